@@ -29,6 +29,7 @@ const EnvVaultTLSServerName = "VAULT_TLS_SERVER_NAME"
 const EnvVaultWrapTTL = "VAULT_WRAP_TTL"
 const EnvVaultMaxRetries = "VAULT_MAX_RETRIES"
 const EnvVaultToken = "VAULT_TOKEN"
+const EnvVaultNamespace = "VAULT_NAMESPACE"
 
 // WrappingLookupFunc is a function that, given an HTTP verb and a path,
 // returns an optional string duration to be used for response wrapping (e.g.
@@ -224,6 +225,7 @@ type Client struct {
 	addr               *url.URL
 	config             *Config
 	token              string
+	namespace          string
 	wrappingLookupFunc WrappingLookupFunc
 }
 
@@ -279,6 +281,10 @@ func NewClient(c *Config) (*Client, error) {
 		client.SetToken(token)
 	}
 
+	if namespace := os.Getenv(EnvVaultNamespace); namespace != "" {
+		client.SetNamespace(namespace)
+	}
+
 	return client, nil
 }
 
@@ -322,6 +328,18 @@ func (c *Client) SetToken(v string) {
 	c.token = v
 }
 
+// Namespace returns the namespace the requests of this client are made
+// within. It will return the empty string for the root namespace.
+func (c *Client) Namespace() string {
+	return c.namespace
+}
+
+// SetNamespace sets the namespace the requests of this client are made
+// within. The paths of the requests are relative to the namespace.
+func (c *Client) SetNamespace(namespace string) {
+	c.namespace = namespace
+}
+
 // ClearToken deletes the token if it is set or does nothing otherwise.
 func (c *Client) ClearToken() {
 	c.token = ""
@@ -345,6 +363,7 @@ func (c *Client) NewRequest(method, requestPath string) *Request {
 			Path:   path.Join(c.addr.Path, requestPath),
 		},
 		ClientToken: c.token,
+		Namespace:   c.namespace,
 		Params:      make(map[string][]string),
 	}
 
@@ -85,6 +85,36 @@ func TestClientToken(t *testing.T) {
 	}
 }
 
+func TestClientNamespace(t *testing.T) {
+	var namespace string
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		namespace = req.Header.Get("X-Vault-Namespace")
+	}
+
+	config, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	client.SetNamespace("ns1/")
+	if v := client.Namespace(); v != "ns1/" {
+		t.Fatalf("bad: %s", v)
+	}
+
+	// The namespace is sent with the requests
+	resp, err := client.RawRequest(client.NewRequest("GET", "/"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	resp.Body.Close()
+	if namespace != "ns1/" {
+		t.Fatalf("bad: %s", namespace)
+	}
+}
+
 func TestClientRedirect(t *testing.T) {
 	primary := func(w http.ResponseWriter, req *http.Request) {
 		w.Write([]byte("test"))
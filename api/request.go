@@ -16,6 +16,7 @@ type Request struct {
 	Params      url.Values
 	Headers     http.Header
 	ClientToken string
+	Namespace   string
 	WrapTTL     string
 	Obj         interface{}
 	Body        io.Reader
@@ -73,6 +74,10 @@ func (r *Request) ToHTTP() (*http.Request, error) {
 		req.Header.Set("X-Vault-Token", r.ClientToken)
 	}
 
+	if len(r.Namespace) != 0 {
+		req.Header.Set("X-Vault-Namespace", r.Namespace)
+	}
+
 	if len(r.WrapTTL) != 0 {
 		req.Header.Set("X-Vault-Wrap-TTL", r.WrapTTL)
 	}
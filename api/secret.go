@@ -40,6 +40,7 @@ type Secret struct {
 // available in WrappedAccessor.
 type SecretWrapInfo struct {
 	Token           string    `json:"token"`
+	Accessor        string    `json:"accessor"`
 	TTL             int       `json:"ttl"`
 	CreationTime    time.Time `json:"creation_time"`
 	WrappedAccessor string    `json:"wrapped_accessor"`
@@ -54,6 +55,28 @@ type SecretAuth struct {
 
 	LeaseDuration int  `json:"lease_duration"`
 	Renewable     bool `json:"renewable"`
+
+	// MFARequirement is set instead of ClientToken when the login must be
+	// completed with Sys().MFAValidate
+	MFARequirement *MFARequirement `json:"mfa_requirement"`
+}
+
+// MFARequirement is the MFA a login must complete before a token is issued
+type MFARequirement struct {
+	MFARequestID   string                       `json:"mfa_request_id"`
+	MFAConstraints map[string]*MFAConstraintAny `json:"mfa_constraints"`
+}
+
+// MFAConstraintAny is a constraint satisfied by any of its methods
+type MFAConstraintAny struct {
+	Any []*MFAMethodID `json:"any"`
+}
+
+// MFAMethodID describes an MFA method a login can be completed with
+type MFAMethodID struct {
+	Type         string `json:"type"`
+	ID           string `json:"id"`
+	UsesPasscode bool   `json:"uses_passcode"`
 }
 
 // ParseSecret is used to parse a secret value from JSON from an io.Reader.
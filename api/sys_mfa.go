@@ -0,0 +1,24 @@
+package api
+
+// MFAValidate completes a login which returned an MFA requirement. The
+// payload maps the IDs of the MFA methods used to their passcodes, which are
+// empty for methods using push notifications.
+func (c *Sys) MFAValidate(requestID string, payload map[string][]string) (*Secret, error) {
+	r := c.c.NewRequest("PUT", "/v1/sys/mfa/validate")
+
+	body := map[string]interface{}{
+		"mfa_request_id": requestID,
+		"mfa_payload":    payload,
+	}
+	if err := r.SetJSONBody(body); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ParseSecret(resp.Body)
+}
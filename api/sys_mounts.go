@@ -130,6 +130,9 @@ type MountConfigInput struct {
 	DefaultLeaseTTL string `json:"default_lease_ttl" structs:"default_lease_ttl" mapstructure:"default_lease_ttl"`
 	MaxLeaseTTL     string `json:"max_lease_ttl" structs:"max_lease_ttl" mapstructure:"max_lease_ttl"`
 	ForceNoCache    bool   `json:"force_no_cache" structs:"force_no_cache" mapstructure:"force_no_cache"`
+
+	DefaultWrappingTTL string `json:"default_wrapping_ttl" structs:"default_wrapping_ttl" mapstructure:"default_wrapping_ttl"`
+	MaxWrappingTTL     string `json:"max_wrapping_ttl" structs:"max_wrapping_ttl" mapstructure:"max_wrapping_ttl"`
 }
 
 type MountOutput struct {
@@ -143,4 +146,17 @@ type MountConfigOutput struct {
 	DefaultLeaseTTL int  `json:"default_lease_ttl" structs:"default_lease_ttl" mapstructure:"default_lease_ttl"`
 	MaxLeaseTTL     int  `json:"max_lease_ttl" structs:"max_lease_ttl" mapstructure:"max_lease_ttl"`
 	ForceNoCache    bool `json:"force_no_cache" structs:"force_no_cache" mapstructure:"force_no_cache"`
+
+	DefaultWrappingTTL int `json:"default_wrapping_ttl" structs:"default_wrapping_ttl" mapstructure:"default_wrapping_ttl"`
+	MaxWrappingTTL     int `json:"max_wrapping_ttl" structs:"max_wrapping_ttl" mapstructure:"max_wrapping_ttl"`
+
+	// TokenType and UserLockoutConfig are only returned for auth mounts
+	TokenType         string                   `json:"token_type,omitempty" structs:"token_type" mapstructure:"token_type"`
+	UserLockoutConfig *UserLockoutConfigOutput `json:"user_lockout_config,omitempty" structs:"user_lockout_config" mapstructure:"user_lockout_config"`
+}
+
+type UserLockoutConfigOutput struct {
+	LockoutThreshold            int `json:"lockout_threshold" structs:"lockout_threshold" mapstructure:"lockout_threshold"`
+	LockoutDuration             int `json:"lockout_duration" structs:"lockout_duration" mapstructure:"lockout_duration"`
+	LockoutCounterResetDuration int `json:"lockout_counter_reset_duration" structs:"lockout_counter_reset_duration" mapstructure:"lockout_counter_reset_duration"`
 }
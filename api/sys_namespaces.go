@@ -0,0 +1,98 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// ListNamespaces returns the names of the namespaces directly within the
+// namespace of the client
+func (c *Sys) ListNamespaces() ([]string, error) {
+	r := c.c.NewRequest("LIST", "/v1/sys/namespaces")
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+		if resp.StatusCode == 404 {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	var result struct {
+		Keys []string `mapstructure:"keys"`
+	}
+	err = mapstructure.Decode(secret.Data, &result)
+	return result.Keys, err
+}
+
+// GetNamespace returns the namespace with the given name within the namespace
+// of the client, or nil if it does not exist
+func (c *Sys) GetNamespace(name string) (*NamespaceOutput, error) {
+	r := c.c.NewRequest("GET", fmt.Sprintf("/v1/sys/namespaces/%s", name))
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+		if resp.StatusCode == 404 {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseNamespaceOutput(resp)
+}
+
+// CreateNamespace creates a namespace with the given name within the namespace
+// of the client
+func (c *Sys) CreateNamespace(name string) (*NamespaceOutput, error) {
+	r := c.c.NewRequest("POST", fmt.Sprintf("/v1/sys/namespaces/%s", name))
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return parseNamespaceOutput(resp)
+}
+
+// DeleteNamespace deletes the namespace with the given name within the
+// namespace of the client
+func (c *Sys) DeleteNamespace(name string) error {
+	r := c.c.NewRequest("DELETE", fmt.Sprintf("/v1/sys/namespaces/%s", name))
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+func parseNamespaceOutput(resp *Response) (*NamespaceOutput, error) {
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("data from server response is empty")
+	}
+
+	var result NamespaceOutput
+	err = mapstructure.Decode(secret.Data, &result)
+	return &result, err
+}
+
+type NamespaceOutput struct {
+	ID   string `mapstructure:"id"`
+	Path string `mapstructure:"path"`
+}
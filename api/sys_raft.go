@@ -0,0 +1,356 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// RaftJoin adds the node to the raft cluster of the node with the given raft
+// address. The node must not be initialized.
+func (c *Sys) RaftJoin(opts *RaftJoinRequest) (*RaftJoinResponse, error) {
+	r := c.c.NewRequest("PUT", "/v1/sys/storage/raft/join")
+	if err := r.SetJSONBody(opts); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result RaftJoinResponse
+	err = resp.DecodeJSON(&result)
+	return &result, err
+}
+
+// RaftConfiguration returns the membership of the raft cluster
+func (c *Sys) RaftConfiguration() (*RaftConfiguration, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/storage/raft/configuration")
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("data from server response is empty")
+	}
+
+	var result RaftConfiguration
+	err = mapstructure.WeakDecode(secret.Data, &result)
+	return &result, err
+}
+
+// RaftRemovePeer removes the server with the given node ID from the raft
+// cluster
+func (c *Sys) RaftRemovePeer(serverID string) error {
+	r := c.c.NewRequest("PUT", "/v1/sys/storage/raft/remove-peer")
+	if err := r.SetJSONBody(map[string]interface{}{
+		"server_id": serverID,
+	}); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// RaftTransferLeadership hands the leadership of the raft cluster over to
+// the voter with the given node ID, or to the most up to date voter if empty
+func (c *Sys) RaftTransferLeadership(serverID string) error {
+	r := c.c.NewRequest("PUT", "/v1/sys/storage/raft/transfer-leadership")
+	if err := r.SetJSONBody(map[string]interface{}{
+		"server_id": serverID,
+	}); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// RaftSnapshot returns a snapshot of the raft storage
+func (c *Sys) RaftSnapshot() ([]byte, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/storage/raft/snapshot")
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// RaftSnapshotRestore replaces the data of the raft cluster with the data of
+// a snapshot. Forced restores accept snapshots encrypted with other keys,
+// after which the node must be unsealed with the keys of the snapshot.
+func (c *Sys) RaftSnapshotRestore(snapshot []byte, force bool) error {
+	path := "/v1/sys/storage/raft/snapshot"
+	if force {
+		path = "/v1/sys/storage/raft/snapshot-force"
+	}
+	r := c.c.NewRequest("PUT", path)
+	r.Body = bytes.NewReader(snapshot)
+	r.BodySize = int64(len(snapshot))
+	r.Headers = http.Header{}
+	r.Headers.Set("Content-Type", "application/octet-stream")
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// RaftAutopilotConfiguration returns the autopilot configuration of the
+// raft cluster
+func (c *Sys) RaftAutopilotConfiguration() (*RaftAutopilotConfig, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/storage/raft/autopilot/configuration")
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("data from server response is empty")
+	}
+
+	var result RaftAutopilotConfig
+	err = mapstructure.WeakDecode(secret.Data, &result)
+	return &result, err
+}
+
+// PutRaftAutopilotConfiguration updates the autopilot configuration of the
+// raft cluster. The durations are given as strings, such as "10s".
+func (c *Sys) PutRaftAutopilotConfiguration(opts map[string]interface{}) error {
+	r := c.c.NewRequest("PUT", "/v1/sys/storage/raft/autopilot/configuration")
+	if err := r.SetJSONBody(opts); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// RaftAutopilotState returns the health of the raft cluster
+func (c *Sys) RaftAutopilotState() (*RaftAutopilotState, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/storage/raft/autopilot/state")
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("data from server response is empty")
+	}
+
+	var result RaftAutopilotState
+	err = mapstructure.WeakDecode(secret.Data, &result)
+	return &result, err
+}
+
+// ListRaftSnapshotAutoConfigs returns the names of the automated snapshot
+// configurations
+func (c *Sys) ListRaftSnapshotAutoConfigs() ([]string, error) {
+	r := c.c.NewRequest("LIST", "/v1/sys/storage/raft/snapshot-auto/config")
+	resp, err := c.c.RawRequest(r)
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	var result struct {
+		Keys []string `mapstructure:"keys"`
+	}
+	err = mapstructure.WeakDecode(secret.Data, &result)
+	return result.Keys, err
+}
+
+// RaftSnapshotAutoConfig returns the named automated snapshot configuration,
+// or nil if it does not exist
+func (c *Sys) RaftSnapshotAutoConfig(name string) (*RaftSnapshotAutoConfig, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/storage/raft/snapshot-auto/config/"+name)
+	resp, err := c.c.RawRequest(r)
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("data from server response is empty")
+	}
+
+	var result RaftSnapshotAutoConfig
+	err = mapstructure.WeakDecode(secret.Data, &result)
+	return &result, err
+}
+
+// PutRaftSnapshotAutoConfig creates or updates an automated snapshot
+// configuration. The parameters which are not given are kept.
+func (c *Sys) PutRaftSnapshotAutoConfig(name string, opts map[string]interface{}) error {
+	r := c.c.NewRequest("PUT", "/v1/sys/storage/raft/snapshot-auto/config/"+name)
+	if err := r.SetJSONBody(opts); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// DeleteRaftSnapshotAutoConfig deletes an automated snapshot configuration
+func (c *Sys) DeleteRaftSnapshotAutoConfig(name string) error {
+	r := c.c.NewRequest("DELETE", "/v1/sys/storage/raft/snapshot-auto/config/"+name)
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// RaftSnapshotAutoStatus returns the outcome of the automated snapshots of a
+// configuration
+func (c *Sys) RaftSnapshotAutoStatus(name string) (*RaftSnapshotAutoStatus, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/storage/raft/snapshot-auto/status/"+name)
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("data from server response is empty")
+	}
+
+	var result RaftSnapshotAutoStatus
+	err = mapstructure.WeakDecode(secret.Data, &result)
+	return &result, err
+}
+
+type RaftJoinRequest struct {
+	LeaderAddress string `json:"leader_address"`
+	NonVoter      bool   `json:"non_voter"`
+}
+
+type RaftJoinResponse struct {
+	Joined bool `json:"joined"`
+}
+
+type RaftServer struct {
+	NodeID         string `json:"node_id" mapstructure:"node_id"`
+	Address        string `json:"address" mapstructure:"address"`
+	Leader         bool   `json:"leader" mapstructure:"leader"`
+	Voter          bool   `json:"voter" mapstructure:"voter"`
+	RedundancyZone string `json:"redundancy_zone" mapstructure:"redundancy_zone"`
+}
+
+type RaftConfiguration struct {
+	Servers []*RaftServer `json:"servers" mapstructure:"servers"`
+	Index   uint64        `json:"index" mapstructure:"index"`
+}
+
+type RaftAutopilotConfig struct {
+	CleanupDeadServers             bool   `json:"cleanup_dead_servers" mapstructure:"cleanup_dead_servers"`
+	LastContactThreshold           string `json:"last_contact_threshold" mapstructure:"last_contact_threshold"`
+	DeadServerLastContactThreshold string `json:"dead_server_last_contact_threshold" mapstructure:"dead_server_last_contact_threshold"`
+	MaxTrailingLogs                uint64 `json:"max_trailing_logs" mapstructure:"max_trailing_logs"`
+	MinQuorum                      int    `json:"min_quorum" mapstructure:"min_quorum"`
+	ServerStabilizationTime        string `json:"server_stabilization_time" mapstructure:"server_stabilization_time"`
+}
+
+type RaftAutopilotServer struct {
+	NodeID         string `json:"node_id" mapstructure:"node_id"`
+	Address        string `json:"address" mapstructure:"address"`
+	Status         string `json:"status" mapstructure:"status"`
+	Healthy        bool   `json:"healthy" mapstructure:"healthy"`
+	LastContact    string `json:"last_contact" mapstructure:"last_contact"`
+	LastIndex      uint64 `json:"last_index" mapstructure:"last_index"`
+	StableSince    string `json:"stable_since" mapstructure:"stable_since"`
+	RedundancyZone string `json:"redundancy_zone" mapstructure:"redundancy_zone"`
+}
+
+type RaftAutopilotZone struct {
+	Servers          []string `json:"servers" mapstructure:"servers"`
+	Voters           []string `json:"voters" mapstructure:"voters"`
+	FailureTolerance int      `json:"failure_tolerance" mapstructure:"failure_tolerance"`
+}
+
+type RaftAutopilotState struct {
+	Healthy          bool                            `json:"healthy" mapstructure:"healthy"`
+	FailureTolerance int                             `json:"failure_tolerance" mapstructure:"failure_tolerance"`
+	Leader           string                          `json:"leader" mapstructure:"leader"`
+	Voters           []string                        `json:"voters" mapstructure:"voters"`
+	Servers          map[string]*RaftAutopilotServer `json:"servers" mapstructure:"servers"`
+	RedundancyZones  map[string]*RaftAutopilotZone   `json:"redundancy_zones" mapstructure:"redundancy_zones"`
+}
+
+type RaftSnapshotAutoConfig struct {
+	Interval    int               `json:"interval" mapstructure:"interval"`
+	Retain      int               `json:"retain" mapstructure:"retain"`
+	PathPrefix  string            `json:"path_prefix" mapstructure:"path_prefix"`
+	FilePrefix  string            `json:"file_prefix" mapstructure:"file_prefix"`
+	StorageType string            `json:"storage_type" mapstructure:"storage_type"`
+	Parameters  map[string]string `json:"parameters" mapstructure:"parameters"`
+}
+
+type RaftSnapshotAutoStatus struct {
+	LastSnapshotStart string `json:"last_snapshot_start" mapstructure:"last_snapshot_start"`
+	LastSnapshotEnd   string `json:"last_snapshot_end" mapstructure:"last_snapshot_end"`
+	LastSnapshotName  string `json:"last_snapshot_name" mapstructure:"last_snapshot_name"`
+	LastSnapshotSize  int    `json:"last_snapshot_size" mapstructure:"last_snapshot_size"`
+	LastError         string `json:"last_error" mapstructure:"last_error"`
+	ConsecutiveErrors int    `json:"consecutive_errors" mapstructure:"consecutive_errors"`
+	NextSnapshotStart string `json:"next_snapshot_start" mapstructure:"next_snapshot_start"`
+}
@@ -47,6 +47,10 @@ type backend struct {
 	// secretIDListingLock is a dedicated lock for listing SecretIDAccessors
 	// for all the SecretIDs issued against an approle
 	secretIDListingLock sync.RWMutex
+
+	// accessorIndexUpgraded is set once the accessors of SecretIDs are
+	// indexed per role
+	accessorIndexUpgraded uint32
 }
 
 func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
@@ -136,6 +140,11 @@ func (b *backend) invalidate(key string) {
 // expiration. The deletion of SecretIDs are not security sensitive and it is okay
 // to delay the removal of SecretIDs by a minute.
 func (b *backend) periodicFunc(req *logical.Request) error {
+	// Index the accessors of SecretIDs created by previous versions
+	if err := b.upgradeSecretIDAccessorIndex(req.Storage); err != nil {
+		b.Logger().Error("approle: failed to upgrade secret ID accessor index", "error", err)
+	}
+
 	// Initiate clean-up of expired SecretID entries
 	b.tidySecretID(req.Storage)
 	return nil
@@ -33,7 +33,7 @@ func pathLogin(b *backend) *framework.Path {
 // Returns the Auth object indicating the authentication and authorization information
 // if the credentials provided are validated by the backend.
 func (b *backend) pathLoginUpdate(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	role, roleName, metadata, err := b.validateCredentials(req, data)
+	role, roleName, secretIDEntry, err := b.validateCredentials(req, data)
 	if err != nil || role == nil {
 		return logical.ErrorResponse(fmt.Sprintf("failed to validate SecretID: %s", err)), nil
 	}
@@ -44,13 +44,22 @@ func (b *backend) pathLoginUpdate(req *logical.Request, data *framework.FieldDat
 		InternalData: map[string]interface{}{
 			"role_name": roleName,
 		},
-		Metadata: metadata,
-		Policies: role.Policies,
+		Policies:   role.Policies,
+		BoundCIDRs: role.TokenBoundCIDRs,
 		LeaseOptions: logical.LeaseOptions{
 			Renewable: true,
 		},
 	}
 
+	// The metadata and the token CIDR restrictions of the SecretID are
+	// attached to the token
+	if secretIDEntry != nil {
+		auth.Metadata = secretIDEntry.Metadata
+		if len(secretIDEntry.TokenBoundCIDRs) != 0 {
+			auth.BoundCIDRs = secretIDEntry.TokenBoundCIDRs
+		}
+	}
+
 	// If 'Period' is set, use the value of 'Period' as the TTL.
 	// Otherwise, set the normal TokenTTL.
 	if role.Period > time.Duration(0) {
@@ -1,6 +1,7 @@
 package approle
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/hashicorp/vault/logical"
@@ -56,3 +57,99 @@ func TestAppRole_RoleLogin(t *testing.T) {
 		t.Fatalf("expected a non-nil auth object in the response")
 	}
 }
+
+func TestAppRole_SecretIDConstraints(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	roleReq := &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "role/role1",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"policies":           "a",
+			"secret_id_num_uses": 5,
+			"secret_id_ttl":      "1h",
+			"token_bound_cidrs":  "10.0.0.0/8",
+		},
+	}
+	resp, err := b.HandleRequest(roleReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "role/role1/role-id",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	roleID := resp.Data["role_id"]
+
+	// Constraints less restrictive than the role's are rejected
+	for _, data := range []map[string]interface{}{
+		{"num_uses": 6},
+		{"num_uses": 0},
+		{"ttl": "2h"},
+		{"token_bound_cidrs": "192.168.0.0/16"},
+	} {
+		resp, err = b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/role1/secret-id",
+			Storage:   storage,
+			Data:      data,
+		})
+		if err == nil && (resp == nil || !resp.IsError()) {
+			t.Fatalf("expected error for %#v", data)
+		}
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/role1/secret-id",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"num_uses":          1,
+			"ttl":               "10m",
+			"token_bound_cidrs": "10.1.0.0/16",
+			"metadata":          `{"team": "payments"}`,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["secret_id_num_uses"] != 1 || resp.Data["secret_id_ttl"] != int64(600) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	secretID := resp.Data["secret_id"]
+
+	loginReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "login",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"role_id":   roleID,
+			"secret_id": secretID,
+		},
+		Connection: &logical.Connection{
+			RemoteAddr: "127.0.0.1",
+		},
+	}
+	resp, err = b.HandleRequest(loginReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if !reflect.DeepEqual(resp.Auth.BoundCIDRs, []string{"10.1.0.0/16"}) {
+		t.Fatalf("bad: %#v", resp.Auth.BoundCIDRs)
+	}
+	if resp.Auth.Metadata["team"] != "payments" {
+		t.Fatalf("bad: %#v", resp.Auth.Metadata)
+	}
+
+	// The secret ID could only be used once
+	resp, err = b.HandleRequest(loginReq)
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("expected error reusing the secret ID")
+	}
+}
@@ -2,6 +2,7 @@ package approle
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -51,6 +52,10 @@ type roleStorageEntry struct {
 	// A constraint, if set, specifies the CIDR blocks from which logins should be allowed
 	BoundCIDRList string `json:"bound_cidr_list" structs:"bound_cidr_list" mapstructure:"bound_cidr_list"`
 
+	// A constraint, if set, specifies the CIDR blocks from which the issued
+	// tokens can be used
+	TokenBoundCIDRs []string `json:"token_bound_cidrs" structs:"token_bound_cidrs" mapstructure:"token_bound_cidrs"`
+
 	// Period, if set, indicates that the token generated using this role
 	// should never expire. The token should be renewed within the duration
 	// specified by this value. The renewal duration will be fixed if the
@@ -77,9 +82,10 @@ type roleIDStorageEntry struct {
 // role/<role_name>/token-num-uses - For updating the param
 // role/<role_name>/bind-secret-id - For updating the param
 // role/<role_name>/bound-cidr-list - For updating the param
+// role/<role_name>/token-bound-cidrs - For updating the param
 // role/<role_name>/period - For updating the param
 // role/<role_name>/role-id - For fetching the role_id of an role
-// role/<role_name>/secret-id - For issuing a secret_id against an role, also to list the secret_id_accessorss
+// role/<role_name>/secret-id - For issuing a secret_id against an role, also to list the secret_id_accessors and their properties
 // role/<role_name>/custom-secret-id - For assigning a custom SecretID against an role
 // role/<role_name>/secret-id/lookup - For reading the properties of a secret_id
 // role/<role_name>/secret-id/destroy - For deleting a secret_id
@@ -111,6 +117,11 @@ func rolePaths(b *backend) []*framework.Path {
 					Type: framework.TypeString,
 					Description: `Comma separated list of CIDR blocks, if set, specifies blocks of IP
 addresses which can perform the login operation`,
+				},
+				"token_bound_cidrs": &framework.FieldSchema{
+					Type: framework.TypeCommaStringSlice,
+					Description: `Comma separated list of CIDR blocks, if set, specifies blocks of IP
+addresses which can use the issued tokens`,
 				},
 				"policies": &framework.FieldSchema{
 					Type:        framework.TypeString,
@@ -206,6 +217,27 @@ addresses which can perform the login operation`,
 			HelpSynopsis:    strings.TrimSpace(roleHelp["role-bound-cidr-list"][0]),
 			HelpDescription: strings.TrimSpace(roleHelp["role-bound-cidr-list"][1]),
 		},
+		&framework.Path{
+			Pattern: "role/" + framework.GenericNameRegex("role_name") + "/token-bound-cidrs$",
+			Fields: map[string]*framework.FieldSchema{
+				"role_name": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Name of the role.",
+				},
+				"token_bound_cidrs": &framework.FieldSchema{
+					Type: framework.TypeCommaStringSlice,
+					Description: `Comma separated list of CIDR blocks, if set, specifies blocks of IP
+addresses which can use the issued tokens`,
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.pathRoleTokenBoundCIDRsUpdate,
+				logical.ReadOperation:   b.pathRoleTokenBoundCIDRsRead,
+				logical.DeleteOperation: b.pathRoleTokenBoundCIDRsDelete,
+			},
+			HelpSynopsis:    strings.TrimSpace(roleHelp["role-token-bound-cidrs"][0]),
+			HelpDescription: strings.TrimSpace(roleHelp["role-token-bound-cidrs"][1]),
+		},
 		&framework.Path{
 			Pattern: "role/" + framework.GenericNameRegex("role_name") + "/bind-secret-id$",
 			Fields: map[string]*framework.FieldSchema{
@@ -392,6 +424,34 @@ specific set of IP addresses. If 'bound_cidr_list' is set on the role, then the
 list of CIDR blocks listed here should be a subset of the CIDR blocks listed on
 the role.`,
 				},
+				"token_bound_cidrs": &framework.FieldSchema{
+					Type: framework.TypeCommaStringSlice,
+					Description: `Comma separated list of CIDR blocks enforcing the tokens issued using the
+secret ID to be used from specific set of IP addresses. If 'token_bound_cidrs'
+is set on the role, then the list of CIDR blocks listed here should be a subset
+of the CIDR blocks listed on the role.`,
+				},
+				"ttl": &framework.FieldSchema{
+					Type: framework.TypeDurationSecond,
+					Description: `Duration in seconds after which the secret ID expires, overriding the
+'secret_id_ttl' of the role. It cannot be greater than the 'secret_id_ttl' of
+the role, if set.`,
+				},
+				"num_uses": &framework.FieldSchema{
+					Type: framework.TypeInt,
+					Description: `Number of times the secret ID can be used, overriding the
+'secret_id_num_uses' of the role. It cannot be greater than the
+'secret_id_num_uses' of the role, if set.`,
+				},
+				"after": &framework.FieldSchema{
+					Type: framework.TypeString,
+					Description: `When listing, the accessor after which to start the page. Accessors are
+listed in an arbitrary but stable order.`,
+				},
+				"limit": &framework.FieldSchema{
+					Type:        framework.TypeInt,
+					Description: "When listing, the maximum number of accessors to return. Zero returns all of them.",
+				},
 			},
 			Callbacks: map[logical.Operation]framework.OperationFunc{
 				logical.UpdateOperation: b.pathRoleSecretIDUpdate,
@@ -452,8 +512,8 @@ the role.`,
 			Callbacks: map[logical.Operation]framework.OperationFunc{
 				logical.UpdateOperation: b.pathRoleSecretIDAccessorLookupUpdate,
 			},
-			HelpSynopsis:    strings.TrimSpace(roleHelp["role-secret-id-accessor"][0]),
-			HelpDescription: strings.TrimSpace(roleHelp["role-secret-id-accessor"][1]),
+			HelpSynopsis:    strings.TrimSpace(roleHelp["role-secret-id-accessor-lookup"][0]),
+			HelpDescription: strings.TrimSpace(roleHelp["role-secret-id-accessor-lookup"][1]),
 		},
 		&framework.Path{
 			Pattern: "role/" + framework.GenericNameRegex("role_name") + "/secret-id-accessor/destroy/?$",
@@ -471,8 +531,8 @@ the role.`,
 				logical.UpdateOperation: b.pathRoleSecretIDAccessorDestroyUpdateDelete,
 				logical.DeleteOperation: b.pathRoleSecretIDAccessorDestroyUpdateDelete,
 			},
-			HelpSynopsis:    strings.TrimSpace(roleHelp["role-secret-id-accessor"][0]),
-			HelpDescription: strings.TrimSpace(roleHelp["role-secret-id-accessor"][1]),
+			HelpSynopsis:    strings.TrimSpace(roleHelp["role-secret-id-accessor-destroy"][0]),
+			HelpDescription: strings.TrimSpace(roleHelp["role-secret-id-accessor-destroy"][1]),
 		},
 		&framework.Path{
 			Pattern: "role/" + framework.GenericNameRegex("role_name") + "/custom-secret-id$",
@@ -497,6 +557,25 @@ specific set of IP addresses. If 'bound_cidr_list' is set on the role, then the
 list of CIDR blocks listed here should be a subset of the CIDR blocks listed on
 the role.`,
 				},
+				"token_bound_cidrs": &framework.FieldSchema{
+					Type: framework.TypeCommaStringSlice,
+					Description: `Comma separated list of CIDR blocks enforcing the tokens issued using the
+secret ID to be used from specific set of IP addresses. If 'token_bound_cidrs'
+is set on the role, then the list of CIDR blocks listed here should be a subset
+of the CIDR blocks listed on the role.`,
+				},
+				"ttl": &framework.FieldSchema{
+					Type: framework.TypeDurationSecond,
+					Description: `Duration in seconds after which the secret ID expires, overriding the
+'secret_id_ttl' of the role. It cannot be greater than the 'secret_id_ttl' of
+the role, if set.`,
+				},
+				"num_uses": &framework.FieldSchema{
+					Type: framework.TypeInt,
+					Description: `Number of times the secret ID can be used, overriding the
+'secret_id_num_uses' of the role. It cannot be greater than the
+'secret_id_num_uses' of the role, if set.`,
+				},
 			},
 			Callbacks: map[logical.Operation]framework.OperationFunc{
 				logical.UpdateOperation: b.pathRoleCustomSecretIDUpdate,
@@ -531,12 +610,20 @@ func (b *backend) pathRoleList(req *logical.Request, data *framework.FieldData)
 }
 
 // pathRoleSecretIDList is used to list all the 'secret_id_accessor's issued against the role.
+// Accessors are listed from their index, and with a limit only the SecretIDs
+// of the listed page are read.
 func (b *backend) pathRoleSecretIDList(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	roleName := data.Get("role_name").(string)
 	if roleName == "" {
 		return logical.ErrorResponse("missing role_name"), nil
 	}
 
+	after := data.Get("after").(string)
+	limit := data.Get("limit").(int)
+	if limit < 0 {
+		return logical.ErrorResponse("limit cannot be negative"), nil
+	}
+
 	// Get the role entry
 	role, err := b.roleEntry(req.Storage, strings.ToLower(roleName))
 	if err != nil {
@@ -546,6 +633,10 @@ func (b *backend) pathRoleSecretIDList(req *logical.Request, data *framework.Fie
 		return logical.ErrorResponse(fmt.Sprintf("role %s does not exist", roleName)), nil
 	}
 
+	if err := b.upgradeSecretIDAccessorIndex(req.Storage); err != nil {
+		return nil, err
+	}
+
 	// Guard the list operation with an outer lock
 	b.secretIDListingLock.RLock()
 	defer b.secretIDListingLock.RUnlock()
@@ -555,22 +646,48 @@ func (b *backend) pathRoleSecretIDList(req *logical.Request, data *framework.Fie
 		return nil, fmt.Errorf("failed to create HMAC of role_name: %s", err)
 	}
 
-	// Listing works one level at a time. Get the first level of data
-	// which could then be used to get the actual SecretID storage entries.
-	secretIDHMACs, err := req.Storage.List(fmt.Sprintf("secret_id/%s/", roleNameHMAC))
+	// Accessors are indexed by their salted value, which orders the pages
+	accessorIndexes, err := req.Storage.List(fmt.Sprintf("secret_id_accessor/%s/", roleNameHMAC))
 	if err != nil {
 		return nil, err
 	}
+	sort.Strings(accessorIndexes)
+
+	if after != "" {
+		salt, err := b.Salt()
+		if err != nil {
+			return nil, err
+		}
+		saltedAfter := salt.SaltID(after)
+		start := sort.SearchStrings(accessorIndexes, saltedAfter)
+		if start < len(accessorIndexes) && accessorIndexes[start] == saltedAfter {
+			start++
+		}
+		accessorIndexes = accessorIndexes[start:]
+	}
+	if limit > 0 && len(accessorIndexes) > limit {
+		accessorIndexes = accessorIndexes[:limit]
+	}
 
 	var listItems []string
-	for _, secretIDHMAC := range secretIDHMACs {
+	keyInfo := make(map[string]interface{}, len(accessorIndexes))
+	for _, accessorIndex := range accessorIndexes {
 		// For sanity
-		if secretIDHMAC == "" {
+		if accessorIndex == "" {
+			continue
+		}
+
+		var accessorEntry secretIDAccessorStorageEntry
+		if entry, err := req.Storage.Get(fmt.Sprintf("secret_id_accessor/%s/%s", roleNameHMAC, accessorIndex)); err != nil {
+			return nil, err
+		} else if entry == nil {
 			continue
+		} else if err := entry.DecodeJSON(&accessorEntry); err != nil {
+			return nil, err
 		}
 
 		// Prepare the full index of the SecretIDs.
-		entryIndex := fmt.Sprintf("secret_id/%s/%s", roleNameHMAC, secretIDHMAC)
+		entryIndex := fmt.Sprintf("secret_id/%s/%s", roleNameHMAC, accessorEntry.SecretIDHMAC)
 
 		// SecretID locks are not indexed by SecretIDs itself.
 		// This is because SecretIDs are not stored in plaintext
@@ -578,7 +695,7 @@ func (b *backend) pathRoleSecretIDList(req *logical.Request, data *framework.Fie
 		// corresponding lock many times using SecretIDs is not
 		// possible. Also, indexing it everywhere using secretIDHMACs
 		// makes listing operation easier.
-		secretIDLock := b.secretIDLock(secretIDHMAC)
+		secretIDLock := b.secretIDLock(accessorEntry.SecretIDHMAC)
 
 		secretIDLock.RLock()
 
@@ -587,17 +704,25 @@ func (b *backend) pathRoleSecretIDList(req *logical.Request, data *framework.Fie
 			secretIDLock.RUnlock()
 			return nil, err
 		} else if entry == nil {
+			// The SecretID was deleted after the accessors were listed
 			secretIDLock.RUnlock()
-			return nil, fmt.Errorf("storage entry for SecretID is present but no content found at the index")
+			continue
 		} else if err := entry.DecodeJSON(&result); err != nil {
 			secretIDLock.RUnlock()
 			return nil, err
 		}
 		listItems = append(listItems, result.SecretIDAccessor)
+		keyInfo[result.SecretIDAccessor] = map[string]interface{}{
+			"creation_time":      result.CreationTime.Format(time.RFC3339Nano),
+			"expiration_time":    result.ExpirationTime.Format(time.RFC3339Nano),
+			"last_updated_time":  result.LastUpdatedTime.Format(time.RFC3339Nano),
+			"secret_id_num_uses": result.SecretIDNumUses,
+			"metadata":           result.Metadata,
+		}
 		secretIDLock.RUnlock()
 	}
 
-	return logical.ListResponse(listItems), nil
+	return logical.ListResponseWithInfo(listItems, keyInfo), nil
 }
 
 // validateRoleConstraints checks if the role has at least one constraint
@@ -767,6 +892,20 @@ func (b *backend) pathRoleCreateUpdate(req *logical.Request, data *framework.Fie
 		}
 	}
 
+	if tokenBoundCIDRsRaw, ok := data.GetOk("token_bound_cidrs"); ok {
+		role.TokenBoundCIDRs = tokenBoundCIDRsRaw.([]string)
+	}
+
+	if len(role.TokenBoundCIDRs) != 0 {
+		valid, err := cidrutil.ValidateCIDRListSlice(role.TokenBoundCIDRs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to validate CIDR blocks: %v", err)
+		}
+		if !valid {
+			return logical.ErrorResponse("invalid CIDR blocks"), nil
+		}
+	}
+
 	if policiesRaw, ok := data.GetOk("policies"); ok {
 		role.Policies = policyutil.ParsePolicies(policiesRaw.(string))
 	} else if req.Operation == logical.CreateOperation {
@@ -1030,7 +1169,7 @@ func (b *backend) pathRoleSecretIDDestroyUpdateDelete(req *logical.Request, data
 	}
 
 	// Delete the accessor of the SecretID first
-	if err := b.deleteSecretIDAccessorEntry(req.Storage, result.SecretIDAccessor); err != nil {
+	if err := b.deleteSecretIDAccessorEntry(req.Storage, roleNameHMAC, result.SecretIDAccessor); err != nil {
 		return nil, err
 	}
 
@@ -1067,22 +1206,36 @@ func (b *backend) pathRoleSecretIDAccessorLookupUpdate(req *logical.Request, dat
 		return nil, fmt.Errorf("role %s does not exist", roleName)
 	}
 
-	accessorEntry, err := b.secretIDAccessorEntry(req.Storage, secretIDAccessor)
-	if err != nil {
+	if err := b.upgradeSecretIDAccessorIndex(req.Storage); err != nil {
 		return nil, err
 	}
-	if accessorEntry == nil {
-		return nil, fmt.Errorf("failed to find accessor entry for secret_id_accessor:%s\n", secretIDAccessor)
-	}
 
 	roleNameHMAC, err := createHMAC(role.HMACKey, roleName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create HMAC of role_name: %s", err)
 	}
 
+	// Accessors are indexed per role, so accessors of the SecretIDs of
+	// other roles are not found
+	accessorEntry, err := b.secretIDAccessorEntry(req.Storage, roleNameHMAC, secretIDAccessor)
+	if err != nil {
+		return nil, err
+	}
+	if accessorEntry == nil {
+		return logical.ErrorResponse(fmt.Sprintf("failed to find accessor entry for secret_id_accessor %q", secretIDAccessor)), nil
+	}
+
 	entryIndex := fmt.Sprintf("secret_id/%s/%s", roleNameHMAC, accessorEntry.SecretIDHMAC)
 
-	return b.secretIDCommon(req.Storage, entryIndex, accessorEntry.SecretIDHMAC)
+	resp, err := b.secretIDCommon(req.Storage, entryIndex, accessorEntry.SecretIDHMAC)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		// The accessor belongs to a SecretID of another role
+		return logical.ErrorResponse(fmt.Sprintf("secret_id_accessor %q does not belong to role %q", secretIDAccessor, roleName)), nil
+	}
+	return resp, nil
 }
 
 func (b *backend) pathRoleSecretIDAccessorDestroyUpdateDelete(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
@@ -1108,27 +1261,41 @@ func (b *backend) pathRoleSecretIDAccessorDestroyUpdateDelete(req *logical.Reque
 		return nil, fmt.Errorf("role %s does not exist", roleName)
 	}
 
-	accessorEntry, err := b.secretIDAccessorEntry(req.Storage, secretIDAccessor)
-	if err != nil {
+	if err := b.upgradeSecretIDAccessorIndex(req.Storage); err != nil {
 		return nil, err
 	}
-	if accessorEntry == nil {
-		return nil, fmt.Errorf("failed to find accessor entry for secret_id_accessor:%s\n", secretIDAccessor)
-	}
 
 	roleNameHMAC, err := createHMAC(role.HMACKey, roleName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create HMAC of role_name: %s", err)
 	}
 
+	// Accessors are indexed per role, so accessors of the SecretIDs of
+	// other roles are not found
+	accessorEntry, err := b.secretIDAccessorEntry(req.Storage, roleNameHMAC, secretIDAccessor)
+	if err != nil {
+		return nil, err
+	}
+	if accessorEntry == nil {
+		return logical.ErrorResponse(fmt.Sprintf("failed to find accessor entry for secret_id_accessor %q", secretIDAccessor)), nil
+	}
+
 	entryIndex := fmt.Sprintf("secret_id/%s/%s", roleNameHMAC, accessorEntry.SecretIDHMAC)
 
 	lock := b.secretIDLock(accessorEntry.SecretIDHMAC)
 	lock.Lock()
 	defer lock.Unlock()
 
+	// Ensure the accessor belongs to a SecretID of the role, so that
+	// SecretIDs of other roles are left intact
+	if entry, err := req.Storage.Get(entryIndex); err != nil {
+		return nil, err
+	} else if entry == nil {
+		return logical.ErrorResponse(fmt.Sprintf("secret_id_accessor %q does not belong to role %q", secretIDAccessor, roleName)), nil
+	}
+
 	// Delete the accessor of the SecretID first
-	if err := b.deleteSecretIDAccessorEntry(req.Storage, secretIDAccessor); err != nil {
+	if err := b.deleteSecretIDAccessorEntry(req.Storage, roleNameHMAC, secretIDAccessor); err != nil {
 		return nil, err
 	}
 
@@ -1221,6 +1388,85 @@ func (b *backend) pathRoleBoundCIDRListDelete(req *logical.Request, data *framew
 	return nil, b.setRoleEntry(req.Storage, roleName, role, "")
 }
 
+func (b *backend) pathRoleTokenBoundCIDRsUpdate(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role_name").(string)
+	if roleName == "" {
+		return logical.ErrorResponse("missing role_name"), nil
+	}
+
+	role, err := b.roleEntry(req.Storage, strings.ToLower(roleName))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	lock := b.roleLock(roleName)
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	role.TokenBoundCIDRs = data.Get("token_bound_cidrs").([]string)
+	if len(role.TokenBoundCIDRs) == 0 {
+		return logical.ErrorResponse("missing token_bound_cidrs"), nil
+	}
+
+	valid, err := cidrutil.ValidateCIDRListSlice(role.TokenBoundCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate CIDR blocks: %q", err)
+	}
+	if !valid {
+		return logical.ErrorResponse("failed to validate CIDR blocks"), nil
+	}
+
+	return nil, b.setRoleEntry(req.Storage, roleName, role, "")
+}
+
+func (b *backend) pathRoleTokenBoundCIDRsRead(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role_name").(string)
+	if roleName == "" {
+		return logical.ErrorResponse("missing role_name"), nil
+	}
+
+	if role, err := b.roleEntry(req.Storage, strings.ToLower(roleName)); err != nil {
+		return nil, err
+	} else if role == nil {
+		return nil, nil
+	} else {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"token_bound_cidrs": role.TokenBoundCIDRs,
+			},
+		}, nil
+	}
+}
+
+func (b *backend) pathRoleTokenBoundCIDRsDelete(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role_name").(string)
+	if roleName == "" {
+		return logical.ErrorResponse("missing role_name"), nil
+	}
+
+	role, err := b.roleEntry(req.Storage, strings.ToLower(roleName))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	lock := b.roleLock(roleName)
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	// Deleting a field implies setting the value to it's default value.
+	role.TokenBoundCIDRs = nil
+
+	return nil, b.setRoleEntry(req.Storage, roleName, role, "")
+}
+
 func (b *backend) pathRoleBindSecretIDUpdate(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	roleName := data.Get("role_name").(string)
 	if roleName == "" {
@@ -1902,11 +2148,50 @@ func (b *backend) handleRoleSecretIDCommon(req *logical.Request, data *framework
 		return nil, err
 	}
 
+	tokenBoundCIDRs := data.Get("token_bound_cidrs").([]string)
+	if len(tokenBoundCIDRs) != 0 {
+		valid, err := cidrutil.ValidateCIDRListSlice(tokenBoundCIDRs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to validate CIDR blocks: %q", err)
+		}
+		if !valid {
+			return logical.ErrorResponse("failed to validate CIDR blocks"), nil
+		}
+	}
+	if err := verifyCIDRRoleSecretIDSubset(tokenBoundCIDRs, strings.Join(role.TokenBoundCIDRs, ",")); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	// The use limit and the TTL of the SecretID can only be more restrictive
+	// than those of the role
+	numUses := role.SecretIDNumUses
+	if numUsesRaw, ok := data.GetOk("num_uses"); ok {
+		numUses = numUsesRaw.(int)
+		switch {
+		case numUses < 0:
+			return logical.ErrorResponse("num_uses cannot be negative"), nil
+		case role.SecretIDNumUses > 0 && (numUses == 0 || numUses > role.SecretIDNumUses):
+			return logical.ErrorResponse("num_uses cannot be higher than the role's secret_id_num_uses"), nil
+		}
+	}
+
+	ttl := role.SecretIDTTL
+	if ttlRaw, ok := data.GetOk("ttl"); ok {
+		ttl = time.Duration(ttlRaw.(int)) * time.Second
+		switch {
+		case ttl < 0:
+			return logical.ErrorResponse("ttl cannot be negative"), nil
+		case role.SecretIDTTL > 0 && (ttl == 0 || ttl > role.SecretIDTTL):
+			return logical.ErrorResponse("ttl cannot be longer than the role's secret_id_ttl"), nil
+		}
+	}
+
 	secretIDStorage := &secretIDStorageEntry{
-		SecretIDNumUses: role.SecretIDNumUses,
-		SecretIDTTL:     role.SecretIDTTL,
+		SecretIDNumUses: numUses,
+		SecretIDTTL:     ttl,
 		Metadata:        make(map[string]string),
 		CIDRList:        secretIDCIDRs,
+		TokenBoundCIDRs: tokenBoundCIDRs,
 	}
 
 	if err = strutil.ParseArbitraryKeyValues(data.Get("metadata").(string), secretIDStorage.Metadata, ","); err != nil {
@@ -1921,6 +2206,8 @@ func (b *backend) handleRoleSecretIDCommon(req *logical.Request, data *framework
 		Data: map[string]interface{}{
 			"secret_id":          secretID,
 			"secret_id_accessor": secretIDStorage.SecretIDAccessor,
+			"secret_id_ttl":      int64(secretIDStorage.SecretIDTTL.Seconds()),
+			"secret_id_num_uses": secretIDStorage.SecretIDNumUses,
 		},
 	}, nil
 }
@@ -2032,6 +2319,13 @@ addresses which can perform the login operation`,
 		`During login, the IP address of the client will be checked to see if it
 belongs to the CIDR blocks specified. If CIDR blocks were set and if the
 IP is not encompassed by it, login fails`,
+	},
+	"role-token-bound-cidrs": {
+		`Comma separated list of CIDR blocks, if set, specifies blocks of IP
+addresses which can use the issued tokens`,
+		`The tokens issued using the role can only be used from IP addresses
+belonging to the CIDR blocks specified. The 'token_bound_cidrs' of a secret ID,
+which must be a subset of these, override them.`,
 	},
 	"role-policies": {
 		"Policies of the role.",
@@ -2072,9 +2366,8 @@ represents a non-expiring 'secret_id'.`,
 		"Delete an issued secret_id, using its accessor",
 		`This is particularly useful to clean-up the non-expiring 'secret_id's.
 The list operation on the 'role/<role_name>/secret-id' endpoint will return
-the 'secret_id_accessor's. This endpoint can be used to read the properties
-of the secret. If the 'secret_id_num_uses' field in the response is 0, it
-represents a non-expiring 'secret_id'.`,
+the 'secret_id_accessor's. This endpoint can be used to delete a secret_id
+without affecting the other secret_ids of the role.`,
 	},
 	"role-token-num-uses": {
 		"Number of times issued tokens can be used",
@@ -2112,7 +2405,15 @@ this endpoint.`,
 just this role and none else. The properties of this SecretID will be
 based on the options set on the role. It will expire after a period
 defined by the 'secret_id_ttl' option on the role and/or the backend
-mount's maximum TTL value.`,
+mount's maximum TTL value.
+
+The list operation returns the 'secret_id_accessor's of the SecretIDs of the
+role, along with their creation time, expiration time, remaining uses and
+metadata.
+
+The 'ttl', 'num_uses' and 'token_bound_cidrs' options override those of
+the role for this SecretID, and can only be more restrictive. The metadata
+of the SecretID is attached to the tokens issued using it.`,
 	},
 	"role-custom-secret-id": {
 		"Assign a SecretID of choice against the role.",
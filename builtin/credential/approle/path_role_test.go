@@ -2,6 +2,7 @@ package approle
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -612,6 +613,7 @@ func TestAppRole_RoleCRUD(t *testing.T) {
 		"token_max_ttl":      500,
 		"token_num_uses":     600,
 		"bound_cidr_list":    "127.0.0.1/32,127.0.0.1/16",
+		"token_bound_cidrs":  []string{},
 	}
 	var expectedStruct roleStorageEntry
 	err = mapstructure.Decode(expected, &expectedStruct)
@@ -1045,6 +1047,253 @@ func TestAppRole_RoleCRUD(t *testing.T) {
 	}
 }
 
+func TestAppRole_SecretIDAccessors(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	b, storage := createBackendWithStorage(t)
+
+	createRole(t, b, storage, "role1", "a,b")
+	createRole(t, b, storage, "role2", "c")
+
+	accessors := map[string]string{}
+	for _, roleName := range []string{"role1", "role2"} {
+		resp, err = b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/" + roleName + "/secret-id",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"metadata": `{"owner": "` + roleName + `"}`,
+			},
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		accessors[roleName] = resp.Data["secret_id_accessor"].(string)
+	}
+
+	// Listing returns the properties of the SecretIDs
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "role/role1/secret-id",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if !reflect.DeepEqual(resp.Data["keys"], []string{accessors["role1"]}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	info := resp.Data["key_info"].(map[string]interface{})[accessors["role1"]].(map[string]interface{})
+	if info["metadata"].(map[string]string)["owner"] != "role1" || info["creation_time"] == "" {
+		t.Fatalf("bad: %#v", info)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/role1/secret-id-accessor/lookup",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"secret_id_accessor": accessors["role1"],
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["secret_id_accessor"] != accessors["role1"] {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The SecretIDs of other roles cannot be looked up or destroyed
+	for _, path := range []string{"role/role1/secret-id-accessor/lookup", "role/role1/secret-id-accessor/destroy"} {
+		resp, err = b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"secret_id_accessor": accessors["role2"],
+			},
+		})
+		if err == nil && (resp == nil || !resp.IsError()) {
+			t.Fatalf("%s: expected error for the accessor of another role", path)
+		}
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/role1/secret-id-accessor/destroy",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"secret_id_accessor": accessors["role1"],
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	// Only the destroyed SecretID is gone
+	for roleName, count := range map[string]int{"role1": 0, "role2": 1} {
+		resp, err = b.HandleRequest(&logical.Request{
+			Operation: logical.ListOperation,
+			Path:      "role/" + roleName + "/secret-id",
+			Storage:   storage,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		if keys, _ := resp.Data["keys"].([]string); len(keys) != count {
+			t.Fatalf("%s: bad: %#v", roleName, resp.Data)
+		}
+	}
+}
+
+func TestAppRole_SecretIDListPagination(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	b, storage := createBackendWithStorage(t)
+
+	createRole(t, b, storage, "role1", "a,b")
+
+	accessors := map[string]bool{}
+	for i := 0; i < 7; i++ {
+		resp, err = b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "role/role1/secret-id",
+			Storage:   storage,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		accessors[resp.Data["secret_id_accessor"].(string)] = true
+	}
+
+	// Pages are listed after the last accessor of the previous page
+	listed := map[string]bool{}
+	after := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatalf("too many pages: %#v", listed)
+		}
+		resp, err = b.HandleRequest(&logical.Request{
+			Operation: logical.ListOperation,
+			Path:      "role/role1/secret-id/",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"after": after,
+				"limit": 3,
+			},
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		keys, _ := resp.Data["keys"].([]string)
+		if len(keys) == 0 {
+			break
+		}
+		if len(keys) > 3 {
+			t.Fatalf("bad: page of %d accessors", len(keys))
+		}
+		for _, key := range keys {
+			if listed[key] || !accessors[key] {
+				t.Fatalf("bad: accessor %q listed twice or unknown", key)
+			}
+			listed[key] = true
+		}
+		if len(resp.Data["key_info"].(map[string]interface{})) != len(keys) {
+			t.Fatalf("bad: %#v", resp.Data["key_info"])
+		}
+		after = keys[len(keys)-1]
+	}
+	if !reflect.DeepEqual(listed, accessors) {
+		t.Fatalf("bad: expected %#v, got %#v", accessors, listed)
+	}
+
+	// Deleting the role deletes the index of its accessors
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "role/role1",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if keys, err := logical.CollectKeys(storage); err != nil {
+		t.Fatal(err)
+	} else {
+		for _, key := range keys {
+			if strings.HasPrefix(key, "secret_id") || strings.HasPrefix(key, "accessor/") {
+				t.Fatalf("bad: %q left in storage", key)
+			}
+		}
+	}
+}
+
+func TestAppRole_SecretIDAccessorIndexUpgrade(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	b, storage := createBackendWithStorage(t)
+
+	createRole(t, b, storage, "role1", "a,b")
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/role1/secret-id",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	accessor := resp.Data["secret_id_accessor"].(string)
+
+	// Move the accessor to the index of previous versions
+	role, err := b.roleEntry(storage, "role1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roleNameHMAC, err := createHMAC(role.HMACKey, "role1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := b.secretIDAccessorIndex(roleNameHMAC, accessor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := storage.Get(index)
+	if err != nil || entry == nil {
+		t.Fatalf("err:%v entry:%#v", err, entry)
+	}
+	salt, err := b.Salt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.Key = "accessor/" + salt.SaltID(accessor)
+	if err := storage.Put(entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Delete(index); err != nil {
+		t.Fatal(err)
+	}
+	b.accessorIndexUpgraded = 0
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/role1/secret-id-accessor/lookup",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"secret_id_accessor": accessor,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	if entry, err := storage.Get("accessor/" + salt.SaltID(accessor)); err != nil || entry != nil {
+		t.Fatalf("err:%v entry:%#v", err, entry)
+	}
+	if entry, err := storage.Get(accessorIndexUpgradedKey); err != nil || entry == nil {
+		t.Fatalf("err:%v entry:%#v", err, entry)
+	}
+}
+
 func createRole(t *testing.T, b *backend, s logical.Storage, roleName, policies string) {
 	roleData := map[string]interface{}{
 		"policies":           policies,
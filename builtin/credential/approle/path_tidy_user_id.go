@@ -2,6 +2,7 @@ package approle
 
 import (
 	"fmt"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -76,6 +77,10 @@ func (b *backend) tidySecretID(s logical.Storage) error {
 
 			// ExpirationTime not being set indicates non-expiring SecretIDs
 			if !result.ExpirationTime.IsZero() && time.Now().After(result.ExpirationTime) {
+				if err := b.deleteSecretIDAccessorEntry(s, strings.TrimSuffix(roleNameHMAC, "/"), result.SecretIDAccessor); err != nil {
+					lock.Unlock()
+					return err
+				}
 				if err := s.Delete(entryIndex); err != nil {
 					lock.Unlock()
 					return fmt.Errorf("error deleting SecretID %s from storage: %s", secretIDHMAC, err)
@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/go-uuid"
@@ -53,10 +54,19 @@ type secretIDStorageEntry struct {
 	// restrictions on the usage of SecretID
 	CIDRList []string `json:"cidr_list" structs:"cidr_list" mapstructure:"cidr_list"`
 
+	// TokenBoundCIDRs is a set of CIDR blocks that impose source address
+	// restrictions on the usage of the tokens issued using the SecretID. It
+	// overrides the one of the role.
+	TokenBoundCIDRs []string `json:"token_bound_cidrs" structs:"token_bound_cidrs" mapstructure:"token_bound_cidrs"`
+
 	// This is a deprecated field
 	SecretIDNumUsesDeprecated int `json:"SecretIDNumUses" structs:"SecretIDNumUses" mapstructure:"SecretIDNumUses"`
 }
 
+// accessorIndexUpgradedKey marks the accessors of the SecretIDs as indexed
+// per role
+const accessorIndexUpgradedKey = "config/secret_id_accessor_index_upgraded"
+
 // Represents the payload of the storage entry of the accessor that maps to a
 // unique SecretID. Note that SecretIDs should never be stored in plaintext
 // anywhere in the backend. SecretIDHMAC will be used as an index to fetch the
@@ -65,6 +75,10 @@ type secretIDAccessorStorageEntry struct {
 	// Hash of the SecretID which can be used to find the storage index at which
 	// properties of SecretID is stored.
 	SecretIDHMAC string `json:"secret_id_hmac" structs:"secret_id_hmac" mapstructure:"secret_id_hmac"`
+
+	// The accessor itself, as accessors are only indexed by their salted
+	// value
+	SecretIDAccessor string `json:"secret_id_accessor" structs:"secret_id_accessor" mapstructure:"secret_id_accessor"`
 }
 
 // Checks if the Role represented by the RoleID still exists
@@ -89,27 +103,28 @@ func (b *backend) validateRoleID(s logical.Storage, roleID string) (*roleStorage
 	return role, roleIDIndex.Name, nil
 }
 
-// Validates the supplied RoleID and SecretID
-func (b *backend) validateCredentials(req *logical.Request, data *framework.FieldData) (*roleStorageEntry, string, map[string]string, error) {
-	var metadata map[string]string
+// Validates the supplied RoleID and SecretID, returning the role and the
+// properties of the SecretID if the role requires one
+func (b *backend) validateCredentials(req *logical.Request, data *framework.FieldData) (*roleStorageEntry, string, *secretIDStorageEntry, error) {
+	var secretIDEntry *secretIDStorageEntry
 	// RoleID must be supplied during every login
 	roleID := strings.TrimSpace(data.Get("role_id").(string))
 	if roleID == "" {
-		return nil, "", metadata, fmt.Errorf("missing role_id")
+		return nil, "", nil, fmt.Errorf("missing role_id")
 	}
 
 	// Validate the RoleID and get the Role entry
 	role, roleName, err := b.validateRoleID(req.Storage, roleID)
 	if err != nil {
-		return nil, "", metadata, err
+		return nil, "", nil, err
 	}
 	if role == nil || roleName == "" {
-		return nil, "", metadata, fmt.Errorf("failed to validate role_id")
+		return nil, "", nil, fmt.Errorf("failed to validate role_id")
 	}
 
 	// Calculate the TTL boundaries since this reflects the properties of the token issued
 	if role.TokenTTL, role.TokenMaxTTL, err = b.SanitizeTTL(role.TokenTTL, role.TokenMaxTTL); err != nil {
-		return nil, "", metadata, err
+		return nil, "", nil, err
 	}
 
 	if role.BindSecretID {
@@ -117,50 +132,50 @@ func (b *backend) validateCredentials(req *logical.Request, data *framework.Fiel
 		// to be specified and validate it.
 		secretID := strings.TrimSpace(data.Get("secret_id").(string))
 		if secretID == "" {
-			return nil, "", metadata, fmt.Errorf("missing secret_id")
+			return nil, "", nil, fmt.Errorf("missing secret_id")
 		}
 
 		// Check if the SecretID supplied is valid. If use limit was specified
 		// on the SecretID, it will be decremented in this call.
-		var valid bool
-		valid, metadata, err = b.validateBindSecretID(req, roleName, secretID, role.HMACKey, role.BoundCIDRList)
+		secretIDEntry, err = b.validateBindSecretID(req, roleName, secretID, role)
 		if err != nil {
-			return nil, "", metadata, err
+			return nil, "", nil, err
 		}
-		if !valid {
-			return nil, "", metadata, fmt.Errorf("invalid secret_id %q", secretID)
+		if secretIDEntry == nil {
+			return nil, "", nil, fmt.Errorf("invalid secret_id %q", secretID)
 		}
 	}
 
 	if role.BoundCIDRList != "" {
 		// If 'bound_cidr_list' was set, verify the CIDR restrictions
 		if req.Connection == nil || req.Connection.RemoteAddr == "" {
-			return nil, "", metadata, fmt.Errorf("failed to get connection information")
+			return nil, "", nil, fmt.Errorf("failed to get connection information")
 		}
 
 		belongs, err := cidrutil.IPBelongsToCIDRBlocksString(req.Connection.RemoteAddr, role.BoundCIDRList, ",")
 		if err != nil {
-			return nil, "", metadata, fmt.Errorf("failed to verify the CIDR restrictions set on the role: %v", err)
+			return nil, "", nil, fmt.Errorf("failed to verify the CIDR restrictions set on the role: %v", err)
 		}
 		if !belongs {
-			return nil, "", metadata, fmt.Errorf("source address %q unauthorized through CIDR restrictions on the role", req.Connection.RemoteAddr)
+			return nil, "", nil, fmt.Errorf("source address %q unauthorized through CIDR restrictions on the role", req.Connection.RemoteAddr)
 		}
 	}
 
-	return role, roleName, metadata, nil
+	return role, roleName, secretIDEntry, nil
 }
 
-// validateBindSecretID is used to determine if the given SecretID is a valid one.
-func (b *backend) validateBindSecretID(req *logical.Request, roleName, secretID,
-	hmacKey, roleBoundCIDRList string) (bool, map[string]string, error) {
-	secretIDHMAC, err := createHMAC(hmacKey, secretID)
+// validateBindSecretID is used to determine if the given SecretID is a valid
+// one, returning its properties, or nil if it is not.
+func (b *backend) validateBindSecretID(req *logical.Request, roleName, secretID string,
+	role *roleStorageEntry) (*secretIDStorageEntry, error) {
+	secretIDHMAC, err := createHMAC(role.HMACKey, secretID)
 	if err != nil {
-		return false, nil, fmt.Errorf("failed to create HMAC of secret_id: %v", err)
+		return nil, fmt.Errorf("failed to create HMAC of secret_id: %v", err)
 	}
 
-	roleNameHMAC, err := createHMAC(hmacKey, roleName)
+	roleNameHMAC, err := createHMAC(role.HMACKey, roleName)
 	if err != nil {
-		return false, nil, fmt.Errorf("failed to create HMAC of role_name: %v", err)
+		return nil, fmt.Errorf("failed to create HMAC of role_name: %v", err)
 	}
 
 	entryIndex := fmt.Sprintf("secret_id/%s/%s", roleNameHMAC, secretIDHMAC)
@@ -174,37 +189,21 @@ func (b *backend) validateBindSecretID(req *logical.Request, roleName, secretID,
 	result, err := b.nonLockedSecretIDStorageEntry(req.Storage, roleNameHMAC, secretIDHMAC)
 	if err != nil {
 		lock.RUnlock()
-		return false, nil, err
+		return nil, err
 	} else if result == nil {
 		lock.RUnlock()
-		return false, nil, nil
+		return nil, nil
 	}
 
 	// SecretIDNumUses will be zero only if the usage limit was not set at all,
 	// in which case, the SecretID will remain to be valid as long as it is not
 	// expired.
 	if result.SecretIDNumUses == 0 {
-		// Ensure that the CIDRs on the secret ID are still a subset of that of
-		// role's
-		if err := verifyCIDRRoleSecretIDSubset(result.CIDRList,
-			roleBoundCIDRList); err != nil {
-			return false, nil, err
-		}
-
-		// If CIDR restrictions are present on the secret ID, check if the
-		// source IP complies to it
-		if len(result.CIDRList) != 0 {
-			if req.Connection == nil || req.Connection.RemoteAddr == "" {
-				return false, nil, fmt.Errorf("failed to get connection information")
-			}
-
-			if belongs, err := cidrutil.IPBelongsToCIDRBlocksSlice(req.Connection.RemoteAddr, result.CIDRList); !belongs || err != nil {
-				return false, nil, fmt.Errorf("source address %q unauthorized through CIDR restrictions on the secret ID: %v", req.Connection.RemoteAddr, err)
-			}
-		}
-
 		lock.RUnlock()
-		return true, result.Metadata, nil
+		if err := verifySecretIDCIDRs(req, result, role); err != nil {
+			return nil, err
+		}
+		return result, nil
 	}
 
 	// If the SecretIDNumUses is non-zero, it means that its use-count should be updated
@@ -218,10 +217,10 @@ func (b *backend) validateBindSecretID(req *logical.Request, roleName, secretID,
 	// Lock switching may change the data. Refresh the contents.
 	result, err = b.nonLockedSecretIDStorageEntry(req.Storage, roleNameHMAC, secretIDHMAC)
 	if err != nil {
-		return false, nil, err
+		return nil, err
 	}
 	if result == nil {
-		return false, nil, nil
+		return nil, nil
 	}
 
 	// If there exists a single use left, delete the SecretID entry from
@@ -229,43 +228,58 @@ func (b *backend) validateBindSecretID(req *logical.Request, roleName, secretID,
 	// requests to use the same SecretID will fail.
 	if result.SecretIDNumUses == 1 {
 		// Delete the secret IDs accessor first
-		if err := b.deleteSecretIDAccessorEntry(req.Storage, result.SecretIDAccessor); err != nil {
-			return false, nil, err
+		if err := b.deleteSecretIDAccessorEntry(req.Storage, roleNameHMAC, result.SecretIDAccessor); err != nil {
+			return nil, err
 		}
 		if err := req.Storage.Delete(entryIndex); err != nil {
-			return false, nil, fmt.Errorf("failed to delete secret ID: %v", err)
+			return nil, fmt.Errorf("failed to delete secret ID: %v", err)
 		}
 	} else {
 		// If the use count is greater than one, decrement it and update the last updated time.
 		result.SecretIDNumUses -= 1
 		result.LastUpdatedTime = time.Now()
 		if entry, err := logical.StorageEntryJSON(entryIndex, &result); err != nil {
-			return false, nil, fmt.Errorf("failed to decrement the use count for secret ID %q", secretID)
+			return nil, fmt.Errorf("failed to decrement the use count for secret ID %q", secretID)
 		} else if err = req.Storage.Put(entry); err != nil {
-			return false, nil, fmt.Errorf("failed to decrement the use count for secret ID %q", secretID)
+			return nil, fmt.Errorf("failed to decrement the use count for secret ID %q", secretID)
 		}
 	}
 
+	if err := verifySecretIDCIDRs(req, result, role); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// verifySecretIDCIDRs checks that the CIDR restrictions on the secret ID are
+// still a subset of those of the role, and that the source address complies
+// with them
+func verifySecretIDCIDRs(req *logical.Request, result *secretIDStorageEntry, role *roleStorageEntry) error {
 	// Ensure that the CIDRs on the secret ID are still a subset of that of
 	// role's
 	if err := verifyCIDRRoleSecretIDSubset(result.CIDRList,
-		roleBoundCIDRList); err != nil {
-		return false, nil, err
+		role.BoundCIDRList); err != nil {
+		return err
+	}
+	if err := verifyCIDRRoleSecretIDSubset(result.TokenBoundCIDRs,
+		strings.Join(role.TokenBoundCIDRs, ",")); err != nil {
+		return err
 	}
 
 	// If CIDR restrictions are present on the secret ID, check if the
 	// source IP complies to it
 	if len(result.CIDRList) != 0 {
 		if req.Connection == nil || req.Connection.RemoteAddr == "" {
-			return false, nil, fmt.Errorf("failed to get connection information")
+			return fmt.Errorf("failed to get connection information")
 		}
 
 		if belongs, err := cidrutil.IPBelongsToCIDRBlocksSlice(req.Connection.RemoteAddr, result.CIDRList); !belongs || err != nil {
-			return false, nil, fmt.Errorf("source address %q unauthorized through CIDR restrictions on the secret ID: %v", req.Connection.RemoteAddr, err)
+			return fmt.Errorf("source address %q unauthorized through CIDR restrictions on the secret ID: %v", req.Connection.RemoteAddr, err)
 		}
 	}
 
-	return true, result.Metadata, nil
+	return nil
 }
 
 // verifyCIDRRoleSecretIDSubset checks if the CIDR blocks set on the secret ID
@@ -448,7 +462,7 @@ func (b *backend) registerSecretIDEntry(s logical.Storage, roleName, secretID, h
 	}
 
 	// Before storing the SecretID, store its accessor.
-	if err := b.createSecretIDAccessorEntry(s, secretEntry, secretIDHMAC); err != nil {
+	if err := b.createSecretIDAccessorEntry(s, secretEntry, roleNameHMAC, secretIDHMAC); err != nil {
 		return nil, err
 	}
 
@@ -459,21 +473,30 @@ func (b *backend) registerSecretIDEntry(s logical.Storage, roleName, secretID, h
 	return secretEntry, nil
 }
 
+// secretIDAccessorIndex returns the storage index of the accessor of a
+// SecretID. Accessors are indexed per role, so that the accessors of a role
+// are listed without reading the entries of its SecretIDs.
+func (b *backend) secretIDAccessorIndex(roleNameHMAC, secretIDAccessor string) (string, error) {
+	salt, err := b.Salt()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("secret_id_accessor/%s/%s", roleNameHMAC, salt.SaltID(secretIDAccessor)), nil
+}
+
 // secretIDAccessorEntry is used to read the storage entry that maps an
-// accessor to a secret_id.
-func (b *backend) secretIDAccessorEntry(s logical.Storage, secretIDAccessor string) (*secretIDAccessorStorageEntry, error) {
+// accessor of a SecretID of the role to the SecretID.
+func (b *backend) secretIDAccessorEntry(s logical.Storage, roleNameHMAC, secretIDAccessor string) (*secretIDAccessorStorageEntry, error) {
 	if secretIDAccessor == "" {
 		return nil, fmt.Errorf("missing secretIDAccessor")
 	}
 
 	var result secretIDAccessorStorageEntry
 
-	// Create index entry, mapping the accessor to the token ID
-	salt, err := b.Salt()
+	entryIndex, err := b.secretIDAccessorIndex(roleNameHMAC, secretIDAccessor)
 	if err != nil {
 		return nil, err
 	}
-	entryIndex := "accessor/" + salt.SaltID(secretIDAccessor)
 
 	accessorLock := b.secretIDAccessorLock(secretIDAccessor)
 	accessorLock.RLock()
@@ -493,7 +516,7 @@ func (b *backend) secretIDAccessorEntry(s logical.Storage, secretIDAccessor stri
 // createSecretIDAccessorEntry creates an identifier for the SecretID. A storage index,
 // mapping the accessor to the SecretID is also created. This method should
 // be called when the lock for the corresponding SecretID is held.
-func (b *backend) createSecretIDAccessorEntry(s logical.Storage, entry *secretIDStorageEntry, secretIDHMAC string) error {
+func (b *backend) createSecretIDAccessorEntry(s logical.Storage, entry *secretIDStorageEntry, roleNameHMAC, secretIDHMAC string) error {
 	// Create a random accessor
 	accessorUUID, err := uuid.GenerateUUID()
 	if err != nil {
@@ -501,19 +524,24 @@ func (b *backend) createSecretIDAccessorEntry(s logical.Storage, entry *secretID
 	}
 	entry.SecretIDAccessor = accessorUUID
 
-	// Create index entry, mapping the accessor to the token ID
-	salt, err := b.Salt()
+	return b.setSecretIDAccessorEntry(s, roleNameHMAC, secretIDHMAC, accessorUUID)
+}
+
+// setSecretIDAccessorEntry stores the storage index mapping the accessor to
+// a SecretID of the role
+func (b *backend) setSecretIDAccessorEntry(s logical.Storage, roleNameHMAC, secretIDHMAC, secretIDAccessor string) error {
+	entryIndex, err := b.secretIDAccessorIndex(roleNameHMAC, secretIDAccessor)
 	if err != nil {
 		return err
 	}
-	entryIndex := "accessor/" + salt.SaltID(entry.SecretIDAccessor)
 
-	accessorLock := b.secretIDAccessorLock(accessorUUID)
+	accessorLock := b.secretIDAccessorLock(secretIDAccessor)
 	accessorLock.Lock()
 	defer accessorLock.Unlock()
 
 	if entry, err := logical.StorageEntryJSON(entryIndex, &secretIDAccessorStorageEntry{
-		SecretIDHMAC: secretIDHMAC,
+		SecretIDHMAC:     secretIDHMAC,
+		SecretIDAccessor: secretIDAccessor,
 	}); err != nil {
 		return err
 	} else if err = s.Put(entry); err != nil {
@@ -524,12 +552,11 @@ func (b *backend) createSecretIDAccessorEntry(s logical.Storage, entry *secretID
 }
 
 // deleteSecretIDAccessorEntry deletes the storage index mapping the accessor to a SecretID.
-func (b *backend) deleteSecretIDAccessorEntry(s logical.Storage, secretIDAccessor string) error {
-	salt, err := b.Salt()
+func (b *backend) deleteSecretIDAccessorEntry(s logical.Storage, roleNameHMAC, secretIDAccessor string) error {
+	accessorEntryIndex, err := b.secretIDAccessorIndex(roleNameHMAC, secretIDAccessor)
 	if err != nil {
 		return err
 	}
-	accessorEntryIndex := "accessor/" + salt.SaltID(secretIDAccessor)
 
 	accessorLock := b.secretIDAccessorLock(secretIDAccessor)
 	accessorLock.Lock()
@@ -570,5 +597,92 @@ func (b *backend) flushRoleSecrets(s logical.Storage, roleName, hmacKey string)
 		}
 		lock.Unlock()
 	}
+
+	// The accessors of the role are deleted along with their index, without
+	// reading the entries of the SecretIDs
+	accessorIndexes, err := s.List(fmt.Sprintf("secret_id_accessor/%s/", roleNameHMAC))
+	if err != nil {
+		return err
+	}
+	for _, accessorIndex := range accessorIndexes {
+		if err := s.Delete(fmt.Sprintf("secret_id_accessor/%s/%s", roleNameHMAC, accessorIndex)); err != nil {
+			return fmt.Errorf("error deleting accessor index entry from storage: %v", err)
+		}
+	}
+	return nil
+}
+
+// upgradeSecretIDAccessorIndex moves the accessors of the SecretIDs created
+// before accessors were indexed per role from the "accessor/" index to the
+// index of their role. It runs once, before accessors are first listed or
+// looked up.
+func (b *backend) upgradeSecretIDAccessorIndex(s logical.Storage) error {
+	if atomic.LoadUint32(&b.accessorIndexUpgraded) == 1 {
+		return nil
+	}
+
+	// Hold the listing lock, so that no listing is performed while the
+	// index is incomplete
+	b.secretIDListingLock.Lock()
+	defer b.secretIDListingLock.Unlock()
+
+	if atomic.LoadUint32(&b.accessorIndexUpgraded) == 1 {
+		return nil
+	}
+
+	if entry, err := s.Get(accessorIndexUpgradedKey); err != nil {
+		return err
+	} else if entry != nil {
+		atomic.StoreUint32(&b.accessorIndexUpgraded, 1)
+		return nil
+	}
+
+	roleNameHMACs, err := s.List("secret_id/")
+	if err != nil {
+		return err
+	}
+	for _, roleNameHMAC := range roleNameHMACs {
+		roleNameHMAC = strings.TrimSuffix(roleNameHMAC, "/")
+		secretIDHMACs, err := s.List(fmt.Sprintf("secret_id/%s/", roleNameHMAC))
+		if err != nil {
+			return err
+		}
+		for _, secretIDHMAC := range secretIDHMACs {
+			lock := b.secretIDLock(secretIDHMAC)
+			lock.RLock()
+			entry, err := b.nonLockedSecretIDStorageEntry(s, roleNameHMAC, secretIDHMAC)
+			if err == nil && entry != nil {
+				err = b.setSecretIDAccessorEntry(s, roleNameHMAC, secretIDHMAC, entry.SecretIDAccessor)
+			}
+			lock.RUnlock()
+			if err != nil {
+				return fmt.Errorf("failed to index the accessor of SecretID %q: %v", secretIDHMAC, err)
+			}
+		}
+	}
+
+	// The previous index also kept the accessors of the SecretIDs of deleted
+	// roles
+	legacyIndexes, err := s.List("accessor/")
+	if err != nil {
+		return err
+	}
+	for _, legacyIndex := range legacyIndexes {
+		if err := s.Delete("accessor/" + legacyIndex); err != nil {
+			return fmt.Errorf("failed to delete accessor storage entry: %v", err)
+		}
+	}
+
+	if err := s.Put(&logical.StorageEntry{
+		Key:   accessorIndexUpgradedKey,
+		Value: []byte("1"),
+	}); err != nil {
+		return err
+	}
+	atomic.StoreUint32(&b.accessorIndexUpgraded, 1)
+
+	if b.Logger().IsInfo() {
+		b.Logger().Info("approle: upgraded secret ID accessor index", "roles", len(roleNameHMACs))
+	}
 	return nil
 }
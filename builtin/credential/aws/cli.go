@@ -32,6 +32,10 @@ func (h *CLIHandler) Auth(c *api.Client, m map[string]string) (string, error) {
 		headerValue = ""
 	}
 
+	if m["auth_type"] == ec2AuthType {
+		return ec2Auth(c, mount, role, m["nonce"])
+	}
+
 	// Grab any supplied credentials off the command line
 	// Ensure we're able to fall back to the SDK default credential providers
 	credConfig := &awsutil.CredentialsConfig{
@@ -47,9 +51,16 @@ func (h *CLIHandler) Auth(c *api.Client, m map[string]string) (string, error) {
 		return "", fmt.Errorf("could not compile valid credential providers from static config, environment, shared, or instance metadata")
 	}
 
-	// Use the credentials we've found to construct an STS session
+	// Use the credentials we've found to construct an STS session. The
+	// request is signed for the regional endpoint when a region is given,
+	// which Vault must be configured to use with sts_region.
+	stsConfig := aws.Config{Credentials: creds}
+	if region := m["sts_region"]; region != "" {
+		stsConfig.Region = aws.String(region)
+		stsConfig.Endpoint = aws.String(regionalSTSEndpoint(region))
+	}
 	stsSession, err := session.NewSessionWithOptions(session.Options{
-		Config: aws.Config{Credentials: creds},
+		Config: stsConfig,
 	})
 	if err != nil {
 		return "", err
@@ -99,6 +110,35 @@ func (h *CLIHandler) Auth(c *api.Client, m map[string]string) (string, error) {
 	return secret.Auth.ClientToken, nil
 }
 
+// ec2Auth logs in with the PKCS7 signature of the instance identity
+// document, read with IMDSv2 when the instance supports it
+func ec2Auth(c *api.Client, mount, role, nonce string) (string, error) {
+	imds := &awsutil.IMDSClient{}
+	pkcs7, err := imds.Get("dynamic/instance-identity/pkcs7")
+	if err != nil {
+		return "", err
+	}
+
+	data := map[string]interface{}{
+		"pkcs7": strings.Replace(pkcs7, "\n", "", -1),
+		"role":  role,
+	}
+	if nonce != "" {
+		data["nonce"] = nonce
+	}
+
+	path := fmt.Sprintf("auth/%s/login", mount)
+	secret, err := c.Logical().Write(path, data)
+	if err != nil {
+		return "", err
+	}
+	if secret == nil {
+		return "", fmt.Errorf("empty response from credential provider")
+	}
+
+	return secret.Auth.ClientToken, nil
+}
+
 func (h *CLIHandler) Help() string {
 	help := `
 The AWS credential provider allows you to authenticate with
@@ -114,6 +154,11 @@ instance profile (in that order).
 If you need to explicitly pass in credentials, you would do it like this:
   Example: vault auth -method=aws aws_access_key_id=<access key> aws_secret_access_key=<secret key> aws_security_token=<token>
 
+On EC2 instances, you can instead log in with the signed instance identity
+document, which is read from the instance metadata service with IMDSv2 when
+the instance supports it:
+  Example: vault auth -method=aws auth_type=ec2 role=<role> nonce=<nonce>
+
 Key/Value Pairs:
 
   mount=aws                           The mountpoint for the AWS credential provider.
@@ -123,6 +168,10 @@ Key/Value Pairs:
   aws_security_token=<token>          Security token for temporary credentials
   header_value                        The Value of the X-Vault-AWS-IAM-Server-ID header.
   role                                The name of the role you're requesting a token for
+  sts_region                          Region of the STS endpoint to sign the request for.
+                                      Defaults to the global endpoint
+  auth_type=iam                       The auth type, "iam" or "ec2". Defaults to "iam"
+  nonce                               The client nonce of ec2 logins
   `
 
 	return strings.TrimSpace(help)
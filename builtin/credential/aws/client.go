@@ -40,8 +40,11 @@ func (b *backend) getRawClientConfig(s logical.Storage, region, clientType strin
 			endpoint = aws.String(config.Endpoint)
 		case clientType == "iam" && config.IAMEndpoint != "":
 			endpoint = aws.String(config.IAMEndpoint)
-		case clientType == "sts" && config.STSEndpoint != "":
-			endpoint = aws.String(config.STSEndpoint)
+		case clientType == "sts" && (config.STSEndpoint != "" || config.STSRegion != ""):
+			endpoint = aws.String(config.stsEndpoint())
+		}
+		if clientType == "sts" && config.STSRegion != "" {
+			region = config.STSRegion
 		}
 
 		credsConfig.AccessKey = config.AccessKey
@@ -67,6 +70,13 @@ func (b *backend) getRawClientConfig(s logical.Storage, region, clientType strin
 	}, nil
 }
 
+const defaultSTSEndpoint = "https://sts.amazonaws.com"
+
+// regionalSTSEndpoint returns the STS endpoint of a region
+func regionalSTSEndpoint(region string) string {
+	return fmt.Sprintf("https://sts.%s.amazonaws.com", region)
+}
+
 // getClientConfig returns an aws-sdk-go config, with optionally assumed credentials
 // It uses getRawClientConfig to obtain config for the runtime environemnt, and if
 // stsRole is a non-empty string, it will use AssumeRole to obtain a set of assumed
@@ -40,6 +40,12 @@ func pathConfigClient(b *backend) *framework.Path {
 				Description: "URL to override the default generated endpoint for making AWS STS API calls.",
 			},
 
+			"sts_region": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     "",
+				Description: "Region of the regional STS endpoint used for AWS STS API calls, for accounts blocking the global endpoint. Ignored when sts_endpoint is set.",
+			},
+
 			"iam_server_id_header_value": &framework.FieldSchema{
 				Type:        framework.TypeString,
 				Default:     "",
@@ -98,6 +104,21 @@ func (b *backend) nonLockedClientConfigEntry(s logical.Storage) (*clientConfig,
 	return &result, nil
 }
 
+// stsEndpoint returns the STS endpoint the GetCallerIdentity requests of iam
+// logins are sent to. The clients must sign their requests for the same
+// endpoint.
+func (c *clientConfig) stsEndpoint() string {
+	switch {
+	case c == nil:
+		return defaultSTSEndpoint
+	case c.STSEndpoint != "":
+		return c.STSEndpoint
+	case c.STSRegion != "":
+		return regionalSTSEndpoint(c.STSRegion)
+	}
+	return defaultSTSEndpoint
+}
+
 func (b *backend) pathConfigClientRead(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	clientConfig, err := b.lockedClientConfigEntry(req.Storage)
@@ -208,6 +229,17 @@ func (b *backend) pathConfigClientCreateUpdate(
 		configEntry.STSEndpoint = data.Get("sts_endpoint").(string)
 	}
 
+	stsRegionStr, ok := data.GetOk("sts_region")
+	if ok {
+		if configEntry.STSRegion != stsRegionStr.(string) {
+			// Flush the cached clients for the same reason as the STS endpoint
+			changedCreds = true
+			configEntry.STSRegion = stsRegionStr.(string)
+		}
+	} else if req.Operation == logical.CreateOperation {
+		configEntry.STSRegion = data.Get("sts_region").(string)
+	}
+
 	headerValStr, ok := data.GetOk("iam_server_id_header_value")
 	if ok {
 		if configEntry.IAMServerIdHeaderValue != headerValStr.(string) {
@@ -251,6 +283,7 @@ type clientConfig struct {
 	Endpoint               string `json:"endpoint" structs:"endpoint" mapstructure:"endpoint"`
 	IAMEndpoint            string `json:"iam_endpoint" structs:"iam_endpoint" mapstructure:"iam_endpoint"`
 	STSEndpoint            string `json:"sts_endpoint" structs:"sts_endpoint" mapstructure:"sts_endpoint"`
+	STSRegion              string `json:"sts_region" structs:"sts_region" mapstructure:"sts_region"`
 	IAMServerIdHeaderValue string `json:"iam_server_id_header_value" structs:"iam_server_id_header_value" mapstructure:"iam_server_id_header_value"`
 }
 
@@ -74,3 +74,16 @@ func TestBackend_pathConfigClient(t *testing.T) {
 			data["iam_server_id_header_value"], resp.Data["iam_server_id_header_value"])
 	}
 }
+
+func TestBackend_clientConfigSTSEndpoint(t *testing.T) {
+	for expected, config := range map[string]*clientConfig{
+		"https://sts.amazonaws.com":           nil,
+		"https://sts.amazonaws.com/":          &clientConfig{STSEndpoint: "https://sts.amazonaws.com/"},
+		"https://sts.us-west-2.amazonaws.com": &clientConfig{STSRegion: "us-west-2"},
+		"https://sts.proxy.example.com":       &clientConfig{STSEndpoint: "https://sts.proxy.example.com", STSRegion: "us-west-2"},
+	} {
+		if actual := config.stsEndpoint(); actual != expected {
+			t.Fatalf("expected STS endpoint %q, got %q", expected, actual)
+		}
+	}
+}
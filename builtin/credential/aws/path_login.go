@@ -932,7 +932,7 @@ func (b *backend) pathLoginRenewIam(
 	// those bindings are either with a bound_iam_principal_arn or bindings on the inferred enttity.
 	// If the bound_iam_principal_arn is set to "", then that means all the bindings were set on the
 	// inferred entity type and already checked, so we don't need to check bound_iam_principal_arn.
-	if roleEntry.BoundIamPrincipalARN != "" && roleEntry.BoundIamPrincipalARN != canonicalArn {
+	if roleEntry.BoundIamPrincipalARN != "" && !roleEntry.principalARNMatches(canonicalArn) {
 		return nil, fmt.Errorf("role no longer bound to arn %q", canonicalArn)
 	}
 	// Need to hanndle the case where an auth token was generated before we put client_user_id in the metadata
@@ -1109,17 +1109,12 @@ func (b *backend) pathLoginUpdateIam(
 		return logical.ErrorResponse("error getting configuration"), nil
 	}
 
-	endpoint := "https://sts.amazonaws.com"
+	endpoint := config.stsEndpoint()
 
-	if config != nil {
-		if config.IAMServerIdHeaderValue != "" {
-			err = validateVaultHeaderValue(headers, parsedUrl, config.IAMServerIdHeaderValue)
-			if err != nil {
-				return logical.ErrorResponse(fmt.Sprintf("error validating %s header: %v", iamServerIdHeader, err)), nil
-			}
-		}
-		if config.STSEndpoint != "" {
-			endpoint = config.STSEndpoint
+	if config != nil && config.IAMServerIdHeaderValue != "" {
+		err = validateVaultHeaderValue(headers, parsedUrl, config.IAMServerIdHeaderValue)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("error validating %s header: %v", iamServerIdHeader, err)), nil
 		}
 	}
 
@@ -1161,7 +1156,7 @@ func (b *backend) pathLoginUpdateIam(
 		if callerUniqueId != roleEntry.BoundIamPrincipalID {
 			return logical.ErrorResponse(fmt.Sprintf("expected IAM %s %s to resolve to unique AWS ID %q but got %q instead", entity.Type, entity.FriendlyName, roleEntry.BoundIamPrincipalID, callerUniqueId)), nil
 		}
-	} else if roleEntry.BoundIamPrincipalARN != "" && roleEntry.BoundIamPrincipalARN != entity.canonicalArn() {
+	} else if roleEntry.BoundIamPrincipalARN != "" && !roleEntry.principalARNMatches(entity.canonicalArn()) {
 		return logical.ErrorResponse(fmt.Sprintf("IAM Principal %q does not belong to the role %q", callerID.Arn, roleName)), nil
 	}
 
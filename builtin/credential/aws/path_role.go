@@ -37,8 +37,10 @@ in its identity document to match the one specified by this parameter.`,
 			},
 			"bound_iam_principal_arn": {
 				Type: framework.TypeString,
-				Description: `ARN of the IAM principal to bind to this role. Only applicable when
-auth_type is iam.`,
+				Description: `ARN of the IAM principal to bind to this role. A trailing '*' matches
+any principal whose ARN has the given prefix, such as
+arn:aws:iam::123456789012:role/app-*, in which case the ARN is not
+resolved to a unique ID. Only applicable when auth_type is iam.`,
 			},
 			"bound_region": {
 				Type: framework.TypeString,
@@ -318,6 +320,7 @@ func (b *backend) upgradeRoleEntry(s logical.Storage, roleEntry *awsRoleEntry) (
 	if roleEntry.AuthType == iamAuthType &&
 		roleEntry.ResolveAWSUniqueIDs &&
 		roleEntry.BoundIamPrincipalARN != "" &&
+		!roleEntry.hasWildcardPrincipalARN() &&
 		roleEntry.BoundIamPrincipalID == "" {
 		principalId, err := b.resolveArnToUniqueIDFunc(s, roleEntry.BoundIamPrincipalARN)
 		if err != nil {
@@ -488,19 +491,24 @@ func (b *backend) pathRoleCreateUpdate(
 
 	if boundIamPrincipalARNRaw, ok := data.GetOk("bound_iam_principal_arn"); ok {
 		principalARN := boundIamPrincipalARNRaw.(string)
+		if strings.Contains(strings.TrimSuffix(principalARN, "*"), "*") {
+			return logical.ErrorResponse("bound_iam_principal_arn can only contain a trailing '*'"), nil
+		}
 		roleEntry.BoundIamPrincipalARN = principalARN
+		roleEntry.BoundIamPrincipalID = ""
 		// Explicitly not checking to see if the user has changed the ARN under us
 		// This allows the user to sumbit an update with the same ARN to force Vault
 		// to re-resolve the ARN to the unique ID, in case an entity was deleted and
-		// recreated
-		if roleEntry.ResolveAWSUniqueIDs {
+		// recreated. ARNs with a wildcard match several principals, and are not
+		// resolved.
+		if roleEntry.ResolveAWSUniqueIDs && !roleEntry.hasWildcardPrincipalARN() {
 			principalID, err := b.resolveArnToUniqueIDFunc(req.Storage, principalARN)
 			if err != nil {
 				return logical.ErrorResponse(fmt.Sprintf("failed updating the unique ID of ARN %#v: %#v", principalARN, err)), nil
 			}
 			roleEntry.BoundIamPrincipalID = principalID
 		}
-	} else if roleEntry.ResolveAWSUniqueIDs && roleEntry.BoundIamPrincipalARN != "" {
+	} else if roleEntry.ResolveAWSUniqueIDs && roleEntry.BoundIamPrincipalARN != "" && !roleEntry.hasWildcardPrincipalARN() {
 		// we're turning on resolution on this role, so ensure we update it
 		principalID, err := b.resolveArnToUniqueIDFunc(req.Storage, roleEntry.BoundIamPrincipalARN)
 		if err != nil {
@@ -753,6 +761,21 @@ type awsRoleEntry struct {
 	Period                     time.Duration `json:"period" mapstructure:"period" structs:"period"`
 }
 
+// hasWildcardPrincipalARN returns whether the bound IAM principal ARN ends
+// with a wildcard
+func (r *awsRoleEntry) hasWildcardPrincipalARN() bool {
+	return strings.HasSuffix(r.BoundIamPrincipalARN, "*")
+}
+
+// principalARNMatches checks the canonical ARN of an IAM principal against
+// the bound IAM principal ARN
+func (r *awsRoleEntry) principalARNMatches(arn string) bool {
+	if r.hasWildcardPrincipalARN() {
+		return strings.HasPrefix(arn, strings.TrimSuffix(r.BoundIamPrincipalARN, "*"))
+	}
+	return arn == r.BoundIamPrincipalARN
+}
+
 const pathRoleSyn = `
 Create a role and associate policies to it.
 `
@@ -1,6 +1,7 @@
 package awsauth
 
 import (
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
@@ -212,6 +213,81 @@ func Test_enableIamIDResolution(t *testing.T) {
 	}
 }
 
+func TestBackend_pathIamWildcardPrincipal(t *testing.T) {
+	config := logical.TestBackendConfig()
+	storage := &logical.InmemStorage{}
+	config.StorageView = storage
+
+	b, err := Backend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.Setup(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ARNs with a wildcard match several principals and must not be resolved
+	b.resolveArnToUniqueIDFunc = func(s logical.Storage, arn string) (string, error) {
+		return "", fmt.Errorf("unexpected resolution of %q", arn)
+	}
+
+	submitRequest := func(op logical.Operation, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(&logical.Request{
+			Operation: op,
+			Path:      "role/wildcard",
+			Data:      data,
+			Storage:   storage,
+		})
+	}
+
+	resp, err := submitRequest(logical.CreateOperation, map[string]interface{}{
+		"auth_type":               iamAuthType,
+		"bound_iam_principal_arn": "arn:aws:iam::123456789012:*/MyRole",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for a wildcard which is not trailing, got %#v", resp)
+	}
+
+	resp, err = submitRequest(logical.CreateOperation, map[string]interface{}{
+		"auth_type":               iamAuthType,
+		"bound_iam_principal_arn": "arn:aws:iam::123456789012:role/app-*",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatalf("failed to create role: %#v", resp)
+	}
+
+	resp, err = submitRequest(logical.ReadOperation, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["bound_iam_principal_id"] != "" || resp.Data["resolve_aws_unique_ids"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	roleEntry, err := b.lockedAWSRole(storage, "wildcard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for arn, expected := range map[string]bool{
+		"arn:aws:iam::123456789012:role/app-web":   true,
+		"arn:aws:iam::123456789012:role/app-":      true,
+		"arn:aws:iam::123456789012:role/other-app": false,
+		"arn:aws:iam::210987654321:role/app-web":   false,
+		"arn:aws:iam::123456789012:user/app-web":   false,
+	} {
+		if actual := roleEntry.principalARNMatches(arn); actual != expected {
+			t.Fatalf("%s: expected match %t, got %t", arn, expected, actual)
+		}
+	}
+}
+
 func TestBackend_pathIam(t *testing.T) {
 	config := logical.TestBackendConfig()
 	storage := &logical.InmemStorage{}
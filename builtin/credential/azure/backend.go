@@ -0,0 +1,98 @@
+package azureauth
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	b := &backend{}
+	b.Backend = &framework.Backend{
+		Help: backendHelp,
+
+		PathsSpecial: &logical.Paths{
+			Unauthenticated: []string{
+				"login",
+			},
+		},
+
+		Paths: []*framework.Path{
+			pathConfig(b),
+			pathListRoles(b),
+			pathRoles(b),
+			pathLogin(b),
+		},
+
+		AuthRenew:  b.pathLoginRenew,
+		Invalidate: b.invalidate,
+	}
+
+	return b
+}
+
+type backend struct {
+	*framework.Backend
+
+	// clientLock guards the cached client, which is created from the
+	// configuration
+	clientLock sync.RWMutex
+	client     *azureClient
+}
+
+func (b *backend) invalidate(key string) {
+	switch key {
+	case "config":
+		b.resetClient()
+	}
+}
+
+// azureClient returns the client verifying tokens and looking up virtual
+// machines with the configured tenant and credentials
+func (b *backend) azureClient(config *azureConfig) (*azureClient, error) {
+	b.clientLock.RLock()
+	if b.client != nil {
+		defer b.clientLock.RUnlock()
+		return b.client, nil
+	}
+	b.clientLock.RUnlock()
+
+	b.clientLock.Lock()
+	defer b.clientLock.Unlock()
+
+	// Check again, as the client may have been created while waiting for the
+	// lock
+	if b.client != nil {
+		return b.client, nil
+	}
+
+	client, err := newAzureClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the azure client: %s", err)
+	}
+	b.client = client
+
+	return client, nil
+}
+
+func (b *backend) resetClient() {
+	b.clientLock.Lock()
+	defer b.clientLock.Unlock()
+	b.client = nil
+}
+
+const backendHelp = `
+The Azure credential provider allows authentication of Azure resources with
+the access tokens of their managed identities.
+
+The tokens are verified with the signing keys of the Azure Active Directory
+tenant. Roles bind the service principals, groups, subscriptions, resource
+groups, locations and scale sets allowed to log in to policies; virtual
+machines are looked up with the Azure Resource Manager API to verify them.
+`
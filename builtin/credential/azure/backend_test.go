@@ -0,0 +1,300 @@
+package azureauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	testTenantID = "tenant"
+	testResource = "https://management.azure.com/"
+	testIssuer   = "https://sts.windows.net/tenant/"
+)
+
+func createBackendWithStorage(t *testing.T) (*backend, logical.Storage) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView
+}
+
+func testRequest(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatalf("%s %s: %v", op, path, err)
+	}
+	return resp
+}
+
+// fakeAzure serves the discovery document and the signing keys of the
+// tenant, and the virtual machines and scale sets of the Resource Manager
+// API. The Resource Manager requests must carry the token of Vault.
+type fakeAzure struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	resources map[string]*computeResource
+}
+
+func newFakeAzure(t *testing.T) *fakeAzure {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeAzure{
+		key:       key,
+		resources: map[string]*computeResource{},
+	}
+
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/"+testTenantID+"/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":   testIssuer,
+				"jwks_uri": f.server.URL + "/keys",
+			})
+		case r.URL.Path == "/keys":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"keys": []map[string]string{{
+					"kid": "key-1",
+					"kty": "RSA",
+					"n":   base64.RawURLEncoding.EncodeToString(f.key.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(f.key.E)).Bytes()),
+				}},
+			})
+		case strings.HasPrefix(r.URL.Path, "/subscriptions/"):
+			resource, ok := f.resources[r.URL.Path]
+			if r.Header.Get("Authorization") != "Bearer arm-token" || r.URL.Query().Get("api-version") != computeAPIVersion {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error": {"code": "ResourceNotFound", "message": "not found"}}`))
+				return
+			}
+			json.NewEncoder(w).Encode(resource)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return f
+}
+
+// backend returns a configured backend calling the fake APIs
+func (f *fakeAzure) backend(t *testing.T) (*backend, logical.Storage) {
+	b, storage := createBackendWithStorage(t)
+	resp := testRequest(t, b, storage, logical.UpdateOperation, "config", map[string]interface{}{
+		"tenant_id": testTenantID,
+		"resource":  testResource,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatal(resp.Data["error"])
+	}
+
+	b.client = &azureClient{
+		httpClient:              http.DefaultClient,
+		tenantID:                testTenantID,
+		activeDirectoryEndpoint: f.server.URL + "/",
+		armEndpoint:             f.server.URL + "/",
+		armToken: func() (string, error) {
+			return "arm-token", nil
+		},
+	}
+	return b, storage
+}
+
+func (f *fakeAzure) addResource(resourceType, name, location, principalID string) {
+	resource := &computeResource{
+		Name:     name,
+		Location: location,
+	}
+	resource.Identity.PrincipalID = principalID
+	f.resources["/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/"+resourceType+"/"+name] = resource
+}
+
+func (f *fakeAzure) token(t *testing.T, claims jwt.MapClaims) string {
+	base := jwt.MapClaims{
+		"iss": testIssuer,
+		"aud": testResource,
+		"tid": testTenantID,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		base[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, base)
+	token.Header["kid"] = "key-1"
+	signed, err := token.SignedString(f.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestBackend_pathConfig(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	for _, data := range []map[string]interface{}{
+		{"resource": testResource},
+		{"tenant_id": testTenantID},
+		{"tenant_id": testTenantID, "resource": testResource, "client_id": "id"},
+		{"tenant_id": testTenantID, "resource": testResource, "environment": "mars"},
+	} {
+		resp := testRequest(t, b, storage, logical.UpdateOperation, "config", data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%v: expected an error, got %#v", data, resp)
+		}
+	}
+
+	testRequest(t, b, storage, logical.UpdateOperation, "config", map[string]interface{}{
+		"tenant_id":     testTenantID,
+		"resource":      testResource,
+		"client_id":     "id",
+		"client_secret": "secret",
+	})
+	resp := testRequest(t, b, storage, logical.ReadOperation, "config", nil)
+	if resp.Data["client_id"] != "id" || resp.Data["tenant_id"] != testTenantID {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["client_secret"]; ok {
+		t.Fatal("client_secret was returned")
+	}
+}
+
+func TestBackend_pathRole(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	resp := testRequest(t, b, storage, logical.UpdateOperation, "role/empty", map[string]interface{}{
+		"policies": "web",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected a role without constraints to fail, got %#v", resp)
+	}
+
+	testRequest(t, b, storage, logical.UpdateOperation, "role/web", map[string]interface{}{
+		"bound_subscription_ids": "sub",
+		"bound_resource_groups":  "rg",
+		"policies":               "web",
+		"ttl":                    "1h",
+	})
+	resp = testRequest(t, b, storage, logical.ReadOperation, "role/web", nil)
+	if resp.Data["ttl"] != int64(3600) || len(resp.Data["bound_resource_groups"].([]string)) != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp = testRequest(t, b, storage, logical.ListOperation, "role/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != "web" {
+		t.Fatalf("bad: %#v", keys)
+	}
+}
+
+func TestBackend_login(t *testing.T) {
+	f := newFakeAzure(t)
+	defer f.server.Close()
+	b, storage := f.backend(t)
+
+	f.addResource("virtualMachines", "vm1", "westeurope", "vm1-principal")
+	f.addResource("virtualMachineScaleSets", "web", "westeurope", "web-principal")
+
+	testRequest(t, b, storage, logical.UpdateOperation, "role/vm", map[string]interface{}{
+		"bound_subscription_ids": "sub",
+		"bound_resource_groups":  "RG",
+		"bound_locations":        "westeurope",
+		"policies":               "vm",
+	})
+	testRequest(t, b, storage, logical.UpdateOperation, "role/scaleset", map[string]interface{}{
+		"bound_scale_sets": "web",
+		"policies":         "web",
+	})
+	testRequest(t, b, storage, logical.UpdateOperation, "role/group", map[string]interface{}{
+		"bound_group_ids": "ops",
+		"policies":        "ops",
+	})
+
+	login := func(role string, claims jwt.MapClaims, vm map[string]interface{}) *logical.Response {
+		data := map[string]interface{}{
+			"role": role,
+			"jwt":  f.token(t, claims),
+		}
+		for k, v := range vm {
+			data[k] = v
+		}
+		return testRequest(t, b, storage, logical.UpdateOperation, "login", data)
+	}
+	vm1 := map[string]interface{}{
+		"subscription_id":     "sub",
+		"resource_group_name": "rg",
+		"vm_name":             "vm1",
+	}
+
+	resp := login("vm", jwt.MapClaims{"oid": "vm1-principal"}, vm1)
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp.Auth.Metadata["vm_name"] != "vm1" || resp.Auth.Metadata["object_id"] != "vm1-principal" || resp.Auth.DisplayName != "vm1" {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+
+	// The token must belong to the virtual machine it claims to be
+	resp = login("vm", jwt.MapClaims{"oid": "web-principal"}, vm1)
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Data["error"].(string), "does not belong") {
+		t.Fatalf("expected another identity to be rejected, got %#v", resp)
+	}
+	resp = login("vm", jwt.MapClaims{"oid": "vm1-principal"}, nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected a login without the virtual machine to fail, got %#v", resp)
+	}
+	resp = login("vm", jwt.MapClaims{"oid": "vm1-principal", "aud": "https://vault.example.com"}, vm1)
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Data["error"].(string), "audience") {
+		t.Fatalf("expected the audience to be rejected, got %#v", resp)
+	}
+	resp = login("vm", jwt.MapClaims{"oid": "vm1-principal", "iss": "https://sts.windows.net/other/"}, vm1)
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Data["error"].(string), "issuer") {
+		t.Fatalf("expected the issuer to be rejected, got %#v", resp)
+	}
+
+	f.resources["/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/vm1"].Location = "eastus"
+	resp = login("vm", jwt.MapClaims{"oid": "vm1-principal"}, vm1)
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Data["error"].(string), "location") {
+		t.Fatalf("expected the location to be rejected, got %#v", resp)
+	}
+
+	resp = login("scaleset", jwt.MapClaims{"oid": "web-principal"}, map[string]interface{}{
+		"subscription_id":     "sub",
+		"resource_group_name": "rg",
+		"vm_name":             "web_0",
+		"vmss_name":           "web",
+	})
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	resp = login("group", jwt.MapClaims{"oid": "user", "groups": []string{"dev", "ops"}}, nil)
+	if resp == nil || resp.IsError() || resp.Auth == nil || resp.Auth.DisplayName != "user" {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = login("group", jwt.MapClaims{"oid": "user", "groups": []string{"dev"}}, nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected the groups to be rejected, got %#v", resp)
+	}
+}
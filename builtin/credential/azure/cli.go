@@ -0,0 +1,96 @@
+package azureauth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/mapstructure"
+)
+
+// CLIHandler logs in with the managed identity of the virtual machine the
+// command runs on, reading its token and its identity from the Instance
+// Metadata Service
+type CLIHandler struct{}
+
+func (h *CLIHandler) Auth(c *api.Client, m map[string]string) (string, error) {
+	var data struct {
+		Mount    string `mapstructure:"mount"`
+		Role     string `mapstructure:"role"`
+		Resource string `mapstructure:"resource"`
+	}
+	if err := mapstructure.WeakDecode(m, &data); err != nil {
+		return "", err
+	}
+	if data.Mount == "" {
+		data.Mount = "azure"
+	}
+	if data.Role == "" {
+		return "", fmt.Errorf("role must be specified")
+	}
+	if data.Resource == "" {
+		return "", fmt.Errorf("resource must be specified")
+	}
+
+	client := cleanhttp.DefaultClient()
+	client.Timeout = 30 * time.Second
+
+	token, _, err := managedIdentityToken(client, data.Resource)
+	if err != nil {
+		return "", err
+	}
+	var instance struct {
+		Compute struct {
+			SubscriptionID    string `json:"subscriptionId"`
+			ResourceGroupName string `json:"resourceGroupName"`
+			Name              string `json:"name"`
+			VMScaleSetName    string `json:"vmScaleSetName"`
+		} `json:"compute"`
+	}
+	if err := getIMDS(client, "instance?api-version=2017-12-01", &instance); err != nil {
+		return "", fmt.Errorf("error reading the instance metadata: %s", err)
+	}
+
+	path := fmt.Sprintf("auth/%s/login", data.Mount)
+	secret, err := c.Logical().Write(path, map[string]interface{}{
+		"role":                data.Role,
+		"jwt":                 token,
+		"subscription_id":     instance.Compute.SubscriptionID,
+		"resource_group_name": instance.Compute.ResourceGroupName,
+		"vm_name":             instance.Compute.Name,
+		"vmss_name":           instance.Compute.VMScaleSetName,
+	})
+	if err != nil {
+		return "", err
+	}
+	if secret == nil {
+		return "", fmt.Errorf("empty response from credential provider")
+	}
+
+	return secret.Auth.ClientToken, nil
+}
+
+func (h *CLIHandler) Help() string {
+	help := `
+The Azure credential provider allows you to log in with the managed identity
+of the Azure virtual machine the command runs on. The token of the identity
+and the name of the virtual machine are read from the Instance Metadata
+Service.
+
+    Example: vault auth -method=azure role=web resource=https://management.azure.com/
+
+Key/Value Pairs:
+
+    mount=azure             The mountpoint for the Azure credential provider.
+                            Defaults to "azure"
+
+    role=<name>             The role to log in with.
+
+    resource=<uri>          The resource to request the token for, which must
+                            be the resource configured in Vault.
+	`
+
+	return strings.TrimSpace(help)
+}
@@ -0,0 +1,329 @@
+package azureauth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+const (
+	computeAPIVersion = "2019-07-01"
+
+	// imdsEndpoint is the Azure Instance Metadata Service, which issues the
+	// tokens of managed identities
+	imdsEndpoint = "http://169.254.169.254/metadata/"
+)
+
+// azureClient verifies the tokens issued by Azure Active Directory, and
+// looks up virtual machines with the Azure Resource Manager API. The Azure
+// SDK for these APIs is not available to Vault.
+type azureClient struct {
+	httpClient *http.Client
+	tenantID   string
+
+	// activeDirectoryEndpoint and armEndpoint are the base URLs of the
+	// APIs, ending with a slash
+	activeDirectoryEndpoint string
+	armEndpoint             string
+
+	// armToken returns the access token of Vault for the Resource Manager
+	// API
+	armToken func() (string, error)
+
+	// keysLock guards the issuer and the signing keys of the tenant, which
+	// are fetched again when a token is signed by an unknown key
+	keysLock sync.Mutex
+	issuer   string
+	keys     map[string]*rsa.PublicKey
+}
+
+func newAzureClient(config *azureConfig) (*azureClient, error) {
+	environment := azure.PublicCloud
+	if config.Environment != "" {
+		var err error
+		environment, err = azure.EnvironmentFromName(config.Environment)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	httpClient := cleanhttp.DefaultClient()
+	httpClient.Timeout = 30 * time.Second
+
+	c := &azureClient{
+		httpClient:              httpClient,
+		tenantID:                config.TenantID,
+		activeDirectoryEndpoint: environment.ActiveDirectoryEndpoint,
+		armEndpoint:             environment.ResourceManagerEndpoint,
+	}
+
+	// Without client credentials, Vault uses its own managed identity
+	if config.ClientID == "" {
+		var lock sync.Mutex
+		var token string
+		var expiresOn time.Time
+		c.armToken = func() (string, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			if time.Now().Add(time.Minute).After(expiresOn) {
+				var err error
+				token, expiresOn, err = managedIdentityToken(httpClient, environment.ResourceManagerEndpoint)
+				if err != nil {
+					return "", err
+				}
+			}
+			return token, nil
+		}
+		return c, nil
+	}
+
+	oauthConfig, err := adal.NewOAuthConfig(environment.ActiveDirectoryEndpoint, config.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	spt, err := adal.NewServicePrincipalToken(*oauthConfig, config.ClientID, config.ClientSecret, environment.ResourceManagerEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	spt.SetSender(httpClient)
+	var lock sync.Mutex
+	c.armToken = func() (string, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if err := spt.EnsureFresh(); err != nil {
+			return "", err
+		}
+		return spt.OAuthToken(), nil
+	}
+	return c, nil
+}
+
+// managedIdentityToken requests a token for the resource from the managed
+// identity of the virtual machine, and returns it with its expiration
+func managedIdentityToken(client *http.Client, resource string) (string, time.Time, error) {
+	query := url.Values{}
+	query.Set("api-version", "2018-02-01")
+	query.Set("resource", resource)
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresOn   string `json:"expires_on"`
+	}
+	if err := getIMDS(client, "identity/oauth2/token?"+query.Encode(), &result); err != nil {
+		return "", time.Time{}, fmt.Errorf("error requesting a managed identity token: %s", err)
+	}
+	expiresOn, err := strconv.ParseInt(result.ExpiresOn, 10, 64)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid managed identity token expiration %q", result.ExpiresOn)
+	}
+	return result.AccessToken, time.Unix(expiresOn, 0), nil
+}
+
+// getIMDS decodes a response of the Instance Metadata Service
+func getIMDS(client *http.Client, path string, out interface{}) error {
+	req, err := http.NewRequest("GET", imdsEndpoint+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Metadata", "true")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("instance metadata service returned status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// apiError is an error returned by an Azure API
+type apiError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("azure API returned status %d (%s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+// isNotFound returns whether err is an API error for a missing resource
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// computeResource is the subset of the virtual machine and scale set
+// resources used by the backend
+type computeResource struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Location string `json:"location"`
+	Identity struct {
+		PrincipalID            string `json:"principalId"`
+		UserAssignedIdentities map[string]struct {
+			PrincipalID string `json:"principalId"`
+		} `json:"userAssignedIdentities"`
+	} `json:"identity"`
+}
+
+// hasPrincipal returns whether the system or one of the user assigned
+// identities of the resource is the service principal
+func (r *computeResource) hasPrincipal(objectID string) bool {
+	if r.Identity.PrincipalID == objectID {
+		return true
+	}
+	for _, identity := range r.Identity.UserAssignedIdentities {
+		if identity.PrincipalID == objectID {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *azureClient) getVirtualMachine(subscriptionID, resourceGroup, name string) (*computeResource, error) {
+	return c.getComputeResource(subscriptionID, resourceGroup, "virtualMachines", name)
+}
+
+func (c *azureClient) getScaleSet(subscriptionID, resourceGroup, name string) (*computeResource, error) {
+	return c.getComputeResource(subscriptionID, resourceGroup, "virtualMachineScaleSets", name)
+}
+
+func (c *azureClient) getComputeResource(subscriptionID, resourceGroup, resourceType, name string) (*computeResource, error) {
+	u := fmt.Sprintf("%ssubscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/%s/%s?api-version=%s",
+		c.armEndpoint, url.PathEscape(subscriptionID), url.PathEscape(resourceGroup), resourceType, url.PathEscape(name), computeAPIVersion)
+
+	token, err := c.armToken()
+	if err != nil {
+		return nil, fmt.Errorf("error authenticating to azure: %s", err)
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var resource computeResource
+	if err := c.do(req, &resource); err != nil {
+		return nil, err
+	}
+	return &resource, nil
+}
+
+// signingKeys returns the issuer and the signing keys of the tenant, from
+// its OpenID Connect discovery document. The keys are fetched again when
+// refresh is set.
+func (c *azureClient) signingKeys(refresh bool) (string, map[string]*rsa.PublicKey, error) {
+	c.keysLock.Lock()
+	defer c.keysLock.Unlock()
+
+	if c.keys != nil && !refresh {
+		return c.issuer, c.keys, nil
+	}
+
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	discoveryURL := c.activeDirectoryEndpoint + url.PathEscape(c.tenantID) + "/.well-known/openid-configuration"
+	if err := c.get(discoveryURL, &discovery); err != nil {
+		return "", nil, fmt.Errorf("error fetching the discovery document of the tenant: %s", err)
+	}
+
+	var keySet struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := c.get(discovery.JWKSURI, &keySet); err != nil {
+		return "", nil, fmt.Errorf("error fetching the signing keys of the tenant: %s", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(keySet.Keys))
+	for _, k := range keySet.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid modulus of key %q: %s", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid exponent of key %q: %s", k.Kid, err)
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	c.issuer, c.keys = discovery.Issuer, keys
+	return c.issuer, c.keys, nil
+}
+
+func (c *azureClient) get(u string, out interface{}) error {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	return c.do(req, out)
+}
+
+// do makes a request to an API and decodes the response into out
+func (c *azureClient) do(req *http.Request, out interface{}) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return decodeAPIError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding azure API response: %s", err)
+	}
+	return nil
+}
+
+func decodeAPIError(resp *http.Response) error {
+	var errResp struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+
+	apiErr := &apiError{StatusCode: resp.StatusCode}
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err == nil {
+		apiErr.Code, apiErr.Message = errResp.Error.Code, errResp.Error.Message
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return apiErr
+}
@@ -0,0 +1,163 @@
+package azureauth
+
+import (
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `config`,
+		Fields: map[string]*framework.FieldSchema{
+			"tenant_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "ID of the Azure Active Directory tenant issuing the tokens.",
+			},
+			"resource": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Resource the tokens are requested for, which is their audience, for example https://management.azure.com/",
+			},
+			"environment": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Azure environment, such as "AzureUSGovernmentCloud". Defaults to "AzurePublicCloud".`,
+			},
+			"client_id": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Client ID of the service principal reading virtual machines. Defaults to the
+managed identity of the Vault server.`,
+			},
+			"client_secret": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Client secret of the service principal reading virtual machines.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+// Config returns the configuration of the backend
+func (b *backend) Config(s logical.Storage) (*azureConfig, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result azureConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	// The client secret is not returned
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"tenant_id":   config.TenantID,
+			"resource":    config.Resource,
+			"environment": config.Environment,
+			"client_id":   config.ClientID,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &azureConfig{}
+	}
+
+	if v, ok := d.GetOk("tenant_id"); ok {
+		config.TenantID = v.(string)
+	}
+	if v, ok := d.GetOk("resource"); ok {
+		config.Resource = v.(string)
+	}
+	if v, ok := d.GetOk("environment"); ok {
+		config.Environment = v.(string)
+	}
+	if v, ok := d.GetOk("client_id"); ok {
+		config.ClientID = v.(string)
+	}
+	if v, ok := d.GetOk("client_secret"); ok {
+		config.ClientSecret = v.(string)
+	}
+
+	switch {
+	case config.TenantID == "":
+		return logical.ErrorResponse("tenant_id is required"), nil
+	case config.Resource == "":
+		return logical.ErrorResponse("resource is required"), nil
+	case (config.ClientID == "") != (config.ClientSecret == ""):
+		return logical.ErrorResponse("client_id and client_secret must be set together"), nil
+	}
+	if config.Environment != "" {
+		if _, err := azure.EnvironmentFromName(config.Environment); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	b.resetClient()
+
+	return nil, nil
+}
+
+// azureConfig is the configuration of the backend
+type azureConfig struct {
+	TenantID     string `json:"tenant_id"`
+	Resource     string `json:"resource"`
+	Environment  string `json:"environment"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+const pathConfigHelpSyn = `
+Configures the Azure Active Directory tenant whose tokens log in.
+`
+
+const pathConfigHelpDesc = `
+The Azure backend accepts the access tokens issued by the "tenant_id" for the
+"resource", which the managed identities request from the Instance Metadata
+Service of their virtual machine.
+
+To verify the virtual machines and scale sets logging in, the backend reads
+them with the Azure Resource Manager API, as the service principal of the
+"client_id" and "client_secret", or as the managed identity of the Vault
+server when they are not set. It needs the "Reader" role on the resources.
+
+The "environment" parameter selects the Azure cloud, such as
+"AzureUSGovernmentCloud" or "AzureChinaCloud".
+`
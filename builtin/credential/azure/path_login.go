@@ -0,0 +1,319 @@
+package azureauth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathLogin(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "login$",
+		Fields: map[string]*framework.FieldSchema{
+			"role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role to log in with.",
+			},
+			"jwt": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Access token of the managed identity, issued for the configured resource.",
+			},
+			"subscription_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Subscription of the virtual machine.",
+			},
+			"resource_group_name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Resource group of the virtual machine.",
+			},
+			"vm_name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the virtual machine.",
+			},
+			"vmss_name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the scale set of the virtual machine, if any.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLogin,
+		},
+
+		HelpSynopsis:    pathLoginHelpSyn,
+		HelpDescription: pathLoginHelpDesc,
+	}
+}
+
+func (b *backend) pathLogin(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleName := strings.ToLower(d.Get("role").(string))
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+	jwtStr := d.Get("jwt").(string)
+	if jwtStr == "" {
+		return logical.ErrorResponse("missing jwt"), nil
+	}
+	vm := &virtualMachine{
+		SubscriptionID: d.Get("subscription_id").(string),
+		ResourceGroup:  d.Get("resource_group_name").(string),
+		Name:           d.Get("vm_name").(string),
+		ScaleSet:       d.Get("vmss_name").(string),
+	}
+
+	role, err := b.role(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid role name %q", roleName)), nil
+	}
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return logical.ErrorResponse("azure backend is not configured"), nil
+	}
+	client, err := b.azureClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := verifyToken(client, config, jwtStr)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	objectID, _ := claims["oid"].(string)
+	if objectID == "" {
+		return logical.ErrorResponse("token has no object ID"), nil
+	}
+	if err := validateClaims(role, claims); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	// The virtual machine is only trusted once the token is known to belong
+	// to one of its identities
+	if vm.Name != "" || vm.ScaleSet != "" || role.boundToResource() {
+		if err := verifyVirtualMachine(client, role, vm, objectID); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	displayName := vm.Name
+	if displayName == "" {
+		displayName = vm.ScaleSet
+	}
+	if displayName == "" {
+		displayName = objectID
+	}
+
+	auth := &logical.Auth{
+		Policies: role.Policies,
+		Period:   role.Period,
+		InternalData: map[string]interface{}{
+			"role": roleName,
+		},
+		Metadata: map[string]string{
+			"role":                roleName,
+			"object_id":           objectID,
+			"subscription_id":     vm.SubscriptionID,
+			"resource_group_name": vm.ResourceGroup,
+			"vm_name":             vm.Name,
+			"vmss_name":           vm.ScaleSet,
+		},
+		DisplayName: displayName,
+		LeaseOptions: logical.LeaseOptions{
+			TTL:       role.TTL,
+			Renewable: true,
+		},
+	}
+
+	// If 'Period' is set, use the value of 'Period' as the TTL
+	if role.Period > time.Duration(0) {
+		auth.TTL = role.Period
+	}
+
+	return &logical.Response{
+		Auth: auth,
+	}, nil
+}
+
+func (b *backend) pathLoginRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if req.Auth == nil {
+		return nil, fmt.Errorf("request auth was nil")
+	}
+
+	roleName, _ := req.Auth.InternalData["role"].(string)
+	if roleName == "" {
+		return nil, fmt.Errorf("failed to fetch role during renewal")
+	}
+
+	// The role must still exist and grant the same policies
+	role, err := b.role(req.Storage, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate role %s during renewal: %s", roleName, err)
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role %s does not exist during renewal", roleName)
+	}
+	if !policyutil.EquivalentPolicies(role.Policies, req.Auth.Policies) {
+		return nil, fmt.Errorf("policies have changed, not renewing")
+	}
+
+	if role.Period > time.Duration(0) {
+		req.Auth.TTL = role.Period
+		return &logical.Response{Auth: req.Auth}, nil
+	}
+	return framework.LeaseExtend(role.TTL, role.MaxTTL, b.System())(req, d)
+}
+
+// verifyToken verifies the signature, the expiration, the issuer and the
+// audience of the token, and returns its claims
+func verifyToken(client *azureClient, config *azureConfig, jwtStr string) (jwt.MapClaims, error) {
+	parser := &jwt.Parser{
+		ValidMethods: []string{"RS256"},
+	}
+
+	var issuer string
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(jwtStr, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		iss, keys, err := client.signingKeys(false)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := keys[kid]
+		if !ok {
+			// The keys of the tenant are rotated regularly
+			iss, keys, err = client.signingKeys(true)
+			if err != nil {
+				return nil, err
+			}
+			if key, ok = keys[kid]; !ok {
+				return nil, fmt.Errorf("unknown key ID %q", kid)
+			}
+		}
+		issuer = iss
+		return key, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify token: %s", err)
+	}
+
+	if iss, _ := claims["iss"].(string); iss != issuer {
+		return nil, fmt.Errorf("invalid issuer %q", iss)
+	}
+	if !claims.VerifyAudience(config.Resource, true) {
+		return nil, fmt.Errorf("invalid audience, expected %q", config.Resource)
+	}
+	return claims, nil
+}
+
+// validateClaims checks the service principal and the groups of the token
+// against the role
+func validateClaims(role *azureRole, claims jwt.MapClaims) error {
+	objectID, _ := claims["oid"].(string)
+	if len(role.BoundServicePrincipalIDs) != 0 && !strutil.StrListContains(role.BoundServicePrincipalIDs, objectID) {
+		return fmt.Errorf("service principal %q not authorized", objectID)
+	}
+
+	if len(role.BoundGroupIDs) != 0 {
+		groups, _ := claims["groups"].([]interface{})
+		for _, group := range groups {
+			if id, ok := group.(string); ok && strutil.StrListContains(role.BoundGroupIDs, id) {
+				return nil
+			}
+		}
+		return errors.New("service principal is not a member of a bound group")
+	}
+
+	return nil
+}
+
+// virtualMachine is the virtual machine a managed identity logs in from, as
+// given at login
+type virtualMachine struct {
+	SubscriptionID string
+	ResourceGroup  string
+	Name           string
+	ScaleSet       string
+}
+
+// verifyVirtualMachine checks that the service principal is an identity of
+// the virtual machine, or of its scale set, and checks them against the role
+func verifyVirtualMachine(client *azureClient, role *azureRole, vm *virtualMachine, objectID string) error {
+	if vm.SubscriptionID == "" || vm.ResourceGroup == "" {
+		return errors.New("subscription_id and resource_group_name are required")
+	}
+	if vm.Name == "" && vm.ScaleSet == "" {
+		return errors.New("vm_name or vmss_name is required")
+	}
+
+	if len(role.BoundSubscriptionIDs) != 0 && !strutil.StrListContains(role.BoundSubscriptionIDs, vm.SubscriptionID) {
+		return fmt.Errorf("subscription %q not authorized", vm.SubscriptionID)
+	}
+	if len(role.BoundResourceGroups) != 0 && !listContainsFold(role.BoundResourceGroups, vm.ResourceGroup) {
+		return fmt.Errorf("resource group %q not authorized", vm.ResourceGroup)
+	}
+	if len(role.BoundScaleSets) != 0 && !listContainsFold(role.BoundScaleSets, vm.ScaleSet) {
+		return fmt.Errorf("scale set %q not authorized", vm.ScaleSet)
+	}
+
+	var resource *computeResource
+	var err error
+	if vm.ScaleSet != "" {
+		resource, err = client.getScaleSet(vm.SubscriptionID, vm.ResourceGroup, vm.ScaleSet)
+	} else {
+		resource, err = client.getVirtualMachine(vm.SubscriptionID, vm.ResourceGroup, vm.Name)
+	}
+	switch {
+	case isNotFound(err):
+		return errors.New("virtual machine or scale set not found")
+	case err != nil:
+		return err
+	}
+
+	if !resource.hasPrincipal(objectID) {
+		return errors.New("token does not belong to an identity of the virtual machine")
+	}
+	if len(role.BoundLocations) != 0 && !listContainsFold(role.BoundLocations, resource.Location) {
+		return fmt.Errorf("location %q not authorized", resource.Location)
+	}
+
+	return nil
+}
+
+// listContainsFold looks for a string in a list, ignoring case, as the
+// names of Azure resources are case insensitive
+func listContainsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+const pathLoginHelpSyn = `
+Authenticates Azure managed identities with Vault.
+`
+
+const pathLoginHelpDesc = `
+Log in with the access token of a managed identity, requested from the
+Instance Metadata Service for the configured resource, and the name of a
+role.
+
+The subscription, the resource group and the name of the virtual machine, or
+of its scale set, are required by roles bound to them. They are read from the
+instance metadata of the virtual machine.
+`
@@ -0,0 +1,262 @@
+package azureauth
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    pathRoleHelpSyn,
+		HelpDescription: pathRoleHelpDesc,
+	}
+}
+
+func pathRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+			"bound_service_principal_ids": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of the object IDs of the service principals able to log in.",
+			},
+			"bound_group_ids": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of groups, one of which the service principals must be a member of.",
+			},
+			"bound_subscription_ids": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of the subscriptions of the virtual machines able to log in.",
+			},
+			"bound_resource_groups": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of the resource groups of the virtual machines able to log in.",
+			},
+			"bound_locations": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of the locations of the virtual machines able to log in.",
+			},
+			"bound_scale_sets": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of the scale sets able to log in.",
+			},
+			"policies": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of policies on the role.",
+			},
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Duration after which the issued tokens expire. Defaults to the mount's default TTL.",
+			},
+			"max_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Duration after which the issued tokens cannot be renewed. Defaults to the mount's maximum TTL.",
+			},
+			"period": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `If set, the issued tokens are periodic: they never expire as long as they
+are renewed within this duration.`,
+			},
+		},
+
+		ExistenceCheck: b.pathRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathRoleCreateUpdate,
+			logical.UpdateOperation: b.pathRoleCreateUpdate,
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    pathRoleHelpSyn,
+		HelpDescription: pathRoleHelpDesc,
+	}
+}
+
+// role returns the named role, or nil if it does not exist
+func (b *backend) role(s logical.Storage, name string) (*azureRole, error) {
+	entry, err := s.Get("role/" + strings.ToLower(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result azureRole
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathRoleExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	role, err := b.role(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return role != nil, nil
+}
+
+func (b *backend) pathRoleList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roles, err := req.Storage.List("role/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathRoleRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := b.role(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"bound_service_principal_ids": role.BoundServicePrincipalIDs,
+			"bound_group_ids":             role.BoundGroupIDs,
+			"bound_subscription_ids":      role.BoundSubscriptionIDs,
+			"bound_resource_groups":       role.BoundResourceGroups,
+			"bound_locations":             role.BoundLocations,
+			"bound_scale_sets":            role.BoundScaleSets,
+			"policies":                    role.Policies,
+			"ttl":                         int64(role.TTL / time.Second),
+			"max_ttl":                     int64(role.MaxTTL / time.Second),
+			"period":                      int64(role.Period / time.Second),
+		},
+	}, nil
+}
+
+func (b *backend) pathRoleDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete("role/" + strings.ToLower(d.Get("name").(string))); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathRoleCreateUpdate(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := strings.ToLower(d.Get("name").(string))
+	role, err := b.role(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role = &azureRole{}
+	}
+
+	if raw, ok := d.GetOk("bound_service_principal_ids"); ok {
+		role.BoundServicePrincipalIDs = raw.([]string)
+	}
+	if raw, ok := d.GetOk("bound_group_ids"); ok {
+		role.BoundGroupIDs = raw.([]string)
+	}
+	if raw, ok := d.GetOk("bound_subscription_ids"); ok {
+		role.BoundSubscriptionIDs = raw.([]string)
+	}
+	if raw, ok := d.GetOk("bound_resource_groups"); ok {
+		role.BoundResourceGroups = raw.([]string)
+	}
+	if raw, ok := d.GetOk("bound_locations"); ok {
+		role.BoundLocations = raw.([]string)
+	}
+	if raw, ok := d.GetOk("bound_scale_sets"); ok {
+		role.BoundScaleSets = raw.([]string)
+	}
+	if raw, ok := d.GetOk("policies"); ok {
+		role.Policies = policyutil.SanitizePolicies(raw.([]string), true)
+	} else if req.Operation == logical.CreateOperation {
+		role.Policies = policyutil.SanitizePolicies(nil, true)
+	}
+	if raw, ok := d.GetOk("ttl"); ok {
+		role.TTL = time.Duration(raw.(int)) * time.Second
+	}
+	if raw, ok := d.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(raw.(int)) * time.Second
+	}
+	if raw, ok := d.GetOk("period"); ok {
+		role.Period = time.Duration(raw.(int)) * time.Second
+	}
+
+	if len(role.BoundServicePrincipalIDs) == 0 && len(role.BoundGroupIDs) == 0 &&
+		len(role.BoundSubscriptionIDs) == 0 && len(role.BoundResourceGroups) == 0 &&
+		len(role.BoundLocations) == 0 && len(role.BoundScaleSets) == 0 {
+		return logical.ErrorResponse("at least one bound constraint must be set"), nil
+	}
+	if role.MaxTTL > 0 && role.TTL > role.MaxTTL {
+		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	}
+	if role.Period > b.System().MaxLeaseTTL() {
+		return logical.ErrorResponse("period cannot be greater than the mount's maximum TTL"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("role/"+name, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// azureRole binds service principals and virtual machines to policies
+type azureRole struct {
+	BoundServicePrincipalIDs []string      `json:"bound_service_principal_ids"`
+	BoundGroupIDs            []string      `json:"bound_group_ids"`
+	BoundSubscriptionIDs     []string      `json:"bound_subscription_ids"`
+	BoundResourceGroups      []string      `json:"bound_resource_groups"`
+	BoundLocations           []string      `json:"bound_locations"`
+	BoundScaleSets           []string      `json:"bound_scale_sets"`
+	Policies                 []string      `json:"policies"`
+	TTL                      time.Duration `json:"ttl"`
+	MaxTTL                   time.Duration `json:"max_ttl"`
+	Period                   time.Duration `json:"period"`
+}
+
+// boundToResource returns whether the role binds properties of the virtual
+// machine, which must then be verified
+func (r *azureRole) boundToResource() bool {
+	return len(r.BoundSubscriptionIDs) != 0 || len(r.BoundResourceGroups) != 0 ||
+		len(r.BoundLocations) != 0 || len(r.BoundScaleSets) != 0
+}
+
+const pathRoleHelpSyn = `
+Manage the roles binding managed identities to policies.
+`
+
+const pathRoleHelpDesc = `
+A role allows the managed identities matching all of its bound constraints to
+log in and obtain tokens with its policies. At least one constraint must be
+set.
+
+The service principal and group constraints are checked against the claims of
+the token. The subscription, resource group, location and scale set
+constraints apply to the virtual machine or scale set given at login, which
+is read with the Azure Resource Manager API to verify that the token belongs
+to one of its identities.
+`
@@ -1,6 +1,7 @@
 package cert
 
 import (
+	"net/http"
 	"strings"
 	"sync"
 
@@ -42,6 +43,7 @@ func Backend() *backend {
 	}
 
 	b.crlUpdateMutex = &sync.RWMutex{}
+	b.ocspClient = ocspClient()
 
 	return &b
 }
@@ -52,6 +54,12 @@ type backend struct {
 
 	crls           map[string]CRLInfo
 	crlUpdateMutex *sync.RWMutex
+
+	// ocspCache holds the OCSP responses which are still valid, by issuer
+	// and serial number
+	ocspCache  map[string]*ocspResponse
+	ocspLock   sync.Mutex
+	ocspClient *http.Client
 }
 
 func (b *backend) invalidate(key string) {
@@ -6,6 +6,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"fmt"
 	"io/ioutil"
 	"math/big"
@@ -1079,3 +1080,137 @@ func Test_Renew(t *testing.T) {
 		t.Fatal("expected error")
 	}
 }
+
+func TestBackend_extendedConstraints(t *testing.T) {
+	ca := newTestCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+
+	// The subject alternative names are set as an extension, since the
+	// certificate templates do not have URIs
+	sans, err := asn1.Marshal([]asn1.RawValue{
+		{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte("web.example.com")},
+		{Class: asn1.ClassContextSpecific, Tag: 1, Bytes: []byte("web@example.com")},
+		{Class: asn1.ClassContextSpecific, Tag: 6, Bytes: []byte("spiffe://example.com/web")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	team, err := asn1.Marshal("engineering")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "web"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidSubjectAltName, Value: sans},
+			{Id: asn1.ObjectIdentifier{1, 2, 3, 4}, Value: team},
+		},
+	}, ca)
+
+	if uris := certificateURIs(client.cert); !reflect.DeepEqual(uris, []string{"spiffe://example.com/web"}) {
+		t.Fatalf("bad: %#v", uris)
+	}
+
+	b := Backend()
+	if _, err := b.Setup(&logical.BackendConfig{
+		System: &logical.StaticSystemView{
+			DefaultLeaseTTLVal: time.Hour,
+			MaxLeaseTTLVal:     time.Hour,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	storage := &logical.InmemStorage{}
+
+	login := func(data map[string]interface{}) *logical.Response {
+		data["certificate"] = ca.pem()
+		data["policies"] = "foo"
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "certs/web",
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: %v %#v", err, resp)
+		}
+
+		resp, err = b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "login",
+			Storage:   storage,
+			Connection: &logical.Connection{
+				ConnState: &tls.ConnectionState{
+					PeerCertificates: []*x509.Certificate{client.cert},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || resp.IsError() || resp.Auth == nil {
+			return nil
+		}
+		return resp
+	}
+
+	for _, c := range []struct {
+		data    map[string]interface{}
+		success bool
+	}{
+		{map[string]interface{}{"allowed_common_names": "w*"}, true},
+		{map[string]interface{}{"allowed_common_names": "db"}, false},
+		{map[string]interface{}{"allowed_dns_sans": "db.example.com,*.example.com"}, true},
+		{map[string]interface{}{"allowed_dns_sans": "*.example.org"}, false},
+		{map[string]interface{}{"allowed_email_sans": "*@example.com"}, true},
+		{map[string]interface{}{"allowed_email_sans": "db@example.com"}, false},
+		{map[string]interface{}{"allowed_uri_sans": "spiffe://example.com/*"}, true},
+		{map[string]interface{}{"allowed_uri_sans": "spiffe://example.org/*"}, false},
+		{map[string]interface{}{"required_extensions": "1.2.3.4:eng*"}, true},
+		{map[string]interface{}{"required_extensions": "1.2.3.4:sales"}, false},
+		{map[string]interface{}{"required_extensions": "1.2.3.4:*,1.2.3.5:*"}, false},
+		{map[string]interface{}{"allowed_dns_sans": "*.example.com", "allowed_uri_sans": "spiffe://example.org/*"}, false},
+	} {
+		if resp := login(c.data); (resp != nil) != c.success {
+			t.Fatalf("%v: expected success %t", c.data, c.success)
+		}
+	}
+
+	resp := login(map[string]interface{}{"allowed_metadata_extensions": "1.2.3.4,1.2.3.5"})
+	if resp == nil {
+		t.Fatal("expected login to succeed")
+	}
+	if resp.Auth.Metadata["1-2-3-4"] != "engineering" {
+		t.Fatalf("bad: %#v", resp.Auth.Metadata)
+	}
+	if _, ok := resp.Auth.Metadata["1-2-3-5"]; ok {
+		t.Fatalf("bad: %#v", resp.Auth.Metadata)
+	}
+
+	for _, data := range []map[string]interface{}{
+		{"required_extensions": "1.2.3.4"},
+		{"required_extensions": "foo:bar"},
+		{"allowed_metadata_extensions": "1.x"},
+	} {
+		data["certificate"] = ca.pem()
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "certs/web",
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%v: expected an error", data)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package cert
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+// This file implements the subset of the Online Certificate Status Protocol
+// (RFC 6960) used to check the revocation status of client certificates:
+// building requests for a single certificate, and parsing and verifying the
+// basic responses to them.
+
+const (
+	ocspStatusGood = iota
+	ocspStatusRevoked
+	ocspStatusUnknown
+)
+
+// ocspSkew is the clock skew allowed when checking the validity period of
+// responses
+const ocspSkew = 5 * time.Minute
+
+var (
+	oidOCSPBasicResponse = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+
+	ocspHashOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+		crypto.SHA1:   asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26},
+		crypto.SHA256: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1},
+		crypto.SHA384: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2},
+		crypto.SHA512: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3},
+	}
+
+	ocspSignatureAlgorithms = []struct {
+		oid       asn1.ObjectIdentifier
+		algorithm x509.SignatureAlgorithm
+	}{
+		{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}, x509.SHA1WithRSA},
+		{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, x509.SHA256WithRSA},
+		{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, x509.SHA384WithRSA},
+		{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, x509.SHA512WithRSA},
+		{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}, x509.ECDSAWithSHA1},
+		{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, x509.ECDSAWithSHA256},
+		{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, x509.ECDSAWithSHA384},
+		{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}, x509.ECDSAWithSHA512},
+	}
+)
+
+type ocspCertID struct {
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+type ocspRequestASN1 struct {
+	TBSRequest ocspTBSRequest
+}
+
+type ocspTBSRequest struct {
+	Version     int `asn1:"explicit,tag:0,default:0,optional"`
+	RequestList []ocspSingleRequest
+}
+
+type ocspSingleRequest struct {
+	Cert ocspCertID
+}
+
+type ocspResponseASN1 struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    ocspResponseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Raw            asn1.RawContent
+	Version        int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID asn1.RawValue
+	ProducedAt     time.Time `asn1:"generalized"`
+	Responses      []ocspSingleResponse
+}
+
+type ocspSingleResponse struct {
+	CertID     ocspCertID
+	Good       asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked    ocspRevokedInfo  `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate time.Time        `asn1:"generalized"`
+	NextUpdate time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	Extensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+// ocspResponse is the status of a certificate given by an OCSP responder
+type ocspResponse struct {
+	Status     int
+	RevokedAt  time.Time
+	ThisUpdate time.Time
+	NextUpdate time.Time
+}
+
+// ocspIssuerHashes returns the hashes of the name and of the public key of
+// the issuer identifying it in OCSP requests and responses
+func ocspIssuerHashes(issuer *x509.Certificate, hash crypto.Hash) ([]byte, []byte, error) {
+	if !hash.Available() {
+		return nil, nil, fmt.Errorf("hash function %v is not available", hash)
+	}
+
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &publicKeyInfo); err != nil {
+		return nil, nil, err
+	}
+
+	h := hash.New()
+	h.Write(issuer.RawSubject)
+	nameHash := h.Sum(nil)
+
+	h.Reset()
+	h.Write(publicKeyInfo.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+
+	return nameHash, keyHash, nil
+}
+
+// createOCSPRequest returns the DER encoded request for the status of a
+// certificate
+func createOCSPRequest(cert, issuer *x509.Certificate) ([]byte, error) {
+	nameHash, keyHash, err := ocspIssuerHashes(issuer, crypto.SHA1)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(ocspRequestASN1{
+		TBSRequest: ocspTBSRequest{
+			RequestList: []ocspSingleRequest{
+				{
+					Cert: ocspCertID{
+						HashAlgorithm: pkix.AlgorithmIdentifier{
+							Algorithm:  ocspHashOIDs[crypto.SHA1],
+							Parameters: asn1.RawValue{Tag: asn1.TagNull},
+						},
+						IssuerNameHash: nameHash,
+						IssuerKeyHash:  keyHash,
+						SerialNumber:   cert.SerialNumber,
+					},
+				},
+			},
+		},
+	})
+}
+
+// parseOCSPResponse parses a DER encoded response, verifies that it is
+// signed by the issuer or by a responder the issuer delegated to, and
+// returns the status of the certificate it contains
+func parseOCSPResponse(der []byte, cert, issuer *x509.Certificate, now time.Time) (*ocspResponse, error) {
+	var resp ocspResponseASN1
+	rest, err := asn1.Unmarshal(der, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("malformed OCSP response: %v", err)
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data in OCSP response")
+	}
+	if resp.Status != 0 {
+		return nil, fmt.Errorf("OCSP responder returned status %d", resp.Status)
+	}
+	if !resp.Response.ResponseType.Equal(oidOCSPBasicResponse) {
+		return nil, errors.New("unsupported OCSP response type")
+	}
+
+	var basic ocspBasicResponse
+	if _, err := asn1.Unmarshal(resp.Response.Response, &basic); err != nil {
+		return nil, fmt.Errorf("malformed OCSP basic response: %v", err)
+	}
+
+	if err := verifyOCSPSignature(&basic, issuer); err != nil {
+		return nil, err
+	}
+
+	for _, single := range basic.TBSResponseData.Responses {
+		if single.CertID.SerialNumber == nil || single.CertID.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+			continue
+		}
+		hash, ok := ocspHashFromOID(single.CertID.HashAlgorithm.Algorithm)
+		if !ok {
+			continue
+		}
+		nameHash, keyHash, err := ocspIssuerHashes(issuer, hash)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(nameHash, single.CertID.IssuerNameHash) || !bytes.Equal(keyHash, single.CertID.IssuerKeyHash) {
+			continue
+		}
+
+		if single.ThisUpdate.After(now.Add(ocspSkew)) {
+			return nil, errors.New("OCSP response is not yet valid")
+		}
+		if !single.NextUpdate.IsZero() && single.NextUpdate.Add(ocspSkew).Before(now) {
+			return nil, errors.New("OCSP response has expired")
+		}
+
+		result := &ocspResponse{
+			ThisUpdate: single.ThisUpdate,
+			NextUpdate: single.NextUpdate,
+		}
+		switch {
+		case bool(single.Good):
+			result.Status = ocspStatusGood
+		case bool(single.Unknown):
+			result.Status = ocspStatusUnknown
+		default:
+			result.Status = ocspStatusRevoked
+			result.RevokedAt = single.Revoked.RevocationTime
+		}
+		return result, nil
+	}
+
+	return nil, errors.New("OCSP response does not contain the certificate")
+}
+
+// verifyOCSPSignature checks the signature of a basic response. It is signed
+// either by the issuer itself, or by a certificate included in the response
+// which the issuer signed for OCSP signing.
+func verifyOCSPSignature(basic *ocspBasicResponse, issuer *x509.Certificate) error {
+	algorithm := x509.UnknownSignatureAlgorithm
+	for _, a := range ocspSignatureAlgorithms {
+		if a.oid.Equal(basic.SignatureAlgorithm.Algorithm) {
+			algorithm = a.algorithm
+			break
+		}
+	}
+	if algorithm == x509.UnknownSignatureAlgorithm {
+		return errors.New("unsupported OCSP response signature algorithm")
+	}
+
+	signed := basic.TBSResponseData.Raw
+	signature := basic.Signature.RightAlign()
+	if issuer.CheckSignature(algorithm, signed, signature) == nil {
+		return nil
+	}
+
+	for _, raw := range basic.Certificates {
+		responder, err := x509.ParseCertificate(raw.FullBytes)
+		if err != nil {
+			continue
+		}
+		if responder.CheckSignatureFrom(issuer) != nil || !hasOCSPSigningUsage(responder) {
+			continue
+		}
+		if responder.CheckSignature(algorithm, signed, signature) == nil {
+			return nil
+		}
+	}
+
+	return errors.New("OCSP response is not signed by the issuer or by an authorized responder")
+}
+
+func hasOCSPSigningUsage(cert *x509.Certificate) bool {
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageOCSPSigning {
+			return true
+		}
+	}
+	return false
+}
+
+func ocspHashFromOID(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	for hash, hashOID := range ocspHashOIDs {
+		if hashOID.Equal(oid) {
+			return hash, true
+		}
+	}
+	return 0, false
+}
+
+// queryOCSP requests the status of a certificate from a responder
+func queryOCSP(client *http.Client, server string, cert, issuer *x509.Certificate) (*ocspResponse, error) {
+	request, err := createOCSPRequest(cert, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequest("POST", server, bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/ocsp-request")
+	httpReq.Header.Set("Accept", "application/ocsp-response")
+
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OCSP responder returned HTTP status %d", httpResp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseOCSPResponse(body, cert, issuer, time.Now())
+}
+
+// ocspClient returns the client used to query OCSP responders
+func ocspClient() *http.Client {
+	client := cleanhttp.DefaultClient()
+	client.Timeout = 10 * time.Second
+	return client
+}
@@ -0,0 +1,331 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCertificate(t *testing.T, template *x509.Certificate, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCertificate{cert: cert, key: key}
+}
+
+func (c *testCertificate) pem() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}))
+}
+
+// testOCSPResponse returns a response giving the status of cert, signed by
+// signer, which includes its certificate if it is not the issuer
+func testOCSPResponse(t *testing.T, cert, issuer, signer *testCertificate, status int) []byte {
+	nameHash, keyHash, err := ocspIssuerHashes(issuer.cert, crypto.SHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responderID, err := asn1.Marshal(keyHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	single := ocspSingleResponse{
+		CertID: ocspCertID{
+			HashAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  ocspHashOIDs[crypto.SHA1],
+				Parameters: asn1.RawValue{Tag: asn1.TagNull},
+			},
+			IssuerNameHash: nameHash,
+			IssuerKeyHash:  keyHash,
+			SerialNumber:   cert.cert.SerialNumber,
+		},
+		ThisUpdate: now.Add(-time.Minute).UTC(),
+		NextUpdate: now.Add(time.Hour).UTC(),
+	}
+	switch status {
+	case ocspStatusGood:
+		single.Good = true
+	case ocspStatusRevoked:
+		single.Revoked = ocspRevokedInfo{RevocationTime: now.Add(-time.Minute).UTC()}
+	default:
+		single.Unknown = true
+	}
+
+	tbs, err := asn1.Marshal(ocspResponseData{
+		RawResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: responderID},
+		ProducedAt:     now.UTC(),
+		Responses:      []ocspSingleResponse{single},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(tbs)
+	signature, err := signer.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	basic := ocspBasicResponse{
+		TBSResponseData: ocspResponseData{Raw: tbs},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{
+			Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2},
+		},
+		Signature: asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+	}
+	if signer != issuer {
+		basic.Certificates = []asn1.RawValue{{FullBytes: signer.cert.Raw}}
+	}
+	basicDER, err := asn1.Marshal(basic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := asn1.Marshal(ocspResponseASN1{
+		Response: ocspResponseBytes{
+			ResponseType: oidOCSPBasicResponse,
+			Response:     basicDER,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestOCSP_parseResponse(t *testing.T) {
+	ca := newTestCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	client := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "client"},
+	}, ca)
+	responder := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "responder"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	}, ca)
+	other := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(4),
+		Subject:      pkix.Name{CommonName: "other"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+
+	// The request identifies the certificate by its serial number
+	request, err := createOCSPRequest(client.cert, ca.cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed ocspRequestASN1
+	if _, err := asn1.Unmarshal(request, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.TBSRequest.RequestList) != 1 || parsed.TBSRequest.RequestList[0].Cert.SerialNumber.Cmp(big.NewInt(2)) != 0 {
+		t.Fatalf("bad: %#v", parsed)
+	}
+
+	now := time.Now()
+	for _, status := range []int{ocspStatusGood, ocspStatusRevoked, ocspStatusUnknown} {
+		for _, signer := range []*testCertificate{ca, responder} {
+			resp, err := parseOCSPResponse(testOCSPResponse(t, client, ca, signer, status), client.cert, ca.cert, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != status {
+				t.Fatalf("expected status %d, got %d", status, resp.Status)
+			}
+		}
+	}
+
+	// Responses signed by a certificate not authorized for OCSP are rejected
+	if _, err := parseOCSPResponse(testOCSPResponse(t, client, ca, other, ocspStatusGood), client.cert, ca.cert, now); err == nil {
+		t.Fatal("expected an error for an unauthorized signer")
+	}
+
+	// Responses for another certificate are rejected
+	if _, err := parseOCSPResponse(testOCSPResponse(t, other, ca, ca, ocspStatusGood), client.cert, ca.cert, now); err == nil {
+		t.Fatal("expected an error for another certificate")
+	}
+
+	// Expired responses are rejected
+	if _, err := parseOCSPResponse(testOCSPResponse(t, client, ca, ca, ocspStatusGood), client.cert, ca.cert, now.Add(2*time.Hour)); err == nil {
+		t.Fatal("expected an error for an expired response")
+	}
+}
+
+func TestBackend_OCSPLogin(t *testing.T) {
+	var status atomic.Value
+	status.Store(ocspStatusGood)
+	var queries int32
+
+	var ca, client *testCertificate
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&queries, 1)
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(testOCSPResponse(t, client, ca, ca, status.Load().(int)))
+	}))
+	defer responder.Close()
+
+	ca = newTestCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	client = newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "client"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		OCSPServer:   []string{responder.URL},
+	}, ca)
+
+	b := Backend()
+	if _, err := b.Setup(&logical.BackendConfig{
+		System: &logical.StaticSystemView{
+			DefaultLeaseTTLVal: time.Hour,
+			MaxLeaseTTLVal:     time.Hour,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	storage := &logical.InmemStorage{}
+
+	writeCert := func(data map[string]interface{}) {
+		data["certificate"] = ca.pem()
+		data["policies"] = "foo"
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "certs/web",
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: %v %#v", err, resp)
+		}
+		b.ocspCache = nil
+	}
+	login := func() bool {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "login",
+			Storage:   storage,
+			Connection: &logical.Connection{
+				ConnState: &tls.ConnectionState{
+					PeerCertificates: []*x509.Certificate{client.cert},
+				},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp != nil && !resp.IsError() && resp.Auth != nil
+	}
+
+	writeCert(map[string]interface{}{
+		"ocsp_enabled": true,
+	})
+	if !login() {
+		t.Fatal("expected login to succeed")
+	}
+
+	// The response is cached until its next update
+	if !login() || atomic.LoadInt32(&queries) != 1 {
+		t.Fatalf("expected a single OCSP query, got %d", atomic.LoadInt32(&queries))
+	}
+
+	status.Store(ocspStatusRevoked)
+	b.ocspCache = nil
+	if login() {
+		t.Fatal("expected login of a revoked certificate to fail")
+	}
+
+	// Revoked certificates are rejected even when failing open
+	writeCert(map[string]interface{}{
+		"ocsp_enabled":   true,
+		"ocsp_fail_open": true,
+	})
+	if login() {
+		t.Fatal("expected login of a revoked certificate to fail")
+	}
+
+	// Unreachable responders fail the login unless failing open
+	status.Store(ocspStatusGood)
+	writeCert(map[string]interface{}{
+		"ocsp_enabled":          true,
+		"ocsp_servers_override": "http://127.0.0.1:1",
+	})
+	if login() {
+		t.Fatal("expected login to fail when failing closed")
+	}
+	writeCert(map[string]interface{}{
+		"ocsp_enabled":          true,
+		"ocsp_servers_override": "http://127.0.0.1:1",
+		"ocsp_fail_open":        true,
+	})
+	if !login() {
+		t.Fatal("expected login to succeed when failing open")
+	}
+
+	// The override is tried in order
+	writeCert(map[string]interface{}{
+		"ocsp_enabled":          true,
+		"ocsp_servers_override": "http://127.0.0.1:1," + responder.URL,
+	})
+	if !login() {
+		t.Fatal("expected login to succeed")
+	}
+
+	// Revocation is not checked when OCSP is disabled
+	status.Store(ocspStatusRevoked)
+	writeCert(map[string]interface{}{})
+	if !login() {
+		t.Fatal("expected login to succeed")
+	}
+}
@@ -3,6 +3,7 @@ package cert
 import (
 	"crypto/x509"
 	"fmt"
+	"net/url"
 	"strings"
 	"time"
 
@@ -45,6 +46,46 @@ Must be x509 PEM encoded.`,
 At least one must exist in either the Common Name or SANs. Supports globbing.`,
 			},
 
+			"allowed_common_names": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `A comma-separated list of names.
+At least one must match the Common Name. Supports globbing.`,
+			},
+
+			"allowed_dns_sans": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `A comma-separated list of DNS names.
+At least one must match a DNS SAN. Supports globbing.`,
+			},
+
+			"allowed_email_sans": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `A comma-separated list of email addresses.
+At least one must match an email SAN. Supports globbing.`,
+			},
+
+			"allowed_uri_sans": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `A comma-separated list of URIs.
+At least one must match a URI SAN. Supports globbing.`,
+			},
+
+			"required_extensions": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `A comma-separated list of "oid:value" pairs.
+The client certificate must have every extension,
+with an ASN.1 string value matching the value.
+Supports globbing on the value.`,
+			},
+
+			"allowed_metadata_extensions": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `A comma-separated list of extension OIDs.
+The ASN.1 string values of these extensions in the
+client certificate are added to the token metadata,
+with the dots of the OID replaced by dashes.`,
+			},
+
 			"display_name": &framework.FieldSchema{
 				Type: framework.TypeString,
 				Description: `The display name to use for clients using this
@@ -67,6 +108,25 @@ seconds. Defaults to system/backend default TTL.`,
 				Description: `TTL for tokens issued by this backend.
 Defaults to system/backend default TTL time.`,
 			},
+
+			"ocsp_enabled": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Whether to check the revocation status of client
+certificates with OCSP at login.`,
+			},
+
+			"ocsp_servers_override": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `A comma-separated list of OCSP responder URLs to
+query instead of those of the client certificates.`,
+			},
+
+			"ocsp_fail_open": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If true, logins are allowed when no OCSP responder
+gives the status of the client certificate. Revoked
+certificates are always rejected.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -135,6 +195,18 @@ func (b *backend) pathCertRead(
 			"display_name": cert.DisplayName,
 			"policies":     strings.Join(cert.Policies, ","),
 			"ttl":          duration / time.Second,
+
+			"allowed_names":               cert.AllowedNames,
+			"allowed_common_names":        cert.AllowedCommonNames,
+			"allowed_dns_sans":            cert.AllowedDNSSANs,
+			"allowed_email_sans":          cert.AllowedEmailSANs,
+			"allowed_uri_sans":            cert.AllowedURISANs,
+			"required_extensions":         cert.RequiredExtensions,
+			"allowed_metadata_extensions": cert.AllowedMetadataExtensions,
+
+			"ocsp_enabled":          cert.OCSPEnabled,
+			"ocsp_servers_override": cert.OCSPServersOverride,
+			"ocsp_fail_open":        cert.OCSPFailOpen,
 		},
 	}, nil
 }
@@ -171,12 +243,47 @@ func (b *backend) pathCertWrite(
 		}
 	}
 
+	requiredExtensions := d.Get("required_extensions").([]string)
+	for _, ext := range requiredExtensions {
+		parts := strings.SplitN(ext, ":", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return logical.ErrorResponse(fmt.Sprintf("required extension %q must be of the form \"oid:value\"", ext)), nil
+		}
+		if _, err := parseOID(parts[0]); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid OID %q in required extension", parts[0])), nil
+		}
+	}
+	metadataExtensions := d.Get("allowed_metadata_extensions").([]string)
+	for _, oid := range metadataExtensions {
+		if _, err := parseOID(oid); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid OID %q in allowed_metadata_extensions", oid)), nil
+		}
+	}
+
+	ocspServers := d.Get("ocsp_servers_override").([]string)
+	for _, server := range ocspServers {
+		if u, err := url.Parse(server); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return logical.ErrorResponse(fmt.Sprintf("invalid OCSP server URL %q", server)), nil
+		}
+	}
+
 	certEntry := &CertEntry{
 		Name:         name,
 		Certificate:  certificate,
 		DisplayName:  displayName,
 		Policies:     policies,
 		AllowedNames: allowedNames,
+
+		AllowedCommonNames:        d.Get("allowed_common_names").([]string),
+		AllowedDNSSANs:            d.Get("allowed_dns_sans").([]string),
+		AllowedEmailSANs:          d.Get("allowed_email_sans").([]string),
+		AllowedURISANs:            d.Get("allowed_uri_sans").([]string),
+		RequiredExtensions:        requiredExtensions,
+		AllowedMetadataExtensions: metadataExtensions,
+
+		OCSPEnabled:         d.Get("ocsp_enabled").(bool),
+		OCSPServersOverride: ocspServers,
+		OCSPFailOpen:        d.Get("ocsp_fail_open").(bool),
 	}
 
 	// Parse the lease duration or default to backend/system default
@@ -210,6 +317,17 @@ type CertEntry struct {
 	Policies     []string
 	TTL          time.Duration
 	AllowedNames []string
+
+	AllowedCommonNames        []string
+	AllowedDNSSANs            []string
+	AllowedEmailSANs          []string
+	AllowedURISANs            []string
+	RequiredExtensions        []string
+	AllowedMetadataExtensions []string
+
+	OCSPEnabled         bool
+	OCSPServersOverride []string
+	OCSPFailOpen        bool
 }
 
 const pathCertHelpSyn = `
@@ -2,13 +2,17 @@ package cert
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/helper/certutil"
 	"github.com/hashicorp/vault/helper/policyutil"
@@ -18,6 +22,11 @@ import (
 	"github.com/ryanuber/go-glob"
 )
 
+var oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// sanURITag is the tag of the uniformResourceIdentifier general names
+const sanURITag = 6
+
 // ParsedCert is a certificate that has been configured as trusted
 type ParsedCert struct {
 	Entry        *CertEntry
@@ -67,6 +76,24 @@ func (b *backend) pathLogin(
 	skid := base64.StdEncoding.EncodeToString(clientCerts[0].SubjectKeyId)
 	akid := base64.StdEncoding.EncodeToString(clientCerts[0].AuthorityKeyId)
 
+	metadata := map[string]string{
+		"cert_name":        matched.Entry.Name,
+		"common_name":      clientCerts[0].Subject.CommonName,
+		"subject_key_id":   certutil.GetHexFormatted(clientCerts[0].SubjectKeyId, ":"),
+		"authority_key_id": certutil.GetHexFormatted(clientCerts[0].AuthorityKeyId, ":"),
+	}
+
+	// Add the values of the allowed extensions, keyed by OID with dashes
+	// instead of dots
+	if len(matched.Entry.AllowedMetadataExtensions) != 0 {
+		extensions := certificateExtensions(clientCerts[0])
+		for _, oid := range matched.Entry.AllowedMetadataExtensions {
+			if value, ok := extensions[oid]; ok {
+				metadata[strings.Replace(oid, ".", "-", -1)] = value
+			}
+		}
+	}
+
 	// Generate a response
 	resp := &logical.Response{
 		Auth: &logical.Auth{
@@ -76,12 +103,7 @@ func (b *backend) pathLogin(
 			},
 			Policies:    matched.Entry.Policies,
 			DisplayName: matched.Entry.DisplayName,
-			Metadata: map[string]string{
-				"cert_name":        matched.Entry.Name,
-				"common_name":      clientCerts[0].Subject.CommonName,
-				"subject_key_id":   certutil.GetHexFormatted(clientCerts[0].SubjectKeyId, ":"),
-				"authority_key_id": certutil.GetHexFormatted(clientCerts[0].AuthorityKeyId, ":"),
-			},
+			Metadata:    metadata,
 			LeaseOptions: logical.LeaseOptions{
 				Renewable: true,
 				TTL:       ttl,
@@ -238,7 +260,199 @@ func (b *backend) matchesConstraints(clientCert *x509.Certificate, trustedChain
 		}
 	}
 
-	return !b.checkForChainInCRLs(trustedChain) && nameMatched
+	return nameMatched &&
+		matchesAny(config.Entry.AllowedCommonNames, []string{clientCert.Subject.CommonName}) &&
+		matchesAny(config.Entry.AllowedDNSSANs, clientCert.DNSNames) &&
+		matchesAny(config.Entry.AllowedEmailSANs, clientCert.EmailAddresses) &&
+		matchesAny(config.Entry.AllowedURISANs, certificateURIs(clientCert)) &&
+		matchesExtensions(clientCert, config.Entry.RequiredExtensions) &&
+		!b.checkForChainInCRLs(trustedChain) &&
+		b.checkOCSP(clientCert, trustedChain, config.Entry)
+}
+
+// matchesAny returns whether at least one of the values matches one of the
+// glob patterns, or true if there are no patterns
+func matchesAny(patterns []string, values []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if glob.Glob(pattern, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesExtensions returns whether the certificate has every required
+// extension, given as "oid:pattern", with a value matching the pattern
+func matchesExtensions(clientCert *x509.Certificate, required []string) bool {
+	values := certificateExtensions(clientCert)
+	for _, ext := range required {
+		parts := strings.SplitN(ext, ":", 2)
+		if len(parts) != 2 {
+			return false
+		}
+		value, ok := values[parts[0]]
+		if !ok || !glob.Glob(parts[1], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// certificateExtensions returns the values of the extensions of the
+// certificate which are ASN.1 strings, by OID
+func certificateExtensions(cert *x509.Certificate) map[string]string {
+	values := make(map[string]string, len(cert.Extensions))
+	for _, ext := range cert.Extensions {
+		var value string
+		if rest, err := asn1.Unmarshal(ext.Value, &value); err != nil || len(rest) != 0 {
+			continue
+		}
+		values[ext.Id.String()] = value
+	}
+	return values
+}
+
+// certificateURIs returns the URIs in the subject alternative names of the
+// certificate
+func certificateURIs(cert *x509.Certificate) []string {
+	var uris []string
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidSubjectAltName) {
+			continue
+		}
+		var seq asn1.RawValue
+		if rest, err := asn1.Unmarshal(ext.Value, &seq); err != nil || len(rest) != 0 || !seq.IsCompound || seq.Tag != asn1.TagSequence {
+			return nil
+		}
+		rest := seq.Bytes
+		for len(rest) > 0 {
+			var name asn1.RawValue
+			var err error
+			if rest, err = asn1.Unmarshal(rest, &name); err != nil {
+				return nil
+			}
+			if name.Class == asn1.ClassContextSpecific && name.Tag == sanURITag {
+				uris = append(uris, string(name.Bytes))
+			}
+		}
+	}
+	return uris
+}
+
+// parseOID parses an OID in dotted notation
+func parseOID(s string) (asn1.ObjectIdentifier, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", s)
+	}
+	oid := make(asn1.ObjectIdentifier, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid OID %q", s)
+		}
+		oid[i] = n
+	}
+	return oid, nil
+}
+
+// checkOCSP returns whether the client certificate passes the OCSP check of
+// the entry. The issuer of the certificate must be in the trusted chain.
+func (b *backend) checkOCSP(clientCert *x509.Certificate, trustedChain []*x509.Certificate, entry *CertEntry) bool {
+	if !entry.OCSPEnabled {
+		return true
+	}
+
+	var issuer *x509.Certificate
+	for _, cert := range trustedChain {
+		if cert != clientCert && clientCert.CheckSignatureFrom(cert) == nil {
+			issuer = cert
+			break
+		}
+	}
+
+	servers := entry.OCSPServersOverride
+	if len(servers) == 0 {
+		servers = clientCert.OCSPServer
+	}
+
+	var resp *ocspResponse
+	var err error
+	switch {
+	case issuer == nil:
+		err = fmt.Errorf("issuer of the certificate not found in the trusted chain")
+	case len(servers) == 0:
+		err = fmt.Errorf("no OCSP server for the certificate")
+	default:
+		resp, err = b.ocspStatus(servers, clientCert, issuer)
+	}
+	if err != nil {
+		b.Logger().Warn("cert: OCSP status of the certificate unavailable", "name", entry.Name,
+			"serial", certutil.GetHexFormatted(clientCert.SerialNumber.Bytes(), ":"), "error", err, "fail_open", entry.OCSPFailOpen)
+		return entry.OCSPFailOpen
+	}
+
+	switch resp.Status {
+	case ocspStatusGood:
+		return true
+	case ocspStatusRevoked:
+		b.Logger().Debug("cert: certificate revoked according to OCSP", "name", entry.Name,
+			"serial", certutil.GetHexFormatted(clientCert.SerialNumber.Bytes(), ":"), "revoked_at", resp.RevokedAt)
+		return false
+	default:
+		return entry.OCSPFailOpen
+	}
+}
+
+// ocspStatus returns the status of the certificate from the cache, or from
+// the first responder giving it
+func (b *backend) ocspStatus(servers []string, cert, issuer *x509.Certificate) (*ocspResponse, error) {
+	key := fmt.Sprintf("%x/%s", sha256.Sum256(issuer.Raw), cert.SerialNumber)
+	now := time.Now()
+
+	b.ocspLock.Lock()
+	cached := b.ocspCache[key]
+	b.ocspLock.Unlock()
+	if cached != nil && now.Before(cached.NextUpdate) {
+		return cached, nil
+	}
+
+	var errs []string
+	for _, server := range servers {
+		resp, err := queryOCSP(b.ocspClient, server, cert, issuer)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", server, err))
+			continue
+		}
+		if resp.Status == ocspStatusUnknown {
+			errs = append(errs, fmt.Sprintf("%s: unknown certificate", server))
+			continue
+		}
+
+		// Responses without a next update time have no validity period and
+		// are not cached
+		if !resp.NextUpdate.IsZero() {
+			b.ocspLock.Lock()
+			if b.ocspCache == nil {
+				b.ocspCache = make(map[string]*ocspResponse)
+			}
+			for k, v := range b.ocspCache {
+				if !now.Before(v.NextUpdate) {
+					delete(b.ocspCache, k)
+				}
+			}
+			b.ocspCache[key] = resp
+			b.ocspLock.Unlock()
+		}
+		return resp, nil
+	}
+
+	return nil, fmt.Errorf("no OCSP server gave the status of the certificate: %s", strings.Join(errs, "; "))
 }
 
 // loadTrustedCerts is used to load all the trusted certificates from the backend
@@ -0,0 +1,49 @@
+package cfauth
+
+import (
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	b := &backend{}
+	b.Backend = &framework.Backend{
+		Help: backendHelp,
+
+		PathsSpecial: &logical.Paths{
+			Unauthenticated: []string{
+				"login",
+			},
+		},
+
+		Paths: []*framework.Path{
+			pathConfig(b),
+			pathListRoles(b),
+			pathRoles(b),
+			pathLogin(b),
+		},
+
+		AuthRenew: b.pathLoginRenew,
+	}
+
+	return b
+}
+
+type backend struct {
+	*framework.Backend
+}
+
+const backendHelp = `
+The CF credential provider allows authentication of Cloud Foundry application
+instances with their instance identity certificates.
+
+The certificates are issued by the CA of the platform and name the
+organization, space and application of the instance. At login, the instance
+signs the request with the key of its certificate. Roles bind the
+organizations, spaces, applications and instances allowed to log in to
+policies.
+`
@@ -0,0 +1,243 @@
+package cfauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func createBackendWithStorage(t *testing.T) (*backend, logical.Storage) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView
+}
+
+func testRequest(t *testing.T, b *backend, s logical.Storage, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       path,
+		Storage:    s,
+		Data:       data,
+		Connection: &logical.Connection{RemoteAddr: "10.255.0.2"},
+	})
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return resp
+}
+
+// testCA is a CA issuing certificates in tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+	pem  string
+}
+
+func newTestCA(t *testing.T, parent *testCA, name string) *testCA {
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	return issue(t, parent, template)
+}
+
+func issue(t *testing.T, parent *testCA, template *x509.Certificate) *testCA {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+	}
+}
+
+// instanceCert returns an instance identity certificate and its chain
+func instanceCert(t *testing.T, intermediate *testCA, org, space, app string) *testCA {
+	leaf := issue(t, intermediate, &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject: pkix.Name{
+			CommonName:         "instance-1",
+			OrganizationalUnit: []string{"organization:" + org, "space:" + space, "app:" + app},
+		},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(time.Hour),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IPAddresses: []net.IP{net.ParseIP("10.255.0.2")},
+	})
+	leaf.pem += intermediate.pem
+	return leaf
+}
+
+func testLogin(t *testing.T, b *backend, s logical.Storage, role string, cert *testCA, signingTime time.Time) *logical.Response {
+	signingTimeStr := signingTime.UTC().Format(signingTimeFormat)
+	sig, err := sign(cert.key, signingTimeStr, cert.pem, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testRequest(t, b, s, "login", map[string]interface{}{
+		"role":             role,
+		"cf_instance_cert": cert.pem,
+		"signing_time":     signingTimeStr,
+		"signature":        base64.StdEncoding.EncodeToString(sig),
+	})
+}
+
+func TestBackend_Login(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	root := newTestCA(t, nil, "root")
+	intermediate := newTestCA(t, root, "intermediate")
+
+	resp := testRequest(t, b, storage, "config", map[string]interface{}{
+		"identity_ca_certificates": root.pem,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = testRequest(t, b, storage, "role/web", map[string]interface{}{
+		"bound_organization_ids": "org-1",
+		"bound_application_ids":  "app-1,app-2",
+		"policies":               "web",
+		"ttl":                    "1h",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	cert := instanceCert(t, intermediate, "org-1", "space-1", "app-1")
+	resp = testLogin(t, b, storage, "web", cert, time.Now())
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if !reflect.DeepEqual(resp.Auth.Policies, []string{"default", "web"}) {
+		t.Fatalf("bad: %#v", resp.Auth.Policies)
+	}
+	expectedMetadata := map[string]string{
+		"role":            "web",
+		"organization_id": "org-1",
+		"space_id":        "space-1",
+		"app_id":          "app-1",
+		"instance_id":     "instance-1",
+	}
+	if !reflect.DeepEqual(resp.Auth.Metadata, expectedMetadata) {
+		t.Fatalf("bad: %#v", resp.Auth.Metadata)
+	}
+	if resp.Auth.DisplayName != "app-1" || resp.Auth.TTL != time.Hour {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+
+	// Logins are bound to the role
+	resp = testLogin(t, b, storage, "web", instanceCert(t, intermediate, "org-2", "space-1", "app-1"), time.Now())
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for the wrong organization: %#v", resp)
+	}
+	resp = testLogin(t, b, storage, "web", instanceCert(t, intermediate, "org-1", "space-1", "app-3"), time.Now())
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for the wrong application: %#v", resp)
+	}
+
+	// The signing time must be recent
+	resp = testLogin(t, b, storage, "web", cert, time.Now().Add(-10*time.Minute))
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for the old signing time: %#v", resp)
+	}
+	resp = testLogin(t, b, storage, "web", cert, time.Now().Add(10*time.Minute))
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for the future signing time: %#v", resp)
+	}
+
+	// The signature must be made with the key of the certificate
+	other := instanceCert(t, intermediate, "org-1", "space-1", "app-1")
+	forged := &testCA{cert: cert.cert, key: other.key, pem: cert.pem}
+	resp = testLogin(t, b, storage, "web", forged, time.Now())
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for the forged signature: %#v", resp)
+	}
+
+	// The certificate must be issued by the configured CA
+	otherRoot := newTestCA(t, nil, "other")
+	resp = testLogin(t, b, storage, "web", instanceCert(t, newTestCA(t, otherRoot, "intermediate"), "org-1", "space-1", "app-1"), time.Now())
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for the untrusted certificate: %#v", resp)
+	}
+}
+
+func TestBackend_LoginIPMatching(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	root := newTestCA(t, nil, "root")
+
+	testRequest(t, b, storage, "config", map[string]interface{}{
+		"identity_ca_certificates": root.pem,
+	})
+	testRequest(t, b, storage, "role/web", map[string]interface{}{
+		"bound_space_ids": "space-1",
+	})
+
+	// Logins must come from the address of the certificate
+	leaf := issue(t, root, &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject: pkix.Name{
+			CommonName:         "instance-2",
+			OrganizationalUnit: []string{"organization:org-1", "space:space-1", "app:app-1"},
+		},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(time.Hour),
+		IPAddresses: []net.IP{net.ParseIP("10.255.0.3")},
+	})
+	resp := testLogin(t, b, storage, "web", leaf, time.Now())
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for the wrong address: %#v", resp)
+	}
+
+	testRequest(t, b, storage, "role/web", map[string]interface{}{
+		"disable_ip_matching": true,
+	})
+	resp = testLogin(t, b, storage, "web", leaf, time.Now())
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestBackend_RoleRequiresConstraint(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	resp := testRequest(t, b, storage, "role/web", map[string]interface{}{
+		"policies": "web",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for the unbound role: %#v", resp)
+	}
+}
@@ -0,0 +1,131 @@
+package cfauth
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/mapstructure"
+)
+
+// CLIHandler logs in with the instance identity certificate of the
+// application instance the command runs in, read from the files named by
+// CF_INSTANCE_CERT and CF_INSTANCE_KEY
+type CLIHandler struct{}
+
+func (h *CLIHandler) Auth(c *api.Client, m map[string]string) (string, error) {
+	var data struct {
+		Mount    string `mapstructure:"mount"`
+		Role     string `mapstructure:"role"`
+		CertPath string `mapstructure:"cf_instance_cert"`
+		KeyPath  string `mapstructure:"cf_instance_key"`
+	}
+	if err := mapstructure.WeakDecode(m, &data); err != nil {
+		return "", err
+	}
+	if data.Mount == "" {
+		data.Mount = "cf"
+	}
+	if data.Role == "" {
+		return "", fmt.Errorf("role must be specified")
+	}
+	if data.CertPath == "" {
+		data.CertPath = os.Getenv("CF_INSTANCE_CERT")
+	}
+	if data.KeyPath == "" {
+		data.KeyPath = os.Getenv("CF_INSTANCE_KEY")
+	}
+	if data.CertPath == "" || data.KeyPath == "" {
+		return "", fmt.Errorf("CF_INSTANCE_CERT and CF_INSTANCE_KEY must be set")
+	}
+
+	certPEM, err := ioutil.ReadFile(data.CertPath)
+	if err != nil {
+		return "", fmt.Errorf("error reading the instance identity certificate: %s", err)
+	}
+	keyPEM, err := ioutil.ReadFile(data.KeyPath)
+	if err != nil {
+		return "", fmt.Errorf("error reading the instance identity key: %s", err)
+	}
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return "", fmt.Errorf("error parsing the instance identity key: %s", err)
+	}
+
+	signingTime := time.Now().UTC().Format(signingTimeFormat)
+	sig, err := sign(key, signingTime, string(certPEM), data.Role)
+	if err != nil {
+		return "", err
+	}
+
+	path := fmt.Sprintf("auth/%s/login", data.Mount)
+	secret, err := c.Logical().Write(path, map[string]interface{}{
+		"role":             data.Role,
+		"cf_instance_cert": string(certPEM),
+		"signing_time":     signingTime,
+		"signature":        base64.StdEncoding.EncodeToString(sig),
+	})
+	if err != nil {
+		return "", err
+	}
+	if secret == nil {
+		return "", fmt.Errorf("empty response from credential provider")
+	}
+
+	return secret.Auth.ClientToken, nil
+}
+
+// parsePrivateKey parses the PEM encoded RSA key of the instance identity
+// certificate
+func parsePrivateKey(keyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM encoded key found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+func (h *CLIHandler) Help() string {
+	help := `
+The CF credential provider allows you to log in with the instance identity
+certificate of the Cloud Foundry application instance the command runs in.
+The certificate and its key are read from the files named by the
+CF_INSTANCE_CERT and CF_INSTANCE_KEY environment variables.
+
+    Example: vault auth -method=cf role=web
+
+Key/Value Pairs:
+
+    mount=cf                  The mountpoint for the CF credential provider.
+                              Defaults to "cf"
+
+    role=<name>               The role to log in with.
+
+    cf_instance_cert=<path>   The path of the instance identity certificate.
+                              Defaults to $CF_INSTANCE_CERT
+
+    cf_instance_key=<path>    The path of the key of the certificate.
+                              Defaults to $CF_INSTANCE_KEY
+	`
+
+	return strings.TrimSpace(help)
+}
@@ -0,0 +1,174 @@
+package cfauth
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	defaultLoginMaxSecondsNotBefore = 300
+	defaultLoginMaxSecondsNotAfter  = 60
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `config`,
+		Fields: map[string]*framework.FieldSchema{
+			"identity_ca_certificates": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "PEM encoded certificates of the CAs issuing the instance identity certificates.",
+			},
+			"login_max_seconds_not_before": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Default:     defaultLoginMaxSecondsNotBefore,
+				Description: "Maximum age of the signing time of logins. Defaults to 300 seconds.",
+			},
+			"login_max_seconds_not_after": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Default:     defaultLoginMaxSecondsNotAfter,
+				Description: "Maximum time the signing time of logins can be in the future, for clock skew. Defaults to 60 seconds.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+// Config returns the configuration of the backend
+func (b *backend) Config(s logical.Storage) (*cfConfig, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result cfConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"identity_ca_certificates":     config.IdentityCACertificates,
+			"login_max_seconds_not_before": int64(config.LoginMaxNotBefore / time.Second),
+			"login_max_seconds_not_after":  int64(config.LoginMaxNotAfter / time.Second),
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &cfConfig{
+			LoginMaxNotBefore: defaultLoginMaxSecondsNotBefore * time.Second,
+			LoginMaxNotAfter:  defaultLoginMaxSecondsNotAfter * time.Second,
+		}
+	}
+
+	if v, ok := d.GetOk("identity_ca_certificates"); ok {
+		config.IdentityCACertificates = v.(string)
+	}
+	if v, ok := d.GetOk("login_max_seconds_not_before"); ok {
+		config.LoginMaxNotBefore = time.Duration(v.(int)) * time.Second
+	}
+	if v, ok := d.GetOk("login_max_seconds_not_after"); ok {
+		config.LoginMaxNotAfter = time.Duration(v.(int)) * time.Second
+	}
+
+	if config.IdentityCACertificates == "" {
+		return logical.ErrorResponse("identity_ca_certificates is required"), nil
+	}
+	if _, err := config.caPool(); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid identity_ca_certificates: %s", err)), nil
+	}
+	if config.LoginMaxNotBefore <= 0 || config.LoginMaxNotAfter < 0 {
+		return logical.ErrorResponse("login_max_seconds_not_before must be positive, and login_max_seconds_not_after cannot be negative"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// cfConfig is the configuration of the backend
+type cfConfig struct {
+	IdentityCACertificates string        `json:"identity_ca_certificates"`
+	LoginMaxNotBefore      time.Duration `json:"login_max_not_before"`
+	LoginMaxNotAfter       time.Duration `json:"login_max_not_after"`
+}
+
+// caPool returns the pool of the CAs issuing the instance identity
+// certificates
+func (c *cfConfig) caPool() (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	found := false
+	rest := []byte(c.IdentityCACertificates)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pool.AddCert(cert)
+		found = true
+	}
+	if !found {
+		return nil, errors.New("no PEM encoded certificates found")
+	}
+	return pool, nil
+}
+
+const pathConfigHelpSyn = `
+Configures the CAs issuing the instance identity certificates.
+`
+
+const pathConfigHelpDesc = `
+The CF backend accepts the instance identity certificates issued by the
+"identity_ca_certificates", which are the instance identity CA of the
+platform and, if any, its intermediate CAs.
+
+Logins are signed with the key of the certificate and their signing time,
+which must be no older than "login_max_seconds_not_before" and no further in
+the future than "login_max_seconds_not_after", to allow for clock skew.
+`
@@ -0,0 +1,295 @@
+package cfauth
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathLogin(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "login$",
+		Fields: map[string]*framework.FieldSchema{
+			"role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role to log in with.",
+			},
+			"cf_instance_cert": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "PEM encoded instance identity certificate, followed by its intermediate CAs, as found in CF_INSTANCE_CERT.",
+			},
+			"signing_time": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Time the login was signed at, in RFC3339 format.",
+			},
+			"signature": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Base64 encoded RSA-PSS signature with SHA-256, made with the key of the
+certificate, of the signing time, the certificate and the role name.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLogin,
+		},
+
+		HelpSynopsis:    pathLoginHelpSyn,
+		HelpDescription: pathLoginHelpDesc,
+	}
+}
+
+func (b *backend) pathLogin(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleName := strings.ToLower(d.Get("role").(string))
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+	certPEM := d.Get("cf_instance_cert").(string)
+	if certPEM == "" {
+		return logical.ErrorResponse("missing cf_instance_cert"), nil
+	}
+	signingTimeRaw := d.Get("signing_time").(string)
+	signingTime, err := time.Parse(signingTimeFormat, signingTimeRaw)
+	if err != nil {
+		return logical.ErrorResponse("missing or invalid signing_time"), nil
+	}
+	sig, err := base64.StdEncoding.DecodeString(d.Get("signature").(string))
+	if err != nil || len(sig) == 0 {
+		return logical.ErrorResponse("missing or invalid signature"), nil
+	}
+
+	role, err := b.role(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid role name %q", roleName)), nil
+	}
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return logical.ErrorResponse("cf backend is not configured"), nil
+	}
+
+	now := time.Now()
+	if signingTime.Before(now.Add(-config.LoginMaxNotBefore)) {
+		return logical.ErrorResponse("signing_time is too old"), nil
+	}
+	if signingTime.After(now.Add(config.LoginMaxNotAfter)) {
+		return logical.ErrorResponse("signing_time is in the future"), nil
+	}
+
+	cert, err := verifyCertificate(config, certPEM, now)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := verifySignature(cert.PublicKey, signingTimeRaw, certPEM, roleName, sig); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	id, err := parseIdentity(cert)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := validateIdentity(role, id); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if !role.DisableIPMatching {
+		if err := validateIP(cert, req.Connection); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	auth := &logical.Auth{
+		Policies: role.Policies,
+		Period:   role.Period,
+		InternalData: map[string]interface{}{
+			"role": roleName,
+		},
+		Metadata: map[string]string{
+			"role":            roleName,
+			"organization_id": id.OrganizationID,
+			"space_id":        id.SpaceID,
+			"app_id":          id.ApplicationID,
+			"instance_id":     id.InstanceID,
+		},
+		DisplayName: id.ApplicationID,
+		LeaseOptions: logical.LeaseOptions{
+			TTL:       role.TTL,
+			Renewable: true,
+		},
+	}
+
+	// If 'Period' is set, use the value of 'Period' as the TTL
+	if role.Period > time.Duration(0) {
+		auth.TTL = role.Period
+	}
+
+	return &logical.Response{
+		Auth: auth,
+	}, nil
+}
+
+func (b *backend) pathLoginRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if req.Auth == nil {
+		return nil, fmt.Errorf("request auth was nil")
+	}
+
+	roleName, _ := req.Auth.InternalData["role"].(string)
+	if roleName == "" {
+		return nil, fmt.Errorf("failed to fetch role during renewal")
+	}
+
+	// The role must still exist and grant the same policies
+	role, err := b.role(req.Storage, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate role %s during renewal: %s", roleName, err)
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role %s does not exist during renewal", roleName)
+	}
+	if !policyutil.EquivalentPolicies(role.Policies, req.Auth.Policies) {
+		return nil, fmt.Errorf("policies have changed, not renewing")
+	}
+
+	if role.Period > time.Duration(0) {
+		req.Auth.TTL = role.Period
+		return &logical.Response{Auth: req.Auth}, nil
+	}
+	return framework.LeaseExtend(role.TTL, role.MaxTTL, b.System())(req, d)
+}
+
+// verifyCertificate parses the instance identity certificate and its
+// intermediate CAs, and verifies it against the configured CAs
+func verifyCertificate(config *cfConfig, certPEM string, now time.Time) (*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(certPEM)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cf_instance_cert: %s", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("cf_instance_cert has no PEM encoded certificate")
+	}
+
+	roots, err := config.caPool()
+	if err != nil {
+		return nil, err
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to verify cf_instance_cert: %s", err)
+	}
+	return certs[0], nil
+}
+
+// cfIdentity is the identity of an application instance, as named by its
+// instance identity certificate
+type cfIdentity struct {
+	OrganizationID string
+	SpaceID        string
+	ApplicationID  string
+	InstanceID     string
+}
+
+// parseIdentity returns the identity of the instance identity certificate,
+// whose common name is the instance GUID and whose organizational units are
+// the "organization:", "space:" and "app:" GUIDs
+func parseIdentity(cert *x509.Certificate) (*cfIdentity, error) {
+	id := &cfIdentity{
+		InstanceID: cert.Subject.CommonName,
+	}
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		switch {
+		case strings.HasPrefix(ou, "organization:"):
+			id.OrganizationID = strings.TrimPrefix(ou, "organization:")
+		case strings.HasPrefix(ou, "space:"):
+			id.SpaceID = strings.TrimPrefix(ou, "space:")
+		case strings.HasPrefix(ou, "app:"):
+			id.ApplicationID = strings.TrimPrefix(ou, "app:")
+		}
+	}
+	if id.InstanceID == "" || id.OrganizationID == "" || id.SpaceID == "" || id.ApplicationID == "" {
+		return nil, errors.New("cf_instance_cert is not an instance identity certificate")
+	}
+	return id, nil
+}
+
+// validateIdentity checks the identity of the instance against the role
+func validateIdentity(role *cfRole, id *cfIdentity) error {
+	if len(role.BoundOrganizationIDs) != 0 && !strutil.StrListContains(role.BoundOrganizationIDs, id.OrganizationID) {
+		return fmt.Errorf("organization %q not authorized", id.OrganizationID)
+	}
+	if len(role.BoundSpaceIDs) != 0 && !strutil.StrListContains(role.BoundSpaceIDs, id.SpaceID) {
+		return fmt.Errorf("space %q not authorized", id.SpaceID)
+	}
+	if len(role.BoundApplicationIDs) != 0 && !strutil.StrListContains(role.BoundApplicationIDs, id.ApplicationID) {
+		return fmt.Errorf("application %q not authorized", id.ApplicationID)
+	}
+	if len(role.BoundInstanceIDs) != 0 && !strutil.StrListContains(role.BoundInstanceIDs, id.InstanceID) {
+		return fmt.Errorf("instance %q not authorized", id.InstanceID)
+	}
+	return nil
+}
+
+// validateIP checks that the login comes from one of the IP addresses of the
+// instance identity certificate
+func validateIP(cert *x509.Certificate, conn *logical.Connection) error {
+	if conn == nil {
+		return errors.New("unable to determine the address of the login")
+	}
+	remote := net.ParseIP(conn.RemoteAddr)
+	if remote == nil {
+		return errors.New("unable to determine the address of the login")
+	}
+	for _, ip := range cert.IPAddresses {
+		if ip.Equal(remote) {
+			return nil
+		}
+	}
+	return fmt.Errorf("address %s does not match cf_instance_cert", conn.RemoteAddr)
+}
+
+const pathLoginHelpSyn = `
+Authenticates an application instance with its instance identity certificate.
+`
+
+const pathLoginHelpDesc = `
+The instance sends its instance identity certificate, found in the file named
+by CF_INSTANCE_CERT, and signs the login with the key of the certificate,
+found in the file named by CF_INSTANCE_KEY. The signature is made with
+RSA-PSS and SHA-256 over the concatenation of the "signing_time", in RFC3339
+format, the "cf_instance_cert" and the role name.
+
+The certificate must be issued by the configured CAs, and its organization,
+space, application and instance must match the role.
+`
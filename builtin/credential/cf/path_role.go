@@ -0,0 +1,245 @@
+package cfauth
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    pathRoleHelpSyn,
+		HelpDescription: pathRoleHelpDesc,
+	}
+}
+
+func pathRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+			"bound_organization_ids": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of the GUIDs of the organizations able to log in.",
+			},
+			"bound_space_ids": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of the GUIDs of the spaces able to log in.",
+			},
+			"bound_application_ids": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of the GUIDs of the applications able to log in.",
+			},
+			"bound_instance_ids": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of the GUIDs of the application instances able to log in.",
+			},
+			"disable_ip_matching": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If set, logins are not required to come from the IP address of the
+instance identity certificate.`,
+			},
+			"policies": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of policies on the role.",
+			},
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Duration after which the issued tokens expire. Defaults to the mount's default TTL.",
+			},
+			"max_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Duration after which the issued tokens cannot be renewed. Defaults to the mount's maximum TTL.",
+			},
+			"period": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `If set, the issued tokens are periodic: they never expire as long as they
+are renewed within this duration.`,
+			},
+		},
+
+		ExistenceCheck: b.pathRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathRoleCreateUpdate,
+			logical.UpdateOperation: b.pathRoleCreateUpdate,
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    pathRoleHelpSyn,
+		HelpDescription: pathRoleHelpDesc,
+	}
+}
+
+// role returns the named role, or nil if it does not exist
+func (b *backend) role(s logical.Storage, name string) (*cfRole, error) {
+	entry, err := s.Get("role/" + strings.ToLower(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result cfRole
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathRoleExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	role, err := b.role(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return role != nil, nil
+}
+
+func (b *backend) pathRoleList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roles, err := req.Storage.List("role/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathRoleRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := b.role(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"bound_organization_ids": role.BoundOrganizationIDs,
+			"bound_space_ids":        role.BoundSpaceIDs,
+			"bound_application_ids":  role.BoundApplicationIDs,
+			"bound_instance_ids":     role.BoundInstanceIDs,
+			"disable_ip_matching":    role.DisableIPMatching,
+			"policies":               role.Policies,
+			"ttl":                    int64(role.TTL / time.Second),
+			"max_ttl":                int64(role.MaxTTL / time.Second),
+			"period":                 int64(role.Period / time.Second),
+		},
+	}, nil
+}
+
+func (b *backend) pathRoleDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete("role/" + strings.ToLower(d.Get("name").(string))); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathRoleCreateUpdate(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := strings.ToLower(d.Get("name").(string))
+	role, err := b.role(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role = &cfRole{}
+	}
+
+	if raw, ok := d.GetOk("bound_organization_ids"); ok {
+		role.BoundOrganizationIDs = raw.([]string)
+	}
+	if raw, ok := d.GetOk("bound_space_ids"); ok {
+		role.BoundSpaceIDs = raw.([]string)
+	}
+	if raw, ok := d.GetOk("bound_application_ids"); ok {
+		role.BoundApplicationIDs = raw.([]string)
+	}
+	if raw, ok := d.GetOk("bound_instance_ids"); ok {
+		role.BoundInstanceIDs = raw.([]string)
+	}
+	if raw, ok := d.GetOk("disable_ip_matching"); ok {
+		role.DisableIPMatching = raw.(bool)
+	}
+	if raw, ok := d.GetOk("policies"); ok {
+		role.Policies = policyutil.SanitizePolicies(raw.([]string), true)
+	} else if req.Operation == logical.CreateOperation {
+		role.Policies = policyutil.SanitizePolicies(nil, true)
+	}
+	if raw, ok := d.GetOk("ttl"); ok {
+		role.TTL = time.Duration(raw.(int)) * time.Second
+	}
+	if raw, ok := d.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(raw.(int)) * time.Second
+	}
+	if raw, ok := d.GetOk("period"); ok {
+		role.Period = time.Duration(raw.(int)) * time.Second
+	}
+
+	if len(role.BoundOrganizationIDs) == 0 && len(role.BoundSpaceIDs) == 0 &&
+		len(role.BoundApplicationIDs) == 0 && len(role.BoundInstanceIDs) == 0 {
+		return logical.ErrorResponse("at least one bound constraint must be set"), nil
+	}
+	if role.MaxTTL > 0 && role.TTL > role.MaxTTL {
+		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	}
+	if role.Period > b.System().MaxLeaseTTL() {
+		return logical.ErrorResponse("period cannot be greater than the mount's maximum TTL"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("role/"+name, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// cfRole binds organizations, spaces, applications and instances to
+// policies
+type cfRole struct {
+	BoundOrganizationIDs []string      `json:"bound_organization_ids"`
+	BoundSpaceIDs        []string      `json:"bound_space_ids"`
+	BoundApplicationIDs  []string      `json:"bound_application_ids"`
+	BoundInstanceIDs     []string      `json:"bound_instance_ids"`
+	DisableIPMatching    bool          `json:"disable_ip_matching"`
+	Policies             []string      `json:"policies"`
+	TTL                  time.Duration `json:"ttl"`
+	MaxTTL               time.Duration `json:"max_ttl"`
+	Period               time.Duration `json:"period"`
+}
+
+const pathRoleHelpSyn = `
+Manage the roles binding application instances to policies.
+`
+
+const pathRoleHelpDesc = `
+A role allows the application instances matching all of its bound constraints
+to log in and obtain tokens with its policies. At least one constraint must
+be set. The constraints are checked against the organization, space,
+application and instance GUIDs of the instance identity certificate.
+
+Unless "disable_ip_matching" is set, logins must come from the IP address of
+the certificate, which is the address of the container of the instance.
+`
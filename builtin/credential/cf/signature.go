@@ -0,0 +1,39 @@
+package cfauth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"time"
+)
+
+// signingTimeFormat is the format of the signing time of logins
+const signingTimeFormat = time.RFC3339
+
+// signatureData returns the hash signed at login with the key of the
+// instance identity certificate, which binds the signature to the signing
+// time as sent, the certificate and the role
+func signatureData(signingTime, certPEM, roleName string) []byte {
+	hashed := sha256.Sum256([]byte(signingTime + certPEM + roleName))
+	return hashed[:]
+}
+
+// sign signs a login with the key of the instance identity certificate
+func sign(key *rsa.PrivateKey, signingTime string, certPEM, roleName string) ([]byte, error) {
+	return rsa.SignPSS(rand.Reader, key, crypto.SHA256, signatureData(signingTime, certPEM, roleName), nil)
+}
+
+// verifySignature verifies the signature of a login with the public key of
+// the instance identity certificate
+func verifySignature(key crypto.PublicKey, signingTime string, certPEM, roleName string, sig []byte) error {
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("instance identity certificate does not have an RSA key")
+	}
+	if err := rsa.VerifyPSS(rsaKey, crypto.SHA256, signatureData(signingTime, certPEM, roleName), sig, nil); err != nil {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
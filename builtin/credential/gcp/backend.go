@@ -0,0 +1,68 @@
+package gcpauth
+
+import (
+	"net/http"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	b := &backend{
+		googleCertsURL:         "https://www.googleapis.com/oauth2/v1/certs",
+		serviceAccountCertsURL: "https://www.googleapis.com/service_accounts/v1/metadata/x509/",
+		iamEndpoint:            "https://iam.googleapis.com/",
+		computeEndpoint:        "https://compute.googleapis.com/",
+		apiClient:              apiClient,
+	}
+	b.Backend = &framework.Backend{
+		Help: backendHelp,
+
+		PathsSpecial: &logical.Paths{
+			Unauthenticated: []string{
+				"login",
+			},
+		},
+
+		Paths: []*framework.Path{
+			pathConfig(b),
+			pathListRoles(b),
+			pathRoles(b),
+			pathLogin(b),
+		},
+
+		AuthRenew: b.pathLoginRenew,
+	}
+
+	return b
+}
+
+type backend struct {
+	*framework.Backend
+
+	// The Google endpoints used by the backend, which tests replace. The
+	// URLs of the certificates return a map of key IDs to PEM encoded
+	// certificates, and the API endpoints end with a slash.
+	googleCertsURL         string
+	serviceAccountCertsURL string
+	iamEndpoint            string
+	computeEndpoint        string
+
+	// apiClient returns the HTTP client authenticating the requests to the
+	// IAM and Compute APIs
+	apiClient func(*gcpConfig) (*http.Client, error)
+}
+
+const backendHelp = `
+The GCP credential provider allows authentication of Google Cloud service
+accounts and Compute Engine instances.
+
+Service accounts log in with a JWT signed by Google for the account, and
+instances with the identity token from their metadata server. Roles bind
+the projects, service accounts, zones and labels allowed to log in to
+policies.
+`
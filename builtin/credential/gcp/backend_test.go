@@ -0,0 +1,355 @@
+package gcpauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/hashicorp/vault/logical"
+)
+
+func createBackendWithStorage(t *testing.T) (*backend, logical.Storage) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView
+}
+
+func testRequest(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatalf("%s %s: %v", op, path, err)
+	}
+	return resp
+}
+
+// testGoogle fakes the Google endpoints used by the backend. The service
+// account and Google certificates have a key each, which sign the JWTs of
+// the tests.
+type testGoogle struct {
+	server *httptest.Server
+
+	saKey     *rsa.PrivateKey
+	googleKey *rsa.PrivateKey
+
+	serviceAccount *serviceAccount
+	instance       *computeInstance
+}
+
+func newTestGoogle(t *testing.T) *testGoogle {
+	g := &testGoogle{
+		saKey:     testKey(t),
+		googleKey: testKey(t),
+		serviceAccount: &serviceAccount{
+			Email:     "app@my-project.iam.gserviceaccount.com",
+			UniqueID:  "1234567890",
+			ProjectID: "my-project",
+		},
+		instance: &computeInstance{
+			ID:     "42",
+			Name:   "web-1",
+			Labels: map[string]string{"env": "prod"},
+		},
+	}
+	saCerts := map[string]string{"sa-key": testCert(t, g.saKey)}
+	googleCerts := map[string]string{"google-key": testCert(t, g.googleKey)}
+
+	g.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sa := g.serviceAccount
+		var out interface{}
+		switch r.URL.Path {
+		case "/certs":
+			out = googleCerts
+		case "/sa-certs/" + sa.Email:
+			out = saCerts
+		case "/iam/v1/projects/-/serviceAccounts/" + sa.Email, "/iam/v1/projects/-/serviceAccounts/" + sa.UniqueID:
+			out = sa
+		case "/compute/compute/v1/projects/my-project/zones/us-central1-a/instances/" + g.instance.Name:
+			out = g.instance
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(out)
+	}))
+	return g
+}
+
+func (g *testGoogle) backend(t *testing.T) (*backend, logical.Storage) {
+	b, storage := createBackendWithStorage(t)
+	b.googleCertsURL = g.server.URL + "/certs"
+	b.serviceAccountCertsURL = g.server.URL + "/sa-certs/"
+	b.iamEndpoint = g.server.URL + "/iam/"
+	b.computeEndpoint = g.server.URL + "/compute/"
+	b.apiClient = func(*gcpConfig) (*http.Client, error) {
+		return http.DefaultClient, nil
+	}
+	return b, storage
+}
+
+func (g *testGoogle) serviceAccountJWT(t *testing.T, aud string, exp time.Duration) string {
+	return testSign(t, g.saKey, "sa-key", jwt.MapClaims{
+		"sub": g.serviceAccount.Email,
+		"aud": aud,
+		"exp": time.Now().Add(exp).Unix(),
+	})
+}
+
+func (g *testGoogle) identityToken(t *testing.T, aud, zone string) string {
+	return testSign(t, g.googleKey, "google-key", jwt.MapClaims{
+		"iss":   "https://accounts.google.com",
+		"sub":   "1234567890",
+		"email": "app@my-project.iam.gserviceaccount.com",
+		"aud":   aud,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"google": map[string]interface{}{
+			"compute_engine": map[string]interface{}{
+				"project_id":    "my-project",
+				"zone":          zone,
+				"instance_id":   "42",
+				"instance_name": "web-1",
+			},
+		},
+	})
+}
+
+func testKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func testCert(t *testing.T, key *rsa.PrivateKey) string {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func testSign(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestBackend_pathRole(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	for _, tc := range []struct {
+		data map[string]interface{}
+		err  string
+	}{
+		{map[string]interface{}{"type": "aws", "bound_projects": "p"}, `type must be "iam" or "gce"`},
+		{map[string]interface{}{"type": "iam", "bound_projects": "p"}, "bound_service_accounts must be set"},
+		{map[string]interface{}{"type": "gce"}, "bound_projects must be set"},
+		{map[string]interface{}{"type": "iam", "bound_projects": "p", "bound_service_accounts": "*", "bound_zones": "z"}, "bound_zones cannot be set on iam roles"},
+		{map[string]interface{}{"type": "gce", "bound_projects": "p", "max_jwt_exp": 60}, "max_jwt_exp cannot be set on gce roles"},
+		{map[string]interface{}{"type": "gce", "bound_projects": "p", "bound_labels": "env"}, "invalid label"},
+	} {
+		resp := testRequest(t, b, storage, logical.UpdateOperation, "role/bad", tc.data)
+		if resp == nil || !resp.IsError() || !strings.Contains(resp.Data["error"].(string), tc.err) {
+			t.Fatalf("%v: expected error %q, got %#v", tc.data, tc.err, resp)
+		}
+	}
+
+	resp := testRequest(t, b, storage, logical.UpdateOperation, "role/web", map[string]interface{}{
+		"type":           "gce",
+		"bound_projects": "my-project",
+		"bound_zones":    "us-central1-a,us-central1-b",
+		"bound_labels":   "env:prod,team:web",
+		"policies":       "web",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatal(resp.Data["error"])
+	}
+
+	resp = testRequest(t, b, storage, logical.ReadOperation, "role/web", nil)
+	if resp.Data["type"] != "gce" || len(resp.Data["bound_labels"].([]string)) != 2 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["max_jwt_exp"]; ok {
+		t.Fatalf("max_jwt_exp returned on a gce role: %#v", resp.Data)
+	}
+
+	resp = testRequest(t, b, storage, logical.UpdateOperation, "role/web", map[string]interface{}{
+		"type": "iam",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected the type change to fail, got %#v", resp)
+	}
+
+	resp = testRequest(t, b, storage, logical.UpdateOperation, "role/app", map[string]interface{}{
+		"type":                   "iam",
+		"bound_projects":         "my-project",
+		"bound_service_accounts": "app@my-project.iam.gserviceaccount.com",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatal(resp.Data["error"])
+	}
+	resp = testRequest(t, b, storage, logical.ReadOperation, "role/app", nil)
+	if resp.Data["max_jwt_exp"] != int64(900) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp = testRequest(t, b, storage, logical.ListOperation, "role/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 2 {
+		t.Fatalf("bad: %#v", keys)
+	}
+}
+
+func TestBackend_pathConfig(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	resp := testRequest(t, b, storage, logical.UpdateOperation, "config", map[string]interface{}{
+		"credentials": `{"type": "authorized_user"}`,
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected user credentials to be rejected, got %#v", resp)
+	}
+
+	resp = testRequest(t, b, storage, logical.ReadOperation, "config", nil)
+	if resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestBackend_iamLogin(t *testing.T) {
+	g := newTestGoogle(t)
+	defer g.server.Close()
+	b, storage := g.backend(t)
+
+	testRequest(t, b, storage, logical.UpdateOperation, "role/app", map[string]interface{}{
+		"type":                   "iam",
+		"bound_projects":         "my-project",
+		"bound_service_accounts": "1234567890",
+		"policies":               "app",
+		"ttl":                    300,
+	})
+
+	resp := testRequest(t, b, storage, logical.UpdateOperation, "login", map[string]interface{}{
+		"role": "app",
+		"jwt":  g.serviceAccountJWT(t, "vault/app", 10*time.Minute),
+	})
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp.Auth.Metadata["service_account_email"] != "app@my-project.iam.gserviceaccount.com" ||
+		resp.Auth.Metadata["project_id"] != "my-project" ||
+		resp.Auth.DisplayName != "app@my-project.iam.gserviceaccount.com" {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+	if resp.Auth.TTL != 300*time.Second || !strings.Contains(strings.Join(resp.Auth.Policies, ","), "app") {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+
+	for name, jwtStr := range map[string]string{
+		"audience":   g.serviceAccountJWT(t, "vault/other", 10*time.Minute),
+		"expiration": g.serviceAccountJWT(t, "vault/app", time.Hour),
+		"expired":    g.serviceAccountJWT(t, "vault/app", -time.Minute),
+		"signature":  testSign(t, g.googleKey, "sa-key", jwt.MapClaims{"sub": g.serviceAccount.Email, "aud": "vault/app", "exp": time.Now().Add(time.Minute).Unix()}),
+	} {
+		resp := testRequest(t, b, storage, logical.UpdateOperation, "login", map[string]interface{}{
+			"role": "app",
+			"jwt":  jwtStr,
+		})
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected login to fail, got %#v", name, resp)
+		}
+	}
+
+	// Service accounts of other projects are rejected
+	g.serviceAccount.ProjectID = "other-project"
+	resp = testRequest(t, b, storage, logical.UpdateOperation, "login", map[string]interface{}{
+		"role": "app",
+		"jwt":  g.serviceAccountJWT(t, "vault/app", 10*time.Minute),
+	})
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Data["error"].(string), "project") {
+		t.Fatalf("expected the project to be rejected, got %#v", resp)
+	}
+}
+
+func TestBackend_gceLogin(t *testing.T) {
+	g := newTestGoogle(t)
+	defer g.server.Close()
+	b, storage := g.backend(t)
+
+	testRequest(t, b, storage, logical.UpdateOperation, "role/web", map[string]interface{}{
+		"type":           "gce",
+		"bound_projects": "my-project",
+		"bound_regions":  "us-central1",
+		"bound_labels":   "env:prod",
+		"policies":       "web",
+	})
+
+	login := func(aud, zone string) *logical.Response {
+		return testRequest(t, b, storage, logical.UpdateOperation, "login", map[string]interface{}{
+			"role": "web",
+			"jwt":  g.identityToken(t, aud, zone),
+		})
+	}
+
+	resp := login("vault/web", "us-central1-a")
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp.Auth.Metadata["instance_name"] != "web-1" || resp.Auth.Metadata["zone"] != "us-central1-a" ||
+		resp.Auth.Metadata["service_account_id"] != "1234567890" || resp.Auth.DisplayName != "web-1" {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+
+	if resp := login("vault/other", "us-central1-a"); resp == nil || !resp.IsError() {
+		t.Fatalf("expected the audience to be rejected, got %#v", resp)
+	}
+	if resp := login("vault/web", "europe-west1-b"); resp == nil || !resp.IsError() || !strings.Contains(resp.Data["error"].(string), "region") {
+		t.Fatalf("expected the region to be rejected, got %#v", resp)
+	}
+
+	g.instance.Labels["env"] = "dev"
+	if resp := login("vault/web", "us-central1-a"); resp == nil || !resp.IsError() || !strings.Contains(resp.Data["error"].(string), "label") {
+		t.Fatalf("expected the labels to be rejected, got %#v", resp)
+	}
+	g.instance.Labels["env"] = "prod"
+
+	g.instance.ID = "43"
+	if resp := login("vault/web", "us-central1-a"); resp == nil || !resp.IsError() || !strings.Contains(resp.Data["error"].(string), "recreated") {
+		t.Fatalf("expected the recreated instance to be rejected, got %#v", resp)
+	}
+	g.instance.ID = "42"
+
+	g.instance.Name = "web-2"
+	if resp := login("vault/web", "us-central1-a"); resp == nil || !resp.IsError() {
+		t.Fatalf("expected the deleted instance to be rejected, got %#v", resp)
+	}
+}
@@ -0,0 +1,156 @@
+package gcpauth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/mapstructure"
+)
+
+// CLIHandler logs in with a JWT signed for a service account when one is
+// given, or with the identity token of the instance it runs on
+type CLIHandler struct{}
+
+func (h *CLIHandler) Auth(c *api.Client, m map[string]string) (string, error) {
+	var data struct {
+		Mount          string `mapstructure:"mount"`
+		Role           string `mapstructure:"role"`
+		ServiceAccount string `mapstructure:"service_account"`
+		Credentials    string `mapstructure:"credentials"`
+		JWTExp         int    `mapstructure:"jwt_exp"`
+	}
+	if err := mapstructure.WeakDecode(m, &data); err != nil {
+		return "", err
+	}
+	if data.Mount == "" {
+		data.Mount = "gcp"
+	}
+	if data.Role == "" {
+		return "", fmt.Errorf("role must be specified")
+	}
+	if data.JWTExp == 0 {
+		data.JWTExp = 15
+	}
+
+	audience := "vault/" + data.Role
+	var jwt string
+	var err error
+	if data.ServiceAccount != "" {
+		jwt, err = signServiceAccountJWT(data.Credentials, data.ServiceAccount, audience, time.Duration(data.JWTExp)*time.Minute)
+	} else {
+		jwt, err = metadata.Get(fmt.Sprintf("instance/service-accounts/default/identity?audience=%s&format=full", url.QueryEscape(audience)))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	path := fmt.Sprintf("auth/%s/login", data.Mount)
+	secret, err := c.Logical().Write(path, map[string]interface{}{
+		"role": data.Role,
+		"jwt":  jwt,
+	})
+	if err != nil {
+		return "", err
+	}
+	if secret == nil {
+		return "", fmt.Errorf("empty response from credential provider")
+	}
+
+	return secret.Auth.ClientToken, nil
+}
+
+// signServiceAccountJWT has Google sign a JWT for the service account with
+// the signJwt method of the IAM Credentials API, authenticated with the
+// credentials file or the application default credentials
+func signServiceAccountJWT(credentialsFile, email, audience string, exp time.Duration) (string, error) {
+	config := &gcpConfig{}
+	if credentialsFile != "" {
+		credentials, err := ioutil.ReadFile(credentialsFile)
+		if err != nil {
+			return "", err
+		}
+		config.Credentials = string(credentials)
+	}
+	client, err := apiClient(config)
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"sub": email,
+		"aud": audience,
+		"exp": time.Now().Add(exp).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(map[string]string{
+		"payload": string(payload),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	u := fmt.Sprintf("https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/%s:signJwt", url.PathEscape(email))
+	resp, err := client.Post(u, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to sign JWT for %s: unexpected status %d", email, resp.StatusCode)
+	}
+
+	var result struct {
+		SignedJWT string `json:"signedJwt"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	return result.SignedJWT, nil
+}
+
+func (h *CLIHandler) Help() string {
+	help := `
+The GCP credential provider allows you to log in as a service account, with a
+role of the "iam" type, or as the Compute Engine instance the command runs
+on, with a role of the "gce" type.
+
+Service accounts log in with a JWT signed by the signJwt method of the IAM
+Credentials API. The caller needs the "iam.serviceAccounts.signJwt"
+permission on the service account, for example with the
+"roles/iam.serviceAccountTokenCreator" role.
+
+    Example: vault auth -method=gcp role=dev service_account=dev@my-project.iam.gserviceaccount.com
+
+Instances log in with the identity token of their metadata server.
+
+    Example: vault auth -method=gcp role=web
+
+Key/Value Pairs:
+
+    mount=gcp                   The mountpoint for the GCP credential provider.
+                                Defaults to "gcp"
+
+    role=<name>                 The role to log in with.
+
+    service_account=<email>     The service account to log in as. If not set,
+                                the command logs in as the instance.
+
+    credentials=<path>          Path of the JSON key used to sign the JWT.
+                                Defaults to the application default credentials
+
+    jwt_exp=15                  Minutes until the signed JWT expires.
+                                Defaults to 15
+	`
+
+	return strings.TrimSpace(help)
+}
@@ -0,0 +1,128 @@
+package gcpauth
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+// errNotFound is returned when a service account or instance does not exist
+var errNotFound = errors.New("not found")
+
+// serviceAccount is the subset of the IAM API service account resource used
+// by the backend
+type serviceAccount struct {
+	Email     string `json:"email"`
+	UniqueID  string `json:"uniqueId"`
+	ProjectID string `json:"projectId"`
+}
+
+// computeInstance is the subset of the Compute API instance resource used by
+// the backend
+type computeInstance struct {
+	ID     string            `json:"id"`
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels"`
+}
+
+// serviceAccount looks up a service account by email or unique ID
+func (b *backend) serviceAccount(client *http.Client, id string) (*serviceAccount, error) {
+	u := fmt.Sprintf("%sv1/projects/-/serviceAccounts/%s", b.iamEndpoint, url.PathEscape(id))
+
+	var result serviceAccount
+	if err := getJSON(client, u, &result); err != nil {
+		return nil, fmt.Errorf("failed to look up service account %q: %s", id, err)
+	}
+	return &result, nil
+}
+
+// instance looks up a Compute Engine instance
+func (b *backend) instance(client *http.Client, project, zone, name string) (*computeInstance, error) {
+	u := fmt.Sprintf("%scompute/v1/projects/%s/zones/%s/instances/%s", b.computeEndpoint,
+		url.PathEscape(project), url.PathEscape(zone), url.PathEscape(name))
+
+	var result computeInstance
+	if err := getJSON(client, u, &result); err != nil {
+		return nil, fmt.Errorf("failed to look up instance %q: %s", name, err)
+	}
+	return &result, nil
+}
+
+// fetchCerts returns the public keys of the certificates published at the
+// URL, by key ID
+func fetchCerts(u string) (map[string]*rsa.PublicKey, error) {
+	client := cleanhttp.DefaultClient()
+	client.Timeout = 30 * time.Second
+
+	var certs map[string]string
+	if err := getJSON(client, u, &certs); err != nil {
+		return nil, fmt.Errorf("failed to fetch certificates: %s", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(certs))
+	for kid, certPEM := range certs {
+		block, _ := pem.Decode([]byte(certPEM))
+		if block == nil {
+			return nil, fmt.Errorf("certificate %q is not PEM encoded", kid)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate %q: %s", kid, err)
+		}
+		key, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("certificate %q does not have an RSA key", kid)
+		}
+		keys[kid] = key
+	}
+	return keys, nil
+}
+
+// verifyJWT verifies the RS256 signature and the expiration of the JWT with
+// the key matching its key ID, and returns its claims
+func verifyJWT(jwtStr string, keys map[string]*rsa.PublicKey) (jwt.MapClaims, error) {
+	parser := &jwt.Parser{
+		ValidMethods: []string{"RS256"},
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(jwtStr, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := keys[kid]; ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify JWT: %s", err)
+	}
+	return claims, nil
+}
+
+// getJSON decodes the response of a GET request, mapping 404 responses to
+// errNotFound
+func getJSON(client *http.Client, u string, out interface{}) error {
+	resp, err := client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return errNotFound
+	default:
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,170 @@
+package gcpauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `config`,
+		Fields: map[string]*framework.FieldSchema{
+			"credentials": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `JSON key of the service account used to call the IAM and Compute APIs.
+Defaults to the application default credentials of the Vault server.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+// Config returns the configuration of the backend, which is empty when it
+// was not written
+func (b *backend) Config(s logical.Storage) (*gcpConfig, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return &gcpConfig{}, nil
+	}
+
+	var result gcpConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config.Credentials == "" {
+		return nil, nil
+	}
+
+	// The credentials contain a private key, only the account is returned
+	key, err := config.serviceAccountKey()
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"client_email": key.ClientEmail,
+			"project_id":   key.ProjectID,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config := &gcpConfig{
+		Credentials: d.Get("credentials").(string),
+	}
+
+	if config.Credentials != "" {
+		if _, err := config.serviceAccountKey(); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if _, err := google.JWTConfigFromJSON([]byte(config.Credentials), cloudPlatformScope); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid credentials: %s", err)), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// gcpConfig is the configuration of the backend
+type gcpConfig struct {
+	Credentials string `json:"credentials"`
+}
+
+// serviceAccountKey is the subset of a service account JSON key read by
+// the backend
+type serviceAccountKey struct {
+	Type        string `json:"type"`
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+}
+
+func (c *gcpConfig) serviceAccountKey() (*serviceAccountKey, error) {
+	var key serviceAccountKey
+	if err := json.Unmarshal([]byte(c.Credentials), &key); err != nil {
+		return nil, fmt.Errorf("credentials are not a JSON key: %s", err)
+	}
+	if key.Type != "service_account" {
+		return nil, fmt.Errorf("credentials are not a service account key")
+	}
+	return &key, nil
+}
+
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// apiClient returns an HTTP client authenticated with the credentials of the
+// configuration, or with the application default credentials
+func apiClient(config *gcpConfig) (*http.Client, error) {
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, cleanhttp.DefaultClient())
+
+	var tokenSource oauth2.TokenSource
+	if config.Credentials != "" {
+		jwtConfig, err := google.JWTConfigFromJSON([]byte(config.Credentials), cloudPlatformScope)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing credentials: %s", err)
+		}
+		tokenSource = jwtConfig.TokenSource(ctx)
+	} else {
+		var err error
+		tokenSource, err = google.DefaultTokenSource(ctx, cloudPlatformScope)
+		if err != nil {
+			return nil, fmt.Errorf("error finding the application default credentials: %s", err)
+		}
+	}
+
+	client := oauth2.NewClient(ctx, tokenSource)
+	client.Timeout = 30 * time.Second
+	return client, nil
+}
+
+const pathConfigHelpSyn = `
+Configures the credentials used to call the Google Cloud APIs.
+`
+
+const pathConfigHelpDesc = `
+The GCP backend calls the IAM API to look up the service accounts logging
+in, and the Compute API to look up the instances. The service account of the
+"credentials" needs the "iam.serviceAccounts.get" and "compute.instances.get"
+permissions in the projects of the roles, for example with the
+"roles/iam.serviceAccountViewer" and "roles/compute.viewer" roles.
+
+Without credentials, the application default credentials of the Vault server
+are used, such as those of its own instance on Compute Engine.
+`
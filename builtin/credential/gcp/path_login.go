@@ -0,0 +1,333 @@
+package gcpauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathLogin(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "login$",
+		Fields: map[string]*framework.FieldSchema{
+			"role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role to log in with.",
+			},
+			"jwt": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `JWT signed for the service account on iam roles, or identity token of the
+instance on gce roles. Its audience must be "vault/<role>".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLogin,
+		},
+
+		HelpSynopsis:    pathLoginHelpSyn,
+		HelpDescription: pathLoginHelpDesc,
+	}
+}
+
+func (b *backend) pathLogin(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleName := strings.ToLower(d.Get("role").(string))
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+	jwtStr := d.Get("jwt").(string)
+	if jwtStr == "" {
+		return logical.ErrorResponse("missing jwt"), nil
+	}
+
+	role, err := b.role(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid role name %q", roleName)), nil
+	}
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata map[string]string
+	var displayName string
+	switch role.Type {
+	case iamRoleType:
+		sa, err := b.iamLogin(config, roleName, role, jwtStr)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		metadata = map[string]string{
+			"project_id":            sa.ProjectID,
+			"service_account_email": sa.Email,
+			"service_account_id":    sa.UniqueID,
+		}
+		displayName = sa.Email
+	case gceRoleType:
+		identity, err := b.gceLogin(config, roleName, role, jwtStr)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		metadata = map[string]string{
+			"project_id":            identity.ProjectID,
+			"zone":                  identity.Zone,
+			"instance_id":           identity.InstanceID,
+			"instance_name":         identity.InstanceName,
+			"service_account_email": identity.ServiceAccountEmail,
+			"service_account_id":    identity.ServiceAccountID,
+		}
+		displayName = identity.InstanceName
+	default:
+		return nil, fmt.Errorf("role %q has unknown type %q", roleName, role.Type)
+	}
+	metadata["role"] = roleName
+
+	auth := &logical.Auth{
+		Policies: role.Policies,
+		Period:   role.Period,
+		InternalData: map[string]interface{}{
+			"role": roleName,
+		},
+		Metadata:    metadata,
+		DisplayName: displayName,
+		LeaseOptions: logical.LeaseOptions{
+			TTL:       role.TTL,
+			Renewable: true,
+		},
+	}
+
+	// If 'Period' is set, use the value of 'Period' as the TTL
+	if role.Period > time.Duration(0) {
+		auth.TTL = role.Period
+	}
+
+	return &logical.Response{
+		Auth: auth,
+	}, nil
+}
+
+func (b *backend) pathLoginRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if req.Auth == nil {
+		return nil, fmt.Errorf("request auth was nil")
+	}
+
+	roleName, _ := req.Auth.InternalData["role"].(string)
+	if roleName == "" {
+		return nil, fmt.Errorf("failed to fetch role during renewal")
+	}
+
+	// The role must still exist and grant the same policies
+	role, err := b.role(req.Storage, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate role %s during renewal: %s", roleName, err)
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role %s does not exist during renewal", roleName)
+	}
+	if !policyutil.EquivalentPolicies(role.Policies, req.Auth.Policies) {
+		return nil, fmt.Errorf("policies have changed, not renewing")
+	}
+
+	if role.Period > time.Duration(0) {
+		req.Auth.TTL = role.Period
+		return &logical.Response{Auth: req.Auth}, nil
+	}
+	return framework.LeaseExtend(role.TTL, role.MaxTTL, b.System())(req, d)
+}
+
+// iamLogin validates the JWT signed for a service account against the role,
+// and returns the service account
+func (b *backend) iamLogin(config *gcpConfig, roleName string, role *gcpRole, jwtStr string) (*serviceAccount, error) {
+	// The subject of the JWT selects the keys verifying it
+	unverified, err := unverifiedClaims(jwtStr)
+	if err != nil {
+		return nil, err
+	}
+	sub, _ := unverified["sub"].(string)
+	if sub == "" {
+		return nil, errors.New("JWT has no subject")
+	}
+
+	client, err := b.apiClient(config)
+	if err != nil {
+		return nil, err
+	}
+	sa, err := b.serviceAccount(client, sub)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := fetchCerts(b.serviceAccountCertsURL + url.PathEscape(sa.Email))
+	if err != nil {
+		return nil, err
+	}
+	claims, err := verifyJWT(jwtStr, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.VerifyAudience("vault/"+roleName, true) {
+		return nil, fmt.Errorf("invalid audience, expected %q", "vault/"+roleName)
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("JWT has no expiration")
+	}
+	if time.Unix(int64(exp), 0).Sub(time.Now()) > role.MaxJWTExp {
+		return nil, fmt.Errorf("JWT expires in more than %s", role.MaxJWTExp)
+	}
+
+	if !strutil.StrListContains(role.BoundProjects, sa.ProjectID) {
+		return nil, fmt.Errorf("project %q not authorized", sa.ProjectID)
+	}
+	if !boundServiceAccount(role.BoundServiceAccounts, sa.Email, sa.UniqueID) {
+		return nil, fmt.Errorf("service account %q not authorized", sa.Email)
+	}
+
+	return sa, nil
+}
+
+// gceIdentity is the identity of an instance, from the claims of its
+// identity token
+type gceIdentity struct {
+	ProjectID           string
+	Zone                string
+	InstanceID          string
+	InstanceName        string
+	ServiceAccountEmail string
+	ServiceAccountID    string
+}
+
+// gceLogin validates the identity token of an instance against the role,
+// and returns the identity of the instance
+func (b *backend) gceLogin(config *gcpConfig, roleName string, role *gcpRole, jwtStr string) (*gceIdentity, error) {
+	keys, err := fetchCerts(b.googleCertsURL)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := verifyJWT(jwtStr, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	if iss, _ := claims["iss"].(string); iss != "https://accounts.google.com" && iss != "accounts.google.com" {
+		return nil, fmt.Errorf("invalid issuer %q", iss)
+	}
+	if !claims.VerifyAudience("vault/"+roleName, true) {
+		return nil, fmt.Errorf("invalid audience, expected %q", "vault/"+roleName)
+	}
+
+	// The instance claims are only present in tokens requested with the
+	// "full" format
+	google, _ := claims["google"].(map[string]interface{})
+	gce, _ := google["compute_engine"].(map[string]interface{})
+	if gce == nil {
+		return nil, errors.New(`JWT is not the identity token of an instance, which is requested with format=full`)
+	}
+	identity := &gceIdentity{}
+	identity.ProjectID, _ = gce["project_id"].(string)
+	identity.Zone, _ = gce["zone"].(string)
+	identity.InstanceID, _ = gce["instance_id"].(string)
+	identity.InstanceName, _ = gce["instance_name"].(string)
+	identity.ServiceAccountEmail, _ = claims["email"].(string)
+	identity.ServiceAccountID, _ = claims["sub"].(string)
+
+	if !strutil.StrListContains(role.BoundProjects, identity.ProjectID) {
+		return nil, fmt.Errorf("project %q not authorized", identity.ProjectID)
+	}
+	if len(role.BoundZones) != 0 && !strutil.StrListContains(role.BoundZones, identity.Zone) {
+		return nil, fmt.Errorf("zone %q not authorized", identity.Zone)
+	}
+	if len(role.BoundRegions) != 0 && !strutil.StrListContains(role.BoundRegions, zoneRegion(identity.Zone)) {
+		return nil, fmt.Errorf("region %q not authorized", zoneRegion(identity.Zone))
+	}
+	if len(role.BoundServiceAccounts) != 0 &&
+		!boundServiceAccount(role.BoundServiceAccounts, identity.ServiceAccountEmail, identity.ServiceAccountID) {
+		return nil, fmt.Errorf("service account %q not authorized", identity.ServiceAccountEmail)
+	}
+
+	// The instance must still exist, and be the one the token was issued to
+	// rather than a new instance with the same name
+	client, err := b.apiClient(config)
+	if err != nil {
+		return nil, err
+	}
+	instance, err := b.instance(client, identity.ProjectID, identity.Zone, identity.InstanceName)
+	if err != nil {
+		return nil, err
+	}
+	if instance.ID != identity.InstanceID {
+		return nil, fmt.Errorf("instance %q was recreated", identity.InstanceName)
+	}
+	for k, v := range role.BoundLabels {
+		if instance.Labels[k] != v {
+			return nil, fmt.Errorf("instance does not have label %s:%s", k, v)
+		}
+	}
+
+	return identity, nil
+}
+
+// unverifiedClaims decodes the claims of the JWT, which is verified once its
+// keys are known
+func unverifiedClaims(jwtStr string) (map[string]interface{}, error) {
+	parts := strings.Split(jwtStr, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed JWT")
+	}
+	payload, err := jwt.DecodeSegment(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWT: %s", err)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("malformed JWT: %s", err)
+	}
+	return claims, nil
+}
+
+// boundServiceAccount checks a service account against a list of emails and
+// unique IDs
+func boundServiceAccount(bound []string, email, id string) bool {
+	return strutil.StrListContains(bound, "*") ||
+		strutil.StrListContains(bound, email) ||
+		strutil.StrListContains(bound, id)
+}
+
+// zoneRegion returns the region of a zone, such as us-central1 for
+// us-central1-a
+func zoneRegion(zone string) string {
+	if i := strings.LastIndex(zone, "-"); i != -1 {
+		return zone[:i]
+	}
+	return zone
+}
+
+const pathLoginHelpSyn = `
+Authenticates Google Cloud service accounts and instances with Vault.
+`
+
+const pathLoginHelpDesc = `
+Log in with a JWT and the name of a role. The audience of the JWT must be
+"vault/<role>".
+
+On iam roles, the JWT is signed for the service account by the signJwt method
+of the IAM Credentials API, with the email of the account as its subject. On
+gce roles, the JWT is the identity token of the instance, read from
+instance/service-accounts/default/identity?audience=vault/<role>&format=full
+on its metadata server.
+`
@@ -0,0 +1,337 @@
+package gcpauth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	iamRoleType = "iam"
+	gceRoleType = "gce"
+
+	defaultMaxJWTExp = 15 * time.Minute
+)
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    pathRoleHelpSyn,
+		HelpDescription: pathRoleHelpDesc,
+	}
+}
+
+func pathRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+			"type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Type of the role, "iam" for service accounts or "gce" for Compute Engine instances. Cannot be changed.`,
+			},
+			"bound_projects": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of the projects of the service accounts or instances able to log in.",
+			},
+			"bound_service_accounts": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma separated list of the emails or unique IDs of the service accounts
+able to log in. "*" allows all service accounts of the bound projects.
+Required on iam roles; on gce roles, the service account of the instances.`,
+			},
+			"max_jwt_exp": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum remaining lifetime of the JWTs of iam logins. Defaults to 15 minutes.",
+			},
+			"bound_zones": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of the zones of the instances able to log in. Only on gce roles.",
+			},
+			"bound_regions": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of the regions of the instances able to log in. Only on gce roles.",
+			},
+			"bound_labels": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma separated list of "key:value" labels the instances must all have
+to log in. Only on gce roles.`,
+			},
+			"policies": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of policies on the role.",
+			},
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Duration after which the issued tokens expire. Defaults to the mount's default TTL.",
+			},
+			"max_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Duration after which the issued tokens cannot be renewed. Defaults to the mount's maximum TTL.",
+			},
+			"period": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `If set, the issued tokens are periodic: they never expire as long as they
+are renewed within this duration.`,
+			},
+		},
+
+		ExistenceCheck: b.pathRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathRoleCreateUpdate,
+			logical.UpdateOperation: b.pathRoleCreateUpdate,
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    pathRoleHelpSyn,
+		HelpDescription: pathRoleHelpDesc,
+	}
+}
+
+// role returns the named role, or nil if it does not exist
+func (b *backend) role(s logical.Storage, name string) (*gcpRole, error) {
+	entry, err := s.Get("role/" + strings.ToLower(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result gcpRole
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathRoleExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	role, err := b.role(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return role != nil, nil
+}
+
+func (b *backend) pathRoleList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roles, err := req.Storage.List("role/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathRoleRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := b.role(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	data := map[string]interface{}{
+		"type":                   role.Type,
+		"bound_projects":         role.BoundProjects,
+		"bound_service_accounts": role.BoundServiceAccounts,
+		"policies":               role.Policies,
+		"ttl":                    int64(role.TTL / time.Second),
+		"max_ttl":                int64(role.MaxTTL / time.Second),
+		"period":                 int64(role.Period / time.Second),
+	}
+	switch role.Type {
+	case iamRoleType:
+		data["max_jwt_exp"] = int64(role.MaxJWTExp / time.Second)
+	case gceRoleType:
+		labels := make([]string, 0, len(role.BoundLabels))
+		for k, v := range role.BoundLabels {
+			labels = append(labels, k+":"+v)
+		}
+		data["bound_zones"] = role.BoundZones
+		data["bound_regions"] = role.BoundRegions
+		data["bound_labels"] = labels
+	}
+
+	return &logical.Response{
+		Data: data,
+	}, nil
+}
+
+func (b *backend) pathRoleDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete("role/" + strings.ToLower(d.Get("name").(string))); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathRoleCreateUpdate(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := strings.ToLower(d.Get("name").(string))
+	role, err := b.role(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		roleType := d.Get("type").(string)
+		if roleType != iamRoleType && roleType != gceRoleType {
+			return logical.ErrorResponse(`type must be "iam" or "gce"`), nil
+		}
+		role = &gcpRole{
+			Type: roleType,
+		}
+	} else if raw, ok := d.GetOk("type"); ok && raw.(string) != role.Type {
+		return logical.ErrorResponse("type cannot be changed"), nil
+	}
+
+	if raw, ok := d.GetOk("bound_projects"); ok {
+		role.BoundProjects = raw.([]string)
+	}
+	if raw, ok := d.GetOk("bound_service_accounts"); ok {
+		role.BoundServiceAccounts = raw.([]string)
+	}
+	if raw, ok := d.GetOk("policies"); ok {
+		role.Policies = policyutil.SanitizePolicies(raw.([]string), true)
+	} else if req.Operation == logical.CreateOperation {
+		role.Policies = policyutil.SanitizePolicies(nil, true)
+	}
+	if raw, ok := d.GetOk("ttl"); ok {
+		role.TTL = time.Duration(raw.(int)) * time.Second
+	}
+	if raw, ok := d.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(raw.(int)) * time.Second
+	}
+	if raw, ok := d.GetOk("period"); ok {
+		role.Period = time.Duration(raw.(int)) * time.Second
+	}
+
+	// The bindings of the other type are rejected rather than ignored
+	for _, field := range role.foreignFields() {
+		if _, ok := d.GetOk(field); ok {
+			return logical.ErrorResponse(fmt.Sprintf("%s cannot be set on %s roles", field, role.Type)), nil
+		}
+	}
+	switch role.Type {
+	case iamRoleType:
+		if raw, ok := d.GetOk("max_jwt_exp"); ok {
+			role.MaxJWTExp = time.Duration(raw.(int)) * time.Second
+		} else if role.MaxJWTExp == 0 {
+			role.MaxJWTExp = defaultMaxJWTExp
+		}
+		if len(role.BoundServiceAccounts) == 0 {
+			return logical.ErrorResponse("bound_service_accounts must be set on iam roles"), nil
+		}
+		if role.MaxJWTExp <= 0 {
+			return logical.ErrorResponse("max_jwt_exp must be positive"), nil
+		}
+	case gceRoleType:
+		if raw, ok := d.GetOk("bound_zones"); ok {
+			role.BoundZones = raw.([]string)
+		}
+		if raw, ok := d.GetOk("bound_regions"); ok {
+			role.BoundRegions = raw.([]string)
+		}
+		if raw, ok := d.GetOk("bound_labels"); ok {
+			labels, err := parseLabels(raw.([]string))
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+			role.BoundLabels = labels
+		}
+	}
+
+	if len(role.BoundProjects) == 0 {
+		return logical.ErrorResponse("bound_projects must be set"), nil
+	}
+	if role.MaxTTL > 0 && role.TTL > role.MaxTTL {
+		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	}
+	if role.Period > b.System().MaxLeaseTTL() {
+		return logical.ErrorResponse("period cannot be greater than the mount's maximum TTL"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("role/"+name, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// parseLabels parses a list of "key:value" labels
+func parseLabels(list []string) (map[string]string, error) {
+	labels := make(map[string]string, len(list))
+	for _, label := range list {
+		parts := strings.SplitN(label, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid label %q, expected key:value", label)
+		}
+		labels[parts[0]] = parts[1]
+	}
+	return labels, nil
+}
+
+// gcpRole binds service accounts or instances to policies
+type gcpRole struct {
+	Type                 string        `json:"type"`
+	BoundProjects        []string      `json:"bound_projects"`
+	BoundServiceAccounts []string      `json:"bound_service_accounts"`
+	Policies             []string      `json:"policies"`
+	TTL                  time.Duration `json:"ttl"`
+	MaxTTL               time.Duration `json:"max_ttl"`
+	Period               time.Duration `json:"period"`
+
+	// Bindings of iam roles
+	MaxJWTExp time.Duration `json:"max_jwt_exp"`
+
+	// Bindings of gce roles
+	BoundZones   []string          `json:"bound_zones"`
+	BoundRegions []string          `json:"bound_regions"`
+	BoundLabels  map[string]string `json:"bound_labels"`
+}
+
+// foreignFields returns the fields which only apply to the other type of
+// role
+func (r *gcpRole) foreignFields() []string {
+	if r.Type == iamRoleType {
+		return []string{"bound_zones", "bound_regions", "bound_labels"}
+	}
+	return []string{"max_jwt_exp"}
+}
+
+const pathRoleHelpSyn = `
+Manage the roles binding service accounts and instances to policies.
+`
+
+const pathRoleHelpDesc = `
+A role allows service accounts or Compute Engine instances of its projects to
+log in and obtain tokens with its policies.
+
+Roles of type "iam" bind service accounts, which log in with a JWT signed by
+Google for the account. The JWT may not expire later than "max_jwt_exp".
+
+Roles of type "gce" bind instances, which log in with the identity token of
+their metadata server. They may also be bound to the zones, the regions and
+the labels of the instances, and to the service account they run as.
+`
@@ -2,6 +2,8 @@ package github
 
 import (
 	"context"
+	"fmt"
+	"net/url"
 
 	"github.com/google/go-github/github"
 	"github.com/hashicorp/go-cleanhttp"
@@ -44,6 +46,7 @@ func Backend() *backend {
 		Paths: append([]*framework.Path{
 			pathConfig(&b),
 			pathLogin(&b),
+			pathTeamMappings(&b),
 		}, allPaths...),
 
 		AuthRenew: b.pathLoginRenew,
@@ -61,15 +64,24 @@ type backend struct {
 }
 
 // Client returns the GitHub client to communicate to GitHub via the
-// configured settings.
-func (b *backend) Client(token string) (*github.Client, error) {
+// configured settings. The base URL is the public API if empty.
+func (b *backend) Client(token string, baseURL string) (*github.Client, error) {
 	tc := cleanhttp.DefaultClient()
 	if token != "" {
 		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, tc)
 		tc = oauth2.NewClient(ctx, &tokenSource{Value: token})
 	}
 
-	return github.NewClient(tc), nil
+	client := github.NewClient(tc)
+	if baseURL != "" {
+		parsedURL, err := url.Parse(baseURL)
+		if err != nil {
+			return nil, fmt.Errorf("Successfully parsed base_url when set but failing to parse now: %s", err)
+		}
+		client.BaseURL = parsedURL
+	}
+
+	return client, nil
 }
 
 // tokenSource is an oauth2.TokenSource implementation.
@@ -2,7 +2,10 @@ package github
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -198,3 +201,201 @@ func testAccLogin(t *testing.T, policies []string) logicaltest.TestStep {
 		Check: logicaltest.TestCheckAuth(policies),
 	}
 }
+
+func TestBackend_OrganizationID(t *testing.T) {
+	// A fake GitHub API, where the organization "acme" was renamed "acme-old"
+	// and its name given to another organization
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body string
+		switch r.URL.Path {
+		case "/orgs/acme":
+			body = `{"login": "acme", "id": 2}`
+		case "/user":
+			body = `{"login": "alice"}`
+		case "/user/orgs":
+			body = `[{"login": "acme-old", "id": 1}]`
+		case "/user/teams":
+			body = `[{"name": "Ops", "slug": "ops", "organization": {"login": "acme-old", "id": 1}}]`
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			body = `{"message": "Not Found"}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	b, storage := createBackendWithStorage(t)
+
+	// The ID is looked up from the name
+	resp, err := testRequest(b, storage, logical.UpdateOperation, "config", map[string]interface{}{
+		"organization": "acme",
+		"base_url":     ts.URL + "/",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: %v %#v", err, resp)
+	}
+	resp, err = testRequest(b, storage, logical.ReadOperation, "config", nil)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: %v %#v", err, resp)
+	}
+	if resp.Data["organization_id"] != 2 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The user is not part of the organization with that ID
+	resp, err = testRequest(b, storage, logical.UpdateOperation, "login", map[string]interface{}{
+		"token": "foo",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error, got %#v", resp)
+	}
+
+	// Pinning the renamed organization by ID lets its members log in
+	resp, err = testRequest(b, storage, logical.UpdateOperation, "config", map[string]interface{}{
+		"organization":    "acme",
+		"organization_id": 1,
+		"base_url":        ts.URL + "/",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: %v %#v", err, resp)
+	}
+	resp, err = testRequest(b, storage, logical.UpdateOperation, "map/teams/ops", map[string]interface{}{
+		"value": "ops-policy",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: %v %#v", err, resp)
+	}
+	resp, err = testRequest(b, storage, logical.UpdateOperation, "login", map[string]interface{}{
+		"token": "foo",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: %v %#v", err, resp)
+	}
+	if !reflect.DeepEqual(resp.Auth.Policies, []string{"ops-policy"}) {
+		t.Fatalf("bad: %#v", resp.Auth.Policies)
+	}
+	if resp.Auth.Metadata["org"] != "acme-old" {
+		t.Fatalf("bad: %#v", resp.Auth.Metadata)
+	}
+
+	// Unknown organizations are rejected
+	resp, err = testRequest(b, storage, logical.UpdateOperation, "config", map[string]interface{}{
+		"organization": "missing",
+		"base_url":     ts.URL + "/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error, got %#v", resp)
+	}
+}
+
+func TestBackend_TeamMappings(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	resp, err := testRequest(b, storage, logical.UpdateOperation, "map/teams/legacy", map[string]interface{}{
+		"value": "legacy",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: %v %#v", err, resp)
+	}
+
+	// Invalid mappings fail the whole import
+	resp, err = testRequest(b, storage, logical.UpdateOperation, "team-mappings", map[string]interface{}{
+		"mappings": map[string]interface{}{
+			"ops":     "ops",
+			"bad/one": "bad",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error, got %#v", resp)
+	}
+	if v, err := b.TeamMap.Get(storage, "ops"); err != nil || v != nil {
+		t.Fatalf("bad: %v %#v", err, v)
+	}
+
+	resp, err = testRequest(b, storage, logical.UpdateOperation, "team-mappings", map[string]interface{}{
+		"mappings": map[string]interface{}{
+			"ops":              "ops, oncall",
+			"Site-Reliability": []interface{}{"sre", "oncall"},
+		},
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: %v %#v", err, resp)
+	}
+	if !reflect.DeepEqual(resp.Data["imported"], []string{"ops", "site-reliability"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp, err = testRequest(b, storage, logical.ReadOperation, "team-mappings", nil)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: %v %#v", err, resp)
+	}
+	expected := map[string]interface{}{
+		"legacy":           "legacy",
+		"ops":              "ops,oncall",
+		"site-reliability": "sre,oncall",
+	}
+	if !reflect.DeepEqual(resp.Data["mappings"], expected) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	policies, err := b.TeamMap.Policies(storage, "Site-Reliability")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(policies, []string{"oncall", "sre"}) {
+		t.Fatalf("bad: %#v", policies)
+	}
+
+	// Replacing the mappings deletes those which are not imported
+	resp, err = testRequest(b, storage, logical.UpdateOperation, "team-mappings", map[string]interface{}{
+		"mappings": map[string]interface{}{
+			"ops": "ops",
+		},
+		"replace": true,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: %v %#v", err, resp)
+	}
+	if !reflect.DeepEqual(resp.Data["deleted"], []string{"legacy", "site-reliability"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	keys, err := b.TeamMap.List(storage, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"ops"}) {
+		t.Fatalf("bad: %#v", keys)
+	}
+}
+
+func createBackendWithStorage(t *testing.T) (*backend, logical.Storage) {
+	b := Backend()
+	if _, err := b.Setup(&logical.BackendConfig{
+		System: &logical.StaticSystemView{
+			DefaultLeaseTTLVal: time.Hour * 24,
+			MaxLeaseTTLVal:     time.Hour * 24 * 32,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return b, &logical.InmemStorage{}
+}
+
+func testRequest(b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+	return b.HandleRequest(&logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+}
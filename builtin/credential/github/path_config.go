@@ -1,6 +1,7 @@
 package github
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"time"
@@ -19,6 +20,14 @@ func pathConfig(b *backend) *framework.Path {
 				Description: "The organization users must be part of",
 			},
 
+			"organization_id": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `The ID of the organization users must be part of.
+Looked up from the organization name if not given.
+Unlike the name, the ID cannot be reused by another
+organization.`,
+			},
+
 			"base_url": &framework.FieldSchema{
 				Type: framework.TypeString,
 				Description: `The API endpoint to use. Useful if you
@@ -53,6 +62,24 @@ func (b *backend) pathConfigWrite(
 		}
 	}
 
+	// Pin the organization by ID, so that users of another organization
+	// later given the same name cannot log in
+	organizationID := data.Get("organization_id").(int)
+	if organizationID < 0 {
+		return logical.ErrorResponse("organization_id must be positive"), nil
+	}
+	if organizationID == 0 && organization != "" {
+		client, err := b.Client("", baseURL)
+		if err != nil {
+			return nil, err
+		}
+		org, _, err := client.Organizations.Get(context.Background(), organization)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("Error looking up the ID of organization %q: %s", organization, err)), nil
+		}
+		organizationID = org.GetID()
+	}
+
 	var ttl time.Duration
 	var err error
 	ttlRaw, ok := data.GetOk("ttl")
@@ -77,7 +104,8 @@ func (b *backend) pathConfigWrite(
 	}
 
 	entry, err := logical.StorageEntryJSON("config", config{
-		Organization: organization,
+		Organization:   organization,
+		OrganizationID: organizationID,
 		BaseURL:      baseURL,
 		TTL:          ttl,
 		MaxTTL:       maxTTL,
@@ -131,7 +159,8 @@ func (b *backend) Config(s logical.Storage) (*config, error) {
 }
 
 type config struct {
-	Organization string        `json:"organization" structs:"organization" mapstructure:"organization"`
+	Organization   string        `json:"organization" structs:"organization" mapstructure:"organization"`
+	OrganizationID int           `json:"organization_id" structs:"organization_id" mapstructure:"organization_id"`
 	BaseURL      string        `json:"base_url" structs:"base_url" mapstructure:"base_url"`
 	TTL          time.Duration `json:"ttl" structs:"ttl" mapstructure:"ttl"`
 	MaxTTL       time.Duration `json:"max_ttl" structs:"max_ttl" mapstructure:"max_ttl"`
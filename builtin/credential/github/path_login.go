@@ -3,7 +3,6 @@ package github
 import (
 	"context"
 	"fmt"
-	"net/url"
 	"strings"
 
 	"github.com/google/go-github/github"
@@ -113,19 +112,11 @@ func (b *backend) verifyCredentials(req *logical.Request, token string) (*verify
 			"configure the github credential backend first"), nil
 	}
 
-	client, err := b.Client(token)
+	client, err := b.Client(token, config.BaseURL)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	if config.BaseURL != "" {
-		parsedURL, err := url.Parse(config.BaseURL)
-		if err != nil {
-			return nil, nil, fmt.Errorf("Successfully parsed base_url when set but failing to parse now: %s", err)
-		}
-		client.BaseURL = parsedURL
-	}
-
 	// Get the user
 	user, _, err := client.Users.Get(context.Background(), "")
 	if err != nil {
@@ -153,6 +144,15 @@ func (b *backend) verifyCredentials(req *logical.Request, token string) (*verify
 	}
 
 	for _, o := range allOrgs {
+		// Configurations written before the organization was pinned by ID
+		// only have its name
+		if config.OrganizationID != 0 {
+			if o.GetID() == config.OrganizationID {
+				org = o
+				break
+			}
+			continue
+		}
 		if strings.ToLower(*o.Login) == strings.ToLower(config.Organization) {
 			org = o
 			break
@@ -0,0 +1,177 @@
+package github
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// teamSlugRegex matches the keys accepted by the map/teams paths
+var teamSlugRegex = regexp.MustCompile(`^[-\w]+$`)
+
+func pathTeamMappings(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "team-mappings/?$",
+		Fields: map[string]*framework.FieldSchema{
+			"mappings": &framework.FieldSchema{
+				Type: framework.TypeMap,
+				Description: `Map of team slugs to the policies of the team,
+as a comma-separated string or a list of strings.`,
+			},
+
+			"replace": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If true, the mappings of the teams which are not
+imported are deleted, except for the default mapping.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathTeamMappingsRead,
+			logical.UpdateOperation: b.pathTeamMappingsWrite,
+		},
+
+		HelpSynopsis:    pathTeamMappingsHelpSyn,
+		HelpDescription: pathTeamMappingsHelpDesc,
+	}
+}
+
+func (b *backend) pathTeamMappingsRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	keys, err := b.TeamMap.List(req.Storage, "")
+	if err != nil {
+		return nil, err
+	}
+
+	mappings := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		v, err := b.TeamMap.Get(req.Storage, key)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			continue
+		}
+		mappings[key] = v["value"]
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"mappings": mappings,
+		},
+	}, nil
+}
+
+func (b *backend) pathTeamMappingsWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	mappings := data.Get("mappings").(map[string]interface{})
+	if len(mappings) == 0 {
+		return logical.ErrorResponse("no mappings to import"), nil
+	}
+
+	// Every mapping is checked before any is stored, so that a failed import
+	// does not store some of the mappings
+	values := make(map[string]string, len(mappings))
+	var errs []string
+	for slug, raw := range mappings {
+		slug = strings.ToLower(slug)
+		if !teamSlugRegex.MatchString(slug) {
+			errs = append(errs, fmt.Sprintf("%s: invalid team slug", slug))
+			continue
+		}
+
+		policies, err := parsePolicies(raw)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", slug, err))
+			continue
+		}
+		values[slug] = strings.Join(policies, ",")
+	}
+	if len(errs) != 0 {
+		sort.Strings(errs)
+		return logical.ErrorResponse(fmt.Sprintf(
+			"no mappings were imported: %s", strings.Join(errs, "; "))), nil
+	}
+
+	var deleted []string
+	if data.Get("replace").(bool) {
+		keys, err := b.TeamMap.List(req.Storage, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if _, ok := values[key]; ok || key == b.TeamMap.DefaultKey {
+				continue
+			}
+			if err := b.TeamMap.Delete(req.Storage, key); err != nil {
+				return nil, err
+			}
+			deleted = append(deleted, key)
+		}
+	}
+
+	imported := make([]string, 0, len(values))
+	for slug, value := range values {
+		if err := b.TeamMap.Put(req.Storage, slug, map[string]interface{}{
+			"value": value,
+		}); err != nil {
+			return nil, err
+		}
+		imported = append(imported, slug)
+	}
+	sort.Strings(imported)
+	sort.Strings(deleted)
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"imported": imported,
+			"deleted":  deleted,
+		},
+	}, nil
+}
+
+// parsePolicies returns the policies of a mapping given either as a
+// comma-separated string or a list of strings
+func parsePolicies(raw interface{}) ([]string, error) {
+	var policies []string
+	switch v := raw.(type) {
+	case string:
+		policies = strings.Split(v, ",")
+	case []interface{}:
+		for _, p := range v {
+			s, ok := p.(string)
+			if !ok {
+				return nil, fmt.Errorf("the policies must be strings")
+			}
+			policies = append(policies, s)
+		}
+	default:
+		return nil, fmt.Errorf("the policies must be a string or a list of strings")
+	}
+
+	result := make([]string, 0, len(policies))
+	for _, p := range policies {
+		if p = strings.TrimSpace(p); p != "" {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+const pathTeamMappingsHelpSyn = `
+Read or import the policies of GitHub teams in bulk.
+`
+
+const pathTeamMappingsHelpDesc = `
+Reading this path returns the policies of every team mapped with the
+"map/teams" paths, keyed by team slug.
+
+Writing to this path imports a map of team slugs to policies. Existing
+mappings of the same teams are replaced. If "replace" is true, the mappings
+of the teams which are not imported are deleted. If any mapping is invalid,
+nothing is imported and the errors of all the invalid mappings are returned.
+`
@@ -0,0 +1,82 @@
+package jwtauth
+
+import (
+	"sync"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	b := &backend{
+		oidcStates: make(map[string]*oidcState),
+	}
+	b.Backend = &framework.Backend{
+		Help: backendHelp,
+
+		PathsSpecial: &logical.Paths{
+			Unauthenticated: []string{
+				"login",
+				"oidc/auth_url",
+				"oidc/callback",
+			},
+		},
+
+		Paths: []*framework.Path{
+			pathConfig(b),
+			pathListRoles(b),
+			pathRoles(b),
+			pathLogin(b),
+			pathOIDCAuthURL(b),
+			pathOIDCCallback(b),
+		},
+
+		AuthRenew:  b.pathLoginRenew,
+		Invalidate: b.invalidate,
+	}
+
+	return b
+}
+
+type backend struct {
+	*framework.Backend
+
+	// keySet caches the keys fetched from the JWKS URL or discovered with
+	// OIDC discovery
+	keySetLock sync.Mutex
+	keySet     *remoteKeySet
+
+	// oidcStates are the pending OIDC logins, by state
+	oidcStatesLock sync.Mutex
+	oidcStates     map[string]*oidcState
+}
+
+func (b *backend) invalidate(key string) {
+	if key == "config" {
+		b.reset()
+	}
+}
+
+// reset drops the cached keys, which are fetched again on the next login
+func (b *backend) reset() {
+	b.keySetLock.Lock()
+	b.keySet = nil
+	b.keySetLock.Unlock()
+}
+
+const backendHelp = `
+The JWT credential provider allows authentication with JSON Web Tokens, such
+as the ID tokens of an OpenID Connect provider or the tokens of a CI system.
+
+The signatures of the tokens are verified with keys found with OIDC
+discovery, fetched from a JWKS URL, or configured statically. Roles bind the
+audiences, subjects and claims of the tokens to policies, and map claims
+into the token metadata.
+
+Roles of the "oidc" type log users in with the authorization code flow of an
+OpenID Connect provider instead, through a browser.
+`
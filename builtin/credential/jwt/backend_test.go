@@ -0,0 +1,613 @@
+package jwtauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/hashicorp/vault/logical"
+)
+
+func createBackendWithStorage(t *testing.T) (*backend, logical.Storage) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView
+}
+
+func testRequest(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatalf("%s %s: %v", op, path, err)
+	}
+	return resp
+}
+
+func testLogin(t *testing.T, b *backend, s logical.Storage, role, jwtStr string) *logical.Response {
+	data := map[string]interface{}{
+		"jwt": jwtStr,
+	}
+	if role != "" {
+		data["role"] = role
+	}
+	return testRequest(t, b, s, logical.UpdateOperation, "login", data)
+}
+
+func testSign(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func testClaims(claims jwt.MapClaims) jwt.MapClaims {
+	result := jwt.MapClaims{
+		"iss": "https://issuer.example.com",
+		"sub": "user-1",
+		"aud": "vault",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	}
+	for k, v := range claims {
+		if v == nil {
+			delete(result, k)
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// testProvider serves an OIDC discovery document and a JWK set, whose keys
+// can be replaced. Its token endpoint exchanges the code "code" for the ID
+// token, if the code verifier matches the challenge.
+type testProvider struct {
+	server *httptest.Server
+
+	l         sync.Mutex
+	keys      []map[string]string
+	challenge string
+	idToken   string
+}
+
+func newTestProvider() *testProvider {
+	p := &testProvider{}
+	p.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 p.server.URL,
+				"jwks_uri":               p.server.URL + "/keys",
+				"authorization_endpoint": p.server.URL + "/authorize",
+				"token_endpoint":         p.server.URL + "/token",
+			})
+		case "/token":
+			p.l.Lock()
+			defer p.l.Unlock()
+			verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+			if r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("code") != "code" ||
+				r.PostFormValue("client_id") != "vault" || r.PostFormValue("client_secret") != "secret" ||
+				base64.RawURLEncoding.EncodeToString(verifier[:]) != p.challenge {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{
+				"access_token": "access",
+				"id_token":     p.idToken,
+			})
+		case "/keys":
+			p.l.Lock()
+			defer p.l.Unlock()
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"keys": p.keys,
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return p
+}
+
+func (p *testProvider) setKeys(keys ...map[string]string) {
+	p.l.Lock()
+	p.keys = keys
+	p.l.Unlock()
+}
+
+func encodeInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   encodeInt(key.N),
+		"e":   encodeInt(big.NewInt(int64(key.E))),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"crv": "P-256",
+		"x":   encodeInt(key.X),
+		"y":   encodeInt(key.Y),
+	}
+}
+
+func mustGenerateKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestJWT_Config(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	for _, data := range []map[string]interface{}{
+		{},
+		{"jwks_url": "https://example.com/keys", "jwt_validation_pubkeys": "x"},
+		{"jwt_validation_pubkeys": "not a key"},
+		{"jwks_url": "https://example.com/keys", "jwt_supported_algs": "HS256"},
+		{"jwks_url": "https://example.com/keys", "jwks_ca_pem": "not a cert"},
+		{"oidc_discovery_url": "http://127.0.0.1:0"},
+	} {
+		resp := testRequest(t, b, s, logical.UpdateOperation, "config", data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("expected error for %v, got %#v", data, resp)
+		}
+	}
+
+	provider := newTestProvider()
+	defer provider.server.Close()
+
+	resp := testRequest(t, b, s, logical.UpdateOperation, "config", map[string]interface{}{
+		"oidc_discovery_url": provider.server.URL,
+		"default_role":       "dev",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = testRequest(t, b, s, logical.ReadOperation, "config", nil)
+	if resp.Data["oidc_discovery_url"] != provider.server.URL || resp.Data["default_role"] != "dev" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestJWT_RoleCRUD(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	for _, data := range []map[string]interface{}{
+		{"bound_audiences": "vault"},
+		{"user_claim": "sub"},
+		{"user_claim": "sub", "bound_subject": "a", "bound_claims_type": "regex"},
+		{"user_claim": "sub", "bound_claims": map[string]interface{}{"n": 1}},
+		{"user_claim": "sub", "bound_subject": "a", "claim_mappings": map[string]interface{}{"email": "role"}},
+	} {
+		resp := testRequest(t, b, s, logical.CreateOperation, "role/dev", data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("expected error for %v, got %#v", data, resp)
+		}
+	}
+
+	resp := testRequest(t, b, s, logical.CreateOperation, "role/dev", map[string]interface{}{
+		"user_claim":      "email",
+		"bound_audiences": "vault,other",
+		"bound_claims": map[string]interface{}{
+			"groups": []interface{}{"dev", "ops"},
+		},
+		"claim_mappings": map[string]interface{}{
+			"email": "email",
+		},
+		"policies": "dev",
+		"ttl":      "1h",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	resp = testRequest(t, b, s, logical.ReadOperation, "role/dev", nil)
+	if resp == nil {
+		t.Fatal("expected role")
+	}
+	if resp.Data["user_claim"] != "email" || resp.Data["bound_claims_type"] != claimTypeString || resp.Data["ttl"].(int64) != 3600 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if auds := resp.Data["bound_audiences"].([]string); len(auds) != 2 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if resp.Data["claim_mappings"].(map[string]string)["email"] != "email" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp = testRequest(t, b, s, logical.ListOperation, "role/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != "dev" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	testRequest(t, b, s, logical.DeleteOperation, "role/dev", nil)
+	if resp = testRequest(t, b, s, logical.ReadOperation, "role/dev", nil); resp != nil {
+		t.Fatalf("expected deleted role, got %#v", resp)
+	}
+}
+
+func TestJWT_LoginOIDCDiscovery(t *testing.T) {
+	rsaKey := mustGenerateKey(t)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := newTestProvider()
+	defer provider.server.Close()
+	provider.setKeys(rsaJWK("rsa-1", &rsaKey.PublicKey))
+
+	b, s := createBackendWithStorage(t)
+	testRequest(t, b, s, logical.UpdateOperation, "config", map[string]interface{}{
+		"oidc_discovery_url": provider.server.URL,
+		"jwt_supported_algs": "RS256,ES256",
+		"default_role":       "dev",
+	})
+	testRequest(t, b, s, logical.CreateOperation, "role/dev", map[string]interface{}{
+		"user_claim":      "email",
+		"groups_claim":    "/org/teams",
+		"bound_audiences": "vault",
+		"bound_claims": map[string]interface{}{
+			"/org/name": "acme",
+			"env":       []interface{}{"prod", "staging"},
+		},
+		"claim_mappings": map[string]interface{}{
+			"email":      "email",
+			"/org/admin": "admin",
+		},
+		"policies": "dev",
+	})
+
+	claims := func(overrides jwt.MapClaims) jwt.MapClaims {
+		c := testClaims(jwt.MapClaims{
+			"iss":   provider.server.URL,
+			"email": "user@example.com",
+			"env":   "prod",
+			"org": map[string]interface{}{
+				"name":  "acme",
+				"admin": true,
+				"teams": []interface{}{"red", "blue"},
+			},
+		})
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+
+	resp := testLogin(t, b, s, "", testSign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", claims(nil)))
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp.Auth.DisplayName != "user@example.com" || resp.Auth.Metadata["role"] != "dev" ||
+		resp.Auth.Metadata["email"] != "user@example.com" || resp.Auth.Metadata["admin"] != "true" {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+	if len(resp.Auth.GroupAliases) != 2 || resp.Auth.GroupAliases[1] != "blue" {
+		t.Fatalf("bad: %#v", resp.Auth.GroupAliases)
+	}
+
+	// A rotated key is fetched on first use
+	provider.setKeys(rsaJWK("rsa-1", &rsaKey.PublicKey), ecJWK("ec-1", &ecKey.PublicKey))
+	resp = testLogin(t, b, s, "dev", testSign(t, jwt.SigningMethodES256, ecKey, "ec-1", claims(jwt.MapClaims{
+		"aud": []interface{}{"other", "vault"},
+	})))
+	if resp == nil || resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	for name, jwtStr := range map[string]string{
+		"wrong issuer":      testSign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", claims(jwt.MapClaims{"iss": "https://evil.example.com"})),
+		"wrong audience":    testSign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", claims(jwt.MapClaims{"aud": "other"})),
+		"expired":           testSign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", claims(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()})),
+		"unbound claim":     testSign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", claims(jwt.MapClaims{"env": "dev"})),
+		"missing claim":     testSign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", claims(jwt.MapClaims{"org": nil})),
+		"missing user":      testSign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", claims(jwt.MapClaims{"email": nil})),
+		"unknown key ID":    testSign(t, jwt.SigningMethodRS256, rsaKey, "rsa-2", claims(nil)),
+		"wrong key":         testSign(t, jwt.SigningMethodRS256, mustGenerateKey(t), "rsa-1", claims(nil)),
+		"unsupported alg":   testSign(t, jwt.SigningMethodRS512, rsaKey, "rsa-1", claims(nil)),
+		"mismatched method": testSign(t, jwt.SigningMethodRS256, rsaKey, "ec-1", claims(nil)),
+	} {
+		resp := testLogin(t, b, s, "dev", jwtStr)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected error, got %#v", name, resp)
+		}
+	}
+
+	// Renewing checks the role
+	resp = testLogin(t, b, s, "dev", testSign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", claims(nil)))
+	auth := resp.Auth
+	auth.IssueTime = time.Now()
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.RenewOperation,
+		Path:      "login",
+		Storage:   s,
+		Auth:      auth,
+	})
+	if err != nil || resp == nil || resp.Auth == nil {
+		t.Fatalf("bad: %#v, %v", resp, err)
+	}
+	testRequest(t, b, s, logical.DeleteOperation, "role/dev", nil)
+	if _, err := b.HandleRequest(&logical.Request{
+		Operation: logical.RenewOperation,
+		Path:      "login",
+		Storage:   s,
+		Auth:      auth,
+	}); err == nil {
+		t.Fatal("expected renewal to fail after the role was deleted")
+	}
+}
+
+func TestJWT_LoginStaticKeys(t *testing.T) {
+	key := mustGenerateKey(t)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	b, s := createBackendWithStorage(t)
+	resp := testRequest(t, b, s, logical.UpdateOperation, "config", map[string]interface{}{
+		"jwt_validation_pubkeys": []string{pemKey},
+		"bound_issuer":           "https://issuer.example.com",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	testRequest(t, b, s, logical.CreateOperation, "role/ci", map[string]interface{}{
+		"user_claim":        "sub",
+		"bound_subject":     "repo:acme/app",
+		"bound_claims_type": "glob",
+		"bound_claims": map[string]interface{}{
+			"ref": "refs/heads/release-*",
+		},
+		"period": "30m",
+	})
+
+	claims := testClaims(jwt.MapClaims{
+		"sub": "repo:acme/app",
+		"aud": nil,
+		"ref": "refs/heads/release-1.2",
+	})
+	resp = testLogin(t, b, s, "ci", testSign(t, jwt.SigningMethodRS256, key, "", claims))
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp.Auth.Period != 30*time.Minute || resp.Auth.TTL != 30*time.Minute || resp.Auth.DisplayName != "repo:acme/app" {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+
+	for name, c := range map[string]jwt.MapClaims{
+		"unbound audience": {"aud": "vault"},
+		"wrong subject":    {"sub": "repo:acme/other"},
+		"unmatched glob":   {"ref": "refs/heads/main"},
+		"wrong issuer":     {"iss": "https://other.example.com"},
+	} {
+		overridden := jwt.MapClaims{}
+		for k, v := range claims {
+			overridden[k] = v
+		}
+		for k, v := range c {
+			overridden[k] = v
+		}
+		resp := testLogin(t, b, s, "ci", testSign(t, jwt.SigningMethodRS256, key, "", overridden))
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected error, got %#v", name, resp)
+		}
+	}
+
+	// Without a default role, the role is required
+	resp = testLogin(t, b, s, "", testSign(t, jwt.SigningMethodRS256, key, "", claims))
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Data["error"].(string), "missing role") {
+		t.Fatalf("expected missing role error, got %#v", resp)
+	}
+}
+
+func TestJWT_OIDCLogin(t *testing.T) {
+	key := mustGenerateKey(t)
+	provider := newTestProvider()
+	defer provider.server.Close()
+	provider.setKeys(rsaJWK("1", &key.PublicKey))
+
+	b, s := createBackendWithStorage(t)
+	resp := testRequest(t, b, s, logical.UpdateOperation, "config", map[string]interface{}{
+		"oidc_discovery_url": provider.server.URL,
+		"oidc_client_id":     "vault",
+		"oidc_client_secret": "secret",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = testRequest(t, b, s, logical.ReadOperation, "config", nil)
+	if _, ok := resp.Data["oidc_client_secret"]; ok {
+		t.Fatal("oidc_client_secret should not be returned")
+	}
+
+	resp = testRequest(t, b, s, logical.CreateOperation, "role/dev", map[string]interface{}{
+		"role_type":  "oidc",
+		"user_claim": "email",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for missing allowed_redirect_uris, got %#v", resp)
+	}
+	testRequest(t, b, s, logical.CreateOperation, "role/dev", map[string]interface{}{
+		"role_type":             "oidc",
+		"user_claim":            "email",
+		"allowed_redirect_uris": "http://localhost:8250/oidc/callback",
+		"oidc_scopes":           "email,groups",
+		"policies":              "dev",
+	})
+	resp = testRequest(t, b, s, logical.UpdateOperation, "role/dev", map[string]interface{}{
+		"role_type": "jwt",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error changing role_type, got %#v", resp)
+	}
+
+	authURL := func(redirectURI, clientNonce string) url.Values {
+		resp := testRequest(t, b, s, logical.UpdateOperation, "oidc/auth_url", map[string]interface{}{
+			"role":         "dev",
+			"redirect_uri": redirectURI,
+			"client_nonce": clientNonce,
+		})
+		if resp == nil || resp.IsError() {
+			t.Fatalf("bad: %#v", resp)
+		}
+		u, err := url.Parse(resp.Data["auth_url"].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Path != "/authorize" {
+			t.Fatalf("bad auth URL: %s", u)
+		}
+		return u.Query()
+	}
+	issue := func(params url.Values, claims jwt.MapClaims) {
+		provider.l.Lock()
+		defer provider.l.Unlock()
+		provider.challenge = params.Get("code_challenge")
+		provider.idToken = testSign(t, jwt.SigningMethodRS256, key, "1", testClaims(jwt.MapClaims{
+			"iss":   provider.server.URL,
+			"aud":   "vault",
+			"nonce": params.Get("nonce"),
+			"email": "user@example.com",
+		}))
+		if claims != nil {
+			provider.idToken = testSign(t, jwt.SigningMethodRS256, key, "1", claims)
+		}
+	}
+	callback := func(params url.Values, clientNonce string) *logical.Response {
+		return testRequest(t, b, s, logical.UpdateOperation, "oidc/callback", map[string]interface{}{
+			"state":        params.Get("state"),
+			"code":         "code",
+			"client_nonce": clientNonce,
+		})
+	}
+
+	resp = testRequest(t, b, s, logical.UpdateOperation, "oidc/auth_url", map[string]interface{}{
+		"role":         "dev",
+		"redirect_uri": "https://evil.example.com/callback",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for unallowed redirect_uri, got %#v", resp)
+	}
+
+	params := authURL("http://localhost:8250/oidc/callback", "client-nonce")
+	if params.Get("client_id") != "vault" || params.Get("scope") != "openid email groups" ||
+		params.Get("response_type") != "code" || params.Get("code_challenge_method") != "S256" {
+		t.Fatalf("bad auth URL parameters: %v", params)
+	}
+	issue(params, nil)
+
+	if resp = callback(params, "other-nonce"); resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for wrong client_nonce, got %#v", resp)
+	}
+
+	// The state was consumed by the failed callback
+	params = authURL("http://localhost:8250/oidc/callback", "client-nonce")
+	issue(params, nil)
+	resp = callback(params, "client-nonce")
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp.Auth.DisplayName != "user@example.com" || len(resp.Auth.Policies) != 2 {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+	if resp = callback(params, "client-nonce"); resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for replayed state, got %#v", resp)
+	}
+
+	// ID tokens must carry the nonce and be issued for the client ID
+	for name, claims := range map[string]jwt.MapClaims{
+		"wrong nonce":    testClaims(jwt.MapClaims{"iss": provider.server.URL, "aud": "vault", "nonce": "other", "email": "user@example.com"}),
+		"wrong audience": nil,
+	} {
+		params := authURL("http://localhost:8250/oidc/callback", "")
+		if claims == nil {
+			claims = testClaims(jwt.MapClaims{"iss": provider.server.URL, "aud": "other", "nonce": params.Get("nonce"), "email": "user@example.com"})
+		}
+		issue(params, claims)
+		if resp := callback(params, ""); resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected error, got %#v", name, resp)
+		}
+	}
+
+	// OIDC roles cannot log in with a JWT
+	resp = testLogin(t, b, s, "dev", testSign(t, jwt.SigningMethodRS256, key, "1", testClaims(jwt.MapClaims{
+		"iss":   provider.server.URL,
+		"aud":   "vault",
+		"email": "user@example.com",
+	})))
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for JWT login with an OIDC role, got %#v", resp)
+	}
+}
+
+func TestJWT_GetClaim(t *testing.T) {
+	claims := map[string]interface{}{
+		"a/b": "slash",
+		"nested": map[string]interface{}{
+			"list": []interface{}{"x", "y"},
+			"n":    float64(42),
+		},
+	}
+
+	for claim, expected := range map[string]interface{}{
+		"/a~1b":           "slash",
+		"/nested/list/1":  "y",
+		"/nested/n":       float64(42),
+		"/nested/list/2":  nil,
+		"/nested/missing": nil,
+		"nested/n":        nil,
+	} {
+		if actual := getClaim(claims, claim); actual != expected {
+			t.Fatalf("%s: expected %v, got %v", claim, expected, actual)
+		}
+	}
+	if s, ok := claimString(claims, "/nested/n"); !ok || s != "42" {
+		t.Fatalf("bad: %q", s)
+	}
+}
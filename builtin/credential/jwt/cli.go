@@ -0,0 +1,174 @@
+package jwtauth
+
+import (
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	defaultListenAddress = "localhost"
+	defaultPort          = "8250"
+)
+
+// CLIHandler logs in with a role of the oidc type. It starts a listener
+// for the redirect of the OIDC provider, opens the auth URL in a browser,
+// and completes the login with the code it receives.
+type CLIHandler struct {
+	DefaultMount string
+}
+
+type loginResult struct {
+	secret *api.Secret
+	err    error
+}
+
+func (h *CLIHandler) Auth(c *api.Client, m map[string]string) (string, error) {
+	var data struct {
+		Mount         string `mapstructure:"mount"`
+		Role          string `mapstructure:"role"`
+		ListenAddress string `mapstructure:"listenaddress"`
+		Port          string `mapstructure:"port"`
+	}
+	if err := mapstructure.WeakDecode(m, &data); err != nil {
+		return "", err
+	}
+	if data.Mount == "" {
+		data.Mount = h.DefaultMount
+	}
+	if data.ListenAddress == "" {
+		data.ListenAddress = defaultListenAddress
+	}
+	if data.Port == "" {
+		data.Port = defaultPort
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(data.ListenAddress, data.Port))
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+
+	clientNonce, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+	redirectURI := fmt.Sprintf("http://%s/oidc/callback", net.JoinHostPort(data.ListenAddress, data.Port))
+
+	secret, err := c.Logical().Write(fmt.Sprintf("auth/%s/oidc/auth_url", data.Mount), map[string]interface{}{
+		"role":         data.Role,
+		"redirect_uri": redirectURI,
+		"client_nonce": clientNonce,
+	})
+	if err != nil {
+		return "", err
+	}
+	if secret == nil {
+		return "", fmt.Errorf("empty response from credential provider")
+	}
+	authURL, _ := secret.Data["auth_url"].(string)
+	if authURL == "" {
+		return "", fmt.Errorf("no auth_url in the response from credential provider")
+	}
+
+	doneCh := make(chan loginResult, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oidc/callback", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if errParam := query.Get("error"); errParam != "" {
+			fmt.Fprintf(w, callbackPage, "Login failed: "+html.EscapeString(errParam))
+			doneCh <- loginResult{err: fmt.Errorf("OIDC provider returned an error: %s %s", errParam, query.Get("error_description"))}
+			return
+		}
+
+		secret, err := c.Logical().Write(fmt.Sprintf("auth/%s/oidc/callback", data.Mount), map[string]interface{}{
+			"state":        query.Get("state"),
+			"code":         query.Get("code"),
+			"client_nonce": clientNonce,
+		})
+		if err != nil {
+			fmt.Fprintf(w, callbackPage, "Login failed, see the terminal for details.")
+		} else {
+			fmt.Fprintf(w, callbackPage, "Login succeeded, you can close this window.")
+		}
+		doneCh <- loginResult{secret: secret, err: err}
+	})
+	go http.Serve(listener, mux)
+
+	fmt.Fprintf(os.Stderr, "Complete the login via your OIDC provider. Launching browser to:\n\n    %s\n\n", authURL)
+	if err := openURL(authURL); err != nil {
+		fmt.Fprintf(os.Stderr, "Error attempting to automatically open browser: '%s'.\nPlease visit the authorization URL manually.\n", err)
+	}
+	fmt.Fprintf(os.Stderr, "Waiting for OIDC authentication to complete...\n")
+
+	sigintCh := make(chan os.Signal, 1)
+	signal.Notify(sigintCh, os.Interrupt)
+	defer signal.Stop(sigintCh)
+
+	select {
+	case result := <-doneCh:
+		if result.err != nil {
+			return "", result.err
+		}
+		if result.secret == nil || result.secret.Auth == nil {
+			return "", fmt.Errorf("empty response from credential provider")
+		}
+		return result.secret.Auth.ClientToken, nil
+	case <-sigintCh:
+		return "", fmt.Errorf("interrupted")
+	}
+}
+
+// openURL opens the URL in the default browser
+func openURL(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
+
+const callbackPage = `<!DOCTYPE html>
+<html><head><title>Vault</title></head><body><p>%s</p></body></html>
+`
+
+func (h *CLIHandler) Help() string {
+	help := `
+The JWT credential provider allows you to log in with an OIDC provider through
+your browser, with a role of the "oidc" type. The role must allow the
+redirect URI http://<listenaddress>:<port>/oidc/callback.
+
+    Example: vault auth -method=oidc role=dev
+
+Key/Value Pairs:
+
+    mount=oidc               The mountpoint for the JWT credential provider.
+                             Defaults to "oidc"
+
+    role=<name>              The role to log in with. Defaults to the
+                             default_role of the configuration.
+
+    listenaddress=localhost  The address the redirect is received on.
+                             Defaults to "localhost"
+
+    port=8250                The port the redirect is received on.
+                             Defaults to "8250"
+	`
+
+	return strings.TrimSpace(help)
+}
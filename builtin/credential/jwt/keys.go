@@ -0,0 +1,311 @@
+package jwtauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+var supportedAlgorithms = map[string]bool{
+	"RS256": true,
+	"RS384": true,
+	"RS512": true,
+	"ES256": true,
+	"ES384": true,
+	"ES512": true,
+}
+
+// verifyJWT verifies the signature and the time claims of the JWT with the
+// keys of the configuration, and returns its claims
+func (b *backend) verifyJWT(config *jwtConfig, jwtStr string) (map[string]interface{}, error) {
+	parser := &jwt.Parser{
+		ValidMethods: config.algorithms(),
+	}
+
+	if len(config.JWTValidationPubKeys) != 0 {
+		keys, err := config.publicKeys()
+		if err != nil {
+			return nil, err
+		}
+
+		var lastErr error
+		for _, key := range keys {
+			claims := jwt.MapClaims{}
+			_, err := parser.ParseWithClaims(jwtStr, claims, func(token *jwt.Token) (interface{}, error) {
+				return matchKey(token, key)
+			})
+			if err == nil {
+				return claims, nil
+			}
+			lastErr = err
+		}
+		return nil, fmt.Errorf("failed to verify JWT: %s", lastErr)
+	}
+
+	keySet, err := b.remoteKeySet(config)
+	if err != nil {
+		return nil, err
+	}
+	claims := jwt.MapClaims{}
+	_, err = parser.ParseWithClaims(jwtStr, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, err := keySet.key(kid)
+		if err != nil {
+			return nil, err
+		}
+		return matchKey(token, key)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify JWT: %s", err)
+	}
+	return claims, nil
+}
+
+// matchKey returns the key if its type matches the signing method
+func matchKey(token *jwt.Token, key interface{}) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA:
+		if _, ok := key.(*rsa.PublicKey); ok {
+			return key, nil
+		}
+	case *jwt.SigningMethodECDSA:
+		if _, ok := key.(*ecdsa.PublicKey); ok {
+			return key, nil
+		}
+	}
+	return nil, errors.New("key does not match the signing method")
+}
+
+// remoteKeySet returns the cached key set of the JWKS URL, or of the
+// discovered JWKS URL
+func (b *backend) remoteKeySet(config *jwtConfig) (*remoteKeySet, error) {
+	b.keySetLock.Lock()
+	defer b.keySetLock.Unlock()
+
+	if b.keySet != nil {
+		return b.keySet, nil
+	}
+
+	keySet := &remoteKeySet{
+		url: config.JWKSURL,
+	}
+	caPEM := config.JWKSCAPEM
+	if config.OIDCDiscoveryURL != "" {
+		discovery, err := discover(config)
+		if err != nil {
+			return nil, err
+		}
+		keySet.url = discovery.JWKSURI
+		caPEM = config.OIDCDiscoveryCAPEM
+	}
+	client, err := httpClient(caPEM)
+	if err != nil {
+		return nil, err
+	}
+	keySet.client = client
+
+	b.keySet = keySet
+	return keySet, nil
+}
+
+// providerDiscovery is the subset of the OIDC discovery document used by
+// the backend
+type providerDiscovery struct {
+	Issuer                string `json:"issuer"`
+	JWKSURI               string `json:"jwks_uri"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+}
+
+// discover fetches the OIDC discovery document of the configuration
+func discover(config *jwtConfig) (*providerDiscovery, error) {
+	client, err := httpClient(config.OIDCDiscoveryCAPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	wellKnown := strings.TrimSuffix(config.OIDCDiscoveryURL, "/") + "/.well-known/openid-configuration"
+	var discovery providerDiscovery
+	if err := getJSON(client, wellKnown, &discovery); err != nil {
+		return nil, fmt.Errorf("failed to fetch the OIDC discovery document: %s", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != strings.TrimSuffix(config.OIDCDiscoveryURL, "/") {
+		return nil, fmt.Errorf("issuer %q of the OIDC discovery document does not match oidc_discovery_url", discovery.Issuer)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document has no jwks_uri")
+	}
+	return &discovery, nil
+}
+
+// remoteKeySet is a JWK set fetched from a URL. The keys are fetched again
+// when a JWT is signed with an unknown key ID, which happens when the keys
+// are rotated.
+type remoteKeySet struct {
+	url    string
+	client *http.Client
+
+	// keys is the last fetched set, by key ID
+	lock sync.Mutex
+	keys map[string]interface{}
+}
+
+func (s *remoteKeySet) key(kid string) (interface{}, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+
+	keys, err := s.fetch()
+	if err != nil {
+		return nil, err
+	}
+	s.keys = keys
+
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("no key with ID %q in the JWK set", kid)
+}
+
+// lookup finds the key in the cached set. A JWT without a key ID can only
+// be verified with a set of a single key.
+func (s *remoteKeySet) lookup(kid string) (interface{}, bool) {
+	if kid == "" {
+		if len(s.keys) == 1 {
+			for _, key := range s.keys {
+				return key, true
+			}
+		}
+		return nil, false
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+func (s *remoteKeySet) fetch() (map[string]interface{}, error) {
+	var set struct {
+		Keys []*jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(s.client, s.url, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch the JWK set: %s", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Keys of unsupported types are ignored
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+	return keys, nil
+}
+
+// jsonWebKey is a public key of a JWK set
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+
+	// RSA public key
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC public key
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+func (k *jsonWebKey) publicKey() (interface{}, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.KeyType {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+}
+
+func httpClient(caPEM string) (*http.Client, error) {
+	client := cleanhttp.DefaultClient()
+	if caPEM != "" {
+		pool, err := certPool(caPEM)
+		if err != nil {
+			return nil, err
+		}
+		transport := cleanhttp.DefaultTransport()
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs: pool,
+		}
+		client.Transport = transport
+	}
+	return client, nil
+}
+
+func getJSON(client *http.Client, url string, out interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
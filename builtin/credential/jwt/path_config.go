@@ -0,0 +1,251 @@
+package jwtauth
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `config`,
+		Fields: map[string]*framework.FieldSchema{
+			"oidc_discovery_url": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "OIDC discovery URL, without the /.well-known/openid-configuration suffix. The keys are found with discovery.",
+			},
+			"oidc_discovery_ca_pem": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "PEM encoded CA certificate of the OIDC discovery URL. Defaults to the system CAs.",
+			},
+			"oidc_client_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Client ID of Vault at the OIDC provider, used by the roles of the oidc type.",
+			},
+			"oidc_client_secret": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Client secret of Vault at the OIDC provider, used by the roles of the oidc type.",
+			},
+			"jwks_url": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "URL of the JWK set used to verify the tokens.",
+			},
+			"jwks_ca_pem": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "PEM encoded CA certificate of the JWKS URL. Defaults to the system CAs.",
+			},
+			"jwt_validation_pubkeys": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of PEM encoded public keys used to verify the tokens.",
+			},
+			"jwt_supported_algs": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of the signing algorithms accepted. Defaults to RS256.",
+			},
+			"bound_issuer": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "If set, the issuer the tokens must have. Defaults to the discovered issuer with OIDC discovery.",
+			},
+			"default_role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Role used when logging in without a role.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+// Config returns the configuration of the backend
+func (b *backend) Config(s logical.Storage) (*jwtConfig, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result jwtConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	// The client secret is a credential, and is not returned
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"oidc_discovery_url":     config.OIDCDiscoveryURL,
+			"oidc_client_id":         config.OIDCClientID,
+			"oidc_discovery_ca_pem":  config.OIDCDiscoveryCAPEM,
+			"jwks_url":               config.JWKSURL,
+			"jwks_ca_pem":            config.JWKSCAPEM,
+			"jwt_validation_pubkeys": config.JWTValidationPubKeys,
+			"jwt_supported_algs":     config.JWTSupportedAlgs,
+			"bound_issuer":           config.BoundIssuer,
+			"default_role":           config.DefaultRole,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config := &jwtConfig{
+		OIDCDiscoveryURL:     d.Get("oidc_discovery_url").(string),
+		OIDCDiscoveryCAPEM:   d.Get("oidc_discovery_ca_pem").(string),
+		OIDCClientID:         d.Get("oidc_client_id").(string),
+		OIDCClientSecret:     d.Get("oidc_client_secret").(string),
+		JWKSURL:              d.Get("jwks_url").(string),
+		JWKSCAPEM:            d.Get("jwks_ca_pem").(string),
+		JWTValidationPubKeys: d.Get("jwt_validation_pubkeys").([]string),
+		JWTSupportedAlgs:     d.Get("jwt_supported_algs").([]string),
+		BoundIssuer:          d.Get("bound_issuer").(string),
+		DefaultRole:          d.Get("default_role").(string),
+	}
+
+	sources := 0
+	if config.OIDCDiscoveryURL != "" {
+		sources++
+	}
+	if config.JWKSURL != "" {
+		sources++
+	}
+	if len(config.JWTValidationPubKeys) != 0 {
+		sources++
+	}
+	if sources != 1 {
+		return logical.ErrorResponse("exactly one of oidc_discovery_url, jwks_url or jwt_validation_pubkeys must be set"), nil
+	}
+
+	if config.OIDCClientID != "" && config.OIDCDiscoveryURL == "" {
+		return logical.ErrorResponse("oidc_client_id requires oidc_discovery_url"), nil
+	}
+
+	for _, caPEM := range []string{config.OIDCDiscoveryCAPEM, config.JWKSCAPEM} {
+		if caPEM == "" {
+			continue
+		}
+		if _, err := certPool(caPEM); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+	if _, err := config.publicKeys(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	for _, alg := range config.JWTSupportedAlgs {
+		if !supportedAlgorithms[alg] {
+			return logical.ErrorResponse(fmt.Sprintf("unsupported signing algorithm %q", alg)), nil
+		}
+	}
+
+	// Check that the keys can be found, so that a wrong URL is reported now
+	// rather than at login
+	if config.OIDCDiscoveryURL != "" {
+		if _, err := discover(config); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+	b.reset()
+
+	return nil, nil
+}
+
+// jwtConfig is the configuration of the backend
+type jwtConfig struct {
+	OIDCDiscoveryURL     string   `json:"oidc_discovery_url"`
+	OIDCDiscoveryCAPEM   string   `json:"oidc_discovery_ca_pem"`
+	OIDCClientID         string   `json:"oidc_client_id"`
+	OIDCClientSecret     string   `json:"oidc_client_secret"`
+	JWKSURL              string   `json:"jwks_url"`
+	JWKSCAPEM            string   `json:"jwks_ca_pem"`
+	JWTValidationPubKeys []string `json:"jwt_validation_pubkeys"`
+	JWTSupportedAlgs     []string `json:"jwt_supported_algs"`
+	BoundIssuer          string   `json:"bound_issuer"`
+	DefaultRole          string   `json:"default_role"`
+}
+
+// algorithms returns the signing algorithms accepted
+func (c *jwtConfig) algorithms() []string {
+	if len(c.JWTSupportedAlgs) == 0 {
+		return []string{"RS256"}
+	}
+	return c.JWTSupportedAlgs
+}
+
+// publicKeys parses the static public keys of the configuration
+func (c *jwtConfig) publicKeys() ([]interface{}, error) {
+	keys := make([]interface{}, 0, len(c.JWTValidationPubKeys))
+	for _, pemKey := range c.JWTValidationPubKeys {
+		block, _ := pem.Decode([]byte(pemKey))
+		if block == nil {
+			return nil, errors.New("jwt_validation_pubkeys contains a key which is not PEM encoded")
+		}
+
+		var key interface{}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			key = cert.PublicKey
+		} else if key, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %s", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func certPool(caPEM string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(caPEM)) {
+		return nil, errors.New("could not parse CA certificate")
+	}
+	return pool, nil
+}
+
+const pathConfigHelpSyn = `
+Configures how the JWTs are verified.
+`
+
+const pathConfigHelpDesc = `
+The signatures of the JWTs are verified with the keys of exactly one source:
+
+  * "oidc_discovery_url", the issuer URL of an OpenID Connect provider, whose
+    keys are found with OIDC discovery. The discovered issuer is also the
+    default "bound_issuer".
+  * "jwks_url", the URL of a JWK set.
+  * "jwt_validation_pubkeys", a list of PEM encoded public keys.
+
+The roles of the "oidc" type require OIDC discovery and the
+"oidc_client_id" and "oidc_client_secret" of Vault at the provider.
+
+The keys fetched from URLs are cached, and fetched again when a JWT is signed
+with an unknown key ID.
+`
@@ -0,0 +1,311 @@
+package jwtauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathLogin(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "login$",
+		Fields: map[string]*framework.FieldSchema{
+			"role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role to log in with. Defaults to the default_role of the configuration.",
+			},
+			"jwt": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The signed JWT.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLogin,
+		},
+
+		HelpSynopsis:    pathLoginHelpSyn,
+		HelpDescription: pathLoginHelpDesc,
+	}
+}
+
+func (b *backend) pathLogin(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	jwtStr := d.Get("jwt").(string)
+	if jwtStr == "" {
+		return logical.ErrorResponse("missing jwt"), nil
+	}
+
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return logical.ErrorResponse("jwt backend is not configured"), nil
+	}
+
+	roleName := strings.ToLower(d.Get("role").(string))
+	if roleName == "" {
+		roleName = config.DefaultRole
+	}
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+	role, err := b.role(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid role name %q", roleName)), nil
+	}
+
+	if role.RoleType != roleTypeJWT {
+		return logical.ErrorResponse(fmt.Sprintf("role %q logs in through the OIDC provider", roleName)), nil
+	}
+
+	claims, err := b.verifyJWT(config, jwtStr)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := validateClaims(config, role, claims); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return roleAuth(roleName, role, claims)
+}
+
+// roleAuth returns the auth of a login with validated claims
+func roleAuth(roleName string, role *jwtRole, claims map[string]interface{}) (*logical.Response, error) {
+	user, ok := claimString(claims, role.UserClaim)
+	if !ok || user == "" {
+		return logical.ErrorResponse(fmt.Sprintf("claim %q not found in JWT", role.UserClaim)), nil
+	}
+
+	metadata := map[string]string{
+		"role": roleName,
+	}
+	for claim, key := range role.ClaimMappings {
+		if value, ok := claimString(claims, claim); ok {
+			metadata[key] = value
+		}
+	}
+
+	var groups []string
+	if role.GroupsClaim != "" {
+		var err error
+		if groups, err = claimStrings(claims, role.GroupsClaim); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	auth := &logical.Auth{
+		Policies:     role.Policies,
+		GroupAliases: groups,
+		Period:       role.Period,
+		InternalData: map[string]interface{}{
+			"role": roleName,
+		},
+		Metadata:    metadata,
+		DisplayName: user,
+		LeaseOptions: logical.LeaseOptions{
+			TTL:       role.TTL,
+			Renewable: true,
+		},
+	}
+
+	// If 'Period' is set, use the value of 'Period' as the TTL
+	if role.Period > time.Duration(0) {
+		auth.TTL = role.Period
+	}
+
+	return &logical.Response{
+		Auth: auth,
+	}, nil
+}
+
+func (b *backend) pathLoginRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if req.Auth == nil {
+		return nil, fmt.Errorf("request auth was nil")
+	}
+
+	roleName, _ := req.Auth.InternalData["role"].(string)
+	if roleName == "" {
+		return nil, fmt.Errorf("failed to fetch role during renewal")
+	}
+
+	// The role must still exist and grant the same policies
+	role, err := b.role(req.Storage, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate role %s during renewal: %s", roleName, err)
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role %s does not exist during renewal", roleName)
+	}
+	if !policyutil.EquivalentPolicies(role.Policies, req.Auth.Policies) {
+		return nil, fmt.Errorf("policies have changed, not renewing")
+	}
+
+	if role.Period > time.Duration(0) {
+		req.Auth.TTL = role.Period
+		return &logical.Response{Auth: req.Auth}, nil
+	}
+	return framework.LeaseExtend(role.TTL, role.MaxTTL, b.System())(req, d)
+}
+
+// validateClaims checks the issuer, audience, subject and bound claims of a
+// verified JWT
+func validateClaims(config *jwtConfig, role *jwtRole, claims map[string]interface{}) error {
+	issuer := config.BoundIssuer
+	if issuer == "" && config.OIDCDiscoveryURL != "" {
+		// The discovered issuer matches the discovery URL
+		issuer = config.OIDCDiscoveryURL
+	}
+	if issuer != "" {
+		iss, _ := claims["iss"].(string)
+		if strings.TrimSuffix(iss, "/") != strings.TrimSuffix(issuer, "/") {
+			return fmt.Errorf("invalid issuer %q", iss)
+		}
+	}
+
+	audiences, err := claimStrings(claims, "aud")
+	if err != nil {
+		return err
+	}
+	boundAudiences := role.boundAudiences(config)
+	switch {
+	case len(boundAudiences) != 0:
+		found := false
+		for _, aud := range audiences {
+			if strutil.StrListContains(boundAudiences, aud) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("aud claim does not match any bound audience")
+		}
+	case len(audiences) != 0:
+		// A JWT issued for an audience must not be accepted by roles which
+		// do not expect it
+		return errors.New("aud claim found in JWT but no audiences bound to the role")
+	}
+
+	if role.BoundSubject != "" {
+		if sub, _ := claims["sub"].(string); sub != role.BoundSubject {
+			return errors.New("sub claim does not match the bound subject")
+		}
+	}
+
+	for claim, expected := range role.BoundClaims {
+		value, ok := claimString(claims, claim)
+		if !ok {
+			return fmt.Errorf("claim %q is missing", claim)
+		}
+		if !matchBoundClaim(expected, value, role.BoundClaimsType == claimTypeGlob) {
+			return fmt.Errorf("claim %q does not match any associated bound claim values", claim)
+		}
+	}
+
+	return nil
+}
+
+// matchBoundClaim checks the value of a claim against a bound value, or a
+// list of bound values
+func matchBoundClaim(expected interface{}, value string, glob bool) bool {
+	var values []string
+	switch expected := expected.(type) {
+	case string:
+		values = []string{expected}
+	case []interface{}:
+		for _, v := range expected {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	for _, v := range values {
+		if glob && strutil.GlobbedStringsMatch(v, value) || v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// getClaim returns a claim. Claims starting with "/" are JSON pointers to
+// nested claims, such as "/groups/0" or "/address/country".
+func getClaim(claims map[string]interface{}, claim string) interface{} {
+	if !strings.HasPrefix(claim, "/") {
+		return claims[claim]
+	}
+
+	var current interface{} = claims
+	for _, token := range strings.Split(claim[1:], "/") {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		switch node := current.(type) {
+		case map[string]interface{}:
+			current = node[token]
+		case []interface{}:
+			var index int
+			if _, err := fmt.Sscanf(token, "%d", &index); err != nil || index < 0 || index >= len(node) {
+				return nil
+			}
+			current = node[index]
+		default:
+			return nil
+		}
+	}
+	return current
+}
+
+// claimString returns a claim whose value is a string, a number or a
+// boolean, as a string
+func claimString(claims map[string]interface{}, claim string) (string, bool) {
+	switch value := getClaim(claims, claim).(type) {
+	case string:
+		return value, true
+	case float64, bool, json.Number:
+		return fmt.Sprint(value), true
+	}
+	return "", false
+}
+
+// claimStrings returns a claim whose value is a string or a list of
+// strings, as a list
+func claimStrings(claims map[string]interface{}, claim string) ([]string, error) {
+	switch value := getClaim(claims, claim).(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{value}, nil
+	case []interface{}:
+		result := make([]string, 0, len(value))
+		for _, v := range value {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("claim %q must be a string or a list of strings", claim)
+			}
+			result = append(result, s)
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("claim %q must be a string or a list of strings", claim)
+}
+
+const pathLoginHelpSyn = `
+Authenticates JWTs with Vault.
+`
+
+const pathLoginHelpDesc = `
+Log in with a signed JWT and the name of a role binding it. The signature,
+expiration and issuer of the JWT are verified, and its claims must match the
+bindings of the role.
+`
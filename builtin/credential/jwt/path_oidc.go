@@ -0,0 +1,343 @@
+package jwtauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// oidcStateTTL is how long users have to complete an OIDC login
+const oidcStateTTL = 10 * time.Minute
+
+// oidcState is a pending OIDC login, created by the auth URL request and
+// consumed by the callback
+type oidcState struct {
+	roleName     string
+	redirectURI  string
+	nonce        string
+	codeVerifier string
+	clientNonce  string
+	expiration   time.Time
+}
+
+func pathOIDCAuthURL(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `oidc/auth_url`,
+		Fields: map[string]*framework.FieldSchema{
+			"role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role to log in with. Defaults to the default_role of the configuration.",
+			},
+			"redirect_uri": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "URI the OIDC provider redirects the user to, which must be allowed by the role.",
+			},
+			"client_nonce": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Optional nonce which the client must present again to the callback.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathOIDCAuthURL,
+		},
+
+		HelpSynopsis:    pathOIDCAuthURLHelpSyn,
+		HelpDescription: pathOIDCAuthURLHelpDesc,
+	}
+}
+
+func pathOIDCCallback(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `oidc/callback`,
+		Fields: map[string]*framework.FieldSchema{
+			"state": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "State returned by the OIDC provider.",
+			},
+			"code": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Authorization code returned by the OIDC provider.",
+			},
+			"client_nonce": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Nonce given to the auth URL request, if any.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathOIDCCallback,
+		},
+
+		HelpSynopsis:    pathOIDCCallbackHelpSyn,
+		HelpDescription: pathOIDCCallbackHelpDesc,
+	}
+}
+
+func (b *backend) pathOIDCAuthURL(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || config.OIDCClientID == "" {
+		return logical.ErrorResponse("jwt backend is not configured for OIDC logins"), nil
+	}
+
+	roleName := strings.ToLower(d.Get("role").(string))
+	if roleName == "" {
+		roleName = config.DefaultRole
+	}
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+	role, err := b.role(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid role name %q", roleName)), nil
+	}
+	if role.RoleType != roleTypeOIDC {
+		return logical.ErrorResponse(fmt.Sprintf("role %q is not an OIDC role", roleName)), nil
+	}
+
+	redirectURI := d.Get("redirect_uri").(string)
+	if redirectURI == "" {
+		return logical.ErrorResponse("missing redirect_uri"), nil
+	}
+	if !strutil.StrListContains(role.AllowedRedirectURIs, redirectURI) {
+		return logical.ErrorResponse(fmt.Sprintf("redirect_uri %q is not allowed by the role", redirectURI)), nil
+	}
+
+	discovery, err := discover(config)
+	if err != nil {
+		return nil, err
+	}
+	if discovery.AuthorizationEndpoint == "" {
+		return nil, errors.New("OIDC discovery document has no authorization_endpoint")
+	}
+
+	stateID, state, err := b.createOIDCState(roleName, redirectURI, d.Get("client_nonce").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	// The code challenge binds the authorization code to this login (PKCE)
+	challenge := sha256.Sum256([]byte(state.codeVerifier))
+	params := url.Values{
+		"client_id":             {config.OIDCClientID},
+		"response_type":         {"code"},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {strings.Join(append([]string{"openid"}, role.OIDCScopes...), " ")},
+		"state":                 {stateID},
+		"nonce":                 {state.nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	authURL := discovery.AuthorizationEndpoint
+	if strings.Contains(authURL, "?") {
+		authURL += "&" + params.Encode()
+	} else {
+		authURL += "?" + params.Encode()
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"auth_url": authURL,
+		},
+	}, nil
+}
+
+func (b *backend) pathOIDCCallback(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	stateID := d.Get("state").(string)
+	if stateID == "" {
+		return logical.ErrorResponse("missing state"), nil
+	}
+	code := d.Get("code").(string)
+	if code == "" {
+		return logical.ErrorResponse("missing code"), nil
+	}
+
+	// A state can only be used once
+	state := b.consumeOIDCState(stateID)
+	if state == nil {
+		return logical.ErrorResponse("expired or unknown state"), nil
+	}
+	if state.clientNonce != d.Get("client_nonce").(string) {
+		return logical.ErrorResponse("invalid client_nonce"), nil
+	}
+
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || config.OIDCClientID == "" {
+		return logical.ErrorResponse("jwt backend is not configured for OIDC logins"), nil
+	}
+	role, err := b.role(req.Storage, state.roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil || role.RoleType != roleTypeOIDC {
+		return logical.ErrorResponse(fmt.Sprintf("invalid role name %q", state.roleName)), nil
+	}
+
+	idToken, err := exchangeCode(config, state, code)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	claims, err := b.verifyJWT(config, idToken)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if nonce, _ := claims["nonce"].(string); nonce != state.nonce {
+		return logical.ErrorResponse("invalid ID token nonce"), nil
+	}
+	if err := validateClaims(config, role, claims); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return roleAuth(state.roleName, role, claims)
+}
+
+// createOIDCState registers a pending OIDC login, and prunes the expired
+// ones
+func (b *backend) createOIDCState(roleName, redirectURI, clientNonce string) (string, *oidcState, error) {
+	stateID, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", nil, err
+	}
+	nonce, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", nil, err
+	}
+	verifier := make([]byte, 32)
+	if _, err := rand.Read(verifier); err != nil {
+		return "", nil, err
+	}
+
+	state := &oidcState{
+		roleName:     roleName,
+		redirectURI:  redirectURI,
+		nonce:        nonce,
+		codeVerifier: base64.RawURLEncoding.EncodeToString(verifier),
+		clientNonce:  clientNonce,
+		expiration:   time.Now().Add(oidcStateTTL),
+	}
+
+	b.oidcStatesLock.Lock()
+	defer b.oidcStatesLock.Unlock()
+
+	now := time.Now()
+	for id, s := range b.oidcStates {
+		if now.After(s.expiration) {
+			delete(b.oidcStates, id)
+		}
+	}
+	b.oidcStates[stateID] = state
+
+	return stateID, state, nil
+}
+
+// consumeOIDCState removes a pending OIDC login, and returns it if it has
+// not expired
+func (b *backend) consumeOIDCState(stateID string) *oidcState {
+	b.oidcStatesLock.Lock()
+	defer b.oidcStatesLock.Unlock()
+
+	state, ok := b.oidcStates[stateID]
+	if !ok {
+		return nil
+	}
+	delete(b.oidcStates, stateID)
+
+	if time.Now().After(state.expiration) {
+		return nil
+	}
+	return state
+}
+
+// exchangeCode exchanges the authorization code for the ID token at the
+// token endpoint of the provider
+func exchangeCode(config *jwtConfig, state *oidcState, code string) (string, error) {
+	discovery, err := discover(config)
+	if err != nil {
+		return "", err
+	}
+	if discovery.TokenEndpoint == "" {
+		return "", errors.New("OIDC discovery document has no token_endpoint")
+	}
+	client, err := httpClient(config.OIDCDiscoveryCAPEM)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.PostForm(discovery.TokenEndpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {state.redirectURI},
+		"client_id":     {config.OIDCClientID},
+		"client_secret": {config.OIDCClientSecret},
+		"code_verifier": {state.codeVerifier},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange the authorization code: %s", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode the token response: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to exchange the authorization code: %s %s", result.Error, result.ErrorDescription)
+	}
+	if result.IDToken == "" {
+		return "", errors.New("token response has no id_token")
+	}
+	return result.IDToken, nil
+}
+
+const pathOIDCAuthURLHelpSyn = `
+Returns the URL where users log in to the OIDC provider.
+`
+
+const pathOIDCAuthURLHelpDesc = `
+This path starts an OIDC login with a role of the "oidc" type. The user opens
+the returned URL in a browser, and the provider redirects them to the
+"redirect_uri" with an authorization code and a state, which are given to the
+"oidc/callback" path within 10 minutes.
+
+The code is bound to the login with PKCE, and the ID token with a nonce. An
+optional "client_nonce" ensures that only the client which started the login
+can complete it.
+`
+
+const pathOIDCCallbackHelpSyn = `
+Completes an OIDC login.
+`
+
+const pathOIDCCallbackHelpDesc = `
+This path exchanges the authorization code returned by the OIDC provider for
+an ID token, validates it against the role of the login, and issues a Vault
+token. Each state can only be used once.
+`
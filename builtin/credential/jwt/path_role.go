@@ -0,0 +1,373 @@
+package jwtauth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	claimTypeString = "string"
+	claimTypeGlob   = "glob"
+
+	roleTypeJWT  = "jwt"
+	roleTypeOIDC = "oidc"
+)
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    pathRoleHelpSyn,
+		HelpDescription: pathRoleHelpDesc,
+	}
+}
+
+func pathRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+			"role_type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     roleTypeJWT,
+				Description: `Type of the role: "jwt" to log in with JWTs, or "oidc" to log users in through the OIDC provider.`,
+			},
+			"allowed_redirect_uris": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of the redirect URIs allowed in OIDC logins.",
+			},
+			"oidc_scopes": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Comma separated list of the scopes requested in OIDC logins, in addition to "openid".`,
+			},
+			"bound_audiences": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of audiences. The aud claim of the JWTs must contain one of them.",
+			},
+			"bound_subject": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "If set, the sub claim the JWTs must have.",
+			},
+			"bound_claims": &framework.FieldSchema{
+				Type: framework.TypeMap,
+				Description: `Map of claims to the values they must have. A value can be a list, of which
+the claim must match one element. Claims starting with "/" are JSON pointers
+to nested claims.`,
+			},
+			"bound_claims_type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     claimTypeString,
+				Description: `How the bound claims are matched: "string" for exact matches, or "glob" for values with a leading or trailing "*".`,
+			},
+			"claim_mappings": &framework.FieldSchema{
+				Type:        framework.TypeMap,
+				Description: "Map of claims to the metadata keys they are copied to.",
+			},
+			"user_claim": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Claim identifying the user, used as the display name of the tokens.",
+			},
+			"groups_claim": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "If set, claim listing the groups of the user, which are resolved to external groups.",
+			},
+			"policies": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of policies on the role.",
+			},
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Duration after which the issued tokens expire. Defaults to the mount's default TTL.",
+			},
+			"max_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Duration after which the issued tokens cannot be renewed. Defaults to the mount's maximum TTL.",
+			},
+			"period": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `If set, the issued tokens are periodic: they never expire as long as they
+are renewed within this duration.`,
+			},
+		},
+
+		ExistenceCheck: b.pathRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathRoleCreateUpdate,
+			logical.UpdateOperation: b.pathRoleCreateUpdate,
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    pathRoleHelpSyn,
+		HelpDescription: pathRoleHelpDesc,
+	}
+}
+
+// role returns the named role, or nil if it does not exist
+func (b *backend) role(s logical.Storage, name string) (*jwtRole, error) {
+	entry, err := s.Get("role/" + strings.ToLower(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result jwtRole
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	if result.RoleType == "" {
+		result.RoleType = roleTypeJWT
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathRoleExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	role, err := b.role(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return role != nil, nil
+}
+
+func (b *backend) pathRoleList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roles, err := req.Storage.List("role/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathRoleRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := b.role(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"role_type":             role.RoleType,
+			"allowed_redirect_uris": role.AllowedRedirectURIs,
+			"oidc_scopes":           role.OIDCScopes,
+			"bound_audiences":       role.BoundAudiences,
+			"bound_subject":         role.BoundSubject,
+			"bound_claims":          role.BoundClaims,
+			"bound_claims_type":     role.BoundClaimsType,
+			"claim_mappings":        role.ClaimMappings,
+			"user_claim":            role.UserClaim,
+			"groups_claim":          role.GroupsClaim,
+			"policies":              role.Policies,
+			"ttl":                   int64(role.TTL / time.Second),
+			"max_ttl":               int64(role.MaxTTL / time.Second),
+			"period":                int64(role.Period / time.Second),
+		},
+	}, nil
+}
+
+func (b *backend) pathRoleDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete("role/" + strings.ToLower(d.Get("name").(string))); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathRoleCreateUpdate(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := strings.ToLower(d.Get("name").(string))
+	role, err := b.role(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role = &jwtRole{
+			RoleType:        d.Get("role_type").(string),
+			BoundClaimsType: claimTypeString,
+		}
+	}
+
+	if raw, ok := d.GetOk("role_type"); ok && raw.(string) != role.RoleType {
+		return logical.ErrorResponse("role_type cannot be changed"), nil
+	}
+	if raw, ok := d.GetOk("allowed_redirect_uris"); ok {
+		role.AllowedRedirectURIs = raw.([]string)
+	}
+	if raw, ok := d.GetOk("oidc_scopes"); ok {
+		role.OIDCScopes = raw.([]string)
+	}
+
+	if raw, ok := d.GetOk("bound_audiences"); ok {
+		role.BoundAudiences = raw.([]string)
+	}
+	if raw, ok := d.GetOk("bound_subject"); ok {
+		role.BoundSubject = raw.(string)
+	}
+	if raw, ok := d.GetOk("bound_claims"); ok {
+		role.BoundClaims = raw.(map[string]interface{})
+	}
+	if raw, ok := d.GetOk("bound_claims_type"); ok {
+		role.BoundClaimsType = raw.(string)
+	}
+	if raw, ok := d.GetOk("claim_mappings"); ok {
+		var mappings map[string]string
+		if err := mapstructure.Decode(raw, &mappings); err != nil {
+			return logical.ErrorResponse("claim_mappings must map claims to metadata keys"), nil
+		}
+		role.ClaimMappings = mappings
+	}
+	if raw, ok := d.GetOk("user_claim"); ok {
+		role.UserClaim = raw.(string)
+	}
+	if raw, ok := d.GetOk("groups_claim"); ok {
+		role.GroupsClaim = raw.(string)
+	}
+	if raw, ok := d.GetOk("policies"); ok {
+		role.Policies = policyutil.SanitizePolicies(raw.([]string), true)
+	} else if req.Operation == logical.CreateOperation {
+		role.Policies = policyutil.SanitizePolicies(nil, true)
+	}
+	if raw, ok := d.GetOk("ttl"); ok {
+		role.TTL = time.Duration(raw.(int)) * time.Second
+	}
+	if raw, ok := d.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(raw.(int)) * time.Second
+	}
+	if raw, ok := d.GetOk("period"); ok {
+		role.Period = time.Duration(raw.(int)) * time.Second
+	}
+
+	if role.UserClaim == "" {
+		return logical.ErrorResponse("user_claim must be set"), nil
+	}
+	switch role.RoleType {
+	case roleTypeJWT:
+		if len(role.BoundAudiences) == 0 && role.BoundSubject == "" && len(role.BoundClaims) == 0 {
+			return logical.ErrorResponse("at least one of bound_audiences, bound_subject or bound_claims must be set"), nil
+		}
+	case roleTypeOIDC:
+		// The ID tokens are bound to the client ID of Vault
+		if len(role.AllowedRedirectURIs) == 0 {
+			return logical.ErrorResponse("allowed_redirect_uris must be set"), nil
+		}
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("role_type must be %q or %q", roleTypeJWT, roleTypeOIDC)), nil
+	}
+	if role.BoundClaimsType != claimTypeString && role.BoundClaimsType != claimTypeGlob {
+		return logical.ErrorResponse(fmt.Sprintf("bound_claims_type must be %q or %q", claimTypeString, claimTypeGlob)), nil
+	}
+	if err := validateBoundClaims(role.BoundClaims); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	for claim, key := range role.ClaimMappings {
+		if key == "" || key == "role" {
+			return logical.ErrorResponse(fmt.Sprintf("invalid metadata key %q for claim %q", key, claim)), nil
+		}
+	}
+	if role.MaxTTL > 0 && role.TTL > role.MaxTTL {
+		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	}
+	if role.Period > b.System().MaxLeaseTTL() {
+		return logical.ErrorResponse("period cannot be greater than the mount's maximum TTL"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("role/"+name, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// validateBoundClaims checks that the bound values are strings, or lists
+// of strings
+func validateBoundClaims(boundClaims map[string]interface{}) error {
+	for claim, value := range boundClaims {
+		switch value := value.(type) {
+		case string:
+		case []interface{}:
+			for _, v := range value {
+				if _, ok := v.(string); !ok {
+					return fmt.Errorf("bound claim %q must be a string or a list of strings", claim)
+				}
+			}
+		default:
+			return fmt.Errorf("bound claim %q must be a string or a list of strings", claim)
+		}
+	}
+	if _, ok := boundClaims[""]; ok {
+		return errors.New("bound_claims contains an empty claim")
+	}
+	return nil
+}
+
+// jwtRole binds the claims of JWTs to policies
+type jwtRole struct {
+	RoleType            string                 `json:"role_type"`
+	AllowedRedirectURIs []string               `json:"allowed_redirect_uris"`
+	OIDCScopes          []string               `json:"oidc_scopes"`
+	BoundAudiences      []string               `json:"bound_audiences"`
+	BoundSubject        string                 `json:"bound_subject"`
+	BoundClaims         map[string]interface{} `json:"bound_claims"`
+	BoundClaimsType     string                 `json:"bound_claims_type"`
+	ClaimMappings       map[string]string      `json:"claim_mappings"`
+	UserClaim           string                 `json:"user_claim"`
+	GroupsClaim         string                 `json:"groups_claim"`
+	Policies            []string               `json:"policies"`
+	TTL                 time.Duration          `json:"ttl"`
+	MaxTTL              time.Duration          `json:"max_ttl"`
+	Period              time.Duration          `json:"period"`
+}
+
+// boundAudiences returns the audiences the JWTs must have. The ID tokens of
+// OIDC logins are issued for the client ID of Vault by default.
+func (r *jwtRole) boundAudiences(config *jwtConfig) []string {
+	if len(r.BoundAudiences) == 0 && r.RoleType == roleTypeOIDC {
+		return []string{config.OIDCClientID}
+	}
+	return r.BoundAudiences
+}
+
+const pathRoleHelpSyn = `
+Manage the roles binding JWTs to policies.
+`
+
+const pathRoleHelpDesc = `
+A role allows the JWTs matching its bound audiences, subject and claims to
+log in and obtain tokens with its policies. At least one of these bindings
+must be set.
+
+The "user_claim" identifies the user, and "claim_mappings" copies claims into
+the metadata of the tokens. With "groups_claim", the groups listed in the JWT
+are resolved to the external groups of the mount.
+
+Roles of the "oidc" type log users in through the authorization code flow of
+the OIDC provider, redirecting them to one of the "allowed_redirect_uris".
+Their ID tokens must be issued for the client ID of Vault, unless
+"bound_audiences" is set.
+`
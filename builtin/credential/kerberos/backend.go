@@ -0,0 +1,94 @@
+package kerberos
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/credential/ldap"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	b := Backend()
+	if _, err := b.ldap.Setup(conf); err != nil {
+		return nil, err
+	}
+	return b.Setup(conf)
+}
+
+func Backend() *backend {
+	l := ldap.Backend()
+	b := &backend{
+		ldap:    l,
+		replays: make(map[string]time.Time),
+	}
+	b.Backend = &framework.Backend{
+		Help: backendHelp,
+
+		PathsSpecial: &logical.Paths{
+			Unauthenticated: []string{
+				"login",
+			},
+		},
+
+		Paths: append([]*framework.Path{
+			pathConfig(b),
+			pathLogin(b),
+		}, ldapPaths(l.Paths)...),
+
+		AuthRenew: b.pathLoginRenew,
+	}
+
+	return b
+}
+
+type backend struct {
+	*framework.Backend
+
+	// ldap is the LDAP backend looking up the groups of the users, whose
+	// storage is under "ldap/"
+	ldap ldapBackend
+
+	// replays holds the expiration of the authenticators used to log in,
+	// which cannot be used again
+	replaysLock sync.Mutex
+	replays     map[string]time.Time
+}
+
+// ldapBackend is implemented by the backend of the ldap package
+type ldapBackend interface {
+	Setup(*logical.BackendConfig) (logical.Backend, error)
+	Lookup(*logical.Request, string) ([]string, []string, string, *logical.Response, error)
+}
+
+// checkReplay records the authenticator of a login, returning an error if it
+// was already used
+func (b *backend) checkReplay(auth *clientAuthentication, now time.Time) error {
+	b.replaysLock.Lock()
+	defer b.replaysLock.Unlock()
+
+	for key, expiration := range b.replays {
+		if now.After(expiration) {
+			delete(b.replays, key)
+		}
+	}
+
+	key := fmt.Sprintf("%s %d %d", auth.Principal, auth.CTime.Unix(), auth.CUSec)
+	if _, ok := b.replays[key]; ok {
+		return fmt.Errorf("replayed authenticator of %s", auth.Principal)
+	}
+	b.replays[key] = auth.CTime.Add(maxClockSkew)
+
+	return nil
+}
+
+const backendHelp = `
+The Kerberos credential provider allows authentication with SPNEGO tokens,
+as sent by browsers and clients in "Authorization: Negotiate" headers.
+
+The Kerberos tickets of the tokens are verified with the keys of a keytab of
+the service principal of Vault. The groups of the users are looked up in LDAP,
+such as Active Directory, and mapped to policies.
+`
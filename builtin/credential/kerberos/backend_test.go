@@ -0,0 +1,361 @@
+package kerberos
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestNFold(t *testing.T) {
+	// Test vectors of RFC 3961 appendix A.1
+	cases := []struct {
+		bits     int
+		input    string
+		expected string
+	}{
+		{64, "012345", "be072631276b1955"},
+		{56, "password", "78a07b6caf85fa"},
+		{64, "Rough Consensus, and Running Code", "bb6ed30870b7f0e0"},
+		{168, "password", "59e4a8ca7c0385c3c37b3f6d2000247cb6e6bd5b3e"},
+		{192, "MASSACHVSETTS INSTITVTE OF TECHNOLOGY", "db3b0d8f0b061e603282b308a50841229ad798fab9540c1b"},
+		{168, "Q", "518a54a215a8452a518a54a215a8452a518a54a215"},
+		{64, "kerberos", "6b65726265726f73"},
+		{128, "kerberos", "6b65726265726f737b9b5b2b93132b93"},
+		{256, "kerberos", "6b65726265726f737b9b5b2b93132b935c9bdcdad95c9899c4cae4dee6d6cae4"},
+	}
+	for _, c := range cases {
+		if actual := hex.EncodeToString(nfold([]byte(c.input), c.bits/8)); actual != c.expected {
+			t.Fatalf("%d-fold(%q): expected %s, got %s", c.bits, c.input, c.expected, actual)
+		}
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	// The string-to-key test vectors of RFC 3962 appendix B with 1 iteration,
+	// whose keys are derived from the PBKDF2 output
+	cases := []struct {
+		size     int
+		expected string
+	}{
+		{16, "42263c6e89f4fc28b8df68ee09799f15"},
+		{32, "fe697b52bc0d3ce14432ba036a92e65bbb52280990a2fa27883998d72af30161"},
+	}
+	for _, c := range cases {
+		tkey := pbkdf2SHA1([]byte("password"), []byte("ATHENA.MIT.EDUraeburn"), c.size)
+		key, err := deriveKey(tkey, []byte("kerberos"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := hex.EncodeToString(key); actual != c.expected {
+			t.Fatalf("expected %s, got %s", c.expected, actual)
+		}
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	for _, etype := range []int32{etypeAES128CTSHMACSHA196, etypeAES256CTSHMACSHA196, etypeRC4HMAC} {
+		key := testKey(t, etype)
+		for size := 0; size <= 40; size++ {
+			plaintext := make([]byte, size)
+			rand.Read(plaintext)
+
+			ciphertext, err := encrypt(etype, key, keyUsageTicket, plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decrypted, err := decrypt(etype, key, keyUsageTicket, ciphertext)
+			if err != nil {
+				t.Fatalf("etype %d, size %d: %v", etype, size, err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Fatalf("etype %d, size %d: bad plaintext", etype, size)
+			}
+
+			if _, err := decrypt(etype, key, keyUsageAuthenticator, ciphertext); err != errIntegrity {
+				t.Fatalf("etype %d, size %d: expected an integrity error with another key usage, got %v", etype, size, err)
+			}
+		}
+	}
+}
+
+func TestParseKeytab(t *testing.T) {
+	entries := []*keytabEntry{
+		&keytabEntry{Principal: parsePrincipalName("HTTP/vault.example.com@EXAMPLE.COM"), KVNO: 2, EType: etypeAES256CTSHMACSHA196, Key: testKey(t, etypeAES256CTSHMACSHA196)},
+		&keytabEntry{Principal: parsePrincipalName("HTTP/vault.example.com@EXAMPLE.COM"), KVNO: 3, EType: etypeAES256CTSHMACSHA196, Key: testKey(t, etypeAES256CTSHMACSHA196)},
+		&keytabEntry{Principal: parsePrincipalName("HTTP/vault.example.com@EXAMPLE.COM"), KVNO: 3, EType: etypeRC4HMAC, Key: testKey(t, etypeRC4HMAC)},
+	}
+	kt, err := parseKeytab(marshalKeytab(entries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(kt.Entries, entries) {
+		t.Fatalf("bad: %#v", kt.Entries)
+	}
+
+	service := parsePrincipalName("HTTP/vault.example.com")
+	if key := kt.Key(service, etypeAES256CTSHMACSHA196, 0); key != kt.Entries[1] {
+		t.Fatalf("expected the latest key, got %#v", key)
+	}
+	if key := kt.Key(service, etypeAES256CTSHMACSHA196, 2); key != kt.Entries[0] {
+		t.Fatalf("expected the key of version 2, got %#v", key)
+	}
+	if key := kt.Key(parsePrincipalName("HTTP/vault.example.com@OTHER.COM"), etypeRC4HMAC, 0); key != nil {
+		t.Fatalf("expected no key of another realm, got %#v", key)
+	}
+
+	if _, err := parseKeytab([]byte{0x05, 0x01}); err == nil {
+		t.Fatal("expected an error for keytab version 1")
+	}
+}
+
+func TestBackend_Login(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(&logical.Request{
+			Operation: op,
+			Path:      path,
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+	}
+
+	service := parsePrincipalName("HTTP/vault.example.com@EXAMPLE.COM")
+	key := testKey(t, etypeAES256CTSHMACSHA196)
+	kt := marshalKeytab([]*keytabEntry{
+		&keytabEntry{Principal: service, KVNO: 1, EType: etypeAES256CTSHMACSHA196, Key: key},
+	})
+
+	resp, err := request(logical.UpdateOperation, "config", map[string]interface{}{
+		"keytab":          base64.StdEncoding.EncodeToString(kt),
+		"service_account": "HTTP/other.example.com",
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for a service account not in the keytab: %v %#v", err, resp)
+	}
+	resp, err = request(logical.UpdateOperation, "config", map[string]interface{}{
+		"keytab":          base64.StdEncoding.EncodeToString(kt),
+		"service_account": "HTTP/vault.example.com",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+
+	// The LDAP configuration and groups are stored under "ldap/"
+	resp, err = request(logical.UpdateOperation, "config/ldap", map[string]interface{}{
+		"url":    "ldap://127.0.0.1:1",
+		"userdn": "ou=users,dc=example,dc=com",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+	resp, err = request(logical.UpdateOperation, "groups/admins", map[string]interface{}{
+		"policies": "admin",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+	keys, err := config.StorageView.List("ldap/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"config", "group/"}) {
+		t.Fatalf("bad: %#v", keys)
+	}
+	resp, err = request(logical.ReadOperation, "config/ldap", nil)
+	if err != nil || resp.Data["url"] != "ldap://127.0.0.1:1" {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+
+	login := func(token []byte) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "login",
+			Storage:   config.StorageView,
+			Headers: map[string][]string{
+				"Authorization": []string{"Negotiate " + base64.StdEncoding.EncodeToString(token)},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("expected an error response, got %#v", resp)
+		}
+		return resp
+	}
+	expectError := func(resp *logical.Response, message string) {
+		if !strings.Contains(resp.Data["error"].(string), message) {
+			t.Fatalf("expected an error containing %q, got %q", message, resp.Data["error"])
+		}
+	}
+
+	now := time.Now()
+	client := parsePrincipalName("alice@EXAMPLE.COM")
+	token := testNegotiateToken(t, service, key, etypeAES256CTSHMACSHA196, client, now, now)
+
+	// The ticket is verified before the user is looked up in LDAP, which is
+	// unreachable
+	expectError(login(token), "error connecting to host")
+	expectError(login(token), "replayed authenticator")
+
+	token = testNegotiateToken(t, service, testKey(t, etypeAES256CTSHMACSHA196), etypeAES256CTSHMACSHA196, client, now, now)
+	expectError(login(token), "error decrypting the ticket")
+
+	token = testNegotiateToken(t, parsePrincipalName("HTTP/other.example.com@EXAMPLE.COM"), key, etypeAES256CTSHMACSHA196, client, now, now)
+	expectError(login(token), "ticket is for HTTP/other.example.com@EXAMPLE.COM")
+
+	token = testNegotiateToken(t, service, key, etypeAES256CTSHMACSHA196, client, now.Add(-2*time.Hour), now)
+	expectError(login(token), "ticket has expired")
+
+	token = testNegotiateToken(t, service, key, etypeAES256CTSHMACSHA196, client, now, now.Add(-10*time.Minute))
+	expectError(login(token), "clock skew too great")
+
+	expectError(login([]byte("NTLMSSP\x00\x01\x00\x00\x00")), "NTLM is not supported")
+}
+
+func testKey(t *testing.T, etype int32) []byte {
+	size := 16
+	if etype == etypeAES256CTSHMACSHA196 {
+		size = 32
+	}
+	key := make([]byte, size)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// pbkdf2SHA1 is PBKDF2 with HMAC-SHA1 and 1 iteration
+func pbkdf2SHA1(password, salt []byte, size int) []byte {
+	var result []byte
+	for i := uint32(1); len(result) < size; i++ {
+		block := make([]byte, 4)
+		binary.BigEndian.PutUint32(block, i)
+		result = append(result, hmacSHA1(password, append(append([]byte{}, salt...), block...))...)
+	}
+	return result[:size]
+}
+
+func marshalKeytab(entries []*keytabEntry) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0x05, 0x02})
+
+	// A deleted entry
+	binary.Write(&buf, binary.BigEndian, int32(-4))
+	buf.Write(make([]byte, 4))
+
+	for _, entry := range entries {
+		var e bytes.Buffer
+		writeString := func(s string) {
+			binary.Write(&e, binary.BigEndian, uint16(len(s)))
+			e.WriteString(s)
+		}
+		binary.Write(&e, binary.BigEndian, uint16(len(entry.Principal.Components)))
+		writeString(entry.Principal.Realm)
+		for _, component := range entry.Principal.Components {
+			writeString(component)
+		}
+		binary.Write(&e, binary.BigEndian, uint32(1))
+		binary.Write(&e, binary.BigEndian, uint32(time.Now().Unix()))
+		e.WriteByte(uint8(entry.KVNO))
+		binary.Write(&e, binary.BigEndian, uint16(entry.EType))
+		binary.Write(&e, binary.BigEndian, uint16(len(entry.Key)))
+		e.Write(entry.Key)
+		binary.Write(&e, binary.BigEndian, entry.KVNO)
+
+		binary.Write(&buf, binary.BigEndian, int32(e.Len()))
+		buf.Write(e.Bytes())
+	}
+	return buf.Bytes()
+}
+
+// testNegotiateToken returns a SPNEGO token with a ticket of the client for
+// the service, issued at authTime and valid for an hour, and an
+// authenticator created at ctime
+func testNegotiateToken(t *testing.T, service principalName, serviceKey []byte, etype int32, client principalName, authTime, ctime time.Time) []byte {
+	marshal := func(v interface{}) []byte {
+		b, err := asn1.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	wrap := func(class, tag int, b []byte) []byte {
+		return marshal(asn1.RawValue{Class: class, Tag: tag, IsCompound: true, Bytes: b})
+	}
+	generalString := func(s string) asn1.RawValue {
+		return asn1.RawValue{Tag: 27, Bytes: []byte(s)}
+	}
+	// encoding/asn1 ignores the explicit tags of raw values when marshaling
+	explicit := func(tag int, v asn1.RawValue) asn1.RawValue {
+		return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: marshal(v)}
+	}
+	rawName := func(p principalName) rawPrincipal {
+		name := rawPrincipal{NameType: 1}
+		for _, component := range p.Components {
+			name.NameString = append(name.NameString, generalString(component))
+		}
+		return name
+	}
+	seal := func(etype int32, key []byte, usage uint32, plaintext []byte) encryptedData {
+		ciphertext, err := encrypt(etype, key, usage, plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encryptedData{EType: etype, KVNO: 1, Cipher: ciphertext}
+	}
+
+	sessionKey := testKey(t, etypeAES128CTSHMACSHA196)
+	encPart := wrap(asn1.ClassApplication, 3, marshal(encTicketPart{
+		Flags:     asn1.BitString{Bytes: []byte{0, 0, 0, 0}, BitLength: 32},
+		Key:       encryptionKey{KeyType: etypeAES128CTSHMACSHA196, KeyValue: sessionKey},
+		CRealm:    explicit(2, generalString(client.Realm)),
+		CName:     rawName(client),
+		Transited: explicit(4, asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true}),
+		AuthTime:  authTime.UTC().Truncate(time.Second),
+		EndTime:   authTime.Add(time.Hour).UTC().Truncate(time.Second),
+	}))
+	tkt := wrap(asn1.ClassApplication, 1, marshal(ticket{
+		TktVNO:  5,
+		Realm:   explicit(1, generalString(service.Realm)),
+		SName:   rawName(service),
+		EncPart: seal(etype, serviceKey, keyUsageTicket, encPart),
+	}))
+
+	auth := wrap(asn1.ClassApplication, 2, marshal(authenticator{
+		AuthenticatorVNO: 5,
+		CRealm:           explicit(1, generalString(client.Realm)),
+		CName:            rawName(client),
+		CUSec:            ctime.Nanosecond() / 1000,
+		CTime:            ctime.UTC().Truncate(time.Second),
+	}))
+	req := wrap(asn1.ClassApplication, 14, marshal(apReq{
+		PVNO:          5,
+		MsgType:       14,
+		APOptions:     asn1.BitString{Bytes: []byte{0, 0, 0, 0}, BitLength: 32},
+		Ticket:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 3, IsCompound: true, Bytes: tkt},
+		Authenticator: seal(etypeAES128CTSHMACSHA196, sessionKey, keyUsageAuthenticator, auth),
+	}))
+
+	mechToken := wrap(asn1.ClassApplication, 0, append(append(marshal(oidKerberos), 0x01, 0x00), req...))
+	init := wrap(asn1.ClassContextSpecific, 0, marshal(negTokenInit{
+		MechTypes: []asn1.ObjectIdentifier{oidMSKerberos, oidKerberos},
+		MechToken: mechToken,
+	}))
+	return wrap(asn1.ClassApplication, 0, append(marshal(oidSPNEGO), init...))
+}
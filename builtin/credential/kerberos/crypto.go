@@ -0,0 +1,328 @@
+package kerberos
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Encryption types of RFC 3962 and RFC 4757
+const (
+	etypeAES128CTSHMACSHA196 = 17
+	etypeAES256CTSHMACSHA196 = 18
+	etypeRC4HMAC             = 23
+)
+
+// Key usages of RFC 4120
+const (
+	keyUsageTicket        = 2
+	keyUsageAuthenticator = 11
+)
+
+const aesHMACSize = 12
+
+var errIntegrity = errors.New("integrity check failed")
+
+// decrypt decrypts the ciphertext of an EncryptedData with the key of the
+// encryption type and the key usage
+func decrypt(etype int32, key []byte, usage uint32, ciphertext []byte) ([]byte, error) {
+	switch etype {
+	case etypeAES128CTSHMACSHA196, etypeAES256CTSHMACSHA196:
+		return decryptAES(key, usage, ciphertext)
+	case etypeRC4HMAC:
+		return decryptRC4(key, usage, ciphertext)
+	default:
+		return nil, fmt.Errorf("unsupported encryption type %d", etype)
+	}
+}
+
+// encrypt encrypts the plaintext of an EncryptedData with the key of the
+// encryption type and the key usage
+func encrypt(etype int32, key []byte, usage uint32, plaintext []byte) ([]byte, error) {
+	switch etype {
+	case etypeAES128CTSHMACSHA196, etypeAES256CTSHMACSHA196:
+		return encryptAES(key, usage, plaintext)
+	case etypeRC4HMAC:
+		return encryptRC4(key, usage, plaintext)
+	default:
+		return nil, fmt.Errorf("unsupported encryption type %d", etype)
+	}
+}
+
+// aesUsageKeys derives the encryption and integrity keys of the key usage, as
+// described in RFC 3961 section 5.3
+func aesUsageKeys(key []byte, usage uint32) ([]byte, []byte, error) {
+	constant := make([]byte, 5)
+	binary.BigEndian.PutUint32(constant, usage)
+
+	constant[4] = 0xaa
+	ke, err := deriveKey(key, constant)
+	if err != nil {
+		return nil, nil, err
+	}
+	constant[4] = 0x55
+	ki, err := deriveKey(key, constant)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ke, ki, nil
+}
+
+func decryptAES(key []byte, usage uint32, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < aes.BlockSize+aesHMACSize {
+		return nil, errors.New("ciphertext too short")
+	}
+	ke, ki, err := aesUsageKeys(key, usage)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, mac := ciphertext[:len(ciphertext)-aesHMACSize], ciphertext[len(ciphertext)-aesHMACSize:]
+	plaintext, err := decryptCTS(ke, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(mac, hmacSHA1(ki, plaintext)[:aesHMACSize]) {
+		return nil, errIntegrity
+	}
+
+	// Remove the confounder
+	return plaintext[aes.BlockSize:], nil
+}
+
+func encryptAES(key []byte, usage uint32, plaintext []byte) ([]byte, error) {
+	ke, ki, err := aesUsageKeys(key, usage)
+	if err != nil {
+		return nil, err
+	}
+
+	confounded := make([]byte, aes.BlockSize, aes.BlockSize+len(plaintext))
+	if _, err := rand.Read(confounded); err != nil {
+		return nil, err
+	}
+	confounded = append(confounded, plaintext...)
+
+	ciphertext, err := encryptCTS(ke, confounded)
+	if err != nil {
+		return nil, err
+	}
+	return append(ciphertext, hmacSHA1(ki, confounded)[:aesHMACSize]...), nil
+}
+
+// deriveKey is the DK function of RFC 3961 for the AES encryption types,
+// whose random-to-key function is the identity
+func deriveKey(key, constant []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	derived := make([]byte, 0, len(key)+aes.BlockSize)
+	input := nfold(constant, aes.BlockSize)
+	for len(derived) < len(key) {
+		output := make([]byte, aes.BlockSize)
+		block.Encrypt(output, input)
+		derived = append(derived, output...)
+		input = output
+	}
+	return derived[:len(key)], nil
+}
+
+// nfold is the n-fold function of RFC 3961 section 5.1, folding the input to
+// size bytes
+func nfold(input []byte, size int) []byte {
+	inBits := len(input) * 8
+	outBits := size * 8
+	lcm := inBits * outBits / gcd(inBits, outBits)
+
+	// Concatenate copies of the input, each rotated 13 bits to the right of
+	// the previous one
+	replicated := make([]byte, 0, lcm/8)
+	for i := 0; i < lcm/inBits; i++ {
+		replicated = append(replicated, rotateRight(input, 13*i)...)
+	}
+
+	// Add the chunks of the output size with one's complement addition
+	result := make([]byte, size)
+	for i := 0; i < len(replicated); i += size {
+		carry := 0
+		for j := size - 1; j >= 0; j-- {
+			sum := int(result[j]) + int(replicated[i+j]) + carry
+			result[j] = byte(sum)
+			carry = sum >> 8
+		}
+		for carry != 0 {
+			for j := size - 1; j >= 0 && carry != 0; j-- {
+				sum := int(result[j]) + carry
+				result[j] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return result
+}
+
+func rotateRight(input []byte, bits int) []byte {
+	size := len(input) * 8
+	output := make([]byte, len(input))
+	for i := 0; i < size; i++ {
+		if input[i/8]&(0x80>>uint(i%8)) != 0 {
+			j := (i + bits) % size
+			output[j/8] |= 0x80 >> uint(j%8)
+		}
+	}
+	return output
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// decryptCTS decrypts AES in CBC mode with ciphertext stealing and a zero
+// initialization vector, as described in RFC 3962 section 5
+func decryptCTS(key, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aes.BlockSize {
+		return nil, errors.New("ciphertext too short")
+	}
+	iv := make([]byte, aes.BlockSize)
+	if len(ciphertext) == aes.BlockSize {
+		plaintext := make([]byte, aes.BlockSize)
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+		return plaintext, nil
+	}
+
+	// The last two blocks are swapped, and the last one is truncated to the
+	// size of the last block of the plaintext
+	n := (len(ciphertext) + aes.BlockSize - 1) / aes.BlockSize
+	last := len(ciphertext) - (n-1)*aes.BlockSize
+
+	plaintext := make([]byte, len(ciphertext))
+	head := ciphertext[:(n-2)*aes.BlockSize]
+	if len(head) > 0 {
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, head)
+		iv = head[len(head)-aes.BlockSize:]
+	}
+
+	swapped := ciphertext[(n-2)*aes.BlockSize : (n-1)*aes.BlockSize]
+	stolen := ciphertext[(n-1)*aes.BlockSize:]
+
+	decrypted := make([]byte, aes.BlockSize)
+	block.Decrypt(decrypted, swapped)
+	penultimate := make([]byte, aes.BlockSize)
+	copy(penultimate, stolen)
+	copy(penultimate[last:], decrypted[last:])
+
+	for i := 0; i < last; i++ {
+		plaintext[(n-1)*aes.BlockSize+i] = decrypted[i] ^ stolen[i]
+	}
+	block.Decrypt(plaintext[(n-2)*aes.BlockSize:], penultimate)
+	for i := 0; i < aes.BlockSize; i++ {
+		plaintext[(n-2)*aes.BlockSize+i] ^= iv[i]
+	}
+	return plaintext, nil
+}
+
+// encryptCTS encrypts AES in CBC mode with ciphertext stealing and a zero
+// initialization vector
+func encryptCTS(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(plaintext) < aes.BlockSize {
+		return nil, errors.New("plaintext too short")
+	}
+
+	n := (len(plaintext) + aes.BlockSize - 1) / aes.BlockSize
+	last := len(plaintext) - (n-1)*aes.BlockSize
+
+	padded := make([]byte, n*aes.BlockSize)
+	copy(padded, plaintext)
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(padded, padded)
+	if n == 1 {
+		return padded, nil
+	}
+
+	ciphertext := make([]byte, 0, len(plaintext))
+	ciphertext = append(ciphertext, padded[:(n-2)*aes.BlockSize]...)
+	ciphertext = append(ciphertext, padded[(n-1)*aes.BlockSize:]...)
+	return append(ciphertext, padded[(n-2)*aes.BlockSize:(n-2)*aes.BlockSize+last]...), nil
+}
+
+// rc4UsageKey derives the key of the key usage, as described in RFC 4757
+func rc4UsageKey(key []byte, usage uint32) []byte {
+	// The key usage of AS-REP encrypted parts is translated
+	if usage == 3 {
+		usage = 8
+	}
+	salt := make([]byte, 4)
+	binary.LittleEndian.PutUint32(salt, usage)
+	return hmacMD5(key, salt)
+}
+
+func decryptRC4(key []byte, usage uint32, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < md5.Size+8 {
+		return nil, errors.New("ciphertext too short")
+	}
+	k1 := rc4UsageKey(key, usage)
+
+	checksum := ciphertext[:md5.Size]
+	c, err := rc4.NewCipher(hmacMD5(k1, checksum))
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext)-md5.Size)
+	c.XORKeyStream(plaintext, ciphertext[md5.Size:])
+
+	if !hmac.Equal(checksum, hmacMD5(k1, plaintext)) {
+		return nil, errIntegrity
+	}
+
+	// Remove the confounder
+	return plaintext[8:], nil
+}
+
+func encryptRC4(key []byte, usage uint32, plaintext []byte) ([]byte, error) {
+	k1 := rc4UsageKey(key, usage)
+
+	confounded := make([]byte, 8, 8+len(plaintext))
+	if _, err := rand.Read(confounded); err != nil {
+		return nil, err
+	}
+	confounded = append(confounded, plaintext...)
+
+	checksum := hmacMD5(k1, confounded)
+	c, err := rc4.NewCipher(hmacMD5(k1, checksum))
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := make([]byte, len(confounded))
+	c.XORKeyStream(ciphertext, confounded)
+	return append(checksum, ciphertext...), nil
+}
+
+func hmacSHA1(key, data []byte) []byte {
+	h := hmac.New(sha1.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func hmacMD5(key, data []byte) []byte {
+	h := hmac.New(md5.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
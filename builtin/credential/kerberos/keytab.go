@@ -0,0 +1,206 @@
+package kerberos
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// keytab is a parsed keytab file, holding the keys of service principals
+type keytab struct {
+	Entries []*keytabEntry
+}
+
+type keytabEntry struct {
+	Principal principalName
+	KVNO      uint32
+	EType     int32
+	Key       []byte
+}
+
+// principalName is the name of a Kerberos principal: its components, such as
+// "HTTP" and "vault.example.com", and its realm
+type principalName struct {
+	Components []string
+	Realm      string
+}
+
+// parsePrincipalName parses a principal such as "HTTP/vault.example.com" or
+// "HTTP/vault.example.com@EXAMPLE.COM"
+func parsePrincipalName(s string) principalName {
+	var name principalName
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		s, name.Realm = s[:i], s[i+1:]
+	}
+	name.Components = strings.Split(s, "/")
+	return name
+}
+
+// Name returns the principal without its realm
+func (p principalName) Name() string {
+	return strings.Join(p.Components, "/")
+}
+
+func (p principalName) String() string {
+	return p.Name() + "@" + p.Realm
+}
+
+// Matches returns whether the principal is the other one, whose realm is
+// ignored if empty
+func (p principalName) Matches(other principalName) bool {
+	if other.Realm != "" && other.Realm != p.Realm {
+		return false
+	}
+	return p.Name() == other.Name()
+}
+
+// parseKeytab parses a keytab file of version 2, as written by ktutil and
+// ktpass
+func parseKeytab(data []byte) (*keytab, error) {
+	if len(data) < 2 || data[0] != 0x05 {
+		return nil, errors.New("invalid keytab file")
+	}
+	if data[1] != 0x02 {
+		return nil, fmt.Errorf("unsupported keytab version %d", data[1])
+	}
+
+	kt := &keytab{}
+	r := &keytabReader{data: data[2:]}
+	for len(r.data) > 0 {
+		size := int32(r.uint32())
+		if r.err != nil {
+			break
+		}
+		// Deleted entries are holes of the opposite size
+		if size < 0 {
+			r.skip(int(-size))
+			continue
+		}
+		if size == 0 {
+			break
+		}
+
+		entry := &keytabReader{data: r.bytes(int(size))}
+		if r.err != nil {
+			break
+		}
+		kt.Entries = append(kt.Entries, entry.entry())
+		if entry.err != nil {
+			return nil, entry.err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(kt.Entries) == 0 {
+		return nil, errors.New("keytab file has no keys")
+	}
+
+	return kt, nil
+}
+
+// Key returns the key of the principal for the encryption type and key
+// version, or for the latest version if kvno is 0
+func (kt *keytab) Key(principal principalName, etype int32, kvno uint32) *keytabEntry {
+	var result *keytabEntry
+	for _, entry := range kt.Entries {
+		if entry.EType != etype || !entry.Principal.Matches(principal) {
+			continue
+		}
+		if kvno != 0 && entry.KVNO == kvno {
+			return entry
+		}
+		if kvno == 0 && (result == nil || entry.KVNO > result.KVNO) {
+			result = entry
+		}
+	}
+	return result
+}
+
+// Has returns whether the keytab has keys of the principal
+func (kt *keytab) Has(principal principalName) bool {
+	for _, entry := range kt.Entries {
+		if entry.Principal.Matches(principal) {
+			return true
+		}
+	}
+	return false
+}
+
+// keytabReader reads the big endian fields of keytab entries, recording the
+// first error
+type keytabReader struct {
+	data []byte
+	err  error
+}
+
+func (r *keytabReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data) {
+		r.err = errors.New("truncated keytab file")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *keytabReader) skip(n int) {
+	r.bytes(n)
+}
+
+func (r *keytabReader) uint8() uint8 {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *keytabReader) uint16() uint16 {
+	b := r.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+func (r *keytabReader) uint32() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *keytabReader) string() string {
+	return string(r.bytes(int(r.uint16())))
+}
+
+func (r *keytabReader) entry() *keytabEntry {
+	entry := &keytabEntry{}
+
+	count := int(r.uint16())
+	entry.Principal.Realm = r.string()
+	for i := 0; i < count; i++ {
+		entry.Principal.Components = append(entry.Principal.Components, r.string())
+	}
+
+	// Name type and timestamp
+	r.skip(8)
+
+	entry.KVNO = uint32(r.uint8())
+	entry.EType = int32(r.uint16())
+	entry.Key = r.bytes(int(r.uint16()))
+
+	// The 32-bit key version supersedes the 8-bit one if present
+	if len(r.data) >= 4 {
+		if kvno := r.uint32(); kvno != 0 {
+			entry.KVNO = kvno
+		}
+	}
+	return entry
+}
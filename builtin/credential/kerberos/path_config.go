@@ -0,0 +1,141 @@
+package kerberos
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `config`,
+		Fields: map[string]*framework.FieldSchema{
+			"keytab": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Keytab file of the service principal, encoded in base64.",
+			},
+			"service_account": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Service principal of Vault in the keytab, such as "HTTP/vault.example.com".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+// Config returns the configuration of the backend
+func (b *backend) Config(s logical.Storage) (*kerberosConfig, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result kerberosConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	// The keytab is not returned
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"service_account": config.ServiceAccount,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &kerberosConfig{}
+	}
+
+	if v, ok := d.GetOk("keytab"); ok {
+		config.Keytab = v.(string)
+	}
+	if v, ok := d.GetOk("service_account"); ok {
+		config.ServiceAccount = v.(string)
+	}
+
+	switch {
+	case config.Keytab == "":
+		return logical.ErrorResponse("keytab is required"), nil
+	case config.ServiceAccount == "":
+		return logical.ErrorResponse("service_account is required"), nil
+	}
+
+	kt, err := config.parseKeytab()
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if !kt.Has(parsePrincipalName(config.ServiceAccount)) {
+		return logical.ErrorResponse(fmt.Sprintf("keytab has no keys of %q", config.ServiceAccount)), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// kerberosConfig is the configuration of the backend
+type kerberosConfig struct {
+	Keytab         string `json:"keytab"`
+	ServiceAccount string `json:"service_account"`
+}
+
+func (c *kerberosConfig) parseKeytab() (*keytab, error) {
+	data, err := base64.StdEncoding.DecodeString(c.Keytab)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding the keytab: %s", err)
+	}
+	return parseKeytab(data)
+}
+
+const pathConfigHelpSyn = `
+Configures the keytab verifying the Kerberos tickets of the logins.
+`
+
+const pathConfigHelpDesc = `
+The Kerberos backend accepts tickets issued for the "service_account", the
+service principal of Vault, such as "HTTP/vault.example.com" for the Vault
+server at https://vault.example.com. The "keytab" is a keytab file with the
+keys of the service principal, encoded in base64, as exported with ktutil or
+with ktpass for an Active Directory service account.
+
+The supported encryption types are aes256-cts-hmac-sha1-96,
+aes128-cts-hmac-sha1-96 and rc4-hmac.
+`
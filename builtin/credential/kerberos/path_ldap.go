@@ -0,0 +1,86 @@
+package kerberos
+
+import (
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// ldapPathPatterns maps the patterns of the paths of the LDAP backend served
+// by this backend to their patterns here
+var ldapPathPatterns = map[string]string{
+	`config`:              `config/ldap`,
+	"groups/?$":           "groups/?$",
+	`groups/(?P<name>.+)`: `groups/(?P<name>.+)`,
+	"users/?$":            "users/?$",
+	`users/(?P<name>.+)`:  `users/(?P<name>.+)`,
+}
+
+// ldapPaths returns the paths of the LDAP backend configuring the LDAP
+// server and the policies of the groups and users, which are served with the
+// storage of the LDAP backend
+func ldapPaths(paths []*framework.Path) []*framework.Path {
+	var result []*framework.Path
+	for _, p := range paths {
+		pattern, ok := ldapPathPatterns[p.Pattern]
+		if !ok {
+			continue
+		}
+
+		path := *p
+		path.Pattern = pattern
+		path.Callbacks = make(map[logical.Operation]framework.OperationFunc, len(p.Callbacks))
+		for op, callback := range p.Callbacks {
+			path.Callbacks[op] = ldapCallback(callback)
+		}
+		result = append(result, &path)
+	}
+	return result
+}
+
+func ldapCallback(callback framework.OperationFunc) framework.OperationFunc {
+	return func(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		return callback(ldapRequest(req), d)
+	}
+}
+
+// ldapRequest returns a copy of the request with the storage of the LDAP
+// backend
+func ldapRequest(req *logical.Request) *logical.Request {
+	r := *req
+	r.Storage = &ldapStorage{req.Storage}
+	return &r
+}
+
+// ldapStorage stores the configuration, groups and users of the LDAP backend
+// under "ldap/"
+type ldapStorage struct {
+	logical.Storage
+}
+
+const ldapStoragePrefix = "ldap/"
+
+func (s *ldapStorage) List(prefix string) ([]string, error) {
+	return s.Storage.List(ldapStoragePrefix + prefix)
+}
+
+func (s *ldapStorage) Get(key string) (*logical.StorageEntry, error) {
+	entry, err := s.Storage.Get(ldapStoragePrefix + key)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return &logical.StorageEntry{
+		Key:   key,
+		Value: entry.Value,
+	}, nil
+}
+
+func (s *ldapStorage) Put(entry *logical.StorageEntry) error {
+	return s.Storage.Put(&logical.StorageEntry{
+		Key:   ldapStoragePrefix + entry.Key,
+		Value: entry.Value,
+	})
+}
+
+func (s *ldapStorage) Delete(key string) error {
+	return s.Storage.Delete(ldapStoragePrefix + key)
+}
@@ -0,0 +1,140 @@
+package kerberos
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathLogin(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "login$",
+		Fields: map[string]*framework.FieldSchema{
+			"authorization": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `SPNEGO token, as "Negotiate <base64 token>". Defaults to the Authorization
+header of the request.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLogin,
+		},
+
+		HelpSynopsis:    pathLoginHelpSyn,
+		HelpDescription: pathLoginHelpDesc,
+	}
+}
+
+func (b *backend) pathLogin(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	authorization := d.Get("authorization").(string)
+	if authorization == "" && len(req.Headers["Authorization"]) > 0 {
+		authorization = req.Headers["Authorization"][0]
+	}
+	if !strings.HasPrefix(authorization, "Negotiate ") {
+		return logical.ErrorResponse("missing Negotiate authorization"), nil
+	}
+	token, err := base64.StdEncoding.DecodeString(strings.TrimSpace(strings.TrimPrefix(authorization, "Negotiate ")))
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error decoding the negotiate token: %s", err)), nil
+	}
+
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return logical.ErrorResponse("kerberos backend is not configured"), nil
+	}
+	kt, err := config.parseKeytab()
+	if err != nil {
+		return nil, err
+	}
+
+	apReq, err := parseNegotiateToken(token)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	now := time.Now()
+	client, err := verifyAPReq(apReq, kt, parsePrincipalName(config.ServiceAccount), now)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := b.checkReplay(client, now); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	username := client.Principal.Name()
+	policies, groups, displayName, resp, err := b.ldap.Lookup(ldapRequest(req), username)
+	if err != nil {
+		return nil, err
+	}
+	if resp != nil {
+		if resp.IsError() {
+			return resp, nil
+		}
+	} else {
+		resp = &logical.Response{}
+	}
+
+	sort.Strings(policies)
+
+	resp.Auth = &logical.Auth{
+		Policies:     policies,
+		GroupAliases: groups,
+		Metadata: map[string]string{
+			"username": username,
+			"realm":    client.Principal.Realm,
+			"policies": strings.Join(policies, ","),
+		},
+		DisplayName: displayName,
+		LeaseOptions: logical.LeaseOptions{
+			Renewable: true,
+		},
+	}
+	return resp, nil
+}
+
+func (b *backend) pathLoginRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if req.Auth == nil {
+		return nil, fmt.Errorf("request auth was nil")
+	}
+
+	// The groups of the user are looked up again, as the ticket cannot be
+	// verified again
+	username := req.Auth.Metadata["username"]
+	policies, groups, _, resp, err := b.ldap.Lookup(ldapRequest(req), username)
+	if err != nil || (resp != nil && resp.IsError()) {
+		return resp, err
+	}
+
+	if !policyutil.EquivalentPolicies(policies, req.Auth.Policies) {
+		return nil, fmt.Errorf("policies have changed, not renewing")
+	}
+	if (len(groups) != 0 || len(req.Auth.GroupAliases) != 0) && !strutil.EquivalentSlices(groups, req.Auth.GroupAliases) {
+		return nil, fmt.Errorf("groups have changed, not renewing")
+	}
+
+	return framework.LeaseExtend(0, 0, b.System())(req, d)
+}
+
+const pathLoginHelpSyn = `
+Log in with a SPNEGO token.
+`
+
+const pathLoginHelpDesc = `
+This endpoint authenticates with the SPNEGO token of the "authorization"
+parameter, or of the Authorization header of the request, such as
+"Negotiate YIIC...". The Kerberos ticket of the token must be issued for the
+service principal of the configuration, and its client principal is looked up
+in LDAP for its groups, whose policies are granted.
+`
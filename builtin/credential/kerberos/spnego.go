@@ -0,0 +1,235 @@
+package kerberos
+
+import (
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	oidSPNEGO     = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 2}
+	oidKerberos   = asn1.ObjectIdentifier{1, 2, 840, 113554, 1, 2, 2}
+	oidMSKerberos = asn1.ObjectIdentifier{1, 2, 840, 48018, 1, 2, 2}
+)
+
+// maxClockSkew is the maximum difference between the clocks of clients and
+// of Vault
+const maxClockSkew = 5 * time.Minute
+
+// The ASN.1 messages of RFC 4120 and RFC 4178. Strings are parsed as raw
+// values, as they are GeneralStrings.
+
+type negTokenInit struct {
+	MechTypes   []asn1.ObjectIdentifier `asn1:"explicit,tag:0"`
+	ReqFlags    asn1.BitString          `asn1:"optional,explicit,tag:1"`
+	MechToken   []byte                  `asn1:"optional,explicit,tag:2"`
+	MechListMIC []byte                  `asn1:"optional,explicit,tag:3"`
+}
+
+type apReq struct {
+	PVNO          int            `asn1:"explicit,tag:0"`
+	MsgType       int            `asn1:"explicit,tag:1"`
+	APOptions     asn1.BitString `asn1:"explicit,tag:2"`
+	Ticket        asn1.RawValue  `asn1:"explicit,tag:3"`
+	Authenticator encryptedData  `asn1:"explicit,tag:4"`
+}
+
+type ticket struct {
+	TktVNO  int           `asn1:"explicit,tag:0"`
+	Realm   asn1.RawValue `asn1:"explicit,tag:1"`
+	SName   rawPrincipal  `asn1:"explicit,tag:2"`
+	EncPart encryptedData `asn1:"explicit,tag:3"`
+}
+
+type encryptedData struct {
+	EType  int32  `asn1:"explicit,tag:0"`
+	KVNO   int    `asn1:"optional,explicit,tag:1"`
+	Cipher []byte `asn1:"explicit,tag:2"`
+}
+
+type encryptionKey struct {
+	KeyType  int32  `asn1:"explicit,tag:0"`
+	KeyValue []byte `asn1:"explicit,tag:1"`
+}
+
+type rawPrincipal struct {
+	NameType   int32           `asn1:"explicit,tag:0"`
+	NameString []asn1.RawValue `asn1:"explicit,tag:1"`
+}
+
+type encTicketPart struct {
+	Flags     asn1.BitString `asn1:"explicit,tag:0"`
+	Key       encryptionKey  `asn1:"explicit,tag:1"`
+	CRealm    asn1.RawValue  `asn1:"explicit,tag:2"`
+	CName     rawPrincipal   `asn1:"explicit,tag:3"`
+	Transited asn1.RawValue  `asn1:"explicit,tag:4"`
+	AuthTime  time.Time      `asn1:"generalized,explicit,tag:5"`
+	StartTime time.Time      `asn1:"generalized,optional,explicit,tag:6"`
+	EndTime   time.Time      `asn1:"generalized,explicit,tag:7"`
+}
+
+type authenticator struct {
+	AuthenticatorVNO int           `asn1:"explicit,tag:0"`
+	CRealm           asn1.RawValue `asn1:"explicit,tag:1"`
+	CName            rawPrincipal  `asn1:"explicit,tag:2"`
+	Cksum            asn1.RawValue `asn1:"optional,explicit,tag:3"`
+	CUSec            int           `asn1:"explicit,tag:4"`
+	CTime            time.Time     `asn1:"generalized,explicit,tag:5"`
+}
+
+// explicitValue returns the element of a raw value with an explicit tag,
+// which encoding/asn1 parses along with its tag
+func explicitValue(v asn1.RawValue) asn1.RawValue {
+	if v.Class == asn1.ClassContextSpecific && v.IsCompound {
+		var inner asn1.RawValue
+		if _, err := asn1.Unmarshal(v.Bytes, &inner); err == nil {
+			return inner
+		}
+	}
+	return v
+}
+
+func (p rawPrincipal) principalName(realm asn1.RawValue) principalName {
+	name := principalName{
+		Realm: string(explicitValue(realm).Bytes),
+	}
+	for _, component := range p.NameString {
+		name.Components = append(name.Components, string(component.Bytes))
+	}
+	return name
+}
+
+// clientAuthentication is the client authenticated by an AP-REQ
+type clientAuthentication struct {
+	Principal principalName
+
+	// CTime and CUSec are the time of the authenticator, which identify it
+	// with the principal to detect replays
+	CTime time.Time
+	CUSec int
+}
+
+// unwrapGSSToken returns the mechanism and the inner token of a GSS-API
+// initial context token, as described in RFC 2743 section 3.1
+func unwrapGSSToken(token []byte) (asn1.ObjectIdentifier, []byte, error) {
+	var outer asn1.RawValue
+	if _, err := asn1.Unmarshal(token, &outer); err != nil {
+		return nil, nil, err
+	}
+	if outer.Class != asn1.ClassApplication || outer.Tag != 0 {
+		return nil, nil, errors.New("not a GSS-API initial context token")
+	}
+
+	var mech asn1.ObjectIdentifier
+	inner, err := asn1.Unmarshal(outer.Bytes, &mech)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mech, inner, nil
+}
+
+// parseNegotiateToken returns the AP-REQ of a SPNEGO token offering the
+// Kerberos mechanism, or of a raw Kerberos token
+func parseNegotiateToken(token []byte) ([]byte, error) {
+	// NTLM tokens are not GSS-API tokens
+	if len(token) >= 8 && string(token[:8]) == "NTLMSSP\x00" {
+		return nil, errors.New("NTLM is not supported; the client must use Kerberos")
+	}
+
+	mech, inner, err := unwrapGSSToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid negotiate token: %s", err)
+	}
+
+	if mech.Equal(oidSPNEGO) {
+		var init negTokenInit
+		if _, err := asn1.UnmarshalWithParams(inner, &init, "explicit,tag:0"); err != nil {
+			return nil, fmt.Errorf("invalid SPNEGO token: %s", err)
+		}
+		if len(init.MechToken) == 0 {
+			return nil, errors.New("SPNEGO token has no mechanism token")
+		}
+		mech, inner, err = unwrapGSSToken(init.MechToken)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SPNEGO mechanism token: %s", err)
+		}
+	}
+
+	if !mech.Equal(oidKerberos) && !mech.Equal(oidMSKerberos) {
+		return nil, fmt.Errorf("unsupported mechanism %s; the client must use Kerberos", mech)
+	}
+
+	// The AP-REQ follows the token ID of RFC 1964 section 1.1
+	if len(inner) < 2 || inner[0] != 0x01 || inner[1] != 0x00 {
+		return nil, errors.New("Kerberos token is not an AP-REQ")
+	}
+	return inner[2:], nil
+}
+
+// verifyAPReq verifies the ticket of an AP-REQ with the keys of the service
+// principal in the keytab, and its authenticator with the session key of the
+// ticket
+func verifyAPReq(data []byte, kt *keytab, service principalName, now time.Time) (*clientAuthentication, error) {
+	var req apReq
+	if _, err := asn1.UnmarshalWithParams(data, &req, "application,explicit,tag:14"); err != nil {
+		return nil, fmt.Errorf("invalid AP-REQ: %s", err)
+	}
+
+	var tkt ticket
+	if _, err := asn1.UnmarshalWithParams(explicitValue(req.Ticket).FullBytes, &tkt, "application,explicit,tag:1"); err != nil {
+		return nil, fmt.Errorf("invalid ticket: %s", err)
+	}
+
+	sname := tkt.SName.principalName(tkt.Realm)
+	if !sname.Matches(service) {
+		return nil, fmt.Errorf("ticket is for %s rather than %s", sname, service.Name())
+	}
+	key := kt.Key(sname, tkt.EncPart.EType, uint32(tkt.EncPart.KVNO))
+	if key == nil {
+		return nil, fmt.Errorf("keytab has no key of %s for encryption type %d and key version %d", sname, tkt.EncPart.EType, tkt.EncPart.KVNO)
+	}
+
+	plaintext, err := decrypt(key.EType, key.Key, keyUsageTicket, tkt.EncPart.Cipher)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting the ticket: %s", err)
+	}
+	var encPart encTicketPart
+	if _, err := asn1.UnmarshalWithParams(plaintext, &encPart, "application,explicit,tag:3"); err != nil {
+		return nil, fmt.Errorf("invalid ticket: %s", err)
+	}
+
+	startTime := encPart.StartTime
+	if startTime.IsZero() {
+		startTime = encPart.AuthTime
+	}
+	if now.Add(maxClockSkew).Before(startTime) {
+		return nil, errors.New("ticket is not yet valid")
+	}
+	if now.Add(-maxClockSkew).After(encPart.EndTime) {
+		return nil, errors.New("ticket has expired")
+	}
+
+	plaintext, err = decrypt(encPart.Key.KeyType, encPart.Key.KeyValue, keyUsageAuthenticator, req.Authenticator.Cipher)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting the authenticator: %s", err)
+	}
+	var auth authenticator
+	if _, err := asn1.UnmarshalWithParams(plaintext, &auth, "application,explicit,tag:2"); err != nil {
+		return nil, fmt.Errorf("invalid authenticator: %s", err)
+	}
+
+	cname := encPart.CName.principalName(encPart.CRealm)
+	if auth.CName.principalName(auth.CRealm).String() != cname.String() {
+		return nil, errors.New("authenticator does not match the client of the ticket")
+	}
+	if skew := now.Sub(auth.CTime); skew > maxClockSkew || skew < -maxClockSkew {
+		return nil, errors.New("clock skew too great")
+	}
+
+	return &clientAuthentication{
+		Principal: cname,
+		CTime:     auth.CTime,
+		CUSec:     auth.CUSec,
+	}, nil
+}
@@ -0,0 +1,47 @@
+package kubernetes
+
+import (
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	b := &backend{}
+	b.Backend = &framework.Backend{
+		Help: backendHelp,
+
+		PathsSpecial: &logical.Paths{
+			Unauthenticated: []string{
+				"login",
+			},
+		},
+
+		Paths: []*framework.Path{
+			pathConfig(b),
+			pathListRoles(b),
+			pathRoles(b),
+			pathLogin(b),
+		},
+
+		AuthRenew: b.pathLoginRenew,
+	}
+
+	return b
+}
+
+type backend struct {
+	*framework.Backend
+}
+
+const backendHelp = `
+The Kubernetes credential provider allows authentication of the workloads
+running in a Kubernetes cluster with their service account tokens.
+
+The tokens are validated with the TokenReview API of the cluster, or with
+the public keys of the cluster when they are configured. Roles bind the
+service accounts and namespaces allowed to log in to policies.
+`
@@ -0,0 +1,329 @@
+package kubernetes
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/hashicorp/vault/logical"
+)
+
+func createBackendWithStorage(t *testing.T) (*backend, logical.Storage) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView
+}
+
+func testRequest(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatalf("%s %s: %v", op, path, err)
+	}
+	return resp
+}
+
+func testServiceAccountJWT(t *testing.T, key *rsa.PrivateKey, namespace, name string, aud interface{}) string {
+	claims := jwt.MapClaims{
+		"iss":                                    "kubernetes/serviceaccount",
+		"kubernetes.io/serviceaccount/namespace": namespace,
+		"kubernetes.io/serviceaccount/service-account.name": name,
+		"kubernetes.io/serviceaccount/service-account.uid":  "uid-" + name,
+		"kubernetes.io/serviceaccount/secret.name":          name + "-token-abcde",
+		"sub": "system:serviceaccount:" + namespace + ":" + name,
+	}
+	if aud != nil {
+		claims["aud"] = aud
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// testTokenReviewServer authenticates the JWTs signed by the key, unless
+// they belong to the deleted service accounts
+func testTokenReviewServer(t *testing.T, key *rsa.PrivateKey, reviewer string, deleted ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/authentication.k8s.io/v1/tokenreviews" || r.Method != "POST" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+reviewer {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var review tokenReview
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(review.Spec.Token, claims, func(*jwt.Token) (interface{}, error) {
+			return &key.PublicKey, nil
+		})
+		if err == nil {
+			name := claims["kubernetes.io/serviceaccount/service-account.name"].(string)
+			review.Status.Authenticated = true
+			for _, d := range deleted {
+				if d == name {
+					review.Status.Authenticated = false
+				}
+			}
+			review.Status.User.Username = claims["sub"].(string)
+			review.Status.User.UID = claims["kubernetes.io/serviceaccount/service-account.uid"].(string)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(review)
+	}))
+}
+
+func TestKubernetes_Config(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	resp := testRequest(t, b, s, logical.UpdateOperation, "config", map[string]interface{}{
+		"kubernetes_ca_cert": "not a cert",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for missing host, got %#v", resp)
+	}
+
+	resp = testRequest(t, b, s, logical.UpdateOperation, "config", map[string]interface{}{
+		"kubernetes_host":    "https://kube.example.com",
+		"token_reviewer_jwt": "reviewer",
+		"issuer":             "kubernetes/serviceaccount",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	resp = testRequest(t, b, s, logical.ReadOperation, "config", nil)
+	if resp == nil {
+		t.Fatal("expected config")
+	}
+	if resp.Data["kubernetes_host"] != "https://kube.example.com" || resp.Data["issuer"] != "kubernetes/serviceaccount" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["token_reviewer_jwt"]; ok {
+		t.Fatal("token_reviewer_jwt should not be returned")
+	}
+
+	resp = testRequest(t, b, s, logical.UpdateOperation, "config", map[string]interface{}{
+		"kubernetes_host": "https://kube.example.com",
+		"pem_keys":        "not a key",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for invalid pem_keys, got %#v", resp)
+	}
+}
+
+func TestKubernetes_RoleCRUD(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	resp := testRequest(t, b, s, logical.CreateOperation, "role/web", map[string]interface{}{
+		"bound_service_account_names":      "*",
+		"bound_service_account_namespaces": "*",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for wildcard names and namespaces, got %#v", resp)
+	}
+
+	resp = testRequest(t, b, s, logical.CreateOperation, "role/web", map[string]interface{}{
+		"bound_service_account_names":      "web,api",
+		"bound_service_account_namespaces": "default",
+		"policies":                         "web",
+		"ttl":                              "1h",
+		"max_ttl":                          "2h",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	resp = testRequest(t, b, s, logical.ReadOperation, "role/web", nil)
+	if resp == nil {
+		t.Fatal("expected role")
+	}
+	if names := resp.Data["bound_service_account_names"].([]string); len(names) != 2 || names[1] != "api" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if resp.Data["ttl"].(int64) != 3600 || resp.Data["max_ttl"].(int64) != 7200 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if policies := resp.Data["policies"].([]string); len(policies) != 2 || policies[0] != "default" || policies[1] != "web" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp = testRequest(t, b, s, logical.ListOperation, "role/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != "web" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	testRequest(t, b, s, logical.DeleteOperation, "role/web", nil)
+	if resp = testRequest(t, b, s, logical.ReadOperation, "role/web", nil); resp != nil {
+		t.Fatalf("expected deleted role, got %#v", resp)
+	}
+}
+
+func TestKubernetes_LoginTokenReview(t *testing.T) {
+	key := mustGenerateKey(t)
+	server := testTokenReviewServer(t, key, "reviewer", "deleted")
+	defer server.Close()
+
+	b, s := createBackendWithStorage(t)
+	testRequest(t, b, s, logical.UpdateOperation, "config", map[string]interface{}{
+		"kubernetes_host":    server.URL,
+		"token_reviewer_jwt": "reviewer",
+		"issuer":             "kubernetes/serviceaccount",
+	})
+	testRequest(t, b, s, logical.CreateOperation, "role/web", map[string]interface{}{
+		"bound_service_account_names":      "web,deleted",
+		"bound_service_account_namespaces": "default",
+		"policies":                         "web",
+		"ttl":                              "1h",
+	})
+
+	resp := testRequest(t, b, s, logical.UpdateOperation, "login", map[string]interface{}{
+		"role": "web",
+		"jwt":  testServiceAccountJWT(t, key, "default", "web", nil),
+	})
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp.Auth.Metadata["service_account_uid"] != "uid-web" || resp.Auth.Metadata["service_account_secret_name"] != "web-token-abcde" {
+		t.Fatalf("bad: %#v", resp.Auth.Metadata)
+	}
+	if resp.Auth.DisplayName != "default-web" || resp.Auth.TTL != time.Hour {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+
+	// Renewing checks the role
+	auth := resp.Auth
+	auth.IssueTime = time.Now()
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.RenewOperation,
+		Path:      "login",
+		Storage:   s,
+		Auth:      auth,
+	})
+	if err != nil || resp == nil || resp.Auth == nil {
+		t.Fatalf("bad: %#v, %v", resp, err)
+	}
+	testRequest(t, b, s, logical.UpdateOperation, "role/web", map[string]interface{}{
+		"policies": "other",
+	})
+	if _, err := b.HandleRequest(&logical.Request{
+		Operation: logical.RenewOperation,
+		Path:      "login",
+		Storage:   s,
+		Auth:      auth,
+	}); err == nil {
+		t.Fatal("expected renewal to fail after the policies changed")
+	}
+
+	for name, jwtStr := range map[string]string{
+		"wrong namespace":  testServiceAccountJWT(t, key, "kube-system", "web", nil),
+		"wrong name":       testServiceAccountJWT(t, key, "default", "api", nil),
+		"deleted account":  testServiceAccountJWT(t, key, "default", "deleted", nil),
+		"unknown key":      testServiceAccountJWT(t, mustGenerateKey(t), "default", "web", nil),
+		"malformed jwt":    "not.a.jwt",
+		"unsigned payload": "a.b",
+	} {
+		resp := testRequest(t, b, s, logical.UpdateOperation, "login", map[string]interface{}{
+			"role": "web",
+			"jwt":  jwtStr,
+		})
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected error, got %#v", name, resp)
+		}
+	}
+
+	// A reviewer without permission denies every login
+	testRequest(t, b, s, logical.UpdateOperation, "config", map[string]interface{}{
+		"kubernetes_host":    server.URL,
+		"token_reviewer_jwt": "other",
+	})
+	resp = testRequest(t, b, s, logical.UpdateOperation, "login", map[string]interface{}{
+		"role": "web",
+		"jwt":  testServiceAccountJWT(t, key, "default", "web", nil),
+	})
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Data["error"].(string), "denied") {
+		t.Fatalf("expected denied review, got %#v", resp)
+	}
+}
+
+func TestKubernetes_LoginPEMKeys(t *testing.T) {
+	key := mustGenerateKey(t)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	b, s := createBackendWithStorage(t)
+	resp := testRequest(t, b, s, logical.UpdateOperation, "config", map[string]interface{}{
+		"kubernetes_host": "https://kube.invalid",
+		"pem_keys":        []string{pemKey},
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	testRequest(t, b, s, logical.CreateOperation, "role/web", map[string]interface{}{
+		"bound_service_account_names":      "web",
+		"bound_service_account_namespaces": "*",
+		"audience":                         "vault",
+		"period":                           "30m",
+	})
+
+	resp = testRequest(t, b, s, logical.UpdateOperation, "login", map[string]interface{}{
+		"role": "web",
+		"jwt":  testServiceAccountJWT(t, key, "team-a", "web", []interface{}{"api", "vault"}),
+	})
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp.Auth.Period != 30*time.Minute || resp.Auth.TTL != 30*time.Minute {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+
+	for name, jwtStr := range map[string]string{
+		"wrong audience": testServiceAccountJWT(t, key, "team-a", "web", "api"),
+		"no audience":    testServiceAccountJWT(t, key, "team-a", "web", nil),
+		"unknown key":    testServiceAccountJWT(t, mustGenerateKey(t), "team-a", "web", "vault"),
+	} {
+		resp := testRequest(t, b, s, logical.UpdateOperation, "login", map[string]interface{}{
+			"role": "web",
+			"jwt":  jwtStr,
+		})
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected error, got %#v", name, resp)
+		}
+	}
+}
+
+func mustGenerateKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
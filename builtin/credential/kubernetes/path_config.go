@@ -0,0 +1,169 @@
+package kubernetes
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `config`,
+		Fields: map[string]*framework.FieldSchema{
+			"kubernetes_host": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Host, port and scheme of the Kubernetes API server, for example https://192.168.99.100:8443",
+			},
+			"kubernetes_ca_cert": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "PEM encoded CA certificate of the Kubernetes API server. Defaults to the system CAs.",
+			},
+			"token_reviewer_jwt": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `A service account JWT allowed to call the TokenReview API. If not set, the
+JWT presented at login is used to review itself.`,
+			},
+			"pem_keys": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma separated list of PEM encoded public keys of the cluster. If set,
+service account JWTs are verified with these keys instead of the TokenReview
+API.`,
+			},
+			"issuer": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "If set, the issuer the service account JWTs must have, for example kubernetes/serviceaccount",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+// Config returns the configuration of the backend
+func (b *backend) Config(s logical.Storage) (*kubeConfig, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result kubeConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	// The token reviewer JWT is a credential, and is not returned
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"kubernetes_host":    config.Host,
+			"kubernetes_ca_cert": config.CACert,
+			"pem_keys":           config.PEMKeys,
+			"issuer":             config.Issuer,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config := &kubeConfig{
+		Host:             d.Get("kubernetes_host").(string),
+		CACert:           d.Get("kubernetes_ca_cert").(string),
+		TokenReviewerJWT: d.Get("token_reviewer_jwt").(string),
+		PEMKeys:          d.Get("pem_keys").([]string),
+		Issuer:           d.Get("issuer").(string),
+	}
+
+	if config.Host == "" {
+		return logical.ErrorResponse("missing kubernetes_host"), nil
+	}
+	if _, err := url.Parse(config.Host); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid kubernetes_host: %s", err)), nil
+	}
+	if config.CACert != "" {
+		if block, _ := pem.Decode([]byte(config.CACert)); block == nil {
+			return logical.ErrorResponse("kubernetes_ca_cert is not PEM encoded"), nil
+		}
+	}
+	if _, err := config.publicKeys(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// kubeConfig is the configuration of the backend
+type kubeConfig struct {
+	Host             string   `json:"kubernetes_host"`
+	CACert           string   `json:"kubernetes_ca_cert"`
+	TokenReviewerJWT string   `json:"token_reviewer_jwt"`
+	PEMKeys          []string `json:"pem_keys"`
+	Issuer           string   `json:"issuer"`
+}
+
+// publicKeys parses the PEM encoded public keys of the configuration
+func (c *kubeConfig) publicKeys() ([]interface{}, error) {
+	keys := make([]interface{}, 0, len(c.PEMKeys))
+	for _, pemKey := range c.PEMKeys {
+		block, _ := pem.Decode([]byte(pemKey))
+		if block == nil {
+			return nil, fmt.Errorf("pem_keys contains a key which is not PEM encoded")
+		}
+
+		var key interface{}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			key = cert.PublicKey
+		} else if key, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %s", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+const pathConfigHelpSyn = `
+Configures the Kubernetes cluster whose service accounts log in.
+`
+
+const pathConfigHelpDesc = `
+The Kubernetes backend validates service account JWTs with the TokenReview
+API of the configured API server. The "token_reviewer_jwt" must belong to a
+service account allowed to create TokenReviews, such as one bound to the
+"system:auth-delegator" cluster role.
+
+Alternatively, the JWTs are verified with the "pem_keys" of the cluster when
+they are set, without contacting the API server. Deleted service accounts are
+then not detected.
+`
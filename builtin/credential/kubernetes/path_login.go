@@ -0,0 +1,391 @@
+package kubernetes
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathLogin(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "login$",
+		Fields: map[string]*framework.FieldSchema{
+			"role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role to log in with.",
+			},
+			"jwt": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Service account JWT.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLogin,
+		},
+
+		HelpSynopsis:    pathLoginHelpSyn,
+		HelpDescription: pathLoginHelpDesc,
+	}
+}
+
+func (b *backend) pathLogin(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleName := strings.ToLower(d.Get("role").(string))
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+	jwtStr := d.Get("jwt").(string)
+	if jwtStr == "" {
+		return logical.ErrorResponse("missing jwt"), nil
+	}
+
+	role, err := b.role(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid role name %q", roleName)), nil
+	}
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return logical.ErrorResponse("kubernetes backend is not configured"), nil
+	}
+
+	sa, err := b.serviceAccount(config, role, jwtStr)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	auth := &logical.Auth{
+		Policies: role.Policies,
+		Period:   role.Period,
+		InternalData: map[string]interface{}{
+			"role": roleName,
+		},
+		Metadata: map[string]string{
+			"role":                        roleName,
+			"service_account_name":        sa.Name,
+			"service_account_namespace":   sa.Namespace,
+			"service_account_uid":         sa.UID,
+			"service_account_secret_name": sa.SecretName,
+		},
+		DisplayName: fmt.Sprintf("%s-%s", sa.Namespace, sa.Name),
+		LeaseOptions: logical.LeaseOptions{
+			TTL:       role.TTL,
+			Renewable: true,
+		},
+	}
+
+	// If 'Period' is set, use the value of 'Period' as the TTL
+	if role.Period > time.Duration(0) {
+		auth.TTL = role.Period
+	}
+
+	return &logical.Response{
+		Auth: auth,
+	}, nil
+}
+
+func (b *backend) pathLoginRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if req.Auth == nil {
+		return nil, fmt.Errorf("request auth was nil")
+	}
+
+	roleName, _ := req.Auth.InternalData["role"].(string)
+	if roleName == "" {
+		return nil, fmt.Errorf("failed to fetch role during renewal")
+	}
+
+	// The role must still exist and grant the same policies
+	role, err := b.role(req.Storage, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate role %s during renewal: %s", roleName, err)
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role %s does not exist during renewal", roleName)
+	}
+	if !policyutil.EquivalentPolicies(role.Policies, req.Auth.Policies) {
+		return nil, fmt.Errorf("policies have changed, not renewing")
+	}
+
+	if role.Period > time.Duration(0) {
+		req.Auth.TTL = role.Period
+		return &logical.Response{Auth: req.Auth}, nil
+	}
+	return framework.LeaseExtend(role.TTL, role.MaxTTL, b.System())(req, d)
+}
+
+// serviceAccount is the service account a JWT was issued to
+type serviceAccount struct {
+	Name       string
+	Namespace  string
+	UID        string
+	SecretName string
+}
+
+// serviceAccount validates the JWT against the role, and returns the service
+// account it was issued to
+func (b *backend) serviceAccount(config *kubeConfig, role *roleStorageEntry, jwtStr string) (*serviceAccount, error) {
+	keys, err := config.publicKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if len(keys) != 0 {
+		claims, err = verifyClaims(jwtStr, keys)
+	} else {
+		claims, err = unverifiedClaims(jwtStr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != config.Issuer {
+			return nil, fmt.Errorf("invalid issuer %q", iss)
+		}
+	}
+
+	sa := claimsServiceAccount(claims)
+	if sa.Name == "" || sa.Namespace == "" {
+		return nil, errors.New("JWT is not a service account token")
+	}
+	if !boundTo(role.ServiceAccountNames, sa.Name) {
+		return nil, fmt.Errorf("service account name %q not authorized", sa.Name)
+	}
+	if !boundTo(role.ServiceAccountNamespaces, sa.Namespace) {
+		return nil, fmt.Errorf("namespace %q not authorized", sa.Namespace)
+	}
+	if role.Audience != "" && !hasAudience(claims["aud"], role.Audience) {
+		return nil, fmt.Errorf("invalid audience, expected %q", role.Audience)
+	}
+
+	// Without public keys, the API server verifies the JWT, which also
+	// detects deleted service accounts
+	if len(keys) == 0 {
+		if err := reviewToken(config, role, jwtStr, sa); err != nil {
+			return nil, err
+		}
+	}
+
+	return sa, nil
+}
+
+// verifyClaims verifies the signature and expiration of the JWT with the
+// public keys, and returns its claims
+func verifyClaims(jwtStr string, keys []interface{}) (map[string]interface{}, error) {
+	parser := &jwt.Parser{
+		ValidMethods: []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"},
+	}
+
+	var lastErr error
+	for _, key := range keys {
+		claims := jwt.MapClaims{}
+		_, err := parser.ParseWithClaims(jwtStr, claims, func(token *jwt.Token) (interface{}, error) {
+			switch token.Method.(type) {
+			case *jwt.SigningMethodRSA:
+				if _, ok := key.(*rsa.PublicKey); ok {
+					return key, nil
+				}
+			case *jwt.SigningMethodECDSA:
+				if _, ok := key.(*ecdsa.PublicKey); ok {
+					return key, nil
+				}
+			}
+			return nil, errors.New("key does not match the signing method")
+		})
+		if err == nil {
+			return claims, nil
+		}
+		lastErr = err
+	}
+
+	return nil, fmt.Errorf("failed to verify JWT: %s", lastErr)
+}
+
+// unverifiedClaims decodes the claims of the JWT, which the TokenReview API
+// verifies afterwards
+func unverifiedClaims(jwtStr string) (map[string]interface{}, error) {
+	parts := strings.Split(jwtStr, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed JWT")
+	}
+	payload, err := jwt.DecodeSegment(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWT: %s", err)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("malformed JWT: %s", err)
+	}
+	return claims, nil
+}
+
+// claimsServiceAccount extracts the service account from the claims of
+// legacy secret tokens or of projected tokens
+func claimsServiceAccount(claims map[string]interface{}) *serviceAccount {
+	sa := &serviceAccount{}
+	if k8s, ok := claims["kubernetes.io"].(map[string]interface{}); ok {
+		sa.Namespace, _ = k8s["namespace"].(string)
+		if account, ok := k8s["serviceaccount"].(map[string]interface{}); ok {
+			sa.Name, _ = account["name"].(string)
+			sa.UID, _ = account["uid"].(string)
+		}
+		return sa
+	}
+
+	sa.Namespace, _ = claims["kubernetes.io/serviceaccount/namespace"].(string)
+	sa.Name, _ = claims["kubernetes.io/serviceaccount/service-account.name"].(string)
+	sa.UID, _ = claims["kubernetes.io/serviceaccount/service-account.uid"].(string)
+	sa.SecretName, _ = claims["kubernetes.io/serviceaccount/secret.name"].(string)
+	return sa
+}
+
+func boundTo(bound []string, value string) bool {
+	return strutil.StrListContains(bound, "*") || strutil.StrListContains(bound, value)
+}
+
+// hasAudience checks the aud claim, which is either a string or a list
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, v := range aud {
+			if s, ok := v.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tokenReview is the subset of the authentication.k8s.io/v1 TokenReview
+// resource used by the backend
+type tokenReview struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Spec       tokenReviewSpec   `json:"spec"`
+	Status     tokenReviewStatus `json:"status"`
+}
+
+type tokenReviewSpec struct {
+	Token     string   `json:"token"`
+	Audiences []string `json:"audiences,omitempty"`
+}
+
+type tokenReviewStatus struct {
+	Authenticated bool   `json:"authenticated"`
+	Error         string `json:"error"`
+	User          struct {
+		Username string `json:"username"`
+		UID      string `json:"uid"`
+	} `json:"user"`
+}
+
+// reviewToken asks the API server to verify the JWT, and checks that it
+// belongs to the service account
+func reviewToken(config *kubeConfig, role *roleStorageEntry, jwtStr string, sa *serviceAccount) error {
+	review := &tokenReview{
+		APIVersion: "authentication.k8s.io/v1",
+		Kind:       "TokenReview",
+		Spec: tokenReviewSpec{
+			Token: jwtStr,
+		},
+	}
+	if role.Audience != "" {
+		review.Spec.Audiences = []string{role.Audience}
+	}
+	body, err := json.Marshal(review)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequest("POST", strings.TrimSuffix(config.Host, "/")+"/apis/authentication.k8s.io/v1/tokenreviews", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	bearer := config.TokenReviewerJWT
+	if bearer == "" {
+		bearer = jwtStr
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+bearer)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+
+	client := cleanhttp.DefaultClient()
+	if config.CACert != "" {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM([]byte(config.CACert))
+		transport := cleanhttp.DefaultTransport()
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs: pool,
+		}
+		client.Transport = transport
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to review token: %s", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return errors.New("token review denied: the JWT may belong to a deleted service account, or the reviewer may lack permission")
+	case resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("token review failed with status %d", resp.StatusCode)
+	}
+
+	var result tokenReview
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode token review: %s", err)
+	}
+	if result.Status.Error != "" {
+		return fmt.Errorf("token review failed: %s", result.Status.Error)
+	}
+	if !result.Status.Authenticated {
+		return errors.New("JWT is not authenticated")
+	}
+
+	username := fmt.Sprintf("system:serviceaccount:%s:%s", sa.Namespace, sa.Name)
+	if result.Status.User.Username != username {
+		return errors.New("token review returned another service account")
+	}
+	if sa.UID != "" && result.Status.User.UID != sa.UID {
+		return errors.New("token review returned another service account UID")
+	}
+
+	return nil
+}
+
+const pathLoginHelpSyn = `
+Authenticates Kubernetes service accounts with Vault.
+`
+
+const pathLoginHelpDesc = `
+Log in with the JWT of a service account and the name of a role binding it.
+The JWT is mounted in pods at /var/run/secrets/kubernetes.io/serviceaccount/token.
+`
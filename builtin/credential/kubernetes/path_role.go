@@ -0,0 +1,230 @@
+package kubernetes
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    pathRoleHelpSyn,
+		HelpDescription: pathRoleHelpDesc,
+	}
+}
+
+func pathRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+			"bound_service_account_names": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Comma separated list of the service account names able to log in. "*" allows all names.`,
+			},
+			"bound_service_account_namespaces": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Comma separated list of the namespaces of the service accounts able to log in. "*" allows all namespaces.`,
+			},
+			"audience": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "If set, the audience the service account JWTs must have.",
+			},
+			"policies": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of policies on the role.",
+			},
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Duration after which the issued tokens expire. Defaults to the mount's default TTL.",
+			},
+			"max_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Duration after which the issued tokens cannot be renewed. Defaults to the mount's maximum TTL.",
+			},
+			"period": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `If set, the issued tokens are periodic: they never expire as long as they
+are renewed within this duration.`,
+			},
+		},
+
+		ExistenceCheck: b.pathRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathRoleCreateUpdate,
+			logical.UpdateOperation: b.pathRoleCreateUpdate,
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    pathRoleHelpSyn,
+		HelpDescription: pathRoleHelpDesc,
+	}
+}
+
+// role returns the named role, or nil if it does not exist
+func (b *backend) role(s logical.Storage, name string) (*roleStorageEntry, error) {
+	entry, err := s.Get("role/" + strings.ToLower(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result roleStorageEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathRoleExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	role, err := b.role(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return role != nil, nil
+}
+
+func (b *backend) pathRoleList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roles, err := req.Storage.List("role/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathRoleRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := b.role(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"bound_service_account_names":      role.ServiceAccountNames,
+			"bound_service_account_namespaces": role.ServiceAccountNamespaces,
+			"audience":                         role.Audience,
+			"policies":                         role.Policies,
+			"ttl":                              int64(role.TTL / time.Second),
+			"max_ttl":                          int64(role.MaxTTL / time.Second),
+			"period":                           int64(role.Period / time.Second),
+		},
+	}, nil
+}
+
+func (b *backend) pathRoleDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete("role/" + strings.ToLower(d.Get("name").(string))); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathRoleCreateUpdate(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := strings.ToLower(d.Get("name").(string))
+	role, err := b.role(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role = &roleStorageEntry{}
+	}
+
+	if raw, ok := d.GetOk("bound_service_account_names"); ok {
+		role.ServiceAccountNames = raw.([]string)
+	}
+	if raw, ok := d.GetOk("bound_service_account_namespaces"); ok {
+		role.ServiceAccountNamespaces = raw.([]string)
+	}
+	if raw, ok := d.GetOk("audience"); ok {
+		role.Audience = raw.(string)
+	}
+	if raw, ok := d.GetOk("policies"); ok {
+		role.Policies = policyutil.SanitizePolicies(raw.([]string), true)
+	} else if req.Operation == logical.CreateOperation {
+		role.Policies = policyutil.SanitizePolicies(nil, true)
+	}
+	if raw, ok := d.GetOk("ttl"); ok {
+		role.TTL = time.Duration(raw.(int)) * time.Second
+	}
+	if raw, ok := d.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(raw.(int)) * time.Second
+	}
+	if raw, ok := d.GetOk("period"); ok {
+		role.Period = time.Duration(raw.(int)) * time.Second
+	}
+
+	if len(role.ServiceAccountNames) == 0 {
+		return logical.ErrorResponse("bound_service_account_names must be set"), nil
+	}
+	if len(role.ServiceAccountNamespaces) == 0 {
+		return logical.ErrorResponse("bound_service_account_namespaces must be set"), nil
+	}
+	if strutil.StrListContains(role.ServiceAccountNames, "*") && strutil.StrListContains(role.ServiceAccountNamespaces, "*") {
+		return logical.ErrorResponse(`bound_service_account_names and bound_service_account_namespaces cannot both be "*"`), nil
+	}
+	if role.MaxTTL > 0 && role.TTL > role.MaxTTL {
+		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	}
+	if role.Period > b.System().MaxLeaseTTL() {
+		return logical.ErrorResponse("period cannot be greater than the mount's maximum TTL"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("role/"+name, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// roleStorageEntry binds service accounts to policies
+type roleStorageEntry struct {
+	ServiceAccountNames      []string      `json:"bound_service_account_names"`
+	ServiceAccountNamespaces []string      `json:"bound_service_account_namespaces"`
+	Audience                 string        `json:"audience"`
+	Policies                 []string      `json:"policies"`
+	TTL                      time.Duration `json:"ttl"`
+	MaxTTL                   time.Duration `json:"max_ttl"`
+	Period                   time.Duration `json:"period"`
+}
+
+const pathRoleHelpSyn = `
+Manage the roles binding service accounts to policies.
+`
+
+const pathRoleHelpDesc = `
+A role allows the service accounts with one of its names, in one of its
+namespaces, to log in and obtain tokens with its policies. Either the names
+or the namespaces can be "*", but not both.
+
+If an audience is set, the service account JWTs must be issued for it, which
+is the case of projected service account tokens requested for that audience.
+`
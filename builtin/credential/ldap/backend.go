@@ -2,6 +2,7 @@ package ldap
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"text/template"
 
@@ -83,22 +84,25 @@ func EscapeLDAPValue(input string) string {
 	return input
 }
 
-func (b *backend) Login(req *logical.Request, username string, password string) ([]string, *logical.Response, error) {
+// Login authenticates the user and returns its policies, its groups and its
+// display name. Users without policies are authenticated if they are members
+// of groups, whose external groups may grant them policies.
+func (b *backend) Login(req *logical.Request, username string, password string) ([]string, []string, string, *logical.Response, error) {
 
 	cfg, err := b.Config(req)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, "", nil, err
 	}
 	if cfg == nil {
-		return nil, logical.ErrorResponse("ldap backend not configured"), nil
+		return nil, nil, "", logical.ErrorResponse("ldap backend not configured"), nil
 	}
 
 	c, err := cfg.DialLDAP()
 	if err != nil {
-		return nil, logical.ErrorResponse(err.Error()), nil
+		return nil, nil, "", logical.ErrorResponse(err.Error()), nil
 	}
 	if c == nil {
-		return nil, logical.ErrorResponse("invalid connection returned from LDAP dial"), nil
+		return nil, nil, "", logical.ErrorResponse("invalid connection returned from LDAP dial"), nil
 	}
 
 	// Clean connection
@@ -106,7 +110,7 @@ func (b *backend) Login(req *logical.Request, username string, password string)
 
 	userBindDN, err := b.getUserBindDN(cfg, c, username)
 	if err != nil {
-		return nil, logical.ErrorResponse(err.Error()), nil
+		return nil, nil, "", logical.ErrorResponse(err.Error()), nil
 	}
 
 	if b.Logger().IsDebug() {
@@ -114,33 +118,78 @@ func (b *backend) Login(req *logical.Request, username string, password string)
 	}
 
 	if cfg.DenyNullBind && len(password) == 0 {
-		return nil, logical.ErrorResponse("password cannot be of zero length when passwordless binds are being denied"), nil
+		return nil, nil, "", logical.ErrorResponse("password cannot be of zero length when passwordless binds are being denied"), nil
 	}
 
 	// Try to bind as the login user. This is where the actual authentication takes place.
 	if err = c.Bind(userBindDN, password); err != nil {
-		return nil, logical.ErrorResponse(fmt.Sprintf("LDAP bind failed: %v", err)), nil
+		return nil, nil, "", logical.ErrorResponse(fmt.Sprintf("LDAP bind failed: %v", err)), nil
 	}
 
 	// We re-bind to the BindDN if it's defined because we assume
 	// the BindDN should be the one to search, not the user logging in.
 	if cfg.BindDN != "" && cfg.BindPassword != "" {
 		if err := c.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
-			return nil, logical.ErrorResponse(fmt.Sprintf("Encountered an error while attempting to re-bind with the BindDN User: %s", err.Error())), nil
+			return nil, nil, "", logical.ErrorResponse(fmt.Sprintf("Encountered an error while attempting to re-bind with the BindDN User: %s", err.Error())), nil
 		}
 		if b.Logger().IsDebug() {
 			b.Logger().Debug("auth/ldap: Re-Bound to original BindDN")
 		}
 	}
 
+	return b.userPolicies(req, cfg, c, username, userBindDN)
+}
+
+// Lookup returns the policies, groups and display name of a user who was
+// authenticated by other means, such as Kerberos, as Login does. The user is
+// looked up with the configured BindDN, or anonymously.
+func (b *backend) Lookup(req *logical.Request, username string) ([]string, []string, string, *logical.Response, error) {
+	cfg, err := b.Config(req)
+	if err != nil {
+		return nil, nil, "", nil, err
+	}
+	if cfg == nil {
+		return nil, nil, "", logical.ErrorResponse("ldap backend not configured"), nil
+	}
+
+	c, err := cfg.DialLDAP()
+	if err != nil {
+		return nil, nil, "", logical.ErrorResponse(err.Error()), nil
+	}
+	if c == nil {
+		return nil, nil, "", logical.ErrorResponse("invalid connection returned from LDAP dial"), nil
+	}
+
+	// Clean connection
+	defer c.Close()
+
+	userBindDN, err := b.getUserBindDN(cfg, c, username)
+	if err != nil {
+		return nil, nil, "", logical.ErrorResponse(err.Error()), nil
+	}
+
+	return b.userPolicies(req, cfg, c, username, userBindDN)
+}
+
+// userPolicies returns the policies, groups and display name of a user,
+// searching for its groups with the bound connection
+func (b *backend) userPolicies(req *logical.Request, cfg *ConfigEntry, c *ldap.Conn, username, userBindDN string) ([]string, []string, string, *logical.Response, error) {
 	userDN, err := b.getUserDN(cfg, c, userBindDN)
 	if err != nil {
-		return nil, logical.ErrorResponse(err.Error()), nil
+		return nil, nil, "", logical.ErrorResponse(err.Error()), nil
+	}
+
+	displayName := username
+	if !cfg.UsernameAsAlias {
+		displayName, err = b.getUserAttrValue(cfg, c, userDN, username)
+		if err != nil {
+			return nil, nil, "", logical.ErrorResponse(err.Error()), nil
+		}
 	}
 
 	ldapGroups, err := b.getLdapGroups(cfg, c, userDN, username)
 	if err != nil {
-		return nil, logical.ErrorResponse(err.Error()), nil
+		return nil, nil, "", logical.ErrorResponse(err.Error()), nil
 	}
 	if b.Logger().IsDebug() {
 		b.Logger().Debug("auth/ldap: Groups fetched from server", "num_server_groups", len(ldapGroups), "server_groups", ldapGroups)
@@ -181,18 +230,19 @@ func (b *backend) Login(req *logical.Request, username string, password string)
 	}
 	// Policies from each group may overlap
 	policies = strutil.RemoveDuplicates(policies, true)
+	allGroups = strutil.RemoveDuplicates(allGroups, false)
 
-	if len(policies) == 0 {
+	if len(policies) == 0 && len(allGroups) == 0 {
 		errStr := "user is not a member of any authorized group"
 		if len(ldapResponse.Warnings) > 0 {
 			errStr = fmt.Sprintf("%s; additionally, %s", errStr, ldapResponse.Warnings[0])
 		}
 
 		ldapResponse.Data["error"] = errStr
-		return nil, ldapResponse, nil
+		return nil, nil, "", ldapResponse, nil
 	}
 
-	return policies, ldapResponse, nil
+	return policies, allGroups, displayName, ldapResponse, nil
 }
 
 /*
@@ -236,7 +286,10 @@ func (b *backend) getUserBindDN(cfg *ConfigEntry, c *ldap.Conn, username string)
 			return bindDN, fmt.Errorf("LDAP bind (service) failed: %v", err)
 		}
 
-		filter := fmt.Sprintf("(%s=%s)", cfg.UserAttr, ldap.EscapeFilter(username))
+		filter, err := renderUserSearchFilter(cfg.UserFilter, cfg.UserAttr, username)
+		if err != nil {
+			return bindDN, err
+		}
 		if b.Logger().IsDebug() {
 			b.Logger().Debug("auth/ldap: Discovering user", "userdn", cfg.UserDN, "filter", filter)
 		}
@@ -270,7 +323,10 @@ func (b *backend) getUserDN(cfg *ConfigEntry, c *ldap.Conn, bindDN string) (stri
 	userDN := ""
 	if cfg.UPNDomain != "" {
 		// Find the distinguished name for the user if userPrincipalName used for login
-		filter := fmt.Sprintf("(userPrincipalName=%s)", ldap.EscapeFilter(bindDN))
+		filter, err := renderUserSearchFilter(cfg.UserFilter, "userPrincipalName", bindDN)
+		if err != nil {
+			return userDN, err
+		}
 		if b.Logger().IsDebug() {
 			b.Logger().Debug("auth/ldap: Searching UPN", "userdn", cfg.UserDN, "filter", filter)
 		}
@@ -292,11 +348,73 @@ func (b *backend) getUserDN(cfg *ConfigEntry, c *ldap.Conn, bindDN string) (stri
 	return userDN, nil
 }
 
+/*
+ * getUserAttrValue returns the value of cfg.UserAttr on the object of the authenticated user, which is
+ * the canonical form of the username in the directory. The username is returned if the attribute is
+ * not set on the object.
+ */
+func (b *backend) getUserAttrValue(cfg *ConfigEntry, c *ldap.Conn, userDN string, username string) (string, error) {
+	result, err := c.Search(&ldap.SearchRequest{
+		BaseDN: userDN,
+		Scope:  ldap.ScopeBaseObject,
+		Filter: "(objectClass=*)",
+		Attributes: []string{
+			cfg.UserAttr,
+		},
+		SizeLimit: 1,
+	})
+	if err != nil {
+		return "", fmt.Errorf("LDAP search failed for reading user attribute: %v", err)
+	}
+	if len(result.Entries) == 0 {
+		return username, nil
+	}
+
+	value := result.Entries[0].GetAttributeValue(cfg.UserAttr)
+	if value == "" {
+		return username, nil
+	}
+	return value, nil
+}
+
+/*
+ * renderUserSearchFilter renders the user search filter template, with the attribute matching
+ * the username and the escaped username as its context. An empty template falls back to
+ * the default filter, "({{.UserAttr}}={{.Username}})".
+ */
+func renderUserSearchFilter(userFilter, userAttr, username string) (string, error) {
+	if userFilter == "" {
+		userFilter = "({{.UserAttr}}={{.Username}})"
+	}
+
+	t, err := template.New("queryTemplate").Parse(userFilter)
+	if err != nil {
+		return "", fmt.Errorf("LDAP search failed due to template compilation error: %v", err)
+	}
+
+	context := struct {
+		UserAttr string
+		Username string
+	}{
+		ldap.EscapeFilter(userAttr),
+		ldap.EscapeFilter(username),
+	}
+
+	var renderedFilter bytes.Buffer
+	if err := t.Execute(&renderedFilter, context); err != nil {
+		return "", fmt.Errorf("LDAP search failed due to template parsing error: %v", err)
+	}
+
+	return renderedFilter.String(), nil
+}
+
 /*
  * getLdapGroups queries LDAP and returns a slice describing the set of groups the authenticated user is a member of.
  *
- * The search query is constructed according to cfg.GroupFilter, and run in context of cfg.GroupDN.
- * Groups will be resolved from the query results by following the attribute defined in cfg.GroupAttr.
+ * If cfg.UseTokenGroups is set, the groups are the entries of the SIDs in the "tokenGroups" attribute of the
+ * user object, which Active Directory computes with the nested groups. Otherwise, the search query is
+ * constructed according to cfg.GroupFilter, and run in context of cfg.GroupDN.
+ * Groups will be resolved from the results by following the attribute defined in cfg.GroupAttr.
  *
  * cfg.GroupFilter is a go template and is compiled with the following context: [UserDN, Username]
  *    UserDN - The DN of the authenticated user
@@ -311,17 +429,57 @@ func (b *backend) getUserDN(cfg *ConfigEntry, c *ldap.Conn, bindDN string) (stri
  *
  */
 func (b *backend) getLdapGroups(cfg *ConfigEntry, c *ldap.Conn, userDN string, username string) ([]string, error) {
+	var entries []*ldap.Entry
+	var err error
+	if cfg.UseTokenGroups {
+		entries, err = b.performLdapTokenGroupsSearch(cfg, c, userDN)
+	} else {
+		entries, err = b.performLdapFilterGroupsSearch(cfg, c, userDN, username)
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	// retrieve the groups in a string/bool map as a structure to avoid duplicates inside
 	ldapMap := make(map[string]bool)
 
+	for _, e := range entries {
+		dn, err := ldap.ParseDN(e.DN)
+		if err != nil || len(dn.RDNs) == 0 {
+			continue
+		}
+
+		// Enumerate attributes of each result, parse out CN and add as group
+		values := e.GetAttributeValues(cfg.GroupAttr)
+		if len(values) > 0 {
+			for _, val := range values {
+				groupCN := b.getCN(val)
+				ldapMap[groupCN] = true
+			}
+		} else {
+			// If groupattr didn't resolve, use self (enumerating group objects)
+			groupCN := b.getCN(e.DN)
+			ldapMap[groupCN] = true
+		}
+	}
+
+	ldapGroups := make([]string, 0, len(ldapMap))
+	for key, _ := range ldapMap {
+		ldapGroups = append(ldapGroups, key)
+	}
+
+	return ldapGroups, nil
+}
+
+func (b *backend) performLdapFilterGroupsSearch(cfg *ConfigEntry, c *ldap.Conn, userDN string, username string) ([]*ldap.Entry, error) {
 	if cfg.GroupFilter == "" {
 		b.Logger().Warn("auth/ldap: GroupFilter is empty, will not query server")
-		return make([]string, 0), nil
+		return make([]*ldap.Entry, 0), nil
 	}
 
 	if cfg.GroupDN == "" {
 		b.Logger().Warn("auth/ldap: GroupDN is empty, will not query server")
-		return make([]string, 0), nil
+		return make([]*ldap.Entry, 0), nil
 	}
 
 	// If groupfilter was defined, resolve it as a Go template and use the query for
@@ -365,32 +523,90 @@ func (b *backend) getLdapGroups(cfg *ConfigEntry, c *ldap.Conn, userDN string, u
 		return nil, fmt.Errorf("LDAP search failed: %v", err)
 	}
 
-	for _, e := range result.Entries {
-		dn, err := ldap.ParseDN(e.DN)
-		if err != nil || len(dn.RDNs) == 0 {
+	return result.Entries, nil
+}
+
+/*
+ * performLdapTokenGroupsSearch reads the SIDs of the groups of an Active Directory user from the
+ * "tokenGroups" attribute of its object, and returns the objects of the groups, which are
+ * read with the "<SID=...>" DN syntax of Active Directory.
+ */
+func (b *backend) performLdapTokenGroupsSearch(cfg *ConfigEntry, c *ldap.Conn, userDN string) ([]*ldap.Entry, error) {
+	result, err := c.Search(&ldap.SearchRequest{
+		BaseDN: userDN,
+		Scope:  ldap.ScopeBaseObject,
+		Filter: "(objectClass=*)",
+		Attributes: []string{
+			"tokenGroups",
+		},
+		SizeLimit: 1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("LDAP search failed: %v", err)
+	}
+	if len(result.Entries) == 0 {
+		b.Logger().Warn("auth/ldap: unable to read object for group attributes", "userdn", userDN)
+		return make([]*ldap.Entry, 0), nil
+	}
+
+	sids := result.Entries[0].GetRawAttributeValues("tokenGroups")
+	if b.Logger().IsDebug() {
+		b.Logger().Debug("auth/ldap: Resolving token groups", "userdn", userDN, "num_token_groups", len(sids))
+	}
+
+	entries := make([]*ldap.Entry, 0, len(sids))
+	for _, sidBytes := range sids {
+		sid, err := sidBytesToString(sidBytes)
+		if err != nil {
+			b.Logger().Warn("auth/ldap: unable to parse token group SID", "error", err)
 			continue
 		}
 
-		// Enumerate attributes of each result, parse out CN and add as group
-		values := e.GetAttributeValues(cfg.GroupAttr)
-		if len(values) > 0 {
-			for _, val := range values {
-				groupCN := b.getCN(val)
-				ldapMap[groupCN] = true
-			}
-		} else {
-			// If groupattr didn't resolve, use self (enumerating group objects)
-			groupCN := b.getCN(e.DN)
-			ldapMap[groupCN] = true
+		groupResult, err := c.Search(&ldap.SearchRequest{
+			BaseDN: fmt.Sprintf("<SID=%s>", sid),
+			Scope:  ldap.ScopeBaseObject,
+			Filter: "(objectClass=*)",
+			Attributes: []string{
+				cfg.GroupAttr,
+			},
+			SizeLimit: 1,
+		})
+		if err != nil {
+			// Groups of other domains may not be readable
+			b.Logger().Warn("auth/ldap: unable to read the object of a token group", "sid", sid, "error", err)
+			continue
 		}
+		entries = append(entries, groupResult.Entries...)
 	}
 
-	ldapGroups := make([]string, 0, len(ldapMap))
-	for key, _ := range ldapMap {
-		ldapGroups = append(ldapGroups, key)
+	return entries, nil
+}
+
+/*
+ * sidBytesToString converts the binary form of a Windows security identifier to its string
+ * form, such as S-1-5-21-3623811015-3361044348-30300820-1013.
+ * See https://msdn.microsoft.com/en-us/library/cc230371.aspx
+ */
+func sidBytesToString(b []byte) (string, error) {
+	if len(b) < 8 {
+		return "", fmt.Errorf("SID of %d bytes is too short", len(b))
+	}
+	subAuthorityCount := int(b[1])
+	if len(b) != 8+4*subAuthorityCount {
+		return "", fmt.Errorf("SID of %d bytes does not have %d sub-authorities", len(b), subAuthorityCount)
 	}
 
-	return ldapGroups, nil
+	// The identifier authority is a 48-bit big endian value
+	var authority uint64
+	for _, v := range b[2:8] {
+		authority = authority<<8 | uint64(v)
+	}
+
+	sid := fmt.Sprintf("S-%d-%d", b[0], authority)
+	for i := 0; i < subAuthorityCount; i++ {
+		sid += fmt.Sprintf("-%d", binary.LittleEndian.Uint32(b[8+4*i:]))
+	}
+	return sid, nil
 }
 
 const backendHelp = `
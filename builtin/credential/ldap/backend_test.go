@@ -1,14 +1,25 @@
 package ldap
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
+	"math/big"
+	"net"
 	"reflect"
 	"sort"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/vault/helper/logformat"
 	"github.com/hashicorp/vault/logical"
 	logicaltest "github.com/hashicorp/vault/logical/testing"
+	log "github.com/mgutz/logxi/v1"
 	"github.com/mitchellh/mapstructure"
 )
 
@@ -257,6 +268,19 @@ func TestBackend_configDefaultsAfterUpdate(t *testing.T) {
 						t.Errorf("Default mismatch: userattr. Expected: '%s', received :'%s'", defaultUserAttr, cfg["userattr"])
 					}
 
+					defaultUserFilter := "({{.UserAttr}}={{.Username}})"
+					if cfg["userfilter"] != defaultUserFilter {
+						t.Errorf("Default mismatch: userfilter. Expected: '%s', received :'%s'", defaultUserFilter, cfg["userfilter"])
+					}
+
+					if cfg["use_token_groups"] != false {
+						t.Errorf("Default mismatch: use_token_groups. Expected: false, received :'%v'", cfg["use_token_groups"])
+					}
+
+					if cfg["connection_timeout"] != 30 || cfg["request_timeout"] != 90 {
+						t.Errorf("Default mismatch: timeouts. Expected: 30 and 90, received :'%v' and '%v'", cfg["connection_timeout"], cfg["request_timeout"])
+					}
+
 					defaultDenyNullBind := true
 					if cfg["deny_null_bind"] != defaultDenyNullBind {
 						t.Errorf("Default mismatch: deny_null_bind. Expected: '%s', received :'%s'", defaultDenyNullBind, cfg["deny_null_bind"])
@@ -489,6 +513,239 @@ func TestLDAPEscape(t *testing.T) {
 	}
 }
 
+func TestLDAPUserSearchFilter(t *testing.T) {
+	testcases := []struct {
+		filter   string
+		attr     string
+		username string
+		expected string
+	}{
+		{"", "uid", "jane", "(uid=jane)"},
+		{"({{.UserAttr}}={{.Username}})", "sAMAccountName", "jane*", "(sAMAccountName=jane\\2a)"},
+		{"(&(objectClass=user)({{.UserAttr}}={{.Username}}))", "cn", "jane (ops)", "(&(objectClass=user)(cn=jane \\28ops\\29))"},
+	}
+
+	for _, tc := range testcases {
+		res, err := renderUserSearchFilter(tc.filter, tc.attr, tc.username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != tc.expected {
+			t.Errorf("Failed to render %q: %s != %s", tc.filter, res, tc.expected)
+		}
+	}
+
+	if _, err := renderUserSearchFilter("({{.UserAttr}", "uid", "jane"); err == nil {
+		t.Fatal("expected an invalid template to fail")
+	}
+}
+
+func TestLDAPUserFilterConfig(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"userfilter": "({{.UserAttr}",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an invalid userfilter to be rejected, got %#v", resp)
+	}
+}
+
+func TestLDAPSIDBytesToString(t *testing.T) {
+	testcases := map[string][]byte{
+		// Well-known SID of the local administrators group
+		"S-1-5-32-544": {0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x05, 0x20, 0x00, 0x00, 0x00, 0x20, 0x02, 0x00, 0x00},
+		"S-1-5-21-3623811015-3361044348-30300820-1013": {
+			0x01, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x05,
+			0x15, 0x00, 0x00, 0x00,
+			0xc7, 0xf7, 0xfe, 0xd7,
+			0x7c, 0x77, 0x55, 0xc8,
+			0x94, 0x5a, 0xce, 0x01,
+			0xf5, 0x03, 0x00, 0x00,
+		},
+	}
+
+	for answer, sid := range testcases {
+		res, err := sidBytesToString(sid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res != answer {
+			t.Errorf("Failed to convert SID: %s != %s", res, answer)
+		}
+	}
+
+	if _, err := sidBytesToString([]byte{0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x05, 0x20}); err == nil {
+		t.Fatal("expected a truncated SID to fail")
+	}
+}
+
+func TestLDAPConnectionConfig(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	certPEM, keyPEM := testClientCertificate(t)
+
+	for _, data := range []map[string]interface{}{
+		{"client_tls_cert": certPEM},
+		{"client_tls_cert": certPEM, "client_tls_key": "not a key"},
+		{"connection_timeout": -1},
+		{"request_timeout": -1},
+	} {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%v: expected an error, got %#v", data, resp)
+		}
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"client_tls_cert":    certPEM,
+			"client_tls_key":     keyPEM,
+			"connection_timeout": 5,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: %v %#v", err, resp)
+	}
+	cfg, err := b.Config(&logical.Request{Storage: storage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ConnectionTimeout != 5 || cfg.RequestTimeout != 90 || cfg.ClientTLSKey != keyPEM {
+		t.Fatalf("bad: %#v", cfg)
+	}
+}
+
+func TestLDAPDialClientCertificate(t *testing.T) {
+	certPEM, keyPEM := testClientCertificate(t)
+	serverCert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The server requires a client certificate, and reports the one it
+	// received
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAnyClientCert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	clientCerts := make(chan int, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tlsConn := conn.(*tls.Conn)
+		tlsConn.Handshake()
+		clientCerts <- len(tlsConn.ConnectionState().PeerCertificates)
+	}()
+
+	cfg := &ConfigEntry{
+		Url:               "ldaps://" + listener.Addr().String(),
+		InsecureTLS:       true,
+		ClientTLSCert:     certPEM,
+		ClientTLSKey:      keyPEM,
+		ConnectionTimeout: 5,
+		RequestTimeout:    5,
+		logger:            logformat.NewVaultLogger(log.LevelTrace),
+	}
+	conn, err := cfg.DialLDAP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	select {
+	case n := <-clientCerts:
+		if n != 1 {
+			t.Fatalf("expected the client certificate, got %d certificates", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the handshake")
+	}
+}
+
+func TestLDAPDialTimeout(t *testing.T) {
+	// The server accepts connections but never completes the TLS handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	cfg := &ConfigEntry{
+		Url:               "ldaps://" + listener.Addr().String(),
+		InsecureTLS:       true,
+		ConnectionTimeout: 1,
+		RequestTimeout:    1,
+		logger:            logformat.NewVaultLogger(log.LevelTrace),
+	}
+	start := time.Now()
+	if _, err := cfg.DialLDAP(); err == nil {
+		t.Fatal("expected the connection to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("connection timeout not applied, took %s", elapsed)
+	}
+}
+
+func testClientCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "vault"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
 func testAccStepGroupList(t *testing.T, groups []string) logicaltest.TestStep {
 	return logicaltest.TestStep{
 		Operation: logical.ListOperation,
@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/fatih/structs"
 	"github.com/go-ldap/ldap"
@@ -66,6 +67,21 @@ Examples: "cn" or "memberOf", etc.
 Default: cn`,
 			},
 
+			"userfilter": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "({{.UserAttr}}={{.Username}})",
+				Description: `Go template for the LDAP user search filter (optional)
+The template can access the following context variables: UserAttr, Username
+Example: (&(objectClass=user)({{.UserAttr}}={{.Username}}))
+Default: ({{.UserAttr}}={{.Username}})`,
+			},
+
+			"use_token_groups": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Resolve the groups of Active Directory users from their "tokenGroups"
+attribute, which includes nested groups, instead of the group filter (optional)`,
+			},
+
 			"upndomain": &framework.FieldSchema{
 				Type:        framework.TypeString,
 				Description: "Enables userPrincipalDomain login with [username]@UPNDomain (optional)",
@@ -108,6 +124,33 @@ Default: cn`,
 				Default:     "tls12",
 				Description: "Maximum TLS version to use. Accepted values are 'tls10', 'tls11' or 'tls12'. Defaults to 'tls12'",
 			},
+			"client_tls_cert": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Client certificate to provide to the LDAP server, must be x509 PEM encoded (optional)",
+			},
+
+			"client_tls_key": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Private key of the client certificate, must be PEM encoded (optional)",
+			},
+
+			"connection_timeout": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Default:     30,
+				Description: "Timeout, in seconds, when connecting to a LDAP server before trying the next URL (default: 30)",
+			},
+
+			"request_timeout": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Default:     90,
+				Description: "Timeout, in seconds, of the requests made to the LDAP server (default: 90)",
+			},
+
+			"username_as_alias": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: "Use the username given at login as the display name of the tokens, instead of the value of userattr on the user object (optional)",
+			},
+
 			"deny_null_bind": &framework.FieldSchema{
 				Type:        framework.TypeBool,
 				Default:     true,
@@ -215,6 +258,20 @@ func (b *backend) newConfigEntry(d *framework.FieldData) (*ConfigEntry, error) {
 
 		cfg.GroupFilter = groupfilter
 	}
+	userfilter := d.Get("userfilter").(string)
+	if userfilter != "" {
+		// Validate the template before proceeding
+		_, err := template.New("queryTemplate").Parse(userfilter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid userfilter (%v)", err)
+		}
+
+		cfg.UserFilter = userfilter
+	}
+	useTokenGroups := d.Get("use_token_groups").(bool)
+	if useTokenGroups {
+		cfg.UseTokenGroups = useTokenGroups
+	}
 	groupattr := d.Get("groupattr").(string)
 	if groupattr != "" {
 		cfg.GroupAttr = groupattr
@@ -255,6 +312,31 @@ func (b *backend) newConfigEntry(d *framework.FieldData) (*ConfigEntry, error) {
 		return nil, fmt.Errorf("'tls_max_version' must be greater than or equal to 'tls_min_version'")
 	}
 
+	clientTLSCert := d.Get("client_tls_cert").(string)
+	clientTLSKey := d.Get("client_tls_key").(string)
+	if clientTLSCert != "" || clientTLSKey != "" {
+		if clientTLSCert == "" || clientTLSKey == "" {
+			return nil, fmt.Errorf("both client_tls_cert and client_tls_key must be set")
+		}
+		if _, err := tls.X509KeyPair([]byte(clientTLSCert), []byte(clientTLSKey)); err != nil {
+			return nil, fmt.Errorf("failed to parse client X509 key pair: %v", err)
+		}
+		cfg.ClientTLSCert = clientTLSCert
+		cfg.ClientTLSKey = clientTLSKey
+	}
+	cfg.ConnectionTimeout = d.Get("connection_timeout").(int)
+	if cfg.ConnectionTimeout <= 0 {
+		return nil, fmt.Errorf("'connection_timeout' must be positive")
+	}
+	cfg.RequestTimeout = d.Get("request_timeout").(int)
+	if cfg.RequestTimeout <= 0 {
+		return nil, fmt.Errorf("'request_timeout' must be positive")
+	}
+	usernameAsAlias := d.Get("username_as_alias").(bool)
+	if usernameAsAlias {
+		cfg.UsernameAsAlias = usernameAsAlias
+	}
+
 	startTLS := d.Get("starttls").(bool)
 	if startTLS {
 		cfg.StartTLS = startTLS
@@ -300,23 +382,30 @@ func (b *backend) pathConfigWrite(
 }
 
 type ConfigEntry struct {
-	logger        log.Logger
-	Url           string `json:"url" structs:"url" mapstructure:"url"`
-	UserDN        string `json:"userdn" structs:"userdn" mapstructure:"userdn"`
-	GroupDN       string `json:"groupdn" structs:"groupdn" mapstructure:"groupdn"`
-	GroupFilter   string `json:"groupfilter" structs:"groupfilter" mapstructure:"groupfilter"`
-	GroupAttr     string `json:"groupattr" structs:"groupattr" mapstructure:"groupattr"`
-	UPNDomain     string `json:"upndomain" structs:"upndomain" mapstructure:"upndomain"`
-	UserAttr      string `json:"userattr" structs:"userattr" mapstructure:"userattr"`
-	Certificate   string `json:"certificate" structs:"certificate" mapstructure:"certificate"`
-	InsecureTLS   bool   `json:"insecure_tls" structs:"insecure_tls" mapstructure:"insecure_tls"`
-	StartTLS      bool   `json:"starttls" structs:"starttls" mapstructure:"starttls"`
-	BindDN        string `json:"binddn" structs:"binddn" mapstructure:"binddn"`
-	BindPassword  string `json:"bindpass" structs:"bindpass" mapstructure:"bindpass"`
-	DenyNullBind  bool   `json:"deny_null_bind" structs:"deny_null_bind" mapstructure:"deny_null_bind"`
-	DiscoverDN    bool   `json:"discoverdn" structs:"discoverdn" mapstructure:"discoverdn"`
-	TLSMinVersion string `json:"tls_min_version" structs:"tls_min_version" mapstructure:"tls_min_version"`
-	TLSMaxVersion string `json:"tls_max_version" structs:"tls_max_version" mapstructure:"tls_max_version"`
+	logger            log.Logger
+	Url               string `json:"url" structs:"url" mapstructure:"url"`
+	UserDN            string `json:"userdn" structs:"userdn" mapstructure:"userdn"`
+	GroupDN           string `json:"groupdn" structs:"groupdn" mapstructure:"groupdn"`
+	GroupFilter       string `json:"groupfilter" structs:"groupfilter" mapstructure:"groupfilter"`
+	GroupAttr         string `json:"groupattr" structs:"groupattr" mapstructure:"groupattr"`
+	UserFilter        string `json:"userfilter" structs:"userfilter" mapstructure:"userfilter"`
+	UseTokenGroups    bool   `json:"use_token_groups" structs:"use_token_groups" mapstructure:"use_token_groups"`
+	UPNDomain         string `json:"upndomain" structs:"upndomain" mapstructure:"upndomain"`
+	UserAttr          string `json:"userattr" structs:"userattr" mapstructure:"userattr"`
+	Certificate       string `json:"certificate" structs:"certificate" mapstructure:"certificate"`
+	InsecureTLS       bool   `json:"insecure_tls" structs:"insecure_tls" mapstructure:"insecure_tls"`
+	StartTLS          bool   `json:"starttls" structs:"starttls" mapstructure:"starttls"`
+	BindDN            string `json:"binddn" structs:"binddn" mapstructure:"binddn"`
+	BindPassword      string `json:"bindpass" structs:"bindpass" mapstructure:"bindpass"`
+	DenyNullBind      bool   `json:"deny_null_bind" structs:"deny_null_bind" mapstructure:"deny_null_bind"`
+	DiscoverDN        bool   `json:"discoverdn" structs:"discoverdn" mapstructure:"discoverdn"`
+	TLSMinVersion     string `json:"tls_min_version" structs:"tls_min_version" mapstructure:"tls_min_version"`
+	TLSMaxVersion     string `json:"tls_max_version" structs:"tls_max_version" mapstructure:"tls_max_version"`
+	ClientTLSCert     string `json:"client_tls_cert" structs:"client_tls_cert" mapstructure:"client_tls_cert"`
+	ClientTLSKey      string `json:"client_tls_key" structs:"client_tls_key" mapstructure:"client_tls_key"`
+	ConnectionTimeout int    `json:"connection_timeout" structs:"connection_timeout" mapstructure:"connection_timeout"`
+	RequestTimeout    int    `json:"request_timeout" structs:"request_timeout" mapstructure:"request_timeout"`
+	UsernameAsAlias   bool   `json:"username_as_alias" structs:"username_as_alias" mapstructure:"username_as_alias"`
 }
 
 func (c *ConfigEntry) GetTLSConfig(host string) (*tls.Config, error) {
@@ -351,6 +440,13 @@ func (c *ConfigEntry) GetTLSConfig(host string) (*tls.Config, error) {
 		}
 		tlsConfig.RootCAs = caPool
 	}
+	if c.ClientTLSCert != "" && c.ClientTLSKey != "" {
+		certificate, err := tls.X509KeyPair([]byte(c.ClientTLSCert), []byte(c.ClientTLSKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse client X509 key pair: %v", err)
+		}
+		tlsConfig.Certificates = append(tlsConfig.Certificates, certificate)
+	}
 	return tlsConfig, nil
 }
 
@@ -375,7 +471,7 @@ func (c *ConfigEntry) DialLDAP() (*ldap.Conn, error) {
 			if port == "" {
 				port = "389"
 			}
-			conn, err = ldap.Dial("tcp", net.JoinHostPort(host, port))
+			conn, err = c.dial(net.JoinHostPort(host, port), nil)
 			if err != nil {
 				break
 			}
@@ -398,11 +494,16 @@ func (c *ConfigEntry) DialLDAP() (*ldap.Conn, error) {
 			if err != nil {
 				break
 			}
-			conn, err = ldap.DialTLS("tcp", net.JoinHostPort(host, port), tlsConfig)
+			conn, err = c.dial(net.JoinHostPort(host, port), tlsConfig)
 		default:
 			retErr = multierror.Append(retErr, fmt.Errorf("invalid LDAP scheme in url %q", net.JoinHostPort(host, port)))
 			continue
 		}
+		if err != nil && conn != nil {
+			// The StartTLS command failed on an established connection
+			conn.Close()
+			conn = nil
+		}
 		if err == nil {
 			if retErr != nil {
 				if c.logger.IsDebug() {
@@ -418,6 +519,35 @@ func (c *ConfigEntry) DialLDAP() (*ldap.Conn, error) {
 	return conn, retErr.ErrorOrNil()
 }
 
+// dial connects to a LDAP server within the connection timeout, over TLS
+// when tlsConfig is set, and sets the request timeout of the connection
+func (c *ConfigEntry) dial(addr string, tlsConfig *tls.Config) (*ldap.Conn, error) {
+	timeout := time.Duration(c.ConnectionTimeout) * time.Second
+	netConn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	isTLS := tlsConfig != nil
+	if isTLS {
+		tlsConn := tls.Client(netConn, tlsConfig)
+		if timeout > 0 {
+			tlsConn.SetDeadline(time.Now().Add(timeout))
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+		tlsConn.SetDeadline(time.Time{})
+		netConn = tlsConn
+	}
+
+	conn := ldap.NewConn(netConn, isTLS)
+	conn.Start()
+	conn.SetTimeout(time.Duration(c.RequestTimeout) * time.Second)
+	return conn, nil
+}
+
 /*
  * Returns FieldData describing our ConfigEntry struct schema
  */
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -39,7 +40,7 @@ func (b *backend) pathLogin(
 	username := d.Get("username").(string)
 	password := d.Get("password").(string)
 
-	policies, resp, err := b.Login(req, username, password)
+	policies, groups, displayName, resp, err := b.Login(req, username, password)
 	// Handle an internal error
 	if err != nil {
 		return nil, err
@@ -56,7 +57,8 @@ func (b *backend) pathLogin(
 	sort.Strings(policies)
 
 	resp.Auth = &logical.Auth{
-		Policies: policies,
+		Policies:     policies,
+		GroupAliases: groups,
 		Metadata: map[string]string{
 			"username": username,
 			"policies": strings.Join(policies, ","),
@@ -64,7 +66,7 @@ func (b *backend) pathLogin(
 		InternalData: map[string]interface{}{
 			"password": password,
 		},
-		DisplayName: username,
+		DisplayName: displayName,
 		LeaseOptions: logical.LeaseOptions{
 			Renewable: true,
 		},
@@ -78,14 +80,17 @@ func (b *backend) pathLoginRenew(
 	username := req.Auth.Metadata["username"]
 	password := req.Auth.InternalData["password"].(string)
 
-	loginPolicies, resp, err := b.Login(req, username, password)
-	if len(loginPolicies) == 0 {
+	loginPolicies, loginGroups, _, resp, err := b.Login(req, username, password)
+	if err != nil || (resp != nil && resp.IsError()) {
 		return resp, err
 	}
 
 	if !policyutil.EquivalentPolicies(loginPolicies, req.Auth.Policies) {
 		return nil, fmt.Errorf("policies have changed, not renewing")
 	}
+	if (len(loginGroups) != 0 || len(req.Auth.GroupAliases) != 0) && !strutil.EquivalentSlices(loginGroups, req.Auth.GroupAliases) {
+		return nil, fmt.Errorf("groups have changed, not renewing")
+	}
 
 	return framework.LeaseExtend(0, 0, b.System())(req, d)
 }
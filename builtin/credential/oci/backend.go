@@ -0,0 +1,111 @@
+package ociauth
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	b := &backend{}
+	b.Backend = &framework.Backend{
+		Help: backendHelp,
+
+		PathsSpecial: &logical.Paths{
+			Unauthenticated: []string{
+				"login/*",
+			},
+		},
+
+		Paths: []*framework.Path{
+			pathConfig(b),
+			pathListRoles(b),
+			pathRoles(b),
+			pathLogin(b),
+		},
+
+		AuthRenew:  b.pathLoginRenew,
+		Invalidate: b.invalidate,
+	}
+
+	return b
+}
+
+type backend struct {
+	*framework.Backend
+
+	// clientLock guards the cached client, which is created from the
+	// configuration
+	clientLock sync.RWMutex
+	client     *identityClient
+}
+
+func (b *backend) invalidate(key string) {
+	switch key {
+	case "config":
+		b.resetClient()
+	}
+}
+
+// identityClient returns the client of the identity service, signing its
+// requests with the configured API key or the instance principal of the
+// Vault server
+func (b *backend) identityClient(config *ociConfig) (*identityClient, error) {
+	b.clientLock.RLock()
+	if b.client != nil {
+		defer b.clientLock.RUnlock()
+		return b.client, nil
+	}
+	b.clientLock.RUnlock()
+
+	b.clientLock.Lock()
+	defer b.clientLock.Unlock()
+
+	// Check again, as the client may have been created while waiting for the
+	// lock
+	if b.client != nil {
+		return b.client, nil
+	}
+
+	endpoint := config.endpoint()
+	var keys keyProvider
+	if config.UserID != "" {
+		key, err := parsePrivateKey([]byte(config.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the private key: %s", err)
+		}
+		keys = &apiKeyProvider{
+			tenancyID:   config.HomeTenancyID,
+			userID:      config.UserID,
+			fingerprint: config.Fingerprint,
+			key:         key,
+		}
+	} else {
+		keys = newInstancePrincipalProvider(endpoint)
+	}
+	b.client = newIdentityClient(endpoint, keys)
+
+	return b.client, nil
+}
+
+func (b *backend) resetClient() {
+	b.clientLock.Lock()
+	defer b.clientLock.Unlock()
+	b.client = nil
+}
+
+const backendHelp = `
+The OCI credential provider allows authentication of Oracle Cloud
+Infrastructure instance principals and users with signed requests.
+
+Clients sign a login request with the key of their instance principal or of
+their API key, and Vault has the identity service authenticate the signature.
+Roles bind the compartments of instances, and the groups and dynamic groups
+of the principals, to policies.
+`
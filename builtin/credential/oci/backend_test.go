@@ -0,0 +1,392 @@
+package ociauth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+const testTenancyID = "ocid1.tenancy.oc1..test"
+
+func createBackendWithStorage(t *testing.T) (*backend, logical.Storage) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView
+}
+
+func testRequest(t *testing.T, b *backend, s logical.Storage, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       path,
+		MountPoint: "auth/oci/",
+		Storage:    s,
+		Data:       data,
+	})
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return resp
+}
+
+func testKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func keyPEM(key *rsa.PrivateKey) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+var authorizationRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// verifySignedHeaders verifies the OCI signature of the headers, as the
+// identity service does, and returns its key ID
+func verifySignedHeaders(headers map[string][]string, keys map[string]*rsa.PublicKey) (string, error) {
+	lower := make(map[string]string, len(headers))
+	for name, values := range headers {
+		lower[strings.ToLower(name)] = strings.Join(values, ", ")
+	}
+	params := map[string]string{}
+	for _, match := range authorizationRegexp.FindAllStringSubmatch(lower["authorization"], -1) {
+		params[match[1]] = match[2]
+	}
+	key, ok := keys[params["keyId"]]
+	if !ok {
+		return "", fmt.Errorf("unknown key %q", params["keyId"])
+	}
+
+	var lines []string
+	for _, name := range strings.Fields(params["headers"]) {
+		lines = append(lines, name+": "+lower[name])
+	}
+	sig, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil {
+		return "", err
+	}
+	hashed := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], sig); err != nil {
+		return "", errors.New("invalid signature")
+	}
+	return params["keyId"], nil
+}
+
+// requestHeaders returns the headers of a request received by a test
+// server, with the pseudo headers
+func requestHeaders(r *http.Request) map[string][]string {
+	headers := map[string][]string{
+		"(request-target)": {requestTarget(r.Method, r.URL.RequestURI())},
+		"host":             {r.Host},
+	}
+	for name, values := range r.Header {
+		headers[name] = values
+	}
+	return headers
+}
+
+// testIdentityService is a fake identity service, authenticating the
+// clients signing with the keys
+type testIdentityService struct {
+	*httptest.Server
+	vaultKeys  map[string]*rsa.PublicKey
+	clientKeys map[string]*rsa.PublicKey
+	principals map[string]*principal
+	groups     map[string][]string
+}
+
+func newTestIdentityService(t *testing.T) *testIdentityService {
+	s := &testIdentityService{
+		vaultKeys:  map[string]*rsa.PublicKey{},
+		clientKeys: map[string]*rsa.PublicKey{},
+		principals: map[string]*principal{},
+		groups:     map[string][]string{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		hash := sha256.Sum256(body)
+		if r.Header.Get("x-content-sha256") != base64.StdEncoding.EncodeToString(hash[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if _, err := verifySignedHeaders(requestHeaders(r), s.vaultKeys); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/authentication/authenticateClient":
+			var req struct {
+				RequestHeaders map[string][]string `json:"requestHeaders"`
+			}
+			json.Unmarshal(body, &req)
+			keyID, err := verifySignedHeaders(req.RequestHeaders, s.clientKeys)
+			if err != nil {
+				json.NewEncoder(w).Encode(map[string]interface{}{"errorMessage": err.Error()})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"principal": s.principals[keyID]})
+
+		case "/v1/filterGroupMembership":
+			var req struct {
+				Principal principal `json:"principal"`
+				GroupIDs  []string  `json:"groupIds"`
+			}
+			json.Unmarshal(body, &req)
+			var result []string
+			for _, group := range s.groups[req.Principal.SubjectID] {
+				for _, id := range req.GroupIDs {
+					if id == group {
+						result = append(result, id)
+					}
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"groupIds": result})
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return s
+}
+
+func TestBackend_Login(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	service := newTestIdentityService(t)
+	defer service.Close()
+
+	vaultKey := testKey(t)
+	service.vaultKeys[testTenancyID+"/ocid1.user.vault/aa:bb"] = &vaultKey.PublicKey
+	clientKey := testKey(t)
+	clientKeyID := testTenancyID + "/ocid1.user.alice/cc:dd"
+	service.clientKeys[clientKeyID] = &clientKey.PublicKey
+	service.principals[clientKeyID] = &principal{
+		TenantID:  testTenancyID,
+		SubjectID: "ocid1.user.alice",
+		Claims:    []claim{{Key: claimPrincipalType, Value: "user"}},
+	}
+	service.groups["ocid1.user.alice"] = []string{"ocid1.group.devs"}
+
+	resp := testRequest(t, b, storage, "config", map[string]interface{}{
+		"home_tenancy_id":   testTenancyID,
+		"identity_endpoint": service.URL,
+		"user_id":           "ocid1.user.vault",
+		"fingerprint":       "aa:bb",
+		"private_key":       keyPEM(vaultKey),
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = testRequest(t, b, storage, "role/dev", map[string]interface{}{
+		"bound_group_ids": "ocid1.group.devs,ocid1.group.ops",
+		"policies":        "dev",
+		"ttl":             "1h",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	headers, err := loginHeaders("https://vault.example.com", "oci", "dev", clientKeyID, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = testRequest(t, b, storage, "login/dev", map[string]interface{}{
+		"request_headers": headers,
+	})
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if !reflect.DeepEqual(resp.Auth.Policies, []string{"default", "dev"}) {
+		t.Fatalf("bad: %#v", resp.Auth.Policies)
+	}
+	expectedMetadata := map[string]string{
+		"role":           "dev",
+		"tenancy_id":     testTenancyID,
+		"principal_id":   "ocid1.user.alice",
+		"principal_type": "user",
+		"compartment_id": "",
+	}
+	if !reflect.DeepEqual(resp.Auth.Metadata, expectedMetadata) {
+		t.Fatalf("bad: %#v", resp.Auth.Metadata)
+	}
+
+	// The signature is only valid for the role it was made for
+	resp = testRequest(t, b, storage, "login/ops", map[string]interface{}{
+		"request_headers": headers,
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for the wrong role: %#v", resp)
+	}
+
+	// Tampered headers are rejected by the identity service
+	tampered := make(map[string][]string, len(headers))
+	for name, values := range headers {
+		tampered[name] = values
+	}
+	tampered["date"] = []string{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)}
+	resp = testRequest(t, b, storage, "login/dev", map[string]interface{}{
+		"request_headers": tampered,
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for the tampered headers: %#v", resp)
+	}
+
+	// Principals must be members of a bound group
+	service.groups["ocid1.user.alice"] = []string{"ocid1.group.other"}
+	resp = testRequest(t, b, storage, "login/dev", map[string]interface{}{
+		"request_headers": headers,
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for the unbound group: %#v", resp)
+	}
+}
+
+func TestBackend_LoginCompartment(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	service := newTestIdentityService(t)
+	defer service.Close()
+
+	vaultKey := testKey(t)
+	service.vaultKeys[testTenancyID+"/ocid1.user.vault/aa:bb"] = &vaultKey.PublicKey
+	clientKey := testKey(t)
+	service.clientKeys["ST$token"] = &clientKey.PublicKey
+	service.principals["ST$token"] = &principal{
+		TenantID:  testTenancyID,
+		SubjectID: "ocid1.instance.web",
+		Claims: []claim{
+			{Key: claimPrincipalType, Value: principalTypeInstance},
+			{Key: claimCompartment, Value: "ocid1.compartment.web"},
+		},
+	}
+
+	testRequest(t, b, storage, "config", map[string]interface{}{
+		"home_tenancy_id":   testTenancyID,
+		"identity_endpoint": service.URL,
+		"user_id":           "ocid1.user.vault",
+		"fingerprint":       "aa:bb",
+		"private_key":       keyPEM(vaultKey),
+	})
+	testRequest(t, b, storage, "role/web", map[string]interface{}{
+		"bound_compartment_ids": "ocid1.compartment.web",
+	})
+	testRequest(t, b, storage, "role/db", map[string]interface{}{
+		"bound_compartment_ids": "ocid1.compartment.db",
+	})
+
+	headers, err := loginHeaders("https://vault.example.com", "oci", "web", "ST$token", clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := testRequest(t, b, storage, "login/web", map[string]interface{}{
+		"request_headers": headers,
+	})
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp.Auth.Metadata["compartment_id"] != "ocid1.compartment.web" {
+		t.Fatalf("bad: %#v", resp.Auth.Metadata)
+	}
+
+	headers, err = loginHeaders("https://vault.example.com", "oci", "db", "ST$token", clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = testRequest(t, b, storage, "login/db", map[string]interface{}{
+		"request_headers": headers,
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for the wrong compartment: %#v", resp)
+	}
+}
+
+func TestInstancePrincipalProvider(t *testing.T) {
+	instanceKey := testKey(t)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName:         "ocid1.instance.web",
+			OrganizationalUnit: []string{"opc-instance:ocid1.instance.web", "opc-tenant:" + testTenancyID},
+		},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &instanceKey.PublicKey, instanceKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer Oracle" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/identity/cert.pem", "/identity/intermediate.pem":
+			w.Write(certPEM)
+		case "/identity/key.pem":
+			w.Write([]byte(keyPEM(instanceKey)))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer metadata.Close()
+
+	var federations int32
+	instanceKeyID := fmt.Sprintf("%s/fed-x509/%s", testTenancyID, fingerprint(cert))
+	federation := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := verifySignedHeaders(requestHeaders(r), map[string]*rsa.PublicKey{instanceKeyID: &instanceKey.PublicKey}); err != nil || r.URL.Path != "/v1/x509" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		atomic.AddInt32(&federations, 1)
+		payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, time.Now().Add(20*time.Minute).Unix())))
+		json.NewEncoder(w).Encode(map[string]string{"token": "header." + payload + ".signature"})
+	}))
+	defer federation.Close()
+
+	p := newInstancePrincipalProvider(federation.URL)
+	p.metadataURL = metadata.URL
+	keyID, key, err := p.Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(keyID, "ST$header.") || key == nil {
+		t.Fatalf("bad: %s", keyID)
+	}
+
+	// The token is cached until it expires
+	if _, _, err := p.Key(); err != nil {
+		t.Fatal(err)
+	}
+	if federations != 1 {
+		t.Fatalf("expected 1 federation, got %d", federations)
+	}
+}
@@ -0,0 +1,115 @@
+package ociauth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/mapstructure"
+)
+
+// CLIHandler logs in with a request signed by the instance principal of the
+// compute instance the command runs on, or by an API key
+type CLIHandler struct{}
+
+func (h *CLIHandler) Auth(c *api.Client, m map[string]string) (string, error) {
+	var data struct {
+		Mount       string `mapstructure:"mount"`
+		Role        string `mapstructure:"role"`
+		AuthType    string `mapstructure:"auth_type"`
+		TenancyID   string `mapstructure:"tenancy_id"`
+		UserID      string `mapstructure:"user_id"`
+		Fingerprint string `mapstructure:"fingerprint"`
+		KeyFile     string `mapstructure:"key_file"`
+	}
+	if err := mapstructure.WeakDecode(m, &data); err != nil {
+		return "", err
+	}
+	if data.Mount == "" {
+		data.Mount = "oci"
+	}
+	if data.Role == "" {
+		return "", fmt.Errorf("role must be specified")
+	}
+
+	var keys keyProvider
+	switch data.AuthType {
+	case "", "instance":
+		keys = newInstancePrincipalProvider("")
+	case "apikey":
+		if data.TenancyID == "" || data.UserID == "" || data.Fingerprint == "" || data.KeyFile == "" {
+			return "", fmt.Errorf("tenancy_id, user_id, fingerprint and key_file must be specified")
+		}
+		keyPEM, err := ioutil.ReadFile(data.KeyFile)
+		if err != nil {
+			return "", fmt.Errorf("error reading the API key: %s", err)
+		}
+		key, err := parsePrivateKey(keyPEM)
+		if err != nil {
+			return "", fmt.Errorf("error parsing the API key: %s", err)
+		}
+		keys = &apiKeyProvider{
+			tenancyID:   data.TenancyID,
+			userID:      data.UserID,
+			fingerprint: data.Fingerprint,
+			key:         key,
+		}
+	default:
+		return "", fmt.Errorf("auth_type must be \"instance\" or \"apikey\"")
+	}
+
+	keyID, key, err := keys.Key()
+	if err != nil {
+		return "", err
+	}
+	headers, err := loginHeaders(c.Address(), data.Mount, data.Role, keyID, key)
+	if err != nil {
+		return "", err
+	}
+
+	path := fmt.Sprintf("auth/%s/login/%s", data.Mount, data.Role)
+	secret, err := c.Logical().Write(path, map[string]interface{}{
+		"request_headers": headers,
+	})
+	if err != nil {
+		return "", err
+	}
+	if secret == nil {
+		return "", fmt.Errorf("empty response from credential provider")
+	}
+
+	return secret.Auth.ClientToken, nil
+}
+
+func (h *CLIHandler) Help() string {
+	help := `
+The OCI credential provider allows you to log in with a request signed by the
+instance principal of the compute instance the command runs on, or by the API
+key of a user.
+
+    Example: vault auth -method=oci role=web
+
+Key/Value Pairs:
+
+    mount=oci                The mountpoint for the OCI credential provider.
+                             Defaults to "oci"
+
+    role=<name>              The role to log in with.
+
+    auth_type=instance       "instance" to sign with the instance principal,
+                             or "apikey" to sign with an API key.
+                             Defaults to "instance"
+
+    tenancy_id=<ocid>        The tenancy of the user of the API key.
+
+    user_id=<ocid>           The user of the API key.
+
+    fingerprint=<value>      The fingerprint of the API key.
+
+    key_file=<path>          The path of the PEM encoded private key of the
+                             API key.
+	`
+
+	return strings.TrimSpace(help)
+}
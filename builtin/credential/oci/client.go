@@ -0,0 +1,123 @@
+package ociauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+// principal is a principal authenticated by the identity service
+type principal struct {
+	TenantID  string  `json:"tenantId"`
+	SubjectID string  `json:"subjectId"`
+	Claims    []claim `json:"claims"`
+}
+
+type claim struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Issuer string `json:"issuer"`
+}
+
+// Claim returns the value of the claim of the principal
+func (p *principal) Claim(key string) string {
+	for _, c := range p.Claims {
+		if c.Key == key {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// identityClient calls the identity data plane of OCI, authenticating the
+// signed requests of clients and checking their group memberships
+type identityClient struct {
+	client   *http.Client
+	endpoint string
+	keys     keyProvider
+}
+
+func newIdentityClient(endpoint string, keys keyProvider) *identityClient {
+	client := cleanhttp.DefaultClient()
+	client.Timeout = 30 * time.Second
+	return &identityClient{
+		client:   client,
+		endpoint: endpoint,
+		keys:     keys,
+	}
+}
+
+// authenticateClient verifies the signed headers of a request of a client,
+// and returns its principal
+func (c *identityClient) authenticateClient(headers map[string][]string) (*principal, error) {
+	var result struct {
+		Principal    *principal `json:"principal"`
+		ErrorMessage string     `json:"errorMessage"`
+	}
+	if err := c.post("/v1/authentication/authenticateClient", map[string]interface{}{
+		"requestHeaders": headers,
+	}, &result); err != nil {
+		return nil, err
+	}
+	if result.Principal == nil {
+		if result.ErrorMessage != "" {
+			return nil, fmt.Errorf("failed to authenticate the request: %s", result.ErrorMessage)
+		}
+		return nil, fmt.Errorf("failed to authenticate the request")
+	}
+	return result.Principal, nil
+}
+
+// filterGroupMembership returns the groups and dynamic groups the principal
+// is a member of, among the given ones
+func (c *identityClient) filterGroupMembership(p *principal, groupIDs []string) ([]string, error) {
+	var result struct {
+		GroupIDs []string `json:"groupIds"`
+	}
+	if err := c.post("/v1/filterGroupMembership", map[string]interface{}{
+		"principal": p,
+		"groupIds":  groupIDs,
+	}, &result); err != nil {
+		return nil, err
+	}
+	return result.GroupIDs, nil
+}
+
+func (c *identityClient) post(path string, body, result interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	keyID, key, err := c.keys.Key()
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequest(http.MethodPost, c.endpoint+path, nil)
+	if err != nil {
+		return err
+	}
+	if err := signRequest(r, data, keyID, key); err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("error calling the identity service: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("error calling the identity service: %d %s %s", resp.StatusCode, apiErr.Code, apiErr.Message)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("error decoding the response of the identity service: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package ociauth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+// defaultMetadataURL is the base URL of the instance metadata service
+const defaultMetadataURL = "http://169.254.169.254/opc/v2"
+
+// keyProvider provides the key ID and the private key requests to OCI are
+// signed with
+type keyProvider interface {
+	Key() (string, *rsa.PrivateKey, error)
+}
+
+// apiKeyProvider signs requests with the API key of a user
+type apiKeyProvider struct {
+	tenancyID   string
+	userID      string
+	fingerprint string
+	key         *rsa.PrivateKey
+}
+
+func (p *apiKeyProvider) Key() (string, *rsa.PrivateKey, error) {
+	return fmt.Sprintf("%s/%s/%s", p.tenancyID, p.userID, p.fingerprint), p.key, nil
+}
+
+// instancePrincipalProvider signs requests as the instance principal of the
+// compute instance it runs on. The certificate of the instance, read from
+// the instance metadata service, is exchanged for a security token of a
+// session key with the federation endpoint of the identity service.
+type instancePrincipalProvider struct {
+	client      *http.Client
+	metadataURL string
+
+	// endpoint is the identity service endpoint the certificate is
+	// exchanged at. It defaults to the one of the region of the instance.
+	endpoint string
+
+	lock       sync.Mutex
+	token      string
+	expiration time.Time
+	sessionKey *rsa.PrivateKey
+}
+
+func newInstancePrincipalProvider(endpoint string) *instancePrincipalProvider {
+	client := cleanhttp.DefaultClient()
+	client.Timeout = 30 * time.Second
+	return &instancePrincipalProvider{
+		client:      client,
+		metadataURL: defaultMetadataURL,
+		endpoint:    endpoint,
+	}
+}
+
+func (p *instancePrincipalProvider) Key() (string, *rsa.PrivateKey, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// Tokens are refreshed shortly before they expire
+	if p.token == "" || time.Now().Add(time.Minute).After(p.expiration) {
+		if err := p.refresh(); err != nil {
+			return "", nil, err
+		}
+	}
+	return "ST$" + p.token, p.sessionKey, nil
+}
+
+// Region returns the region of the instance
+func (p *instancePrincipalProvider) Region() (string, error) {
+	region, err := p.metadata("instance/regionInfo/regionIdentifier")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(region)), nil
+}
+
+// refresh exchanges the certificate of the instance for a new security
+// token of a new session key
+func (p *instancePrincipalProvider) refresh() error {
+	certPEM, err := p.metadata("identity/cert.pem")
+	if err != nil {
+		return err
+	}
+	keyPEM, err := p.metadata("identity/key.pem")
+	if err != nil {
+		return err
+	}
+	intermediatePEM, err := p.metadata("identity/intermediate.pem")
+	if err != nil {
+		return err
+	}
+
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return fmt.Errorf("invalid instance certificate: %s", err)
+	}
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return fmt.Errorf("invalid instance key: %s", err)
+	}
+	tenancyID := certTenancyID(cert)
+	if tenancyID == "" {
+		return errors.New("instance certificate does not name its tenancy")
+	}
+
+	endpoint := p.endpoint
+	if endpoint == "" {
+		region, err := p.Region()
+		if err != nil {
+			return err
+		}
+		endpoint = identityEndpoint(region)
+	}
+
+	sessionKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&sessionKey.PublicKey)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"certificate":              pemBody(certPEM),
+		"publicKey":                base64.StdEncoding.EncodeToString(publicKey),
+		"intermediateCertificates": []string{pemBody(intermediatePEM)},
+	})
+	if err != nil {
+		return err
+	}
+
+	r, err := http.NewRequest(http.MethodPost, endpoint+"/v1/x509", nil)
+	if err != nil {
+		return err
+	}
+	keyID := fmt.Sprintf("%s/fed-x509/%s", tenancyID, fingerprint(cert))
+	if err := signRequest(r, body, keyID, key); err != nil {
+		return err
+	}
+	resp, err := p.client.Do(r)
+	if err != nil {
+		return fmt.Errorf("error requesting a security token: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error requesting a security token: unexpected status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("error decoding the security token: %s", err)
+	}
+	expiration, err := tokenExpiration(result.Token)
+	if err != nil {
+		return err
+	}
+
+	p.token = result.Token
+	p.expiration = expiration
+	p.sessionKey = sessionKey
+	return nil
+}
+
+// metadata reads a document from the instance metadata service
+func (p *instancePrincipalProvider) metadata(path string) ([]byte, error) {
+	r, err := http.NewRequest(http.MethodGet, p.metadataURL+"/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Authorization", "Bearer Oracle")
+	resp, err := p.client.Do(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the instance metadata: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error reading the instance metadata %s: unexpected status %d", path, resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// identityEndpoint returns the endpoint of the identity service of the
+// region
+func identityEndpoint(region string) string {
+	return fmt.Sprintf("https://auth.%s.oraclecloud.com", region)
+}
+
+// certTenancyID returns the tenancy named by the organizational units of an
+// instance certificate
+func certTenancyID(cert *x509.Certificate) string {
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		if strings.HasPrefix(ou, "opc-tenant:") {
+			return strings.TrimPrefix(ou, "opc-tenant:")
+		}
+	}
+	return ""
+}
+
+// fingerprint returns the SHA-1 fingerprint of the certificate, as colon
+// separated hex digits
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha1.Sum(cert.Raw)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// tokenExpiration returns the expiration of a security token, which is a
+// JWT whose signature is only checked by the identity service
+func tokenExpiration(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("invalid security token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid security token: %s", err)
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("invalid security token: %s", err)
+	}
+	return time.Unix(claims.Exp, 0), nil
+}
+
+// pemBody returns the base64 body of the first PEM block
+func pemBody(data []byte) string {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(block.Bytes)
+}
+
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// parsePrivateKey parses a PEM encoded RSA key, in PKCS #1 or PKCS #8 form
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(bytes.TrimSpace(data))
+	if block == nil {
+		return nil, errors.New("no PEM encoded key found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("key is not an RSA key")
+	}
+	return rsaKey, nil
+}
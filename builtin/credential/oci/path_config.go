@@ -0,0 +1,179 @@
+package ociauth
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `config`,
+		Fields: map[string]*framework.FieldSchema{
+			"home_tenancy_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "OCID of the tenancy whose principals can log in.",
+			},
+			"region": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Region of the identity service, such as "us-phoenix-1".`,
+			},
+			"identity_endpoint": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Endpoint of the identity service, for realms other than oraclecloud.com.
+Defaults to https://auth.<region>.oraclecloud.com.`,
+			},
+			"user_id": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `OCID of the user whose API key Vault calls the identity service with.
+Defaults to the instance principal of the Vault server.`,
+			},
+			"fingerprint": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Fingerprint of the API key of the user.",
+			},
+			"private_key": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "PEM encoded private key of the API key of the user.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+// Config returns the configuration of the backend
+func (b *backend) Config(s logical.Storage) (*ociConfig, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result ociConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	// The private key is not returned
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"home_tenancy_id":   config.HomeTenancyID,
+			"region":            config.Region,
+			"identity_endpoint": config.IdentityEndpoint,
+			"user_id":           config.UserID,
+			"fingerprint":       config.Fingerprint,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &ociConfig{}
+	}
+
+	if v, ok := d.GetOk("home_tenancy_id"); ok {
+		config.HomeTenancyID = v.(string)
+	}
+	if v, ok := d.GetOk("region"); ok {
+		config.Region = v.(string)
+	}
+	if v, ok := d.GetOk("identity_endpoint"); ok {
+		config.IdentityEndpoint = v.(string)
+	}
+	if v, ok := d.GetOk("user_id"); ok {
+		config.UserID = v.(string)
+	}
+	if v, ok := d.GetOk("fingerprint"); ok {
+		config.Fingerprint = v.(string)
+	}
+	if v, ok := d.GetOk("private_key"); ok {
+		config.PrivateKey = v.(string)
+	}
+
+	switch {
+	case config.HomeTenancyID == "":
+		return logical.ErrorResponse("home_tenancy_id is required"), nil
+	case config.Region == "" && config.IdentityEndpoint == "":
+		return logical.ErrorResponse("region or identity_endpoint is required"), nil
+	case config.UserID != "" && (config.Fingerprint == "" || config.PrivateKey == ""):
+		return logical.ErrorResponse("fingerprint and private_key are required with user_id"), nil
+	}
+	if config.UserID != "" {
+		if _, err := parsePrivateKey([]byte(config.PrivateKey)); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid private_key: %s", err)), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	b.resetClient()
+
+	return nil, nil
+}
+
+// ociConfig is the configuration of the backend
+type ociConfig struct {
+	HomeTenancyID    string `json:"home_tenancy_id"`
+	Region           string `json:"region"`
+	IdentityEndpoint string `json:"identity_endpoint"`
+	UserID           string `json:"user_id"`
+	Fingerprint      string `json:"fingerprint"`
+	PrivateKey       string `json:"private_key"`
+}
+
+// endpoint returns the endpoint of the identity service
+func (c *ociConfig) endpoint() string {
+	if c.IdentityEndpoint != "" {
+		return c.IdentityEndpoint
+	}
+	return identityEndpoint(c.Region)
+}
+
+const pathConfigHelpSyn = `
+Configures the tenancy whose principals log in.
+`
+
+const pathConfigHelpDesc = `
+The OCI backend accepts the principals of the "home_tenancy_id", whose signed
+requests are authenticated by the identity service of the "region".
+
+Vault calls the identity service as the instance principal of the compute
+instance it runs on, which must be allowed to inspect the groups and dynamic
+groups of the tenancy. Alternatively, it calls it with the API key of the
+"user_id", whose "fingerprint" and "private_key" must be set too. The private
+key is not returned when reading the configuration.
+`
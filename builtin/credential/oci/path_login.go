@@ -0,0 +1,220 @@
+package ociauth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	// claimPrincipalType and claimCompartment are the claims of the
+	// principals naming their type and, for instances, their compartment
+	claimPrincipalType = "ptype"
+	claimCompartment   = "opc-compartment"
+
+	principalTypeInstance = "instance"
+)
+
+// maxDateSkew is the maximum difference between the date of the signed
+// login request and the time of the login
+const maxDateSkew = 5 * time.Minute
+
+func pathLogin(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "login/" + framework.GenericNameRegex("role"),
+		Fields: map[string]*framework.FieldSchema{
+			"role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role to log in with.",
+			},
+			"request_headers": &framework.FieldSchema{
+				Type: framework.TypeMap,
+				Description: `Headers of the login request signed by the client, including the
+(request-target) and host pseudo headers.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLogin,
+		},
+
+		HelpSynopsis:    pathLoginHelpSyn,
+		HelpDescription: pathLoginHelpDesc,
+	}
+}
+
+func (b *backend) pathLogin(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleName := strings.ToLower(d.Get("role").(string))
+	var headers map[string][]string
+	if err := mapstructure.WeakDecode(d.Get("request_headers"), &headers); err != nil || len(headers) == 0 {
+		return logical.ErrorResponse("missing or invalid request_headers"), nil
+	}
+
+	// The signature must be made for a login to this mount and role, and
+	// be recent
+	expectedTarget := requestTarget(http.MethodGet, "/v1/"+req.MountPoint+"login/"+d.Get("role").(string))
+	if target := headers["(request-target)"]; len(target) != 1 || target[0] != expectedTarget {
+		return logical.ErrorResponse(fmt.Sprintf("request_headers must be signed for %q", expectedTarget)), nil
+	}
+	date, err := headerDate(headers)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if now := time.Now(); date.Before(now.Add(-maxDateSkew)) || date.After(now.Add(maxDateSkew)) {
+		return logical.ErrorResponse("date of the request_headers is not current"), nil
+	}
+
+	role, err := b.role(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid role name %q", roleName)), nil
+	}
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return logical.ErrorResponse("oci backend is not configured"), nil
+	}
+	client, err := b.identityClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := client.authenticateClient(headers)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if p.TenantID != config.HomeTenancyID {
+		return logical.ErrorResponse(fmt.Sprintf("tenancy %q not authorized", p.TenantID)), nil
+	}
+	if err := validatePrincipal(client, role, p); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	auth := &logical.Auth{
+		Policies: role.Policies,
+		Period:   role.Period,
+		InternalData: map[string]interface{}{
+			"role": roleName,
+		},
+		Metadata: map[string]string{
+			"role":           roleName,
+			"tenancy_id":     p.TenantID,
+			"principal_id":   p.SubjectID,
+			"principal_type": p.Claim(claimPrincipalType),
+			"compartment_id": p.Claim(claimCompartment),
+		},
+		DisplayName: p.SubjectID,
+		LeaseOptions: logical.LeaseOptions{
+			TTL:       role.TTL,
+			Renewable: true,
+		},
+	}
+
+	// If 'Period' is set, use the value of 'Period' as the TTL
+	if role.Period > time.Duration(0) {
+		auth.TTL = role.Period
+	}
+
+	return &logical.Response{
+		Auth: auth,
+	}, nil
+}
+
+func (b *backend) pathLoginRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if req.Auth == nil {
+		return nil, fmt.Errorf("request auth was nil")
+	}
+
+	roleName, _ := req.Auth.InternalData["role"].(string)
+	if roleName == "" {
+		return nil, fmt.Errorf("failed to fetch role during renewal")
+	}
+
+	// The role must still exist and grant the same policies
+	role, err := b.role(req.Storage, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate role %s during renewal: %s", roleName, err)
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role %s does not exist during renewal", roleName)
+	}
+	if !policyutil.EquivalentPolicies(role.Policies, req.Auth.Policies) {
+		return nil, fmt.Errorf("policies have changed, not renewing")
+	}
+
+	if role.Period > time.Duration(0) {
+		req.Auth.TTL = role.Period
+		return &logical.Response{Auth: req.Auth}, nil
+	}
+	return framework.LeaseExtend(role.TTL, role.MaxTTL, b.System())(req, d)
+}
+
+// headerDate returns the signed date of the request headers
+func headerDate(headers map[string][]string) (time.Time, error) {
+	for name, values := range headers {
+		if strings.ToLower(name) == "date" && len(values) == 1 {
+			date, err := http.ParseTime(values[0])
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid date in request_headers: %s", err)
+			}
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("request_headers have no date")
+}
+
+// validatePrincipal checks the compartment and the group memberships of the
+// principal against the role
+func validatePrincipal(client *identityClient, role *ociRole, p *principal) error {
+	if len(role.BoundCompartmentIDs) != 0 {
+		if p.Claim(claimPrincipalType) != principalTypeInstance {
+			return fmt.Errorf("only instance principals can log in with the role")
+		}
+		if compartment := p.Claim(claimCompartment); !strutil.StrListContains(role.BoundCompartmentIDs, compartment) {
+			return fmt.Errorf("compartment %q not authorized", compartment)
+		}
+	}
+
+	if len(role.BoundGroupIDs) != 0 {
+		groups, err := client.filterGroupMembership(p, role.BoundGroupIDs)
+		if err != nil {
+			return err
+		}
+		for _, group := range groups {
+			if strutil.StrListContains(role.BoundGroupIDs, group) {
+				return nil
+			}
+		}
+		return fmt.Errorf("principal is not a member of a bound group")
+	}
+
+	return nil
+}
+
+const pathLoginHelpSyn = `
+Authenticates a principal with a signed request.
+`
+
+const pathLoginHelpDesc = `
+The client signs a GET request to this path with the key of its instance
+principal or of its API key, as the OCI APIs require, and sends its signed
+headers as "request_headers", including the (request-target) and host pseudo
+headers. The identity service authenticates the signature, and the principal
+must then match the role.
+
+The signature is only accepted for this path, and within 5 minutes of its
+date.
+`
@@ -0,0 +1,89 @@
+package ociauth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signRequest signs the request with the HTTP signature scheme of OCI, as
+// described in https://docs.cloud.oracle.com/iaas/Content/API/Concepts/signingrequests.htm.
+// The body of requests with one is signed too.
+func signRequest(r *http.Request, body []byte, keyID string, key *rsa.PrivateKey) error {
+	r.Header.Set("date", time.Now().UTC().Format(http.TimeFormat))
+	names := []string{"date", "(request-target)", "host"}
+	if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch {
+		hash := sha256.Sum256(body)
+		r.Header.Set("x-content-sha256", base64.StdEncoding.EncodeToString(hash[:]))
+		r.Header.Set("content-length", strconv.Itoa(len(body)))
+		if r.Header.Get("content-type") == "" {
+			r.Header.Set("content-type", "application/json")
+		}
+		r.ContentLength = int64(len(body))
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		names = append(names, "content-length", "content-type", "x-content-sha256")
+	}
+
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = name + ": " + signedHeaderValue(r, name)
+	}
+	hashed := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set("authorization", fmt.Sprintf(`Signature version="1",headers="%s",keyId="%s",algorithm="rsa-sha256",signature="%s"`,
+		strings.Join(names, " "), keyID, base64.StdEncoding.EncodeToString(sig)))
+	return nil
+}
+
+// signedHeaderValue returns the value of a signed header of the request,
+// including the (request-target) pseudo header
+func signedHeaderValue(r *http.Request, name string) string {
+	switch name {
+	case "(request-target)":
+		return requestTarget(r.Method, r.URL.RequestURI())
+	case "host":
+		return r.URL.Host
+	default:
+		return r.Header.Get(name)
+	}
+}
+
+// requestTarget returns the value of the (request-target) pseudo header
+func requestTarget(method, requestURI string) string {
+	return strings.ToLower(method) + " " + requestURI
+}
+
+// loginHeaders returns the signed headers of a login request with the role
+// at the mount of the Vault server, which the client sends to Vault for it
+// to authenticate with the identity service
+func loginHeaders(vaultAddr, mount, role, keyID string, key *rsa.PrivateKey) (map[string][]string, error) {
+	r, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/v1/auth/%s/login/%s", strings.TrimSuffix(vaultAddr, "/"), mount, role), nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := signRequest(r, nil, keyID, key); err != nil {
+		return nil, err
+	}
+
+	headers := map[string][]string{
+		"(request-target)": {signedHeaderValue(r, "(request-target)")},
+		"host":             {r.URL.Host},
+	}
+	for name, values := range r.Header {
+		headers[strings.ToLower(name)] = values
+	}
+	return headers, nil
+}
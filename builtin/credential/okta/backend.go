@@ -2,6 +2,8 @@ package okta
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -34,14 +36,38 @@ func Backend() *backend {
 		AuthRenew: b.pathLoginRenew,
 	}
 
+	b.apiURL = defaultAPIURL
+	b.pushTimeout = 60 * time.Second
+	b.pushInterval = 2 * time.Second
+
 	return &b
 }
 
 type backend struct {
 	*framework.Backend
+
+	// apiURL returns the URL of the Okta API of the configuration
+	apiURL func(*ConfigEntry) string
+
+	// pushTimeout and pushInterval are how long, and how often, the result
+	// of push notifications is polled
+	pushTimeout  time.Duration
+	pushInterval time.Duration
+}
+
+// mfaParams are the parameters of the MFA challenge of a login. A nil value
+// skips the challenge, such as when renewing a token whose login completed
+// it.
+type mfaParams struct {
+	// TOTP is the passcode of a TOTP factor. The challenge is a push
+	// notification if it is empty.
+	TOTP string
+
+	// Provider is the provider of the TOTP factor
+	Provider string
 }
 
-func (b *backend) Login(req *logical.Request, username string, password string) ([]string, *logical.Response, error) {
+func (b *backend) Login(req *logical.Request, username string, password string, mfa *mfaParams) ([]string, *logical.Response, error) {
 	cfg, err := b.Config(req.Storage)
 	if err != nil {
 		return nil, nil, err
@@ -50,13 +76,26 @@ func (b *backend) Login(req *logical.Request, username string, password string)
 		return nil, logical.ErrorResponse("Okta backend not configured"), nil
 	}
 
-	client := cfg.OktaClient()
-	auth, err := client.Authenticate(username, password)
+	client := b.oktaClient(cfg)
+	auth, err := client.authenticate(username, password)
 	if err != nil {
 		return nil, logical.ErrorResponse(fmt.Sprintf("Okta auth failed: %v", err)), nil
 	}
-	if auth == nil {
-		return nil, logical.ErrorResponse("okta auth backend unexpected failure"), nil
+
+	switch auth.Status {
+	case "SUCCESS", "PASSWORD_WARN":
+	case "MFA_REQUIRED":
+		if !cfg.BypassOktaMFA && mfa != nil {
+			if err := b.verifyMFA(client, auth, mfa); err != nil {
+				return nil, logical.ErrorResponse(fmt.Sprintf("Okta auth failed: %v", err)), nil
+			}
+		}
+	case "MFA_ENROLL":
+		if !cfg.BypassOktaMFA && mfa != nil {
+			return nil, logical.ErrorResponse("Okta auth failed: the user must enroll an MFA factor"), nil
+		}
+	default:
+		return nil, logical.ErrorResponse(fmt.Sprintf("Okta auth failed: unexpected status %q", auth.Status)), nil
 	}
 
 	oktaGroups, err := b.getOktaGroups(cfg, auth.Embedded.User.ID)
@@ -116,20 +155,59 @@ func (b *backend) Login(req *logical.Request, username string, password string)
 }
 
 func (b *backend) getOktaGroups(cfg *ConfigEntry, userID string) ([]string, error) {
-	if cfg.Token != "" {
-		client := cfg.OktaClient()
-		groups, err := client.Groups(userID)
+	if cfg.Token == "" {
+		return nil, nil
+	}
+	return b.oktaClient(cfg).groups(userID)
+}
+
+// verifyMFA completes the MFA challenge of an authentication transaction,
+// with a TOTP factor if a passcode is given or else with an Okta Verify push
+// notification
+func (b *backend) verifyMFA(client *client, auth *authnResponse, mfa *mfaParams) error {
+	factorType, provider := "push", "OKTA"
+	if mfa.TOTP != "" {
+		factorType = "token:software:totp"
+		if mfa.Provider != "" {
+			provider = strings.ToUpper(mfa.Provider)
+		}
+	}
+
+	var selected *factor
+	for _, f := range auth.Embedded.Factors {
+		if f.FactorType == factorType && f.Provider == provider {
+			selected = f
+			break
+		}
+	}
+	if selected == nil {
+		if mfa.TOTP == "" {
+			return fmt.Errorf("the user has no Okta Verify push factor, a TOTP passcode is required")
+		}
+		return fmt.Errorf("the user has no TOTP factor of provider %s", provider)
+	}
+
+	deadline := time.Now().Add(b.pushTimeout)
+	for {
+		result, err := client.verifyFactor(auth.StateToken, selected.ID, mfa.TOTP)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		oktaGroups := make([]string, 0, len(*groups))
-		for _, group := range *groups {
-			oktaGroups = append(oktaGroups, group.Profile.Name)
+		switch {
+		case result.Status == "SUCCESS":
+			return nil
+		case result.FactorResult == "WAITING":
+			if time.Now().After(deadline) {
+				return fmt.Errorf("timed out waiting for the push notification to be approved")
+			}
+			time.Sleep(b.pushInterval)
+		case result.FactorResult != "":
+			return fmt.Errorf("push notification %s", strings.ToLower(result.FactorResult))
+		default:
+			return fmt.Errorf("MFA verification failed with status %q", result.Status)
 		}
-		return oktaGroups, err
 	}
-	return nil, nil
 }
 
 const backendHelp = `
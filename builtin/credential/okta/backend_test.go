@@ -1,10 +1,15 @@
 package okta
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/helper/logformat"
 	"github.com/hashicorp/vault/helper/policyutil"
@@ -172,3 +177,147 @@ func testAccLogin(t *testing.T, user, password string, keys []string) logicaltes
 		Check: logicaltest.TestCheckAuth(keys),
 	}
 }
+
+func TestBackend_MFA(t *testing.T) {
+	var pushResult atomic.Value
+	pushResult.Store("SUCCESS")
+	var pushPolls int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+
+		var body string
+		switch {
+		case r.URL.Path == "/api/v1/authn" && req["password"] != "password":
+			w.WriteHeader(http.StatusUnauthorized)
+			body = `{"errorCode": "E0000004", "errorSummary": "Authentication failed"}`
+		case r.URL.Path == "/api/v1/authn" && req["username"] == "plain":
+			body = `{"status": "SUCCESS", "_embedded": {"user": {"id": "u1"}}}`
+		case r.URL.Path == "/api/v1/authn" && req["username"] == "enroll":
+			body = `{"status": "MFA_ENROLL", "stateToken": "st", "_embedded": {"user": {"id": "u2"}}}`
+		case r.URL.Path == "/api/v1/authn":
+			body = `{"status": "MFA_REQUIRED", "stateToken": "st", "_embedded": {"user": {"id": "u3"}, "factors": [
+				{"id": "push1", "factorType": "push", "provider": "OKTA"},
+				{"id": "totp1", "factorType": "token:software:totp", "provider": "GOOGLE"}]}}`
+		case r.URL.Path == "/api/v1/authn/factors/push1/verify" && req["stateToken"] == "st":
+			// The first poll is waiting for the user
+			if atomic.AddInt32(&pushPolls, 1)%2 == 1 {
+				body = `{"status": "MFA_CHALLENGE", "factorResult": "WAITING"}`
+			} else if result := pushResult.Load().(string); result == "SUCCESS" {
+				body = `{"status": "SUCCESS", "sessionToken": "session"}`
+			} else {
+				body = `{"status": "MFA_CHALLENGE", "factorResult": "` + result + `"}`
+			}
+		case r.URL.Path == "/api/v1/authn/factors/totp1/verify" && req["stateToken"] == "st" && req["passCode"] == "123456":
+			body = `{"status": "SUCCESS", "sessionToken": "session"}`
+		case r.URL.Path == "/api/v1/authn/factors/totp1/verify":
+			w.WriteHeader(http.StatusForbidden)
+			body = `{"errorCode": "E0000068", "errorSummary": "Invalid Passcode/Answer"}`
+		case strings.HasSuffix(r.URL.Path, "/groups") && r.Header.Get("Authorization") == "SSWS token":
+			body = `[{"profile": {"name": "Engineering"}}]`
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			body = `{"errorCode": "E0000007", "errorSummary": "Not found"}`
+		}
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	b := Backend()
+	if _, err := b.Setup(&logical.BackendConfig{
+		Logger: logformat.NewVaultLogger(log.LevelTrace),
+		System: &logical.StaticSystemView{
+			DefaultLeaseTTLVal: time.Hour,
+			MaxLeaseTTLVal:     time.Hour,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	b.apiURL = func(*ConfigEntry) string { return ts.URL + "/api/v1/" }
+	b.pushInterval = time.Millisecond
+	storage := &logical.InmemStorage{}
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: op,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	login := func(username string, data map[string]interface{}) *logical.Response {
+		data["password"] = "password"
+		return request(logical.UpdateOperation, "login/"+username, data)
+	}
+
+	request(logical.CreateOperation, "config", map[string]interface{}{
+		"organization": "example",
+		"token":        "token",
+	})
+	request(logical.UpdateOperation, "groups/Engineering", map[string]interface{}{
+		"policies": "eng",
+	})
+
+	if resp := login("plain", map[string]interface{}{}); resp == nil || resp.IsError() || !policyutil.EquivalentPolicies(resp.Auth.Policies, []string{"eng"}) {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp := request(logical.UpdateOperation, "login/plain", map[string]interface{}{"password": "wrong"}); resp == nil || !strings.Contains(resp.Error().Error(), "E0000004") {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// The push notification is polled until it is approved
+	resp := login("mfa", map[string]interface{}{})
+	if resp == nil || resp.IsError() || !policyutil.EquivalentPolicies(resp.Auth.Policies, []string{"eng"}) {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if atomic.LoadInt32(&pushPolls) != 2 {
+		t.Fatalf("expected 2 polls, got %d", atomic.LoadInt32(&pushPolls))
+	}
+
+	// Renewals do not repeat the challenge
+	pushResult.Store("REJECTED")
+	renewReq := &logical.Request{
+		Operation: logical.RenewOperation,
+		Path:      "login/mfa",
+		Storage:   storage,
+		Auth:      resp.Auth,
+	}
+	renewReq.Auth.IssueTime = time.Now()
+	if resp, err := b.HandleRequest(renewReq); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: %v %#v", err, resp)
+	}
+
+	if resp := login("mfa", map[string]interface{}{}); resp == nil || !strings.Contains(resp.Error().Error(), "push notification rejected") {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// The TOTP factor of the provider is used if a passcode is given
+	if resp := login("mfa", map[string]interface{}{"totp": "123456", "provider": "google"}); resp == nil || resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp := login("mfa", map[string]interface{}{"totp": "000000", "provider": "google"}); resp == nil || !strings.Contains(resp.Error().Error(), "E0000068") {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp := login("mfa", map[string]interface{}{"totp": "123456"}); resp == nil || !strings.Contains(resp.Error().Error(), "no TOTP factor of provider OKTA") {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp := login("enroll", map[string]interface{}{}); resp == nil || !resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// The challenges are skipped when bypassing Okta MFA
+	request(logical.UpdateOperation, "config", map[string]interface{}{
+		"bypass_okta_mfa": true,
+	})
+	for _, username := range []string{"mfa", "enroll"} {
+		if resp := login(username, map[string]interface{}{}); resp == nil || resp.IsError() {
+			t.Fatalf("bad: %#v", resp)
+		}
+	}
+}
@@ -37,6 +37,12 @@ func (h *CLIHandler) Auth(c *api.Client, m map[string]string) (string, error) {
 	data := map[string]interface{}{
 		"password": password,
 	}
+	if totp, ok := m["totp"]; ok {
+		data["totp"] = totp
+	}
+	if provider, ok := m["provider"]; ok {
+		data["provider"] = provider
+	}
 
 	path := fmt.Sprintf("auth/%s/login/%s", mount, username)
 	secret, err := c.Logical().Write(path, data)
@@ -58,8 +64,13 @@ To use it, first configure it through the "config" endpoint, and then
 login by specifying username and password. If password is not provided
 on the command line, it will be read from stdin.
 
+If Okta requires MFA, approve the Okta Verify push notification, or give
+a TOTP passcode with "totp" and its provider with "provider".
+
     Example: vault auth -method=okta username=john
 
+    Example: vault auth -method=okta username=john totp=123456
+
     `
 
 	return strings.TrimSpace(help)
@@ -0,0 +1,161 @@
+package okta
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+// client is a client of the Okta authentication and users APIs
+type client struct {
+	httpClient *http.Client
+	apiURL     string
+	token      string
+}
+
+// authnResponse is the state of an authentication transaction
+type authnResponse struct {
+	Status       string `json:"status"`
+	StateToken   string `json:"stateToken"`
+	SessionToken string `json:"sessionToken"`
+	FactorResult string `json:"factorResult"`
+	Embedded     struct {
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+		Factors []*factor `json:"factors"`
+	} `json:"_embedded"`
+}
+
+// factor is an MFA factor enrolled by a user
+type factor struct {
+	ID         string `json:"id"`
+	FactorType string `json:"factorType"`
+	Provider   string `json:"provider"`
+}
+
+type group struct {
+	Profile struct {
+		Name string `json:"name"`
+	} `json:"profile"`
+}
+
+// apiError is an error returned by the Okta API
+type apiError struct {
+	ErrorCode    string `json:"errorCode"`
+	ErrorSummary string `json:"errorSummary"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s: %s", e.ErrorCode, e.ErrorSummary)
+}
+
+// defaultAPIURL returns the URL of the API of the configured organization
+func defaultAPIURL(cfg *ConfigEntry) string {
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = "okta.com"
+	}
+	return "https://" + cfg.Org + "." + baseURL + "/api/v1/"
+}
+
+// oktaClient returns a client of the API of the configured organization
+func (b *backend) oktaClient(cfg *ConfigEntry) *client {
+	return &client{
+		httpClient: cleanhttp.DefaultClient(),
+		apiURL:     b.apiURL(cfg),
+		token:      cfg.Token,
+	}
+}
+
+// authenticate starts an authentication transaction with the username and
+// password of a user
+func (c *client) authenticate(username, password string) (*authnResponse, error) {
+	var resp authnResponse
+	err := c.call("POST", "authn", map[string]interface{}{
+		"username": username,
+		"password": password,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// verifyFactor verifies a factor of the transaction. For push factors,
+// calling it again polls the result of the challenge.
+func (c *client) verifyFactor(stateToken, factorID, passCode string) (*authnResponse, error) {
+	request := map[string]interface{}{
+		"stateToken": stateToken,
+	}
+	if passCode != "" {
+		request["passCode"] = passCode
+	}
+
+	var resp authnResponse
+	if err := c.call("POST", "authn/factors/"+url.PathEscape(factorID)+"/verify", request, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// groups returns the names of the groups of a user. It requires an API
+// token.
+func (c *client) groups(userID string) ([]string, error) {
+	var groups []group
+	if err := c.call("GET", "users/"+url.PathEscape(userID)+"/groups", nil, &groups); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(groups))
+	for _, g := range groups {
+		names = append(names, g.Profile.Name)
+	}
+	return names, nil
+}
+
+func (c *client) call(method, endpoint string, request, response interface{}) error {
+	var body []byte
+	if request != nil {
+		var err error
+		if body, err = json.Marshal(request); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.apiURL, "/")+"/"+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "SSWS "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &apiError{}
+		if err := json.Unmarshal(respBody, apiErr); err != nil || apiErr.ErrorCode == "" {
+			return fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, endpoint)
+		}
+		return apiErr
+	}
+
+	return json.Unmarshal(respBody, response)
+}
@@ -6,7 +6,6 @@ import (
 
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
-	"github.com/sstarcher/go-okta"
 )
 
 func pathConfig(b *backend) *framework.Path {
@@ -26,6 +25,12 @@ func pathConfig(b *backend) *framework.Path {
 				Description: `The API endpoint to use. Useful if you
 are using Okta development accounts.`,
 			},
+			"bypass_okta_mfa": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `When set, logins do not complete the MFA
+challenges Okta requires, such as when using Vault's
+own MFA.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -75,6 +80,8 @@ func (b *backend) pathConfigRead(
 		Data: map[string]interface{}{
 			"Org":     cfg.Org,
 			"BaseURL": cfg.BaseURL,
+
+			"bypass_okta_mfa": cfg.BypassOktaMFA,
 		},
 	}
 
@@ -118,6 +125,11 @@ func (b *backend) pathConfigWrite(
 		cfg.BaseURL = d.Get("base_url").(string)
 	}
 
+	bypass, ok := d.GetOk("bypass_okta_mfa")
+	if ok {
+		cfg.BypassOktaMFA = bypass.(bool)
+	}
+
 	jsonCfg, err := logical.StorageEntryJSON("config", cfg)
 	if err != nil {
 		return nil, err
@@ -139,25 +151,13 @@ func (b *backend) pathConfigExistenceCheck(
 	return cfg != nil, nil
 }
 
-// OktaClient creates a basic okta client connection
-func (c *ConfigEntry) OktaClient() *okta.Client {
-	client := okta.NewClient(c.Org)
-	if c.BaseURL != "" {
-		client.Url = c.BaseURL
-	}
-
-	if c.Token != "" {
-		client.ApiToken = c.Token
-	}
-
-	return client
-}
-
 // ConfigEntry for Okta
 type ConfigEntry struct {
 	Org     string `json:"organization"`
 	Token   string `json:"token"`
 	BaseURL string `json:"base_url"`
+
+	BypassOktaMFA bool `json:"bypass_okta_mfa"`
 }
 
 const pathConfigHelp = `
@@ -23,6 +23,17 @@ func pathLogin(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: "Password for this user.",
 			},
+
+			"totp": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `TOTP passcode answering the MFA challenge.
+If not given, the challenge is an Okta Verify push notification.`,
+			},
+
+			"provider": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Provider of the TOTP factor: "OKTA" or "GOOGLE" (default: "OKTA")`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -39,7 +50,10 @@ func (b *backend) pathLogin(
 	username := d.Get("username").(string)
 	password := d.Get("password").(string)
 
-	policies, resp, err := b.Login(req, username, password)
+	policies, resp, err := b.Login(req, username, password, &mfaParams{
+		TOTP:     d.Get("totp").(string),
+		Provider: d.Get("provider").(string),
+	})
 	// Handle an internal error
 	if err != nil {
 		return nil, err
@@ -78,7 +92,8 @@ func (b *backend) pathLoginRenew(
 	username := req.Auth.Metadata["username"]
 	password := req.Auth.InternalData["password"].(string)
 
-	loginPolicies, resp, err := b.Login(req, username, password)
+	// The MFA challenge was completed at login
+	loginPolicies, resp, err := b.Login(req, username, password, nil)
 	if len(loginPolicies) == 0 {
 		return resp, err
 	}
@@ -95,5 +110,7 @@ Log in with a username and password.
 `
 
 const pathLoginDesc = `
-This endpoint authenticates using a username and password.
+This endpoint authenticates using a username and password. If Okta requires
+MFA, the login waits for an Okta Verify push notification to be approved,
+unless a TOTP passcode is given.
 `
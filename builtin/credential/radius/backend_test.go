@@ -2,11 +2,14 @@ package radius
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"reflect"
 	"testing"
 	"time"
 
+	"layeh.com/radius"
+
 	"github.com/hashicorp/vault/logical"
 	logicaltest "github.com/hashicorp/vault/logical/testing"
 )
@@ -260,3 +263,115 @@ func testAccUserLoginPolicy(t *testing.T, user string, data map[string]interface
 		},
 	}
 }
+
+func TestBackend_challenge(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &radius.Server{
+		Secret:     []byte("test-secret"),
+		Dictionary: radius.Builtin,
+		Handler: radius.HandlerFunc(func(w radius.ResponseWriter, p *radius.Packet) {
+			username, password, _ := p.PAP()
+			state, _ := p.Value("State").([]byte)
+			switch {
+			case username == "alice" && state == nil && password == "1234":
+				// The token code is asked for after the PIN
+				stateAttr, _ := p.Dictionary.Attr("State", []byte("next-token"))
+				messageAttr, _ := p.Dictionary.Attr("Reply-Message", "Enter the next token code")
+				w.AccessChallenge(stateAttr, messageAttr)
+			case username == "alice" && string(state) == "next-token" && password == "567890":
+				w.AccessAccept()
+			default:
+				w.AccessReject()
+			}
+		}),
+	}
+	go server.Serve(pc)
+
+	b, err := Factory(&logical.BackendConfig{
+		Logger: nil,
+		System: &logical.StaticSystemView{
+			DefaultLeaseTTLVal: testSysTTL,
+			MaxLeaseTTLVal:     testSysMaxTTL,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unable to create backend: %s", err)
+	}
+	storage := &logical.InmemStorage{}
+
+	request := func(path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	request("config", map[string]interface{}{
+		"host":   "127.0.0.1",
+		"port":   pc.LocalAddr().(*net.UDPAddr).Port,
+		"secret": "test-secret",
+	})
+	request("users/alice", map[string]interface{}{
+		"policies": "foo",
+	})
+
+	resp := request("login/alice", map[string]interface{}{
+		"password": "1234",
+	})
+	if resp == nil || resp.IsError() || resp.Auth != nil {
+		t.Fatalf("expected a challenge, got %#v", resp)
+	}
+	if resp.Data["reply_message"] != "Enter the next token code" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	state := resp.Data["state"].(string)
+
+	if resp := request("login/alice", map[string]interface{}{
+		"password": "000000",
+		"state":    state,
+	}); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error, got %#v", resp)
+	}
+
+	resp = request("login/alice", map[string]interface{}{
+		"password": "567890",
+		"state":    state,
+	})
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if !reflect.DeepEqual(resp.Auth.Policies, []string{"default", "foo"}) {
+		t.Fatalf("bad: %#v", resp.Auth.Policies)
+	}
+	if _, ok := resp.Auth.InternalData["password"]; ok {
+		t.Fatal("the response to the challenge should not be stored")
+	}
+
+	// The renewal checks the policies without authenticating again
+	auth := resp.Auth
+	auth.IssueTime = time.Now()
+	renewReq := &logical.Request{
+		Operation: logical.RenewOperation,
+		Path:      "login/alice",
+		Storage:   storage,
+		Auth:      auth,
+	}
+	if resp, err := b.HandleRequest(renewReq); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: %v %#v", err, resp)
+	}
+	request("users/alice", map[string]interface{}{
+		"policies": "bar",
+	})
+	if _, err := b.HandleRequest(renewReq); err == nil {
+		t.Fatal("expected an error when the policies have changed")
+	}
+}
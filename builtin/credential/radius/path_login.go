@@ -1,6 +1,7 @@
 package radius
 
 import (
+	"encoding/base64"
 	"fmt"
 	"net"
 	"strconv"
@@ -30,7 +31,14 @@ func pathLogin(b *backend) *framework.Path {
 
 			"password": &framework.FieldSchema{
 				Type:        framework.TypeString,
-				Description: "Password for this user.",
+				Description: "Password for this user, or the response to a challenge.",
+			},
+
+			"state": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `State returned by a previous login request when the
+RADIUS server challenged it. The password is then the response to the
+challenge.`,
 			},
 		},
 
@@ -59,7 +67,15 @@ func (b *backend) pathLogin(
 		return logical.ErrorResponse("password cannot be emtpy"), nil
 	}
 
-	policies, resp, err := b.RadiusLogin(req, username, password)
+	var state []byte
+	if encoded := d.Get("state").(string); encoded != "" {
+		var err error
+		if state, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return logical.ErrorResponse("invalid state"), nil
+		}
+	}
+
+	policies, resp, err := b.RadiusLogin(req, username, password, state)
 	// Handle an internal error
 	if err != nil {
 		return nil, err
@@ -70,6 +86,17 @@ func (b *backend) pathLogin(
 			return resp, nil
 		}
 	}
+	// Handle a challenge, which must be answered by another login request
+	if policies == nil {
+		return resp, nil
+	}
+
+	internalData := map[string]interface{}{}
+	// The response to a challenge is usually a one-time code, which cannot be
+	// used to authenticate the renewals
+	if state == nil {
+		internalData["password"] = password
+	}
 
 	resp.Auth = &logical.Auth{
 		Policies: policies,
@@ -77,10 +104,8 @@ func (b *backend) pathLogin(
 			"username": username,
 			"policies": strings.Join(policies, ","),
 		},
-		InternalData: map[string]interface{}{
-			"password": password,
-		},
-		DisplayName: username,
+		InternalData: internalData,
+		DisplayName:  username,
 		LeaseOptions: logical.LeaseOptions{
 			Renewable: true,
 		},
@@ -93,14 +118,32 @@ func (b *backend) pathLoginRenew(
 	var err error
 
 	username := req.Auth.Metadata["username"]
-	password := req.Auth.InternalData["password"].(string)
 
 	var resp *logical.Response
 	var loginPolicies []string
 
-	loginPolicies, resp, err = b.RadiusLogin(req, username, password)
-	if err != nil || (resp != nil && resp.IsError()) {
-		return resp, err
+	if password, ok := req.Auth.InternalData["password"].(string); ok {
+		loginPolicies, resp, err = b.RadiusLogin(req, username, password, nil)
+		if err != nil || (resp != nil && resp.IsError()) {
+			return resp, err
+		}
+		if loginPolicies == nil {
+			return nil, fmt.Errorf("the RADIUS server challenged the authentication, not renewing")
+		}
+	} else {
+		// The login answered a challenge, so only the policies of the user
+		// are checked
+		cfg, err := b.Config(req)
+		if err != nil {
+			return nil, err
+		}
+		if cfg == nil {
+			return nil, fmt.Errorf("radius backend not configured")
+		}
+		loginPolicies, resp, err = b.userPolicies(req, cfg, username)
+		if err != nil || (resp != nil && resp.IsError()) {
+			return resp, err
+		}
 	}
 
 	if !policyutil.EquivalentPolicies(loginPolicies, req.Auth.Policies) {
@@ -110,7 +153,11 @@ func (b *backend) pathLoginRenew(
 	return framework.LeaseExtend(0, 0, b.System())(req, d)
 }
 
-func (b *backend) RadiusLogin(req *logical.Request, username string, password string) ([]string, *logical.Response, error) {
+// RadiusLogin authenticates a user against the RADIUS server. If the server
+// challenges the request, no policies are returned and the response holds
+// the state and the message of the challenge. The state is passed back
+// along with the response to the challenge as the password.
+func (b *backend) RadiusLogin(req *logical.Request, username string, password string, state []byte) ([]string, *logical.Response, error) {
 
 	cfg, err := b.Config(req)
 	if err != nil {
@@ -124,8 +171,11 @@ func (b *backend) RadiusLogin(req *logical.Request, username string, password st
 
 	packet := radius.New(radius.CodeAccessRequest, []byte(cfg.Secret))
 	packet.Add("User-Name", username)
-	packet.Add("User-Password", password)
+	packet.Add("User-Password", padPassword(password))
 	packet.Add("NAS-Port", uint32(cfg.NasPort))
+	if state != nil {
+		packet.Add("State", state)
+	}
 
 	client := radius.Client{
 		DialTimeout: time.Duration(cfg.DialTimeout) * time.Second,
@@ -135,13 +185,45 @@ func (b *backend) RadiusLogin(req *logical.Request, username string, password st
 	if err != nil {
 		return nil, logical.ErrorResponse(err.Error()), nil
 	}
-	if received.Code != radius.CodeAccessAccept {
+	switch received.Code {
+	case radius.CodeAccessAccept:
+	case radius.CodeAccessChallenge:
+		challengeState, _ := received.Value("State").([]byte)
+		if len(challengeState) == 0 {
+			return nil, logical.ErrorResponse("the authentication server sent a challenge without state"), nil
+		}
+		return nil, &logical.Response{
+			Data: map[string]interface{}{
+				"state":         base64.StdEncoding.EncodeToString(challengeState),
+				"reply_message": received.String("Reply-Message"),
+			},
+		}, nil
+	default:
 		return nil, logical.ErrorResponse("access denied by the authentication server"), nil
 	}
 
+	return b.userPolicies(req, cfg, username)
+}
+
+// padPassword pads a password with nulls to a multiple of 16 bytes, as
+// RFC 2865 requires before it is hidden in the User-Password attribute
+func padPassword(password string) []byte {
+	padded := make([]byte, (len(password)+15)/16*16)
+	if len(padded) == 0 {
+		padded = make([]byte, 16)
+	}
+	copy(padded, password)
+	return padded
+}
+
+// userPolicies returns the policies of an authenticated user
+func (b *backend) userPolicies(req *logical.Request, cfg *ConfigEntry, username string) ([]string, *logical.Response, error) {
 	var policies []string
 	// Retrieve user entry from storage
 	user, err := b.user(req.Storage, username)
+	if err != nil {
+		return nil, nil, err
+	}
 	if user == nil {
 		// No user found, check if unregistered users are allowed (unregistered_user_policies not empty)
 		if len(policyutil.SanitizePolicies(cfg.UnregisteredUserPolicies, false)) == 0 {
@@ -162,4 +244,9 @@ Log in with a username and password.
 const pathLoginDesc = `
 This endpoint authenticates using a username and password. Please be sure to
 read the note on escaping from the path-help for the 'config' endpoint.
+
+If the RADIUS server challenges the login, for instance to ask for the next
+token code, no token is returned. The response instead contains the
+"reply_message" of the server and a "state", which must be passed to another
+login request whose password is the response to the challenge.
 `
@@ -0,0 +1,61 @@
+package samlauth
+
+import (
+	"sync"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	b := &backend{
+		samlStates: make(map[string]*samlState),
+	}
+	b.Backend = &framework.Backend{
+		Help: backendHelp,
+
+		PathsSpecial: &logical.Paths{
+			Unauthenticated: []string{
+				"sso_service_url",
+				"callback",
+				"token",
+			},
+		},
+
+		Paths: []*framework.Path{
+			pathConfig(b),
+			pathListRoles(b),
+			pathRoles(b),
+			pathSSOServiceURL(b),
+			pathCallback(b),
+			pathToken(b),
+		},
+
+		AuthRenew: b.pathLoginRenew,
+	}
+
+	return b
+}
+
+type backend struct {
+	*framework.Backend
+
+	// samlStates are the pending SAML logins, by token poll ID
+	samlStatesLock sync.Mutex
+	samlStates     map[string]*samlState
+}
+
+const backendHelp = `
+The SAML credential provider allows users to log in with a SAML 2.0 identity
+provider, for IdPs which do not support OpenID Connect.
+
+Vault is a service provider of the IdP, and logins are initiated by Vault:
+the user opens the single sign-on URL of the IdP in a browser, the IdP posts
+the signed assertion to the callback of the backend, and the client which
+started the login fetches its token. Roles bind the subjects and attributes
+of the assertions to policies, and map attributes into the token metadata.
+`
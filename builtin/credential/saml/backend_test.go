@@ -0,0 +1,461 @@
+package samlauth
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	testEntityID    = "https://vault.example.com"
+	testACSURL      = "https://vault.example.com/v1/auth/saml/callback"
+	testIDPEntityID = "https://idp.example.com"
+	testIDPSSOURL   = "https://idp.example.com/sso"
+)
+
+func createBackendWithStorage(t *testing.T) (*backend, logical.Storage) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView
+}
+
+func testRequest(t *testing.T, b *backend, s logical.Storage, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return resp
+}
+
+// testIDP generates the key and self-signed certificate of an IdP
+func testIDP(t *testing.T) (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// findByID returns the element with the ID
+func findByID(e *xmlElement, id string) *xmlElement {
+	if e.Attr("ID") == id {
+		return e
+	}
+	for _, child := range e.Children {
+		if el, ok := child.(*xmlElement); ok {
+			if found := findByID(el, id); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// testSign replaces the {{signature}} placeholder of the document with an
+// enveloped signature of the element with the ID
+func testSign(t *testing.T, key *rsa.PrivateKey, doc, id string) string {
+	unsigned, err := parseXML([]byte(strings.Replace(doc, "{{signature}}", "", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(canonicalize(findByID(unsigned, id), nil, nil))
+
+	signature := fmt.Sprintf(`<ds:Signature xmlns:ds="%s"><ds:SignedInfo><ds:CanonicalizationMethod Algorithm="%s"/><ds:SignatureMethod Algorithm="%s"/><ds:Reference URI="#%s"><ds:Transforms><ds:Transform Algorithm="%s"/><ds:Transform Algorithm="%s"/></ds:Transforms><ds:DigestMethod Algorithm="%s"/><ds:DigestValue>%s</ds:DigestValue></ds:Reference></ds:SignedInfo><ds:SignatureValue>{{value}}</ds:SignatureValue></ds:Signature>`,
+		nsDSig, algExcC14N, algRSASHA256, id, algEnveloped, algExcC14N, algSHA256, base64.StdEncoding.EncodeToString(digest[:]))
+	doc = strings.Replace(doc, "{{signature}}", signature, 1)
+
+	signed, err := parseXML([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedInfo := findByID(signed, id).Child(nsDSig, "Signature").Child(nsDSig, "SignedInfo")
+	hashed := sha256.Sum256(canonicalize(signedInfo, nil, nil))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Replace(doc, "{{value}}", base64.StdEncoding.EncodeToString(sig), 1)
+}
+
+// testAssertion returns an assertion of the user with the ID, and a
+// {{signature}} placeholder
+func testAssertion(id, requestID, nameID string) string {
+	now := time.Now().UTC()
+	return fmt.Sprintf(`<saml:Assertion xmlns:saml="%s" ID="%s" Version="2.0" IssueInstant="%s">
+  <saml:Issuer>%s</saml:Issuer>{{signature}}
+  <saml:Subject>
+    <saml:NameID>%s</saml:NameID>
+    <saml:SubjectConfirmation Method="%s">
+      <saml:SubjectConfirmationData InResponseTo="%s" Recipient="%s" NotOnOrAfter="%s"/>
+    </saml:SubjectConfirmation>
+  </saml:Subject>
+  <saml:Conditions NotBefore="%s" NotOnOrAfter="%s">
+    <saml:AudienceRestriction><saml:Audience>%s</saml:Audience></saml:AudienceRestriction>
+  </saml:Conditions>
+  <saml:AttributeStatement>
+    <saml:Attribute Name="email"><saml:AttributeValue>%s</saml:AttributeValue></saml:Attribute>
+    <saml:Attribute Name="groups"><saml:AttributeValue>admins</saml:AttributeValue><saml:AttributeValue>devs</saml:AttributeValue></saml:Attribute>
+  </saml:AttributeStatement>
+</saml:Assertion>`,
+		nsSAML, id, now.Format(time.RFC3339), testIDPEntityID, nameID, confirmationBearer, requestID, testACSURL,
+		now.Add(5*time.Minute).Format(time.RFC3339), now.Add(-time.Minute).Format(time.RFC3339),
+		now.Add(5*time.Minute).Format(time.RFC3339), testEntityID, nameID)
+}
+
+// testResponse returns a response with the assertions, and a {{signature}}
+// placeholder if the assertions have none
+func testResponse(requestID string, assertions ...string) string {
+	return fmt.Sprintf(`<samlp:Response xmlns:samlp="%s" xmlns:saml="%s" ID="_response" Version="2.0" IssueInstant="%s" Destination="%s" InResponseTo="%s"><saml:Issuer>%s</saml:Issuer><samlp:Status><samlp:StatusCode Value="%s"/></samlp:Status>%s</samlp:Response>`,
+		nsSAMLP, nsSAML, time.Now().UTC().Format(time.RFC3339), testACSURL, requestID, testIDPEntityID, statusSuccess,
+		strings.Join(assertions, ""))
+}
+
+func testConfig(certPEM string) *samlConfig {
+	return &samlConfig{
+		EntityID:    testEntityID,
+		ACSURLs:     []string{testACSURL},
+		IDPEntityID: testIDPEntityID,
+		IDPSSOURL:   testIDPSSOURL,
+		IDPCert:     certPEM,
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	doc := `<a:root xmlns:a="urn:a" xmlns:b="urn:b" z="1" a:y="2"><b:child attr="x &amp; &lt;">text &gt;</b:child><c/><!-- comment --></a:root>`
+	root, err := parseXML([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<a:root xmlns:a="urn:a" z="1" a:y="2"><b:child xmlns:b="urn:b" attr="x &amp; &lt;">text &gt;</b:child><c></c></a:root>`
+	if actual := string(canonicalize(root, nil, nil)); actual != expected {
+		t.Fatalf("expected %s, got %s", expected, actual)
+	}
+
+	expected = `<a:root xmlns:a="urn:a" xmlns:b="urn:b" z="1" a:y="2"><b:child attr="x &amp; &lt;">text &gt;</b:child><c></c></a:root>`
+	if actual := string(canonicalize(root, nil, []string{"b"})); actual != expected {
+		t.Fatalf("expected %s, got %s", expected, actual)
+	}
+}
+
+func TestVerifyResponse(t *testing.T) {
+	key, certPEM := testIDP(t)
+	config := testConfig(certPEM)
+	encode := func(doc string) string {
+		return base64.StdEncoding.EncodeToString([]byte(doc))
+	}
+
+	// Signed assertion
+	signed := testSign(t, key, testAssertion("_a1", "_req", "alice"), "_a1")
+	assertion, err := verifyResponse(config, encode(testResponse("_req", signed)), "_req", testACSURL, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &samlAssertion{
+		NameID: "alice",
+		Attributes: map[string][]string{
+			"email":  {"alice"},
+			"groups": {"admins", "devs"},
+		},
+	}
+	if !reflect.DeepEqual(assertion, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, assertion)
+	}
+
+	// Signed response
+	response := testSign(t, key, strings.Replace(testResponse("_req", strings.Replace(testAssertion("_a1", "_req", "alice"), "{{signature}}", "", 1)), "</saml:Issuer>", "</saml:Issuer>{{signature}}", 1), "_response")
+	if _, err := verifyResponse(config, encode(response), "_req", testACSURL, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	otherKey, _ := testIDP(t)
+	unsigned := strings.Replace(testAssertion("_a2", "_req", "mallory"), "{{signature}}", "", 1)
+	cases := map[string]struct {
+		response  string
+		requestID string
+		now       time.Time
+	}{
+		"unsigned": {
+			response:  testResponse("_req", unsigned),
+			requestID: "_req",
+		},
+		"tampered": {
+			response:  testResponse("_req", strings.Replace(signed, "<saml:NameID>alice", "<saml:NameID>mallory", 1)),
+			requestID: "_req",
+		},
+		"untrusted key": {
+			response:  testResponse("_req", testSign(t, otherKey, testAssertion("_a1", "_req", "alice"), "_a1")),
+			requestID: "_req",
+		},
+		"other request": {
+			response:  testResponse("_other", signed),
+			requestID: "_other",
+		},
+		"wrong request": {
+			response:  testResponse("_req", signed),
+			requestID: "_other",
+		},
+		"expired": {
+			response:  testResponse("_req", signed),
+			requestID: "_req",
+			now:       time.Now().Add(time.Hour),
+		},
+		"wrapped": {
+			response:  testResponse("_req", unsigned, signed),
+			requestID: "_req",
+		},
+		"nested": {
+			response:  testResponse("_req", strings.Replace(unsigned, "</saml:Subject>", "</saml:Subject>"+signed, 1)),
+			requestID: "_req",
+		},
+	}
+	for name, tc := range cases {
+		now := tc.now
+		if now.IsZero() {
+			now = time.Now()
+		}
+		if _, err := verifyResponse(config, encode(tc.response), tc.requestID, testACSURL, now); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+
+	// The audience must be the entity ID
+	config.EntityID = "https://other.example.com"
+	if _, err := verifyResponse(config, encode(testResponse("_req", signed)), "_req", testACSURL, time.Now()); err == nil {
+		t.Fatal("expected an error for the wrong audience")
+	}
+}
+
+func TestParseIDPMetadata(t *testing.T) {
+	_, certPEM := testIDP(t)
+	block, _ := pem.Decode([]byte(certPEM))
+	doc := fmt.Sprintf(`<md:EntityDescriptor xmlns:md="%s" xmlns:ds="%s" entityID="%s"><md:IDPSSODescriptor protocolSupportEnumeration="%s"><md:KeyDescriptor use="signing"><ds:KeyInfo><ds:X509Data><ds:X509Certificate>%s</ds:X509Certificate></ds:X509Data></ds:KeyInfo></md:KeyDescriptor><md:SingleSignOnService Binding="%s" Location="https://idp.example.com/post"/><md:SingleSignOnService Binding="%s" Location="%s"/></md:IDPSSODescriptor></md:EntityDescriptor>`,
+		nsMetadata, nsDSig, testIDPEntityID, nsSAMLP, base64.StdEncoding.EncodeToString(block.Bytes), bindingHTTPPost, bindingHTTPRedirect, testIDPSSOURL)
+
+	metadata, err := parseIDPMetadata([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &idpMetadata{
+		EntityID: testIDPEntityID,
+		SSOURL:   testIDPSSOURL,
+		CertPEM:  certPEM,
+	}
+	if !reflect.DeepEqual(metadata, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, metadata)
+	}
+}
+
+func TestBackend_Login(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	key, certPEM := testIDP(t)
+
+	resp := testRequest(t, b, storage, "config", map[string]interface{}{
+		"entity_id":     testEntityID,
+		"acs_urls":      testACSURL,
+		"default_role":  "dev",
+		"idp_entity_id": testIDPEntityID,
+		"idp_sso_url":   testIDPSSOURL,
+		"idp_cert":      certPEM,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = testRequest(t, b, storage, "role/dev", map[string]interface{}{
+		"bound_attributes":   map[string]interface{}{"groups": "admins,ops"},
+		"attribute_mappings": map[string]interface{}{"email": "email"},
+		"groups_attribute":   "groups",
+		"policies":           "dev",
+		"ttl":                "1h",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	verifier := "verifier"
+	challenge := sha256.Sum256([]byte(verifier))
+	resp = testRequest(t, b, storage, "sso_service_url", map[string]interface{}{
+		"client_challenge": base64.RawURLEncoding.EncodeToString(challenge[:]),
+	})
+	if resp == nil || resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	pollID := resp.Data["token_poll_id"].(string)
+
+	// The request ID is read from the AuthnRequest, as the IdP does
+	ssoURL, err := url.Parse(resp.Data["sso_service_url"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ssoURL.Host != "idp.example.com" || ssoURL.Query().Get("RelayState") != pollID {
+		t.Fatalf("bad: %s", ssoURL)
+	}
+	deflated, err := base64.StdEncoding.DecodeString(ssoURL.Query().Get("SAMLRequest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authnRequest, err := parseXML(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !authnRequest.Is(nsSAMLP, "AuthnRequest") || authnRequest.Attr("AssertionConsumerServiceURL") != testACSURL {
+		t.Fatalf("bad: %s", request)
+	}
+	requestID := authnRequest.Attr("ID")
+
+	// The login is pending until the IdP posts its response
+	resp = testRequest(t, b, storage, "token", map[string]interface{}{
+		"token_poll_id":   pollID,
+		"client_verifier": verifier,
+	})
+	if resp == nil || !resp.IsError() || resp.Data["error"] != errLoginPending {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	samlResponse := testResponse(requestID, testSign(t, key, testAssertion("_a1", requestID, "alice@example.com"), "_a1"))
+	form := url.Values{
+		"SAMLResponse": {base64.StdEncoding.EncodeToString([]byte(samlResponse))},
+		"RelayState":   {pollID},
+	}
+	resp = testRequest(t, b, storage, "callback", map[string]interface{}{
+		logical.HTTPContentType: "application/x-www-form-urlencoded",
+		logical.HTTPRawBody:     []byte(form.Encode()),
+	})
+	if resp == nil || resp.Data[logical.HTTPStatusCode] != http.StatusOK {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	resp = testRequest(t, b, storage, "token", map[string]interface{}{
+		"token_poll_id":   pollID,
+		"client_verifier": "other",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for the wrong verifier: %#v", resp)
+	}
+
+	resp = testRequest(t, b, storage, "token", map[string]interface{}{
+		"token_poll_id":   pollID,
+		"client_verifier": verifier,
+	})
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	auth := resp.Auth
+	if !reflect.DeepEqual(auth.Policies, []string{"default", "dev"}) {
+		t.Fatalf("bad: %#v", auth.Policies)
+	}
+	if !reflect.DeepEqual(auth.GroupAliases, []string{"admins", "devs"}) {
+		t.Fatalf("bad: %#v", auth.GroupAliases)
+	}
+	expectedMetadata := map[string]string{
+		"role":    "dev",
+		"name_id": "alice@example.com",
+		"email":   "alice@example.com",
+	}
+	if !reflect.DeepEqual(auth.Metadata, expectedMetadata) {
+		t.Fatalf("bad: %#v", auth.Metadata)
+	}
+	if auth.DisplayName != "alice@example.com" || auth.TTL != time.Hour {
+		t.Fatalf("bad: %#v", auth)
+	}
+
+	// The token can only be fetched once
+	resp = testRequest(t, b, storage, "token", map[string]interface{}{
+		"token_poll_id":   pollID,
+		"client_verifier": verifier,
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for the consumed login: %#v", resp)
+	}
+}
+
+func TestBackend_LoginBoundAttributes(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	key, certPEM := testIDP(t)
+
+	testRequest(t, b, storage, "config", map[string]interface{}{
+		"entity_id":     testEntityID,
+		"acs_urls":      testACSURL,
+		"idp_entity_id": testIDPEntityID,
+		"idp_sso_url":   testIDPSSOURL,
+		"idp_cert":      certPEM,
+	})
+	resp := testRequest(t, b, storage, "role/ops", map[string]interface{}{
+		"bound_subjects":      "*@example.com",
+		"bound_subjects_type": "glob",
+		"bound_attributes":    map[string]interface{}{"groups": "ops"},
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	challenge := sha256.Sum256([]byte("verifier"))
+	resp = testRequest(t, b, storage, "sso_service_url", map[string]interface{}{
+		"role":             "ops",
+		"client_challenge": base64.RawURLEncoding.EncodeToString(challenge[:]),
+	})
+	if resp == nil || resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	pollID := resp.Data["token_poll_id"].(string)
+	requestID := b.samlState(pollID).requestID
+
+	samlResponse := testResponse(requestID, testSign(t, key, testAssertion("_a1", requestID, "alice@example.com"), "_a1"))
+	resp = testRequest(t, b, storage, "callback", map[string]interface{}{
+		"SAMLResponse": base64.StdEncoding.EncodeToString([]byte(samlResponse)),
+		"RelayState":   pollID,
+	})
+	if resp == nil || resp.Data[logical.HTTPStatusCode] != http.StatusForbidden {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	resp = testRequest(t, b, storage, "token", map[string]interface{}{
+		"token_poll_id":   pollID,
+		"client_verifier": "verifier",
+	})
+	if resp == nil || !resp.IsError() || resp.Data["error"] == errLoginPending {
+		t.Fatalf("expected the login to fail: %#v", resp)
+	}
+}
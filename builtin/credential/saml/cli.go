@@ -0,0 +1,139 @@
+package samlauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/mitchellh/mapstructure"
+)
+
+// pollInterval is how often the CLI polls for the token of a login
+const pollInterval = 2 * time.Second
+
+// CLIHandler logs in with SAML. It opens the single sign-on URL of the IdP in
+// a browser, and polls for the token until the IdP has posted its response
+// to the callback of the backend.
+type CLIHandler struct{}
+
+func (h *CLIHandler) Auth(c *api.Client, m map[string]string) (string, error) {
+	var data struct {
+		Mount  string `mapstructure:"mount"`
+		Role   string `mapstructure:"role"`
+		ACSURL string `mapstructure:"acs_url"`
+	}
+	if err := mapstructure.WeakDecode(m, &data); err != nil {
+		return "", err
+	}
+	if data.Mount == "" {
+		data.Mount = "saml"
+	}
+
+	// Only this client can fetch the token, with the verifier of the
+	// challenge
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	verifier := base64.RawURLEncoding.EncodeToString(raw)
+	challenge := sha256.Sum256([]byte(verifier))
+
+	secret, err := c.Logical().Write(fmt.Sprintf("auth/%s/sso_service_url", data.Mount), map[string]interface{}{
+		"role":             data.Role,
+		"acs_url":          data.ACSURL,
+		"client_challenge": base64.RawURLEncoding.EncodeToString(challenge[:]),
+	})
+	if err != nil {
+		return "", err
+	}
+	if secret == nil {
+		return "", fmt.Errorf("empty response from credential provider")
+	}
+	ssoURL, _ := secret.Data["sso_service_url"].(string)
+	pollID, _ := secret.Data["token_poll_id"].(string)
+	if ssoURL == "" || pollID == "" {
+		return "", fmt.Errorf("no sso_service_url in the response from credential provider")
+	}
+
+	fmt.Fprintf(os.Stderr, "Complete the login via your SAML IdP. Launching browser to:\n\n    %s\n\n", ssoURL)
+	if err := openURL(ssoURL); err != nil {
+		fmt.Fprintf(os.Stderr, "Error attempting to automatically open browser: '%s'.\nPlease visit the single sign-on URL manually.\n", err)
+	}
+	fmt.Fprintf(os.Stderr, "Waiting for SAML authentication to complete...\n")
+
+	sigintCh := make(chan os.Signal, 1)
+	signal.Notify(sigintCh, os.Interrupt)
+	defer signal.Stop(sigintCh)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-sigintCh:
+			return "", fmt.Errorf("interrupted")
+		}
+
+		secret, err := c.Logical().Write(fmt.Sprintf("auth/%s/token", data.Mount), map[string]interface{}{
+			"token_poll_id":   pollID,
+			"client_verifier": verifier,
+		})
+		if err != nil {
+			if strings.Contains(err.Error(), errLoginPending) {
+				continue
+			}
+			return "", err
+		}
+		if secret == nil || secret.Auth == nil {
+			return "", fmt.Errorf("empty response from credential provider")
+		}
+		return secret.Auth.ClientToken, nil
+	}
+}
+
+// openURL opens the URL in the default browser
+func openURL(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
+
+func (h *CLIHandler) Help() string {
+	help := `
+The SAML credential provider allows you to log in with a SAML IdP through
+your browser. The IdP posts its response to the callback of the backend, and
+the CLI polls Vault until the login completes.
+
+    Example: vault auth -method=saml role=dev
+
+Key/Value Pairs:
+
+    mount=saml       The mountpoint for the SAML credential provider.
+                     Defaults to "saml"
+
+    role=<name>      The role to log in with. Defaults to the default_role
+                     of the configuration.
+
+    acs_url=<url>    The assertion consumer service URL the IdP posts its
+                     response to. Defaults to the only acs_urls of the
+                     configuration.
+	`
+
+	return strings.TrimSpace(help)
+}
@@ -0,0 +1,219 @@
+package samlauth
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// maxMetadataSize is the maximum size of the metadata of IdPs
+const maxMetadataSize = 1 << 20
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `config`,
+		Fields: map[string]*framework.FieldSchema{
+			"entity_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Entity ID of Vault as a SAML service provider, which the assertions must be intended for.",
+			},
+			"acs_urls": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma separated list of the assertion consumer service URLs the IdP may post
+responses to, such as https://vault.example.com/v1/auth/saml/callback.`,
+			},
+			"default_role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Role used when logging in without a role.",
+			},
+			"idp_metadata_url": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "URL of the metadata of the IdP, which its entity ID, single sign-on URL and certificates are read from.",
+			},
+			"idp_entity_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Entity ID of the IdP, which the assertions must be issued by.",
+			},
+			"idp_sso_url": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "URL of the single sign-on service of the IdP, with the HTTP-Redirect binding.",
+			},
+			"idp_cert": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "PEM encoded certificates of the IdP, verifying the signatures of the assertions.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+// Config returns the configuration of the backend
+func (b *backend) Config(s logical.Storage) (*samlConfig, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result samlConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"entity_id":        config.EntityID,
+			"acs_urls":         config.ACSURLs,
+			"default_role":     config.DefaultRole,
+			"idp_metadata_url": config.IDPMetadataURL,
+			"idp_entity_id":    config.IDPEntityID,
+			"idp_sso_url":      config.IDPSSOURL,
+			"idp_cert":         config.IDPCert,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &samlConfig{}
+	}
+
+	if v, ok := d.GetOk("entity_id"); ok {
+		config.EntityID = v.(string)
+	}
+	if v, ok := d.GetOk("acs_urls"); ok {
+		config.ACSURLs = v.([]string)
+	}
+	if v, ok := d.GetOk("default_role"); ok {
+		config.DefaultRole = v.(string)
+	}
+	if v, ok := d.GetOk("idp_metadata_url"); ok {
+		config.IDPMetadataURL = v.(string)
+	}
+	if v, ok := d.GetOk("idp_entity_id"); ok {
+		config.IDPEntityID = v.(string)
+	}
+	if v, ok := d.GetOk("idp_sso_url"); ok {
+		config.IDPSSOURL = v.(string)
+	}
+	if v, ok := d.GetOk("idp_cert"); ok {
+		config.IDPCert = v.(string)
+	}
+
+	// The metadata of the IdP is read when configuring it, and supersedes
+	// the IdP parameters
+	if config.IDPMetadataURL != "" {
+		metadata, err := fetchIDPMetadata(config.IDPMetadataURL)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		config.IDPEntityID = metadata.EntityID
+		config.IDPSSOURL = metadata.SSOURL
+		config.IDPCert = metadata.CertPEM
+	}
+
+	switch {
+	case config.EntityID == "":
+		return logical.ErrorResponse("entity_id is required"), nil
+	case len(config.ACSURLs) == 0:
+		return logical.ErrorResponse("acs_urls is required"), nil
+	case config.IDPEntityID == "" || config.IDPSSOURL == "" || config.IDPCert == "":
+		return logical.ErrorResponse("idp_metadata_url, or idp_entity_id, idp_sso_url and idp_cert, are required"), nil
+	}
+	if _, err := config.certificates(); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid idp_cert: %s", err)), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// fetchIDPMetadata reads the metadata of the IdP from its URL
+func fetchIDPMetadata(url string) (*idpMetadata, error) {
+	resp, err := cleanhttp.DefaultClient().Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching the IdP metadata: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching the IdP metadata: unexpected status %d", resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching the IdP metadata: %s", err)
+	}
+	return parseIDPMetadata(data)
+}
+
+// samlConfig is the configuration of the backend
+type samlConfig struct {
+	EntityID       string   `json:"entity_id"`
+	ACSURLs        []string `json:"acs_urls"`
+	DefaultRole    string   `json:"default_role"`
+	IDPMetadataURL string   `json:"idp_metadata_url"`
+	IDPEntityID    string   `json:"idp_entity_id"`
+	IDPSSOURL      string   `json:"idp_sso_url"`
+	IDPCert        string   `json:"idp_cert"`
+}
+
+func (c *samlConfig) certificates() ([]*x509.Certificate, error) {
+	return parseCertificates(c.IDPCert)
+}
+
+const pathConfigHelpSyn = `
+Configures Vault as a SAML service provider of the IdP.
+`
+
+const pathConfigHelpDesc = `
+Vault is registered at the IdP as a service provider with its "entity_id",
+and the IdP posts the SAML responses of logins to one of the "acs_urls", the
+assertion consumer service URLs. They are normally the callback path of the
+backend, such as https://vault.example.com/v1/auth/saml/callback.
+
+The IdP is configured with the URL of its metadata, "idp_metadata_url", which
+is read when writing the configuration; or with its "idp_entity_id", the URL
+of its single sign-on service "idp_sso_url", and its signing certificates
+"idp_cert". The assertions, or the responses containing them, must be signed
+with exclusive canonicalization.
+`
@@ -0,0 +1,420 @@
+package samlauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// samlStateTTL is how long users have to complete a SAML login
+const samlStateTTL = 10 * time.Minute
+
+// errLoginPending is the error of the token path while the IdP has not yet
+// posted its response
+const errLoginPending = "login is pending"
+
+// samlState is a pending SAML login, created by the single sign-on URL
+// request, completed by the callback and consumed by the token request
+type samlState struct {
+	roleName        string
+	acsURL          string
+	requestID       string
+	clientChallenge string
+	expiration      time.Time
+
+	// auth or err are set once the IdP has posted its response
+	auth *logical.Auth
+	err  string
+}
+
+func pathSSOServiceURL(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `sso_service_url`,
+		Fields: map[string]*framework.FieldSchema{
+			"role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role to log in with. Defaults to the default_role of the configuration.",
+			},
+			"acs_url": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Assertion consumer service URL the IdP posts the response to, which must be one of the acs_urls of the configuration.",
+			},
+			"client_challenge": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Base64url encoded SHA-256 hash of the client_verifier presented to the token path.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathSSOServiceURL,
+		},
+
+		HelpSynopsis:    pathSSOServiceURLHelpSyn,
+		HelpDescription: pathSSOServiceURLHelpDesc,
+	}
+}
+
+func pathCallback(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `callback`,
+		Fields: map[string]*framework.FieldSchema{
+			"SAMLResponse": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Base64 encoded SAML response posted by the IdP.",
+			},
+			"RelayState": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Relay state posted by the IdP, which is the token poll ID of the login.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathCallback,
+		},
+
+		HelpSynopsis:    pathCallbackHelpSyn,
+		HelpDescription: pathCallbackHelpDesc,
+	}
+}
+
+func pathToken(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `token`,
+		Fields: map[string]*framework.FieldSchema{
+			"token_poll_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Token poll ID returned by the sso_service_url path.",
+			},
+			"client_verifier": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Verifier whose hash is the client_challenge of the login.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathToken,
+		},
+
+		HelpSynopsis:    pathTokenHelpSyn,
+		HelpDescription: pathTokenHelpDesc,
+	}
+}
+
+func (b *backend) pathSSOServiceURL(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return logical.ErrorResponse("saml backend is not configured"), nil
+	}
+
+	roleName := strings.ToLower(d.Get("role").(string))
+	if roleName == "" {
+		roleName = config.DefaultRole
+	}
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+	role, err := b.role(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid role name %q", roleName)), nil
+	}
+
+	acsURL := d.Get("acs_url").(string)
+	if acsURL == "" && len(config.ACSURLs) == 1 {
+		acsURL = config.ACSURLs[0]
+	}
+	if acsURL == "" {
+		return logical.ErrorResponse("missing acs_url"), nil
+	}
+	if !strutil.StrListContains(config.ACSURLs, acsURL) {
+		return logical.ErrorResponse(fmt.Sprintf("acs_url %q is not allowed by the configuration", acsURL)), nil
+	}
+
+	clientChallenge := d.Get("client_challenge").(string)
+	if clientChallenge == "" {
+		return logical.ErrorResponse("missing client_challenge"), nil
+	}
+
+	pollID, state, err := b.createSAMLState(roleName, acsURL, clientChallenge)
+	if err != nil {
+		return nil, err
+	}
+
+	ssoURL, err := authnRequestURL(config, state.requestID, acsURL, pollID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"sso_service_url": ssoURL,
+			"token_poll_id":   pollID,
+		},
+	}, nil
+}
+
+func (b *backend) pathCallback(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	// The IdP posts the response as a form, which is passed through raw
+	samlResponse := d.Get("SAMLResponse").(string)
+	relayState := d.Get("RelayState").(string)
+	if body, ok := req.Data[logical.HTTPRawBody].([]byte); ok {
+		contentType, _ := req.Data[logical.HTTPContentType].(string)
+		if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/x-www-form-urlencoded" {
+			return logical.ErrorResponse(fmt.Sprintf("unsupported content type %q", contentType)), nil
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid form: %s", err)), nil
+		}
+		samlResponse = form.Get("SAMLResponse")
+		relayState = form.Get("RelayState")
+	}
+
+	if samlResponse == "" || relayState == "" {
+		return callbackResponse(http.StatusBadRequest, "Login failed: missing SAMLResponse or RelayState."), nil
+	}
+
+	state := b.samlState(relayState)
+	if state == nil {
+		return callbackResponse(http.StatusBadRequest, "Login failed: expired or unknown login."), nil
+	}
+
+	auth, err := b.verifyLogin(req.Storage, state, samlResponse)
+	if err != nil {
+		b.completeSAMLState(relayState, nil, err.Error())
+		return callbackResponse(http.StatusForbidden, "Login failed: "+html.EscapeString(err.Error())), nil
+	}
+	b.completeSAMLState(relayState, auth, "")
+
+	return callbackResponse(http.StatusOK, "Login succeeded, you can close this window."), nil
+}
+
+// verifyLogin verifies the SAML response of a login against the
+// configuration and its role, and returns the auth of the login
+func (b *backend) verifyLogin(s logical.Storage, state *samlState, samlResponse string) (*logical.Auth, error) {
+	config, err := b.Config(s)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, fmt.Errorf("saml backend is not configured")
+	}
+	role, err := b.role(s, state.roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, fmt.Errorf("invalid role name %q", state.roleName)
+	}
+
+	assertion, err := verifyResponse(config, samlResponse, state.requestID, state.acsURL, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return roleAuth(state.roleName, role, assertion)
+}
+
+func (b *backend) pathToken(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	pollID := d.Get("token_poll_id").(string)
+	if pollID == "" {
+		return logical.ErrorResponse("missing token_poll_id"), nil
+	}
+	verifier := d.Get("client_verifier").(string)
+	if verifier == "" {
+		return logical.ErrorResponse("missing client_verifier"), nil
+	}
+
+	state := b.samlState(pollID)
+	if state == nil {
+		return logical.ErrorResponse("expired or unknown login"), nil
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(challenge[:])), []byte(state.clientChallenge)) != 1 {
+		return logical.ErrorResponse("invalid client_verifier"), nil
+	}
+	if state.auth == nil && state.err == "" {
+		return logical.ErrorResponse(errLoginPending), nil
+	}
+
+	// A completed login can only be fetched once
+	b.consumeSAMLState(pollID)
+	if state.err != "" {
+		return logical.ErrorResponse(state.err), nil
+	}
+
+	return &logical.Response{
+		Auth: state.auth,
+	}, nil
+}
+
+func (b *backend) pathLoginRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if req.Auth == nil {
+		return nil, fmt.Errorf("request auth was nil")
+	}
+
+	roleName, _ := req.Auth.InternalData["role"].(string)
+	if roleName == "" {
+		return nil, fmt.Errorf("failed to fetch role during renewal")
+	}
+
+	// The role must still exist and grant the same policies
+	role, err := b.role(req.Storage, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate role %s during renewal: %s", roleName, err)
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role %s does not exist during renewal", roleName)
+	}
+	if !policyutil.EquivalentPolicies(role.Policies, req.Auth.Policies) {
+		return nil, fmt.Errorf("policies have changed, not renewing")
+	}
+
+	if role.Period > time.Duration(0) {
+		req.Auth.TTL = role.Period
+		return &logical.Response{Auth: req.Auth}, nil
+	}
+	return framework.LeaseExtend(role.TTL, role.MaxTTL, b.System())(req, d)
+}
+
+// createSAMLState registers a pending SAML login, and prunes the expired
+// ones
+func (b *backend) createSAMLState(roleName, acsURL, clientChallenge string) (string, *samlState, error) {
+	pollID, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", nil, err
+	}
+	requestID, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", nil, err
+	}
+
+	state := &samlState{
+		roleName: roleName,
+		acsURL:   acsURL,
+		// IDs of SAML messages must not start with a digit
+		requestID:       "_" + requestID,
+		clientChallenge: clientChallenge,
+		expiration:      time.Now().Add(samlStateTTL),
+	}
+
+	b.samlStatesLock.Lock()
+	defer b.samlStatesLock.Unlock()
+
+	now := time.Now()
+	for id, s := range b.samlStates {
+		if now.After(s.expiration) {
+			delete(b.samlStates, id)
+		}
+	}
+	b.samlStates[pollID] = state
+
+	return pollID, state, nil
+}
+
+// samlState returns a copy of a pending SAML login, if it has not expired
+func (b *backend) samlState(pollID string) *samlState {
+	b.samlStatesLock.Lock()
+	defer b.samlStatesLock.Unlock()
+
+	state, ok := b.samlStates[pollID]
+	if !ok || time.Now().After(state.expiration) {
+		return nil
+	}
+	result := *state
+	return &result
+}
+
+// completeSAMLState records the outcome of the SAML response of a login. A
+// login can only be completed once.
+func (b *backend) completeSAMLState(pollID string, auth *logical.Auth, err string) {
+	b.samlStatesLock.Lock()
+	defer b.samlStatesLock.Unlock()
+
+	state, ok := b.samlStates[pollID]
+	if !ok || state.auth != nil || state.err != "" {
+		return
+	}
+	state.auth = auth
+	state.err = err
+}
+
+// consumeSAMLState removes a SAML login
+func (b *backend) consumeSAMLState(pollID string) {
+	b.samlStatesLock.Lock()
+	defer b.samlStatesLock.Unlock()
+
+	delete(b.samlStates, pollID)
+}
+
+// callbackResponse returns the page shown in the browser once the IdP has
+// posted its response
+func callbackResponse(status int, message string) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "text/html; charset=utf-8",
+			logical.HTTPRawBody:     []byte(fmt.Sprintf(callbackPage, message)),
+			logical.HTTPStatusCode:  status,
+		},
+	}
+}
+
+const callbackPage = `<!DOCTYPE html>
+<html><head><title>Vault</title></head><body><p>%s</p></body></html>
+`
+
+const pathSSOServiceURLHelpSyn = `
+Returns the URL where users log in to the IdP.
+`
+
+const pathSSOServiceURLHelpDesc = `
+This path starts a SAML login with a role. The user opens the returned single
+sign-on URL in a browser, and the IdP posts the signed response to the
+"acs_url", which must be the callback path of the backend, within 10 minutes.
+
+The client which started the login polls the "token" path with the returned
+"token_poll_id", and the verifier whose hash is the "client_challenge", until
+the login completes.
+`
+
+const pathCallbackHelpSyn = `
+Receives the SAML responses posted by the IdP.
+`
+
+const pathCallbackHelpDesc = `
+This path is the assertion consumer service of the backend, where the browser
+of the user posts the SAML response of the IdP as a form. The response is
+verified against the configuration and the role of the login, and the login
+can then be completed with the "token" path.
+`
+
+const pathTokenHelpSyn = `
+Completes a SAML login.
+`
+
+const pathTokenHelpDesc = `
+This path returns the Vault token of a SAML login, given its "token_poll_id"
+and "client_verifier". Until the IdP has posted its response, it returns a
+"login is pending" error. Each login can only be completed once.
+`
@@ -0,0 +1,362 @@
+package samlauth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	matchTypeString = "string"
+	matchTypeGlob   = "glob"
+)
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    pathRoleHelpSyn,
+		HelpDescription: pathRoleHelpDesc,
+	}
+}
+
+func pathRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+			"bound_subjects": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of subjects. If set, the NameID of the assertions must be one of them.",
+			},
+			"bound_subjects_type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     matchTypeString,
+				Description: `How the bound subjects are matched: "string" for exact matches, or "glob" for values with a leading or trailing "*".`,
+			},
+			"bound_attributes": &framework.FieldSchema{
+				Type: framework.TypeMap,
+				Description: `Map of attributes to the values they must have, as comma separated lists of
+which the attribute must match one.`,
+			},
+			"bound_attributes_type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     matchTypeString,
+				Description: `How the bound attributes are matched: "string" for exact matches, or "glob" for values with a leading or trailing "*".`,
+			},
+			"attribute_mappings": &framework.FieldSchema{
+				Type:        framework.TypeMap,
+				Description: "Map of attributes to the metadata keys they are copied to.",
+			},
+			"groups_attribute": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "If set, attribute listing the groups of the user, which are resolved to external groups.",
+			},
+			"policies": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of policies on the role.",
+			},
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Duration after which the issued tokens expire. Defaults to the mount's default TTL.",
+			},
+			"max_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Duration after which the issued tokens cannot be renewed. Defaults to the mount's maximum TTL.",
+			},
+			"period": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `If set, the issued tokens are periodic: they never expire as long as they
+are renewed within this duration.`,
+			},
+		},
+
+		ExistenceCheck: b.pathRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathRoleCreateUpdate,
+			logical.UpdateOperation: b.pathRoleCreateUpdate,
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    pathRoleHelpSyn,
+		HelpDescription: pathRoleHelpDesc,
+	}
+}
+
+// role returns the named role, or nil if it does not exist
+func (b *backend) role(s logical.Storage, name string) (*samlRole, error) {
+	entry, err := s.Get("role/" + strings.ToLower(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result samlRole
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathRoleExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	role, err := b.role(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return role != nil, nil
+}
+
+func (b *backend) pathRoleList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roles, err := req.Storage.List("role/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathRoleRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := b.role(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"bound_subjects":        role.BoundSubjects,
+			"bound_subjects_type":   role.BoundSubjectsType,
+			"bound_attributes":      role.BoundAttributes,
+			"bound_attributes_type": role.BoundAttributesType,
+			"attribute_mappings":    role.AttributeMappings,
+			"groups_attribute":      role.GroupsAttribute,
+			"policies":              role.Policies,
+			"ttl":                   int64(role.TTL / time.Second),
+			"max_ttl":               int64(role.MaxTTL / time.Second),
+			"period":                int64(role.Period / time.Second),
+		},
+	}, nil
+}
+
+func (b *backend) pathRoleDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete("role/" + strings.ToLower(d.Get("name").(string))); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathRoleCreateUpdate(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := strings.ToLower(d.Get("name").(string))
+	role, err := b.role(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role = &samlRole{
+			BoundSubjectsType:   matchTypeString,
+			BoundAttributesType: matchTypeString,
+		}
+	}
+
+	if raw, ok := d.GetOk("bound_subjects"); ok {
+		role.BoundSubjects = raw.([]string)
+	}
+	if raw, ok := d.GetOk("bound_subjects_type"); ok {
+		role.BoundSubjectsType = raw.(string)
+	}
+	if raw, ok := d.GetOk("bound_attributes"); ok {
+		var attributes map[string]string
+		if err := mapstructure.Decode(raw, &attributes); err != nil {
+			return logical.ErrorResponse("bound_attributes must map attributes to comma separated values"), nil
+		}
+		role.BoundAttributes = make(map[string][]string, len(attributes))
+		for attribute, values := range attributes {
+			role.BoundAttributes[attribute] = strutil.ParseDedupAndSortStrings(values, ",")
+		}
+	}
+	if raw, ok := d.GetOk("bound_attributes_type"); ok {
+		role.BoundAttributesType = raw.(string)
+	}
+	if raw, ok := d.GetOk("attribute_mappings"); ok {
+		var mappings map[string]string
+		if err := mapstructure.Decode(raw, &mappings); err != nil {
+			return logical.ErrorResponse("attribute_mappings must map attributes to metadata keys"), nil
+		}
+		role.AttributeMappings = mappings
+	}
+	if raw, ok := d.GetOk("groups_attribute"); ok {
+		role.GroupsAttribute = raw.(string)
+	}
+	if raw, ok := d.GetOk("policies"); ok {
+		role.Policies = policyutil.SanitizePolicies(raw.([]string), true)
+	} else if req.Operation == logical.CreateOperation {
+		role.Policies = policyutil.SanitizePolicies(nil, true)
+	}
+	if raw, ok := d.GetOk("ttl"); ok {
+		role.TTL = time.Duration(raw.(int)) * time.Second
+	}
+	if raw, ok := d.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(raw.(int)) * time.Second
+	}
+	if raw, ok := d.GetOk("period"); ok {
+		role.Period = time.Duration(raw.(int)) * time.Second
+	}
+
+	for _, matchType := range []string{role.BoundSubjectsType, role.BoundAttributesType} {
+		if matchType != matchTypeString && matchType != matchTypeGlob {
+			return logical.ErrorResponse(fmt.Sprintf("bound_subjects_type and bound_attributes_type must be %q or %q", matchTypeString, matchTypeGlob)), nil
+		}
+	}
+	if _, ok := role.BoundAttributes[""]; ok {
+		return logical.ErrorResponse("bound_attributes contains an empty attribute"), nil
+	}
+	for attribute, key := range role.AttributeMappings {
+		if key == "" || key == "role" || key == "name_id" {
+			return logical.ErrorResponse(fmt.Sprintf("invalid metadata key %q for attribute %q", key, attribute)), nil
+		}
+	}
+	if role.MaxTTL > 0 && role.TTL > role.MaxTTL {
+		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	}
+	if role.Period > b.System().MaxLeaseTTL() {
+		return logical.ErrorResponse("period cannot be greater than the mount's maximum TTL"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("role/"+name, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// samlRole binds the subjects and attributes of assertions to policies
+type samlRole struct {
+	BoundSubjects       []string            `json:"bound_subjects"`
+	BoundSubjectsType   string              `json:"bound_subjects_type"`
+	BoundAttributes     map[string][]string `json:"bound_attributes"`
+	BoundAttributesType string              `json:"bound_attributes_type"`
+	AttributeMappings   map[string]string   `json:"attribute_mappings"`
+	GroupsAttribute     string              `json:"groups_attribute"`
+	Policies            []string            `json:"policies"`
+	TTL                 time.Duration       `json:"ttl"`
+	MaxTTL              time.Duration       `json:"max_ttl"`
+	Period              time.Duration       `json:"period"`
+}
+
+// validateAssertion checks that the assertion matches the bound subjects and
+// attributes of the role
+func (r *samlRole) validateAssertion(assertion *samlAssertion) error {
+	if len(r.BoundSubjects) > 0 && !matchesAny(r.BoundSubjectsType, r.BoundSubjects, []string{assertion.NameID}) {
+		return fmt.Errorf("subject %q is not allowed by the role", assertion.NameID)
+	}
+	for attribute, values := range r.BoundAttributes {
+		if !matchesAny(r.BoundAttributesType, values, assertion.Attributes[attribute]) {
+			return fmt.Errorf("attribute %q does not match the role", attribute)
+		}
+	}
+	return nil
+}
+
+// matchesAny returns whether any of the values matches any of the allowed
+// values
+func matchesAny(matchType string, allowed, values []string) bool {
+	for _, value := range values {
+		for _, a := range allowed {
+			if a == value || (matchType == matchTypeGlob && strutil.GlobbedStringsMatch(a, value)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// roleAuth returns the auth of a login with a verified assertion
+func roleAuth(roleName string, role *samlRole, assertion *samlAssertion) (*logical.Auth, error) {
+	if err := role.validateAssertion(assertion); err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]string{
+		"role":    roleName,
+		"name_id": assertion.NameID,
+	}
+	for attribute, key := range role.AttributeMappings {
+		if values := assertion.Attributes[attribute]; len(values) > 0 {
+			metadata[key] = strings.Join(values, ",")
+		}
+	}
+
+	var groups []string
+	if role.GroupsAttribute != "" {
+		groups = assertion.Attributes[role.GroupsAttribute]
+		if len(groups) == 0 {
+			return nil, errors.New("assertion has no groups attribute")
+		}
+	}
+
+	auth := &logical.Auth{
+		Policies:     role.Policies,
+		GroupAliases: groups,
+		Period:       role.Period,
+		InternalData: map[string]interface{}{
+			"role": roleName,
+		},
+		Metadata:    metadata,
+		DisplayName: assertion.NameID,
+		LeaseOptions: logical.LeaseOptions{
+			TTL:       role.TTL,
+			Renewable: true,
+		},
+	}
+
+	// If 'Period' is set, use the value of 'Period' as the TTL
+	if role.Period > time.Duration(0) {
+		auth.TTL = role.Period
+	}
+
+	return auth, nil
+}
+
+const pathRoleHelpSyn = `
+Manage the roles binding SAML assertions to policies.
+`
+
+const pathRoleHelpDesc = `
+A role allows the users whose assertions match its bound subjects and
+attributes to log in and obtain tokens with its policies. Without bindings,
+all the users of the IdP may log in with the role.
+
+The NameID of the assertion is the display name of the tokens, and
+"attribute_mappings" copies attributes into their metadata. With
+"groups_attribute", the groups listed in the assertion are resolved to the
+external groups of the mount.
+`
@@ -0,0 +1,311 @@
+package samlauth
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	nsSAML     = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsSAMLP    = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsMetadata = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	bindingHTTPPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	bindingHTTPRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	statusSuccess       = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	confirmationBearer  = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+)
+
+// maxClockSkew is the maximum difference between the clocks of the IdP and
+// of Vault
+const maxClockSkew = 2 * time.Minute
+
+// samlAssertion holds the subject and attributes of a verified assertion
+type samlAssertion struct {
+	NameID     string
+	Attributes map[string][]string
+}
+
+// authnRequestURL returns the URL of the IdP single sign-on service with an
+// AuthnRequest of the HTTP-Redirect binding, asking the IdP to post the
+// response to the assertion consumer service URL
+func authnRequestURL(config *samlConfig, requestID, acsURL, relayState string, now time.Time) (string, error) {
+	request := fmt.Sprintf(`<samlp:AuthnRequest xmlns:samlp="%s" xmlns:saml="%s" ID="%s" Version="2.0" IssueInstant="%s" Destination="%s" AssertionConsumerServiceURL="%s" ProtocolBinding="%s"><saml:Issuer>%s</saml:Issuer><samlp:NameIDPolicy AllowCreate="true"></samlp:NameIDPolicy></samlp:AuthnRequest>`,
+		nsSAMLP, nsSAML, requestID, now.UTC().Format(time.RFC3339), escapeAttr(config.IDPSSOURL),
+		escapeAttr(acsURL), bindingHTTPPost, escapeText(config.EntityID))
+
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write([]byte(request)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"SAMLRequest": {base64.StdEncoding.EncodeToString(buf.Bytes())},
+		"RelayState":  {relayState},
+	}
+	if strings.Contains(config.IDPSSOURL, "?") {
+		return config.IDPSSOURL + "&" + params.Encode(), nil
+	}
+	return config.IDPSSOURL + "?" + params.Encode(), nil
+}
+
+// verifyResponse verifies a SAML response of the HTTP-POST binding to the
+// AuthnRequest, and returns its assertion. The assertion must be signed, or
+// the response containing it.
+func verifyResponse(config *samlConfig, encoded, requestID, acsURL string, now time.Time) (*samlAssertion, error) {
+	data, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding the SAML response: %s", err)
+	}
+	response, err := parseXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the SAML response: %s", err)
+	}
+	if !response.Is(nsSAMLP, "Response") {
+		return nil, errors.New("not a SAML response")
+	}
+
+	certs, err := config.certificates()
+	if err != nil {
+		return nil, err
+	}
+
+	if status := response.Child(nsSAMLP, "Status"); status != nil {
+		if code := status.Child(nsSAMLP, "StatusCode"); code != nil && code.Attr("Value") != statusSuccess {
+			message := code.Attr("Value")
+			if statusMessage := status.Child(nsSAMLP, "StatusMessage"); statusMessage != nil {
+				message += ": " + statusMessage.Text()
+			}
+			return nil, fmt.Errorf("IdP returned an error: %s", message)
+		}
+	}
+	if destination := response.Attr("Destination"); destination != "" && destination != acsURL {
+		return nil, fmt.Errorf("response is for %q rather than %q", destination, acsURL)
+	}
+	if response.Attr("InResponseTo") != requestID {
+		return nil, errors.New("response is not for the login's request")
+	}
+
+	if len(response.ChildElements(nsSAML, "EncryptedAssertion")) > 0 {
+		return nil, errors.New("encrypted assertions are not supported")
+	}
+	assertions := response.ChildElements(nsSAML, "Assertion")
+	if len(assertions) != 1 {
+		return nil, errors.New("response must have exactly one assertion")
+	}
+	assertion := assertions[0]
+
+	if assertion.Child(nsDSig, "Signature") != nil {
+		err = verifySignature(assertion, certs)
+	} else {
+		err = verifySignature(response, certs)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the contents of the verified assertion are used from here
+	if issuer := assertion.Child(nsSAML, "Issuer"); issuer == nil || strings.TrimSpace(issuer.Text()) != config.IDPEntityID {
+		return nil, errors.New("assertion is not issued by the IdP")
+	}
+	if err := validateConditions(assertion.Child(nsSAML, "Conditions"), config.EntityID, now); err != nil {
+		return nil, err
+	}
+
+	subject := assertion.Child(nsSAML, "Subject")
+	if subject == nil {
+		return nil, errors.New("assertion has no subject")
+	}
+	nameID := subject.Child(nsSAML, "NameID")
+	if nameID == nil || strings.TrimSpace(nameID.Text()) == "" {
+		return nil, errors.New("assertion has no NameID")
+	}
+	if err := validateSubjectConfirmation(subject, requestID, acsURL, now); err != nil {
+		return nil, err
+	}
+
+	result := &samlAssertion{
+		NameID:     strings.TrimSpace(nameID.Text()),
+		Attributes: make(map[string][]string),
+	}
+	for _, statement := range assertion.ChildElements(nsSAML, "AttributeStatement") {
+		for _, attribute := range statement.ChildElements(nsSAML, "Attribute") {
+			name := attribute.Attr("Name")
+			for _, value := range attribute.ChildElements(nsSAML, "AttributeValue") {
+				result.Attributes[name] = append(result.Attributes[name], strings.TrimSpace(value.Text()))
+			}
+		}
+	}
+	return result, nil
+}
+
+// validateConditions checks the validity period and audiences of an
+// assertion
+func validateConditions(conditions *xmlElement, entityID string, now time.Time) error {
+	if conditions == nil {
+		return nil
+	}
+	if err := validatePeriod(conditions, now); err != nil {
+		return fmt.Errorf("assertion %s", err)
+	}
+	for _, restriction := range conditions.ChildElements(nsSAML, "AudienceRestriction") {
+		found := false
+		for _, audience := range restriction.ChildElements(nsSAML, "Audience") {
+			if strings.TrimSpace(audience.Text()) == entityID {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("assertion is not intended for %q", entityID)
+		}
+	}
+	return nil
+}
+
+// validateSubjectConfirmation checks that a bearer subject confirmation
+// allows the subject to log in with the response
+func validateSubjectConfirmation(subject *xmlElement, requestID, acsURL string, now time.Time) error {
+	for _, confirmation := range subject.ChildElements(nsSAML, "SubjectConfirmation") {
+		if confirmation.Attr("Method") != confirmationBearer {
+			continue
+		}
+		data := confirmation.Child(nsSAML, "SubjectConfirmationData")
+		if data == nil || data.Attr("Recipient") != acsURL || data.Attr("NotOnOrAfter") == "" {
+			continue
+		}
+		if inResponseTo := data.Attr("InResponseTo"); inResponseTo != "" && inResponseTo != requestID {
+			continue
+		}
+		if validatePeriod(data, now) != nil {
+			continue
+		}
+		return nil
+	}
+	return errors.New("assertion has no valid bearer subject confirmation")
+}
+
+// validatePeriod checks the NotBefore and NotOnOrAfter attributes of an
+// element
+func validatePeriod(e *xmlElement, now time.Time) error {
+	if notBefore := e.Attr("NotBefore"); notBefore != "" {
+		t, err := time.Parse(time.RFC3339Nano, notBefore)
+		if err != nil {
+			return fmt.Errorf("has an invalid NotBefore: %s", err)
+		}
+		if now.Add(maxClockSkew).Before(t) {
+			return errors.New("is not yet valid")
+		}
+	}
+	if notOnOrAfter := e.Attr("NotOnOrAfter"); notOnOrAfter != "" {
+		t, err := time.Parse(time.RFC3339Nano, notOnOrAfter)
+		if err != nil {
+			return fmt.Errorf("has an invalid NotOnOrAfter: %s", err)
+		}
+		if !now.Add(-maxClockSkew).Before(t) {
+			return errors.New("has expired")
+		}
+	}
+	return nil
+}
+
+// idpMetadata is the configuration of an IdP read from its metadata
+type idpMetadata struct {
+	EntityID string
+	SSOURL   string
+	CertPEM  string
+}
+
+// parseIDPMetadata parses the metadata of an IdP, returning its entity ID,
+// the URL of its single sign-on service with the HTTP-Redirect binding, and
+// its signing certificates
+func parseIDPMetadata(data []byte) (*idpMetadata, error) {
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the IdP metadata: %s", err)
+	}
+	if !root.Is(nsMetadata, "EntityDescriptor") {
+		return nil, errors.New("IdP metadata is not an EntityDescriptor")
+	}
+	descriptor := root.Child(nsMetadata, "IDPSSODescriptor")
+	if descriptor == nil {
+		return nil, errors.New("IdP metadata has no IDPSSODescriptor")
+	}
+
+	metadata := &idpMetadata{
+		EntityID: root.Attr("entityID"),
+	}
+	for _, service := range descriptor.ChildElements(nsMetadata, "SingleSignOnService") {
+		if service.Attr("Binding") == bindingHTTPRedirect {
+			metadata.SSOURL = service.Attr("Location")
+			break
+		}
+	}
+
+	var certs []string
+	for _, key := range descriptor.ChildElements(nsMetadata, "KeyDescriptor") {
+		if use := key.Attr("use"); use != "" && use != "signing" {
+			continue
+		}
+		keyInfo := key.Child(nsDSig, "KeyInfo")
+		if keyInfo == nil {
+			continue
+		}
+		for _, data := range keyInfo.ChildElements(nsDSig, "X509Data") {
+			for _, cert := range data.ChildElements(nsDSig, "X509Certificate") {
+				der, err := decodeBase64(cert.Text())
+				if err != nil {
+					return nil, fmt.Errorf("invalid certificate in the IdP metadata: %s", err)
+				}
+				certs = append(certs, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+			}
+		}
+	}
+	metadata.CertPEM = strings.Join(certs, "")
+
+	switch {
+	case metadata.EntityID == "":
+		return nil, errors.New("IdP metadata has no entityID")
+	case metadata.SSOURL == "":
+		return nil, errors.New("IdP metadata has no single sign-on service with the HTTP-Redirect binding")
+	case metadata.CertPEM == "":
+		return nil, errors.New("IdP metadata has no signing certificate")
+	}
+	return metadata, nil
+}
+
+// parseCertificates parses the PEM encoded certificates
+func parseCertificates(certPEM string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(certPEM)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM encoded certificates found")
+	}
+	return certs, nil
+}
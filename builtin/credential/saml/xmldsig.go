@@ -0,0 +1,456 @@
+package samlauth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+
+	// Register the digest algorithms of XML signatures
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+const (
+	nsXML  = "http://www.w3.org/XML/1998/namespace"
+	nsDSig = "http://www.w3.org/2000/09/xmldsig#"
+
+	algExcC14N     = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnveloped   = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algSHA1        = "http://www.w3.org/2000/09/xmldsig#sha1"
+	algSHA256      = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algSHA512      = "http://www.w3.org/2001/04/xmlenc#sha512"
+	algRSASHA1     = "http://www.w3.org/2000/09/xmldsig#rsa-sha1"
+	algRSASHA256   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algRSASHA512   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	algECDSASHA256 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+	algECDSASHA512 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512"
+)
+
+var digestAlgorithms = map[string]crypto.Hash{
+	algSHA1:   crypto.SHA1,
+	algSHA256: crypto.SHA256,
+	algSHA512: crypto.SHA512,
+}
+
+var signatureAlgorithms = map[string]crypto.Hash{
+	algRSASHA1:     crypto.SHA1,
+	algRSASHA256:   crypto.SHA256,
+	algRSASHA512:   crypto.SHA512,
+	algECDSASHA256: crypto.SHA256,
+	algECDSASHA512: crypto.SHA512,
+}
+
+// xmlElement is an element of a parsed XML document. Unlike encoding/xml,
+// it keeps the prefixes and namespace declarations of the document, which
+// its canonical form depends on.
+type xmlElement struct {
+	Parent   *xmlElement
+	Prefix   string
+	Local    string
+	Attrs    []xmlAttr
+	NSDecls  map[string]string
+	Children []interface{}
+}
+
+type xmlAttr struct {
+	Prefix string
+	Local  string
+	Value  string
+}
+
+// xmlText is the character data of an element
+type xmlText string
+
+// parseXML parses an XML document. Document type declarations are rejected,
+// and comments and processing instructions are dropped.
+func parseXML(data []byte) (*xmlElement, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	var root, current *xmlElement
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			if current == nil && root != nil {
+				return nil, errors.New("multiple root elements")
+			}
+			el := &xmlElement{
+				Parent:  current,
+				Prefix:  token.Name.Space,
+				Local:   token.Name.Local,
+				NSDecls: make(map[string]string),
+			}
+			for _, attr := range token.Attr {
+				switch {
+				case attr.Name.Space == "xmlns":
+					el.NSDecls[attr.Name.Local] = attr.Value
+				case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+					el.NSDecls[""] = attr.Value
+				default:
+					el.Attrs = append(el.Attrs, xmlAttr{
+						Prefix: attr.Name.Space,
+						Local:  attr.Name.Local,
+						Value:  attr.Value,
+					})
+				}
+			}
+			if current == nil {
+				root = el
+			} else {
+				current.Children = append(current.Children, el)
+			}
+			current = el
+
+		case xml.EndElement:
+			if current == nil || token.Name.Space != current.Prefix || token.Name.Local != current.Local {
+				return nil, fmt.Errorf("unexpected end element %q", token.Name.Local)
+			}
+			current = current.Parent
+
+		case xml.CharData:
+			if current != nil {
+				current.Children = append(current.Children, xmlText(token))
+			}
+
+		case xml.Directive:
+			return nil, errors.New("XML directives are not allowed")
+		}
+	}
+
+	if root == nil {
+		return nil, errors.New("empty XML document")
+	}
+	if current != nil {
+		return nil, errors.New("unexpected end of XML document")
+	}
+	return root, nil
+}
+
+// lookupNS returns the namespace bound to the prefix in the scope of the
+// element
+func (e *xmlElement) lookupNS(prefix string) string {
+	if prefix == "xml" {
+		return nsXML
+	}
+	for el := e; el != nil; el = el.Parent {
+		if ns, ok := el.NSDecls[prefix]; ok {
+			return ns
+		}
+	}
+	return ""
+}
+
+// Is returns whether the element has the namespace and local name
+func (e *xmlElement) Is(space, local string) bool {
+	return e.Local == local && e.lookupNS(e.Prefix) == space
+}
+
+// Attr returns the value of the unqualified attribute
+func (e *xmlElement) Attr(local string) string {
+	for _, attr := range e.Attrs {
+		if attr.Prefix == "" && attr.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// ChildElements returns the child elements with the namespace and local
+// name
+func (e *xmlElement) ChildElements(space, local string) []*xmlElement {
+	var result []*xmlElement
+	for _, child := range e.Children {
+		if el, ok := child.(*xmlElement); ok && el.Is(space, local) {
+			result = append(result, el)
+		}
+	}
+	return result
+}
+
+// Child returns the first child element with the namespace and local name,
+// or nil
+func (e *xmlElement) Child(space, local string) *xmlElement {
+	if children := e.ChildElements(space, local); len(children) > 0 {
+		return children[0]
+	}
+	return nil
+}
+
+// Text returns the character data of the element, without the text of its
+// child elements
+func (e *xmlElement) Text() string {
+	var buf bytes.Buffer
+	for _, child := range e.Children {
+		if text, ok := child.(xmlText); ok {
+			buf.WriteString(string(text))
+		}
+	}
+	return buf.String()
+}
+
+// canonicalize returns the exclusive canonical form of the element, without
+// comments, as described in https://www.w3.org/TR/xml-exc-c14n/. The
+// excluded element, if any, is omitted, and the namespaces of the inclusive
+// prefixes are rendered as in inclusive canonicalization.
+func canonicalize(e *xmlElement, excluded *xmlElement, inclusivePrefixes []string) []byte {
+	inclusive := make(map[string]bool, len(inclusivePrefixes))
+	for _, prefix := range inclusivePrefixes {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		inclusive[prefix] = true
+	}
+
+	var buf bytes.Buffer
+	writeCanonical(&buf, e, excluded, inclusive, map[string]string{})
+	return buf.Bytes()
+}
+
+func writeCanonical(buf *bytes.Buffer, e, excluded *xmlElement, inclusive map[string]bool, rendered map[string]string) {
+	// The namespaces visibly utilized by the element and its attributes, and
+	// the inclusive ones in scope, are rendered unless an output ancestor
+	// rendered them already
+	utilized := map[string]bool{e.Prefix: true}
+	for _, attr := range e.Attrs {
+		if attr.Prefix != "" && attr.Prefix != "xml" {
+			utilized[attr.Prefix] = true
+		}
+	}
+	for prefix := range inclusive {
+		if prefix == "" || e.lookupNS(prefix) != "" {
+			utilized[prefix] = true
+		}
+	}
+
+	var prefixes []string
+	scope := make(map[string]string, len(rendered)+len(utilized))
+	for prefix, ns := range rendered {
+		scope[prefix] = ns
+	}
+	for prefix := range utilized {
+		ns := e.lookupNS(prefix)
+		previous, ok := rendered[prefix]
+		if ns == "" && (prefix != "" || !ok || previous == "") {
+			continue
+		}
+		if ok && previous == ns {
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+		scope[prefix] = ns
+	}
+	sort.Strings(prefixes)
+
+	attrs := make([]xmlAttr, len(e.Attrs))
+	copy(attrs, e.Attrs)
+	sort.Slice(attrs, func(i, j int) bool {
+		nsi, nsj := "", ""
+		if attrs[i].Prefix != "" {
+			nsi = e.lookupNS(attrs[i].Prefix)
+		}
+		if attrs[j].Prefix != "" {
+			nsj = e.lookupNS(attrs[j].Prefix)
+		}
+		if nsi != nsj {
+			return nsi < nsj
+		}
+		return attrs[i].Local < attrs[j].Local
+	})
+
+	name := qualifiedName(e.Prefix, e.Local)
+	buf.WriteString("<" + name)
+	for _, prefix := range prefixes {
+		if prefix == "" {
+			buf.WriteString(` xmlns="`)
+		} else {
+			buf.WriteString(` xmlns:` + prefix + `="`)
+		}
+		buf.WriteString(escapeAttr(scope[prefix]) + `"`)
+	}
+	for _, attr := range attrs {
+		buf.WriteString(" " + qualifiedName(attr.Prefix, attr.Local) + `="` + escapeAttr(attr.Value) + `"`)
+	}
+	buf.WriteString(">")
+
+	for _, child := range e.Children {
+		switch child := child.(type) {
+		case *xmlElement:
+			if child != excluded {
+				writeCanonical(buf, child, excluded, inclusive, scope)
+			}
+		case xmlText:
+			buf.WriteString(escapeText(string(child)))
+		}
+	}
+	buf.WriteString("</" + name + ">")
+}
+
+func qualifiedName(prefix, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+
+var attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func escapeAttr(s string) string {
+	return attrEscaper.Replace(s)
+}
+
+// verifySignature verifies the enveloped signature of the element, which
+// must be its child and reference it by ID, with one of the certificates.
+// The key info of the signature is ignored.
+func verifySignature(e *xmlElement, certs []*x509.Certificate) error {
+	signatures := e.ChildElements(nsDSig, "Signature")
+	switch len(signatures) {
+	case 0:
+		return fmt.Errorf("%s is not signed", e.Local)
+	case 1:
+	default:
+		return fmt.Errorf("%s has multiple signatures", e.Local)
+	}
+	signature := signatures[0]
+
+	signedInfo := signature.Child(nsDSig, "SignedInfo")
+	if signedInfo == nil {
+		return errors.New("signature has no SignedInfo")
+	}
+	c14nMethod := signedInfo.Child(nsDSig, "CanonicalizationMethod")
+	if c14nMethod == nil || c14nMethod.Attr("Algorithm") != algExcC14N {
+		return errors.New("unsupported canonicalization method; exclusive canonicalization is required")
+	}
+	signatureMethod := signedInfo.Child(nsDSig, "SignatureMethod")
+	if signatureMethod == nil {
+		return errors.New("signature has no SignatureMethod")
+	}
+	signatureHash, ok := signatureAlgorithms[signatureMethod.Attr("Algorithm")]
+	if !ok {
+		return fmt.Errorf("unsupported signature method %q", signatureMethod.Attr("Algorithm"))
+	}
+
+	references := signedInfo.ChildElements(nsDSig, "Reference")
+	if len(references) != 1 {
+		return errors.New("signature must have exactly one reference")
+	}
+	reference := references[0]
+	if id := e.Attr("ID"); id == "" || reference.Attr("URI") != "#"+id {
+		return fmt.Errorf("signature does not reference the %s", e.Local)
+	}
+
+	// Only the enveloped signature and exclusive canonicalization transforms
+	// are allowed
+	var excluded *xmlElement
+	var prefixes []string
+	if transforms := reference.Child(nsDSig, "Transforms"); transforms != nil {
+		for _, transform := range transforms.ChildElements(nsDSig, "Transform") {
+			switch transform.Attr("Algorithm") {
+			case algEnveloped:
+				excluded = signature
+			case algExcC14N:
+				prefixes = inclusivePrefixes(transform)
+			default:
+				return fmt.Errorf("unsupported transform %q", transform.Attr("Algorithm"))
+			}
+		}
+	}
+
+	digestMethod := reference.Child(nsDSig, "DigestMethod")
+	if digestMethod == nil {
+		return errors.New("reference has no DigestMethod")
+	}
+	digestHash, ok := digestAlgorithms[digestMethod.Attr("Algorithm")]
+	if !ok {
+		return fmt.Errorf("unsupported digest method %q", digestMethod.Attr("Algorithm"))
+	}
+	digestValue := reference.Child(nsDSig, "DigestValue")
+	if digestValue == nil {
+		return errors.New("reference has no DigestValue")
+	}
+	expectedDigest, err := decodeBase64(digestValue.Text())
+	if err != nil {
+		return fmt.Errorf("invalid digest value: %s", err)
+	}
+
+	h := digestHash.New()
+	h.Write(canonicalize(e, excluded, prefixes))
+	if subtle.ConstantTimeCompare(h.Sum(nil), expectedDigest) != 1 {
+		return fmt.Errorf("digest of the %s does not match its signature", e.Local)
+	}
+
+	signatureValue := signature.Child(nsDSig, "SignatureValue")
+	if signatureValue == nil {
+		return errors.New("signature has no SignatureValue")
+	}
+	sig, err := decodeBase64(signatureValue.Text())
+	if err != nil {
+		return fmt.Errorf("invalid signature value: %s", err)
+	}
+
+	h = signatureHash.New()
+	h.Write(canonicalize(signedInfo, nil, inclusivePrefixes(c14nMethod)))
+	hashed := h.Sum(nil)
+	for _, cert := range certs {
+		if verifyHash(cert.PublicKey, signatureHash, hashed, sig) {
+			return nil
+		}
+	}
+	return errors.New("signature was not made by the IdP certificates")
+}
+
+// inclusivePrefixes returns the PrefixList of the InclusiveNamespaces of an
+// exclusive canonicalization transform
+func inclusivePrefixes(transform *xmlElement) []string {
+	// The namespace of InclusiveNamespaces is the algorithm identifier
+	if ns := transform.Child(algExcC14N, "InclusiveNamespaces"); ns != nil {
+		return strings.Fields(ns.Attr("PrefixList"))
+	}
+	return nil
+}
+
+func verifyHash(key interface{}, hash crypto.Hash, hashed, sig []byte) bool {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, hash, hashed, sig) == nil
+	case *ecdsa.PublicKey:
+		// XML signatures concatenate r and s
+		if len(sig)%2 != 0 {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:len(sig)/2])
+		s := new(big.Int).SetBytes(sig[len(sig)/2:])
+		return ecdsa.Verify(key, hashed, r, s)
+	default:
+		return false
+	}
+}
+
+// decodeBase64 decodes base64 with line breaks and spaces
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
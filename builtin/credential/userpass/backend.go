@@ -24,6 +24,7 @@ func Backend() *backend {
 		},
 
 		Paths: append([]*framework.Path{
+			pathConfig(&b),
 			pathUsers(&b),
 			pathUsersList(&b),
 			pathUserPolicies(&b),
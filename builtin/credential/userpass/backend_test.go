@@ -325,3 +325,143 @@ func testAccStepReadUser(t *testing.T, name string, policies string) logicaltest
 		},
 	}
 }
+
+func TestBackend_passwordPolicy(t *testing.T) {
+	b, err := Factory(&logical.BackendConfig{
+		System: &logical.StaticSystemView{
+			DefaultLeaseTTLVal: testSysTTL,
+			MaxLeaseTTLVal:     testSysMaxTTL,
+			PasswordPolicies: map[string]string{
+				"digits": `
+length = 10
+rule "charset" {
+  charset = "0123456789"
+  min-chars = 2
+}`,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := &logical.InmemStorage{}
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, _ := b.HandleRequest(&logical.Request{
+			Operation: op,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+		return resp
+	}
+
+	resp := request(logical.UpdateOperation, "config", map[string]interface{}{
+		"password_policy": "missing",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for a missing policy, got %#v", resp)
+	}
+	if resp := request(logical.UpdateOperation, "config", map[string]interface{}{
+		"password_policy": "digits",
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = request(logical.ReadOperation, "config", nil)
+	if resp == nil || resp.Data["password_policy"] != "digits" {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	for _, c := range []struct {
+		path     string
+		op       logical.Operation
+		password string
+		success  bool
+	}{
+		{"users/web", logical.CreateOperation, "short12", false},
+		{"users/web", logical.CreateOperation, "longwithoutdigit", false},
+		{"users/web", logical.CreateOperation, "longwith12digits", true},
+		{"users/web/password", logical.UpdateOperation, "password", false},
+		{"users/web/password", logical.UpdateOperation, "password1234", true},
+	} {
+		resp := request(c.op, c.path, map[string]interface{}{
+			"password": c.password,
+		})
+		if success := resp == nil || !resp.IsError(); success != c.success {
+			t.Fatalf("%s %q: expected success %t, got %#v", c.path, c.password, c.success, resp)
+		}
+	}
+}
+
+func TestBackend_selfServicePassword(t *testing.T) {
+	b, err := Factory(&logical.BackendConfig{
+		System: &logical.StaticSystemView{
+			DefaultLeaseTTLVal: testSysTTL,
+			MaxLeaseTTLVal:     testSysMaxTTL,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := &logical.InmemStorage{}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "users/web",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"password": "password",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: %v %#v", err, resp)
+	}
+
+	changePassword := func(entity *logical.Entity, data map[string]interface{}) bool {
+		resp, _ := b.HandleRequest(&logical.Request{
+			Operation:  logical.UpdateOperation,
+			Path:       "users/web/password",
+			MountPoint: "auth/userpass/",
+			Storage:    storage,
+			Entity:     entity,
+			Data:       data,
+		})
+		return resp == nil || !resp.IsError()
+	}
+	self := &logical.Entity{
+		Name:     "userpass-web",
+		Metadata: map[string]string{"username": "web"},
+	}
+
+	// Users must give their current password
+	if changePassword(self, map[string]interface{}{"password": "new"}) {
+		t.Fatal("expected the current password to be required")
+	}
+	if changePassword(self, map[string]interface{}{"password": "new", "current_password": "wrong"}) {
+		t.Fatal("expected a wrong current password to be rejected")
+	}
+	if !changePassword(self, map[string]interface{}{"password": "new", "current_password": "password"}) {
+		t.Fatal("expected the password change to succeed")
+	}
+
+	// Tokens of other users, or from other backends, do not need it
+	other := &logical.Entity{
+		Name:     "github-web",
+		Metadata: map[string]string{"username": "web"},
+	}
+	if !changePassword(other, map[string]interface{}{"password": "newer"}) {
+		t.Fatal("expected the password change to succeed")
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "login/web",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"password": "newer",
+		},
+	})
+	if err != nil || resp == nil || resp.Auth == nil {
+		t.Fatalf("bad: %v %#v", err, resp)
+	}
+}
@@ -0,0 +1,99 @@
+package userpass
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config",
+		Fields: map[string]*framework.FieldSchema{
+			"password_policy": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Name of the password policy, from
+sys/policies/password, which the passwords of
+the users must satisfy.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"password_policy": config.PasswordPolicy,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if passwordPolicy, ok := d.GetOk("password_policy"); ok {
+		config.PasswordPolicy = passwordPolicy.(string)
+	}
+	if config.PasswordPolicy != "" {
+		if _, err := b.System().PasswordPolicy(config.PasswordPolicy); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid password_policy %q: %s", config.PasswordPolicy, err)), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	return nil, req.Storage.Put(entry)
+}
+
+// config returns the configuration of the backend, which is empty if it was
+// never written
+func (b *backend) config(s logical.Storage) (*configEntry, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+
+	var result configEntry
+	if entry != nil {
+		if err := entry.DecodeJSON(&result); err != nil {
+			return nil, err
+		}
+	}
+	return &result, nil
+}
+
+type configEntry struct {
+	// PasswordPolicy is the name of the password policy the passwords must
+	// satisfy
+	PasswordPolicy string `json:"password_policy"`
+}
+
+const pathConfigHelpSyn = `
+Configure the userpass backend.
+`
+
+const pathConfigHelpDesc = `
+This endpoint configures the password policy which the passwords of the users
+must satisfy when they are set. Existing passwords are not checked.
+`
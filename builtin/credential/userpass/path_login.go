@@ -1,14 +1,12 @@
 package userpass
 
 import (
-	"crypto/subtle"
 	"fmt"
 	"strings"
 
 	"github.com/hashicorp/vault/helper/policyutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
-	"golang.org/x/crypto/bcrypt"
 )
 
 func pathLogin(b *backend) *framework.Path {
@@ -53,17 +51,8 @@ func (b *backend) pathLogin(
 		return logical.ErrorResponse("invalid username or password"), nil
 	}
 
-	// Check for a password match. Check for a hash collision for Vault 0.2+,
-	// but handle the older legacy passwords with a constant time comparison.
-	passwordBytes := []byte(password)
-	if user.PasswordHash != nil {
-		if err := bcrypt.CompareHashAndPassword(user.PasswordHash, passwordBytes); err != nil {
-			return logical.ErrorResponse("invalid username or password"), nil
-		}
-	} else {
-		if subtle.ConstantTimeCompare([]byte(user.Password), passwordBytes) != 1 {
-			return logical.ErrorResponse("invalid username or password"), nil
-		}
+	if !user.checkPassword(password) {
+		return logical.ErrorResponse("invalid username or password"), nil
 	}
 
 	return &logical.Response{
@@ -2,6 +2,7 @@ package userpass
 
 import (
 	"fmt"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -22,6 +23,12 @@ func pathUserPassword(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: "Password for this user.",
 			},
+
+			"current_password": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Current password of the user. Required when
+users change their own password.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -46,9 +53,20 @@ func (b *backend) pathUserPasswordUpdate(
 		return nil, fmt.Errorf("username does not exist")
 	}
 
+	// Users changing their own password must prove that they know the
+	// current one, so that a leaked token is not enough to take over the
+	// account
+	currentPassword := d.Get("current_password").(string)
+	if currentPassword == "" && isSelf(req, username) {
+		return logical.ErrorResponse("current_password is required to change your own password"), logical.ErrInvalidRequest
+	}
+	if currentPassword != "" && !userEntry.checkPassword(currentPassword) {
+		return logical.ErrorResponse("current_password is incorrect"), logical.ErrInvalidRequest
+	}
+
 	userErr, intErr := b.updateUserPassword(req, d, userEntry)
 	if intErr != nil {
-		return nil, err
+		return nil, intErr
 	}
 	if userErr != nil {
 		return logical.ErrorResponse(userErr.Error()), logical.ErrInvalidRequest
@@ -57,11 +75,38 @@ func (b *backend) pathUserPasswordUpdate(
 	return nil, b.setUser(req.Storage, username, userEntry)
 }
 
+// isSelf returns whether the request is made with a token issued by this
+// backend to the user. The display names of these tokens are the path of
+// the mount followed by the username.
+func isSelf(req *logical.Request, username string) bool {
+	if req.Entity == nil || req.Entity.Metadata["username"] != username {
+		return false
+	}
+	source := strings.TrimPrefix(req.MountPoint, "auth/")
+	source = strings.Replace(source, "/", "-", -1)
+	return req.Entity.Name == source+username
+}
+
 func (b *backend) updateUserPassword(req *logical.Request, d *framework.FieldData, userEntry *UserEntry) (error, error) {
 	password := d.Get("password").(string)
 	if password == "" {
 		return fmt.Errorf("missing password"), nil
 	}
+
+	config, err := b.config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config.PasswordPolicy != "" {
+		policy, err := b.System().PasswordPolicy(config.PasswordPolicy)
+		if err != nil {
+			return nil, fmt.Errorf("error loading password policy %q: %s", config.PasswordPolicy, err)
+		}
+		if err := policy.Validate(password); err != nil {
+			return err, nil
+		}
+	}
+
 	// Generate a hash of the password
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -76,5 +121,10 @@ Reset user's password.
 `
 
 const pathUserPasswordHelpDesc = `
-This endpoint allows resetting the user's password.
+This endpoint allows resetting the user's password. The password must satisfy
+the password policy of the backend, if configured.
+
+Users can change their own password if their policies allow updating this
+endpoint for their username. They must then give their current password as
+"current_password".
 `
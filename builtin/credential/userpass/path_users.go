@@ -1,6 +1,7 @@
 package userpass
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"strings"
 	"time"
@@ -8,6 +9,7 @@ import (
 	"github.com/hashicorp/vault/helper/policyutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func pathUsersList(b *backend) *framework.Path {
@@ -158,7 +160,7 @@ func (b *backend) userCreateUpdate(req *logical.Request, d *framework.FieldData)
 	if _, ok := d.GetOk("password"); ok {
 		userErr, intErr := b.updateUserPassword(req, d, userEntry)
 		if intErr != nil {
-			return nil, err
+			return nil, intErr
 		}
 		if userErr != nil {
 			return logical.ErrorResponse(userErr.Error()), logical.ErrInvalidRequest
@@ -214,6 +216,16 @@ type UserEntry struct {
 	MaxTTL time.Duration
 }
 
+// checkPassword returns whether the password is the password of the user.
+// Check for a hash collision for Vault 0.2+, but handle the older legacy
+// passwords with a constant time comparison.
+func (u *UserEntry) checkPassword(password string) bool {
+	if u.PasswordHash != nil {
+		return bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(u.Password), []byte(password)) == 1
+}
+
 const pathUserHelpSyn = `
 Manage users allowed to authenticate.
 `
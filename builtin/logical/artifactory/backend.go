@@ -0,0 +1,46 @@
+package artifactory
+
+import (
+	"strings"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	var b backend
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		Paths: []*framework.Path{
+			pathConfigAdmin(&b),
+			pathListRoles(&b),
+			pathRoles(&b),
+			pathToken(&b),
+		},
+
+		Secrets: []*framework.Secret{
+			secretAccessToken(&b),
+		},
+	}
+
+	return &b
+}
+
+type backend struct {
+	*framework.Backend
+}
+
+const backendHelp = `
+The Artifactory backend issues short-lived Artifactory access tokens, which
+can be used with the Artifactory REST API and as the password of its Docker,
+npm, Maven and other artifact registries.
+
+After mounting this backend, the URL of Artifactory and an admin access token
+must be configured with the "config/admin" endpoint, and roles written with
+the "role/" endpoints before any tokens can be issued.
+`
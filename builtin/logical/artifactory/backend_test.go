@@ -0,0 +1,243 @@
+package artifactory
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// fakeArtifactory implements the access token endpoints of the Artifactory
+// REST API
+type fakeArtifactory struct {
+	sync.Mutex
+	nextID int
+	tokens map[string]url.Values
+}
+
+func (f *fakeArtifactory) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer admin" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/artifactory/api/security/token":
+		f.nextID++
+		token := fmt.Sprintf("token-%d", f.nextID)
+		expiresIn, _ := strconv.Atoi(r.PostForm.Get("expires_in"))
+		f.tokens[token] = r.PostForm
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": token,
+			"expires_in":   expiresIn,
+			"scope":        r.PostForm.Get("scope"),
+			"token_type":   "Bearer",
+		})
+
+	case r.Method == "POST" && r.URL.Path == "/artifactory/api/security/token/revoke":
+		token := r.PostForm.Get("token")
+		if f.tokens[token] == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.tokens, token)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeArtifactory) token(token string) url.Values {
+	f.Lock()
+	defer f.Unlock()
+	return f.tokens[token]
+}
+
+func testBackend(t *testing.T) (*backend, logical.Storage, *fakeArtifactory, func()) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeArtifactory{tokens: map[string]url.Values{}}
+	srv := httptest.NewServer(fake)
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/admin",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"url":          srv.URL + "/artifactory/",
+			"access_token": "admin",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	return b, config.StorageView, fake, srv.Close
+}
+
+func TestBackend_token(t *testing.T) {
+	b, storage, fake, cleanup := testBackend(t)
+	defer cleanup()
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "role/ci",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"scope":   "member-of-groups:readers",
+			"ttl":     "1h",
+			"max_ttl": "2h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/ci",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	username := resp.Data["username"].(string)
+	if resp.Data["access_token"] != "token-1" || !strings.HasPrefix(username, "vault-ci-") {
+		t.Fatalf("bad token: %#v", resp.Data)
+	}
+	if resp.Secret == nil || resp.Secret.TTL != time.Hour {
+		t.Fatalf("bad secret: %#v", resp.Secret)
+	}
+	form := fake.token("token-1")
+	if form.Get("username") != username || form.Get("scope") != "member-of-groups:readers" ||
+		form.Get("expires_in") != "7200" || form.Get("audience") != "" {
+		t.Fatalf("bad token request: %v", form)
+	}
+
+	secret := resp.Secret
+	secret.IssueTime = time.Now()
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   storage,
+		Secret:    secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	for i := 0; i < 2; i++ {
+		// Revoking a revoked token succeeds
+		resp, err = b.HandleRequest(&logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   storage,
+			Secret:    secret,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+		if fake.token("token-1") != nil {
+			t.Fatal("token was not revoked")
+		}
+	}
+}
+
+func TestBackend_username(t *testing.T) {
+	b, storage, fake, cleanup := testBackend(t)
+	defer cleanup()
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "role/deploy",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"scope":    "api:*",
+			"username": "deployer",
+			"audience": "*@*",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/deploy",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp.Data["username"] != "deployer" {
+		t.Fatalf("bad token: %#v", resp.Data)
+	}
+	form := fake.token(resp.Data["access_token"].(string))
+	if form.Get("username") != "deployer" || form.Get("audience") != "*@*" {
+		t.Fatalf("bad token request: %v", form)
+	}
+}
+
+func TestBackend_validation(t *testing.T) {
+	b, storage, _, cleanup := testBackend(t)
+	defer cleanup()
+
+	for _, data := range []map[string]interface{}{
+		{},
+		{"username": "deployer"},
+		{"scope": "api:*", "ttl": "2h", "max_ttl": "1h"},
+	} {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error writing %v: %#v", data, resp)
+		}
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/admin",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"url": "artifactory.example.com",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error writing a URL without scheme: %#v", resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/admin",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if _, ok := resp.Data["access_token"]; ok {
+		t.Fatalf("access token was returned: %#v", resp.Data)
+	}
+}
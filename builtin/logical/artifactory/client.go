@@ -0,0 +1,136 @@
+package artifactory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/logical"
+)
+
+// client calls the access token endpoints of the Artifactory REST API
+type client struct {
+	httpClient *http.Client
+	url        string
+	token      string
+}
+
+func artifactoryClient(s logical.Storage) (*client, error) {
+	conf, err := readConfigAdmin(s)
+	if err != nil {
+		return nil, err
+	}
+	if conf == nil {
+		return nil, fmt.Errorf("the backend is not configured; please configure it at the 'config/admin' endpoint")
+	}
+
+	httpClient := cleanhttp.DefaultClient()
+	httpClient.Timeout = 30 * time.Second
+
+	return &client{
+		httpClient: httpClient,
+		url:        strings.TrimSuffix(conf.URL, "/"),
+		token:      conf.AccessToken,
+	}, nil
+}
+
+// accessToken is an access token created by Artifactory
+type accessToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+	TokenType   string `json:"token_type"`
+}
+
+// tokenRequest are the parameters of a new access token
+type tokenRequest struct {
+	Username  string
+	Scope     string
+	Audience  string
+	ExpiresIn time.Duration
+}
+
+// createToken creates an access token. Artifactory creates a transient user
+// for the token if the user does not exist and the scope lists its groups.
+func (c *client) createToken(r *tokenRequest) (*accessToken, error) {
+	form := url.Values{}
+	form.Set("username", r.Username)
+	form.Set("scope", r.Scope)
+	form.Set("expires_in", strconv.FormatInt(int64(r.ExpiresIn/time.Second), 10))
+	if r.Audience != "" {
+		form.Set("audience", r.Audience)
+	}
+
+	resp, err := c.post("/api/security/token", form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var token accessToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("Artifactory did not return an access token")
+	}
+
+	return &token, nil
+}
+
+// revokeToken revokes an access token, succeeding if it does not exist
+func (c *client) revokeToken(token string) error {
+	form := url.Values{}
+	form.Set("token", token)
+
+	resp, err := c.post("/api/security/token/revoke", form)
+	if respErr, ok := err.(*apiError); ok && respErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// apiError is an error response of the Artifactory REST API
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("unexpected response code: %d (%s)", e.StatusCode, e.Message)
+}
+
+func (c *client) post(path string, form url.Values) (*http.Response, error) {
+	req, err := http.NewRequest("POST", c.url+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, &apiError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(msg)),
+		}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,130 @@
+package artifactory
+
+import (
+	"net/url"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const configAdminKey = "config/admin"
+
+func pathConfigAdmin(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/admin",
+		Fields: map[string]*framework.FieldSchema{
+			"url": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Artifactory URL, such as https://artifactory.example.com/artifactory",
+			},
+
+			"access_token": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Admin access token used to create and revoke tokens",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigAdminRead,
+			logical.UpdateOperation: b.pathConfigAdminWrite,
+			logical.DeleteOperation: b.pathConfigAdminDelete,
+		},
+
+		HelpSynopsis:    pathConfigAdminHelpSyn,
+		HelpDescription: pathConfigAdminHelpDesc,
+	}
+}
+
+func readConfigAdmin(s logical.Storage) (*adminConfig, error) {
+	entry, err := s.Get(configAdminKey)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	conf := &adminConfig{}
+	if err := entry.DecodeJSON(conf); err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+func (b *backend) pathConfigAdminRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	conf, err := readConfigAdmin(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if conf == nil {
+		return nil, nil
+	}
+
+	// The access token is not returned
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"url": conf.URL,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigAdminWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	conf, err := readConfigAdmin(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if conf == nil {
+		conf = &adminConfig{}
+	}
+
+	if v, ok := d.GetOk("url"); ok {
+		conf.URL = v.(string)
+	}
+	if v, ok := d.GetOk("access_token"); ok {
+		conf.AccessToken = v.(string)
+	}
+
+	if u, err := url.Parse(conf.URL); err != nil || u.Scheme == "" || u.Host == "" {
+		return logical.ErrorResponse("url must be a URL such as https://artifactory.example.com/artifactory"), nil
+	}
+	if conf.AccessToken == "" {
+		return logical.ErrorResponse("access_token is required"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(configAdminKey, conf)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathConfigAdminDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete(configAdminKey); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+type adminConfig struct {
+	URL         string `json:"url"`
+	AccessToken string `json:"access_token"`
+}
+
+const pathConfigAdminHelpSyn = `
+Configure the URL and admin access token of Artifactory.
+`
+
+const pathConfigAdminHelpDesc = `
+This path configures the URL of Artifactory, including its context path such
+as "/artifactory", and the admin access token Vault uses to create and revoke
+access tokens. The access token is not returned when reading the
+configuration.
+`
@@ -0,0 +1,205 @@
+package artifactory
+
+import (
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    pathRolesHelpSyn,
+		HelpDescription: pathRolesHelpDesc,
+	}
+}
+
+func pathRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role",
+			},
+
+			"scope": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Scope of the tokens, such as "member-of-groups:readers,ci"`,
+			},
+
+			"username": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "User of the tokens. Defaults to a transient user generated for each token.",
+			},
+
+			"audience": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Services the tokens are valid for, such as \"*@*\". Defaults to the Artifactory instance which issued them.",
+			},
+
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Default lease of the tokens. Defaults to the system default.",
+			},
+
+			"max_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum lease of the tokens, after which Artifactory expires them. Defaults to the system maximum.",
+			},
+		},
+
+		ExistenceCheck: b.pathRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.CreateOperation: b.pathRoleWrite,
+			logical.UpdateOperation: b.pathRoleWrite,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    pathRolesHelpSyn,
+		HelpDescription: pathRolesHelpDesc,
+	}
+}
+
+func (b *backend) pathRoleExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	role, err := b.Role(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return role != nil, nil
+}
+
+func (b *backend) pathRoleList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("role/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathRoleRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := b.Role(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"scope":    role.Scope,
+			"username": role.Username,
+			"audience": role.Audience,
+			"ttl":      int64(role.TTL / time.Second),
+			"max_ttl":  int64(role.MaxTTL / time.Second),
+		},
+	}, nil
+}
+
+func (b *backend) pathRoleWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	role, err := b.Role(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role = &roleEntry{}
+	}
+
+	if v, ok := d.GetOk("scope"); ok {
+		role.Scope = v.(string)
+	}
+	if v, ok := d.GetOk("username"); ok {
+		role.Username = v.(string)
+	}
+	if v, ok := d.GetOk("audience"); ok {
+		role.Audience = v.(string)
+	}
+	if v, ok := d.GetOk("ttl"); ok {
+		role.TTL = time.Duration(v.(int)) * time.Second
+	}
+	if v, ok := d.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(v.(int)) * time.Second
+	}
+
+	if role.Scope == "" {
+		return logical.ErrorResponse("scope is required"), nil
+	}
+	if role.MaxTTL != 0 && role.TTL > role.MaxTTL {
+		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("role/"+name, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathRoleDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete("role/" + d.Get("name").(string)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// Role returns the role of the given name
+func (b *backend) Role(s logical.Storage, name string) (*roleEntry, error) {
+	entry, err := s.Get("role/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result roleEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+type roleEntry struct {
+	Scope    string        `json:"scope"`
+	Username string        `json:"username"`
+	Audience string        `json:"audience"`
+	TTL      time.Duration `json:"ttl"`
+	MaxTTL   time.Duration `json:"max_ttl"`
+}
+
+const pathRolesHelpSyn = `
+Manage the roles used to issue Artifactory access tokens.
+`
+
+const pathRolesHelpDesc = `
+This path lets you manage the roles used to issue Artifactory access tokens.
+
+The "scope" of a role sets the permissions of its tokens, usually as the
+groups of their user, such as "member-of-groups:readers". Unless "username"
+is set, each token belongs to a new transient user, which only exists in
+Artifactory for the lifetime of the token.
+
+Tokens are issued with an expiry of the role's "max_ttl", so Artifactory
+rejects them after their maximum lease even if Vault cannot revoke them.
+`
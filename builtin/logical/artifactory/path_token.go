@@ -0,0 +1,97 @@
+package artifactory
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathToken(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "token/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathTokenRead,
+		},
+
+		HelpSynopsis:    pathTokenHelpSyn,
+		HelpDescription: pathTokenHelpDesc,
+	}
+}
+
+func (b *backend) pathTokenRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	role, err := b.Role(req.Storage, name)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving role: %s", err)
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %q not found", name)), nil
+	}
+
+	c, err := artifactoryClient(req.Storage)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	username := role.Username
+	if username == "" {
+		uuidVal, err := uuid.GenerateUUID()
+		if err != nil {
+			return nil, err
+		}
+		username = fmt.Sprintf("vault-%s-%s", name, uuidVal[:8])
+	}
+
+	// Artifactory expires the token at the end of its maximum lease, as
+	// its expiry cannot be extended on renewal
+	maxTTL := b.System().MaxLeaseTTL()
+	if role.MaxTTL != 0 && role.MaxTTL < maxTTL {
+		maxTTL = role.MaxTTL
+	}
+
+	token, err := c.createToken(&tokenRequest{
+		Username:  username,
+		Scope:     role.Scope,
+		Audience:  role.Audience,
+		ExpiresIn: maxTTL,
+	})
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	resp := b.Secret(SecretAccessTokenType).Response(map[string]interface{}{
+		"access_token": token.AccessToken,
+		"username":     username,
+		"scope":        token.Scope,
+	}, map[string]interface{}{
+		"access_token": token.AccessToken,
+		"role":         name,
+	})
+	resp.Secret.TTL = role.TTL
+
+	return resp, nil
+}
+
+const pathTokenHelpSyn = `
+Issue an Artifactory access token from a specific Vault role.
+`
+
+const pathTokenHelpDesc = `
+This path issues an Artifactory access token with the scope of the role,
+which Artifactory expires at the end of its maximum lease. The token is
+revoked when its lease is revoked.
+
+The token authenticates to the Artifactory REST API as a bearer token, and to
+its artifact registries, such as "docker login", with the returned username.
+`
@@ -0,0 +1,62 @@
+package artifactory
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const SecretAccessTokenType = "access_token"
+
+func secretAccessToken(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretAccessTokenType,
+		Fields: map[string]*framework.FieldSchema{
+			"access_token": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Artifactory access token",
+			},
+			"username": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "User of the token",
+			},
+		},
+
+		Renew:  b.secretAccessTokenRenew,
+		Revoke: b.secretAccessTokenRevoke,
+	}
+}
+
+func (b *backend) secretAccessTokenRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleName, ok := req.Secret.InternalData["role"].(string)
+	if !ok {
+		return nil, fmt.Errorf("secret is missing role internal data")
+	}
+
+	role, err := b.Role(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %q no longer exists", roleName)), nil
+	}
+
+	return framework.LeaseExtend(role.TTL, role.MaxTTL, b.System())(req, d)
+}
+
+func (b *backend) secretAccessTokenRevoke(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	token, ok := req.Secret.InternalData["access_token"].(string)
+	if !ok {
+		return nil, fmt.Errorf("secret is missing access_token internal data")
+	}
+
+	c, err := artifactoryClient(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, c.revokeToken(token)
+}
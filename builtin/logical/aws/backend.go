@@ -2,6 +2,7 @@ package aws
 
 import (
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/vault/logical"
@@ -30,6 +31,10 @@ func Backend() *backend {
 			pathListRoles(&b),
 			pathUser(&b),
 			pathSTS(&b),
+			pathListStaticRoles(&b),
+			pathStaticRoles(&b),
+			pathStaticCreds(&b),
+			pathRotateRole(&b),
 		},
 
 		Secrets: []*framework.Secret{
@@ -38,6 +43,7 @@ func Backend() *backend {
 
 		WALRollback:       walRollback,
 		WALRollbackMinAge: 5 * time.Minute,
+		PeriodicFunc:      b.periodicFunc,
 	}
 
 	return &b
@@ -45,6 +51,18 @@ func Backend() *backend {
 
 type backend struct {
 	*framework.Backend
+
+	// staticRoleLock serializes the rotations of static roles
+	staticRoleLock sync.Mutex
+
+	// accessKeys overrides the IAM client rotating the access keys of
+	// static roles, for tests
+	accessKeys accessKeysAPI
+}
+
+// periodicFunc rotates the access keys of the static roles that are due
+func (b *backend) periodicFunc(req *logical.Request) error {
+	return b.rotateStaticRoles(req.Storage)
 }
 
 const backendHelp = `
@@ -55,4 +73,8 @@ are automatically revoked at the end of the lease.
 After mounting this backend, credentials to generate IAM keys must
 be configured with the "root" path and policies must be written using
 the "roles/" endpoints before any access keys can be generated.
+
+Static roles rotate the access key of an existing IAM user on a schedule,
+for systems that cannot use dynamic credentials. They are managed with the
+"static-roles/" endpoints and their credentials read from "static-creds/".
 `
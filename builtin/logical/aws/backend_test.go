@@ -60,6 +60,39 @@ func TestBackend_basicSTS(t *testing.T) {
 	})
 }
 
+func TestBackend_credentialTypes(t *testing.T) {
+	logicaltest.Test(t, logicaltest.TestCase{
+		AcceptanceTest: true,
+		PreCheck: func() {
+			testAccPreCheck(t)
+			createRole(t)
+		},
+		Backend: getBackend(t),
+		Steps: []logicaltest.TestStep{
+			testAccStepConfig(t),
+			testAccStepWriteRole(t, "federation", map[string]interface{}{
+				"credential_type": federationTokenCred,
+				"policy_document": testPolicy,
+				"default_sts_ttl": 900,
+			}),
+			testAccStepReadSTSPath(t, "creds/federation"),
+			testAccStepWriteRole(t, "assumed", map[string]interface{}{
+				"credential_type": assumedRoleCred,
+				"role_arns":       fmt.Sprintf("arn:aws:iam::%s:role/%s", os.Getenv("AWS_ACCOUNT_ID"), testRoleName),
+				"policy_document": testPolicy,
+			}),
+			testAccStepReadSTSPath(t, "creds/assumed"),
+			testAccStepWriteRole(t, "user", map[string]interface{}{
+				"credential_type": iamUserCred,
+				"policy_arns":     testPolicyArn,
+				"policy_document": testPolicy,
+			}),
+			testAccStepReadUser(t, "user"),
+		},
+		Teardown: teardown,
+	})
+}
+
 func TestBackend_policyCrud(t *testing.T) {
 	var compacted bytes.Buffer
 	if err := json.Compact(&compacted, []byte(testPolicy)); err != nil {
@@ -262,9 +295,13 @@ func testAccStepReadUser(t *testing.T, name string) logicaltest.TestStep {
 }
 
 func testAccStepReadSTS(t *testing.T, name string) logicaltest.TestStep {
+	return testAccStepReadSTSPath(t, "sts/"+name)
+}
+
+func testAccStepReadSTSPath(t *testing.T, path string) logicaltest.TestStep {
 	return logicaltest.TestStep{
 		Operation: logical.ReadOperation,
-		Path:      "sts/" + name,
+		Path:      path,
 		Check: func(resp *logical.Response) error {
 			var d struct {
 				AccessKey string `mapstructure:"access_key"`
@@ -321,6 +358,14 @@ func testAccStepWritePolicy(t *testing.T, name string, policy string) logicaltes
 	}
 }
 
+func testAccStepWriteRole(t *testing.T, name string, data map[string]interface{}) logicaltest.TestStep {
+	return logicaltest.TestStep{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/" + name,
+		Data:      data,
+	}
+}
+
 func testAccStepDeletePolicy(t *testing.T, n string) logicaltest.TestStep {
 	return logicaltest.TestStep{
 		Operation: logical.DeleteOperation,
@@ -342,7 +387,7 @@ func testAccStepReadPolicy(t *testing.T, name string, value string) logicaltest.
 			}
 
 			var d struct {
-				Policy string `mapstructure:"policy"`
+				Policy string `mapstructure:"policy_document"`
 			}
 			if err := mapstructure.Decode(resp.Data, &d); err != nil {
 				return err
@@ -428,13 +473,13 @@ func testAccStepReadArnPolicy(t *testing.T, name string, value string) logicalte
 			}
 
 			var d struct {
-				Policy string `mapstructure:"arn"`
+				Policies []string `mapstructure:"policy_arns"`
 			}
 			if err := mapstructure.Decode(resp.Data, &d); err != nil {
 				return err
 			}
 
-			if d.Policy != value {
+			if len(d.Policies) != 1 || d.Policies[0] != value {
 				return fmt.Errorf("bad: %#v", resp)
 			}
 
@@ -3,11 +3,12 @@ package aws
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
-
 	"errors"
+	"fmt"
 	"strings"
+	"time"
 
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -34,14 +35,46 @@ func pathRoles() *framework.Path {
 				Description: "Name of the policy",
 			},
 
+			"credential_type": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: fmt.Sprintf("Comma-separated types of credentials issued for the role: %s, %s or %s",
+					iamUserCred, assumedRoleCred, federationTokenCred),
+			},
+
+			"role_arns": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "ARNs of the roles that can be assumed, for the assumed_role credential type",
+			},
+
+			"policy_arns": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "ARNs of the managed policies attached to the users of the iam_user credential type",
+			},
+
+			"policy_document": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `IAM policy document. It is the inline policy of the users of the
+iam_user credential type, and limits the permissions of the STS credentials`,
+			},
+
+			"default_sts_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Default lifetime of the STS credentials, if not given when requesting them",
+			},
+
+			"max_sts_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum lifetime of the STS credentials",
+			},
+
 			"arn": &framework.FieldSchema{
 				Type:        framework.TypeString,
-				Description: "ARN Reference to a managed policy",
+				Description: "Deprecated; use role_arns or policy_arns instead. ARN Reference to a managed policy or a role",
 			},
 
 			"policy": &framework.FieldSchema{
 				Type:        framework.TypeString,
-				Description: "IAM policy document",
+				Description: "Deprecated; use policy_document instead. IAM policy document",
 			},
 		},
 
@@ -77,76 +110,213 @@ func pathRolesDelete(
 
 func pathRolesRead(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	entry, err := req.Storage.Get("policy/" + d.Get("name").(string))
+	role, err := roleRead(req.Storage, d.Get("name").(string))
 	if err != nil {
 		return nil, err
 	}
-	if entry == nil {
+	if role == nil {
 		return nil, nil
 	}
 
-	val := string(entry.Value)
-	if strings.HasPrefix(val, "arn:") {
-		return &logical.Response{
-			Data: map[string]interface{}{
-				"arn": val,
-			},
-		}, nil
-	}
 	return &logical.Response{
-		Data: map[string]interface{}{
-			"policy": val,
-		},
+		Data: role.toResponseData(),
 	}, nil
 }
 
-func useInlinePolicy(d *framework.FieldData) (bool, error) {
-	bp := d.Get("policy").(string) != ""
-	ba := d.Get("arn").(string) != ""
+func pathRolesWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := roleFromFieldData(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
 
-	if !bp && !ba {
-		return false, errors.New("Either policy or arn must be provided")
+	entry, err := logical.StorageEntryJSON("policy/"+d.Get("name").(string), role)
+	if err != nil {
+		return nil, err
 	}
-	if bp && ba {
-		return false, errors.New("Only one of policy or arn should be provided")
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
 	}
-	return bp, nil
+
+	return nil, nil
 }
 
-func pathRolesWrite(
-	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	var buf bytes.Buffer
+// roleFromFieldData builds and validates a role from the parameters of a
+// request, translating the deprecated "arn" and "policy" parameters.
+func roleFromFieldData(d *framework.FieldData) (*awsRoleEntry, error) {
+	role := &awsRoleEntry{
+		RoleArns:      d.Get("role_arns").([]string),
+		PolicyArns:    d.Get("policy_arns").([]string),
+		DefaultSTSTTL: time.Duration(d.Get("default_sts_ttl").(int)) * time.Second,
+		MaxSTSTTL:     time.Duration(d.Get("max_sts_ttl").(int)) * time.Second,
+	}
 
-	uip, err := useInlinePolicy(d)
-	if err != nil {
+	policyDocument := d.Get("policy_document").(string)
+	legacyArn := d.Get("arn").(string)
+	legacyPolicy := d.Get("policy").(string)
+	if legacyArn != "" || legacyPolicy != "" {
+		if len(role.RoleArns) != 0 || len(role.PolicyArns) != 0 || policyDocument != "" {
+			return nil, errors.New("arn and policy cannot be combined with role_arns, policy_arns or policy_document")
+		}
+		if legacyArn != "" && legacyPolicy != "" {
+			return nil, errors.New("Only one of policy or arn should be provided")
+		}
+		if legacyArn != "" {
+			// No validation is performed on ARNs
+			role = &awsRoleEntry{CredentialTypes: []string{iamUserCred}, PolicyArns: []string{legacyArn}}
+			if strings.Contains(legacyArn, ":role/") {
+				role = &awsRoleEntry{CredentialTypes: []string{assumedRoleCred}, RoleArns: []string{legacyArn}}
+			}
+		} else {
+			role = upgradeLegacyPolicyEntry(legacyPolicy)
+			policyDocument = role.PolicyDocument
+		}
+		role.DefaultSTSTTL = time.Duration(d.Get("default_sts_ttl").(int)) * time.Second
+		role.MaxSTSTTL = time.Duration(d.Get("max_sts_ttl").(int)) * time.Second
+	}
+
+	if credentialType := d.Get("credential_type").(string); credentialType != "" {
+		role.CredentialTypes = strutil.RemoveDuplicates(strutil.ParseStringSlice(credentialType, ","), true)
+	}
+	if len(role.CredentialTypes) == 0 {
+		return nil, errors.New("credential_type is required")
+	}
+
+	if policyDocument != "" {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, []byte(policyDocument)); err != nil {
+			return nil, fmt.Errorf("Error compacting policy: %s", err)
+		}
+		role.PolicyDocument = buf.String()
+	}
+
+	if err := role.validate(); err != nil {
 		return nil, err
 	}
 
-	if uip {
-		if err := json.Compact(&buf, []byte(d.Get("policy").(string))); err != nil {
-			return logical.ErrorResponse(fmt.Sprintf(
-				"Error compacting policy: %s", err)), nil
+	return role, nil
+}
+
+const (
+	// iamUserCred creates an IAM user with access keys
+	iamUserCred = "iam_user"
+
+	// assumedRoleCred assumes one of the roles with sts:AssumeRole
+	assumedRoleCred = "assumed_role"
+
+	// federationTokenCred gets a federation token with
+	// sts:GetFederationToken, limited by the policy document
+	federationTokenCred = "federation_token"
+)
+
+type awsRoleEntry struct {
+	CredentialTypes []string      `json:"credential_types"`
+	RoleArns        []string      `json:"role_arns"`
+	PolicyArns      []string      `json:"policy_arns"`
+	PolicyDocument  string        `json:"policy_document"`
+	DefaultSTSTTL   time.Duration `json:"default_sts_ttl"`
+	MaxSTSTTL       time.Duration `json:"max_sts_ttl"`
+}
+
+func (r *awsRoleEntry) hasCredentialType(credentialType string) bool {
+	return strutil.StrListContains(r.CredentialTypes, credentialType)
+}
+
+func (r *awsRoleEntry) validate() error {
+	var errs []string
+	for _, credentialType := range r.CredentialTypes {
+		switch credentialType {
+		case iamUserCred:
+			if len(r.PolicyArns) == 0 && r.PolicyDocument == "" {
+				errs = append(errs, "policy_arns or policy_document is required for the iam_user credential type")
+			}
+		case assumedRoleCred:
+			if len(r.RoleArns) == 0 {
+				errs = append(errs, "role_arns is required for the assumed_role credential type")
+			}
+		case federationTokenCred:
+			if r.PolicyDocument == "" {
+				errs = append(errs, "policy_document is required for the federation_token credential type")
+			}
+		default:
+			errs = append(errs, fmt.Sprintf("unsupported credential_type %q", credentialType))
 		}
-		// Write the policy into storage
-		err := req.Storage.Put(&logical.StorageEntry{
-			Key:   "policy/" + d.Get("name").(string),
-			Value: buf.Bytes(),
-		})
-		if err != nil {
-			return nil, err
+	}
+
+	if len(r.RoleArns) != 0 && !r.hasCredentialType(assumedRoleCred) {
+		errs = append(errs, "role_arns is only supported by the assumed_role credential type")
+	}
+	if len(r.PolicyArns) != 0 && !r.hasCredentialType(iamUserCred) {
+		errs = append(errs, "policy_arns is only supported by the iam_user credential type")
+	}
+
+	if r.DefaultSTSTTL != 0 || r.MaxSTSTTL != 0 {
+		if !r.hasCredentialType(assumedRoleCred) && !r.hasCredentialType(federationTokenCred) {
+			errs = append(errs, "default_sts_ttl and max_sts_ttl are only supported by STS credential types")
 		}
-	} else {
-		// Write the arn ref into storage
-		err := req.Storage.Put(&logical.StorageEntry{
-			Key:   "policy/" + d.Get("name").(string),
-			Value: []byte(d.Get("arn").(string)),
-		})
-		if err != nil {
-			return nil, err
+		if r.MaxSTSTTL != 0 && r.DefaultSTSTTL > r.MaxSTSTTL {
+			errs = append(errs, "default_sts_ttl cannot be greater than max_sts_ttl")
 		}
 	}
 
-	return nil, nil
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (r *awsRoleEntry) toResponseData() map[string]interface{} {
+	return map[string]interface{}{
+		"credential_types": r.CredentialTypes,
+		"role_arns":        r.RoleArns,
+		"policy_arns":      r.PolicyArns,
+		"policy_document":  r.PolicyDocument,
+		"default_sts_ttl":  int64(r.DefaultSTSTTL.Seconds()),
+		"max_sts_ttl":      int64(r.MaxSTSTTL.Seconds()),
+	}
+}
+
+// roleRead reads a role, upgrading the roles stored before credential types
+// were supported, which are a raw policy document or ARN.
+func roleRead(s logical.Storage, name string) (*awsRoleEntry, error) {
+	entry, err := s.Get("policy/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	role := &awsRoleEntry{}
+	if err := json.Unmarshal(entry.Value, role); err == nil && len(role.CredentialTypes) != 0 {
+		return role, nil
+	}
+
+	return upgradeLegacyPolicyEntry(string(entry.Value)), nil
+}
+
+// upgradeLegacyPolicyEntry returns the role that a raw policy document or ARN
+// was used as: the ARN of a role is assumed, users are created with the ARN
+// of a managed policy, and policy documents are used for both users and
+// federation tokens.
+func upgradeLegacyPolicyEntry(value string) *awsRoleEntry {
+	switch {
+	case strings.HasPrefix(value, "arn:") && strings.Contains(value, ":role/"):
+		return &awsRoleEntry{
+			CredentialTypes: []string{assumedRoleCred},
+			RoleArns:        []string{value},
+		}
+	case strings.HasPrefix(value, "arn:"):
+		return &awsRoleEntry{
+			CredentialTypes: []string{iamUserCred},
+			PolicyArns:      []string{value},
+		}
+	default:
+		return &awsRoleEntry{
+			CredentialTypes: []string{iamUserCred, federationTokenCred},
+			PolicyDocument:  value,
+		}
+	}
 }
 
 const pathListRolesHelpSyn = `List the existing roles in this backend`
@@ -164,11 +334,28 @@ map directly to the route to read the access keys. For example, if the
 backend is mounted at "aws" and you create a role at "aws/roles/deploy"
 then a user could request access credentials at "aws/creds/deploy".
 
-You can either supply a user inline policy (via the policy argument), or
-provide a reference to an existing AWS policy by supplying the full arn
-reference (via the arn argument). Inline user policies written are normal
-IAM policies. Vault will not attempt to parse these except to validate
-that they're basic JSON. No validation is performed on arn references.
+The "credential_type" argument sets the types of credentials issued:
+
+  * "iam_user" creates an IAM user, with the inline policy of the
+    "policy_document" argument and the managed policies of the
+    "policy_arns" argument attached.
+
+  * "assumed_role" assumes one of the roles of the "role_arns" argument,
+    with the permissions of the role limited by the "policy_document"
+    argument, if any.
+
+  * "federation_token" gets a federation token, with the permissions of
+    the "policy_document" argument.
+
+The lifetime of the STS credentials can be set when requesting them, and
+defaults to the "default_sts_ttl" argument, and is limited by the
+"max_sts_ttl" argument. Policy documents are normal IAM policies. Vault will
+not attempt to parse these except to validate that they're basic JSON. No
+validation is performed on ARNs.
+
+The deprecated "arn" and "policy" arguments are translated: the ARN of a role
+is assumed, the ARN of a managed policy is attached to IAM users, and a policy
+is used for both IAM users and federation tokens.
 
 To validate the keys, attempt to read an access key after writing the policy.
 `
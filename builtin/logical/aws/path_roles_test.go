@@ -1,6 +1,7 @@
 package aws
 
 import (
+	"reflect"
 	"strconv"
 	"testing"
 
@@ -62,3 +63,168 @@ func TestBackend_PathListRoles(t *testing.T) {
 		t.Fatalf("failed to list all 10 roles")
 	}
 }
+
+func TestBackend_roleCredentialTypes(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+
+	roleArn := "arn:aws:iam::123456789012:role/deploy"
+	roleReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/test",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"credential_type": "assumed_role",
+			"role_arns":       roleArn + ",arn:aws:iam::123456789012:role/audit",
+			"policy_document": `{ "Version": "2012-10-17" }`,
+			"default_sts_ttl": "15m",
+			"max_sts_ttl":     "1h",
+		},
+	}
+	resp, err := b.HandleRequest(roleReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: role creation failed. resp:%#v\n err:%v", resp, err)
+	}
+
+	roleReq.Operation = logical.ReadOperation
+	resp, err = b.HandleRequest(roleReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: reading role failed. resp:%#v\n err:%v", resp, err)
+	}
+	expected := map[string]interface{}{
+		"credential_types": []string{"assumed_role"},
+		"role_arns":        []string{roleArn, "arn:aws:iam::123456789012:role/audit"},
+		"policy_arns":      []string{},
+		"policy_document":  `{"Version":"2012-10-17"}`,
+		"default_sts_ttl":  int64(900),
+		"max_sts_ttl":      int64(3600),
+	}
+	if !reflect.DeepEqual(resp.Data, expected) {
+		t.Fatalf("bad: expected:%#v\nactual:%#v", expected, resp.Data)
+	}
+
+	// Requests are validated before calling AWS
+	credsReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "creds/test",
+		Storage:   config.StorageView,
+		Data:      map[string]interface{}{"role_arn": roleArn, "ttl": "2h"},
+	}
+	resp, err = b.HandleRequest(credsReq)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for a ttl greater than max_sts_ttl: %#v", resp)
+	}
+	credsReq.Data = map[string]interface{}{}
+	resp, err = b.HandleRequest(credsReq)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error without a role_arn: %#v", resp)
+	}
+	credsReq.Data = map[string]interface{}{"role_arn": "arn:aws:iam::123456789012:role/admin"}
+	resp, err = b.HandleRequest(credsReq)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for a role_arn of another role: %#v", resp)
+	}
+
+	invalid := []map[string]interface{}{
+		{},
+		{"credential_type": "iam_group", "policy_document": "{}"},
+		{"credential_type": "iam_user"},
+		{"credential_type": "assumed_role", "policy_document": "{}"},
+		{"credential_type": "federation_token", "policy_arns": "arn:aws:iam::aws:policy/ReadOnlyAccess"},
+		{"credential_type": "iam_user", "policy_document": "{}", "default_sts_ttl": 900},
+		{"credential_type": "federation_token", "policy_document": "{}", "default_sts_ttl": 900, "max_sts_ttl": 600},
+		{"credential_type": "federation_token", "policy_document": "not json"},
+		{"arn": roleArn, "role_arns": roleArn},
+	}
+	roleReq.Operation = logical.UpdateOperation
+	for _, data := range invalid {
+		roleReq.Data = data
+		resp, err = b.HandleRequest(roleReq)
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error for %v: %#v", data, resp)
+		}
+	}
+}
+
+func TestBackend_roleLegacyEntries(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+
+	// Roles were stored as the raw policy document or ARN
+	cases := map[string]*awsRoleEntry{
+		`{"Version":"2012-10-17"}`: {
+			CredentialTypes: []string{iamUserCred, federationTokenCred},
+			PolicyDocument:  `{"Version":"2012-10-17"}`,
+		},
+		"arn:aws:iam::aws:policy/ReadOnlyAccess": {
+			CredentialTypes: []string{iamUserCred},
+			PolicyArns:      []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"},
+		},
+		"arn:aws:iam::123456789012:role/deploy": {
+			CredentialTypes: []string{assumedRoleCred},
+			RoleArns:        []string{"arn:aws:iam::123456789012:role/deploy"},
+		},
+	}
+	for value, expected := range cases {
+		err := config.StorageView.Put(&logical.StorageEntry{
+			Key:   "policy/legacy",
+			Value: []byte(value),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		role, err := roleRead(config.StorageView, "legacy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(role, expected) {
+			t.Fatalf("bad: expected:%#v\nactual:%#v", expected, role)
+		}
+	}
+
+	// STS credentials cannot be generated for managed policies
+	err := config.StorageView.Put(&logical.StorageEntry{
+		Key:   "policy/legacy",
+		Value: []byte("arn:aws:iam::aws:policy/ReadOnlyAccess"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "sts/legacy",
+		Storage:   config.StorageView,
+	})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected error: %#v", resp)
+	}
+
+	// The deprecated parameters are translated
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/legacy",
+		Storage:   config.StorageView,
+		Data:      map[string]interface{}{"policy": `{ "Version": "2012-10-17" }`},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: role creation failed. resp:%#v\n err:%v", resp, err)
+	}
+	role, err := roleRead(config.StorageView, "legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(role, cases[`{"Version":"2012-10-17"}`]) {
+		t.Fatalf("bad: %#v", role)
+	}
+}
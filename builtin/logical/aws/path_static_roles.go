@@ -0,0 +1,448 @@
+package aws
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	staticRolePath = "static-role/"
+
+	// minRotationPeriod is the shortest rotation period allowed for static
+	// roles, since rotations happen as part of the periodic function and
+	// new access keys take time to propagate through AWS
+	minRotationPeriod = time.Minute
+)
+
+// accessKeysAPI is the part of the IAM API used to rotate the access keys of
+// static roles
+type accessKeysAPI interface {
+	ListAccessKeys(*iam.ListAccessKeysInput) (*iam.ListAccessKeysOutput, error)
+	CreateAccessKey(*iam.CreateAccessKeyInput) (*iam.CreateAccessKeyOutput, error)
+	DeleteAccessKey(*iam.DeleteAccessKeyInput) (*iam.DeleteAccessKeyOutput, error)
+}
+
+func pathListStaticRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-roles/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathStaticRoleList,
+		},
+
+		HelpSynopsis:    pathStaticRolesHelpSyn,
+		HelpDescription: pathStaticRolesHelpDesc,
+	}
+}
+
+func pathStaticRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-roles/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the static role",
+			},
+			"username": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the existing IAM user whose access keys are rotated",
+			},
+			"rotation_period": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Period after which the access key is rotated. Must be at least a minute.",
+			},
+		},
+
+		ExistenceCheck: b.pathStaticRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathStaticRoleRead,
+			logical.CreateOperation: b.pathStaticRoleWrite,
+			logical.UpdateOperation: b.pathStaticRoleWrite,
+			logical.DeleteOperation: b.pathStaticRoleDelete,
+		},
+
+		HelpSynopsis:    pathStaticRolesHelpSyn,
+		HelpDescription: pathStaticRolesHelpDesc,
+	}
+}
+
+func pathStaticCreds(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-creds/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the static role",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathStaticCredsRead,
+		},
+
+		HelpSynopsis:    pathStaticCredsHelpSyn,
+		HelpDescription: pathStaticCredsHelpDesc,
+	}
+}
+
+func pathRotateRole(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "rotate-role/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the static role",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRotateRoleUpdate,
+		},
+
+		HelpSynopsis:    pathRotateRoleHelpSyn,
+		HelpDescription: pathRotateRoleHelpDesc,
+	}
+}
+
+func (b *backend) pathStaticRoleExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	role, err := staticRoleRead(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return role != nil, nil
+}
+
+func (b *backend) pathStaticRoleList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(staticRolePath)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathStaticRoleDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.staticRoleLock.Lock()
+	defer b.staticRoleLock.Unlock()
+
+	// The access key is left to the user, who may still rely on it
+	err := req.Storage.Delete(staticRolePath + d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathStaticRoleRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := staticRoleRead(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"username":            role.Username,
+			"rotation_period":     int64(role.RotationPeriod.Seconds()),
+			"last_vault_rotation": role.LastVaultRotation,
+		},
+	}, nil
+}
+
+func (b *backend) pathStaticRoleWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.staticRoleLock.Lock()
+	defer b.staticRoleLock.Unlock()
+
+	role, err := staticRoleRead(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role = &staticRoleEntry{}
+	}
+
+	// The username cannot change, as the access key of the previous user
+	// would no longer be managed
+	if usernameRaw, ok := d.GetOk("username"); ok {
+		username := usernameRaw.(string)
+		if role.Username != "" && role.Username != username {
+			return logical.ErrorResponse("username of an existing static role cannot be changed"), nil
+		}
+		role.Username = username
+	}
+	if role.Username == "" {
+		return logical.ErrorResponse("username is required"), nil
+	}
+
+	if rotationPeriodRaw, ok := d.GetOk("rotation_period"); ok {
+		role.RotationPeriod = time.Duration(rotationPeriodRaw.(int)) * time.Second
+	}
+	if role.RotationPeriod < minRotationPeriod {
+		return logical.ErrorResponse(fmt.Sprintf("rotation_period must be at least %s", minRotationPeriod)), nil
+	}
+
+	// New roles have their access key rotated right away so that Vault
+	// knows the current credentials
+	if req.Operation == logical.CreateOperation {
+		if err := b.rotateStaticRole(req.Storage, name, role); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf(
+				"Error rotating access key: %s", err)), nil
+		}
+		return nil, nil
+	}
+
+	if err := storeStaticRole(req.Storage, name, role); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathStaticCredsRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	role, err := staticRoleRead(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"Static role '%s' not found", name)), nil
+	}
+
+	ttl := role.LastVaultRotation.Add(role.RotationPeriod).Sub(time.Now())
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"access_key":          role.AccessKeyID,
+			"secret_key":          role.SecretAccessKey,
+			"username":            role.Username,
+			"last_vault_rotation": role.LastVaultRotation,
+			"rotation_period":     int64(role.RotationPeriod.Seconds()),
+			"ttl":                 int64(ttl.Seconds()),
+		},
+	}, nil
+}
+
+func (b *backend) pathRotateRoleUpdate(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.staticRoleLock.Lock()
+	defer b.staticRoleLock.Unlock()
+
+	role, err := staticRoleRead(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"Static role '%s' not found", name)), nil
+	}
+
+	if err := b.rotateStaticRole(req.Storage, name, role); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"Error rotating access key: %s", err)), nil
+	}
+
+	return nil, nil
+}
+
+// rotateStaticRoles rotates the access keys of the static roles whose
+// rotation period has elapsed. It is called from the backend's periodic
+// function.
+func (b *backend) rotateStaticRoles(s logical.Storage) error {
+	b.staticRoleLock.Lock()
+	defer b.staticRoleLock.Unlock()
+
+	names, err := s.List(staticRolePath)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, name := range names {
+		role, err := staticRoleRead(s, name)
+		if err != nil {
+			return err
+		}
+		if role == nil || role.LastVaultRotation.Add(role.RotationPeriod).After(now) {
+			continue
+		}
+
+		if err := b.rotateStaticRole(s, name, role); err != nil {
+			b.Logger().Error("aws: error rotating static role access key", "role", name, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// rotateStaticRole creates a new access key for the user of the static role,
+// deletes the previous one and stores the new one. IAM users have at most two
+// access keys, so the previous key is deleted first if the user has two; keys
+// not created by Vault are never deleted. The caller must hold the
+// staticRoleLock.
+func (b *backend) rotateStaticRole(s logical.Storage, name string, role *staticRoleEntry) error {
+	client, err := b.accessKeysClient(s)
+	if err != nil {
+		return err
+	}
+
+	keysResp, err := client.ListAccessKeys(&iam.ListAccessKeysInput{
+		UserName: aws.String(role.Username),
+	})
+	if err != nil {
+		return err
+	}
+
+	previousKeyExists := false
+	for _, key := range keysResp.AccessKeyMetadata {
+		if role.AccessKeyID != "" && aws.StringValue(key.AccessKeyId) == role.AccessKeyID {
+			previousKeyExists = true
+		}
+	}
+
+	if len(keysResp.AccessKeyMetadata) >= 2 {
+		if !previousKeyExists {
+			return fmt.Errorf("user %q already has two access keys not managed by Vault", role.Username)
+		}
+		if err := deleteAccessKey(client, role.Username, role.AccessKeyID); err != nil {
+			return err
+		}
+		previousKeyExists = false
+	}
+
+	keyResp, err := client.CreateAccessKey(&iam.CreateAccessKeyInput{
+		UserName: aws.String(role.Username),
+	})
+	if err != nil {
+		return err
+	}
+
+	previousKeyID := role.AccessKeyID
+	role.AccessKeyID = aws.StringValue(keyResp.AccessKey.AccessKeyId)
+	role.SecretAccessKey = aws.StringValue(keyResp.AccessKey.SecretAccessKey)
+	role.LastVaultRotation = time.Now()
+	if err := storeStaticRole(s, name, role); err != nil {
+		return err
+	}
+
+	if previousKeyExists {
+		if err := deleteAccessKey(client, role.Username, previousKeyID); err != nil {
+			return fmt.Errorf("error deleting the previous access key: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func deleteAccessKey(client accessKeysAPI, username, accessKeyID string) error {
+	_, err := client.DeleteAccessKey(&iam.DeleteAccessKeyInput{
+		UserName:    aws.String(username),
+		AccessKeyId: aws.String(accessKeyID),
+	})
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == iam.ErrCodeNoSuchEntityException {
+		return nil
+	}
+	return err
+}
+
+func (b *backend) accessKeysClient(s logical.Storage) (accessKeysAPI, error) {
+	if b.accessKeys != nil {
+		return b.accessKeys, nil
+	}
+	return clientIAM(s)
+}
+
+func storeStaticRole(s logical.Storage, name string, role *staticRoleEntry) error {
+	entry, err := logical.StorageEntryJSON(staticRolePath+name, role)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+func staticRoleRead(s logical.Storage, name string) (*staticRoleEntry, error) {
+	entry, err := s.Get(staticRolePath + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result staticRoleEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+type staticRoleEntry struct {
+	Username          string        `json:"username"`
+	AccessKeyID       string        `json:"access_key_id"`
+	SecretAccessKey   string        `json:"secret_access_key"`
+	RotationPeriod    time.Duration `json:"rotation_period"`
+	LastVaultRotation time.Time     `json:"last_vault_rotation"`
+}
+
+const pathStaticRolesHelpSyn = `
+Manage the static roles whose access keys are rotated by this backend.
+`
+
+const pathStaticRolesHelpDesc = `
+This path lets you manage static roles. A static role maps to an existing IAM
+user, whose access key Vault rotates and serves, for systems that cannot use
+short lived credentials.
+
+The "username" parameter is required and is the name of the IAM user. It
+cannot be changed once the role is created.
+
+The "rotation_period" parameter is required and sets how often the access key
+is rotated. The access key is also rotated when the role is created. Each
+rotation creates a new access key and deletes the previous one. As IAM users
+have at most two access keys, the user must have at most one access key not
+managed by Vault.
+
+Deleting a static role leaves its current access key in place.
+`
+
+const pathStaticCredsHelpSyn = `
+Request the current access key of a static role.
+`
+
+const pathStaticCredsHelpDesc = `
+This path reads the current access key of a static role, along with the time
+of the last rotation and the time left until the next one.
+`
+
+const pathRotateRoleHelpSyn = `
+Rotate the access key of a static role.
+`
+
+const pathRotateRoleHelpDesc = `
+This path rotates the access key of a static role right away, and restarts its
+rotation period.
+`
@@ -0,0 +1,301 @@
+package aws
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/hashicorp/vault/logical"
+)
+
+// fakeAccessKeys keeps the access keys of IAM users in memory
+type fakeAccessKeys struct {
+	sync.Mutex
+	next int
+	keys map[string][]string
+}
+
+func (f *fakeAccessKeys) ListAccessKeys(input *iam.ListAccessKeysInput) (*iam.ListAccessKeysOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	keys, ok := f.keys[*input.UserName]
+	if !ok {
+		return nil, awserr.New(iam.ErrCodeNoSuchEntityException, "user not found", nil)
+	}
+	output := &iam.ListAccessKeysOutput{}
+	for _, key := range keys {
+		output.AccessKeyMetadata = append(output.AccessKeyMetadata, &iam.AccessKeyMetadata{
+			AccessKeyId: aws.String(key),
+			UserName:    input.UserName,
+		})
+	}
+	return output, nil
+}
+
+func (f *fakeAccessKeys) CreateAccessKey(input *iam.CreateAccessKeyInput) (*iam.CreateAccessKeyOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	keys, ok := f.keys[*input.UserName]
+	if !ok {
+		return nil, awserr.New(iam.ErrCodeNoSuchEntityException, "user not found", nil)
+	}
+	if len(keys) >= 2 {
+		return nil, awserr.New(iam.ErrCodeLimitExceededException, "too many access keys", nil)
+	}
+	f.next++
+	key := fmt.Sprintf("AKIA%d", f.next)
+	f.keys[*input.UserName] = append(keys, key)
+	return &iam.CreateAccessKeyOutput{
+		AccessKey: &iam.AccessKey{
+			AccessKeyId:     aws.String(key),
+			SecretAccessKey: aws.String("secret-" + key),
+			UserName:        input.UserName,
+		},
+	}, nil
+}
+
+func (f *fakeAccessKeys) DeleteAccessKey(input *iam.DeleteAccessKeyInput) (*iam.DeleteAccessKeyOutput, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	keys := f.keys[*input.UserName]
+	for i, key := range keys {
+		if key == *input.AccessKeyId {
+			f.keys[*input.UserName] = append(keys[:i:i], keys[i+1:]...)
+			return &iam.DeleteAccessKeyOutput{}, nil
+		}
+	}
+	return nil, awserr.New(iam.ErrCodeNoSuchEntityException, "access key not found", nil)
+}
+
+func (f *fakeAccessKeys) userKeys(username string) []string {
+	f.Lock()
+	defer f.Unlock()
+	return append([]string{}, f.keys[username]...)
+}
+
+func testStaticRoleBackend(t *testing.T) (*backend, logical.Storage, *fakeAccessKeys) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeAccessKeys{
+		keys: map[string][]string{
+			"legacy":    {"AKIAUNMANAGED"},
+			"saturated": {"AKIAONE", "AKIATWO"},
+		},
+	}
+	b.accessKeys = fake
+
+	return b, config.StorageView, fake
+}
+
+func TestBackend_staticRoles(t *testing.T) {
+	b, storage, fake := testStaticRoleBackend(t)
+
+	req := &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "static-roles/legacy",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"username":        "legacy",
+			"rotation_period": "1h",
+		},
+	}
+	resp, err := b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// The access key is rotated when the role is created, leaving the
+	// unmanaged key in place
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "static-creds/legacy",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	firstKey := resp.Data["access_key"].(string)
+	if resp.Data["secret_key"] != "secret-"+firstKey || resp.Data["rotation_period"] != int64(3600) {
+		t.Fatalf("bad credentials: %#v", resp.Data)
+	}
+	if ttl := resp.Data["ttl"].(int64); ttl <= 3500 || ttl > 3600 {
+		t.Fatalf("bad ttl: %d", ttl)
+	}
+	if keys := fake.userKeys("legacy"); len(keys) != 2 || keys[0] != "AKIAUNMANAGED" {
+		t.Fatalf("bad keys: %v", keys)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "rotate-role/legacy",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// The previous access key is replaced, even though the user had two keys
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "static-creds/legacy",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	secondKey := resp.Data["access_key"].(string)
+	if secondKey == firstKey {
+		t.Fatal("access key was not rotated")
+	}
+	if keys := fake.userKeys("legacy"); len(keys) != 2 || keys[0] != "AKIAUNMANAGED" || keys[1] != secondKey {
+		t.Fatalf("bad keys: %v", keys)
+	}
+
+	// The username cannot change
+	req.Operation = logical.UpdateOperation
+	req.Data = map[string]interface{}{"username": "saturated"}
+	resp, err = b.HandleRequest(req)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error changing the username: %#v", resp)
+	}
+
+	req.Data = map[string]interface{}{"rotation_period": "2h"}
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "static-roles/legacy",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp.Data["username"] != "legacy" || resp.Data["rotation_period"] != int64(7200) {
+		t.Fatalf("bad role: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["secret_key"]; ok {
+		t.Fatal("secret key returned with the role")
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "static-roles/",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != "legacy" {
+		t.Fatalf("bad list: %v", keys)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "static-roles/legacy",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if keys := fake.userKeys("legacy"); len(keys) != 2 {
+		t.Fatalf("access key deleted with the role: %v", keys)
+	}
+}
+
+func TestBackend_staticRolesValidation(t *testing.T) {
+	b, storage, fake := testStaticRoleBackend(t)
+
+	cases := []map[string]interface{}{
+		{"rotation_period": "1h"},
+		{"username": "legacy"},
+		{"username": "legacy", "rotation_period": "30s"},
+		{"username": "missing", "rotation_period": "1h"},
+		// Keys not managed by Vault are never deleted
+		{"username": "saturated", "rotation_period": "1h"},
+	}
+
+	for i, data := range cases {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "static-roles/test",
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("case %d: expected error for %v: %#v", i, data, resp)
+		}
+	}
+
+	if keys := fake.userKeys("saturated"); len(keys) != 2 {
+		t.Fatalf("bad keys: %v", keys)
+	}
+	if entries, _ := storage.List(staticRolePath); len(entries) != 0 {
+		t.Fatalf("invalid roles were stored: %v", entries)
+	}
+}
+
+func TestBackend_staticRolesPeriodicRotation(t *testing.T) {
+	b, storage, fake := testStaticRoleBackend(t)
+
+	for _, name := range []string{"due", "current"} {
+		fake.keys[name] = nil
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "static-roles/" + name,
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"username":        name,
+				"rotation_period": "1h",
+			},
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+	}
+
+	due, err := staticRoleRead(storage, "due")
+	if err != nil {
+		t.Fatal(err)
+	}
+	due.LastVaultRotation = time.Now().Add(-2 * time.Hour)
+	if err := storeStaticRole(storage, "due", due); err != nil {
+		t.Fatal(err)
+	}
+	dueKeys := fake.userKeys("due")
+	currentKeys := fake.userKeys("current")
+
+	if err := b.periodicFunc(&logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys := fake.userKeys("due"); len(keys) != 1 || keys[0] == dueKeys[0] {
+		t.Fatalf("due access key was not rotated: %v", keys)
+	}
+	if keys := fake.userKeys("current"); len(keys) != 1 || keys[0] != currentKeys[0] {
+		t.Fatalf("current access key was rotated: %v", keys)
+	}
+
+	rotated, err := staticRoleRead(storage, "due")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(rotated.LastVaultRotation) > time.Minute {
+		t.Fatalf("bad last rotation: %s", rotated.LastVaultRotation)
+	}
+}
@@ -1,9 +1,6 @@
 package aws
 
 import (
-	"fmt"
-	"strings"
-
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -18,14 +15,19 @@ func pathSTS(b *backend) *framework.Path {
 			},
 			"ttl": &framework.FieldSchema{
 				Type: framework.TypeDurationSecond,
-				Description: `Lifetime of the token in seconds.
+				Description: `Lifetime of the token in seconds. Defaults to the
+default_sts_ttl of the role, or one hour.
 AWS documentation excerpt: The duration, in seconds, that the credentials
 should remain valid. Acceptable durations for IAM user sessions range from 900
 seconds (15 minutes) to 129600 seconds (36 hours), with 43200 seconds (12
 hours) as the default. Sessions for AWS account owners are restricted to a
 maximum of 3600 seconds (one hour). If the duration is longer than one hour,
 the session for AWS account owners defaults to one hour.`,
-				Default: 3600,
+			},
+			"role_arn": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `ARN of the role to assume, for roles of the assumed_role
+credential type with several role ARNs`,
 			},
 		},
 
@@ -41,38 +43,7 @@ the session for AWS account owners defaults to one hour.`,
 
 func (b *backend) pathSTSRead(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	policyName := d.Get("name").(string)
-	ttl := int64(d.Get("ttl").(int))
-
-	// Read the policy
-	policy, err := req.Storage.Get("policy/" + policyName)
-	if err != nil {
-		return nil, fmt.Errorf("error retrieving role: %s", err)
-	}
-	if policy == nil {
-		return logical.ErrorResponse(fmt.Sprintf(
-			"Role '%s' not found", policyName)), nil
-	}
-	policyValue := string(policy.Value)
-	if strings.HasPrefix(policyValue, "arn:") {
-		if strings.Contains(policyValue, ":role/") {
-			return b.assumeRole(
-				req.Storage,
-				req.DisplayName, policyName, policyValue,
-				ttl,
-			)
-		} else {
-			return logical.ErrorResponse(
-					"Can't generate STS credentials for a managed policy; use a role to assume or an inline policy instead"),
-				logical.ErrInvalidRequest
-		}
-	}
-	// Use the helper to create the secret
-	return b.secretTokenCreate(
-		req.Storage,
-		req.DisplayName, policyName, policyValue,
-		ttl,
-	)
+	return b.credsRead(req, d, true)
 }
 
 const pathSTSHelpSyn = `
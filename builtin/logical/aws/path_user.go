@@ -2,9 +2,11 @@ package aws
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 	"github.com/mitchellh/mapstructure"
@@ -18,10 +20,21 @@ func pathUser(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: "Name of the role",
 			},
+			"ttl": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `Lifetime of the STS credentials in seconds. Defaults to the
+default_sts_ttl of the role, or one hour.`,
+			},
+			"role_arn": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `ARN of the role to assume, for roles of the assumed_role
+credential type with several role ARNs`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
-			logical.ReadOperation: b.pathUserRead,
+			logical.ReadOperation:   b.pathUserRead,
+			logical.UpdateOperation: b.pathUserRead,
 		},
 
 		HelpSynopsis:    pathUserHelpSyn,
@@ -31,21 +44,92 @@ func pathUser(b *backend) *framework.Path {
 
 func (b *backend) pathUserRead(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return b.credsRead(req, d, false)
+}
+
+// credsRead generates credentials of the type of the role. Roles with several
+// types issue IAM users first, then federation tokens, then assumed roles,
+// unless only STS credentials are allowed.
+func (b *backend) credsRead(
+	req *logical.Request, d *framework.FieldData, stsOnly bool) (*logical.Response, error) {
 	policyName := d.Get("name").(string)
 
 	// Read the policy
-	policy, err := req.Storage.Get("policy/" + policyName)
+	role, err := roleRead(req.Storage, policyName)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving role: %s", err)
 	}
-	if policy == nil {
+	if role == nil {
 		return logical.ErrorResponse(fmt.Sprintf(
 			"Role '%s' not found", policyName)), nil
 	}
 
-	// Use the helper to create the secret
-	return b.secretAccessKeysCreate(
-		req.Storage, req.DisplayName, policyName, string(policy.Value))
+	var credentialType string
+	switch {
+	case role.hasCredentialType(iamUserCred) && !stsOnly:
+		credentialType = iamUserCred
+	case role.hasCredentialType(federationTokenCred):
+		credentialType = federationTokenCred
+	case role.hasCredentialType(assumedRoleCred):
+		credentialType = assumedRoleCred
+	case len(role.PolicyArns) != 0:
+		return logical.ErrorResponse(
+				"Can't generate STS credentials for a managed policy; use a role to assume or an inline policy instead"),
+			logical.ErrInvalidRequest
+	default:
+		return logical.ErrorResponse(fmt.Sprintf(
+				"Role '%s' does not have an STS credential type", policyName)),
+			logical.ErrInvalidRequest
+	}
+
+	ttlRaw, ttlSet := d.GetOk("ttl")
+	if credentialType == iamUserCred {
+		if ttlSet {
+			return logical.ErrorResponse("ttl is only supported by STS credentials"), nil
+		}
+
+		// Use the helper to create the secret
+		return b.secretAccessKeysCreate(
+			req.Storage, req.DisplayName, policyName, role)
+	}
+
+	ttl := int64(3600)
+	switch {
+	case ttlSet:
+		ttl = int64(ttlRaw.(int))
+	case role.DefaultSTSTTL != 0:
+		ttl = int64(role.DefaultSTSTTL.Seconds())
+	}
+	if role.MaxSTSTTL != 0 && ttl > int64(role.MaxSTSTTL.Seconds()) {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"ttl cannot be greater than the max_sts_ttl of the role, %d seconds", int64(role.MaxSTSTTL.Seconds()))), nil
+	}
+
+	if credentialType == federationTokenCred {
+		return b.secretTokenCreate(
+			req.Storage,
+			req.DisplayName, policyName, role.PolicyDocument,
+			ttl,
+		)
+	}
+
+	roleArn := d.Get("role_arn").(string)
+	switch {
+	case roleArn == "" && len(role.RoleArns) == 1:
+		roleArn = role.RoleArns[0]
+	case roleArn == "":
+		return logical.ErrorResponse(fmt.Sprintf(
+			"role_arn is required to choose one of the roles: %s", strings.Join(role.RoleArns, ", "))), nil
+	case !strutil.StrListContains(role.RoleArns, roleArn):
+		return logical.ErrorResponse(fmt.Sprintf(
+			"role_arn %q is not one of the roles of %q", roleArn, policyName)), nil
+	}
+
+	return b.assumeRole(
+		req.Storage,
+		req.DisplayName, policyName, roleArn, role.PolicyDocument,
+		ttl,
+	)
 }
 
 func pathUserRollback(req *logical.Request, _kind string, data interface{}) error {
@@ -169,6 +253,10 @@ accessing AWS. The IAM policy used to back this key pair will be
 the "name" parameter. For example, if this backend is mounted at "aws",
 then "aws/creds/deploy" would generate access keys for the "deploy" role.
 
+The type of credentials depends on the credential type of the role. STS
+credentials also have a security token, and their lifetime can be set with
+the "ttl" parameter.
+
 The access keys will have a lease associated with them. The access keys
 can be revoked by using the lease ID.
 `
@@ -6,8 +6,6 @@ import (
 	"regexp"
 	"time"
 
-	"strings"
-
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/sts"
@@ -110,7 +108,7 @@ func (b *backend) secretTokenCreate(s logical.Storage,
 }
 
 func (b *backend) assumeRole(s logical.Storage,
-	displayName, policyName, policy string,
+	displayName, policyName, roleArn, policy string,
 	lifeTimeInSeconds int64) (*logical.Response, error) {
 	STSClient, err := clientSTS(s)
 	if err != nil {
@@ -119,12 +117,17 @@ func (b *backend) assumeRole(s logical.Storage,
 
 	username, usernameWarning := genUsername(displayName, policyName, "iam_user")
 
-	tokenResp, err := STSClient.AssumeRole(
-		&sts.AssumeRoleInput{
-			RoleSessionName: aws.String(username),
-			RoleArn:         aws.String(policy),
-			DurationSeconds: &lifeTimeInSeconds,
-		})
+	assumeRoleInput := &sts.AssumeRoleInput{
+		RoleSessionName: aws.String(username),
+		RoleArn:         aws.String(roleArn),
+		DurationSeconds: &lifeTimeInSeconds,
+	}
+	// The policy further limits the permissions of the role
+	if policy != "" {
+		assumeRoleInput.Policy = aws.String(policy)
+	}
+
+	tokenResp, err := STSClient.AssumeRole(assumeRoleInput)
 
 	if err != nil {
 		return logical.ErrorResponse(fmt.Sprintf(
@@ -137,7 +140,7 @@ func (b *backend) assumeRole(s logical.Storage,
 		"security_token": *tokenResp.Credentials.SessionToken,
 	}, map[string]interface{}{
 		"username": username,
-		"policy":   policy,
+		"policy":   roleArn,
 		"is_sts":   true,
 	})
 
@@ -156,7 +159,7 @@ func (b *backend) assumeRole(s logical.Storage,
 
 func (b *backend) secretAccessKeysCreate(
 	s logical.Storage,
-	displayName, policyName string, policy string) (*logical.Response, error) {
+	displayName, policyName string, role *awsRoleEntry) (*logical.Response, error) {
 	client, err := clientIAM(s)
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), nil
@@ -184,23 +187,24 @@ func (b *backend) secretAccessKeysCreate(
 			"Error creating IAM user: %s", err)), nil
 	}
 
-	if strings.HasPrefix(policy, "arn:") {
-		// Attach existing policy against user
+	// Attach existing policies against user
+	for _, policyArn := range role.PolicyArns {
 		_, err = client.AttachUserPolicy(&iam.AttachUserPolicyInput{
 			UserName:  aws.String(username),
-			PolicyArn: aws.String(policy),
+			PolicyArn: aws.String(policyArn),
 		})
 		if err != nil {
 			return logical.ErrorResponse(fmt.Sprintf(
 				"Error attaching user policy: %s", err)), nil
 		}
+	}
 
-	} else {
+	if role.PolicyDocument != "" {
 		// Add new inline user policy against user
 		_, err = client.PutUserPolicy(&iam.PutUserPolicyInput{
 			UserName:       aws.String(username),
 			PolicyName:     aws.String(policyName),
-			PolicyDocument: aws.String(policy),
+			PolicyDocument: aws.String(role.PolicyDocument),
 		})
 		if err != nil {
 			return logical.ErrorResponse(fmt.Sprintf(
@@ -230,9 +234,10 @@ func (b *backend) secretAccessKeysCreate(
 		"secret_key":     *keyResp.AccessKey.SecretAccessKey,
 		"security_token": nil,
 	}, map[string]interface{}{
-		"username": username,
-		"policy":   policy,
-		"is_sts":   false,
+		"username":    username,
+		"policy":      role.PolicyDocument,
+		"policy_arns": role.PolicyArns,
+		"is_sts":      false,
 	})
 
 	lease, err := b.Lease(s)
@@ -0,0 +1,105 @@
+package azure
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	var b backend
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		Paths: []*framework.Path{
+			pathConfig(&b),
+			pathListRoles(&b),
+			pathRoles(&b),
+			pathCreds(&b),
+		},
+
+		Secrets: []*framework.Secret{
+			secretServicePrincipal(&b),
+		},
+
+		Invalidate: b.invalidate,
+	}
+
+	return &b
+}
+
+type backend struct {
+	*framework.Backend
+
+	// clientLock guards the cached client, which is created from the
+	// configured credentials
+	clientLock sync.RWMutex
+	client     *azureClient
+}
+
+func (b *backend) invalidate(key string) {
+	switch key {
+	case configPath:
+		b.resetClient()
+	}
+}
+
+// azureClient returns the client calling the Azure APIs with the configured
+// credentials.
+func (b *backend) azureClient(s logical.Storage) (*azureClient, error) {
+	b.clientLock.RLock()
+	if b.client != nil {
+		defer b.clientLock.RUnlock()
+		return b.client, nil
+	}
+	b.clientLock.RUnlock()
+
+	b.clientLock.Lock()
+	defer b.clientLock.Unlock()
+
+	// Check again, as the client may have been created while waiting for the
+	// lock
+	if b.client != nil {
+		return b.client, nil
+	}
+
+	config, err := getConfig(s)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, fmt.Errorf("the azure backend is not configured")
+	}
+
+	client, err := newAzureClient(config)
+	if err != nil {
+		return nil, err
+	}
+	b.client = client
+
+	return client, nil
+}
+
+func (b *backend) resetClient() {
+	b.clientLock.Lock()
+	defer b.clientLock.Unlock()
+	b.client = nil
+}
+
+const backendHelp = `
+The Azure backend dynamically generates Azure service principals. Each
+service principal is assigned the Azure roles and added to the Azure Active
+Directory groups of its Vault role, and is deleted when its lease is revoked.
+Roles can also issue leased client secrets for an existing application.
+
+After mounting this backend, the credentials used to manage service
+principals must be configured with the "config" endpoint, and roles written
+with the "roles/" endpoints before any credentials can be generated.
+`
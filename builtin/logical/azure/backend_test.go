@@ -0,0 +1,457 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	testTenantID       = "tenant"
+	testSubscriptionID = "subscription"
+	testReaderRoleID   = "/subscriptions/subscription/providers/Microsoft.Authorization/roleDefinitions/reader"
+)
+
+func init() {
+	principalPropagationDelay = 0
+}
+
+// fakeAzure implements the parts of the Graph and Resource Manager APIs used
+// by the backend. The Graph API is served under /graph/ and the Resource
+// Manager API under /arm/.
+type fakeAzure struct {
+	sync.Mutex
+	nextID       int
+	applications map[string]*application
+	credentials  map[string][]*passwordCredential
+	principals   map[string]string
+	groups       map[string]map[string]bool
+	assignments  map[string]string
+
+	// pendingPrincipals is the number of role assignments rejected because
+	// the service principal has not replicated yet
+	pendingPrincipals int
+}
+
+func newFakeAzure() *fakeAzure {
+	return &fakeAzure{
+		applications: map[string]*application{
+			"existing-object": {ObjectID: "existing-object", AppID: "existing-app"},
+		},
+		credentials: map[string][]*passwordCredential{
+			"existing-object": {{KeyID: "existing-key"}},
+		},
+		principals:  map[string]string{},
+		groups:      map[string]map[string]bool{"group-id": {}},
+		assignments: map[string]string{},
+	}
+}
+
+func (f *fakeAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	if strings.HasPrefix(r.URL.Path, "/arm/") {
+		f.serveARM(w, r, strings.TrimPrefix(r.URL.Path, "/arm"), body)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/graph/"+testTenantID+"/"), "/")
+	switch {
+	case parts[0] == "applications" && len(parts) == 1 && r.Method == "POST":
+		f.nextID++
+		app := &application{
+			ObjectID:    fmt.Sprintf("object-%d", f.nextID),
+			AppID:       fmt.Sprintf("app-%d", f.nextID),
+			DisplayName: body["displayName"].(string),
+		}
+		f.applications[app.ObjectID] = app
+		f.credentials[app.ObjectID] = decodeCredentials(body["passwordCredentials"])
+		json.NewEncoder(w).Encode(app)
+
+	case parts[0] == "applications" && f.applications[parts[1]] == nil:
+		f.error(w, http.StatusNotFound, "Request_ResourceNotFound")
+
+	case parts[0] == "applications" && len(parts) == 2 && r.Method == "GET":
+		json.NewEncoder(w).Encode(f.applications[parts[1]])
+
+	case parts[0] == "applications" && len(parts) == 2 && r.Method == "DELETE":
+		delete(f.principals, f.applications[parts[1]].AppID)
+		delete(f.applications, parts[1])
+		delete(f.credentials, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+
+	case parts[0] == "applications" && r.Method == "GET":
+		var credentials []*passwordCredential
+		for _, c := range f.credentials[parts[1]] {
+			credentials = append(credentials, &passwordCredential{KeyID: c.KeyID})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"value": credentials})
+
+	case parts[0] == "applications" && r.Method == "PATCH":
+		existing := map[string]*passwordCredential{}
+		for _, c := range f.credentials[parts[1]] {
+			existing[c.KeyID] = c
+		}
+		var credentials []*passwordCredential
+		for _, c := range decodeCredentials(body["value"]) {
+			if c.Value == "" {
+				c = existing[c.KeyID]
+			}
+			credentials = append(credentials, c)
+		}
+		f.credentials[parts[1]] = credentials
+		w.WriteHeader(http.StatusNoContent)
+
+	case parts[0] == "servicePrincipals" && r.Method == "POST":
+		appID := body["appId"].(string)
+		f.principals[appID] = "sp-" + appID
+		json.NewEncoder(w).Encode(&servicePrincipal{ObjectID: f.principals[appID], AppID: appID})
+
+	case parts[0] == "groups" && len(parts) == 1:
+		var found []*group
+		if r.URL.Query().Get("$filter") == "displayName eq 'my-group'" {
+			found = append(found, &group{ObjectID: "group-id", DisplayName: "my-group"})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"value": found})
+
+	case parts[0] == "groups" && f.groups[parts[1]] == nil:
+		f.error(w, http.StatusNotFound, "Request_ResourceNotFound")
+
+	case parts[0] == "groups" && len(parts) == 2:
+		json.NewEncoder(w).Encode(&group{ObjectID: parts[1], DisplayName: "my-group"})
+
+	case parts[0] == "groups" && r.Method == "POST":
+		u := body["url"].(string)
+		f.groups[parts[1]][u[strings.LastIndex(u, "/")+1:]] = true
+		w.WriteHeader(http.StatusNoContent)
+
+	case parts[0] == "groups" && r.Method == "DELETE":
+		delete(f.groups[parts[1]], parts[4])
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		f.error(w, http.StatusBadRequest, "unexpected request "+r.Method+" "+r.URL.Path)
+	}
+}
+
+func (f *fakeAzure) serveARM(w http.ResponseWriter, r *http.Request, path string, body map[string]interface{}) {
+	switch {
+	case strings.HasSuffix(path, "/roleDefinitions"):
+		var found []map[string]interface{}
+		if r.URL.Query().Get("$filter") == "roleName eq 'Reader'" {
+			found = append(found, map[string]interface{}{
+				"id":         testReaderRoleID,
+				"properties": map[string]interface{}{"roleName": "Reader"},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"value": found})
+
+	case path == testReaderRoleID:
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":         testReaderRoleID,
+			"properties": map[string]interface{}{"roleName": "Reader"},
+		})
+
+	case strings.Contains(path, "/roleAssignments/") && r.Method == "PUT":
+		if f.pendingPrincipals > 0 {
+			f.pendingPrincipals--
+			f.error(w, http.StatusBadRequest, "PrincipalNotFound")
+			return
+		}
+		properties := body["properties"].(map[string]interface{})
+		f.assignments[path] = properties["principalId"].(string)
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": path})
+
+	case strings.Contains(path, "/roleAssignments/") && r.Method == "DELETE":
+		if _, ok := f.assignments[path]; !ok {
+			f.error(w, http.StatusNotFound, "RoleAssignmentNotFound")
+			return
+		}
+		delete(f.assignments, path)
+		w.WriteHeader(http.StatusOK)
+
+	default:
+		f.error(w, http.StatusNotFound, "ResourceNotFound")
+	}
+}
+
+func (f *fakeAzure) error(w http.ResponseWriter, code int, errCode string) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    errCode,
+			"message": errCode,
+		},
+	})
+}
+
+func (f *fakeAzure) count() (applications, principals, members, assignments int) {
+	f.Lock()
+	defer f.Unlock()
+	return len(f.applications), len(f.principals), len(f.groups["group-id"]), len(f.assignments)
+}
+
+func (f *fakeAzure) keyIDs(objectID string) []string {
+	f.Lock()
+	defer f.Unlock()
+	var ids []string
+	for _, c := range f.credentials[objectID] {
+		ids = append(ids, c.KeyID)
+	}
+	return ids
+}
+
+func decodeCredentials(raw interface{}) []*passwordCredential {
+	b, _ := json.Marshal(raw)
+	var credentials []*passwordCredential
+	json.Unmarshal(b, &credentials)
+	return credentials
+}
+
+func testBackend(t *testing.T) (*backend, logical.Storage, *fakeAzure, func()) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := newFakeAzure()
+	srv := httptest.NewServer(fake)
+	b.client = &azureClient{
+		httpClient:     cleanhttp.DefaultClient(),
+		tenantID:       testTenantID,
+		subscriptionID: testSubscriptionID,
+		armEndpoint:    srv.URL + "/arm/",
+		graphEndpoint:  srv.URL + "/graph/",
+	}
+
+	return b, config.StorageView, fake, srv.Close
+}
+
+func TestBackend_servicePrincipal(t *testing.T) {
+	b, storage, fake, cleanup := testBackend(t)
+	defer cleanup()
+
+	// Role assignments are retried until the service principal replicates
+	fake.pendingPrincipals = 2
+
+	req := &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roles/test",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"azure_roles":  `[{"role_name": "Reader"}]`,
+			"azure_groups": `[{"group_name": "my-group"}]`,
+			"ttl":          "1h",
+			"max_ttl":      "2h",
+		},
+	}
+	resp, err := b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	req.Operation = logical.ReadOperation
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	roles := resp.Data["azure_roles"].([]*azureRole)
+	if len(roles) != 1 || roles[0].RoleID != testReaderRoleID || roles[0].Scope != "/subscriptions/"+testSubscriptionID {
+		t.Fatalf("bad azure_roles: %#v", roles)
+	}
+	groups := resp.Data["azure_groups"].([]*azureGroup)
+	if len(groups) != 1 || groups[0].ObjectID != "group-id" {
+		t.Fatalf("bad azure_groups: %#v", groups)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/test",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp.Data["client_id"] != "app-1" || resp.Data["client_secret"] == "" {
+		t.Fatalf("bad creds: %#v", resp.Data)
+	}
+	if resp.Secret == nil || resp.Secret.TTL != time.Hour {
+		t.Fatalf("bad secret: %#v", resp.Secret)
+	}
+	if apps, principals, members, assignments := fake.count(); apps != 2 || principals != 1 || members != 1 || assignments != 1 {
+		t.Fatalf("bad service principal: %d applications, %d principals, %d members, %d assignments",
+			apps, principals, members, assignments)
+	}
+
+	secret := resp.Secret
+	secret.IssueTime = time.Now()
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   storage,
+		Secret:    secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   storage,
+		Secret:    secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if apps, principals, members, assignments := fake.count(); apps != 1 || principals != 0 || members != 0 || assignments != 0 {
+		t.Fatalf("service principal was not deleted: %d applications, %d principals, %d members, %d assignments",
+			apps, principals, members, assignments)
+	}
+
+	// Revoking again succeeds
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   storage,
+		Secret:    secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// Leases of deleted roles are not renewed
+	req.Operation = logical.DeleteOperation
+	req.Data = nil
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   storage,
+		Secret:    secret,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error renewing the lease: %#v", resp)
+	}
+}
+
+func TestBackend_servicePrincipalCleanup(t *testing.T) {
+	b, storage, fake, cleanup := testBackend(t)
+	defer cleanup()
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roles/test",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"azure_roles":  `[{"role_id": "` + testReaderRoleID + `"}]`,
+			"azure_groups": `[{"object_id": "group-id"}]`,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// The application is deleted if the service principal never replicates
+	fake.pendingPrincipals = principalPropagationAttempts
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/test",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error reading creds: %#v", resp)
+	}
+	if apps, principals, members, assignments := fake.count(); apps != 1 || principals != 0 || members != 0 || assignments != 0 {
+		t.Fatalf("service principal was not cleaned up: %d applications, %d principals, %d members, %d assignments",
+			apps, principals, members, assignments)
+	}
+}
+
+func TestBackend_existingApplication(t *testing.T) {
+	b, storage, fake, cleanup := testBackend(t)
+	defer cleanup()
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roles/test",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"application_object_id": "existing-object",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/test",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp.Data["client_id"] != "existing-app" {
+		t.Fatalf("bad creds: %#v", resp.Data)
+	}
+	keyID := resp.Secret.InternalData["key_id"].(string)
+	if ids := fake.keyIDs("existing-object"); len(ids) != 2 || ids[0] != "existing-key" || ids[1] != keyID {
+		t.Fatalf("bad client secrets: %v", ids)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   storage,
+		Secret:    resp.Secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if ids := fake.keyIDs("existing-object"); len(ids) != 1 || ids[0] != "existing-key" {
+		t.Fatalf("client secret was not removed: %v", ids)
+	}
+	if apps, _, _, _ := fake.count(); apps != 1 {
+		t.Fatal("existing application was deleted")
+	}
+}
+
+func TestBackend_roleValidation(t *testing.T) {
+	b, storage, _, cleanup := testBackend(t)
+	defer cleanup()
+
+	for _, data := range []map[string]interface{}{
+		{},
+		{"azure_roles": `[{"role_name": "Missing"}]`},
+		{"azure_roles": `[{"scope": "/subscriptions/subscription"}]`},
+		{"azure_roles": `not json`},
+		{"azure_groups": `[{"group_name": "missing"}]`},
+		{"azure_groups": `[{"object_id": "missing"}]`},
+		{"application_object_id": "missing"},
+		{"application_object_id": "existing-object", "azure_roles": `[{"role_name": "Reader"}]`},
+		{"azure_roles": `[{"role_name": "Reader"}]`, "ttl": "2h", "max_ttl": "1h"},
+	} {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "roles/test",
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error writing %v: %#v", data, resp)
+		}
+	}
+}
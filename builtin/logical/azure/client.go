@@ -0,0 +1,388 @@
+package azure
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+const (
+	graphAPIVersion         = "1.6"
+	authorizationAPIVersion = "2015-07-01"
+)
+
+// azureClient makes calls to the Azure Resource Manager API, to manage role
+// assignments, and to the Azure Active Directory Graph API, to manage
+// applications, service principals and groups. The Azure SDK for these APIs
+// is not available to Vault, and the few calls made here do not warrant it.
+type azureClient struct {
+	httpClient     *http.Client
+	tenantID       string
+	subscriptionID string
+
+	// armEndpoint and graphEndpoint are the base URLs of the APIs, ending
+	// with a slash
+	armEndpoint   string
+	graphEndpoint string
+
+	// tokenLock guards the tokens, which are refreshed as they expire
+	tokenLock  sync.Mutex
+	armToken   *adal.ServicePrincipalToken
+	graphToken *adal.ServicePrincipalToken
+}
+
+func newAzureClient(config *azureConfig) (*azureClient, error) {
+	environment := azure.PublicCloud
+	if config.Environment != "" {
+		var err error
+		environment, err = azure.EnvironmentFromName(config.Environment)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	oauthConfig, err := adal.NewOAuthConfig(environment.ActiveDirectoryEndpoint, config.TenantID)
+	if err != nil {
+		return nil, err
+	}
+	armToken, err := adal.NewServicePrincipalToken(*oauthConfig, config.ClientID, config.ClientSecret, environment.ResourceManagerEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	graphToken, err := adal.NewServicePrincipalToken(*oauthConfig, config.ClientID, config.ClientSecret, environment.GraphEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := cleanhttp.DefaultClient()
+	httpClient.Timeout = 30 * time.Second
+	armToken.SetSender(httpClient)
+	graphToken.SetSender(httpClient)
+
+	return &azureClient{
+		httpClient:     httpClient,
+		tenantID:       config.TenantID,
+		subscriptionID: config.SubscriptionID,
+		armEndpoint:    environment.ResourceManagerEndpoint,
+		graphEndpoint:  environment.GraphEndpoint,
+		armToken:       armToken,
+		graphToken:     graphToken,
+	}, nil
+}
+
+// apiError is an error returned by an Azure API
+type apiError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("azure API returned status %d (%s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+// isNotFound returns whether err is an API error for a missing resource
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// isPrincipalNotFound returns whether err is an error assigning a role to a
+// service principal that has not replicated through Azure Active Directory
+// yet
+func isPrincipalNotFound(err error) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.Code == "PrincipalNotFound"
+}
+
+type application struct {
+	ObjectID    string `json:"objectId,omitempty"`
+	AppID       string `json:"appId,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+type passwordCredential struct {
+	KeyID     string    `json:"keyId"`
+	StartDate time.Time `json:"startDate"`
+	EndDate   time.Time `json:"endDate"`
+	Value     string    `json:"value,omitempty"`
+}
+
+type servicePrincipal struct {
+	ObjectID string `json:"objectId"`
+	AppID    string `json:"appId"`
+}
+
+type roleDefinition struct {
+	ID         string `json:"id"`
+	Properties struct {
+		RoleName string `json:"roleName"`
+	} `json:"properties"`
+}
+
+type group struct {
+	ObjectID    string `json:"objectId"`
+	DisplayName string `json:"displayName"`
+}
+
+func (c *azureClient) createApplication(name string, credential *passwordCredential) (*application, error) {
+	app := &application{}
+	err := c.graph("POST", "applications", nil, map[string]interface{}{
+		"displayName":         name,
+		"identifierUris":      []string{"https://" + name},
+		"passwordCredentials": []*passwordCredential{credential},
+	}, app)
+	if err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+func (c *azureClient) getApplication(objectID string) (*application, error) {
+	app := &application{}
+	if err := c.graph("GET", "applications/"+url.PathEscape(objectID), nil, nil, app); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+// deleteApplication deletes an application along with its service
+// principal, succeeding if it does not exist.
+func (c *azureClient) deleteApplication(objectID string) error {
+	err := c.graph("DELETE", "applications/"+url.PathEscape(objectID), nil, nil, nil)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (c *azureClient) listPasswordCredentials(objectID string) ([]*passwordCredential, error) {
+	var result struct {
+		Value []*passwordCredential `json:"value"`
+	}
+	if err := c.graph("GET", "applications/"+url.PathEscape(objectID)+"/passwordCredentials", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Value, nil
+}
+
+// setPasswordCredentials replaces the password credentials of an
+// application. Existing credentials are kept by giving their key ID without
+// a value.
+func (c *azureClient) setPasswordCredentials(objectID string, credentials []*passwordCredential) error {
+	if credentials == nil {
+		credentials = []*passwordCredential{}
+	}
+	return c.graph("PATCH", "applications/"+url.PathEscape(objectID)+"/passwordCredentials", nil, map[string]interface{}{
+		"value": credentials,
+	}, nil)
+}
+
+func (c *azureClient) createServicePrincipal(appID string) (*servicePrincipal, error) {
+	sp := &servicePrincipal{}
+	err := c.graph("POST", "servicePrincipals", nil, map[string]interface{}{
+		"appId":          appID,
+		"accountEnabled": true,
+	}, sp)
+	if err != nil {
+		return nil, err
+	}
+	return sp, nil
+}
+
+func (c *azureClient) getGroup(objectID string) (*group, error) {
+	g := &group{}
+	if err := c.graph("GET", "groups/"+url.PathEscape(objectID), nil, nil, g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (c *azureClient) findGroups(displayName string) ([]*group, error) {
+	var result struct {
+		Value []*group `json:"value"`
+	}
+	query := url.Values{"$filter": []string{fmt.Sprintf("displayName eq '%s'", strings.Replace(displayName, "'", "''", -1))}}
+	if err := c.graph("GET", "groups", query, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Value, nil
+}
+
+func (c *azureClient) addGroupMember(groupID, objectID string) error {
+	return c.graph("POST", "groups/"+url.PathEscape(groupID)+"/$links/members", nil, map[string]interface{}{
+		"url": c.graphEndpoint + c.tenantID + "/directoryObjects/" + objectID,
+	}, nil)
+}
+
+// removeGroupMember removes a member of a group, succeeding if it is not a
+// member.
+func (c *azureClient) removeGroupMember(groupID, objectID string) error {
+	err := c.graph("DELETE", "groups/"+url.PathEscape(groupID)+"/$links/members/"+url.PathEscape(objectID), nil, nil, nil)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (c *azureClient) getRoleDefinition(id string) (*roleDefinition, error) {
+	role := &roleDefinition{}
+	if err := c.arm("GET", id, nil, nil, role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (c *azureClient) findRoleDefinitions(scope, roleName string) ([]*roleDefinition, error) {
+	var result struct {
+		Value []*roleDefinition `json:"value"`
+	}
+	query := url.Values{"$filter": []string{fmt.Sprintf("roleName eq '%s'", strings.Replace(roleName, "'", "''", -1))}}
+	if err := c.arm("GET", scope+"/providers/Microsoft.Authorization/roleDefinitions", query, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Value, nil
+}
+
+// createRoleAssignment assigns a role to a principal on a scope, returning
+// the ID of the assignment.
+func (c *azureClient) createRoleAssignment(scope, roleID, principalID, assignmentName string) (string, error) {
+	var result struct {
+		ID string `json:"id"`
+	}
+	err := c.arm("PUT", scope+"/providers/Microsoft.Authorization/roleAssignments/"+assignmentName, nil, map[string]interface{}{
+		"properties": map[string]interface{}{
+			"roleDefinitionId": roleID,
+			"principalId":      principalID,
+		},
+	}, &result)
+	if err != nil {
+		return "", err
+	}
+	return result.ID, nil
+}
+
+// deleteRoleAssignment deletes a role assignment by ID, succeeding if it does
+// not exist.
+func (c *azureClient) deleteRoleAssignment(id string) error {
+	err := c.arm("DELETE", id, nil, nil, nil)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// defaultScope returns the scope of role assignments without an explicit
+// scope, which is the configured subscription
+func (c *azureClient) defaultScope() string {
+	return "/subscriptions/" + c.subscriptionID
+}
+
+func (c *azureClient) graph(method, path string, query url.Values, in, out interface{}) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("api-version", graphAPIVersion)
+	return c.do(method, c.graphEndpoint+c.tenantID+"/"+path+"?"+query.Encode(), c.graphToken, in, out)
+}
+
+func (c *azureClient) arm(method, path string, query url.Values, in, out interface{}) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("api-version", authorizationAPIVersion)
+	return c.do(method, strings.TrimSuffix(c.armEndpoint, "/")+path+"?"+query.Encode(), c.armToken, in, out)
+}
+
+// do makes a request to an API, encoding in as the JSON body and decoding the
+// response into out if they are set.
+func (c *azureClient) do(method, url string, token *adal.ServicePrincipalToken, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if token != nil {
+		c.tokenLock.Lock()
+		err := token.EnsureFresh()
+		accessToken := token.OAuthToken()
+		c.tokenLock.Unlock()
+		if err != nil {
+			return fmt.Errorf("error authenticating to azure: %s", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return decodeAPIError(resp)
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("error decoding azure API response: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// decodeAPIError decodes the errors of both APIs, which differ in format
+func decodeAPIError(resp *http.Response) error {
+	var errResp struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+		GraphError struct {
+			Code    string `json:"code"`
+			Message struct {
+				Value string `json:"value"`
+			} `json:"message"`
+		} `json:"odata.error"`
+	}
+
+	apiErr := &apiError{StatusCode: resp.StatusCode}
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err == nil {
+		apiErr.Code, apiErr.Message = errResp.Error.Code, errResp.Error.Message
+		if apiErr.Code == "" {
+			apiErr.Code, apiErr.Message = errResp.GraphError.Code, errResp.GraphError.Message.Value
+		}
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	return apiErr
+}
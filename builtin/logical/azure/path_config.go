@@ -0,0 +1,159 @@
+package azure
+
+import (
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const configPath = "config"
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config",
+		Fields: map[string]*framework.FieldSchema{
+			"subscription_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "ID of the subscription in which roles are assigned by default.",
+			},
+			"tenant_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "ID of the Azure Active Directory tenant.",
+			},
+			"client_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Client ID of the service principal used by Vault.",
+			},
+			"client_secret": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Client secret of the service principal used by Vault.",
+			},
+			"environment": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Azure environment, such as "AzureUSGovernmentCloud". Defaults to "AzurePublicCloud".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := getConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	// The client secret is not returned
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"subscription_id": config.SubscriptionID,
+			"tenant_id":       config.TenantID,
+			"client_id":       config.ClientID,
+			"environment":     config.Environment,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := getConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &azureConfig{}
+	}
+
+	if v, ok := d.GetOk("subscription_id"); ok {
+		config.SubscriptionID = v.(string)
+	}
+	if v, ok := d.GetOk("tenant_id"); ok {
+		config.TenantID = v.(string)
+	}
+	if v, ok := d.GetOk("client_id"); ok {
+		config.ClientID = v.(string)
+	}
+	if v, ok := d.GetOk("client_secret"); ok {
+		config.ClientSecret = v.(string)
+	}
+	if v, ok := d.GetOk("environment"); ok {
+		config.Environment = v.(string)
+	}
+
+	switch {
+	case config.SubscriptionID == "":
+		return logical.ErrorResponse("subscription_id is required"), nil
+	case config.TenantID == "":
+		return logical.ErrorResponse("tenant_id is required"), nil
+	case config.ClientID == "" || config.ClientSecret == "":
+		return logical.ErrorResponse("client_id and client_secret are required"), nil
+	}
+	if config.Environment != "" {
+		if _, err := azure.EnvironmentFromName(config.Environment); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(configPath, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	b.resetClient()
+
+	return nil, nil
+}
+
+func getConfig(s logical.Storage) (*azureConfig, error) {
+	entry, err := s.Get(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result azureConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+type azureConfig struct {
+	SubscriptionID string `json:"subscription_id"`
+	TenantID       string `json:"tenant_id"`
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	Environment    string `json:"environment"`
+}
+
+const pathConfigHelpSyn = `
+Configure the credentials used to manage service principals.
+`
+
+const pathConfigHelpDesc = `
+The Azure backend needs the credentials of a service principal that is able
+to manage applications and groups in Azure Active Directory, and role
+assignments in the subscription. This endpoint configures the tenant and
+subscription, and the client ID and secret of this service principal.
+
+The "environment" parameter selects the Azure cloud, such as
+"AzureUSGovernmentCloud" or "AzureChinaCloud". It defaults to
+"AzurePublicCloud".
+`
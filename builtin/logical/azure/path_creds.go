@@ -0,0 +1,215 @@
+package azure
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// Service principals take time to replicate through Azure Active Directory,
+// during which roles cannot be assigned to them. Assignments are retried for
+// up to a minute.
+var (
+	principalPropagationDelay    = 5 * time.Second
+	principalPropagationAttempts = 12
+)
+
+func pathCreds(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "creds/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathCredsRead,
+		},
+
+		HelpSynopsis:    pathCredsHelpSyn,
+		HelpDescription: pathCredsHelpDesc,
+	}
+}
+
+func (b *backend) pathCredsRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	role, err := getRole(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %q not found", name)), nil
+	}
+
+	client, err := b.azureClient(req.Storage)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	// Client secrets expire on their own once the lease cannot be renewed
+	// anymore, in case revocation fails
+	maxTTL := role.MaxTTL
+	if maxTTL == 0 {
+		maxTTL = b.System().MaxLeaseTTL()
+	}
+	credential, err := newPasswordCredential(maxTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *logical.Response
+	if role.ApplicationObjectID != "" {
+		resp, err = b.createClientSecret(client, role, credential)
+	} else {
+		resp, err = b.createServicePrincipal(client, name, role, credential)
+	}
+	if err != nil || resp.IsError() {
+		return resp, err
+	}
+
+	resp.Secret.InternalData["role"] = name
+	if role.TTL != 0 {
+		resp.Secret.TTL = role.TTL
+	}
+
+	return resp, nil
+}
+
+// createServicePrincipal creates an application and its service principal,
+// with the Azure roles and groups of the role. Everything created is deleted
+// on failure.
+func (b *backend) createServicePrincipal(client *azureClient, roleName string, role *roleEntry, credential *passwordCredential) (*logical.Response, error) {
+	suffix, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	app, err := client.createApplication(fmt.Sprintf("vault-%s-%s", roleName, suffix), credential)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error creating application: %s", err)), nil
+	}
+
+	created := &servicePrincipalResources{ApplicationObjectID: app.ObjectID}
+	err = func() error {
+		sp, err := client.createServicePrincipal(app.AppID)
+		if err != nil {
+			return errwrap.Wrapf("error creating service principal: {{err}}", err)
+		}
+		created.ServicePrincipalObjectID = sp.ObjectID
+
+		for _, r := range role.AzureRoles {
+			id, err := assignRole(client, r, sp.ObjectID)
+			if err != nil {
+				return errwrap.Wrapf(fmt.Sprintf("error assigning role %q on %s: {{err}}", r.RoleName, r.Scope), err)
+			}
+			created.RoleAssignmentIDs = append(created.RoleAssignmentIDs, id)
+		}
+
+		for _, g := range role.AzureGroups {
+			if err := client.addGroupMember(g.ObjectID, sp.ObjectID); err != nil {
+				return errwrap.Wrapf(fmt.Sprintf("error adding the service principal to group %q: {{err}}", g.GroupName), err)
+			}
+			created.GroupObjectIDs = append(created.GroupObjectIDs, g.ObjectID)
+		}
+
+		return nil
+	}()
+	if err != nil {
+		if cleanupErr := created.delete(client); cleanupErr != nil {
+			err = errwrap.Wrapf(fmt.Sprintf("%s; error cleaning up application %s: {{err}}", err, app.ObjectID), cleanupErr)
+		}
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return b.Secret(SecretServicePrincipalType).Response(map[string]interface{}{
+		"client_id":     app.AppID,
+		"client_secret": credential.Value,
+	}, map[string]interface{}{
+		"app_object_id":       created.ApplicationObjectID,
+		"sp_object_id":        created.ServicePrincipalObjectID,
+		"role_assignment_ids": created.RoleAssignmentIDs,
+		"group_object_ids":    created.GroupObjectIDs,
+	}), nil
+}
+
+// createClientSecret adds a client secret to the existing application of a
+// role.
+func (b *backend) createClientSecret(client *azureClient, role *roleEntry, credential *passwordCredential) (*logical.Response, error) {
+	app, err := client.getApplication(role.ApplicationObjectID)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"error reading application %s: %s", role.ApplicationObjectID, err)), nil
+	}
+
+	credentials, err := client.listPasswordCredentials(app.ObjectID)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error reading client secrets: %s", err)), nil
+	}
+	if err := client.setPasswordCredentials(app.ObjectID, append(credentials, credential)); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error adding client secret: %s", err)), nil
+	}
+
+	return b.Secret(SecretServicePrincipalType).Response(map[string]interface{}{
+		"client_id":     app.AppID,
+		"client_secret": credential.Value,
+	}, map[string]interface{}{
+		"app_object_id": app.ObjectID,
+		"key_id":        credential.KeyID,
+	}), nil
+}
+
+// assignRole assigns an Azure role to a new service principal, waiting for
+// the service principal to replicate.
+func assignRole(client *azureClient, role *azureRole, principalID string) (string, error) {
+	assignmentName, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+
+	for attempt := 1; ; attempt++ {
+		id, err := client.createRoleAssignment(role.Scope, role.RoleID, principalID, assignmentName)
+		if err == nil || !isPrincipalNotFound(err) || attempt == principalPropagationAttempts {
+			return id, err
+		}
+		time.Sleep(principalPropagationDelay)
+	}
+}
+
+func newPasswordCredential(ttl time.Duration) (*passwordCredential, error) {
+	keyID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	password, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	return &passwordCredential{
+		KeyID:     keyID,
+		Value:     password,
+		StartDate: now,
+		EndDate:   now.Add(ttl),
+	}, nil
+}
+
+const pathCredsHelpSyn = `
+Generate Azure credentials from a specific Vault role.
+`
+
+const pathCredsHelpDesc = `
+This path generates Azure credentials for a role. Depending on the role, a
+new service principal is created with the role's Azure roles and groups, or a
+client secret is added to an existing application. The client ID and secret
+are returned, and are deleted when the lease is revoked.
+
+New service principals may take a few minutes to be usable across Azure.
+`
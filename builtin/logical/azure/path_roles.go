@@ -0,0 +1,327 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roles/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    pathRolesHelpSyn,
+		HelpDescription: pathRolesHelpDesc,
+	}
+}
+
+func pathRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roles/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role",
+			},
+			"azure_roles": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `JSON list of the Azure roles assigned to the service principals,
+each with a "role_name" or "role_id" and an optional "scope".`,
+			},
+			"azure_groups": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `JSON list of the Azure Active Directory groups the service
+principals are added to, each with a "group_name" or "object_id".`,
+			},
+			"application_object_id": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Object ID of an existing application. If set, client secrets
+are added to this application instead of creating service principals.`,
+			},
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Default lease of the credentials. Defaults to the system default.",
+			},
+			"max_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum lease of the credentials. Defaults to the system maximum.",
+			},
+		},
+
+		ExistenceCheck: b.pathRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.CreateOperation: b.pathRoleWrite,
+			logical.UpdateOperation: b.pathRoleWrite,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    pathRolesHelpSyn,
+		HelpDescription: pathRolesHelpDesc,
+	}
+}
+
+func (b *backend) pathRoleExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	role, err := getRole(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return role != nil, nil
+}
+
+func (b *backend) pathRoleList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("roles/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathRoleDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	err := req.Storage.Delete("roles/" + d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathRoleRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := getRole(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"azure_roles":           role.AzureRoles,
+			"azure_groups":          role.AzureGroups,
+			"application_object_id": role.ApplicationObjectID,
+			"ttl":                   int64(role.TTL.Seconds()),
+			"max_ttl":               int64(role.MaxTTL.Seconds()),
+		},
+	}, nil
+}
+
+func (b *backend) pathRoleWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	role, err := getRole(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role = &roleEntry{}
+	}
+
+	if v, ok := d.GetOk("azure_roles"); ok {
+		role.AzureRoles = nil
+		if raw := v.(string); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &role.AzureRoles); err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("error parsing azure_roles: %s", err)), nil
+			}
+		}
+	}
+	if v, ok := d.GetOk("azure_groups"); ok {
+		role.AzureGroups = nil
+		if raw := v.(string); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &role.AzureGroups); err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("error parsing azure_groups: %s", err)), nil
+			}
+		}
+	}
+	if v, ok := d.GetOk("application_object_id"); ok {
+		role.ApplicationObjectID = v.(string)
+	}
+	if v, ok := d.GetOk("ttl"); ok {
+		role.TTL = time.Duration(v.(int)) * time.Second
+	}
+	if v, ok := d.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(v.(int)) * time.Second
+	}
+
+	if role.MaxTTL != 0 && role.TTL > role.MaxTTL {
+		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	}
+	if role.ApplicationObjectID != "" && (len(role.AzureRoles) != 0 || len(role.AzureGroups) != 0) {
+		return logical.ErrorResponse("azure_roles and azure_groups cannot be set with an existing application"), nil
+	}
+	if role.ApplicationObjectID == "" && len(role.AzureRoles) == 0 && len(role.AzureGroups) == 0 {
+		return logical.ErrorResponse("at least one of azure_roles, azure_groups or application_object_id is required"), nil
+	}
+
+	client, err := b.azureClient(req.Storage)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	// Roles and groups are looked up now, so that credentials are not
+	// issued with partial permissions later
+	if err := resolveAzureRoles(client, role.AzureRoles); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := resolveAzureGroups(client, role.AzureGroups); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if role.ApplicationObjectID != "" {
+		if _, err := client.getApplication(role.ApplicationObjectID); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf(
+				"error reading application %s: %s", role.ApplicationObjectID, err)), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("roles/"+name, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// resolveAzureRoles fills in the IDs, names and default scopes of the Azure
+// roles.
+func resolveAzureRoles(client *azureClient, roles []*azureRole) error {
+	for _, role := range roles {
+		if role.Scope == "" {
+			role.Scope = client.defaultScope()
+		}
+
+		switch {
+		case role.RoleID != "":
+			definition, err := client.getRoleDefinition(role.RoleID)
+			if err != nil {
+				return fmt.Errorf("error reading role definition %s: %s", role.RoleID, err)
+			}
+			role.RoleName = definition.Properties.RoleName
+
+		case role.RoleName != "":
+			definitions, err := client.findRoleDefinitions(role.Scope, role.RoleName)
+			if err != nil {
+				return fmt.Errorf("error finding role %q: %s", role.RoleName, err)
+			}
+			if len(definitions) != 1 {
+				return fmt.Errorf("found %d roles named %q on %s, expected one", len(definitions), role.RoleName, role.Scope)
+			}
+			role.RoleID = definitions[0].ID
+
+		default:
+			return fmt.Errorf("azure_roles must have a role_name or role_id")
+		}
+	}
+	return nil
+}
+
+// resolveAzureGroups fills in the object IDs and names of the groups.
+func resolveAzureGroups(client *azureClient, groups []*azureGroup) error {
+	for _, g := range groups {
+		switch {
+		case g.ObjectID != "":
+			found, err := client.getGroup(g.ObjectID)
+			if err != nil {
+				return fmt.Errorf("error reading group %s: %s", g.ObjectID, err)
+			}
+			g.GroupName = found.DisplayName
+
+		case g.GroupName != "":
+			found, err := client.findGroups(g.GroupName)
+			if err != nil {
+				return fmt.Errorf("error finding group %q: %s", g.GroupName, err)
+			}
+			if len(found) != 1 {
+				return fmt.Errorf("found %d groups named %q, expected one", len(found), g.GroupName)
+			}
+			g.ObjectID = found[0].ObjectID
+
+		default:
+			return fmt.Errorf("azure_groups must have a group_name or object_id")
+		}
+	}
+	return nil
+}
+
+func getRole(s logical.Storage, name string) (*roleEntry, error) {
+	entry, err := s.Get("roles/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result roleEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+type roleEntry struct {
+	AzureRoles          []*azureRole  `json:"azure_roles"`
+	AzureGroups         []*azureGroup `json:"azure_groups"`
+	ApplicationObjectID string        `json:"application_object_id"`
+	TTL                 time.Duration `json:"ttl"`
+	MaxTTL              time.Duration `json:"max_ttl"`
+}
+
+// azureRole is an Azure role assigned to the service principals on a scope
+type azureRole struct {
+	RoleName string `json:"role_name"`
+	RoleID   string `json:"role_id"`
+	Scope    string `json:"scope"`
+}
+
+// azureGroup is an Azure Active Directory group the service principals are
+// added to
+type azureGroup struct {
+	GroupName string `json:"group_name"`
+	ObjectID  string `json:"object_id"`
+}
+
+const pathRolesHelpSyn = `
+Manage the roles that can be created with this backend.
+`
+
+const pathRolesHelpDesc = `
+This path lets you manage the roles used to generate Azure credentials.
+
+Roles either create a service principal for each lease, or add a client
+secret to an existing application:
+
+The "azure_roles" parameter is a JSON list of the Azure roles assigned to the
+service principals. Each entry has a "role_name" or a "role_id", and a
+"scope" that defaults to the configured subscription:
+
+  [{"role_name": "Reader", "scope": "/subscriptions/<id>/resourceGroups/my-group"}]
+
+The "azure_groups" parameter is a JSON list of the Azure Active Directory
+groups the service principals are added to, each with a "group_name" or an
+"object_id".
+
+The "application_object_id" parameter is the object ID of an existing
+application. Instead of creating service principals, each lease adds a client
+secret to this application, which is removed when the lease is revoked. It
+cannot be combined with "azure_roles" and "azure_groups".
+
+Roles and groups are looked up when the role is written. The "ttl" and
+"max_ttl" parameters configure the leases of the credentials.
+`
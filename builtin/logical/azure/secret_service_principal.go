@@ -0,0 +1,124 @@
+package azure
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"github.com/mitchellh/mapstructure"
+)
+
+const SecretServicePrincipalType = "service_principal"
+
+func secretServicePrincipal(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretServicePrincipalType,
+		Fields: map[string]*framework.FieldSchema{
+			"client_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Client ID of the application",
+			},
+			"client_secret": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Client secret",
+			},
+		},
+
+		Renew:  b.secretServicePrincipalRenew,
+		Revoke: b.secretServicePrincipalRevoke,
+	}
+}
+
+func (b *backend) secretServicePrincipalRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleName, _ := req.Secret.InternalData["role"].(string)
+	role, err := getRole(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %q no longer exists", roleName)), nil
+	}
+
+	return framework.LeaseExtend(role.TTL, role.MaxTTL, b.System())(req, d)
+}
+
+func (b *backend) secretServicePrincipalRevoke(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	var resources servicePrincipalResources
+	if err := mapstructure.Decode(req.Secret.InternalData, &resources); err != nil {
+		return nil, err
+	}
+	if resources.ApplicationObjectID == "" {
+		return nil, fmt.Errorf("secret is missing app_object_id internal data")
+	}
+
+	client, err := b.azureClient(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if resources.KeyID != "" {
+		return nil, removeClientSecret(client, resources.ApplicationObjectID, resources.KeyID)
+	}
+	return nil, resources.delete(client)
+}
+
+// servicePrincipalResources are the Azure resources backing a lease
+type servicePrincipalResources struct {
+	ApplicationObjectID      string   `mapstructure:"app_object_id"`
+	ServicePrincipalObjectID string   `mapstructure:"sp_object_id"`
+	RoleAssignmentIDs        []string `mapstructure:"role_assignment_ids"`
+	GroupObjectIDs           []string `mapstructure:"group_object_ids"`
+
+	// KeyID is the ID of the client secret added to an existing application
+	KeyID string `mapstructure:"key_id"`
+}
+
+// delete removes the role assignments and group memberships of a service
+// principal, and deletes its application. All the resources are deleted
+// even if some fail.
+func (r *servicePrincipalResources) delete(client *azureClient) error {
+	var errs *multierror.Error
+	for _, id := range r.RoleAssignmentIDs {
+		if err := client.deleteRoleAssignment(id); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("error deleting role assignment %s: %s", id, err))
+		}
+	}
+	if r.ServicePrincipalObjectID != "" {
+		for _, id := range r.GroupObjectIDs {
+			if err := client.removeGroupMember(id, r.ServicePrincipalObjectID); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("error removing the service principal from group %s: %s", id, err))
+			}
+		}
+	}
+	if err := client.deleteApplication(r.ApplicationObjectID); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("error deleting application %s: %s", r.ApplicationObjectID, err))
+	}
+	return errs.ErrorOrNil()
+}
+
+// removeClientSecret removes a client secret from an application, succeeding
+// if the application does not exist anymore.
+func removeClientSecret(client *azureClient, appObjectID, keyID string) error {
+	credentials, err := client.listPasswordCredentials(appObjectID)
+	if isNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var remaining []*passwordCredential
+	for _, credential := range credentials {
+		if credential.KeyID != keyID {
+			remaining = append(remaining, credential)
+		}
+	}
+	if len(remaining) == len(credentials) {
+		return nil
+	}
+
+	return client.setPasswordCredentials(appObjectID, remaining)
+}
@@ -2,10 +2,14 @@ package consul
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -314,6 +318,148 @@ func TestBackend_role_lease(t *testing.T) {
 	})
 }
 
+// TestBackend_aclTokens tests tokens created with the ACL token endpoints
+// against a fake Consul server, as they require Consul 1.4 or later.
+func TestBackend_aclTokens(t *testing.T) {
+	var lock sync.Mutex
+	tokens := map[string]*aclToken{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if r.Header.Get("X-Consul-Token") != "master" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch {
+		case r.Method == "PUT" && r.URL.Path == "/v1/acl/token":
+			var token aclToken
+			if err := json.NewDecoder(r.Body).Decode(&token); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			token.AccessorID = fmt.Sprintf("accessor-%d", len(tokens))
+			token.SecretID = fmt.Sprintf("secret-%d", len(tokens))
+			tokens[token.AccessorID] = &token
+			json.NewEncoder(w).Encode(&token)
+
+		case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/v1/acl/token/"):
+			token := tokens[strings.TrimPrefix(r.URL.Path, "/v1/acl/token/")]
+			if token == nil || r.URL.Query().Get("ns") != token.Namespace || r.URL.Query().Get("partition") != token.Partition {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			delete(tokens, token.AccessorID)
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &logical.Request{
+		Storage:   config.StorageView,
+		Operation: logical.UpdateOperation,
+		Path:      "config/access",
+		Data: map[string]interface{}{
+			"address": strings.TrimPrefix(srv.URL, "http://"),
+			"token":   "master",
+		},
+	}
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatal(err)
+	}
+
+	req.Path = "roles/test"
+	req.Data = map[string]interface{}{
+		"policies":           "read-kv,write-kv",
+		"consul_roles":       "operators",
+		"service_identities": []string{"web", "db:dc1,dc2"},
+		"consul_namespace":   "team",
+		"partition":          "part",
+		"lease":              "1h",
+	}
+	resp, err := b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	req.Operation = logical.ReadOperation
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if !reflect.DeepEqual(resp.Data["policies"], []string{"read-kv", "write-kv"}) ||
+		!reflect.DeepEqual(resp.Data["service_identities"], []string{"web", "db:dc1,dc2"}) ||
+		resp.Data["consul_namespace"] != "team" {
+		t.Fatalf("bad role: %#v", resp.Data)
+	}
+
+	req.Path = "creds/test"
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp.Data["token"] != "secret-0" || resp.Data["accessor"] != "accessor-0" {
+		t.Fatalf("bad token: %#v", resp.Data)
+	}
+	if resp.Secret.TTL != time.Hour {
+		t.Fatalf("bad lease: %s", resp.Secret.TTL)
+	}
+
+	token := tokens["accessor-0"]
+	expected := &aclToken{
+		AccessorID:  "accessor-0",
+		SecretID:    "secret-0",
+		Description: token.Description,
+		Policies:    []*aclLink{{Name: "read-kv"}, {Name: "write-kv"}},
+		Roles:       []*aclLink{{Name: "operators"}},
+		ServiceIdentities: []*aclServiceIdentity{
+			{ServiceName: "web"},
+			{ServiceName: "db", Datacenters: []string{"dc1", "dc2"}},
+		},
+		Namespace: "team",
+		Partition: "part",
+	}
+	if !reflect.DeepEqual(token, expected) {
+		t.Fatalf("bad token: %#v", token)
+	}
+
+	req.Operation = logical.RevokeOperation
+	req.Secret = resp.Secret
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 0 {
+		t.Fatalf("token was not deleted: %#v", tokens)
+	}
+
+	// Policy documents are only supported by legacy tokens, and namespaces
+	// require policies, roles or service identities
+	req.Operation = logical.UpdateOperation
+	req.Path = "roles/invalid"
+	req.Secret = nil
+	for _, data := range []map[string]interface{}{
+		{"policy": base64.StdEncoding.EncodeToString([]byte(testPolicy)), "policies": "read-kv"},
+		{"token_type": "management", "policies": "read-kv"},
+		{"consul_namespace": "team"},
+		{"service_identities": []string{":dc1"}},
+	} {
+		req.Data = data
+		resp, err = b.HandleRequest(req)
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error writing %v: %#v", data, resp)
+		}
+	}
+}
+
 func testAccStepConfig(
 	t *testing.T, config map[string]interface{}) logicaltest.TestStep {
 	return logicaltest.TestStep{
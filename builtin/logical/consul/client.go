@@ -1,9 +1,17 @@
 package consul
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-cleanhttp"
 	"github.com/hashicorp/vault/logical"
 )
 
@@ -27,3 +35,141 @@ func client(s logical.Storage) (*api.Client, error, error) {
 	client, err := api.NewClient(consulConf)
 	return client, nil, err
 }
+
+// aclClient calls the ACL token endpoints of Consul 1.4 and later, which
+// the vendored Consul API package predates. Tokens created this way are
+// linked to ACL policies, roles and service identities, and can belong to a
+// namespace and an admin partition.
+type aclClient struct {
+	httpClient *http.Client
+	address    string
+	token      string
+}
+
+func newACLClient(s logical.Storage) (*aclClient, error, error) {
+	conf, userErr, intErr := readConfigAccess(s)
+	if intErr != nil {
+		return nil, nil, intErr
+	}
+	if userErr != nil {
+		return nil, userErr, nil
+	}
+	if conf == nil {
+		return nil, nil, fmt.Errorf("no error received but no configuration found")
+	}
+
+	address := conf.Address
+	if !strings.Contains(address, "://") {
+		scheme := conf.Scheme
+		if scheme == "" {
+			scheme = "http"
+		}
+		address = scheme + "://" + address
+	}
+
+	return &aclClient{
+		httpClient: cleanhttp.DefaultClient(),
+		address:    strings.TrimSuffix(address, "/"),
+		token:      conf.Token,
+	}, nil, nil
+}
+
+type aclToken struct {
+	AccessorID        string                `json:",omitempty"`
+	SecretID          string                `json:",omitempty"`
+	Description       string                `json:",omitempty"`
+	Policies          []*aclLink            `json:",omitempty"`
+	Roles             []*aclLink            `json:",omitempty"`
+	ServiceIdentities []*aclServiceIdentity `json:",omitempty"`
+	Local             bool                  `json:",omitempty"`
+	Namespace         string                `json:",omitempty"`
+	Partition         string                `json:",omitempty"`
+}
+
+// aclLink refers to an ACL policy or role by name
+type aclLink struct {
+	Name string
+}
+
+type aclServiceIdentity struct {
+	ServiceName string
+	Datacenters []string `json:",omitempty"`
+}
+
+func (c *aclClient) createToken(token *aclToken) (*aclToken, error) {
+	created := &aclToken{}
+	if err := c.do("PUT", "/v1/acl/token", nil, token, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// deleteToken deletes a token by accessor ID, succeeding if it does not
+// exist.
+func (c *aclClient) deleteToken(accessorID, namespace, partition string) error {
+	query := url.Values{}
+	if namespace != "" {
+		query.Set("ns", namespace)
+	}
+	if partition != "" {
+		query.Set("partition", partition)
+	}
+
+	err := c.do("DELETE", "/v1/acl/token/"+url.PathEscape(accessorID), query, nil, nil)
+	if respErr, ok := err.(*aclError); ok && respErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// aclError is an error response of the Consul API
+type aclError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *aclError) Error() string {
+	return fmt.Sprintf("Unexpected response code: %d (%s)", e.StatusCode, e.Message)
+}
+
+func (c *aclClient) do(method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	u := c.address + path
+	if len(query) != 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return &aclError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(msg)),
+		}
+	}
+
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package consul
 import (
 	"encoding/base64"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/vault/logical"
@@ -43,6 +44,46 @@ the "policy" parameter is not required.
 Defaults to 'client'.`,
 			},
 
+			"policies": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `List of Consul ACL policies attached to the
+tokens. Requires Consul 1.4 or later.`,
+			},
+
+			"consul_roles": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `List of Consul ACL roles attached to the
+tokens. Requires Consul 1.5 or later.`,
+			},
+
+			"service_identities": &framework.FieldSchema{
+				Type: framework.TypeStringSlice,
+				Description: `List of service identities attached to the
+tokens, each formatted as "<service>" or
+"<service>:<datacenter>,<datacenter>". Requires
+Consul 1.5 or later.`,
+			},
+
+			"consul_namespace": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Consul namespace in which the tokens are
+created. Requires Consul Enterprise 1.7 or later.`,
+			},
+
+			"partition": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Consul admin partition in which the tokens
+are created. Requires Consul Enterprise 1.11 or
+later.`,
+			},
+
+			"local": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Create tokens local to the datacenter of the
+Consul servers, which are not replicated to
+other datacenters.`,
+			},
+
 			"lease": &framework.FieldSchema{
 				Type:        framework.TypeString,
 				Description: "Lease time of the role.",
@@ -91,8 +132,14 @@ func pathRolesRead(
 	// Generate the response
 	resp := &logical.Response{
 		Data: map[string]interface{}{
-			"lease":      result.Lease.String(),
-			"token_type": result.TokenType,
+			"lease":              result.Lease.String(),
+			"token_type":         result.TokenType,
+			"policies":           result.Policies,
+			"consul_roles":       result.ConsulRoles,
+			"service_identities": result.ServiceIdentities,
+			"consul_namespace":   result.ConsulNamespace,
+			"partition":          result.Partition,
+			"local":              result.Local,
 		},
 	}
 	if result.Policy != "" {
@@ -115,9 +162,33 @@ func pathRolesWrite(
 
 	name := d.Get("name").(string)
 	policy := d.Get("policy").(string)
+	role := roleConfig{
+		TokenType:         tokenType,
+		Policies:          d.Get("policies").([]string),
+		ConsulRoles:       d.Get("consul_roles").([]string),
+		ServiceIdentities: d.Get("service_identities").([]string),
+		ConsulNamespace:   d.Get("consul_namespace").(string),
+		Partition:         d.Get("partition").(string),
+		Local:             d.Get("local").(bool),
+	}
+
+	if !role.legacy() {
+		if tokenType == "management" || policy != "" {
+			return logical.ErrorResponse(
+				"policies, consul_roles, service_identities, consul_namespace, partition and local cannot be used with management tokens or a policy document"), nil
+		}
+		if len(role.Policies) == 0 && len(role.ConsulRoles) == 0 && len(role.ServiceIdentities) == 0 {
+			return logical.ErrorResponse(
+				"at least one of policies, consul_roles or service_identities is required"), nil
+		}
+		if _, err := parseServiceIdentities(role.ServiceIdentities); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
 	var policyRaw []byte
 	var err error
-	if tokenType != "management" {
+	if tokenType != "management" && role.legacy() {
 		if policy == "" {
 			return logical.ErrorResponse(
 				"policy cannot be empty when not using management tokens"), nil
@@ -139,11 +210,10 @@ func pathRolesWrite(
 		}
 	}
 
-	entry, err := logical.StorageEntryJSON("policy/"+name, roleConfig{
-		Policy:    string(policyRaw),
-		Lease:     lease,
-		TokenType: tokenType,
-	})
+	role.Policy = string(policyRaw)
+	role.Lease = lease
+
+	entry, err := logical.StorageEntryJSON("policy/"+name, role)
 	if err != nil {
 		return nil, err
 	}
@@ -168,4 +238,44 @@ type roleConfig struct {
 	Policy    string        `json:"policy"`
 	Lease     time.Duration `json:"lease"`
 	TokenType string        `json:"token_type"`
+
+	// Tokens of roles with the following fields are created with the ACL
+	// token endpoints of Consul 1.4 and later
+	Policies          []string `json:"policies"`
+	ConsulRoles       []string `json:"consul_roles"`
+	ServiceIdentities []string `json:"service_identities"`
+	ConsulNamespace   string   `json:"consul_namespace"`
+	Partition         string   `json:"partition"`
+	Local             bool     `json:"local"`
+}
+
+// legacy returns whether the tokens of the role are created with the legacy
+// ACL endpoints, from a policy document.
+func (r *roleConfig) legacy() bool {
+	return len(r.Policies) == 0 && len(r.ConsulRoles) == 0 && len(r.ServiceIdentities) == 0 &&
+		r.ConsulNamespace == "" && r.Partition == "" && !r.Local
+}
+
+// parseServiceIdentities parses service identities formatted as
+// "<service>:<datacenter>,<datacenter>", where the datacenters are optional.
+func parseServiceIdentities(raw []string) ([]*aclServiceIdentity, error) {
+	var identities []*aclServiceIdentity
+	for _, r := range raw {
+		parts := strings.SplitN(r, ":", 2)
+		identity := &aclServiceIdentity{
+			ServiceName: strings.TrimSpace(parts[0]),
+		}
+		if identity.ServiceName == "" {
+			return nil, fmt.Errorf("invalid service identity %q: missing service name", r)
+		}
+		if len(parts) == 2 {
+			for _, dc := range strings.Split(parts[1], ",") {
+				if dc = strings.TrimSpace(dc); dc != "" {
+					identity.Datacenters = append(identity.Datacenters, dc)
+				}
+			}
+		}
+		identities = append(identities, identity)
+	}
+	return identities, nil
 }
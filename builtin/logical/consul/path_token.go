@@ -46,6 +46,10 @@ func (b *backend) pathTokenRead(
 		result.TokenType = "client"
 	}
 
+	if !result.legacy() {
+		return b.createACLToken(req, name, &result)
+	}
+
 	// Get the consul client
 	c, userErr, intErr := client(req.Storage)
 	if intErr != nil {
@@ -78,3 +82,54 @@ func (b *backend) pathTokenRead(
 
 	return s, nil
 }
+
+// createACLToken creates a token linked to the ACL policies, roles and
+// service identities of the role.
+func (b *backend) createACLToken(req *logical.Request, name string, role *roleConfig) (*logical.Response, error) {
+	c, userErr, intErr := newACLClient(req.Storage)
+	if intErr != nil {
+		return nil, intErr
+	}
+	if userErr != nil {
+		return logical.ErrorResponse(userErr.Error()), nil
+	}
+
+	serviceIdentities, err := parseServiceIdentities(role.ServiceIdentities)
+	if err != nil {
+		return nil, err
+	}
+	token := &aclToken{
+		Description:       fmt.Sprintf("Vault %s %s %d", name, req.DisplayName, time.Now().UnixNano()),
+		ServiceIdentities: serviceIdentities,
+		Local:             role.Local,
+		Namespace:         role.ConsulNamespace,
+		Partition:         role.Partition,
+	}
+	for _, policy := range role.Policies {
+		token.Policies = append(token.Policies, &aclLink{Name: policy})
+	}
+	for _, consulRole := range role.ConsulRoles {
+		token.Roles = append(token.Roles, &aclLink{Name: consulRole})
+	}
+
+	token, err = c.createToken(token)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	s := b.Secret(SecretTokenType).Response(map[string]interface{}{
+		"token":            token.SecretID,
+		"accessor":         token.AccessorID,
+		"local":            token.Local,
+		"consul_namespace": token.Namespace,
+		"partition":        token.Partition,
+	}, map[string]interface{}{
+		"token":            token.SecretID,
+		"accessor":         token.AccessorID,
+		"consul_namespace": token.Namespace,
+		"partition":        token.Partition,
+	})
+	s.Secret.TTL = role.Lease
+
+	return s, nil
+}
@@ -17,6 +17,10 @@ func secretToken(b *backend) *framework.Secret {
 				Type:        framework.TypeString,
 				Description: "Request token",
 			},
+			"accessor": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Accessor ID of the token",
+			},
 		},
 
 		Renew:  b.secretTokenRenew,
@@ -32,6 +36,10 @@ func (b *backend) secretTokenRenew(
 
 func secretTokenRevoke(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if accessor, ok := req.Secret.InternalData["accessor"].(string); ok {
+		return nil, revokeACLToken(req, accessor)
+	}
+
 	c, userErr, intErr := client(req.Storage)
 	if intErr != nil {
 		return nil, intErr
@@ -57,3 +65,19 @@ func secretTokenRevoke(
 
 	return nil, nil
 }
+
+// revokeACLToken deletes a token created with the ACL token endpoints, by
+// accessor ID.
+func revokeACLToken(req *logical.Request, accessor string) error {
+	c, userErr, intErr := newACLClient(req.Storage)
+	if intErr != nil {
+		return intErr
+	}
+	if userErr != nil {
+		return userErr
+	}
+
+	namespace, _ := req.Secret.InternalData["consul_namespace"].(string)
+	partition, _ := req.Secret.InternalData["partition"].(string)
+	return c.deleteToken(accessor, namespace, partition)
+}
@@ -31,6 +31,11 @@ func Backend(conf *logical.BackendConfig) *databaseBackend {
 			pathRoles(&b),
 			pathCredsCreate(&b),
 			pathResetConnection(&b),
+			pathRotateRootCredentials(&b),
+			pathListStaticRoles(&b),
+			pathStaticRoles(&b),
+			pathStaticCredsRead(&b),
+			pathRotateRole(&b),
 		},
 
 		Secrets: []*framework.Secret{
@@ -40,6 +45,8 @@ func Backend(conf *logical.BackendConfig) *databaseBackend {
 		Clean: b.closeAllDBs,
 
 		Invalidate: b.invalidate,
+
+		PeriodicFunc: b.periodicFunc,
 	}
 
 	b.logger = conf.Logger
@@ -51,6 +58,9 @@ type databaseBackend struct {
 	connections map[string]dbplugin.Database
 	logger      log.Logger
 
+	// staticRoleLock serializes password rotations of static roles
+	staticRoleLock sync.Mutex
+
 	*framework.Backend
 	sync.RWMutex
 }
@@ -159,6 +169,11 @@ func (b *databaseBackend) clearConnection(name string) {
 	}
 }
 
+// periodicFunc rotates the passwords of static roles when due
+func (b *databaseBackend) periodicFunc(req *logical.Request) error {
+	return b.rotateStaticRoles(req.Storage)
+}
+
 func (b *databaseBackend) closeIfShutdown(name string, err error) {
 	// Plugin has shutdown, close it so next call can reconnect.
 	if err == rpc.ErrShutdown {
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"log"
 	stdhttp "net/http"
+	"net/url"
 	"os"
 	"reflect"
 	"sync"
@@ -173,7 +174,9 @@ func TestBackend_config_connection(t *testing.T) {
 		"connection_details": map[string]interface{}{
 			"connection_url": "sample_connection_url",
 		},
-		"allowed_roles": []string{"*"},
+		"allowed_roles":            []string{"*"},
+		"root_rotation_statements": "",
+		"username_template":        "",
 	}
 	configReq.Operation = logical.ReadOperation
 	resp, err = b.HandleRequest(configReq)
@@ -371,7 +374,9 @@ func TestBackend_connectionCrud(t *testing.T) {
 		"connection_details": map[string]interface{}{
 			"connection_url": connURL,
 		},
-		"allowed_roles": []string{"plugin-role-test"},
+		"allowed_roles":            []string{"plugin-role-test"},
+		"root_rotation_statements": "",
+		"username_template":        "",
 	}
 	req.Operation = logical.ReadOperation
 	resp, err = b.HandleRequest(req)
@@ -717,6 +722,249 @@ func TestBackend_allowedRoles(t *testing.T) {
 	}
 }
 
+func TestBackend_rotateRoot(t *testing.T) {
+	cores, sys := getCore(t)
+	for _, core := range cores {
+		defer core.CloseListeners()
+	}
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	config.System = sys
+
+	b, err := Factory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Cleanup()
+
+	cleanup, connURL := preparePostgresTestContainer(t, config.StorageView, b)
+	defer cleanup()
+
+	// Create the user Vault connects as
+	conn, err := pq.ParseURL(connURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("postgres", conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE ROLE "vault-root" WITH SUPERUSER LOGIN PASSWORD 'initial';`); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(connURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templatedURL := fmt.Sprintf("postgres://{{username}}:{{password}}@%s%s?sslmode=disable", u.Host, u.Path)
+
+	// Configure a connection
+	data := map[string]interface{}{
+		"connection_url": templatedURL,
+		"username":       "vault-root",
+		"password":       "initial",
+		"plugin_name":    "postgresql-database-plugin",
+		"allowed_roles":  []string{"plugin-role-test"},
+	}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/plugin-test",
+		Storage:   config.StorageView,
+		Data:      data,
+	}
+	resp, err := b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// Rotate the root credentials
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "rotate-root/plugin-test",
+		Storage:   config.StorageView,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	if testStaticCredsValid(t, connURL, "vault-root", "initial") {
+		t.Fatal("old root credentials should not be valid")
+	}
+
+	// The connection keeps working with the new password
+	data = map[string]interface{}{
+		"db_name":             "plugin-test",
+		"creation_statements": testRole,
+		"default_ttl":         "5m",
+		"max_ttl":             "10m",
+	}
+	req = &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/plugin-role-test",
+		Storage:   config.StorageView,
+		Data:      data,
+	}
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	credsResp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/plugin-role-test",
+		Storage:   config.StorageView,
+	})
+	if err != nil || (credsResp != nil && credsResp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, credsResp)
+	}
+	if !testCredsExist(t, credsResp, connURL) {
+		t.Fatalf("Creds should exist")
+	}
+}
+
+func TestBackend_staticRole(t *testing.T) {
+	cores, sys := getCore(t)
+	for _, core := range cores {
+		defer core.CloseListeners()
+	}
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	config.System = sys
+
+	b, err := Factory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Cleanup()
+
+	cleanup, connURL := preparePostgresTestContainer(t, config.StorageView, b)
+	defer cleanup()
+
+	// Create the existing user whose password the role manages
+	conn, err := pq.ParseURL(connURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("postgres", conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE ROLE "static-user" WITH LOGIN PASSWORD 'initial';`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Configure a connection
+	data := map[string]interface{}{
+		"connection_url": connURL,
+		"plugin_name":    "postgresql-database-plugin",
+		"allowed_roles":  []string{"static-role-test"},
+	}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/plugin-test",
+		Storage:   config.StorageView,
+		Data:      data,
+	}
+	resp, err := b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// Roles not allowed by the connection are rejected
+	data = map[string]interface{}{
+		"db_name":         "plugin-test",
+		"username":        "static-user",
+		"rotation_period": "1h",
+	}
+	req = &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "static-roles/other-role",
+		Storage:   config.StorageView,
+		Data:      data,
+	}
+	resp, err = b.HandleRequest(req)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response, got err:%s resp:%#v\n", err, resp)
+	}
+
+	// Create a static role, which rotates the password
+	req.Path = "static-roles/static-role-test"
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	readCreds := func() *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "static-creds/static-role-test",
+			Storage:   config.StorageView,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+		return resp
+	}
+
+	credsResp := readCreds()
+	if credsResp.Data["username"] != "static-user" {
+		t.Fatalf("bad username: %#v", credsResp.Data)
+	}
+	password := credsResp.Data["password"].(string)
+	if password == "" || password == "initial" {
+		t.Fatalf("password was not rotated: %#v", credsResp.Data)
+	}
+	if ttl := credsResp.Data["ttl"].(int64); ttl <= 0 || ttl > 3600 {
+		t.Fatalf("bad ttl: %d", ttl)
+	}
+	if !testStaticCredsValid(t, connURL, "static-user", password) {
+		t.Fatal("static credentials should be valid")
+	}
+
+	// Rotate on demand
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "rotate-role/static-role-test",
+		Storage:   config.StorageView,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	credsResp = readCreds()
+	newPassword := credsResp.Data["password"].(string)
+	if newPassword == password {
+		t.Fatal("password was not rotated")
+	}
+	if testStaticCredsValid(t, connURL, "static-user", password) {
+		t.Fatal("old static credentials should not be valid")
+	}
+	if !testStaticCredsValid(t, connURL, "static-user", newPassword) {
+		t.Fatal("new static credentials should be valid")
+	}
+}
+
+func testStaticCredsValid(t *testing.T, connURL, username, password string) bool {
+	u, err := url.Parse(connURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.User = url.UserPassword(username, password)
+
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	return db.Ping() == nil
+}
+
 func testCredsExist(t *testing.T, resp *logical.Response, connURL string) bool {
 	var d struct {
 		Username string `mapstructure:"username"`
@@ -0,0 +1,219 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/mitchellh/mapstructure"
+)
+
+// CredentialTypeClientCertificate is a client certificate whose common name
+// is the username, issued by the CA configured on the role. It is only
+// supported by dynamic roles, as the database only needs to trust the CA.
+const CredentialTypeClientCertificate = "client_certificate"
+
+// credentialConfig is the configuration of the credentials of a role, which
+// depends on the type of credential.
+type credentialConfig struct {
+	// KeyType and KeyBits are the type and size of the generated keys
+	KeyType string `mapstructure:"key_type"`
+	KeyBits int    `mapstructure:"key_bits"`
+
+	// CACert and CAPrivateKey are the PEM encoded CA issuing client
+	// certificates
+	CACert       string `mapstructure:"ca_cert"`
+	CAPrivateKey string `mapstructure:"ca_private_key"`
+
+	caBundle *certutil.ParsedCertBundle
+}
+
+// parseCredentialConfig validates the credential configuration of a role for
+// the type of credential, and fills in the defaults.
+func parseCredentialConfig(credentialType string, raw map[string]interface{}) (*credentialConfig, error) {
+	config := &credentialConfig{}
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		WeaklyTypedInput: true,
+		ErrorUnused:      true,
+		Result:           config,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := decoder.Decode(raw); err != nil {
+		return nil, fmt.Errorf("invalid credential_config: %s", err)
+	}
+
+	switch credentialType {
+	case dbplugin.CredentialTypePassword:
+		if len(raw) != 0 {
+			return nil, fmt.Errorf("credential_config is not supported for passwords")
+		}
+
+	case dbplugin.CredentialTypeRSAPrivateKey:
+		if config.KeyType != "" && config.KeyType != "rsa" {
+			return nil, fmt.Errorf("key_type must be rsa for RSA private keys")
+		}
+		if config.CACert != "" || config.CAPrivateKey != "" {
+			return nil, fmt.Errorf("a CA is only used for client certificates")
+		}
+		config.KeyType = "rsa"
+
+	case CredentialTypeClientCertificate:
+		if config.CACert == "" || config.CAPrivateKey == "" {
+			return nil, fmt.Errorf("ca_cert and ca_private_key are required for client certificates")
+		}
+		config.caBundle, err = certutil.ParsePEMBundle(config.CACert + "\n" + config.CAPrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the CA: %s", err)
+		}
+		if config.caBundle.Certificate == nil || config.caBundle.PrivateKey == nil {
+			return nil, fmt.Errorf("ca_cert must contain a certificate and ca_private_key its private key")
+		}
+		if !config.caBundle.Certificate.IsCA {
+			return nil, fmt.Errorf("ca_cert is not a CA certificate")
+		}
+		match, err := certutil.ComparePublicKeys(config.caBundle.Certificate.PublicKey, config.caBundle.PrivateKey.Public())
+		if err != nil || !match {
+			return nil, fmt.Errorf("ca_private_key is not the private key of ca_cert")
+		}
+		if config.KeyType == "" {
+			config.KeyType = "rsa"
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported credential_type %q", credentialType)
+	}
+
+	switch config.KeyType {
+	case "":
+	case "rsa":
+		if config.KeyBits == 0 {
+			config.KeyBits = 2048
+		}
+		switch config.KeyBits {
+		case 2048, 3072, 4096:
+		default:
+			return nil, fmt.Errorf("unsupported key_bits %d for RSA keys", config.KeyBits)
+		}
+	case "ec":
+		if config.KeyBits == 0 {
+			config.KeyBits = 256
+		}
+		switch config.KeyBits {
+		case 224, 256, 384, 521:
+		default:
+			return nil, fmt.Errorf("unsupported key_bits %d for EC keys", config.KeyBits)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported key_type %q", config.KeyType)
+	}
+
+	return config, nil
+}
+
+// rsaKeyPair is a generated RSA key pair, in the formats given to users and
+// to databases.
+type rsaKeyPair struct {
+	// PrivateKey is the PEM encoded PKCS #8 private key
+	PrivateKey string
+
+	// PublicKey is the base64 encoded DER public key, without the PEM armor,
+	// as substituted for "public_key" in the creation statements
+	PublicKey string
+}
+
+func generateRSAKeyPair(config *credentialConfig) (*rsaKeyPair, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, config.KeyBits)
+	if err != nil {
+		return nil, err
+	}
+
+	privateDER, err := certutil.MarshalPKCS8RSAPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rsaKeyPair{
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{
+			Type:  "PRIVATE KEY",
+			Bytes: privateDER,
+		})),
+		PublicKey: base64.StdEncoding.EncodeToString(publicDER),
+	}, nil
+}
+
+// issueClientCertificate generates a key and issues a client certificate for
+// the username, valid for the given duration or until the CA expires.
+func issueClientCertificate(config *credentialConfig, username string, ttl time.Duration) (*certutil.CertBundle, error) {
+	result := &certutil.ParsedCertBundle{}
+	if err := certutil.GeneratePrivateKey(config.KeyType, config.KeyBits, result); err != nil {
+		return nil, err
+	}
+
+	serialNumber, err := certutil.GenerateSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	subjKeyID, err := certutil.GetSubjKeyID(result.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	caCert := config.caBundle.Certificate
+	notAfter := time.Now().Add(ttl)
+	if caCert.NotAfter.Before(notAfter) {
+		notAfter = caCert.NotAfter
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: username},
+		NotBefore:    time.Now().Add(-30 * time.Second),
+		NotAfter:     notAfter,
+		SubjectKeyId: subjKeyID,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, caCert, result.PrivateKey.Public(), config.caBundle.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("error issuing the client certificate: %s", err)
+	}
+
+	result.CertificateBytes = certBytes
+	result.Certificate, err = x509.ParseCertificate(certBytes)
+	if err != nil {
+		return nil, err
+	}
+	result.CAChain = []*certutil.CertBlock{{
+		Certificate: caCert,
+		Bytes:       caCert.Raw,
+	}}
+
+	return result.ToCertBundle()
+}
+
+// redactCredentialConfig returns the credential configuration of a role
+// without the private key of the CA.
+func redactCredentialConfig(raw map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(raw))
+	for k, v := range raw {
+		if strings.ToLower(k) != "ca_private_key" {
+			redacted[k] = v
+		}
+	}
+	return redacted
+}
@@ -0,0 +1,216 @@
+package database
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/logical"
+)
+
+// testCA returns the PEM encoded certificate and private key of a self-signed
+// CA.
+func testCA(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}))
+}
+
+func TestParseCredentialConfig(t *testing.T) {
+	caCert, caKey := testCA(t)
+	_, otherKey := testCA(t)
+
+	cases := []struct {
+		credentialType string
+		raw            map[string]interface{}
+		valid          bool
+	}{
+		{dbplugin.CredentialTypePassword, nil, true},
+		{dbplugin.CredentialTypePassword, map[string]interface{}{"key_bits": 2048}, false},
+		{dbplugin.CredentialTypeRSAPrivateKey, nil, true},
+		{dbplugin.CredentialTypeRSAPrivateKey, map[string]interface{}{"key_bits": "4096"}, true},
+		{dbplugin.CredentialTypeRSAPrivateKey, map[string]interface{}{"key_bits": 1024}, false},
+		{dbplugin.CredentialTypeRSAPrivateKey, map[string]interface{}{"key_type": "ec"}, false},
+		{dbplugin.CredentialTypeRSAPrivateKey, map[string]interface{}{"unknown": "value"}, false},
+		{CredentialTypeClientCertificate, nil, false},
+		{CredentialTypeClientCertificate, map[string]interface{}{"ca_cert": caCert, "ca_private_key": caKey}, true},
+		{CredentialTypeClientCertificate, map[string]interface{}{"ca_cert": caCert, "ca_private_key": caKey, "key_type": "ec", "key_bits": 384}, true},
+		{CredentialTypeClientCertificate, map[string]interface{}{"ca_cert": caCert, "ca_private_key": otherKey}, false},
+		{CredentialTypeClientCertificate, map[string]interface{}{"ca_cert": caCert, "ca_private_key": caKey, "key_type": "dsa"}, false},
+		{"certificate", nil, false},
+	}
+
+	for i, tc := range cases {
+		_, err := parseCredentialConfig(tc.credentialType, tc.raw)
+		if (err == nil) != tc.valid {
+			t.Fatalf("case %d: bad validation of %s %v: %v", i, tc.credentialType, tc.raw, err)
+		}
+	}
+}
+
+func TestGenerateRSAKeyPair(t *testing.T) {
+	config, err := parseCredentialConfig(dbplugin.CredentialTypeRSAPrivateKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyPair, err := generateRSAKeyPair(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode([]byte(keyPair.PrivateKey))
+	if block == nil || block.Type != "PRIVATE KEY" {
+		t.Fatalf("bad private key: %s", keyPair.PrivateKey)
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := base64.StdEncoding.DecodeString(keyPair.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if publicKey.(*rsa.PublicKey).N.Cmp(privateKey.(*rsa.PrivateKey).N) != 0 {
+		t.Fatal("public key does not match the private key")
+	}
+}
+
+func TestIssueClientCertificate(t *testing.T) {
+	caCert, caKey := testCA(t)
+	config, err := parseCredentialConfig(CredentialTypeClientCertificate, map[string]interface{}{
+		"ca_cert":        caCert,
+		"ca_private_key": caKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certBundle, err := issueClientCertificate(config, "v-token-test", 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := certBundle.ToParsedCertBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := parsed.Certificate
+	if cert.Subject.CommonName != "v-token-test" {
+		t.Fatalf("bad common name: %q", cert.Subject.CommonName)
+	}
+	// The certificate does not outlive the CA
+	if cert.NotAfter.After(config.caBundle.Certificate.NotAfter) {
+		t.Fatalf("bad expiration: %s", cert.NotAfter)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(config.caBundle.Certificate)
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackend_roleCredentialType(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Cleanup()
+
+	caCert, caKey := testCA(t)
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/cert",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"db_name":             "plugin-test",
+			"creation_statements": `CREATE ROLE "{{name}}" WITH LOGIN;`,
+			"credential_type":     CredentialTypeClientCertificate,
+			"credential_config": map[string]interface{}{
+				"ca_cert":        caCert,
+				"ca_private_key": caKey,
+			},
+		},
+	}
+	resp, err := b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// The private key of the CA is not returned
+	req.Operation = logical.ReadOperation
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp.Data["credential_type"] != CredentialTypeClientCertificate {
+		t.Fatalf("bad credential_type: %v", resp.Data["credential_type"])
+	}
+	credentialConfig := resp.Data["credential_config"].(map[string]interface{})
+	if _, ok := credentialConfig["ca_private_key"]; ok || credentialConfig["ca_cert"] != caCert {
+		t.Fatalf("bad credential_config: %v", credentialConfig)
+	}
+
+	// RSA key pairs must be set in the creation statements
+	req.Operation = logical.UpdateOperation
+	req.Path = "roles/rsa"
+	req.Data = map[string]interface{}{
+		"db_name":             "plugin-test",
+		"creation_statements": `CREATE USER "{{name}}";`,
+		"credential_type":     dbplugin.CredentialTypeRSAPrivateKey,
+	}
+	resp, err = b.HandleRequest(req)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error without the public key: %#v", resp)
+	}
+
+	req.Data["creation_statements"] = `CREATE USER "{{name}}" RSA_PUBLIC_KEY = '{{public_key}}';`
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+}
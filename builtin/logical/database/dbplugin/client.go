@@ -2,34 +2,104 @@ package dbplugin
 
 import (
 	"fmt"
+	"net"
 	"net/rpc"
 	"sync"
 	"time"
 
 	"github.com/hashicorp/go-plugin"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin/pb"
 	"github.com/hashicorp/vault/helper/pluginutil"
+	"google.golang.org/grpc"
 )
 
-// DatabasePluginClient embeds a databasePluginRPCClient and wraps it's Close
-// method to also call Kill() on the plugin.Client.
+// DatabasePluginClient wraps a Database served by a plugin process and wraps
+// its Close method to also release the process, which is killed once no
+// connection uses it anymore.
 type DatabasePluginClient struct {
-	client *plugin.Client
-	sync.Mutex
+	process *pluginProcess
 
-	*databasePluginRPCClient
+	Database
 }
 
 func (dc *DatabasePluginClient) Close() error {
-	err := dc.databasePluginRPCClient.Close()
-	dc.client.Kill()
+	err := dc.Database.Close()
+	dc.process.release()
 
 	return err
 }
 
-// newPluginClient returns a databaseRPCClient with a connection to a running
-// plugin. The client is wrapped in a DatabasePluginClient object to ensure the
-// plugin is killed on call of Close().
+// pluginProcess is a running plugin process. Processes of plugins supporting
+// multiplexing are shared by all the connections using the same plugin.
+type pluginProcess struct {
+	key    string
+	client *plugin.Client
+	conn   *grpc.ClientConn
+	refs   int
+}
+
+var (
+	// processes holds the running multiplexed plugin processes, keyed by
+	// plugin name and checksum
+	processes     = make(map[string]*pluginProcess)
+	processesLock sync.Mutex
+)
+
+// newConnection returns a Database for a new connection served by the
+// process. The caller must hold processesLock.
+func (p *pluginProcess) newConnection() (Database, error) {
+	connectionID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	p.refs++
+	return &DatabasePluginClient{
+		process: p,
+		Database: &gRPCClient{
+			client:       pb.NewDatabaseClient(p.conn),
+			connectionID: connectionID,
+		},
+	}, nil
+}
+
+// release drops a reference to the process, and kills it if it was the last
+// one.
+func (p *pluginProcess) release() {
+	processesLock.Lock()
+	defer processesLock.Unlock()
+
+	p.refs--
+	if p.refs > 0 {
+		return
+	}
+
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.client.Kill()
+
+	if processes[p.key] == p {
+		delete(processes, p.key)
+	}
+}
+
+// newPluginClient returns a Database with a connection to a running plugin.
+// A running process of the plugin is reused if the plugin supports
+// multiplexing; otherwise a new one is started. The client is wrapped in a
+// DatabasePluginClient object to ensure the plugin is killed on call of
+// Close().
 func newPluginClient(sys pluginutil.RunnerUtil, pluginRunner *pluginutil.PluginRunner) (Database, error) {
+	key := fmt.Sprintf("%s-%x", pluginRunner.Name, pluginRunner.Sha256)
+
+	processesLock.Lock()
+	defer processesLock.Unlock()
+
+	if p, ok := processes[key]; ok && !p.client.Exited() {
+		return p.newConnection()
+	}
+
 	// pluginMap is the map of plugins we can dispense.
 	var pluginMap = map[string]plugin.Plugin{
 		"database": new(DatabasePlugin),
@@ -43,12 +113,14 @@ func newPluginClient(sys pluginutil.RunnerUtil, pluginRunner *pluginutil.PluginR
 	// Connect via RPC
 	rpcClient, err := client.Client()
 	if err != nil {
+		client.Kill()
 		return nil, err
 	}
 
 	// Request the plugin
 	raw, err := rpcClient.Dispense("database")
 	if err != nil {
+		client.Kill()
 		return nil, err
 	}
 
@@ -56,11 +128,39 @@ func newPluginClient(sys pluginutil.RunnerUtil, pluginRunner *pluginutil.PluginR
 	// implementation but is in fact over an RPC connection.
 	databaseRPC := raw.(*databasePluginRPCClient)
 
-	// Wrap RPC implimentation in DatabasePluginClient
-	return &DatabasePluginClient{
-		client:                  client,
-		databasePluginRPCClient: databaseRPC,
-	}, nil
+	p := &pluginProcess{
+		key:    key,
+		client: client,
+	}
+
+	// Plugins built before the gRPC interface only serve net/rpc, in which
+	// case the process is dedicated to this connection.
+	info, err := databaseRPC.grpcInfo()
+	if err != nil {
+		p.refs = 1
+		return &DatabasePluginClient{
+			process:  p,
+			Database: databaseRPC,
+		}, nil
+	}
+
+	// The broker streams are carried by the plugin's TLS connection, so
+	// gRPC itself does not need transport security.
+	p.conn, err = grpc.Dial("plugin",
+		grpc.WithInsecure(),
+		grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+			return databaseRPC.broker.Dial(info.BrokerID)
+		}))
+	if err != nil {
+		client.Kill()
+		return nil, err
+	}
+
+	if info.Multiplexed {
+		processes[key] = p
+	}
+
+	return p.newConnection()
 }
 
 // ---- RPC client domain ----
@@ -69,6 +169,18 @@ func newPluginClient(sys pluginutil.RunnerUtil, pluginRunner *pluginutil.PluginR
 // make RPC calls to a plugin.
 type databasePluginRPCClient struct {
 	client *rpc.Client
+	broker *plugin.MuxBroker
+}
+
+// grpcInfo asks the plugin to serve its gRPC interface
+func (dr *databasePluginRPCClient) grpcInfo() (*GRPCInfo, error) {
+	var info GRPCInfo
+	err := dr.client.Call("Plugin.GRPC", struct{}{}, &info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
 }
 
 func (dr *databasePluginRPCClient) Type() (string, error) {
@@ -114,6 +226,18 @@ func (dr *databasePluginRPCClient) RevokeUser(statements Statements, username st
 	return err
 }
 
+func (dr *databasePluginRPCClient) SetCredentials(statements Statements, staticUser StaticUserConfig) (username string, password string, err error) {
+	req := SetCredentialsRequest{
+		Statements: statements,
+		StaticUser: staticUser,
+	}
+
+	var resp SetCredentialsResponse
+	err = dr.client.Call("Plugin.SetCredentials", req, &resp)
+
+	return resp.Username, resp.Password, err
+}
+
 func (dr *databasePluginRPCClient) Initialize(conf map[string]interface{}, verifyConnection bool) error {
 	req := InitializeRequest{
 		Config:           conf,
@@ -49,6 +49,15 @@ func (mw *databaseTracingMiddleware) RevokeUser(statements Statements, username
 	return mw.next.RevokeUser(statements, username)
 }
 
+func (mw *databaseTracingMiddleware) SetCredentials(statements Statements, staticUser StaticUserConfig) (username string, password string, err error) {
+	defer func(then time.Time) {
+		mw.logger.Trace("database", "operation", "SetCredentials", "status", "finished", "type", mw.typeStr, "err", err, "took", time.Since(then))
+	}(time.Now())
+
+	mw.logger.Trace("database", "operation", "SetCredentials", "status", "started", "type", mw.typeStr)
+	return mw.next.SetCredentials(statements, staticUser)
+}
+
 func (mw *databaseTracingMiddleware) Initialize(conf map[string]interface{}, verifyConnection bool) (err error) {
 	defer func(then time.Time) {
 		mw.logger.Trace("database", "operation", "Initialize", "status", "finished", "type", mw.typeStr, "verify", verifyConnection, "err", err, "took", time.Since(then))
@@ -129,6 +138,22 @@ func (mw *databaseMetricsMiddleware) RevokeUser(statements Statements, username
 	return mw.next.RevokeUser(statements, username)
 }
 
+func (mw *databaseMetricsMiddleware) SetCredentials(statements Statements, staticUser StaticUserConfig) (username string, password string, err error) {
+	defer func(now time.Time) {
+		metrics.MeasureSince([]string{"database", "SetCredentials"}, now)
+		metrics.MeasureSince([]string{"database", mw.typeStr, "SetCredentials"}, now)
+
+		if err != nil {
+			metrics.IncrCounter([]string{"database", "SetCredentials", "error"}, 1)
+			metrics.IncrCounter([]string{"database", mw.typeStr, "SetCredentials", "error"}, 1)
+		}
+	}(time.Now())
+
+	metrics.IncrCounter([]string{"database", "SetCredentials"}, 1)
+	metrics.IncrCounter([]string{"database", mw.typeStr, "SetCredentials"}, 1)
+	return mw.next.SetCredentials(statements, staticUser)
+}
+
 func (mw *databaseMetricsMiddleware) Initialize(conf map[string]interface{}, verifyConnection bool) (err error) {
 	defer func(now time.Time) {
 		metrics.MeasureSince([]string{"database", "Initialize"}, now)
@@ -0,0 +1,135 @@
+package dbplugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/rpc"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin/pb"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// ---- gRPC client domain ----
+
+// gRPCClient implements Database and is used on the client to make gRPC calls
+// to a plugin. Calls are tagged with the connection ID so that a plugin
+// process can serve several connections.
+type gRPCClient struct {
+	client       pb.DatabaseClient
+	connectionID string
+}
+
+func (c *gRPCClient) context() context.Context {
+	return metadata.NewOutgoingContext(context.Background(), metadata.Pairs(connectionIDKey, c.connectionID))
+}
+
+func (c *gRPCClient) Type() (string, error) {
+	resp, err := c.client.Type(c.context(), &pb.Empty{})
+	if err != nil {
+		return "", convertGRPCError(err)
+	}
+
+	return fmt.Sprintf("plugin-%s", resp.Type), nil
+}
+
+func (c *gRPCClient) CreateUser(statements Statements, usernameConfig UsernameConfig, expiration time.Time) (username string, password string, err error) {
+	resp, err := c.client.CreateUser(c.context(), &pb.CreateUserRequest{
+		Statements: statementsToProto(statements),
+		UsernameConfig: &pb.UsernameConfig{
+			DisplayName: usernameConfig.DisplayName,
+			RoleName:    usernameConfig.RoleName,
+			Template:    usernameConfig.Template,
+		},
+		Expiration: expiration.Unix(),
+	})
+	if err != nil {
+		return "", "", convertGRPCError(err)
+	}
+
+	return resp.Username, resp.Password, nil
+}
+
+func (c *gRPCClient) RenewUser(statements Statements, username string, expiration time.Time) error {
+	_, err := c.client.RenewUser(c.context(), &pb.RenewUserRequest{
+		Statements: statementsToProto(statements),
+		Username:   username,
+		Expiration: expiration.Unix(),
+	})
+
+	return convertGRPCError(err)
+}
+
+func (c *gRPCClient) RevokeUser(statements Statements, username string) error {
+	_, err := c.client.RevokeUser(c.context(), &pb.RevokeUserRequest{
+		Statements: statementsToProto(statements),
+		Username:   username,
+	})
+
+	return convertGRPCError(err)
+}
+
+func (c *gRPCClient) SetCredentials(statements Statements, staticUser StaticUserConfig) (username string, password string, err error) {
+	resp, err := c.client.SetCredentials(c.context(), &pb.SetCredentialsRequest{
+		Statements: statementsToProto(statements),
+		StaticUser: &pb.StaticUserConfig{
+			Username:       staticUser.Username,
+			Password:       staticUser.Password,
+			CredentialType: staticUser.CredentialType,
+		},
+	})
+	if err != nil {
+		return "", "", convertGRPCError(err)
+	}
+
+	return resp.Username, resp.Password, nil
+}
+
+func (c *gRPCClient) Initialize(conf map[string]interface{}, verifyConnection bool) error {
+	config, err := json.Marshal(conf)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.client.Initialize(c.context(), &pb.InitializeRequest{
+		Config:           config,
+		VerifyConnection: verifyConnection,
+	})
+
+	return convertGRPCError(err)
+}
+
+func (c *gRPCClient) Close() error {
+	_, err := c.client.Close(c.context(), &pb.Empty{})
+
+	return convertGRPCError(err)
+}
+
+func statementsToProto(s Statements) *pb.Statements {
+	return &pb.Statements{
+		CreationStatements:   s.CreationStatements,
+		RevocationStatements: s.RevocationStatements,
+		RollbackStatements:   s.RollbackStatements,
+		RenewStatements:      s.RenewStatements,
+		RotationStatements:   s.RotationStatements,
+	}
+}
+
+// convertGRPCError strips the gRPC status from errors returned by the
+// plugin. An unavailable plugin is reported as rpc.ErrShutdown, as with
+// net/rpc plugins, so that callers know to start it again.
+func convertGRPCError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if grpc.Code(err) == codes.Unavailable {
+		return rpc.ErrShutdown
+	}
+
+	return errors.New(grpc.ErrorDesc(err))
+}
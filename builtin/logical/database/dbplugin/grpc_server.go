@@ -0,0 +1,265 @@
+package dbplugin
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-plugin"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin/pb"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// connectionIDKey is the gRPC metadata key identifying the connection a call
+// is made for, when a plugin process serves several connections.
+const connectionIDKey = "connection-id"
+
+// ---- gRPC server domain ----
+
+// gRPCServer implements the gRPC version of Database and is run inside a
+// plugin. If factory is set, an instance of Database is created for each
+// connection; otherwise all calls go to impl.
+type gRPCServer struct {
+	impl    Database
+	factory func() (Database, error)
+
+	instances map[string]Database
+	sync.RWMutex
+}
+
+func newGRPCServer(impl Database, factory func() (Database, error)) *gRPCServer {
+	return &gRPCServer{
+		impl:      impl,
+		factory:   factory,
+		instances: make(map[string]Database),
+	}
+}
+
+// instance returns the Database serving the connection of the call. If create
+// is set, an instance is created for connections not seen before.
+func (s *gRPCServer) instance(ctx context.Context, create bool) (Database, error) {
+	if s.factory == nil {
+		return s.impl, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if len(md[connectionIDKey]) != 1 || md[connectionIDKey][0] == "" {
+		return nil, grpc.Errorf(codes.InvalidArgument, "missing connection ID")
+	}
+	id := md[connectionIDKey][0]
+
+	s.RLock()
+	db, ok := s.instances[id]
+	s.RUnlock()
+	if ok {
+		return db, nil
+	}
+	if !create {
+		return nil, grpc.Errorf(codes.FailedPrecondition, "connection %s is not initialized", id)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	// The instance may have been created while waiting for the lock
+	if db, ok := s.instances[id]; ok {
+		return db, nil
+	}
+
+	db, err := s.factory()
+	if err != nil {
+		return nil, err
+	}
+	s.instances[id] = db
+
+	return db, nil
+}
+
+func (s *gRPCServer) Type(context.Context, *pb.Empty) (*pb.TypeResponse, error) {
+	// The type is the same for all instances
+	t, err := s.impl.Type()
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.TypeResponse{
+		Type: t,
+	}, nil
+}
+
+func (s *gRPCServer) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.CreateUserResponse, error) {
+	db, err := s.instance(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	usernameConfig := UsernameConfig{
+		DisplayName: req.GetUsernameConfig().GetDisplayName(),
+		RoleName:    req.GetUsernameConfig().GetRoleName(),
+		Template:    req.GetUsernameConfig().GetTemplate(),
+	}
+	username, password, err := db.CreateUser(statementsFromProto(req.Statements), usernameConfig, time.Unix(req.Expiration, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.CreateUserResponse{
+		Username: username,
+		Password: password,
+	}, nil
+}
+
+func (s *gRPCServer) RenewUser(ctx context.Context, req *pb.RenewUserRequest) (*pb.Empty, error) {
+	db, err := s.instance(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.RenewUser(statementsFromProto(req.Statements), req.Username, time.Unix(req.Expiration, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.Empty{}, nil
+}
+
+func (s *gRPCServer) RevokeUser(ctx context.Context, req *pb.RevokeUserRequest) (*pb.Empty, error) {
+	db, err := s.instance(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.RevokeUser(statementsFromProto(req.Statements), req.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.Empty{}, nil
+}
+
+func (s *gRPCServer) SetCredentials(ctx context.Context, req *pb.SetCredentialsRequest) (*pb.SetCredentialsResponse, error) {
+	db, err := s.instance(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	staticUser := StaticUserConfig{
+		Username:       req.GetStaticUser().GetUsername(),
+		Password:       req.GetStaticUser().GetPassword(),
+		CredentialType: req.GetStaticUser().GetCredentialType(),
+	}
+	username, password, err := db.SetCredentials(statementsFromProto(req.Statements), staticUser)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.SetCredentialsResponse{
+		Username: username,
+		Password: password,
+	}, nil
+}
+
+func (s *gRPCServer) Initialize(ctx context.Context, req *pb.InitializeRequest) (*pb.Empty, error) {
+	db, err := s.instance(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var config map[string]interface{}
+	if err := json.Unmarshal(req.Config, &config); err != nil {
+		return nil, err
+	}
+
+	if err := db.Initialize(config, req.VerifyConnection); err != nil {
+		return nil, err
+	}
+
+	return &pb.Empty{}, nil
+}
+
+func (s *gRPCServer) Close(ctx context.Context, _ *pb.Empty) (*pb.Empty, error) {
+	if s.factory == nil {
+		s.impl.Close()
+		return &pb.Empty{}, nil
+	}
+
+	db, err := s.instance(ctx, false)
+	if err != nil {
+		// Nothing to close
+		return &pb.Empty{}, nil
+	}
+	db.Close()
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.Lock()
+	delete(s.instances, md[connectionIDKey][0])
+	s.Unlock()
+
+	return &pb.Empty{}, nil
+}
+
+func statementsFromProto(s *pb.Statements) Statements {
+	return Statements{
+		CreationStatements:   s.GetCreationStatements(),
+		RevocationStatements: s.GetRevocationStatements(),
+		RollbackStatements:   s.GetRollbackStatements(),
+		RenewStatements:      s.GetRenewStatements(),
+		RotationStatements:   s.GetRotationStatements(),
+	}
+}
+
+// brokerListener is a net.Listener accepting the connections made to a
+// stream ID of a MuxBroker, over which the gRPC server is run.
+type brokerListener struct {
+	broker *plugin.MuxBroker
+	id     uint32
+
+	closeCh   chan struct{}
+	closeOnce sync.Once
+}
+
+func newBrokerListener(broker *plugin.MuxBroker, id uint32) *brokerListener {
+	return &brokerListener{
+		broker:  broker,
+		id:      id,
+		closeCh: make(chan struct{}),
+	}
+}
+
+func (l *brokerListener) Accept() (net.Conn, error) {
+	for {
+		select {
+		case <-l.closeCh:
+			return nil, errors.New("listener closed")
+		default:
+		}
+
+		// The broker times out when no connection is made to the ID, in
+		// which case we keep waiting
+		conn, err := l.broker.Accept(l.id)
+		if err == nil {
+			return conn, nil
+		}
+	}
+}
+
+func (l *brokerListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closeCh)
+	})
+	return nil
+}
+
+func (l *brokerListener) Addr() net.Addr {
+	return brokerAddr{}
+}
+
+type brokerAddr struct{}
+
+func (brokerAddr) Network() string { return "plugin" }
+func (brokerAddr) String() string  { return "plugin" }
@@ -1,6 +1,7 @@
 package dbplugin
 
 import (
+	"errors"
 	"fmt"
 	"net/rpc"
 	"time"
@@ -17,6 +18,12 @@ type Database interface {
 	RenewUser(statements Statements, username string, expiration time.Time) error
 	RevokeUser(statements Statements, username string) error
 
+	// SetCredentials sets the password of an existing user, as used by static
+	// roles. If the password in staticUser is empty, a new one is generated.
+	// Plugins supporting other types of credentials, such as key pairs,
+	// return the credential in place of the password.
+	SetCredentials(statements Statements, staticUser StaticUserConfig) (username string, password string, err error)
+
 	Initialize(config map[string]interface{}, verifyConnection bool) error
 	Close() error
 }
@@ -27,6 +34,7 @@ type Statements struct {
 	RevocationStatements string `json:"revocation_statements" mapstructure:"revocation_statements" structs:"revocation_statements"`
 	RollbackStatements   string `json:"rollback_statements" mapstructure:"rollback_statements" structs:"rollback_statements"`
 	RenewStatements      string `json:"renew_statements" mapstructure:"renew_statements" structs:"renew_statements"`
+	RotationStatements   string `json:"rotation_statements" mapstructure:"rotation_statements" structs:"rotation_statements"`
 }
 
 // UsernameConfig is used to configure prefixes for the username to be
@@ -34,8 +42,36 @@ type Statements struct {
 type UsernameConfig struct {
 	DisplayName string
 	RoleName    string
+
+	// Template, if set, is the Go template the username is generated from
+	Template string
 }
 
+// StaticUserConfig describes an existing database user whose credentials are
+// managed by Vault.
+type StaticUserConfig struct {
+	Username string
+	Password string
+
+	// CredentialType is the type of credential to set, CredentialTypePassword
+	// if empty. Plugins return ErrUnsupportedCredentialType for types they do
+	// not support.
+	CredentialType string
+}
+
+const (
+	// CredentialTypePassword is a password
+	CredentialTypePassword = "password"
+
+	// CredentialTypeRSAPrivateKey is a PEM encoded RSA private key, whose
+	// public key is set for the user
+	CredentialTypeRSAPrivateKey = "rsa_private_key"
+)
+
+// ErrUnsupportedCredentialType is returned by plugins asked to set a type of
+// credential they do not support.
+var ErrUnsupportedCredentialType = errors.New("unsupported credential type")
+
 // PluginFactory is used to build plugin database types. It wraps the database
 // object in a logging and metrics middleware.
 func PluginFactory(pluginName string, sys pluginutil.LookRunnerUtil, logger log.Logger) (Database, error) {
@@ -105,14 +141,22 @@ var handshakeConfig = plugin.HandshakeConfig{
 // retrieving a server and a client instance of the plugin.
 type DatabasePlugin struct {
 	impl Database
+
+	// factory, if set, creates a Database for each connection served by the
+	// plugin process
+	factory func() (Database, error)
 }
 
-func (d DatabasePlugin) Server(*plugin.MuxBroker) (interface{}, error) {
-	return &databasePluginRPCServer{impl: d.impl}, nil
+func (d DatabasePlugin) Server(b *plugin.MuxBroker) (interface{}, error) {
+	return &databasePluginRPCServer{
+		impl:    d.impl,
+		factory: d.factory,
+		broker:  b,
+	}, nil
 }
 
 func (DatabasePlugin) Client(b *plugin.MuxBroker, c *rpc.Client) (interface{}, error) {
-	return &databasePluginRPCClient{client: c}, nil
+	return &databasePluginRPCClient{client: c, broker: b}, nil
 }
 
 // ---- RPC Request Args Domain ----
@@ -139,9 +183,29 @@ type RevokeUserRequest struct {
 	Username   string
 }
 
+type SetCredentialsRequest struct {
+	Statements Statements
+	StaticUser StaticUserConfig
+}
+
 // ---- RPC Response Args Domain ----
 
+// GRPCInfo describes the gRPC server of a plugin
+type GRPCInfo struct {
+	// BrokerID is the ID of the broker stream the gRPC server is served on
+	BrokerID uint32
+
+	// Multiplexed is true if the plugin process can serve several
+	// connections
+	Multiplexed bool
+}
+
 type CreateUserResponse struct {
 	Username string
 	Password string
 }
+
+type SetCredentialsResponse struct {
+	Username string
+	Password string
+}
@@ -60,6 +60,24 @@ func (m *mockPlugin) RevokeUser(statements dbplugin.Statements, username string)
 	delete(m.users, username)
 	return nil
 }
+func (m *mockPlugin) SetCredentials(statements dbplugin.Statements, staticUser dbplugin.StaticUserConfig) (username string, password string, err error) {
+	err = errors.New("err")
+	if staticUser.Username == "" {
+		return "", "", err
+	}
+
+	if _, ok := m.users[staticUser.Username]; !ok {
+		return "", "", err
+	}
+
+	password = staticUser.Password
+	if password == "" {
+		password = "generated"
+	}
+	m.users[staticUser.Username] = []string{password}
+
+	return staticUser.Username, password, nil
+}
 func (m *mockPlugin) Initialize(conf map[string]interface{}, _ bool) error {
 	err := errors.New("err")
 	if len(conf) != 1 {
@@ -102,8 +120,10 @@ func TestPlugin_Main(t *testing.T) {
 		return
 	}
 
-	plugin := &mockPlugin{
-		users: make(map[string][]string),
+	factory := func() (interface{}, error) {
+		return &mockPlugin{
+			users: make(map[string][]string),
+		}, nil
 	}
 
 	args := []string{"--tls-skip-verify=true"}
@@ -112,7 +132,7 @@ func TestPlugin_Main(t *testing.T) {
 	flags := apiClientMeta.FlagSet()
 	flags.Parse(args)
 
-	plugins.Serve(plugin, apiClientMeta.GetTLSConfig())
+	plugins.ServeMultiplex(factory, apiClientMeta.GetTLSConfig())
 }
 
 func TestPlugin_Initialize(t *testing.T) {
@@ -219,6 +239,110 @@ func TestPlugin_RenewUser(t *testing.T) {
 	}
 }
 
+func TestPlugin_SetCredentials(t *testing.T) {
+	cores, sys := getCore(t)
+	for _, core := range cores {
+		defer core.CloseListeners()
+	}
+
+	db, err := dbplugin.PluginFactory("test-plugin", sys, &log.NullLogger{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer db.Close()
+
+	connectionDetails := map[string]interface{}{
+		"test": 1,
+	}
+	err = db.Initialize(connectionDetails, true)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	usernameConf := dbplugin.UsernameConfig{
+		DisplayName: "test",
+		RoleName:    "test",
+	}
+
+	us, _, err := db.CreateUser(dbplugin.Statements{}, usernameConf, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Test a generated password
+	_, pw, err := db.SetCredentials(dbplugin.Statements{}, dbplugin.StaticUserConfig{Username: us})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if pw != "generated" {
+		t.Fatalf("bad password: %q", pw)
+	}
+
+	// Test a given password
+	_, pw, err = db.SetCredentials(dbplugin.Statements{}, dbplugin.StaticUserConfig{Username: us, Password: "given"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if pw != "given" {
+		t.Fatalf("bad password: %q", pw)
+	}
+
+	// Test an unknown user
+	_, _, err = db.SetCredentials(dbplugin.Statements{}, dbplugin.StaticUserConfig{Username: "unknown"})
+	if err == nil {
+		t.Fatal("expected error for unknown user")
+	}
+}
+
+func TestPlugin_Multiplex(t *testing.T) {
+	cores, sys := getCore(t)
+	for _, core := range cores {
+		defer core.CloseListeners()
+	}
+
+	connectionDetails := map[string]interface{}{
+		"test": 1,
+	}
+	usernameConf := dbplugin.UsernameConfig{
+		DisplayName: "test",
+		RoleName:    "test",
+	}
+
+	db1, err := dbplugin.PluginFactory("test-plugin", sys, &log.NullLogger{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer db1.Close()
+	if err := db1.Initialize(connectionDetails, true); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	db2, err := dbplugin.PluginFactory("test-plugin", sys, &log.NullLogger{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := db2.Initialize(connectionDetails, true); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Each connection has its own instance, so the same user can be created
+	// on both
+	if _, _, err := db1.CreateUser(dbplugin.Statements{}, usernameConf, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, _, err := db2.CreateUser(dbplugin.Statements{}, usernameConf, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Closing one connection leaves the other one working
+	if err := db2.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := db1.RenewUser(dbplugin.Statements{}, "test", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
 func TestPlugin_RevokeUser(t *testing.T) {
 	cores, sys := getCore(t)
 	for _, core := range cores {
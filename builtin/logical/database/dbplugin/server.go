@@ -2,18 +2,41 @@ package dbplugin
 
 import (
 	"crypto/tls"
+	"fmt"
+	"sync"
 
 	"github.com/hashicorp/go-plugin"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin/pb"
+	"google.golang.org/grpc"
 )
 
 // Serve is called from within a plugin and wraps the provided
 // Database implementation in a databasePluginRPCServer object and starts a
-// RPC server.
+// RPC server. All connections made to the plugin process share db.
 func Serve(db Database, tlsProvider func() (*tls.Config, error)) {
-	dbPlugin := &DatabasePlugin{
+	serve(&DatabasePlugin{
 		impl: db,
+	}, tlsProvider)
+}
+
+// ServeMultiplex is like Serve, but creates a new Database with factory for
+// each connection, so that a single plugin process can serve all the
+// connections using the plugin.
+func ServeMultiplex(factory func() (Database, error), tlsProvider func() (*tls.Config, error)) {
+	db, err := factory()
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
 
+	serve(&DatabasePlugin{
+		impl:    db,
+		factory: factory,
+	}, tlsProvider)
+}
+
+func serve(dbPlugin *DatabasePlugin, tlsProvider func() (*tls.Config, error)) {
+
 	// pluginMap is the map of plugins we can dispense.
 	var pluginMap = map[string]plugin.Plugin{
 		"database": dbPlugin,
@@ -31,7 +54,29 @@ func Serve(db Database, tlsProvider func() (*tls.Config, error)) {
 // databasePluginRPCServer implements an RPC version of Database and is run
 // inside a plugin. It wraps an underlying implementation of Database.
 type databasePluginRPCServer struct {
-	impl Database
+	impl    Database
+	factory func() (Database, error)
+	broker  *plugin.MuxBroker
+
+	grpcOnce sync.Once
+	grpcID   uint32
+}
+
+// GRPC starts the gRPC server of the plugin, if not already running, and
+// returns how to reach it. Hosts that predate the gRPC interface never call
+// it and only use net/rpc.
+func (ds *databasePluginRPCServer) GRPC(_ struct{}, resp *GRPCInfo) error {
+	ds.grpcOnce.Do(func() {
+		ds.grpcID = ds.broker.NextId()
+
+		server := grpc.NewServer()
+		pb.RegisterDatabaseServer(server, newGRPCServer(ds.impl, ds.factory))
+		go server.Serve(newBrokerListener(ds.broker, ds.grpcID))
+	})
+
+	resp.BrokerID = ds.grpcID
+	resp.Multiplexed = ds.factory != nil
+	return nil
 }
 
 func (ds *databasePluginRPCServer) Type(_ struct{}, resp *string) error {
@@ -59,6 +104,13 @@ func (ds *databasePluginRPCServer) RevokeUser(args *RevokeUserRequest, _ *struct
 	return err
 }
 
+func (ds *databasePluginRPCServer) SetCredentials(args *SetCredentialsRequest, resp *SetCredentialsResponse) error {
+	var err error
+	resp.Username, resp.Password, err = ds.impl.SetCredentials(args.Statements, args.StaticUser)
+
+	return err
+}
+
 func (ds *databasePluginRPCServer) Initialize(args *InitializeRequest, _ *struct{}) error {
 	err := ds.impl.Initialize(args.Config, args.VerifyConnection)
 
@@ -8,6 +8,7 @@ import (
 	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
+	"github.com/hashicorp/vault/plugins/helper/database/credsutil"
 )
 
 var (
@@ -23,6 +24,12 @@ type DatabaseConfig struct {
 	// by each database type.
 	ConnectionDetails map[string]interface{} `json:"connection_details" structs:"connection_details" mapstructure:"connection_details"`
 	AllowedRoles      []string               `json:"allowed_roles" structs:"allowed_roles" mapstructure:"allowed_roles"`
+	// RootRotationStatements are the statements used to rotate the password of
+	// the user Vault connects as. The plugin's defaults are used if empty.
+	RootRotationStatements string `json:"root_rotation_statements" structs:"root_rotation_statements" mapstructure:"root_rotation_statements"`
+	// UsernameTemplate is the template used to generate usernames for the
+	// roles that do not set their own
+	UsernameTemplate string `json:"username_template" structs:"username_template" mapstructure:"username_template"`
 }
 
 // pathResetConnection configures a path to reset a plugin.
@@ -102,6 +109,21 @@ func pathConfigurePluginConnection(b *databaseBackend) *framework.Path {
 				allowed to get creds from this database connection. If empty no
 				roles are allowed. If "*" all roles are allowed.`,
 			},
+
+			"root_rotation_statements": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Specifies the database statements to be executed
+				to rotate the password of the user Vault connects as. See the
+				plugin's API page for more information on support and
+				formatting for this parameter.`,
+			},
+
+			"username_template": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Template used to generate the usernames of the
+				roles using this connection. For example
+				"{{.RoleName}}_{{.DisplayName}}_{{random 8}}".`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -212,17 +234,30 @@ func (b *databaseBackend) connectionWriteHandler() framework.OperationFunc {
 
 		allowedRoles := data.Get("allowed_roles").([]string)
 
+		rootRotationStmts := data.Get("root_rotation_statements").(string)
+
+		usernameTemplate := data.Get("username_template").(string)
+		if usernameTemplate != "" {
+			if err := credsutil.ValidateUsernameTemplate(usernameTemplate); err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+		}
+
 		// Remove these entries from the data before we store it keyed under
 		// ConnectionDetails.
 		delete(data.Raw, "name")
 		delete(data.Raw, "plugin_name")
 		delete(data.Raw, "allowed_roles")
 		delete(data.Raw, "verify_connection")
+		delete(data.Raw, "root_rotation_statements")
+		delete(data.Raw, "username_template")
 
 		config := &DatabaseConfig{
-			ConnectionDetails: data.Raw,
-			PluginName:        pluginName,
-			AllowedRoles:      allowedRoles,
+			ConnectionDetails:      data.Raw,
+			PluginName:             pluginName,
+			AllowedRoles:           allowedRoles,
+			RootRotationStatements: rootRotationStmts,
+			UsernameTemplate:       usernameTemplate,
 		}
 
 		db, err := dbplugin.PluginFactory(config.PluginName, b.System(), b.logger)
@@ -282,6 +317,12 @@ accepts:
 	* "verify_connection" (default: true) - A boolean value denoting if the plugin should verify
 	   it is able to connect to the database using the provided connection
        details.
+
+	* "root_rotation_statements" - The statements used to rotate the password
+	   of the user Vault connects as, using the "database/rotate-root/" path.
+
+	* "username_template" - The Go template used to generate usernames for the
+	   roles that do not set their own.
 `
 
 const pathResetConnectionHelpSyn = `
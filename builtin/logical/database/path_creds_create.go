@@ -8,6 +8,7 @@ import (
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
+	"github.com/hashicorp/vault/plugins/helper/database/dbutil"
 )
 
 func pathCredsCreate(b *databaseBackend) *framework.Path {
@@ -78,21 +79,75 @@ func (b *databaseBackend) pathCredsCreateRead() framework.OperationFunc {
 		usernameConfig := dbplugin.UsernameConfig{
 			DisplayName: req.DisplayName,
 			RoleName:    name,
+			Template:    role.UsernameTemplate,
+		}
+		if usernameConfig.Template == "" {
+			usernameConfig.Template = dbConfig.UsernameTemplate
+		}
+
+		credentialConfig, err := parseCredentialConfig(role.credentialType(), role.CredentialConfig)
+		if err != nil {
+			unlockFunc()
+			return nil, err
+		}
+
+		// Generate the key pair before creating the user, which is given the
+		// public key in its creation statements
+		statements := role.Statements
+		var keyPair *rsaKeyPair
+		if role.credentialType() == dbplugin.CredentialTypeRSAPrivateKey {
+			keyPair, err = generateRSAKeyPair(credentialConfig)
+			if err != nil {
+				unlockFunc()
+				return nil, err
+			}
+			statements.CreationStatements = dbutil.QueryHelper(statements.CreationStatements, map[string]string{
+				"public_key": keyPair.PublicKey,
+			})
 		}
 
 		// Create the user
-		username, password, err := db.CreateUser(role.Statements, usernameConfig, expiration)
-		// Unlock
-		unlockFunc()
+		username, password, err := db.CreateUser(statements, usernameConfig, expiration)
 		if err != nil {
+			unlockFunc()
 			b.closeIfShutdown(role.DBName, err)
 			return nil, err
 		}
 
-		resp := b.Secret(SecretCredsType).Response(map[string]interface{}{
+		respData := map[string]interface{}{
 			"username": username,
-			"password": password,
-		}, map[string]interface{}{
+		}
+		switch role.credentialType() {
+		case dbplugin.CredentialTypeRSAPrivateKey:
+			respData["rsa_private_key"] = keyPair.PrivateKey
+
+		case CredentialTypeClientCertificate:
+			// The certificate is valid for as long as the lease can be
+			// renewed
+			ttl := role.MaxTTL
+			if ttl == 0 {
+				ttl = b.System().MaxLeaseTTL()
+			}
+
+			certBundle, err := issueClientCertificate(credentialConfig, username, ttl)
+			if err != nil {
+				// Best effort removal of the user, which cannot log in
+				db.RevokeUser(role.Statements, username)
+				unlockFunc()
+				return nil, err
+			}
+			respData["client_certificate"] = certBundle.Certificate
+			respData["ca_chain"] = certBundle.CAChain
+			respData["private_key"] = certBundle.PrivateKey
+			respData["private_key_type"] = certBundle.PrivateKeyType
+
+		default:
+			respData["password"] = password
+		}
+		// Unlock
+		unlockFunc()
+
+		resp := b.Secret(SecretCredsType).Response(respData, map[string]interface{}{
 			"username": username,
 			"role":     name,
 		})
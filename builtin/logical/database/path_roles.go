@@ -1,11 +1,13 @@
 package database
 
 import (
+	"strings"
 	"time"
 
 	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
+	"github.com/hashicorp/vault/plugins/helper/database/credsutil"
 )
 
 func pathListRoles(b *databaseBackend) *framework.Path {
@@ -62,6 +64,27 @@ func pathRoles(b *databaseBackend) *framework.Path {
 				parameter.`,
 			},
 
+			"username_template": {
+				Type: framework.TypeString,
+				Description: `Template used to generate the usernames of this
+				role, overriding the one of the database connection. For
+				example "{{.RoleName}}_{{.DisplayName}}_{{random 8}}".`,
+			},
+
+			"credential_type": {
+				Type:    framework.TypeString,
+				Default: dbplugin.CredentialTypePassword,
+				Description: `Type of credential issued for this role: "password",
+				"rsa_private_key" or "client_certificate".`,
+			},
+			"credential_config": {
+				Type: framework.TypeMap,
+				Description: `Configuration of the credentials, depending on
+				the credential type: "key_bits" for RSA private keys, and
+				"ca_cert", "ca_private_key", "key_type" and "key_bits" for
+				client certificates.`,
+			},
+
 			"default_ttl": {
 				Type:        framework.TypeDurationSecond,
 				Description: "Default ttl for role.",
@@ -112,6 +135,9 @@ func (b *databaseBackend) pathRoleRead() framework.OperationFunc {
 				"revocation_statements": role.Statements.RevocationStatements,
 				"rollback_statements":   role.Statements.RollbackStatements,
 				"renew_statements":      role.Statements.RenewStatements,
+				"username_template":     role.UsernameTemplate,
+				"credential_type":       role.credentialType(),
+				"credential_config":     redactCredentialConfig(role.CredentialConfig),
 				"default_ttl":           role.DefaultTTL.Seconds(),
 				"max_ttl":               role.MaxTTL.Seconds(),
 			},
@@ -148,6 +174,24 @@ func (b *databaseBackend) pathRoleCreate() framework.OperationFunc {
 		rollbackStmts := data.Get("rollback_statements").(string)
 		renewStmts := data.Get("renew_statements").(string)
 
+		usernameTemplate := data.Get("username_template").(string)
+		if usernameTemplate != "" {
+			if err := credsutil.ValidateUsernameTemplate(usernameTemplate); err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+		}
+
+		// Validate the credentials, which are generated by the backend for
+		// types other than passwords
+		credentialType := data.Get("credential_type").(string)
+		credentialConfig := data.Get("credential_config").(map[string]interface{})
+		if _, err := parseCredentialConfig(credentialType, credentialConfig); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if credentialType == dbplugin.CredentialTypeRSAPrivateKey && !strings.Contains(creationStmts, "{{public_key}}") {
+			return logical.ErrorResponse(`creation_statements must set the "{{public_key}}" of RSA private keys`), nil
+		}
+
 		// Get TTLs
 		defaultTTLRaw := data.Get("default_ttl").(int)
 		maxTTLRaw := data.Get("max_ttl").(int)
@@ -163,10 +207,13 @@ func (b *databaseBackend) pathRoleCreate() framework.OperationFunc {
 
 		// Store it
 		entry, err := logical.StorageEntryJSON("role/"+name, &roleEntry{
-			DBName:     dbName,
-			Statements: statements,
-			DefaultTTL: defaultTTL,
-			MaxTTL:     maxTTL,
+			DBName:           dbName,
+			Statements:       statements,
+			UsernameTemplate: usernameTemplate,
+			CredentialType:   credentialType,
+			CredentialConfig: credentialConfig,
+			DefaultTTL:       defaultTTL,
+			MaxTTL:           maxTTL,
 		})
 		if err != nil {
 			return nil, err
@@ -184,6 +231,20 @@ type roleEntry struct {
 	Statements dbplugin.Statements `json:"statments" mapstructure:"statements" structs:"statments"`
 	DefaultTTL time.Duration       `json:"default_ttl" mapstructure:"default_ttl" structs:"default_ttl"`
 	MaxTTL     time.Duration       `json:"max_ttl" mapstructure:"max_ttl" structs:"max_ttl"`
+
+	UsernameTemplate string `json:"username_template" mapstructure:"username_template" structs:"username_template"`
+
+	CredentialType   string                 `json:"credential_type" mapstructure:"credential_type" structs:"credential_type"`
+	CredentialConfig map[string]interface{} `json:"credential_config" mapstructure:"credential_config" structs:"credential_config"`
+}
+
+// credentialType returns the type of credential issued for the role, which
+// is a password for roles created before credential types were supported.
+func (r *roleEntry) credentialType() string {
+	if r.CredentialType == "" {
+		return dbplugin.CredentialTypePassword
+	}
+	return r.CredentialType
 }
 
 const pathRoleHelpSyn = `
@@ -227,6 +288,17 @@ database plugin:
 
 The "renew_statements" parameter customizes the statement string used to renew a
 user.
+The "username_template" parameter customizes the generated usernames. It is a
+Go template given the "RoleName" and "DisplayName", and functions such as
+"random", "truncate", "lowercase" and "replace". It overrides the template of
+the database connection.
 The "rollback_statements' parameter customizes the statement string used to
 rollback a change if needed.
+
+The "credential_type" parameter sets the type of credential issued. Passwords
+are generated by the database plugin. For "rsa_private_key", a key pair is
+generated and its base64 encoded public key substituted for "{{public_key}}"
+in the creation statements. For "client_certificate", a key is generated and a
+certificate whose common name is the username is issued by the CA set in the
+"credential_config" parameter, which the database must trust.
 `
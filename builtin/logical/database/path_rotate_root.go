@@ -0,0 +1,117 @@
+package database
+
+import (
+	"fmt"
+	"net/rpc"
+	"strings"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// pathRotateRootCredentials configures a path to rotate the password of the
+// user Vault connects to a database as.
+func pathRotateRootCredentials(b *databaseBackend) *framework.Path {
+	return &framework.Path{
+		Pattern: fmt.Sprintf("rotate-root/%s", framework.GenericNameRegex("name")),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of this database connection",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRotateRootCredentialsUpdate(),
+		},
+
+		HelpSynopsis:    pathRotateRootCredentialsHelpSyn,
+		HelpDescription: pathRotateRootCredentialsHelpDesc,
+	}
+}
+
+func (b *databaseBackend) pathRotateRootCredentialsUpdate() framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		name := data.Get("name").(string)
+		if name == "" {
+			return logical.ErrorResponse(respErrEmptyName), nil
+		}
+
+		config, err := b.DatabaseConfig(req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+
+		username, _ := config.ConnectionDetails["username"].(string)
+		if username == "" {
+			return logical.ErrorResponse("unable to rotate root credentials: no username in the connection details"), nil
+		}
+
+		// If the connection URL does not use the password template, the new
+		// password would never be used and Vault would lose access
+		if connURL, ok := config.ConnectionDetails["connection_url"].(string); ok && !strings.Contains(connURL, "{{password}}") {
+			return logical.ErrorResponse(`unable to rotate root credentials: the connection URL must use the "{{password}}" template`), nil
+		}
+
+		// Connections authenticating with a key pair have it rotated instead
+		// of a password
+		credentialType, credentialKey := dbplugin.CredentialTypePassword, "password"
+		if _, ok := config.ConnectionDetails["private_key"]; ok {
+			credentialType, credentialKey = dbplugin.CredentialTypeRSAPrivateKey, "private_key"
+		}
+
+		// Grab the mutex lock, as the connection is replaced
+		b.Lock()
+		defer b.Unlock()
+
+		db, err := b.createDBObj(req.Storage, name)
+		if err != nil {
+			return nil, fmt.Errorf("cound not retrieve db with name: %s, got error: %s", name, err)
+		}
+
+		_, credential, err := db.SetCredentials(dbplugin.Statements{
+			RotationStatements: config.RootRotationStatements,
+		}, dbplugin.StaticUserConfig{
+			Username:       username,
+			CredentialType: credentialType,
+		})
+		if err != nil {
+			if err == rpc.ErrShutdown {
+				b.clearConnection(name)
+			}
+			return nil, err
+		}
+
+		config.ConnectionDetails[credentialKey] = credential
+
+		entry, err := logical.StorageEntryJSON(fmt.Sprintf("config/%s", name), config)
+		if err != nil {
+			return nil, err
+		}
+		if err := req.Storage.Put(entry); err != nil {
+			return nil, fmt.Errorf("credentials of %q were rotated but the connection could not be updated: %s", username, err)
+		}
+
+		// The existing connection uses the old password, so the plugin is
+		// recreated from the new configuration on next use
+		b.clearConnection(name)
+
+		return nil, nil
+	}
+}
+
+const pathRotateRootCredentialsHelpSyn = `
+Rotate the password of the user Vault connects to a database as.
+`
+
+const pathRotateRootCredentialsHelpDesc = `
+This path sets a new random password for the user configured in the "username"
+connection detail, and updates the connection to use it. Once rotated, the
+password is only known to Vault. Connections authenticating with a
+"private_key", such as Snowflake's, have a new key pair set instead.
+
+The connection URL, if any, must use the "{{username}}" and "{{password}}"
+templates so that the new password is used. The "root_rotation_statements"
+connection parameter customizes the statements used to set the password.
+`
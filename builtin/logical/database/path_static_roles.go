@@ -0,0 +1,510 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	staticRolePath = "static-role/"
+
+	// minRotationPeriod is the shortest rotation period allowed for static
+	// roles, since rotations happen as part of the periodic function
+	minRotationPeriod = 5 * time.Second
+)
+
+func pathListStaticRoles(b *databaseBackend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-roles/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathStaticRoleList(),
+		},
+
+		HelpSynopsis:    pathStaticRoleHelpSyn,
+		HelpDescription: pathStaticRoleHelpDesc,
+	}
+}
+
+func pathStaticRoles(b *databaseBackend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-roles/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+
+			"db_name": {
+				Type:        framework.TypeString,
+				Description: "Name of the database this role acts on.",
+			},
+			"username": {
+				Type: framework.TypeString,
+				Description: `Name of the existing database user whose password
+				is managed by this role.`,
+			},
+			"credential_type": {
+				Type: framework.TypeString,
+				Description: `Type of credential rotated for the user,
+				"password" or "rsa_private_key". Defaults to "password". The
+				plugin of the database must support the type.`,
+			},
+			"rotation_statements": {
+				Type: framework.TypeString,
+				Description: `Specifies the database statements to be executed
+				to rotate the password of the user. See the plugin's API page
+				for more information on support and formatting for this
+				parameter.`,
+			},
+
+			"rotation_period": {
+				Type: framework.TypeDurationSecond,
+				Description: `Period after which the password is rotated. Must
+				be at least 5 seconds.`,
+			},
+		},
+
+		ExistenceCheck: b.pathStaticRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathStaticRoleRead(),
+			logical.CreateOperation: b.pathStaticRoleCreateUpdate(),
+			logical.UpdateOperation: b.pathStaticRoleCreateUpdate(),
+			logical.DeleteOperation: b.pathStaticRoleDelete(),
+		},
+
+		HelpSynopsis:    pathStaticRoleHelpSyn,
+		HelpDescription: pathStaticRoleHelpDesc,
+	}
+}
+
+func pathStaticCredsRead(b *databaseBackend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-creds/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the static role.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathStaticCredsRead(),
+		},
+
+		HelpSynopsis:    pathStaticCredsReadHelpSyn,
+		HelpDescription: pathStaticCredsReadHelpDesc,
+	}
+}
+
+func pathRotateRole(b *databaseBackend) *framework.Path {
+	return &framework.Path{
+		Pattern: "rotate-role/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the static role.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRotateRoleUpdate(),
+		},
+
+		HelpSynopsis:    pathRotateRoleHelpSyn,
+		HelpDescription: pathRotateRoleHelpDesc,
+	}
+}
+
+func (b *databaseBackend) pathStaticRoleExistenceCheck(req *logical.Request, data *framework.FieldData) (bool, error) {
+	role, err := b.StaticRole(req.Storage, data.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return role != nil, nil
+}
+
+func (b *databaseBackend) pathStaticRoleDelete() framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		b.staticRoleLock.Lock()
+		defer b.staticRoleLock.Unlock()
+
+		err := req.Storage.Delete(staticRolePath + data.Get("name").(string))
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+func (b *databaseBackend) pathStaticRoleRead() framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		role, err := b.StaticRole(req.Storage, data.Get("name").(string))
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return nil, nil
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"db_name":             role.DBName,
+				"username":            role.Username,
+				"credential_type":     role.credentialType(),
+				"rotation_statements": role.Statements.RotationStatements,
+				"rotation_period":     role.RotationPeriod.Seconds(),
+				"last_vault_rotation": role.LastVaultRotation,
+			},
+		}, nil
+	}
+}
+
+func (b *databaseBackend) pathStaticRoleList() framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		entries, err := req.Storage.List(staticRolePath)
+		if err != nil {
+			return nil, err
+		}
+
+		return logical.ListResponse(entries), nil
+	}
+}
+
+func (b *databaseBackend) pathStaticRoleCreateUpdate() framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		name := data.Get("name").(string)
+		if name == "" {
+			return logical.ErrorResponse("empty role name attribute given"), nil
+		}
+
+		b.staticRoleLock.Lock()
+		defer b.staticRoleLock.Unlock()
+
+		role, err := b.StaticRole(req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			role = &staticRoleEntry{}
+		}
+
+		if dbNameRaw, ok := data.GetOk("db_name"); ok {
+			role.DBName = dbNameRaw.(string)
+		}
+		if role.DBName == "" {
+			return logical.ErrorResponse("empty database name attribute given"), nil
+		}
+
+		// The username cannot change, as the credentials of the previous user
+		// would no longer be managed
+		if usernameRaw, ok := data.GetOk("username"); ok {
+			username := usernameRaw.(string)
+			if role.Username != "" && role.Username != username {
+				return logical.ErrorResponse("username of an existing static role cannot be changed"), nil
+			}
+			role.Username = username
+		}
+		if role.Username == "" {
+			return logical.ErrorResponse("empty username attribute given"), nil
+		}
+
+		// The credential type cannot change either, as the stored credential
+		// would be served as the wrong type until the next rotation
+		if credentialTypeRaw, ok := data.GetOk("credential_type"); ok {
+			credentialType := credentialTypeRaw.(string)
+			switch credentialType {
+			case dbplugin.CredentialTypePassword, dbplugin.CredentialTypeRSAPrivateKey:
+			default:
+				return logical.ErrorResponse(fmt.Sprintf("unsupported credential_type %q", credentialType)), nil
+			}
+			if req.Operation == logical.UpdateOperation && credentialType != role.credentialType() {
+				return logical.ErrorResponse("credential_type of an existing static role cannot be changed"), nil
+			}
+			role.CredentialType = credentialType
+		}
+
+		if rotationStmtsRaw, ok := data.GetOk("rotation_statements"); ok {
+			role.Statements.RotationStatements = rotationStmtsRaw.(string)
+		}
+
+		if rotationPeriodRaw, ok := data.GetOk("rotation_period"); ok {
+			role.RotationPeriod = time.Duration(rotationPeriodRaw.(int)) * time.Second
+		}
+		if role.RotationPeriod < minRotationPeriod {
+			return logical.ErrorResponse(fmt.Sprintf("rotation_period must be at least %s", minRotationPeriod)), nil
+		}
+
+		dbConfig, err := b.DatabaseConfig(req.Storage, role.DBName)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if !strutil.StrListContains(dbConfig.AllowedRoles, "*") && !strutil.StrListContains(dbConfig.AllowedRoles, name) {
+			return logical.ErrorResponse(fmt.Sprintf("%q is not an allowed role of database %q", name, role.DBName)), nil
+		}
+
+		// New roles have their password rotated right away so that Vault
+		// knows the current credentials
+		if req.Operation == logical.CreateOperation {
+			if err := b.rotateStaticRole(req.Storage, name, role); err != nil {
+				return nil, err
+			}
+			return nil, nil
+		}
+
+		if err := b.storeStaticRole(req.Storage, name, role); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+func (b *databaseBackend) pathStaticCredsRead() framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		name := data.Get("name").(string)
+
+		role, err := b.StaticRole(req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return logical.ErrorResponse(fmt.Sprintf("unknown static role: %s", name)), nil
+		}
+
+		dbConfig, err := b.DatabaseConfig(req.Storage, role.DBName)
+		if err != nil {
+			return nil, err
+		}
+
+		// If role name isn't in the database's allowed roles, send back a
+		// permission denied.
+		if !strutil.StrListContains(dbConfig.AllowedRoles, "*") && !strutil.StrListContains(dbConfig.AllowedRoles, name) {
+			return nil, logical.ErrPermissionDenied
+		}
+
+		ttl := role.LastVaultRotation.Add(role.RotationPeriod).Sub(time.Now())
+		if ttl < 0 {
+			ttl = 0
+		}
+
+		resp := &logical.Response{
+			Data: map[string]interface{}{
+				"username":            role.Username,
+				"last_vault_rotation": role.LastVaultRotation,
+				"rotation_period":     role.RotationPeriod.Seconds(),
+				"ttl":                 int64(ttl.Seconds()),
+			},
+		}
+
+		switch role.credentialType() {
+		case dbplugin.CredentialTypeRSAPrivateKey:
+			resp.Data["rsa_private_key"] = role.RSAPrivateKey
+		default:
+			resp.Data["password"] = role.Password
+		}
+
+		return resp, nil
+	}
+}
+
+func (b *databaseBackend) pathRotateRoleUpdate() framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		name := data.Get("name").(string)
+
+		b.staticRoleLock.Lock()
+		defer b.staticRoleLock.Unlock()
+
+		role, err := b.StaticRole(req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return logical.ErrorResponse(fmt.Sprintf("unknown static role: %s", name)), nil
+		}
+
+		if err := b.rotateStaticRole(req.Storage, name, role); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+// rotateStaticRoles rotates the passwords of the static roles whose rotation
+// period has elapsed. It is called from the backend's periodic function.
+func (b *databaseBackend) rotateStaticRoles(s logical.Storage) error {
+	b.staticRoleLock.Lock()
+	defer b.staticRoleLock.Unlock()
+
+	names, err := s.List(staticRolePath)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, name := range names {
+		role, err := b.StaticRole(s, name)
+		if err != nil {
+			return err
+		}
+		if role == nil || role.LastVaultRotation.Add(role.RotationPeriod).After(now) {
+			continue
+		}
+
+		if err := b.rotateStaticRole(s, name, role); err != nil {
+			b.logger.Error("database: error rotating static role password", "role", name, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// rotateStaticRole sets a new credential for the user of the static role and
+// stores it. The caller must hold the staticRoleLock.
+func (b *databaseBackend) rotateStaticRole(s logical.Storage, name string, role *staticRoleEntry) error {
+	// Grab the read lock
+	b.RLock()
+	var unlockFunc func() = b.RUnlock
+
+	// Get the Database object
+	db, ok := b.getDBObj(role.DBName)
+	if !ok {
+		// Upgrade lock
+		b.RUnlock()
+		b.Lock()
+		unlockFunc = b.Unlock
+
+		// Create a new DB object
+		var err error
+		db, err = b.createDBObj(s, role.DBName)
+		if err != nil {
+			unlockFunc()
+			return fmt.Errorf("cound not retrieve db with name: %s, got error: %s", role.DBName, err)
+		}
+	}
+
+	_, credential, err := db.SetCredentials(role.Statements, dbplugin.StaticUserConfig{
+		Username:       role.Username,
+		CredentialType: role.credentialType(),
+	})
+	// Unlock
+	unlockFunc()
+	if err != nil {
+		b.closeIfShutdown(role.DBName, err)
+		return err
+	}
+
+	switch role.credentialType() {
+	case dbplugin.CredentialTypeRSAPrivateKey:
+		role.RSAPrivateKey = credential
+	default:
+		role.Password = credential
+	}
+	role.LastVaultRotation = time.Now()
+
+	return b.storeStaticRole(s, name, role)
+}
+
+func (b *databaseBackend) storeStaticRole(s logical.Storage, name string, role *staticRoleEntry) error {
+	entry, err := logical.StorageEntryJSON(staticRolePath+name, role)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+func (b *databaseBackend) StaticRole(s logical.Storage, roleName string) (*staticRoleEntry, error) {
+	entry, err := s.Get(staticRolePath + roleName)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result staticRoleEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+type staticRoleEntry struct {
+	DBName            string              `json:"db_name" mapstructure:"db_name" structs:"db_name"`
+	Username          string              `json:"username" mapstructure:"username" structs:"username"`
+	Password          string              `json:"password" mapstructure:"password" structs:"password"`
+	RSAPrivateKey     string              `json:"rsa_private_key" mapstructure:"rsa_private_key" structs:"rsa_private_key"`
+	CredentialType    string              `json:"credential_type" mapstructure:"credential_type" structs:"credential_type"`
+	Statements        dbplugin.Statements `json:"statements" mapstructure:"statements" structs:"statements"`
+	RotationPeriod    time.Duration       `json:"rotation_period" mapstructure:"rotation_period" structs:"rotation_period"`
+	LastVaultRotation time.Time           `json:"last_vault_rotation" mapstructure:"last_vault_rotation" structs:"last_vault_rotation"`
+}
+
+// credentialType returns the type of credential rotated for the role, which
+// defaults to a password for roles created before types were supported.
+func (r *staticRoleEntry) credentialType() string {
+	if r.CredentialType == "" {
+		return dbplugin.CredentialTypePassword
+	}
+	return r.CredentialType
+}
+
+const pathStaticRoleHelpSyn = `
+Manage the static roles whose credentials are rotated by this backend.
+`
+
+const pathStaticRoleHelpDesc = `
+This path lets you manage static roles. A static role maps to an existing
+database user, whose password Vault rotates and serves.
+
+The "db_name" parameter is required and configures the name of the database
+connection to use. The role must be allowed by the connection's
+"allowed_roles".
+
+The "username" parameter is required and is the name of the database user.
+It cannot be changed once the role is created.
+
+The "credential_type" parameter sets the type of credential rotated for the
+user: "password", the default, or "rsa_private_key" for plugins supporting key
+pair authentication, such as Snowflake. It cannot be changed once the role is
+created.
+
+The "rotation_period" parameter is required and sets how often the password is
+rotated. The password is also rotated when the role is created.
+
+The "rotation_statements" parameter customizes the statement string used to
+set the password. The "name" and "password" variables are substituted. Example
+for a postgresql database plugin:
+
+	ALTER ROLE "{{name}}" WITH PASSWORD '{{password}}';
+
+If not set, the plugin's default statements are used.
+`
+
+const pathStaticCredsReadHelpSyn = `
+Request the current credentials of a static role.
+`
+
+const pathStaticCredsReadHelpDesc = `
+This path reads the current username and password, or RSA private key, of a
+static role, along with the time of the last rotation and the time left until
+the next one.
+`
+
+const pathRotateRoleHelpSyn = `
+Rotate the password of a static role.
+`
+
+const pathRotateRoleHelpDesc = `
+This path rotates the password of a static role right away, and restarts its
+rotation period.
+`
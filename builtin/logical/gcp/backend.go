@@ -0,0 +1,117 @@
+package gcp
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	var b backend
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		Paths: []*framework.Path{
+			pathConfig(&b),
+			pathListRoleSets(&b),
+			pathRoleSet(&b),
+			pathRoleSetRotate(&b),
+			pathListStaticAccounts(&b),
+			pathStaticAccount(&b),
+			pathSecretToken(&b, roleSetPath),
+			pathSecretKey(&b, roleSetPath),
+			pathSecretToken(&b, staticAccountPath),
+			pathSecretKey(&b, staticAccountPath),
+		},
+
+		Secrets: []*framework.Secret{
+			secretServiceAccountKey(&b),
+		},
+
+		Invalidate: b.invalidate,
+	}
+
+	return &b
+}
+
+type backend struct {
+	*framework.Backend
+
+	// clientLock guards the cached client, which is created from the
+	// configured credentials
+	clientLock sync.RWMutex
+	client     *gcpClient
+
+	// accountLock serializes the changes to rolesets and static accounts,
+	// as they update the IAM policies of shared resources
+	accountLock sync.Mutex
+}
+
+func (b *backend) invalidate(key string) {
+	switch key {
+	case configPath:
+		b.resetClient()
+	}
+}
+
+// gcpClient returns the client calling the Google Cloud APIs with the
+// configured credentials.
+func (b *backend) gcpClient(s logical.Storage) (*gcpClient, error) {
+	b.clientLock.RLock()
+	if b.client != nil {
+		defer b.clientLock.RUnlock()
+		return b.client, nil
+	}
+	b.clientLock.RUnlock()
+
+	b.clientLock.Lock()
+	defer b.clientLock.Unlock()
+
+	// Check again, as the client may have been created while waiting for the
+	// lock
+	if b.client != nil {
+		return b.client, nil
+	}
+
+	config, err := getConfig(s)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &gcpConfig{}
+	}
+
+	client, err := newGCPClient(config.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	b.client = client
+
+	return client, nil
+}
+
+func (b *backend) resetClient() {
+	b.clientLock.Lock()
+	defer b.clientLock.Unlock()
+	b.client = nil
+}
+
+const backendHelp = `
+The GCP backend dynamically generates Google Cloud OAuth2 access tokens and
+service account keys.
+
+Rolesets are managed with the "roleset/" endpoints. Each roleset has its own
+service account, created by Vault and bound to IAM roles on Google Cloud
+resources. Static accounts are managed with the "static-account/" endpoints
+and issue credentials for existing service accounts.
+
+Access tokens are read from the "token" endpoint of a roleset or static
+account, and leased service account keys from its "key" endpoint. The
+credentials used by Vault are configured with the "config" endpoint.
+`
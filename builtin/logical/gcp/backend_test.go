@@ -0,0 +1,573 @@
+package gcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/logical"
+)
+
+// fakeGCP implements the parts of the IAM, IAM Credentials and Cloud Resource
+// Manager APIs used by the backend. Each service is served under its name.
+type fakeGCP struct {
+	sync.Mutex
+	nextID   int
+	accounts map[string]*serviceAccount
+	keys     map[string]string
+	policies map[string]map[string][]string
+
+	// conflicts is the number of policy updates rejected as concurrent
+	// modifications
+	conflicts int
+}
+
+func newFakeGCP() *fakeGCP {
+	return &fakeGCP{
+		accounts: map[string]*serviceAccount{
+			"existing@my-project.iam.gserviceaccount.com": {
+				Email: "existing@my-project.iam.gserviceaccount.com",
+			},
+		},
+		keys: map[string]string{},
+		policies: map[string]map[string][]string{
+			"cloudresourcemanager/projects/my-project": {
+				"roles/owner": {"user:admin@example.com"},
+			},
+			"storage/b/my-bucket": {},
+		},
+	}
+}
+
+func (f *fakeGCP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	service := strings.SplitN(path, "/", 2)[0]
+	path = strings.TrimPrefix(strings.TrimPrefix(path, service+"/"), "v1/")
+
+	switch {
+	case service == "iam" && r.Method == "POST" && strings.HasSuffix(path, "/serviceAccounts"):
+		project := strings.TrimSuffix(strings.TrimPrefix(path, "projects/"), "/serviceAccounts")
+		email := fmt.Sprintf("%s@%s.iam.gserviceaccount.com", body["accountId"], project)
+		if f.accounts[email] != nil {
+			f.error(w, http.StatusConflict, "service account already exists")
+			return
+		}
+		f.accounts[email] = &serviceAccount{Email: email, ProjectID: project}
+		json.NewEncoder(w).Encode(f.accounts[email])
+
+	case service == "iam" && strings.HasPrefix(path, "projects/-/serviceAccounts/"):
+		parts := strings.Split(strings.TrimPrefix(path, "projects/-/serviceAccounts/"), "/")
+		account := f.accounts[parts[0]]
+		switch {
+		case account == nil:
+			f.error(w, http.StatusNotFound, "service account not found")
+		case len(parts) == 1 && r.Method == "GET":
+			json.NewEncoder(w).Encode(account)
+		case len(parts) == 1 && r.Method == "DELETE":
+			delete(f.accounts, parts[0])
+			for name, email := range f.keys {
+				if email == parts[0] {
+					delete(f.keys, name)
+				}
+			}
+		case len(parts) == 2 && r.Method == "POST":
+			f.nextID++
+			name := fmt.Sprintf("projects/-/serviceAccounts/%s/keys/%d", parts[0], f.nextID)
+			f.keys[name] = parts[0]
+			json.NewEncoder(w).Encode(&serviceAccountKey{
+				Name:           name,
+				PrivateKeyType: body["privateKeyType"].(string),
+				KeyAlgorithm:   body["keyAlgorithm"].(string),
+				PrivateKeyData: "a2V5",
+			})
+		case len(parts) == 3 && r.Method == "DELETE":
+			if _, ok := f.keys[path]; !ok {
+				f.error(w, http.StatusNotFound, "key not found")
+				return
+			}
+			delete(f.keys, path)
+		default:
+			f.error(w, http.StatusNotFound, "not found")
+		}
+
+	case service == "iamcredentials" && strings.HasSuffix(path, ":generateAccessToken"):
+		email := strings.TrimSuffix(strings.TrimPrefix(path, "projects/-/serviceAccounts/"), ":generateAccessToken")
+		if f.accounts[email] == nil {
+			f.error(w, http.StatusNotFound, "service account not found")
+			return
+		}
+		json.NewEncoder(w).Encode(&accessToken{
+			AccessToken: fmt.Sprintf("token-%s-%v", email, body["scope"]),
+			ExpireTime:  time.Now().Add(time.Hour),
+		})
+
+	case service == "cloudresourcemanager" && strings.HasSuffix(path, ":getIamPolicy"):
+		f.getPolicy(w, service+"/"+strings.TrimSuffix(path, ":getIamPolicy"))
+
+	case service == "cloudresourcemanager" && strings.HasSuffix(path, ":setIamPolicy"):
+		f.setPolicy(w, service+"/"+strings.TrimSuffix(path, ":setIamPolicy"), body["policy"].(map[string]interface{}))
+
+	case service == "storage" && r.Method == "GET":
+		f.getPolicy(w, service+"/"+strings.TrimSuffix(strings.TrimPrefix(path, "storage/v1/"), "/iam"))
+
+	case service == "storage" && r.Method == "PUT":
+		f.setPolicy(w, service+"/"+strings.TrimSuffix(strings.TrimPrefix(path, "storage/v1/"), "/iam"), body)
+
+	default:
+		f.error(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (f *fakeGCP) getPolicy(w http.ResponseWriter, resource string) {
+	policy, ok := f.policies[resource]
+	if !ok {
+		f.error(w, http.StatusNotFound, "resource not found")
+		return
+	}
+
+	var bindings []interface{}
+	for role, members := range policy {
+		bindings = append(bindings, map[string]interface{}{
+			"role":    role,
+			"members": members,
+		})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"bindings": bindings,
+		"etag":     "etag",
+		"version":  1,
+	})
+}
+
+func (f *fakeGCP) setPolicy(w http.ResponseWriter, resource string, raw map[string]interface{}) {
+	if _, ok := f.policies[resource]; !ok {
+		f.error(w, http.StatusNotFound, "resource not found")
+		return
+	}
+	if f.conflicts > 0 {
+		f.conflicts--
+		f.error(w, http.StatusConflict, "concurrent policy changes")
+		return
+	}
+	if raw["etag"] != "etag" || raw["version"] != float64(1) {
+		f.error(w, http.StatusBadRequest, "fields of the policy were dropped")
+		return
+	}
+
+	policy := map[string][]string{}
+	bindings, _ := raw["bindings"].([]interface{})
+	for _, bindingRaw := range bindings {
+		binding := bindingRaw.(map[string]interface{})
+		for _, member := range binding["members"].([]interface{}) {
+			policy[binding["role"].(string)] = append(policy[binding["role"].(string)], member.(string))
+		}
+	}
+	f.policies[resource] = policy
+}
+
+func (f *fakeGCP) error(w http.ResponseWriter, code int, message string) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+		},
+	})
+}
+
+// members returns the members granted a role on a resource
+func (f *fakeGCP) members(resource, role string) []string {
+	f.Lock()
+	defer f.Unlock()
+	members := append([]string{}, f.policies[resource][role]...)
+	sort.Strings(members)
+	return members
+}
+
+func (f *fakeGCP) hasAccount(email string) bool {
+	f.Lock()
+	defer f.Unlock()
+	return f.accounts[email] != nil
+}
+
+func (f *fakeGCP) keyCount() int {
+	f.Lock()
+	defer f.Unlock()
+	return len(f.keys)
+}
+
+func testBackend(t *testing.T) (*backend, logical.Storage, *fakeGCP, func()) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := newFakeGCP()
+	srv := httptest.NewServer(fake)
+	b.client = &gcpClient{
+		httpClient: cleanhttp.DefaultClient(),
+		endpoint: func(service string) string {
+			return srv.URL + "/" + service + "/"
+		},
+	}
+
+	return b, config.StorageView, fake, srv.Close
+}
+
+const testBindings = `
+resource "//cloudresourcemanager.googleapis.com/projects/my-project" {
+  roles = ["roles/viewer", "roles/pubsub.publisher"]
+}
+
+resource "//storage.googleapis.com/projects/_/buckets/my-bucket" {
+  roles = ["roles/storage.objectViewer"]
+}
+`
+
+func TestBackend_roleSet(t *testing.T) {
+	b, storage, fake, cleanup := testBackend(t)
+	defer cleanup()
+
+	// Policy updates are retried on concurrent modifications
+	fake.conflicts = 2
+
+	req := &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roleset/test",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"project":      "my-project",
+			"bindings":     testBindings,
+			"token_scopes": "https://www.googleapis.com/auth/cloud-platform",
+		},
+	}
+	resp, err := b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	req.Operation = logical.ReadOperation
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	email := resp.Data["service_account_email"].(string)
+	if !strings.HasPrefix(email, "vaulttest-") || !fake.hasAccount(email) {
+		t.Fatalf("bad service account: %q", email)
+	}
+	if resp.Data["secret_type"] != secretTypeAccessToken || resp.Data["project"] != "my-project" {
+		t.Fatalf("bad roleset: %#v", resp.Data)
+	}
+
+	member := serviceAccountMember(email)
+	expected := []string{member}
+	for resource, role := range map[string]string{
+		"cloudresourcemanager/projects/my-project": "roles/viewer",
+		"storage/b/my-bucket":                      "roles/storage.objectViewer",
+	} {
+		if members := fake.members(resource, role); !reflect.DeepEqual(members, expected) {
+			t.Fatalf("bad members of %s on %s: %v", role, resource, members)
+		}
+	}
+	if members := fake.members("cloudresourcemanager/projects/my-project", "roles/owner"); len(members) != 1 {
+		t.Fatalf("existing bindings were changed: %v", members)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roleset/test/token",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if !strings.HasPrefix(resp.Data["token"].(string), "token-"+email) || resp.Secret != nil {
+		t.Fatalf("bad token: %#v", resp)
+	}
+
+	// Keys are not issued by rolesets of access tokens
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roleset/test/key",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error reading a key: %#v", resp)
+	}
+
+	// Changing the bindings replaces the service account
+	req.Operation = logical.UpdateOperation
+	req.Data = map[string]interface{}{
+		"bindings": `resource "//storage.googleapis.com/b/my-bucket" { roles = ["roles/storage.admin"] }`,
+	}
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	roleSet, err := getRoleSet(storage, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roleSet.ServiceAccountEmail == email || fake.hasAccount(email) {
+		t.Fatalf("service account was not replaced: %q", roleSet.ServiceAccountEmail)
+	}
+	if members := fake.members("cloudresourcemanager/projects/my-project", "roles/viewer"); len(members) != 0 {
+		t.Fatalf("bindings of the previous account were not removed: %v", members)
+	}
+	expected = []string{serviceAccountMember(roleSet.ServiceAccountEmail)}
+	if members := fake.members("storage/b/my-bucket", "roles/storage.admin"); !reflect.DeepEqual(members, expected) {
+		t.Fatalf("bad members: %v", members)
+	}
+
+	// The project and secret type cannot change
+	for _, data := range []map[string]interface{}{
+		{"project": "other-project"},
+		{"secret_type": secretTypeKey},
+	} {
+		req.Data = data
+		resp, err = b.HandleRequest(req)
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error updating %v: %#v", data, resp)
+		}
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "rolesets/",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != "test" {
+		t.Fatalf("bad list: %v", keys)
+	}
+
+	req.Operation = logical.DeleteOperation
+	req.Data = nil
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if fake.hasAccount(roleSet.ServiceAccountEmail) {
+		t.Fatal("service account was not deleted")
+	}
+	if members := fake.members("storage/b/my-bucket", "roles/storage.admin"); len(members) != 0 {
+		t.Fatalf("bindings were not removed: %v", members)
+	}
+}
+
+func TestBackend_roleSetValidation(t *testing.T) {
+	b, storage, fake, cleanup := testBackend(t)
+	defer cleanup()
+
+	cases := []map[string]interface{}{
+		{"bindings": testBindings, "token_scopes": "scope"},
+		{"project": "my-project", "token_scopes": "scope"},
+		{"project": "my-project", "bindings": testBindings},
+		{"project": "my-project", "bindings": testBindings, "secret_type": "password"},
+		{"project": "my-project", "bindings": `resource "projects/my-project" { roles = ["roles/viewer"] }`, "token_scopes": "scope"},
+		{"project": "my-project", "bindings": `resource "//storage.googleapis.com/b/my-bucket" { roles = ["viewer"] }`, "token_scopes": "scope"},
+		// Bindings on missing resources are rolled back
+		{"project": "my-project", "bindings": `resource "//cloudresourcemanager.googleapis.com/projects/missing" { roles = ["roles/viewer"] }`, "token_scopes": "scope"},
+	}
+
+	for i, data := range cases {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "roleset/test",
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("case %d: expected error for %v: %#v", i, data, resp)
+		}
+	}
+
+	if len(fake.accounts) != 1 {
+		t.Fatalf("service accounts were not cleaned up: %v", fake.accounts)
+	}
+	if entries, _ := storage.List(roleSetPath + "/"); len(entries) != 0 {
+		t.Fatalf("invalid rolesets were stored: %v", entries)
+	}
+}
+
+func TestBackend_staticAccountKeys(t *testing.T) {
+	b, storage, fake, cleanup := testBackend(t)
+	defer cleanup()
+
+	email := "existing@my-project.iam.gserviceaccount.com"
+	req := &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "static-account/test",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"service_account_email": email,
+			"secret_type":           secretTypeKey,
+			"bindings":              testBindings,
+		},
+	}
+	resp, err := b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	member := serviceAccountMember(email)
+	if members := fake.members("cloudresourcemanager/projects/my-project", "roles/pubsub.publisher"); !reflect.DeepEqual(members, []string{member}) {
+		t.Fatalf("bad members: %v", members)
+	}
+
+	// Roles removed from the bindings are revoked, and the others kept
+	req.Operation = logical.UpdateOperation
+	req.Data = map[string]interface{}{
+		"bindings": `resource "//cloudresourcemanager.googleapis.com/projects/my-project" { roles = ["roles/viewer"] }`,
+	}
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if members := fake.members("cloudresourcemanager/projects/my-project", "roles/viewer"); !reflect.DeepEqual(members, []string{member}) {
+		t.Fatalf("bad members: %v", members)
+	}
+	if members := fake.members("cloudresourcemanager/projects/my-project", "roles/pubsub.publisher"); len(members) != 0 {
+		t.Fatalf("bad members: %v", members)
+	}
+	if members := fake.members("storage/b/my-bucket", "roles/storage.objectViewer"); len(members) != 0 {
+		t.Fatalf("bad members: %v", members)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "static-account/test/key",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"ttl": "1h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp.Data["private_key_data"] != "a2V5" || resp.Data["key_type"] != "TYPE_GOOGLE_CREDENTIALS_FILE" {
+		t.Fatalf("bad key: %#v", resp.Data)
+	}
+	if resp.Secret == nil || resp.Secret.TTL != time.Hour || fake.keyCount() != 1 {
+		t.Fatalf("bad secret: %#v", resp.Secret)
+	}
+
+	secret := resp.Secret
+	secret.IssueTime = time.Now()
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   storage,
+		Secret:    secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   storage,
+		Secret:    secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if fake.keyCount() != 0 {
+		t.Fatal("key was not deleted")
+	}
+
+	// Deleting the static account revokes its roles, but keeps the account
+	req.Operation = logical.DeleteOperation
+	req.Data = nil
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if members := fake.members("cloudresourcemanager/projects/my-project", "roles/viewer"); len(members) != 0 {
+		t.Fatalf("bad members: %v", members)
+	}
+	if !fake.hasAccount(email) {
+		t.Fatal("service account was deleted")
+	}
+
+	// Keys of deleted static accounts are not renewed
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   storage,
+		Secret:    secret,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error renewing the key: %#v", resp)
+	}
+
+	// Missing service accounts are rejected
+	req.Operation = logical.CreateOperation
+	req.Data = map[string]interface{}{
+		"service_account_email": "missing@my-project.iam.gserviceaccount.com",
+		"token_scopes":          "scope",
+	}
+	resp, err = b.HandleRequest(req)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for a missing service account: %#v", resp)
+	}
+}
+
+func TestParseBindings(t *testing.T) {
+	expected := map[string][]string{
+		"//cloudresourcemanager.googleapis.com/projects/my-project": {"roles/pubsub.publisher", "roles/viewer"},
+		"//storage.googleapis.com/projects/_/buckets/my-bucket":     {"roles/storage.objectViewer"},
+	}
+
+	for _, raw := range []string{
+		testBindings,
+		`{
+  "resource": {
+    "//cloudresourcemanager.googleapis.com/projects/my-project": {
+      "roles": ["roles/viewer", "roles/pubsub.publisher", "roles/viewer"]
+    },
+    "//storage.googleapis.com/projects/_/buckets/my-bucket": {
+      "roles": ["roles/storage.objectViewer"]
+    }
+  }
+}`,
+		"CnJlc291cmNlICIvL2Nsb3VkcmVzb3VyY2VtYW5hZ2VyLmdvb2dsZWFwaXMuY29tL3Byb2plY3RzL215LXByb2plY3QiIHsKICByb2xlcyA9IFsicm9sZXMvdmlld2VyIiwgInJvbGVzL3B1YnN1Yi5wdWJsaXNoZXIiXQp9CgpyZXNvdXJjZSAiLy9zdG9yYWdlLmdvb2dsZWFwaXMuY29tL3Byb2plY3RzL18vYnVja2V0cy9teS1idWNrZXQiIHsKICByb2xlcyA9IFsicm9sZXMvc3RvcmFnZS5vYmplY3RWaWV3ZXIiXQp9Cg==",
+	} {
+		bindings, err := parseBindings(raw)
+		if err != nil {
+			t.Fatalf("error parsing %s: %s", raw, err)
+		}
+		if !reflect.DeepEqual(bindings, expected) {
+			t.Fatalf("bad bindings: %v", bindings)
+		}
+	}
+
+	for _, raw := range []string{
+		``,
+		`path "//storage.googleapis.com/b/my-bucket" { roles = ["roles/viewer"] }`,
+		`resource "//storage.googleapis.com/b/my-bucket" {}`,
+		`resource "//storage.googleapis.com/b/my-bucket/o/object" { roles = ["roles/viewer"] }`,
+		`resource "//example.com/things/1" { roles = ["roles/viewer"] }`,
+	} {
+		if _, err := parseBindings(raw); err == nil {
+			t.Fatalf("expected error parsing %s", raw)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package gcp
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/vault/helper/strutil"
+)
+
+// maxPolicyUpdateAttempts is the number of times an IAM policy update is
+// attempted when the policy is concurrently modified
+const maxPolicyUpdateAttempts = 5
+
+// parseBindings parses IAM bindings given in HCL or JSON, optionally base64
+// encoded, into the roles granted on each resource:
+//
+//	resource "//cloudresourcemanager.googleapis.com/projects/my-project" {
+//	  roles = ["roles/viewer"]
+//	}
+func parseBindings(raw string) (map[string][]string, error) {
+	if decoded, err := base64.StdEncoding.DecodeString(raw); err == nil {
+		raw = string(decoded)
+	}
+
+	root, err := hcl.Parse(raw)
+	if err != nil {
+		return nil, errwrap.Wrapf("error parsing bindings: {{err}}", err)
+	}
+	list, ok := root.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("error parsing bindings: does not contain a root object")
+	}
+
+	bindings := map[string][]string{}
+	for _, item := range list.Items {
+		if len(item.Keys) != 2 || item.Keys[0].Token.Value() != "resource" {
+			return nil, fmt.Errorf("bindings must only contain resource blocks")
+		}
+		name := item.Keys[1].Token.Value().(string)
+		if _, err := parseIAMResource(name); err != nil {
+			return nil, err
+		}
+
+		var binding struct {
+			Roles []string `hcl:"roles"`
+		}
+		if err := hcl.DecodeObject(&binding, item.Val); err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("error parsing the bindings of %q: {{err}}", name), err)
+		}
+		if len(binding.Roles) == 0 {
+			return nil, fmt.Errorf("no roles are bound on %q", name)
+		}
+		for _, role := range binding.Roles {
+			if !strings.HasPrefix(role, "roles/") && !strings.Contains(role, "/roles/") {
+				return nil, fmt.Errorf("%q is not the name of a role", role)
+			}
+		}
+
+		roles := strutil.RemoveDuplicates(append(bindings[name], binding.Roles...), false)
+		sort.Strings(roles)
+		bindings[name] = roles
+	}
+
+	if len(bindings) == 0 {
+		return nil, fmt.Errorf("bindings must bind roles on at least one resource")
+	}
+
+	return bindings, nil
+}
+
+// addBindings grants the roles on each resource to the member.
+func (c *gcpClient) addBindings(member string, bindings map[string][]string) error {
+	for name, roles := range bindings {
+		err := c.updateIAMPolicy(name, func(policy map[string]interface{}) {
+			addPolicyMember(policy, member, roles)
+		})
+		if err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("error binding roles on %q: {{err}}", name), err)
+		}
+	}
+	return nil
+}
+
+// removeBindings revokes the roles on each resource from the member. The
+// resources are all updated even if some fail.
+func (c *gcpClient) removeBindings(member string, bindings map[string][]string) error {
+	var errs []string
+	for name, roles := range bindings {
+		err := c.updateIAMPolicy(name, func(policy map[string]interface{}) {
+			removePolicyMember(policy, member, roles)
+		})
+		if err != nil && !isNotFound(err) {
+			errs = append(errs, fmt.Sprintf("error removing the roles bound on %q: %s", name, err))
+		}
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// updateIAMPolicy reads, modifies and writes back the IAM policy of a
+// resource, starting over if the policy is modified concurrently.
+func (c *gcpClient) updateIAMPolicy(name string, modify func(map[string]interface{})) error {
+	resource, err := parseIAMResource(name)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		policy, err := c.getIAMPolicy(resource)
+		if err != nil {
+			return err
+		}
+
+		modify(policy)
+
+		err = c.setIAMPolicy(resource, policy)
+		if err == nil || !isConflict(err) || attempt == maxPolicyUpdateAttempts {
+			return err
+		}
+	}
+}
+
+// addPolicyMember adds the member to the bindings of the roles in an IAM
+// policy, adding the bindings that do not exist.
+func addPolicyMember(policy map[string]interface{}, member string, roles []string) {
+	bindings, _ := policy["bindings"].([]interface{})
+
+	for _, role := range roles {
+		found := false
+		for _, bindingRaw := range bindings {
+			binding, ok := bindingRaw.(map[string]interface{})
+			// Conditional bindings only grant the role in some cases
+			if !ok || binding["role"] != role || binding["condition"] != nil {
+				continue
+			}
+			found = true
+			members, _ := binding["members"].([]interface{})
+			if !containsMember(members, member) {
+				binding["members"] = append(members, member)
+			}
+			break
+		}
+		if !found {
+			bindings = append(bindings, map[string]interface{}{
+				"role":    role,
+				"members": []interface{}{member},
+			})
+		}
+	}
+
+	policy["bindings"] = bindings
+}
+
+// removePolicyMember removes the member from the bindings of the roles in an
+// IAM policy, dropping the bindings left without members.
+func removePolicyMember(policy map[string]interface{}, member string, roles []string) {
+	bindings, _ := policy["bindings"].([]interface{})
+
+	result := []interface{}{}
+	for _, bindingRaw := range bindings {
+		binding, ok := bindingRaw.(map[string]interface{})
+		role, _ := binding["role"].(string)
+		if !ok || binding["condition"] != nil || !strutil.StrListContains(roles, role) {
+			result = append(result, bindingRaw)
+			continue
+		}
+
+		members, _ := binding["members"].([]interface{})
+		var remaining []interface{}
+		for _, m := range members {
+			if m != member {
+				remaining = append(remaining, m)
+			}
+		}
+		if len(remaining) != 0 {
+			binding["members"] = remaining
+			result = append(result, binding)
+		}
+	}
+
+	policy["bindings"] = result
+}
+
+func containsMember(members []interface{}, member string) bool {
+	for _, m := range members {
+		if m == member {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceAccountMember returns the IAM policy member of a service account
+func serviceAccountMember(email string) string {
+	return "serviceAccount:" + email
+}
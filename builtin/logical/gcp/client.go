@@ -0,0 +1,299 @@
+package gcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// cloudPlatformScope is the scope of the access tokens used by Vault to call
+// the Google Cloud APIs
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// gcpClient makes calls to the REST APIs of Google Cloud that manage service
+// accounts and IAM policies. The Go client libraries of these APIs are not
+// available to Vault, and the few calls made here do not warrant them.
+type gcpClient struct {
+	httpClient *http.Client
+
+	// endpoint returns the base URL of the API of a Google Cloud service,
+	// such as "iam" or "cloudresourcemanager"
+	endpoint func(service string) string
+}
+
+// newGCPClient returns a client authenticating with the given service account
+// credentials file or, if it is empty, with the application default
+// credentials.
+func newGCPClient(credentials string) (*gcpClient, error) {
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, cleanhttp.DefaultClient())
+
+	var tokenSource oauth2.TokenSource
+	if credentials != "" {
+		jwtConfig, err := google.JWTConfigFromJSON([]byte(credentials), cloudPlatformScope)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing credentials: %s", err)
+		}
+		tokenSource = jwtConfig.TokenSource(ctx)
+	} else {
+		var err error
+		tokenSource, err = google.DefaultTokenSource(ctx, cloudPlatformScope)
+		if err != nil {
+			return nil, fmt.Errorf("error finding the application default credentials: %s", err)
+		}
+	}
+
+	httpClient := oauth2.NewClient(ctx, tokenSource)
+	httpClient.Timeout = 30 * time.Second
+
+	return &gcpClient{
+		httpClient: httpClient,
+		endpoint: func(service string) string {
+			return fmt.Sprintf("https://%s.googleapis.com/", service)
+		},
+	}, nil
+}
+
+// apiError is an error returned by a Google Cloud API
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("google cloud API returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// isNotFound returns whether err is an API error for a missing resource
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// isConflict returns whether err is an API error for a concurrent
+// modification, such as an IAM policy with a stale etag
+func isConflict(err error) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.StatusCode == http.StatusConflict
+}
+
+type serviceAccount struct {
+	Name        string `json:"name,omitempty"`
+	ProjectID   string `json:"projectId,omitempty"`
+	UniqueID    string `json:"uniqueId,omitempty"`
+	Email       string `json:"email,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+type serviceAccountKey struct {
+	Name           string `json:"name"`
+	PrivateKeyType string `json:"privateKeyType"`
+	PrivateKeyData string `json:"privateKeyData"`
+	KeyAlgorithm   string `json:"keyAlgorithm"`
+}
+
+type accessToken struct {
+	AccessToken string    `json:"accessToken"`
+	ExpireTime  time.Time `json:"expireTime"`
+}
+
+// serviceAccountResource returns the name of a service account in the IAM
+// API. The project is inferred from the email.
+func serviceAccountResource(email string) string {
+	return "projects/-/serviceAccounts/" + url.PathEscape(email)
+}
+
+func (c *gcpClient) createServiceAccount(project, accountID, displayName string) (*serviceAccount, error) {
+	account := &serviceAccount{}
+	err := c.do("POST", c.endpoint("iam")+"v1/projects/"+url.PathEscape(project)+"/serviceAccounts", map[string]interface{}{
+		"accountId": accountID,
+		"serviceAccount": &serviceAccount{
+			DisplayName: displayName,
+		},
+	}, account)
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (c *gcpClient) getServiceAccount(email string) (*serviceAccount, error) {
+	account := &serviceAccount{}
+	if err := c.do("GET", c.endpoint("iam")+"v1/"+serviceAccountResource(email), nil, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// deleteServiceAccount deletes a service account, succeeding if it does not
+// exist.
+func (c *gcpClient) deleteServiceAccount(email string) error {
+	err := c.do("DELETE", c.endpoint("iam")+"v1/"+serviceAccountResource(email), nil, nil)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (c *gcpClient) createServiceAccountKey(email, keyAlgorithm, privateKeyType string) (*serviceAccountKey, error) {
+	key := &serviceAccountKey{}
+	err := c.do("POST", c.endpoint("iam")+"v1/"+serviceAccountResource(email)+"/keys", map[string]interface{}{
+		"keyAlgorithm":   keyAlgorithm,
+		"privateKeyType": privateKeyType,
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// deleteServiceAccountKey deletes a service account key by its full name,
+// succeeding if the key or its service account do not exist.
+func (c *gcpClient) deleteServiceAccountKey(name string) error {
+	err := c.do("DELETE", c.endpoint("iam")+"v1/"+name, nil, nil)
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (c *gcpClient) generateAccessToken(email string, scopes []string, lifetime time.Duration) (*accessToken, error) {
+	token := &accessToken{}
+	err := c.do("POST", c.endpoint("iamcredentials")+"v1/"+serviceAccountResource(email)+":generateAccessToken", map[string]interface{}{
+		"scope":    scopes,
+		"lifetime": fmt.Sprintf("%ds", int64(lifetime.Seconds())),
+	}, token)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// getIAMPolicy returns the IAM policy of a resource. Policies are kept as
+// generic maps so that the fields Vault does not manage are written back
+// unchanged.
+func (c *gcpClient) getIAMPolicy(resource *iamResource) (map[string]interface{}, error) {
+	policy := map[string]interface{}{}
+	var err error
+	if resource.Service == "storage" {
+		err = c.do("GET", c.endpoint("storage")+"storage/v1/"+resource.Path+"/iam", nil, &policy)
+	} else {
+		err = c.do("POST", c.endpoint(resource.Service)+"v1/"+resource.Path+":getIamPolicy", map[string]interface{}{}, &policy)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (c *gcpClient) setIAMPolicy(resource *iamResource, policy map[string]interface{}) error {
+	if resource.Service == "storage" {
+		return c.do("PUT", c.endpoint("storage")+"storage/v1/"+resource.Path+"/iam", policy, nil)
+	}
+	return c.do("POST", c.endpoint(resource.Service)+"v1/"+resource.Path+":setIamPolicy", map[string]interface{}{
+		"policy": policy,
+	}, nil)
+}
+
+// do makes a request to an API, encoding in as the JSON body and decoding the
+// response into out if they are set.
+func (c *gcpClient) do(method, url string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errResp struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		apiErr := &apiError{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err == nil {
+			apiErr.Message = errResp.Error.Message
+		}
+		if apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		return apiErr
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("error decoding google cloud API response: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// iamResource is a Google Cloud resource whose IAM policy can be managed,
+// identified by its full resource name, such as
+// "//cloudresourcemanager.googleapis.com/projects/my-project".
+type iamResource struct {
+	Name    string
+	Service string
+	Path    string
+}
+
+func parseIAMResource(name string) (*iamResource, error) {
+	if !strings.HasPrefix(name, "//") {
+		return nil, fmt.Errorf("resource %q is not a full resource name starting with //", name)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(name, "//"), "/", 2)
+	if len(parts) != 2 || parts[1] == "" || !strings.HasSuffix(parts[0], ".googleapis.com") {
+		return nil, fmt.Errorf("resource %q is not a full resource name of a Google Cloud service", name)
+	}
+
+	resource := &iamResource{
+		Name:    name,
+		Service: strings.TrimSuffix(parts[0], ".googleapis.com"),
+		Path:    strings.Trim(parts[1], "/"),
+	}
+	if resource.Service == "" || strings.Contains(resource.Service, ".") {
+		return nil, fmt.Errorf("resource %q is not a full resource name of a Google Cloud service", name)
+	}
+	// Buckets are named "projects/_/buckets/<name>" but the JSON API of Cloud
+	// Storage calls them "b/<name>"
+	if resource.Service == "storage" {
+		resource.Path = strings.Replace(resource.Path, "projects/_/buckets/", "b/", 1)
+		if !strings.HasPrefix(resource.Path, "b/") || strings.Contains(strings.TrimPrefix(resource.Path, "b/"), "/") {
+			return nil, fmt.Errorf("only the IAM policies of buckets are supported for storage resources")
+		}
+	}
+
+	return resource, nil
+}
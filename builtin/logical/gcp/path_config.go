@@ -0,0 +1,139 @@
+package gcp
+
+import (
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"golang.org/x/oauth2/google"
+)
+
+const configPath = "config"
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config",
+		Fields: map[string]*framework.FieldSchema{
+			"credentials": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `JSON credentials file of the service account used by Vault.
+If not set, the application default credentials are used.`,
+			},
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Default lease of the service account keys. Defaults to the system default.",
+			},
+			"max_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum lease of the service account keys. Defaults to the system maximum.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := getConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	// The credentials are not returned
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"ttl":     int64(config.TTL.Seconds()),
+			"max_ttl": int64(config.MaxTTL.Seconds()),
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := getConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &gcpConfig{}
+	}
+
+	if credentialsRaw, ok := d.GetOk("credentials"); ok {
+		credentials := credentialsRaw.(string)
+		if credentials != "" {
+			if _, err := google.JWTConfigFromJSON([]byte(credentials)); err != nil {
+				return logical.ErrorResponse("credentials must be the JSON credentials file of a service account"), nil
+			}
+		}
+		config.Credentials = credentials
+	}
+	if ttlRaw, ok := d.GetOk("ttl"); ok {
+		config.TTL = time.Duration(ttlRaw.(int)) * time.Second
+	}
+	if maxTTLRaw, ok := d.GetOk("max_ttl"); ok {
+		config.MaxTTL = time.Duration(maxTTLRaw.(int)) * time.Second
+	}
+	if config.MaxTTL != 0 && config.TTL > config.MaxTTL {
+		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(configPath, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	b.resetClient()
+
+	return nil, nil
+}
+
+func getConfig(s logical.Storage) (*gcpConfig, error) {
+	entry, err := s.Get(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result gcpConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+type gcpConfig struct {
+	Credentials string        `json:"credentials"`
+	TTL         time.Duration `json:"ttl"`
+	MaxTTL      time.Duration `json:"max_ttl"`
+}
+
+const pathConfigHelpSyn = `
+Configure the credentials used to manage service accounts and IAM policies.
+`
+
+const pathConfigHelpDesc = `
+The GCP backend needs credentials that are able to manage service accounts,
+their keys and the IAM policies of the resources bound in rolesets. This
+endpoint configures the JSON credentials file of a service account for this
+purpose. If it is not set, the application default credentials of the Vault
+server are used.
+
+The "ttl" and "max_ttl" parameters configure the leases of the service
+account keys generated by this backend.
+`
@@ -0,0 +1,317 @@
+package gcp
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathListRoleSets(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "rolesets/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleSetList,
+		},
+
+		HelpSynopsis:    pathRoleSetHelpSyn,
+		HelpDescription: pathRoleSetHelpDesc,
+	}
+}
+
+func pathRoleSet(b *backend) *framework.Path {
+	fields := serviceAccountFields()
+	fields["project"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Project in which the service account is created. Cannot be changed.",
+	}
+
+	return &framework.Path{
+		Pattern: roleSetPath + "/" + framework.GenericNameRegex("name"),
+		Fields:  fields,
+
+		ExistenceCheck: b.pathRoleSetExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathRoleSetRead,
+			logical.CreateOperation: b.pathRoleSetWrite,
+			logical.UpdateOperation: b.pathRoleSetWrite,
+			logical.DeleteOperation: b.pathRoleSetDelete,
+		},
+
+		HelpSynopsis:    pathRoleSetHelpSyn,
+		HelpDescription: pathRoleSetHelpDesc,
+	}
+}
+
+func pathRoleSetRotate(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: roleSetPath + "/" + framework.GenericNameRegex("name") + "/rotate",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the roleset",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRoleSetRotate,
+		},
+
+		HelpSynopsis:    pathRoleSetRotateHelpSyn,
+		HelpDescription: pathRoleSetRotateHelpDesc,
+	}
+}
+
+func (b *backend) pathRoleSetExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	roleSet, err := getRoleSet(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return roleSet != nil, nil
+}
+
+func (b *backend) pathRoleSetList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(roleSetPath + "/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathRoleSetRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleSet, err := getRoleSet(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if roleSet == nil {
+		return nil, nil
+	}
+
+	data := roleSet.responseData()
+	data["project"] = roleSet.Project
+
+	return &logical.Response{
+		Data: data,
+	}, nil
+}
+
+func (b *backend) pathRoleSetWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.accountLock.Lock()
+	defer b.accountLock.Unlock()
+
+	roleSet, err := getRoleSet(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if roleSet == nil {
+		roleSet = &roleSetEntry{}
+	}
+	previous := *roleSet
+
+	if projectRaw, ok := d.GetOk("project"); ok {
+		project := projectRaw.(string)
+		if roleSet.Project != "" && roleSet.Project != project {
+			return logical.ErrorResponse("project cannot be changed"), nil
+		}
+		roleSet.Project = project
+	}
+	if roleSet.Project == "" {
+		return logical.ErrorResponse("project is required"), nil
+	}
+
+	if msg := roleSet.update(d); msg != "" {
+		return logical.ErrorResponse(msg), nil
+	}
+	if len(roleSet.Bindings) == 0 {
+		return logical.ErrorResponse("bindings are required"), nil
+	}
+
+	// The service account is replaced when the bindings change, so that the
+	// keys issued with the previous bindings stop working
+	if req.Operation == logical.CreateOperation || !sameBindings(previous.Bindings, roleSet.Bindings) {
+		return b.rotateRoleSet(req.Storage, name, &previous, roleSet)
+	}
+
+	if err := putRoleSet(req.Storage, name, roleSet); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathRoleSetDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.accountLock.Lock()
+	defer b.accountLock.Unlock()
+
+	roleSet, err := getRoleSet(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if roleSet == nil {
+		return nil, nil
+	}
+
+	client, err := b.gcpClient(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// The roleset is kept until its service account is deleted, so that the
+	// deletion can be retried
+	if err := deleteRoleSetAccount(client, &roleSet.serviceAccountConfig); err != nil {
+		return nil, err
+	}
+
+	if err := req.Storage.Delete(roleSetPath + "/" + name); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathRoleSetRotate(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.accountLock.Lock()
+	defer b.accountLock.Unlock()
+
+	roleSet, err := getRoleSet(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if roleSet == nil {
+		return logical.ErrorResponse(fmt.Sprintf("roleset %q not found", name)), nil
+	}
+
+	previous := *roleSet
+	return b.rotateRoleSet(req.Storage, name, &previous, roleSet)
+}
+
+// rotateRoleSet creates a new service account for the roleset with its
+// bindings and stores it, then removes the previous service account. The
+// previous account is only cleaned up on a best effort basis, as the roleset
+// no longer refers to it; failures are returned as warnings. The caller must
+// hold the accountLock.
+func (b *backend) rotateRoleSet(s logical.Storage, name string, previous, roleSet *roleSetEntry) (*logical.Response, error) {
+	client, err := b.gcpClient(s)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := client.createServiceAccount(roleSet.Project, genAccountID(name),
+		fmt.Sprintf("Service account of the Vault roleset %s", name))
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error creating service account: %s", err)), nil
+	}
+	roleSet.ServiceAccountEmail = account.Email
+
+	err = client.addBindings(serviceAccountMember(account.Email), roleSet.Bindings)
+	if err == nil {
+		err = putRoleSet(s, name, roleSet)
+	}
+	if err != nil {
+		if cleanupErr := deleteRoleSetAccount(client, &roleSet.serviceAccountConfig); cleanupErr != nil {
+			err = errwrap.Wrapf(fmt.Sprintf("%s; error cleaning up service account %s: {{err}}", err, account.Email), cleanupErr)
+		}
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if previous.ServiceAccountEmail == "" {
+		return nil, nil
+	}
+
+	resp := &logical.Response{}
+	if err := deleteRoleSetAccount(client, &previous.serviceAccountConfig); err != nil {
+		resp.AddWarning(fmt.Sprintf("error deleting the previous service account %s: %s", previous.ServiceAccountEmail, err))
+		return resp, nil
+	}
+
+	return nil, nil
+}
+
+// deleteRoleSetAccount removes the bindings of the service account of a
+// roleset, and deletes it along with its keys.
+func deleteRoleSetAccount(client *gcpClient, config *serviceAccountConfig) error {
+	if err := client.removeBindings(serviceAccountMember(config.ServiceAccountEmail), config.Bindings); err != nil {
+		return err
+	}
+	return client.deleteServiceAccount(config.ServiceAccountEmail)
+}
+
+func getRoleSet(s logical.Storage, name string) (*roleSetEntry, error) {
+	entry, err := s.Get(roleSetPath + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result roleSetEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func putRoleSet(s logical.Storage, name string, roleSet *roleSetEntry) error {
+	entry, err := logical.StorageEntryJSON(roleSetPath+"/"+name, roleSet)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+// roleSetEntry is a roleset, whose service account is created and managed by
+// Vault
+type roleSetEntry struct {
+	serviceAccountConfig
+
+	Project string `json:"project"`
+}
+
+const pathRoleSetHelpSyn = `
+Manage the rolesets, whose service accounts are created by Vault.
+`
+
+const pathRoleSetHelpDesc = `
+This path lets you manage rolesets. Vault creates a service account in the
+project of each roleset, and grants it the IAM roles of the bindings on Google
+Cloud resources. Bindings are given in HCL or JSON:
+
+  resource "//cloudresourcemanager.googleapis.com/projects/my-project" {
+    roles = ["roles/viewer"]
+  }
+
+The "secret_type" parameter sets whether the roleset issues OAuth2 access
+tokens, from its "token" endpoint, or leased service account keys, from its
+"key" endpoint. Access tokens require "token_scopes".
+
+Changing the bindings of a roleset replaces its service account, which
+invalidates the credentials issued previously. Deleting a roleset deletes its
+service account.
+`
+
+const pathRoleSetRotateHelpSyn = `
+Replace the service account of a roleset.
+`
+
+const pathRoleSetRotateHelpDesc = `
+This path replaces the service account of a roleset with a new one with the
+same bindings, and deletes the previous account. The credentials issued for
+the previous account stop working.
+`
@@ -0,0 +1,207 @@
+package gcp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// accessTokenLifetime is the lifetime of the access tokens, which is the
+// maximum allowed by Google Cloud without an organization policy
+const accessTokenLifetime = time.Hour
+
+// pathSecretToken returns the path issuing access tokens for the rolesets or
+// static accounts, depending on kind.
+func pathSecretToken(b *backend, kind string) *framework.Path {
+	return &framework.Path{
+		Pattern: kind + "/" + framework.GenericNameRegex("name") + "/token",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the roleset or static account",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathSecretTokenRead(kind),
+			logical.UpdateOperation: b.pathSecretTokenRead(kind),
+		},
+
+		HelpSynopsis:    pathSecretTokenHelpSyn,
+		HelpDescription: pathSecretTokenHelpDesc,
+	}
+}
+
+// pathSecretKey returns the path issuing service account keys for the
+// rolesets or static accounts, depending on kind.
+func pathSecretKey(b *backend, kind string) *framework.Path {
+	return &framework.Path{
+		Pattern: kind + "/" + framework.GenericNameRegex("name") + "/key",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the roleset or static account",
+			},
+			"key_algorithm": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     "KEY_ALG_RSA_2048",
+				Description: "Algorithm of the key, KEY_ALG_RSA_2048 or KEY_ALG_RSA_1024.",
+			},
+			"key_type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     "TYPE_GOOGLE_CREDENTIALS_FILE",
+				Description: "Format of the private key, TYPE_GOOGLE_CREDENTIALS_FILE or TYPE_PKCS12_FILE.",
+			},
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Lease of the key. Defaults to the configured ttl.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathSecretKeyRead(kind),
+			logical.UpdateOperation: b.pathSecretKeyRead(kind),
+		},
+
+		HelpSynopsis:    pathSecretKeyHelpSyn,
+		HelpDescription: pathSecretKeyHelpDesc,
+	}
+}
+
+func (b *backend) pathSecretTokenRead(kind string) framework.OperationFunc {
+	return func(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+		account, resp, err := b.issuingAccount(req.Storage, kind, name, secretTypeAccessToken)
+		if resp != nil || err != nil {
+			return resp, err
+		}
+
+		client, err := b.gcpClient(req.Storage)
+		if err != nil {
+			return nil, err
+		}
+
+		token, err := client.generateAccessToken(account.ServiceAccountEmail, account.TokenScopes, accessTokenLifetime)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("error generating access token: %s", err)), nil
+		}
+
+		// Access tokens cannot be revoked, so they are not leased
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"token":              token.AccessToken,
+				"token_ttl":          int64(token.ExpireTime.Sub(time.Now()).Seconds()),
+				"expires_at_seconds": token.ExpireTime.Unix(),
+			},
+		}, nil
+	}
+}
+
+func (b *backend) pathSecretKeyRead(kind string) framework.OperationFunc {
+	return func(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+		account, resp, err := b.issuingAccount(req.Storage, kind, name, secretTypeKey)
+		if resp != nil || err != nil {
+			return resp, err
+		}
+
+		keyAlgorithm := d.Get("key_algorithm").(string)
+		switch keyAlgorithm {
+		case "KEY_ALG_RSA_2048", "KEY_ALG_RSA_1024":
+		default:
+			return logical.ErrorResponse(fmt.Sprintf("unsupported key_algorithm %q", keyAlgorithm)), nil
+		}
+		keyType := d.Get("key_type").(string)
+		switch keyType {
+		case "TYPE_GOOGLE_CREDENTIALS_FILE", "TYPE_PKCS12_FILE":
+		default:
+			return logical.ErrorResponse(fmt.Sprintf("unsupported key_type %q", keyType)), nil
+		}
+
+		config, err := getConfig(req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		if config == nil {
+			config = &gcpConfig{}
+		}
+
+		ttl := config.TTL
+		if ttlRaw, ok := d.GetOk("ttl"); ok {
+			ttl = time.Duration(ttlRaw.(int)) * time.Second
+		}
+		if config.MaxTTL != 0 && ttl > config.MaxTTL {
+			return logical.ErrorResponse(fmt.Sprintf("ttl cannot be greater than the max_ttl of %s", config.MaxTTL)), nil
+		}
+
+		client, err := b.gcpClient(req.Storage)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := client.createServiceAccountKey(account.ServiceAccountEmail, keyAlgorithm, keyType)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("error creating service account key: %s", err)), nil
+		}
+
+		resp = b.Secret(SecretServiceAccountKeyType).Response(map[string]interface{}{
+			"private_key_data": key.PrivateKeyData,
+			"key_algorithm":    key.KeyAlgorithm,
+			"key_type":         key.PrivateKeyType,
+		}, map[string]interface{}{
+			"key_name":              key.Name,
+			"service_account_email": account.ServiceAccountEmail,
+			"account_path":          kind + "/" + name,
+		})
+		if ttl != 0 {
+			resp.Secret.TTL = ttl
+		}
+
+		return resp, nil
+	}
+}
+
+// issuingAccount returns the roleset or static account issuing a type of
+// secret, or an error response if it does not exist or issues other secrets.
+func (b *backend) issuingAccount(s logical.Storage, kind, name, secretType string) (*serviceAccountConfig, *logical.Response, error) {
+	account, err := getServiceAccountConfig(s, kind, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if account == nil {
+		return nil, logical.ErrorResponse(fmt.Sprintf("%s %q not found", kind, name)), nil
+	}
+	if account.SecretType != secretType {
+		return nil, logical.ErrorResponse(fmt.Sprintf(
+			"%s %q issues secrets of type %s", kind, name, account.SecretType)), nil
+	}
+	return account, nil, nil
+}
+
+const pathSecretTokenHelpSyn = `
+Generate an OAuth2 access token for a roleset or static account.
+`
+
+const pathSecretTokenHelpDesc = `
+This path generates an OAuth2 access token for the service account of a
+roleset or static account whose secret type is "access_token", with its token
+scopes. Access tokens are valid for an hour and are not leased, as Google
+Cloud cannot revoke them.
+`
+
+const pathSecretKeyHelpSyn = `
+Generate a leased service account key for a roleset or static account.
+`
+
+const pathSecretKeyHelpDesc = `
+This path generates a key for the service account of a roleset or static
+account whose secret type is "service_account_key". The key is deleted when
+its lease is revoked. Service accounts have at most ten keys, which limits the
+number of keys leased at once.
+
+The "key_algorithm" and "key_type" parameters set the algorithm of the key and
+the format of the private key, which defaults to a JSON credentials file. The
+private key is returned base64 encoded.
+`
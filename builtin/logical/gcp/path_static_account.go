@@ -0,0 +1,204 @@
+package gcp
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathListStaticAccounts(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-accounts/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathStaticAccountList,
+		},
+
+		HelpSynopsis:    pathStaticAccountHelpSyn,
+		HelpDescription: pathStaticAccountHelpDesc,
+	}
+}
+
+func pathStaticAccount(b *backend) *framework.Path {
+	fields := serviceAccountFields()
+	fields["service_account_email"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Email of the existing service account. Cannot be changed.",
+	}
+
+	return &framework.Path{
+		Pattern: staticAccountPath + "/" + framework.GenericNameRegex("name"),
+		Fields:  fields,
+
+		ExistenceCheck: b.pathStaticAccountExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathStaticAccountRead,
+			logical.CreateOperation: b.pathStaticAccountWrite,
+			logical.UpdateOperation: b.pathStaticAccountWrite,
+			logical.DeleteOperation: b.pathStaticAccountDelete,
+		},
+
+		HelpSynopsis:    pathStaticAccountHelpSyn,
+		HelpDescription: pathStaticAccountHelpDesc,
+	}
+}
+
+func (b *backend) pathStaticAccountExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	account, err := getServiceAccountConfig(req.Storage, staticAccountPath, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return account != nil, nil
+}
+
+func (b *backend) pathStaticAccountList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(staticAccountPath + "/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathStaticAccountRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	account, err := getServiceAccountConfig(req.Storage, staticAccountPath, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: account.responseData(),
+	}, nil
+}
+
+func (b *backend) pathStaticAccountWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.accountLock.Lock()
+	defer b.accountLock.Unlock()
+
+	account, err := getServiceAccountConfig(req.Storage, staticAccountPath, name)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		account = &serviceAccountConfig{}
+	}
+	previousBindings := account.Bindings
+
+	if emailRaw, ok := d.GetOk("service_account_email"); ok {
+		email := emailRaw.(string)
+		if account.ServiceAccountEmail != "" && account.ServiceAccountEmail != email {
+			return logical.ErrorResponse("service_account_email cannot be changed"), nil
+		}
+		account.ServiceAccountEmail = email
+	}
+	if account.ServiceAccountEmail == "" {
+		return logical.ErrorResponse("service_account_email is required"), nil
+	}
+
+	if msg := account.update(d); msg != "" {
+		return logical.ErrorResponse(msg), nil
+	}
+
+	client, err := b.gcpClient(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Operation == logical.CreateOperation {
+		if _, err := client.getServiceAccount(account.ServiceAccountEmail); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf(
+				"error reading service account %s: %s", account.ServiceAccountEmail, err)), nil
+		}
+	}
+
+	// The new bindings are added before the previous ones are removed, so that
+	// the roles bound in both are not lost in between
+	member := serviceAccountMember(account.ServiceAccountEmail)
+	if !sameBindings(previousBindings, account.Bindings) {
+		if err := client.addBindings(member, account.Bindings); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	if err := putStaticAccount(req.Storage, name, account); err != nil {
+		return nil, err
+	}
+
+	if err := client.removeBindings(member, removedBindings(previousBindings, account.Bindings)); err != nil {
+		resp := &logical.Response{}
+		resp.AddWarning(err.Error())
+		return resp, nil
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathStaticAccountDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.accountLock.Lock()
+	defer b.accountLock.Unlock()
+
+	account, err := getServiceAccountConfig(req.Storage, staticAccountPath, name)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, nil
+	}
+
+	client, err := b.gcpClient(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// The service account itself is left in place, but loses the roles bound
+	// by Vault
+	if err := client.removeBindings(serviceAccountMember(account.ServiceAccountEmail), account.Bindings); err != nil {
+		return nil, err
+	}
+
+	if err := req.Storage.Delete(staticAccountPath + "/" + name); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func putStaticAccount(s logical.Storage, name string, account *serviceAccountConfig) error {
+	entry, err := logical.StorageEntryJSON(staticAccountPath+"/"+name, account)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+const pathStaticAccountHelpSyn = `
+Manage the static accounts, which issue credentials for existing service accounts.
+`
+
+const pathStaticAccountHelpDesc = `
+This path lets you manage static accounts. A static account issues credentials
+for an existing service account, which is not created nor deleted by Vault.
+The "service_account_email" parameter is required and cannot be changed.
+
+The optional "bindings" parameter grants IAM roles to the service account on
+Google Cloud resources, in the same format as rolesets. The roles are revoked
+when they are removed from the bindings, or when the static account is
+deleted.
+
+The "secret_type" parameter sets whether the static account issues OAuth2
+access tokens, from its "token" endpoint, or leased service account keys, from
+its "key" endpoint. Access tokens require "token_scopes".
+`
@@ -0,0 +1,86 @@
+package gcp
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const SecretServiceAccountKeyType = "service_account_key"
+
+func secretServiceAccountKey(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretServiceAccountKeyType,
+		Fields: map[string]*framework.FieldSchema{
+			"private_key_data": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Base64 encoded private key",
+			},
+			"key_algorithm": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Algorithm of the key",
+			},
+			"key_type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Format of the private key",
+			},
+		},
+
+		Renew:  b.secretServiceAccountKeyRenew,
+		Revoke: b.secretServiceAccountKeyRevoke,
+	}
+}
+
+func (b *backend) secretServiceAccountKeyRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	// Keys are only renewed while the service account they belong to is
+	// still used by the roleset or static account that issued them
+	accountPath, _ := req.Secret.InternalData["account_path"].(string)
+	email, _ := req.Secret.InternalData["service_account_email"].(string)
+
+	entry, err := req.Storage.Get(accountPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return logical.ErrorResponse(fmt.Sprintf("%s no longer exists", accountPath)), nil
+	}
+	var account serviceAccountConfig
+	if err := entry.DecodeJSON(&account); err != nil {
+		return nil, err
+	}
+	if account.ServiceAccountEmail != email {
+		return logical.ErrorResponse(fmt.Sprintf("the service account of %s was replaced", accountPath)), nil
+	}
+
+	config, err := getConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &gcpConfig{}
+	}
+
+	return framework.LeaseExtend(config.TTL, config.MaxTTL, b.System())(req, d)
+}
+
+func (b *backend) secretServiceAccountKeyRevoke(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	keyNameRaw, ok := req.Secret.InternalData["key_name"]
+	if !ok {
+		return nil, fmt.Errorf("secret is missing key_name internal data")
+	}
+
+	client, err := b.gcpClient(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys of deleted service accounts are already gone
+	if err := client.deleteServiceAccountKey(keyNameRaw.(string)); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,175 @@
+package gcp
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	// roleSetPath and staticAccountPath prefix both the API paths and the
+	// storage entries of rolesets and static accounts
+	roleSetPath       = "roleset"
+	staticAccountPath = "static-account"
+
+	secretTypeAccessToken = "access_token"
+	secretTypeKey         = "service_account_key"
+)
+
+// serviceAccountConfig is the part of rolesets and static accounts that
+// determines the credentials they issue.
+type serviceAccountConfig struct {
+	// ServiceAccountEmail is the email of the service account whose
+	// credentials are issued
+	ServiceAccountEmail string `json:"service_account_email"`
+
+	// SecretType is the type of credential issued, either access tokens or
+	// leased service account keys
+	SecretType string `json:"secret_type"`
+
+	// TokenScopes are the OAuth2 scopes of the access tokens
+	TokenScopes []string `json:"token_scopes"`
+
+	// Bindings are the IAM roles granted to the service account on each
+	// resource, and RawBindings the bindings as they were given
+	Bindings    map[string][]string `json:"bindings"`
+	RawBindings string              `json:"raw_bindings"`
+}
+
+// serviceAccountFields are the fields shared by rolesets and static accounts
+func serviceAccountFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"name": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Name of the roleset or static account",
+		},
+		"secret_type": &framework.FieldSchema{
+			Type: framework.TypeString,
+			Description: `Type of credential issued, "access_token" or "service_account_key".
+Defaults to "access_token". Cannot be changed.`,
+		},
+		"token_scopes": &framework.FieldSchema{
+			Type:        framework.TypeCommaStringSlice,
+			Description: "OAuth2 scopes of the access tokens. Required for access tokens.",
+		},
+		"bindings": &framework.FieldSchema{
+			Type: framework.TypeString,
+			Description: `IAM roles granted to the service account on Google Cloud resources,
+in HCL or JSON, optionally base64 encoded.`,
+		},
+	}
+}
+
+// update sets the fields shared by rolesets and static accounts from the
+// request, returning an error message for invalid values.
+func (c *serviceAccountConfig) update(d *framework.FieldData) string {
+	if secretTypeRaw, ok := d.GetOk("secret_type"); ok {
+		secretType := secretTypeRaw.(string)
+		if c.SecretType != "" && c.SecretType != secretType {
+			return "secret_type cannot be changed"
+		}
+		c.SecretType = secretType
+	}
+	if c.SecretType == "" {
+		c.SecretType = secretTypeAccessToken
+	}
+	switch c.SecretType {
+	case secretTypeAccessToken, secretTypeKey:
+	default:
+		return fmt.Sprintf("unsupported secret_type %q", c.SecretType)
+	}
+
+	if tokenScopesRaw, ok := d.GetOk("token_scopes"); ok {
+		c.TokenScopes = strutil.RemoveDuplicates(tokenScopesRaw.([]string), false)
+	}
+	if c.SecretType == secretTypeAccessToken && len(c.TokenScopes) == 0 {
+		return "token_scopes are required for access tokens"
+	}
+
+	// Bindings are cleared with an empty string, which is only allowed for
+	// static accounts
+	if bindingsRaw, ok := d.GetOk("bindings"); ok {
+		c.Bindings = nil
+		c.RawBindings = bindingsRaw.(string)
+		if c.RawBindings != "" {
+			bindings, err := parseBindings(c.RawBindings)
+			if err != nil {
+				return err.Error()
+			}
+			c.Bindings = bindings
+		}
+	}
+
+	return ""
+}
+
+func (c *serviceAccountConfig) responseData() map[string]interface{} {
+	data := map[string]interface{}{
+		"service_account_email": c.ServiceAccountEmail,
+		"secret_type":           c.SecretType,
+		"bindings":              c.Bindings,
+	}
+	if c.SecretType == secretTypeAccessToken {
+		data["token_scopes"] = c.TokenScopes
+	}
+	return data
+}
+
+// sameBindings returns whether two sets of bindings grant the same roles
+func sameBindings(a, b map[string][]string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// removedBindings returns the roles bound in old but not in new
+func removedBindings(old, new map[string][]string) map[string][]string {
+	removed := map[string][]string{}
+	for name, roles := range old {
+		for _, role := range roles {
+			if !strutil.StrListContains(new[name], role) {
+				removed[name] = append(removed[name], role)
+			}
+		}
+	}
+	return removed
+}
+
+// getServiceAccountConfig returns the credential configuration of a roleset
+// or static account, which are both stored under their API path.
+func getServiceAccountConfig(s logical.Storage, kind, name string) (*serviceAccountConfig, error) {
+	entry, err := s.Get(kind + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result serviceAccountConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+var invalidAccountIDChars = regexp.MustCompile("[^a-z0-9-]+")
+
+// genAccountID returns the ID of a new service account of a roleset. IDs are
+// limited to 30 lowercase letters, digits and dashes.
+func genAccountID(name string) string {
+	name = invalidAccountIDChars.ReplaceAllString(strings.ToLower(name), "-")
+	if len(name) > 10 {
+		name = name[:10]
+	}
+	return fmt.Sprintf("vault%s-%d%04d", name, time.Now().Unix(), rand.Int31n(10000))
+}
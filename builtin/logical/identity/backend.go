@@ -0,0 +1,92 @@
+package identity
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	var b backend
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		PathsSpecial: &logical.Paths{
+			Unauthenticated: []string{
+				"oidc/.well-known/*",
+				"oidc/issuer/*",
+			},
+		},
+
+		Paths: []*framework.Path{
+			pathConfig(&b),
+			pathListKeys(&b),
+			pathKeys(&b),
+			pathRotateKey(&b),
+			pathListRoles(&b),
+			pathRoles(&b),
+			pathToken(&b),
+			pathIntrospect(&b),
+			pathDiscovery(&b),
+			pathJWKS(&b),
+			pathListScopes(&b),
+			pathScopes(&b),
+			pathListClients(&b),
+			pathClients(&b),
+			pathListProviders(&b),
+			pathProviders(&b),
+			pathAuthorize(&b),
+			pathProviderDiscovery(&b),
+			pathProviderJWKS(&b),
+			pathProviderToken(&b),
+			pathProviderUserInfo(&b),
+		},
+
+		PeriodicFunc: b.periodicFunc,
+	}
+
+	return &b
+}
+
+type backend struct {
+	*framework.Backend
+
+	// keyLock guards the rotation of keys, and their use by roles and
+	// clients
+	keyLock sync.RWMutex
+
+	// flowLock guards the exchange of authorization codes
+	flowLock sync.Mutex
+}
+
+func (b *backend) periodicFunc(req *logical.Request) error {
+	if err := b.rotateKeys(req.Storage); err != nil {
+		return err
+	}
+	return b.tidyProviderTokens(req.Storage)
+}
+
+const backendHelp = `
+The identity backend makes Vault an OpenID Connect identity provider. It
+issues signed identity tokens, in the form of JWTs, describing the client
+that requested them, which workloads can present to third parties.
+
+Keys sign the tokens and are rotated on a schedule. Roles set the key, the
+audience, the lifetime and the templated claims of their tokens. Third
+parties verify the tokens with the unauthenticated discovery and JWKS
+endpoints under "oidc/.well-known/".
+
+Providers let apps sign users in with Vault using the OpenID Connect
+authorization code flow. Clients are the apps using providers, and scopes
+set the claims they receive.
+
+After mounting this backend, the issuer must be configured with the
+"oidc/config" endpoint, and keys and roles written before any tokens can be
+issued.
+`
@@ -0,0 +1,618 @@
+package identity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/credential/userpass"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/vault"
+)
+
+const testIssuer = "https://vault.example.com:8200/v1/identity/oidc"
+
+func testBackend(t *testing.T) (*backend, logical.Storage) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+
+	testRequest(t, b, config.StorageView, logical.UpdateOperation, "oidc/config", map[string]interface{}{
+		"issuer": testIssuer + "/",
+	})
+
+	return b, config.StorageView
+}
+
+func testRequest(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+		Entity: &logical.Entity{
+			Name:     "userpass-alice",
+			Metadata: map[string]string{"team": "payments"},
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("%s %s: err:%s resp:%#v\n", op, path, err, resp)
+	}
+	return resp
+}
+
+func testRequestError(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for %s %s with %v: %#v", op, path, data, resp)
+	}
+}
+
+// testJWKS reads the published JWK set
+func testJWKS(t *testing.T, b *backend, s logical.Storage) map[string]map[string]string {
+	resp := testRequest(t, b, s, logical.ReadOperation, "oidc/.well-known/keys", nil)
+	var jwks struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &jwks); err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[string]map[string]string)
+	for _, key := range jwks.Keys {
+		keys[key["kid"]] = key
+	}
+	return keys
+}
+
+// verifyWithJWK verifies a token with a published JWK, independently of the
+// signing code of the backend, and returns its claims
+func verifyWithJWK(t *testing.T, token string, jwk map[string]string) map[string]interface{} {
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("bad token: %s", token)
+	}
+	var header map[string]string
+	if err := json.Unmarshal(decode(parts[0]), &header); err != nil {
+		t.Fatal(err)
+	}
+	if header["alg"] != jwk["alg"] || header["kid"] != jwk["kid"] || header["typ"] != "JWT" {
+		t.Fatalf("bad header: %v", header)
+	}
+
+	sig := decode(parts[2])
+	hash := crypto.SHA256
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	digest := h.Sum(nil)
+
+	switch jwk["kty"] {
+	case "RSA":
+		pub := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(decode(jwk["n"])),
+			E: int(new(big.Int).SetBytes(decode(jwk["e"])).Int64()),
+		}
+		if err := rsa.VerifyPKCS1v15(pub, hash, digest, sig); err != nil {
+			t.Fatal(err)
+		}
+	case "EC":
+		if jwk["crv"] != "P-256" || len(sig) != 64 {
+			t.Fatalf("bad EC key or signature: %v", jwk)
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(decode(jwk["x"])),
+			Y:     new(big.Int).SetBytes(decode(jwk["y"])),
+		}
+		if !ecdsa.Verify(pub, digest, new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+			t.Fatal("bad EC signature")
+		}
+	default:
+		t.Fatalf("bad key type: %v", jwk)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(decode(parts[1]), &claims); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestBackend_token(t *testing.T) {
+	for _, algorithm := range []string{"RS256", "ES256"} {
+		b, storage := testBackend(t)
+
+		testRequest(t, b, storage, logical.CreateOperation, "oidc/key/default", map[string]interface{}{
+			"algorithm": algorithm,
+		})
+		testRequest(t, b, storage, logical.CreateOperation, "oidc/role/ci", map[string]interface{}{
+			"key":      "default",
+			"ttl":      "1h",
+			"template": `{"team": "{{identity.entity.metadata.team}}", "groups": ["{{identity.entity.metadata.groups}}"], "static": 1}`,
+		})
+		clientID := testRequest(t, b, storage, logical.ReadOperation, "oidc/role/ci", nil).Data["client_id"].(string)
+
+		resp := testRequest(t, b, storage, logical.ReadOperation, "oidc/token/ci", nil)
+		token := resp.Data["token"].(string)
+		if resp.Data["client_id"] != clientID || resp.Data["ttl"] != int64(3600) {
+			t.Fatalf("bad response: %#v", resp.Data)
+		}
+
+		keyID, err := tokenKeyID(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys := testJWKS(t, b, storage)
+		if len(keys) != 1 || keys[keyID] == nil {
+			t.Fatalf("bad JWK set: %v", keys)
+		}
+		claims := verifyWithJWK(t, token, keys[keyID])
+
+		exp, iat := claims["exp"].(float64), claims["iat"].(float64)
+		delete(claims, "exp")
+		delete(claims, "iat")
+		expected := map[string]interface{}{
+			"iss":    testIssuer,
+			"sub":    "userpass-alice",
+			"aud":    clientID,
+			"team":   "payments",
+			"static": float64(1),
+		}
+		if !reflect.DeepEqual(claims, expected) || exp-iat != 3600 {
+			t.Fatalf("bad %s claims: %#v", algorithm, claims)
+		}
+
+		resp = testRequest(t, b, storage, logical.UpdateOperation, "oidc/introspect", map[string]interface{}{
+			"token":     token,
+			"client_id": clientID,
+		})
+		if resp.Data["active"] != true {
+			t.Fatalf("bad introspection: %#v", resp.Data)
+		}
+	}
+}
+
+// testCoreTokens sets up a core with the backend mounted at "identity/" and
+// a userpass user. It returns
+// the core, the root token, the token of the user and a child token of the
+// user carrying forged metadata.
+func testCoreTokens(t *testing.T, rules string) (*vault.Core, string, string, string) {
+	vault.AddTestLogicalBackend("identity", Factory)
+	vault.AddTestCredentialBackend("userpass", userpass.Factory)
+	core, _, root := vault.TestCoreUnsealed(t)
+
+	for _, step := range []struct {
+		path string
+		data map[string]interface{}
+	}{
+		{"sys/mounts/identity", map[string]interface{}{"type": "identity"}},
+		{"sys/auth/userpass", map[string]interface{}{"type": "userpass"}},
+		{"sys/policy/oidc", map[string]interface{}{
+			"rules": rules + `
+path "auth/token/create" { capabilities = ["update"] }`,
+		}},
+		{"auth/userpass/users/alice", map[string]interface{}{"password": "secret", "policies": "oidc"}},
+		{"identity/oidc/config", map[string]interface{}{"issuer": testIssuer + "/"}},
+		{"identity/oidc/key/default", nil},
+	} {
+		testCoreRequest(t, core, root, logical.UpdateOperation, step.path, step.data)
+	}
+
+	resp := testCoreRequest(t, core, "", logical.UpdateOperation, "auth/userpass/login/alice", map[string]interface{}{
+		"password": "secret",
+	})
+	userToken := resp.Auth.ClientToken
+	resp = testCoreRequest(t, core, userToken, logical.UpdateOperation, "auth/token/create", map[string]interface{}{
+		"display_name": "bob",
+		"meta":         map[string]interface{}{"username": "bob"},
+	})
+	return core, root, userToken, resp.Auth.ClientToken
+}
+
+func testCoreRequest(t *testing.T, core *vault.Core, token string, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	req := logical.TestRequest(t, op, path)
+	req.ClientToken = token
+	req.Data = data
+	resp, err := core.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("%s %s: err:%s resp:%#v\n", op, path, err, resp)
+	}
+	return resp
+}
+
+func TestBackend_token_childToken(t *testing.T) {
+	core, root, userToken, childToken := testCoreTokens(t, `path "identity/oidc/token/*" { capabilities = ["read"] }`)
+	testCoreRequest(t, core, root, logical.UpdateOperation, "identity/oidc/role/ci", map[string]interface{}{
+		"key":      "default",
+		"template": `{"username": "{{identity.entity.metadata.username}}"}`,
+	})
+
+	resp := testCoreRequest(t, core, root, logical.ReadOperation, "identity/oidc/.well-known/keys", nil)
+	var jwks struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &jwks); err != nil {
+		t.Fatal(err)
+	}
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("bad JWK set: %v", jwks.Keys)
+	}
+
+	// Child tokens carrying forged metadata get the claims of the user who
+	// logged in
+	for _, token := range []string{userToken, childToken} {
+		resp := testCoreRequest(t, core, token, logical.ReadOperation, "identity/oidc/token/ci", nil)
+		claims := verifyWithJWK(t, resp.Data["token"].(string), jwks.Keys[0])
+		if claims["sub"] != "userpass-alice" || claims["username"] != "alice" {
+			t.Fatalf("bad claims: %#v", claims)
+		}
+	}
+}
+
+func TestBackend_rotation(t *testing.T) {
+	b, storage := testBackend(t)
+
+	testRequest(t, b, storage, logical.CreateOperation, "oidc/key/default", map[string]interface{}{
+		"verification_ttl": "2h",
+	})
+	testRequest(t, b, storage, logical.CreateOperation, "oidc/role/ci", map[string]interface{}{
+		"key": "default",
+		"ttl": "1h",
+	})
+	token := testRequest(t, b, storage, logical.ReadOperation, "oidc/token/ci", nil).Data["token"].(string)
+	oldKeyID, err := tokenKeyID(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The previous version remains published after a rotation
+	testRequest(t, b, storage, logical.UpdateOperation, "oidc/key/default/rotate", nil)
+	keys := testJWKS(t, b, storage)
+	if len(keys) != 2 || keys[oldKeyID] == nil {
+		t.Fatalf("bad JWK set: %v", keys)
+	}
+	verifyWithJWK(t, token, keys[oldKeyID])
+	newToken := testRequest(t, b, storage, logical.ReadOperation, "oidc/token/ci", nil).Data["token"].(string)
+	if newKeyID, _ := tokenKeyID(newToken); newKeyID == oldKeyID || keys[newKeyID] == nil {
+		t.Fatalf("token was not signed with the new key: %s", newKeyID)
+	}
+
+	// The periodic function rotates the key when its rotation period has
+	// elapsed, and removes expired versions
+	key, err := readKey(storage, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key.NextRotation = time.Now().Add(-time.Minute)
+	key.Keys[1].ExpireAt = time.Now().Add(-time.Minute)
+	if err := storeKey(storage, "default", key); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.periodicFunc(&logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	keys = testJWKS(t, b, storage)
+	if len(keys) != 2 || keys[oldKeyID] != nil {
+		t.Fatalf("bad JWK set after periodic rotation: %v", keys)
+	}
+
+	resp := testRequest(t, b, storage, logical.UpdateOperation, "oidc/introspect", map[string]interface{}{
+		"token": token,
+	})
+	if resp.Data["active"] != false {
+		t.Fatalf("token of an expired key is active: %#v", resp.Data)
+	}
+}
+
+func TestBackend_discovery(t *testing.T) {
+	b, storage := testBackend(t)
+
+	resp := testRequest(t, b, storage, logical.ReadOperation, "oidc/.well-known/openid-configuration", nil)
+	if resp.Data[logical.HTTPContentType] != "application/json" {
+		t.Fatalf("bad response: %#v", resp.Data)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["issuer"] != testIssuer || doc["jwks_uri"] != testIssuer+"/.well-known/keys" {
+		t.Fatalf("bad discovery document: %v", doc)
+	}
+
+	paths := b.SpecialPaths().Unauthenticated
+	if !reflect.DeepEqual(paths, []string{"oidc/.well-known/*", "oidc/issuer/*"}) {
+		t.Fatalf("bad unauthenticated paths: %v", paths)
+	}
+}
+
+func TestBackend_introspect(t *testing.T) {
+	b, storage := testBackend(t)
+
+	testRequest(t, b, storage, logical.CreateOperation, "oidc/key/default", nil)
+	testRequest(t, b, storage, logical.CreateOperation, "oidc/role/ci", map[string]interface{}{
+		"key": "default",
+	})
+	token := testRequest(t, b, storage, logical.ReadOperation, "oidc/token/ci", nil).Data["token"].(string)
+	parts := strings.Split(token, ".")
+
+	for _, tc := range []map[string]interface{}{
+		{"token": "not-a-token"},
+		{"token": token, "client_id": "other"},
+		{"token": parts[0] + "." + parts[1] + ".c2lnbmF0dXJl"},
+	} {
+		resp := testRequest(t, b, storage, logical.UpdateOperation, "oidc/introspect", tc)
+		if resp.Data["active"] != false || resp.Data["error"] == "" {
+			t.Fatalf("bad introspection of %v: %#v", tc, resp.Data)
+		}
+	}
+}
+
+func TestBackend_validation(t *testing.T) {
+	b, storage := testBackend(t)
+
+	testRequestError(t, b, storage, logical.UpdateOperation, "oidc/config", map[string]interface{}{
+		"issuer": "vault.example.com",
+	})
+	testRequestError(t, b, storage, logical.CreateOperation, "oidc/key/bad", map[string]interface{}{
+		"algorithm": "HS256",
+	})
+
+	testRequest(t, b, storage, logical.CreateOperation, "oidc/key/default", map[string]interface{}{
+		"verification_ttl": "1h",
+	})
+	for _, data := range []map[string]interface{}{
+		{},
+		{"key": "missing"},
+		{"key": "default", "ttl": "2h"},
+		{"key": "default", "template": "not json"},
+		{"key": "default", "template": `{"sub": "other"}`},
+	} {
+		testRequestError(t, b, storage, logical.CreateOperation, "oidc/role/test", data)
+	}
+
+	testRequest(t, b, storage, logical.CreateOperation, "oidc/role/test", map[string]interface{}{
+		"key": "default",
+		"ttl": "1h",
+	})
+	testRequestError(t, b, storage, logical.UpdateOperation, "oidc/key/default", map[string]interface{}{
+		"verification_ttl": "30m",
+	})
+	testRequestError(t, b, storage, logical.DeleteOperation, "oidc/key/default", nil)
+
+	testRequest(t, b, storage, logical.DeleteOperation, "oidc/role/test", nil)
+	testRequest(t, b, storage, logical.DeleteOperation, "oidc/key/default", nil)
+}
+
+// testRawJSON decodes a raw JSON response
+func testRawJSON(t *testing.T, resp *logical.Response) (int, map[string]interface{}) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Data[logical.HTTPStatusCode].(int), doc
+}
+
+func TestBackend_provider(t *testing.T) {
+	b, storage := testBackend(t)
+
+	testRequest(t, b, storage, logical.CreateOperation, "oidc/key/default", nil)
+	testRequest(t, b, storage, logical.CreateOperation, "oidc/scope/team", map[string]interface{}{
+		"template":    `{"team": "{{identity.entity.metadata.team}}", "groups": "{{identity.entity.metadata.groups}}"}`,
+		"description": "Your team",
+	})
+	testRequest(t, b, storage, logical.CreateOperation, "oidc/client/app", map[string]interface{}{
+		"key":           "default",
+		"redirect_uris": "https://app.example.com/callback",
+		"id_token_ttl":  "30m",
+	})
+	client := testRequest(t, b, storage, logical.ReadOperation, "oidc/client/app", nil).Data
+	clientID, clientSecret := client["client_id"].(string), client["client_secret"].(string)
+	testRequest(t, b, storage, logical.CreateOperation, "oidc/provider/default", map[string]interface{}{
+		"allowed_client_ids": "*",
+		"scopes_supported":   "team",
+	})
+
+	issuer := testIssuer + "/issuer/default"
+	_, doc := testRawJSON(t, testRequest(t, b, storage, logical.ReadOperation, "oidc/issuer/default/.well-known/openid-configuration", nil))
+	if doc["issuer"] != issuer || doc["token_endpoint"] != issuer+"/token" || doc["authorization_endpoint"] != testIssuer+"/provider/default/authorize" {
+		t.Fatalf("bad discovery document: %v", doc)
+	}
+
+	authorize := map[string]interface{}{
+		"client_id":     clientID,
+		"redirect_uri":  "https://app.example.com/callback",
+		"response_type": "code",
+		"scope":         "openid team",
+		"state":         "xyz",
+		"nonce":         "n-0S6",
+	}
+	resp := testRequest(t, b, storage, logical.UpdateOperation, "oidc/provider/default/authorize", authorize)
+	if resp.Data["consent_required"] != true || resp.Data["client"] != "app" {
+		t.Fatalf("consent was not required: %#v", resp.Data)
+	}
+	authorize["consent"] = true
+	testRequest(t, b, storage, logical.UpdateOperation, "oidc/provider/default/authorize", authorize)
+
+	// Consent is only asked once
+	delete(authorize, "consent")
+	resp = testRequest(t, b, storage, logical.UpdateOperation, "oidc/provider/default/authorize", authorize)
+	code, _ := resp.Data["code"].(string)
+	if code == "" || resp.Data["state"] != "xyz" || !strings.HasPrefix(resp.Data["redirect_uri"].(string), "https://app.example.com/callback?code=") {
+		t.Fatalf("bad authorization: %#v", resp.Data)
+	}
+
+	exchange := func(secret string) *logical.Response {
+		form := url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {"https://app.example.com/callback"},
+			"client_id":     {clientID},
+			"client_secret": {secret},
+		}
+		return testRequest(t, b, storage, logical.UpdateOperation, "oidc/issuer/default/token", map[string]interface{}{
+			logical.HTTPContentType: "application/x-www-form-urlencoded",
+			logical.HTTPRawBody:     []byte(form.Encode()),
+		})
+	}
+
+	status, doc := testRawJSON(t, exchange("wrong"))
+	if status != http.StatusUnauthorized || doc["error"] != "invalid_client" {
+		t.Fatalf("bad secret was accepted: %d %v", status, doc)
+	}
+
+	status, doc = testRawJSON(t, exchange(clientSecret))
+	if status != http.StatusOK || doc["token_type"] != "Bearer" {
+		t.Fatalf("bad token response: %d %v", status, doc)
+	}
+	idToken := doc["id_token"].(string)
+	accessToken := doc["access_token"].(string)
+
+	keyID, err := tokenKeyID(idToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = testRequest(t, b, storage, logical.ReadOperation, "oidc/issuer/default/.well-known/keys", nil)
+	var jwks struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &jwks); err != nil {
+		t.Fatal(err)
+	}
+	if len(jwks.Keys) != 1 || jwks.Keys[0]["kid"] != keyID {
+		t.Fatalf("bad JWK set: %v", jwks.Keys)
+	}
+	claims := verifyWithJWK(t, idToken, jwks.Keys[0])
+	exp, iat := claims["exp"].(float64), claims["iat"].(float64)
+	delete(claims, "exp")
+	delete(claims, "iat")
+	expected := map[string]interface{}{
+		"iss":   issuer,
+		"sub":   "userpass-alice",
+		"aud":   clientID,
+		"nonce": "n-0S6",
+		"team":  "payments",
+	}
+	if !reflect.DeepEqual(claims, expected) || exp-iat != 1800 {
+		t.Fatalf("bad claims: %#v", claims)
+	}
+
+	// Codes can only be exchanged once
+	status, doc = testRawJSON(t, exchange(clientSecret))
+	if status != http.StatusBadRequest || doc["error"] != "invalid_grant" {
+		t.Fatalf("code was reused: %d %v", status, doc)
+	}
+
+	status, doc = testRawJSON(t, testRequest(t, b, storage, logical.UpdateOperation, "oidc/issuer/default/userinfo", map[string]interface{}{
+		"access_token": accessToken,
+	}))
+	if status != http.StatusOK || !reflect.DeepEqual(doc, map[string]interface{}{"sub": "userpass-alice", "team": "payments"}) {
+		t.Fatalf("bad userinfo: %d %v", status, doc)
+	}
+	status, doc = testRawJSON(t, testRequest(t, b, storage, logical.UpdateOperation, "oidc/issuer/default/userinfo", map[string]interface{}{
+		"access_token": "wrong",
+	}))
+	if status != http.StatusUnauthorized || doc["error"] != "invalid_token" {
+		t.Fatalf("bad access token was accepted: %d %v", status, doc)
+	}
+
+	// Keys and scopes in use cannot be deleted
+	testRequestError(t, b, storage, logical.DeleteOperation, "oidc/key/default", nil)
+	testRequestError(t, b, storage, logical.DeleteOperation, "oidc/scope/team", nil)
+	testRequestError(t, b, storage, logical.CreateOperation, "oidc/scope/openid", map[string]interface{}{
+		"template": `{}`,
+	})
+}
+
+func TestBackend_provider_childToken(t *testing.T) {
+	core, root, _, childToken := testCoreTokens(t, `path "identity/oidc/provider/*" { capabilities = ["update"] }`)
+	for _, step := range []struct {
+		path string
+		data map[string]interface{}
+	}{
+		{"identity/oidc/scope/user", map[string]interface{}{
+			"template": `{"username": "{{identity.entity.metadata.username}}"}`,
+		}},
+		{"identity/oidc/client/app", map[string]interface{}{
+			"key":           "default",
+			"redirect_uris": "https://app.example.com/callback",
+		}},
+		{"identity/oidc/provider/default", map[string]interface{}{
+			"allowed_client_ids": "*",
+			"scopes_supported":   "user",
+		}},
+	} {
+		testCoreRequest(t, core, root, logical.UpdateOperation, step.path, step.data)
+	}
+	client := testCoreRequest(t, core, root, logical.ReadOperation, "identity/oidc/client/app", nil).Data
+	clientID, clientSecret := client["client_id"].(string), client["client_secret"].(string)
+
+	// A child token carrying forged metadata authorizes the client as the
+	// user who logged in
+	resp := testCoreRequest(t, core, childToken, logical.UpdateOperation, "identity/oidc/provider/default/authorize", map[string]interface{}{
+		"client_id":     clientID,
+		"redirect_uri":  "https://app.example.com/callback",
+		"response_type": "code",
+		"scope":         "openid user",
+		"consent":       true,
+	})
+	code, _ := resp.Data["code"].(string)
+	if code == "" {
+		t.Fatalf("bad authorization: %#v", resp.Data)
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {"https://app.example.com/callback"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+	}
+	status, doc := testRawJSON(t, testCoreRequest(t, core, "", logical.UpdateOperation, "identity/oidc/issuer/default/token", map[string]interface{}{
+		logical.HTTPContentType: "application/x-www-form-urlencoded",
+		logical.HTTPRawBody:     []byte(form.Encode()),
+	}))
+	if status != http.StatusOK {
+		t.Fatalf("bad token response: %d %v", status, doc)
+	}
+
+	resp = testCoreRequest(t, core, "", logical.ReadOperation, "identity/oidc/issuer/default/.well-known/keys", nil)
+	var jwks struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &jwks); err != nil {
+		t.Fatal(err)
+	}
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("bad JWK set: %v", jwks.Keys)
+	}
+	claims := verifyWithJWK(t, doc["id_token"].(string), jwks.Keys[0])
+	if claims["sub"] != "userpass-alice" || claims["username"] != "alice" {
+		t.Fatalf("bad claims: %#v", claims)
+	}
+}
@@ -0,0 +1,269 @@
+package identity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+)
+
+// signingAlgorithms are the JWS algorithms supported by keys
+var signingAlgorithms = map[string]struct {
+	hash  crypto.Hash
+	curve elliptic.Curve
+}{
+	"RS256": {hash: crypto.SHA256},
+	"RS384": {hash: crypto.SHA384},
+	"RS512": {hash: crypto.SHA512},
+	"ES256": {hash: crypto.SHA256, curve: elliptic.P256()},
+	"ES384": {hash: crypto.SHA384, curve: elliptic.P384()},
+	"ES512": {hash: crypto.SHA512, curve: elliptic.P521()},
+}
+
+var errInvalidToken = errors.New("invalid token")
+
+// signingKey is a version of a named key. Its private key is stored in DER
+// form: PKCS#1 for RSA keys and SEC 1 for EC keys.
+type signingKey struct {
+	KeyID      string    `json:"key_id"`
+	Algorithm  string    `json:"algorithm"`
+	PrivateKey []byte    `json:"private_key"`
+	ExpireAt   time.Time `json:"expire_at"`
+}
+
+// generateSigningKey generates a new signing key for the algorithm
+func generateSigningKey(algorithm string) (*signingKey, error) {
+	alg, ok := signingAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+
+	var der []byte
+	if alg.curve == nil {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		der = x509.MarshalPKCS1PrivateKey(key)
+	} else {
+		key, err := ecdsa.GenerateKey(alg.curve, rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if der, err = x509.MarshalECPrivateKey(key); err != nil {
+			return nil, err
+		}
+	}
+
+	keyID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &signingKey{
+		KeyID:      keyID,
+		Algorithm:  algorithm,
+		PrivateKey: der,
+	}, nil
+}
+
+func (k *signingKey) privateKey() (crypto.Signer, error) {
+	if signingAlgorithms[k.Algorithm].curve == nil {
+		return x509.ParsePKCS1PrivateKey(k.PrivateKey)
+	}
+	return x509.ParseECPrivateKey(k.PrivateKey)
+}
+
+// sign returns the compact serialization of a JWT with the claims, signed
+// with the key
+func (k *signingKey) sign(claims map[string]interface{}) (string, error) {
+	priv, err := k.privateKey()
+	if err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(map[string]string{
+		"alg": k.Algorithm,
+		"kid": k.KeyID,
+		"typ": "JWT",
+	})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := encodeSegment(header) + "." + encodeSegment(payload)
+
+	hash := signingAlgorithms[k.Algorithm].hash
+	h := hash.New()
+	h.Write([]byte(signingInput))
+	digest := h.Sum(nil)
+
+	var sig []byte
+	switch priv := priv.(type) {
+	case *rsa.PrivateKey:
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, priv, hash, digest); err != nil {
+			return "", err
+		}
+	case *ecdsa.PrivateKey:
+		// JWS uses the fixed size concatenation of R and S rather than
+		// the ASN.1 encoding of crypto/ecdsa
+		r, s, err := ecdsa.Sign(rand.Reader, priv, digest)
+		if err != nil {
+			return "", err
+		}
+		size := curveByteSize(priv.Curve)
+		sig = make([]byte, 2*size)
+		copyPadded(sig[:size], r)
+		copyPadded(sig[size:], s)
+	}
+
+	return signingInput + "." + encodeSegment(sig), nil
+}
+
+// verify checks the signature of a compact JWT signed with the key, and
+// returns its claims
+func (k *signingKey) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+
+	priv, err := k.privateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := signingAlgorithms[k.Algorithm].hash
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	digest := h.Sum(nil)
+
+	switch pub := priv.Public().(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, hash, digest, sig); err != nil {
+			return nil, errInvalidToken
+		}
+	case *ecdsa.PublicKey:
+		size := curveByteSize(pub.Curve)
+		if len(sig) != 2*size {
+			return nil, errInvalidToken
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return nil, errInvalidToken
+		}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errInvalidToken
+	}
+
+	return claims, nil
+}
+
+// jsonWebKey is the public key of a signing key, as published in a JWK set
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+
+	// RSA public key
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC public key
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// jwk returns the public key of the signing key as a JWK
+func (k *signingKey) jwk() (*jsonWebKey, error) {
+	priv, err := k.privateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	jwk := &jsonWebKey{
+		KeyID:     k.KeyID,
+		Use:       "sig",
+		Algorithm: k.Algorithm,
+	}
+	switch pub := priv.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encodeSegment(pub.N.Bytes())
+		jwk.E = encodeSegment(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := curveByteSize(pub.Curve)
+		x := make([]byte, size)
+		y := make([]byte, size)
+		copyPadded(x, pub.X)
+		copyPadded(y, pub.Y)
+		jwk.KeyType = "EC"
+		jwk.Curve = pub.Curve.Params().Name
+		jwk.X = encodeSegment(x)
+		jwk.Y = encodeSegment(y)
+	}
+
+	return jwk, nil
+}
+
+// tokenKeyID returns the key ID in the header of a compact JWT
+func tokenKeyID(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errInvalidToken
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", errInvalidToken
+	}
+	var header struct {
+		KeyID string `json:"kid"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil || header.KeyID == "" {
+		return "", errInvalidToken
+	}
+	return header.KeyID, nil
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func curveByteSize(curve elliptic.Curve) int {
+	return (curve.Params().BitSize + 7) / 8
+}
+
+// copyPadded writes the big-endian bytes of n to the end of dst, which is
+// zero-filled
+func copyPadded(dst []byte, n *big.Int) {
+	b := n.Bytes()
+	copy(dst[len(dst)-len(b):], b)
+}
@@ -0,0 +1,273 @@
+package identity
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathListClients(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/client/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathClientList,
+		},
+
+		HelpSynopsis:    pathClientsHelpSyn,
+		HelpDescription: pathClientsHelpDesc,
+	}
+}
+
+func pathClients(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/client/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the client",
+			},
+
+			"key": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key signing the ID tokens of the client",
+			},
+
+			"redirect_uris": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Redirection URIs the client may request",
+			},
+
+			"id_token_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Default:     24 * 60 * 60,
+				Description: "Lifetime of the ID tokens",
+			},
+
+			"access_token_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Default:     24 * 60 * 60,
+				Description: "Lifetime of the access tokens of the userinfo endpoint",
+			},
+		},
+
+		ExistenceCheck: b.pathClientExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathClientRead,
+			logical.CreateOperation: b.pathClientWrite,
+			logical.UpdateOperation: b.pathClientWrite,
+			logical.DeleteOperation: b.pathClientDelete,
+		},
+
+		HelpSynopsis:    pathClientsHelpSyn,
+		HelpDescription: pathClientsHelpDesc,
+	}
+}
+
+func (b *backend) pathClientExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	client, err := readClient(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return client != nil, nil
+}
+
+func (b *backend) pathClientList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("oidc/client/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathClientRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	client, err := readClient(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"key":              client.Key,
+			"redirect_uris":    client.RedirectURIs,
+			"id_token_ttl":     int64(client.IDTokenTTL / time.Second),
+			"access_token_ttl": int64(client.AccessTokenTTL / time.Second),
+			"client_id":        client.ClientID,
+			"client_secret":    client.ClientSecret,
+		},
+	}, nil
+}
+
+func (b *backend) pathClientWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	// The key lock ensures the key cannot be deleted, or its verification
+	// TTL lowered, while the client is written
+	b.keyLock.Lock()
+	defer b.keyLock.Unlock()
+
+	name := d.Get("name").(string)
+	client, err := readClient(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		clientID, err := uuid.GenerateUUID()
+		if err != nil {
+			return nil, err
+		}
+		clientSecret, err := uuid.GenerateUUID()
+		if err != nil {
+			return nil, err
+		}
+		client = &clientEntry{
+			IDTokenTTL:     time.Duration(d.Get("id_token_ttl").(int)) * time.Second,
+			AccessTokenTTL: time.Duration(d.Get("access_token_ttl").(int)) * time.Second,
+			ClientID:       clientID,
+			ClientSecret:   clientSecret,
+		}
+	}
+
+	if v, ok := d.GetOk("key"); ok {
+		client.Key = v.(string)
+	}
+	if v, ok := d.GetOk("redirect_uris"); ok {
+		client.RedirectURIs = v.([]string)
+	}
+	if v, ok := d.GetOk("id_token_ttl"); ok {
+		client.IDTokenTTL = time.Duration(v.(int)) * time.Second
+	}
+	if v, ok := d.GetOk("access_token_ttl"); ok {
+		client.AccessTokenTTL = time.Duration(v.(int)) * time.Second
+	}
+
+	if client.Key == "" {
+		return logical.ErrorResponse("key is required"), nil
+	}
+	key, err := readKey(req.Storage, client.Key)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return logical.ErrorResponse(fmt.Sprintf("key %q not found", client.Key)), nil
+	}
+	if len(client.RedirectURIs) == 0 {
+		return logical.ErrorResponse("redirect_uris is required"), nil
+	}
+	for _, redirectURI := range client.RedirectURIs {
+		u, err := url.Parse(redirectURI)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return logical.ErrorResponse(fmt.Sprintf("redirect URI %q must be an absolute URI without fragment", redirectURI)), nil
+		}
+	}
+	if client.IDTokenTTL <= 0 || client.AccessTokenTTL <= 0 {
+		return logical.ErrorResponse("id_token_ttl and access_token_ttl must be positive"), nil
+	}
+	if client.IDTokenTTL > key.VerificationTTL {
+		return logical.ErrorResponse("id_token_ttl cannot be greater than the verification_ttl of the key"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("oidc/client/"+name, client)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathClientDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete("oidc/client/" + d.Get("name").(string)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func readClient(s logical.Storage, name string) (*clientEntry, error) {
+	entry, err := s.Get("oidc/client/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result clientEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// listClients returns all clients by name
+func listClients(s logical.Storage) (map[string]*clientEntry, error) {
+	names, err := s.List("oidc/client/")
+	if err != nil {
+		return nil, err
+	}
+
+	clients := make(map[string]*clientEntry)
+	for _, name := range names {
+		client, err := readClient(s, name)
+		if err != nil {
+			return nil, err
+		}
+		if client != nil {
+			clients[name] = client
+		}
+	}
+
+	return clients, nil
+}
+
+// clientByID returns the client with the client ID, and its name
+func clientByID(s logical.Storage, clientID string) (string, *clientEntry, error) {
+	clients, err := listClients(s)
+	if err != nil {
+		return "", nil, err
+	}
+	for name, client := range clients {
+		if client.ClientID == clientID {
+			return name, client, nil
+		}
+	}
+	return "", nil, nil
+}
+
+type clientEntry struct {
+	Key            string        `json:"key"`
+	RedirectURIs   []string      `json:"redirect_uris"`
+	IDTokenTTL     time.Duration `json:"id_token_ttl"`
+	AccessTokenTTL time.Duration `json:"access_token_ttl"`
+	ClientID       string        `json:"client_id"`
+	ClientSecret   string        `json:"client_secret"`
+}
+
+const pathClientsHelpSyn = `
+Manage the applications signing in with OIDC providers.
+`
+
+const pathClientsHelpDesc = `
+This path lets you manage the OIDC clients, which are the applications
+signing users in with the authorization code flow of providers. The
+"client_id" and "client_secret" of a client are generated when it is created.
+
+The redirection URI of an authorization request must be one of the
+"redirect_uris" of the client. ID tokens are signed with the "key" of the
+client.
+`
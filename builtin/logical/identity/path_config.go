@@ -0,0 +1,104 @@
+package identity
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const configKey = "oidc/config"
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/config",
+		Fields: map[string]*framework.FieldSchema{
+			"issuer": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Issuer of the tokens, which is the URL of the oidc path of this mount, such as https://vault.example.com:8200/v1/identity/oidc",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+func readConfig(s logical.Storage) (*oidcConfig, error) {
+	entry, err := s.Get(configKey)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	conf := &oidcConfig{}
+	if err := entry.DecodeJSON(conf); err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	conf, err := readConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if conf == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"issuer": conf.Issuer,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	issuer := strings.TrimSuffix(d.Get("issuer").(string), "/")
+	u, err := url.Parse(issuer)
+	if err != nil || u.Scheme != "https" && u.Scheme != "http" || u.Host == "" {
+		return logical.ErrorResponse("issuer must be a URL such as https://vault.example.com:8200/v1/identity/oidc"), nil
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return logical.ErrorResponse("issuer cannot have a query or fragment"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(configKey, &oidcConfig{
+		Issuer: issuer,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+type oidcConfig struct {
+	Issuer string `json:"issuer"`
+}
+
+const pathConfigHelpSyn = `
+Configure the issuer of identity tokens.
+`
+
+const pathConfigHelpDesc = `
+This path configures the issuer of identity tokens, which is the URL at which
+third parties reach the "oidc" path of this mount, such as
+"https://vault.example.com:8200/v1/identity/oidc". Third parties find the
+discovery document at "<issuer>/.well-known/openid-configuration".
+`
@@ -0,0 +1,434 @@
+package identity
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathProviderDiscovery(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/issuer/" + framework.GenericNameRegex("name") + "/.well-known/openid-configuration",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the provider",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathProviderDiscoveryRead,
+		},
+
+		HelpSynopsis:    pathDiscoveryHelpSyn,
+		HelpDescription: pathDiscoveryHelpDesc,
+	}
+}
+
+func pathProviderJWKS(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/issuer/" + framework.GenericNameRegex("name") + "/.well-known/keys",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the provider",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathProviderJWKSRead,
+		},
+
+		HelpSynopsis:    pathJWKSHelpSyn,
+		HelpDescription: pathJWKSHelpDesc,
+	}
+}
+
+func pathProviderToken(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/issuer/" + framework.GenericNameRegex("name") + "/token",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the provider",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathProviderToken,
+		},
+
+		HelpSynopsis:    pathProviderTokenHelpSyn,
+		HelpDescription: pathProviderTokenHelpDesc,
+	}
+}
+
+func pathProviderUserInfo(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/issuer/" + framework.GenericNameRegex("name") + "/userinfo",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the provider",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathProviderUserInfo,
+		},
+
+		HelpSynopsis:    pathProviderUserInfoHelpSyn,
+		HelpDescription: pathProviderUserInfoHelpDesc,
+	}
+}
+
+func (b *backend) pathProviderDiscoveryRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	provider, conf, errResp, err := readProviderAndConfig(req.Storage, name)
+	if errResp != nil || err != nil {
+		return errResp, err
+	}
+
+	issuer := providerIssuer(conf, name)
+	authorizationEndpoint := provider.AuthorizationEndpoint
+	if authorizationEndpoint == "" {
+		authorizationEndpoint = conf.Issuer + "/provider/" + name + "/authorize"
+	}
+
+	return rawJSONResponse(http.StatusOK, map[string]interface{}{
+		"issuer":                                issuer,
+		"jwks_uri":                              issuer + "/.well-known/keys",
+		"authorization_endpoint":                authorizationEndpoint,
+		"token_endpoint":                        issuer + "/token",
+		"userinfo_endpoint":                     issuer + "/userinfo",
+		"scopes_supported":                      append([]string{openIDScope}, provider.ScopesSupported...),
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": signingAlgorithmNames(),
+		"token_endpoint_auth_methods_supported": []string{"client_secret_post"},
+	})
+}
+
+func (b *backend) pathProviderJWKSRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	provider, _, errResp, err := readProviderAndConfig(req.Storage, d.Get("name").(string))
+	if errResp != nil || err != nil {
+		return errResp, err
+	}
+
+	b.keyLock.RLock()
+	defer b.keyLock.RUnlock()
+
+	// Only the keys of the clients of the provider are published
+	clients, err := listClients(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, client := range clients {
+		if provider.allowsClient(client.ClientID) && !seen[client.Key] {
+			seen[client.Key] = true
+			names = append(names, client.Key)
+		}
+	}
+
+	return jwksResponse(req.Storage, names)
+}
+
+func (b *backend) pathProviderToken(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	provider, conf, errResp, err := readProviderAndConfig(req.Storage, name)
+	if errResp != nil || err != nil {
+		return errResp, err
+	}
+
+	params, err := requestParams(req)
+	if err != nil {
+		return oauthError(http.StatusBadRequest, "invalid_request", err.Error())
+	}
+	if params.Get("grant_type") != "authorization_code" {
+		return oauthError(http.StatusBadRequest, "unsupported_grant_type", `grant_type must be "authorization_code"`)
+	}
+
+	clientID := params.Get("client_id")
+	_, client, err := clientByID(req.Storage, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil || subtle.ConstantTimeCompare([]byte(client.ClientSecret), []byte(params.Get("client_secret"))) != 1 {
+		return oauthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	}
+	if !provider.allowsClient(clientID) {
+		return oauthError(http.StatusBadRequest, "unauthorized_client", "client is not allowed to use the provider")
+	}
+
+	// Codes are exchanged once, so they are deleted under the lock before
+	// being used
+	codeKey := "oidc/code/" + subjectHash(params.Get("code"))
+	b.flowLock.Lock()
+	entry, err := req.Storage.Get(codeKey)
+	if err == nil && entry != nil {
+		err = req.Storage.Delete(codeKey)
+	}
+	b.flowLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return oauthError(http.StatusBadRequest, "invalid_grant", "invalid code")
+	}
+	var code authorizationCode
+	if err := entry.DecodeJSON(&code); err != nil {
+		return nil, err
+	}
+	if code.Provider != name || code.ClientID != clientID || code.RedirectURI != params.Get("redirect_uri") || time.Now().After(code.ExpireAt) {
+		return oauthError(http.StatusBadRequest, "invalid_grant", "invalid code")
+	}
+
+	claims, err := scopeClaims(req.Storage, code.Scopes, code.Entity)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	claims["iss"] = providerIssuer(conf, name)
+	claims["sub"] = code.Entity.Name
+	claims["aud"] = clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(client.IDTokenTTL).Unix()
+	if code.Nonce != "" {
+		claims["nonce"] = code.Nonce
+	}
+
+	b.keyLock.RLock()
+	key, err := readKey(req.Storage, client.Key)
+	var idToken string
+	if err == nil && key != nil && key.current() != nil {
+		idToken, err = key.current().sign(claims)
+	}
+	b.keyLock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if idToken == "" {
+		return nil, fmt.Errorf("key %q of client not found", client.Key)
+	}
+
+	accessToken, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	entry, err = logical.StorageEntryJSON("oidc/access-token/"+subjectHash(accessToken), &providerAccessToken{
+		Provider: name,
+		ClientID: clientID,
+		Scopes:   code.Scopes,
+		Entity:   code.Entity,
+		ExpireAt: now.Add(client.AccessTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return rawJSONResponse(http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int64(client.AccessTokenTTL / time.Second),
+		"id_token":     idToken,
+	})
+}
+
+func (b *backend) pathProviderUserInfo(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	_, _, errResp, err := readProviderAndConfig(req.Storage, name)
+	if errResp != nil || err != nil {
+		return errResp, err
+	}
+
+	params, err := requestParams(req)
+	if err != nil {
+		return oauthError(http.StatusBadRequest, "invalid_request", err.Error())
+	}
+
+	entry, err := req.Storage.Get("oidc/access-token/" + subjectHash(params.Get("access_token")))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return oauthError(http.StatusUnauthorized, "invalid_token", "invalid access token")
+	}
+	var token providerAccessToken
+	if err := entry.DecodeJSON(&token); err != nil {
+		return nil, err
+	}
+	if token.Provider != name || time.Now().After(token.ExpireAt) {
+		return oauthError(http.StatusUnauthorized, "invalid_token", "invalid access token")
+	}
+
+	claims, err := scopeClaims(req.Storage, token.Scopes, token.Entity)
+	if err != nil {
+		return nil, err
+	}
+	claims["sub"] = token.Entity.Name
+
+	return rawJSONResponse(http.StatusOK, claims)
+}
+
+// tidyProviderTokens deletes the expired authorization codes and access
+// tokens
+func (b *backend) tidyProviderTokens(s logical.Storage) error {
+	now := time.Now()
+	for _, prefix := range []string{"oidc/code/", "oidc/access-token/"} {
+		keys, err := s.List(prefix)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			entry, err := s.Get(prefix + key)
+			if err != nil {
+				return err
+			}
+			if entry == nil {
+				continue
+			}
+			var expiry struct {
+				ExpireAt time.Time `json:"expire_at"`
+			}
+			if err := entry.DecodeJSON(&expiry); err != nil {
+				return err
+			}
+			if now.After(expiry.ExpireAt) {
+				if err := s.Delete(prefix + key); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// scopeClaims returns the claims of the scopes for the entity. Claims whose
+// metadata is not set on the entity are omitted.
+func scopeClaims(s logical.Storage, scopes []string, entity *logical.Entity) (map[string]interface{}, error) {
+	claims := make(map[string]interface{})
+	for _, scopeName := range scopes {
+		if scopeName == openIDScope {
+			continue
+		}
+		scope, err := readScope(s, scopeName)
+		if err != nil {
+			return nil, err
+		}
+		if scope == nil {
+			continue
+		}
+		template, err := parseTemplate(scope.Template)
+		if err != nil {
+			return nil, err
+		}
+		for claim, value := range template {
+			populated, err := populateClaim(entity, value)
+			if err != nil {
+				continue
+			}
+			claims[claim] = populated
+		}
+	}
+	return claims, nil
+}
+
+// readProviderAndConfig returns the provider and the configuration, or an
+// error response if either does not exist
+func readProviderAndConfig(s logical.Storage, name string) (*providerEntry, *oidcConfig, *logical.Response, error) {
+	provider, err := readProvider(s, name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if provider == nil {
+		resp, err := oauthError(http.StatusNotFound, "invalid_request", fmt.Sprintf("provider %q not found", name))
+		return nil, nil, resp, err
+	}
+
+	conf, err := readConfig(s)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if conf == nil {
+		resp, err := oauthError(http.StatusInternalServerError, "server_error", "the issuer is not configured")
+		return nil, nil, resp, err
+	}
+
+	return provider, conf, nil, nil
+}
+
+// requestParams returns the parameters of a request to an OAuth endpoint,
+// sent either form-encoded, as the protocol requires, or as JSON
+func requestParams(req *logical.Request) (url.Values, error) {
+	if body, ok := req.Data[logical.HTTPRawBody].([]byte); ok {
+		contentType, _ := req.Data[logical.HTTPContentType].(string)
+		if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/x-www-form-urlencoded" {
+			return nil, fmt.Errorf("unsupported content type %q", contentType)
+		}
+		return url.ParseQuery(string(body))
+	}
+
+	params := url.Values{}
+	for k, v := range req.Data {
+		if s, ok := v.(string); ok {
+			params.Set(k, s)
+		}
+	}
+	return params, nil
+}
+
+// oauthError returns an OAuth 2.0 error response
+func oauthError(status int, code, description string) (*logical.Response, error) {
+	return rawJSONResponse(status, map[string]interface{}{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// providerAccessToken is an access token to the userinfo endpoint of a
+// provider
+type providerAccessToken struct {
+	Provider string          `json:"provider"`
+	ClientID string          `json:"client_id"`
+	Scopes   []string        `json:"scopes"`
+	Entity   *logical.Entity `json:"entity"`
+	ExpireAt time.Time       `json:"expire_at"`
+}
+
+const pathProviderTokenHelpSyn = `
+Exchange an authorization code for an ID token.
+`
+
+const pathProviderTokenHelpDesc = `
+This unauthenticated path implements the token endpoint of the authorization
+code flow. Clients authenticate with the "client_id" and "client_secret"
+parameters, and exchange the "code" for an ID token and an access token to
+the userinfo endpoint. Parameters can be form-encoded or JSON.
+`
+
+const pathProviderUserInfoHelpSyn = `
+Read the claims of the user of an access token.
+`
+
+const pathProviderUserInfoHelpDesc = `
+This unauthenticated path implements the userinfo endpoint, returning the
+claims of the scopes granted to the "access_token" parameter. Parameters can
+be form-encoded or JSON.
+`
@@ -0,0 +1,393 @@
+package identity
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathListKeys(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/key/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathKeyList,
+		},
+
+		HelpSynopsis:    pathKeysHelpSyn,
+		HelpDescription: pathKeysHelpDesc,
+	}
+}
+
+func pathKeys(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/key/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"algorithm": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     "RS256",
+				Description: "Signing algorithm of the key: RS256, RS384, RS512, ES256, ES384 or ES512",
+			},
+
+			"rotation_period": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Default:     24 * 60 * 60,
+				Description: "How often the key is rotated",
+			},
+
+			"verification_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Default:     24 * 60 * 60,
+				Description: "How long the public key remains published after it is rotated, which must cover the ttl of the roles using the key",
+			},
+		},
+
+		ExistenceCheck: b.pathKeyExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathKeyRead,
+			logical.CreateOperation: b.pathKeyWrite,
+			logical.UpdateOperation: b.pathKeyWrite,
+			logical.DeleteOperation: b.pathKeyDelete,
+		},
+
+		HelpSynopsis:    pathKeysHelpSyn,
+		HelpDescription: pathKeysHelpDesc,
+	}
+}
+
+func pathRotateKey(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/key/" + framework.GenericNameRegex("name") + "/rotate",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathKeyRotate,
+		},
+
+		HelpSynopsis:    pathRotateKeyHelpSyn,
+		HelpDescription: pathRotateKeyHelpDesc,
+	}
+}
+
+func (b *backend) pathKeyExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	key, err := readKey(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return key != nil, nil
+}
+
+func (b *backend) pathKeyList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("oidc/key/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathKeyRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.keyLock.RLock()
+	defer b.keyLock.RUnlock()
+
+	key, err := readKey(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"algorithm":        key.Algorithm,
+			"rotation_period":  int64(key.RotationPeriod / time.Second),
+			"verification_ttl": int64(key.VerificationTTL / time.Second),
+			"next_rotation":    key.NextRotation,
+		},
+	}, nil
+}
+
+func (b *backend) pathKeyWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.keyLock.Lock()
+	defer b.keyLock.Unlock()
+
+	name := d.Get("name").(string)
+	key, err := readKey(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		key = &keyEntry{
+			Algorithm:       d.Get("algorithm").(string),
+			RotationPeriod:  time.Duration(d.Get("rotation_period").(int)) * time.Second,
+			VerificationTTL: time.Duration(d.Get("verification_ttl").(int)) * time.Second,
+		}
+	}
+
+	// Changing the algorithm rotates the key immediately
+	rotate := len(key.Keys) == 0
+	if v, ok := d.GetOk("algorithm"); ok && v.(string) != key.Algorithm {
+		key.Algorithm = v.(string)
+		rotate = true
+	}
+	if v, ok := d.GetOk("rotation_period"); ok {
+		key.RotationPeriod = time.Duration(v.(int)) * time.Second
+		key.NextRotation = time.Now().Add(key.RotationPeriod)
+	}
+	if v, ok := d.GetOk("verification_ttl"); ok {
+		key.VerificationTTL = time.Duration(v.(int)) * time.Second
+	}
+
+	if _, ok := signingAlgorithms[key.Algorithm]; !ok {
+		return logical.ErrorResponse(fmt.Sprintf("unsupported algorithm %q", key.Algorithm)), nil
+	}
+	if key.RotationPeriod < time.Minute {
+		return logical.ErrorResponse("rotation_period must be at least one minute"), nil
+	}
+
+	// The tokens of the roles and clients using the key must remain
+	// verifiable after it is rotated
+	roles, err := rolesUsingKey(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	for roleName, role := range roles {
+		if role.TTL > key.VerificationTTL {
+			return logical.ErrorResponse(fmt.Sprintf("verification_ttl cannot be lower than the ttl of role %q", roleName)), nil
+		}
+	}
+	clients, err := listClients(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	for clientName, client := range clients {
+		if client.Key == name && client.IDTokenTTL > key.VerificationTTL {
+			return logical.ErrorResponse(fmt.Sprintf("verification_ttl cannot be lower than the id_token_ttl of client %q", clientName)), nil
+		}
+	}
+
+	if rotate {
+		if err := key.rotate(time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	if err := storeKey(req.Storage, name, key); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathKeyDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.keyLock.Lock()
+	defer b.keyLock.Unlock()
+
+	name := d.Get("name").(string)
+	roles, err := rolesUsingKey(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) != 0 {
+		names := make([]string, 0, len(roles))
+		for roleName := range roles {
+			names = append(names, roleName)
+		}
+		return logical.ErrorResponse(fmt.Sprintf("key is used by roles: %s", strings.Join(names, ", "))), nil
+	}
+	clients, err := listClients(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	for clientName, client := range clients {
+		if client.Key == name {
+			return logical.ErrorResponse(fmt.Sprintf("key is used by client %q", clientName)), nil
+		}
+	}
+
+	if err := req.Storage.Delete("oidc/key/" + name); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathKeyRotate(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.keyLock.Lock()
+	defer b.keyLock.Unlock()
+
+	name := d.Get("name").(string)
+	key, err := readKey(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return logical.ErrorResponse(fmt.Sprintf("key %q not found", name)), nil
+	}
+
+	if err := key.rotate(time.Now()); err != nil {
+		return nil, err
+	}
+	if err := storeKey(req.Storage, name, key); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// rotateKeys rotates the keys whose rotation period has elapsed, and removes
+// the expired versions of all keys
+func (b *backend) rotateKeys(s logical.Storage) error {
+	b.keyLock.Lock()
+	defer b.keyLock.Unlock()
+
+	names, err := s.List("oidc/key/")
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, name := range names {
+		key, err := readKey(s, name)
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			continue
+		}
+
+		switch {
+		case now.After(key.NextRotation):
+			err = key.rotate(now)
+		case key.prune(now):
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := storeKey(s, name, key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readKey(s logical.Storage, name string) (*keyEntry, error) {
+	entry, err := s.Get("oidc/key/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result keyEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func storeKey(s logical.Storage, name string, key *keyEntry) error {
+	entry, err := logical.StorageEntryJSON("oidc/key/"+name, key)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+type keyEntry struct {
+	Algorithm       string        `json:"algorithm"`
+	RotationPeriod  time.Duration `json:"rotation_period"`
+	VerificationTTL time.Duration `json:"verification_ttl"`
+	NextRotation    time.Time     `json:"next_rotation"`
+
+	// Keys are the versions of the key which are still published, starting
+	// with the current one
+	Keys []*signingKey `json:"keys"`
+}
+
+// current returns the version of the key used for signing
+func (k *keyEntry) current() *signingKey {
+	if len(k.Keys) == 0 {
+		return nil
+	}
+	return k.Keys[0]
+}
+
+// rotate generates a new version of the key. The previous version remains
+// published for the verification TTL.
+func (k *keyEntry) rotate(now time.Time) error {
+	next, err := generateSigningKey(k.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	if current := k.current(); current != nil {
+		current.ExpireAt = now.Add(k.VerificationTTL)
+	}
+	k.Keys = append([]*signingKey{next}, k.Keys...)
+	k.NextRotation = now.Add(k.RotationPeriod)
+	k.prune(now)
+
+	return nil
+}
+
+// prune removes the expired versions of the key, returning whether any
+// was removed
+func (k *keyEntry) prune(now time.Time) bool {
+	keys := k.Keys[:0]
+	for _, key := range k.Keys {
+		if key.ExpireAt.IsZero() || now.Before(key.ExpireAt) {
+			keys = append(keys, key)
+		}
+	}
+	pruned := len(keys) != len(k.Keys)
+	k.Keys = keys
+	return pruned
+}
+
+const pathKeysHelpSyn = `
+Manage the keys used to sign identity tokens.
+`
+
+const pathKeysHelpDesc = `
+This path lets you manage the named keys used to sign identity tokens.
+
+Keys are rotated every "rotation_period". After a rotation, the public part
+of the previous version is still published for "verification_ttl", so the
+tokens it signed can be verified until they expire. A key cannot be deleted
+while roles use it.
+`
+
+const pathRotateKeyHelpSyn = `
+Rotate a key used to sign identity tokens.
+`
+
+const pathRotateKeyHelpDesc = `
+This path generates a new version of the key, which signs new tokens. The
+previous version is still published for the "verification_ttl" of the key.
+`
@@ -0,0 +1,478 @@
+package identity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	// openIDScope is the scope every authorization request must include
+	openIDScope = "openid"
+
+	// authorizationCodeTTL is how long authorization codes can be exchanged
+	authorizationCodeTTL = 5 * time.Minute
+)
+
+func pathListProviders(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/provider/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathProviderList,
+		},
+
+		HelpSynopsis:    pathProvidersHelpSyn,
+		HelpDescription: pathProvidersHelpDesc,
+	}
+}
+
+func pathProviders(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/provider/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the provider",
+			},
+
+			"allowed_client_ids": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Client IDs of the clients which can use the provider, or "*" for all clients`,
+			},
+
+			"scopes_supported": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Scopes clients can request, in addition to "openid"`,
+			},
+
+			"authorization_endpoint": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "URL of the page signing users in to Vault and calling the authorize endpoint, advertised to clients. Defaults to the authorize endpoint.",
+			},
+		},
+
+		ExistenceCheck: b.pathProviderExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathProviderRead,
+			logical.CreateOperation: b.pathProviderWrite,
+			logical.UpdateOperation: b.pathProviderWrite,
+			logical.DeleteOperation: b.pathProviderDelete,
+		},
+
+		HelpSynopsis:    pathProvidersHelpSyn,
+		HelpDescription: pathProvidersHelpDesc,
+	}
+}
+
+func pathAuthorize(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/provider/" + framework.GenericNameRegex("name") + "/authorize",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the provider",
+			},
+
+			"client_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Client ID of the client",
+			},
+
+			"redirect_uri": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Redirection URI of the client",
+			},
+
+			"response_type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Must be "code"`,
+			},
+
+			"scope": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Space-separated scopes, which must include "openid"`,
+			},
+
+			"state": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Opaque value returned to the client",
+			},
+
+			"nonce": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Value added to the ID token",
+			},
+
+			"prompt": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Set to "consent" to ask for consent even if it was given before`,
+			},
+
+			"consent": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: "Whether the user consents to the client receiving the requested scopes",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathAuthorize,
+			logical.UpdateOperation: b.pathAuthorize,
+		},
+
+		HelpSynopsis:    pathAuthorizeHelpSyn,
+		HelpDescription: pathAuthorizeHelpDesc,
+	}
+}
+
+func (b *backend) pathProviderExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	provider, err := readProvider(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return provider != nil, nil
+}
+
+func (b *backend) pathProviderList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("oidc/provider/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathProviderRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	provider, err := readProvider(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return nil, nil
+	}
+
+	data := map[string]interface{}{
+		"allowed_client_ids":     provider.AllowedClientIDs,
+		"scopes_supported":       provider.ScopesSupported,
+		"authorization_endpoint": provider.AuthorizationEndpoint,
+	}
+	conf, err := readConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if conf != nil {
+		data["issuer"] = providerIssuer(conf, name)
+	}
+
+	return &logical.Response{
+		Data: data,
+	}, nil
+}
+
+func (b *backend) pathProviderWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	provider, err := readProvider(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		provider = &providerEntry{}
+	}
+
+	if v, ok := d.GetOk("allowed_client_ids"); ok {
+		provider.AllowedClientIDs = v.([]string)
+	}
+	if v, ok := d.GetOk("scopes_supported"); ok {
+		provider.ScopesSupported = v.([]string)
+	}
+	if v, ok := d.GetOk("authorization_endpoint"); ok {
+		provider.AuthorizationEndpoint = v.(string)
+	}
+
+	for _, scopeName := range provider.ScopesSupported {
+		if scopeName == openIDScope {
+			continue
+		}
+		scope, err := readScope(req.Storage, scopeName)
+		if err != nil {
+			return nil, err
+		}
+		if scope == nil {
+			return logical.ErrorResponse(fmt.Sprintf("scope %q not found", scopeName)), nil
+		}
+	}
+	if provider.AuthorizationEndpoint != "" {
+		if u, err := url.Parse(provider.AuthorizationEndpoint); err != nil || !u.IsAbs() {
+			return logical.ErrorResponse("authorization_endpoint must be an absolute URL"), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("oidc/provider/"+name, provider)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathProviderDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete("oidc/provider/" + d.Get("name").(string)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathAuthorize(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	provider, err := readProvider(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		return logical.ErrorResponse(fmt.Sprintf("provider %q not found", name)), nil
+	}
+	if req.Entity == nil || req.Entity.Name == "" {
+		return logical.ErrorResponse("the request has no identity to authorize"), nil
+	}
+
+	clientID := d.Get("client_id").(string)
+	clientName, client, err := clientByID(req.Storage, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil || !provider.allowsClient(clientID) {
+		return logical.ErrorResponse("invalid client_id"), nil
+	}
+	redirectURI := d.Get("redirect_uri").(string)
+	if !strutil.StrListContains(client.RedirectURIs, redirectURI) {
+		return logical.ErrorResponse("redirect_uri is not registered for the client"), nil
+	}
+	if d.Get("response_type").(string) != "code" {
+		return logical.ErrorResponse(`response_type must be "code"`), nil
+	}
+
+	scopes := strutil.RemoveDuplicates(strings.Fields(d.Get("scope").(string)), false)
+	if !strutil.StrListContains(scopes, openIDScope) {
+		return logical.ErrorResponse(`scope must include "openid"`), nil
+	}
+	for _, scope := range scopes {
+		if !provider.supportsScope(scope) {
+			return logical.ErrorResponse(fmt.Sprintf("scope %q is not supported by the provider", scope)), nil
+		}
+	}
+
+	// The user consents once to each client receiving its scopes, unless
+	// the client asks for consent again
+	consentKey := fmt.Sprintf("oidc/consent/%s/%s/%s", name, clientID, subjectHash(req.Entity.Name))
+	consent, err := readConsent(req.Storage, consentKey)
+	if err != nil {
+		return nil, err
+	}
+	consented := d.Get("prompt").(string) != "consent" && consent != nil && strutil.StrListSubset(consent.Scopes, scopes)
+	if !consented {
+		if !d.Get("consent").(bool) {
+			descriptions := make(map[string]interface{}, len(scopes))
+			for _, scopeName := range scopes {
+				scope, err := readScope(req.Storage, scopeName)
+				if err != nil {
+					return nil, err
+				}
+				if scope != nil {
+					descriptions[scopeName] = scope.Description
+				}
+			}
+			return &logical.Response{
+				Data: map[string]interface{}{
+					"consent_required": true,
+					"client":           clientName,
+					"scopes":           descriptions,
+				},
+			}, nil
+		}
+
+		if consent == nil {
+			consent = &consentEntry{}
+		}
+		consent.Scopes = strutil.RemoveDuplicates(append(consent.Scopes, scopes...), false)
+		entry, err := logical.StorageEntryJSON(consentKey, consent)
+		if err != nil {
+			return nil, err
+		}
+		if err := req.Storage.Put(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	code, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := logical.StorageEntryJSON("oidc/code/"+subjectHash(code), &authorizationCode{
+		Provider:    name,
+		ClientID:    clientID,
+		RedirectURI: redirectURI,
+		Scopes:      scopes,
+		Nonce:       d.Get("nonce").(string),
+		Entity:      req.Entity,
+		ExpireAt:    time.Now().Add(authorizationCodeTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	// The redirection URI may already have a query
+	redirect, err := url.Parse(redirectURI)
+	if err != nil {
+		return nil, err
+	}
+	query := redirect.Query()
+	query.Set("code", code)
+	if state := d.Get("state").(string); state != "" {
+		query.Set("state", state)
+	}
+	redirect.RawQuery = query.Encode()
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"code":         code,
+			"state":        d.Get("state").(string),
+			"redirect_uri": redirect.String(),
+		},
+	}, nil
+}
+
+func readProvider(s logical.Storage, name string) (*providerEntry, error) {
+	entry, err := s.Get("oidc/provider/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result providerEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func readConsent(s logical.Storage, key string) (*consentEntry, error) {
+	entry, err := s.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result consentEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// providerIssuer returns the issuer of a provider, under which its public
+// endpoints are served
+func providerIssuer(conf *oidcConfig, name string) string {
+	return conf.Issuer + "/issuer/" + name
+}
+
+// subjectHash returns the hash of a value used in a storage key, so that
+// secrets and arbitrary names are not stored in keys
+func subjectHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+type providerEntry struct {
+	AllowedClientIDs      []string `json:"allowed_client_ids"`
+	ScopesSupported       []string `json:"scopes_supported"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+}
+
+func (p *providerEntry) allowsClient(clientID string) bool {
+	return strutil.StrListContains(p.AllowedClientIDs, "*") ||
+		strutil.StrListContains(p.AllowedClientIDs, clientID)
+}
+
+func (p *providerEntry) supportsScope(scope string) bool {
+	return scope == openIDScope || strutil.StrListContains(p.ScopesSupported, scope)
+}
+
+// consentEntry records the scopes a user consented to a client receiving
+type consentEntry struct {
+	Scopes []string `json:"scopes"`
+}
+
+// authorizationCode is an authorization code, which the client exchanges
+// once for an ID token and an access token
+type authorizationCode struct {
+	Provider    string          `json:"provider"`
+	ClientID    string          `json:"client_id"`
+	RedirectURI string          `json:"redirect_uri"`
+	Scopes      []string        `json:"scopes"`
+	Nonce       string          `json:"nonce"`
+	Entity      *logical.Entity `json:"entity"`
+	ExpireAt    time.Time       `json:"expire_at"`
+}
+
+const pathProvidersHelpSyn = `
+Manage the OIDC providers apps sign users in with.
+`
+
+const pathProvidersHelpDesc = `
+This path lets you manage OIDC providers, which let apps sign users in with
+Vault using the authorization code flow. A provider lists the clients which
+can use it and the scopes they can request.
+
+The public endpoints of a provider are served under its issuer,
+"<oidc/config issuer>/issuer/<name>", including its discovery document at
+"<issuer>/.well-known/openid-configuration".
+
+Users are signed in by the "oidc/provider/<name>/authorize" endpoint, which
+requires a Vault token, so access to a provider is controlled by the policies
+granting access to that endpoint. As browsers cannot call it directly,
+"authorization_endpoint" sets the page advertised to clients, which signs the
+user in to Vault and calls the endpoint.
+`
+
+const pathAuthorizeHelpSyn = `
+Authorize a client to sign in the requesting user.
+`
+
+const pathAuthorizeHelpDesc = `
+This path implements the authorization endpoint of the authorization code
+flow, for the user of the Vault token of the request. It returns the code,
+and the redirection URI with the code and state the user agent is sent back
+to.
+
+If the user has not yet consented to the client receiving the requested
+scopes, "consent_required" is returned with the descriptions of the scopes,
+and the request must be repeated with "consent" set once the user agrees.
+`
@@ -0,0 +1,262 @@
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// reservedClaims are set by the backend and cannot be templated
+var reservedClaims = []string{"iss", "sub", "aud", "exp", "iat", "nbf", "jti"}
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/role/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    pathRolesHelpSyn,
+		HelpDescription: pathRolesHelpDesc,
+	}
+}
+
+func pathRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/role/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role",
+			},
+
+			"key": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key signing the tokens",
+			},
+
+			"template": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `JSON object of additional claims, whose string values can use identity templates such as "{{identity.entity.metadata.team}}"`,
+			},
+
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Default:     24 * 60 * 60,
+				Description: "Lifetime of the tokens",
+			},
+		},
+
+		ExistenceCheck: b.pathRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.CreateOperation: b.pathRoleWrite,
+			logical.UpdateOperation: b.pathRoleWrite,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    pathRolesHelpSyn,
+		HelpDescription: pathRolesHelpDesc,
+	}
+}
+
+func (b *backend) pathRoleExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	role, err := readRole(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return role != nil, nil
+}
+
+func (b *backend) pathRoleList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("oidc/role/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathRoleRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := readRole(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"key":       role.Key,
+			"template":  role.Template,
+			"ttl":       int64(role.TTL / time.Second),
+			"client_id": role.ClientID,
+		},
+	}, nil
+}
+
+func (b *backend) pathRoleWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	// The key lock ensures the key cannot be deleted, or its verification
+	// TTL lowered, while the role is written
+	b.keyLock.Lock()
+	defer b.keyLock.Unlock()
+
+	name := d.Get("name").(string)
+	role, err := readRole(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		// The client ID is the audience of the tokens, and identifies the
+		// role to third parties
+		clientID, err := uuid.GenerateUUID()
+		if err != nil {
+			return nil, err
+		}
+		role = &roleEntry{
+			TTL:      time.Duration(d.Get("ttl").(int)) * time.Second,
+			ClientID: clientID,
+		}
+	}
+
+	if v, ok := d.GetOk("key"); ok {
+		role.Key = v.(string)
+	}
+	if v, ok := d.GetOk("template"); ok {
+		role.Template = v.(string)
+	}
+	if v, ok := d.GetOk("ttl"); ok {
+		role.TTL = time.Duration(v.(int)) * time.Second
+	}
+
+	if role.Key == "" {
+		return logical.ErrorResponse("key is required"), nil
+	}
+	key, err := readKey(req.Storage, role.Key)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return logical.ErrorResponse(fmt.Sprintf("key %q not found", role.Key)), nil
+	}
+	if role.TTL <= 0 {
+		return logical.ErrorResponse("ttl must be positive"), nil
+	}
+	if role.TTL > key.VerificationTTL {
+		return logical.ErrorResponse("ttl cannot be greater than the verification_ttl of the key"), nil
+	}
+	if _, err := parseTemplate(role.Template); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("oidc/role/"+name, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathRoleDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete("oidc/role/" + d.Get("name").(string)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func readRole(s logical.Storage, name string) (*roleEntry, error) {
+	entry, err := s.Get("oidc/role/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result roleEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// rolesUsingKey returns the roles signing their tokens with the key
+func rolesUsingKey(s logical.Storage, keyName string) (map[string]*roleEntry, error) {
+	names, err := s.List("oidc/role/")
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string]*roleEntry)
+	for _, name := range names {
+		role, err := readRole(s, name)
+		if err != nil {
+			return nil, err
+		}
+		if role != nil && role.Key == keyName {
+			roles[name] = role
+		}
+	}
+
+	return roles, nil
+}
+
+// parseTemplate parses the claims template of a role
+func parseTemplate(template string) (map[string]interface{}, error) {
+	claims := make(map[string]interface{})
+	if template == "" {
+		return claims, nil
+	}
+
+	if err := json.Unmarshal([]byte(template), &claims); err != nil {
+		return nil, fmt.Errorf("template must be a JSON object: %s", err)
+	}
+	for _, claim := range reservedClaims {
+		if _, ok := claims[claim]; ok {
+			return nil, fmt.Errorf("template cannot set the reserved claim %q", claim)
+		}
+	}
+
+	return claims, nil
+}
+
+type roleEntry struct {
+	Key      string        `json:"key"`
+	Template string        `json:"template"`
+	TTL      time.Duration `json:"ttl"`
+	ClientID string        `json:"client_id"`
+}
+
+const pathRolesHelpSyn = `
+Manage the roles used to issue identity tokens.
+`
+
+const pathRolesHelpDesc = `
+This path lets you manage the roles used to issue identity tokens. A role
+sets the key signing its tokens, their lifetime and their additional claims.
+
+The "template" is a JSON object of claims added to the tokens. Its string
+values can use the "{{identity.entity.name}}" and
+"{{identity.entity.metadata.<key>}}" templates, which are replaced with the
+name and metadata of the requesting client. Claims whose metadata is not set
+on the client are omitted.
+
+The "client_id" of a role is generated when the role is created, and is the
+audience of its tokens.
+`
@@ -0,0 +1,188 @@
+package identity
+
+import (
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathListScopes(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/scope/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathScopeList,
+		},
+
+		HelpSynopsis:    pathScopesHelpSyn,
+		HelpDescription: pathScopesHelpDesc,
+	}
+}
+
+func pathScopes(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/scope/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the scope",
+			},
+
+			"template": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `JSON object of the claims of the scope, whose string values can use identity templates such as "{{identity.entity.metadata.email}}", populated from the entity the token of the user was issued to`,
+			},
+
+			"description": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Description of the scope, shown when asking for consent",
+			},
+		},
+
+		ExistenceCheck: b.pathScopeExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathScopeRead,
+			logical.CreateOperation: b.pathScopeWrite,
+			logical.UpdateOperation: b.pathScopeWrite,
+			logical.DeleteOperation: b.pathScopeDelete,
+		},
+
+		HelpSynopsis:    pathScopesHelpSyn,
+		HelpDescription: pathScopesHelpDesc,
+	}
+}
+
+func (b *backend) pathScopeExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	scope, err := readScope(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return scope != nil, nil
+}
+
+func (b *backend) pathScopeList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("oidc/scope/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathScopeRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	scope, err := readScope(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if scope == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"template":    scope.Template,
+			"description": scope.Description,
+		},
+	}, nil
+}
+
+func (b *backend) pathScopeWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == openIDScope {
+		return logical.ErrorResponse(`the "openid" scope is built in`), nil
+	}
+
+	scope, err := readScope(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if scope == nil {
+		scope = &scopeEntry{}
+	}
+
+	if v, ok := d.GetOk("template"); ok {
+		scope.Template = v.(string)
+	}
+	if v, ok := d.GetOk("description"); ok {
+		scope.Description = v.(string)
+	}
+
+	if _, err := parseTemplate(scope.Template); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("oidc/scope/"+name, scope)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathScopeDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	// Providers supporting the scope would advertise a scope which no
+	// longer exists
+	providers, err := req.Storage.List("oidc/provider/")
+	if err != nil {
+		return nil, err
+	}
+	for _, providerName := range providers {
+		provider, err := readProvider(req.Storage, providerName)
+		if err != nil {
+			return nil, err
+		}
+		if provider != nil && provider.supportsScope(name) {
+			return logical.ErrorResponse("scope is supported by provider " + providerName), nil
+		}
+	}
+
+	if err := req.Storage.Delete("oidc/scope/" + name); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func readScope(s logical.Storage, name string) (*scopeEntry, error) {
+	entry, err := s.Get("oidc/scope/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result scopeEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+type scopeEntry struct {
+	Template    string `json:"template"`
+	Description string `json:"description"`
+}
+
+const pathScopesHelpSyn = `
+Manage the scopes of OIDC providers.
+`
+
+const pathScopesHelpDesc = `
+This path lets you manage the scopes OIDC clients can request from providers.
+The "template" of a scope is a JSON object of the claims added to ID tokens
+and userinfo responses when the scope is granted, using the same identity
+templates as roles. The "openid" scope is built in and required by every
+authorization request.
+`
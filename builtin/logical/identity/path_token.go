@@ -0,0 +1,264 @@
+package identity
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/helper/identitytpl"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathToken(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/token/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathTokenRead,
+		},
+
+		HelpSynopsis:    pathTokenHelpSyn,
+		HelpDescription: pathTokenHelpDesc,
+	}
+}
+
+func pathIntrospect(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/introspect/?$",
+		Fields: map[string]*framework.FieldSchema{
+			"token": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Identity token to verify",
+			},
+
+			"client_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Client ID the token must be issued for. Optional.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathIntrospect,
+		},
+
+		HelpSynopsis:    pathIntrospectHelpSyn,
+		HelpDescription: pathIntrospectHelpDesc,
+	}
+}
+
+func (b *backend) pathTokenRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	role, err := readRole(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %q not found", name)), nil
+	}
+	if req.Entity == nil || req.Entity.Name == "" {
+		return logical.ErrorResponse("the request has no identity to issue a token for"), nil
+	}
+
+	conf, err := readConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if conf == nil {
+		return logical.ErrorResponse("the issuer is not configured; please configure it at the 'oidc/config' endpoint"), nil
+	}
+
+	claims, err := parseTemplate(role.Template)
+	if err != nil {
+		return nil, err
+	}
+	for claim, value := range claims {
+		populated, err := populateClaim(req.Entity, value)
+		switch {
+		case err == identitytpl.ErrTemplateValueNotFound:
+			delete(claims, claim)
+		case err != nil:
+			return logical.ErrorResponse(fmt.Sprintf("error templating claim %q: %s", claim, err)), nil
+		default:
+			claims[claim] = populated
+		}
+	}
+
+	now := time.Now()
+	claims["iss"] = conf.Issuer
+	claims["sub"] = req.Entity.Name
+	claims["aud"] = role.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(role.TTL).Unix()
+
+	b.keyLock.RLock()
+	defer b.keyLock.RUnlock()
+
+	key, err := readKey(req.Storage, role.Key)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || key.current() == nil {
+		return nil, fmt.Errorf("key %q of role %q not found", role.Key, name)
+	}
+
+	token, err := key.current().sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"token":     token,
+			"client_id": role.ClientID,
+			"ttl":       int64(role.TTL / time.Second),
+		},
+	}, nil
+}
+
+// populateClaim replaces the identity templates in the string values of a
+// claim
+func populateClaim(entity *logical.Entity, value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case string:
+		_, populated, err := identitytpl.PopulateString(entity, value)
+		return populated, err
+
+	case []interface{}:
+		ret := make([]interface{}, 0, len(value))
+		for _, v := range value {
+			populated, err := populateClaim(entity, v)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, populated)
+		}
+		return ret, nil
+
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			populated, err := populateClaim(entity, v)
+			if err != nil {
+				return nil, err
+			}
+			ret[k] = populated
+		}
+		return ret, nil
+	}
+
+	return value, nil
+}
+
+func (b *backend) pathIntrospect(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	inactive := func(reason string) (*logical.Response, error) {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"active": false,
+				"error":  reason,
+			},
+		}, nil
+	}
+
+	token := d.Get("token").(string)
+	if token == "" {
+		return logical.ErrorResponse("token is required"), nil
+	}
+
+	keyID, err := tokenKeyID(token)
+	if err != nil {
+		return inactive(err.Error())
+	}
+
+	b.keyLock.RLock()
+	signingKey, err := findSigningKey(req.Storage, keyID)
+	b.keyLock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if signingKey == nil {
+		return inactive("unknown signing key")
+	}
+
+	claims, err := signingKey.verify(token)
+	if err != nil {
+		return inactive(err.Error())
+	}
+
+	conf, err := readConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if conf == nil || claims["iss"] != conf.Issuer {
+		return inactive("invalid issuer")
+	}
+	if exp, ok := claims["exp"].(float64); !ok || time.Now().Unix() >= int64(exp) {
+		return inactive("token is expired")
+	}
+	if clientID := d.Get("client_id").(string); clientID != "" && claims["aud"] != clientID {
+		return inactive("invalid audience")
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"active": true,
+		},
+	}, nil
+}
+
+// findSigningKey returns the published version of any key with the key ID
+func findSigningKey(s logical.Storage, keyID string) (*signingKey, error) {
+	names, err := s.List("oidc/key/")
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, name := range names {
+		key, err := readKey(s, name)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			continue
+		}
+		for _, signingKey := range key.Keys {
+			if signingKey.KeyID != keyID {
+				continue
+			}
+			if !signingKey.ExpireAt.IsZero() && !now.Before(signingKey.ExpireAt) {
+				return nil, nil
+			}
+			return signingKey, nil
+		}
+	}
+
+	return nil, nil
+}
+
+const pathTokenHelpSyn = `
+Issue an identity token from a specific Vault role.
+`
+
+const pathTokenHelpDesc = `
+This path issues a signed identity token describing the requesting client,
+with the claims and lifetime set by the role. Its subject is the display name
+of the client token, and its audience the client ID of the role.
+`
+
+const pathIntrospectHelpSyn = `
+Verify an identity token.
+`
+
+const pathIntrospectHelpDesc = `
+This path verifies the signature, issuer and expiration of an identity token,
+and optionally its audience, returning whether the token is active.
+`
@@ -0,0 +1,146 @@
+package identity
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathDiscovery(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/.well-known/openid-configuration",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathDiscoveryRead,
+		},
+
+		HelpSynopsis:    pathDiscoveryHelpSyn,
+		HelpDescription: pathDiscoveryHelpDesc,
+	}
+}
+
+func pathJWKS(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/.well-known/keys",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathJWKSRead,
+		},
+
+		HelpSynopsis:    pathJWKSHelpSyn,
+		HelpDescription: pathJWKSHelpDesc,
+	}
+}
+
+func (b *backend) pathDiscoveryRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	conf, err := readConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if conf == nil {
+		return logical.ErrorResponse("the issuer is not configured"), nil
+	}
+
+	return rawJSONResponse(http.StatusOK, map[string]interface{}{
+		"issuer":                                conf.Issuer,
+		"jwks_uri":                              conf.Issuer + "/.well-known/keys",
+		"response_types_supported":              []string{"id_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": signingAlgorithmNames(),
+	})
+}
+
+func (b *backend) pathJWKSRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.keyLock.RLock()
+	defer b.keyLock.RUnlock()
+
+	names, err := req.Storage.List("oidc/key/")
+	if err != nil {
+		return nil, err
+	}
+
+	return jwksResponse(req.Storage, names)
+}
+
+// jwksResponse returns the JWK set of the published versions of the named
+// keys
+func jwksResponse(s logical.Storage, names []string) (*logical.Response, error) {
+	now := time.Now()
+	keys := []*jsonWebKey{}
+	for _, name := range names {
+		key, err := readKey(s, name)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			continue
+		}
+		for _, signingKey := range key.Keys {
+			if !signingKey.ExpireAt.IsZero() && !now.Before(signingKey.ExpireAt) {
+				continue
+			}
+			jwk, err := signingKey.jwk()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, jwk)
+		}
+	}
+
+	return rawJSONResponse(http.StatusOK, map[string]interface{}{
+		"keys": keys,
+	})
+}
+
+// signingAlgorithmNames returns the sorted names of the signing algorithms
+func signingAlgorithmNames() []string {
+	algorithms := make([]string, 0, len(signingAlgorithms))
+	for algorithm := range signingAlgorithms {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+	return algorithms
+}
+
+// rawJSONResponse returns a response whose body is the JSON document,
+// rather than a Vault response, as third parties expect
+func rawJSONResponse(status int, doc interface{}) (*logical.Response, error) {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/json",
+			logical.HTTPRawBody:     body,
+			logical.HTTPStatusCode:  status,
+		},
+	}, nil
+}
+
+const pathDiscoveryHelpSyn = `
+Read the OpenID Connect discovery document.
+`
+
+const pathDiscoveryHelpDesc = `
+This unauthenticated path returns the OpenID Connect discovery document of
+the issuer, which third parties use to find the keys verifying identity
+tokens.
+`
+
+const pathJWKSHelpSyn = `
+Read the public keys verifying identity tokens.
+`
+
+const pathJWKSHelpDesc = `
+This unauthenticated path returns the JWK set of the public keys verifying
+identity tokens, including the previous versions of rotated keys until their
+verification TTL has elapsed.
+`
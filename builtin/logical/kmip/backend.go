@@ -0,0 +1,144 @@
+package kmip
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	b := Backend()
+	b.view = conf.StorageView
+	if _, err := b.Setup(conf); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func Backend() *backend {
+	var b backend
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		Paths: []*framework.Path{
+			pathConfig(&b),
+			pathCA(&b),
+			pathListScopes(&b),
+			pathScopes(&b),
+			pathListRoles(&b),
+			pathRoles(&b),
+			pathCredentialGenerate(&b),
+			pathCredentialLookup(&b),
+			pathCredentialRevoke(&b),
+			pathListCredentials(&b),
+		},
+
+		Init:  b.initialize,
+		Clean: b.cleanup,
+	}
+
+	return &b
+}
+
+type backend struct {
+	*framework.Backend
+
+	// view is the storage used by the KMIP server, outside of the requests
+	// made to the backend
+	view logical.Storage
+
+	// serverLock guards the KMIP server
+	serverLock sync.Mutex
+	server     *server
+
+	// lock guards the scopes, roles, credentials and managed objects, which
+	// are used both by the requests made to the backend and by the KMIP
+	// server
+	lock sync.Mutex
+}
+
+// initialize starts the KMIP server if the backend is configured
+func (b *backend) initialize() error {
+	if b.view == nil {
+		return nil
+	}
+
+	config, err := getConfig(b.view)
+	if err != nil {
+		return err
+	}
+	if config == nil {
+		return nil
+	}
+
+	ca, err := getCA(b.view)
+	if err != nil {
+		return err
+	}
+	if ca == nil {
+		return nil
+	}
+
+	if err := b.startServer(config, ca); err != nil {
+		// A listener that cannot be opened should not prevent the backend
+		// from being mounted, as the configuration can be fixed through it
+		b.Logger().Error("kmip: error starting server", "error", err)
+	}
+	return nil
+}
+
+func (b *backend) cleanup() {
+	b.serverLock.Lock()
+	defer b.serverLock.Unlock()
+
+	if b.server != nil {
+		b.server.Stop()
+		b.server = nil
+	}
+}
+
+// startServer starts the KMIP server with the given configuration, replacing
+// the running server
+func (b *backend) startServer(config *kmipConfig, ca *caBundle) error {
+	b.serverLock.Lock()
+	defer b.serverLock.Unlock()
+
+	if b.server != nil {
+		b.server.Stop()
+		b.server = nil
+	}
+
+	s, err := newServer(b, config, ca)
+	if err != nil {
+		return err
+	}
+	b.server = s
+	return nil
+}
+
+// listenAddrs returns the addresses the KMIP server listens on
+func (b *backend) listenAddrs() []string {
+	b.serverLock.Lock()
+	defer b.serverLock.Unlock()
+
+	if b.server == nil {
+		return nil
+	}
+	return b.server.Addrs()
+}
+
+const backendHelp = `
+The KMIP backend runs a KMIP server, which lets clients such as storage
+arrays and databases use Vault to manage their keys.
+
+Clients are organized in scopes. Each scope has its own set of managed
+objects, and roles that set the KMIP operations its clients are allowed to
+perform. Clients authenticate to the KMIP server with TLS certificates issued
+by the CA of the backend, which are generated for a role with the
+"scope/<scope>/role/<role>/credential/generate" endpoint.
+
+After mounting this backend, the KMIP server must be configured with the
+"config" endpoint.
+`
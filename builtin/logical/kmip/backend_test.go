@@ -0,0 +1,445 @@
+package kmip
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func getBackend(t *testing.T) (*backend, logical.Storage) {
+	storage := &logical.InmemStorage{}
+	config := logical.TestBackendConfig()
+	config.StorageView = storage
+
+	b, err := Factory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	return b.(*backend), storage
+}
+
+func request(t *testing.T, b *backend, storage logical.Storage, operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: operation,
+		Path:      path,
+		Data:      data,
+		Storage:   storage,
+	})
+	if err != nil {
+		t.Fatalf("%s %s: %s", operation, path, err)
+	}
+	return resp
+}
+
+func requestOK(t *testing.T, b *backend, storage logical.Storage, operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp := request(t, b, storage, operation, path, data)
+	if resp != nil && resp.IsError() {
+		t.Fatalf("%s %s: %s", operation, path, resp.Error())
+	}
+	return resp
+}
+
+func TestBackend_config(t *testing.T) {
+	b, storage := getBackend(t)
+	defer b.Cleanup()
+
+	if resp := requestOK(t, b, storage, logical.ReadOperation, "ca", nil); resp != nil {
+		t.Fatalf("expected no CA before the configuration, got %#v", resp.Data)
+	}
+
+	resp := request(t, b, storage, logical.UpdateOperation, "config", map[string]interface{}{
+		"listen_addrs":    "127.0.0.1:0",
+		"tls_ca_key_type": "rsa",
+		"tls_ca_key_bits": 1024,
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected an error for a small RSA key")
+	}
+
+	requestOK(t, b, storage, logical.UpdateOperation, "config", map[string]interface{}{
+		"listen_addrs":     "127.0.0.1:0",
+		"server_hostnames": "kmip.example.com",
+		"server_ips":       "127.0.0.1",
+	})
+	if len(b.listenAddrs()) != 1 {
+		t.Fatalf("expected the server to listen on one address, got %v", b.listenAddrs())
+	}
+
+	resp = requestOK(t, b, storage, logical.ReadOperation, "config", nil)
+	expected := map[string]interface{}{
+		"listen_addrs":                []string{"127.0.0.1:0"},
+		"server_hostnames":            []string{"kmip.example.com"},
+		"server_ips":                  []string{"127.0.0.1"},
+		"tls_ca_key_type":             "ec",
+		"tls_ca_key_bits":             256,
+		"default_tls_client_key_type": "ec",
+		"default_tls_client_key_bits": 256,
+		"default_tls_client_ttl":      int64(336 * 3600),
+	}
+	if !reflect.DeepEqual(resp.Data, expected) {
+		t.Fatalf("bad config:\nexpected %#v\ngot      %#v", expected, resp.Data)
+	}
+
+	resp = requestOK(t, b, storage, logical.ReadOperation, "ca", nil)
+	caPEM := resp.Data["ca_pem"].(string)
+	if caPEM == "" {
+		t.Fatal("expected a CA certificate")
+	}
+
+	// The CA is kept when the configuration changes, and its key cannot be
+	// changed
+	resp = request(t, b, storage, logical.UpdateOperation, "config", map[string]interface{}{
+		"tls_ca_key_type": "rsa",
+		"tls_ca_key_bits": 2048,
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected an error changing the CA key type")
+	}
+	requestOK(t, b, storage, logical.UpdateOperation, "config", map[string]interface{}{
+		"default_tls_client_ttl": "1h",
+	})
+	resp = requestOK(t, b, storage, logical.ReadOperation, "ca", nil)
+	if resp.Data["ca_pem"].(string) != caPEM {
+		t.Fatal("expected the CA to be kept")
+	}
+
+	// The server is started again when the backend is loaded
+	b2, err := Factory(&logical.BackendConfig{
+		Logger:      b.Logger(),
+		System:      logical.TestSystemView(),
+		StorageView: storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b2.Cleanup()
+	if err := b2.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if len(b2.(*backend).listenAddrs()) != 1 {
+		t.Fatal("expected the server to be started on initialization")
+	}
+}
+
+func TestBackend_scopesAndRoles(t *testing.T) {
+	b, storage := getBackend(t)
+	defer b.Cleanup()
+
+	resp := request(t, b, storage, logical.UpdateOperation, "scope/finance/role/admin", map[string]interface{}{
+		"operation_all": true,
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected an error creating a role in a missing scope")
+	}
+
+	requestOK(t, b, storage, logical.UpdateOperation, "scope/finance", nil)
+	requestOK(t, b, storage, logical.UpdateOperation, "scope/hr", nil)
+	resp = requestOK(t, b, storage, logical.ListOperation, "scope/", nil)
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"finance", "hr"}) {
+		t.Fatalf("bad scopes: %#v", resp.Data["keys"])
+	}
+
+	resp = request(t, b, storage, logical.CreateOperation, "scope/finance/role/admin", map[string]interface{}{
+		"operation_all":  true,
+		"operation_none": true,
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected an error setting operation_all and operation_none")
+	}
+
+	requestOK(t, b, storage, logical.CreateOperation, "scope/finance/role/reader", map[string]interface{}{
+		"operation_get":    true,
+		"operation_locate": true,
+		"tls_client_ttl":   "1h",
+	})
+	requestOK(t, b, storage, logical.UpdateOperation, "scope/finance/role/reader", map[string]interface{}{
+		"operation_get_attributes": true,
+		"operation_locate":         false,
+	})
+
+	resp = requestOK(t, b, storage, logical.ReadOperation, "scope/finance/role/reader", nil)
+	expected := map[string]interface{}{
+		"operation_all":               false,
+		"operation_create":            false,
+		"operation_locate":            false,
+		"operation_get":               true,
+		"operation_get_attributes":    true,
+		"operation_activate":          false,
+		"operation_revoke":            false,
+		"operation_destroy":           false,
+		"operation_discover_versions": false,
+		"tls_client_key_type":         "",
+		"tls_client_key_bits":         0,
+		"tls_client_ttl":              int64(3600),
+	}
+	if !reflect.DeepEqual(resp.Data, expected) {
+		t.Fatalf("bad role:\nexpected %#v\ngot      %#v", expected, resp.Data)
+	}
+
+	requestOK(t, b, storage, logical.UpdateOperation, "scope/finance/role/reader", map[string]interface{}{
+		"operation_none": true,
+	})
+	resp = requestOK(t, b, storage, logical.ReadOperation, "scope/finance/role/reader", nil)
+	if resp.Data["operation_get"].(bool) {
+		t.Fatal("expected operation_none to remove the operations")
+	}
+
+	resp = requestOK(t, b, storage, logical.ListOperation, "scope/finance/role/", nil)
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"reader"}) {
+		t.Fatalf("bad roles: %#v", resp.Data["keys"])
+	}
+
+	requestOK(t, b, storage, logical.DeleteOperation, "scope/finance", nil)
+	resp = requestOK(t, b, storage, logical.ListOperation, "scope/finance/role/", nil)
+	if _, ok := resp.Data["keys"]; ok {
+		t.Fatalf("expected the roles to be deleted with the scope, got %#v", resp.Data["keys"])
+	}
+}
+
+// kmipClient sends KMIP requests over a TLS connection
+type kmipClient struct {
+	t    *testing.T
+	conn *tls.Conn
+}
+
+func newKMIPClient(t *testing.T, addr, caPEM string, cred map[string]interface{}) *kmipClient {
+	cert, err := tls.X509KeyPair([]byte(cred["certificate"].(string)), []byte(cred["private_key"].(string)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM([]byte(caPEM)) {
+		t.Fatal("failed to parse the CA certificate")
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      roots,
+		ServerName:   "127.0.0.1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &kmipClient{t: t, conn: conn}
+}
+
+// do sends a request with a single batch item, and returns its result
+func (c *kmipClient) do(operation uint32, payload ...*item) (uint32, uint32, *item) {
+	request := structure(tagRequestMessage,
+		structure(tagRequestHeader,
+			protocolVersion([2]int32{1, 2}),
+			integer(tagBatchCount, 1),
+		),
+		structure(tagBatchItem,
+			enumeration(tagOperation, operation),
+			structure(tagRequestPayload, payload...),
+		),
+	)
+	encoded, err := encodeTTLV(request)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := c.conn.Write(encoded); err != nil {
+		c.t.Fatal(err)
+	}
+
+	c.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	header := make([]byte, ttlvHeaderLength)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		c.t.Fatal(err)
+	}
+	buf := make([]byte, ttlvHeaderLength+int(binary.BigEndian.Uint32(header[4:])))
+	copy(buf, header)
+	if _, err := io.ReadFull(c.conn, buf[ttlvHeaderLength:]); err != nil {
+		c.t.Fatal(err)
+	}
+	response, _, err := decodeTTLV(buf)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	batchItem := response.Child(tagBatchItem)
+	status, _ := batchItem.Child(tagResultStatus).Enumeration()
+	reason, _ := batchItem.Child(tagResultReason).Enumeration()
+	return status, reason, batchItem.Child(tagResponsePayload)
+}
+
+// mustDo sends a request which must succeed, and returns its payload
+func (c *kmipClient) mustDo(operation uint32, payload ...*item) *item {
+	status, reason, response := c.do(operation, payload...)
+	if status != resultStatusSuccess {
+		c.t.Fatalf("operation %d failed with reason %d", operation, reason)
+	}
+	return response
+}
+
+func (c *kmipClient) state(id string) uint32 {
+	response := c.mustDo(operationGetAttributes,
+		textString(tagUniqueIdentifier, id),
+		textString(tagAttributeName, attributeState),
+	)
+	attrs := response.ChildrenWithTag(tagAttribute)
+	if len(attrs) != 1 {
+		c.t.Fatalf("expected one attribute, got %d", len(attrs))
+	}
+	state, _ := attrs[0].Child(tagAttributeValue).Enumeration()
+	return state
+}
+
+func TestBackend_KMIPServer(t *testing.T) {
+	b, storage := getBackend(t)
+	defer b.Cleanup()
+
+	requestOK(t, b, storage, logical.UpdateOperation, "config", map[string]interface{}{
+		"listen_addrs": "127.0.0.1:0",
+		"server_ips":   "127.0.0.1",
+	})
+	caPEM := requestOK(t, b, storage, logical.ReadOperation, "ca", nil).Data["ca_pem"].(string)
+	addr := b.listenAddrs()[0]
+
+	requestOK(t, b, storage, logical.UpdateOperation, "scope/finance", nil)
+	requestOK(t, b, storage, logical.UpdateOperation, "scope/hr", nil)
+	requestOK(t, b, storage, logical.UpdateOperation, "scope/finance/role/admin", map[string]interface{}{
+		"operation_all": true,
+	})
+	requestOK(t, b, storage, logical.UpdateOperation, "scope/finance/role/reader", map[string]interface{}{
+		"operation_get":    true,
+		"operation_locate": true,
+	})
+	requestOK(t, b, storage, logical.UpdateOperation, "scope/hr/role/admin", map[string]interface{}{
+		"operation_all": true,
+	})
+
+	adminCred := requestOK(t, b, storage, logical.UpdateOperation, "scope/finance/role/admin/credential/generate", nil).Data
+	admin := newKMIPClient(t, addr, caPEM, adminCred)
+	defer admin.conn.Close()
+
+	// Create a key and manage its lifecycle
+	response := admin.mustDo(operationCreate,
+		enumeration(tagObjectType, objectTypeSymmetricKey),
+		structure(tagTemplateAttribute,
+			attribute(attributeCryptographicAlgorithm, enumeration(tagAttributeValue, cryptographicAlgorithmAES)),
+			attribute(attributeCryptographicLength, integer(tagAttributeValue, 256)),
+			attribute(attributeName, structure(tagAttributeValue,
+				textString(tagNameValue, "disk-key"),
+				enumeration(tagNameType, nameTypeUninterpretedTextString),
+			)),
+		),
+	)
+	id, ok := response.Child(tagUniqueIdentifier).TextString()
+	if !ok || id == "" {
+		t.Fatal("expected a unique identifier")
+	}
+	if state := admin.state(id); state != statePreActive {
+		t.Fatalf("expected a pre-active key, got state %d", state)
+	}
+
+	response = admin.mustDo(operationGet, textString(tagUniqueIdentifier, id))
+	keyMaterial, _ := response.Child(tagSymmetricKey).Child(tagKeyBlock).Child(tagKeyValue).Child(tagKeyMaterial).ByteString()
+	if len(keyMaterial) != 32 {
+		t.Fatalf("expected a 256 bit key, got %d bytes", len(keyMaterial))
+	}
+
+	response = admin.mustDo(operationLocate,
+		attribute(attributeName, structure(tagAttributeValue,
+			textString(tagNameValue, "disk-key"),
+			enumeration(tagNameType, nameTypeUninterpretedTextString),
+		)),
+	)
+	if located, _ := response.Child(tagUniqueIdentifier).TextString(); located != id {
+		t.Fatalf("expected to locate %q, got %q", id, located)
+	}
+
+	// Active keys cannot be destroyed before being revoked
+	admin.mustDo(operationActivate, textString(tagUniqueIdentifier, id))
+	if state := admin.state(id); state != stateActive {
+		t.Fatalf("expected an active key, got state %d", state)
+	}
+	if status, reason, _ := admin.do(operationDestroy, textString(tagUniqueIdentifier, id)); status != resultStatusOperationFailed || reason != resultReasonIllegalOperation {
+		t.Fatalf("expected destroying an active key to fail, got status %d and reason %d", status, reason)
+	}
+	admin.mustDo(operationRevoke,
+		textString(tagUniqueIdentifier, id),
+		structure(tagRevocationReason,
+			enumeration(tagRevocationReasonCode, 0x06),
+		),
+	)
+	if state := admin.state(id); state != stateDeactivated {
+		t.Fatalf("expected a deactivated key, got state %d", state)
+	}
+	admin.mustDo(operationDestroy, textString(tagUniqueIdentifier, id))
+	if state := admin.state(id); state != stateDestroyed {
+		t.Fatalf("expected a destroyed key, got state %d", state)
+	}
+	if status, _, _ := admin.do(operationGet, textString(tagUniqueIdentifier, id)); status != resultStatusOperationFailed {
+		t.Fatal("expected getting a destroyed key to fail")
+	}
+
+	// Roles restrict the operations of their clients
+	secondID, _ := admin.mustDo(operationCreate,
+		enumeration(tagObjectType, objectTypeSymmetricKey),
+		structure(tagTemplateAttribute,
+			attribute(attributeCryptographicAlgorithm, enumeration(tagAttributeValue, cryptographicAlgorithmAES)),
+			attribute(attributeCryptographicLength, integer(tagAttributeValue, 128)),
+		),
+	).Child(tagUniqueIdentifier).TextString()
+
+	readerCred := requestOK(t, b, storage, logical.UpdateOperation, "scope/finance/role/reader/credential/generate", nil).Data
+	reader := newKMIPClient(t, addr, caPEM, readerCred)
+	defer reader.conn.Close()
+	reader.mustDo(operationGet, textString(tagUniqueIdentifier, secondID))
+	if status, reason, _ := reader.do(operationDestroy, textString(tagUniqueIdentifier, secondID)); status != resultStatusOperationFailed || reason != resultReasonPermissionDenied {
+		t.Fatalf("expected the reader to be denied, got status %d and reason %d", status, reason)
+	}
+
+	// Scopes isolate their objects
+	hrCred := requestOK(t, b, storage, logical.UpdateOperation, "scope/hr/role/admin/credential/generate", nil).Data
+	hr := newKMIPClient(t, addr, caPEM, hrCred)
+	defer hr.conn.Close()
+	if status, reason, _ := hr.do(operationGet, textString(tagUniqueIdentifier, secondID)); status != resultStatusOperationFailed || reason != resultReasonItemNotFound {
+		t.Fatalf("expected the key of another scope not to be found, got status %d and reason %d", status, reason)
+	}
+	if response := hr.mustDo(operationLocate); len(response.Children()) != 0 {
+		t.Fatal("expected no object in the hr scope")
+	}
+
+	// Revoked credentials are rejected, including on open connections
+	serial := readerCred["serial_number"].(string)
+	resp := requestOK(t, b, storage, logical.ListOperation, "scope/finance/role/reader/credential/", nil)
+	if !reflect.DeepEqual(resp.Data["keys"], []string{serial}) {
+		t.Fatalf("bad credentials: %#v", resp.Data["keys"])
+	}
+	resp = requestOK(t, b, storage, logical.UpdateOperation, "scope/finance/role/reader/credential/lookup", map[string]interface{}{
+		"serial_number": serial,
+	})
+	if resp.Data["certificate"].(string) != readerCred["certificate"].(string) {
+		t.Fatal("bad credential certificate")
+	}
+	requestOK(t, b, storage, logical.UpdateOperation, "scope/finance/role/reader/credential/revoke", map[string]interface{}{
+		"serial_number": serial,
+	})
+	if status, reason, _ := reader.do(operationGet, textString(tagUniqueIdentifier, secondID)); status != resultStatusOperationFailed || reason != resultReasonPermissionDenied {
+		t.Fatalf("expected the revoked credential to be denied, got status %d and reason %d", status, reason)
+	}
+
+	// Scopes with objects are only deleted when forced
+	resp = request(t, b, storage, logical.DeleteOperation, "scope/finance", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected an error deleting a scope with objects")
+	}
+	requestOK(t, b, storage, logical.DeleteOperation, "scope/finance", map[string]interface{}{
+		"force": true,
+	})
+	if status, reason, _ := admin.do(operationLocate); status != resultStatusOperationFailed || reason != resultReasonPermissionDenied {
+		t.Fatalf("expected the credentials of the deleted scope to be denied, got status %d and reason %d", status, reason)
+	}
+}
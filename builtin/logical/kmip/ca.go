@@ -0,0 +1,182 @@
+package kmip
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	caPath = "ca"
+
+	// caTTL is the lifetime of the CA of the backend, which is not rotated
+	caTTL = 10 * 365 * 24 * time.Hour
+
+	// serverCertificateTTL is the lifetime of the certificate of the KMIP
+	// server, which is issued again every time the server starts
+	serverCertificateTTL = 365 * 24 * time.Hour
+
+	// certificateBackdate is removed from the start of the validity of the
+	// certificates, to allow for clock skew
+	certificateBackdate = 30 * time.Second
+)
+
+// caBundle is the stored CA of the backend
+type caBundle struct {
+	*certutil.CertBundle
+}
+
+// parse returns the parsed certificate and private key of the CA
+func (c *caBundle) parse() (*certutil.ParsedCertBundle, error) {
+	parsed, err := c.CertBundle.ToParsedCertBundle()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the CA: %s", err)
+	}
+	return parsed, nil
+}
+
+func getCA(s logical.Storage) (*caBundle, error) {
+	entry, err := s.Get(caPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var bundle certutil.CertBundle
+	if err := entry.DecodeJSON(&bundle); err != nil {
+		return nil, err
+	}
+	return &caBundle{CertBundle: &bundle}, nil
+}
+
+func storeCA(s logical.Storage, ca *caBundle) error {
+	entry, err := logical.StorageEntryJSON(caPath, ca.CertBundle)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+// generateCA generates the self-signed CA issuing the certificates of the
+// KMIP server and of its clients
+func generateCA(keyType string, keyBits int) (*caBundle, error) {
+	parsed := &certutil.ParsedCertBundle{}
+	if err := certutil.GeneratePrivateKey(keyType, keyBits, parsed); err != nil {
+		return nil, err
+	}
+
+	subjKeyID, err := certutil.GetSubjKeyID(parsed.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := certutil.GenerateSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName: "Vault KMIP CA",
+		},
+		NotBefore:             now.Add(-certificateBackdate),
+		NotAfter:              now.Add(caTTL),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          subjKeyID,
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, parsed.PrivateKey.Public(), parsed.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("error creating the CA certificate: %s", err)
+	}
+	if parsed.Certificate, err = x509.ParseCertificate(certBytes); err != nil {
+		return nil, err
+	}
+	parsed.CertificateBytes = certBytes
+	parsed.SerialNumber = serial
+
+	bundle, err := parsed.ToCertBundle()
+	if err != nil {
+		return nil, err
+	}
+	return &caBundle{CertBundle: bundle}, nil
+}
+
+// certificateRequest describes a certificate issued by the CA
+type certificateRequest struct {
+	Subject     pkix.Name
+	DNSNames    []string
+	IPAddresses []net.IP
+	KeyType     string
+	KeyBits     int
+	TTL         time.Duration
+	ExtKeyUsage x509.ExtKeyUsage
+}
+
+// issueCertificate generates a private key and issues its certificate with
+// the CA
+func issueCertificate(ca *certutil.ParsedCertBundle, req *certificateRequest) (*certutil.ParsedCertBundle, error) {
+	parsed := &certutil.ParsedCertBundle{}
+	if err := certutil.GeneratePrivateKey(req.KeyType, req.KeyBits, parsed); err != nil {
+		return nil, err
+	}
+
+	subjKeyID, err := certutil.GetSubjKeyID(parsed.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := certutil.GenerateSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	notAfter := now.Add(req.TTL)
+	if notAfter.After(ca.Certificate.NotAfter) {
+		notAfter = ca.Certificate.NotAfter
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               req.Subject,
+		DNSNames:              req.DNSNames,
+		IPAddresses:           req.IPAddresses,
+		NotBefore:             now.Add(-certificateBackdate),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageKeyAgreement,
+		ExtKeyUsage:           []x509.ExtKeyUsage{req.ExtKeyUsage},
+		BasicConstraintsValid: true,
+		SubjectKeyId:          subjKeyID,
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, parsed.PrivateKey.Public(), ca.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("error creating certificate: %s", err)
+	}
+	if parsed.Certificate, err = x509.ParseCertificate(certBytes); err != nil {
+		return nil, err
+	}
+	parsed.CertificateBytes = certBytes
+	parsed.SerialNumber = serial
+	parsed.CAChain = []*certutil.CertBlock{
+		{
+			Certificate: ca.Certificate,
+			Bytes:       ca.CertificateBytes,
+		},
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,144 @@
+package kmip
+
+// The tags of the KMIP items used by the server
+const (
+	tagActivationDate         uint32 = 0x420001
+	tagAttribute              uint32 = 0x420008
+	tagAttributeIndex         uint32 = 0x420009
+	tagAttributeName          uint32 = 0x42000A
+	tagAttributeValue         uint32 = 0x42000B
+	tagBatchCount             uint32 = 0x42000D
+	tagBatchItem              uint32 = 0x42000F
+	tagCryptographicAlgorithm uint32 = 0x420028
+	tagCryptographicLength    uint32 = 0x42002A
+	tagCryptographicUsageMask uint32 = 0x42002C
+	tagDeactivationDate       uint32 = 0x42002F
+	tagDestroyDate            uint32 = 0x420033
+	tagInitialDate            uint32 = 0x420039
+	tagKeyBlock               uint32 = 0x420040
+	tagKeyFormatType          uint32 = 0x420042
+	tagKeyMaterial            uint32 = 0x420043
+	tagKeyValue               uint32 = 0x420045
+	tagMaximumItems           uint32 = 0x42004F
+	tagName                   uint32 = 0x420053
+	tagNameType               uint32 = 0x420054
+	tagNameValue              uint32 = 0x420055
+	tagObjectType             uint32 = 0x420057
+	tagOperation              uint32 = 0x42005C
+	tagProtocolVersion        uint32 = 0x420069
+	tagProtocolVersionMajor   uint32 = 0x42006A
+	tagProtocolVersionMinor   uint32 = 0x42006B
+	tagRequestHeader          uint32 = 0x420077
+	tagRequestMessage         uint32 = 0x420078
+	tagRequestPayload         uint32 = 0x420079
+	tagResponseHeader         uint32 = 0x42007A
+	tagResponseMessage        uint32 = 0x42007B
+	tagResponsePayload        uint32 = 0x42007C
+	tagResultMessage          uint32 = 0x42007D
+	tagResultReason           uint32 = 0x42007E
+	tagResultStatus           uint32 = 0x42007F
+	tagRevocationReason       uint32 = 0x420081
+	tagRevocationReasonCode   uint32 = 0x420082
+	tagState                  uint32 = 0x42008D
+	tagSymmetricKey           uint32 = 0x42008F
+	tagTemplateAttribute      uint32 = 0x420091
+	tagTimeStamp              uint32 = 0x420092
+	tagUniqueBatchItemID      uint32 = 0x420093
+	tagUniqueIdentifier       uint32 = 0x420094
+)
+
+// The KMIP operations supported by the server
+const (
+	operationCreate           uint32 = 0x01
+	operationLocate           uint32 = 0x08
+	operationGet              uint32 = 0x0A
+	operationGetAttributes    uint32 = 0x0B
+	operationActivate         uint32 = 0x12
+	operationRevoke           uint32 = 0x13
+	operationDestroy          uint32 = 0x14
+	operationDiscoverVersions uint32 = 0x1E
+)
+
+// operationNames maps the supported operations to the names used by the
+// operation fields of roles
+var operationNames = map[uint32]string{
+	operationCreate:           "create",
+	operationLocate:           "locate",
+	operationGet:              "get",
+	operationGetAttributes:    "get_attributes",
+	operationActivate:         "activate",
+	operationRevoke:           "revoke",
+	operationDestroy:          "destroy",
+	operationDiscoverVersions: "discover_versions",
+}
+
+const (
+	resultStatusSuccess         uint32 = 0x00
+	resultStatusOperationFailed uint32 = 0x01
+)
+
+const (
+	resultReasonItemNotFound          uint32 = 0x01
+	resultReasonInvalidMessage        uint32 = 0x04
+	resultReasonOperationNotSupported uint32 = 0x05
+	resultReasonMissingData           uint32 = 0x06
+	resultReasonInvalidField          uint32 = 0x07
+	resultReasonIllegalOperation      uint32 = 0x0B
+	resultReasonPermissionDenied      uint32 = 0x0C
+	resultReasonGeneralFailure        uint32 = 0x100
+)
+
+const (
+	objectTypeSymmetricKey uint32 = 0x02
+)
+
+const (
+	cryptographicAlgorithmAES uint32 = 0x03
+)
+
+const (
+	keyFormatTypeRaw uint32 = 0x01
+)
+
+const (
+	nameTypeUninterpretedTextString uint32 = 0x01
+)
+
+// The states of managed objects
+const (
+	statePreActive            uint32 = 0x01
+	stateActive               uint32 = 0x02
+	stateDeactivated          uint32 = 0x03
+	stateCompromised          uint32 = 0x04
+	stateDestroyed            uint32 = 0x05
+	stateDestroyedCompromised uint32 = 0x06
+)
+
+const (
+	revocationReasonKeyCompromise uint32 = 0x02
+)
+
+// The names of the attributes of managed objects
+const (
+	attributeActivationDate         = "Activation Date"
+	attributeCryptographicAlgorithm = "Cryptographic Algorithm"
+	attributeCryptographicLength    = "Cryptographic Length"
+	attributeCryptographicUsageMask = "Cryptographic Usage Mask"
+	attributeDeactivationDate       = "Deactivation Date"
+	attributeDestroyDate            = "Destroy Date"
+	attributeInitialDate            = "Initial Date"
+	attributeName                   = "Name"
+	attributeObjectType             = "Object Type"
+	attributeState                  = "State"
+	attributeUniqueIdentifier       = "Unique Identifier"
+)
+
+// supportedProtocolVersions are the versions of the KMIP protocol spoken by
+// the server, most preferred first
+var supportedProtocolVersions = [][2]int32{
+	{1, 4},
+	{1, 3},
+	{1, 2},
+	{1, 1},
+	{1, 0},
+}
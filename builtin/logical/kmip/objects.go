@@ -0,0 +1,106 @@
+package kmip
+
+import (
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+const objectPath = "objects/"
+
+// managedObject is a KMIP managed object of a scope. Only symmetric keys are
+// supported.
+type managedObject struct {
+	UniqueIdentifier       string    `json:"unique_identifier"`
+	ObjectType             uint32    `json:"object_type"`
+	CryptographicAlgorithm uint32    `json:"cryptographic_algorithm"`
+	CryptographicLength    int32     `json:"cryptographic_length"`
+	CryptographicUsageMask int32     `json:"cryptographic_usage_mask"`
+	Names                  []string  `json:"names"`
+	State                  uint32    `json:"state"`
+	KeyMaterial            []byte    `json:"key_material"`
+	InitialDate            time.Time `json:"initial_date"`
+	ActivationDate         time.Time `json:"activation_date"`
+	DeactivationDate       time.Time `json:"deactivation_date"`
+	DestroyDate            time.Time `json:"destroy_date"`
+}
+
+func getObject(s logical.Storage, scope, id string) (*managedObject, error) {
+	entry, err := s.Get(objectPath + scope + "/" + id)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result managedObject
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func putObject(s logical.Storage, scope string, object *managedObject) error {
+	entry, err := logical.StorageEntryJSON(objectPath+scope+"/"+object.UniqueIdentifier, object)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+// attributes returns the KMIP attributes of the object which are set
+func (o *managedObject) attributes() []*item {
+	ret := []*item{
+		attribute(attributeUniqueIdentifier, textString(tagAttributeValue, o.UniqueIdentifier)),
+		attribute(attributeObjectType, enumeration(tagAttributeValue, o.ObjectType)),
+		attribute(attributeCryptographicAlgorithm, enumeration(tagAttributeValue, o.CryptographicAlgorithm)),
+		attribute(attributeCryptographicLength, integer(tagAttributeValue, o.CryptographicLength)),
+	}
+	if o.CryptographicUsageMask != 0 {
+		ret = append(ret, attribute(attributeCryptographicUsageMask, integer(tagAttributeValue, o.CryptographicUsageMask)))
+	}
+	for i, name := range o.Names {
+		ret = append(ret, structure(tagAttribute,
+			textString(tagAttributeName, attributeName),
+			integer(tagAttributeIndex, int32(i)),
+			structure(tagAttributeValue,
+				textString(tagNameValue, name),
+				enumeration(tagNameType, nameTypeUninterpretedTextString),
+			),
+		))
+	}
+	ret = append(ret, attribute(attributeState, enumeration(tagAttributeValue, o.State)))
+
+	dates := []struct {
+		name  string
+		value time.Time
+	}{
+		{attributeInitialDate, o.InitialDate},
+		{attributeActivationDate, o.ActivationDate},
+		{attributeDeactivationDate, o.DeactivationDate},
+		{attributeDestroyDate, o.DestroyDate},
+	}
+	for _, date := range dates {
+		if !date.value.IsZero() {
+			ret = append(ret, attribute(date.name, dateTime(tagAttributeValue, date.value)))
+		}
+	}
+
+	return ret
+}
+
+// attribute returns an attribute item with the given name and value. The
+// tag of the value must be tagAttributeValue.
+func attribute(name string, value *item) *item {
+	return structure(tagAttribute,
+		textString(tagAttributeName, name),
+		value,
+	)
+}
+
+// attributeNameOf returns the name of an attribute item
+func attributeNameOf(attr *item) string {
+	name, _ := attr.Child(tagAttributeName).TextString()
+	return name
+}
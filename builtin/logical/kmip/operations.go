@@ -0,0 +1,369 @@
+package kmip
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+// kmipError is an error returned to KMIP clients in the result of a batch
+// item
+type kmipError struct {
+	Reason  uint32
+	Message string
+}
+
+func (e *kmipError) Error() string {
+	return e.Message
+}
+
+func newKMIPError(reason uint32, format string, args ...interface{}) *kmipError {
+	return &kmipError{
+		Reason:  reason,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// operationFunc performs a KMIP operation in a scope, and returns the
+// response payload
+type operationFunc func(s logical.Storage, scope string, payload *item) (*item, error)
+
+var operations = map[uint32]operationFunc{
+	operationCreate:           opCreate,
+	operationLocate:           opLocate,
+	operationGet:              opGet,
+	operationGetAttributes:    opGetAttributes,
+	operationActivate:         opActivate,
+	operationRevoke:           opRevoke,
+	operationDestroy:          opDestroy,
+	operationDiscoverVersions: opDiscoverVersions,
+}
+
+func opCreate(s logical.Storage, scope string, payload *item) (*item, error) {
+	objectType, ok := payload.Child(tagObjectType).Enumeration()
+	if !ok {
+		return nil, newKMIPError(resultReasonMissingData, "the object type is required")
+	}
+	if objectType != objectTypeSymmetricKey {
+		return nil, newKMIPError(resultReasonInvalidField, "only symmetric keys can be created")
+	}
+
+	object := &managedObject{
+		ObjectType: objectType,
+		State:      statePreActive,
+	}
+
+	for _, attr := range payload.Child(tagTemplateAttribute).ChildrenWithTag(tagAttribute) {
+		value := attr.Child(tagAttributeValue)
+		var valid bool
+		switch attributeNameOf(attr) {
+		case attributeCryptographicAlgorithm:
+			object.CryptographicAlgorithm, valid = value.Enumeration()
+		case attributeCryptographicLength:
+			object.CryptographicLength, valid = value.Integer()
+		case attributeCryptographicUsageMask:
+			object.CryptographicUsageMask, valid = value.Integer()
+		case attributeName:
+			var name string
+			name, valid = value.Child(tagNameValue).TextString()
+			object.Names = append(object.Names, name)
+		default:
+			// Attributes which are not managed by the server, such as
+			// custom attributes, are ignored
+			valid = true
+		}
+		if !valid {
+			return nil, newKMIPError(resultReasonInvalidField, "invalid value for the %q attribute", attributeNameOf(attr))
+		}
+	}
+
+	if object.CryptographicAlgorithm == 0 {
+		return nil, newKMIPError(resultReasonMissingData, "the cryptographic algorithm is required")
+	}
+	if object.CryptographicAlgorithm != cryptographicAlgorithmAES {
+		return nil, newKMIPError(resultReasonInvalidField, "only AES keys can be created")
+	}
+	switch object.CryptographicLength {
+	case 128, 192, 256:
+	case 0:
+		return nil, newKMIPError(resultReasonMissingData, "the cryptographic length is required")
+	default:
+		return nil, newKMIPError(resultReasonInvalidField, "invalid cryptographic length %d for AES keys", object.CryptographicLength)
+	}
+
+	object.KeyMaterial = make([]byte, object.CryptographicLength/8)
+	if _, err := rand.Read(object.KeyMaterial); err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	object.UniqueIdentifier = id
+	object.InitialDate = time.Now().UTC()
+
+	if err := putObject(s, scope, object); err != nil {
+		return nil, err
+	}
+
+	return structure(tagResponsePayload,
+		enumeration(tagObjectType, object.ObjectType),
+		textString(tagUniqueIdentifier, object.UniqueIdentifier),
+	), nil
+}
+
+func opLocate(s logical.Storage, scope string, payload *item) (*item, error) {
+	maxItems, hasMax := payload.Child(tagMaximumItems).Integer()
+
+	ids, err := s.List(objectPath + scope + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []*managedObject
+	for _, id := range ids {
+		object, err := getObject(s, scope, id)
+		if err != nil {
+			return nil, err
+		}
+		if object == nil {
+			continue
+		}
+
+		matches, err := object.matches(payload.ChildrenWithTag(tagAttribute))
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			objects = append(objects, object)
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].InitialDate.Equal(objects[j].InitialDate) {
+			return objects[i].UniqueIdentifier < objects[j].UniqueIdentifier
+		}
+		return objects[i].InitialDate.Before(objects[j].InitialDate)
+	})
+	if hasMax && maxItems >= 0 && int(maxItems) < len(objects) {
+		objects = objects[:maxItems]
+	}
+
+	response := structure(tagResponsePayload)
+	for _, object := range objects {
+		response.Add(textString(tagUniqueIdentifier, object.UniqueIdentifier))
+	}
+	return response, nil
+}
+
+// matches returns whether the object has all the given attributes
+func (o *managedObject) matches(attrs []*item) (bool, error) {
+	for _, attr := range attrs {
+		value := attr.Child(tagAttributeValue)
+		var matches bool
+		switch attributeNameOf(attr) {
+		case attributeObjectType:
+			v, ok := value.Enumeration()
+			matches = ok && v == o.ObjectType
+		case attributeCryptographicAlgorithm:
+			v, ok := value.Enumeration()
+			matches = ok && v == o.CryptographicAlgorithm
+		case attributeCryptographicLength:
+			v, ok := value.Integer()
+			matches = ok && v == o.CryptographicLength
+		case attributeState:
+			v, ok := value.Enumeration()
+			matches = ok && v == o.State
+		case attributeName:
+			v, ok := value.Child(tagNameValue).TextString()
+			matches = ok && strutil.StrListContains(o.Names, v)
+		default:
+			return false, newKMIPError(resultReasonInvalidField, "objects cannot be located by the %q attribute", attributeNameOf(attr))
+		}
+		if !matches {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// getPayloadObject returns the object whose unique identifier is in the
+// request payload
+func getPayloadObject(s logical.Storage, scope string, payload *item) (*managedObject, error) {
+	id, ok := payload.Child(tagUniqueIdentifier).TextString()
+	if !ok {
+		return nil, newKMIPError(resultReasonMissingData, "the unique identifier is required")
+	}
+
+	object, err := getObject(s, scope, id)
+	if err != nil {
+		return nil, err
+	}
+	if object == nil {
+		return nil, newKMIPError(resultReasonItemNotFound, "object %q not found", id)
+	}
+	return object, nil
+}
+
+func opGet(s logical.Storage, scope string, payload *item) (*item, error) {
+	object, err := getPayloadObject(s, scope, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if format, ok := payload.Child(tagKeyFormatType).Enumeration(); ok && format != keyFormatTypeRaw {
+		return nil, newKMIPError(resultReasonInvalidField, "only the raw key format is supported")
+	}
+	if object.State == stateDestroyed || object.State == stateDestroyedCompromised {
+		return nil, newKMIPError(resultReasonIllegalOperation, "the key material of object %q was destroyed", object.UniqueIdentifier)
+	}
+
+	return structure(tagResponsePayload,
+		enumeration(tagObjectType, object.ObjectType),
+		textString(tagUniqueIdentifier, object.UniqueIdentifier),
+		structure(tagSymmetricKey,
+			structure(tagKeyBlock,
+				enumeration(tagKeyFormatType, keyFormatTypeRaw),
+				structure(tagKeyValue,
+					byteString(tagKeyMaterial, object.KeyMaterial),
+				),
+				enumeration(tagCryptographicAlgorithm, object.CryptographicAlgorithm),
+				integer(tagCryptographicLength, object.CryptographicLength),
+			),
+		),
+	), nil
+}
+
+func opGetAttributes(s logical.Storage, scope string, payload *item) (*item, error) {
+	object, err := getPayloadObject(s, scope, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, name := range payload.ChildrenWithTag(tagAttributeName) {
+		if v, ok := name.TextString(); ok {
+			names = append(names, v)
+		}
+	}
+
+	response := structure(tagResponsePayload,
+		textString(tagUniqueIdentifier, object.UniqueIdentifier),
+	)
+	for _, attr := range object.attributes() {
+		if len(names) == 0 || strutil.StrListContains(names, attributeNameOf(attr)) {
+			response.Add(attr)
+		}
+	}
+	return response, nil
+}
+
+func opActivate(s logical.Storage, scope string, payload *item) (*item, error) {
+	object, err := getPayloadObject(s, scope, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if object.State != statePreActive {
+		return nil, newKMIPError(resultReasonIllegalOperation, "only pre-active objects can be activated")
+	}
+	object.State = stateActive
+	object.ActivationDate = time.Now().UTC()
+
+	if err := putObject(s, scope, object); err != nil {
+		return nil, err
+	}
+	return structure(tagResponsePayload,
+		textString(tagUniqueIdentifier, object.UniqueIdentifier),
+	), nil
+}
+
+func opRevoke(s logical.Storage, scope string, payload *item) (*item, error) {
+	object, err := getPayloadObject(s, scope, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	reason, ok := payload.Child(tagRevocationReason).Child(tagRevocationReasonCode).Enumeration()
+	if !ok {
+		return nil, newKMIPError(resultReasonMissingData, "the revocation reason is required")
+	}
+
+	switch {
+	case object.State == stateDestroyed || object.State == stateDestroyedCompromised:
+		return nil, newKMIPError(resultReasonIllegalOperation, "destroyed objects cannot be revoked")
+	case reason == revocationReasonKeyCompromise:
+		object.State = stateCompromised
+	case object.State == statePreActive || object.State == stateActive:
+		object.State = stateDeactivated
+	default:
+		return nil, newKMIPError(resultReasonIllegalOperation, "the object was already revoked")
+	}
+	if object.DeactivationDate.IsZero() {
+		object.DeactivationDate = time.Now().UTC()
+	}
+
+	if err := putObject(s, scope, object); err != nil {
+		return nil, err
+	}
+	return structure(tagResponsePayload,
+		textString(tagUniqueIdentifier, object.UniqueIdentifier),
+	), nil
+}
+
+func opDestroy(s logical.Storage, scope string, payload *item) (*item, error) {
+	object, err := getPayloadObject(s, scope, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	switch object.State {
+	case stateActive:
+		return nil, newKMIPError(resultReasonIllegalOperation, "active objects must be revoked before being destroyed")
+	case stateDestroyed, stateDestroyedCompromised:
+		return nil, newKMIPError(resultReasonIllegalOperation, "the object was already destroyed")
+	case stateCompromised:
+		object.State = stateDestroyedCompromised
+	default:
+		object.State = stateDestroyed
+	}
+	object.KeyMaterial = nil
+	object.DestroyDate = time.Now().UTC()
+
+	if err := putObject(s, scope, object); err != nil {
+		return nil, err
+	}
+	return structure(tagResponsePayload,
+		textString(tagUniqueIdentifier, object.UniqueIdentifier),
+	), nil
+}
+
+func opDiscoverVersions(s logical.Storage, scope string, payload *item) (*item, error) {
+	requested := map[[2]int32]bool{}
+	for _, version := range payload.ChildrenWithTag(tagProtocolVersion) {
+		major, _ := version.Child(tagProtocolVersionMajor).Integer()
+		minor, _ := version.Child(tagProtocolVersionMinor).Integer()
+		requested[[2]int32{major, minor}] = true
+	}
+
+	response := structure(tagResponsePayload)
+	for _, version := range supportedProtocolVersions {
+		if len(requested) == 0 || requested[version] {
+			response.Add(protocolVersion(version))
+		}
+	}
+	return response, nil
+}
+
+func protocolVersion(version [2]int32) *item {
+	return structure(tagProtocolVersion,
+		integer(tagProtocolVersionMajor, version[0]),
+		integer(tagProtocolVersionMinor, version[1]),
+	)
+}
@@ -0,0 +1,304 @@
+package kmip
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	configPath = "config"
+
+	defaultListenAddr = "127.0.0.1:5696"
+	defaultKeyType    = "ec"
+	defaultKeyBits    = 256
+	defaultClientTTL  = 14 * 24 * time.Hour
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config",
+		Fields: map[string]*framework.FieldSchema{
+			"listen_addrs": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Default:     defaultListenAddr,
+				Description: "Addresses the KMIP server listens on, as host:port",
+			},
+			"server_hostnames": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Hostnames included in the certificate of the KMIP server",
+			},
+			"server_ips": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "IP addresses included in the certificate of the KMIP server",
+			},
+			"tls_ca_key_type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     defaultKeyType,
+				Description: `Type of the key of the CA, "ec" or "rsa". It cannot be changed once the CA is generated.`,
+			},
+			"tls_ca_key_bits": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Default:     defaultKeyBits,
+				Description: "Size of the key of the CA. It cannot be changed once the CA is generated.",
+			},
+			"default_tls_client_key_type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     defaultKeyType,
+				Description: `Default type of the keys of client certificates, "ec" or "rsa"`,
+			},
+			"default_tls_client_key_bits": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Default:     defaultKeyBits,
+				Description: "Default size of the keys of client certificates",
+			},
+			"default_tls_client_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Default:     int(defaultClientTTL / time.Second),
+				Description: "Default lifetime of client certificates",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := getConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"listen_addrs":                config.ListenAddrs,
+			"server_hostnames":            config.ServerHostnames,
+			"server_ips":                  config.ServerIPs,
+			"tls_ca_key_type":             config.CAKeyType,
+			"tls_ca_key_bits":             config.CAKeyBits,
+			"default_tls_client_key_type": config.ClientKeyType,
+			"default_tls_client_key_bits": config.ClientKeyBits,
+			"default_tls_client_ttl":      int64(config.ClientTTL / time.Second),
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := getConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &kmipConfig{
+			ListenAddrs:   d.Get("listen_addrs").([]string),
+			CAKeyType:     d.Get("tls_ca_key_type").(string),
+			CAKeyBits:     d.Get("tls_ca_key_bits").(int),
+			ClientKeyType: d.Get("default_tls_client_key_type").(string),
+			ClientKeyBits: d.Get("default_tls_client_key_bits").(int),
+			ClientTTL:     time.Duration(d.Get("default_tls_client_ttl").(int)) * time.Second,
+		}
+	}
+
+	ca, err := getCA(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if v, ok := d.GetOk("listen_addrs"); ok {
+		config.ListenAddrs = v.([]string)
+	}
+	if v, ok := d.GetOk("server_hostnames"); ok {
+		config.ServerHostnames = v.([]string)
+	}
+	if v, ok := d.GetOk("server_ips"); ok {
+		config.ServerIPs = v.([]string)
+	}
+	if v, ok := d.GetOk("tls_ca_key_type"); ok {
+		if ca != nil && v.(string) != config.CAKeyType {
+			return logical.ErrorResponse("tls_ca_key_type cannot be changed once the CA is generated"), nil
+		}
+		config.CAKeyType = v.(string)
+	}
+	if v, ok := d.GetOk("tls_ca_key_bits"); ok {
+		if ca != nil && v.(int) != config.CAKeyBits {
+			return logical.ErrorResponse("tls_ca_key_bits cannot be changed once the CA is generated"), nil
+		}
+		config.CAKeyBits = v.(int)
+	}
+	if v, ok := d.GetOk("default_tls_client_key_type"); ok {
+		config.ClientKeyType = v.(string)
+	}
+	if v, ok := d.GetOk("default_tls_client_key_bits"); ok {
+		config.ClientKeyBits = v.(int)
+	}
+	if v, ok := d.GetOk("default_tls_client_ttl"); ok {
+		config.ClientTTL = time.Duration(v.(int)) * time.Second
+	}
+
+	if err := config.validate(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if ca == nil {
+		if ca, err = generateCA(config.CAKeyType, config.CAKeyBits); err != nil {
+			return nil, err
+		}
+		if err := storeCA(req.Storage, ca); err != nil {
+			return nil, err
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(configPath, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	if err := b.startServer(config, ca); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"the configuration was saved, but the KMIP server could not be started: %s", err)), nil
+	}
+
+	return nil, nil
+}
+
+func getConfig(s logical.Storage) (*kmipConfig, error) {
+	entry, err := s.Get(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result kmipConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+type kmipConfig struct {
+	ListenAddrs     []string      `json:"listen_addrs"`
+	ServerHostnames []string      `json:"server_hostnames"`
+	ServerIPs       []string      `json:"server_ips"`
+	CAKeyType       string        `json:"tls_ca_key_type"`
+	CAKeyBits       int           `json:"tls_ca_key_bits"`
+	ClientKeyType   string        `json:"default_tls_client_key_type"`
+	ClientKeyBits   int           `json:"default_tls_client_key_bits"`
+	ClientTTL       time.Duration `json:"default_tls_client_ttl"`
+}
+
+func (c *kmipConfig) validate() error {
+	if len(c.ListenAddrs) == 0 {
+		return fmt.Errorf("at least one listen address is required")
+	}
+	for _, addr := range c.ListenAddrs {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid listen address %q: %s", addr, err)
+		}
+	}
+	for _, ip := range c.ServerIPs {
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid server IP %q", ip)
+		}
+	}
+	if err := validateKeyParameters(c.CAKeyType, c.CAKeyBits); err != nil {
+		return fmt.Errorf("invalid CA key: %s", err)
+	}
+	if err := validateKeyParameters(c.ClientKeyType, c.ClientKeyBits); err != nil {
+		return fmt.Errorf("invalid default client key: %s", err)
+	}
+	if c.ClientTTL <= 0 {
+		return fmt.Errorf("default_tls_client_ttl must be greater than zero")
+	}
+	return nil
+}
+
+// validateKeyParameters checks the type and size of the keys of certificates
+func validateKeyParameters(keyType string, keyBits int) error {
+	switch keyType {
+	case "ec":
+		switch keyBits {
+		case 224, 256, 384, 521:
+			return nil
+		}
+		return fmt.Errorf("unsupported size %d for EC keys", keyBits)
+	case "rsa":
+		if keyBits < 2048 {
+			return fmt.Errorf("RSA keys must be at least 2048 bits")
+		}
+		return nil
+	}
+	return fmt.Errorf(`unknown key type %q, must be "ec" or "rsa"`, keyType)
+}
+
+func pathCA(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "ca",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathCARead,
+		},
+
+		HelpSynopsis:    pathCAHelpSyn,
+		HelpDescription: pathCAHelpDesc,
+	}
+}
+
+func (b *backend) pathCARead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ca, err := getCA(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if ca == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"ca_pem": ca.Certificate,
+		},
+	}, nil
+}
+
+const pathConfigHelpSyn = `
+Configure the KMIP server.
+`
+
+const pathConfigHelpDesc = `
+This path configures the addresses the KMIP server listens on, and the names
+included in its certificate. The first write to this path generates the CA of
+the backend, which issues the certificates of the server and of its clients,
+with the key type and size set by "tls_ca_key_type" and "tls_ca_key_bits".
+
+The server is restarted every time the configuration is written, with a newly
+issued certificate.
+`
+
+const pathCAHelpSyn = `
+Read the CA certificate of the KMIP server.
+`
+
+const pathCAHelpDesc = `
+This path returns the PEM encoded certificate of the CA which issues the
+certificates of the KMIP server and of its clients. Clients should use it to
+verify the KMIP server.
+`
@@ -0,0 +1,336 @@
+package kmip
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const credentialPath = "credentials/"
+
+func credentialFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"scope": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Name of the scope",
+		},
+		"role": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Name of the role",
+		},
+		"serial_number": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Serial number of the client certificate",
+		},
+		"format": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Default:     "pem",
+			Description: `Format of the certificate and private key: "pem", "pem_bundle" or "der"`,
+		},
+	}
+}
+
+func credentialPattern(suffix string) string {
+	return "scope/" + framework.GenericNameRegex("scope") + "/role/" + framework.GenericNameRegex("role") + "/credential" + suffix
+}
+
+func pathCredentialGenerate(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: credentialPattern("/generate$"),
+		Fields:  credentialFields(),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathCredentialGenerate,
+		},
+
+		HelpSynopsis:    pathCredentialGenerateHelpSyn,
+		HelpDescription: pathCredentialGenerateHelpDesc,
+	}
+}
+
+func pathCredentialLookup(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: credentialPattern("/lookup$"),
+		Fields:  credentialFields(),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathCredentialLookup,
+			logical.UpdateOperation: b.pathCredentialLookup,
+		},
+
+		HelpSynopsis:    pathCredentialLookupHelpSyn,
+		HelpDescription: pathCredentialLookupHelpDesc,
+	}
+}
+
+func pathCredentialRevoke(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: credentialPattern("/revoke$"),
+		Fields:  credentialFields(),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathCredentialRevoke,
+		},
+
+		HelpSynopsis:    pathCredentialRevokeHelpSyn,
+		HelpDescription: pathCredentialRevokeHelpDesc,
+	}
+}
+
+func pathListCredentials(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: credentialPattern("/?$"),
+		Fields:  credentialFields(),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathCredentialList,
+		},
+
+		HelpSynopsis:    pathListCredentialsHelpSyn,
+		HelpDescription: pathListCredentialsHelpDesc,
+	}
+}
+
+func (b *backend) pathCredentialGenerate(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	format := d.Get("format").(string)
+	switch format {
+	case "pem", "pem_bundle", "der":
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("unknown format %q", format)), nil
+	}
+
+	scope, roleName := d.Get("scope").(string), d.Get("role").(string)
+	role, err := getRole(req.Storage, scope, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %q does not exist in scope %q", roleName, scope)), nil
+	}
+
+	config, err := getConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := getCA(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || ca == nil {
+		return logical.ErrorResponse("the KMIP server is not configured"), nil
+	}
+	parsedCA, err := ca.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	keyType, keyBits, ttl := config.ClientKeyType, config.ClientKeyBits, config.ClientTTL
+	if role.TLSClientKeyType != "" {
+		keyType, keyBits = role.TLSClientKeyType, role.TLSClientKeyBits
+	}
+	if role.TLSClientTTL != 0 {
+		ttl = role.TLSClientTTL
+	}
+
+	commonName, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	// The scope and the role of the client are recorded in the subject of
+	// its certificate, which the KMIP server trusts as it is signed by the
+	// CA of the backend
+	parsed, err := issueCertificate(parsedCA, &certificateRequest{
+		Subject: pkix.Name{
+			CommonName:         commonName,
+			Organization:       []string{scope},
+			OrganizationalUnit: []string{roleName},
+		},
+		KeyType:     keyType,
+		KeyBits:     keyBits,
+		TTL:         ttl,
+		ExtKeyUsage: x509.ExtKeyUsageClientAuth,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	serial := formatSerial(parsed.SerialNumber)
+	cred := &credentialEntry{
+		SerialNumber: serial,
+		Certificate: strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: parsed.CertificateBytes,
+		}))),
+		Expiration: parsed.Certificate.NotAfter,
+	}
+	entry, err := logical.StorageEntryJSON(credentialPath+scope+"/"+roleName+"/"+serial, cred)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		"serial_number": serial,
+	}
+	switch format {
+	case "der":
+		data["certificate"] = base64.StdEncoding.EncodeToString(parsed.CertificateBytes)
+		data["private_key"] = base64.StdEncoding.EncodeToString(parsed.PrivateKeyBytes)
+		data["ca_chain"] = []string{base64.StdEncoding.EncodeToString(parsedCA.CertificateBytes)}
+
+	default:
+		bundle, err := parsed.ToCertBundle()
+		if err != nil {
+			return nil, err
+		}
+		data["certificate"] = bundle.Certificate
+		data["private_key"] = bundle.PrivateKey
+		data["ca_chain"] = []string{ca.Certificate}
+		if format == "pem_bundle" {
+			data["certificate"] = strings.Join([]string{bundle.PrivateKey, bundle.Certificate, ca.Certificate}, "\n")
+		}
+	}
+
+	return &logical.Response{
+		Data: data,
+	}, nil
+}
+
+func (b *backend) pathCredentialLookup(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	serial := d.Get("serial_number").(string)
+	if serial == "" {
+		return logical.ErrorResponse("serial_number is required"), nil
+	}
+
+	cred, err := getCredential(req.Storage, d.Get("scope").(string), d.Get("role").(string), serial)
+	if err != nil {
+		return nil, err
+	}
+	if cred == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"serial_number": cred.SerialNumber,
+			"certificate":   cred.Certificate,
+			"expiration":    cred.Expiration.Unix(),
+		},
+	}, nil
+}
+
+func (b *backend) pathCredentialRevoke(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	serial := d.Get("serial_number").(string)
+	if serial == "" {
+		return logical.ErrorResponse("serial_number is required"), nil
+	}
+
+	scope, role := d.Get("scope").(string), d.Get("role").(string)
+	if err := req.Storage.Delete(credentialPath + scope + "/" + role + "/" + serial); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathCredentialList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	serials, err := req.Storage.List(credentialPath + d.Get("scope").(string) + "/" + d.Get("role").(string) + "/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(serials), nil
+}
+
+func getCredential(s logical.Storage, scope, role, serial string) (*credentialEntry, error) {
+	entry, err := s.Get(credentialPath + scope + "/" + role + "/" + serial)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result credentialEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// formatSerial returns the serial number of a certificate in the format used
+// by the credential endpoints
+func formatSerial(serial *big.Int) string {
+	return certutil.GetHexFormatted(serial.Bytes(), ":")
+}
+
+// credentialEntry is a client certificate issued for a role. The KMIP server
+// rejects certificates whose credential is not stored, so deleting it revokes
+// the certificate.
+type credentialEntry struct {
+	SerialNumber string    `json:"serial_number"`
+	Certificate  string    `json:"certificate"`
+	Expiration   time.Time `json:"expiration"`
+}
+
+const pathCredentialGenerateHelpSyn = `
+Generate a client certificate for a role.
+`
+
+const pathCredentialGenerateHelpDesc = `
+This path generates a private key and issues a client certificate for the
+role, which KMIP clients use to authenticate to the KMIP server. The key
+type, key size and lifetime of the certificate are set by the role, or by the
+configuration.
+
+The private key is not stored and is only returned by this path.
+`
+
+const pathCredentialLookupHelpSyn = `
+Look up a client certificate issued for a role.
+`
+
+const pathCredentialLookupHelpDesc = `
+This path returns the certificate and expiration of a credential of the role,
+given its serial number.
+`
+
+const pathCredentialRevokeHelpSyn = `
+Revoke a client certificate issued for a role.
+`
+
+const pathCredentialRevokeHelpDesc = `
+This path revokes a credential of the role, given its serial number. The KMIP
+server rejects the requests made with the certificate once it is revoked,
+including on open connections.
+`
+
+const pathListCredentialsHelpSyn = `
+List the client certificates issued for a role.
+`
+
+const pathListCredentialsHelpDesc = `
+This path lists the serial numbers of the credentials of the role which have
+not been revoked.
+`
@@ -0,0 +1,287 @@
+package kmip
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const rolePath = "roles/"
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "scope/" + framework.GenericNameRegex("scope") + "/role/?$",
+		Fields: map[string]*framework.FieldSchema{
+			"scope": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the scope",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    pathRolesHelpSyn,
+		HelpDescription: pathRolesHelpDesc,
+	}
+}
+
+func pathRoles(b *backend) *framework.Path {
+	fields := map[string]*framework.FieldSchema{
+		"scope": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Name of the scope",
+		},
+		"role": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Name of the role",
+		},
+		"operation_all": &framework.FieldSchema{
+			Type:        framework.TypeBool,
+			Description: "Allow all the KMIP operations, including the ones supported in the future",
+		},
+		"operation_none": &framework.FieldSchema{
+			Type:        framework.TypeBool,
+			Description: "Remove all the KMIP operations allowed by the role",
+		},
+		"tls_client_key_type": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: `Type of the keys of client certificates, "ec" or "rsa". Defaults to the value of the configuration.`,
+		},
+		"tls_client_key_bits": &framework.FieldSchema{
+			Type:        framework.TypeInt,
+			Description: "Size of the keys of client certificates. Defaults to the value of the configuration.",
+		},
+		"tls_client_ttl": &framework.FieldSchema{
+			Type:        framework.TypeDurationSecond,
+			Description: "Lifetime of client certificates. Defaults to the value of the configuration.",
+		},
+	}
+	for _, name := range operationNames {
+		fields["operation_"+name] = &framework.FieldSchema{
+			Type:        framework.TypeBool,
+			Description: fmt.Sprintf("Allow the %s KMIP operation", name),
+		}
+	}
+
+	return &framework.Path{
+		Pattern: "scope/" + framework.GenericNameRegex("scope") + "/role/" + framework.GenericNameRegex("role") + "$",
+		Fields:  fields,
+
+		ExistenceCheck: b.pathRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathRoleWrite,
+			logical.UpdateOperation: b.pathRoleWrite,
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    pathRolesHelpSyn,
+		HelpDescription: pathRolesHelpDesc,
+	}
+}
+
+func (b *backend) pathRoleExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	role, err := getRole(req.Storage, d.Get("scope").(string), d.Get("role").(string))
+	if err != nil {
+		return false, err
+	}
+	return role != nil, nil
+}
+
+func (b *backend) pathRoleList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roles, err := req.Storage.List(rolePath + d.Get("scope").(string) + "/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathRoleRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := getRole(req.Storage, d.Get("scope").(string), d.Get("role").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	data := map[string]interface{}{
+		"operation_all":       role.OperationAll,
+		"tls_client_key_type": role.TLSClientKeyType,
+		"tls_client_key_bits": role.TLSClientKeyBits,
+		"tls_client_ttl":      int64(role.TLSClientTTL / time.Second),
+	}
+	for _, name := range operationNames {
+		data["operation_"+name] = strutil.StrListContains(role.Operations, name)
+	}
+
+	return &logical.Response{
+		Data: data,
+	}, nil
+}
+
+func (b *backend) pathRoleWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	scopeName := d.Get("scope").(string)
+	scope, err := getScope(req.Storage, scopeName)
+	if err != nil {
+		return nil, err
+	}
+	if scope == nil {
+		return logical.ErrorResponse(fmt.Sprintf("scope %q does not exist", scopeName)), nil
+	}
+
+	name := d.Get("role").(string)
+	role, err := getRole(req.Storage, scopeName, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role = &roleEntry{}
+	}
+
+	operationAll := d.Get("operation_all").(bool)
+	if operationAll && d.Get("operation_none").(bool) {
+		return logical.ErrorResponse("operation_all and operation_none cannot both be set"), nil
+	}
+	if v, ok := d.GetOk("operation_all"); ok {
+		role.OperationAll = v.(bool)
+	}
+	if d.Get("operation_none").(bool) {
+		role.OperationAll = false
+		role.Operations = nil
+	}
+
+	operations := make(map[string]bool, len(role.Operations))
+	for _, operation := range role.Operations {
+		operations[operation] = true
+	}
+	for _, operation := range operationNames {
+		if v, ok := d.GetOk("operation_" + operation); ok {
+			operations[operation] = v.(bool)
+		}
+	}
+	role.Operations = nil
+	for operation, allowed := range operations {
+		if allowed {
+			role.Operations = append(role.Operations, operation)
+		}
+	}
+	sort.Strings(role.Operations)
+
+	if v, ok := d.GetOk("tls_client_key_type"); ok {
+		role.TLSClientKeyType = v.(string)
+	}
+	if v, ok := d.GetOk("tls_client_key_bits"); ok {
+		role.TLSClientKeyBits = v.(int)
+	}
+	if v, ok := d.GetOk("tls_client_ttl"); ok {
+		role.TLSClientTTL = time.Duration(v.(int)) * time.Second
+	}
+
+	if role.TLSClientKeyType != "" || role.TLSClientKeyBits != 0 {
+		if role.TLSClientKeyType == "" || role.TLSClientKeyBits == 0 {
+			return logical.ErrorResponse("tls_client_key_type and tls_client_key_bits must be set together"), nil
+		}
+		if err := validateKeyParameters(role.TLSClientKeyType, role.TLSClientKeyBits); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+	if role.TLSClientTTL < 0 {
+		return logical.ErrorResponse("tls_client_ttl cannot be negative"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(rolePath+scopeName+"/"+name, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathRoleDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if err := deleteRole(req.Storage, d.Get("scope").(string), d.Get("role").(string)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func getRole(s logical.Storage, scope, name string) (*roleEntry, error) {
+	entry, err := s.Get(rolePath + scope + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result roleEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// deleteRole deletes a role along with the credentials issued for it
+func deleteRole(s logical.Storage, scope, name string) error {
+	prefix := credentialPath + scope + "/" + name + "/"
+	serials, err := s.List(prefix)
+	if err != nil {
+		return err
+	}
+	for _, serial := range serials {
+		if err := s.Delete(prefix + serial); err != nil {
+			return err
+		}
+	}
+	return s.Delete(rolePath + scope + "/" + name)
+}
+
+type roleEntry struct {
+	OperationAll     bool          `json:"operation_all"`
+	Operations       []string      `json:"operations"`
+	TLSClientKeyType string        `json:"tls_client_key_type"`
+	TLSClientKeyBits int           `json:"tls_client_key_bits"`
+	TLSClientTTL     time.Duration `json:"tls_client_ttl"`
+}
+
+// allowed returns whether the role allows the given KMIP operation
+func (r *roleEntry) allowed(operation string) bool {
+	return r.OperationAll || strutil.StrListContains(r.Operations, operation)
+}
+
+const pathRolesHelpSyn = `
+Manage the roles of a scope.
+`
+
+const pathRolesHelpDesc = `
+Roles set the KMIP operations allowed to the clients holding the credentials
+issued for them, with the "operation_<name>" fields, or with "operation_all"
+to allow every operation. Setting "operation_none" removes all the allowed
+operations.
+
+Roles also set the key type, key size and lifetime of the client
+certificates issued for them, which otherwise default to the values of the
+configuration.
+
+Deleting a role revokes the credentials issued for it.
+`
@@ -0,0 +1,154 @@
+package kmip
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const scopePath = "scopes/"
+
+func pathListScopes(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "scope/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathScopeList,
+		},
+
+		HelpSynopsis:    pathScopesHelpSyn,
+		HelpDescription: pathScopesHelpDesc,
+	}
+}
+
+func pathScopes(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "scope/" + framework.GenericNameRegex("scope") + "$",
+		Fields: map[string]*framework.FieldSchema{
+			"scope": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the scope",
+			},
+			"force": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: "Delete the scope even if it has managed objects, destroying them",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathScopeWrite,
+			logical.DeleteOperation: b.pathScopeDelete,
+		},
+
+		HelpSynopsis:    pathScopesHelpSyn,
+		HelpDescription: pathScopesHelpDesc,
+	}
+}
+
+func (b *backend) pathScopeList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	scopes, err := req.Storage.List(scopePath)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(scopes), nil
+}
+
+func (b *backend) pathScopeWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	name := d.Get("scope").(string)
+	scope, err := getScope(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if scope != nil {
+		return nil, nil
+	}
+
+	entry, err := logical.StorageEntryJSON(scopePath+name, &scopeEntry{
+		CreationTime: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathScopeDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	name := d.Get("scope").(string)
+	objects, err := req.Storage.List(objectPath + name + "/")
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) != 0 && !d.Get("force").(bool) {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"the scope has %d managed objects, set force to delete it along with them", len(objects))), nil
+	}
+
+	for _, id := range objects {
+		if err := req.Storage.Delete(objectPath + name + "/" + id); err != nil {
+			return nil, err
+		}
+	}
+
+	roles, err := req.Storage.List(rolePath + name + "/")
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		if err := deleteRole(req.Storage, name, role); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := req.Storage.Delete(scopePath + name); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func getScope(s logical.Storage, name string) (*scopeEntry, error) {
+	entry, err := s.Get(scopePath + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result scopeEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+type scopeEntry struct {
+	CreationTime time.Time `json:"creation_time"`
+}
+
+const pathScopesHelpSyn = `
+Manage the scopes of the KMIP server.
+`
+
+const pathScopesHelpDesc = `
+Scopes partition the managed objects of the KMIP server: clients only see and
+operate on the objects of the scope of their role. Writing to a scope creates
+it.
+
+Deleting a scope deletes its roles and revokes the credentials issued for
+them. A scope which still has managed objects is only deleted if "force" is
+set, in which case its objects are destroyed.
+`
@@ -0,0 +1,354 @@
+package kmip
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// maxMessageLength is the maximum length of the requests accepted by
+	// the server
+	maxMessageLength = 1024 * 1024
+
+	// connectionIdleTimeout closes the connections of clients which do not
+	// send requests
+	connectionIdleTimeout = 5 * time.Minute
+)
+
+// server is the KMIP server of the backend
+type server struct {
+	b         *backend
+	tlsConfig *tls.Config
+	listeners []net.Listener
+
+	wg     sync.WaitGroup
+	stopCh chan struct{}
+
+	connsLock sync.Mutex
+	conns     map[net.Conn]struct{}
+}
+
+// newServer issues a certificate for the server and starts listening on the
+// configured addresses
+func newServer(b *backend, config *kmipConfig, ca *caBundle) (*server, error) {
+	parsedCA, err := ca.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []net.IP
+	for _, ip := range config.ServerIPs {
+		ips = append(ips, net.ParseIP(ip))
+	}
+	commonName := "vault-kmip-server"
+	if len(config.ServerHostnames) != 0 {
+		commonName = config.ServerHostnames[0]
+	}
+
+	cert, err := issueCertificate(parsedCA, &certificateRequest{
+		Subject: pkix.Name{
+			CommonName: commonName,
+		},
+		DNSNames:    config.ServerHostnames,
+		IPAddresses: ips,
+		KeyType:     config.CAKeyType,
+		KeyBits:     config.CAKeyBits,
+		TTL:         serverCertificateTTL,
+		ExtKeyUsage: x509.ExtKeyUsageServerAuth,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error issuing the server certificate: %s", err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(parsedCA.Certificate)
+
+	s := &server{
+		b: b,
+		tlsConfig: &tls.Config{
+			Certificates: []tls.Certificate{
+				{
+					Certificate: [][]byte{cert.CertificateBytes, parsedCA.CertificateBytes},
+					PrivateKey:  cert.PrivateKey,
+					Leaf:        cert.Certificate,
+				},
+			},
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  clientCAs,
+			MinVersion: tls.VersionTLS12,
+		},
+		stopCh: make(chan struct{}),
+		conns:  make(map[net.Conn]struct{}),
+	}
+
+	for _, addr := range config.ListenAddrs {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			s.Stop()
+			return nil, fmt.Errorf("error listening on %s: %s", addr, err)
+		}
+		s.listeners = append(s.listeners, ln)
+	}
+
+	for _, ln := range s.listeners {
+		s.wg.Add(1)
+		go s.serve(tls.NewListener(ln, s.tlsConfig))
+	}
+
+	return s, nil
+}
+
+// Addrs returns the addresses the server listens on
+func (s *server) Addrs() []string {
+	var ret []string
+	for _, ln := range s.listeners {
+		ret = append(ret, ln.Addr().String())
+	}
+	return ret
+}
+
+// Stop closes the listeners and the connections of the server, and waits
+// for the requests being handled to complete
+func (s *server) Stop() {
+	close(s.stopCh)
+	for _, ln := range s.listeners {
+		ln.Close()
+	}
+
+	s.connsLock.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.connsLock.Unlock()
+
+	s.wg.Wait()
+}
+
+func (s *server) serve(ln net.Listener) {
+	defer s.wg.Done()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-s.stopCh:
+				return
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			s.b.Logger().Error("kmip: error accepting connection", "error", err)
+			return
+		}
+
+		s.connsLock.Lock()
+		select {
+		case <-s.stopCh:
+			s.connsLock.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.connsLock.Unlock()
+
+		go s.handleConn(conn.(*tls.Conn))
+	}
+}
+
+func (s *server) handleConn(conn *tls.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.connsLock.Lock()
+		delete(s.conns, conn)
+		s.connsLock.Unlock()
+		conn.Close()
+	}()
+
+	conn.SetDeadline(time.Now().Add(connectionIdleTimeout))
+	if err := conn.Handshake(); err != nil {
+		if s.b.Logger().IsDebug() {
+			s.b.Logger().Debug("kmip: TLS handshake failed", "remote_addr", conn.RemoteAddr(), "error", err)
+		}
+		return
+	}
+
+	client, err := newClientIdentity(conn.ConnectionState().PeerCertificates)
+	if err != nil {
+		s.b.Logger().Warn("kmip: rejected client certificate", "remote_addr", conn.RemoteAddr(), "error", err)
+		return
+	}
+
+	for {
+		conn.SetDeadline(time.Now().Add(connectionIdleTimeout))
+
+		header := make([]byte, ttlvHeaderLength)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		length := binary.BigEndian.Uint32(header[4:])
+		if length > maxMessageLength {
+			s.writeMessage(conn, invalidMessageResponse(fmt.Sprintf("the request exceeds %d bytes", maxMessageLength)))
+			return
+		}
+
+		buf := make([]byte, ttlvHeaderLength+int(length))
+		copy(buf, header)
+		if _, err := io.ReadFull(conn, buf[ttlvHeaderLength:]); err != nil {
+			return
+		}
+
+		request, _, err := decodeTTLV(buf)
+		if err != nil || request.Tag != tagRequestMessage || request.Type != typeStructure {
+			s.writeMessage(conn, invalidMessageResponse("the request is not a valid KMIP request message"))
+			return
+		}
+
+		if !s.writeMessage(conn, s.handleRequest(client, request)) {
+			return
+		}
+	}
+}
+
+func (s *server) writeMessage(conn net.Conn, message *item) bool {
+	encoded, err := encodeTTLV(message)
+	if err != nil {
+		s.b.Logger().Error("kmip: error encoding response", "error", err)
+		return false
+	}
+	_, err = conn.Write(encoded)
+	return err == nil
+}
+
+// clientIdentity is the scope and role of a client, from its certificate
+type clientIdentity struct {
+	Scope        string
+	Role         string
+	SerialNumber string
+}
+
+func newClientIdentity(certs []*x509.Certificate) (*clientIdentity, error) {
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no client certificate")
+	}
+	cert := certs[0]
+	if len(cert.Subject.Organization) != 1 || len(cert.Subject.OrganizationalUnit) != 1 {
+		return nil, fmt.Errorf("the certificate was not issued for a role")
+	}
+
+	return &clientIdentity{
+		Scope:        cert.Subject.Organization[0],
+		Role:         cert.Subject.OrganizationalUnit[0],
+		SerialNumber: formatSerial(cert.SerialNumber),
+	}, nil
+}
+
+// handleRequest performs the batch items of a request message, and returns
+// the response message
+func (s *server) handleRequest(client *clientIdentity, request *item) *item {
+	version := [2]int32{1, 0}
+	if v := request.Child(tagRequestHeader).Child(tagProtocolVersion); v != nil {
+		version[0], _ = v.Child(tagProtocolVersionMajor).Integer()
+		version[1], _ = v.Child(tagProtocolVersionMinor).Integer()
+	}
+
+	batchItems := request.ChildrenWithTag(tagBatchItem)
+	response := structure(tagResponseMessage,
+		structure(tagResponseHeader,
+			protocolVersion(version),
+			dateTime(tagTimeStamp, time.Now().UTC()),
+			integer(tagBatchCount, int32(len(batchItems))),
+		),
+	)
+
+	for _, batchItem := range batchItems {
+		operation, _ := batchItem.Child(tagOperation).Enumeration()
+		responseItem := structure(tagBatchItem,
+			enumeration(tagOperation, operation),
+		)
+		if id := batchItem.Child(tagUniqueBatchItemID); id != nil {
+			responseItem.Add(id)
+		}
+
+		payload, err := s.handleOperation(client, operation, batchItem.Child(tagRequestPayload))
+		if err != nil {
+			kerr, ok := err.(*kmipError)
+			if !ok {
+				s.b.Logger().Error("kmip: error performing operation", "operation", operationNames[operation], "scope", client.Scope, "error", err)
+				kerr = newKMIPError(resultReasonGeneralFailure, "internal error")
+			}
+			responseItem.Add(
+				enumeration(tagResultStatus, resultStatusOperationFailed),
+				enumeration(tagResultReason, kerr.Reason),
+				textString(tagResultMessage, kerr.Message),
+			)
+		} else {
+			responseItem.Add(
+				enumeration(tagResultStatus, resultStatusSuccess),
+				payload,
+			)
+		}
+		response.Add(responseItem)
+	}
+
+	return response
+}
+
+// handleOperation checks that the credential of the client is valid and
+// that its role allows the operation, and performs it
+func (s *server) handleOperation(client *clientIdentity, operation uint32, payload *item) (*item, error) {
+	s.b.lock.Lock()
+	defer s.b.lock.Unlock()
+
+	cred, err := getCredential(s.b.view, client.Scope, client.Role, client.SerialNumber)
+	if err != nil {
+		return nil, err
+	}
+	if cred == nil {
+		return nil, newKMIPError(resultReasonPermissionDenied, "the client certificate was revoked")
+	}
+	role, err := getRole(s.b.view, client.Scope, client.Role)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, newKMIPError(resultReasonPermissionDenied, "the role of the client does not exist")
+	}
+
+	name, ok := operationNames[operation]
+	if !ok {
+		return nil, newKMIPError(resultReasonOperationNotSupported, "operation %d is not supported", operation)
+	}
+	if !role.allowed(name) {
+		return nil, newKMIPError(resultReasonPermissionDenied, "the %s operation is not allowed by the role", name)
+	}
+
+	return operations[operation](s.b.view, client.Scope, payload)
+}
+
+// invalidMessageResponse returns the response to a request which cannot be
+// decoded
+func invalidMessageResponse(message string) *item {
+	return structure(tagResponseMessage,
+		structure(tagResponseHeader,
+			protocolVersion(supportedProtocolVersions[0]),
+			dateTime(tagTimeStamp, time.Now().UTC()),
+			integer(tagBatchCount, 1),
+		),
+		structure(tagBatchItem,
+			enumeration(tagResultStatus, resultStatusOperationFailed),
+			enumeration(tagResultReason, resultReasonInvalidMessage),
+			textString(tagResultMessage, message),
+		),
+	)
+}
@@ -0,0 +1,302 @@
+package kmip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// The item types of the TTLV encoding of KMIP
+const (
+	typeStructure   byte = 0x01
+	typeInteger     byte = 0x02
+	typeLongInteger byte = 0x03
+	typeBigInteger  byte = 0x04
+	typeEnumeration byte = 0x05
+	typeBoolean     byte = 0x06
+	typeTextString  byte = 0x07
+	typeByteString  byte = 0x08
+	typeDateTime    byte = 0x09
+	typeInterval    byte = 0x0A
+)
+
+// ttlvHeaderLength is the length of the tag, type and length of an item
+const ttlvHeaderLength = 8
+
+// item is a TTLV encoded item. The type of Value depends on the type of the
+// item: []*item for structures, int32 for integers, int64 for long integers,
+// uint32 for enumerations and intervals, bool for booleans, string for text
+// strings, []byte for byte strings and big integers, and time.Time for date
+// times.
+type item struct {
+	Tag   uint32
+	Type  byte
+	Value interface{}
+}
+
+func structure(tag uint32, children ...*item) *item {
+	return &item{Tag: tag, Type: typeStructure, Value: children}
+}
+
+func integer(tag uint32, value int32) *item {
+	return &item{Tag: tag, Type: typeInteger, Value: value}
+}
+
+func enumeration(tag uint32, value uint32) *item {
+	return &item{Tag: tag, Type: typeEnumeration, Value: value}
+}
+
+func boolean(tag uint32, value bool) *item {
+	return &item{Tag: tag, Type: typeBoolean, Value: value}
+}
+
+func textString(tag uint32, value string) *item {
+	return &item{Tag: tag, Type: typeTextString, Value: value}
+}
+
+func byteString(tag uint32, value []byte) *item {
+	return &item{Tag: tag, Type: typeByteString, Value: value}
+}
+
+func dateTime(tag uint32, value time.Time) *item {
+	return &item{Tag: tag, Type: typeDateTime, Value: value}
+}
+
+// Children returns the items of a structure, or nil if the item is not a
+// structure
+func (i *item) Children() []*item {
+	if i == nil {
+		return nil
+	}
+	children, _ := i.Value.([]*item)
+	return children
+}
+
+// Child returns the first item of a structure with the given tag, or nil if
+// there is none
+func (i *item) Child(tag uint32) *item {
+	for _, child := range i.Children() {
+		if child.Tag == tag {
+			return child
+		}
+	}
+	return nil
+}
+
+// ChildrenWithTag returns the items of a structure with the given tag
+func (i *item) ChildrenWithTag(tag uint32) []*item {
+	var ret []*item
+	for _, child := range i.Children() {
+		if child.Tag == tag {
+			ret = append(ret, child)
+		}
+	}
+	return ret
+}
+
+// Add appends items to a structure
+func (i *item) Add(children ...*item) {
+	i.Value = append(i.Children(), children...)
+}
+
+func (i *item) Integer() (int32, bool) {
+	if i == nil || i.Type != typeInteger {
+		return 0, false
+	}
+	return i.Value.(int32), true
+}
+
+func (i *item) Enumeration() (uint32, bool) {
+	if i == nil || i.Type != typeEnumeration {
+		return 0, false
+	}
+	return i.Value.(uint32), true
+}
+
+func (i *item) TextString() (string, bool) {
+	if i == nil || i.Type != typeTextString {
+		return "", false
+	}
+	return i.Value.(string), true
+}
+
+func (i *item) ByteString() ([]byte, bool) {
+	if i == nil || i.Type != typeByteString {
+		return nil, false
+	}
+	return i.Value.([]byte), true
+}
+
+// encodeTTLV returns the TTLV encoding of an item
+func encodeTTLV(i *item) ([]byte, error) {
+	var value []byte
+	switch i.Type {
+	case typeStructure:
+		for _, child := range i.Children() {
+			encoded, err := encodeTTLV(child)
+			if err != nil {
+				return nil, err
+			}
+			value = append(value, encoded...)
+		}
+
+	case typeInteger:
+		v, ok := i.Value.(int32)
+		if !ok {
+			return nil, fmt.Errorf("invalid value for integer item %06x", i.Tag)
+		}
+		value = make([]byte, 4)
+		binary.BigEndian.PutUint32(value, uint32(v))
+
+	case typeEnumeration, typeInterval:
+		v, ok := i.Value.(uint32)
+		if !ok {
+			return nil, fmt.Errorf("invalid value for item %06x", i.Tag)
+		}
+		value = make([]byte, 4)
+		binary.BigEndian.PutUint32(value, v)
+
+	case typeLongInteger:
+		v, ok := i.Value.(int64)
+		if !ok {
+			return nil, fmt.Errorf("invalid value for long integer item %06x", i.Tag)
+		}
+		value = make([]byte, 8)
+		binary.BigEndian.PutUint64(value, uint64(v))
+
+	case typeBoolean:
+		v, ok := i.Value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("invalid value for boolean item %06x", i.Tag)
+		}
+		value = make([]byte, 8)
+		if v {
+			value[7] = 1
+		}
+
+	case typeDateTime:
+		v, ok := i.Value.(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("invalid value for date time item %06x", i.Tag)
+		}
+		value = make([]byte, 8)
+		binary.BigEndian.PutUint64(value, uint64(v.Unix()))
+
+	case typeTextString:
+		v, ok := i.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid value for text string item %06x", i.Tag)
+		}
+		value = []byte(v)
+
+	case typeByteString, typeBigInteger:
+		v, ok := i.Value.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("invalid value for item %06x", i.Tag)
+		}
+		value = v
+
+	default:
+		return nil, fmt.Errorf("unknown type %d for item %06x", i.Type, i.Tag)
+	}
+
+	ret := make([]byte, ttlvHeaderLength, ttlvHeaderLength+paddedLength(len(value)))
+	ret[0] = byte(i.Tag >> 16)
+	ret[1] = byte(i.Tag >> 8)
+	ret[2] = byte(i.Tag)
+	ret[3] = i.Type
+	binary.BigEndian.PutUint32(ret[4:], uint32(len(value)))
+	ret = append(ret, value...)
+	return append(ret, make([]byte, paddedLength(len(value))-len(value))...), nil
+}
+
+// decodeTTLV decodes the item at the start of the buffer, and returns the
+// number of bytes it used
+func decodeTTLV(buf []byte) (*item, int, error) {
+	if len(buf) < ttlvHeaderLength {
+		return nil, 0, fmt.Errorf("truncated item header")
+	}
+
+	i := &item{
+		Tag:  uint32(buf[0])<<16 | uint32(buf[1])<<8 | uint32(buf[2]),
+		Type: buf[3],
+	}
+	length := int(binary.BigEndian.Uint32(buf[4:8]))
+	if length < 0 || length > len(buf)-ttlvHeaderLength {
+		return nil, 0, fmt.Errorf("truncated value for item %06x", i.Tag)
+	}
+	value := buf[ttlvHeaderLength : ttlvHeaderLength+length]
+
+	used := ttlvHeaderLength + paddedLength(length)
+	if used > len(buf) {
+		used = len(buf)
+	}
+
+	fixedLength := func(expected int) error {
+		if length != expected {
+			return fmt.Errorf("invalid length %d for item %06x", length, i.Tag)
+		}
+		return nil
+	}
+
+	switch i.Type {
+	case typeStructure:
+		children := []*item{}
+		for len(value) > 0 {
+			child, n, err := decodeTTLV(value)
+			if err != nil {
+				return nil, 0, err
+			}
+			children = append(children, child)
+			value = value[n:]
+		}
+		i.Value = children
+
+	case typeInteger:
+		if err := fixedLength(4); err != nil {
+			return nil, 0, err
+		}
+		i.Value = int32(binary.BigEndian.Uint32(value))
+
+	case typeEnumeration, typeInterval:
+		if err := fixedLength(4); err != nil {
+			return nil, 0, err
+		}
+		i.Value = binary.BigEndian.Uint32(value)
+
+	case typeLongInteger:
+		if err := fixedLength(8); err != nil {
+			return nil, 0, err
+		}
+		i.Value = int64(binary.BigEndian.Uint64(value))
+
+	case typeBoolean:
+		if err := fixedLength(8); err != nil {
+			return nil, 0, err
+		}
+		i.Value = binary.BigEndian.Uint64(value) != 0
+
+	case typeDateTime:
+		if err := fixedLength(8); err != nil {
+			return nil, 0, err
+		}
+		i.Value = time.Unix(int64(binary.BigEndian.Uint64(value)), 0).UTC()
+
+	case typeTextString:
+		i.Value = string(value)
+
+	case typeByteString, typeBigInteger:
+		i.Value = append([]byte(nil), value...)
+
+	default:
+		return nil, 0, fmt.Errorf("unknown type %d for item %06x", i.Type, i.Tag)
+	}
+
+	return i, used, nil
+}
+
+// paddedLength returns the length of a value padded to a multiple of eight
+// bytes
+func paddedLength(length int) int {
+	return (length + 7) / 8 * 8
+}
@@ -0,0 +1,97 @@
+package kmip
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTTLV_encoding(t *testing.T) {
+	// Test vectors from the KMIP 1.2 specification
+	cases := []struct {
+		item     *item
+		expected string
+	}{
+		{
+			integer(0x420020, 8),
+			"420020 02 00000004 0000000800000000",
+		},
+		{
+			textString(0x420020, "Hello World"),
+			"420020 07 0000000B 48656C6C6F20576F726C640000000000",
+		},
+		{
+			byteString(0x420020, []byte{1, 2, 3}),
+			"420020 08 00000003 0102030000000000",
+		},
+		{
+			boolean(0x420020, true),
+			"420020 06 00000008 0000000000000001",
+		},
+		{
+			dateTime(0x420020, time.Unix(0x47DA67F8, 0).UTC()),
+			"420020 09 00000008 0000000047DA67F8",
+		},
+		{
+			structure(0x420020,
+				enumeration(0x420004, 254),
+				integer(0x420005, 255),
+			),
+			"420020 01 00000020 420004 05 00000004 000000FE00000000 420005 02 00000004 000000FF00000000",
+		},
+	}
+
+	for _, tc := range cases {
+		expected, err := hex.DecodeString(strings.Replace(tc.expected, " ", "", -1))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		encoded, err := encodeTTLV(tc.item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded, expected) {
+			t.Fatalf("bad encoding of %#v:\nexpected %x\ngot      %x", tc.item, expected, encoded)
+		}
+
+		decoded, n, err := decodeTTLV(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(encoded) {
+			t.Fatalf("decoded %d bytes out of %d", n, len(encoded))
+		}
+		if !reflect.DeepEqual(decoded, tc.item) {
+			t.Fatalf("bad decoding:\nexpected %#v\ngot      %#v", tc.item, decoded)
+		}
+	}
+}
+
+func TestTTLV_invalid(t *testing.T) {
+	cases := []string{
+		// Truncated header
+		"420020 02 0000",
+		// Truncated value
+		"420020 07 00000010 48656C6C6F",
+		// Invalid length for an integer
+		"420020 02 00000008 0000000000000008",
+		// Unknown type
+		"420020 0F 00000000",
+		// Truncated item in a structure
+		"420020 01 00000008 420004 05 0000",
+	}
+
+	for _, tc := range cases {
+		buf, err := hex.DecodeString(strings.Replace(tc, " ", "", -1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := decodeTTLV(buf); err == nil {
+			t.Fatalf("expected an error decoding %s", tc)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package ldap
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	b := backend{
+		client: client{},
+	}
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		PathsSpecial: &logical.Paths{
+			Root: []string{
+				"library/manage/*",
+			},
+		},
+
+		Paths: []*framework.Path{
+			pathConfig(&b),
+			pathRotateRoot(&b),
+			pathListStaticRoles(&b),
+			pathStaticRoles(&b),
+			pathStaticCreds(&b),
+			pathRotateRole(&b),
+			pathListDynamicRoles(&b),
+			pathDynamicRoles(&b),
+			pathDynamicCreds(&b),
+			pathListLibraries(&b),
+			pathLibraries(&b),
+			pathLibraryCheckOut(&b),
+			pathLibraryCheckIn(&b),
+			pathLibraryManageCheckIn(&b),
+			pathLibraryStatus(&b),
+		},
+
+		Secrets: []*framework.Secret{
+			secretDynamicUser(&b),
+			secretLibraryAccount(&b),
+		},
+
+		PeriodicFunc: b.periodicFunc,
+	}
+
+	return &b
+}
+
+type backend struct {
+	*framework.Backend
+
+	client ldapClient
+
+	// rotationLock guards the rotation of the bind password and of the
+	// passwords of static roles
+	rotationLock sync.Mutex
+
+	// libraryLock guards the libraries and the check-outs of their accounts
+	libraryLock sync.Mutex
+}
+
+func (b *backend) periodicFunc(req *logical.Request) error {
+	return b.rotateStaticRoles(req.Storage)
+}
+
+const backendHelp = `
+The LDAP backend manages the passwords of LDAP and Active Directory entries.
+
+Static roles rotate the password of an existing entry, on demand and on a
+schedule, and serve its current password. Libraries are sets of shared
+service accounts that can be checked out, with their password rotated when
+they are checked back in. Dynamic roles create entries from LDIF templates,
+which are deleted when their lease is revoked.
+
+After mounting this backend, the LDAP server and the credentials Vault uses
+to manage it must be configured with the "config" endpoint.
+`
@@ -0,0 +1,602 @@
+package ldap
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// fakeLDAP is an in-memory ldapClient whose entries are keyed by DN
+type fakeLDAP struct {
+	sync.Mutex
+	passwords map[string]string
+	entries   map[string]*ldifEntry
+
+	// failAdd makes added entries with this DN fail
+	failAdd string
+}
+
+func newFakeLDAP() *fakeLDAP {
+	return &fakeLDAP{
+		passwords: map[string]string{
+			"cn=admin,dc=example,dc=com":            "admin-password",
+			"cn=app,ou=users,dc=example,dc=com":     "app-password",
+			"cn=shared1,ou=users,dc=example,dc=com": "shared1-password",
+			"cn=shared2,ou=users,dc=example,dc=com": "shared2-password",
+		},
+		entries: map[string]*ldifEntry{},
+	}
+}
+
+func (f *fakeLDAP) FindDN(config *ldapConfig, username string) (string, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	dn := fmt.Sprintf("%s=%s,%s", config.UserAttr, username, config.UserDN)
+	if _, ok := f.passwords[dn]; !ok {
+		return "", fmt.Errorf("no entry found for %q", username)
+	}
+	return dn, nil
+}
+
+func (f *fakeLDAP) UpdatePassword(config *ldapConfig, dn, password string) error {
+	f.Lock()
+	defer f.Unlock()
+
+	if _, ok := f.passwords[dn]; !ok {
+		return fmt.Errorf("no such entry %q", dn)
+	}
+	f.passwords[dn] = password
+	return nil
+}
+
+func (f *fakeLDAP) Execute(config *ldapConfig, entries []*ldifEntry) error {
+	f.Lock()
+	defer f.Unlock()
+
+	for _, entry := range entries {
+		switch entry.ChangeType {
+		case changeTypeAdd:
+			if entry.DN == f.failAdd {
+				return fmt.Errorf("cannot add %q", entry.DN)
+			}
+			f.entries[entry.DN] = entry
+		case changeTypeDelete:
+			delete(f.entries, entry.DN)
+		}
+	}
+	return nil
+}
+
+func testBackend(t *testing.T) (*backend, logical.Storage, *fakeLDAP) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := newFakeLDAP()
+	b.client = fake
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"binddn":   "cn=admin,dc=example,dc=com",
+			"bindpass": "admin-password",
+			"userdn":   "ou=users,dc=example,dc=com",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	return b, config.StorageView, fake
+}
+
+func TestBackend_config(t *testing.T) {
+	b, storage, _ := testBackend(t)
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if _, ok := resp.Data["bindpass"]; ok {
+		t.Fatalf("bind password returned: %#v", resp.Data)
+	}
+	if resp.Data["userattr"] != "cn" || resp.Data["url"] != "ldap://127.0.0.1" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"password_length": 8,
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for a short password length, got err:%s resp:%#v", err, resp)
+	}
+}
+
+func TestBackend_rotateRoot(t *testing.T) {
+	b, storage, fake := testBackend(t)
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "rotate-root",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	password := fake.passwords["cn=admin,dc=example,dc=com"]
+	if password == "admin-password" || len(password) != defaultPasswordLength {
+		t.Fatalf("bad password: %q", password)
+	}
+	config, err := getConfig(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.BindPassword != password {
+		t.Fatalf("stored password %q does not match %q", config.BindPassword, password)
+	}
+}
+
+func TestBackend_staticRole(t *testing.T) {
+	b, storage, fake := testBackend(t)
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "static-role/app",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"username":        "app",
+			"rotation_period": "1h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	readCreds := func() map[string]interface{} {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "static-cred/app",
+			Storage:   storage,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+		return resp.Data
+	}
+
+	creds := readCreds()
+	first := creds["password"].(string)
+	if creds["dn"] != "cn=app,ou=users,dc=example,dc=com" || first != fake.passwords["cn=app,ou=users,dc=example,dc=com"] {
+		t.Fatalf("bad: %#v", creds)
+	}
+	if ttl := creds["ttl"].(int64); ttl <= 0 || ttl > 3600 {
+		t.Fatalf("bad ttl: %d", ttl)
+	}
+
+	// The entry of a static role cannot change
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "static-role/app",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"username": "other",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error changing the username, got err:%s resp:%#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "rotate-role/app",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	second := readCreds()["password"].(string)
+	if second == first || second != fake.passwords["cn=app,ou=users,dc=example,dc=com"] {
+		t.Fatalf("password not rotated: %q", second)
+	}
+
+	// The periodic function only rotates the roles whose period elapsed
+	if err := b.rotateStaticRoles(storage); err != nil {
+		t.Fatal(err)
+	}
+	if readCreds()["password"] != second {
+		t.Fatal("password rotated before its rotation period")
+	}
+
+	role, err := staticRoleRead(storage, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	role.LastVaultRotation = time.Now().Add(-2 * time.Hour)
+	if err := storeStaticRole(storage, "app", role); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.rotateStaticRoles(storage); err != nil {
+		t.Fatal(err)
+	}
+	if readCreds()["password"] == second {
+		t.Fatal("password not rotated after its rotation period")
+	}
+}
+
+func TestBackend_dynamicRole(t *testing.T) {
+	b, storage, fake := testBackend(t)
+
+	creation := `
+dn: cn={{.Username}},ou=users,dc=example,dc=com
+objectClass: person
+cn: {{.Username}}
+userPassword: {{.Password}}
+
+dn: cn=admins,ou=groups,dc=example,dc=com
+changetype: modify
+add: member
+member: cn={{.Username}},ou=users,dc=example,dc=com
+-
+`
+	deletion := `
+dn: cn={{.Username}},ou=users,dc=example,dc=com
+changetype: delete
+`
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "role/dyn",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"creation_ldif": "dn: cn={{.Username}\n",
+			"deletion_ldif": deletion,
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for an invalid template, got err:%s resp:%#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "role/dyn",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"creation_ldif":     creation,
+			"deletion_ldif":     deletion,
+			"username_template": "v_{{.RoleName}}_{{random 8}}",
+			"default_ttl":       "1h",
+			"max_ttl":           "2h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "creds/dyn",
+		Storage:     storage,
+		DisplayName: "token",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp.Secret.TTL != time.Hour {
+		t.Fatalf("bad ttl: %s", resp.Secret.TTL)
+	}
+
+	username := resp.Data["username"].(string)
+	if !strings.HasPrefix(username, "v_dyn_") {
+		t.Fatalf("bad username: %q", username)
+	}
+	dn := "cn=" + username + ",ou=users,dc=example,dc=com"
+	if !reflect.DeepEqual(resp.Data["distinguished_names"], []string{dn}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	entry, ok := fake.entries[dn]
+	if !ok {
+		t.Fatalf("entry %q not created", dn)
+	}
+	if entry.Attributes[2].Values[0] != resp.Data["password"] {
+		t.Fatalf("bad password attribute: %#v", entry.Attributes[2])
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   storage,
+		Secret: &logical.Secret{
+			InternalData: map[string]interface{}{
+				"secret_type":   SecretDynamicUserType,
+				"role":          resp.Secret.InternalData["role"],
+				"username":      resp.Secret.InternalData["username"],
+				"deletion_ldif": resp.Secret.InternalData["deletion_ldif"],
+			},
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if _, ok := fake.entries[dn]; ok {
+		t.Fatalf("entry %q not deleted", dn)
+	}
+}
+
+func TestBackend_dynamicRoleRollback(t *testing.T) {
+	b, storage, fake := testBackend(t)
+	fake.failAdd = "cn=failing,dc=example,dc=com"
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "role/dyn",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"creation_ldif": "dn: cn={{.Username}},dc=example,dc=com\ncn: {{.Username}}\n\ndn: cn=failing,dc=example,dc=com\ncn: failing\n",
+			"deletion_ldif": "dn: cn={{.Username}},dc=example,dc=com\nchangetype: delete\n",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/dyn",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error, got err:%s resp:%#v", err, resp)
+	}
+	if len(fake.entries) != 0 {
+		t.Fatalf("entries not rolled back: %#v", fake.entries)
+	}
+}
+
+func TestBackend_library(t *testing.T) {
+	b, storage, fake := testBackend(t)
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "library/shared",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"service_account_names": "shared1,shared2",
+			"ttl":                   "1h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if fake.passwords["cn=shared1,ou=users,dc=example,dc=com"] == "shared1-password" {
+		t.Fatal("password not rotated when added to the library")
+	}
+
+	// Accounts belong to a single library
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "library/other",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"service_account_names": "shared2",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error, got err:%s resp:%#v", err, resp)
+	}
+
+	checkOut := func(accessor string) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation:           logical.UpdateOperation,
+			Path:                "library/shared/check-out",
+			Storage:             storage,
+			ClientTokenAccessor: accessor,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	first := checkOut("alice")
+	if first.IsError() {
+		t.Fatalf("bad: %#v", first)
+	}
+	if first.Data["service_account_name"] != "shared1" || first.Secret.TTL != time.Hour {
+		t.Fatalf("bad: %#v", first)
+	}
+	if first.Data["password"] != fake.passwords["cn=shared1,ou=users,dc=example,dc=com"] {
+		t.Fatalf("bad password: %#v", first.Data)
+	}
+	if resp := checkOut("bob"); resp.IsError() || resp.Data["service_account_name"] != "shared2" {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp := checkOut("carol"); !resp.IsError() {
+		t.Fatalf("expected no account to be available, got %#v", resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "library/shared/status",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	expected := map[string]interface{}{
+		"shared1": map[string]interface{}{"available": false, "borrower_client_token_accessor": "alice"},
+		"shared2": map[string]interface{}{"available": false, "borrower_client_token_accessor": "bob"},
+	}
+	if !reflect.DeepEqual(resp.Data, expected) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Only the borrower checks in its account
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation:           logical.UpdateOperation,
+		Path:                "library/shared/check-in",
+		Storage:             storage,
+		ClientTokenAccessor: "bob",
+		Data: map[string]interface{}{
+			"service_account_names": "shared1",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error, got err:%s resp:%#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation:           logical.UpdateOperation,
+		Path:                "library/shared/check-in",
+		Storage:             storage,
+		ClientTokenAccessor: "alice",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if !reflect.DeepEqual(resp.Data["check_ins"], []string{"shared1"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if fake.passwords["cn=shared1,ou=users,dc=example,dc=com"] == first.Data["password"] {
+		t.Fatal("password not rotated on check-in")
+	}
+
+	// Revoking a lease whose account was already checked in does nothing
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   storage,
+		Secret: &logical.Secret{
+			InternalData: map[string]interface{}{
+				"secret_type":          SecretLibraryAccountType,
+				"library":              "shared",
+				"service_account_name": "shared1",
+				"check_out_id":         first.Secret.InternalData["check_out_id"],
+			},
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// Checked out accounts cannot be removed
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "library/shared",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error, got err:%s resp:%#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "library/manage/shared/check-in",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"service_account_names": "shared2",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "library/shared",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if account, err := libraryAccountRead(storage, "shared2"); err != nil || account != nil {
+		t.Fatalf("account not deleted: %#v, %s", account, err)
+	}
+}
+
+func TestParseLDIF(t *testing.T) {
+	entries, err := parseLDIF(`
+# a comment
+dn: cn=alice,ou=users,dc=example,dc=com
+objectClass: person
+objectClass: top
+description: a long
+  description
+userPassword:: c2VjcmV0
+
+dn: cn=admins,ou=groups,dc=example,dc=com
+changetype: modify
+add: member
+member: cn=alice,ou=users,dc=example,dc=com
+-
+replace: description
+description: admins
+-
+
+dn: cn=bob,ou=users,dc=example,dc=com
+changetype: delete
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*ldifEntry{
+		{
+			DN:         "cn=alice,ou=users,dc=example,dc=com",
+			ChangeType: changeTypeAdd,
+			Attributes: []*ldifAttribute{
+				{Type: "objectClass", Values: []string{"person", "top"}},
+				{Type: "description", Values: []string{"a long description"}},
+				{Type: "userPassword", Values: []string{"secret"}},
+			},
+		},
+		{
+			DN:         "cn=admins,ou=groups,dc=example,dc=com",
+			ChangeType: changeTypeModify,
+			Modifications: []*ldifModification{
+				{Operation: "add", ldifAttribute: ldifAttribute{Type: "member", Values: []string{"cn=alice,ou=users,dc=example,dc=com"}}},
+				{Operation: "replace", ldifAttribute: ldifAttribute{Type: "description", Values: []string{"admins"}}},
+			},
+		},
+		{
+			DN:         "cn=bob,ou=users,dc=example,dc=com",
+			ChangeType: changeTypeDelete,
+		},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		for i := range entries {
+			t.Logf("%#v", entries[i])
+		}
+		t.Fatal("bad entries")
+	}
+
+	for _, raw := range []string{
+		"",
+		"cn: alice\n",
+		"dn: cn=alice\nchangetype: rename\n",
+		"dn: cn=alice\n",
+	} {
+		if _, err := parseLDIF(raw); err == nil {
+			t.Fatalf("expected error parsing %q", raw)
+		}
+	}
+}
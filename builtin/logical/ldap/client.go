@@ -0,0 +1,214 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/go-ldap/ldap"
+	"github.com/hashicorp/go-multierror"
+)
+
+// ldapClient is the part of the directory used by the backend. It is an
+// interface so that tests do not need an LDAP server.
+type ldapClient interface {
+	// FindDN returns the DN of the entry under the configured user DN whose
+	// user attribute is username
+	FindDN(config *ldapConfig, username string) (string, error)
+
+	// UpdatePassword sets the password of the entry at dn
+	UpdatePassword(config *ldapConfig, dn, password string) error
+
+	// Execute applies the changes of LDIF entries, in order
+	Execute(config *ldapConfig, entries []*ldifEntry) error
+}
+
+// client is the ldapClient connecting to the configured directory
+type client struct{}
+
+func (client) FindDN(config *ldapConfig, username string) (string, error) {
+	if config.UserDN == "" {
+		return "", fmt.Errorf("userdn must be configured to look up entries by username")
+	}
+
+	conn, err := dial(config)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	result, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     config.UserDN,
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     fmt.Sprintf("(%s=%s)", config.UserAttr, ldap.EscapeFilter(username)),
+		Attributes: []string{"dn"},
+		SizeLimit:  2,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error searching for %q: %s", username, err)
+	}
+	if len(result.Entries) != 1 {
+		return "", fmt.Errorf("found %d entries for %q under %q, expected one", len(result.Entries), username, config.UserDN)
+	}
+
+	return result.Entries[0].DN, nil
+}
+
+func (client) UpdatePassword(config *ldapConfig, dn, password string) error {
+	conn, err := dial(config)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Active Directory only accepts passwords written to unicodePwd, as a
+	// quoted UTF-16 string, over encrypted connections
+	if config.Schema == schemaAD {
+		req := ldap.NewModifyRequest(dn)
+		req.Replace("unicodePwd", []string{encodeADPassword(password)})
+		return conn.Modify(req)
+	}
+
+	_, err = conn.PasswordModify(ldap.NewPasswordModifyRequest(dn, "", password))
+	return err
+}
+
+func (client) Execute(config *ldapConfig, entries []*ldifEntry) error {
+	conn, err := dial(config)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, entry := range entries {
+		var err error
+		switch entry.ChangeType {
+		case changeTypeAdd:
+			req := ldap.NewAddRequest(entry.DN)
+			for _, attr := range entry.Attributes {
+				req.Attribute(attr.Type, attr.Values)
+			}
+			err = conn.Add(req)
+
+		case changeTypeModify:
+			req := ldap.NewModifyRequest(entry.DN)
+			for _, mod := range entry.Modifications {
+				switch mod.Operation {
+				case "add":
+					req.Add(mod.Type, mod.Values)
+				case "delete":
+					req.Delete(mod.Type, mod.Values)
+				case "replace":
+					req.Replace(mod.Type, mod.Values)
+				}
+			}
+			err = conn.Modify(req)
+
+		case changeTypeDelete:
+			err = conn.Del(ldap.NewDelRequest(entry.DN, nil))
+		}
+		if err != nil {
+			return fmt.Errorf("error applying %s of %q: %s", entry.ChangeType, entry.DN, err)
+		}
+	}
+
+	return nil
+}
+
+// encodeADPassword encodes a password for the unicodePwd attribute
+func encodeADPassword(password string) string {
+	encoded := utf16.Encode([]rune(`"` + password + `"`))
+	b := make([]byte, 2*len(encoded))
+	for i, r := range encoded {
+		binary.LittleEndian.PutUint16(b[2*i:], r)
+	}
+	return string(b)
+}
+
+// dial connects to the first reachable URL of the configuration, and binds
+// with the configured credentials.
+func dial(config *ldapConfig) (*ldap.Conn, error) {
+	var retErr *multierror.Error
+	for _, rawURL := range strings.Split(config.URL, ",") {
+		conn, err := dialURL(config, strings.TrimSpace(rawURL))
+		if err != nil {
+			retErr = multierror.Append(retErr, fmt.Errorf("error connecting to %q: %s", rawURL, err))
+			continue
+		}
+
+		if err := conn.Bind(config.BindDN, config.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error binding as %q: %s", config.BindDN, err)
+		}
+		return conn, nil
+	}
+
+	return nil, retErr.ErrorOrNil()
+}
+
+func dialURL(config *ldapConfig, rawURL string) (*ldap.Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		host = u.Host
+	}
+
+	switch u.Scheme {
+	case "ldap":
+		if port == "" {
+			port = "389"
+		}
+		conn, err := ldap.Dial("tcp", net.JoinHostPort(host, port))
+		if err != nil {
+			return nil, err
+		}
+		if config.StartTLS {
+			tlsConfig, err := config.tlsConfig(host)
+			if err == nil {
+				err = conn.StartTLS(tlsConfig)
+			}
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		return conn, nil
+
+	case "ldaps":
+		if port == "" {
+			port = "636"
+		}
+		tlsConfig, err := config.tlsConfig(host)
+		if err != nil {
+			return nil, err
+		}
+		return ldap.DialTLS("tcp", net.JoinHostPort(host, port), tlsConfig)
+
+	default:
+		return nil, fmt.Errorf("invalid LDAP scheme %q", u.Scheme)
+	}
+}
+
+func (c *ldapConfig) tlsConfig(host string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         host,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.InsecureTLS,
+	}
+	if c.Certificate != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(c.Certificate)) {
+			return nil, fmt.Errorf("could not parse certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,211 @@
+package ldap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+const (
+	changeTypeAdd    = "add"
+	changeTypeModify = "modify"
+	changeTypeDelete = "delete"
+)
+
+// ldifEntry is a change record of an LDIF document
+type ldifEntry struct {
+	DN         string
+	ChangeType string
+
+	// Attributes are the attributes of added entries
+	Attributes []*ldifAttribute
+
+	// Modifications are the changes of modified entries
+	Modifications []*ldifModification
+}
+
+type ldifAttribute struct {
+	Type   string
+	Values []string
+}
+
+type ldifModification struct {
+	// Operation is "add", "delete" or "replace"
+	Operation string
+	ldifAttribute
+}
+
+// parseLDIF parses the change records of an LDIF document, such as:
+//
+//	dn: cn=alice,ou=users,dc=example,dc=com
+//	changetype: add
+//	objectClass: person
+//	cn: alice
+//	userPassword:: c2VjcmV0
+//
+//	dn: cn=admins,ou=groups,dc=example,dc=com
+//	changetype: modify
+//	add: member
+//	member: cn=alice,ou=users,dc=example,dc=com
+//	-
+//
+// Records are separated by blank lines, and default to the "add" change
+// type. Lines starting with a space continue the previous line, and lines
+// starting with "#" are comments.
+func parseLDIF(raw string) ([]*ldifEntry, error) {
+	var entries []*ldifEntry
+	var lines []string
+
+	flush := func() error {
+		if len(lines) == 0 {
+			return nil
+		}
+		entry, err := parseLDIFRecord(lines)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		lines = nil
+		return nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(raw))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case strings.TrimSpace(line) == "":
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, " "):
+			if len(lines) == 0 {
+				return nil, fmt.Errorf("continuation line without a previous line: %q", line)
+			}
+			lines[len(lines)-1] += line[1:]
+		default:
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no LDIF entries found")
+	}
+	return entries, nil
+}
+
+func parseLDIFRecord(lines []string) (*ldifEntry, error) {
+	attrType, value, err := parseLDIFLine(lines[0])
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(attrType, "dn") || value == "" {
+		return nil, fmt.Errorf("LDIF entry must start with a dn, got %q", lines[0])
+	}
+	entry := &ldifEntry{DN: value, ChangeType: changeTypeAdd}
+	lines = lines[1:]
+
+	if len(lines) != 0 {
+		attrType, value, err := parseLDIFLine(lines[0])
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(attrType, "changetype") {
+			entry.ChangeType = strings.ToLower(value)
+			lines = lines[1:]
+		}
+	}
+
+	switch entry.ChangeType {
+	case changeTypeAdd:
+		for _, line := range lines {
+			attrType, value, err := parseLDIFLine(line)
+			if err != nil {
+				return nil, err
+			}
+			entry.Attributes = appendLDIFValue(entry.Attributes, attrType, value)
+		}
+		if len(entry.Attributes) == 0 {
+			return nil, fmt.Errorf("added entry %q has no attributes", entry.DN)
+		}
+
+	case changeTypeModify:
+		var mod *ldifModification
+		for _, line := range lines {
+			if line == "-" {
+				mod = nil
+				continue
+			}
+			attrType, value, err := parseLDIFLine(line)
+			if err != nil {
+				return nil, err
+			}
+
+			if mod == nil {
+				operation := strings.ToLower(attrType)
+				if operation != "add" && operation != "delete" && operation != "replace" {
+					return nil, fmt.Errorf("invalid modification %q of %q", attrType, entry.DN)
+				}
+				mod = &ldifModification{Operation: operation}
+				mod.Type = value
+				entry.Modifications = append(entry.Modifications, mod)
+				continue
+			}
+
+			if !strings.EqualFold(attrType, mod.Type) {
+				return nil, fmt.Errorf("modification of %q contains a value of %q", mod.Type, attrType)
+			}
+			mod.Values = append(mod.Values, value)
+		}
+		if len(entry.Modifications) == 0 {
+			return nil, fmt.Errorf("modified entry %q has no modifications", entry.DN)
+		}
+
+	case changeTypeDelete:
+		if len(lines) != 0 {
+			return nil, fmt.Errorf("deleted entry %q cannot have attributes", entry.DN)
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported changetype %q of %q", entry.ChangeType, entry.DN)
+	}
+
+	return entry, nil
+}
+
+// parseLDIFLine parses an "attribute: value" line, where the value is base64
+// encoded if the separator is "::"
+func parseLDIFLine(line string) (string, string, error) {
+	i := strings.Index(line, ":")
+	if i <= 0 {
+		return "", "", fmt.Errorf("invalid LDIF line %q", line)
+	}
+	attrType, value := line[:i], line[i+1:]
+
+	if strings.HasPrefix(value, ":") {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+		if err != nil {
+			return "", "", fmt.Errorf("invalid base64 value of %q: %s", attrType, err)
+		}
+		return attrType, string(decoded), nil
+	}
+
+	return attrType, strings.TrimSpace(value), nil
+}
+
+func appendLDIFValue(attrs []*ldifAttribute, attrType, value string) []*ldifAttribute {
+	for _, attr := range attrs {
+		if strings.EqualFold(attr.Type, attrType) {
+			attr.Values = append(attr.Values, value)
+			return attrs
+		}
+	}
+	return append(attrs, &ldifAttribute{Type: attrType, Values: []string{value}})
+}
@@ -0,0 +1,25 @@
+package ldap
+
+import (
+	"strings"
+
+	"github.com/hashicorp/vault/plugins/helper/database/credsutil"
+)
+
+// generatePassword returns a random alphanumeric password containing lower
+// case letters, upper case letters and digits, as required by the default
+// password policy of Active Directory
+func generatePassword(length int) (string, error) {
+	for {
+		raw, err := credsutil.RandomAlphaNumericOfLen(length)
+		if err != nil {
+			return "", err
+		}
+		password := string(raw)
+		if strings.ContainsAny(password, "abcdefghijklmnopqrstuvwxyz") &&
+			strings.ContainsAny(password, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") &&
+			strings.ContainsAny(password, "0123456789") {
+			return password, nil
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package ldap
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	configPath = "config"
+
+	schemaOpenLDAP = "openldap"
+	schemaAD       = "ad"
+
+	defaultPasswordLength = 64
+
+	// minPasswordLength keeps generated passwords strong enough, and long
+	// enough to contain the character classes required by Active Directory
+	minPasswordLength = 14
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config",
+		Fields: map[string]*framework.FieldSchema{
+			"url": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     "ldap://127.0.0.1",
+				Description: "Comma-separated LDAP URLs to connect to, tried in order",
+			},
+			"binddn": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "DN of the entry Vault binds as to manage passwords and entries",
+			},
+			"bindpass": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Password of the bind DN",
+			},
+			"userdn": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Base DN under which entries are looked up by username",
+			},
+			"userattr": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     "cn",
+				Description: `Attribute matched against usernames, such as "cn", "uid" or "sAMAccountName"`,
+			},
+			"schema": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     schemaOpenLDAP,
+				Description: `Directory schema: "openldap" or "ad" for Active Directory`,
+			},
+			"password_length": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Default:     defaultPasswordLength,
+				Description: "Length of generated passwords",
+			},
+			"certificate": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "PEM encoded CA certificate verifying the LDAP server",
+			},
+			"insecure_tls": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: "Skip the verification of the LDAP server certificate",
+			},
+			"starttls": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: "Issue a StartTLS command on ldap:// URLs",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := readConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	// The bind password is not returned
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"url":             config.URL,
+			"binddn":          config.BindDN,
+			"userdn":          config.UserDN,
+			"userattr":        config.UserAttr,
+			"schema":          config.Schema,
+			"password_length": config.PasswordLength,
+			"certificate":     config.Certificate,
+			"insecure_tls":    config.InsecureTLS,
+			"starttls":        config.StartTLS,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.rotationLock.Lock()
+	defer b.rotationLock.Unlock()
+
+	config, err := readConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &ldapConfig{
+			URL:            d.Get("url").(string),
+			UserAttr:       d.Get("userattr").(string),
+			Schema:         d.Get("schema").(string),
+			PasswordLength: d.Get("password_length").(int),
+		}
+	}
+
+	if v, ok := d.GetOk("url"); ok {
+		config.URL = v.(string)
+	}
+	if v, ok := d.GetOk("binddn"); ok {
+		config.BindDN = v.(string)
+	}
+	if v, ok := d.GetOk("bindpass"); ok {
+		config.BindPassword = v.(string)
+	}
+	if v, ok := d.GetOk("userdn"); ok {
+		config.UserDN = v.(string)
+	}
+	if v, ok := d.GetOk("userattr"); ok {
+		config.UserAttr = v.(string)
+	}
+	if v, ok := d.GetOk("schema"); ok {
+		config.Schema = v.(string)
+	}
+	if v, ok := d.GetOk("password_length"); ok {
+		config.PasswordLength = v.(int)
+	}
+	if v, ok := d.GetOk("certificate"); ok {
+		config.Certificate = v.(string)
+	}
+	if v, ok := d.GetOk("insecure_tls"); ok {
+		config.InsecureTLS = v.(bool)
+	}
+	if v, ok := d.GetOk("starttls"); ok {
+		config.StartTLS = v.(bool)
+	}
+
+	if err := config.validate(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if err := storeConfig(req.Storage, config); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (c *ldapConfig) validate() error {
+	if c.BindDN == "" || c.BindPassword == "" {
+		return fmt.Errorf("binddn and bindpass are required")
+	}
+	for _, rawURL := range strings.Split(c.URL, ",") {
+		u, err := url.Parse(strings.TrimSpace(rawURL))
+		if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+			return fmt.Errorf("invalid LDAP URL %q", rawURL)
+		}
+	}
+	if c.Schema != schemaOpenLDAP && c.Schema != schemaAD {
+		return fmt.Errorf("schema must be %q or %q", schemaOpenLDAP, schemaAD)
+	}
+	if c.PasswordLength < minPasswordLength {
+		return fmt.Errorf("password_length must be at least %d", minPasswordLength)
+	}
+	if c.Certificate != "" {
+		block, _ := pem.Decode([]byte(c.Certificate))
+		if block == nil || block.Type != "CERTIFICATE" {
+			return fmt.Errorf("failed to decode PEM block in the certificate")
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return fmt.Errorf("failed to parse certificate: %s", err)
+		}
+	}
+	return nil
+}
+
+func readConfig(s logical.Storage) (*ldapConfig, error) {
+	entry, err := s.Get(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result ldapConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// getConfig returns the configuration, or an error if the backend is not
+// configured
+func getConfig(s logical.Storage) (*ldapConfig, error) {
+	config, err := readConfig(s)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, fmt.Errorf("the ldap backend is not configured")
+	}
+	return config, nil
+}
+
+func storeConfig(s logical.Storage, config *ldapConfig) error {
+	entry, err := logical.StorageEntryJSON(configPath, config)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+type ldapConfig struct {
+	URL            string `json:"url"`
+	BindDN         string `json:"binddn"`
+	BindPassword   string `json:"bindpass"`
+	UserDN         string `json:"userdn"`
+	UserAttr       string `json:"userattr"`
+	Schema         string `json:"schema"`
+	PasswordLength int    `json:"password_length"`
+	Certificate    string `json:"certificate"`
+	InsecureTLS    bool   `json:"insecure_tls"`
+	StartTLS       bool   `json:"starttls"`
+}
+
+const pathConfigHelpSyn = `
+Configure the LDAP server and the credentials used to manage it.
+`
+
+const pathConfigHelpDesc = `
+This path configures the LDAP server, and the DN and password Vault binds as
+to rotate passwords and manage entries. The bind password is not returned
+when reading the configuration, and can be rotated by Vault with the
+"rotate-root" endpoint.
+
+Set "schema" to "ad" for Active Directory, whose passwords are written to the
+unicodePwd attribute and require an ldaps:// URL or StartTLS. Other servers
+have their passwords changed with the password modify extended operation.
+
+Entries are looked up by username under "userdn", with the "userattr"
+attribute.
+`
@@ -0,0 +1,425 @@
+package ldap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"text/template"
+	"time"
+	"unicode/utf16"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"github.com/hashicorp/vault/plugins/helper/database/credsutil"
+)
+
+const (
+	dynamicRolePath = "role/"
+
+	defaultUsernameTemplate = "v_{{.DisplayName | truncate 15}}_{{.RoleName | truncate 15}}_{{random 10}}_{{unix_time}}"
+)
+
+// ldifTemplateFuncs are the functions available to LDIF templates, to encode
+// passwords for Active Directory, such as:
+//
+//	unicodePwd:: {{ printf "%q" .Password | utf16le | base64 }}
+var ldifTemplateFuncs = template.FuncMap{
+	"base64": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+	"utf16le": func(s string) string {
+		encoded := utf16.Encode([]rune(s))
+		b := make([]byte, 2*len(encoded))
+		for i, r := range encoded {
+			b[2*i], b[2*i+1] = byte(r), byte(r>>8)
+		}
+		return string(b)
+	},
+}
+
+// ldifTemplateData is the data LDIF templates are rendered with
+type ldifTemplateData struct {
+	Username    string
+	Password    string
+	DisplayName string
+	RoleName    string
+}
+
+func pathListDynamicRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathDynamicRoleList,
+		},
+
+		HelpSynopsis:    pathDynamicRolesHelpSyn,
+		HelpDescription: pathDynamicRolesHelpDesc,
+	}
+}
+
+func pathDynamicRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role",
+			},
+			"creation_ldif": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "LDIF template creating the entries of a user",
+			},
+			"deletion_ldif": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "LDIF template deleting the entries of a user",
+			},
+			"rollback_ldif": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `LDIF template undoing a failed creation. Defaults to the
+deletion LDIF.`,
+			},
+			"username_template": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Template of the usernames",
+			},
+			"default_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Default lease of the users. Defaults to the system default.",
+			},
+			"max_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum lease of the users. Defaults to the system maximum.",
+			},
+		},
+
+		ExistenceCheck: b.pathDynamicRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathDynamicRoleRead,
+			logical.CreateOperation: b.pathDynamicRoleWrite,
+			logical.UpdateOperation: b.pathDynamicRoleWrite,
+			logical.DeleteOperation: b.pathDynamicRoleDelete,
+		},
+
+		HelpSynopsis:    pathDynamicRolesHelpSyn,
+		HelpDescription: pathDynamicRolesHelpDesc,
+	}
+}
+
+func pathDynamicCreds(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "creds/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathDynamicCredsRead,
+		},
+
+		HelpSynopsis:    pathDynamicCredsHelpSyn,
+		HelpDescription: pathDynamicCredsHelpDesc,
+	}
+}
+
+func (b *backend) pathDynamicRoleExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	role, err := dynamicRoleRead(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return role != nil, nil
+}
+
+func (b *backend) pathDynamicRoleList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(dynamicRolePath)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathDynamicRoleDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete(dynamicRolePath + d.Get("name").(string)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathDynamicRoleRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := dynamicRoleRead(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"creation_ldif":     role.CreationLDIF,
+			"deletion_ldif":     role.DeletionLDIF,
+			"rollback_ldif":     role.RollbackLDIF,
+			"username_template": role.UsernameTemplate,
+			"default_ttl":       int64(role.DefaultTTL.Seconds()),
+			"max_ttl":           int64(role.MaxTTL.Seconds()),
+		},
+	}, nil
+}
+
+func (b *backend) pathDynamicRoleWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	role, err := dynamicRoleRead(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role = &dynamicRoleEntry{}
+	}
+
+	if v, ok := d.GetOk("creation_ldif"); ok {
+		role.CreationLDIF = v.(string)
+	}
+	if v, ok := d.GetOk("deletion_ldif"); ok {
+		role.DeletionLDIF = v.(string)
+	}
+	if v, ok := d.GetOk("rollback_ldif"); ok {
+		role.RollbackLDIF = v.(string)
+	}
+	if v, ok := d.GetOk("username_template"); ok {
+		role.UsernameTemplate = v.(string)
+	}
+	if v, ok := d.GetOk("default_ttl"); ok {
+		role.DefaultTTL = time.Duration(v.(int)) * time.Second
+	}
+	if v, ok := d.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(v.(int)) * time.Second
+	}
+
+	if role.CreationLDIF == "" || role.DeletionLDIF == "" {
+		return logical.ErrorResponse("creation_ldif and deletion_ldif are required"), nil
+	}
+	if role.MaxTTL != 0 && role.DefaultTTL > role.MaxTTL {
+		return logical.ErrorResponse("default_ttl cannot be greater than max_ttl"), nil
+	}
+
+	// The templates are checked by rendering them with sample data
+	sample := &ldifTemplateData{
+		Username:    "username",
+		Password:    "password",
+		DisplayName: "display-name",
+		RoleName:    name,
+	}
+	if role.UsernameTemplate != "" {
+		if err := credsutil.ValidateUsernameTemplate(role.UsernameTemplate); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+	for field, tpl := range map[string]string{
+		"creation_ldif": role.CreationLDIF,
+		"deletion_ldif": role.DeletionLDIF,
+		"rollback_ldif": role.RollbackLDIF,
+	} {
+		if tpl == "" {
+			continue
+		}
+		if _, err := renderLDIF(tpl, sample); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid %s: %s", field, err)), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(dynamicRolePath+name, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathDynamicCredsRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	role, err := dynamicRoleRead(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %q not found", name)), nil
+	}
+
+	config, err := getConfig(req.Storage)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	usernameTemplate := role.UsernameTemplate
+	if usernameTemplate == "" {
+		usernameTemplate = defaultUsernameTemplate
+	}
+	username, err := credsutil.GenerateUsernameFromTemplate(usernameTemplate, dbplugin.UsernameConfig{
+		DisplayName: req.DisplayName,
+		RoleName:    name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	password, err := generatePassword(config.PasswordLength)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &ldifTemplateData{
+		Username:    username,
+		Password:    password,
+		DisplayName: req.DisplayName,
+		RoleName:    name,
+	}
+	creation, err := renderLDIF(role.CreationLDIF, data)
+	if err != nil {
+		return nil, err
+	}
+	deletion, err := renderLDIF(role.DeletionLDIF, data)
+	if err != nil {
+		return nil, err
+	}
+	rollback := deletion
+	if role.RollbackLDIF != "" {
+		if rollback, err = renderLDIF(role.RollbackLDIF, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := b.client.Execute(config, creation); err != nil {
+		if rollbackErr := b.client.Execute(config, rollback); rollbackErr != nil {
+			err = multierror.Append(err, fmt.Errorf("error rolling back: %s", rollbackErr))
+		}
+		return logical.ErrorResponse(fmt.Sprintf("error creating user: %s", err)), nil
+	}
+
+	var dns []string
+	for _, entry := range creation {
+		if entry.ChangeType == changeTypeAdd {
+			dns = append(dns, entry.DN)
+		}
+	}
+
+	resp := b.Secret(SecretDynamicUserType).Response(map[string]interface{}{
+		"username":            username,
+		"password":            password,
+		"distinguished_names": dns,
+	}, map[string]interface{}{
+		"role":          name,
+		"username":      username,
+		"deletion_ldif": renderedDeletionLDIF(role.DeletionLDIF, data),
+	})
+	resp.Secret.TTL = role.DefaultTTL
+
+	return resp, nil
+}
+
+// renderLDIF renders an LDIF template and parses the resulting entries
+func renderLDIF(tpl string, data *ldifTemplateData) ([]*ldifEntry, error) {
+	rendered, err := executeLDIFTemplate(tpl, data)
+	if err != nil {
+		return nil, err
+	}
+	return parseLDIF(rendered)
+}
+
+// renderedDeletionLDIF renders the deletion LDIF of a user, which is kept
+// with its lease so that it can be deleted even if the role changes. The
+// template was already rendered successfully, so errors are not expected.
+func renderedDeletionLDIF(tpl string, data *ldifTemplateData) string {
+	rendered, _ := executeLDIFTemplate(tpl, data)
+	return rendered
+}
+
+func executeLDIFTemplate(tpl string, data *ldifTemplateData) (string, error) {
+	t, err := template.New("ldif").Funcs(ldifTemplateFuncs).Option("missingkey=error").Parse(tpl)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func dynamicRoleRead(s logical.Storage, name string) (*dynamicRoleEntry, error) {
+	entry, err := s.Get(dynamicRolePath + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result dynamicRoleEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+type dynamicRoleEntry struct {
+	CreationLDIF     string        `json:"creation_ldif"`
+	DeletionLDIF     string        `json:"deletion_ldif"`
+	RollbackLDIF     string        `json:"rollback_ldif"`
+	UsernameTemplate string        `json:"username_template"`
+	DefaultTTL       time.Duration `json:"default_ttl"`
+	MaxTTL           time.Duration `json:"max_ttl"`
+}
+
+const pathDynamicRolesHelpSyn = `
+Manage the roles creating dynamic users.
+`
+
+const pathDynamicRolesHelpDesc = `
+Dynamic roles create LDAP entries for each lease from LDIF templates, and
+delete them when the lease is revoked.
+
+The templates are Go templates rendered with {{.Username}}, {{.Password}},
+{{.DisplayName}} and {{.RoleName}}, and the "base64" and "utf16le" functions
+to encode Active Directory passwords. Entries are separated by blank lines
+and have a "changetype" of "add" (the default), "modify" or "delete":
+
+  dn: cn={{.Username}},ou=users,dc=example,dc=com
+  objectClass: person
+  objectClass: top
+  cn: {{.Username}}
+  sn: {{.Username}}
+  userPassword: {{.Password}}
+
+The "rollback_ldif" template undoes a partially applied "creation_ldif", and
+defaults to "deletion_ldif". Usernames are generated from
+"username_template", which takes the same functions as the usernames of the
+database backend.
+`
+
+const pathDynamicCredsHelpSyn = `
+Create a dynamic user from a role.
+`
+
+const pathDynamicCredsHelpDesc = `
+This path creates the entries of the creation LDIF of a role, and returns the
+username and password of the user. The entries are deleted with the deletion
+LDIF when the lease is revoked.
+`
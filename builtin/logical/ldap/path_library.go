@@ -0,0 +1,649 @@
+package ldap
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	libraryPath        = "library/"
+	libraryAccountPath = "library-account/"
+)
+
+func pathListLibraries(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "library/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathLibraryList,
+		},
+
+		HelpSynopsis:    pathLibrariesHelpSyn,
+		HelpDescription: pathLibrariesHelpDesc,
+	}
+}
+
+func pathLibraries(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "library/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the library",
+			},
+			"service_account_names": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Usernames of the service accounts of the library",
+			},
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Default lease of the check-outs. Defaults to the system default.",
+			},
+			"max_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum lease of the check-outs. Defaults to the system maximum.",
+			},
+			"disable_check_in_enforcement": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If set, accounts can be checked in by anyone, not only by the
+token that checked them out.`,
+			},
+		},
+
+		ExistenceCheck: b.pathLibraryExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathLibraryRead,
+			logical.CreateOperation: b.pathLibraryWrite,
+			logical.UpdateOperation: b.pathLibraryWrite,
+			logical.DeleteOperation: b.pathLibraryDelete,
+		},
+
+		HelpSynopsis:    pathLibrariesHelpSyn,
+		HelpDescription: pathLibrariesHelpDesc,
+	}
+}
+
+func pathLibraryCheckOut(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "library/" + framework.GenericNameRegex("name") + "/check-out$",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the library",
+			},
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Lease of the check-out. Defaults to the library's ttl.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLibraryCheckOutUpdate,
+		},
+
+		HelpSynopsis:    pathLibraryCheckOutHelpSyn,
+		HelpDescription: pathLibraryCheckOutHelpDesc,
+	}
+}
+
+func pathLibraryCheckIn(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "library/" + framework.GenericNameRegex("name") + "/check-in$",
+		Fields:  libraryCheckInFields,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLibraryCheckInUpdate(true),
+		},
+
+		HelpSynopsis:    pathLibraryCheckInHelpSyn,
+		HelpDescription: pathLibraryCheckInHelpDesc,
+	}
+}
+
+func pathLibraryManageCheckIn(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "library/manage/" + framework.GenericNameRegex("name") + "/check-in$",
+		Fields:  libraryCheckInFields,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLibraryCheckInUpdate(false),
+		},
+
+		HelpSynopsis:    pathLibraryCheckInHelpSyn,
+		HelpDescription: pathLibraryCheckInHelpDesc,
+	}
+}
+
+func pathLibraryStatus(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "library/" + framework.GenericNameRegex("name") + "/status$",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the library",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathLibraryStatusRead,
+		},
+
+		HelpSynopsis:    pathLibraryStatusHelpSyn,
+		HelpDescription: pathLibraryStatusHelpDesc,
+	}
+}
+
+var libraryCheckInFields = map[string]*framework.FieldSchema{
+	"name": &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Name of the library",
+	},
+	"service_account_names": &framework.FieldSchema{
+		Type: framework.TypeCommaStringSlice,
+		Description: `Usernames of the accounts to check in. Defaults to the only
+account checked out by the caller.`,
+	},
+}
+
+func (b *backend) pathLibraryExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	library, err := libraryRead(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return library != nil, nil
+}
+
+func (b *backend) pathLibraryList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(libraryPath)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathLibraryRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	library, err := libraryRead(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if library == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"service_account_names":        library.ServiceAccountNames,
+			"ttl":                          int64(library.TTL.Seconds()),
+			"max_ttl":                      int64(library.MaxTTL.Seconds()),
+			"disable_check_in_enforcement": library.DisableCheckInEnforcement,
+		},
+	}, nil
+}
+
+func (b *backend) pathLibraryWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.libraryLock.Lock()
+	defer b.libraryLock.Unlock()
+
+	library, err := libraryRead(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if library == nil {
+		library = &libraryEntry{}
+	}
+	previous := library.ServiceAccountNames
+
+	if v, ok := d.GetOk("service_account_names"); ok {
+		library.ServiceAccountNames = strutil.RemoveDuplicates(v.([]string), false)
+	}
+	if v, ok := d.GetOk("ttl"); ok {
+		library.TTL = time.Duration(v.(int)) * time.Second
+	}
+	if v, ok := d.GetOk("max_ttl"); ok {
+		library.MaxTTL = time.Duration(v.(int)) * time.Second
+	}
+	if v, ok := d.GetOk("disable_check_in_enforcement"); ok {
+		library.DisableCheckInEnforcement = v.(bool)
+	}
+
+	if len(library.ServiceAccountNames) == 0 {
+		return logical.ErrorResponse("service_account_names is required"), nil
+	}
+	if library.MaxTTL != 0 && library.TTL > library.MaxTTL {
+		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	}
+
+	// Removed accounts must not be in use, and added accounts must not
+	// belong to another library
+	var added, removed []string
+	for _, username := range previous {
+		if !strutil.StrListContains(library.ServiceAccountNames, username) {
+			removed = append(removed, username)
+		}
+	}
+	for _, username := range library.ServiceAccountNames {
+		if !strutil.StrListContains(previous, username) {
+			added = append(added, username)
+		}
+	}
+	for _, username := range removed {
+		account, err := libraryAccountRead(req.Storage, username)
+		if err != nil {
+			return nil, err
+		}
+		if account != nil && account.CheckedOut {
+			return logical.ErrorResponse(fmt.Sprintf("%q is checked out and cannot be removed", username)), nil
+		}
+	}
+	for _, username := range added {
+		account, err := libraryAccountRead(req.Storage, username)
+		if err != nil {
+			return nil, err
+		}
+		if account != nil {
+			return logical.ErrorResponse(fmt.Sprintf("%q already belongs to library %q", username, account.Library)), nil
+		}
+	}
+
+	// Added accounts have their password rotated so that Vault knows it
+	if len(added) != 0 {
+		config, err := getConfig(req.Storage)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		for _, username := range added {
+			dn, err := b.client.FindDN(config, username)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+			account := &libraryAccountEntry{
+				Library: name,
+				DN:      dn,
+			}
+			if err := b.rotateLibraryAccount(req.Storage, config, username, account); err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("error rotating the password of %q: %s", username, err)), nil
+			}
+		}
+	}
+	for _, username := range removed {
+		if err := req.Storage.Delete(libraryAccountPath + username); err != nil {
+			return nil, err
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(libraryPath+name, library)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathLibraryDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.libraryLock.Lock()
+	defer b.libraryLock.Unlock()
+
+	library, err := libraryRead(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if library == nil {
+		return nil, nil
+	}
+
+	for _, username := range library.ServiceAccountNames {
+		account, err := libraryAccountRead(req.Storage, username)
+		if err != nil {
+			return nil, err
+		}
+		if account != nil && account.CheckedOut {
+			return logical.ErrorResponse(fmt.Sprintf("%q is checked out, the library cannot be deleted", username)), nil
+		}
+	}
+	for _, username := range library.ServiceAccountNames {
+		if err := req.Storage.Delete(libraryAccountPath + username); err != nil {
+			return nil, err
+		}
+	}
+	if err := req.Storage.Delete(libraryPath + name); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathLibraryCheckOutUpdate(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.libraryLock.Lock()
+	defer b.libraryLock.Unlock()
+
+	library, err := libraryRead(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if library == nil {
+		return logical.ErrorResponse(fmt.Sprintf("library %q not found", name)), nil
+	}
+
+	ttl := library.TTL
+	if v, ok := d.GetOk("ttl"); ok {
+		ttl = time.Duration(v.(int)) * time.Second
+	}
+	if library.MaxTTL != 0 && ttl > library.MaxTTL {
+		ttl = library.MaxTTL
+	}
+
+	for _, username := range library.ServiceAccountNames {
+		account, err := libraryAccountRead(req.Storage, username)
+		if err != nil {
+			return nil, err
+		}
+		if account == nil || account.CheckedOut {
+			continue
+		}
+
+		checkOutID, err := uuid.GenerateUUID()
+		if err != nil {
+			return nil, err
+		}
+		account.CheckedOut = true
+		account.BorrowerAccessor = req.ClientTokenAccessor
+		account.CheckOutID = checkOutID
+		if err := storeLibraryAccount(req.Storage, username, account); err != nil {
+			return nil, err
+		}
+
+		resp := b.Secret(SecretLibraryAccountType).Response(map[string]interface{}{
+			"service_account_name": username,
+			"password":             account.Password,
+		}, map[string]interface{}{
+			"library":              name,
+			"service_account_name": username,
+			"check_out_id":         checkOutID,
+		})
+		resp.Secret.TTL = ttl
+		return resp, nil
+	}
+
+	return logical.ErrorResponse(fmt.Sprintf("no account of library %q is available", name)), nil
+}
+
+func (b *backend) pathLibraryCheckInUpdate(enforce bool) framework.OperationFunc {
+	return func(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+
+		b.libraryLock.Lock()
+		defer b.libraryLock.Unlock()
+
+		library, err := libraryRead(req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if library == nil {
+			return logical.ErrorResponse(fmt.Sprintf("library %q not found", name)), nil
+		}
+		enforce = enforce && !library.DisableCheckInEnforcement
+
+		usernames := d.Get("service_account_names").([]string)
+		if len(usernames) == 0 {
+			// Without names, the caller's only check-out is checked in
+			for _, username := range library.ServiceAccountNames {
+				account, err := libraryAccountRead(req.Storage, username)
+				if err != nil {
+					return nil, err
+				}
+				if account == nil || !account.CheckedOut {
+					continue
+				}
+				if enforce && account.BorrowerAccessor != req.ClientTokenAccessor {
+					continue
+				}
+				usernames = append(usernames, username)
+			}
+			if len(usernames) != 1 {
+				return logical.ErrorResponse(fmt.Sprintf(
+					"%d accounts are checked out, service_account_names is required", len(usernames))), nil
+			}
+		}
+
+		accounts := make(map[string]*libraryAccountEntry, len(usernames))
+		for _, username := range usernames {
+			if !strutil.StrListContains(library.ServiceAccountNames, username) {
+				return logical.ErrorResponse(fmt.Sprintf("%q does not belong to library %q", username, name)), nil
+			}
+			account, err := libraryAccountRead(req.Storage, username)
+			if err != nil {
+				return nil, err
+			}
+			if account == nil {
+				return logical.ErrorResponse(fmt.Sprintf("account %q not found", username)), nil
+			}
+			if enforce && account.CheckedOut && account.BorrowerAccessor != req.ClientTokenAccessor {
+				return logical.ErrorResponse(fmt.Sprintf("%q was checked out by another token", username)), nil
+			}
+			accounts[username] = account
+		}
+
+		config, err := getConfig(req.Storage)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+
+		var checkIns []string
+		for _, username := range usernames {
+			account := accounts[username]
+			if !account.CheckedOut {
+				continue
+			}
+			if err := b.checkInLibraryAccount(req.Storage, config, username, account); err != nil {
+				return nil, err
+			}
+			checkIns = append(checkIns, username)
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"check_ins": checkIns,
+			},
+		}, nil
+	}
+}
+
+func (b *backend) pathLibraryStatusRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	library, err := libraryRead(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if library == nil {
+		return logical.ErrorResponse(fmt.Sprintf("library %q not found", name)), nil
+	}
+
+	status := make(map[string]interface{}, len(library.ServiceAccountNames))
+	for _, username := range library.ServiceAccountNames {
+		account, err := libraryAccountRead(req.Storage, username)
+		if err != nil {
+			return nil, err
+		}
+		if account == nil {
+			continue
+		}
+
+		accountStatus := map[string]interface{}{
+			"available": !account.CheckedOut,
+		}
+		if account.CheckedOut && !library.DisableCheckInEnforcement {
+			accountStatus["borrower_client_token_accessor"] = account.BorrowerAccessor
+		}
+		status[username] = accountStatus
+	}
+
+	return &logical.Response{
+		Data: status,
+	}, nil
+}
+
+// checkInLibraryAccount makes an account available again, with a new
+// password so that the borrower cannot keep using it. The caller must hold
+// the libraryLock.
+func (b *backend) checkInLibraryAccount(s logical.Storage, config *ldapConfig, username string, account *libraryAccountEntry) error {
+	account.CheckedOut = false
+	account.BorrowerAccessor = ""
+	account.CheckOutID = ""
+
+	if err := b.rotateLibraryAccount(s, config, username, account); err != nil {
+		// The account stays checked in with its previous password rather
+		// than being lost to the library
+		b.Logger().Error("ldap: error rotating library account password on check-in", "account", username, "error", err)
+		return storeLibraryAccount(s, username, account)
+	}
+	return nil
+}
+
+// rotateLibraryAccount sets a new password on a library account and stores
+// it.
+func (b *backend) rotateLibraryAccount(s logical.Storage, config *ldapConfig, username string, account *libraryAccountEntry) error {
+	password, err := generatePassword(config.PasswordLength)
+	if err != nil {
+		return err
+	}
+	if err := b.client.UpdatePassword(config, account.DN, password); err != nil {
+		return err
+	}
+
+	account.Password = password
+	if err := storeLibraryAccount(s, username, account); err != nil {
+		return fmt.Errorf("the password was rotated but could not be stored: %s", err)
+	}
+	return nil
+}
+
+func libraryRead(s logical.Storage, name string) (*libraryEntry, error) {
+	entry, err := s.Get(libraryPath + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result libraryEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func libraryAccountRead(s logical.Storage, username string) (*libraryAccountEntry, error) {
+	entry, err := s.Get(libraryAccountPath + username)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result libraryAccountEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func storeLibraryAccount(s logical.Storage, username string, account *libraryAccountEntry) error {
+	entry, err := logical.StorageEntryJSON(libraryAccountPath+username, account)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+type libraryEntry struct {
+	ServiceAccountNames       []string      `json:"service_account_names"`
+	TTL                       time.Duration `json:"ttl"`
+	MaxTTL                    time.Duration `json:"max_ttl"`
+	DisableCheckInEnforcement bool          `json:"disable_check_in_enforcement"`
+}
+
+// libraryAccountEntry is a service account of a library and its check-out
+type libraryAccountEntry struct {
+	Library          string `json:"library"`
+	DN               string `json:"dn"`
+	Password         string `json:"password"`
+	CheckedOut       bool   `json:"checked_out"`
+	BorrowerAccessor string `json:"borrower_accessor"`
+	CheckOutID       string `json:"check_out_id"`
+}
+
+const pathLibrariesHelpSyn = `
+Manage the libraries of shared service accounts.
+`
+
+const pathLibrariesHelpDesc = `
+A library is a set of existing service accounts that can be checked out one
+at a time. Vault rotates the password of each account when it is added to a
+library and when it is checked in, so that only the current borrower knows
+it.
+
+An account belongs to at most one library. Accounts cannot be removed, nor
+libraries deleted, while they are checked out. The "ttl" and "max_ttl"
+parameters configure the leases of the check-outs, and the accounts are
+checked in when their lease expires.
+`
+
+const pathLibraryCheckOutHelpSyn = `
+Check out an available account of a library.
+`
+
+const pathLibraryCheckOutHelpDesc = `
+This path checks out an available account of the library, and returns its
+name and password. The account is checked in when its lease is revoked.
+`
+
+const pathLibraryCheckInHelpSyn = `
+Check accounts back in to a library.
+`
+
+const pathLibraryCheckInHelpDesc = `
+This path checks accounts back in and rotates their password. Without
+"service_account_names", the only account checked out by the caller is
+checked in.
+
+Unless the library disables check-in enforcement, accounts can only be
+checked in by the token that checked them out. The "library/manage/<name>/
+check-in" path, which requires sudo, checks in any account.
+`
+
+const pathLibraryStatusHelpSyn = `
+Read the check-out status of the accounts of a library.
+`
+
+const pathLibraryStatusHelpDesc = `
+This path returns, for each account of the library, whether it is available
+and, if check-in enforcement is enabled, the accessor of the token that
+checked it out.
+`
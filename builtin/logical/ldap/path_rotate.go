@@ -0,0 +1,107 @@
+package ldap
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathRotateRoot(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "rotate-root",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRotateRootUpdate,
+		},
+
+		HelpSynopsis:    pathRotateRootHelpSyn,
+		HelpDescription: pathRotateRootHelpDesc,
+	}
+}
+
+func pathRotateRole(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "rotate-role/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the static role",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRotateRoleUpdate,
+		},
+
+		HelpSynopsis:    pathRotateRoleHelpSyn,
+		HelpDescription: pathRotateRoleHelpDesc,
+	}
+}
+
+func (b *backend) pathRotateRootUpdate(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.rotationLock.Lock()
+	defer b.rotationLock.Unlock()
+
+	config, err := getConfig(req.Storage)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	password, err := generatePassword(config.PasswordLength)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.client.UpdatePassword(config, config.BindDN, password); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error rotating the bind password: %s", err)), nil
+	}
+
+	config.BindPassword = password
+	if err := storeConfig(req.Storage, config); err != nil {
+		return nil, fmt.Errorf("the bind password was rotated but could not be stored: %s", err)
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathRotateRoleUpdate(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.rotationLock.Lock()
+	defer b.rotationLock.Unlock()
+
+	role, err := staticRoleRead(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("static role %q not found", name)), nil
+	}
+
+	if err := b.rotateStaticRole(req.Storage, name, role); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error rotating password: %s", err)), nil
+	}
+
+	return nil, nil
+}
+
+const pathRotateRootHelpSyn = `
+Rotate the password of the bind DN.
+`
+
+const pathRotateRootHelpDesc = `
+This path generates a new password for the configured bind DN, sets it in the
+directory and stores it. Afterwards, only Vault knows the password of the
+bind DN.
+`
+
+const pathRotateRoleHelpSyn = `
+Rotate the password of a static role.
+`
+
+const pathRotateRoleHelpDesc = `
+This path immediately rotates the password of the entry of a static role.
+The rotation period of the role starts over.
+`
@@ -0,0 +1,346 @@
+package ldap
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	staticRolePath = "static-role/"
+
+	// minRotationPeriod is the shortest rotation period of static roles,
+	// which are rotated by the periodic function of the backend
+	minRotationPeriod = time.Minute
+)
+
+func pathListStaticRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-role/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathStaticRoleList,
+		},
+
+		HelpSynopsis:    pathStaticRolesHelpSyn,
+		HelpDescription: pathStaticRolesHelpDesc,
+	}
+}
+
+func pathStaticRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-role/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the static role",
+			},
+			"username": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Username of the existing entry whose password is rotated",
+			},
+			"dn": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "DN of the entry. Looked up from the username if not set.",
+			},
+			"rotation_period": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `Period after which the password is rotated. If not set, the
+password is only rotated on demand.`,
+			},
+		},
+
+		ExistenceCheck: b.pathStaticRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathStaticRoleRead,
+			logical.CreateOperation: b.pathStaticRoleWrite,
+			logical.UpdateOperation: b.pathStaticRoleWrite,
+			logical.DeleteOperation: b.pathStaticRoleDelete,
+		},
+
+		HelpSynopsis:    pathStaticRolesHelpSyn,
+		HelpDescription: pathStaticRolesHelpDesc,
+	}
+}
+
+func pathStaticCreds(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-cred/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the static role",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathStaticCredsRead,
+		},
+
+		HelpSynopsis:    pathStaticCredsHelpSyn,
+		HelpDescription: pathStaticCredsHelpDesc,
+	}
+}
+
+func (b *backend) pathStaticRoleExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	role, err := staticRoleRead(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return role != nil, nil
+}
+
+func (b *backend) pathStaticRoleList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(staticRolePath)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathStaticRoleDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.rotationLock.Lock()
+	defer b.rotationLock.Unlock()
+
+	// The entry keeps its last password
+	if err := req.Storage.Delete(staticRolePath + d.Get("name").(string)); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathStaticRoleRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := staticRoleRead(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"username":            role.Username,
+			"dn":                  role.DN,
+			"rotation_period":     int64(role.RotationPeriod.Seconds()),
+			"last_vault_rotation": role.LastVaultRotation,
+		},
+	}, nil
+}
+
+func (b *backend) pathStaticRoleWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.rotationLock.Lock()
+	defer b.rotationLock.Unlock()
+
+	role, err := staticRoleRead(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role = &staticRoleEntry{}
+	}
+
+	// The entry cannot change, as its password would no longer be managed
+	if v, ok := d.GetOk("username"); ok {
+		if role.Username != "" && role.Username != v.(string) {
+			return logical.ErrorResponse("username of an existing static role cannot be changed"), nil
+		}
+		role.Username = v.(string)
+	}
+	if v, ok := d.GetOk("dn"); ok {
+		if role.DN != "" && role.DN != v.(string) {
+			return logical.ErrorResponse("dn of an existing static role cannot be changed"), nil
+		}
+		role.DN = v.(string)
+	}
+	if role.Username == "" {
+		return logical.ErrorResponse("username is required"), nil
+	}
+
+	if v, ok := d.GetOk("rotation_period"); ok {
+		role.RotationPeriod = time.Duration(v.(int)) * time.Second
+	}
+	if role.RotationPeriod != 0 && role.RotationPeriod < minRotationPeriod {
+		return logical.ErrorResponse(fmt.Sprintf("rotation_period must be at least %s", minRotationPeriod)), nil
+	}
+
+	// New roles have their password rotated right away so that Vault knows
+	// the current password
+	if req.Operation == logical.CreateOperation {
+		if role.DN == "" {
+			config, err := getConfig(req.Storage)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+			role.DN, err = b.client.FindDN(config, role.Username)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+		}
+
+		if err := b.rotateStaticRole(req.Storage, name, role); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("error rotating password: %s", err)), nil
+		}
+		return nil, nil
+	}
+
+	if err := storeStaticRole(req.Storage, name, role); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathStaticCredsRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	role, err := staticRoleRead(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("static role %q not found", name)), nil
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"username":            role.Username,
+			"dn":                  role.DN,
+			"password":            role.Password,
+			"last_vault_rotation": role.LastVaultRotation,
+			"rotation_period":     int64(role.RotationPeriod.Seconds()),
+		},
+	}
+	if role.RotationPeriod != 0 {
+		ttl := role.LastVaultRotation.Add(role.RotationPeriod).Sub(time.Now())
+		if ttl < 0 {
+			ttl = 0
+		}
+		resp.Data["ttl"] = int64(ttl.Seconds())
+	}
+
+	return resp, nil
+}
+
+// rotateStaticRoles rotates the passwords of the static roles whose rotation
+// period has elapsed. It is called from the backend's periodic function.
+func (b *backend) rotateStaticRoles(s logical.Storage) error {
+	b.rotationLock.Lock()
+	defer b.rotationLock.Unlock()
+
+	names, err := s.List(staticRolePath)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, name := range names {
+		role, err := staticRoleRead(s, name)
+		if err != nil {
+			return err
+		}
+		if role == nil || role.RotationPeriod == 0 || role.LastVaultRotation.Add(role.RotationPeriod).After(now) {
+			continue
+		}
+
+		if err := b.rotateStaticRole(s, name, role); err != nil {
+			b.Logger().Error("ldap: error rotating static role password", "role", name, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// rotateStaticRole sets a new password on the entry of a static role and
+// stores it. The caller must hold the rotationLock.
+func (b *backend) rotateStaticRole(s logical.Storage, name string, role *staticRoleEntry) error {
+	config, err := getConfig(s)
+	if err != nil {
+		return err
+	}
+
+	password, err := generatePassword(config.PasswordLength)
+	if err != nil {
+		return err
+	}
+	if err := b.client.UpdatePassword(config, role.DN, password); err != nil {
+		return err
+	}
+
+	role.Password = password
+	role.LastVaultRotation = time.Now()
+	if err := storeStaticRole(s, name, role); err != nil {
+		return fmt.Errorf("the password was rotated but could not be stored: %s", err)
+	}
+
+	return nil
+}
+
+func storeStaticRole(s logical.Storage, name string, role *staticRoleEntry) error {
+	entry, err := logical.StorageEntryJSON(staticRolePath+name, role)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+func staticRoleRead(s logical.Storage, name string) (*staticRoleEntry, error) {
+	entry, err := s.Get(staticRolePath + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result staticRoleEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+type staticRoleEntry struct {
+	Username          string        `json:"username"`
+	DN                string        `json:"dn"`
+	RotationPeriod    time.Duration `json:"rotation_period"`
+	Password          string        `json:"password"`
+	LastVaultRotation time.Time     `json:"last_vault_rotation"`
+}
+
+const pathStaticRolesHelpSyn = `
+Manage the static roles rotating the passwords of existing entries.
+`
+
+const pathStaticRolesHelpDesc = `
+Static roles manage the password of an existing LDAP entry, identified by
+"username" and optionally "dn". If "dn" is not set, the entry is looked up
+under the configured "userdn". The password is rotated when the role is
+created, when the "rotation_period" elapses if set, and on demand with the
+"rotate-role/" endpoint.
+
+The username and DN of a static role cannot be changed. Deleting a static
+role leaves the entry with its last password.
+`
+
+const pathStaticCredsHelpSyn = `
+Read the current password of a static role.
+`
+
+const pathStaticCredsHelpDesc = `
+This path returns the current password of the entry of a static role, along
+with the time of its last rotation and the time left until the next one.
+`
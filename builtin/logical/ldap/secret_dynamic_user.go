@@ -0,0 +1,62 @@
+package ldap
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const SecretDynamicUserType = "dynamic_user"
+
+func secretDynamicUser(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretDynamicUserType,
+		Fields: map[string]*framework.FieldSchema{
+			"username": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Username of the user",
+			},
+			"password": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Password of the user",
+			},
+		},
+
+		Renew:  b.secretDynamicUserRenew,
+		Revoke: b.secretDynamicUserRevoke,
+	}
+}
+
+func (b *backend) secretDynamicUserRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleName, _ := req.Secret.InternalData["role"].(string)
+	role, err := dynamicRoleRead(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %q no longer exists", roleName)), nil
+	}
+
+	return framework.LeaseExtend(role.DefaultTTL, role.MaxTTL, b.System())(req, d)
+}
+
+func (b *backend) secretDynamicUserRevoke(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	deletion, ok := req.Secret.InternalData["deletion_ldif"].(string)
+	if !ok {
+		return nil, fmt.Errorf("secret is missing deletion_ldif internal data")
+	}
+	entries, err := parseLDIF(deletion)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := getConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, b.client.Execute(config, entries)
+}
@@ -0,0 +1,72 @@
+package ldap
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const SecretLibraryAccountType = "library_account"
+
+func secretLibraryAccount(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretLibraryAccountType,
+		Fields: map[string]*framework.FieldSchema{
+			"service_account_name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Username of the checked out account",
+			},
+			"password": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Password of the checked out account",
+			},
+		},
+
+		Renew:  b.secretLibraryAccountRenew,
+		Revoke: b.secretLibraryAccountRevoke,
+	}
+}
+
+func (b *backend) secretLibraryAccountRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name, _ := req.Secret.InternalData["library"].(string)
+	library, err := libraryRead(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if library == nil {
+		return logical.ErrorResponse(fmt.Sprintf("library %q no longer exists", name)), nil
+	}
+
+	return framework.LeaseExtend(library.TTL, library.MaxTTL, b.System())(req, d)
+}
+
+func (b *backend) secretLibraryAccountRevoke(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	username, ok := req.Secret.InternalData["service_account_name"].(string)
+	if !ok {
+		return nil, fmt.Errorf("secret is missing service_account_name internal data")
+	}
+	checkOutID, _ := req.Secret.InternalData["check_out_id"].(string)
+
+	b.libraryLock.Lock()
+	defer b.libraryLock.Unlock()
+
+	// The account may already have been checked in, and checked out again
+	// under another lease
+	account, err := libraryAccountRead(req.Storage, username)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil || !account.CheckedOut || account.CheckOutID != checkOutID {
+		return nil, nil
+	}
+
+	config, err := getConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, b.checkInLibraryAccount(req.Storage, config, username, account)
+}
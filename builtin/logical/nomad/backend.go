@@ -0,0 +1,46 @@
+package nomad
+
+import (
+	"strings"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	var b backend
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		Paths: []*framework.Path{
+			pathConfigAccess(&b),
+			pathConfigLease(&b),
+			pathListRoles(&b),
+			pathRoles(&b),
+			pathCredsCreate(&b),
+		},
+
+		Secrets: []*framework.Secret{
+			secretToken(&b),
+		},
+	}
+
+	return &b
+}
+
+type backend struct {
+	*framework.Backend
+}
+
+const backendHelp = `
+The Nomad backend dynamically generates Nomad ACL tokens from the Nomad ACL
+policies of a role. Tokens are deleted when their lease is revoked.
+
+After mounting this backend, the address and management token of the Nomad
+cluster must be configured with the "config/access" endpoint, and roles
+written with the "role/" endpoints before any tokens can be generated.
+`
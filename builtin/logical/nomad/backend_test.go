@@ -0,0 +1,248 @@
+package nomad
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// fakeNomad implements the ACL token endpoints of the Nomad API
+type fakeNomad struct {
+	sync.Mutex
+	nextID int
+	tokens map[string]*aclToken
+}
+
+func (f *fakeNomad) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	if r.Header.Get("X-Nomad-Token") != "management" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/v1/acl/token":
+		var token aclToken
+		if err := json.NewDecoder(r.Body).Decode(&token); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.nextID++
+		token.AccessorID = fmt.Sprintf("accessor-%d", f.nextID)
+		token.SecretID = fmt.Sprintf("secret-%d", f.nextID)
+		f.tokens[token.AccessorID] = &token
+		json.NewEncoder(w).Encode(&token)
+
+	case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/v1/acl/token/"):
+		accessorID := strings.TrimPrefix(r.URL.Path, "/v1/acl/token/")
+		if f.tokens[accessorID] == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.tokens, accessorID)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeNomad) token(accessorID string) *aclToken {
+	f.Lock()
+	defer f.Unlock()
+	return f.tokens[accessorID]
+}
+
+func testBackend(t *testing.T) (*backend, logical.Storage, *fakeNomad, func()) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeNomad{tokens: map[string]*aclToken{}}
+	srv := httptest.NewServer(fake)
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/access",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"address": srv.URL,
+			"token":   "management",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	return b, config.StorageView, fake, srv.Close
+}
+
+func TestBackend_token(t *testing.T) {
+	b, storage, fake, cleanup := testBackend(t)
+	defer cleanup()
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/lease",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"ttl":     "1h",
+			"max_ttl": "2h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	req := &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "role/test",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"policies": "readonly,jobs",
+			"global":   true,
+		},
+	}
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	req.Operation = logical.ReadOperation
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	expected := map[string]interface{}{
+		"policies": []string{"readonly", "jobs"},
+		"global":   true,
+		"type":     "client",
+	}
+	if !reflect.DeepEqual(resp.Data, expected) {
+		t.Fatalf("bad role: %#v", resp.Data)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "creds/test",
+		Storage:     storage,
+		DisplayName: "token-user",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp.Data["secret_id"] != "secret-1" || resp.Data["accessor_id"] != "accessor-1" {
+		t.Fatalf("bad token: %#v", resp.Data)
+	}
+	if resp.Secret == nil || resp.Secret.TTL != time.Hour {
+		t.Fatalf("bad secret: %#v", resp.Secret)
+	}
+	token := fake.token("accessor-1")
+	if token == nil || token.Type != "client" || !token.Global ||
+		!reflect.DeepEqual(token.Policies, []string{"readonly", "jobs"}) ||
+		!strings.HasPrefix(token.Name, "vault-test-token-user-") {
+		t.Fatalf("bad token: %#v", token)
+	}
+
+	secret := resp.Secret
+	secret.IssueTime = time.Now()
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   storage,
+		Secret:    secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	for i := 0; i < 2; i++ {
+		// Revoking a deleted token succeeds
+		resp, err = b.HandleRequest(&logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   storage,
+			Secret:    secret,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+		if fake.token("accessor-1") != nil {
+			t.Fatal("token was not deleted")
+		}
+	}
+}
+
+func TestBackend_management(t *testing.T) {
+	b, storage, fake, cleanup := testBackend(t)
+	defer cleanup()
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "role/admin",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"type": "management",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/admin",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if token := fake.token(resp.Data["accessor_id"].(string)); token == nil || token.Type != "management" {
+		t.Fatalf("bad token: %#v", token)
+	}
+}
+
+func TestBackend_roleValidation(t *testing.T) {
+	b, storage, _, cleanup := testBackend(t)
+	defer cleanup()
+
+	for _, data := range []map[string]interface{}{
+		{},
+		{"type": "client"},
+		{"type": "management", "policies": "readonly"},
+		{"type": "other", "policies": "readonly"},
+	} {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error writing %v: %#v", data, resp)
+		}
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/access",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"address": "127.0.0.1:4646",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error writing an address without scheme: %#v", resp)
+	}
+}
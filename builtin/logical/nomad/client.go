@@ -0,0 +1,117 @@
+package nomad
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/logical"
+)
+
+// client calls the ACL token endpoints of the Nomad HTTP API.
+type client struct {
+	httpClient *http.Client
+	address    string
+	token      string
+}
+
+func nomadClient(s logical.Storage) (*client, error) {
+	conf, err := readConfigAccess(s)
+	if err != nil {
+		return nil, err
+	}
+	if conf == nil {
+		return nil, fmt.Errorf("access credentials for the backend have not been configured; please configure them at the 'config/access' endpoint")
+	}
+
+	httpClient := cleanhttp.DefaultClient()
+	httpClient.Timeout = 30 * time.Second
+
+	return &client{
+		httpClient: httpClient,
+		address:    strings.TrimSuffix(conf.Address, "/"),
+		token:      conf.Token,
+	}, nil
+}
+
+type aclToken struct {
+	AccessorID string   `json:",omitempty"`
+	SecretID   string   `json:",omitempty"`
+	Name       string   `json:",omitempty"`
+	Type       string   `json:",omitempty"`
+	Policies   []string `json:",omitempty"`
+	Global     bool
+}
+
+func (c *client) createToken(token *aclToken) (*aclToken, error) {
+	created := &aclToken{}
+	if err := c.do("POST", "/v1/acl/token", token, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// deleteToken deletes a token by accessor ID, succeeding if it does not
+// exist.
+func (c *client) deleteToken(accessorID string) error {
+	err := c.do("DELETE", "/v1/acl/token/"+url.PathEscape(accessorID), nil, nil)
+	if respErr, ok := err.(*apiError); ok && respErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// apiError is an error response of the Nomad API
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("unexpected response code: %d (%s)", e.StatusCode, e.Message)
+}
+
+func (c *client) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.address+path, body)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Nomad-Token", c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return &apiError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(msg)),
+		}
+	}
+
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package nomad
+
+import (
+	"net/url"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const configAccessKey = "config/access"
+
+func pathConfigAccess(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/access",
+		Fields: map[string]*framework.FieldSchema{
+			"address": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Nomad server address, such as https://127.0.0.1:4646",
+			},
+
+			"token": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Nomad management token used to create and revoke tokens",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigAccessRead,
+			logical.UpdateOperation: b.pathConfigAccessWrite,
+		},
+
+		HelpSynopsis:    pathConfigAccessHelpSyn,
+		HelpDescription: pathConfigAccessHelpDesc,
+	}
+}
+
+func readConfigAccess(s logical.Storage) (*accessConfig, error) {
+	entry, err := s.Get(configAccessKey)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	conf := &accessConfig{}
+	if err := entry.DecodeJSON(conf); err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+func (b *backend) pathConfigAccessRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	conf, err := readConfigAccess(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if conf == nil {
+		return nil, nil
+	}
+
+	// The management token is not returned
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"address": conf.Address,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigAccessWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	conf, err := readConfigAccess(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if conf == nil {
+		conf = &accessConfig{}
+	}
+
+	if v, ok := d.GetOk("address"); ok {
+		conf.Address = v.(string)
+	}
+	if v, ok := d.GetOk("token"); ok {
+		conf.Token = v.(string)
+	}
+
+	if conf.Address == "" {
+		return logical.ErrorResponse("address is required"), nil
+	}
+	if u, err := url.Parse(conf.Address); err != nil || u.Scheme == "" || u.Host == "" {
+		return logical.ErrorResponse("address must be a URL such as https://127.0.0.1:4646"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(configAccessKey, conf)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+type accessConfig struct {
+	Address string `json:"address"`
+	Token   string `json:"token"`
+}
+
+const pathConfigAccessHelpSyn = `
+Configure the address and token used to access Nomad.
+`
+
+const pathConfigAccessHelpDesc = `
+This path configures the address of the Nomad HTTP API, and the management
+token Vault uses to create and revoke ACL tokens. The token is not returned
+when reading the configuration.
+`
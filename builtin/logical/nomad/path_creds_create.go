@@ -0,0 +1,92 @@
+package nomad
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// maxTokenNameLength is the maximum length of the names of Nomad tokens
+const maxTokenNameLength = 256
+
+func pathCredsCreate(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "creds/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathTokenRead,
+		},
+
+		HelpSynopsis:    pathCredsHelpSyn,
+		HelpDescription: pathCredsHelpDesc,
+	}
+}
+
+func (b *backend) pathTokenRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	role, err := b.Role(req.Storage, name)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving role: %s", err)
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %q not found", name)), nil
+	}
+
+	lease, err := b.LeaseConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if lease == nil {
+		lease = &configLease{}
+	}
+
+	c, err := nomadClient(req.Storage)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	tokenName := fmt.Sprintf("vault-%s-%s-%d", name, req.DisplayName, time.Now().UnixNano())
+	if len(tokenName) > maxTokenNameLength {
+		tokenName = tokenName[:maxTokenNameLength]
+	}
+
+	token, err := c.createToken(&aclToken{
+		Name:     tokenName,
+		Type:     role.TokenType,
+		Policies: role.Policies,
+		Global:   role.Global,
+	})
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	resp := b.Secret(SecretTokenType).Response(map[string]interface{}{
+		"secret_id":   token.SecretID,
+		"accessor_id": token.AccessorID,
+	}, map[string]interface{}{
+		"accessor_id": token.AccessorID,
+	})
+	resp.Secret.TTL = lease.TTL
+
+	return resp, nil
+}
+
+const pathCredsHelpSyn = `
+Generate a Nomad token from a specific Vault role.
+`
+
+const pathCredsHelpDesc = `
+This path generates a Nomad ACL token for a role. The secret ID of the token
+is used to authenticate to Nomad, and the token is deleted when its lease is
+revoked.
+`
@@ -0,0 +1,193 @@
+package nomad
+
+import (
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    pathRolesHelpSyn,
+		HelpDescription: pathRolesHelpDesc,
+	}
+}
+
+func pathRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role",
+			},
+
+			"policies": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma-separated list of Nomad ACL policies attached to client tokens",
+			},
+
+			"global": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: "Whether the tokens are replicated to all Nomad regions",
+			},
+
+			"type": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "client",
+				Description: `Which type of token to create: 'client' or
+'management'. Management tokens do not take
+policies. Defaults to 'client'.`,
+			},
+		},
+
+		ExistenceCheck: b.pathRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.CreateOperation: b.pathRoleWrite,
+			logical.UpdateOperation: b.pathRoleWrite,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    pathRolesHelpSyn,
+		HelpDescription: pathRolesHelpDesc,
+	}
+}
+
+func (b *backend) pathRoleExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	role, err := b.Role(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return role != nil, nil
+}
+
+func (b *backend) pathRoleList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("role/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathRoleRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := b.Role(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"policies": role.Policies,
+			"global":   role.Global,
+			"type":     role.TokenType,
+		},
+	}, nil
+}
+
+func (b *backend) pathRoleWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	role, err := b.Role(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role = &roleConfig{}
+	}
+
+	if v, ok := d.GetOk("policies"); ok {
+		role.Policies = v.([]string)
+	}
+	if v, ok := d.GetOk("global"); ok {
+		role.Global = v.(bool)
+	}
+	if v, ok := d.GetOk("type"); ok {
+		role.TokenType = v.(string)
+	} else if role.TokenType == "" {
+		role.TokenType = d.Get("type").(string)
+	}
+
+	switch role.TokenType {
+	case "client":
+		if len(role.Policies) == 0 {
+			return logical.ErrorResponse("policies cannot be empty for client tokens"), nil
+		}
+	case "management":
+		if len(role.Policies) != 0 {
+			return logical.ErrorResponse("policies cannot be set for management tokens"), nil
+		}
+	default:
+		return logical.ErrorResponse(`type must be "client" or "management"`), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("role/"+name, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathRoleDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete("role/" + d.Get("name").(string)); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// Role returns the role of the given name
+func (b *backend) Role(s logical.Storage, name string) (*roleConfig, error) {
+	entry, err := s.Get("role/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result roleConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+type roleConfig struct {
+	Policies  []string `json:"policies"`
+	Global    bool     `json:"global"`
+	TokenType string   `json:"type"`
+}
+
+const pathRolesHelpSyn = `
+Manage the roles used to generate Nomad tokens.
+`
+
+const pathRolesHelpDesc = `
+This path lets you manage the roles used to generate Nomad ACL tokens.
+
+Client tokens are attached to the Nomad ACL policies listed in "policies",
+which must exist in Nomad. Management tokens have full access to Nomad and
+take no policies. Tokens are local to the region of the configured Nomad
+server unless "global" is set.
+`
@@ -0,0 +1,57 @@
+package nomad
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const SecretTokenType = "token"
+
+func secretToken(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretTokenType,
+		Fields: map[string]*framework.FieldSchema{
+			"secret_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Secret ID of the token",
+			},
+			"accessor_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Accessor ID of the token",
+			},
+		},
+
+		Renew:  b.secretTokenRenew,
+		Revoke: b.secretTokenRevoke,
+	}
+}
+
+func (b *backend) secretTokenRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	lease, err := b.LeaseConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if lease == nil {
+		lease = &configLease{}
+	}
+
+	return framework.LeaseExtend(lease.TTL, lease.MaxTTL, b.System())(req, d)
+}
+
+func (b *backend) secretTokenRevoke(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	accessorID, ok := req.Secret.InternalData["accessor_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("secret is missing accessor_id internal data")
+	}
+
+	c, err := nomadClient(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, c.deleteToken(accessorID)
+}
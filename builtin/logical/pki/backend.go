@@ -28,6 +28,7 @@ func Backend() *backend {
 				"ca",
 				"crl/pem",
 				"crl",
+				"est/*",
 			},
 
 			LocalStorage: []string{
@@ -47,6 +48,7 @@ func Backend() *backend {
 			pathConfigCA(&b),
 			pathConfigCRL(&b),
 			pathConfigURLs(&b),
+			pathConfigEST(&b),
 			pathSignVerbatim(&b),
 			pathSign(&b),
 			pathIssue(&b),
@@ -59,6 +61,9 @@ func Backend() *backend {
 			pathFetchListCerts(&b),
 			pathRevoke(&b),
 			pathTidy(&b),
+			pathESTCACerts(&b),
+			pathESTSimpleEnroll(&b),
+			pathESTSimpleReenroll(&b),
 		},
 
 		Secrets: []*framework.Secret{
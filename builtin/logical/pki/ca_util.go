@@ -1,21 +1,39 @@
 package pki
 
 import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/managedkeys"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
 
+// caManagedKeyEntry records the managed key holding the private key of the
+// CA, which is then never stored by the backend
+type caManagedKeyEntry struct {
+	Name string `json:"name"`
+}
+
 func (b *backend) getGenerationParams(
 	data *framework.FieldData,
-) (exported bool, format string, role *roleEntry, errorResp *logical.Response) {
+) (exported bool, format string, role *roleEntry, managedKey *caManagedKey, errorResp *logical.Response) {
 	exportedStr := data.Get("exported").(string)
 	switch exportedStr {
 	case "exported":
 		exported = true
 	case "internal":
+	case "managed":
+		managedKey, errorResp = b.getCAManagedKey(data.Get("managed_key_name").(string))
+		if errorResp != nil {
+			return
+		}
 	default:
 		errorResp = logical.ErrorResponse(
-			`The "exported" path parameter must be "internal" or "exported"`)
+			`The "exported" path parameter must be "internal", "exported" or "managed"`)
 		return
 	}
 
@@ -36,6 +54,15 @@ func (b *backend) getGenerationParams(
 		EnforceHostnames: false,
 	}
 
+	if managedKey != nil {
+		// The key type follows from the managed key
+		role.KeyType, role.KeyBits = managedKey.keyTypeAndBits()
+		if role.KeyType == "" {
+			errorResp = logical.ErrorResponse("managed key type is not supported for CA keys")
+		}
+		return
+	}
+
 	if role.KeyType == "rsa" && role.KeyBits < 2048 {
 		errorResp = logical.ErrorResponse("RSA keys < 2048 bits are unsafe and not supported")
 		return
@@ -45,3 +72,82 @@ func (b *backend) getGenerationParams(
 
 	return
 }
+
+// caManagedKey is a managed key used as the private key of the CA
+type caManagedKey struct {
+	Name string
+	Key  managedkeys.Key
+}
+
+func (m *caManagedKey) keyTypeAndBits() (string, int) {
+	switch pub := m.Key.Public().(type) {
+	case *rsa.PublicKey:
+		return "rsa", pub.N.BitLen()
+	case *ecdsa.PublicKey:
+		return "ec", pub.Params().BitSize
+	}
+	return "", 0
+}
+
+func (m *caManagedKey) privateKeyType() certutil.PrivateKeyType {
+	keyType, _ := m.keyTypeAndBits()
+	return certutil.PrivateKeyType(keyType)
+}
+
+// getCAManagedKey looks up the named managed key, returning an error response
+// if it is not available to this mount
+func (b *backend) getCAManagedKey(name string) (*caManagedKey, *logical.Response) {
+	if name == "" {
+		return nil, logical.ErrorResponse(`"managed_key_name" is required when using a managed key`)
+	}
+	key, err := b.System().ManagedKey(name)
+	switch {
+	case err == managedkeys.ErrNotFound:
+		return nil, logical.ErrorResponse(fmt.Sprintf("managed key %q not found or not allowed for this mount", name))
+	case err != nil:
+		return nil, logical.ErrorResponse(fmt.Sprintf("error accessing managed key %q: %v", name, err))
+	}
+	return &caManagedKey{
+		Name: name,
+		Key:  key,
+	}, nil
+}
+
+// storeCAManagedKey records the managed key used by the CA, or removes the
+// record when the CA key is held by the backend itself
+func storeCAManagedKey(req *logical.Request, managedKey *caManagedKey) error {
+	if managedKey == nil {
+		return req.Storage.Delete("config/ca_managed_key")
+	}
+
+	entry, err := logical.StorageEntryJSON("config/ca_managed_key", &caManagedKeyEntry{
+		Name: managedKey.Name,
+	})
+	if err != nil {
+		return err
+	}
+	return req.Storage.Put(entry)
+}
+
+// fetchCAManagedKey returns the managed key used by the CA, or nil if the CA
+// key is held by the backend
+func fetchCAManagedKey(b *backend, req *logical.Request) (*caManagedKey, error) {
+	entry, err := req.Storage.Get("config/ca_managed_key")
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch CA managed key: %v", err)}
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var keyEntry caManagedKeyEntry
+	if err := entry.DecodeJSON(&keyEntry); err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to decode CA managed key: %v", err)}
+	}
+
+	managedKey, errResp := b.getCAManagedKey(keyEntry.Name)
+	if errResp != nil {
+		return nil, errutil.UserError{Err: errResp.Data["error"].(string)}
+	}
+	return managedKey, nil
+}
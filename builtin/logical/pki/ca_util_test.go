@@ -0,0 +1,146 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/helper/managedkeys"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestBackend_ManagedKeyCA(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	system := &logical.StaticSystemView{
+		DefaultLeaseTTLVal: 24 * time.Hour,
+		MaxLeaseTTLVal:     32 * 24 * time.Hour,
+		ManagedKeys: map[string]managedkeys.Key{
+			"root-key":         rsaKey,
+			"intermediate-key": ecKey,
+		},
+	}
+
+	newBackend := func() (*backend, logical.Storage) {
+		config := logical.TestBackendConfig()
+		config.StorageView = &logical.InmemStorage{}
+		config.System = system
+		b := Backend()
+		if _, err := b.Setup(config); err != nil {
+			t.Fatal(err)
+		}
+		return b, config.StorageView
+	}
+
+	write := func(b *backend, s logical.Storage, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   s,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("path %s: err: %v resp: %#v", path, err, resp)
+		}
+		return resp
+	}
+
+	parseCert := func(pemCert string) *x509.Certificate {
+		block, _ := pem.Decode([]byte(pemCert))
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	// Unknown managed keys are rejected
+	rootBackend, rootStorage := newBackend()
+	resp, _ := rootBackend.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "root/generate/managed",
+		Storage:   rootStorage,
+		Data: map[string]interface{}{
+			"common_name":      "root.example.com",
+			"managed_key_name": "missing",
+		},
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for unknown managed key, got %#v", resp)
+	}
+
+	// Generate a root whose key is a managed key
+	resp = write(rootBackend, rootStorage, "root/generate/managed", map[string]interface{}{
+		"common_name":      "root.example.com",
+		"managed_key_name": "root-key",
+		"ttl":              "48h",
+	})
+	if _, ok := resp.Data["private_key"]; ok {
+		t.Fatal("managed key must not be returned")
+	}
+	rootCert := parseCert(resp.Data["certificate"].(string))
+	equal, err := certutil.ComparePublicKeys(rootCert.PublicKey, rsaKey.Public())
+	if err != nil || !equal {
+		t.Fatalf("root certificate does not use the managed key: %v", err)
+	}
+	if err := rootCert.CheckSignatureFrom(rootCert); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := rootStorage.Get("config/ca_bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cb certutil.CertBundle
+	if err := entry.DecodeJSON(&cb); err != nil {
+		t.Fatal(err)
+	}
+	if cb.PrivateKey != "" {
+		t.Fatal("managed key must not be stored")
+	}
+
+	// Generate an intermediate CSR using a managed key and sign it with the
+	// managed root
+	intBackend, intStorage := newBackend()
+	resp = write(intBackend, intStorage, "intermediate/generate/managed", map[string]interface{}{
+		"common_name":      "intermediate.example.com",
+		"managed_key_name": "intermediate-key",
+	})
+	resp = write(rootBackend, rootStorage, "root/sign-intermediate", map[string]interface{}{
+		"csr": resp.Data["csr"],
+		"ttl": "24h",
+	})
+	intCert := parseCert(resp.Data["certificate"].(string))
+	if err := intCert.CheckSignatureFrom(rootCert); err != nil {
+		t.Fatal(err)
+	}
+	write(intBackend, intStorage, "intermediate/set-signed", map[string]interface{}{
+		"certificate": resp.Data["certificate"],
+	})
+
+	// Issue a leaf certificate signed by the managed intermediate key
+	write(intBackend, intStorage, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"max_ttl":          "1h",
+	})
+	resp = write(intBackend, intStorage, "issue/example", map[string]interface{}{
+		"common_name": "www.example.com",
+	})
+	leafCert := parseCert(resp.Data["certificate"].(string))
+	if err := leafCert.CheckSignatureFrom(intCert); err != nil {
+		t.Fatal(err)
+	}
+}
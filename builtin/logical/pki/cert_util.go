@@ -12,12 +12,14 @@ import (
 	"encoding/pem"
 	"fmt"
 	"net"
+	"net/url"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/vault/helper/certutil"
 	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/identitytpl"
 	"github.com/hashicorp/vault/helper/parseutil"
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
@@ -41,11 +43,13 @@ type creationBundle struct {
 	DNSNames       []string
 	EmailAddresses []string
 	IPAddresses    []net.IP
+	URIs           []*url.URL
 	IsCA           bool
 	KeyType        string
 	KeyBits        int
 	SigningBundle  *caInfoBundle
 	TTL            time.Duration
+	NotAfter       time.Time
 	KeyUsage       x509.KeyUsage
 	ExtKeyUsage    certExtKeyUsage
 
@@ -57,6 +61,19 @@ type creationBundle struct {
 
 	// The maximum path length to encode
 	MaxPathLength int
+
+	// If set, the managed key to use as the key of the new certificate or
+	// CSR instead of generating one
+	ManagedKey *caManagedKey
+}
+
+// notAfter returns the expiration to encode into the certificate; an explicit
+// not_after date wins over the TTL
+func (c *creationBundle) notAfter() time.Time {
+	if !c.NotAfter.IsZero() {
+		return c.NotAfter
+	}
+	return time.Now().Add(c.TTL)
 }
 
 type caInfoBundle struct {
@@ -85,6 +102,10 @@ func (b *caInfoBundle) GetCAChain() []*certutil.CertBlock {
 	return chain
 }
 
+// notAfterFormat is the layout accepted for the not_after role and request
+// parameters
+const notAfterFormat = "2006-01-02T15:04:05Z"
+
 var (
 	hostnameRegex                = regexp.MustCompile(`^(([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9\-]*[a-zA-Z0-9])\.)*([A-Za-z0-9]|[A-Za-z0-9][A-Za-z0-9\-]*[A-Za-z0-9])$`)
 	oidExtensionBasicConstraints = []int{2, 5, 29, 19}
@@ -142,7 +163,7 @@ func validateKeyTypeLength(keyType string, keyBits int) *logical.Response {
 
 // Fetches the CA info. Unlike other certificates, the CA info is stored
 // in the backend as a CertBundle, because we are storing its private key
-func fetchCAInfo(req *logical.Request) (*caInfoBundle, error) {
+func fetchCAInfo(b *backend, req *logical.Request) (*caInfoBundle, error) {
 	bundleEntry, err := req.Storage.Get("config/ca_bundle")
 	if err != nil {
 		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch local CA certificate/key: %v", err)}
@@ -165,6 +186,18 @@ func fetchCAInfo(req *logical.Request) (*caInfoBundle, error) {
 		return nil, errutil.InternalError{Err: "stored CA information not able to be parsed"}
 	}
 
+	if parsedBundle.PrivateKey == nil {
+		managedKey, err := fetchCAManagedKey(b, req)
+		if err != nil {
+			return nil, err
+		}
+		if managedKey == nil {
+			return nil, errutil.InternalError{Err: "stored CA information has no private key"}
+		}
+		parsedBundle.PrivateKey = managedKey.Key
+		parsedBundle.PrivateKeyType = managedKey.privateKeyType()
+	}
+
 	caInfo := &caInfoBundle{*parsedBundle, nil}
 
 	entries, err := getURLs(req)
@@ -248,6 +281,33 @@ func fetchCertBySerial(req *logical.Request, prefix, serial string) (*logical.St
 	return certEntry, nil
 }
 
+// storeCertRole records the name of the role that issued the certificate
+// with the given serial, so that role-bound features such as EST can tell
+// which certificates they are allowed to trust.
+func storeCertRole(s logical.Storage, serial, roleName string) error {
+	err := s.Put(&logical.StorageEntry{
+		Key:   "cert-roles/" + normalizeSerial(serial),
+		Value: []byte(roleName),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to store certificate role: %v", err)
+	}
+	return nil
+}
+
+// fetchCertRole returns the name of the role that issued the certificate with
+// the given serial, or an empty string if none was recorded.
+func fetchCertRole(s logical.Storage, serial string) (string, error) {
+	entry, err := s.Get("cert-roles/" + normalizeSerial(serial))
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch certificate role: %v", err)
+	}
+	if entry == nil {
+		return "", nil
+	}
+	return string(entry.Value), nil
+}
+
 // Given a set of requested names for a certificate, verifies that all of them
 // match the various toggles set in the role for controlling issuance.
 // If one does not pass, it is returned in the string argument.
@@ -379,6 +439,16 @@ func validateNames(req *logical.Request, names []string, role *roleEntry) string
 					continue
 				}
 
+				// Templated domains that cannot be populated for this
+				// requester simply do not match
+				if role.AllowedDomainsTemplate {
+					_, populated, err := identitytpl.PopulateString(req.Entity, currDomain)
+					if err != nil {
+						continue
+					}
+					currDomain = populated
+				}
+
 				// First, allow an exact match of the base domain if that role flag
 				// is enabled
 				if role.AllowBareDomains &&
@@ -415,10 +485,43 @@ func validateNames(req *logical.Request, names []string, role *roleEntry) string
 	return ""
 }
 
+// Given a set of requested URI SANs, verifies that all of them are allowed by
+// the role. If one does not pass, it is returned in the string argument.
+func validateURISANs(req *logical.Request, uris []*url.URL, role *roleEntry) string {
+	if role.AllowAnyName {
+		return ""
+	}
+
+	allowed := strutil.ParseStringSlice(role.AllowedURISANs, ",")
+	for _, uri := range uris {
+		valid := false
+		for _, allowedURI := range allowed {
+			if role.AllowedURISANsTemplate {
+				_, populated, err := identitytpl.PopulateString(req.Entity, allowedURI)
+				if err != nil {
+					continue
+				}
+				allowedURI = populated
+			}
+
+			if glob.Glob(allowedURI, uri.String()) {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return uri.String()
+		}
+	}
+
+	return ""
+}
+
 func generateCert(b *backend,
 	role *roleEntry,
 	signingBundle *caInfoBundle,
 	isCA bool,
+	managedKey *caManagedKey,
 	req *logical.Request,
 	data *framework.FieldData) (*certutil.ParsedCertBundle, error) {
 
@@ -431,6 +534,8 @@ func generateCert(b *backend,
 		return nil, err
 	}
 
+	creationBundle.ManagedKey = managedKey
+
 	if isCA {
 		creationBundle.IsCA = isCA
 
@@ -470,6 +575,7 @@ func generateCert(b *backend,
 func generateIntermediateCSR(b *backend,
 	role *roleEntry,
 	signingBundle *caInfoBundle,
+	managedKey *caManagedKey,
 	req *logical.Request,
 	data *framework.FieldData) (*certutil.ParsedCSRBundle, error) {
 
@@ -477,6 +583,7 @@ func generateIntermediateCSR(b *backend,
 	if err != nil {
 		return nil, err
 	}
+	creationBundle.ManagedKey = managedKey
 
 	parsedBundle, err := createCSR(creationBundle)
 	if err != nil {
@@ -704,11 +811,40 @@ func generateCreationBundle(b *backend,
 		}
 	}
 
-	// Set OU (organizationalUnit) values if specified in the role
+	// Get and verify any URI SANs
+	uris := []*url.URL{}
+	{
+		if csr != nil && role.UseCSRSANs {
+			uris = csr.URIs
+		} else if uriAltInt, ok := data.GetOk("uri_sans"); ok {
+			for _, v := range strutil.ParseDedupAndSortStrings(uriAltInt.(string), ",") {
+				parsedURI, err := url.Parse(v)
+				if err != nil || parsedURI.Scheme == "" {
+					return nil, errutil.UserError{Err: fmt.Sprintf(
+						"the value '%s' is not a valid URI", v)}
+				}
+				uris = append(uris, parsedURI)
+			}
+		}
+
+		badURI := validateURISANs(req, uris, role)
+		if len(badURI) != 0 {
+			return nil, errutil.UserError{Err: fmt.Sprintf(
+				"URI Subject Alternative Name %s not allowed by this role", badURI)}
+		}
+	}
+
+	// Set OU (organizationalUnit) values if specified in the role, populating
+	// any identity templates from the requester
 	ou := []string{}
 	{
 		if role.OU != "" {
-			ou = strutil.RemoveDuplicates(strutil.ParseStringSlice(role.OU, ","), false)
+			ou, err = identitytpl.PopulateStrings(req.Entity, strutil.ParseStringSlice(role.OU, ","))
+			if err != nil {
+				return nil, errutil.UserError{Err: fmt.Sprintf(
+					"unable to populate OU template: %s", err)}
+			}
+			ou = strutil.RemoveDuplicates(ou, false)
 		}
 	}
 
@@ -720,10 +856,12 @@ func generateCreationBundle(b *backend,
 		}
 	}
 
-	// Get the TTL and very it against the max allowed
+	// Get the TTL and very it against the max allowed. A not_after date, from
+	// either the request or the role, takes precedence over the TTL.
 	var ttlField string
 	var ttl time.Duration
 	var maxTTL time.Duration
+	var notAfter time.Time
 	var ttlFieldInt interface{}
 	{
 		ttlFieldInt, ok = data.GetOk("ttl")
@@ -733,9 +871,27 @@ func generateCreationBundle(b *backend,
 			ttlField = ttlFieldInt.(string)
 		}
 
-		if len(ttlField) == 0 {
+		notAfterField := role.NotAfter
+		if notAfterInt, ok := data.GetOk("not_after"); ok && notAfterInt.(string) != "" {
+			notAfterField = notAfterInt.(string)
+		}
+
+		switch {
+		case notAfterField != "":
+			notAfter, err = time.Parse(notAfterFormat, notAfterField)
+			if err != nil {
+				return nil, errutil.UserError{Err: fmt.Sprintf(
+					"invalid not_after, must be formatted as %s: %s", notAfterFormat, err)}
+			}
+			ttl = notAfter.Sub(time.Now())
+			if ttl <= 0 {
+				return nil, errutil.UserError{Err: "not_after is in the past"}
+			}
+			// Treat it as an explicitly requested TTL for the checks below
+			ttlField = notAfterField
+		case len(ttlField) == 0:
 			ttl = b.System().DefaultLeaseTTL()
-		} else {
+		default:
 			ttl, err = parseutil.ParseDurationSecond(ttlField)
 			if err != nil {
 				return nil, errutil.UserError{Err: fmt.Sprintf(
@@ -797,10 +953,12 @@ func generateCreationBundle(b *backend,
 		DNSNames:       dnsNames,
 		EmailAddresses: emailAddresses,
 		IPAddresses:    ipAddresses,
+		URIs:           uris,
 		KeyType:        role.KeyType,
 		KeyBits:        role.KeyBits,
 		SigningBundle:  signingBundle,
 		TTL:            ttl,
+		NotAfter:       notAfter,
 		KeyUsage:       x509.KeyUsage(parseKeyUsages(role.KeyUsage)),
 		ExtKeyUsage:    extUsage,
 	}
@@ -872,7 +1030,10 @@ func createCertificate(creationInfo *creationBundle) (*certutil.ParsedCertBundle
 		return nil, err
 	}
 
-	if err := certutil.GeneratePrivateKey(creationInfo.KeyType,
+	if creationInfo.ManagedKey != nil {
+		result.PrivateKey = creationInfo.ManagedKey.Key
+		result.PrivateKeyType = creationInfo.ManagedKey.privateKeyType()
+	} else if err := certutil.GeneratePrivateKey(creationInfo.KeyType,
 		creationInfo.KeyBits,
 		result); err != nil {
 		return nil, err
@@ -893,12 +1054,13 @@ func createCertificate(creationInfo *creationBundle) (*certutil.ParsedCertBundle
 		SerialNumber:   serialNumber,
 		Subject:        subject,
 		NotBefore:      time.Now().Add(-30 * time.Second),
-		NotAfter:       time.Now().Add(creationInfo.TTL),
+		NotAfter:       creationInfo.notAfter(),
 		IsCA:           false,
 		SubjectKeyId:   subjKeyID,
 		DNSNames:       creationInfo.DNSNames,
 		EmailAddresses: creationInfo.EmailAddresses,
 		IPAddresses:    creationInfo.IPAddresses,
+		URIs:           creationInfo.URIs,
 	}
 
 	// Add this before calling addKeyUsages
@@ -977,7 +1139,10 @@ func createCSR(creationInfo *creationBundle) (*certutil.ParsedCSRBundle, error)
 	var err error
 	result := &certutil.ParsedCSRBundle{}
 
-	if err := certutil.GeneratePrivateKey(creationInfo.KeyType,
+	if creationInfo.ManagedKey != nil {
+		result.PrivateKey = creationInfo.ManagedKey.Key
+		result.PrivateKeyType = creationInfo.ManagedKey.privateKeyType()
+	} else if err := certutil.GeneratePrivateKey(creationInfo.KeyType,
 		creationInfo.KeyBits,
 		result); err != nil {
 		return nil, err
@@ -993,6 +1158,7 @@ func createCSR(creationInfo *creationBundle) (*certutil.ParsedCSRBundle, error)
 		DNSNames:       creationInfo.DNSNames,
 		EmailAddresses: creationInfo.EmailAddresses,
 		IPAddresses:    creationInfo.IPAddresses,
+		URIs:           creationInfo.URIs,
 	}
 
 	switch creationInfo.KeyType {
@@ -1057,7 +1223,7 @@ func signCertificate(creationInfo *creationBundle,
 		SerialNumber: serialNumber,
 		Subject:      subject,
 		NotBefore:    time.Now().Add(-30 * time.Second),
-		NotAfter:     time.Now().Add(creationInfo.TTL),
+		NotAfter:     creationInfo.notAfter(),
 		SubjectKeyId: subjKeyID[:],
 	}
 
@@ -1074,12 +1240,14 @@ func signCertificate(creationInfo *creationBundle,
 		certTemplate.DNSNames = csr.DNSNames
 		certTemplate.EmailAddresses = csr.EmailAddresses
 		certTemplate.IPAddresses = csr.IPAddresses
+		certTemplate.URIs = csr.URIs
 
 		certTemplate.ExtraExtensions = csr.Extensions
 	} else {
 		certTemplate.DNSNames = creationInfo.DNSNames
 		certTemplate.EmailAddresses = creationInfo.EmailAddresses
 		certTemplate.IPAddresses = creationInfo.IPAddresses
+		certTemplate.URIs = creationInfo.URIs
 	}
 
 	addKeyUsages(creationInfo, certTemplate)
@@ -0,0 +1,134 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	oidPKCS7Data              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS7SignedData        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidPKCS9ChallengePassword = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}
+)
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      pkcs7ContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	SignerInfos      asn1.RawValue
+}
+
+// encodeCertsOnlyPKCS7 returns a degenerate, certificates-only PKCS#7
+// SignedData structure containing the given certificates, as used by EST
+// responses
+func encodeCertsOnlyPKCS7(certs []*x509.Certificate) ([]byte, error) {
+	var rawCerts bytes.Buffer
+	for _, cert := range certs {
+		rawCerts.Write(cert.Raw)
+	}
+
+	emptySet := asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true}
+	signedData, err := asn1.Marshal(pkcs7SignedData{
+		Version:          1,
+		DigestAlgorithms: emptySet,
+		ContentInfo: pkcs7ContentInfo{
+			ContentType: oidPKCS7Data,
+		},
+		Certificates: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      rawCerts.Bytes(),
+		},
+		SignerInfos: emptySet,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(pkcs7ContentInfo{
+		ContentType: oidPKCS7SignedData,
+		Content: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      signedData,
+		},
+	})
+}
+
+// decodeESTBody decodes the base64 body of an EST request, ignoring any line
+// breaks or other whitespace
+func decodeESTBody(body []byte) ([]byte, error) {
+	cleaned := strings.Join(strings.Fields(string(body)), "")
+	if cleaned == "" {
+		return nil, errors.New("request body is empty")
+	}
+	return base64.StdEncoding.DecodeString(cleaned)
+}
+
+// encodeESTBody base64-encodes an EST response body, wrapping lines at 64
+// characters
+func encodeESTBody(der []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(der)
+	var ret bytes.Buffer
+	for len(encoded) > 64 {
+		ret.WriteString(encoded[:64])
+		ret.WriteString("\r\n")
+		encoded = encoded[64:]
+	}
+	ret.WriteString(encoded)
+	ret.WriteString("\r\n")
+	return ret.Bytes()
+}
+
+type csrTBS struct {
+	Raw           asn1.RawContent
+	Version       int
+	Subject       asn1.RawValue
+	PublicKey     asn1.RawValue
+	RawAttributes []asn1.RawValue `asn1:"tag:0"`
+}
+
+type csrAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+// csrChallengePassword extracts the PKCS#9 challengePassword attribute from
+// a CSR, returning an empty string if it is not present
+func csrChallengePassword(csr *x509.CertificateRequest) (string, error) {
+	var tbs csrTBS
+	if _, err := asn1.Unmarshal(csr.RawTBSCertificateRequest, &tbs); err != nil {
+		return "", fmt.Errorf("unable to parse CSR attributes: %v", err)
+	}
+
+	for _, rawAttr := range tbs.RawAttributes {
+		var attr csrAttribute
+		if _, err := asn1.Unmarshal(rawAttr.FullBytes, &attr); err != nil {
+			return "", fmt.Errorf("unable to parse CSR attribute: %v", err)
+		}
+		if !attr.Type.Equal(oidPKCS9ChallengePassword) {
+			continue
+		}
+
+		var password string
+		if _, err := asn1.Unmarshal(attr.Values.Bytes, &password); err != nil {
+			return "", fmt.Errorf("unable to parse CSR challenge password: %v", err)
+		}
+		return password, nil
+	}
+
+	return "", nil
+}
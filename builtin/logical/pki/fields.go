@@ -28,6 +28,19 @@ certificate pem. Defaults to "pem".`,
 comma-delimited list`,
 	}
 
+	fields["uri_sans"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `The requested URI SANs, if any, in a
+comma-delimited list`,
+	}
+
+	fields["not_after"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Set the Not After field of the certificate
+to this date, overriding the TTL. The value must
+be in UTC and formatted as YYYY-MM-ddTHH:MM:SSZ.`,
+	}
+
 	return fields
 }
 
@@ -111,10 +124,19 @@ generating a CSR for an intermediate CA.`,
 func addCAKeyGenerationFields(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
 	fields["exported"] = &framework.FieldSchema{
 		Type: framework.TypeString,
-		Description: `Must be "internal" or "exported". If set to
-"exported", the generated private key will be
-returned. This is your *only* chance to retrieve
-the private key!`,
+		Description: `Must be "internal", "exported" or "managed".
+If set to "exported", the generated private key will
+be returned. This is your *only* chance to retrieve
+the private key! If set to "managed", the private key
+is the managed key given in "managed_key_name" and
+is never held by Vault.`,
+	}
+
+	fields["managed_key_name"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `The name of the managed key to use when
+"exported" is "managed". The key type and size are
+taken from the managed key.`,
 	}
 
 	fields["key_bits"] = &framework.FieldSchema{
@@ -0,0 +1,189 @@
+package pki
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// estConfig holds the configuration of the EST enrollment endpoints
+type estConfig struct {
+	Enabled               bool     `json:"enabled" mapstructure:"enabled" structs:"enabled"`
+	DefaultRole           string   `json:"default_role" mapstructure:"default_role" structs:"default_role"`
+	AllowedRoles          []string `json:"allowed_roles" mapstructure:"allowed_roles" structs:"allowed_roles"`
+	ChallengePasswordHash []byte   `json:"challenge_password_hash" mapstructure:"challenge_password_hash" structs:"challenge_password_hash"`
+}
+
+// roleForLabel returns the name of the role to use for an EST request made
+// with the given label, or an empty string if the label is not allowed
+func (c *estConfig) roleForLabel(label string) string {
+	if label == "" {
+		return c.DefaultRole
+	}
+	if strutil.StrListContains(c.AllowedRoles, label) {
+		return label
+	}
+	return ""
+}
+
+func pathConfigEST(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/est",
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: `Whether the EST enrollment endpoints are enabled`,
+			},
+
+			"default_role": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The role used for EST requests that do not
+include a label in the path`,
+			},
+
+			"allowed_roles": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of roles that may be used
+for enrollment by naming them as the EST label in the
+request path, e.g. "est/<role>/simpleenroll"`,
+			},
+
+			"challenge_password": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `If set, clients without a client certificate
+issued by this CA may enroll by including this value as
+the challengePassword attribute of their CSR. Set to an
+empty string to disable password based enrollment.`,
+			},
+		},
+
+		ExistenceCheck: b.pathESTExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathESTRead,
+			logical.CreateOperation: b.pathESTWrite,
+			logical.UpdateOperation: b.pathESTWrite,
+		},
+
+		HelpSynopsis:    pathConfigESTHelpSyn,
+		HelpDescription: pathConfigESTHelpDesc,
+	}
+}
+
+func (b *backend) EST(s logical.Storage) (*estConfig, error) {
+	entry, err := s.Get("config/est")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result estConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathESTExistenceCheck(
+	req *logical.Request, data *framework.FieldData) (bool, error) {
+	config, err := b.EST(req.Storage)
+	if err != nil {
+		return false, err
+	}
+	return config != nil, nil
+}
+
+func (b *backend) pathESTRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.EST(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":                config.Enabled,
+			"default_role":           config.DefaultRole,
+			"allowed_roles":          config.AllowedRoles,
+			"challenge_password_set": len(config.ChallengePasswordHash) != 0,
+		},
+	}, nil
+}
+
+func (b *backend) pathESTWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.EST(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &estConfig{}
+	}
+
+	if enabledRaw, ok := data.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+	if defaultRoleRaw, ok := data.GetOk("default_role"); ok {
+		config.DefaultRole = defaultRoleRaw.(string)
+	}
+	if allowedRolesRaw, ok := data.GetOk("allowed_roles"); ok {
+		config.AllowedRoles = allowedRolesRaw.([]string)
+	}
+	if passwordRaw, ok := data.GetOk("challenge_password"); ok {
+		config.ChallengePasswordHash = nil
+		if password := passwordRaw.(string); password != "" {
+			config.ChallengePasswordHash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Make sure that every role that can be used for enrollment exists
+	for _, roleName := range append([]string{config.DefaultRole}, config.AllowedRoles...) {
+		if roleName == "" {
+			continue
+		}
+		role, err := b.getRole(req.Storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return logical.ErrorResponse(fmt.Sprintf("role %q does not exist", roleName)), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("config/est", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+const pathConfigESTHelpSyn = `
+Configure the EST (RFC 7030) enrollment endpoints.
+`
+
+const pathConfigESTHelpDesc = `
+This endpoint enables and configures the EST enrollment endpoints under
+"est/". Enrollment requests are issued against "default_role", or against
+one of "allowed_roles" when the role is given as the EST label in the
+request path.
+
+Clients authenticate either with a TLS client certificate issued by this
+CA, or, for initial enrollment, with a challengePassword attribute in their
+CSR matching "challenge_password".
+`
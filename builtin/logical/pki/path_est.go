@@ -0,0 +1,352 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const estCertsOnlyContentType = "application/pkcs7-mime; smime-type=certs-only"
+
+func pathESTCACerts(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "est/(" + framework.GenericNameRegex("label") + "/)?cacerts",
+
+		Fields: map[string]*framework.FieldSchema{
+			"label": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Optional EST label, naming the role to use`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathESTCACertsRead,
+		},
+
+		HelpSynopsis:    pathESTHelpSyn,
+		HelpDescription: pathESTHelpDesc,
+	}
+}
+
+func pathESTSimpleEnroll(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "est/(" + framework.GenericNameRegex("label") + "/)?simpleenroll",
+
+		Fields: map[string]*framework.FieldSchema{
+			"label": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Optional EST label, naming the role to use`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathESTSimpleEnroll,
+		},
+
+		HelpSynopsis:    pathESTHelpSyn,
+		HelpDescription: pathESTHelpDesc,
+	}
+}
+
+func pathESTSimpleReenroll(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "est/(" + framework.GenericNameRegex("label") + "/)?simplereenroll",
+
+		Fields: map[string]*framework.FieldSchema{
+			"label": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Optional EST label, naming the role to use`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathESTSimpleReenroll,
+		},
+
+		HelpSynopsis:    pathESTHelpSyn,
+		HelpDescription: pathESTHelpDesc,
+	}
+}
+
+// estEnabledConfig returns the EST configuration, or an error response if EST
+// has not been enabled on this mount
+func (b *backend) estEnabledConfig(req *logical.Request) (*estConfig, *logical.Response, error) {
+	config, err := b.EST(req.Storage)
+	if err != nil {
+		return nil, nil, err
+	}
+	if config == nil || !config.Enabled {
+		return nil, logical.ErrorResponse("EST is not enabled on this mount"), nil
+	}
+	return config, nil, nil
+}
+
+func (b *backend) pathESTCACertsRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if _, errResp, err := b.estEnabledConfig(req); err != nil || errResp != nil {
+		return errResp, err
+	}
+
+	caInfo, err := fetchCAInfo(b, req)
+	switch err.(type) {
+	case errutil.UserError:
+		return logical.ErrorResponse(err.Error()), nil
+	case errutil.InternalError:
+		return nil, err
+	}
+
+	certs := []*x509.Certificate{caInfo.Certificate}
+	for _, block := range caInfo.CAChain {
+		certs = append(certs, block.Certificate)
+	}
+
+	return estResponse(certs)
+}
+
+func (b *backend) pathESTSimpleEnroll(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.pathESTEnroll(req, data, false)
+}
+
+func (b *backend) pathESTSimpleReenroll(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.pathESTEnroll(req, data, true)
+}
+
+func (b *backend) pathESTEnroll(
+	req *logical.Request, data *framework.FieldData, reenroll bool) (*logical.Response, error) {
+	config, errResp, err := b.estEnabledConfig(req)
+	if err != nil || errResp != nil {
+		return errResp, err
+	}
+
+	roleName := config.roleForLabel(data.Get("label").(string))
+	if roleName == "" {
+		return logical.ErrorResponse("no role is configured for this EST label"), nil
+	}
+	role, err := b.getRole(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown role: %s", roleName)), nil
+	}
+
+	body, ok := req.Data[logical.HTTPRawBody].([]byte)
+	if !ok {
+		return logical.ErrorResponse(`request must be sent with content type "application/pkcs10"`), nil
+	}
+	csrBytes, err := decodeESTBody(body)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("unable to decode request body: %v", err)), nil
+	}
+	csr, err := x509.ParseCertificateRequest(csrBytes)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("certificate request could not be parsed: %v", err)), nil
+	}
+
+	caInfo, err := fetchCAInfo(b, req)
+	switch err.(type) {
+	case errutil.UserError:
+		return logical.ErrorResponse(err.Error()), nil
+	case errutil.InternalError:
+		return nil, err
+	}
+
+	clientCert, err := b.estClientCert(req, caInfo, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case reenroll:
+		// RFC 7030 section 4.2.2: re-enrollment must be authenticated with
+		// the certificate being renewed and must not change its names
+		if clientCert == nil {
+			return nil, logical.ErrPermissionDenied
+		}
+		if !bytes.Equal(csr.RawSubject, clientCert.RawSubject) ||
+			!estNamesSubset(csr, clientCert) {
+			return logical.ErrorResponse("re-enrollment request must keep the subject and subject alternative names of the existing certificate"), nil
+		}
+
+	case clientCert == nil:
+		if len(config.ChallengePasswordHash) == 0 {
+			return nil, logical.ErrPermissionDenied
+		}
+		password, err := csrChallengePassword(csr)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if password == "" || bcrypt.CompareHashAndPassword(config.ChallengePasswordHash, []byte(password)) != nil {
+			return nil, logical.ErrPermissionDenied
+		}
+	}
+
+	// Names always come from the CSR for EST, and EST certificates are not
+	// leased since enrollment requests are not made with a Vault token
+	estRole := *role
+	estRole.UseCSRCommonName = true
+	estRole.UseCSRSANs = true
+
+	signData := &framework.FieldData{
+		Raw: map[string]interface{}{
+			"csr": string(pem.EncodeToMemory(&pem.Block{
+				Type:  "CERTIFICATE REQUEST",
+				Bytes: csrBytes,
+			})),
+		},
+		Schema: pathSign(b).Fields,
+	}
+
+	parsedBundle, err := signCert(b, &estRole, caInfo, false, false, req, signData)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
+	}
+
+	if !role.NoStore {
+		serial := certutil.GetHexFormatted(parsedBundle.Certificate.SerialNumber.Bytes(), ":")
+		err = req.Storage.Put(&logical.StorageEntry{
+			Key:   "certs/" + normalizeSerial(serial),
+			Value: parsedBundle.CertificateBytes,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to store certificate locally: %v", err)
+		}
+		if err := storeCertRole(req.Storage, serial, roleName); err != nil {
+			return nil, err
+		}
+	}
+
+	return estResponse([]*x509.Certificate{parsedBundle.Certificate})
+}
+
+// estClientCert returns the TLS client certificate presented with the
+// request, if it was issued by this CA for the given role and has not been
+// revoked
+func (b *backend) estClientCert(req *logical.Request, caInfo *caInfoBundle, roleName string) (*x509.Certificate, error) {
+	if req.Connection == nil || req.Connection.ConnState == nil ||
+		len(req.Connection.ConnState.PeerCertificates) == 0 {
+		return nil, nil
+	}
+
+	clientCert := req.Connection.ConnState.PeerCertificates[0]
+	roots := x509.NewCertPool()
+	roots.AddCert(caInfo.Certificate)
+	if _, err := clientCert.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return nil, nil
+	}
+
+	serial := certutil.GetHexFormatted(clientCert.SerialNumber.Bytes(), ":")
+	revoked, err := fetchCertBySerial(req, "revoked/", serial)
+	if err != nil {
+		return nil, err
+	}
+	if revoked != nil {
+		return nil, nil
+	}
+
+	// Only certificates issued by the EST role may authenticate to it, so a
+	// certificate from an unrelated role cannot be used to enroll
+	issuedBy, err := fetchCertRole(req.Storage, serial)
+	if err != nil {
+		return nil, err
+	}
+	if issuedBy != roleName {
+		return nil, nil
+	}
+
+	return clientCert, nil
+}
+
+// estNamesSubset returns whether every subject alternative name requested in
+// the CSR is present in the existing certificate. The common name is added to
+// the SANs on issuance, so the CSR may carry fewer names than the certificate.
+func estNamesSubset(csr *x509.CertificateRequest, cert *x509.Certificate) bool {
+	for _, name := range csr.DNSNames {
+		if !strutil.StrListContains(cert.DNSNames, name) {
+			return false
+		}
+	}
+	for _, email := range csr.EmailAddresses {
+		if !strutil.StrListContains(cert.EmailAddresses, email) {
+			return false
+		}
+	}
+	for _, ip := range csr.IPAddresses {
+		found := false
+		for _, certIP := range cert.IPAddresses {
+			if ip.Equal(certIP) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, uri := range csr.URIs {
+		found := false
+		for _, certURI := range cert.URIs {
+			if uri.String() == certURI.String() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func estResponse(certs []*x509.Certificate) (*logical.Response, error) {
+	p7, err := encodeCertsOnlyPKCS7(certs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode PKCS#7 response: %v", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: estCertsOnlyContentType,
+			logical.HTTPRawBody:     encodeESTBody(p7),
+			logical.HTTPStatusCode:  http.StatusOK,
+		},
+	}, nil
+}
+
+const pathESTHelpSyn = `
+EST (RFC 7030) enrollment endpoints.
+`
+
+const pathESTHelpDesc = `
+These endpoints implement the EST "cacerts", "simpleenroll", and
+"simplereenroll" operations, so that devices that speak EST can enroll
+against this CA. They must first be enabled via "config/est".
+
+Requests do not use a Vault token. "simpleenroll" is authenticated with a
+TLS client certificate issued by this CA or a CSR challengePassword;
+"simplereenroll" requires the client certificate being renewed. An optional
+label in the path, as in "est/<role>/simpleenroll", selects the role to use.
+
+These endpoints are under "/v1/<mount>/est/" rather than the standard
+"/.well-known/est/" path of EST servers. The server serves one PKI mount at
+the standard path when it is configured at "sys/config/est".
+`
@@ -0,0 +1,308 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"math/big"
+	"net/url"
+	"testing"
+
+	"github.com/fullsailor/pkcs7"
+	"github.com/hashicorp/vault/logical"
+)
+
+// createESTCSR builds a DER CSR for the given common name, optionally
+// including a PKCS#9 challengePassword attribute, which the standard library
+// cannot generate
+func createESTCSR(t *testing.T, key *ecdsa.PrivateKey, cn, password string) []byte {
+	template, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: cn},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password == "" {
+		return template
+	}
+	parsed, err := x509.ParseCertificateRequest(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passwordBytes, err := asn1.Marshal(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attr, err := asn1.Marshal(struct {
+		Type   asn1.ObjectIdentifier
+		Values asn1.RawValue
+	}{
+		Type:   oidPKCS9ChallengePassword,
+		Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: passwordBytes},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tbs, err := asn1.Marshal(struct {
+		Version    int
+		Subject    asn1.RawValue
+		PublicKey  asn1.RawValue
+		Attributes []asn1.RawValue `asn1:"tag:0"`
+	}{
+		Subject:    asn1.RawValue{FullBytes: parsed.RawSubject},
+		PublicKey:  asn1.RawValue{FullBytes: parsed.RawSubjectPublicKeyInfo},
+		Attributes: []asn1.RawValue{{FullBytes: attr}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha256.Sum256(tbs)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csr, err := asn1.Marshal(struct {
+		TBS       asn1.RawValue
+		Algorithm pkix.AlgorithmIdentifier
+		Signature asn1.BitString
+	}{
+		TBS:       asn1.RawValue{FullBytes: tbs},
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+		Signature: asn1.BitString{Bytes: sig, BitLength: len(sig) * 8},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csr
+}
+
+func parseESTResponse(t *testing.T, resp *logical.Response) []*x509.Certificate {
+	if resp == nil || resp.IsError() {
+		t.Fatalf("bad: resp: %#v", resp)
+	}
+	if resp.Data[logical.HTTPContentType] != estCertsOnlyContentType {
+		t.Fatalf("bad content type: %#v", resp.Data[logical.HTTPContentType])
+	}
+	der, err := decodeESTBody(resp.Data[logical.HTTPRawBody].([]byte))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7, err := pkcs7.Parse(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p7.Certificates
+}
+
+func TestPki_EST(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	b, storage := createBackendWithStorage(t)
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "root/generate/internal",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"common_name": "myvault.com",
+			"ttl":         "5h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/devices",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"allowed_domains":  "devices.myvault.com",
+			"allow_subdomains": true,
+			"key_type":         "ec",
+			"key_bits":         256,
+			"ttl":              "1h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	// EST is disabled until configured
+	cacertsReq := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "est/cacerts",
+		Storage:   storage,
+	}
+	resp, err = b.HandleRequest(cacertsReq)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response: err: %v resp: %#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/est",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"enabled":            true,
+			"default_role":       "devices",
+			"challenge_password": "hunter2",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(cacertsReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if certs := parseESTResponse(t, resp); len(certs) != 1 || certs[0].Subject.CommonName != "myvault.com" {
+		t.Fatalf("bad CA certificates: %#v", certs)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enrollReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "est/simpleenroll",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/pkcs10",
+			logical.HTTPRawBody: []byte(base64.StdEncoding.EncodeToString(
+				createESTCSR(t, key, "dev1.devices.myvault.com", "wrong"))),
+		},
+	}
+	_, err = b.HandleRequest(enrollReq)
+	if err != logical.ErrPermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+
+	enrollReq.Data[logical.HTTPRawBody] = []byte(base64.StdEncoding.EncodeToString(
+		createESTCSR(t, key, "dev1.devices.myvault.com", "hunter2")))
+	resp, err = b.HandleRequest(enrollReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs := parseESTResponse(t, resp)
+	if len(certs) != 1 || certs[0].Subject.CommonName != "dev1.devices.myvault.com" {
+		t.Fatalf("bad issued certificate: %#v", certs)
+	}
+
+	// Re-enrollment requires the existing certificate
+	reenrollReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "est/simplereenroll",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			logical.HTTPRawBody: []byte(base64.StdEncoding.EncodeToString(
+				createESTCSR(t, key, "dev1.devices.myvault.com", ""))),
+		},
+	}
+	_, err = b.HandleRequest(reenrollReq)
+	if err != logical.ErrPermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+
+	// The label must be an allowed role
+	reenrollReq.Connection = &logical.Connection{
+		ConnState: &tls.ConnectionState{
+			PeerCertificates: certs,
+		},
+	}
+	reenrollReq.Path = "est/devices/simplereenroll"
+	resp, err = b.HandleRequest(reenrollReq)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response: err: %v resp: %#v", err, resp)
+	}
+
+	reenrollReq.Path = "est/simplereenroll"
+	resp, err = b.HandleRequest(reenrollReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renewed := parseESTResponse(t, resp)
+	if len(renewed) != 1 || renewed[0].SerialNumber.Cmp(certs[0].SerialNumber) == 0 {
+		t.Fatalf("bad renewed certificate: %#v", renewed)
+	}
+
+	// Re-enrollment cannot add a URI SAN
+	uri, err := url.Parse("spiffe://myvault.com/dev1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uriCSR, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "dev1.devices.myvault.com"},
+		URIs:    []*url.URL{uri},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reenrollReq.Data[logical.HTTPRawBody] = []byte(base64.StdEncoding.EncodeToString(uriCSR))
+	resp, err = b.HandleRequest(reenrollReq)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response: err: %v resp: %#v", err, resp)
+	}
+
+	// A certificate issued by one role cannot authenticate enrollment under
+	// another
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/routers",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"allowed_domains":  "routers.myvault.com",
+			"allow_subdomains": true,
+			"key_type":         "ec",
+			"key_bits":         256,
+			"ttl":              "1h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/est",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"allowed_roles": "routers",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	_, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "est/routers/simpleenroll",
+		Storage:   storage,
+		Connection: &logical.Connection{
+			ConnState: &tls.ConnectionState{
+				PeerCertificates: renewed,
+			},
+		},
+		Data: map[string]interface{}{
+			logical.HTTPRawBody: []byte(base64.StdEncoding.EncodeToString(
+				createESTCSR(t, key, "dev1.routers.myvault.com", ""))),
+		},
+	})
+	if err != logical.ErrPermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+}
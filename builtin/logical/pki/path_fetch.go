@@ -156,7 +156,7 @@ func (b *backend) pathFetchRead(req *logical.Request, data *framework.FieldData)
 	}
 
 	if serial == "ca_chain" {
-		caInfo, err := fetchCAInfo(req)
+		caInfo, err := fetchCAInfo(b, req)
 		switch err.(type) {
 		case errutil.UserError:
 			response = logical.ErrorResponse(funcErr.Error())
@@ -57,13 +57,13 @@ func (b *backend) pathGenerateIntermediate(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	var err error
 
-	exported, format, role, errorResp := b.getGenerationParams(data)
+	exported, format, role, managedKey, errorResp := b.getGenerationParams(data)
 	if errorResp != nil {
 		return errorResp, nil
 	}
 
 	var resp *logical.Response
-	parsedBundle, err := generateIntermediateCSR(b, role, nil, req, data)
+	parsedBundle, err := generateIntermediateCSR(b, role, nil, managedKey, req, data)
 	if err != nil {
 		switch err.(type) {
 		case errutil.UserError:
@@ -118,6 +118,10 @@ func (b *backend) pathGenerateIntermediate(
 	if err != nil {
 		return nil, err
 	}
+	err = storeCAManagedKey(req, managedKey)
+	if err != nil {
+		return nil, err
+	}
 
 	return resp, nil
 }
@@ -158,21 +162,36 @@ func (b *backend) pathSetSignedIntermediate(
 		return nil, err
 	}
 
-	if len(cb.PrivateKey) == 0 || cb.PrivateKeyType == "" {
-		return logical.ErrorResponse("could not find an existing private key"), nil
-	}
-
-	parsedCB, err := cb.ToParsedCertBundle()
+	managedKey, err := fetchCAManagedKey(b, req)
 	if err != nil {
-		return nil, err
-	}
-	if parsedCB.PrivateKey == nil {
-		return nil, fmt.Errorf("saved key could not be parsed successfully")
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
 	}
 
-	inputBundle.PrivateKey = parsedCB.PrivateKey
-	inputBundle.PrivateKeyType = parsedCB.PrivateKeyType
-	inputBundle.PrivateKeyBytes = parsedCB.PrivateKeyBytes
+	if managedKey != nil {
+		inputBundle.PrivateKey = managedKey.Key
+		inputBundle.PrivateKeyType = managedKey.privateKeyType()
+	} else {
+		if len(cb.PrivateKey) == 0 || cb.PrivateKeyType == "" {
+			return logical.ErrorResponse("could not find an existing private key"), nil
+		}
+
+		parsedCB, err := cb.ToParsedCertBundle()
+		if err != nil {
+			return nil, err
+		}
+		if parsedCB.PrivateKey == nil {
+			return nil, fmt.Errorf("saved key could not be parsed successfully")
+		}
+
+		inputBundle.PrivateKey = parsedCB.PrivateKey
+		inputBundle.PrivateKeyType = parsedCB.PrivateKeyType
+		inputBundle.PrivateKeyBytes = parsedCB.PrivateKeyBytes
+	}
 
 	if !inputBundle.Certificate.IsCA {
 		return logical.ErrorResponse("the given certificate is not marked for CA use and cannot be used with this backend"), nil
@@ -167,7 +167,7 @@ func (b *backend) pathIssueSignCert(
 	}
 
 	var caErr error
-	signingBundle, caErr := fetchCAInfo(req)
+	signingBundle, caErr := fetchCAInfo(b, req)
 	switch caErr.(type) {
 	case errutil.UserError:
 		return nil, errutil.UserError{Err: fmt.Sprintf(
@@ -182,7 +182,7 @@ func (b *backend) pathIssueSignCert(
 	if useCSR {
 		parsedBundle, err = signCert(b, role, signingBundle, false, useCSRValues, req, data)
 	} else {
-		parsedBundle, err = generateCert(b, role, signingBundle, false, req, data)
+		parsedBundle, err = generateCert(b, role, signingBundle, false, nil, req, data)
 	}
 	if err != nil {
 		switch err.(type) {
@@ -275,6 +275,14 @@ func (b *backend) pathIssueSignCert(
 		if err != nil {
 			return nil, fmt.Errorf("unable to store certificate locally: %v", err)
 		}
+
+		// Verbatim signing bypasses the role's constraints, so only
+		// certificates issued under a role are attributed to it
+		if !useCSRValues {
+			if err := storeCertRole(req.Storage, cb.SerialNumber, data.Get("role").(string)); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return resp, nil
@@ -66,6 +66,31 @@ information. This parameter accepts a comma-separated list
 of domains.`,
 			},
 
+			"allowed_domains_template": &framework.FieldSchema{
+				Type:    framework.TypeBool,
+				Default: false,
+				Description: `If set, "allowed_domains" may contain identity
+templates such as "{{identity.entity.metadata.team}}.example.com",
+which are populated from the requesting client's identity
+when the role is used.`,
+			},
+
+			"allowed_uri_sans": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "",
+				Description: `If set, clients can request URI Subject Alternative
+Names matching these values, which may contain glob patterns.
+This parameter accepts a comma-separated list of URIs.`,
+			},
+
+			"allowed_uri_sans_template": &framework.FieldSchema{
+				Type:    framework.TypeBool,
+				Default: false,
+				Description: `If set, "allowed_uri_sans" may contain identity
+templates, which are populated from the requesting
+client's identity when the role is used.`,
+			},
+
 			"allow_bare_domains": &framework.FieldSchema{
 				Type:    framework.TypeBool,
 				Default: false,
@@ -189,7 +214,9 @@ include the Common Name (cn). Defaults to true.`,
 				Type:    framework.TypeString,
 				Default: "",
 				Description: `If set, the OU (OrganizationalUnit) will be set to
-this value in certificates issued by this role.`,
+this value in certificates issued by this role. Values may
+contain identity templates such as
+"{{identity.entity.metadata.team}}".`,
 			},
 
 			"organization": &framework.FieldSchema{
@@ -199,6 +226,15 @@ this value in certificates issued by this role.`,
 this value in certificates issued by this role.`,
 			},
 
+			"not_after": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "",
+				Description: `If set, the Not After field of certificates issued
+by this role is set to this date, overriding the TTL. The
+value must be in UTC and formatted as
+YYYY-MM-ddTHH:MM:SSZ.`,
+			},
+
 			"generate_lease": &framework.FieldSchema{
 				Type:    framework.TypeBool,
 				Default: false,
@@ -382,29 +418,33 @@ func (b *backend) pathRoleCreate(
 	name := data.Get("name").(string)
 
 	entry := &roleEntry{
-		MaxTTL:              data.Get("max_ttl").(string),
-		TTL:                 data.Get("ttl").(string),
-		AllowLocalhost:      data.Get("allow_localhost").(bool),
-		AllowedDomains:      data.Get("allowed_domains").(string),
-		AllowBareDomains:    data.Get("allow_bare_domains").(bool),
-		AllowSubdomains:     data.Get("allow_subdomains").(bool),
-		AllowGlobDomains:    data.Get("allow_glob_domains").(bool),
-		AllowAnyName:        data.Get("allow_any_name").(bool),
-		EnforceHostnames:    data.Get("enforce_hostnames").(bool),
-		AllowIPSANs:         data.Get("allow_ip_sans").(bool),
-		ServerFlag:          data.Get("server_flag").(bool),
-		ClientFlag:          data.Get("client_flag").(bool),
-		CodeSigningFlag:     data.Get("code_signing_flag").(bool),
-		EmailProtectionFlag: data.Get("email_protection_flag").(bool),
-		KeyType:             data.Get("key_type").(string),
-		KeyBits:             data.Get("key_bits").(int),
-		UseCSRCommonName:    data.Get("use_csr_common_name").(bool),
-		UseCSRSANs:          data.Get("use_csr_sans").(bool),
-		KeyUsage:            data.Get("key_usage").(string),
-		OU:                  data.Get("ou").(string),
-		Organization:        data.Get("organization").(string),
-		GenerateLease:       new(bool),
-		NoStore:             data.Get("no_store").(bool),
+		MaxTTL:                 data.Get("max_ttl").(string),
+		TTL:                    data.Get("ttl").(string),
+		AllowLocalhost:         data.Get("allow_localhost").(bool),
+		AllowedDomains:         data.Get("allowed_domains").(string),
+		AllowedDomainsTemplate: data.Get("allowed_domains_template").(bool),
+		AllowedURISANs:         data.Get("allowed_uri_sans").(string),
+		AllowedURISANsTemplate: data.Get("allowed_uri_sans_template").(bool),
+		AllowBareDomains:       data.Get("allow_bare_domains").(bool),
+		AllowSubdomains:        data.Get("allow_subdomains").(bool),
+		AllowGlobDomains:       data.Get("allow_glob_domains").(bool),
+		AllowAnyName:           data.Get("allow_any_name").(bool),
+		EnforceHostnames:       data.Get("enforce_hostnames").(bool),
+		AllowIPSANs:            data.Get("allow_ip_sans").(bool),
+		ServerFlag:             data.Get("server_flag").(bool),
+		ClientFlag:             data.Get("client_flag").(bool),
+		CodeSigningFlag:        data.Get("code_signing_flag").(bool),
+		EmailProtectionFlag:    data.Get("email_protection_flag").(bool),
+		KeyType:                data.Get("key_type").(string),
+		KeyBits:                data.Get("key_bits").(int),
+		UseCSRCommonName:       data.Get("use_csr_common_name").(bool),
+		UseCSRSANs:             data.Get("use_csr_sans").(bool),
+		KeyUsage:               data.Get("key_usage").(string),
+		OU:                     data.Get("ou").(string),
+		Organization:           data.Get("organization").(string),
+		NotAfter:               data.Get("not_after").(string),
+		GenerateLease:          new(bool),
+		NoStore:                data.Get("no_store").(bool),
 	}
 
 	// no_store implies generate_lease := false
@@ -418,6 +458,13 @@ func (b *backend) pathRoleCreate(
 		return logical.ErrorResponse("RSA keys < 2048 bits are unsafe and not supported"), nil
 	}
 
+	if entry.NotAfter != "" {
+		if _, err := time.Parse(notAfterFormat, entry.NotAfter); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf(
+				"invalid not_after, must be formatted as %s: %s", notAfterFormat, err)), nil
+		}
+	}
+
 	var maxTTL time.Duration
 	maxSystemTTL := b.System().MaxLeaseTTL()
 	if len(entry.MaxTTL) == 0 {
@@ -503,35 +550,39 @@ func parseKeyUsages(input string) int {
 }
 
 type roleEntry struct {
-	LeaseMax              string `json:"lease_max" structs:"lease_max" mapstructure:"lease_max"`
-	Lease                 string `json:"lease" structs:"lease" mapstructure:"lease"`
-	MaxTTL                string `json:"max_ttl" structs:"max_ttl" mapstructure:"max_ttl"`
-	TTL                   string `json:"ttl" structs:"ttl" mapstructure:"ttl"`
-	AllowLocalhost        bool   `json:"allow_localhost" structs:"allow_localhost" mapstructure:"allow_localhost"`
-	AllowedBaseDomain     string `json:"allowed_base_domain" structs:"allowed_base_domain" mapstructure:"allowed_base_domain"`
-	AllowedDomains        string `json:"allowed_domains" structs:"allowed_domains" mapstructure:"allowed_domains"`
-	AllowBaseDomain       bool   `json:"allow_base_domain" structs:"allow_base_domain" mapstructure:"allow_base_domain"`
-	AllowBareDomains      bool   `json:"allow_bare_domains" structs:"allow_bare_domains" mapstructure:"allow_bare_domains"`
-	AllowTokenDisplayName bool   `json:"allow_token_displayname" structs:"allow_token_displayname" mapstructure:"allow_token_displayname"`
-	AllowSubdomains       bool   `json:"allow_subdomains" structs:"allow_subdomains" mapstructure:"allow_subdomains"`
-	AllowGlobDomains      bool   `json:"allow_glob_domains" structs:"allow_glob_domains" mapstructure:"allow_glob_domains"`
-	AllowAnyName          bool   `json:"allow_any_name" structs:"allow_any_name" mapstructure:"allow_any_name"`
-	EnforceHostnames      bool   `json:"enforce_hostnames" structs:"enforce_hostnames" mapstructure:"enforce_hostnames"`
-	AllowIPSANs           bool   `json:"allow_ip_sans" structs:"allow_ip_sans" mapstructure:"allow_ip_sans"`
-	ServerFlag            bool   `json:"server_flag" structs:"server_flag" mapstructure:"server_flag"`
-	ClientFlag            bool   `json:"client_flag" structs:"client_flag" mapstructure:"client_flag"`
-	CodeSigningFlag       bool   `json:"code_signing_flag" structs:"code_signing_flag" mapstructure:"code_signing_flag"`
-	EmailProtectionFlag   bool   `json:"email_protection_flag" structs:"email_protection_flag" mapstructure:"email_protection_flag"`
-	UseCSRCommonName      bool   `json:"use_csr_common_name" structs:"use_csr_common_name" mapstructure:"use_csr_common_name"`
-	UseCSRSANs            bool   `json:"use_csr_sans" structs:"use_csr_sans" mapstructure:"use_csr_sans"`
-	KeyType               string `json:"key_type" structs:"key_type" mapstructure:"key_type"`
-	KeyBits               int    `json:"key_bits" structs:"key_bits" mapstructure:"key_bits"`
-	MaxPathLength         *int   `json:",omitempty" structs:"max_path_length,omitempty" mapstructure:"max_path_length"`
-	KeyUsage              string `json:"key_usage" structs:"key_usage" mapstructure:"key_usage"`
-	OU                    string `json:"ou" structs:"ou" mapstructure:"ou"`
-	Organization          string `json:"organization" structs:"organization" mapstructure:"organization"`
-	GenerateLease         *bool  `json:"generate_lease,omitempty" structs:"generate_lease,omitempty"`
-	NoStore               bool   `json:"no_store" structs:"no_store" mapstructure:"no_store"`
+	LeaseMax               string `json:"lease_max" structs:"lease_max" mapstructure:"lease_max"`
+	Lease                  string `json:"lease" structs:"lease" mapstructure:"lease"`
+	MaxTTL                 string `json:"max_ttl" structs:"max_ttl" mapstructure:"max_ttl"`
+	TTL                    string `json:"ttl" structs:"ttl" mapstructure:"ttl"`
+	AllowLocalhost         bool   `json:"allow_localhost" structs:"allow_localhost" mapstructure:"allow_localhost"`
+	AllowedBaseDomain      string `json:"allowed_base_domain" structs:"allowed_base_domain" mapstructure:"allowed_base_domain"`
+	AllowedDomains         string `json:"allowed_domains" structs:"allowed_domains" mapstructure:"allowed_domains"`
+	AllowedDomainsTemplate bool   `json:"allowed_domains_template" structs:"allowed_domains_template" mapstructure:"allowed_domains_template"`
+	AllowedURISANs         string `json:"allowed_uri_sans" structs:"allowed_uri_sans" mapstructure:"allowed_uri_sans"`
+	AllowedURISANsTemplate bool   `json:"allowed_uri_sans_template" structs:"allowed_uri_sans_template" mapstructure:"allowed_uri_sans_template"`
+	AllowBaseDomain        bool   `json:"allow_base_domain" structs:"allow_base_domain" mapstructure:"allow_base_domain"`
+	AllowBareDomains       bool   `json:"allow_bare_domains" structs:"allow_bare_domains" mapstructure:"allow_bare_domains"`
+	AllowTokenDisplayName  bool   `json:"allow_token_displayname" structs:"allow_token_displayname" mapstructure:"allow_token_displayname"`
+	AllowSubdomains        bool   `json:"allow_subdomains" structs:"allow_subdomains" mapstructure:"allow_subdomains"`
+	AllowGlobDomains       bool   `json:"allow_glob_domains" structs:"allow_glob_domains" mapstructure:"allow_glob_domains"`
+	AllowAnyName           bool   `json:"allow_any_name" structs:"allow_any_name" mapstructure:"allow_any_name"`
+	EnforceHostnames       bool   `json:"enforce_hostnames" structs:"enforce_hostnames" mapstructure:"enforce_hostnames"`
+	AllowIPSANs            bool   `json:"allow_ip_sans" structs:"allow_ip_sans" mapstructure:"allow_ip_sans"`
+	ServerFlag             bool   `json:"server_flag" structs:"server_flag" mapstructure:"server_flag"`
+	ClientFlag             bool   `json:"client_flag" structs:"client_flag" mapstructure:"client_flag"`
+	CodeSigningFlag        bool   `json:"code_signing_flag" structs:"code_signing_flag" mapstructure:"code_signing_flag"`
+	EmailProtectionFlag    bool   `json:"email_protection_flag" structs:"email_protection_flag" mapstructure:"email_protection_flag"`
+	UseCSRCommonName       bool   `json:"use_csr_common_name" structs:"use_csr_common_name" mapstructure:"use_csr_common_name"`
+	UseCSRSANs             bool   `json:"use_csr_sans" structs:"use_csr_sans" mapstructure:"use_csr_sans"`
+	KeyType                string `json:"key_type" structs:"key_type" mapstructure:"key_type"`
+	KeyBits                int    `json:"key_bits" structs:"key_bits" mapstructure:"key_bits"`
+	MaxPathLength          *int   `json:",omitempty" structs:"max_path_length,omitempty" mapstructure:"max_path_length"`
+	KeyUsage               string `json:"key_usage" structs:"key_usage" mapstructure:"key_usage"`
+	OU                     string `json:"ou" structs:"ou" mapstructure:"ou"`
+	Organization           string `json:"organization" structs:"organization" mapstructure:"organization"`
+	NotAfter               string `json:"not_after" structs:"not_after" mapstructure:"not_after"`
+	GenerateLease          *bool  `json:"generate_lease,omitempty" structs:"generate_lease,omitempty"`
+	NoStore                bool   `json:"no_store" structs:"no_store" mapstructure:"no_store"`
 }
 
 const pathListRolesHelpSyn = `List the existing roles in this backend`
@@ -1,9 +1,14 @@
 package pki
 
 import (
+	"crypto/x509"
+	"encoding/pem"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/vault/builtin/credential/userpass"
 	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/vault"
 	"github.com/mitchellh/mapstructure"
 )
 
@@ -308,3 +313,161 @@ func TestPki_CertsLease(t *testing.T) {
 		t.Fatalf("expected a response that contains a secret")
 	}
 }
+
+func TestPki_RoleIdentityTemplating(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	b, storage := createBackendWithStorage(t)
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "root/generate/internal",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"common_name": "myvault.com",
+			"ttl":         "5h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/teams",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"allowed_domains":           "{{identity.entity.metadata.team}}.myvault.com",
+			"allowed_domains_template":  true,
+			"allow_bare_domains":        true,
+			"allowed_uri_sans":          "spiffe://myvault.com/{{identity.entity.metadata.team}}/*",
+			"allowed_uri_sans_template": true,
+			"ou":                        "{{identity.entity.metadata.team}}",
+			"ttl":                       "1h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	issueReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "issue/teams",
+		Storage:   storage,
+		Entity: &logical.Entity{
+			Name: "bob",
+			Metadata: map[string]string{
+				"team": "infra",
+			},
+		},
+		Data: map[string]interface{}{
+			"common_name": "infra.myvault.com",
+			"uri_sans":    "spiffe://myvault.com/infra/web",
+			"not_after":   time.Now().Add(30 * time.Minute).UTC().Format(notAfterFormat),
+		},
+	}
+	resp, err = b.HandleRequest(issueReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	block, _ := pem.Decode([]byte(resp.Data["certificate"].(string)))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.Subject.OrganizationalUnit) != 1 || cert.Subject.OrganizationalUnit[0] != "infra" {
+		t.Fatalf("bad OU: %#v", cert.Subject.OrganizationalUnit)
+	}
+	if len(cert.URIs) != 1 || cert.URIs[0].String() != "spiffe://myvault.com/infra/web" {
+		t.Fatalf("bad URI SANs: %#v", cert.URIs)
+	}
+	if cert.NotAfter.After(time.Now().Add(31 * time.Minute)) {
+		t.Fatalf("not_after was not honored: %s", cert.NotAfter)
+	}
+
+	// A different team must not be able to request the first team's names
+	issueReq.Entity.Metadata["team"] = "sales"
+	resp, err = b.HandleRequest(issueReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error response, got %#v", resp)
+	}
+
+	// Without an entity the templated names cannot match
+	issueReq.Entity = nil
+	issueReq.Data["common_name"] = "infra.myvault.com"
+	delete(issueReq.Data, "uri_sans")
+	resp, err = b.HandleRequest(issueReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error response, got %#v", resp)
+	}
+}
+
+func TestPki_RoleIdentityTemplating_childToken(t *testing.T) {
+	vault.AddTestLogicalBackend("pki", Factory)
+	vault.AddTestCredentialBackend("userpass", userpass.Factory)
+	core, _, root := vault.TestCoreUnsealed(t)
+
+	request := func(token, path string, data map[string]interface{}) (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.UpdateOperation, path)
+		req.ClientToken = token
+		req.Data = data
+		return core.HandleRequest(req)
+	}
+	for _, step := range []struct {
+		path string
+		data map[string]interface{}
+	}{
+		{"sys/mounts/pki", map[string]interface{}{"type": "pki"}},
+		{"sys/auth/userpass", map[string]interface{}{"type": "userpass"}},
+		{"sys/policy/issuer", map[string]interface{}{
+			"rules": `path "pki/issue/*" { capabilities = ["update"] }
+path "auth/token/create" { capabilities = ["update"] }`,
+		}},
+		{"auth/userpass/users/alice", map[string]interface{}{"password": "secret", "policies": "issuer"}},
+		{"pki/root/generate/internal", map[string]interface{}{"common_name": "myvault.com"}},
+		{"pki/roles/users", map[string]interface{}{
+			"allowed_domains":          "{{identity.entity.metadata.username}}.myvault.com",
+			"allowed_domains_template": true,
+			"allow_bare_domains":       true,
+			"ttl":                      "1h",
+		}},
+	} {
+		if resp, err := request(root, step.path, step.data); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s: err: %v resp: %#v", step.path, err, resp)
+		}
+	}
+
+	resp, err := request("", "auth/userpass/login/alice", map[string]interface{}{"password": "secret"})
+	if err != nil || resp == nil || resp.Auth == nil {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	userToken := resp.Auth.ClientToken
+
+	// Child tokens carrying forged metadata still belong to the user who
+	// logged in
+	resp, err = request(userToken, "auth/token/create", map[string]interface{}{
+		"meta": map[string]interface{}{"username": "bob"},
+	})
+	if err != nil || resp == nil || resp.Auth == nil {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	childToken := resp.Auth.ClientToken
+
+	resp, err = request(childToken, "pki/issue/users", map[string]interface{}{"common_name": "bob.myvault.com"})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected forged metadata not to widen the allowed domains, got %#v", resp)
+	}
+	for _, token := range []string{userToken, childToken} {
+		resp, err = request(token, "pki/issue/users", map[string]interface{}{"common_name": "alice.myvault.com"})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+	}
+}
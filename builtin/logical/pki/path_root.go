@@ -70,7 +70,7 @@ func (b *backend) pathCAGenerateRoot(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	var err error
 
-	exported, format, role, errorResp := b.getGenerationParams(data)
+	exported, format, role, managedKey, errorResp := b.getGenerationParams(data)
 	if errorResp != nil {
 		return errorResp, nil
 	}
@@ -81,7 +81,7 @@ func (b *backend) pathCAGenerateRoot(
 		role.MaxPathLength = &maxPathLength
 	}
 
-	parsedBundle, err := generateCert(b, role, nil, true, req, data)
+	parsedBundle, err := generateCert(b, role, nil, true, managedKey, req, data)
 	if err != nil {
 		switch err.(type) {
 		case errutil.UserError:
@@ -141,6 +141,10 @@ func (b *backend) pathCAGenerateRoot(
 	if err != nil {
 		return nil, err
 	}
+	err = storeCAManagedKey(req, managedKey)
+	if err != nil {
+		return nil, err
+	}
 
 	// Also store it as just the certificate identified by serial number, so it
 	// can be revoked
@@ -199,7 +203,7 @@ func (b *backend) pathCASignIntermediate(
 	}
 
 	var caErr error
-	signingBundle, caErr := fetchCAInfo(req)
+	signingBundle, caErr := fetchCAInfo(b, req)
 	switch caErr.(type) {
 	case errutil.UserError:
 		return nil, errutil.UserError{Err: fmt.Sprintf(
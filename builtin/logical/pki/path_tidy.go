@@ -83,6 +83,9 @@ func (b *backend) pathTidyWrite(
 				if err := req.Storage.Delete("certs/" + serial); err != nil {
 					return nil, fmt.Errorf("error deleting serial %s from storage: %s", serial, err)
 				}
+				if err := req.Storage.Delete("cert-roles/" + serial); err != nil {
+					return nil, fmt.Errorf("error deleting role of serial %s from storage: %s", serial, err)
+				}
 			}
 		}
 	}
@@ -62,19 +62,14 @@ func (b *backend) Client(s logical.Storage) (*rabbithole.Client, error) {
 	b.lock.RUnlock()
 
 	// Otherwise, attempt to make connection
-	entry, err := s.Get("config/connection")
+	connConfig, err := b.connectionConfig(s)
 	if err != nil {
 		return nil, err
 	}
-	if entry == nil {
+	if connConfig == nil {
 		return nil, fmt.Errorf("configure the client connection with config/connection first")
 	}
 
-	var connConfig connectionConfig
-	if err := entry.DecodeJSON(&connConfig); err != nil {
-		return nil, err
-	}
-
 	b.lock.Lock()
 	defer b.lock.Unlock()
 
@@ -93,6 +88,25 @@ func (b *backend) Client(s logical.Storage) (*rabbithole.Client, error) {
 	return b.client, nil
 }
 
+// connectionConfig returns the connection configuration, or nil if it is not
+// configured
+func (b *backend) connectionConfig(s logical.Storage) (*connectionConfig, error) {
+	entry, err := s.Get("config/connection")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result connectionConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
 // resetClient forces a connection next time Client() is called.
 func (b *backend) resetClient() {
 	b.lock.Lock()
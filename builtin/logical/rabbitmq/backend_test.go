@@ -1,9 +1,14 @@
 package rabbitmq
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/hashicorp/vault/helper/jsonutil"
@@ -56,6 +61,114 @@ func TestBackend_roleCrud(t *testing.T) {
 	})
 }
 
+// fakeRabbitMQ records the requests made to the management API
+type fakeRabbitMQ struct {
+	sync.Mutex
+	requests map[string]map[string]interface{}
+}
+
+func (f *fakeRabbitMQ) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	f.requests[r.Method+" "+r.URL.EscapedPath()] = body
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestBackend_topicPermissionsAndPasswordPolicy(t *testing.T) {
+	fake := &fakeRabbitMQ{requests: map[string]map[string]interface{}{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	sys := logical.TestSystemView()
+	sys.PasswordPolicies = map[string]string{
+		"digits": `
+length = 16
+rule "charset" {
+  charset = "0123456789"
+}`,
+	}
+	config.System = sys
+	b, err := Factory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"connection_uri":    srv.URL,
+			"username":          "admin",
+			"password":          "admin",
+			"verify_connection": false,
+			"password_policy":   "unknown",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for an unknown password policy, got err:%s resp:%#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"connection_uri":    srv.URL,
+			"username":          "admin",
+			"password":          "admin",
+			"verify_connection": false,
+			"password_policy":   "digits",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/web",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"tags":         "monitoring",
+			"vhost_topics": `{"/": {"amq.topic": {"write": "^logs\\.", "read": ".*"}}}`,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "creds/web",
+		Storage:     config.StorageView,
+		DisplayName: "token",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	username := resp.Data["username"].(string)
+	password := resp.Data["password"].(string)
+	if len(password) != 16 || strings.Trim(password, "0123456789") != "" {
+		t.Fatalf("password does not follow the policy: %q", password)
+	}
+
+	user := fake.requests["PUT /api/users/"+username]
+	if user == nil || user["password"] != password || user["tags"] != "monitoring" {
+		t.Fatalf("bad user: %#v", fake.requests)
+	}
+	topic := fake.requests["PUT /api/topic-permissions/%2F/"+username]
+	if topic == nil || topic["exchange"] != "amq.topic" || topic["write"] != "^logs\\." || topic["read"] != ".*" {
+		t.Fatalf("bad topic permissions: %#v", fake.requests)
+	}
+}
+
 const (
 	envRabbitMQConnectionURI = "RABBITMQ_CONNECTION_URI"
 	envRabbitMQUsername      = "RABBITMQ_USERNAME"
@@ -29,6 +29,10 @@ func pathConfigConnection(b *backend) *framework.Path {
 				Default:     true,
 				Description: `If set, connection_uri is verified by actually connecting to the RabbitMQ management API`,
 			},
+			"password_policy": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the password policy used to generate passwords",
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -56,6 +60,13 @@ func (b *backend) pathConnectionUpdate(req *logical.Request, data *framework.Fie
 		return logical.ErrorResponse("missing password"), nil
 	}
 
+	passwordPolicy := data.Get("password_policy").(string)
+	if passwordPolicy != "" {
+		if _, err := b.System().PasswordPolicy(passwordPolicy); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid password_policy %q: %s", passwordPolicy, err)), nil
+		}
+	}
+
 	// Don't check the connection_url if verification is disabled
 	verifyConnection := data.Get("verify_connection").(bool)
 	if verifyConnection {
@@ -73,9 +84,10 @@ func (b *backend) pathConnectionUpdate(req *logical.Request, data *framework.Fie
 
 	// Store it
 	entry, err := logical.StorageEntryJSON("config/connection", connectionConfig{
-		URI:      uri,
-		Username: username,
-		Password: password,
+		URI:            uri,
+		Username:       username,
+		Password:       password,
+		PasswordPolicy: passwordPolicy,
 	})
 	if err != nil {
 		return nil, err
@@ -100,6 +112,10 @@ type connectionConfig struct {
 
 	// Password for the Username
 	Password string `json:"password"`
+
+	// PasswordPolicy is the name of the password policy generating the
+	// passwords of users
+	PasswordPolicy string `json:"password_policy"`
 }
 
 const pathConfigConnectionHelpSyn = `
@@ -111,7 +127,8 @@ This path configures the connection properties used to connect to RabbitMQ manag
 The "connection_uri" parameter is a string that is used to connect to the API. The "username"
 and "password" parameters are strings that are used as credentials to the API. The "verify_connection"
 parameter is a boolean that is used to verify whether the provided connection URI, username, and password
-are valid.
+are valid. The "password_policy" parameter is the name of the password policy generated passwords follow.
+By default, passwords are random UUIDs.
 
 The URI looks like:
 "http://localhost:15672"
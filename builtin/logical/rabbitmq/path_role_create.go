@@ -51,11 +51,6 @@ func (b *backend) pathCredsRead(req *logical.Request, d *framework.FieldData) (*
 	}
 	username := fmt.Sprintf("%s-%s", req.DisplayName, uuidVal)
 
-	password, err := uuid.GenerateUUID()
-	if err != nil {
-		return nil, err
-	}
-
 	// Get the client configuration
 	client, err := b.Client(req.Storage)
 	if err != nil {
@@ -65,6 +60,11 @@ func (b *backend) pathCredsRead(req *logical.Request, d *framework.FieldData) (*
 		return logical.ErrorResponse("failed to get the client"), nil
 	}
 
+	password, err := b.generatePassword(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
 	// Register the generated credentials in the backend, with the RabbitMQ server
 	if _, err = client.PutUser(username, rabbithole.UserSettings{
 		Password: password,
@@ -89,6 +89,19 @@ func (b *backend) pathCredsRead(req *logical.Request, d *framework.FieldData) (*
 		}
 	}
 
+	// Topic permissions are set per exchange of each vhost
+	for vhost, exchanges := range role.VHostTopics {
+		for exchange, permission := range exchanges {
+			if err := updateTopicPermissionsIn(client, vhost, username, exchange, permission); err != nil {
+				// Delete the user because it's in an unknown state
+				if _, rmErr := client.DeleteUser(username); rmErr != nil {
+					return nil, fmt.Errorf("failed to delete user:%s, err: %s. %s", username, err, rmErr)
+				}
+				return nil, fmt.Errorf("failed to update topic permissions to the %s user. err:%s", username, err)
+			}
+		}
+	}
+
 	// Return the secret
 	resp := b.Secret(SecretCredsType).Response(map[string]interface{}{
 		"username": username,
@@ -109,6 +122,24 @@ func (b *backend) pathCredsRead(req *logical.Request, d *framework.FieldData) (*
 	return resp, nil
 }
 
+// generatePassword returns a password for a new user, generated from the
+// configured password policy if any
+func (b *backend) generatePassword(s logical.Storage) (string, error) {
+	connConfig, err := b.connectionConfig(s)
+	if err != nil {
+		return "", err
+	}
+	if connConfig == nil || connConfig.PasswordPolicy == "" {
+		return uuid.GenerateUUID()
+	}
+
+	policy, err := b.System().PasswordPolicy(connConfig.PasswordPolicy)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password policy %q: %s", connConfig.PasswordPolicy, err)
+	}
+	return policy.Generate()
+}
+
 const pathRoleCreateReadHelpSyn = `
 Request RabbitMQ credentials for a certain role.
 `
@@ -0,0 +1,50 @@
+package rabbitmq
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/michaelklishin/rabbit-hole"
+)
+
+// topicPermissionsClient sends the topic permission requests, which the
+// RabbitMQ management client does not support
+var topicPermissionsClient = cleanhttp.DefaultPooledClient()
+
+// updateTopicPermissionsIn sets the topic permissions of a user on an
+// exchange of a vhost, using the management API of RabbitMQ 3.7 and later.
+func updateTopicPermissionsIn(client *rabbithole.Client, vhost, username, exchange string, permission topicPermission) error {
+	body, err := json.Marshal(map[string]string{
+		"exchange": exchange,
+		"write":    permission.Write,
+		"read":     permission.Read,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/api/topic-permissions/%s/%s",
+		client.Endpoint, url.QueryEscape(vhost), url.QueryEscape(username)), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(client.Username, client.Password)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := topicPermissionsClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, msg)
+	}
+	return nil
+}
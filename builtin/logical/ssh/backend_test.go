@@ -1,6 +1,9 @@
 package ssh
 
 import (
+	"crypto"
+	"crypto/rsa"
+	_ "crypto/sha1"
 	"fmt"
 	"reflect"
 	"testing"
@@ -13,6 +16,7 @@ import (
 	"strings"
 
 	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/builtin/credential/userpass"
 	"github.com/hashicorp/vault/logical"
 	logicaltest "github.com/hashicorp/vault/logical/testing"
 	"github.com/hashicorp/vault/vault"
@@ -652,6 +656,366 @@ func TestBackend_OptionsOverrideDefaults(t *testing.T) {
 	logicaltest.Test(t, testCase)
 }
 
+func TestBackend_CARoleTemplatingAndCriticalOptions(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Factory(config)
+	if err != nil {
+		t.Fatalf("Cannot create backend: %s", err)
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/ca",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"public_key":  publicKey,
+			"private_key": privateKey,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	// An invalid default source-address is rejected
+	roleData := map[string]interface{}{
+		"key_type":                 "ca",
+		"allowed_users":            "tuber",
+		"default_user":             "tuber",
+		"allow_user_certificates":  true,
+		"allowed_critical_options": "force-command,permit-agent",
+		"default_critical_options": map[string]interface{}{
+			"force-command":  "/usr/bin/uptime",
+			"source-address": "10.0.0.0/8,not-a-cidr",
+		},
+	}
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/teams",
+		Storage:   config.StorageView,
+		Data:      roleData,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error response, got %#v", resp)
+	}
+
+	roleData["default_critical_options"] = map[string]interface{}{
+		"force-command":  "/usr/bin/uptime",
+		"source-address": "10.0.0.0/8,192.168.0.0/16",
+	}
+	roleData["allowed_extensions"] = "permit-pty,login@{{identity.entity.metadata.team}}"
+	roleData["allowed_extensions_template"] = true
+	roleData["default_extensions"] = map[string]interface{}{
+		"login@example.com": "{{identity.entity.name}}",
+	}
+	roleData["default_extensions_template"] = true
+	roleData["not_before_duration"] = "5m"
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/teams",
+		Storage:   config.StorageView,
+		Data:      roleData,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roles/teams",
+		Storage:   config.StorageView,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if resp.Data["not_before_duration"] != "5m" || resp.Data["allowed_extensions_template"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	signReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "sign/teams",
+		Storage:   config.StorageView,
+		Entity: &logical.Entity{
+			Name: "bob",
+			Metadata: map[string]string{
+				"team": "infra",
+			},
+		},
+		Data: map[string]interface{}{
+			"public_key": publicKey2,
+		},
+	}
+	sign := func() *ssh.Certificate {
+		resp, err := b.HandleRequest(signReq)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		signedKey := strings.TrimSpace(resp.Data["signed_key"].(string))
+		key, _ := base64.StdEncoding.DecodeString(strings.Split(signedKey, " ")[1])
+		parsedKey, err := ssh.ParsePublicKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsedKey.(*ssh.Certificate)
+	}
+
+	// Default extensions are populated from the entity, and the certificate
+	// is backdated by not_before_duration
+	cert := sign()
+	if !reflect.DeepEqual(cert.Permissions.Extensions, map[string]string{"login@example.com": "bob"}) {
+		t.Fatalf("bad extensions: %#v", cert.Permissions.Extensions)
+	}
+	backdated := time.Now().Add(-5 * time.Minute).Unix()
+	if validAfter := int64(cert.ValidAfter); validAfter > backdated+5 || validAfter < backdated-5 {
+		t.Fatalf("bad ValidAfter: %d, expected about %d", validAfter, backdated)
+	}
+
+	// Requested extensions are checked against the populated templates
+	signReq.Data["extensions"] = map[string]interface{}{
+		"login@infra": "",
+	}
+	cert = sign()
+	if !reflect.DeepEqual(cert.Permissions.Extensions, map[string]string{"login@infra": ""}) {
+		t.Fatalf("bad extensions: %#v", cert.Permissions.Extensions)
+	}
+
+	signReq.Entity.Metadata["team"] = "sales"
+	resp, err = b.HandleRequest(signReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error response, got %#v", resp)
+	}
+	delete(signReq.Data, "extensions")
+
+	// The default force-command and source-address are kept when other
+	// critical options are requested, and force-command can be overridden
+	// because it is explicitly allowed
+	signReq.Data["critical_options"] = map[string]interface{}{
+		"permit-agent": "",
+	}
+	cert = sign()
+	expected := map[string]string{
+		"permit-agent":   "",
+		"force-command":  "/usr/bin/uptime",
+		"source-address": "10.0.0.0/8,192.168.0.0/16",
+	}
+	if !reflect.DeepEqual(cert.Permissions.CriticalOptions, expected) {
+		t.Fatalf("bad critical options: %#v", cert.Permissions.CriticalOptions)
+	}
+
+	signReq.Data["critical_options"] = map[string]interface{}{
+		"force-command": "/usr/bin/w",
+	}
+	cert = sign()
+	expected = map[string]string{
+		"force-command":  "/usr/bin/w",
+		"source-address": "10.0.0.0/8,192.168.0.0/16",
+	}
+	if !reflect.DeepEqual(cert.Permissions.CriticalOptions, expected) {
+		t.Fatalf("bad critical options: %#v", cert.Permissions.CriticalOptions)
+	}
+
+	// Without an entity the default extension templates cannot be populated
+	delete(signReq.Data, "critical_options")
+	signReq.Entity = nil
+	resp, err = b.HandleRequest(signReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error response, got %#v", resp)
+	}
+}
+
+func TestBackend_CARoleTemplating_childToken(t *testing.T) {
+	vault.AddTestLogicalBackend("ssh", Factory)
+	vault.AddTestCredentialBackend("userpass", userpass.Factory)
+	core, _, root := vault.TestCoreUnsealed(t)
+
+	request := func(token, path string, data map[string]interface{}) (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.UpdateOperation, path)
+		req.ClientToken = token
+		req.Data = data
+		return core.HandleRequest(req)
+	}
+	for _, step := range []struct {
+		path string
+		data map[string]interface{}
+	}{
+		{"sys/mounts/ssh", map[string]interface{}{"type": "ssh"}},
+		{"sys/auth/userpass", map[string]interface{}{"type": "userpass"}},
+		{"sys/policy/signer", map[string]interface{}{
+			"rules": `path "ssh/sign/*" { capabilities = ["update"] }
+path "auth/token/create" { capabilities = ["update"] }`,
+		}},
+		{"auth/userpass/users/alice", map[string]interface{}{"password": "secret", "policies": "signer"}},
+		{"ssh/config/ca", map[string]interface{}{"public_key": publicKey, "private_key": privateKey}},
+		{"ssh/roles/users", map[string]interface{}{
+			"key_type":                    "ca",
+			"allowed_users":               "tuber",
+			"default_user":                "tuber",
+			"allow_user_certificates":     true,
+			"allowed_extensions":          "permit-pty,login@{{identity.entity.metadata.username}}",
+			"allowed_extensions_template": true,
+		}},
+	} {
+		if resp, err := request(root, step.path, step.data); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s: err: %v resp: %#v", step.path, err, resp)
+		}
+	}
+
+	resp, err := request("", "auth/userpass/login/alice", map[string]interface{}{"password": "secret"})
+	if err != nil || resp == nil || resp.Auth == nil {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	userToken := resp.Auth.ClientToken
+
+	// Child tokens carrying forged metadata still get the username the auth
+	// backend set on login
+	resp, err = request(userToken, "auth/token/create", map[string]interface{}{
+		"meta": map[string]interface{}{"username": "bob"},
+	})
+	if err != nil || resp == nil || resp.Auth == nil {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	childToken := resp.Auth.ClientToken
+
+	sign := func(token, extension string) (*logical.Response, error) {
+		return request(token, "ssh/sign/users", map[string]interface{}{
+			"public_key": publicKey2,
+			"extensions": map[string]interface{}{extension: ""},
+		})
+	}
+	if resp, err := sign(childToken, "login@bob"); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected forged metadata not to widen the allowed extensions, got %#v", resp)
+	}
+	for _, token := range []string{userToken, childToken} {
+		if resp, err := sign(token, "login@alice"); err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+	}
+}
+
+func TestBackend_AlgorithmSigner(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Factory(config)
+	if err != nil {
+		t.Fatalf("Cannot create backend: %s", err)
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/ca",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"public_key":  publicKey,
+			"private_key": privateKey,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	writeRole := func(algorithm string) (*logical.Response, error) {
+		return b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/testing",
+			Storage:   config.StorageView,
+			Data: map[string]interface{}{
+				"key_type":                "ca",
+				"allowed_users":           "tuber",
+				"default_user":            "tuber",
+				"allow_user_certificates": true,
+				"algorithm_signer":        algorithm,
+			},
+		})
+	}
+	sign := func() (*logical.Response, error) {
+		return b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "sign/testing",
+			Storage:   config.StorageView,
+			Data: map[string]interface{}{
+				"public_key": publicKey2,
+			},
+		})
+	}
+
+	for algorithm, expected := range map[string]struct {
+		format string
+		hash   crypto.Hash
+	}{
+		"":             {"rsa-sha2-256", crypto.SHA256},
+		"ssh-rsa":      {"ssh-rsa", crypto.SHA1},
+		"rsa-sha2-256": {"rsa-sha2-256", crypto.SHA256},
+		"rsa-sha2-512": {"rsa-sha2-512", crypto.SHA512},
+	} {
+		resp, err := writeRole(algorithm)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+		resp, err = sign()
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v resp: %#v", err, resp)
+		}
+
+		signedKey := strings.TrimSpace(resp.Data["signed_key"].(string))
+		key, _ := base64.StdEncoding.DecodeString(strings.Split(signedKey, " ")[1])
+		parsedKey, err := ssh.ParsePublicKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert := parsedKey.(*ssh.Certificate)
+		if cert.Signature.Format != expected.format {
+			t.Fatalf("algorithm %q: bad signature format %q", algorithm, cert.Signature.Format)
+		}
+
+		// The signed data is the certificate without its signature, and
+		// without the trailing length of the signature
+		unsigned := *cert
+		unsigned.Signature = nil
+		data := unsigned.Marshal()
+		data = data[:len(data)-4]
+
+		h := expected.hash.New()
+		h.Write(data)
+		caKey := cert.SignatureKey.(ssh.CryptoPublicKey).CryptoPublicKey().(*rsa.PublicKey)
+		if err := rsa.VerifyPKCS1v15(caKey, expected.hash, h.Sum(nil), cert.Signature.Blob); err != nil {
+			t.Fatalf("algorithm %q: bad signature: %v", algorithm, err)
+		}
+	}
+
+	// ed25519 signatures require an ed25519 CA key
+	resp, err = writeRole("ed25519")
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	resp, err = sign()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error response, got %#v", resp)
+	}
+
+	resp, err = writeRole("dsa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error response, got %#v", resp)
+	}
+}
+
 func configCaStep() logicaltest.TestStep {
 	return logicaltest.TestStep{
 		Operation: logical.UpdateOperation,
@@ -22,29 +22,33 @@ const (
 // for both OTP and Dynamic roles. Not all the fields are mandatory for both type.
 // Some are applicable for one and not for other. It doesn't matter.
 type sshRole struct {
-	KeyType                string            `mapstructure:"key_type" json:"key_type"`
-	KeyName                string            `mapstructure:"key" json:"key"`
-	KeyBits                int               `mapstructure:"key_bits" json:"key_bits"`
-	AdminUser              string            `mapstructure:"admin_user" json:"admin_user"`
-	DefaultUser            string            `mapstructure:"default_user" json:"default_user"`
-	CIDRList               string            `mapstructure:"cidr_list" json:"cidr_list"`
-	ExcludeCIDRList        string            `mapstructure:"exclude_cidr_list" json:"exclude_cidr_list"`
-	Port                   int               `mapstructure:"port" json:"port"`
-	InstallScript          string            `mapstructure:"install_script" json:"install_script"`
-	AllowedUsers           string            `mapstructure:"allowed_users" json:"allowed_users"`
-	AllowedDomains         string            `mapstructure:"allowed_domains" json:"allowed_domains"`
-	KeyOptionSpecs         string            `mapstructure:"key_option_specs" json:"key_option_specs"`
-	MaxTTL                 string            `mapstructure:"max_ttl" json:"max_ttl"`
-	TTL                    string            `mapstructure:"ttl" json:"ttl"`
-	DefaultCriticalOptions map[string]string `mapstructure:"default_critical_options" json:"default_critical_options"`
-	DefaultExtensions      map[string]string `mapstructure:"default_extensions" json:"default_extensions"`
-	AllowedCriticalOptions string            `mapstructure:"allowed_critical_options" json:"allowed_critical_options"`
-	AllowedExtensions      string            `mapstructure:"allowed_extensions" json:"allowed_extensions"`
-	AllowUserCertificates  bool              `mapstructure:"allow_user_certificates" json:"allow_user_certificates"`
-	AllowHostCertificates  bool              `mapstructure:"allow_host_certificates" json:"allow_host_certificates"`
-	AllowBareDomains       bool              `mapstructure:"allow_bare_domains" json:"allow_bare_domains"`
-	AllowSubdomains        bool              `mapstructure:"allow_subdomains" json:"allow_subdomains"`
-	AllowUserKeyIDs        bool              `mapstructure:"allow_user_key_ids" json:"allow_user_key_ids"`
+	KeyType                   string            `mapstructure:"key_type" json:"key_type"`
+	KeyName                   string            `mapstructure:"key" json:"key"`
+	KeyBits                   int               `mapstructure:"key_bits" json:"key_bits"`
+	AdminUser                 string            `mapstructure:"admin_user" json:"admin_user"`
+	DefaultUser               string            `mapstructure:"default_user" json:"default_user"`
+	CIDRList                  string            `mapstructure:"cidr_list" json:"cidr_list"`
+	ExcludeCIDRList           string            `mapstructure:"exclude_cidr_list" json:"exclude_cidr_list"`
+	Port                      int               `mapstructure:"port" json:"port"`
+	InstallScript             string            `mapstructure:"install_script" json:"install_script"`
+	AllowedUsers              string            `mapstructure:"allowed_users" json:"allowed_users"`
+	AllowedDomains            string            `mapstructure:"allowed_domains" json:"allowed_domains"`
+	KeyOptionSpecs            string            `mapstructure:"key_option_specs" json:"key_option_specs"`
+	MaxTTL                    string            `mapstructure:"max_ttl" json:"max_ttl"`
+	TTL                       string            `mapstructure:"ttl" json:"ttl"`
+	DefaultCriticalOptions    map[string]string `mapstructure:"default_critical_options" json:"default_critical_options"`
+	DefaultExtensions         map[string]string `mapstructure:"default_extensions" json:"default_extensions"`
+	AllowedCriticalOptions    string            `mapstructure:"allowed_critical_options" json:"allowed_critical_options"`
+	AllowedExtensions         string            `mapstructure:"allowed_extensions" json:"allowed_extensions"`
+	AllowedExtensionsTemplate bool              `mapstructure:"allowed_extensions_template" json:"allowed_extensions_template"`
+	DefaultExtensionsTemplate bool              `mapstructure:"default_extensions_template" json:"default_extensions_template"`
+	NotBeforeDuration         string            `mapstructure:"not_before_duration" json:"not_before_duration"`
+	AlgorithmSigner           string            `mapstructure:"algorithm_signer" json:"algorithm_signer"`
+	AllowUserCertificates     bool              `mapstructure:"allow_user_certificates" json:"allow_user_certificates"`
+	AllowHostCertificates     bool              `mapstructure:"allow_host_certificates" json:"allow_host_certificates"`
+	AllowBareDomains          bool              `mapstructure:"allow_bare_domains" json:"allow_bare_domains"`
+	AllowSubdomains           bool              `mapstructure:"allow_subdomains" json:"allow_subdomains"`
+	AllowUserKeyIDs           bool              `mapstructure:"allow_user_key_ids" json:"allow_user_key_ids"`
 }
 
 func pathListRoles(b *backend) *framework.Path {
@@ -225,6 +229,45 @@ func pathRoles(b *backend) *framework.Path {
 				"allowed_extensions". Defaults to none.
 				`,
 			},
+			"allowed_extensions_template": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `
+				[Not applicable for Dynamic type] [Not applicable for OTP type] [Optional for CA type]
+				If set, "allowed_extensions" can contain identity template policies,
+				e.g. "permit-{{identity.entity.metadata.team}}". Templates that
+				cannot be populated for the requesting entity are ignored.
+				`,
+				Default: false,
+			},
+			"default_extensions_template": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `
+				[Not applicable for Dynamic type] [Not applicable for OTP type] [Optional for CA type]
+				If set, the values of "default_extensions" can contain identity
+				template policies, e.g. "{{identity.entity.name}}". Signing fails
+				if a template cannot be populated for the requesting entity.
+				`,
+				Default: false,
+			},
+			"not_before_duration": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `
+				[Not applicable for Dynamic type] [Not applicable for OTP type] [Optional for CA type]
+				Duration before the time of signing from which certificates are
+				valid, to allow for clock skew between Vault and SSH servers.
+				Defaults to 30s.
+				`,
+			},
+			"algorithm_signer": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `
+				[Not applicable for Dynamic type] [Not applicable for OTP type] [Optional for CA type]
+				Signature algorithm used to sign certificates: "ssh-rsa",
+				"rsa-sha2-256" or "rsa-sha2-512" for RSA CA keys, or "ed25519"
+				for ed25519 CA keys. Defaults to "rsa-sha2-256" for RSA CA keys
+				and to the algorithm of the CA key otherwise.
+				`,
+			},
 			"allow_user_certificates": &framework.FieldSchema{
 				Type: framework.TypeBool,
 				Description: `
@@ -423,19 +466,23 @@ func (b *backend) pathRoleWrite(req *logical.Request, d *framework.FieldData) (*
 
 func (b *backend) createCARole(allowedUsers, defaultUser string, data *framework.FieldData) (*sshRole, *logical.Response) {
 	role := &sshRole{
-		MaxTTL: data.Get("max_ttl").(string),
-		TTL:    data.Get("ttl").(string),
-		AllowedCriticalOptions: data.Get("allowed_critical_options").(string),
-		AllowedExtensions:      data.Get("allowed_extensions").(string),
-		AllowUserCertificates:  data.Get("allow_user_certificates").(bool),
-		AllowHostCertificates:  data.Get("allow_host_certificates").(bool),
-		AllowedUsers:           allowedUsers,
-		AllowedDomains:         data.Get("allowed_domains").(string),
-		DefaultUser:            defaultUser,
-		AllowBareDomains:       data.Get("allow_bare_domains").(bool),
-		AllowSubdomains:        data.Get("allow_subdomains").(bool),
-		AllowUserKeyIDs:        data.Get("allow_user_key_ids").(bool),
-		KeyType:                KeyTypeCA,
+		MaxTTL:                    data.Get("max_ttl").(string),
+		TTL:                       data.Get("ttl").(string),
+		AllowedCriticalOptions:    data.Get("allowed_critical_options").(string),
+		AllowedExtensions:         data.Get("allowed_extensions").(string),
+		AllowedExtensionsTemplate: data.Get("allowed_extensions_template").(bool),
+		DefaultExtensionsTemplate: data.Get("default_extensions_template").(bool),
+		NotBeforeDuration:         data.Get("not_before_duration").(string),
+		AlgorithmSigner:           data.Get("algorithm_signer").(string),
+		AllowUserCertificates:     data.Get("allow_user_certificates").(bool),
+		AllowHostCertificates:     data.Get("allow_host_certificates").(bool),
+		AllowedUsers:              allowedUsers,
+		AllowedDomains:            data.Get("allowed_domains").(string),
+		DefaultUser:               defaultUser,
+		AllowBareDomains:          data.Get("allow_bare_domains").(bool),
+		AllowSubdomains:           data.Get("allow_subdomains").(bool),
+		AllowUserKeyIDs:           data.Get("allow_user_key_ids").(bool),
+		KeyType:                   KeyTypeCA,
 	}
 
 	if !role.AllowUserCertificates && !role.AllowHostCertificates {
@@ -445,6 +492,25 @@ func (b *backend) createCARole(allowedUsers, defaultUser string, data *framework
 	defaultCriticalOptions := convertMapToStringValue(data.Get("default_critical_options").(map[string]interface{}))
 	defaultExtensions := convertMapToStringValue(data.Get("default_extensions").(map[string]interface{}))
 
+	if err := validateCriticalOptions(defaultCriticalOptions); err != nil {
+		return nil, logical.ErrorResponse(fmt.Sprintf("Invalid default_critical_options: %s", err))
+	}
+
+	if !validSigningAlgorithm(role.AlgorithmSigner) {
+		return nil, logical.ErrorResponse(fmt.Sprintf("Invalid algorithm_signer: %q", role.AlgorithmSigner))
+	}
+
+	if len(role.NotBeforeDuration) != 0 {
+		notBefore, err := parseutil.ParseDurationSecond(role.NotBeforeDuration)
+		if err != nil {
+			return nil, logical.ErrorResponse(fmt.Sprintf(
+				"Invalid not_before_duration: %s", err))
+		}
+		if notBefore < 0 {
+			return nil, logical.ErrorResponse("not_before_duration cannot be negative")
+		}
+	}
+
 	var maxTTL time.Duration
 	maxSystemTTL := b.System().MaxLeaseTTL()
 	if len(role.MaxTTL) == 0 {
@@ -541,21 +607,25 @@ func (b *backend) pathRoleRead(req *logical.Request, d *framework.FieldData) (*l
 	} else if role.KeyType == KeyTypeCA {
 		return &logical.Response{
 			Data: map[string]interface{}{
-				"allowed_users":   role.AllowedUsers,
-				"allowed_domains": role.AllowedDomains,
-				"default_user":    role.DefaultUser,
-				"max_ttl":         role.MaxTTL,
-				"ttl":             role.TTL,
-				"allowed_critical_options": role.AllowedCriticalOptions,
-				"allowed_extensions":       role.AllowedExtensions,
-				"allow_user_certificates":  role.AllowUserCertificates,
-				"allow_host_certificates":  role.AllowHostCertificates,
-				"allow_bare_domains":       role.AllowBareDomains,
-				"allow_subdomains":         role.AllowSubdomains,
-				"allow_user_key_ids":       role.AllowUserKeyIDs,
-				"key_type":                 role.KeyType,
-				"default_critical_options": role.DefaultCriticalOptions,
-				"default_extensions":       role.DefaultExtensions,
+				"allowed_users":               role.AllowedUsers,
+				"allowed_domains":             role.AllowedDomains,
+				"default_user":                role.DefaultUser,
+				"max_ttl":                     role.MaxTTL,
+				"ttl":                         role.TTL,
+				"allowed_critical_options":    role.AllowedCriticalOptions,
+				"allowed_extensions":          role.AllowedExtensions,
+				"allowed_extensions_template": role.AllowedExtensionsTemplate,
+				"default_extensions_template": role.DefaultExtensionsTemplate,
+				"not_before_duration":         role.NotBeforeDuration,
+				"algorithm_signer":            role.AlgorithmSigner,
+				"allow_user_certificates":     role.AllowUserCertificates,
+				"allow_host_certificates":     role.AllowHostCertificates,
+				"allow_bare_domains":          role.AllowBareDomains,
+				"allow_subdomains":            role.AllowSubdomains,
+				"allow_user_key_ids":          role.AllowUserKeyIDs,
+				"key_type":                    role.KeyType,
+				"default_critical_options":    role.DefaultCriticalOptions,
+				"default_extensions":          role.DefaultExtensions,
 			},
 		}, nil
 	} else {
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/helper/identitytpl"
 	"github.com/hashicorp/vault/helper/parseutil"
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
@@ -28,8 +29,18 @@ type creationBundle struct {
 	Role            *sshRole
 	CriticalOptions map[string]string
 	Extensions      map[string]string
+	NotBefore       time.Duration
 }
 
+// enforcedCriticalOptions are the critical options restricting how a
+// certificate can be used. Their role defaults are kept when other critical
+// options are requested, unless the role explicitly allows overriding them.
+var enforcedCriticalOptions = []string{"force-command", "source-address"}
+
+// defaultNotBeforeDuration is how far certificates are backdated if the role
+// does not set not_before_duration
+const defaultNotBeforeDuration = 30 * time.Second
+
 func pathSign(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: "sign/" + framework.GenericNameRegex("role"),
@@ -144,7 +155,12 @@ func (b *backend) pathSignCertificate(req *logical.Request, data *framework.Fiel
 		return logical.ErrorResponse(err.Error()), nil
 	}
 
-	extensions, err := b.calculateExtensions(data, role)
+	extensions, err := b.calculateExtensions(data, req, role)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	notBefore, err := b.calculateNotBefore(role)
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), nil
 	}
@@ -157,11 +173,16 @@ func (b *backend) pathSignCertificate(req *logical.Request, data *framework.Fiel
 		return nil, fmt.Errorf("failed to read CA private key")
 	}
 
-	signer, err := ssh.ParsePrivateKey([]byte(privateKeyEntry.Key))
+	rawKey, err := ssh.ParseRawPrivateKey([]byte(privateKeyEntry.Key))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse stored CA private key: %v", err)
 	}
 
+	signer, err := caSigner(rawKey, role.AlgorithmSigner)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
 	cBundle := creationBundle{
 		KeyId:           keyId,
 		PublicKey:       userPublicKey,
@@ -172,6 +193,7 @@ func (b *backend) pathSignCertificate(req *logical.Request, data *framework.Fiel
 		Role:            role,
 		CriticalOptions: criticalOptions,
 		Extensions:      extensions,
+		NotBefore:       notBefore,
 	}
 
 	certificate, err := cBundle.sign()
@@ -295,9 +317,10 @@ func (b *backend) calculateCriticalOptions(data *framework.FieldData, role *sshR
 
 	criticalOptions := convertMapToStringValue(unparsedCriticalOptions)
 
+	var allowedCriticalOptions []string
 	if role.AllowedCriticalOptions != "" {
 		notAllowedOptions := []string{}
-		allowedCriticalOptions := strings.Split(role.AllowedCriticalOptions, ",")
+		allowedCriticalOptions = strings.Split(role.AllowedCriticalOptions, ",")
 
 		for option := range criticalOptions {
 			if !strutil.StrListContains(allowedCriticalOptions, option) {
@@ -310,13 +333,40 @@ func (b *backend) calculateCriticalOptions(data *framework.FieldData, role *sshR
 		}
 	}
 
+	for _, option := range enforcedCriticalOptions {
+		value, ok := role.DefaultCriticalOptions[option]
+		if !ok {
+			continue
+		}
+		if _, requested := criticalOptions[option]; requested && strutil.StrListContains(allowedCriticalOptions, option) {
+			continue
+		}
+		criticalOptions[option] = value
+	}
+
+	if err := validateCriticalOptions(criticalOptions); err != nil {
+		return nil, err
+	}
+
 	return criticalOptions, nil
 }
 
-func (b *backend) calculateExtensions(data *framework.FieldData, role *sshRole) (map[string]string, error) {
+func (b *backend) calculateExtensions(data *framework.FieldData, req *logical.Request, role *sshRole) (map[string]string, error) {
 	unparsedExtensions := data.Get("extensions").(map[string]interface{})
 	if len(unparsedExtensions) == 0 {
-		return role.DefaultExtensions, nil
+		if !role.DefaultExtensionsTemplate {
+			return role.DefaultExtensions, nil
+		}
+
+		extensions := make(map[string]string, len(role.DefaultExtensions))
+		for extension, value := range role.DefaultExtensions {
+			_, populated, err := identitytpl.PopulateString(req.Entity, value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to populate default extension %q: %v", extension, err)
+			}
+			extensions[extension] = populated
+		}
+		return extensions, nil
 	}
 
 	extensions := convertMapToStringValue(unparsedExtensions)
@@ -325,6 +375,20 @@ func (b *backend) calculateExtensions(data *framework.FieldData, role *sshRole)
 		notAllowed := []string{}
 		allowedExtensions := strings.Split(role.AllowedExtensions, ",")
 
+		// Templated extensions that cannot be populated for this requester
+		// simply do not match
+		if role.AllowedExtensionsTemplate {
+			populatedExtensions := make([]string, 0, len(allowedExtensions))
+			for _, extension := range allowedExtensions {
+				_, populated, err := identitytpl.PopulateString(req.Entity, extension)
+				if err != nil {
+					continue
+				}
+				populatedExtensions = append(populatedExtensions, populated)
+			}
+			allowedExtensions = populatedExtensions
+		}
+
 		for extension := range extensions {
 			if !strutil.StrListContains(allowedExtensions, extension) {
 				notAllowed = append(notAllowed, extension)
@@ -339,6 +403,19 @@ func (b *backend) calculateExtensions(data *framework.FieldData, role *sshRole)
 	return extensions, nil
 }
 
+func (b *backend) calculateNotBefore(role *sshRole) (time.Duration, error) {
+	if len(role.NotBeforeDuration) == 0 {
+		return defaultNotBeforeDuration, nil
+	}
+
+	notBefore, err := parseutil.ParseDurationSecond(role.NotBeforeDuration)
+	if err != nil {
+		return 0, fmt.Errorf("invalid not_before_duration: %s", err)
+	}
+
+	return notBefore, nil
+}
+
 func (b *backend) calculateTTL(data *framework.FieldData, role *sshRole) (time.Duration, error) {
 
 	var ttl, maxTTL time.Duration
@@ -406,7 +483,7 @@ func (b *creationBundle) sign() (retCert *ssh.Certificate, retErr error) {
 		Key:             b.PublicKey,
 		KeyId:           b.KeyId,
 		ValidPrincipals: b.ValidPrincipals,
-		ValidAfter:      uint64(now.Add(-30 * time.Second).In(time.UTC).Unix()),
+		ValidAfter:      uint64(now.Add(-b.NotBefore).In(time.UTC).Unix()),
 		ValidBefore:     uint64(now.Add(b.TTL).In(time.UTC).Unix()),
 		CertType:        b.CertificateType,
 		Permissions: ssh.Permissions{
@@ -0,0 +1,103 @@
+package ssh
+
+import (
+	"crypto"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// SigningAlgorithmDefault signs with rsa-sha2-256 if the CA key is an
+	// RSA key, and with the algorithm of the CA key otherwise
+	SigningAlgorithmDefault = ""
+
+	SigningAlgorithmSSHRSA     = "ssh-rsa"
+	SigningAlgorithmRSASHA256  = "rsa-sha2-256"
+	SigningAlgorithmRSASHA512  = "rsa-sha2-512"
+	SigningAlgorithmED25519    = "ed25519"
+	signingAlgorithmDefaultRSA = SigningAlgorithmRSASHA256
+)
+
+// validSigningAlgorithm returns whether the algorithm can be set on a role
+func validSigningAlgorithm(algorithm string) bool {
+	switch algorithm {
+	case SigningAlgorithmDefault, SigningAlgorithmSSHRSA, SigningAlgorithmRSASHA256,
+		SigningAlgorithmRSASHA512, SigningAlgorithmED25519:
+		return true
+	}
+	return false
+}
+
+// caSigner returns a signer for the given CA private key, signing with the
+// given algorithm. It returns an error if the algorithm cannot be used with
+// the type of the key.
+func caSigner(rawKey interface{}, algorithm string) (ssh.Signer, error) {
+	signer, err := ssh.NewSignerFromKey(rawKey)
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := rawKey.(type) {
+	case *rsa.PrivateKey:
+		switch algorithm {
+		case SigningAlgorithmDefault:
+			algorithm = signingAlgorithmDefaultRSA
+		case SigningAlgorithmSSHRSA:
+			return signer, nil
+		case SigningAlgorithmED25519:
+			return nil, fmt.Errorf("algorithm_signer %q cannot be used with an RSA CA key", algorithm)
+		}
+
+		hash := crypto.SHA256
+		if algorithm == SigningAlgorithmRSASHA512 {
+			hash = crypto.SHA512
+		}
+		return &rsaSHA2Signer{
+			Signer: signer,
+			key:    key,
+			hash:   hash,
+			format: algorithm,
+		}, nil
+
+	case *ed25519.PrivateKey, ed25519.PrivateKey:
+		if algorithm != SigningAlgorithmDefault && algorithm != SigningAlgorithmED25519 {
+			return nil, fmt.Errorf("algorithm_signer %q cannot be used with an ed25519 CA key", algorithm)
+		}
+		return signer, nil
+
+	default:
+		if algorithm != SigningAlgorithmDefault {
+			return nil, fmt.Errorf("algorithm_signer %q cannot be used with a %s CA key", algorithm, signer.PublicKey().Type())
+		}
+		return signer, nil
+	}
+}
+
+// rsaSHA2Signer signs with the rsa-sha2-256 and rsa-sha2-512 algorithms of
+// RFC 8332, as OpenSSH 8.2 and later reject ssh-rsa signatures
+type rsaSHA2Signer struct {
+	ssh.Signer
+	key    *rsa.PrivateKey
+	hash   crypto.Hash
+	format string
+}
+
+func (s *rsaSHA2Signer) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	h := s.hash.New()
+	h.Write(data)
+	blob, err := rsa.SignPKCS1v15(rand, s.key, s.hash, h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ssh.Signature{
+		Format: s.format,
+		Blob:   blob,
+	}, nil
+}
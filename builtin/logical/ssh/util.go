@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/hashicorp/vault/helper/cidrutil"
 	"github.com/hashicorp/vault/logical"
 
 	log "github.com/mgutz/logxi/v1"
@@ -212,3 +213,22 @@ func convertMapToStringValue(initial map[string]interface{}) map[string]string {
 	}
 	return result
 }
+
+// validateCriticalOptions checks the values of the critical options that
+// OpenSSH interprets. Unknown critical options are left to the SSH server.
+func validateCriticalOptions(criticalOptions map[string]string) error {
+	sourceAddress, ok := criticalOptions["source-address"]
+	if !ok {
+		return nil
+	}
+
+	valid, err := cidrutil.ValidateCIDRListString(sourceAddress, ",")
+	if err != nil {
+		return fmt.Errorf("failed to validate source-address: %v", err)
+	}
+	if !valid {
+		return fmt.Errorf("failed to validate source-address")
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package terraform
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	var b backend
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		Paths: []*framework.Path{
+			pathConfig(&b),
+			pathListRoles(&b),
+			pathRoles(&b),
+			pathCreds(&b),
+			pathRotateRole(&b),
+		},
+
+		Secrets: []*framework.Secret{
+			secretToken(&b),
+		},
+	}
+
+	return &b
+}
+
+type backend struct {
+	*framework.Backend
+
+	// roleLock guards the tokens of organization and team roles
+	roleLock sync.Mutex
+}
+
+const backendHelp = `
+The Terraform backend generates and rotates Terraform Cloud and Terraform
+Enterprise API tokens.
+
+Roles for users generate a new token for every request, which is deleted
+when its lease is revoked. Roles for organizations and teams manage their
+single token, which is rotated on demand.
+
+After mounting this backend, the address of the Terraform API and the token
+used to manage tokens must be configured with the "config" endpoint, and
+roles written with the "role/" endpoints before any tokens can be generated.
+`
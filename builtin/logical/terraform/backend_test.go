@@ -0,0 +1,370 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// fakeTerraform implements the authentication token endpoints of the
+// Terraform API
+type fakeTerraform struct {
+	sync.Mutex
+	nextID int
+
+	// userTokens maps token IDs to the description of user tokens, and
+	// ownerTokens maps organizations and teams to the value of their token
+	userTokens  map[string]string
+	ownerTokens map[string]string
+}
+
+func (f *fakeTerraform) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer admin" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/v2")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case r.Method == "POST" && len(parts) == 3 && parts[0] == "users" && parts[2] == "authentication-tokens":
+		var in authTokenDocument
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.nextID++
+		id := fmt.Sprintf("at-%d", f.nextID)
+		f.userTokens[id] = in.Data.Attributes.Description
+		f.writeToken(w, id, in.Data.Attributes.Description)
+
+	case r.Method == "DELETE" && len(parts) == 2 && parts[0] == "authentication-tokens":
+		if _, ok := f.userTokens[parts[1]]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.userTokens, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+
+	case len(parts) == 3 && (parts[0] == "organizations" || parts[0] == "teams") && parts[2] == "authentication-token":
+		owner := parts[0] + "/" + parts[1]
+		switch r.Method {
+		case "POST":
+			f.nextID++
+			id := fmt.Sprintf("at-%d", f.nextID)
+			f.ownerTokens[owner] = "token-" + id
+			f.writeToken(w, id, "")
+		case "DELETE":
+			if _, ok := f.ownerTokens[owner]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			delete(f.ownerTokens, owner)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeTerraform) writeToken(w http.ResponseWriter, id, description string) {
+	var out authTokenDocument
+	out.Data.ID = id
+	out.Data.Type = "authentication-tokens"
+	out.Data.Attributes.Token = "token-" + id
+	out.Data.Attributes.Description = description
+	w.Header().Set("Content-Type", jsonAPIMediaType)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&out)
+}
+
+func (f *fakeTerraform) userToken(id string) (string, bool) {
+	f.Lock()
+	defer f.Unlock()
+	description, ok := f.userTokens[id]
+	return description, ok
+}
+
+func (f *fakeTerraform) ownerToken(owner string) string {
+	f.Lock()
+	defer f.Unlock()
+	return f.ownerTokens[owner]
+}
+
+func testBackend(t *testing.T) (*backend, logical.Storage, *fakeTerraform, func()) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeTerraform{
+		userTokens:  map[string]string{},
+		ownerTokens: map[string]string{},
+	}
+	srv := httptest.NewServer(fake)
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"address": srv.URL,
+			"token":   "admin",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	return b, config.StorageView, fake, srv.Close
+}
+
+func TestBackend_config(t *testing.T) {
+	b, storage, _, cleanup := testBackend(t)
+	defer cleanup()
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if _, ok := resp.Data["token"]; ok {
+		t.Fatalf("token was returned: %#v", resp.Data)
+	}
+	if resp.Data["base_path"] != "/api/v2/" {
+		t.Fatalf("bad config: %#v", resp.Data)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"address": "app.terraform.io",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error writing an address without scheme: %#v", resp)
+	}
+}
+
+func TestBackend_userToken(t *testing.T) {
+	b, storage, fake, cleanup := testBackend(t)
+	defer cleanup()
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "role/dev",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"user_id": "user-1",
+			"ttl":     "1h",
+			"max_ttl": "2h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "creds/dev",
+		Storage:     storage,
+		DisplayName: "token-user",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp.Data["token"] != "token-at-1" || resp.Data["token_id"] != "at-1" {
+		t.Fatalf("bad token: %#v", resp.Data)
+	}
+	if resp.Secret == nil || resp.Secret.TTL != time.Hour {
+		t.Fatalf("bad secret: %#v", resp.Secret)
+	}
+	description, ok := fake.userToken("at-1")
+	if !ok || !strings.HasPrefix(description, "vault-dev-token-user-") {
+		t.Fatalf("bad token description: %q", description)
+	}
+
+	secret := resp.Secret
+	secret.IssueTime = time.Now()
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   storage,
+		Secret:    secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	for i := 0; i < 2; i++ {
+		// Revoking a deleted token succeeds
+		resp, err = b.HandleRequest(&logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   storage,
+			Secret:    secret,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+		if _, ok := fake.userToken("at-1"); ok {
+			t.Fatal("token was not deleted")
+		}
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "rotate-role/dev",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error rotating a user role: %#v", resp)
+	}
+}
+
+func TestBackend_ownerTokens(t *testing.T) {
+	b, storage, fake, cleanup := testBackend(t)
+	defer cleanup()
+
+	for _, tc := range []struct {
+		role  string
+		data  map[string]interface{}
+		owner string
+		field string
+	}{
+		{"org", map[string]interface{}{"organization": "hashicorp"}, "organizations/hashicorp", "organization"},
+		{"team", map[string]interface{}{"organization": "hashicorp", "team_id": "team-1"}, "teams/team-1", "team_id"},
+	} {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "role/" + tc.role,
+			Storage:   storage,
+			Data:      tc.data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+
+		resp, err = b.HandleRequest(&logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "role/" + tc.role,
+			Storage:   storage,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+		if _, ok := resp.Data["token"]; ok {
+			t.Fatalf("token was returned: %#v", resp.Data)
+		}
+
+		creds := func() map[string]interface{} {
+			resp, err := b.HandleRequest(&logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "creds/" + tc.role,
+				Storage:   storage,
+			})
+			if err != nil || (resp != nil && resp.IsError()) {
+				t.Fatalf("err:%s resp:%#v\n", err, resp)
+			}
+			if resp.Secret != nil {
+				t.Fatalf("%s token was leased: %#v", tc.role, resp.Secret)
+			}
+			return resp.Data
+		}
+
+		data := creds()
+		if data["token"] != fake.ownerToken(tc.owner) || data[tc.field] != tc.data[tc.field] {
+			t.Fatalf("bad %s token: %#v", tc.role, data)
+		}
+
+		resp, err = b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "rotate-role/" + tc.role,
+			Storage:   storage,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+		rotated := creds()
+		if rotated["token"] == data["token"] || rotated["token"] != fake.ownerToken(tc.owner) {
+			t.Fatalf("%s token was not rotated: %#v", tc.role, rotated)
+		}
+
+		resp, err = b.HandleRequest(&logical.Request{
+			Operation: logical.DeleteOperation,
+			Path:      "role/" + tc.role,
+			Storage:   storage,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%s resp:%#v\n", err, resp)
+		}
+		if fake.ownerToken(tc.owner) != "" {
+			t.Fatalf("%s token was not deleted", tc.role)
+		}
+	}
+}
+
+func TestBackend_roleValidation(t *testing.T) {
+	b, storage, _, cleanup := testBackend(t)
+	defer cleanup()
+
+	for _, data := range []map[string]interface{}{
+		{},
+		{"team_id": "team-1", "user_id": "user-1"},
+		{"organization": "hashicorp", "ttl": "1h"},
+		{"user_id": "user-1", "ttl": "2h", "max_ttl": "1h"},
+	} {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "role/test",
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error writing %v: %#v", data, resp)
+		}
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "role/test",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"user_id": "user-1",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/test",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"user_id": "user-2",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error changing the user of a role: %#v", resp)
+	}
+}
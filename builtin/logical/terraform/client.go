@@ -0,0 +1,172 @@
+package terraform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/logical"
+)
+
+const jsonAPIMediaType = "application/vnd.api+json"
+
+// client calls the authentication token endpoints of the Terraform Cloud and
+// Terraform Enterprise API.
+type client struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+}
+
+func terraformClient(s logical.Storage) (*client, error) {
+	conf, err := readConfig(s)
+	if err != nil {
+		return nil, err
+	}
+	if conf == nil {
+		return nil, fmt.Errorf("the backend is not configured; please configure it at the 'config' endpoint")
+	}
+
+	httpClient := cleanhttp.DefaultClient()
+	httpClient.Timeout = 30 * time.Second
+
+	return &client{
+		httpClient: httpClient,
+		baseURL:    strings.TrimSuffix(conf.Address, "/") + "/" + strings.Trim(conf.BasePath, "/"),
+		token:      conf.Token,
+	}, nil
+}
+
+// authToken is an authentication token of the Terraform API
+type authToken struct {
+	ID          string
+	Token       string
+	Description string
+}
+
+type authTokenDocument struct {
+	Data struct {
+		ID         string `json:"id,omitempty"`
+		Type       string `json:"type"`
+		Attributes struct {
+			Token       string `json:"token,omitempty"`
+			Description string `json:"description,omitempty"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+// createUserToken creates a new token of a user. Users can have several
+// tokens.
+func (c *client) createUserToken(userID, description string) (*authToken, error) {
+	return c.createToken("/users/"+url.PathEscape(userID)+"/authentication-tokens", description)
+}
+
+// deleteUserToken deletes a token of a user by ID, succeeding if it does not
+// exist.
+func (c *client) deleteUserToken(tokenID string) error {
+	return c.deleteToken("/authentication-tokens/" + url.PathEscape(tokenID))
+}
+
+// createOrganizationToken generates the token of an organization, which
+// replaces its previous token
+func (c *client) createOrganizationToken(organization string) (*authToken, error) {
+	return c.createToken("/organizations/"+url.PathEscape(organization)+"/authentication-token", "")
+}
+
+func (c *client) deleteOrganizationToken(organization string) error {
+	return c.deleteToken("/organizations/" + url.PathEscape(organization) + "/authentication-token")
+}
+
+// createTeamToken generates the token of a team, which replaces its previous
+// token
+func (c *client) createTeamToken(teamID string) (*authToken, error) {
+	return c.createToken("/teams/"+url.PathEscape(teamID)+"/authentication-token", "")
+}
+
+func (c *client) deleteTeamToken(teamID string) error {
+	return c.deleteToken("/teams/" + url.PathEscape(teamID) + "/authentication-token")
+}
+
+func (c *client) createToken(path, description string) (*authToken, error) {
+	var in authTokenDocument
+	in.Data.Type = "authentication-tokens"
+	in.Data.Attributes.Description = description
+
+	var out authTokenDocument
+	if err := c.do("POST", path, &in, &out); err != nil {
+		return nil, err
+	}
+	if out.Data.Attributes.Token == "" {
+		return nil, fmt.Errorf("the Terraform API did not return a token")
+	}
+
+	return &authToken{
+		ID:          out.Data.ID,
+		Token:       out.Data.Attributes.Token,
+		Description: out.Data.Attributes.Description,
+	}, nil
+}
+
+func (c *client) deleteToken(path string) error {
+	err := c.do("DELETE", path, nil, nil)
+	if respErr, ok := err.(*apiError); ok && respErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// apiError is an error response of the Terraform API
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("unexpected response code: %d (%s)", e.StatusCode, e.Message)
+}
+
+func (c *client) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if in != nil {
+		req.Header.Set("Content-Type", jsonAPIMediaType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return &apiError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(msg)),
+		}
+	}
+
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package terraform
+
+import (
+	"net/url"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const configKey = "config"
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config",
+		Fields: map[string]*framework.FieldSchema{
+			"address": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     "https://app.terraform.io",
+				Description: "Address of Terraform Cloud or of the Terraform Enterprise instance",
+			},
+
+			"base_path": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     "/api/v2/",
+				Description: "Base path of the Terraform API",
+			},
+
+			"token": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Token used to generate and revoke tokens, with access to the organizations, teams and users of the roles",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+			logical.DeleteOperation: b.pathConfigDelete,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+func readConfig(s logical.Storage) (*terraformConfig, error) {
+	entry, err := s.Get(configKey)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	conf := &terraformConfig{}
+	if err := entry.DecodeJSON(conf); err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	conf, err := readConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if conf == nil {
+		return nil, nil
+	}
+
+	// The token is not returned
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"address":   conf.Address,
+			"base_path": conf.BasePath,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	conf, err := readConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if conf == nil {
+		conf = &terraformConfig{
+			Address:  d.Get("address").(string),
+			BasePath: d.Get("base_path").(string),
+		}
+	}
+
+	if v, ok := d.GetOk("address"); ok {
+		conf.Address = v.(string)
+	}
+	if v, ok := d.GetOk("base_path"); ok {
+		conf.BasePath = v.(string)
+	}
+	if v, ok := d.GetOk("token"); ok {
+		conf.Token = v.(string)
+	}
+
+	if u, err := url.Parse(conf.Address); err != nil || u.Scheme == "" || u.Host == "" {
+		return logical.ErrorResponse("address must be a URL such as https://app.terraform.io"), nil
+	}
+	if conf.Token == "" {
+		return logical.ErrorResponse("token is required"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(configKey, conf)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathConfigDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete(configKey); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+type terraformConfig struct {
+	Address  string `json:"address"`
+	BasePath string `json:"base_path"`
+	Token    string `json:"token"`
+}
+
+const pathConfigHelpSyn = `
+Configure the address and token used to access the Terraform API.
+`
+
+const pathConfigHelpDesc = `
+This path configures the address of Terraform Cloud, or of a Terraform
+Enterprise instance, and the token Vault uses to generate and revoke tokens.
+The token must have access to the organizations, teams and users of the
+roles, and is not returned when reading the configuration.
+`
@@ -0,0 +1,147 @@
+package terraform
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathCreds(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "creds/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathCredsRead,
+		},
+
+		HelpSynopsis:    pathCredsHelpSyn,
+		HelpDescription: pathCredsHelpDesc,
+	}
+}
+
+func pathRotateRole(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "rotate-role/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRotateRole,
+		},
+
+		HelpSynopsis:    pathRotateRoleHelpSyn,
+		HelpDescription: pathRotateRoleHelpDesc,
+	}
+}
+
+func (b *backend) pathCredsRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	role, err := b.Role(req.Storage, name)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving role: %s", err)
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %q not found", name)), nil
+	}
+
+	if role.tokenType() != tokenTypeUser {
+		data := map[string]interface{}{
+			"token":    role.Token,
+			"token_id": role.TokenID,
+		}
+		if role.tokenType() == tokenTypeTeam {
+			data["team_id"] = role.TeamID
+		} else {
+			data["organization"] = role.Organization
+		}
+		return &logical.Response{
+			Data: data,
+		}, nil
+	}
+
+	c, err := terraformClient(req.Storage)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	description := fmt.Sprintf("vault-%s-%s-%d", name, req.DisplayName, time.Now().UnixNano())
+	token, err := c.createUserToken(role.UserID, description)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	resp := b.Secret(SecretTokenType).Response(map[string]interface{}{
+		"token":       token.Token,
+		"token_id":    token.ID,
+		"description": description,
+	}, map[string]interface{}{
+		"token_id": token.ID,
+		"role":     name,
+	})
+	resp.Secret.TTL = role.TTL
+
+	return resp, nil
+}
+
+func (b *backend) pathRotateRole(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.roleLock.Lock()
+	defer b.roleLock.Unlock()
+
+	name := d.Get("name").(string)
+	role, err := b.Role(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %q not found", name)), nil
+	}
+	if role.tokenType() == tokenTypeUser {
+		return logical.ErrorResponse("user tokens are revoked through their lease rather than rotated"), nil
+	}
+
+	if err := b.rotateRoleToken(req.Storage, role); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error rotating the %s token: %s", role.tokenType(), err)), nil
+	}
+	if err := storeRole(req.Storage, name, role); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+const pathCredsHelpSyn = `
+Generate or read a Terraform API token from a specific Vault role.
+`
+
+const pathCredsHelpDesc = `
+For user roles, this path generates a new token of the user, which is deleted
+when its lease is revoked.
+
+For organization and team roles, this path returns the current token of the
+organization or team, which is not leased and is replaced when the role is
+rotated.
+`
+
+const pathRotateRoleHelpSyn = `
+Rotate the token of an organization or team role.
+`
+
+const pathRotateRoleHelpDesc = `
+This path generates a new token for the organization or team of the role,
+which immediately invalidates its previous token.
+`
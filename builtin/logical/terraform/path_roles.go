@@ -0,0 +1,331 @@
+package terraform
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	tokenTypeUser         = "user"
+	tokenTypeTeam         = "team"
+	tokenTypeOrganization = "organization"
+)
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    pathRolesHelpSyn,
+		HelpDescription: pathRolesHelpDesc,
+	}
+}
+
+func pathRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role",
+			},
+
+			"organization": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the organization whose token is managed, if neither team_id nor user_id is set",
+			},
+
+			"team_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "ID of the team whose token is managed",
+			},
+
+			"user_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "ID of the user for whom tokens are generated",
+			},
+
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Default lease of user tokens. Defaults to the system default.",
+			},
+
+			"max_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum lease of user tokens. Defaults to the system maximum.",
+			},
+		},
+
+		ExistenceCheck: b.pathRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.CreateOperation: b.pathRoleWrite,
+			logical.UpdateOperation: b.pathRoleWrite,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    pathRolesHelpSyn,
+		HelpDescription: pathRolesHelpDesc,
+	}
+}
+
+func (b *backend) pathRoleExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	role, err := b.Role(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return role != nil, nil
+}
+
+func (b *backend) pathRoleList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("role/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathRoleRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := b.Role(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	// The token of organization and team roles is only returned by the
+	// creds endpoint
+	data := map[string]interface{}{
+		"organization": role.Organization,
+		"team_id":      role.TeamID,
+		"user_id":      role.UserID,
+		"token_type":   role.tokenType(),
+		"ttl":          int64(role.TTL / time.Second),
+		"max_ttl":      int64(role.MaxTTL / time.Second),
+	}
+	if role.tokenType() != tokenTypeUser {
+		data["token_id"] = role.TokenID
+		data["last_rotated"] = role.LastRotated
+	}
+
+	return &logical.Response{
+		Data: data,
+	}, nil
+}
+
+func (b *backend) pathRoleWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.roleLock.Lock()
+	defer b.roleLock.Unlock()
+
+	name := d.Get("name").(string)
+	role, err := b.Role(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	exists := role != nil
+	if !exists {
+		role = &roleEntry{}
+	}
+
+	// The organization, team or user of a role cannot be changed, as its
+	// tokens would be left behind
+	targets := []struct {
+		field string
+		value *string
+	}{
+		{"organization", &role.Organization},
+		{"team_id", &role.TeamID},
+		{"user_id", &role.UserID},
+	}
+	for _, target := range targets {
+		v, ok := d.GetOk(target.field)
+		if !ok {
+			continue
+		}
+		if exists && v.(string) != *target.value {
+			return logical.ErrorResponse(fmt.Sprintf("%s cannot be changed once the role is created", target.field)), nil
+		}
+		*target.value = v.(string)
+	}
+
+	if v, ok := d.GetOk("ttl"); ok {
+		role.TTL = time.Duration(v.(int)) * time.Second
+	}
+	if v, ok := d.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(v.(int)) * time.Second
+	}
+
+	switch {
+	case role.TeamID != "" && role.UserID != "":
+		return logical.ErrorResponse("team_id and user_id cannot both be set"), nil
+	case role.TeamID == "" && role.UserID == "" && role.Organization == "":
+		return logical.ErrorResponse("one of organization, team_id or user_id is required"), nil
+	case role.tokenType() != tokenTypeUser && (role.TTL != 0 || role.MaxTTL != 0):
+		return logical.ErrorResponse("ttl and max_ttl can only be set on user roles, as organization and team tokens are rotated rather than leased"), nil
+	case role.MaxTTL != 0 && role.TTL > role.MaxTTL:
+		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	}
+
+	// Organizations and teams have a single token, which is generated when
+	// the role is created
+	if !exists && role.tokenType() != tokenTypeUser {
+		if err := b.rotateRoleToken(req.Storage, role); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("error generating the %s token: %s", role.tokenType(), err)), nil
+		}
+	}
+
+	if err := storeRole(req.Storage, name, role); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathRoleDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.roleLock.Lock()
+	defer b.roleLock.Unlock()
+
+	name := d.Get("name").(string)
+	role, err := b.Role(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	// The token of organization and team roles is deleted with the role.
+	// User tokens are deleted when their lease is revoked.
+	if role.tokenType() != tokenTypeUser {
+		c, err := terraformClient(req.Storage)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		if role.tokenType() == tokenTypeTeam {
+			err = c.deleteTeamToken(role.TeamID)
+		} else {
+			err = c.deleteOrganizationToken(role.Organization)
+		}
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("error deleting the %s token: %s", role.tokenType(), err)), nil
+		}
+	}
+
+	if err := req.Storage.Delete("role/" + name); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// Role returns the role of the given name
+func (b *backend) Role(s logical.Storage, name string) (*roleEntry, error) {
+	entry, err := s.Get("role/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result roleEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func storeRole(s logical.Storage, name string, role *roleEntry) error {
+	entry, err := logical.StorageEntryJSON("role/"+name, role)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+// rotateRoleToken generates a new token for an organization or team role,
+// which replaces its previous token
+func (b *backend) rotateRoleToken(s logical.Storage, role *roleEntry) error {
+	c, err := terraformClient(s)
+	if err != nil {
+		return err
+	}
+
+	var token *authToken
+	if role.tokenType() == tokenTypeTeam {
+		token, err = c.createTeamToken(role.TeamID)
+	} else {
+		token, err = c.createOrganizationToken(role.Organization)
+	}
+	if err != nil {
+		return err
+	}
+
+	role.Token = token.Token
+	role.TokenID = token.ID
+	role.LastRotated = time.Now().UTC()
+	return nil
+}
+
+type roleEntry struct {
+	Organization string        `json:"organization"`
+	TeamID       string        `json:"team_id"`
+	UserID       string        `json:"user_id"`
+	TTL          time.Duration `json:"ttl"`
+	MaxTTL       time.Duration `json:"max_ttl"`
+
+	// Token, TokenID and LastRotated are the current token of organization
+	// and team roles
+	Token       string    `json:"token"`
+	TokenID     string    `json:"token_id"`
+	LastRotated time.Time `json:"last_rotated"`
+}
+
+// tokenType returns the type of the tokens of the role
+func (r *roleEntry) tokenType() string {
+	switch {
+	case r.UserID != "":
+		return tokenTypeUser
+	case r.TeamID != "":
+		return tokenTypeTeam
+	default:
+		return tokenTypeOrganization
+	}
+}
+
+const pathRolesHelpSyn = `
+Manage the roles used to generate Terraform API tokens.
+`
+
+const pathRolesHelpDesc = `
+This path lets you manage the roles used to generate Terraform Cloud and
+Terraform Enterprise API tokens. The type of the tokens depends on the
+fields of the role, which cannot be changed once it is created:
+
+  * with "user_id", a new token of the user is generated for every request,
+    and deleted when its lease, set by "ttl" and "max_ttl", is revoked.
+
+  * with "team_id", the token of the team is generated when the role is
+    created, and rotated with the "rotate-role/<name>" endpoint.
+
+  * with only "organization", the token of the organization is generated when
+    the role is created, and rotated with the "rotate-role/<name>" endpoint.
+
+Organizations and teams only have a single token, so creating a role for them
+invalidates their existing token, and deleting the role deletes the token.
+`
@@ -0,0 +1,62 @@
+package terraform
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const SecretTokenType = "token"
+
+func secretToken(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretTokenType,
+		Fields: map[string]*framework.FieldSchema{
+			"token": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Terraform API token",
+			},
+			"token_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "ID of the token",
+			},
+		},
+
+		Renew:  b.secretTokenRenew,
+		Revoke: b.secretTokenRevoke,
+	}
+}
+
+func (b *backend) secretTokenRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleName, ok := req.Secret.InternalData["role"].(string)
+	if !ok {
+		return nil, fmt.Errorf("secret is missing role internal data")
+	}
+
+	role, err := b.Role(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %q no longer exists", roleName)), nil
+	}
+
+	return framework.LeaseExtend(role.TTL, role.MaxTTL, b.System())(req, d)
+}
+
+func (b *backend) secretTokenRevoke(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	tokenID, ok := req.Secret.InternalData["token_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("secret is missing token_id internal data")
+	}
+
+	c, err := terraformClient(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, c.deleteUserToken(tokenID)
+}
@@ -20,6 +20,8 @@ func Backend(conf *logical.BackendConfig) *backend {
 			pathListKeys(&b),
 			pathKeys(&b),
 			pathCode(&b),
+			pathExport(&b),
+			pathImport(&b),
 		},
 
 		Secrets: []*framework.Secret{},
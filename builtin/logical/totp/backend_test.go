@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/url"
 	"path"
+	"reflect"
 	"testing"
 	"time"
 
@@ -1126,3 +1127,159 @@ func testAccStepValidateCode(t *testing.T, name string, code string, valid bool)
 		},
 	}
 }
+
+func TestBackend_importExport(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, _ := createKey()
+	urls := map[string]interface{}{
+		"alice": "otpauth://totp/Example:alice@example.com?secret=" + key + "&algorithm=SHA256&digits=8&period=60",
+		"bob":   "otpauth://totp/bob@example.com?secret=HXDMVJECJJWSRB3HWIZR4IFUGFTMXBOZ&issuer=Other",
+		"carol": "otpauth://hotp/carol@example.com?secret=HXDMVJECJJWSRB3HWIZR4IFUGFTMXBOZ",
+	}
+
+	// A single invalid url fails the whole import
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "import",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"keys":       urls,
+			"exportable": true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error response, got %#v", resp)
+	}
+	keys, err := config.StorageView.List("key/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("keys were imported: %v", keys)
+	}
+
+	delete(urls, "carol")
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "import",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"keys":       urls,
+			"exportable": true,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if !reflect.DeepEqual(resp.Data["imported"], []string{"alice", "bob"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "keys/bob",
+		Storage:   config.StorageView,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if resp.Data["issuer"] != "Other" || resp.Data["account_name"] != "bob@example.com" ||
+		resp.Data["period"] != uint(30) || resp.Data["exportable"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The exported url describes the same key
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "export/alice",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"qr_size":             100,
+			"qr_error_correction": "H",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if resp.Data["barcode"] == "" {
+		t.Fatalf("a barcode was not returned: %#v", resp.Data)
+	}
+	exported, err := keyEntryFromURL(resp.Data["url"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &keyEntry{
+		Key:         key,
+		Issuer:      "Example",
+		AccountName: "alice@example.com",
+		Period:      60,
+		Algorithm:   otplib.AlgorithmSHA256,
+		Digits:      otplib.DigitsEight,
+	}
+	if !reflect.DeepEqual(exported, expected) {
+		t.Fatalf("bad: expected %#v, got %#v", expected, exported)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "export/bob",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"qr_size": 0,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	if _, ok := resp.Data["barcode"]; ok {
+		t.Fatalf("a barcode was returned when qr_size was set to zero")
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "export/bob",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"qr_error_correction": "X",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error response, got %#v", resp)
+	}
+
+	// Keys are not exportable by default
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "keys/dave",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"key": key,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "export/dave",
+		Storage:   config.StorageView,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error response, got %#v", resp)
+	}
+}
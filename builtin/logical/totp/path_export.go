@@ -0,0 +1,92 @@
+package totp
+
+import (
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathExport(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "export/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the key.",
+			},
+
+			"qr_size": {
+				Type:        framework.TypeInt,
+				Default:     200,
+				Description: `The pixel size of the square QR code. If this value is 0, a QR code will not be returned.`,
+			},
+
+			"qr_error_correction": {
+				Type:        framework.TypeString,
+				Default:     "M",
+				Description: `The error correction level of the QR code. Options include L, M, Q and H.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathExportRead,
+			logical.UpdateOperation: b.pathExportRead,
+		},
+
+		HelpSynopsis:    pathExportHelpSyn,
+		HelpDescription: pathExportHelpDesc,
+	}
+}
+
+func (b *backend) pathExportRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	key, err := b.Key(req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, nil
+	}
+
+	if !key.Exportable {
+		return logical.ErrorResponse("the key is not exportable"), nil
+	}
+
+	qrSize := data.Get("qr_size").(int)
+	if qrSize < 0 {
+		return logical.ErrorResponse("the qr_size value must be greater than or equal to zero"), nil
+	}
+
+	qrLevel, err := parseErrorCorrection(data.Get("qr_error_correction").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	urlString := key.URL()
+	response := &logical.Response{
+		Data: map[string]interface{}{
+			"url": urlString,
+		},
+	}
+
+	// Don't include QR code is size is set to zero
+	if qrSize != 0 {
+		b64Barcode, err := encodeBarcode(urlString, qrSize, qrLevel)
+		if err != nil {
+			return logical.ErrorResponse("an error occured while generating a QR code image"), err
+		}
+		response.Data["barcode"] = b64Barcode
+	}
+
+	return response, nil
+}
+
+const pathExportHelpSyn = `
+Export the provisioning url of a key.
+`
+
+const pathExportHelpDesc = `
+This path returns the otpauth url of a key created with "exportable" set to
+true, along with its QR code, to provision the key in another authenticator.
+The size and error correction level of the QR code can be set when writing to
+this path.
+`
@@ -0,0 +1,167 @@
+package totp
+
+import (
+	"encoding/base32"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+var keyNameRegex = regexp.MustCompile("^" + framework.GenericNameRegex("name") + "$")
+
+func pathImport(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "import/?$",
+		Fields: map[string]*framework.FieldSchema{
+			"keys": {
+				Type:        framework.TypeMap,
+				Description: "Map of key names to the otpauth urls of the keys to import.",
+			},
+
+			"skew": {
+				Type:        framework.TypeInt,
+				Default:     1,
+				Description: `The number of delay periods that are allowed when validating a TOTP token. This value can either be 0 or 1.`,
+			},
+
+			"exportable": {
+				Type:        framework.TypeBool,
+				Default:     false,
+				Description: `Determines if the urls of the keys can be read from the export endpoint.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathImportWrite,
+		},
+
+		HelpSynopsis:    pathImportHelpSyn,
+		HelpDescription: pathImportHelpDesc,
+	}
+}
+
+func (b *backend) pathImportWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	urls := data.Get("keys").(map[string]interface{})
+	if len(urls) == 0 {
+		return logical.ErrorResponse("no keys to import"), nil
+	}
+
+	skew := data.Get("skew").(int)
+	if skew != 0 && skew != 1 {
+		return logical.ErrorResponse("the skew value must be 0 or 1"), nil
+	}
+	exportable := data.Get("exportable").(bool)
+
+	names := make([]string, 0, len(urls))
+	for name := range urls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Every url is checked before any key is stored, so that a failed import
+	// does not store some of the keys
+	entries := make([]*keyEntry, 0, len(names))
+	var errs []string
+	for _, name := range names {
+		if !keyNameRegex.MatchString(name) {
+			errs = append(errs, fmt.Sprintf("%s: invalid key name", name))
+			continue
+		}
+
+		inputURL, ok := urls[name].(string)
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s: the url must be a string", name))
+			continue
+		}
+
+		entry, err := keyEntryFromURL(inputURL)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", name, err))
+			continue
+		}
+		entry.Skew = uint(skew)
+		entry.Exportable = exportable
+		entries = append(entries, entry)
+	}
+	if len(errs) != 0 {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"no keys were imported: %s", strings.Join(errs, "; "))), nil
+	}
+
+	for i, name := range names {
+		entry, err := logical.StorageEntryJSON("key/"+name, entries[i])
+		if err != nil {
+			return nil, err
+		}
+		if err := req.Storage.Put(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"imported": names,
+		},
+	}, nil
+}
+
+// keyEntryFromURL returns the key described by an otpauth url, with the
+// default period, digits and algorithm of the keys endpoint if they are
+// missing from the url
+func keyEntryFromURL(inputURL string) (*keyEntry, error) {
+	params, err := parseKeyURL(inputURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Key == "" {
+		return nil, fmt.Errorf("the key value is required")
+	}
+	if _, err := base32.StdEncoding.DecodeString(params.Key); err != nil {
+		return nil, fmt.Errorf("invalid key value: %s", err)
+	}
+
+	if params.Period == 0 {
+		params.Period = 30
+	}
+	if params.Digits == 0 {
+		params.Digits = 6
+	}
+	if params.Algorithm == "" {
+		params.Algorithm = "SHA1"
+	}
+
+	digits, err := parseDigits(params.Digits)
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := parseAlgorithm(params.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &keyEntry{
+		Key:         params.Key,
+		Issuer:      params.Issuer,
+		AccountName: params.AccountName,
+		Period:      uint(params.Period),
+		Algorithm:   algorithm,
+		Digits:      digits,
+	}, nil
+}
+
+const pathImportHelpSyn = `
+Import keys from otpauth urls in bulk.
+`
+
+const pathImportHelpDesc = `
+This path imports keys from a map of key names to otpauth urls, such as those
+exported by other TOTP stores. Existing keys with the same names are
+replaced. If any url is invalid, no key is imported and the errors of all the
+invalid urls are returned.
+`
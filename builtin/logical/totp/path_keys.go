@@ -10,6 +10,8 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 	otplib "github.com/pquerna/otp"
@@ -101,10 +103,22 @@ func pathKeys(b *backend) *framework.Path {
 				Description: `The pixel size of the generated square QR code. Only used if generate is true and exported is true. If this value is 0, a QR code will not be returned.`,
 			},
 
+			"qr_error_correction": {
+				Type:        framework.TypeString,
+				Default:     "M",
+				Description: `The error correction level of the generated QR code. Options include L, M, Q and H, recovering 7%, 15%, 25% and 30% of the data respectively. Only used if generate is true and exported is true.`,
+			},
+
 			"url": {
 				Type:        framework.TypeString,
 				Description: `A TOTP url string containing all of the parameters for key setup. Only used if generate is false.`,
 			},
+
+			"exportable": {
+				Type:        framework.TypeBool,
+				Default:     false,
+				Description: `Determines if the url of the key can be read from the export endpoint.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -166,6 +180,7 @@ func (b *backend) pathKeyRead(
 			"period":       key.Period,
 			"algorithm":    algorithm,
 			"digits":       key.Digits,
+			"exportable":   key.Exportable,
 		},
 	}, nil
 }
@@ -195,6 +210,7 @@ func (b *backend) pathKeyCreate(
 	qrSize := data.Get("qr_size").(int)
 	keySize := data.Get("key_size").(int)
 	inputURL := data.Get("url").(string)
+	exportable := data.Get("exportable").(bool)
 
 	if generate {
 		if keyString != "" {
@@ -207,85 +223,41 @@ func (b *backend) pathKeyCreate(
 
 	// Read parameters from url if given
 	if inputURL != "" {
-		//Parse url
-		urlObject, err := url.Parse(inputURL)
+		params, err := parseKeyURL(inputURL)
 		if err != nil {
-			return logical.ErrorResponse("an error occured while parsing url string"), err
+			return logical.ErrorResponse(err.Error()), nil
 		}
 
-		//Set up query object
-		urlQuery := urlObject.Query()
-		path := strings.TrimPrefix(urlObject.Path, "/")
-		index := strings.Index(path, ":")
-
-		//Read issuer
-		urlIssuer := urlQuery.Get("issuer")
-		if urlIssuer != "" {
-			issuer = urlIssuer
-		} else {
-			if index != -1 {
-				issuer = path[:index]
-			}
+		if params.Issuer != "" {
+			issuer = params.Issuer
 		}
-
-		//Read account name
-		if index == -1 {
-			accountName = path
-		} else {
-			accountName = path[index+1:]
-		}
-
-		//Read key string
-		keyString = urlQuery.Get("secret")
-
-		//Read period
-		periodQuery := urlQuery.Get("period")
-		if periodQuery != "" {
-			periodInt, err := strconv.Atoi(periodQuery)
-			if err != nil {
-				return logical.ErrorResponse("an error occured while parsing period value in url"), err
-			}
-			period = periodInt
+		accountName = params.AccountName
+		keyString = params.Key
+		if params.Period != 0 {
+			period = params.Period
 		}
-
-		//Read digits
-		digitsQuery := urlQuery.Get("digits")
-		if digitsQuery != "" {
-			digitsInt, err := strconv.Atoi(digitsQuery)
-			if err != nil {
-				return logical.ErrorResponse("an error occured while parsing digits value in url"), err
-			}
-			digits = digitsInt
+		if params.Digits != 0 {
+			digits = params.Digits
 		}
-
-		//Read algorithm
-		algorithmQuery := urlQuery.Get("algorithm")
-		if algorithmQuery != "" {
-			algorithm = algorithmQuery
+		if params.Algorithm != "" {
+			algorithm = params.Algorithm
 		}
 	}
 
 	// Translate digits and algorithm to a format the totp library understands
-	var keyDigits otplib.Digits
-	switch digits {
-	case 6:
-		keyDigits = otplib.DigitsSix
-	case 8:
-		keyDigits = otplib.DigitsEight
-	default:
-		return logical.ErrorResponse("the digits value can only be 6 or 8"), nil
+	keyDigits, err := parseDigits(digits)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
 
-	var keyAlgorithm otplib.Algorithm
-	switch algorithm {
-	case "SHA1":
-		keyAlgorithm = otplib.AlgorithmSHA1
-	case "SHA256":
-		keyAlgorithm = otplib.AlgorithmSHA256
-	case "SHA512":
-		keyAlgorithm = otplib.AlgorithmSHA512
-	default:
-		return logical.ErrorResponse("the algorithm value is not valid"), nil
+	keyAlgorithm, err := parseAlgorithm(algorithm)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	qrLevel, err := parseErrorCorrection(data.Get("qr_error_correction").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
 
 	// Enforce input value requirements
@@ -356,14 +328,10 @@ func (b *backend) pathKeyCreate(
 					},
 				}
 			} else {
-				barcode, err := keyObject.Image(qrSize, qrSize)
+				b64Barcode, err := encodeBarcode(urlString, qrSize, qrLevel)
 				if err != nil {
 					return logical.ErrorResponse("an error occured while generating a QR code image"), err
 				}
-
-				var buff bytes.Buffer
-				png.Encode(&buff, barcode)
-				b64Barcode := base64.StdEncoding.EncodeToString(buff.Bytes())
 				response = &logical.Response{
 					Data: map[string]interface{}{
 						"url":     urlString,
@@ -377,8 +345,7 @@ func (b *backend) pathKeyCreate(
 			return logical.ErrorResponse("the key value is required"), nil
 		}
 
-		_, err := base32.StdEncoding.DecodeString(keyString)
-		if err != nil {
+		if _, err := base32.StdEncoding.DecodeString(keyString); err != nil {
 			return logical.ErrorResponse(fmt.Sprintf(
 				"invalid key value: %s", err)), nil
 		}
@@ -393,6 +360,7 @@ func (b *backend) pathKeyCreate(
 		Algorithm:   keyAlgorithm,
 		Digits:      keyDigits,
 		Skew:        uintSkew,
+		Exportable:  exportable,
 	})
 	if err != nil {
 		return nil, err
@@ -412,6 +380,149 @@ type keyEntry struct {
 	Algorithm   otplib.Algorithm `json:"algorithm" mapstructure:"algorithm" structs:"algorithm"`
 	Digits      otplib.Digits    `json:"digits" mapstructure:"digits" structs:"digits"`
 	Skew        uint             `json:"skew" mapstructure:"skew" structs:"skew"`
+	Exportable  bool             `json:"exportable" mapstructure:"exportable" structs:"exportable"`
+}
+
+// URL returns the otpauth url provisioning the key in authenticator apps
+func (k *keyEntry) URL() string {
+	label := k.AccountName
+	v := url.Values{}
+	v.Set("secret", k.Key)
+	if k.Issuer != "" {
+		label = k.Issuer + ":" + k.AccountName
+		v.Set("issuer", k.Issuer)
+	}
+	v.Set("period", strconv.FormatUint(uint64(k.Period), 10))
+	v.Set("algorithm", k.Algorithm.String())
+	v.Set("digits", k.Digits.String())
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + label,
+		RawQuery: v.Encode(),
+	}
+	return u.String()
+}
+
+// keyURLParams are the parameters of a key read from an otpauth url.
+// Parameters missing from the url are left to their zero value.
+type keyURLParams struct {
+	Key         string
+	Issuer      string
+	AccountName string
+	Period      int
+	Digits      int
+	Algorithm   string
+}
+
+func parseKeyURL(inputURL string) (*keyURLParams, error) {
+	urlObject, err := url.Parse(inputURL)
+	if err != nil {
+		return nil, fmt.Errorf("an error occured while parsing url string")
+	}
+	if urlObject.Scheme != "otpauth" || urlObject.Host != "totp" {
+		return nil, fmt.Errorf("the url must be an otpauth://totp/ url")
+	}
+
+	urlQuery := urlObject.Query()
+	path := strings.TrimPrefix(urlObject.Path, "/")
+	index := strings.Index(path, ":")
+
+	params := &keyURLParams{
+		Key:       urlQuery.Get("secret"),
+		Issuer:    urlQuery.Get("issuer"),
+		Algorithm: urlQuery.Get("algorithm"),
+	}
+
+	// The issuer of the query string takes precedence over the label
+	if index == -1 {
+		params.AccountName = path
+	} else {
+		if params.Issuer == "" {
+			params.Issuer = path[:index]
+		}
+		params.AccountName = path[index+1:]
+	}
+
+	if periodQuery := urlQuery.Get("period"); periodQuery != "" {
+		params.Period, err = strconv.Atoi(periodQuery)
+		if err != nil {
+			return nil, fmt.Errorf("an error occured while parsing period value in url")
+		}
+		if params.Period <= 0 {
+			return nil, fmt.Errorf("the period value must be greater than zero")
+		}
+	}
+
+	if digitsQuery := urlQuery.Get("digits"); digitsQuery != "" {
+		params.Digits, err = strconv.Atoi(digitsQuery)
+		if err != nil {
+			return nil, fmt.Errorf("an error occured while parsing digits value in url")
+		}
+		if params.Digits <= 0 {
+			return nil, fmt.Errorf("the digits value can only be 6 or 8")
+		}
+	}
+
+	return params, nil
+}
+
+func parseDigits(digits int) (otplib.Digits, error) {
+	switch digits {
+	case 6:
+		return otplib.DigitsSix, nil
+	case 8:
+		return otplib.DigitsEight, nil
+	default:
+		return 0, fmt.Errorf("the digits value can only be 6 or 8")
+	}
+}
+
+func parseAlgorithm(algorithm string) (otplib.Algorithm, error) {
+	switch algorithm {
+	case "SHA1":
+		return otplib.AlgorithmSHA1, nil
+	case "SHA256":
+		return otplib.AlgorithmSHA256, nil
+	case "SHA512":
+		return otplib.AlgorithmSHA512, nil
+	default:
+		return 0, fmt.Errorf("the algorithm value is not valid")
+	}
+}
+
+func parseErrorCorrection(level string) (qr.ErrorCorrectionLevel, error) {
+	switch level {
+	case "L":
+		return qr.L, nil
+	case "M":
+		return qr.M, nil
+	case "Q":
+		return qr.Q, nil
+	case "H":
+		return qr.H, nil
+	default:
+		return 0, fmt.Errorf("the qr_error_correction value can only be L, M, Q or H")
+	}
+}
+
+// encodeBarcode returns the base64 encoded PNG image of the QR code of a url
+func encodeBarcode(urlString string, size int, level qr.ErrorCorrectionLevel) (string, error) {
+	code, err := qr.Encode(urlString, level, qr.Auto)
+	if err != nil {
+		return "", err
+	}
+	code, err = barcode.Scale(code, size, size)
+	if err != nil {
+		return "", err
+	}
+
+	var buff bytes.Buffer
+	if err := png.Encode(&buff, code); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buff.Bytes()), nil
 }
 
 const pathKeyHelpSyn = `
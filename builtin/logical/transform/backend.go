@@ -0,0 +1,45 @@
+package transform
+
+import (
+	"strings"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend(conf).Setup(conf)
+}
+
+func Backend(conf *logical.BackendConfig) *backend {
+	var b backend
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		Paths: []*framework.Path{
+			pathListRoles(&b),
+			pathRoles(&b),
+			pathListTransformations(&b),
+			pathTransformations(&b),
+			pathListTemplates(&b),
+			pathTemplates(&b),
+			pathEncode(&b),
+			pathDecode(&b),
+			pathTokenMetadata(&b),
+		},
+
+		Secrets: []*framework.Secret{},
+	}
+
+	return &b
+}
+
+type backend struct {
+	*framework.Backend
+}
+
+const backendHelp = `
+The transform backend protects sensitive values such as credit card numbers
+while keeping them usable, either with format-preserving encryption (FF3-1)
+or by replacing them with tokens stored in Vault.
+`
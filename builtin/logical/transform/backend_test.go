@@ -0,0 +1,242 @@
+package transform
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func createBackendWithStorage(t *testing.T) (logical.Backend, logical.Storage) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Factory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView
+}
+
+func writeOK(t *testing.T, b logical.Backend, s logical.Storage, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      path,
+		Data:      data,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("path %s: err:%v resp:%#v", path, err, resp)
+	}
+	return resp
+}
+
+func writeError(t *testing.T, b logical.Backend, s logical.Storage, path string, data map[string]interface{}) {
+	resp, err := b.HandleRequest(&logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      path,
+		Data:      data,
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("path %s: expected error response, got err:%v resp:%#v", path, err, resp)
+	}
+}
+
+func TestTransform_FPE(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	writeOK(t, b, s, "transformations/ccn", map[string]interface{}{
+		"template":      "builtin/creditcardnumber",
+		"tweak_source":  "internal",
+		"allowed_roles": "payments",
+	})
+	writeOK(t, b, s, "transformations/ccn-generated", map[string]interface{}{
+		"template":      "builtin/creditcardnumber",
+		"tweak_source":  "generated",
+		"allowed_roles": "*",
+	})
+	writeOK(t, b, s, "roles/payments", map[string]interface{}{
+		"transformations": "ccn,ccn-generated",
+	})
+
+	value := "4111-1111-1111-1111"
+	resp := writeOK(t, b, s, "encode/payments", map[string]interface{}{
+		"value":          value,
+		"transformation": "ccn",
+	})
+	encoded := resp.Data["encoded_value"].(string)
+	if encoded == value || !regexp.MustCompile(`^\d{4}-\d{4}-\d{4}-\d{4}$`).MatchString(encoded) {
+		t.Fatalf("bad encoded value: %q", encoded)
+	}
+
+	// Encoding is deterministic for a given tweak
+	resp = writeOK(t, b, s, "encode/payments", map[string]interface{}{
+		"value":          value,
+		"transformation": "ccn",
+	})
+	if resp.Data["encoded_value"].(string) != encoded {
+		t.Fatalf("expected %q, got %q", encoded, resp.Data["encoded_value"])
+	}
+
+	resp = writeOK(t, b, s, "decode/payments", map[string]interface{}{
+		"value":          encoded,
+		"transformation": "ccn",
+	})
+	if resp.Data["decoded_value"].(string) != value {
+		t.Fatalf("bad decoded value: %#v", resp.Data)
+	}
+
+	// Generated tweaks are returned and needed to decode
+	resp = writeOK(t, b, s, "encode/payments", map[string]interface{}{
+		"value":          value,
+		"transformation": "ccn-generated",
+	})
+	tweak := resp.Data["tweak"].(string)
+	encoded = resp.Data["encoded_value"].(string)
+	writeError(t, b, s, "decode/payments", map[string]interface{}{
+		"value":          encoded,
+		"transformation": "ccn-generated",
+	})
+	resp = writeOK(t, b, s, "decode/payments", map[string]interface{}{
+		"value":          encoded,
+		"transformation": "ccn-generated",
+		"tweak":          tweak,
+	})
+	if resp.Data["decoded_value"].(string) != value {
+		t.Fatalf("bad decoded value: %#v", resp.Data)
+	}
+
+	// Values must match the template
+	writeError(t, b, s, "encode/payments", map[string]interface{}{
+		"value":          "4111-1111",
+		"transformation": "ccn",
+	})
+
+	// Roles must be allowed by the transformation
+	writeOK(t, b, s, "roles/other", map[string]interface{}{
+		"transformations": "ccn",
+	})
+	writeError(t, b, s, "encode/other", map[string]interface{}{
+		"value": value,
+	})
+
+	// Custom templates
+	writeOK(t, b, s, "templates/accounts", map[string]interface{}{
+		"pattern":  `ACCT-([a-z0-9]{8})`,
+		"alphabet": "builtin/alphanumericlower",
+	})
+	writeOK(t, b, s, "transformations/accounts", map[string]interface{}{
+		"template":      "accounts",
+		"tweak_source":  "internal",
+		"allowed_roles": "accounts",
+	})
+	writeOK(t, b, s, "roles/accounts", map[string]interface{}{
+		"transformations": "accounts",
+	})
+	resp = writeOK(t, b, s, "encode/accounts", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"value": "ACCT-abcd1234"},
+			map[string]interface{}{"value": "ACCT-ABCD1234"},
+		},
+	})
+	results := resp.Data["batch_results"].([]batchResponseEncodeItem)
+	if !regexp.MustCompile(`^ACCT-[a-z0-9]{8}$`).MatchString(results[0].EncodedValue) || results[0].Error != "" {
+		t.Fatalf("bad batch result: %#v", results[0])
+	}
+	if results[1].Error == "" {
+		t.Fatalf("expected error for value outside of the alphabet: %#v", results[1])
+	}
+}
+
+func TestTransform_Tokenization(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	writeOK(t, b, s, "transformations/ssn", map[string]interface{}{
+		"type":          "tokenization",
+		"allowed_roles": "hr",
+	})
+	writeOK(t, b, s, "transformations/ssn-convergent", map[string]interface{}{
+		"type":          "tokenization",
+		"convergent":    true,
+		"allowed_roles": "hr",
+	})
+	writeOK(t, b, s, "roles/hr", map[string]interface{}{
+		"transformations": "ssn,ssn-convergent",
+	})
+
+	value := "123-45-6789"
+	resp := writeOK(t, b, s, "encode/hr", map[string]interface{}{
+		"value":          value,
+		"transformation": "ssn",
+		"metadata": map[string]interface{}{
+			"employee": "42",
+		},
+	})
+	token := resp.Data["encoded_value"].(string)
+	if token == value {
+		t.Fatal("token matches value")
+	}
+
+	// Non-convergent tokens differ each time
+	resp = writeOK(t, b, s, "encode/hr", map[string]interface{}{
+		"value":          value,
+		"transformation": "ssn",
+	})
+	if resp.Data["encoded_value"].(string) == token {
+		t.Fatal("expected different tokens for non-convergent tokenization")
+	}
+
+	resp = writeOK(t, b, s, "decode/hr", map[string]interface{}{
+		"value":          token,
+		"transformation": "ssn",
+	})
+	if resp.Data["decoded_value"].(string) != value {
+		t.Fatalf("bad decoded value: %#v", resp.Data)
+	}
+
+	resp = writeOK(t, b, s, "tokenization/metadata/hr", map[string]interface{}{
+		"value":          token,
+		"transformation": "ssn",
+	})
+	if resp.Data["metadata"].(map[string]string)["employee"] != "42" {
+		t.Fatalf("bad metadata: %#v", resp.Data)
+	}
+
+	// Convergent tokens are stable
+	resp = writeOK(t, b, s, "encode/hr", map[string]interface{}{
+		"value":          value,
+		"transformation": "ssn-convergent",
+	})
+	token = resp.Data["encoded_value"].(string)
+	resp = writeOK(t, b, s, "encode/hr", map[string]interface{}{
+		"value":          value,
+		"transformation": "ssn-convergent",
+	})
+	if resp.Data["encoded_value"].(string) != token {
+		t.Fatal("expected the same token for convergent tokenization")
+	}
+
+	// Tokens are only valid for the transformation that issued them
+	writeError(t, b, s, "decode/hr", map[string]interface{}{
+		"value":          token,
+		"transformation": "ssn",
+	})
+
+	// Deleting the transformation removes its tokens
+	_, err := b.HandleRequest(&logical.Request{
+		Storage:   s,
+		Operation: logical.DeleteOperation,
+		Path:      "transformations/ssn",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := s.List(tokenStoragePrefix + "ssn/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 0 {
+		t.Fatalf("expected tokens to be removed, got %v", tokens)
+	}
+}
@@ -0,0 +1,184 @@
+package transform
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+const (
+	// ff3TweakSize is the size in bytes of an FF3-1 tweak
+	ff3TweakSize = 7
+
+	ff3MaxRadix = 1 << 16
+)
+
+// ff3Cipher implements the FF3-1 format-preserving encryption mode described
+// in NIST SP 800-38G Revision 1. Inputs and outputs are strings of numerals,
+// each in the range [0, radix).
+type ff3Cipher struct {
+	block  cipher.Block
+	radix  int
+	minLen int
+	maxLen int
+}
+
+func newFF3Cipher(key []byte, radix int) (*ff3Cipher, error) {
+	if radix < 2 || radix > ff3MaxRadix {
+		return nil, fmt.Errorf("radix must be between 2 and %d", ff3MaxRadix)
+	}
+
+	// The key is used with its bytes reversed
+	block, err := aes.NewCipher(reverseBytes(key))
+	if err != nil {
+		return nil, err
+	}
+
+	// The domain must hold at least a million values, and the halves of the
+	// input must fit in the 96 bits of the round function input
+	minLen := int(math.Ceil(math.Log(1000000) / math.Log(float64(radix))))
+	if minLen < 2 {
+		minLen = 2
+	}
+	maxLen := 2 * int(math.Floor(96/math.Log2(float64(radix))))
+
+	return &ff3Cipher{
+		block:  block,
+		radix:  radix,
+		minLen: minLen,
+		maxLen: maxLen,
+	}, nil
+}
+
+// Encrypt encrypts the numeral string x with the given 56-bit tweak
+func (c *ff3Cipher) Encrypt(tweak []byte, x []int) ([]int, error) {
+	tl, tr, err := splitFF3Tweak(tweak)
+	if err != nil {
+		return nil, err
+	}
+	return c.cipher(tl, tr, x, true)
+}
+
+// Decrypt reverses Encrypt
+func (c *ff3Cipher) Decrypt(tweak []byte, x []int) ([]int, error) {
+	tl, tr, err := splitFF3Tweak(tweak)
+	if err != nil {
+		return nil, err
+	}
+	return c.cipher(tl, tr, x, false)
+}
+
+// splitFF3Tweak derives the left and right 32-bit tweak halves from a 56-bit
+// FF3-1 tweak
+func splitFF3Tweak(tweak []byte) (tl, tr []byte, err error) {
+	if len(tweak) != ff3TweakSize {
+		return nil, nil, fmt.Errorf("tweak must be %d bytes", ff3TweakSize)
+	}
+	tl = []byte{tweak[0], tweak[1], tweak[2], tweak[3] & 0xF0}
+	tr = []byte{tweak[4], tweak[5], tweak[6], tweak[3] << 4}
+	return tl, tr, nil
+}
+
+// cipher runs the eight Feistel rounds shared by FF3 and FF3-1, which differ
+// only in how the tweak halves are formed
+func (c *ff3Cipher) cipher(tl, tr []byte, x []int, encrypt bool) ([]int, error) {
+	n := len(x)
+	if n < c.minLen || n > c.maxLen {
+		return nil, fmt.Errorf("input length must be between %d and %d", c.minLen, c.maxLen)
+	}
+	for _, numeral := range x {
+		if numeral < 0 || numeral >= c.radix {
+			return nil, errors.New("input contains a numeral outside of the radix")
+		}
+	}
+
+	u := (n + 1) / 2
+	v := n - u
+
+	a := make([]int, u)
+	copy(a, x[:u])
+	b := make([]int, v)
+	copy(b, x[u:])
+
+	radix := big.NewInt(int64(c.radix))
+	modU := new(big.Int).Exp(radix, big.NewInt(int64(u)), nil)
+	modV := new(big.Int).Exp(radix, big.NewInt(int64(v)), nil)
+
+	for j := 0; j < 8; j++ {
+		i := j
+		if !encrypt {
+			i = 7 - j
+		}
+
+		m, w, mod := u, tr, modU
+		if i%2 == 1 {
+			m, w, mod = v, tl, modV
+		}
+
+		if encrypt {
+			y := c.round(w, i, b)
+			num := c.numRev(a)
+			num.Add(num, y).Mod(num, mod)
+			a, b = b, c.strRev(m, num)
+		} else {
+			y := c.round(w, i, a)
+			num := c.numRev(b)
+			num.Sub(num, y).Mod(num, mod)
+			a, b = c.strRev(m, num), a
+		}
+	}
+
+	return append(a, b...), nil
+}
+
+// round computes the round function output for round i from the tweak half w
+// and the half of the input that is not being modified
+func (c *ff3Cipher) round(w []byte, i int, half []int) *big.Int {
+	p := make([]byte, aes.BlockSize)
+	copy(p, w)
+	p[3] ^= byte(i)
+
+	numBytes := c.numRev(half).Bytes()
+	copy(p[aes.BlockSize-len(numBytes):], numBytes)
+
+	p = reverseBytes(p)
+	c.block.Encrypt(p, p)
+	return new(big.Int).SetBytes(reverseBytes(p))
+}
+
+// numRev returns the number represented by the reverse of the numeral string
+// x, i.e. with the first numeral being the least significant
+func (c *ff3Cipher) numRev(x []int) *big.Int {
+	radix := big.NewInt(int64(c.radix))
+	ret := new(big.Int)
+	for i := len(x) - 1; i >= 0; i-- {
+		ret.Mul(ret, radix)
+		ret.Add(ret, big.NewInt(int64(x[i])))
+	}
+	return ret
+}
+
+// strRev reverses numRev, returning the m numerals representing num with the
+// least significant first
+func (c *ff3Cipher) strRev(m int, num *big.Int) []int {
+	radix := big.NewInt(int64(c.radix))
+	num = new(big.Int).Set(num)
+	rem := new(big.Int)
+	ret := make([]int, m)
+	for i := 0; i < m; i++ {
+		num.DivMod(num, radix, rem)
+		ret[i] = int(rem.Int64())
+	}
+	return ret
+}
+
+func reverseBytes(in []byte) []byte {
+	ret := make([]byte, len(in))
+	for i := range in {
+		ret[len(in)-1-i] = in[i]
+	}
+	return ret
+}
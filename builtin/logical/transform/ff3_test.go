@@ -0,0 +1,100 @@
+package transform
+
+import (
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func numerals(s, alphabet string) []int {
+	ret := make([]int, len(s))
+	for i, r := range s {
+		ret[i] = strings.IndexRune(alphabet, r)
+	}
+	return ret
+}
+
+func TestFF3_Vectors(t *testing.T) {
+	// Samples from NIST for FF3, which shares its rounds with FF3-1 and
+	// differs only in the size of the tweak
+	key, _ := hex.DecodeString("EF4359D8D580AA4F7F036D6F04FC6A94")
+	cases := []struct {
+		radix      int
+		tweak      string
+		plaintext  string
+		ciphertext string
+	}{
+		{10, "D8E7920AFA330A73", "890121234567890000", "750918814058654607"},
+		{10, "9A768A92F60E12D8", "890121234567890000", "018989839189395384"},
+		{10, "D8E7920AFA330A73", "89012123456789000000789000000", "48598367162252569629397416226"},
+		{26, "9A768A92F60E12D8", "0123456789abcdefghi", "g2pk40i992fn20cjakb"},
+	}
+
+	for _, c := range cases {
+		alphabet := "0123456789abcdefghijklmnopqrstuvwxyz"[:c.radix]
+		ff3, err := newFF3Cipher(key, c.radix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tweak, _ := hex.DecodeString(c.tweak)
+
+		ct, err := ff3.cipher(tweak[:4], tweak[4:], numerals(c.plaintext, alphabet), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := numerals(c.ciphertext, alphabet); !reflect.DeepEqual(ct, expected) {
+			t.Fatalf("bad ciphertext for %s: expected %v, got %v", c.plaintext, expected, ct)
+		}
+
+		pt, err := ff3.cipher(tweak[:4], tweak[4:], ct, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := numerals(c.plaintext, alphabet); !reflect.DeepEqual(pt, expected) {
+			t.Fatalf("bad plaintext: expected %v, got %v", expected, pt)
+		}
+	}
+}
+
+func TestFF3_1(t *testing.T) {
+	key, _ := hex.DecodeString("EF4359D8D580AA4F7F036D6F04FC6A94")
+	ff3, err := newFF3Cipher(key, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tweak, _ := hex.DecodeString("D8E7920AFA330A")
+	plaintext := numerals("4111111111111111", "0123456789")
+	ct, err := ff3.Encrypt(tweak, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(ct, plaintext) {
+		t.Fatal("ciphertext matches plaintext")
+	}
+	pt, err := ff3.Decrypt(tweak, ct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pt, plaintext) {
+		t.Fatalf("bad plaintext: expected %v, got %v", plaintext, pt)
+	}
+
+	// A different tweak gives a different ciphertext
+	tweak[6] ^= 0x01
+	other, err := ff3.Encrypt(tweak, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(other, ct) {
+		t.Fatal("ciphertexts match for different tweaks")
+	}
+
+	if _, err := ff3.Encrypt(tweak, numerals("12345", "0123456789")); err == nil {
+		t.Fatal("expected error for input shorter than the minimum length")
+	}
+	if _, err := ff3.Encrypt(tweak[:6], plaintext); err == nil {
+		t.Fatal("expected error for short tweak")
+	}
+}
@@ -0,0 +1,82 @@
+package transform
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/hashicorp/vault/helper/errutil"
+)
+
+// fpeTransform encrypts or decrypts the characters of value matched by the
+// capture groups of the template with FF3-1, preserving all other characters
+func fpeTransform(t *template, key, tweak []byte, value string, encrypt bool) (string, error) {
+	re, err := regexp.Compile("^(?:" + t.Pattern + ")$")
+	if err != nil {
+		return "", err
+	}
+	chars, err := t.alphabetChars()
+	if err != nil {
+		return "", err
+	}
+	alphabet := []rune(chars)
+	indexes := make(map[rune]int, len(alphabet))
+	for i, r := range alphabet {
+		indexes[r] = i
+	}
+
+	loc := re.FindStringSubmatchIndex(value)
+	if loc == nil {
+		return "", errutil.UserError{Err: "value does not match the transformation's template"}
+	}
+
+	// Collect the captured ranges, skipping groups that did not participate
+	// in the match and groups nested in earlier ones
+	var ranges [][2]int
+	end := 0
+	for i := 2; i < len(loc); i += 2 {
+		if loc[i] < 0 || loc[i] < end {
+			continue
+		}
+		ranges = append(ranges, [2]int{loc[i], loc[i+1]})
+		end = loc[i+1]
+	}
+
+	var x []int
+	for _, r := range ranges {
+		for _, c := range value[r[0]:r[1]] {
+			index, ok := indexes[c]
+			if !ok {
+				return "", errutil.UserError{Err: "value contains characters outside of the template's alphabet"}
+			}
+			x = append(x, index)
+		}
+	}
+
+	ff3, err := newFF3Cipher(key, len(alphabet))
+	if err != nil {
+		return "", err
+	}
+	var y []int
+	if encrypt {
+		y, err = ff3.Encrypt(tweak, x)
+	} else {
+		y, err = ff3.Decrypt(tweak, x)
+	}
+	if err != nil {
+		return "", errutil.UserError{Err: err.Error()}
+	}
+
+	var buf bytes.Buffer
+	prev := 0
+	for _, r := range ranges {
+		buf.WriteString(value[prev:r[0]])
+		for range value[r[0]:r[1]] {
+			buf.WriteRune(alphabet[y[0]])
+			y = y[1:]
+		}
+		prev = r[1]
+	}
+	buf.WriteString(value[prev:])
+
+	return buf.String(), nil
+}
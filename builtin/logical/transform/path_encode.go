@@ -0,0 +1,390 @@
+package transform
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"github.com/mitchellh/mapstructure"
+)
+
+// batchRequestItem represents a request item for batch processing
+type batchRequestItem struct {
+	// Value to encode or decode
+	Value string `json:"value" structs:"value" mapstructure:"value"`
+
+	// Transformation to use; may be omitted if the role has only one
+	Transformation string `json:"transformation" structs:"transformation" mapstructure:"transformation"`
+
+	// Base64-encoded tweak for FPE transformations
+	Tweak string `json:"tweak" structs:"tweak" mapstructure:"tweak"`
+
+	// Metadata stored with the value by tokenization transformations
+	Metadata map[string]string `json:"metadata" structs:"metadata" mapstructure:"metadata"`
+}
+
+// batchResponseEncodeItem represents a response item for batch encoding
+type batchResponseEncodeItem struct {
+	// EncodedValue is the encoded value or token
+	EncodedValue string `json:"encoded_value,omitempty" structs:"encoded_value" mapstructure:"encoded_value"`
+
+	// Tweak is the base64-encoded tweak generated for the value, if any
+	Tweak string `json:"tweak,omitempty" structs:"tweak" mapstructure:"tweak"`
+
+	// Error, if set represents a failure encountered while encoding a
+	// corresponding batch request item
+	Error string `json:"error,omitempty" structs:"error" mapstructure:"error"`
+}
+
+// batchResponseDecodeItem represents a response item for batch decoding
+type batchResponseDecodeItem struct {
+	// DecodedValue is the original value
+	DecodedValue string `json:"decoded_value,omitempty" structs:"decoded_value" mapstructure:"decoded_value"`
+
+	// Error, if set represents a failure encountered while decoding a
+	// corresponding batch request item
+	Error string `json:"error,omitempty" structs:"error" mapstructure:"error"`
+}
+
+func encodeDecodeFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"role_name": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Name of the role.",
+		},
+
+		"value": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The value to encode or decode.",
+		},
+
+		"transformation": &framework.FieldSchema{
+			Type: framework.TypeString,
+			Description: `Name of the transformation to use. May be omitted
+if the role has a single transformation.`,
+		},
+
+		"tweak": &framework.FieldSchema{
+			Type: framework.TypeString,
+			Description: `Base64-encoded 7-byte tweak for FPE
+transformations. Required with the "supplied" tweak
+source, and when decoding with the "generated" one.`,
+		},
+	}
+}
+
+func pathEncode(b *backend) *framework.Path {
+	fields := encodeDecodeFields()
+	fields["metadata"] = &framework.FieldSchema{
+		Type: framework.TypeMap,
+		Description: `String metadata to store with the value, for
+tokenization transformations.`,
+	}
+
+	return &framework.Path{
+		Pattern: "encode/" + framework.GenericNameRegex("role_name"),
+		Fields:  fields,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathEncodeWrite,
+		},
+
+		HelpSynopsis:    pathEncodeHelpSyn,
+		HelpDescription: pathEncodeHelpDesc,
+	}
+}
+
+func pathDecode(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "decode/" + framework.GenericNameRegex("role_name"),
+		Fields:  encodeDecodeFields(),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathDecodeWrite,
+		},
+
+		HelpSynopsis:    pathDecodeHelpSyn,
+		HelpDescription: pathDecodeHelpDesc,
+	}
+}
+
+// roleTransformation returns the named transformation, after checking that
+// it can be used with the role. If no name is given and the role has a single
+// transformation, that one is used.
+func (b *backend) roleTransformation(s logical.Storage, roleName, name string) (string, *transformation, error) {
+	role, err := b.Role(s, roleName)
+	if err != nil {
+		return "", nil, err
+	}
+	if role == nil {
+		return "", nil, errutil.UserError{Err: fmt.Sprintf("role %q not found", roleName)}
+	}
+
+	if name == "" {
+		if len(role.Transformations) != 1 {
+			return "", nil, errutil.UserError{Err: "transformation is required"}
+		}
+		name = role.Transformations[0]
+	}
+	if !strutil.StrListContains(role.Transformations, name) {
+		return "", nil, errutil.UserError{Err: fmt.Sprintf("transformation %q is not allowed for role %q", name, roleName)}
+	}
+
+	t, err := b.Transformation(s, name)
+	if err != nil {
+		return "", nil, err
+	}
+	if t == nil {
+		return "", nil, errutil.UserError{Err: fmt.Sprintf("transformation %q not found", name)}
+	}
+	if !t.roleAllowed(roleName) {
+		return "", nil, errutil.UserError{Err: fmt.Sprintf("role %q is not allowed to use transformation %q", roleName, name)}
+	}
+
+	return name, t, nil
+}
+
+// parseBatchInput returns the batch input of the request, or a single item
+// built from the top-level fields if there is none
+func parseBatchInput(d *framework.FieldData) ([]batchRequestItem, *logical.Response, error) {
+	if batchInputRaw := d.Raw["batch_input"]; batchInputRaw != nil {
+		var items []batchRequestItem
+		if err := mapstructure.Decode(batchInputRaw, &items); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse batch input: %v", err)
+		}
+		if len(items) == 0 {
+			return nil, logical.ErrorResponse("missing batch input to process"), logical.ErrInvalidRequest
+		}
+		return items, nil, nil
+	}
+
+	value, ok := d.GetOk("value")
+	if !ok {
+		return nil, logical.ErrorResponse("missing value"), logical.ErrInvalidRequest
+	}
+	item := batchRequestItem{
+		Value:          value.(string),
+		Transformation: d.Get("transformation").(string),
+		Tweak:          d.Get("tweak").(string),
+	}
+	if metadataRaw, ok := d.GetOk("metadata"); ok {
+		if err := mapstructure.Decode(metadataRaw, &item.Metadata); err != nil {
+			return nil, logical.ErrorResponse("metadata values must be strings"), logical.ErrInvalidRequest
+		}
+	}
+	return []batchRequestItem{item}, nil, nil
+}
+
+// fpeTweak returns the tweak to use for an FPE operation, and whether it was
+// generated for this operation
+func fpeTweak(t *transformation, tweakB64 string, encode bool) ([]byte, bool, error) {
+	switch {
+	case t.TweakSource == tweakSourceInternal:
+		if tweakB64 != "" {
+			return nil, false, errutil.UserError{Err: "tweak cannot be supplied for transformations with an internal tweak"}
+		}
+		return t.Tweak, false, nil
+
+	case t.TweakSource == tweakSourceGenerated && encode:
+		if tweakB64 != "" {
+			return nil, false, errutil.UserError{Err: "tweak cannot be supplied when encoding with a generated tweak"}
+		}
+		tweak, err := uuid.GenerateRandomBytes(ff3TweakSize)
+		if err != nil {
+			return nil, false, err
+		}
+		return tweak, true, nil
+	}
+
+	if tweakB64 == "" {
+		return nil, false, errutil.UserError{Err: "missing tweak"}
+	}
+	tweak, err := base64.StdEncoding.DecodeString(tweakB64)
+	if err != nil {
+		return nil, false, errutil.UserError{Err: "failed to base64-decode tweak"}
+	}
+	if len(tweak) != ff3TweakSize {
+		return nil, false, errutil.UserError{Err: fmt.Sprintf("tweak must be %d bytes", ff3TweakSize)}
+	}
+	return tweak, false, nil
+}
+
+// transformValue encodes or decodes a single value with the transformation.
+// The returned tweak is only set if one was generated.
+func (b *backend) transformValue(s logical.Storage, transformationName string, t *transformation, item batchRequestItem, encode bool) (string, string, error) {
+	switch t.Type {
+	case transformationTypeFPE:
+		tmpl, err := b.Template(s, t.Template)
+		if err != nil {
+			return "", "", err
+		}
+		if tmpl == nil {
+			return "", "", errutil.UserError{Err: fmt.Sprintf("template %q not found", t.Template)}
+		}
+
+		tweak, generated, err := fpeTweak(t, item.Tweak, encode)
+		if err != nil {
+			return "", "", err
+		}
+		result, err := fpeTransform(tmpl, t.Key, tweak, item.Value, encode)
+		if err != nil {
+			return "", "", err
+		}
+		if generated {
+			return result, base64.StdEncoding.EncodeToString(tweak), nil
+		}
+		return result, "", nil
+
+	case transformationTypeTokenization:
+		if item.Tweak != "" {
+			return "", "", errutil.UserError{Err: "tweak is not used by tokenization transformations"}
+		}
+		if encode {
+			token, err := b.tokenize(s, transformationName, t, item.Value, item.Metadata)
+			return token, "", err
+		}
+		value, err := b.detokenize(s, transformationName, t, item.Value)
+		return value, "", err
+	}
+
+	return "", "", errutil.InternalError{Err: fmt.Sprintf("unknown transformation type %q", t.Type)}
+}
+
+// transformBatch processes each item of the batch, returning the results and
+// the per-item errors
+func (b *backend) transformBatch(s logical.Storage, roleName string, items []batchRequestItem, encode bool) ([]string, []string, []error, error) {
+	results := make([]string, len(items))
+	tweaks := make([]string, len(items))
+	errs := make([]error, len(items))
+
+	for i, item := range items {
+		if item.Value == "" {
+			errs[i] = errutil.UserError{Err: "missing value"}
+			continue
+		}
+
+		name, t, err := b.roleTransformation(s, roleName, item.Transformation)
+		if err == nil {
+			results[i], tweaks[i], err = b.transformValue(s, name, t, item, encode)
+		}
+		if err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				errs[i] = err
+			default:
+				return nil, nil, nil, err
+			}
+		}
+	}
+
+	return results, tweaks, errs, nil
+}
+
+func (b *backend) pathEncodeWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	items, errResp, err := parseBatchInput(d)
+	if errResp != nil || err != nil {
+		return errResp, err
+	}
+
+	results, tweaks, errs, err := b.transformBatch(req.Storage, d.Get("role_name").(string), items, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.Raw["batch_input"] == nil {
+		if errs[0] != nil {
+			return logical.ErrorResponse(errs[0].Error()), logical.ErrInvalidRequest
+		}
+		resp := &logical.Response{
+			Data: map[string]interface{}{
+				"encoded_value": results[0],
+			},
+		}
+		if tweaks[0] != "" {
+			resp.Data["tweak"] = tweaks[0]
+		}
+		return resp, nil
+	}
+
+	batchResponseItems := make([]batchResponseEncodeItem, len(items))
+	for i := range items {
+		if errs[i] != nil {
+			batchResponseItems[i].Error = errs[i].Error()
+			continue
+		}
+		batchResponseItems[i].EncodedValue = results[i]
+		batchResponseItems[i].Tweak = tweaks[i]
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"batch_results": batchResponseItems,
+		},
+	}, nil
+}
+
+func (b *backend) pathDecodeWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	items, errResp, err := parseBatchInput(d)
+	if errResp != nil || err != nil {
+		return errResp, err
+	}
+
+	results, _, errs, err := b.transformBatch(req.Storage, d.Get("role_name").(string), items, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.Raw["batch_input"] == nil {
+		if errs[0] != nil {
+			return logical.ErrorResponse(errs[0].Error()), logical.ErrInvalidRequest
+		}
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"decoded_value": results[0],
+			},
+		}, nil
+	}
+
+	batchResponseItems := make([]batchResponseDecodeItem, len(items))
+	for i := range items {
+		if errs[i] != nil {
+			batchResponseItems[i].Error = errs[i].Error()
+			continue
+		}
+		batchResponseItems[i].DecodedValue = results[i]
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"batch_results": batchResponseItems,
+		},
+	}, nil
+}
+
+const pathEncodeHelpSyn = `
+Encode a value with a transformation.
+`
+
+const pathEncodeHelpDesc = `
+Encodes the value with one of the role's transformations. FPE transformations
+return a value with the same format as the input; tokenization
+transformations return a token and store the value. Multiple values can be
+encoded at once by supplying "batch_input", a list of objects with the same
+fields as a single request.
+`
+
+const pathDecodeHelpSyn = `
+Decode a value encoded with a transformation.
+`
+
+const pathDecodeHelpDesc = `
+Reverses "encode", returning the original value. Multiple values can be
+decoded at once by supplying "batch_input", a list of objects with the same
+fields as a single request.
+`
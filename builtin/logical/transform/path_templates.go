@@ -0,0 +1,230 @@
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const builtinPrefix = "builtin/"
+
+// builtinAlphabets are the alphabets that may be referenced by name
+var builtinAlphabets = map[string]string{
+	"builtin/numeric":           "0123456789",
+	"builtin/alphalower":        "abcdefghijklmnopqrstuvwxyz",
+	"builtin/alphaupper":        "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"builtin/alphanumericlower": "0123456789abcdefghijklmnopqrstuvwxyz",
+	"builtin/alphanumericupper": "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"builtin/alphanumeric":      "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+	"builtin/printableascii":    " !\"#$%&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_`abcdefghijklmnopqrstuvwxyz{|}~",
+}
+
+// builtinTemplates are the templates that may be referenced by name
+var builtinTemplates = map[string]*template{
+	"builtin/creditcardnumber": &template{
+		Pattern:  `(\d{4})[- ]?(\d{4})[- ]?(\d{4})[- ]?(\d{4})`,
+		Alphabet: "builtin/numeric",
+	},
+	"builtin/socialsecuritynumber": &template{
+		Pattern:  `(\d{3})[- ]?(\d{2})[- ]?(\d{4})`,
+		Alphabet: "builtin/numeric",
+	},
+}
+
+// template describes the values a format-preserving transformation can
+// operate on. The characters matched by the capture groups of the pattern are
+// encrypted, and must belong to the alphabet; all others are left untouched.
+type template struct {
+	Pattern  string `json:"pattern"`
+	Alphabet string `json:"alphabet"`
+}
+
+// alphabetChars returns the characters of the template's alphabet, resolving
+// builtin alphabet names
+func (t *template) alphabetChars() (string, error) {
+	if strings.HasPrefix(t.Alphabet, builtinPrefix) {
+		chars, ok := builtinAlphabets[t.Alphabet]
+		if !ok {
+			return "", fmt.Errorf("unknown builtin alphabet %q", t.Alphabet)
+		}
+		return chars, nil
+	}
+	return t.Alphabet, nil
+}
+
+// validate checks that the template can be used for encryption
+func (t *template) validate() error {
+	re, err := regexp.Compile(t.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %v", err)
+	}
+	if re.NumSubexp() == 0 {
+		return fmt.Errorf("pattern must contain at least one capture group")
+	}
+
+	chars, err := t.alphabetChars()
+	if err != nil {
+		return err
+	}
+	if utf8.RuneCountInString(chars) < 2 {
+		return fmt.Errorf("alphabet must contain at least two characters")
+	}
+	seen := map[rune]bool{}
+	for _, r := range chars {
+		if seen[r] {
+			return fmt.Errorf("alphabet contains duplicate character %q", r)
+		}
+		seen[r] = true
+	}
+	return nil
+}
+
+func pathListTemplates(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "templates/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathTemplateList,
+		},
+
+		HelpSynopsis:    pathTemplateHelpSyn,
+		HelpDescription: pathTemplateHelpDesc,
+	}
+}
+
+func pathTemplates(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "templates/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the template.",
+			},
+
+			"pattern": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Regular expression the input must fully match.
+The characters matched by its capture groups are
+transformed; all others are kept as they are.`,
+			},
+
+			"alphabet": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Characters the captured values are made of,
+either listed literally or as the name of a builtin
+alphabet such as "builtin/numeric".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathTemplateRead,
+			logical.UpdateOperation: b.pathTemplateWrite,
+			logical.DeleteOperation: b.pathTemplateDelete,
+		},
+
+		HelpSynopsis:    pathTemplateHelpSyn,
+		HelpDescription: pathTemplateHelpDesc,
+	}
+}
+
+// Template returns the named template, including builtin templates
+func (b *backend) Template(s logical.Storage, name string) (*template, error) {
+	if strings.HasPrefix(name, builtinPrefix) {
+		return builtinTemplates[name], nil
+	}
+
+	entry, err := s.Get("template/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result template
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (b *backend) pathTemplateList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("template/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathTemplateRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	t, err := b.Template(req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"pattern":  t.Pattern,
+			"alphabet": t.Alphabet,
+		},
+	}, nil
+}
+
+func (b *backend) pathTemplateWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	t := &template{
+		Pattern:  data.Get("pattern").(string),
+		Alphabet: data.Get("alphabet").(string),
+	}
+	if t.Pattern == "" {
+		return logical.ErrorResponse("pattern is required"), nil
+	}
+	if t.Alphabet == "" {
+		return logical.ErrorResponse("alphabet is required"), nil
+	}
+	if err := t.validate(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("template/"+name, t)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathTemplateDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete("template/" + data.Get("name").(string)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+const pathTemplateHelpSyn = `
+Manage the templates used by format-preserving transformations.
+`
+
+const pathTemplateHelpDesc = `
+A template is a regular expression and an alphabet. Values to be encoded must
+fully match the regular expression; the characters matched by its capture
+groups are encrypted over the alphabet, and all other characters, such as
+separators, are preserved.
+
+The "builtin/creditcardnumber" and "builtin/socialsecuritynumber" templates
+are always available to transformations without being created here.
+`
@@ -0,0 +1,294 @@
+package transform
+
+import (
+	"fmt"
+
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	transformationTypeFPE          = "fpe"
+	transformationTypeTokenization = "tokenization"
+
+	tweakSourceSupplied  = "supplied"
+	tweakSourceGenerated = "generated"
+	tweakSourceInternal  = "internal"
+)
+
+// transformation holds the configuration and key material of a named
+// transformation
+type transformation struct {
+	Type         string   `json:"type"`
+	Template     string   `json:"template"`
+	TweakSource  string   `json:"tweak_source"`
+	Convergent   bool     `json:"convergent"`
+	AllowedRoles []string `json:"allowed_roles"`
+
+	// Key is used for FF3-1 by FPE transformations, and to encrypt stored
+	// values by tokenization transformations
+	Key []byte `json:"key"`
+
+	// HMACKey is used to derive convergent tokens
+	HMACKey []byte `json:"hmac_key"`
+
+	// Tweak is the tweak used when the tweak source is internal
+	Tweak []byte `json:"tweak"`
+}
+
+// roleAllowed returns whether the role may use the transformation
+func (t *transformation) roleAllowed(role string) bool {
+	return strutil.StrListContains(t.AllowedRoles, "*") ||
+		strutil.StrListContains(t.AllowedRoles, role)
+}
+
+func pathListTransformations(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "transformations/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathTransformationList,
+		},
+
+		HelpSynopsis:    pathTransformationHelpSyn,
+		HelpDescription: pathTransformationHelpDesc,
+	}
+}
+
+func pathTransformations(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "transformations/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the transformation.",
+			},
+
+			"type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     transformationTypeFPE,
+				Description: `The type of transformation, "fpe" or "tokenization".`,
+			},
+
+			"template": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Name of the template describing the values to
+encode. Required for "fpe" transformations.`,
+			},
+
+			"tweak_source": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: tweakSourceSupplied,
+				Description: `Where the tweak for "fpe" transformations comes
+from: "supplied" by the caller, "generated" randomly
+on each encode and returned, or "internal" to the
+transformation.`,
+			},
+
+			"convergent": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Whether "tokenization" transformations return
+the same token each time a value is encoded.`,
+			},
+
+			"allowed_roles": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Roles allowed to use this transformation. "*"
+allows all roles.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathTransformationRead,
+			logical.UpdateOperation: b.pathTransformationWrite,
+			logical.DeleteOperation: b.pathTransformationDelete,
+		},
+
+		HelpSynopsis:    pathTransformationHelpSyn,
+		HelpDescription: pathTransformationHelpDesc,
+	}
+}
+
+func (b *backend) Transformation(s logical.Storage, name string) (*transformation, error) {
+	entry, err := s.Get("transformation/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result transformation
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (b *backend) pathTransformationList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("transformation/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathTransformationRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	t, err := b.Transformation(req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, nil
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"type":          t.Type,
+			"allowed_roles": t.AllowedRoles,
+		},
+	}
+	switch t.Type {
+	case transformationTypeFPE:
+		resp.Data["template"] = t.Template
+		resp.Data["tweak_source"] = t.TweakSource
+	case transformationTypeTokenization:
+		resp.Data["convergent"] = t.Convergent
+	}
+	return resp, nil
+}
+
+func (b *backend) pathTransformationWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	// Key material is generated once; the settings that determine how values
+	// are encoded cannot change afterwards, or existing values could no longer
+	// be decoded
+	t, err := b.Transformation(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if t != nil {
+		for _, field := range []string{"type", "template", "tweak_source", "convergent"} {
+			if _, ok := data.GetOk(field); ok {
+				return logical.ErrorResponse(fmt.Sprintf("%s cannot be changed on an existing transformation", field)), nil
+			}
+		}
+		if allowedRoles, ok := data.GetOk("allowed_roles"); ok {
+			t.AllowedRoles = allowedRoles.([]string)
+		}
+		return nil, b.putTransformation(req.Storage, name, t)
+	}
+
+	t = &transformation{
+		Type:         data.Get("type").(string),
+		AllowedRoles: data.Get("allowed_roles").([]string),
+	}
+
+	t.Key, err = uuid.GenerateRandomBytes(32)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.Type {
+	case transformationTypeFPE:
+		t.Template = data.Get("template").(string)
+		if t.Template == "" {
+			return logical.ErrorResponse("template is required for fpe transformations"), nil
+		}
+		tmpl, err := b.Template(req.Storage, t.Template)
+		if err != nil {
+			return nil, err
+		}
+		if tmpl == nil {
+			return logical.ErrorResponse(fmt.Sprintf("template %q not found", t.Template)), nil
+		}
+
+		t.TweakSource = data.Get("tweak_source").(string)
+		switch t.TweakSource {
+		case tweakSourceSupplied, tweakSourceGenerated:
+		case tweakSourceInternal:
+			t.Tweak, err = uuid.GenerateRandomBytes(ff3TweakSize)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return logical.ErrorResponse(fmt.Sprintf("unknown tweak_source %q", t.TweakSource)), nil
+		}
+
+	case transformationTypeTokenization:
+		if _, ok := data.GetOk("template"); ok {
+			return logical.ErrorResponse("template is not used by tokenization transformations"), nil
+		}
+		t.Convergent = data.Get("convergent").(bool)
+		if t.Convergent {
+			t.HMACKey, err = uuid.GenerateRandomBytes(32)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("unknown transformation type %q", t.Type)), nil
+	}
+
+	return nil, b.putTransformation(req.Storage, name, t)
+}
+
+func (b *backend) putTransformation(s logical.Storage, name string, t *transformation) error {
+	entry, err := logical.StorageEntryJSON("transformation/"+name, t)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+func (b *backend) pathTransformationDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	if err := req.Storage.Delete("transformation/" + name); err != nil {
+		return nil, err
+	}
+
+	// Tokens cannot be decoded without the transformation, so remove them
+	tokens, err := req.Storage.List(tokenStoragePrefix + name + "/")
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		if err := req.Storage.Delete(tokenStoragePrefix + name + "/" + token); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+const pathTransformationHelpSyn = `
+Manage the transformations used to encode and decode values.
+`
+
+const pathTransformationHelpDesc = `
+A transformation is either format-preserving encryption ("fpe") or
+tokenization ("tokenization").
+
+FPE transformations encrypt values with FF3-1, so that the encoded value
+matches the same template as the original; for instance an encoded credit
+card number is still a valid-looking credit card number. The tweak, which
+must be the same when encoding and decoding, is supplied by the caller,
+generated on encode and returned with the encoded value, or internal to the
+transformation.
+
+Tokenization transformations replace values with random tokens and store the
+encrypted values, along with optional metadata, in Vault. Convergent
+tokenization returns the same token each time a value is encoded.
+
+Key material is generated when a transformation is created, and only
+"allowed_roles" can be changed afterwards.
+`
@@ -0,0 +1,201 @@
+package transform
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const tokenStoragePrefix = "token/"
+
+// tokenEntry is the stored value behind a token. Tokens are stored under
+// their hash, so that listing storage does not reveal them.
+type tokenEntry struct {
+	Ciphertext []byte            `json:"ciphertext"`
+	Metadata   map[string]string `json:"metadata"`
+}
+
+func tokenStorageKey(transformationName, token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return tokenStoragePrefix + transformationName + "/" + hex.EncodeToString(sum[:])
+}
+
+func (b *backend) tokenEntry(s logical.Storage, transformationName, token string) (*tokenEntry, error) {
+	entry, err := s.Get(tokenStorageKey(transformationName, token))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result tokenEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// tokenize stores value and returns the token that can be used to retrieve
+// it. Convergent transformations return the existing token for a value that
+// has been tokenized before.
+func (b *backend) tokenize(s logical.Storage, transformationName string, t *transformation, value string, metadata map[string]string) (string, error) {
+	var token string
+	if t.Convergent {
+		mac := hmac.New(sha256.New, t.HMACKey)
+		mac.Write([]byte(value))
+		token = base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+		existing, err := b.tokenEntry(s, transformationName, token)
+		if err != nil {
+			return "", err
+		}
+		if existing != nil {
+			return token, nil
+		}
+	} else {
+		tokenBytes, err := uuid.GenerateRandomBytes(32)
+		if err != nil {
+			return "", err
+		}
+		token = base64.RawURLEncoding.EncodeToString(tokenBytes)
+	}
+
+	gcm, err := tokenGCM(t.Key)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := uuid.GenerateRandomBytes(gcm.NonceSize())
+	if err != nil {
+		return "", err
+	}
+
+	entry, err := logical.StorageEntryJSON(tokenStorageKey(transformationName, token), &tokenEntry{
+		Ciphertext: gcm.Seal(nonce, nonce, []byte(value), nil),
+		Metadata:   metadata,
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := s.Put(entry); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// detokenize returns the value stored for the token
+func (b *backend) detokenize(s logical.Storage, transformationName string, t *transformation, token string) (string, error) {
+	entry, err := b.tokenEntry(s, transformationName, token)
+	if err != nil {
+		return "", err
+	}
+	if entry == nil {
+		return "", errutil.UserError{Err: "token not found"}
+	}
+
+	gcm, err := tokenGCM(t.Key)
+	if err != nil {
+		return "", err
+	}
+	if len(entry.Ciphertext) < gcm.NonceSize() {
+		return "", errutil.InternalError{Err: "stored token value is invalid"}
+	}
+	nonce := entry.Ciphertext[:gcm.NonceSize()]
+	value, err := gcm.Open(nil, nonce, entry.Ciphertext[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errutil.InternalError{Err: "unable to decrypt stored token value"}
+	}
+
+	return string(value), nil
+}
+
+func tokenGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func pathTokenMetadata(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "tokenization/metadata/" + framework.GenericNameRegex("role_name"),
+		Fields: map[string]*framework.FieldSchema{
+			"role_name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+
+			"value": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The token to look up.",
+			},
+
+			"transformation": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Name of the tokenization transformation. May be
+omitted if the role has a single transformation.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathTokenMetadataRead,
+		},
+
+		HelpSynopsis:    pathTokenMetadataHelpSyn,
+		HelpDescription: pathTokenMetadataHelpDesc,
+	}
+}
+
+func (b *backend) pathTokenMetadataRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	transformationName, t, err := b.roleTransformation(req.Storage, data.Get("role_name").(string), data.Get("transformation").(string))
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+	if t.Type != transformationTypeTokenization {
+		return logical.ErrorResponse("metadata is only available for tokenization transformations"), logical.ErrInvalidRequest
+	}
+
+	token := data.Get("value").(string)
+	if token == "" {
+		return logical.ErrorResponse("missing value"), logical.ErrInvalidRequest
+	}
+
+	entry, err := b.tokenEntry(req.Storage, transformationName, token)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return logical.ErrorResponse("token not found"), logical.ErrInvalidRequest
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"metadata": entry.Metadata,
+		},
+	}, nil
+}
+
+const pathTokenMetadataHelpSyn = `
+Look up the metadata stored with a token.
+`
+
+const pathTokenMetadataHelpDesc = `
+Returns the metadata supplied when the value behind the token was encoded,
+without returning the value itself.
+`
@@ -1,8 +1,12 @@
 package transit
 
 import (
+	"fmt"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/helper/keysutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -15,6 +19,10 @@ func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
 		return nil, err
 	}
 
+	if err := b.loadCacheConfig(b.view); err != nil {
+		return nil, err
+	}
+
 	return be, nil
 }
 
@@ -26,10 +34,15 @@ func Backend(conf *logical.BackendConfig) *backend {
 			// as the handler is greedy
 			b.pathConfig(),
 			b.pathRotate(),
+			b.pathImport(),
+			b.pathImportVersion(),
 			b.pathRewrap(),
 			b.pathKeys(),
 			b.pathListKeys(),
 			b.pathExportKeys(),
+			b.pathBYOKExportKeys(),
+			b.pathWrappingKey(),
+			b.pathCacheConfig(),
 			b.pathEncrypt(),
 			b.pathDecrypt(),
 			b.pathDatakey(),
@@ -37,15 +50,21 @@ func Backend(conf *logical.BackendConfig) *backend {
 			b.pathHash(),
 			b.pathHMAC(),
 			b.pathSign(),
+			// Must come before verify, as it would otherwise treat "hmac" as
+			// the hash algorithm
+			b.pathVerifyHMAC(),
 			b.pathVerify(),
 		},
 
 		Secrets: []*framework.Secret{},
 
 		Invalidate: b.invalidate,
+
+		PeriodicFunc: b.periodicFunc,
 	}
 
 	b.lm = keysutil.NewLockManager(conf.System.CachingDisabled())
+	b.view = conf.StorageView
 
 	return &b
 }
@@ -53,6 +72,12 @@ func Backend(conf *logical.BackendConfig) *backend {
 type backend struct {
 	*framework.Backend
 	lm *keysutil.LockManager
+
+	// view is used to load the cache configuration
+	view logical.Storage
+
+	// wrappingKeyLock guards generation of the key import wrapping key
+	wrappingKeyLock sync.Mutex
 }
 
 func (b *backend) invalidate(key string) {
@@ -63,5 +88,62 @@ func (b *backend) invalidate(key string) {
 	case strings.HasPrefix(key, "policy/"):
 		name := strings.TrimPrefix(key, "policy/")
 		b.lm.InvalidatePolicy(name)
+	case key == cacheConfigPath:
+		if err := b.loadCacheConfig(b.view); err != nil {
+			b.Logger().Error("transit: error loading cache configuration", "error", err)
+		}
+	}
+}
+
+// periodicFunc rotates the keys whose automatic rotation period has elapsed
+func (b *backend) periodicFunc(req *logical.Request) error {
+	names, err := req.Storage.List("policy/")
+	if err != nil {
+		return err
+	}
+
+	var errs *multierror.Error
+	for _, name := range names {
+		if err := b.autoRotateKey(req.Storage, name); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("error rotating key %s: %v", name, err))
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (b *backend) autoRotateKey(storage logical.Storage, name string) error {
+	// Check with a shared lock first so that keys which do not need rotating
+	// are not blocked
+	p, sharedLock, err := b.lm.GetPolicyShared(storage, name)
+	if err != nil {
+		if sharedLock != nil {
+			sharedLock.RUnlock()
+		}
+		return err
+	}
+	needsRotation := p != nil && p.NeedsAutoRotation(time.Now())
+	if sharedLock != nil {
+		sharedLock.RUnlock()
+	}
+	if !needsRotation {
+		return nil
+	}
+
+	p, lock, err := b.lm.GetPolicyExclusive(storage, name)
+	if lock != nil {
+		defer lock.Unlock()
+	}
+	if err != nil {
+		return err
+	}
+	// The key may have been rotated or deleted while waiting for the lock
+	if p == nil || !p.NeedsAutoRotation(time.Now()) {
+		return nil
+	}
+
+	if b.Logger().IsDebug() {
+		b.Logger().Debug("transit: automatically rotating key", "key", name)
 	}
+	return p.Rotate(storage)
 }
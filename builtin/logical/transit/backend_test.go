@@ -701,6 +701,72 @@ func TestConvergentEncryption(t *testing.T) {
 	testConvergentEncryptionCommon(t, 2)
 }
 
+func TestConvergentEncryption_KeyTypes(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	for _, keyType := range []string{"ecdsa-p256", "ed25519"} {
+		resp, err := b.HandleRequest(&logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "keys/" + keyType,
+			Data: map[string]interface{}{
+				"type":                  keyType,
+				"derived":               true,
+				"convergent_encryption": true,
+			},
+		})
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected error response, got err:%v resp:%#v", keyType, err, resp)
+		}
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/aes",
+		Data: map[string]interface{}{
+			"derived":               true,
+			"convergent_encryption": true,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Storage:   storage,
+		Operation: logical.ReadOperation,
+		Path:      "keys/aes",
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if !resp.Data["supports_convergent_encryption"].(bool) || !resp.Data["convergent_encryption"].(bool) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The same plaintext and context must always produce the same ciphertext
+	var ciphertexts []string
+	for i := 0; i < 2; i++ {
+		resp, err = b.HandleRequest(&logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "encrypt/aes",
+			Data: map[string]interface{}{
+				"plaintext": "emlwIHphcA==",
+				"context":   "dGhpcyBpcyBhIGNvbnRleHQ=",
+			},
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		ciphertexts = append(ciphertexts, resp.Data["ciphertext"].(string))
+	}
+	if ciphertexts[0] != ciphertexts[1] {
+		t.Fatalf("bad: expected identical ciphertexts, got %v", ciphertexts)
+	}
+}
+
 func testConvergentEncryptionCommon(t *testing.T, ver int) {
 	var b *backend
 	sysView := logical.TestSystemView()
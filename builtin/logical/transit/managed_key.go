@@ -0,0 +1,35 @@
+package transit
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/hashicorp/vault/helper/managedkeys"
+	"github.com/hashicorp/vault/logical"
+)
+
+// getManagedKey looks up the named managed key, returning an error response
+// if it does not exist or is not allowed for this mount
+func (b *backend) getManagedKey(name string) (managedkeys.Key, *logical.Response) {
+	key, err := b.System().ManagedKey(name)
+	switch {
+	case err == managedkeys.ErrNotFound:
+		return nil, logical.ErrorResponse(fmt.Sprintf("managed key %q not found or not allowed for this mount", name))
+	case err != nil:
+		return nil, logical.ErrorResponse(fmt.Sprintf("error accessing managed key %q: %v", name, err))
+	}
+	return key, nil
+}
+
+// managedKeyPublicPEM returns the PEM-encoded public part of a managed key
+func managedKeyPublicPEM(key managedkeys.Key) (string, error) {
+	derBytes, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return "", fmt.Errorf("error marshaling managed public key: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: derBytes,
+	})), nil
+}
@@ -0,0 +1,131 @@
+package transit
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/managedkeys"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestTransit_ManagedKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	config.System = &logical.StaticSystemView{
+		ManagedKeys: map[string]managedkeys.Key{
+			"hsm-rsa": rsaKey,
+			"hsm-ec":  ecKey,
+		},
+	}
+	b := Backend(config)
+	if _, err := b.Backend.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	s := config.StorageView
+
+	doReq := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Storage:   s,
+			Operation: op,
+			Path:      path,
+			Data:      data,
+		})
+		if err != nil && err != logical.ErrInvalidRequest {
+			t.Fatalf("path %s: %v", path, err)
+		}
+		return resp
+	}
+
+	// The managed key must be named and available
+	resp := doReq(logical.UpdateOperation, "keys/bad", map[string]interface{}{
+		"type": "managed_key",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error without managed_key_name, got %#v", resp)
+	}
+	resp = doReq(logical.UpdateOperation, "keys/bad", map[string]interface{}{
+		"type":             "managed_key",
+		"managed_key_name": "missing",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for unknown managed key, got %#v", resp)
+	}
+
+	input := base64.StdEncoding.EncodeToString([]byte("the quick brown fox"))
+	for _, tc := range []struct {
+		managedKey   string
+		sigAlgorithm string
+	}{
+		{"hsm-rsa", "pss"},
+		{"hsm-rsa", "pkcs1v15"},
+		{"hsm-ec", ""},
+	} {
+		resp = doReq(logical.UpdateOperation, "keys/"+tc.managedKey, map[string]interface{}{
+			"type":             "managed_key",
+			"managed_key_name": tc.managedKey,
+		})
+		if resp != nil && resp.IsError() {
+			t.Fatalf("bad: %#v", resp)
+		}
+
+		resp = doReq(logical.ReadOperation, "keys/"+tc.managedKey, nil)
+		if resp.Data["managed_key_name"] != tc.managedKey || resp.Data["supports_signing"] != true {
+			t.Fatalf("bad: %#v", resp.Data)
+		}
+		if resp.Data["keys"].(map[string]asymKey)["1"].PublicKey == "" {
+			t.Fatalf("expected public key: %#v", resp.Data)
+		}
+
+		resp = doReq(logical.UpdateOperation, "sign/"+tc.managedKey, map[string]interface{}{
+			"input":               input,
+			"signature_algorithm": tc.sigAlgorithm,
+		})
+		if resp == nil || resp.IsError() {
+			t.Fatalf("bad: %#v", resp)
+		}
+		sig := resp.Data["signature"].(string)
+
+		resp = doReq(logical.UpdateOperation, "verify/"+tc.managedKey, map[string]interface{}{
+			"input":               input,
+			"signature":           sig,
+			"signature_algorithm": tc.sigAlgorithm,
+		})
+		if resp == nil || resp.Data["valid"] != true {
+			t.Fatalf("bad: %#v", resp)
+		}
+
+		resp = doReq(logical.UpdateOperation, "verify/"+tc.managedKey, map[string]interface{}{
+			"input":               base64.StdEncoding.EncodeToString([]byte("other")),
+			"signature":           sig,
+			"signature_algorithm": tc.sigAlgorithm,
+		})
+		if resp == nil || resp.Data["valid"] != false {
+			t.Fatalf("expected invalid signature, got %#v", resp)
+		}
+	}
+
+	// Managed keys cannot be rotated or used for encryption
+	resp = doReq(logical.UpdateOperation, "keys/hsm-rsa/rotate", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error rotating managed key, got %#v", resp)
+	}
+	resp = doReq(logical.UpdateOperation, "encrypt/hsm-rsa", map[string]interface{}{
+		"plaintext": input,
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error encrypting with managed key, got %#v", resp)
+	}
+}
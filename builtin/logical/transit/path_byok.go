@@ -0,0 +1,156 @@
+package transit
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/keysutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func (b *backend) pathBYOKExportKeys() *framework.Path {
+	return &framework.Path{
+		Pattern: "byok-export/" + framework.GenericNameRegex("destination") + "/" + framework.GenericNameRegex("source") + framework.OptionalParamRegex("version"),
+		Fields: map[string]*framework.FieldSchema{
+			"destination": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the RSA key to wrap the exported key with",
+			},
+
+			"source": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key to export",
+			},
+
+			"version": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Version of the key to export",
+			},
+
+			"hash": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "SHA256",
+				Description: `The hash function to use for RSA-OAEP when wrapping
+the ephemeral key. Defaults to "SHA256".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathBYOKExportRead,
+			logical.UpdateOperation: b.pathBYOKExportRead,
+		},
+
+		HelpSynopsis:    pathBYOKExportHelpSyn,
+		HelpDescription: pathBYOKExportHelpDesc,
+	}
+}
+
+func (b *backend) pathBYOKExportRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	dstName := d.Get("destination").(string)
+	srcName := d.Get("source").(string)
+	version := d.Get("version").(string)
+
+	hashFunction, err := parseWrappingHashFunction(d.Get("hash").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	dst, dstLock, err := b.lm.GetPolicyShared(req.Storage, dstName)
+	if dstLock != nil {
+		defer dstLock.RUnlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if dst == nil {
+		return logical.ErrorResponse(fmt.Sprintf("destination key %s not found", dstName)), logical.ErrInvalidRequest
+	}
+	if dst.Type != keysutil.KeyType_RSA2048 && dst.Type != keysutil.KeyType_RSA4096 {
+		return logical.ErrorResponse("destination key must be an RSA key"), logical.ErrInvalidRequest
+	}
+	wrappingKey := &dst.Keys[dst.LatestVersion].RSAKey.PublicKey
+
+	// Exporting a key wrapped for itself would need the same lock twice
+	if srcName == dstName {
+		return logical.ErrorResponse("source and destination keys must differ"), logical.ErrInvalidRequest
+	}
+	src, srcLock, err := b.lm.GetPolicyShared(req.Storage, srcName)
+	if srcLock != nil {
+		defer srcLock.RUnlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if src == nil {
+		return nil, nil
+	}
+	if !src.Exportable {
+		return logical.ErrorResponse("key is not exportable"), logical.ErrInvalidRequest
+	}
+
+	var versions []int
+	switch version {
+	case "":
+		for k := range src.Keys {
+			if k >= src.MinDecryptionVersion {
+				versions = append(versions, k)
+			}
+		}
+
+	default:
+		var versionValue int
+		if version == "latest" {
+			versionValue = src.LatestVersion
+		} else {
+			versionValue, err = strconv.Atoi(strings.TrimPrefix(version, "v"))
+			if err != nil {
+				return logical.ErrorResponse("invalid key version"), logical.ErrInvalidRequest
+			}
+		}
+		if versionValue < src.MinDecryptionVersion {
+			return logical.ErrorResponse("version for export is below minimum decryption version"), logical.ErrInvalidRequest
+		}
+		versions = append(versions, versionValue)
+	}
+
+	retKeys := map[string]string{}
+	for _, ver := range versions {
+		keyMaterial, err := src.KeyMaterial(ver)
+		if err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+			default:
+				return nil, err
+			}
+		}
+
+		wrapped, err := keysutil.WrapKeyMaterial(wrappingKey, hashFunction, keyMaterial)
+		if err != nil {
+			return nil, err
+		}
+		retKeys[strconv.Itoa(ver)] = base64.StdEncoding.EncodeToString(wrapped)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name": src.Name,
+			"type": src.Type.String(),
+			"keys": retKeys,
+		},
+	}, nil
+}
+
+const pathBYOKExportHelpSyn = `Export a key wrapped for another key management system`
+
+const pathBYOKExportHelpDesc = `
+This path is used to export an exportable key, wrapped with the latest version
+of the named destination RSA key, in the same format accepted by
+"keys/<name>/import". This allows keys to be moved to another Vault or key
+management system without exposing the key material in plaintext.
+`
@@ -0,0 +1,109 @@
+package transit
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/helper/keysutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const cacheConfigPath = "config/cache"
+
+type cacheConfig struct {
+	Size int `json:"size"`
+}
+
+func (b *backend) pathCacheConfig() *framework.Path {
+	return &framework.Path{
+		Pattern: "cache-config",
+		Fields: map[string]*framework.FieldSchema{
+			"size": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `Maximum number of keys to hold in memory. Zero
+means that the number of cached keys is unbounded;
+otherwise it must be at least 10.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathCacheConfigRead,
+			logical.UpdateOperation: b.pathCacheConfigWrite,
+		},
+
+		HelpSynopsis:    pathCacheConfigHelpSyn,
+		HelpDescription: pathCacheConfigHelpDesc,
+	}
+}
+
+func (b *backend) pathCacheConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if !b.lm.CacheActive() {
+		return logical.ErrorResponse("caching is disabled for this transit mount"), logical.ErrInvalidRequest
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"size": b.lm.CacheSize(),
+		},
+	}, nil
+}
+
+func (b *backend) pathCacheConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if !b.lm.CacheActive() {
+		return logical.ErrorResponse("caching is disabled for this transit mount"), logical.ErrInvalidRequest
+	}
+
+	size := d.Get("size").(int)
+	if size != 0 && size < keysutil.MinCacheSize {
+		return logical.ErrorResponse(fmt.Sprintf("size must be 0 or a value greater than or equal to %d", keysutil.MinCacheSize)), logical.ErrInvalidRequest
+	}
+
+	entry, err := logical.StorageEntryJSON(cacheConfigPath, &cacheConfig{
+		Size: size,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	if err := b.lm.SetCacheSize(size); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// loadCacheConfig applies the stored cache configuration, if any
+func (b *backend) loadCacheConfig(storage logical.Storage) error {
+	if storage == nil || !b.lm.CacheActive() {
+		return nil
+	}
+
+	entry, err := storage.Get(cacheConfigPath)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+
+	var config cacheConfig
+	if err := entry.DecodeJSON(&config); err != nil {
+		return err
+	}
+
+	return b.lm.SetCacheSize(config.Size)
+}
+
+const pathCacheConfigHelpSyn = `Configure the in-memory key cache`
+
+const pathCacheConfigHelpDesc = `
+Keys are cached in memory so that they do not need to be read and decoded
+from storage for every operation. By default the cache is unbounded; setting
+"size" limits it to that many keys, evicting the least recently used ones.
+This endpoint is unavailable if caching is disabled for the mount.
+`
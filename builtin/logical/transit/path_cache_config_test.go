@@ -0,0 +1,77 @@
+package transit
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestTransit_CacheConfig(t *testing.T) {
+	var resp *logical.Response
+	var err error
+
+	b, s := createBackendWithStorage(t)
+
+	readReq := &logical.Request{
+		Storage:   s,
+		Operation: logical.ReadOperation,
+		Path:      "cache-config",
+	}
+	resp, err = b.HandleRequest(readReq)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["size"].(int) != 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	writeReq := &logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      "cache-config",
+		Data: map[string]interface{}{
+			"size": 5,
+		},
+	}
+	resp, err = b.HandleRequest(writeReq)
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response, got err:%v resp:%#v", err, resp)
+	}
+
+	writeReq.Data["size"] = 10
+	resp, err = b.HandleRequest(writeReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	// Keys still work with more of them than fit in the cache
+	for i := 0; i < 20; i++ {
+		resp, err = b.HandleRequest(&logical.Request{
+			Storage:   s,
+			Operation: logical.CreateOperation,
+			Path:      fmt.Sprintf("encrypt/key%d", i),
+			Data: map[string]interface{}{
+				"plaintext": "dGhlIHF1aWNrIGJyb3duIGZveA==",
+			},
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+	}
+
+	// The configuration is applied to new backends sharing the storage
+	config := logical.TestBackendConfig()
+	config.StorageView = s
+	be, err := Factory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = be.HandleRequest(readReq)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["size"].(int) != 10 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
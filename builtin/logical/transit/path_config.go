@@ -2,7 +2,9 @@ package transit
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/hashicorp/vault/helper/keysutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -35,6 +37,21 @@ the latest version of the key is allowed.`,
 				Type:        framework.TypeBool,
 				Description: "Whether to allow deletion of the key",
 			},
+
+			"auto_rotate_period": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `The period after which the key is automatically
+rotated. Must be at least one hour, or zero to
+disable automatic rotation.`,
+			},
+
+			"max_decryption_versions": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `If set, min_decryption_version is advanced whenever
+the key is rotated, so that at most this many of the
+latest key versions can be used for decryption. Zero
+disables this behavior.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -126,6 +143,36 @@ func (b *backend) pathConfigWrite(
 		}
 	}
 
+	autoRotatePeriodRaw, ok := d.GetOk("auto_rotate_period")
+	if ok {
+		autoRotatePeriod := time.Duration(autoRotatePeriodRaw.(int)) * time.Second
+		if autoRotatePeriod != 0 && autoRotatePeriod < time.Hour {
+			return logical.ErrorResponse("auto rotate period must be zero or at least one hour"), nil
+		}
+		if autoRotatePeriod != 0 && p.Imported && !p.AllowImportedKeyRotation {
+			return logical.ErrorResponse("imported key does not allow rotation"), nil
+		}
+		if autoRotatePeriod != 0 && p.Type == keysutil.KeyType_MANAGED_KEY {
+			return logical.ErrorResponse("managed keys cannot be rotated by Vault"), nil
+		}
+		if autoRotatePeriod != p.AutoRotatePeriod {
+			p.AutoRotatePeriod = autoRotatePeriod
+			persistNeeded = true
+		}
+	}
+
+	maxDecryptionVersionsRaw, ok := d.GetOk("max_decryption_versions")
+	if ok {
+		maxDecryptionVersions := maxDecryptionVersionsRaw.(int)
+		if maxDecryptionVersions < 0 {
+			return logical.ErrorResponse("max decryption versions cannot be negative"), nil
+		}
+		if maxDecryptionVersions != p.MaxDecryptionVersions {
+			p.MaxDecryptionVersions = maxDecryptionVersions
+			persistNeeded = true
+		}
+	}
+
 	// Add this as a guard here before persisting since we now require the min
 	// decryption version to start at 1; even if it's not explicitly set here,
 	// force the upgrade
@@ -150,5 +197,6 @@ const pathConfigHelpSyn = `Configure a named encryption key`
 const pathConfigHelpDesc = `
 This path is used to configure the named key. Currently, this
 supports adjusting the minimum version of the key allowed to
-be used for decryption via the min_decryption_version paramter.
+be used for decryption via the min_decryption_version paramter,
+and automatic rotation of the key via auto_rotate_period.
 `
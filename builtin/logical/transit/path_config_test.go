@@ -4,6 +4,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/logical"
 )
@@ -221,3 +222,94 @@ func TestTransit_ConfigSettings(t *testing.T) {
 	testHMAC(3, true)
 	testHMAC(2, false)
 }
+
+func TestTransit_AutoRotate(t *testing.T) {
+	var resp *logical.Response
+	var err error
+
+	b, s := createBackendWithStorage(t)
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/foo",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	configReq := &logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/foo/config",
+		Data: map[string]interface{}{
+			"auto_rotate_period": "30m",
+		},
+	}
+	resp, err = b.HandleRequest(configReq)
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response, got err:%v resp:%#v", err, resp)
+	}
+
+	configReq.Data = map[string]interface{}{
+		"auto_rotate_period":      "24h",
+		"max_decryption_versions": 2,
+	}
+	resp, err = b.HandleRequest(configReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	readKey := func() map[string]interface{} {
+		resp, err := b.HandleRequest(&logical.Request{
+			Storage:   s,
+			Operation: logical.ReadOperation,
+			Path:      "keys/foo",
+		})
+		if err != nil || resp == nil {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		return resp.Data
+	}
+	if data := readKey(); data["auto_rotate_period"].(int64) != 86400 || data["max_decryption_versions"].(int) != 2 {
+		t.Fatalf("bad: %#v", data)
+	}
+
+	// A fresh key is not rotated
+	if err := b.periodicFunc(&logical.Request{Storage: s}); err != nil {
+		t.Fatal(err)
+	}
+	if data := readKey(); data["latest_version"].(int) != 1 {
+		t.Fatalf("bad: %#v", data)
+	}
+
+	// Backdate the latest version so that it is due for rotation
+	backdate := func() {
+		p, lock, err := b.lm.GetPolicyExclusive(s, "foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer lock.Unlock()
+		entry := p.Keys[p.LatestVersion]
+		entry.CreationTime = entry.CreationTime.Add(-25 * time.Hour)
+		p.Keys[p.LatestVersion] = entry
+		if err := p.Persist(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 2; i <= 3; i++ {
+		backdate()
+		if err := b.periodicFunc(&logical.Request{Storage: s}); err != nil {
+			t.Fatal(err)
+		}
+		if data := readKey(); data["latest_version"].(int) != i {
+			t.Fatalf("bad: expected latest version %d: %#v", i, data)
+		}
+	}
+
+	// Only the latest two versions remain decryptable
+	if data := readKey(); data["min_decryption_version"].(int) != 2 {
+		t.Fatalf("bad: %#v", data)
+	}
+}
@@ -0,0 +1,80 @@
+package transit
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestTransit_DatakeyVersion(t *testing.T) {
+	var resp *logical.Response
+	var err error
+
+	b, s := createBackendWithStorage(t)
+
+	req := &logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test",
+	}
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	req.Path = "keys/test/rotate"
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	datakeyReq := &logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      "datakey/plaintext/test",
+		Data: map[string]interface{}{
+			"key_version": 1,
+			"bits":        512,
+		},
+	}
+	resp, err = b.HandleRequest(datakeyReq)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	ciphertext := resp.Data["ciphertext"].(string)
+	if !strings.HasPrefix(ciphertext, "vault:v1:") {
+		t.Fatalf("expected data key encrypted with version 1, got %q", ciphertext)
+	}
+	plaintext := resp.Data["plaintext"].(string)
+	key, err := base64.StdEncoding.DecodeString(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != 64 {
+		t.Fatalf("bad key length: %d", len(key))
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      "decrypt/test",
+		Data: map[string]interface{}{
+			"ciphertext": ciphertext,
+		},
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["plaintext"].(string) != plaintext {
+		t.Fatalf("bad decrypted data key: %#v", resp.Data)
+	}
+
+	// Versions past the latest are rejected
+	datakeyReq.Path = "datakey/wrapped/test"
+	datakeyReq.Data["key_version"] = 3
+	resp, err = b.HandleRequest(datakeyReq)
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response, got err:%v resp:%#v", err, resp)
+	}
+}
@@ -94,14 +94,11 @@ When performing an upsert operation, the type of key to create. Currently,
 			"convergent_encryption": &framework.FieldSchema{
 				Type: framework.TypeBool,
 				Description: `
-This parameter will only be used when a key is expected to be created.  Whether
-to support convergent encryption. This is only supported when using a key with
-key derivation enabled and will require all requests to carry both a context
-and 96-bit (12-byte) nonce. The given nonce will be used in place of a randomly
-generated nonce. As a result, when the same context and nonce are supplied, the
-same ciphertext is generated. It is *very important* when using this mode that
-you ensure that all nonces are unique for a given context.  Failing to do so
-will severely impact the ciphertext's security.`,
+This parameter will only be used when a key is expected to be created. Whether
+to support convergent encryption, where encrypting the same plaintext with the
+same context always produces the same ciphertext. This is only supported when
+using a key with key derivation enabled and will require all requests to carry
+a context.`,
 			},
 
 			"key_version": &framework.FieldSchema{
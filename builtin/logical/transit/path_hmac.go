@@ -10,8 +10,11 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/keysutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
+	"github.com/mitchellh/mapstructure"
 )
 
 func (b *backend) pathHMAC() *framework.Path {
@@ -63,19 +66,127 @@ to the min_encryption_version configured on the key.`,
 	}
 }
 
+func (b *backend) pathVerifyHMAC() *framework.Path {
+	return &framework.Path{
+		Pattern: "verify/" + framework.GenericNameRegex("name") + "/hmac" + framework.OptionalParamRegex("urlalgorithm"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The key to use for the HMAC function",
+			},
+
+			"input": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The base64-encoded input data to verify",
+			},
+
+			"hmac": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The HMAC, including vault header/key version",
+			},
+
+			"algorithm": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "sha2-256",
+				Description: `Algorithm to use (POST body parameter). Valid values are:
+
+* sha2-224
+* sha2-256
+* sha2-384
+* sha2-512
+
+Defaults to "sha2-256".`,
+			},
+
+			"urlalgorithm": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Algorithm to use (POST URL parameter)`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathVerifyHMACWrite,
+		},
+
+		HelpSynopsis:    pathVerifyHMACHelpSyn,
+		HelpDescription: pathVerifyHMACHelpDesc,
+	}
+}
+
+// batchRequestHMACItem represents a request item for batch HMAC generation
+// and verification
+type batchRequestHMACItem struct {
+	// Input is the base64 encoded data to compute the HMAC of
+	Input string `json:"input" structs:"input" mapstructure:"input"`
+
+	// HMAC to verify against the input
+	HMAC string `json:"hmac" structs:"hmac" mapstructure:"hmac"`
+}
+
+// batchResponseHMACItem represents a response item for batch HMAC generation.
+// Batch verification responses use batchResponseVerifyItem.
+type batchResponseHMACItem struct {
+	// HMAC of the input present in the corresponding batch request item
+	HMAC string `json:"hmac,omitempty" structs:"hmac" mapstructure:"hmac"`
+
+	// Error, if set represents a failure encountered while processing a
+	// corresponding batch request item
+	Error string `json:"error,omitempty" structs:"error" mapstructure:"error"`
+}
+
+// hmacHashFunc returns the hash constructor for the given algorithm name, or
+// nil if the algorithm is not supported
+func hmacHashFunc(algorithm string) func() hash.Hash {
+	switch algorithm {
+	case "sha2-224":
+		return sha256.New224
+	case "sha2-256":
+		return sha256.New
+	case "sha2-384":
+		return sha512.New384
+	case "sha2-512":
+		return sha512.New
+	default:
+		return nil
+	}
+}
+
+// parseHMACBatchInput returns the items to process for an HMAC request,
+// either from "batch_input" or from the top-level parameters
+func parseHMACBatchInput(d *framework.FieldData, verificationHMAC string) ([]batchRequestHMACItem, *logical.Response, error) {
+	batchInputRaw := d.Raw["batch_input"]
+	if batchInputRaw == nil {
+		return []batchRequestHMACItem{
+			batchRequestHMACItem{
+				Input: d.Get("input").(string),
+				HMAC:  verificationHMAC,
+			},
+		}, nil, nil
+	}
+
+	var batchInputItems []batchRequestHMACItem
+	if err := mapstructure.Decode(batchInputRaw, &batchInputItems); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse batch input: %v", err)
+	}
+	if len(batchInputItems) == 0 {
+		return nil, logical.ErrorResponse("missing batch input to process"), logical.ErrInvalidRequest
+	}
+
+	return batchInputItems, nil, nil
+}
+
 func (b *backend) pathHMACWrite(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	name := d.Get("name").(string)
 	ver := d.Get("key_version").(int)
-	inputB64 := d.Get("input").(string)
 	algorithm := d.Get("urlalgorithm").(string)
 	if algorithm == "" {
 		algorithm = d.Get("algorithm").(string)
 	}
 
-	input, err := base64.StdEncoding.DecodeString(inputB64)
-	if err != nil {
-		return logical.ErrorResponse(fmt.Sprintf("unable to decode input as base64: %s", err)), logical.ErrInvalidRequest
+	batchInputItems, errResp, err := parseHMACBatchInput(d, "")
+	if err != nil || errResp != nil {
+		return errResp, err
 	}
 
 	// Get the policy
@@ -109,67 +220,117 @@ func (b *backend) pathHMACWrite(
 		return nil, fmt.Errorf("HMAC key value could not be computed")
 	}
 
-	var hf hash.Hash
-	switch algorithm {
-	case "sha2-224":
-		hf = hmac.New(sha256.New224, key)
-	case "sha2-256":
-		hf = hmac.New(sha256.New, key)
-	case "sha2-384":
-		hf = hmac.New(sha512.New384, key)
-	case "sha2-512":
-		hf = hmac.New(sha512.New, key)
-	default:
+	hashFunc := hmacHashFunc(algorithm)
+	if hashFunc == nil {
 		return logical.ErrorResponse(fmt.Sprintf("unsupported algorithm %s", algorithm)), nil
 	}
-	hf.Write(input)
-	retBytes := hf.Sum(nil)
 
-	retStr := base64.StdEncoding.EncodeToString(retBytes)
-	retStr = fmt.Sprintf("vault:v%s:%s", strconv.Itoa(ver), retStr)
+	batchResponseItems := make([]batchResponseHMACItem, len(batchInputItems))
+	for i, item := range batchInputItems {
+		input, err := base64.StdEncoding.DecodeString(item.Input)
+		if err != nil {
+			batchResponseItems[i].Error = fmt.Sprintf("unable to decode input as base64: %s", err)
+			continue
+		}
+
+		hf := hmac.New(hashFunc, key)
+		hf.Write(input)
+		retStr := base64.StdEncoding.EncodeToString(hf.Sum(nil))
+		batchResponseItems[i].HMAC = fmt.Sprintf("vault:v%s:%s", strconv.Itoa(ver), retStr)
+	}
+
+	if d.Raw["batch_input"] != nil {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"batch_results": batchResponseItems,
+			},
+		}, nil
+	}
+
+	if batchResponseItems[0].Error != "" {
+		return logical.ErrorResponse(batchResponseItems[0].Error), logical.ErrInvalidRequest
+	}
 
 	// Generate the response
 	resp := &logical.Response{
 		Data: map[string]interface{}{
-			"hmac": retStr,
+			"hmac": batchResponseItems[0].HMAC,
 		},
 	}
 	return resp, nil
 }
 
-func (b *backend) pathHMACVerify(
-	req *logical.Request, d *framework.FieldData, verificationHMAC string) (*logical.Response, error) {
-
-	name := d.Get("name").(string)
-	inputB64 := d.Get("input").(string)
-	algorithm := d.Get("urlalgorithm").(string)
-	if algorithm == "" {
-		algorithm = d.Get("algorithm").(string)
+func (b *backend) pathVerifyHMACWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	verificationHMAC := d.Get("hmac").(string)
+	if verificationHMAC == "" && d.Raw["batch_input"] == nil {
+		return logical.ErrorResponse("missing 'hmac' to verify"), logical.ErrInvalidRequest
 	}
 
+	return b.pathHMACVerify(req, d, verificationHMAC)
+}
+
+// verifyHMAC checks a single vault-formatted HMAC against the input. User
+// errors are returned as errutil.UserError.
+func verifyHMAC(p *keysutil.Policy, hashFunc func() hash.Hash, inputB64, verificationHMAC string) (bool, error) {
 	input, err := base64.StdEncoding.DecodeString(inputB64)
 	if err != nil {
-		return logical.ErrorResponse(fmt.Sprintf("unable to decode input as base64: %s", err)), logical.ErrInvalidRequest
+		return false, errutil.UserError{Err: fmt.Sprintf("unable to decode input as base64: %s", err)}
 	}
 
 	// Verify the prefix
 	if !strings.HasPrefix(verificationHMAC, "vault:v") {
-		return logical.ErrorResponse("invalid HMAC to verify: no prefix"), logical.ErrInvalidRequest
+		return false, errutil.UserError{Err: "invalid HMAC to verify: no prefix"}
 	}
 
 	splitVerificationHMAC := strings.SplitN(strings.TrimPrefix(verificationHMAC, "vault:v"), ":", 2)
 	if len(splitVerificationHMAC) != 2 {
-		return logical.ErrorResponse("invalid HMAC: wrong number of fields"), logical.ErrInvalidRequest
+		return false, errutil.UserError{Err: "invalid HMAC: wrong number of fields"}
 	}
 
 	ver, err := strconv.Atoi(splitVerificationHMAC[0])
 	if err != nil {
-		return logical.ErrorResponse("invalid HMAC: version number could not be decoded"), logical.ErrInvalidRequest
+		return false, errutil.UserError{Err: "invalid HMAC: version number could not be decoded"}
 	}
 
 	verBytes, err := base64.StdEncoding.DecodeString(splitVerificationHMAC[1])
 	if err != nil {
-		return logical.ErrorResponse(fmt.Sprintf("unable to decode verification HMAC as base64: %s", err)), logical.ErrInvalidRequest
+		return false, errutil.UserError{Err: fmt.Sprintf("unable to decode verification HMAC as base64: %s", err)}
+	}
+
+	if ver > p.LatestVersion {
+		return false, errutil.UserError{Err: "invalid HMAC: version is too new"}
+	}
+
+	if p.MinDecryptionVersion > 0 && ver < p.MinDecryptionVersion {
+		return false, errutil.UserError{Err: "cannot verify HMAC: version is too old (disallowed by policy)"}
+	}
+
+	key, err := p.HMACKey(ver)
+	if err != nil {
+		return false, errutil.UserError{Err: err.Error()}
+	}
+	if key == nil {
+		return false, fmt.Errorf("HMAC key value could not be computed")
+	}
+
+	hf := hmac.New(hashFunc, key)
+	hf.Write(input)
+	return hmac.Equal(hf.Sum(nil), verBytes), nil
+}
+
+func (b *backend) pathHMACVerify(
+	req *logical.Request, d *framework.FieldData, verificationHMAC string) (*logical.Response, error) {
+
+	name := d.Get("name").(string)
+	algorithm := d.Get("urlalgorithm").(string)
+	if algorithm == "" {
+		algorithm = d.Get("algorithm").(string)
+	}
+
+	batchInputItems, errResp, err := parseHMACBatchInput(d, verificationHMAC)
+	if err != nil || errResp != nil {
+		return errResp, err
 	}
 
 	// Get the policy
@@ -184,41 +345,46 @@ func (b *backend) pathHMACVerify(
 		return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
 	}
 
-	if ver > p.LatestVersion {
-		return logical.ErrorResponse("invalid HMAC: version is too new"), logical.ErrInvalidRequest
+	hashFunc := hmacHashFunc(algorithm)
+	if hashFunc == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unsupported algorithm %s", algorithm)), nil
 	}
 
-	if p.MinDecryptionVersion > 0 && ver < p.MinDecryptionVersion {
-		return logical.ErrorResponse("cannot verify HMAC: version is too old (disallowed by policy)"), logical.ErrInvalidRequest
+	batchResponseItems := make([]batchResponseVerifyItem, len(batchInputItems))
+	for i, item := range batchInputItems {
+		if item.HMAC == "" {
+			batchResponseItems[i].Error = "missing HMAC to verify"
+			continue
+		}
+
+		valid, err := verifyHMAC(p, hashFunc, item.Input, item.HMAC)
+		if err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				batchResponseItems[i].Error = err.Error()
+				continue
+			default:
+				return nil, err
+			}
+		}
+		batchResponseItems[i].Valid = valid
 	}
 
-	key, err := p.HMACKey(ver)
-	if err != nil {
-		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
-	}
-	if key == nil {
-		return nil, fmt.Errorf("HMAC key value could not be computed")
+	if d.Raw["batch_input"] != nil {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"batch_results": batchResponseItems,
+			},
+		}, nil
 	}
 
-	var hf hash.Hash
-	switch algorithm {
-	case "sha2-224":
-		hf = hmac.New(sha256.New224, key)
-	case "sha2-256":
-		hf = hmac.New(sha256.New, key)
-	case "sha2-384":
-		hf = hmac.New(sha512.New384, key)
-	case "sha2-512":
-		hf = hmac.New(sha512.New, key)
-	default:
-		return logical.ErrorResponse(fmt.Sprintf("unsupported algorithm %s", algorithm)), nil
+	if batchResponseItems[0].Error != "" {
+		return logical.ErrorResponse(batchResponseItems[0].Error), logical.ErrInvalidRequest
 	}
-	hf.Write(input)
-	retBytes := hf.Sum(nil)
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"valid": hmac.Equal(retBytes, verBytes),
+			"valid": batchResponseItems[0].Valid,
 		},
 	}, nil
 }
@@ -227,4 +393,14 @@ const pathHMACHelpSyn = `Generate an HMAC for input data using the named key`
 
 const pathHMACHelpDesc = `
 Generates an HMAC sum of the given algorithm and key against the given input data.
+Multiple inputs may be processed in a single request by providing a
+"batch_input" list of items, each with an "input".
+`
+
+const pathVerifyHMACHelpSyn = `Verify an HMAC for input data created using the named key`
+
+const pathVerifyHMACHelpDesc = `
+Verifies an HMAC of the input data using the named key and the given hash
+algorithm. Multiple HMACs may be verified in a single request by providing a
+"batch_input" list of items, each with an "input" and "hmac".
 `
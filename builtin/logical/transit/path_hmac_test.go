@@ -181,3 +181,80 @@ func TestTransit_HMAC(t *testing.T) {
 		t.Fatalf("expected invalid request error, got %v", err)
 	}
 }
+
+func TestTransit_HMACBatch(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	req := &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/foo",
+	}
+	_, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Path = "hmac/foo/sha2-512"
+	req.Data = map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"input": "dGhlIHF1aWNrIGJyb3duIGZveA=="},
+			map[string]interface{}{"input": "not base64"},
+		},
+	}
+	resp, err := b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	hmacResults := resp.Data["batch_results"].([]batchResponseHMACItem)
+	if len(hmacResults) != 2 || hmacResults[0].HMAC == "" || hmacResults[1].Error == "" {
+		t.Fatalf("bad: %#v", hmacResults)
+	}
+
+	// The dedicated verification endpoint takes the algorithm after "hmac"
+	req.Path = "verify/foo/hmac/sha2-512"
+	req.Data = map[string]interface{}{
+		"input": "dGhlIHF1aWNrIGJyb3duIGZveA==",
+		"hmac":  hmacResults[0].HMAC,
+	}
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if !resp.Data["valid"].(bool) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req.Data = map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{
+				"input": "dGhlIHF1aWNrIGJyb3duIGZveA==",
+				"hmac":  hmacResults[0].HMAC,
+			},
+			map[string]interface{}{
+				"input": "anVtcGVkIG92ZXIgdGhlIGxhenkgZG9n",
+				"hmac":  hmacResults[0].HMAC,
+			},
+			map[string]interface{}{
+				"input": "dGhlIHF1aWNrIGJyb3duIGZveA==",
+			},
+		},
+	}
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	verifyResults := resp.Data["batch_results"].([]batchResponseVerifyItem)
+	if len(verifyResults) != 3 || !verifyResults[0].Valid || verifyResults[1].Valid || verifyResults[2].Error == "" {
+		t.Fatalf("bad: %#v", verifyResults)
+	}
+
+	// Without batch input, an HMAC is required
+	req.Data = map[string]interface{}{
+		"input": "dGhlIHF1aWNrIGJyb3duIGZveA==",
+	}
+	resp, err = b.HandleRequest(req)
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response, got err:%v resp:%#v", err, resp)
+	}
+}
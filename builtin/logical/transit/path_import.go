@@ -0,0 +1,260 @@
+package transit
+
+import (
+	"crypto"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/keysutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func (b *backend) pathImport() *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/import",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"ciphertext": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The base64-encoded key material, wrapped with an
+ephemeral AES-256 key using AES key wrap with padding
+(RFC 5649), and prefixed with the ephemeral key wrapped
+with RSA-OAEP using the key from "wrapping_key".`,
+			},
+
+			"hash_function": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "SHA256",
+				Description: `The hash function used for RSA-OAEP when wrapping
+the ephemeral key. Valid values are "SHA1", "SHA224",
+"SHA256", "SHA384" and "SHA512". Defaults to "SHA256".`,
+			},
+
+			"type": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "aes256-gcm96",
+				Description: `The type of the imported key. Defaults to
+"aes256-gcm96".`,
+			},
+
+			"derived": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: `Enables key derivation mode.`,
+			},
+
+			"convergent_encryption": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Whether to support convergent encryption. Requires
+derivation to be enabled.`,
+			},
+
+			"exportable": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: `Enables keys to be exportable.`,
+			},
+
+			"allow_rotation": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Whether the key may be rotated, which creates a
+new key version generated by Vault. If false, new
+versions can only be added with "import_version".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathImportWrite,
+		},
+
+		HelpSynopsis:    pathImportHelpSyn,
+		HelpDescription: pathImportHelpDesc,
+	}
+}
+
+func (b *backend) pathImportVersion() *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/import_version",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"ciphertext": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The base64-encoded wrapped key material, in the same
+format as for "import".`,
+			},
+
+			"hash_function": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "SHA256",
+				Description: `The hash function used for RSA-OAEP when wrapping
+the ephemeral key. Defaults to "SHA256".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathImportVersionWrite,
+		},
+
+		HelpSynopsis:    pathImportVersionHelpSyn,
+		HelpDescription: pathImportVersionHelpDesc,
+	}
+}
+
+// parseWrappingHashFunction returns the hash for the given name, as used
+// with RSA-OAEP by key import and export
+func parseWrappingHashFunction(name string) (crypto.Hash, error) {
+	switch strings.ToUpper(name) {
+	case "SHA1":
+		return crypto.SHA1, nil
+	case "SHA224":
+		return crypto.SHA224, nil
+	case "SHA256":
+		return crypto.SHA256, nil
+	case "SHA384":
+		return crypto.SHA384, nil
+	case "SHA512":
+		return crypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("unsupported hash function %s", name)
+	}
+}
+
+// unwrapImportedKey decodes and unwraps the key material of an import request
+func (b *backend) unwrapImportedKey(req *logical.Request, d *framework.FieldData) ([]byte, *logical.Response, error) {
+	ciphertextB64 := d.Get("ciphertext").(string)
+	if ciphertextB64 == "" {
+		return nil, logical.ErrorResponse("missing ciphertext to import"), logical.ErrInvalidRequest
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextB64)
+	if err != nil {
+		return nil, logical.ErrorResponse("failed to base64-decode ciphertext"), logical.ErrInvalidRequest
+	}
+
+	hashFunction, err := parseWrappingHashFunction(d.Get("hash_function").(string))
+	if err != nil {
+		return nil, logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	wrappingKey, err := b.getWrappingKey(req.Storage)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyMaterial, err := keysutil.UnwrapKeyMaterial(wrappingKey, hashFunction, ciphertext)
+	if err != nil {
+		return nil, logical.ErrorResponse(fmt.Sprintf("failed to unwrap key material: %v", err)), logical.ErrInvalidRequest
+	}
+
+	return keyMaterial, nil, nil
+}
+
+func (b *backend) pathImportWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	derived := d.Get("derived").(bool)
+	convergent := d.Get("convergent_encryption").(bool)
+
+	polReq := keysutil.PolicyRequest{
+		Storage:                  req.Storage,
+		Name:                     name,
+		Derived:                  derived,
+		Convergent:               convergent,
+		Exportable:               d.Get("exportable").(bool),
+		AllowImportedKeyRotation: d.Get("allow_rotation").(bool),
+	}
+
+	var errResp *logical.Response
+	polReq.KeyType, errResp = parseKeyType(d.Get("type").(string), derived, convergent)
+	if errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+
+	keyMaterial, errResp, err := b.unwrapImportedKey(req, d)
+	if err != nil || errResp != nil {
+		return errResp, err
+	}
+	polReq.ImportKey = keyMaterial
+
+	p, lock, upserted, err := b.lm.GetPolicyUpsert(polReq)
+	if lock != nil {
+		defer lock.RUnlock()
+	}
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+	if p == nil {
+		return nil, fmt.Errorf("error importing key: returned policy was nil")
+	}
+	if !upserted {
+		return logical.ErrorResponse(fmt.Sprintf("key %s already exists; use import_version to add a new version", name)), logical.ErrInvalidRequest
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathImportVersionWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	keyMaterial, errResp, err := b.unwrapImportedKey(req, d)
+	if err != nil || errResp != nil {
+		return errResp, err
+	}
+
+	p, lock, err := b.lm.GetPolicyExclusive(req.Storage, name)
+	if lock != nil {
+		defer lock.Unlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("key not found"), logical.ErrInvalidRequest
+	}
+	if !p.Imported {
+		return logical.ErrorResponse("new versions can only be imported into keys that were imported"), logical.ErrInvalidRequest
+	}
+
+	err = p.Import(req.Storage, keyMaterial)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+const pathImportHelpSyn = `Import an externally generated key`
+
+const pathImportHelpDesc = `
+This path is used to create a named key from externally generated key
+material. The key material must be wrapped for the public key returned by
+"wrapping_key", so that it is never sent to Vault in plaintext. Symmetric keys
+are imported as raw bytes and asymmetric keys as PKCS#8 private keys.
+`
+
+const pathImportVersionHelpSyn = `Import a new version of an imported key`
+
+const pathImportVersionHelpDesc = `
+This path is used to add externally generated key material as the latest
+version of a key that was created with "import". The key material is wrapped
+in the same way as for "import".
+`
@@ -0,0 +1,186 @@
+package transit
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/keysutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestTransit_ImportExport(t *testing.T) {
+	var resp *logical.Response
+	var err error
+
+	b, s := createBackendWithStorage(t)
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Storage:   s,
+		Operation: logical.ReadOperation,
+		Path:      "wrapping_key",
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	block, _ := pem.Decode([]byte(resp.Data["public_key"].(string)))
+	if block == nil {
+		t.Fatalf("bad public key: %#v", resp.Data)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrappingKey := parsed.(*rsa.PublicKey)
+
+	aesKey, err := uuid.GenerateRandomBytes(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := keysutil.WrapKeyMaterial(wrappingKey, crypto.SHA256, aesKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	importReq := &logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/imported/import",
+		Data: map[string]interface{}{
+			"ciphertext": base64.StdEncoding.EncodeToString(wrapped),
+			"exportable": true,
+		},
+	}
+	resp, err = b.HandleRequest(importReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	// Importing over an existing key is not allowed
+	resp, err = b.HandleRequest(importReq)
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response, got err:%v resp:%#v", err, resp)
+	}
+
+	// Neither is importing with the wrong hash function
+	importReq.Path = "keys/imported2/import"
+	importReq.Data["hash_function"] = "SHA1"
+	resp, err = b.HandleRequest(importReq)
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response, got err:%v resp:%#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Storage:   s,
+		Operation: logical.ReadOperation,
+		Path:      "keys/imported",
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if !resp.Data["imported_key"].(bool) || resp.Data["allow_imported_key_rotation"].(bool) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Imported keys cannot be rotated unless allowed, but new versions can
+	// be imported
+	resp, err = b.HandleRequest(&logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/imported/rotate",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response, got err:%v resp:%#v", err, resp)
+	}
+	resp, err = b.HandleRequest(&logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/imported/import_version",
+		Data: map[string]interface{}{
+			"ciphertext": base64.StdEncoding.EncodeToString(wrapped),
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	// Export the key wrapped for an exportable RSA key, so that the test can
+	// unwrap it again
+	resp, err = b.HandleRequest(&logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/destination",
+		Data: map[string]interface{}{
+			"type":       "rsa-2048",
+			"exportable": true,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	resp, err = b.HandleRequest(&logical.Request{
+		Storage:   s,
+		Operation: logical.ReadOperation,
+		Path:      "export/signing-key/destination/1",
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	block, _ = pem.Decode([]byte(resp.Data["keys"].(map[string]string)["1"]))
+	if block == nil {
+		t.Fatalf("bad exported key: %#v", resp.Data)
+	}
+	destinationKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Storage:   s,
+		Operation: logical.ReadOperation,
+		Path:      "byok-export/destination/imported",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	keys := resp.Data["keys"].(map[string]string)
+	if len(keys) != 2 {
+		t.Fatalf("bad: expected 2 key versions, got %#v", keys)
+	}
+	for ver, wrappedB64 := range keys {
+		wrapped, err := base64.StdEncoding.DecodeString(wrappedB64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exported, err := keysutil.UnwrapKeyMaterial(destinationKey, crypto.SHA256, wrapped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(exported, aesKey) {
+			t.Fatalf("bad exported key material for version %s", ver)
+		}
+	}
+
+	// Keys that are not exportable cannot be exported wrapped either
+	resp, err = b.HandleRequest(&logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/private",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	resp, err = b.HandleRequest(&logical.Request{
+		Storage:   s,
+		Operation: logical.ReadOperation,
+		Path:      "byok-export/destination/private",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response, got err:%v resp:%#v", err, resp)
+	}
+}
@@ -40,8 +40,17 @@ func (b *backend) pathKeys() *framework.Path {
 				Type:    framework.TypeString,
 				Default: "aes256-gcm96",
 				Description: `The type of key to create. Currently,
-"aes256-gcm96" (symmetric) and "ecdsa-p256" (asymmetric), and
-'ed25519' (asymmetric) are supported. Defaults to "aes256-gcm96".`,
+"aes256-gcm96" (symmetric), "ecdsa-p256" (asymmetric),
+'ed25519' (asymmetric), "rsa-2048" (asymmetric), "rsa-4096"
+(asymmetric) and "managed_key" (asymmetric, held outside
+of Vault) are supported. Defaults to "aes256-gcm96".`,
+			},
+
+			"managed_key_name": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The name of the managed key to use for
+keys of type "managed_key". The managed key must be
+registered with Vault and allowed for this mount.`,
 			},
 
 			"derived": &framework.FieldSchema{
@@ -53,18 +62,15 @@ keys for encryption operations.`,
 
 			"convergent_encryption": &framework.FieldSchema{
 				Type: framework.TypeBool,
-				Description: `Whether to support convergent encryption.
-This is only supported when using a key with
-key derivation enabled and will require all
-requests to carry both a context and 96-bit
-(12-byte) nonce. The given nonce will be used
-in place of a randomly generated nonce. As a
-result, when the same context and nonce are
-supplied, the same ciphertext is generated. It
-is *very important* when using this mode that
-you ensure that all nonces are unique for a
-given context. Failing to do so will severely
-impact the ciphertext's security.`,
+				Description: `Whether to support convergent encryption,
+where encrypting the same plaintext with the same
+context always produces the same ciphertext, so
+that ciphertexts can be compared or used as lookup
+keys. This is only supported for "aes256-gcm96"
+keys with key derivation enabled, and requires all
+requests to carry a context. Because identical
+plaintexts can be recognized, it should only be
+used when this is acceptable for the data.`,
 			},
 
 			"exportable": &framework.FieldSchema{
@@ -111,27 +117,36 @@ func (b *backend) pathPolicyWrite(
 	convergent := d.Get("convergent_encryption").(bool)
 	keyType := d.Get("type").(string)
 	exportable := d.Get("exportable").(bool)
+	managedKeyName := d.Get("managed_key_name").(string)
 
-	if !derived && convergent {
-		return logical.ErrorResponse("convergent encryption requires derivation to be enabled"), nil
+	polReq := keysutil.PolicyRequest{
+		Storage:        req.Storage,
+		Name:           name,
+		Derived:        derived,
+		Convergent:     convergent,
+		Exportable:     exportable,
+		ManagedKeyName: managedKeyName,
 	}
 
-	polReq := keysutil.PolicyRequest{
-		Storage:    req.Storage,
-		Name:       name,
-		Derived:    derived,
-		Convergent: convergent,
-		Exportable: exportable,
+	var errResp *logical.Response
+	polReq.KeyType, errResp = parseKeyType(keyType, derived, convergent)
+	if errResp != nil {
+		return errResp, nil
 	}
-	switch keyType {
-	case "aes256-gcm96":
-		polReq.KeyType = keysutil.KeyType_AES256_GCM96
-	case "ecdsa-p256":
-		polReq.KeyType = keysutil.KeyType_ECDSA_P256
-	case "ed25519":
-		polReq.KeyType = keysutil.KeyType_ED25519
-	default:
-		return logical.ErrorResponse(fmt.Sprintf("unknown key type %v", keyType)), logical.ErrInvalidRequest
+
+	switch {
+	case polReq.KeyType == keysutil.KeyType_MANAGED_KEY:
+		if managedKeyName == "" {
+			return logical.ErrorResponse("managed_key_name is required for keys of type managed_key"), nil
+		}
+		if exportable {
+			return logical.ErrorResponse("managed keys cannot be exportable"), nil
+		}
+		if _, errResp := b.getManagedKey(managedKeyName); errResp != nil {
+			return errResp, nil
+		}
+	case managedKeyName != "":
+		return logical.ErrorResponse("managed_key_name can only be set for keys of type managed_key"), nil
 	}
 
 	p, lock, upserted, err := b.lm.GetPolicyUpsert(polReq)
@@ -178,21 +193,33 @@ func (b *backend) pathPolicyRead(
 	// Return the response
 	resp := &logical.Response{
 		Data: map[string]interface{}{
-			"name":                   p.Name,
-			"type":                   p.Type.String(),
-			"derived":                p.Derived,
-			"deletion_allowed":       p.DeletionAllowed,
-			"min_decryption_version": p.MinDecryptionVersion,
-			"min_encryption_version": p.MinEncryptionVersion,
-			"latest_version":         p.LatestVersion,
-			"exportable":             p.Exportable,
-			"supports_encryption":    p.Type.EncryptionSupported(),
-			"supports_decryption":    p.Type.DecryptionSupported(),
-			"supports_signing":       p.Type.SigningSupported(),
-			"supports_derivation":    p.Type.DerivationSupported(),
+			"name":                           p.Name,
+			"type":                           p.Type.String(),
+			"derived":                        p.Derived,
+			"deletion_allowed":               p.DeletionAllowed,
+			"min_decryption_version":         p.MinDecryptionVersion,
+			"min_encryption_version":         p.MinEncryptionVersion,
+			"latest_version":                 p.LatestVersion,
+			"exportable":                     p.Exportable,
+			"supports_encryption":            p.Type.EncryptionSupported(),
+			"supports_decryption":            p.Type.DecryptionSupported(),
+			"supports_signing":               p.Type.SigningSupported(),
+			"supports_derivation":            p.Type.DerivationSupported(),
+			"supports_convergent_encryption": p.Type.ConvergentEncryptionSupported(),
+			"imported_key":                   p.Imported,
+			"auto_rotate_period":             int64(p.AutoRotatePeriod.Seconds()),
+			"max_decryption_versions":        p.MaxDecryptionVersions,
 		},
 	}
 
+	if p.Imported {
+		resp.Data["allow_imported_key_rotation"] = p.AllowImportedKeyRotation
+	}
+
+	if p.Type == keysutil.KeyType_MANAGED_KEY {
+		resp.Data["managed_key_name"] = p.ManagedKeyName
+	}
+
 	if p.Derived {
 		switch p.KDF {
 		case keysutil.Kdf_hmac_sha256_counter:
@@ -224,7 +251,7 @@ func (b *backend) pathPolicyRead(
 		}
 		resp.Data["keys"] = retKeys
 
-	case keysutil.KeyType_ECDSA_P256, keysutil.KeyType_ED25519:
+	case keysutil.KeyType_ECDSA_P256, keysutil.KeyType_ED25519, keysutil.KeyType_RSA2048, keysutil.KeyType_RSA4096:
 		retKeys := map[string]asymKey{}
 		for k, v := range p.Keys {
 			key := asymKey{
@@ -252,11 +279,33 @@ func (b *backend) pathPolicyRead(
 					}
 				}
 				key.Name = "ed25519"
+			case keysutil.KeyType_RSA2048, keysutil.KeyType_RSA4096:
+				key.Name = "rsa"
 			}
 
 			retKeys[strconv.Itoa(k)] = key
 		}
 		resp.Data["keys"] = retKeys
+
+	case keysutil.KeyType_MANAGED_KEY:
+		// The public key is only returned while the managed key is
+		// available to this mount
+		var publicKey string
+		if key, errResp := b.getManagedKey(p.ManagedKeyName); errResp == nil {
+			publicKey, err = managedKeyPublicPEM(key)
+			if err != nil {
+				return nil, err
+			}
+		}
+		retKeys := map[string]asymKey{}
+		for k, v := range p.Keys {
+			retKeys[strconv.Itoa(k)] = asymKey{
+				Name:         "managed_key",
+				PublicKey:    publicKey,
+				CreationTime: v.CreationTime,
+			}
+		}
+		resp.Data["keys"] = retKeys
 	}
 
 	return resp, nil
@@ -275,6 +324,42 @@ func (b *backend) pathPolicyDelete(
 	return nil, nil
 }
 
+// parseKeyType returns the key type with the given name, or an error response
+// if it is unknown or does not support the requested derivation options
+func parseKeyType(keyType string, derived, convergent bool) (keysutil.KeyType, *logical.Response) {
+	var kt keysutil.KeyType
+	switch keyType {
+	case "aes256-gcm96":
+		kt = keysutil.KeyType_AES256_GCM96
+	case "ecdsa-p256":
+		kt = keysutil.KeyType_ECDSA_P256
+	case "ed25519":
+		kt = keysutil.KeyType_ED25519
+	case "rsa-2048":
+		kt = keysutil.KeyType_RSA2048
+	case "rsa-4096":
+		kt = keysutil.KeyType_RSA4096
+	case "managed_key":
+		kt = keysutil.KeyType_MANAGED_KEY
+	default:
+		return kt, logical.ErrorResponse(fmt.Sprintf("unknown key type %v", keyType))
+	}
+
+	if derived && !kt.DerivationSupported() {
+		return kt, logical.ErrorResponse(fmt.Sprintf("key derivation not supported for keys of type %v", keyType))
+	}
+	if convergent {
+		if !kt.ConvergentEncryptionSupported() {
+			return kt, logical.ErrorResponse(fmt.Sprintf("convergent encryption not supported for keys of type %v", keyType))
+		}
+		if !derived {
+			return kt, logical.ErrorResponse("convergent encryption requires derivation to be enabled")
+		}
+	}
+
+	return kt, nil
+}
+
 const pathPolicyHelpSyn = `Managed named encryption keys`
 
 const pathPolicyHelpDesc = `
@@ -1,6 +1,7 @@
 package transit
 
 import (
+	"github.com/hashicorp/vault/helper/keysutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -39,6 +40,12 @@ func (b *backend) pathRotateWrite(
 	if p == nil {
 		return logical.ErrorResponse("key not found"), logical.ErrInvalidRequest
 	}
+	if p.Imported && !p.AllowImportedKeyRotation {
+		return logical.ErrorResponse("imported key does not allow rotation; use import_version to add a new version"), logical.ErrInvalidRequest
+	}
+	if p.Type == keysutil.KeyType_MANAGED_KEY {
+		return logical.ErrorResponse("managed keys cannot be rotated by Vault; rotate the key in the device holding it"), logical.ErrInvalidRequest
+	}
 
 	// Rotate the policy
 	err = p.Rotate(req.Storage)
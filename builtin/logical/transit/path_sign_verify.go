@@ -1,15 +1,16 @@
 package transit
 
 import (
-	"crypto/sha256"
-	"crypto/sha512"
+	"crypto"
 	"encoding/base64"
 	"fmt"
-	"hash"
 
 	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/keysutil"
+	"github.com/hashicorp/vault/helper/managedkeys"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
+	"github.com/mitchellh/mapstructure"
 )
 
 func (b *backend) pathSign() *framework.Path {
@@ -56,6 +57,19 @@ Defaults to "sha2-256". Not valid for all key types.`,
 Must be 0 (for latest) or a value greater than or equal
 to the min_encryption_version configured on the key.`,
 			},
+
+			"prehashed": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Set to 'true' when the input is already hashed with
+the given algorithm. Not valid for ed25519 keys.`,
+			},
+
+			"signature_algorithm": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "pss",
+				Description: `The signature algorithm to use for RSA keys. Valid
+values are "pss" and "pkcs1v15". Defaults to "pss".`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -114,6 +128,19 @@ derivation is enabled; currently only available with ed25519 keys.`,
 
 Defaults to "sha2-256". Not valid for all key types.`,
 			},
+
+			"prehashed": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Set to 'true' when the input is already hashed with
+the given algorithm. Not valid for ed25519 keys.`,
+			},
+
+			"signature_algorithm": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "pss",
+				Description: `The signature algorithm to use for RSA keys. Valid
+values are "pss" and "pkcs1v15". Defaults to "pss".`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -125,19 +152,149 @@ Defaults to "sha2-256". Not valid for all key types.`,
 	}
 }
 
-func (b *backend) pathSignWrite(
-	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	name := d.Get("name").(string)
-	ver := d.Get("key_version").(int)
-	inputB64 := d.Get("input").(string)
+// batchRequestSignItem represents a request item for batch sign and verify
+// operations
+type batchRequestSignItem struct {
+	// Input is the base64 encoded data to sign or verify
+	Input string `json:"input" structs:"input" mapstructure:"input"`
+
+	// Context for key derivation. This is required for derived keys.
+	Context string `json:"context" structs:"context" mapstructure:"context"`
+
+	// Signature to verify against the input
+	Signature string `json:"signature" structs:"signature" mapstructure:"signature"`
+}
+
+// batchResponseSignItem represents a response item for batch sign operations
+type batchResponseSignItem struct {
+	// Signature of the input present in the corresponding batch request item
+	Signature string `json:"signature,omitempty" structs:"signature" mapstructure:"signature"`
+
+	// PublicKey is returned for key types where it is not otherwise
+	// retrievable, such as ed25519 keys derived from a context
+	PublicKey []byte `json:"public_key,omitempty" structs:"public_key" mapstructure:"public_key"`
+
+	// Error, if set represents a failure encountered while signing a
+	// corresponding batch request item
+	Error string `json:"error,omitempty" structs:"error" mapstructure:"error"`
+}
+
+// batchResponseVerifyItem represents a response item for batch verify
+// operations
+type batchResponseVerifyItem struct {
+	// Valid indicates whether the signature in the corresponding batch
+	// request item is valid for its input
+	Valid bool `json:"valid" structs:"valid" mapstructure:"valid"`
+
+	// Error, if set represents a failure encountered while verifying a
+	// corresponding batch request item
+	Error string `json:"error,omitempty" structs:"error" mapstructure:"error"`
+}
+
+// signatureHashAlgorithm returns the hash for the given algorithm name, or
+// zero if the algorithm is not supported
+func signatureHashAlgorithm(algorithm string) crypto.Hash {
+	switch algorithm {
+	case "sha2-224":
+		return crypto.SHA224
+	case "sha2-256":
+		return crypto.SHA256
+	case "sha2-384":
+		return crypto.SHA384
+	case "sha2-512":
+		return crypto.SHA512
+	default:
+		return 0
+	}
+}
+
+// signatureHashParams validates the hashing parameters of a sign or verify
+// request against the key type. It returns the hash algorithm to pass to the
+// policy, and the one the input should be hashed with by the backend, which
+// is unset when the input is prehashed.
+func signatureHashParams(p *keysutil.Policy, d *framework.FieldData) (crypto.Hash, crypto.Hash, *logical.Response) {
 	algorithm := d.Get("urlalgorithm").(string)
 	if algorithm == "" {
 		algorithm = d.Get("algorithm").(string)
 	}
+	prehashed := d.Get("prehashed").(bool)
 
-	input, err := base64.StdEncoding.DecodeString(inputB64)
+	if !p.Type.HashSignatureInput() {
+		if prehashed {
+			return 0, 0, logical.ErrorResponse(fmt.Sprintf("prehashed input is not supported for keys of type %v", p.Type))
+		}
+		return 0, 0, nil
+	}
+
+	hashAlgorithm := signatureHashAlgorithm(algorithm)
+	if hashAlgorithm == 0 {
+		return 0, 0, logical.ErrorResponse(fmt.Sprintf("unsupported algorithm %s", algorithm))
+	}
+	if prehashed {
+		return hashAlgorithm, 0, nil
+	}
+	return hashAlgorithm, hashAlgorithm, nil
+}
+
+// decode returns the decoded input, hashed with inputHash if it is set, along
+// with the decoded context of the item
+func (item *batchRequestSignItem) decode(inputHash crypto.Hash) ([]byte, []byte, error) {
+	input, err := base64.StdEncoding.DecodeString(item.Input)
 	if err != nil {
-		return logical.ErrorResponse(fmt.Sprintf("unable to decode input as base64: %s", err)), logical.ErrInvalidRequest
+		return nil, nil, fmt.Errorf("unable to decode input as base64: %s", err)
+	}
+
+	var context []byte
+	if len(item.Context) != 0 {
+		context, err = base64.StdEncoding.DecodeString(item.Context)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to base64-decode context")
+		}
+	}
+
+	if inputHash != 0 {
+		hf := inputHash.New()
+		hf.Write(input)
+		input = hf.Sum(nil)
+	}
+
+	return input, context, nil
+}
+
+// parseSignBatchInput returns the items to process for a sign or verify
+// request, either from "batch_input" or from the top-level parameters
+func parseSignBatchInput(d *framework.FieldData, signature string) ([]batchRequestSignItem, *logical.Response, error) {
+	batchInputRaw := d.Raw["batch_input"]
+	if batchInputRaw == nil {
+		return []batchRequestSignItem{
+			batchRequestSignItem{
+				Input:     d.Get("input").(string),
+				Context:   d.Get("context").(string),
+				Signature: signature,
+			},
+		}, nil, nil
+	}
+
+	var batchInputItems []batchRequestSignItem
+	if err := mapstructure.Decode(batchInputRaw, &batchInputItems); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse batch input: %v", err)
+	}
+	if len(batchInputItems) == 0 {
+		return nil, logical.ErrorResponse("missing batch input to process"), logical.ErrInvalidRequest
+	}
+
+	return batchInputItems, nil, nil
+}
+
+func (b *backend) pathSignWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	ver := d.Get("key_version").(int)
+	sigAlgorithm := d.Get("signature_algorithm").(string)
+
+	batchInputItems, errResp, err := parseSignBatchInput(d, "")
+	if err != nil || errResp != nil {
+		return errResp, err
 	}
 
 	// Get the policy
@@ -156,50 +313,74 @@ func (b *backend) pathSignWrite(
 		return logical.ErrorResponse(fmt.Sprintf("key type %v does not support signing", p.Type)), logical.ErrInvalidRequest
 	}
 
-	contextRaw := d.Get("context").(string)
-	var context []byte
-	if len(contextRaw) != 0 {
-		context, err = base64.StdEncoding.DecodeString(contextRaw)
-		if err != nil {
-			return logical.ErrorResponse("failed to base64-decode context"), logical.ErrInvalidRequest
+	hashAlgorithm, inputHash, errResp := signatureHashParams(p, d)
+	if errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+
+	var managedKey managedkeys.Key
+	if p.Type == keysutil.KeyType_MANAGED_KEY {
+		managedKey, errResp = b.getManagedKey(p.ManagedKeyName)
+		if errResp != nil {
+			return errResp, logical.ErrInvalidRequest
 		}
 	}
 
-	if p.Type.HashSignatureInput() {
-		var hf hash.Hash
-		switch algorithm {
-		case "sha2-224":
-			hf = sha256.New224()
-		case "sha2-256":
-			hf = sha256.New()
-		case "sha2-384":
-			hf = sha512.New384()
-		case "sha2-512":
-			hf = sha512.New()
-		default:
-			return logical.ErrorResponse(fmt.Sprintf("unsupported algorithm %s", algorithm)), nil
+	// Process batch request items. If signing of any request item fails,
+	// respectively mark the error in the response collection and continue
+	// to process other items.
+	batchResponseItems := make([]batchResponseSignItem, len(batchInputItems))
+	for i, item := range batchInputItems {
+		input, context, err := item.decode(inputHash)
+		if err != nil {
+			batchResponseItems[i].Error = err.Error()
+			continue
 		}
-		hf.Write(input)
-		input = hf.Sum(nil)
+
+		var sig *keysutil.SigningResult
+		if managedKey != nil {
+			sig, err = p.SignManaged(managedKey, ver, input, hashAlgorithm, sigAlgorithm)
+		} else {
+			sig, err = p.Sign(ver, context, input, hashAlgorithm, sigAlgorithm)
+		}
+		if err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				batchResponseItems[i].Error = err.Error()
+				continue
+			default:
+				return nil, err
+			}
+		}
+		if sig == nil {
+			return nil, fmt.Errorf("signature could not be computed")
+		}
+
+		batchResponseItems[i].Signature = sig.Signature
+		batchResponseItems[i].PublicKey = sig.PublicKey
 	}
 
-	sig, err := p.Sign(ver, context, input)
-	if err != nil {
-		return nil, err
+	if d.Raw["batch_input"] != nil {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"batch_results": batchResponseItems,
+			},
+		}, nil
 	}
-	if sig == nil {
-		return nil, fmt.Errorf("signature could not be computed")
+
+	if batchResponseItems[0].Error != "" {
+		return logical.ErrorResponse(batchResponseItems[0].Error), logical.ErrInvalidRequest
 	}
 
 	// Generate the response
 	resp := &logical.Response{
 		Data: map[string]interface{}{
-			"signature": sig.Signature,
+			"signature": batchResponseItems[0].Signature,
 		},
 	}
 
-	if len(sig.PublicKey) > 0 {
-		resp.Data["public_key"] = sig.PublicKey
+	if len(batchResponseItems[0].PublicKey) > 0 {
+		resp.Data["public_key"] = batchResponseItems[0].PublicKey
 	}
 
 	return resp, nil
@@ -209,28 +390,26 @@ func (b *backend) pathVerifyWrite(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 
 	sig := d.Get("signature").(string)
-	hmac := d.Get("hmac").(string)
-	switch {
-	case sig != "" && hmac != "":
-		return logical.ErrorResponse("provide one of 'signature' or 'hmac'"), logical.ErrInvalidRequest
+	if d.Raw["batch_input"] == nil {
+		hmac := d.Get("hmac").(string)
+		switch {
+		case sig != "" && hmac != "":
+			return logical.ErrorResponse("provide one of 'signature' or 'hmac'"), logical.ErrInvalidRequest
 
-	case sig == "" && hmac == "":
-		return logical.ErrorResponse("neither a 'signature' nor an 'hmac' were given to verify"), logical.ErrInvalidRequest
+		case sig == "" && hmac == "":
+			return logical.ErrorResponse("neither a 'signature' nor an 'hmac' were given to verify"), logical.ErrInvalidRequest
 
-	case hmac != "":
-		return b.pathHMACVerify(req, d, hmac)
+		case hmac != "":
+			return b.pathHMACVerify(req, d, hmac)
+		}
 	}
 
 	name := d.Get("name").(string)
-	inputB64 := d.Get("input").(string)
-	algorithm := d.Get("urlalgorithm").(string)
-	if algorithm == "" {
-		algorithm = d.Get("algorithm").(string)
-	}
+	sigAlgorithm := d.Get("signature_algorithm").(string)
 
-	input, err := base64.StdEncoding.DecodeString(inputB64)
-	if err != nil {
-		return logical.ErrorResponse(fmt.Sprintf("unable to decode input as base64: %s", err)), logical.ErrInvalidRequest
+	batchInputItems, errResp, err := parseSignBatchInput(d, sig)
+	if err != nil || errResp != nil {
+		return errResp, err
 	}
 
 	// Get the policy
@@ -249,49 +428,67 @@ func (b *backend) pathVerifyWrite(
 		return logical.ErrorResponse(fmt.Sprintf("key type %v does not support verification", p.Type)), logical.ErrInvalidRequest
 	}
 
-	contextRaw := d.Get("context").(string)
-	var context []byte
-	if len(contextRaw) != 0 {
-		context, err = base64.StdEncoding.DecodeString(contextRaw)
-		if err != nil {
-			return logical.ErrorResponse("failed to base64-decode context"), logical.ErrInvalidRequest
-		}
+	hashAlgorithm, inputHash, errResp := signatureHashParams(p, d)
+	if errResp != nil {
+		return errResp, logical.ErrInvalidRequest
 	}
 
-	if p.Type.HashSignatureInput() {
-		var hf hash.Hash
-		switch algorithm {
-		case "sha2-224":
-			hf = sha256.New224()
-		case "sha2-256":
-			hf = sha256.New()
-		case "sha2-384":
-			hf = sha512.New384()
-		case "sha2-512":
-			hf = sha512.New()
-		default:
-			return logical.ErrorResponse(fmt.Sprintf("unsupported algorithm %s", algorithm)), nil
+	var managedKey managedkeys.Key
+	if p.Type == keysutil.KeyType_MANAGED_KEY {
+		managedKey, errResp = b.getManagedKey(p.ManagedKeyName)
+		if errResp != nil {
+			return errResp, logical.ErrInvalidRequest
 		}
-		hf.Write(input)
-		input = hf.Sum(nil)
 	}
 
-	valid, err := p.VerifySignature(context, input, sig)
-	if err != nil {
-		switch err.(type) {
-		case errutil.UserError:
-			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
-		case errutil.InternalError:
-			return nil, err
-		default:
-			return nil, err
+	batchResponseItems := make([]batchResponseVerifyItem, len(batchInputItems))
+	for i, item := range batchInputItems {
+		if item.Signature == "" {
+			batchResponseItems[i].Error = "missing signature to verify"
+			continue
 		}
+
+		input, context, err := item.decode(inputHash)
+		if err != nil {
+			batchResponseItems[i].Error = err.Error()
+			continue
+		}
+
+		var valid bool
+		if managedKey != nil {
+			valid, err = p.VerifySignatureManaged(managedKey, input, item.Signature, hashAlgorithm, sigAlgorithm)
+		} else {
+			valid, err = p.VerifySignature(context, input, item.Signature, hashAlgorithm, sigAlgorithm)
+		}
+		if err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				batchResponseItems[i].Error = err.Error()
+				continue
+			default:
+				return nil, err
+			}
+		}
+
+		batchResponseItems[i].Valid = valid
+	}
+
+	if d.Raw["batch_input"] != nil {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"batch_results": batchResponseItems,
+			},
+		}, nil
+	}
+
+	if batchResponseItems[0].Error != "" {
+		return logical.ErrorResponse(batchResponseItems[0].Error), logical.ErrInvalidRequest
 	}
 
 	// Generate the response
 	resp := &logical.Response{
 		Data: map[string]interface{}{
-			"valid": valid,
+			"valid": batchResponseItems[0].Valid,
 		},
 	}
 	return resp, nil
@@ -300,10 +497,15 @@ func (b *backend) pathVerifyWrite(
 const pathSignHelpSyn = `Generate a signature for input data using the named key`
 
 const pathSignHelpDesc = `
-Generates a signature of the input data using the named key and the given hash algorithm.
+Generates a signature of the input data using the named key and the given hash
+algorithm. Multiple inputs may be signed in a single request by providing a
+"batch_input" list of items, each with an "input" and optional "context".
 `
 const pathVerifyHelpSyn = `Verify a signature or HMAC for input data created using the named key`
 
 const pathVerifyHelpDesc = `
-Verifies a signature or HMAC of the input data using the named key and the given hash algorithm.
+Verifies a signature or HMAC of the input data using the named key and the given
+hash algorithm. Multiple signatures may be verified in a single request by
+providing a "batch_input" list of items, each with an "input", "signature" and
+optional "context".
 `
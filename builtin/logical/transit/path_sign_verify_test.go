@@ -1,6 +1,7 @@
 package transit
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
 	"strings"
 	"testing"
@@ -403,3 +404,200 @@ func TestTransit_SignVerify_ED25519(t *testing.T) {
 	verifyRequest(req, false, "bar", sig)
 	verifyRequest(req, true, "bar", v1sig)
 }
+
+func TestTransit_SignVerify_Batch(t *testing.T) {
+	var resp *logical.Response
+	var err error
+
+	b, s := createBackendWithStorage(t)
+
+	req := &logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/foo",
+		Data: map[string]interface{}{
+			"type": "ecdsa-p256",
+		},
+	}
+	_, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Path = "sign/foo"
+	req.Data = map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"input": "dGhlIHF1aWNrIGJyb3duIGZveA=="},
+			map[string]interface{}{"input": "not base64"},
+			map[string]interface{}{"input": "anVtcGVkIG92ZXIgdGhlIGxhenkgZG9n"},
+		},
+	}
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	signResults := resp.Data["batch_results"].([]batchResponseSignItem)
+	if len(signResults) != 3 {
+		t.Fatalf("bad: expected 3 results, got %#v", signResults)
+	}
+	if signResults[0].Signature == "" || signResults[0].Error != "" {
+		t.Fatalf("bad: first item: %#v", signResults[0])
+	}
+	if signResults[1].Signature != "" || signResults[1].Error == "" {
+		t.Fatalf("bad: expected error for second item: %#v", signResults[1])
+	}
+	if signResults[2].Signature == "" || signResults[2].Error != "" {
+		t.Fatalf("bad: third item: %#v", signResults[2])
+	}
+
+	// Reuse the first signature for the last input, so that only the first
+	// item should verify
+	req.Path = "verify/foo"
+	req.Data = map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{
+				"input":     "dGhlIHF1aWNrIGJyb3duIGZveA==",
+				"signature": signResults[0].Signature,
+			},
+			map[string]interface{}{
+				"input": "dGhlIHF1aWNrIGJyb3duIGZveA==",
+			},
+			map[string]interface{}{
+				"input":     "anVtcGVkIG92ZXIgdGhlIGxhenkgZG9n",
+				"signature": signResults[0].Signature,
+			},
+		},
+	}
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	verifyResults := resp.Data["batch_results"].([]batchResponseVerifyItem)
+	if len(verifyResults) != 3 {
+		t.Fatalf("bad: expected 3 results, got %#v", verifyResults)
+	}
+	if !verifyResults[0].Valid || verifyResults[0].Error != "" {
+		t.Fatalf("bad: first item: %#v", verifyResults[0])
+	}
+	if verifyResults[1].Error == "" {
+		t.Fatalf("bad: expected error for second item: %#v", verifyResults[1])
+	}
+	if verifyResults[2].Valid || verifyResults[2].Error != "" {
+		t.Fatalf("bad: third item: %#v", verifyResults[2])
+	}
+
+	// Empty batch input is an error
+	req.Data = map[string]interface{}{
+		"batch_input": []interface{}{},
+	}
+	resp, err = b.HandleRequest(req)
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response, got err:%v resp:%#v", err, resp)
+	}
+}
+
+func TestTransit_SignVerify_RSA(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	req := &logical.Request{
+		Storage:   s,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/foo",
+		Data: map[string]interface{}{
+			"type": "rsa-2048",
+		},
+	}
+	resp, err := b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	input := []byte("the quick brown fox")
+	digest := sha256.Sum256(input)
+
+	sign := func(data map[string]interface{}) string {
+		resp, err := b.HandleRequest(&logical.Request{
+			Storage:   s,
+			Operation: logical.UpdateOperation,
+			Path:      "sign/foo",
+			Data:      data,
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		return resp.Data["signature"].(string)
+	}
+	verify := func(data map[string]interface{}) bool {
+		resp, err := b.HandleRequest(&logical.Request{
+			Storage:   s,
+			Operation: logical.UpdateOperation,
+			Path:      "verify/foo",
+			Data:      data,
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		return resp.Data["valid"].(bool)
+	}
+
+	for _, sigAlgorithm := range []string{"pss", "pkcs1v15"} {
+		sig := sign(map[string]interface{}{
+			"input":               base64.StdEncoding.EncodeToString(input),
+			"signature_algorithm": sigAlgorithm,
+		})
+
+		// A prehashed digest of the same input must verify
+		if !verify(map[string]interface{}{
+			"input":               base64.StdEncoding.EncodeToString(digest[:]),
+			"prehashed":           true,
+			"signature":           sig,
+			"signature_algorithm": sigAlgorithm,
+		}) {
+			t.Fatalf("%s: expected prehashed verification to succeed", sigAlgorithm)
+		}
+
+		// A different hash algorithm must not
+		if verify(map[string]interface{}{
+			"input":               base64.StdEncoding.EncodeToString(input),
+			"algorithm":           "sha2-512",
+			"signature":           sig,
+			"signature_algorithm": sigAlgorithm,
+		}) {
+			t.Fatalf("%s: expected verification with the wrong hash to fail", sigAlgorithm)
+		}
+	}
+
+	// Signature algorithms must match
+	sig := sign(map[string]interface{}{
+		"input":     base64.StdEncoding.EncodeToString(digest[:]),
+		"prehashed": true,
+	})
+	if verify(map[string]interface{}{
+		"input":               base64.StdEncoding.EncodeToString(input),
+		"signature":           sig,
+		"signature_algorithm": "pkcs1v15",
+	}) {
+		t.Fatal("expected verification with the wrong signature algorithm to fail")
+	}
+
+	// Prehashed input is rejected for ed25519 keys
+	req.Path = "keys/ed"
+	req.Data = map[string]interface{}{
+		"type": "ed25519",
+	}
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	req.Path = "sign/ed"
+	req.Data = map[string]interface{}{
+		"input":     base64.StdEncoding.EncodeToString(digest[:]),
+		"prehashed": true,
+	}
+	resp, err = b.HandleRequest(req)
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response, got err:%v resp:%#v", err, resp)
+	}
+}
@@ -0,0 +1,122 @@
+package transit
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const wrappingKeyStoragePath = "import/wrapping_key"
+
+// wrappingKeyEntry is the storage format of the key used to wrap imported
+// key material
+type wrappingKeyEntry struct {
+	Key string `json:"key"`
+}
+
+func (b *backend) pathWrappingKey() *framework.Path {
+	return &framework.Path{
+		Pattern: "wrapping_key",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathWrappingKeyRead,
+		},
+
+		HelpSynopsis:    pathWrappingKeyHelpSyn,
+		HelpDescription: pathWrappingKeyHelpDesc,
+	}
+}
+
+func (b *backend) pathWrappingKeyRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key, err := b.getWrappingKey(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	derBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling public key: %s", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"public_key": string(pem.EncodeToMemory(&pem.Block{
+				Type:  "PUBLIC KEY",
+				Bytes: derBytes,
+			})),
+		},
+	}, nil
+}
+
+// getWrappingKey returns the RSA key used to wrap imported key material,
+// generating it on first use
+func (b *backend) getWrappingKey(s logical.Storage) (*rsa.PrivateKey, error) {
+	key, err := readWrappingKey(s)
+	if err != nil || key != nil {
+		return key, err
+	}
+
+	b.wrappingKeyLock.Lock()
+	defer b.wrappingKeyLock.Unlock()
+
+	// Check again in case it was generated while waiting for the lock
+	key, err = readWrappingKey(s)
+	if err != nil || key != nil {
+		return key, err
+	}
+
+	key, err = rsa.GenerateKey(rand.Reader, 4096)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := logical.StorageEntryJSON(wrappingKeyStoragePath, &wrappingKeyEntry{
+		Key: string(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		})),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func readWrappingKey(s logical.Storage) (*rsa.PrivateKey, error) {
+	raw, err := s.Get(wrappingKeyStoragePath)
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	var entry wrappingKeyEntry
+	if err := raw.DecodeJSON(&entry); err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode([]byte(entry.Key))
+	if block == nil {
+		return nil, errors.New("unable to decode stored wrapping key")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+const pathWrappingKeyHelpSyn = `Returns the public key to use for wrapping imported keys`
+
+const pathWrappingKeyHelpDesc = `
+This path is used to retrieve the RSA-4096 public key used to wrap key
+material for import into this backend. The key is generated on first use.
+`
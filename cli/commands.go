@@ -11,25 +11,42 @@ import (
 	credAppId "github.com/hashicorp/vault/builtin/credential/app-id"
 	credAppRole "github.com/hashicorp/vault/builtin/credential/approle"
 	credAws "github.com/hashicorp/vault/builtin/credential/aws"
+	credAzure "github.com/hashicorp/vault/builtin/credential/azure"
 	credCert "github.com/hashicorp/vault/builtin/credential/cert"
+	credCF "github.com/hashicorp/vault/builtin/credential/cf"
+	credGcp "github.com/hashicorp/vault/builtin/credential/gcp"
 	credGitHub "github.com/hashicorp/vault/builtin/credential/github"
+	credJWT "github.com/hashicorp/vault/builtin/credential/jwt"
+	credKerberos "github.com/hashicorp/vault/builtin/credential/kerberos"
+	credKubernetes "github.com/hashicorp/vault/builtin/credential/kubernetes"
 	credLdap "github.com/hashicorp/vault/builtin/credential/ldap"
+	credOCI "github.com/hashicorp/vault/builtin/credential/oci"
 	credOkta "github.com/hashicorp/vault/builtin/credential/okta"
 	credRadius "github.com/hashicorp/vault/builtin/credential/radius"
+	credSAML "github.com/hashicorp/vault/builtin/credential/saml"
 	credUserpass "github.com/hashicorp/vault/builtin/credential/userpass"
 
+	"github.com/hashicorp/vault/builtin/logical/artifactory"
 	"github.com/hashicorp/vault/builtin/logical/aws"
+	"github.com/hashicorp/vault/builtin/logical/azure"
 	"github.com/hashicorp/vault/builtin/logical/cassandra"
 	"github.com/hashicorp/vault/builtin/logical/consul"
 	"github.com/hashicorp/vault/builtin/logical/database"
+	"github.com/hashicorp/vault/builtin/logical/gcp"
+	"github.com/hashicorp/vault/builtin/logical/identity"
+	"github.com/hashicorp/vault/builtin/logical/kmip"
+	"github.com/hashicorp/vault/builtin/logical/ldap"
 	"github.com/hashicorp/vault/builtin/logical/mongodb"
 	"github.com/hashicorp/vault/builtin/logical/mssql"
 	"github.com/hashicorp/vault/builtin/logical/mysql"
+	"github.com/hashicorp/vault/builtin/logical/nomad"
 	"github.com/hashicorp/vault/builtin/logical/pki"
 	"github.com/hashicorp/vault/builtin/logical/postgresql"
 	"github.com/hashicorp/vault/builtin/logical/rabbitmq"
 	"github.com/hashicorp/vault/builtin/logical/ssh"
+	"github.com/hashicorp/vault/builtin/logical/terraform"
 	"github.com/hashicorp/vault/builtin/logical/totp"
+	"github.com/hashicorp/vault/builtin/logical/transform"
 	"github.com/hashicorp/vault/builtin/logical/transit"
 
 	"github.com/hashicorp/vault/audit"
@@ -70,30 +87,47 @@ func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
 					"socket": auditSocket.Factory,
 				},
 				CredentialBackends: map[string]logical.Factory{
-					"approle":  credAppRole.Factory,
-					"cert":     credCert.Factory,
-					"aws":      credAws.Factory,
-					"app-id":   credAppId.Factory,
-					"github":   credGitHub.Factory,
-					"userpass": credUserpass.Factory,
-					"ldap":     credLdap.Factory,
-					"okta":     credOkta.Factory,
-					"radius":   credRadius.Factory,
+					"approle":    credAppRole.Factory,
+					"cert":       credCert.Factory,
+					"aws":        credAws.Factory,
+					"app-id":     credAppId.Factory,
+					"github":     credGitHub.Factory,
+					"userpass":   credUserpass.Factory,
+					"ldap":       credLdap.Factory,
+					"okta":       credOkta.Factory,
+					"radius":     credRadius.Factory,
+					"kubernetes": credKubernetes.Factory,
+					"jwt":        credJWT.Factory,
+					"gcp":        credGcp.Factory,
+					"azure":      credAzure.Factory,
+					"kerberos":   credKerberos.Factory,
+					"saml":       credSAML.Factory,
+					"cf":         credCF.Factory,
+					"oci":        credOCI.Factory,
 				},
 				LogicalBackends: map[string]logical.Factory{
-					"aws":        aws.Factory,
-					"consul":     consul.Factory,
-					"postgresql": postgresql.Factory,
-					"cassandra":  cassandra.Factory,
-					"pki":        pki.Factory,
-					"transit":    transit.Factory,
-					"mongodb":    mongodb.Factory,
-					"mssql":      mssql.Factory,
-					"mysql":      mysql.Factory,
-					"ssh":        ssh.Factory,
-					"rabbitmq":   rabbitmq.Factory,
-					"database":   database.Factory,
-					"totp":       totp.Factory,
+					"aws":         aws.Factory,
+					"consul":      consul.Factory,
+					"postgresql":  postgresql.Factory,
+					"cassandra":   cassandra.Factory,
+					"pki":         pki.Factory,
+					"transit":     transit.Factory,
+					"mongodb":     mongodb.Factory,
+					"mssql":       mssql.Factory,
+					"mysql":       mysql.Factory,
+					"ssh":         ssh.Factory,
+					"rabbitmq":    rabbitmq.Factory,
+					"database":    database.Factory,
+					"gcp":         gcp.Factory,
+					"azure":       azure.Factory,
+					"nomad":       nomad.Factory,
+					"ldap":        ldap.Factory,
+					"totp":        totp.Factory,
+					"transform":   transform.Factory,
+					"kmip":        kmip.Factory,
+					"terraform":   terraform.Factory,
+					"artifactory": artifactory.Factory,
+					"identity":    identity.Factory,
 				},
 				ShutdownCh: command.MakeShutdownCh(),
 				SighupCh:   command.MakeSighupCh(),
@@ -123,6 +157,12 @@ func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
 					"cert":     &credCert.CLIHandler{},
 					"aws":      &credAws.CLIHandler{},
 					"radius":   &credUserpass.CLIHandler{DefaultMount: "radius"},
+					"oidc":     &credJWT.CLIHandler{DefaultMount: "oidc"},
+					"gcp":      &credGcp.CLIHandler{},
+					"azure":    &credAzure.CLIHandler{},
+					"saml":     &credSAML.CLIHandler{},
+					"cf":       &credCF.CLIHandler{},
+					"oci":      &credOCI.CLIHandler{},
 				},
 			}, nil
 		},
@@ -259,6 +299,18 @@ func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
 			}, nil
 		},
 
+		"migrate": func() (cli.Command, error) {
+			return &command.MigrateCommand{
+				Meta: *metaPtr,
+			}, nil
+		},
+
+		"storage-benchmark": func() (cli.Command, error) {
+			return &command.StorageBenchmarkCommand{
+				Meta: *metaPtr,
+			}, nil
+		},
+
 		"mount": func() (cli.Command, error) {
 			return &command.MountCommand{
 				Meta: *metaPtr,
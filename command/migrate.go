@@ -0,0 +1,213 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/meta"
+	"github.com/hashicorp/vault/physical"
+	log "github.com/mgutz/logxi/v1"
+)
+
+// MigrateCommand is a Command that copies the data of a storage backend to
+// another one.
+type MigrateCommand struct {
+	meta.Meta
+}
+
+// migrateConfig holds the storages of a migration
+type migrateConfig struct {
+	SourceType        string
+	SourceConfig      map[string]string
+	DestinationType   string
+	DestinationConfig map[string]string
+}
+
+func (c *MigrateCommand) Run(args []string) int {
+	var configPath string
+	var reset bool
+	flags := c.Meta.FlagSet("migrate", meta.FlagSetNone)
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	flags.StringVar(&configPath, "config", "", "")
+	flags.BoolVar(&reset, "reset", false, "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if configPath == "" {
+		c.Ui.Error("A migration configuration file must be specified with -config")
+		return 1
+	}
+	config, err := loadMigrateConfig(configPath)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error loading configuration from %s: %s", configPath, err))
+		return 1
+	}
+
+	logger := logformat.NewVaultLoggerWithWriter(os.Stderr, log.LevelInfo)
+
+	source, err := physical.NewBackend(config.SourceType, logger, config.SourceConfig)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing source storage of type %s: %s", config.SourceType, err))
+		return 1
+	}
+	defer closeMigrateStorage(source)
+	dest, err := physical.NewBackend(config.DestinationType, logger, config.DestinationConfig)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing destination storage of type %s: %s", config.DestinationType, err))
+		return 1
+	}
+	defer closeMigrateStorage(dest)
+
+	// Raft only accepts writes on the leader of the cluster, so a new
+	// destination is bootstrapped as a single node cluster
+	for _, b := range []physical.Backend{source, dest} {
+		raftStorage, ok := b.(*physical.RaftBackend)
+		if !ok {
+			continue
+		}
+		if b == dest {
+			if err := raftStorage.Bootstrap(); err != nil {
+				c.Ui.Error(fmt.Sprintf("Error bootstrapping raft storage: %s", err))
+				return 1
+			}
+		}
+		if err := raftStorage.WaitForLeadership(30 * time.Second); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error waiting for raft leadership: %s", err))
+			return 1
+		}
+	}
+
+	if reset {
+		if err := physical.ResetMigration(source, dest); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error resetting migration: %s", err))
+			return 1
+		}
+		c.Ui.Output("Migration locks removed")
+		return 0
+	}
+
+	if err := physical.Migrate(source, dest, logger); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error migrating storage: %s", err))
+		return 1
+	}
+
+	c.Ui.Output(fmt.Sprintf(
+		"Success! Storage migrated from %s to %s. Update the server configuration\n"+
+			"to use the destination storage before starting Vault again.",
+		config.SourceType, config.DestinationType))
+	return 0
+}
+
+func closeMigrateStorage(b physical.Backend) {
+	if raftStorage, ok := b.(*physical.RaftBackend); ok {
+		raftStorage.Close()
+	}
+}
+
+// loadMigrateConfig parses the migration configuration file, which holds a
+// "storage_source" and a "storage_destination" block in the format of the
+// server's "storage" block
+func loadMigrateConfig(path string) (*migrateConfig, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := hcl.Parse(string(d))
+	if err != nil {
+		return nil, err
+	}
+	list, ok := obj.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("error parsing: file doesn't contain a root object")
+	}
+
+	for _, item := range list.Items {
+		key := item.Keys[0].Token.Value().(string)
+		if key != "storage_source" && key != "storage_destination" {
+			return nil, fmt.Errorf("invalid key %q", key)
+		}
+	}
+
+	var result migrateConfig
+	result.SourceType, result.SourceConfig, err = parseMigrateStorage(list, "storage_source")
+	if err != nil {
+		return nil, err
+	}
+	result.DestinationType, result.DestinationConfig, err = parseMigrateStorage(list, "storage_destination")
+	if err != nil {
+		return nil, err
+	}
+	if result.SourceType == result.DestinationType &&
+		fmt.Sprint(result.SourceConfig) == fmt.Sprint(result.DestinationConfig) {
+		return nil, fmt.Errorf("source and destination storages must differ")
+	}
+	return &result, nil
+}
+
+func parseMigrateStorage(list *ast.ObjectList, name string) (string, map[string]string, error) {
+	items := list.Filter(name).Items
+	if len(items) != 1 {
+		return "", nil, fmt.Errorf("exactly one %q block is required", name)
+	}
+	item := items[0]
+	if len(item.Keys) != 1 {
+		return "", nil, fmt.Errorf("the type of the %q block is required", name)
+	}
+
+	var m map[string]string
+	if err := hcl.DecodeObject(&m, item.Val); err != nil {
+		return "", nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return strings.ToLower(item.Keys[0].Token.Value().(string)), m, nil
+}
+
+func (c *MigrateCommand) Synopsis() string {
+	return "Copy the data of a storage backend to another one"
+}
+
+func (c *MigrateCommand) Help() string {
+	helpText := `
+Usage: vault migrate -config=<path> [options]
+
+  Copy all the data of a storage backend to another one, such as to move
+  from Consul to the raft storage.
+
+  Vault must be stopped on all the nodes using the source storage. While the
+  migration runs, both storages hold a lock entry, and Vault refuses to start
+  with either of them. An interrupted migration is resumed from its last
+  checkpoint by running the command again; it can be abandoned instead with
+  -reset, which removes the locks.
+
+  The configuration file holds a "storage_source" and a "storage_destination"
+  block, in the format of the "storage" block of the server configuration:
+
+      storage_source "consul" {
+        address = "127.0.0.1:8500"
+        path    = "vault"
+      }
+
+      storage_destination "raft" {
+        path    = "/var/lib/vault/raft"
+        node_id = "vault-1"
+      }
+
+  The destination must be empty. A raft destination is bootstrapped as a
+  single node cluster, which other nodes join once Vault runs with it.
+
+Migrate Options:
+
+  -config=<path>          Path to the migration configuration file.
+
+  -reset                  Remove the migration locks of both storages instead
+                          of migrating.
+`
+	return strings.TrimSpace(helpText)
+}
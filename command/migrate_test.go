@@ -0,0 +1,108 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/meta"
+	"github.com/hashicorp/vault/physical"
+	log "github.com/mgutz/logxi/v1"
+	"github.com/mitchellh/cli"
+)
+
+func TestMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourcePath := filepath.Join(dir, "source")
+	destPath := filepath.Join(dir, "dest")
+	configPath := filepath.Join(dir, "migrate.hcl")
+	config := fmt.Sprintf(`
+storage_source "file" {
+  path = %q
+}
+
+storage_destination "file" {
+  path = %q
+}
+`, sourcePath, destPath)
+	if err := ioutil.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	source, err := physical.NewBackend("file", logger, map[string]string{"path": sourcePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"core/keyring", "logical/abc/foo", "sys/token/id/bar"} {
+		if err := source.Put(&physical.Entry{Key: key, Value: []byte(key)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ui := new(cli.MockUi)
+	c := &MigrateCommand{
+		Meta: meta.Meta{
+			Ui: ui,
+		},
+	}
+	if code := c.Run([]string{"-config", configPath}); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	dest, err := physical.NewBackend("file", logger, map[string]string{"path": destPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"core/keyring", "logical/abc/foo", "sys/token/id/bar"} {
+		entry, err := dest.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry == nil || string(entry.Value) != key {
+			t.Fatalf("bad entry for %q: %#v", key, entry)
+		}
+	}
+	if entry, _ := dest.Get(physical.MigrationLockKey); entry != nil {
+		t.Fatal("expected the migration lock to be removed")
+	}
+
+	// The destination isn't empty anymore
+	if code := c.Run([]string{"-config", configPath}); code == 0 {
+		t.Fatal("expected an error migrating to a non-empty storage")
+	}
+}
+
+func TestMigrate_Config(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configs := []string{
+		`storage_source "inmem" {}`,
+		`storage_source "inmem" {}
+storage_destination "inmem" {}`,
+		`storage "inmem" {}
+storage_source "inmem" {}
+storage_destination "file" { path = "/tmp" }`,
+	}
+	for i, config := range configs {
+		configPath := filepath.Join(dir, fmt.Sprintf("migrate-%d.hcl", i))
+		if err := ioutil.WriteFile(configPath, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadMigrateConfig(configPath); err == nil {
+			t.Fatalf("expected an error for config %d", i)
+		}
+	}
+}
@@ -15,10 +15,12 @@ type MountTuneCommand struct {
 }
 
 func (c *MountTuneCommand) Run(args []string) int {
-	var defaultLeaseTTL, maxLeaseTTL string
+	var defaultLeaseTTL, maxLeaseTTL, defaultWrappingTTL, maxWrappingTTL string
 	flags := c.Meta.FlagSet("mount-tune", meta.FlagSetDefault)
 	flags.StringVar(&defaultLeaseTTL, "default-lease-ttl", "", "")
 	flags.StringVar(&maxLeaseTTL, "max-lease-ttl", "", "")
+	flags.StringVar(&defaultWrappingTTL, "default-wrapping-ttl", "", "")
+	flags.StringVar(&maxWrappingTTL, "max-wrapping-ttl", "", "")
 	flags.Usage = func() { c.Ui.Error(c.Help()) }
 	if err := flags.Parse(args); err != nil {
 		return 1
@@ -35,8 +37,10 @@ func (c *MountTuneCommand) Run(args []string) int {
 	path := args[0]
 
 	mountConfig := api.MountConfigInput{
-		DefaultLeaseTTL: defaultLeaseTTL,
-		MaxLeaseTTL:     maxLeaseTTL,
+		DefaultLeaseTTL:    defaultLeaseTTL,
+		MaxLeaseTTL:        maxLeaseTTL,
+		DefaultWrappingTTL: defaultWrappingTTL,
+		MaxWrappingTTL:     maxWrappingTTL,
 	}
 
 	client, err := c.Client()
@@ -84,6 +88,15 @@ Mount Options:
                                  the previously set value. Set to 'system' to
                                  explicitly set it to use the system default.
 
+  -default-wrapping-ttl=<duration>  Response wrapping time-to-live of the
+                                    responses of this backend that are not
+                                    requested to be wrapped. Set to '0' to
+                                    stop wrapping them.
+
+  -max-wrapping-ttl=<duration>   Max response wrapping time-to-live of the
+                                 responses of this backend. Set to '0' to
+                                 remove the limit.
+
 `
 	return strings.TrimSpace(helpText)
 }
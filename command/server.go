@@ -195,6 +195,13 @@ func (c *ServerCommand) Run(args []string) int {
 		return 1
 	}
 
+	// Writes are only served by the leader of a raft cluster, which must
+	// therefore be the node holding the HA lock
+	if config.HAStorage != nil && (config.Storage.Type == "raft" || config.HAStorage.Type == "raft") {
+		c.Ui.Output("Raft storage can't be combined with a separate HA storage")
+		return 1
+	}
+
 	// Initialize the backend
 	backend, err := physical.NewBackend(
 		config.Storage.Type, c.logger, config.Storage.Config)
@@ -208,7 +215,11 @@ func (c *ServerCommand) Run(args []string) int {
 	infoKeys := make([]string, 0, 10)
 	info := make(map[string]string)
 
-	var seal vault.Seal = &vault.DefaultSeal{}
+	seal, migrationSeal, entropySource, err := newSeals(config, c.logger, info, &infoKeys)
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
 
 	// Ensure that the seal finalizer is called, even if using verify-only
 	defer func() {
@@ -218,6 +229,12 @@ func (c *ServerCommand) Run(args []string) int {
 				c.Ui.Error(fmt.Sprintf("Error finalizing seals: %v", err))
 			}
 		}
+		if migrationSeal != nil {
+			err = migrationSeal.Finalize()
+			if err != nil {
+				c.Ui.Error(fmt.Sprintf("Error finalizing seals: %v", err))
+			}
+		}
 	}()
 
 	if seal == nil {
@@ -230,6 +247,8 @@ func (c *ServerCommand) Run(args []string) int {
 		RedirectAddr:       config.Storage.RedirectAddr,
 		HAPhysical:         nil,
 		Seal:               seal,
+		MigrationSeal:      migrationSeal,
+		EntropySource:      entropySource,
 		AuditBackends:      c.AuditBackends,
 		CredentialBackends: c.CredentialBackends,
 		LogicalBackends:    c.LogicalBackends,
@@ -240,6 +259,9 @@ func (c *ServerCommand) Run(args []string) int {
 		DefaultLeaseTTL:    config.DefaultLeaseTTL,
 		ClusterName:        config.ClusterName,
 		CacheSize:          config.CacheSize,
+		CacheSizeBytes:     config.CacheSizeBytes,
+		CacheNegative:      config.CacheNegative,
+		PerformanceStandby: config.PerformanceStandby,
 		PluginDirectory:    config.PluginDirectory,
 	}
 	if dev {
@@ -533,6 +555,20 @@ CLUSTER_SYNTHESIS_COMPLETE:
 		return 0
 	}
 
+	// A storage being migrated is either being copied or incomplete. The
+	// storage may not be reachable yet, which is not fatal at this point.
+	migrationStatus, err := physical.ReadMigrationStatus(backend)
+	if err != nil {
+		c.Ui.Output(fmt.Sprintf("==> WARNING: Failed to check for a storage migration: %s\n", err))
+	}
+	if migrationStatus != nil {
+		c.Ui.Output(fmt.Sprintf(
+			"Storage migration in progress or interrupted (started at %s); "+
+				"run \"vault migrate\" again to complete it, or with -reset to abandon it",
+			migrationStatus.Start.Format(time.RFC3339)))
+		return 1
+	}
+
 	// Perform service discovery registrations and initialization of
 	// HTTP server after the verifyOnly check.
 
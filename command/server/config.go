@@ -24,13 +24,22 @@ type Config struct {
 	Storage   *Storage    `hcl:"-"`
 	HAStorage *Storage    `hcl:"-"`
 
-	HSM *HSM `hcl:"-"`
+	HSM   *HSM    `hcl:"-"`
+	Seals []*Seal `hcl:"-"`
 
-	CacheSize       int         `hcl:"cache_size"`
-	DisableCache    bool        `hcl:"-"`
-	DisableCacheRaw interface{} `hcl:"disable_cache"`
-	DisableMlock    bool        `hcl:"-"`
-	DisableMlockRaw interface{} `hcl:"disable_mlock"`
+	Entropy *Entropy `hcl:"-"`
+
+	CacheSize        int         `hcl:"cache_size"`
+	CacheSizeBytes   int64       `hcl:"cache_size_bytes"`
+	CacheNegative    bool        `hcl:"-"`
+	CacheNegativeRaw interface{} `hcl:"cache_negative"`
+	DisableCache     bool        `hcl:"-"`
+	DisableCacheRaw  interface{} `hcl:"disable_cache"`
+	DisableMlock     bool        `hcl:"-"`
+	DisableMlockRaw  interface{} `hcl:"disable_mlock"`
+
+	PerformanceStandby    bool        `hcl:"-"`
+	PerformanceStandbyRaw interface{} `hcl:"performance_standby"`
 
 	EnableUI    bool        `hcl:"-"`
 	EnableUIRaw interface{} `hcl:"ui"`
@@ -119,6 +128,30 @@ func (h *HSM) GoString() string {
 	return fmt.Sprintf("*%#v", *h)
 }
 
+// Seal contains the configuration of an auto seal of the server. A disabled
+// seal is the seal the stored data is migrated from.
+type Seal struct {
+	Type     string
+	Disabled bool
+	Config   map[string]string
+}
+
+func (s *Seal) GoString() string {
+	return fmt.Sprintf("*%#v", *s)
+}
+
+// Entropy configures an external source of randomness for the critical keys
+// of the server. The only source is the seal, with the "augmentation" mode
+// mixing its randomness with the system's.
+type Entropy struct {
+	Source string
+	Mode   string
+}
+
+func (e *Entropy) GoString() string {
+	return fmt.Sprintf("*%#v", *e)
+}
+
 // Telemetry is the telemetry configuration for the server
 type Telemetry struct {
 	StatsiteAddr string `hcl:"statsite_address"`
@@ -240,6 +273,16 @@ func (c *Config) Merge(c2 *Config) *Config {
 		result.HSM = c2.HSM
 	}
 
+	result.Seals = c.Seals
+	if len(c2.Seals) > 0 {
+		result.Seals = c2.Seals
+	}
+
+	result.Entropy = c.Entropy
+	if c2.Entropy != nil {
+		result.Entropy = c2.Entropy
+	}
+
 	result.Telemetry = c.Telemetry
 	if c2.Telemetry != nil {
 		result.Telemetry = c2.Telemetry
@@ -250,7 +293,22 @@ func (c *Config) Merge(c2 *Config) *Config {
 		result.CacheSize = c2.CacheSize
 	}
 
+	result.CacheSizeBytes = c.CacheSizeBytes
+	if c2.CacheSizeBytes != 0 {
+		result.CacheSizeBytes = c2.CacheSizeBytes
+	}
+
 	// merging these booleans via an OR operation
+	result.CacheNegative = c.CacheNegative
+	if c2.CacheNegative {
+		result.CacheNegative = c2.CacheNegative
+	}
+
+	result.PerformanceStandby = c.PerformanceStandby
+	if c2.PerformanceStandby {
+		result.PerformanceStandby = c2.PerformanceStandby
+	}
+
 	result.DisableCache = c.DisableCache
 	if c2.DisableCache {
 		result.DisableCache = c2.DisableCache
@@ -345,6 +403,18 @@ func ParseConfig(d string, logger log.Logger) (*Config, error) {
 		}
 	}
 
+	if result.CacheNegativeRaw != nil {
+		if result.CacheNegative, err = parseutil.ParseBool(result.CacheNegativeRaw); err != nil {
+			return nil, err
+		}
+	}
+
+	if result.PerformanceStandbyRaw != nil {
+		if result.PerformanceStandby, err = parseutil.ParseBool(result.PerformanceStandbyRaw); err != nil {
+			return nil, err
+		}
+	}
+
 	if result.DisableCacheRaw != nil {
 		if result.DisableCache, err = parseutil.ParseBool(result.DisableCacheRaw); err != nil {
 			return nil, err
@@ -369,8 +439,13 @@ func ParseConfig(d string, logger log.Logger) (*Config, error) {
 		"backend",
 		"ha_backend",
 		"hsm",
+		"seal",
+		"entropy",
 		"listener",
 		"cache_size",
+		"cache_size_bytes",
+		"cache_negative",
+		"performance_standby",
 		"disable_cache",
 		"disable_mlock",
 		"ui",
@@ -415,6 +490,18 @@ func ParseConfig(d string, logger log.Logger) (*Config, error) {
 		}
 	}
 
+	if o := list.Filter("seal"); len(o.Items) > 0 {
+		if err := parseSeals(&result, o); err != nil {
+			return nil, fmt.Errorf("error parsing 'seal': %s", err)
+		}
+	}
+
+	if o := list.Filter("entropy"); len(o.Items) > 0 {
+		if err := parseEntropy(&result, o); err != nil {
+			return nil, fmt.Errorf("error parsing 'entropy': %s", err)
+		}
+	}
+
 	if o := list.Filter("listener"); len(o.Items) > 0 {
 		if err := parseListeners(&result, o); err != nil {
 			return nil, fmt.Errorf("error parsing 'listener': %s", err)
@@ -633,6 +720,7 @@ func parseHSMs(result *Config, list *ast.ObjectList) error {
 	valid := []string{
 		"lib",
 		"slot",
+		"token_label",
 		"pin",
 		"mechanism",
 		"key_label",
@@ -656,6 +744,89 @@ func parseHSMs(result *Config, list *ast.ObjectList) error {
 	return nil
 }
 
+func parseSeals(result *Config, list *ast.ObjectList) error {
+	// A second seal is allowed to migrate the stored data from a disabled
+	// seal to the enabled one
+	if len(list.Items) > 2 {
+		return fmt.Errorf("only two 'seal' blocks are permitted")
+	}
+
+	var seals []*Seal
+	var disabled int
+	for _, item := range list.Items {
+		if len(item.Keys) == 0 {
+			return fmt.Errorf("seal type must be specified")
+		}
+		key := item.Keys[0].Token.Value().(string)
+
+		// The parameters depend on the type of the seal, which checks them
+		var m map[string]string
+		if err := hcl.DecodeObject(&m, item.Val); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("seal.%s:", key))
+		}
+
+		s := &Seal{
+			Type:   strings.ToLower(key),
+			Config: m,
+		}
+		if v, ok := m["disabled"]; ok {
+			var err error
+			s.Disabled, err = parseutil.ParseBool(v)
+			if err != nil {
+				return multierror.Prefix(err, fmt.Sprintf("seal.%s.disabled:", key))
+			}
+			delete(m, "disabled")
+		}
+		if s.Disabled {
+			disabled++
+		}
+		seals = append(seals, s)
+	}
+
+	if len(seals) == 2 && disabled != 1 {
+		return fmt.Errorf("exactly one of the two 'seal' blocks must be disabled")
+	}
+
+	result.Seals = seals
+	return nil
+}
+
+func parseEntropy(result *Config, list *ast.ObjectList) error {
+	if len(list.Items) > 1 {
+		return fmt.Errorf("only one 'entropy' block is permitted")
+	}
+
+	item := list.Items[0]
+	if len(item.Keys) == 0 {
+		return fmt.Errorf("entropy source must be specified")
+	}
+	key := item.Keys[0].Token.Value().(string)
+	if key != "seal" {
+		return fmt.Errorf("unknown entropy source %q", key)
+	}
+
+	valid := []string{
+		"mode",
+	}
+	if err := checkHCLKeys(item.Val, valid); err != nil {
+		return multierror.Prefix(err, fmt.Sprintf("entropy.%s:", key))
+	}
+
+	var m map[string]string
+	if err := hcl.DecodeObject(&m, item.Val); err != nil {
+		return multierror.Prefix(err, fmt.Sprintf("entropy.%s:", key))
+	}
+	if m["mode"] != "augmentation" {
+		return fmt.Errorf("entropy.%s: unknown mode %q", key, m["mode"])
+	}
+
+	result.Entropy = &Entropy{
+		Source: key,
+		Mode:   m["mode"],
+	}
+	return nil
+}
+
 func parseListeners(result *Config, list *ast.ObjectList) error {
 	var foundAtlas bool
 
@@ -54,6 +54,16 @@ func TestLoadConfigFile(t *testing.T) {
 			DisableClustering: true,
 		},
 
+		Seals: []*Seal{
+			&Seal{
+				Type: "awskms",
+				Config: map[string]string{
+					"region":     "us-east-1",
+					"kms_key_id": "alias/vault",
+				},
+			},
+		},
+
 		Telemetry: &Telemetry{
 			StatsdAddr:      "bar",
 			StatsiteAddr:    "foo",
@@ -188,7 +198,11 @@ func TestLoadConfigFile_json2(t *testing.T) {
 			},
 		},
 
-		CacheSize: 45678,
+		CacheSize:      45678,
+		CacheSizeBytes: 1048576,
+		CacheNegative:  true,
+
+		PerformanceStandby: true,
 
 		EnableUI: true,
 
@@ -283,6 +297,93 @@ nope = "yes"
 	}
 }
 
+func TestParseConfig_seals(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	config, err := ParseConfig(strings.TrimSpace(`
+seal "transit" {
+	key_name = "unseal"
+}
+
+seal "awskms" {
+	kms_key_id = "alias/vault"
+	disabled   = "true"
+}
+`), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*Seal{
+		&Seal{
+			Type: "transit",
+			Config: map[string]string{
+				"key_name": "unseal",
+			},
+		},
+		&Seal{
+			Type:     "awskms",
+			Disabled: true,
+			Config: map[string]string{
+				"kms_key_id": "alias/vault",
+			},
+		},
+	}
+	if !reflect.DeepEqual(config.Seals, expected) {
+		t.Fatalf("expected \n\n%#v\n\n to be \n\n%#v\n\n", config.Seals, expected)
+	}
+
+	// One of the two seals must be disabled
+	_, err = ParseConfig(strings.TrimSpace(`
+seal "transit" {
+	key_name = "unseal"
+}
+
+seal "awskms" {
+	kms_key_id = "alias/vault"
+}
+`), logger)
+	if err == nil || !strings.Contains(err.Error(), "must be disabled") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
+func TestParseConfig_entropy(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	config, err := ParseConfig(strings.TrimSpace(`
+seal "pkcs11" {
+	lib       = "/usr/lib/libhsm.so"
+	slot      = "0"
+	key_label = "vault"
+}
+
+entropy "seal" {
+	mode = "augmentation"
+}
+`), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Entropy{
+		Source: "seal",
+		Mode:   "augmentation",
+	}
+	if !reflect.DeepEqual(config.Entropy, expected) {
+		t.Fatalf("expected \n\n%#v\n\n to be \n\n%#v\n\n", config.Entropy, expected)
+	}
+
+	_, err = ParseConfig(strings.TrimSpace(`
+entropy "seal" {
+	mode = "replacement"
+}
+`), logger)
+	if err == nil || !strings.Contains(err.Error(), "unknown mode") {
+		t.Fatalf("bad: %v", err)
+	}
+}
+
 func TestParseConfig_badListener(t *testing.T) {
 	logger := logformat.NewVaultLogger(log.LevelTrace)
 
@@ -25,6 +25,11 @@ ha_backend "consul" {
     disable_clustering = "true"
 }
 
+seal "awskms" {
+    region = "us-east-1"
+    kms_key_id = "alias/vault"
+}
+
 telemetry {
     statsd_address = "bar"
     statsite_address = "foo"
@@ -0,0 +1,125 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/command/server"
+	"github.com/hashicorp/vault/vault"
+	"github.com/hashicorp/vault/vault/seal"
+	"github.com/hashicorp/vault/vault/seal/awskms"
+	"github.com/hashicorp/vault/vault/seal/azurekeyvault"
+	"github.com/hashicorp/vault/vault/seal/gcpckms"
+	"github.com/hashicorp/vault/vault/seal/pkcs11"
+	"github.com/hashicorp/vault/vault/seal/transit"
+	log "github.com/mgutz/logxi/v1"
+)
+
+// configurableSeal is the access to a key service configured by the
+// parameters of the seal block of the server configuration
+type configurableSeal interface {
+	seal.Access
+	SetConfig(map[string]string) (map[string]string, error)
+}
+
+// newSeals creates the seals of the server configuration: the enabled seal,
+// which is the default Shamir seal without a seal block, and the disabled
+// seal the stored data is migrated from, if any. A pkcs11 hsm block is the
+// enabled seal when no seal block is. With entropy augmentation, the enabled
+// seal is returned as the entropy source. The information to display about
+// the seals is added to info and infoKeys.
+func newSeals(config *server.Config, logger log.Logger, info map[string]string, infoKeys *[]string) (vault.Seal, vault.Seal, seal.EntropySource, error) {
+	configs := config.Seals
+	if config.HSM != nil {
+		for _, c := range configs {
+			if !c.Disabled {
+				return nil, nil, nil, fmt.Errorf("'hsm' and an enabled 'seal' block can't both be set")
+			}
+		}
+		configs = append(configs, &server.Seal{
+			Type:   config.HSM.Type,
+			Config: config.HSM.Config,
+		})
+	}
+
+	var enabled, disabled vault.Seal
+	var enabledAccess seal.Access
+	for _, c := range configs {
+		prefix := "seal"
+		if c.Disabled {
+			prefix = "migration seal"
+		}
+
+		s, access, err := newSeal(c, logger, prefix, info, infoKeys)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if c.Disabled {
+			disabled = s
+		} else {
+			enabled, enabledAccess = s, access
+		}
+	}
+	if enabled == nil {
+		enabled = &vault.DefaultSeal{}
+	}
+
+	if config.Entropy == nil {
+		return enabled, disabled, nil, nil
+	}
+	source, ok := enabledAccess.(seal.EntropySource)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("entropy augmentation requires a seal generating random bytes, such as the pkcs11 seal")
+	}
+	info["entropy"] = config.Entropy.Source + " " + config.Entropy.Mode
+	*infoKeys = append(*infoKeys, "entropy")
+	return enabled, disabled, source, nil
+}
+
+// newSeal creates the seal of a seal block and returns it with the access to
+// its key service, which is nil for the Shamir seal. The information to
+// display about it is added with the given prefix.
+func newSeal(config *server.Seal, logger log.Logger, prefix string, info map[string]string, infoKeys *[]string) (vault.Seal, seal.Access, error) {
+	info[prefix+" type"] = config.Type
+	*infoKeys = append(*infoKeys, prefix+" type")
+
+	var access configurableSeal
+	switch config.Type {
+	case seal.Shamir:
+		return &vault.DefaultSeal{}, nil, nil
+	case seal.AWSKMS:
+		access = awskms.NewSeal(logger)
+	case seal.GCPCKMS:
+		access = gcpckms.NewSeal(logger)
+	case seal.AzureKeyVault:
+		access = azurekeyvault.NewSeal(logger)
+	case seal.Transit:
+		access = transit.NewSeal(logger)
+	case seal.PKCS11:
+		access = pkcs11.NewSeal(logger)
+	default:
+		return nil, nil, fmt.Errorf("unknown seal type %q", config.Type)
+	}
+
+	sealInfo, err := access.SetConfig(config.Config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error configuring %s seal: %v", config.Type, err)
+	}
+	if err := access.Init(); err != nil {
+		return nil, nil, fmt.Errorf("error initializing %s seal: %v", config.Type, err)
+	}
+
+	keys := make([]string, 0, len(sealInfo))
+	for k := range sealInfo {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		key := prefix + " " + strings.ToLower(k)
+		info[key] = sealInfo[k]
+		*infoKeys = append(*infoKeys, key)
+	}
+
+	return vault.NewAutoSeal(access), access, nil
+}
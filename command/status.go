@@ -36,12 +36,14 @@ func (c *StatusCommand) Run(args []string) int {
 	}
 
 	outStr := fmt.Sprintf(
-		"Sealed: %v\n"+
+		"Type: %s\n"+
+			"Sealed: %v\n"+
 			"Key Shares: %d\n"+
 			"Key Threshold: %d\n"+
 			"Unseal Progress: %d\n"+
 			"Unseal Nonce: %v\n"+
 			"Version: %s",
+		sealStatus.Type,
 		sealStatus.Sealed,
 		sealStatus.N,
 		sealStatus.T,
@@ -49,6 +51,13 @@ func (c *StatusCommand) Run(args []string) int {
 		sealStatus.Nonce,
 		sealStatus.Version)
 
+	if sealStatus.RecoverySeal {
+		outStr += "\nRecovery Seal: true"
+	}
+	if sealStatus.Migration {
+		outStr += "\nSeal Migration in Progress: true"
+	}
+
 	if sealStatus.ClusterName != "" && sealStatus.ClusterID != "" {
 		outStr = fmt.Sprintf("%s\nCluster Name: %s\nCluster ID: %s", outStr, sealStatus.ClusterName, sealStatus.ClusterID)
 	}
@@ -0,0 +1,158 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/command/server"
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/meta"
+	"github.com/hashicorp/vault/physical"
+	log "github.com/mgutz/logxi/v1"
+	"github.com/ryanuber/columnize"
+)
+
+// StorageBenchmarkCommand is a Command that measures the latencies of the
+// storage backend of a server configuration.
+type StorageBenchmarkCommand struct {
+	meta.Meta
+}
+
+func (c *StorageBenchmarkCommand) Run(args []string) int {
+	var configPath, mix string
+	conf := &physical.BenchmarkConfig{}
+	flags := c.Meta.FlagSet("storage-benchmark", meta.FlagSetNone)
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	flags.StringVar(&configPath, "config", "", "")
+	flags.IntVar(&conf.Operations, "operations", 10000, "")
+	flags.IntVar(&conf.Concurrency, "concurrency", 16, "")
+	flags.IntVar(&conf.Keys, "keys", 1000, "")
+	flags.IntVar(&conf.ValueSize, "value-size", 1024, "")
+	flags.StringVar(&mix, "mix", "get=60,put=25,list=10,delete=5", "")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if configPath == "" {
+		c.Ui.Error("A server configuration file must be specified with -config")
+		return 1
+	}
+	var err error
+	conf.Mix, err = parseBenchmarkMix(mix)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Invalid -mix: %s", err))
+		return 1
+	}
+
+	logger := logformat.NewVaultLoggerWithWriter(os.Stderr, log.LevelInfo)
+
+	config, err := server.LoadConfig(configPath, logger)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error loading configuration from %s: %s", configPath, err))
+		return 1
+	}
+	if config.Storage == nil {
+		c.Ui.Error("A storage backend must be specified in the configuration")
+		return 1
+	}
+
+	backend, err := physical.NewBackend(config.Storage.Type, logger, config.Storage.Config)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing storage of type %s: %s", config.Storage.Type, err))
+		return 1
+	}
+	if raftStorage, ok := backend.(*physical.RaftBackend); ok {
+		defer raftStorage.Close()
+		if err := raftStorage.WaitForLeadership(30 * time.Second); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error waiting for raft leadership: %s", err))
+			return 1
+		}
+	}
+
+	result, err := physical.Benchmark(backend, conf, logger)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error running benchmark: %s", err))
+		return 1
+	}
+
+	columns := []string{"Operation | Count | Errors | Min | Mean | P50 | P90 | P99 | Max"}
+	for _, op := range result.Operations() {
+		stats := result.Stats[op]
+		columns = append(columns, fmt.Sprintf(
+			"%s | %d | %d | %s | %s | %s | %s | %s | %s", op, stats.Count, stats.Errors,
+			formatBenchmarkLatency(stats.Min), formatBenchmarkLatency(stats.Mean),
+			formatBenchmarkLatency(stats.P50), formatBenchmarkLatency(stats.P90),
+			formatBenchmarkLatency(stats.P99), formatBenchmarkLatency(stats.Max)))
+	}
+	c.Ui.Output(columnize.SimpleFormat(columns))
+	c.Ui.Output(fmt.Sprintf("\n%d operations in %s (%.1f ops/s)",
+		conf.Operations, result.Duration-result.Duration%time.Millisecond, result.OperationsPerSecond()))
+	return 0
+}
+
+// parseBenchmarkMix parses the weights of the operations of a benchmark, in
+// the form "get=60,put=40"
+func parseBenchmarkMix(mix string) (map[physical.Operation]int, error) {
+	result := make(map[physical.Operation]int)
+	for _, part := range strings.Split(mix, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("expected operation=weight, got %q", part)
+		}
+		weight, err := strconv.Atoi(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight for %s: %v", kv[0], err)
+		}
+		result[physical.Operation(strings.ToLower(kv[0]))] = weight
+	}
+	return result, nil
+}
+
+func formatBenchmarkLatency(d time.Duration) string {
+	return (d - d%time.Microsecond).String()
+}
+
+func (c *StorageBenchmarkCommand) Synopsis() string {
+	return "Measure the latencies of a storage backend"
+}
+
+func (c *StorageBenchmarkCommand) Help() string {
+	helpText := `
+Usage: vault storage-benchmark -config=<path> [options]
+
+  Run a workload of reads, writes, lists and deletes against the storage
+  backend of a server configuration, and report the latencies of the
+  operations. This helps sizing a storage backend before Vault uses it.
+
+  The workload only uses keys under a "storage-benchmark/" path unique to
+  the run, which Vault never uses, and deletes them once it completes, so
+  the command can run against a storage already holding the data of Vault.
+  It adds load to the storage though, which slows down a running Vault.
+
+Storage Benchmark Options:
+
+  -config=<path>          Path to the server configuration file, or to a
+                          directory of configuration files. Only its
+                          "storage" block is used.
+
+  -operations=10000       Number of operations to run.
+
+  -concurrency=16         Number of operations running in parallel.
+
+  -keys=1000              Number of keys the operations are spread over.
+                          They are written before the measured operations.
+
+  -value-size=1024        Size in bytes of the written values.
+
+  -mix=<weights>          Weights of the operations in the workload. The
+                          default is "get=60,put=25,list=10,delete=5".
+`
+	return strings.TrimSpace(helpText)
+}
@@ -0,0 +1,92 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/meta"
+	"github.com/hashicorp/vault/physical"
+	log "github.com/mgutz/logxi/v1"
+	"github.com/mitchellh/cli"
+)
+
+func TestStorageBenchmark(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-benchmark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	storagePath := filepath.Join(dir, "storage")
+	configPath := filepath.Join(dir, "config.hcl")
+	config := fmt.Sprintf(`
+storage "file" {
+  path = %q
+}
+`, storagePath)
+	if err := ioutil.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	storage, err := physical.NewBackend("file", logger, map[string]string{"path": storagePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(&physical.Entry{Key: "core/keyring", Value: []byte("keyring")}); err != nil {
+		t.Fatal(err)
+	}
+
+	ui := new(cli.MockUi)
+	c := &StorageBenchmarkCommand{
+		Meta: meta.Meta{
+			Ui: ui,
+		},
+	}
+	args := []string{"-config", configPath, "-operations", "200", "-keys", "20", "-mix", "get=3,put=1"}
+	if code := c.Run(args); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	output := ui.OutputWriter.String()
+	for _, expected := range []string{"get", "put", "200 operations"} {
+		if !strings.Contains(output, expected) {
+			t.Fatalf("expected %q in output:\n%s", expected, output)
+		}
+	}
+
+	// Only the data of the benchmark is removed
+	keys, err := storage.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"core/"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+}
+
+func TestParseBenchmarkMix(t *testing.T) {
+	mix, err := parseBenchmarkMix("get=60, PUT=30,delete=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[physical.Operation]int{
+		physical.GetOperation:    60,
+		physical.PutOperation:    30,
+		physical.DeleteOperation: 10,
+	}
+	if !reflect.DeepEqual(mix, expected) {
+		t.Fatalf("bad: %v", mix)
+	}
+
+	for _, invalid := range []string{"get", "get=a"} {
+		if _, err := parseBenchmarkMix(invalid); err == nil {
+			t.Fatalf("expected error for %q", invalid)
+		}
+	}
+}
@@ -17,7 +17,7 @@ type TokenCreateCommand struct {
 
 func (c *TokenCreateCommand) Run(args []string) int {
 	var format string
-	var id, displayName, lease, ttl, explicitMaxTTL, period, role string
+	var id, displayName, lease, ttl, explicitMaxTTL, period, role, tokenType string
 	var orphan, noDefaultPolicy, renewable bool
 	var metadata map[string]string
 	var numUses int
@@ -31,6 +31,7 @@ func (c *TokenCreateCommand) Run(args []string) int {
 	flags.StringVar(&explicitMaxTTL, "explicit-max-ttl", "", "")
 	flags.StringVar(&period, "period", "", "")
 	flags.StringVar(&role, "role", "", "")
+	flags.StringVar(&tokenType, "type", "", "")
 	flags.BoolVar(&orphan, "orphan", false, "")
 	flags.BoolVar(&renewable, "renewable", true, "")
 	flags.BoolVar(&noDefaultPolicy, "no-default-policy", false, "")
@@ -73,6 +74,7 @@ func (c *TokenCreateCommand) Run(args []string) int {
 		Renewable:       new(bool),
 		ExplicitMaxTTL:  explicitMaxTTL,
 		Period:          period,
+		Type:            tokenType,
 	}
 	*tcr.Renewable = renewable
 
@@ -142,6 +144,10 @@ Token Options:
                           also set) but every renewal will use the given
                           period. Requires a root/sudo token to use.
 
+  -type="service"         The type of the token, "service" or "batch". Batch
+                          tokens are not persisted, and cannot be renewed or
+                          revoked; they expire at the end of their TTL.
+
   -renewable=true         Whether or not the token is renewable to extend its
                           TTL up to Vault's configured maximum TTL for tokens.
                           This defaults to true; set to false to disable
@@ -4,9 +4,13 @@ import (
 	"encoding/hex"
 	"testing"
 
+	"github.com/hashicorp/vault/helper/logformat"
 	"github.com/hashicorp/vault/http"
 	"github.com/hashicorp/vault/meta"
+	"github.com/hashicorp/vault/physical"
 	"github.com/hashicorp/vault/vault"
+	"github.com/hashicorp/vault/vault/seal"
+	log "github.com/mgutz/logxi/v1"
 	"github.com/mitchellh/cli"
 )
 
@@ -70,3 +74,59 @@ func TestUnseal_arg(t *testing.T) {
 		t.Fatal("should not be sealed")
 	}
 }
+
+func TestUnseal_migrate(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	inm := physical.NewInmem(logger)
+
+	core, err := vault.NewCore(&vault.CoreConfig{
+		Physical:     inm,
+		Logger:       logger,
+		DisableMlock: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := vault.TestCoreInit(t, core)
+
+	core, err = vault.NewCore(&vault.CoreConfig{
+		Physical:     inm,
+		Seal:         vault.NewAutoSeal(seal.NewTestSeal()),
+		Logger:       logger,
+		DisableMlock: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, addr := http.TestServer(t, core)
+	defer ln.Close()
+
+	ui := new(cli.MockUi)
+	c := &UnsealCommand{
+		Meta: meta.Meta{
+			Ui: ui,
+		},
+	}
+	args := []string{"-address", addr, hex.EncodeToString(keys[0])}
+	if code := c.Run(args); code == 0 {
+		t.Fatal("expected unsealing without migrating to fail")
+	}
+
+	for _, key := range keys {
+		args := []string{"-address", addr, "-migrate", hex.EncodeToString(key)}
+		if code := c.Run(args); code != 0 {
+			t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+		}
+	}
+
+	sealed, err := core.Sealed()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if sealed {
+		t.Fatal("should not be sealed")
+	}
+	if core.SealMigrationPending() {
+		t.Fatal("expected complete seal migration")
+	}
+}
@@ -7,8 +7,6 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
-	"github.com/aws/aws-sdk-go/aws/ec2metadata"
-	"github.com/aws/aws-sdk-go/aws/session"
 )
 
 type CredentialsConfig struct {
@@ -65,12 +63,16 @@ func (c *CredentialsConfig) GenerateCredentialChain() (*credentials.Credentials,
 		Profile:  c.Profile,
 	})
 
-	// Add the instance metadata role provider
+	// Add the instance metadata role provider, which uses IMDSv2 when the
+	// instance supports it
+	imds := &IMDSClient{
+		HTTPClient: c.HTTPClient,
+	}
 	providers = append(providers, &ec2rolecreds.EC2RoleProvider{
-		Client: ec2metadata.New(session.New(&aws.Config{
+		Client: imds.EC2MetadataClient(&aws.Config{
 			Region:     aws.String(c.Region),
 			HTTPClient: c.HTTPClient,
-		})),
+		}),
 		ExpiryWindow: 15,
 	})
 
@@ -0,0 +1,152 @@
+package awsutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+const (
+	// DefaultIMDSEndpoint is the endpoint of the EC2 instance metadata
+	// service
+	DefaultIMDSEndpoint = "http://169.254.169.254/latest"
+
+	imdsTokenHeader    = "X-aws-ec2-metadata-token"
+	imdsTokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+
+	// imdsTokenTTL is the lifetime of the requested session tokens, which
+	// are renewed a minute before they expire
+	imdsTokenTTL = 6 * time.Hour
+)
+
+// IMDSClient reads the EC2 instance metadata with IMDSv2 session tokens.
+// When the metadata service does not issue tokens, the requests are made
+// without one, as with IMDSv1.
+type IMDSClient struct {
+	// Endpoint defaults to DefaultIMDSEndpoint
+	Endpoint string
+
+	// HTTPClient defaults to a client with a short timeout, since the
+	// metadata service is local
+	HTTPClient *http.Client
+
+	l          sync.Mutex
+	token      string
+	expiration time.Time
+}
+
+func (c *IMDSClient) endpoint() string {
+	if c.Endpoint == "" {
+		return DefaultIMDSEndpoint
+	}
+	return strings.TrimSuffix(c.Endpoint, "/")
+}
+
+func (c *IMDSClient) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		client := cleanhttp.DefaultClient()
+		client.Timeout = 5 * time.Second
+		return client
+	}
+	return c.HTTPClient
+}
+
+// Token returns a session token, or an empty string if the metadata service
+// does not support IMDSv2
+func (c *IMDSClient) Token() (string, error) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if c.token != "" && time.Now().Before(c.expiration) {
+		return c.token, nil
+	}
+
+	req, err := http.NewRequest("PUT", c.endpoint()+"/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(imdsTokenTTLHeader, fmt.Sprintf("%d", int(imdsTokenTTL/time.Second)))
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		// The token response may not reach containers when the hop limit of
+		// the instance is too low, in which case IMDSv1 may still work
+		return "", nil
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusForbidden:
+		return "", fmt.Errorf("access to the instance metadata service is disabled")
+	default:
+		// The metadata service only supports IMDSv1
+		return "", nil
+	}
+
+	c.token = string(body)
+	c.expiration = time.Now().Add(imdsTokenTTL - time.Minute)
+	return c.token, nil
+}
+
+// Get reads the metadata at the path, such as
+// "dynamic/instance-identity/pkcs7"
+func (c *IMDSClient) Get(path string) (string, error) {
+	token, err := c.Token()
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("GET", c.endpoint()+"/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	if token != "" {
+		req.Header.Set(imdsTokenHeader, token)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to read instance metadata: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to read instance metadata %q: status %d", path, resp.StatusCode)
+	}
+	return string(body), nil
+}
+
+// EC2MetadataClient returns an aws-sdk-go metadata client whose requests
+// carry the session tokens of the IMDS client
+func (c *IMDSClient) EC2MetadataClient(config *aws.Config) *ec2metadata.EC2Metadata {
+	client := ec2metadata.New(session.New(config))
+	client.Handlers.Sign.PushBack(func(r *request.Request) {
+		token, err := c.Token()
+		if err != nil {
+			r.Error = err
+			return
+		}
+		if token != "" {
+			r.HTTPRequest.Header.Set(imdsTokenHeader, token)
+		}
+	})
+	return client
+}
@@ -0,0 +1,65 @@
+package awsutil
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testIMDS serves the instance identity document, requiring a session
+// token when v2 is set
+func testIMDS(t *testing.T, v2 bool) (*httptest.Server, *int) {
+	tokenRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/latest/api/token" && r.Method == "PUT":
+			if !v2 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if r.Header.Get(imdsTokenTTLHeader) == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			tokenRequests++
+			fmt.Fprint(w, "session-token")
+		case r.URL.Path == "/latest/dynamic/instance-identity/pkcs7" && r.Method == "GET":
+			if v2 && r.Header.Get(imdsTokenHeader) != "session-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, "pkcs7")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server, &tokenRequests
+}
+
+func TestIMDSClient_Get(t *testing.T) {
+	for _, v2 := range []bool{true, false} {
+		server, tokenRequests := testIMDS(t, v2)
+		client := &IMDSClient{
+			Endpoint: server.URL + "/latest",
+		}
+
+		for i := 0; i < 2; i++ {
+			doc, err := client.Get("dynamic/instance-identity/pkcs7")
+			if err != nil {
+				t.Fatalf("v2=%t: %v", v2, err)
+			}
+			if doc != "pkcs7" {
+				t.Fatalf("v2=%t: bad: %q", v2, doc)
+			}
+		}
+		if v2 && *tokenRequests != 1 {
+			t.Fatalf("expected the session token to be cached, got %d token requests", *tokenRequests)
+		}
+
+		if _, err := client.Get("meta-data/missing"); err == nil {
+			t.Fatalf("v2=%t: expected error for missing metadata", v2)
+		}
+		server.Close()
+	}
+}
@@ -0,0 +1,52 @@
+package awsutil
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/jsonrpc"
+)
+
+// KMSClient is a client of the AWS KMS API. The KMS service package of the
+// SDK isn't vendored, so the operations are sent with the SDK's JSON RPC
+// protocol, using input and output structs following the API reference.
+type KMSClient struct {
+	*client.Client
+}
+
+// NewKMSClient returns a KMS client using the given configuration
+func NewKMSClient(awsConfig *aws.Config) *KMSClient {
+	c := session.New(awsConfig).ClientConfig("kms")
+	kmsClient := client.New(
+		*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   "kms",
+			SigningName:   c.SigningName,
+			SigningRegion: c.SigningRegion,
+			Endpoint:      c.Endpoint,
+			APIVersion:    "2014-11-01",
+			JSONVersion:   "1.1",
+			TargetPrefix:  "TrentService",
+		},
+		c.Handlers,
+	)
+	kmsClient.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	kmsClient.Handlers.Build.PushBackNamed(jsonrpc.BuildHandler)
+	kmsClient.Handlers.Unmarshal.PushBackNamed(jsonrpc.UnmarshalHandler)
+	kmsClient.Handlers.UnmarshalMeta.PushBackNamed(jsonrpc.UnmarshalMetaHandler)
+	kmsClient.Handlers.UnmarshalError.PushBackNamed(jsonrpc.UnmarshalErrorHandler)
+
+	return &KMSClient{Client: kmsClient}
+}
+
+// Send sends a KMS operation, such as "Encrypt"
+func (c *KMSClient) Send(operation string, input, output interface{}) error {
+	return c.NewRequest(&request.Operation{
+		Name:       operation,
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}, input, output).Send()
+}
@@ -3,9 +3,13 @@ package builtinplugins
 import (
 	"github.com/hashicorp/vault/plugins/database/cassandra"
 	"github.com/hashicorp/vault/plugins/database/mongodb"
+	"github.com/hashicorp/vault/plugins/database/mongodbatlas"
 	"github.com/hashicorp/vault/plugins/database/mssql"
 	"github.com/hashicorp/vault/plugins/database/mysql"
 	"github.com/hashicorp/vault/plugins/database/postgresql"
+	"github.com/hashicorp/vault/plugins/database/redis"
+	"github.com/hashicorp/vault/plugins/database/redisenterprise"
+	"github.com/hashicorp/vault/plugins/database/snowflake"
 )
 
 type BuiltinFactory func() (interface{}, error)
@@ -18,10 +22,14 @@ var plugins map[string]BuiltinFactory = map[string]BuiltinFactory{
 	"mysql-rds-database-plugin":    mysql.New(mysql.LegacyMetadataLen, mysql.LegacyUsernameLen),
 	"mysql-legacy-database-plugin": mysql.New(mysql.LegacyMetadataLen, mysql.LegacyUsernameLen),
 
-	"postgresql-database-plugin": postgresql.New,
-	"mssql-database-plugin":      mssql.New,
-	"cassandra-database-plugin":  cassandra.New,
-	"mongodb-database-plugin":    mongodb.New,
+	"postgresql-database-plugin":      postgresql.New,
+	"mssql-database-plugin":           mssql.New,
+	"cassandra-database-plugin":       cassandra.New,
+	"mongodb-database-plugin":         mongodb.New,
+	"mongodbatlas-database-plugin":    mongodbatlas.New,
+	"snowflake-database-plugin":       snowflake.New,
+	"redis-database-plugin":           redis.New,
+	"redisenterprise-database-plugin": redisenterprise.New,
 }
 
 func Get(name string) (BuiltinFactory, bool) {
@@ -2,6 +2,9 @@ package certutil
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"reflect"
@@ -323,6 +326,26 @@ func compareCSRBundleToParsedCSRBundle(csrbut *CSRBundle, pcsrbut *ParsedCSRBund
 	return nil
 }
 
+func TestMarshalPKCS8RSAPrivateKey(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := MarshalPKCS8RSAPrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, privateKey) {
+		t.Fatal("parsed key does not match the marshalled key")
+	}
+}
+
 func TestTLSConfig(t *testing.T) {
 	cbut := refreshRSACertBundle()
 
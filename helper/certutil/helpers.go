@@ -9,6 +9,8 @@ import (
 	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"fmt"
 	"math/big"
@@ -225,6 +227,28 @@ func GeneratePrivateKey(keyType string, keyBits int, container ParsedPrivateKeyC
 	return nil
 }
 
+// pkcs8 is the ASN.1 structure of PKCS #8 private keys
+type pkcs8 struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+var oidPublicKeyRSA = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+
+// MarshalPKCS8RSAPrivateKey returns the DER encoded PKCS #8 form of an RSA
+// private key, which some clients require over the PKCS #1 form.
+func MarshalPKCS8RSAPrivateKey(privateKey *rsa.PrivateKey) ([]byte, error) {
+	return asn1.Marshal(pkcs8{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm: oidPublicKeyRSA,
+			// The parameters of RSA keys are NULL
+			Parameters: asn1.RawValue{Tag: asn1.TagNull},
+		},
+		PrivateKey: x509.MarshalPKCS1PrivateKey(privateKey),
+	})
+}
+
 // GenerateSerialNumber generates a serial number suitable for a certificate
 func GenerateSerialNumber() (*big.Int, error) {
 	serial, err := rand.Int(rand.Reader, (&big.Int{}).Exp(big.NewInt(2), big.NewInt(159), nil))
@@ -1,20 +1,55 @@
 package consts
 
+// ReplicationState is a set of flags, since a cluster can take part in
+// performance and disaster recovery replication at the same time
 type ReplicationState uint32
 
 const (
-	ReplicationDisabled ReplicationState = iota
-	ReplicationPrimary
-	ReplicationSecondary
+	ReplicationDisabled  ReplicationState = 0
+	ReplicationPrimary   ReplicationState = 1 << 0
+	ReplicationSecondary ReplicationState = 1 << 1
+
+	// ReplicationDRPrimary and ReplicationDRSecondary are the states of the
+	// clusters in disaster recovery replication
+	ReplicationDRPrimary   ReplicationState = 1 << 2
+	ReplicationDRSecondary ReplicationState = 1 << 3
 )
 
+// String returns the mode of the performance replication
 func (r ReplicationState) String() string {
-	switch r {
-	case ReplicationSecondary:
+	switch {
+	case r.HasState(ReplicationSecondary):
+		return "secondary"
+	case r.HasState(ReplicationPrimary):
+		return "primary"
+	}
+
+	return "disabled"
+}
+
+// GetDRString returns the mode of the disaster recovery replication
+func (r ReplicationState) GetDRString() string {
+	switch {
+	case r.HasState(ReplicationDRSecondary):
 		return "secondary"
-	case ReplicationPrimary:
+	case r.HasState(ReplicationDRPrimary):
 		return "primary"
 	}
 
 	return "disabled"
 }
+
+// HasState returns whether the given flag is set
+func (r ReplicationState) HasState(flag ReplicationState) bool {
+	return r&flag != 0
+}
+
+// AddState sets the given flag
+func (r *ReplicationState) AddState(flag ReplicationState) {
+	*r |= flag
+}
+
+// ClearState clears the given flag
+func (r *ReplicationState) ClearState(flag ReplicationState) {
+	*r &^= flag
+}
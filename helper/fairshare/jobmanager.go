@@ -0,0 +1,159 @@
+// Package fairshare runs jobs on a bounded pool of workers, sharing the
+// workers fairly between queues so that a queue with a large backlog does not
+// delay the jobs of the other queues.
+package fairshare
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Job is a unit of work run by a JobManager
+type Job interface {
+	// Execute runs the job
+	Execute() error
+
+	// OnFailure is called with the error returned by Execute when the job
+	// fails
+	OnFailure(err error)
+}
+
+// JobManager runs the jobs of its queues on a fixed number of workers. The
+// workers take the jobs from the queues having pending jobs in turns, so that
+// every queue gets an equal share of the workers.
+type JobManager struct {
+	workerCount int
+
+	l    sync.Mutex
+	cond *sync.Cond
+
+	// queues holds the pending jobs by queue ID, and order the IDs of the
+	// queues having pending jobs, in the order they are served
+	queues  map[string]*list.List
+	order   []string
+	next    int
+	pending int
+
+	running bool
+	wg      sync.WaitGroup
+}
+
+// NewJobManager returns a JobManager running its jobs on the given number of
+// workers. Jobs are not run until the manager is started.
+func NewJobManager(workerCount int) *JobManager {
+	if workerCount < 1 {
+		workerCount = 1
+	}
+	m := &JobManager{
+		workerCount: workerCount,
+		queues:      make(map[string]*list.List),
+	}
+	m.cond = sync.NewCond(&m.l)
+	return m
+}
+
+// Start starts the workers, unless they are already running. A stopped
+// manager can be started again.
+func (m *JobManager) Start() {
+	m.l.Lock()
+	defer m.l.Unlock()
+	if m.running {
+		return
+	}
+	m.running = true
+
+	for i := 0; i < m.workerCount; i++ {
+		m.wg.Add(1)
+		go m.work()
+	}
+}
+
+// Stop stops the workers once they are done with the jobs they are running,
+// and drops the pending jobs
+func (m *JobManager) Stop() {
+	m.l.Lock()
+	if !m.running {
+		m.l.Unlock()
+		return
+	}
+	m.running = false
+	m.queues = make(map[string]*list.List)
+	m.order = nil
+	m.next = 0
+	m.pending = 0
+	m.cond.Broadcast()
+	m.l.Unlock()
+
+	m.wg.Wait()
+}
+
+// AddJob adds a job to the queue with the given ID. Jobs added to a stopped
+// manager are dropped.
+func (m *JobManager) AddJob(job Job, queueID string) {
+	m.l.Lock()
+	defer m.l.Unlock()
+	if !m.running {
+		return
+	}
+
+	queue, ok := m.queues[queueID]
+	if !ok {
+		queue = list.New()
+		m.queues[queueID] = queue
+		m.order = append(m.order, queueID)
+	}
+	queue.PushBack(job)
+	m.pending++
+	m.cond.Signal()
+}
+
+// PendingJobs returns the number of jobs waiting for a worker
+func (m *JobManager) PendingJobs() int {
+	m.l.Lock()
+	defer m.l.Unlock()
+	return m.pending
+}
+
+// work runs jobs until the manager is stopped
+func (m *JobManager) work() {
+	defer m.wg.Done()
+	for {
+		job := m.nextJob()
+		if job == nil {
+			return
+		}
+		if err := job.Execute(); err != nil {
+			job.OnFailure(err)
+		}
+	}
+}
+
+// nextJob waits for a pending job and takes it from the next queue in turn.
+// It returns nil once the manager is stopped.
+func (m *JobManager) nextJob() Job {
+	m.l.Lock()
+	defer m.l.Unlock()
+	for m.running && m.pending == 0 {
+		m.cond.Wait()
+	}
+	if !m.running {
+		return nil
+	}
+
+	if m.next >= len(m.order) {
+		m.next = 0
+	}
+	queueID := m.order[m.next]
+	queue := m.queues[queueID]
+	job := queue.Remove(queue.Front()).(Job)
+	m.pending--
+
+	// Empty queues leave the rotation until they get jobs again
+	if queue.Len() == 0 {
+		delete(m.queues, queueID)
+		m.order = append(m.order[:m.next], m.order[m.next+1:]...)
+	} else {
+		m.next++
+	}
+	return job
+}
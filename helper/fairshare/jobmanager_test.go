@@ -0,0 +1,126 @@
+package fairshare
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testJob struct {
+	queue string
+	fail  bool
+
+	l       *sync.Mutex
+	order   *[]string
+	failed  *int
+	started chan struct{}
+	release chan struct{}
+}
+
+func (j *testJob) Execute() error {
+	if j.started != nil {
+		close(j.started)
+		<-j.release
+	}
+	j.l.Lock()
+	*j.order = append(*j.order, j.queue)
+	j.l.Unlock()
+	if j.fail {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+func (j *testJob) OnFailure(err error) {
+	j.l.Lock()
+	*j.failed++
+	j.l.Unlock()
+}
+
+func TestJobManager_fairshare(t *testing.T) {
+	m := NewJobManager(1)
+	m.Start()
+	defer m.Stop()
+
+	var l sync.Mutex
+	var order []string
+	var failed int
+	newJob := func(queue string) *testJob {
+		return &testJob{queue: queue, l: &l, order: &order, failed: &failed}
+	}
+
+	// Block the worker while the queues are filled
+	blocker := newJob("blocker")
+	blocker.started = make(chan struct{})
+	blocker.release = make(chan struct{})
+	m.AddJob(blocker, "blocker")
+	<-blocker.started
+
+	for i := 0; i < 4; i++ {
+		m.AddJob(newJob("busy"), "busy")
+	}
+	quiet := newJob("quiet")
+	quiet.fail = true
+	m.AddJob(quiet, "quiet")
+	if pending := m.PendingJobs(); pending != 5 {
+		t.Fatalf("bad pending jobs: %d", pending)
+	}
+	close(blocker.release)
+
+	expected := []string{"blocker", "busy", "quiet", "busy", "busy", "busy"}
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		l.Lock()
+		done := len(order) == len(expected) && failed == 1
+		l.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	if len(order) != len(expected) {
+		t.Fatalf("bad order: %v", order)
+	}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("bad order: %v", order)
+		}
+	}
+	if failed != 1 {
+		t.Fatalf("expected a failed job, got %d", failed)
+	}
+}
+
+func TestJobManager_stop(t *testing.T) {
+	m := NewJobManager(4)
+	m.Start()
+	m.Stop()
+
+	var l sync.Mutex
+	var order []string
+	var failed int
+	m.AddJob(&testJob{queue: "a", l: &l, order: &order, failed: &failed}, "a")
+	if pending := m.PendingJobs(); pending != 0 {
+		t.Fatalf("expected the jobs of a stopped manager to be dropped, got %d", pending)
+	}
+
+	// Stopped managers can be started again
+	m.Start()
+	defer m.Stop()
+	m.AddJob(&testJob{queue: "a", l: &l, order: &order, failed: &failed}, "a")
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		l.Lock()
+		done := len(order) == 1
+		l.Unlock()
+		if done {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("job was not run")
+}
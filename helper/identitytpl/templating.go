@@ -0,0 +1,103 @@
+package identitytpl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+var (
+	// ErrUnbalancedTemplatingCharacter is returned when a template has an
+	// opening "{{" without a matching "}}", or vice versa
+	ErrUnbalancedTemplatingCharacter = errors.New("unbalanced templating characters")
+
+	// ErrNoEntityAttachedToRequest is returned when a template needs entity
+	// information but the request carries none
+	ErrNoEntityAttachedToRequest = errors.New("string contains entity template directives but no entity was provided")
+
+	// ErrTemplateValueNotFound is returned when a template references a
+	// metadata key that is not set on the entity
+	ErrTemplateValueNotFound = errors.New("no value could be found for one of the template directives")
+)
+
+// PopulateString replaces identity template directives in input with values
+// taken from the given entity. Supported directives are:
+//
+//	{{identity.entity.name}}
+//	{{identity.entity.metadata.<key>}}
+//
+// The boolean return value indicates whether any templating took place.
+func PopulateString(entity *logical.Entity, input string) (bool, string, error) {
+	if !strings.Contains(input, "{{") && !strings.Contains(input, "}}") {
+		return false, input, nil
+	}
+
+	var b bytes.Buffer
+	subst := false
+	remaining := input
+	for {
+		start := strings.Index(remaining, "{{")
+		end := strings.Index(remaining, "}}")
+		switch {
+		case start == -1 && end == -1:
+			b.WriteString(remaining)
+			return subst, b.String(), nil
+		case start == -1 || end == -1 || end < start:
+			return false, "", ErrUnbalancedTemplatingCharacter
+		}
+
+		b.WriteString(remaining[:start])
+		directive := strings.TrimSpace(remaining[start+2 : end])
+		value, err := lookup(entity, directive)
+		if err != nil {
+			return false, "", err
+		}
+		b.WriteString(value)
+		subst = true
+		remaining = remaining[end+2:]
+	}
+}
+
+// PopulateStrings runs PopulateString over each input, returning the
+// populated values in the same order.
+func PopulateStrings(entity *logical.Entity, inputs []string) ([]string, error) {
+	ret := make([]string, 0, len(inputs))
+	for _, input := range inputs {
+		_, out, err := PopulateString(entity, input)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, out)
+	}
+	return ret, nil
+}
+
+func lookup(entity *logical.Entity, directive string) (string, error) {
+	if !strings.HasPrefix(directive, "identity.entity.") {
+		return "", fmt.Errorf("unsupported template directive %q", directive)
+	}
+	if entity == nil {
+		return "", ErrNoEntityAttachedToRequest
+	}
+
+	field := strings.TrimPrefix(directive, "identity.entity.")
+	switch {
+	case field == "name":
+		if entity.Name == "" {
+			return "", ErrTemplateValueNotFound
+		}
+		return entity.Name, nil
+
+	case strings.HasPrefix(field, "metadata."):
+		value, ok := entity.Metadata[strings.TrimPrefix(field, "metadata.")]
+		if !ok || value == "" {
+			return "", ErrTemplateValueNotFound
+		}
+		return value, nil
+	}
+
+	return "", fmt.Errorf("unsupported template directive %q", directive)
+}
@@ -0,0 +1,51 @@
+package identitytpl
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestPopulateString(t *testing.T) {
+	entity := &logical.Entity{
+		Name: "bob",
+		Metadata: map[string]string{
+			"team": "infra",
+		},
+	}
+
+	tests := []struct {
+		input  string
+		output string
+		subst  bool
+		err    bool
+	}{
+		{input: "example.com", output: "example.com"},
+		{input: "{{identity.entity.metadata.team}}.example.com", output: "infra.example.com", subst: true},
+		{input: "{{ identity.entity.name }}-{{identity.entity.metadata.team}}", output: "bob-infra", subst: true},
+		{input: "{{identity.entity.metadata.missing}}.example.com", err: true},
+		{input: "{{identity.entity.id}}", err: true},
+		{input: "{{identity.entity.name", err: true},
+		{input: "identity.entity.name}}", err: true},
+	}
+
+	for _, tc := range tests {
+		subst, out, err := PopulateString(entity, tc.input)
+		if (err != nil) != tc.err {
+			t.Fatalf("input %q: unexpected error state: %v", tc.input, err)
+		}
+		if tc.err {
+			continue
+		}
+		if subst != tc.subst {
+			t.Fatalf("input %q: expected subst %t, got %t", tc.input, tc.subst, subst)
+		}
+		if out != tc.output {
+			t.Fatalf("input %q: expected %q, got %q", tc.input, tc.output, out)
+		}
+	}
+
+	if _, _, err := PopulateString(nil, "{{identity.entity.name}}"); err != ErrNoEntityAttachedToRequest {
+		t.Fatalf("expected missing entity error, got %v", err)
+	}
+}
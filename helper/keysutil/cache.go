@@ -0,0 +1,74 @@
+package keysutil
+
+import (
+	"github.com/hashicorp/golang-lru"
+)
+
+const (
+	// MinCacheSize is the smallest size allowed for a bounded policy cache
+	MinCacheSize = 10
+)
+
+// policyCache is an in-memory cache of policies, keyed by name. Callers are
+// responsible for synchronization.
+type policyCache interface {
+	Get(name string) *Policy
+	Add(name string, p *Policy)
+	Remove(name string)
+	Len() int
+}
+
+// newPolicyCache returns an unbounded cache if size is zero, and an LRU
+// cache holding at most size policies otherwise
+func newPolicyCache(size int) (policyCache, error) {
+	if size == 0 {
+		return mapCache{}, nil
+	}
+	cache, err := lru.New2Q(size)
+	if err != nil {
+		return nil, err
+	}
+	return &lruCache{lru: cache}, nil
+}
+
+type mapCache map[string]*Policy
+
+func (c mapCache) Get(name string) *Policy {
+	return c[name]
+}
+
+func (c mapCache) Add(name string, p *Policy) {
+	c[name] = p
+}
+
+func (c mapCache) Remove(name string) {
+	delete(c, name)
+}
+
+func (c mapCache) Len() int {
+	return len(c)
+}
+
+type lruCache struct {
+	lru *lru.TwoQueueCache
+}
+
+func (c *lruCache) Get(name string) *Policy {
+	raw, ok := c.lru.Get(name)
+	if !ok {
+		return nil
+	}
+	return raw.(*Policy)
+}
+
+func (c *lruCache) Add(name string, p *Policy) {
+	c.lru.Add(name, p)
+}
+
+func (c *lruCache) Remove(name string) {
+	c.lru.Remove(name)
+}
+
+func (c *lruCache) Len() int {
+	return c.lru.Len()
+}
@@ -0,0 +1,148 @@
+package keysutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	uuid "github.com/hashicorp/go-uuid"
+)
+
+// kwpIV is the alternative initial value prefix from RFC 5649 section 3
+var kwpIV = []byte{0xA6, 0x59, 0x59, 0xA6}
+
+// WrapKeyMaterial wraps key material for transport to a holder of the
+// private half of the given RSA key. An ephemeral AES-256 key is encrypted
+// with RSA-OAEP using the given hash, followed by the key material wrapped
+// with the ephemeral key using AES key wrap with padding (RFC 5649).
+func WrapKeyMaterial(pub *rsa.PublicKey, hash crypto.Hash, keyMaterial []byte) ([]byte, error) {
+	ephemeralKey, err := uuid.GenerateRandomBytes(32)
+	if err != nil {
+		return nil, err
+	}
+
+	wrappedEphemeralKey, err := rsa.EncryptOAEP(hash.New(), rand.Reader, pub, ephemeralKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting ephemeral key: %v", err)
+	}
+
+	wrappedKey, err := wrapKWP(ephemeralKey, keyMaterial)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(wrappedEphemeralKey, wrappedKey...), nil
+}
+
+// UnwrapKeyMaterial reverses WrapKeyMaterial
+func UnwrapKeyMaterial(priv *rsa.PrivateKey, hash crypto.Hash, ciphertext []byte) ([]byte, error) {
+	size := priv.PublicKey.N.BitLen() / 8
+	if len(ciphertext) <= size {
+		return nil, errors.New("wrapped key material is too short")
+	}
+
+	ephemeralKey, err := rsa.DecryptOAEP(hash.New(), rand.Reader, priv, ciphertext[:size], nil)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting ephemeral key: %v", err)
+	}
+
+	return unwrapKWP(ephemeralKey, ciphertext[size:])
+}
+
+// wrapKWP implements AES key wrap with padding, as described in RFC 5649
+func wrapKWP(kek, plaintext []byte) ([]byte, error) {
+	if len(plaintext) == 0 {
+		return nil, errors.New("cannot wrap empty key material")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	aiv := make([]byte, 8)
+	copy(aiv, kwpIV)
+	binary.BigEndian.PutUint32(aiv[4:], uint32(len(plaintext)))
+
+	padded := make([]byte, (len(plaintext)+7)/8*8)
+	copy(padded, plaintext)
+
+	if len(padded) == 8 {
+		ret := make([]byte, 16)
+		block.Encrypt(ret, append(aiv, padded...))
+		return ret, nil
+	}
+
+	n := len(padded) / 8
+	a := aiv
+	r := padded
+	b := make([]byte, 16)
+	for j := 0; j < 6; j++ {
+		for i := 0; i < n; i++ {
+			copy(b, a)
+			copy(b[8:], r[i*8:(i+1)*8])
+			block.Encrypt(b, b)
+
+			t := uint64(n*j + i + 1)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(b[:8])^t)
+			copy(r[i*8:(i+1)*8], b[8:])
+		}
+	}
+
+	return append(a, r...), nil
+}
+
+// unwrapKWP reverses wrapKWP, verifying the integrity of the result
+func unwrapKWP(kek, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < 16 || len(ciphertext)%8 != 0 {
+		return nil, errors.New("invalid wrapped key length")
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	var a, r []byte
+	if len(ciphertext) == 16 {
+		b := make([]byte, 16)
+		block.Decrypt(b, ciphertext)
+		a, r = b[:8], b[8:]
+	} else {
+		n := len(ciphertext)/8 - 1
+		a = make([]byte, 8)
+		copy(a, ciphertext[:8])
+		r = make([]byte, len(ciphertext)-8)
+		copy(r, ciphertext[8:])
+
+		b := make([]byte, 16)
+		for j := 5; j >= 0; j-- {
+			for i := n - 1; i >= 0; i-- {
+				t := uint64(n*j + i + 1)
+				binary.BigEndian.PutUint64(b, binary.BigEndian.Uint64(a)^t)
+				copy(b[8:], r[i*8:(i+1)*8])
+				block.Decrypt(b, b)
+
+				copy(a, b[:8])
+				copy(r[i*8:(i+1)*8], b[8:])
+			}
+		}
+	}
+
+	if subtle.ConstantTimeCompare(a[:4], kwpIV) != 1 {
+		return nil, errors.New("key unwrapping failed integrity check")
+	}
+	length := int(binary.BigEndian.Uint32(a[4:]))
+	if length <= len(r)-8 || length > len(r) {
+		return nil, errors.New("key unwrapping failed integrity check")
+	}
+	if !bytes.Equal(r[length:], make([]byte, len(r)-length)) {
+		return nil, errors.New("key unwrapping failed integrity check")
+	}
+
+	return r[:length], nil
+}
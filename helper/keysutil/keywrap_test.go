@@ -0,0 +1,79 @@
+package keysutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"testing"
+)
+
+func TestKWP_Vectors(t *testing.T) {
+	// Test vectors from RFC 5649 section 6
+	kek, _ := hex.DecodeString("5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8")
+	cases := []struct {
+		key        string
+		ciphertext string
+	}{
+		{
+			key:        "c37b7e6492584340bed12207808941155068f738",
+			ciphertext: "138bdeaa9b8fa7fc61f97742e72248ee5ae6ae5360d1ae6a5f54f373fa543b6a",
+		},
+		{
+			key:        "466f7250617369",
+			ciphertext: "afbeb0f07dfbf5419200f2ccb50bb24f",
+		},
+	}
+
+	for _, c := range cases {
+		key, _ := hex.DecodeString(c.key)
+		expected, _ := hex.DecodeString(c.ciphertext)
+
+		wrapped, err := wrapKWP(kek, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(wrapped, expected) {
+			t.Fatalf("bad wrapped key: expected %x, got %x", expected, wrapped)
+		}
+
+		unwrapped, err := unwrapKWP(kek, wrapped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(unwrapped, key) {
+			t.Fatalf("bad unwrapped key: expected %x, got %x", key, unwrapped)
+		}
+
+		wrapped[len(wrapped)-1] ^= 0x01
+		if _, err := unwrapKWP(kek, wrapped); err == nil {
+			t.Fatal("expected error unwrapping modified ciphertext")
+		}
+	}
+}
+
+func TestWrapKeyMaterial(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyMaterial := []byte("this is thirty-two bytes of key!")
+	wrapped, err := WrapKeyMaterial(&priv.PublicKey, crypto.SHA256, keyMaterial)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unwrapped, err := UnwrapKeyMaterial(priv, crypto.SHA256, wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(unwrapped, keyMaterial) {
+		t.Fatalf("bad: expected %q, got %q", keyMaterial, unwrapped)
+	}
+
+	if _, err := UnwrapKeyMaterial(priv, crypto.SHA1, wrapped); err == nil {
+		t.Fatal("expected error unwrapping with the wrong hash")
+	}
+}
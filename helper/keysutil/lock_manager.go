@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/armon/go-metrics"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/logical"
 )
@@ -41,6 +42,16 @@ type PolicyRequest struct {
 
 	// Whether to upsert
 	Upsert bool
+
+	// Key material to import instead of generating a key, in the format
+	// accepted by Policy.Import
+	ImportKey []byte
+
+	// Whether an imported key may later be rotated to a generated key
+	AllowImportedKeyRotation bool
+
+	// The name of the managed key to use for managed_key policies
+	ManagedKeyName string
 }
 
 type LockManager struct {
@@ -50,8 +61,15 @@ type LockManager struct {
 	// A mutex for the map itself
 	locksMutex sync.RWMutex
 
-	// If caching is enabled, the map of name to in-memory policy cache
-	cache map[string]*Policy
+	// Whether caching is enabled; kept separately from the cache itself as
+	// the cache may be replaced when resized
+	useCache bool
+
+	// If caching is enabled, the in-memory policy cache
+	cache policyCache
+
+	// The maximum number of cached policies; zero means unbounded
+	cacheSize int
 
 	// Used for global locking, and as the cache map mutex
 	cacheMutex sync.RWMutex
@@ -62,13 +80,47 @@ func NewLockManager(cacheDisabled bool) *LockManager {
 		locks: map[string]*sync.RWMutex{},
 	}
 	if !cacheDisabled {
-		lm.cache = map[string]*Policy{}
+		lm.useCache = true
+		lm.cache = mapCache{}
 	}
 	return lm
 }
 
 func (lm *LockManager) CacheActive() bool {
-	return lm.cache != nil
+	return lm.useCache
+}
+
+// CacheSize returns the maximum number of cached policies, with zero meaning
+// that the cache is unbounded
+func (lm *LockManager) CacheSize() int {
+	lm.cacheMutex.RLock()
+	defer lm.cacheMutex.RUnlock()
+	return lm.cacheSize
+}
+
+// SetCacheSize replaces the policy cache with one holding at most size
+// policies, or an unbounded one if size is zero. Cached policies are dropped
+// and will be reloaded from storage as they are used.
+func (lm *LockManager) SetCacheSize(size int) error {
+	if !lm.CacheActive() {
+		return fmt.Errorf("caching is disabled")
+	}
+	if size != 0 && size < MinCacheSize {
+		return fmt.Errorf("cache size must be zero or at least %d", MinCacheSize)
+	}
+
+	lm.cacheMutex.Lock()
+	defer lm.cacheMutex.Unlock()
+	if size == lm.cacheSize {
+		return nil
+	}
+	cache, err := newPolicyCache(size)
+	if err != nil {
+		return err
+	}
+	lm.cache = cache
+	lm.cacheSize = size
+	return nil
 }
 
 func (lm *LockManager) InvalidatePolicy(name string) {
@@ -76,7 +128,7 @@ func (lm *LockManager) InvalidatePolicy(name string) {
 	if lm.CacheActive() {
 		lm.cacheMutex.Lock()
 		defer lm.cacheMutex.Unlock()
-		delete(lm.cache, name)
+		lm.cache.Remove(name)
 	}
 }
 
@@ -212,12 +264,14 @@ func (lm *LockManager) getPolicyCommon(req PolicyRequest, lockType bool) (*Polic
 	// Check if it's in our cache. If so, return right away.
 	if lm.CacheActive() {
 		lm.cacheMutex.RLock()
-		p = lm.cache[req.Name]
+		p = lm.cache.Get(req.Name)
 		if p != nil {
 			lm.cacheMutex.RUnlock()
+			metrics.IncrCounter([]string{"transit", "cache", "hit"}, 1)
 			return p, lock, false, nil
 		}
 		lm.cacheMutex.RUnlock()
+		metrics.IncrCounter([]string{"transit", "cache", "miss"}, 1)
 	}
 
 	// Load it from storage
@@ -241,30 +295,40 @@ func (lm *LockManager) getPolicyCommon(req PolicyRequest, lockType bool) (*Polic
 		}
 
 		switch req.KeyType {
-		case KeyType_AES256_GCM96:
-			if req.Convergent && !req.Derived {
-				return nil, nil, false, fmt.Errorf("convergent encryption requires derivation to be enabled")
-			}
-
-		case KeyType_ECDSA_P256:
-			if req.Derived || req.Convergent {
-				return nil, nil, false, fmt.Errorf("key derivation and convergent encryption not supported for keys of type %v", KeyType_ECDSA_P256)
+		case KeyType_AES256_GCM96, KeyType_ECDSA_P256, KeyType_ED25519, KeyType_RSA2048, KeyType_RSA4096:
+		case KeyType_MANAGED_KEY:
+			if req.ManagedKeyName == "" {
+				lm.UnlockPolicy(lock, lockType)
+				return nil, nil, false, fmt.Errorf("a managed key name is required for keys of type %v", req.KeyType)
 			}
-
-		case KeyType_ED25519:
-			if req.Convergent {
-				return nil, nil, false, fmt.Errorf("convergent encryption not not supported for keys of type %v", KeyType_ED25519)
+			if req.Exportable || req.ImportKey != nil {
+				lm.UnlockPolicy(lock, lockType)
+				return nil, nil, false, fmt.Errorf("keys of type %v cannot be exported or imported", req.KeyType)
 			}
-
 		default:
 			return nil, nil, false, fmt.Errorf("unsupported key type %v", req.KeyType)
 		}
 
+		if req.Derived && !req.KeyType.DerivationSupported() {
+			return nil, nil, false, fmt.Errorf("key derivation not supported for keys of type %v", req.KeyType)
+		}
+
+		if req.Convergent {
+			if !req.KeyType.ConvergentEncryptionSupported() {
+				return nil, nil, false, fmt.Errorf("convergent encryption not supported for keys of type %v", req.KeyType)
+			}
+			if !req.Derived {
+				return nil, nil, false, fmt.Errorf("convergent encryption requires derivation to be enabled")
+			}
+		}
+
 		p = &Policy{
 			Name:       req.Name,
 			Type:       req.KeyType,
 			Derived:    req.Derived,
 			Exportable: req.Exportable,
+
+			ManagedKeyName: req.ManagedKeyName,
 		}
 		if req.Derived {
 			p.KDF = Kdf_hkdf_sha256
@@ -272,7 +336,13 @@ func (lm *LockManager) getPolicyCommon(req PolicyRequest, lockType bool) (*Polic
 			p.ConvergentVersion = 2
 		}
 
-		err = p.Rotate(req.Storage)
+		if req.ImportKey != nil {
+			p.Imported = true
+			p.AllowImportedKeyRotation = req.AllowImportedKeyRotation
+			err = p.Import(req.Storage, req.ImportKey)
+		} else {
+			err = p.Rotate(req.Storage)
+		}
 		if err != nil {
 			lm.UnlockPolicy(lock, lockType)
 			return nil, nil, false, err
@@ -285,12 +355,12 @@ func (lm *LockManager) getPolicyCommon(req PolicyRequest, lockType bool) (*Polic
 			defer lm.cacheMutex.Unlock()
 			// Make sure a policy didn't appear. If so, it will only be set if
 			// there was no error, so assume it's good and return that
-			exp := lm.cache[req.Name]
+			exp := lm.cache.Get(req.Name)
 			if exp != nil {
 				return exp, lock, false, nil
 			}
 			if err == nil {
-				lm.cache[req.Name] = p
+				lm.cache.Add(req.Name, p)
 			}
 		}
 
@@ -318,12 +388,12 @@ func (lm *LockManager) getPolicyCommon(req PolicyRequest, lockType bool) (*Polic
 		defer lm.cacheMutex.Unlock()
 		// Make sure a policy didn't appear. If so, it will only be set if
 		// there was no error, so assume it's good and return that
-		exp := lm.cache[req.Name]
+		exp := lm.cache.Get(req.Name)
 		if exp != nil {
 			return exp, lock, false, nil
 		}
 		if err == nil {
-			lm.cache[req.Name] = p
+			lm.cache.Add(req.Name, p)
 		}
 	}
 
@@ -340,7 +410,7 @@ func (lm *LockManager) DeletePolicy(storage logical.Storage, name string) error
 	var err error
 
 	if lm.CacheActive() {
-		p = lm.cache[name]
+		p = lm.cache.Get(name)
 	}
 	if p == nil {
 		p, err = lm.getStoredPolicy(storage, name)
@@ -367,7 +437,7 @@ func (lm *LockManager) DeletePolicy(storage logical.Storage, name string) error
 	}
 
 	if lm.CacheActive() {
-		delete(lm.cache, name)
+		lm.cache.Remove(name)
 	}
 
 	return nil
@@ -0,0 +1,68 @@
+package keysutil
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// oidEd25519 is the algorithm identifier for Ed25519 keys from RFC 8410
+var oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+type pkcs8PrivateKey struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// marshalEd25519PKCS8 encodes an Ed25519 private key as PKCS#8, as described
+// in RFC 8410
+func marshalEd25519PKCS8(key ed25519.PrivateKey) ([]byte, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid ed25519 private key")
+	}
+
+	seed, err := asn1.Marshal(key[:32])
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(pkcs8PrivateKey{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm: oidEd25519,
+		},
+		PrivateKey: seed,
+	})
+}
+
+// parseEd25519PKCS8 decodes a PKCS#8 encoded Ed25519 private key
+func parseEd25519PKCS8(der []byte) (ed25519.PrivateKey, error) {
+	var info pkcs8PrivateKey
+	rest, err := asn1.Unmarshal(der, &info)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data after private key")
+	}
+	if !info.Algorithm.Algorithm.Equal(oidEd25519) {
+		return nil, errors.New("private key is not an ed25519 key")
+	}
+
+	var seed []byte
+	if _, err := asn1.Unmarshal(info.PrivateKey, &seed); err != nil {
+		return nil, err
+	}
+	if len(seed) != 32 {
+		return nil, errors.New("invalid ed25519 private key seed length")
+	}
+
+	_, key, err := ed25519.GenerateKey(bytes.NewReader(seed))
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -9,6 +9,7 @@ import (
 	"crypto/elliptic"
 	"crypto/hmac"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/asn1"
@@ -44,6 +45,15 @@ const (
 	KeyType_AES256_GCM96 = iota
 	KeyType_ECDSA_P256
 	KeyType_ED25519
+	KeyType_RSA2048
+	KeyType_RSA4096
+	KeyType_MANAGED_KEY
+)
+
+// Signature algorithms that can be used with RSA keys
+const (
+	SignatureAlgorithmPSS      = "pss"
+	SignatureAlgorithmPKCS1v15 = "pkcs1v15"
 )
 
 const ErrTooOld = "ciphertext or signature version is disallowed by policy (too old)"
@@ -77,7 +87,7 @@ func (kt KeyType) DecryptionSupported() bool {
 
 func (kt KeyType) SigningSupported() bool {
 	switch kt {
-	case KeyType_ECDSA_P256, KeyType_ED25519:
+	case KeyType_ECDSA_P256, KeyType_ED25519, KeyType_RSA2048, KeyType_RSA4096, KeyType_MANAGED_KEY:
 		return true
 	}
 	return false
@@ -85,7 +95,7 @@ func (kt KeyType) SigningSupported() bool {
 
 func (kt KeyType) HashSignatureInput() bool {
 	switch kt {
-	case KeyType_ECDSA_P256:
+	case KeyType_ECDSA_P256, KeyType_RSA2048, KeyType_RSA4096, KeyType_MANAGED_KEY:
 		return true
 	}
 	return false
@@ -99,6 +109,17 @@ func (kt KeyType) DerivationSupported() bool {
 	return false
 }
 
+// ConvergentEncryptionSupported returns whether keys of this type can be used
+// for convergent encryption, producing the same ciphertext for the same
+// plaintext and context
+func (kt KeyType) ConvergentEncryptionSupported() bool {
+	switch kt {
+	case KeyType_AES256_GCM96:
+		return true
+	}
+	return false
+}
+
 func (kt KeyType) String() string {
 	switch kt {
 	case KeyType_AES256_GCM96:
@@ -107,6 +128,12 @@ func (kt KeyType) String() string {
 		return "ecdsa-p256"
 	case KeyType_ED25519:
 		return "ed25519"
+	case KeyType_RSA2048:
+		return "rsa-2048"
+	case KeyType_RSA4096:
+		return "rsa-4096"
+	case KeyType_MANAGED_KEY:
+		return "managed_key"
 	}
 
 	return "[unknown]"
@@ -127,6 +154,8 @@ type KeyEntry struct {
 	EC_Y *big.Int `json:"ec_y"`
 	EC_D *big.Int `json:"ec_d"`
 
+	RSAKey *rsa.PrivateKey `json:"rsa_key"`
+
 	// The public key in an appropriate format for the type of key
 	FormattedPublicKey string `json:"public_key"`
 
@@ -201,6 +230,24 @@ type Policy struct {
 
 	// The type of key
 	Type KeyType `json:"type"`
+
+	// Whether the key material was imported rather than generated by Vault
+	Imported bool `json:"imported"`
+
+	// Whether Vault may generate new versions of an imported key on rotation
+	AllowImportedKeyRotation bool `json:"allow_imported_key_rotation"`
+
+	// The period after which the key is automatically rotated; zero disables
+	// automatic rotation
+	AutoRotatePeriod time.Duration `json:"auto_rotate_period"`
+
+	// If set, the minimum decryption version is advanced on rotation so that
+	// at most this many of the latest versions can be used for decryption
+	MaxDecryptionVersions int `json:"max_decryption_versions"`
+
+	// The name of the managed key holding the private key of managed_key
+	// policies, which is never stored by Vault
+	ManagedKeyName string `json:"managed_key_name"`
 }
 
 // ArchivedKeys stores old keys. This is used to keep the key loading time sane
@@ -708,7 +755,10 @@ func (p *Policy) HMACKey(version int) ([]byte, error) {
 	return p.Keys[version].HMACKey, nil
 }
 
-func (p *Policy) Sign(ver int, context, input []byte) (*SigningResult, error) {
+// Sign signs the input with the given version of the key. For key types that
+// hash their input, the input must already be hashed with hashAlgorithm.
+// sigAlgorithm selects the signature scheme for RSA keys and defaults to PSS.
+func (p *Policy) Sign(ver int, context, input []byte, hashAlgorithm crypto.Hash, sigAlgorithm string) (*SigningResult, error) {
 	if !p.Type.SigningSupported() {
 		return nil, fmt.Errorf("message signing not supported for key type %v", p.Type)
 	}
@@ -773,6 +823,20 @@ func (p *Policy) Sign(ver int, context, input []byte) (*SigningResult, error) {
 			return nil, err
 		}
 
+	case KeyType_RSA2048, KeyType_RSA4096:
+		key := p.Keys[ver].RSAKey
+		switch sigAlgorithm {
+		case SignatureAlgorithmPSS, "":
+			sig, err = rsa.SignPSS(rand.Reader, key, hashAlgorithm, input, nil)
+		case SignatureAlgorithmPKCS1v15:
+			sig, err = rsa.SignPKCS1v15(rand.Reader, key, hashAlgorithm, input)
+		default:
+			return nil, errutil.UserError{Err: fmt.Sprintf("unsupported signature algorithm %s", sigAlgorithm)}
+		}
+		if err != nil {
+			return nil, errutil.UserError{Err: fmt.Sprintf("error signing input: %v", err)}
+		}
+
 	default:
 		return nil, fmt.Errorf("unsupported key type %v", p.Type)
 	}
@@ -788,7 +852,9 @@ func (p *Policy) Sign(ver int, context, input []byte) (*SigningResult, error) {
 	return res, nil
 }
 
-func (p *Policy) VerifySignature(context, input []byte, sig string) (bool, error) {
+// VerifySignature verifies a signature created by Sign, using the same
+// hashAlgorithm and sigAlgorithm that were used for signing
+func (p *Policy) VerifySignature(context, input []byte, sig string, hashAlgorithm crypto.Hash, sigAlgorithm string) (bool, error) {
 	if !p.Type.SigningSupported() {
 		return false, errutil.UserError{Err: fmt.Sprintf("message verification not supported for key type %v", p.Type)}
 	}
@@ -857,6 +923,19 @@ func (p *Policy) VerifySignature(context, input []byte, sig string) (bool, error
 
 		return ed25519.Verify(key.Public().(ed25519.PublicKey), input, sigBytes), nil
 
+	case KeyType_RSA2048, KeyType_RSA4096:
+		key := p.Keys[ver].RSAKey
+		switch sigAlgorithm {
+		case SignatureAlgorithmPSS, "":
+			err = rsa.VerifyPSS(&key.PublicKey, hashAlgorithm, input, sigBytes, nil)
+		case SignatureAlgorithmPKCS1v15:
+			err = rsa.VerifyPKCS1v15(&key.PublicKey, hashAlgorithm, input, sigBytes)
+		default:
+			return false, errutil.UserError{Err: fmt.Sprintf("unsupported signature algorithm %s", sigAlgorithm)}
+		}
+
+		return err == nil, nil
+
 	default:
 		return false, errutil.InternalError{Err: fmt.Sprintf("unsupported key type %v", p.Type)}
 	}
@@ -864,7 +943,103 @@ func (p *Policy) VerifySignature(context, input []byte, sig string) (bool, error
 	return false, errutil.InternalError{Err: "no valid key type found"}
 }
 
+// SignManaged signs the input with the managed key backing a managed_key
+// policy, which the caller looks up by ManagedKeyName. The input must already
+// be hashed with hashAlgorithm. Managed keys have a single version.
+func (p *Policy) SignManaged(key crypto.Signer, ver int, input []byte, hashAlgorithm crypto.Hash, sigAlgorithm string) (*SigningResult, error) {
+	if p.Type != KeyType_MANAGED_KEY {
+		return nil, fmt.Errorf("key type %v is not a managed key", p.Type)
+	}
+	if ver != 0 && ver != p.LatestVersion {
+		return nil, errutil.UserError{Err: "managed keys only support signing with the latest key version"}
+	}
+
+	var opts crypto.SignerOpts = hashAlgorithm
+	if _, ok := key.Public().(*rsa.PublicKey); ok {
+		switch sigAlgorithm {
+		case SignatureAlgorithmPSS, "":
+			opts = &rsa.PSSOptions{
+				SaltLength: rsa.PSSSaltLengthEqualsHash,
+				Hash:       hashAlgorithm,
+			}
+		case SignatureAlgorithmPKCS1v15:
+		default:
+			return nil, errutil.UserError{Err: fmt.Sprintf("unsupported signature algorithm %s", sigAlgorithm)}
+		}
+	}
+
+	sig, err := key.Sign(rand.Reader, input, opts)
+	if err != nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("error signing input with managed key: %v", err)}
+	}
+
+	return &SigningResult{
+		Signature: "vault:v" + strconv.Itoa(p.LatestVersion) + ":" + base64.StdEncoding.EncodeToString(sig),
+	}, nil
+}
+
+// VerifySignatureManaged verifies a signature created by SignManaged using
+// the public part of the managed key
+func (p *Policy) VerifySignatureManaged(key crypto.Signer, input []byte, sig string, hashAlgorithm crypto.Hash, sigAlgorithm string) (bool, error) {
+	if p.Type != KeyType_MANAGED_KEY {
+		return false, fmt.Errorf("key type %v is not a managed key", p.Type)
+	}
+
+	if !strings.HasPrefix(sig, "vault:v") {
+		return false, errutil.UserError{Err: "invalid signature: no prefix"}
+	}
+	splitVerSig := strings.SplitN(strings.TrimPrefix(sig, "vault:v"), ":", 2)
+	if len(splitVerSig) != 2 {
+		return false, errutil.UserError{Err: "invalid signature: wrong number of fields"}
+	}
+	ver, err := strconv.Atoi(splitVerSig[0])
+	if err != nil {
+		return false, errutil.UserError{Err: "invalid signature: version number could not be decoded"}
+	}
+	if ver != p.LatestVersion {
+		return false, errutil.UserError{Err: "invalid signature: unknown key version"}
+	}
+	sigBytes, err := base64.StdEncoding.DecodeString(splitVerSig[1])
+	if err != nil {
+		return false, errutil.UserError{Err: "invalid base64 signature value"}
+	}
+
+	switch pub := key.Public().(type) {
+	case *ecdsa.PublicKey:
+		var ecdsaSig ecdsaSignature
+		rest, err := asn1.Unmarshal(sigBytes, &ecdsaSig)
+		if err != nil {
+			return false, errutil.UserError{Err: "supplied signature is invalid"}
+		}
+		if len(rest) != 0 {
+			return false, errutil.UserError{Err: "supplied signature contains extra data"}
+		}
+		return ecdsa.Verify(pub, input, ecdsaSig.R, ecdsaSig.S), nil
+
+	case *rsa.PublicKey:
+		switch sigAlgorithm {
+		case SignatureAlgorithmPSS, "":
+			err = rsa.VerifyPSS(pub, hashAlgorithm, input, sigBytes, &rsa.PSSOptions{
+				SaltLength: rsa.PSSSaltLengthEqualsHash,
+				Hash:       hashAlgorithm,
+			})
+		case SignatureAlgorithmPKCS1v15:
+			err = rsa.VerifyPKCS1v15(pub, hashAlgorithm, input, sigBytes)
+		default:
+			return false, errutil.UserError{Err: fmt.Sprintf("unsupported signature algorithm %s", sigAlgorithm)}
+		}
+		return err == nil, nil
+
+	default:
+		return false, errutil.UserError{Err: "unsupported managed key type"}
+	}
+}
+
 func (p *Policy) Rotate(storage logical.Storage) error {
+	if p.Type == KeyType_MANAGED_KEY && p.LatestVersion > 0 {
+		return errutil.UserError{Err: "managed keys cannot be rotated by Vault"}
+	}
+
 	if p.Keys == nil {
 		// This is an initial key rotation when generating a new policy. We
 		// don't need to call migrate here because if we've called getPolicy to
@@ -923,6 +1098,21 @@ func (p *Policy) Rotate(storage logical.Storage) error {
 		}
 		entry.Key = pri
 		entry.FormattedPublicKey = base64.StdEncoding.EncodeToString(pub)
+
+	case KeyType_RSA2048, KeyType_RSA4096:
+		bitSize := 2048
+		if p.Type == KeyType_RSA4096 {
+			bitSize = 4096
+		}
+
+		entry.RSAKey, err = rsa.GenerateKey(rand.Reader, bitSize)
+		if err != nil {
+			return err
+		}
+		entry.FormattedPublicKey, err = pemPublicKey(entry.RSAKey.Public())
+		if err != nil {
+			return err
+		}
 	}
 
 	p.Keys[p.LatestVersion] = entry
@@ -934,9 +1124,169 @@ func (p *Policy) Rotate(storage logical.Storage) error {
 		p.MinDecryptionVersion = 1
 	}
 
+	if p.MaxDecryptionVersions > 0 && p.LatestVersion-p.MaxDecryptionVersions+1 > p.MinDecryptionVersion {
+		p.MinDecryptionVersion = p.LatestVersion - p.MaxDecryptionVersions + 1
+		if p.MinEncryptionVersion > 0 && p.MinEncryptionVersion < p.MinDecryptionVersion {
+			p.MinEncryptionVersion = p.MinDecryptionVersion
+		}
+	}
+
+	return p.Persist(storage)
+}
+
+// NeedsAutoRotation returns whether the latest version of the key is older
+// than the configured automatic rotation period
+func (p *Policy) NeedsAutoRotation(now time.Time) bool {
+	if p.AutoRotatePeriod <= 0 {
+		return false
+	}
+	if p.Imported && !p.AllowImportedKeyRotation {
+		return false
+	}
+	if p.Type == KeyType_MANAGED_KEY {
+		return false
+	}
+
+	latest, ok := p.Keys[p.LatestVersion]
+	if !ok {
+		return false
+	}
+	created := latest.CreationTime
+	if created.IsZero() {
+		created = time.Unix(latest.DeprecatedCreationTime, 0)
+	}
+
+	return !now.Before(created.Add(p.AutoRotatePeriod))
+}
+
+// Import adds externally generated key material to the policy as a new key
+// version. Symmetric keys are given as raw bytes and asymmetric keys as a
+// PKCS#8 encoded private key.
+func (p *Policy) Import(storage logical.Storage, keyMaterial []byte) error {
+	now := time.Now()
+	entry := KeyEntry{
+		CreationTime:           now,
+		DeprecatedCreationTime: now.Unix(),
+	}
+
+	hmacKey, err := uuid.GenerateRandomBytes(32)
+	if err != nil {
+		return err
+	}
+	entry.HMACKey = hmacKey
+
+	switch p.Type {
+	case KeyType_AES256_GCM96:
+		if len(keyMaterial) != 32 {
+			return errutil.UserError{Err: fmt.Sprintf("imported key for type %v must be 32 bytes long", p.Type)}
+		}
+		entry.Key = keyMaterial
+
+	case KeyType_ED25519:
+		key, err := parseEd25519PKCS8(keyMaterial)
+		if err != nil {
+			return errutil.UserError{Err: fmt.Sprintf("error parsing imported key: %v", err)}
+		}
+		entry.Key = key
+		entry.FormattedPublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+
+	case KeyType_ECDSA_P256, KeyType_RSA2048, KeyType_RSA4096:
+		parsed, err := x509.ParsePKCS8PrivateKey(keyMaterial)
+		if err != nil {
+			return errutil.UserError{Err: fmt.Sprintf("error parsing imported key: %v", err)}
+		}
+
+		switch key := parsed.(type) {
+		case *ecdsa.PrivateKey:
+			if p.Type != KeyType_ECDSA_P256 || key.Curve != elliptic.P256() {
+				return errutil.UserError{Err: fmt.Sprintf("imported key does not match key type %v", p.Type)}
+			}
+			entry.EC_D = key.D
+			entry.EC_X = key.X
+			entry.EC_Y = key.Y
+
+		case *rsa.PrivateKey:
+			bitSize := key.N.BitLen()
+			if (p.Type != KeyType_RSA2048 || bitSize != 2048) && (p.Type != KeyType_RSA4096 || bitSize != 4096) {
+				return errutil.UserError{Err: fmt.Sprintf("imported key does not match key type %v", p.Type)}
+			}
+			entry.RSAKey = key
+
+		default:
+			return errutil.UserError{Err: fmt.Sprintf("imported key does not match key type %v", p.Type)}
+		}
+
+		entry.FormattedPublicKey, err = pemPublicKey(parsed.(crypto.Signer).Public())
+		if err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("unsupported key type %v", p.Type)
+	}
+
+	if p.Keys == nil {
+		p.Keys = keyEntryMap{}
+	}
+	p.LatestVersion += 1
+	p.Keys[p.LatestVersion] = entry
+
+	if p.MinDecryptionVersion == 0 {
+		p.MinDecryptionVersion = 1
+	}
+
 	return p.Persist(storage)
 }
 
+// KeyMaterial returns the key material of the given version in the format
+// accepted by Import
+func (p *Policy) KeyMaterial(ver int) ([]byte, error) {
+	entry, ok := p.Keys[ver]
+	if !ok {
+		return nil, errutil.UserError{Err: "version does not exist or cannot be found"}
+	}
+
+	switch p.Type {
+	case KeyType_AES256_GCM96:
+		return entry.Key, nil
+
+	case KeyType_ED25519:
+		return marshalEd25519PKCS8(ed25519.PrivateKey(entry.Key))
+
+	case KeyType_ECDSA_P256:
+		return x509.MarshalPKCS8PrivateKey(&ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     entry.EC_X,
+				Y:     entry.EC_Y,
+			},
+			D: entry.EC_D,
+		})
+
+	case KeyType_RSA2048, KeyType_RSA4096:
+		return x509.MarshalPKCS8PrivateKey(entry.RSAKey)
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %v", p.Type)
+	}
+}
+
+// pemPublicKey returns the PEM-encoded PKIX form of a public key
+func pemPublicKey(pub crypto.PublicKey) (string, error) {
+	derBytes, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling public key: %s", err)
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: derBytes,
+	})
+	if len(pemBytes) == 0 {
+		return "", fmt.Errorf("error PEM-encoding public key")
+	}
+	return string(pemBytes), nil
+}
+
 func (p *Policy) MigrateKeyToKeysMap() {
 	now := time.Now()
 	p.Keys = keyEntryMap{
@@ -123,7 +123,7 @@ func testArchivingUpgradeCommon(t *testing.T, lm *LockManager) {
 	// If we're caching, expire from the cache since we modified it
 	// under-the-hood
 	if lm.CacheActive() {
-		delete(lm.cache, "test")
+		lm.cache.Remove("test")
 	}
 
 	// Now get the policy again; the upgrade should happen automatically
@@ -141,7 +141,7 @@ func testArchivingUpgradeCommon(t *testing.T, lm *LockManager) {
 	// Let's check some deletion logic while we're at it
 
 	// The policy should be in there
-	if lm.CacheActive() && lm.cache["test"] == nil {
+	if lm.CacheActive() && lm.cache.Get("test") == nil {
 		t.Fatal("nil policy in cache")
 	}
 
@@ -152,7 +152,7 @@ func testArchivingUpgradeCommon(t *testing.T, lm *LockManager) {
 	}
 
 	// The policy should still be in there
-	if lm.CacheActive() && lm.cache["test"] == nil {
+	if lm.CacheActive() && lm.cache.Get("test") == nil {
 		t.Fatal("nil policy in cache")
 	}
 
@@ -177,7 +177,7 @@ func testArchivingUpgradeCommon(t *testing.T, lm *LockManager) {
 	}
 
 	// The policy should *not* be in there
-	if lm.CacheActive() && lm.cache["test"] != nil {
+	if lm.CacheActive() && lm.cache.Get("test") != nil {
 		t.Fatal("non-nil policy in cache")
 	}
 
@@ -349,3 +349,49 @@ func checkKeys(t *testing.T,
 		}
 	}
 }
+
+func Test_ImportKeyMaterial(t *testing.T) {
+	storage := &logical.InmemStorage{}
+
+	for _, keyType := range []KeyType{KeyType_AES256_GCM96, KeyType_ECDSA_P256, KeyType_ED25519, KeyType_RSA2048} {
+		src := &Policy{
+			Name: "src-" + keyType.String(),
+			Type: keyType,
+		}
+		if err := src.Rotate(storage); err != nil {
+			t.Fatal(err)
+		}
+
+		keyMaterial, err := src.KeyMaterial(1)
+		if err != nil {
+			t.Fatalf("%v: %v", keyType, err)
+		}
+
+		dst := &Policy{
+			Name:     "dst-" + keyType.String(),
+			Type:     keyType,
+			Imported: true,
+		}
+		if err := dst.Import(storage, keyMaterial); err != nil {
+			t.Fatalf("%v: %v", keyType, err)
+		}
+		if dst.LatestVersion != 1 || dst.MinDecryptionVersion != 1 {
+			t.Fatalf("%v: bad versions: %#v", keyType, dst)
+		}
+		if !reflect.DeepEqual(dst.Keys[1].Key, src.Keys[1].Key) {
+			t.Fatalf("%v: mismatched keys", keyType)
+		}
+		if dst.Keys[1].FormattedPublicKey != src.Keys[1].FormattedPublicKey {
+			t.Fatalf("%v: mismatched public keys: %q vs %q", keyType, dst.Keys[1].FormattedPublicKey, src.Keys[1].FormattedPublicKey)
+		}
+	}
+
+	// Key material must match the key type
+	mismatched := &Policy{
+		Name: "mismatch",
+		Type: KeyType_ED25519,
+	}
+	if err := mismatched.Import(storage, make([]byte, 32)); err == nil {
+		t.Fatal("expected error importing mismatched key material")
+	}
+}
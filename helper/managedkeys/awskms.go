@@ -0,0 +1,181 @@
+package managedkeys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/helper/awsutil"
+)
+
+var awsKMSProvider = &Provider{
+	RequiredParameters:  []string{"key_id"},
+	SensitiveParameters: []string{"secret_key"},
+	Factory:             newAWSKMSKey,
+}
+
+// awsKMSKey is an asymmetric AWS KMS key. Only the subset of the KMS API
+// needed to use the key is implemented, on top of the SDK's JSON RPC protocol.
+type awsKMSKey struct {
+	client    *awsutil.KMSClient
+	keyID     string
+	publicKey crypto.PublicKey
+}
+
+type kmsGetPublicKeyInput struct {
+	KeyId *string
+}
+
+type kmsGetPublicKeyOutput struct {
+	PublicKey []byte
+}
+
+type kmsSignInput struct {
+	KeyId            *string
+	Message          []byte
+	MessageType      *string
+	SigningAlgorithm *string
+}
+
+type kmsSignOutput struct {
+	Signature []byte
+}
+
+type kmsDecryptInput struct {
+	KeyId               *string
+	CiphertextBlob      []byte
+	EncryptionAlgorithm *string
+}
+
+type kmsDecryptOutput struct {
+	Plaintext []byte
+}
+
+// newAWSKMSKey creates a key from the "key_id" parameter, using the
+// optional "region", "access_key", "secret_key" and "endpoint" parameters to
+// reach KMS. The public key is fetched so that unusable keys are detected
+// early.
+func newAWSKMSKey(params map[string]string) (Key, error) {
+	credsConfig := &awsutil.CredentialsConfig{
+		AccessKey:  params["access_key"],
+		SecretKey:  params["secret_key"],
+		Region:     params["region"],
+		HTTPClient: cleanhttp.DefaultClient(),
+	}
+	if credsConfig.Region == "" {
+		credsConfig.Region = "us-east-1"
+	}
+	creds, err := credsConfig.GenerateCredentialChain()
+	if err != nil {
+		return nil, err
+	}
+
+	awsConfig := &aws.Config{
+		Credentials: creds,
+		Region:      aws.String(credsConfig.Region),
+		HTTPClient:  cleanhttp.DefaultClient(),
+	}
+	if endpoint := params["endpoint"]; endpoint != "" {
+		awsConfig.Endpoint = aws.String(endpoint)
+	}
+
+	k := &awsKMSKey{
+		client: awsutil.NewKMSClient(awsConfig),
+		keyID:  params["key_id"],
+	}
+
+	output := &kmsGetPublicKeyOutput{}
+	if err := k.send("GetPublicKey", &kmsGetPublicKeyInput{
+		KeyId: aws.String(k.keyID),
+	}, output); err != nil {
+		return nil, fmt.Errorf("error fetching public key of KMS key %s: %v", k.keyID, err)
+	}
+	k.publicKey, err = x509.ParsePKIXPublicKey(output.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing public key of KMS key %s: %v", k.keyID, err)
+	}
+
+	return k, nil
+}
+
+func (k *awsKMSKey) send(operation string, input, output interface{}) error {
+	return k.client.Send(operation, input, output)
+}
+
+func (k *awsKMSKey) Public() crypto.PublicKey {
+	return k.publicKey
+}
+
+// Sign signs the digest with the KMS key. RSA keys use PSS if opts are
+// *rsa.PSSOptions and PKCS#1 v1.5 otherwise.
+func (k *awsKMSKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var hashName string
+	switch opts.HashFunc() {
+	case crypto.SHA256:
+		hashName = "SHA_256"
+	case crypto.SHA384:
+		hashName = "SHA_384"
+	case crypto.SHA512:
+		hashName = "SHA_512"
+	default:
+		return nil, ErrUnsupportedOperation
+	}
+
+	var algorithm string
+	switch k.publicKey.(type) {
+	case *rsa.PublicKey:
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			algorithm = "RSASSA_PSS_" + hashName
+		} else {
+			algorithm = "RSASSA_PKCS1_V1_5_" + hashName
+		}
+	case *ecdsa.PublicKey:
+		algorithm = "ECDSA_" + hashName
+	default:
+		return nil, ErrUnsupportedOperation
+	}
+
+	output := &kmsSignOutput{}
+	if err := k.send("Sign", &kmsSignInput{
+		KeyId:            aws.String(k.keyID),
+		Message:          digest,
+		MessageType:      aws.String("DIGEST"),
+		SigningAlgorithm: aws.String(algorithm),
+	}, output); err != nil {
+		return nil, err
+	}
+	return output.Signature, nil
+}
+
+// Decrypt decrypts RSA-OAEP ciphertext with the KMS key
+func (k *awsKMSKey) Decrypt(rand io.Reader, ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	oaepOpts, ok := opts.(*rsa.OAEPOptions)
+	if !ok {
+		return nil, ErrUnsupportedOperation
+	}
+
+	var algorithm string
+	switch oaepOpts.Hash {
+	case crypto.SHA1:
+		algorithm = "RSAES_OAEP_SHA_1"
+	case crypto.SHA256:
+		algorithm = "RSAES_OAEP_SHA_256"
+	default:
+		return nil, ErrUnsupportedOperation
+	}
+
+	output := &kmsDecryptOutput{}
+	if err := k.send("Decrypt", &kmsDecryptInput{
+		KeyId:               aws.String(k.keyID),
+		CiphertextBlob:      ciphertext,
+		EncryptionAlgorithm: aws.String(algorithm),
+	}, output); err != nil {
+		return nil, err
+	}
+	return output.Plaintext, nil
+}
@@ -0,0 +1,117 @@
+package managedkeys
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeKMS serves the KMS operations used by awsKMSKey with a local RSA key
+func fakeKMS(t *testing.T, priv *rsa.PrivateKey) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			KeyId               string
+			Message             []byte
+			SigningAlgorithm    string
+			CiphertextBlob      []byte
+			EncryptionAlgorithm string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Fatal(err)
+		}
+		if input.KeyId != "alias/test" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"NotFoundException","message":"key not found"}`))
+			return
+		}
+
+		var output interface{}
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.GetPublicKey":
+			der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output = map[string]interface{}{"PublicKey": der}
+		case "TrentService.Sign":
+			if input.SigningAlgorithm != "RSASSA_PKCS1_V1_5_SHA_256" {
+				t.Fatalf("bad signing algorithm %q", input.SigningAlgorithm)
+			}
+			sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, input.Message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output = map[string]interface{}{"Signature": sig}
+		case "TrentService.Decrypt":
+			if input.EncryptionAlgorithm != "RSAES_OAEP_SHA_256" {
+				t.Fatalf("bad encryption algorithm %q", input.EncryptionAlgorithm)
+			}
+			plaintext, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, input.CiphertextBlob, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output = map[string]interface{}{"Plaintext": plaintext}
+		default:
+			t.Fatalf("unexpected target %q", r.Header.Get("X-Amz-Target"))
+		}
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		json.NewEncoder(w).Encode(output)
+	}))
+}
+
+func TestAWSKMSKey(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := fakeKMS(t, priv)
+	defer server.Close()
+
+	params := map[string]string{
+		"access_key": "AKIAEXAMPLE",
+		"secret_key": "secret",
+		"endpoint":   server.URL,
+	}
+	if _, err := NewKey("awskms", params); err == nil {
+		t.Fatal("expected error without key_id")
+	}
+
+	params["key_id"] = "alias/missing"
+	if _, err := NewKey("awskms", params); err == nil {
+		t.Fatal("expected error for missing KMS key")
+	}
+
+	params["key_id"] = "alias/test"
+	key, err := NewKey("awskms", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha256.Sum256([]byte("hello"))
+	sig, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rsa.VerifyPKCS1v15(key.Public().(*rsa.PublicKey), crypto.SHA256, digest[:], sig); err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &priv.PublicKey, []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := key.(crypto.Decrypter).Decrypt(rand.Reader, ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "secret" {
+		t.Fatalf("bad plaintext %q", plaintext)
+	}
+}
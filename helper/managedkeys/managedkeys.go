@@ -0,0 +1,122 @@
+// Package managedkeys provides access to keys whose private material is held
+// outside of Vault, such as in a cloud KMS or an HSM. All operations using the
+// private key are delegated to the service holding it.
+package managedkeys
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrNotFound is returned when a managed key is not configured, or is not
+	// available to the caller
+	ErrNotFound = errors.New("managed key not found")
+
+	// ErrUnsupportedOperation is returned when a managed key cannot perform
+	// the requested operation
+	ErrUnsupportedOperation = errors.New("operation not supported by managed key")
+)
+
+// Key is a key whose private material is held outside of Vault. Keys that
+// support decryption additionally implement crypto.Decrypter.
+type Key interface {
+	crypto.Signer
+}
+
+// Factory returns the key described by the given configuration parameters
+type Factory func(params map[string]string) (Key, error)
+
+// Provider creates the keys held by one kind of external service
+type Provider struct {
+	// RequiredParameters lists the parameters that must be set for keys of
+	// this type
+	RequiredParameters []string
+
+	// SensitiveParameters lists the parameters, such as credentials, that
+	// must not be returned when reading a key's configuration
+	SensitiveParameters []string
+
+	// Factory creates the key
+	Factory Factory
+}
+
+var (
+	providersLock sync.RWMutex
+	providers     = map[string]*Provider{
+		"awskms": awsKMSProvider,
+	}
+)
+
+// Register makes a provider available under the given type name, replacing
+// any existing provider for it. It allows providers for devices whose client
+// libraries are not built into Vault, such as PKCS#11 modules, to be added.
+func Register(keyType string, provider *Provider) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+	providers[keyType] = provider
+}
+
+// Types returns the names of the registered provider types
+func Types() []string {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+
+	ret := make([]string, 0, len(providers))
+	for keyType := range providers {
+		ret = append(ret, keyType)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// ValidateParameters checks that the provider for the key type exists and
+// that all its required parameters are set
+func ValidateParameters(keyType string, params map[string]string) error {
+	provider, err := getProvider(keyType)
+	if err != nil {
+		return err
+	}
+	for _, param := range provider.RequiredParameters {
+		if params[param] == "" {
+			return fmt.Errorf("parameter %q is required for managed keys of type %q", param, keyType)
+		}
+	}
+	return nil
+}
+
+// SensitiveParameters returns the parameters of keys of the given type that
+// must not be returned when reading their configuration
+func SensitiveParameters(keyType string) []string {
+	provider, err := getProvider(keyType)
+	if err != nil {
+		return nil
+	}
+	return provider.SensitiveParameters
+}
+
+// NewKey creates a key of the given type from its configuration parameters
+func NewKey(keyType string, params map[string]string) (Key, error) {
+	if err := ValidateParameters(keyType, params); err != nil {
+		return nil, err
+	}
+	provider, err := getProvider(keyType)
+	if err != nil {
+		return nil, err
+	}
+	return provider.Factory(params)
+}
+
+func getProvider(keyType string) (*Provider, error) {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+
+	provider, ok := providers[keyType]
+	if !ok {
+		return nil, fmt.Errorf("unknown managed key type %q", keyType)
+	}
+	return provider, nil
+}
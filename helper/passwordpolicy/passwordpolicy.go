@@ -0,0 +1,203 @@
+// Package passwordpolicy generates passwords from policies describing their
+// length and the characters they are made of.
+package passwordpolicy
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+)
+
+// ErrNotFound is returned when a password policy does not exist
+var ErrNotFound = errors.New("password policy not found")
+
+const (
+	// maxLength bounds the length of generated passwords
+	maxLength = 4096
+
+	// DefaultCharset is used by policies that do not have any charset rule
+	DefaultCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// Policy describes how passwords are generated, such as:
+//
+//	length = 20
+//
+//	rule "charset" {
+//	  charset   = "abcdefghijklmnopqrstuvwxyz"
+//	  min-chars = 1
+//	}
+//
+//	rule "charset" {
+//	  charset   = "0123456789"
+//	  min-chars = 1
+//	}
+//
+// Passwords are made of the characters of all the charset rules, with at
+// least the minimum number of characters of each rule.
+type Policy struct {
+	Length int
+	Rules  []*CharsetRule
+
+	// charset is the union of the charsets of the rules
+	charset []rune
+}
+
+// CharsetRule requires passwords to contain a minimum number of characters
+// from a charset
+type CharsetRule struct {
+	Charset  string `hcl:"charset"`
+	MinChars int    `hcl:"min-chars"`
+}
+
+// Parse parses a policy given in HCL or JSON
+func Parse(raw string) (*Policy, error) {
+	root, err := hcl.Parse(raw)
+	if err != nil {
+		return nil, errwrap.Wrapf("error parsing password policy: {{err}}", err)
+	}
+	list, ok := root.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("error parsing password policy: does not contain a root object")
+	}
+
+	p := &Policy{}
+	for _, item := range list.Items {
+		key := item.Keys[0].Token.Value().(string)
+		switch {
+		case key == "length" && len(item.Keys) == 1:
+			if err := hcl.DecodeObject(&p.Length, item.Val); err != nil {
+				return nil, errwrap.Wrapf("error parsing password policy length: {{err}}", err)
+			}
+
+		case key == "rule" && len(item.Keys) == 2:
+			ruleType := item.Keys[1].Token.Value().(string)
+			if ruleType != "charset" {
+				return nil, fmt.Errorf("unknown password policy rule %q", ruleType)
+			}
+			var rule CharsetRule
+			if err := hcl.DecodeObject(&rule, item.Val); err != nil {
+				return nil, errwrap.Wrapf("error parsing password policy rule: {{err}}", err)
+			}
+			p.Rules = append(p.Rules, &rule)
+
+		default:
+			return nil, fmt.Errorf("invalid key %q in password policy", key)
+		}
+	}
+
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Policy) validate() error {
+	if p.Length <= 0 || p.Length > maxLength {
+		return fmt.Errorf("password policy length must be between 1 and %d", maxLength)
+	}
+
+	seen := map[rune]bool{}
+	minChars := 0
+	for _, rule := range p.Rules {
+		if rule.Charset == "" {
+			return fmt.Errorf("password policy charset rules must have a charset")
+		}
+		if rule.MinChars < 0 {
+			return fmt.Errorf("password policy min-chars cannot be negative")
+		}
+		minChars += rule.MinChars
+
+		for _, r := range rule.Charset {
+			if !seen[r] {
+				seen[r] = true
+				p.charset = append(p.charset, r)
+			}
+		}
+	}
+	if minChars > p.Length {
+		return fmt.Errorf("password policy requires %d characters, more than its length of %d", minChars, p.Length)
+	}
+	if len(p.charset) == 0 {
+		p.charset = []rune(DefaultCharset)
+	}
+
+	return nil
+}
+
+// Generate returns a new random password satisfying the policy
+func (p *Policy) Generate() (string, error) {
+	password := make([]rune, 0, p.Length)
+
+	// The characters required by each rule are picked first, then the rest
+	// of the password is filled from all the charsets and shuffled
+	for _, rule := range p.Rules {
+		charset := []rune(rule.Charset)
+		for i := 0; i < rule.MinChars; i++ {
+			r, err := randomRune(charset)
+			if err != nil {
+				return "", err
+			}
+			password = append(password, r)
+		}
+	}
+	for len(password) < p.Length {
+		r, err := randomRune(p.charset)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, r)
+	}
+
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := randomInt(i + 1)
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j] = password[j], password[i]
+	}
+
+	return string(password), nil
+}
+
+// Validate checks that a password is at least as long as the policy's length
+// and has the minimum number of characters of each rule
+func (p *Policy) Validate(password string) error {
+	if n := len([]rune(password)); n < p.Length {
+		return fmt.Errorf("password must be at least %d characters long", p.Length)
+	}
+	for _, rule := range p.Rules {
+		count := 0
+		for _, r := range password {
+			if strings.ContainsRune(rule.Charset, r) {
+				count++
+			}
+		}
+		if count < rule.MinChars {
+			return fmt.Errorf("password must contain at least %d of the characters %q", rule.MinChars, rule.Charset)
+		}
+	}
+	return nil
+}
+
+func randomRune(charset []rune) (rune, error) {
+	i, err := randomInt(len(charset))
+	if err != nil {
+		return 0, err
+	}
+	return charset[i], nil
+}
+
+func randomInt(max int) (int, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		return 0, err
+	}
+	return int(n.Int64()), nil
+}
@@ -0,0 +1,113 @@
+package passwordpolicy
+
+import (
+	"strings"
+	"testing"
+)
+
+const testPolicy = `
+length = 20
+
+rule "charset" {
+  charset   = "abcdefghijklmnopqrstuvwxyz"
+  min-chars = 1
+}
+
+rule "charset" {
+  charset   = "0123456789"
+  min-chars = 4
+}
+`
+
+func TestParse(t *testing.T) {
+	p, err := Parse(testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Length != 20 || len(p.Rules) != 2 || p.Rules[1].MinChars != 4 {
+		t.Fatalf("bad: %#v", p)
+	}
+
+	p, err = Parse(`{"length": 8, "rule": {"charset": {"charset": "ab", "min-chars": 1}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Length != 8 || len(p.Rules) != 1 || p.Rules[0].Charset != "ab" {
+		t.Fatalf("bad: %#v", p)
+	}
+
+	for _, raw := range []string{
+		``,
+		`length = 0`,
+		`length = 10000`,
+		`length = 10
+		 foo = "bar"`,
+		`length = 10
+		 rule "unknown" {}`,
+		`length = 10
+		 rule "charset" { min-chars = 1 }`,
+		`length = 2
+		 rule "charset" {
+		   charset = "ab"
+		   min-chars = 3
+		 }`,
+	} {
+		if _, err := Parse(raw); err == nil {
+			t.Fatalf("expected error parsing %q", raw)
+		}
+	}
+}
+
+func TestPolicy_Generate(t *testing.T) {
+	p, err := Parse(testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		password, err := p.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(password) != 20 {
+			t.Fatalf("bad length: %q", password)
+		}
+		if strings.Trim(password, "abcdefghijklmnopqrstuvwxyz0123456789") != "" {
+			t.Fatalf("unexpected characters: %q", password)
+		}
+		if err := p.Validate(password); err != nil {
+			t.Fatalf("generated password %q is invalid: %s", password, err)
+		}
+	}
+
+	p, err = Parse(`length = 32`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, err := p.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(password) != 32 || strings.Trim(password, DefaultCharset) != "" {
+		t.Fatalf("bad: %q", password)
+	}
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	p, err := Parse(testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for password, valid := range map[string]bool{
+		"abcdefghijklmnop1234":   true,
+		"ABCDEFGHIJKLMNOPa1234!": true,
+		"abcdefghijklmnop123":    false,
+		"abcdefghijklmnopqrs1":   false,
+		"ABCDEFGHIJKLMNOP1234":   false,
+	} {
+		if err := p.Validate(password); (err == nil) != valid {
+			t.Fatalf("password %q: expected valid=%t, got %v", password, valid, err)
+		}
+	}
+}
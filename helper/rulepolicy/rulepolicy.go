@@ -0,0 +1,764 @@
+// Package rulepolicy evaluates rule-based policies against the context of a
+// request, such as:
+//
+//	# Only the operators may write, during business hours
+//	is_operator = rule { identity.groups contains "operators" }
+//	business_hours = rule { time.hour >= 9 and time.hour < 17 }
+//
+//	main = rule {
+//	  request.operation in ["read", "list"] or
+//	  (is_operator and business_hours)
+//	}
+//
+// A policy is a list of named rules, and passes when its "main" rule is
+// true. Rules are boolean expressions over the values of the context and the
+// other rules, using the "and", "or" and "not" logical operators, the "==",
+// "!=", "<", "<=", ">" and ">=" comparisons, and the "contains", "in" and
+// "matches" (regular expression) operators, which can be negated with "not"
+// as in "x not in y". Values are strings, numbers, booleans, lists and null,
+// and the fields of the context are selected with "." or "[...]". Missing
+// fields are null.
+package rulepolicy
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrNotFound is returned when a rule policy does not exist
+var ErrNotFound = errors.New("rule policy not found")
+
+// mainRule is the rule deciding whether a policy passes
+const mainRule = "main"
+
+// Policy is a parsed rule policy
+type Policy struct {
+	rules map[string]node
+}
+
+// Parse parses the text of a policy
+func Parse(raw string) (*Policy, error) {
+	tokens, err := lex(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	policy := &Policy{
+		rules: make(map[string]node),
+	}
+	for !p.done() {
+		name, err := p.expect(tokenIdent)
+		if err != nil {
+			return nil, err
+		}
+		if keywords[name.text] {
+			return nil, p.errorf(name, "%q is a reserved word", name.text)
+		}
+		if _, ok := policy.rules[name.text]; ok {
+			return nil, p.errorf(name, "rule %q is defined twice", name.text)
+		}
+		if _, err := p.expectText("="); err != nil {
+			return nil, err
+		}
+
+		var expr node
+		if p.peekText("rule") {
+			p.next()
+			if _, err := p.expectText("{"); err != nil {
+				return nil, err
+			}
+			if expr, err = p.parseExpr(); err != nil {
+				return nil, err
+			}
+			if _, err := p.expectText("}"); err != nil {
+				return nil, err
+			}
+		} else if expr, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		policy.rules[name.text] = expr
+	}
+
+	if _, ok := policy.rules[mainRule]; !ok {
+		return nil, fmt.Errorf("policy must define a %q rule", mainRule)
+	}
+	return policy, nil
+}
+
+// Eval evaluates a policy against a context, whose keys are the names of the
+// values rules refer to. It returns whether the main rule is true.
+func (p *Policy) Eval(context map[string]interface{}) (bool, error) {
+	s := &evalState{
+		policy:     p,
+		context:    context,
+		results:    make(map[string]interface{}),
+		evaluating: make(map[string]bool),
+	}
+	result, err := s.rule(mainRule)
+	if err != nil {
+		return false, err
+	}
+	passed, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("rule %q is not a boolean", mainRule)
+	}
+	return passed, nil
+}
+
+// keywords cannot be used as rule names
+var keywords = map[string]bool{
+	"rule":     true,
+	"and":      true,
+	"or":       true,
+	"not":      true,
+	"in":       true,
+	"contains": true,
+	"matches":  true,
+	"true":     true,
+	"false":    true,
+	"null":     true,
+}
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenString
+	tokenNumber
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+// lex splits the text of a policy into tokens, skipping the comments
+func lex(raw string) ([]token, error) {
+	var tokens []token
+	runes := []rune(raw)
+	line := 1
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			line++
+			i++
+
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '#' || (r == '/' && i+1 < len(runes) && runes[i+1] == '/'):
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			start := line
+			for i += 2; i+1 < len(runes) && !(runes[i] == '*' && runes[i+1] == '/'); i++ {
+				if runes[i] == '\n' {
+					line++
+				}
+			}
+			if i+1 >= len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated comment", start)
+			}
+			i += 2
+
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[start:i]), line: line})
+
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i]), line: line})
+
+		case r == '"':
+			start := i
+			i++
+			for i < len(runes) && runes[i] != '"' {
+				if runes[i] == '\\' {
+					i++
+				}
+				if i < len(runes) && runes[i] == '\n' {
+					return nil, fmt.Errorf("line %d: unterminated string", line)
+				}
+				i++
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+			i++
+			text, err := strconv.Unquote(string(runes[start:i]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid string %s", line, string(runes[start:i]))
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, line: line})
+
+		default:
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "==", "!=", "<=", ">=":
+					tokens = append(tokens, token{kind: tokenPunct, text: two, line: line})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("={}()[],.<>", r) {
+				return nil, fmt.Errorf("line %d: unexpected character %q", line, r)
+			}
+			tokens = append(tokens, token{kind: tokenPunct, text: string(r), line: line})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() *token {
+	if p.done() {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+// peekText returns whether the next token is the given punctuation or
+// identifier
+func (p *parser) peekText(text string) bool {
+	t := p.peek()
+	return t != nil && (t.kind == tokenPunct || t.kind == tokenIdent) && t.text == text
+}
+
+// peekTextAt is peekText for the token at the given offset
+func (p *parser) peekTextAt(offset int, text string) bool {
+	if p.pos+offset >= len(p.tokens) {
+		return false
+	}
+	t := p.tokens[p.pos+offset]
+	return (t.kind == tokenPunct || t.kind == tokenIdent) && t.text == text
+}
+
+func (p *parser) next() *token {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) errorf(t *token, format string, args ...interface{}) error {
+	if t == nil {
+		return fmt.Errorf("unexpected end of policy: "+format, args...)
+	}
+	return fmt.Errorf("line %d: "+format, append([]interface{}{t.line}, args...)...)
+}
+
+func (p *parser) expect(kind tokenKind) (*token, error) {
+	t := p.next()
+	if t == nil || t.kind != kind {
+		return nil, p.errorf(t, "unexpected %s", describe(t))
+	}
+	return t, nil
+}
+
+func (p *parser) expectText(text string) (*token, error) {
+	t := p.next()
+	if t == nil || t.text != text || (t.kind != tokenPunct && t.kind != tokenIdent) {
+		return nil, p.errorf(t, "expected %q, got %s", text, describe(t))
+	}
+	return t, nil
+}
+
+func describe(t *token) string {
+	if t == nil {
+		return "end of policy"
+	}
+	return strconv.Quote(t.text)
+}
+
+// parseExpr parses the "or" of "and" of negated comparisons
+func (p *parser) parseExpr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekText("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{or: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekText("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.peekText("not") {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+var comparisonOperators = map[string]bool{
+	"==":       true,
+	"!=":       true,
+	"<":        true,
+	"<=":       true,
+	">":        true,
+	">=":       true,
+	"contains": true,
+	"in":       true,
+	"matches":  true,
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	negated := false
+	if p.peekText("not") {
+		for _, op := range []string{"contains", "in", "matches"} {
+			if p.peekTextAt(1, op) {
+				p.next()
+				negated = true
+			}
+		}
+	}
+	t := p.peek()
+	if t == nil || !comparisonOperators[t.text] || t.kind == tokenString {
+		return left, nil
+	}
+	p.next()
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	var result node = &comparisonNode{op: t.text, left: left, right: right}
+	if negated {
+		result = &notNode{operand: result}
+	}
+	return result, nil
+}
+
+func (p *parser) parseOperand() (node, error) {
+	t := p.next()
+	if t == nil {
+		return nil, p.errorf(t, "expected a value")
+	}
+
+	var operand node
+	switch {
+	case t.kind == tokenString:
+		operand = &literalNode{value: t.text}
+
+	case t.kind == tokenNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid number %q", t.text)
+		}
+		operand = &literalNode{value: f}
+
+	case t.kind == tokenIdent && (t.text == "true" || t.text == "false"):
+		operand = &literalNode{value: t.text == "true"}
+
+	case t.kind == tokenIdent && t.text == "null":
+		operand = &literalNode{}
+
+	case t.kind == tokenIdent && !keywords[t.text]:
+		operand = &identNode{name: t.text}
+
+	case t.text == "(":
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expectText(")"); err != nil {
+			return nil, err
+		}
+		operand = expr
+
+	case t.text == "[":
+		list := &listNode{}
+		for !p.peekText("]") {
+			elem, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			list.elems = append(list.elems, elem)
+			if !p.peekText(",") {
+				break
+			}
+			p.next()
+		}
+		if _, err := p.expectText("]"); err != nil {
+			return nil, err
+		}
+		operand = list
+
+	default:
+		return nil, p.errorf(t, "unexpected %s", describe(t))
+	}
+
+	// Selectors
+	for {
+		switch {
+		case p.peekText("."):
+			p.next()
+			field, err := p.expect(tokenIdent)
+			if err != nil {
+				return nil, err
+			}
+			operand = &indexNode{target: operand, key: &literalNode{value: field.text}}
+
+		case p.peekText("["):
+			p.next()
+			key, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expectText("]"); err != nil {
+				return nil, err
+			}
+			operand = &indexNode{target: operand, key: key}
+
+		default:
+			return operand, nil
+		}
+	}
+}
+
+type node interface {
+	eval(s *evalState) (interface{}, error)
+}
+
+type evalState struct {
+	policy     *Policy
+	context    map[string]interface{}
+	results    map[string]interface{}
+	evaluating map[string]bool
+}
+
+// rule returns the value of a rule, which is evaluated once
+func (s *evalState) rule(name string) (interface{}, error) {
+	if result, ok := s.results[name]; ok {
+		return result, nil
+	}
+	if s.evaluating[name] {
+		return nil, fmt.Errorf("rule %q refers to itself", name)
+	}
+
+	s.evaluating[name] = true
+	result, err := s.policy.rules[name].eval(s)
+	if err != nil {
+		return nil, err
+	}
+	s.results[name] = result
+	return result, nil
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(s *evalState) (interface{}, error) {
+	return n.value, nil
+}
+
+type listNode struct {
+	elems []node
+}
+
+func (n *listNode) eval(s *evalState) (interface{}, error) {
+	list := make([]interface{}, 0, len(n.elems))
+	for _, elem := range n.elems {
+		value, err := elem.eval(s)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+	return list, nil
+}
+
+// identNode is a rule or a value of the context
+type identNode struct {
+	name string
+}
+
+func (n *identNode) eval(s *evalState) (interface{}, error) {
+	if _, ok := s.policy.rules[n.name]; ok {
+		return s.rule(n.name)
+	}
+	if value, ok := s.context[n.name]; ok {
+		return normalize(value), nil
+	}
+	return nil, fmt.Errorf("undefined value %q", n.name)
+}
+
+type indexNode struct {
+	target node
+	key    node
+}
+
+func (n *indexNode) eval(s *evalState) (interface{}, error) {
+	target, err := n.target.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	key, err := n.key.eval(s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch target := target.(type) {
+	case map[string]interface{}:
+		k, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("map keys must be strings, got %v", key)
+		}
+		return normalize(target[k]), nil
+
+	case []interface{}:
+		f, ok := key.(float64)
+		if !ok || f != float64(int(f)) {
+			return nil, fmt.Errorf("list indexes must be integers, got %v", key)
+		}
+		if int(f) < 0 || int(f) >= len(target) {
+			return nil, nil
+		}
+		return target[int(f)], nil
+
+	case nil:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("cannot select %v of %v", key, target)
+}
+
+type logicalNode struct {
+	or          bool
+	left, right node
+}
+
+func (n *logicalNode) eval(s *evalState) (interface{}, error) {
+	left, err := evalBool(s, n.left)
+	if err != nil {
+		return nil, err
+	}
+	if left == n.or {
+		return left, nil
+	}
+	return evalBool(s, n.right)
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n *notNode) eval(s *evalState) (interface{}, error) {
+	value, err := evalBool(s, n.operand)
+	if err != nil {
+		return nil, err
+	}
+	return !value, nil
+}
+
+func evalBool(s *evalState, n node) (bool, error) {
+	value, err := n.eval(s)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected a boolean, got %v", value)
+	}
+	return b, nil
+}
+
+type comparisonNode struct {
+	op          string
+	left, right node
+}
+
+func (n *comparisonNode) eval(s *evalState) (interface{}, error) {
+	left, err := n.left.eval(s)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return reflect.DeepEqual(left, right), nil
+	case "!=":
+		return !reflect.DeepEqual(left, right), nil
+	case "contains":
+		return contains(left, right)
+	case "in":
+		return contains(right, left)
+	case "matches":
+		l, lok := left.(string)
+		r, rok := right.(string)
+		if !lok || !rok {
+			return nil, fmt.Errorf("matches requires strings, got %v and %v", left, right)
+		}
+		re, err := regexp.Compile(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %v", r, err)
+		}
+		return re.MatchString(l), nil
+	}
+
+	// Ordering comparisons
+	var cmp int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %v and %v", left, right)
+		}
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare %v and %v", left, right)
+		}
+		cmp = strings.Compare(l, r)
+	default:
+		return nil, fmt.Errorf("cannot compare %v and %v", left, right)
+	}
+
+	switch n.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+// contains returns whether a list contains a value, a string a substring or
+// a map a key
+func contains(container, value interface{}) (bool, error) {
+	switch c := container.(type) {
+	case []interface{}:
+		for _, elem := range c {
+			if reflect.DeepEqual(elem, value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case string:
+		v, ok := value.(string)
+		if !ok {
+			return false, fmt.Errorf("strings can only contain strings, got %v", value)
+		}
+		return strings.Contains(c, v), nil
+	case map[string]interface{}:
+		v, ok := value.(string)
+		if !ok {
+			return false, nil
+		}
+		_, ok = c[v]
+		return ok, nil
+	case nil:
+		return false, nil
+	}
+	return false, fmt.Errorf("%v is not a list, string or map", container)
+}
+
+// normalize converts the values of the context to the types rules work on:
+// float64 numbers, []interface{} lists and map[string]interface{} maps
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, bool, float64, map[string]interface{}:
+		return value
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32:
+		return rv.Float()
+	case reflect.Slice, reflect.Array:
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = normalize(rv.Index(i).Interface())
+		}
+		return list
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		m := make(map[string]interface{}, rv.Len())
+		for _, k := range rv.MapKeys() {
+			m[k.String()] = normalize(rv.MapIndex(k).Interface())
+		}
+		return m
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil
+		}
+		return normalize(rv.Elem().Interface())
+	}
+	return fmt.Sprintf("%v", value)
+}
@@ -0,0 +1,90 @@
+package rulepolicy
+
+import (
+	"testing"
+)
+
+func TestPolicy_Eval(t *testing.T) {
+	context := map[string]interface{}{
+		"request": map[string]interface{}{
+			"path":      "secret/foo",
+			"operation": "update",
+			"data": map[string]interface{}{
+				"ttl": 30,
+			},
+		},
+		"identity": map[string]interface{}{
+			"groups": []string{"operators", "everyone"},
+		},
+		"time": map[string]interface{}{
+			"hour": 10,
+		},
+	}
+
+	for raw, expected := range map[string]bool{
+		`main = rule { true }`: true,
+		`main = rule { request.path == "secret/foo" and request.operation != "read" }`: true,
+		`main = rule { request.operation in ["read", "list"] }`:                        false,
+		`main = rule { request.operation not in ["read", "list"] }`:                    true,
+		`main = rule { identity.groups contains "operators" }`:                         true,
+		`main = rule { identity["groups"][1] == "everyone" }`:                          true,
+		`main = rule { request.data.ttl <= 60 and request.data.ttl > 29.5 }`:           true,
+		`main = rule { request.data.missing == null }`:                                 true,
+		`main = rule { request.path matches "^secret/" }`:                              true,
+		`main = rule { request.path not matches "^secret/" }`:                          false,
+		`main = rule { not (request.path contains "foo") or false }`:                   false,
+		`
+# Operators may write during business hours
+is_operator = rule { identity.groups contains "operators" }
+business_hours = rule { time.hour >= 9 and time.hour < 17 } // UTC
+/* Reads are always allowed */
+main = rule {
+	request.operation in ["read", "list"] or
+	(is_operator and business_hours)
+}`: true,
+	} {
+		policy, err := Parse(raw)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", raw, err)
+		}
+		passed, err := policy.Eval(context)
+		if err != nil {
+			t.Fatalf("failed to evaluate %q: %v", raw, err)
+		}
+		if passed != expected {
+			t.Fatalf("bad result for %q: %v", raw, passed)
+		}
+	}
+}
+
+func TestPolicy_errors(t *testing.T) {
+	for _, raw := range []string{
+		``,
+		`allowed = rule { true }`,
+		`main = rule { true`,
+		`main = rule { "foo }`,
+		`main = rule { true } main = rule { false }`,
+		`and = rule { true } main = rule { and }`,
+		`main = rule { 1 == }`,
+		`main = rule { a ! b }`,
+	} {
+		if _, err := Parse(raw); err == nil {
+			t.Fatalf("expected error parsing %q", raw)
+		}
+	}
+
+	for _, raw := range []string{
+		`main = rule { undefined }`,
+		`main = rule { "foo" }`,
+		`main = rule { 1 < "2" }`,
+		`main = rule { a } a = rule { main }`,
+	} {
+		policy, err := Parse(raw)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", raw, err)
+		}
+		if _, err := policy.Eval(nil); err == nil {
+			t.Fatalf("expected error evaluating %q", raw)
+		}
+	}
+}
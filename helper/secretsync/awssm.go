@@ -0,0 +1,148 @@
+package secretsync
+
+import (
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/jsonrpc"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/helper/awsutil"
+)
+
+var awsSecretsManagerProvider = &Provider{
+	SensitiveParameters: []string{"secret_key"},
+	InvalidNameChars:    regexp.MustCompile(`[^a-zA-Z0-9/_+=.@-]`),
+	MaxNameLength:       512,
+	Factory:             newAWSSecretsManager,
+}
+
+// awsSecretsManager is an AWS Secrets Manager destination. Only the subset of
+// the Secrets Manager API needed is implemented, on top of the SDK's JSON RPC
+// protocol.
+type awsSecretsManager struct {
+	client *client.Client
+}
+
+type smSecretInput struct {
+	SecretId                   *string
+	Name                       *string
+	SecretString               *string
+	ForceDeleteWithoutRecovery *bool
+}
+
+type smSecretOutput struct {
+	SecretString *string
+}
+
+// newAWSSecretsManager creates a destination from the optional "region",
+// "access_key", "secret_key" and "endpoint" parameters
+func newAWSSecretsManager(params map[string]string) (Destination, error) {
+	credsConfig := &awsutil.CredentialsConfig{
+		AccessKey:  params["access_key"],
+		SecretKey:  params["secret_key"],
+		Region:     params["region"],
+		HTTPClient: cleanhttp.DefaultClient(),
+	}
+	if credsConfig.Region == "" {
+		credsConfig.Region = "us-east-1"
+	}
+	creds, err := credsConfig.GenerateCredentialChain()
+	if err != nil {
+		return nil, err
+	}
+
+	awsConfig := &aws.Config{
+		Credentials: creds,
+		Region:      aws.String(credsConfig.Region),
+		HTTPClient:  cleanhttp.DefaultClient(),
+	}
+	if endpoint := params["endpoint"]; endpoint != "" {
+		awsConfig.Endpoint = aws.String(endpoint)
+	}
+
+	c := session.New(awsConfig).ClientConfig("secretsmanager")
+	smClient := client.New(
+		*c.Config,
+		metadata.ClientInfo{
+			ServiceName:   "secretsmanager",
+			SigningName:   c.SigningName,
+			SigningRegion: c.SigningRegion,
+			Endpoint:      c.Endpoint,
+			APIVersion:    "2017-10-17",
+			JSONVersion:   "1.1",
+			TargetPrefix:  "secretsmanager",
+		},
+		c.Handlers,
+	)
+	smClient.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	smClient.Handlers.Build.PushBackNamed(jsonrpc.BuildHandler)
+	smClient.Handlers.Unmarshal.PushBackNamed(jsonrpc.UnmarshalHandler)
+	smClient.Handlers.UnmarshalMeta.PushBackNamed(jsonrpc.UnmarshalMetaHandler)
+	smClient.Handlers.UnmarshalError.PushBackNamed(jsonrpc.UnmarshalErrorHandler)
+
+	return &awsSecretsManager{
+		client: smClient,
+	}, nil
+}
+
+func (d *awsSecretsManager) send(operation string, input, output interface{}) error {
+	return d.client.NewRequest(&request.Operation{
+		Name:       operation,
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}, input, output).Send()
+}
+
+func isAWSNotFound(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == "ResourceNotFoundException"
+}
+
+// Put replaces the value of the secret, creating it if it does not exist
+func (d *awsSecretsManager) Put(name, value string) error {
+	err := d.send("PutSecretValue", &smSecretInput{
+		SecretId:     aws.String(name),
+		SecretString: aws.String(value),
+	}, &smSecretOutput{})
+	if !isAWSNotFound(err) {
+		return err
+	}
+
+	return d.send("CreateSecret", &smSecretInput{
+		Name:         aws.String(name),
+		SecretString: aws.String(value),
+	}, &smSecretOutput{})
+}
+
+func (d *awsSecretsManager) Get(name string) (string, error) {
+	output := &smSecretOutput{}
+	err := d.send("GetSecretValue", &smSecretInput{
+		SecretId: aws.String(name),
+	}, output)
+	if isAWSNotFound(err) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.SecretString), nil
+}
+
+// Delete deletes the secret immediately, without a recovery window, so that
+// it can be created again if the secret is synced again
+func (d *awsSecretsManager) Delete(name string) error {
+	err := d.send("DeleteSecret", &smSecretInput{
+		SecretId:                   aws.String(name),
+		ForceDeleteWithoutRecovery: aws.Bool(true),
+	}, &smSecretOutput{})
+	if isAWSNotFound(err) {
+		return nil
+	}
+	return err
+}
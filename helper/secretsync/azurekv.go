@@ -0,0 +1,126 @@
+package secretsync
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+const keyVaultAPIVersion = "7.4"
+
+var azureKeyVaultProvider = &Provider{
+	RequiredParameters:  []string{"vault_url", "tenant_id", "client_id", "client_secret"},
+	SensitiveParameters: []string{"client_secret"},
+	InvalidNameChars:    regexp.MustCompile(`[^a-zA-Z0-9-]`),
+	MaxNameLength:       127,
+	Factory:             newAzureKeyVault,
+}
+
+// azureKeyVault is an Azure Key Vault destination, using its REST API
+type azureKeyVault struct {
+	httpClient *http.Client
+
+	// vaultURL is the URL of the key vault, such as
+	// "https://example.vault.azure.net"
+	vaultURL string
+
+	// token returns an access token to the key vault
+	tokenLock sync.Mutex
+	token     func() (string, error)
+}
+
+// newAzureKeyVault creates a destination in the key vault at the "vault_url"
+// parameter, authenticating as the service principal of the "tenant_id",
+// "client_id" and "client_secret" parameters. The optional "environment"
+// parameter selects the Azure cloud.
+func newAzureKeyVault(params map[string]string) (Destination, error) {
+	environment := azure.PublicCloud
+	if params["environment"] != "" {
+		var err error
+		environment, err = azure.EnvironmentFromName(params["environment"])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	oauthConfig, err := adal.NewOAuthConfig(environment.ActiveDirectoryEndpoint, params["tenant_id"])
+	if err != nil {
+		return nil, err
+	}
+	resource := strings.TrimSuffix(environment.KeyVaultEndpoint, "/")
+	spt, err := adal.NewServicePrincipalToken(*oauthConfig, params["client_id"], params["client_secret"], resource)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient := cleanhttp.DefaultClient()
+	httpClient.Timeout = 30 * time.Second
+	spt.SetSender(httpClient)
+
+	return &azureKeyVault{
+		httpClient: httpClient,
+		vaultURL:   strings.TrimSuffix(params["vault_url"], "/"),
+		token: func() (string, error) {
+			if err := spt.EnsureFresh(); err != nil {
+				return "", err
+			}
+			return spt.OAuthToken(), nil
+		},
+	}, nil
+}
+
+func (d *azureKeyVault) do(method, path string, in, out interface{}) error {
+	d.tokenLock.Lock()
+	token, err := d.token()
+	d.tokenLock.Unlock()
+	if err != nil {
+		return fmt.Errorf("error getting an access token: %s", err)
+	}
+
+	return doJSON(d.httpClient, method, fmt.Sprintf("%s/%s?api-version=%s", d.vaultURL, path, keyVaultAPIVersion), token, in, out)
+}
+
+type keyVaultSecret struct {
+	Value string `json:"value"`
+}
+
+// Put sets a new version of the secret
+func (d *azureKeyVault) Put(name, value string) error {
+	return d.do("PUT", "secrets/"+url.PathEscape(name), &keyVaultSecret{Value: value}, nil)
+}
+
+func (d *azureKeyVault) Get(name string) (string, error) {
+	var secret keyVaultSecret
+	err := d.do("GET", "secrets/"+url.PathEscape(name), nil, &secret)
+	if isStatus(err, http.StatusNotFound) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return secret.Value, nil
+}
+
+// Delete deletes the secret, and purges it when the key vault keeps deleted
+// secrets so that it can be created again if the secret is synced again.
+// Purging requires the purge permission, and failures to purge are ignored.
+func (d *azureKeyVault) Delete(name string) error {
+	err := d.do("DELETE", "secrets/"+url.PathEscape(name), nil, nil)
+	if isStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	d.do("DELETE", "deletedsecrets/"+url.PathEscape(name), nil, nil)
+	return nil
+}
@@ -0,0 +1,121 @@
+package secretsync
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+var gcpSecretManagerProvider = &Provider{
+	RequiredParameters:  []string{"project"},
+	SensitiveParameters: []string{"credentials"},
+	InvalidNameChars:    regexp.MustCompile(`[^a-zA-Z0-9_-]`),
+	MaxNameLength:       255,
+	Factory:             newGCPSecretManager,
+}
+
+// gcpSecretManager is a Google Cloud Secret Manager destination, using its
+// REST API
+type gcpSecretManager struct {
+	httpClient *http.Client
+
+	// endpoint is the base URL of the API, ending with a slash
+	endpoint string
+	project  string
+}
+
+// newGCPSecretManager creates a destination in the "project" parameter,
+// authenticating with the optional "credentials" service account file or the
+// application default credentials
+func newGCPSecretManager(params map[string]string) (Destination, error) {
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, cleanhttp.DefaultClient())
+	scope := "https://www.googleapis.com/auth/cloud-platform"
+
+	var tokenSource oauth2.TokenSource
+	if credentials := params["credentials"]; credentials != "" {
+		jwtConfig, err := google.JWTConfigFromJSON([]byte(credentials), scope)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing credentials: %s", err)
+		}
+		tokenSource = jwtConfig.TokenSource(ctx)
+	} else {
+		var err error
+		tokenSource, err = google.DefaultTokenSource(ctx, scope)
+		if err != nil {
+			return nil, fmt.Errorf("error finding the application default credentials: %s", err)
+		}
+	}
+
+	httpClient := oauth2.NewClient(ctx, tokenSource)
+	httpClient.Timeout = 30 * time.Second
+
+	return &gcpSecretManager{
+		httpClient: httpClient,
+		endpoint:   "https://secretmanager.googleapis.com/",
+		project:    params["project"],
+	}, nil
+}
+
+func (d *gcpSecretManager) secretURL(name string) string {
+	return fmt.Sprintf("%sv1/projects/%s/secrets/%s", d.endpoint, url.PathEscape(d.project), url.PathEscape(name))
+}
+
+type gcpSecretPayload struct {
+	Payload struct {
+		Data string `json:"data"`
+	} `json:"payload"`
+}
+
+// Put adds a version to the secret, creating it if it does not exist
+func (d *gcpSecretManager) Put(name, value string) error {
+	var version gcpSecretPayload
+	version.Payload.Data = base64.StdEncoding.EncodeToString([]byte(value))
+
+	err := doJSON(d.httpClient, "POST", d.secretURL(name)+":addVersion", "", &version, nil)
+	if !isStatus(err, http.StatusNotFound) {
+		return err
+	}
+
+	createURL := fmt.Sprintf("%sv1/projects/%s/secrets?secretId=%s", d.endpoint, url.PathEscape(d.project), url.QueryEscape(name))
+	if err := doJSON(d.httpClient, "POST", createURL, "", map[string]interface{}{
+		"replication": map[string]interface{}{
+			"automatic": map[string]interface{}{},
+		},
+	}, nil); err != nil {
+		return err
+	}
+	return doJSON(d.httpClient, "POST", d.secretURL(name)+":addVersion", "", &version, nil)
+}
+
+func (d *gcpSecretManager) Get(name string) (string, error) {
+	var version gcpSecretPayload
+	err := doJSON(d.httpClient, "GET", d.secretURL(name)+"/versions/latest:access", "", nil, &version)
+	if isStatus(err, http.StatusNotFound) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	value, err := base64.StdEncoding.DecodeString(version.Payload.Data)
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+func (d *gcpSecretManager) Delete(name string) error {
+	err := doJSON(d.httpClient, "DELETE", d.secretURL(name), "", nil, nil)
+	if isStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,152 @@
+// Package secretsync provides access to the external secret stores Vault
+// pushes secrets to, such as AWS Secrets Manager. Only the operations needed
+// to keep a copy of a secret up to date are implemented.
+package secretsync
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound is returned when a secret does not exist in a destination
+var ErrNotFound = errors.New("secret not found in destination")
+
+// Destination is an external secret store
+type Destination interface {
+	// Put creates the named secret, or replaces its value
+	Put(name, value string) error
+
+	// Get returns the value of the named secret, or ErrNotFound
+	Get(name string) (string, error)
+
+	// Delete removes the named secret. Deleting a secret that does not
+	// exist succeeds.
+	Delete(name string) error
+}
+
+// Factory returns the destination described by the given configuration
+// parameters
+type Factory func(params map[string]string) (Destination, error)
+
+// Provider creates the destinations of one kind of external store
+type Provider struct {
+	// RequiredParameters lists the parameters that must be set for
+	// destinations of this type
+	RequiredParameters []string
+
+	// SensitiveParameters lists the parameters, such as credentials, that
+	// must not be returned when reading a destination's configuration
+	SensitiveParameters []string
+
+	// InvalidNameChars matches the characters that secret names cannot
+	// contain in the store, which are replaced with dashes
+	InvalidNameChars *regexp.Regexp
+
+	// MaxNameLength is the maximum length of secret names in the store
+	MaxNameLength int
+
+	// Factory creates the destination
+	Factory Factory
+}
+
+var (
+	providersLock sync.RWMutex
+	providers     = map[string]*Provider{
+		"aws-sm":   awsSecretsManagerProvider,
+		"azure-kv": azureKeyVaultProvider,
+		"gcp-sm":   gcpSecretManagerProvider,
+	}
+)
+
+// Register makes a provider available under the given type name, replacing
+// any existing provider for it
+func Register(destType string, provider *Provider) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+	providers[destType] = provider
+}
+
+// Types returns the names of the registered provider types
+func Types() []string {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+
+	ret := make([]string, 0, len(providers))
+	for destType := range providers {
+		ret = append(ret, destType)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// ValidateParameters checks that the provider for the destination type
+// exists and that all its required parameters are set
+func ValidateParameters(destType string, params map[string]string) error {
+	provider, err := getProvider(destType)
+	if err != nil {
+		return err
+	}
+	for _, param := range provider.RequiredParameters {
+		if params[param] == "" {
+			return fmt.Errorf("parameter %q is required for destinations of type %q", param, destType)
+		}
+	}
+	return nil
+}
+
+// SensitiveParameters returns the parameters of destinations of the given
+// type that must not be returned when reading their configuration
+func SensitiveParameters(destType string) []string {
+	provider, err := getProvider(destType)
+	if err != nil {
+		return nil
+	}
+	return provider.SensitiveParameters
+}
+
+// SecretName returns the name of the secret holding the Vault secret at the
+// given mount and path in destinations of the given type, such as
+// "vault-secret-app-db"
+func SecretName(destType, mount, path string) string {
+	name := "vault/" + strings.Trim(mount, "/") + "/" + strings.Trim(path, "/")
+
+	provider, err := getProvider(destType)
+	if err != nil {
+		return name
+	}
+	if provider.InvalidNameChars != nil {
+		name = provider.InvalidNameChars.ReplaceAllString(name, "-")
+	}
+	if provider.MaxNameLength > 0 && len(name) > provider.MaxNameLength {
+		name = name[:provider.MaxNameLength]
+	}
+	return name
+}
+
+// NewDestination creates a destination of the given type from its
+// configuration parameters
+func NewDestination(destType string, params map[string]string) (Destination, error) {
+	if err := ValidateParameters(destType, params); err != nil {
+		return nil, err
+	}
+	provider, err := getProvider(destType)
+	if err != nil {
+		return nil, err
+	}
+	return provider.Factory(params)
+}
+
+func getProvider(destType string) (*Provider, error) {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+
+	provider, ok := providers[destType]
+	if !ok {
+		return nil, fmt.Errorf("unknown sync destination type %q", destType)
+	}
+	return provider, nil
+}
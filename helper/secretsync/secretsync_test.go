@@ -0,0 +1,241 @@
+package secretsync
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+// fakeStore keeps the secrets of a fake destination API
+type fakeStore struct {
+	sync.Mutex
+	secrets map[string]string
+}
+
+func (f *fakeStore) get(name string) (string, bool) {
+	f.Lock()
+	defer f.Unlock()
+	value, ok := f.secrets[name]
+	return value, ok
+}
+
+// testDestination puts, reads and deletes a secret
+func testDestination(t *testing.T, d Destination, store *fakeStore) {
+	if _, err := d.Get("app"); err != ErrNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	for _, value := range []string{`{"password":"a"}`, `{"password":"b"}`} {
+		if err := d.Put("app", value); err != nil {
+			t.Fatal(err)
+		}
+		got, err := d.Get("app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored, _ := store.get("app"); got != value || stored != value {
+			t.Fatalf("bad value: %q %q", got, stored)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := d.Delete("app"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := store.get("app"); ok {
+		t.Fatal("secret was not deleted")
+	}
+}
+
+func TestAWSSecretsManager(t *testing.T) {
+	store := &fakeStore{secrets: map[string]string{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			SecretId                   string
+			Name                       string
+			SecretString               string
+			ForceDeleteWithoutRecovery bool
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Fatal(err)
+		}
+
+		store.Lock()
+		defer store.Unlock()
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		notFound := func() {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"secret not found"}`))
+		}
+
+		var output interface{} = map[string]interface{}{}
+		switch r.Header.Get("X-Amz-Target") {
+		case "secretsmanager.CreateSecret":
+			store.secrets[input.Name] = input.SecretString
+		case "secretsmanager.PutSecretValue":
+			if _, ok := store.secrets[input.SecretId]; !ok {
+				notFound()
+				return
+			}
+			store.secrets[input.SecretId] = input.SecretString
+		case "secretsmanager.GetSecretValue":
+			value, ok := store.secrets[input.SecretId]
+			if !ok {
+				notFound()
+				return
+			}
+			output = map[string]interface{}{"SecretString": value}
+		case "secretsmanager.DeleteSecret":
+			if _, ok := store.secrets[input.SecretId]; !ok || !input.ForceDeleteWithoutRecovery {
+				notFound()
+				return
+			}
+			delete(store.secrets, input.SecretId)
+		default:
+			t.Fatalf("unexpected target %q", r.Header.Get("X-Amz-Target"))
+		}
+		json.NewEncoder(w).Encode(output)
+	}))
+	defer server.Close()
+
+	d, err := NewDestination("aws-sm", map[string]string{
+		"access_key": "AKIAEXAMPLE",
+		"secret_key": "secret",
+		"endpoint":   server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDestination(t, d, store)
+}
+
+func TestGCPSecretManager(t *testing.T) {
+	store := &fakeStore{secrets: map[string]string{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		store.Lock()
+		defer store.Unlock()
+
+		const prefix = "/v1/projects/my-project/secrets"
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			t.Fatalf("unexpected path %q", r.URL.Path)
+		}
+		path := strings.TrimPrefix(r.URL.Path, prefix)
+		notFound := func() {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"message":"secret not found"}}`))
+		}
+
+		switch {
+		case r.Method == "POST" && path == "":
+			store.secrets[r.URL.Query().Get("secretId")] = ""
+		case r.Method == "POST" && strings.HasSuffix(path, ":addVersion"):
+			name := strings.TrimSuffix(strings.TrimPrefix(path, "/"), ":addVersion")
+			if _, ok := store.secrets[name]; !ok {
+				notFound()
+				return
+			}
+			var version gcpSecretPayload
+			if err := json.NewDecoder(r.Body).Decode(&version); err != nil {
+				t.Fatal(err)
+			}
+			value, _ := base64.StdEncoding.DecodeString(version.Payload.Data)
+			store.secrets[name] = string(value)
+		case r.Method == "GET" && strings.HasSuffix(path, "/versions/latest:access"):
+			value, ok := store.secrets[strings.TrimSuffix(strings.TrimPrefix(path, "/"), "/versions/latest:access")]
+			if !ok {
+				notFound()
+				return
+			}
+			var version gcpSecretPayload
+			version.Payload.Data = base64.StdEncoding.EncodeToString([]byte(value))
+			json.NewEncoder(w).Encode(&version)
+			return
+		case r.Method == "DELETE":
+			name := strings.TrimPrefix(path, "/")
+			if _, ok := store.secrets[name]; !ok {
+				notFound()
+				return
+			}
+			delete(store.secrets, name)
+		default:
+			t.Fatalf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	testDestination(t, &gcpSecretManager{
+		httpClient: cleanhttp.DefaultClient(),
+		endpoint:   server.URL + "/",
+		project:    "my-project",
+	}, store)
+}
+
+func TestAzureKeyVault(t *testing.T) {
+	store := &fakeStore{secrets: map[string]string{}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" || r.URL.Query().Get("api-version") != keyVaultAPIVersion {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		store.Lock()
+		defer store.Unlock()
+		if strings.HasPrefix(r.URL.Path, "/deletedsecrets/") {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/secrets/")
+		value, ok := store.secrets[name]
+
+		switch r.Method {
+		case "PUT":
+			var secret keyVaultSecret
+			if err := json.NewDecoder(r.Body).Decode(&secret); err != nil {
+				t.Fatal(err)
+			}
+			store.secrets[name] = secret.Value
+		case "GET", "DELETE":
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":{"code":"SecretNotFound","message":"secret not found"}}`))
+				return
+			}
+			if r.Method == "DELETE" {
+				delete(store.secrets, name)
+			}
+		}
+		json.NewEncoder(w).Encode(&keyVaultSecret{Value: value})
+	}))
+	defer server.Close()
+
+	testDestination(t, &azureKeyVault{
+		httpClient: cleanhttp.DefaultClient(),
+		vaultURL:   server.URL,
+		token: func() (string, error) {
+			return "token", nil
+		},
+	}, store)
+}
+
+func TestSecretName(t *testing.T) {
+	for _, tc := range []struct {
+		destType string
+		expected string
+	}{
+		{"aws-sm", "vault/secret/app/db.prod"},
+		{"gcp-sm", "vault-secret-app-db-prod"},
+		{"azure-kv", "vault-secret-app-db-prod"},
+	} {
+		if name := SecretName(tc.destType, "secret/", "app/db.prod"); name != tc.expected {
+			t.Fatalf("bad %s name: %q", tc.destType, name)
+		}
+	}
+}
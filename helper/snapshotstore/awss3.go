@@ -0,0 +1,102 @@
+package snapshotstore
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/helper/awsutil"
+)
+
+var awsS3Provider = &Provider{
+	RequiredParameters:  []string{"bucket"},
+	SensitiveParameters: []string{"secret_key", "session_token"},
+	Factory:             newAWSS3Store,
+}
+
+// awsS3Store keeps the snapshots in an S3 bucket
+type awsS3Store struct {
+	client *s3.S3
+	bucket string
+}
+
+// newAWSS3Store creates a store in the "bucket" parameter, with the optional
+// "region", "access_key", "secret_key", "session_token", "endpoint" and
+// "s3_force_path_style" parameters
+func newAWSS3Store(params map[string]string) (Store, error) {
+	credsConfig := &awsutil.CredentialsConfig{
+		AccessKey:    params["access_key"],
+		SecretKey:    params["secret_key"],
+		SessionToken: params["session_token"],
+		Region:       params["region"],
+		HTTPClient:   cleanhttp.DefaultClient(),
+	}
+	if credsConfig.Region == "" {
+		credsConfig.Region = "us-east-1"
+	}
+	creds, err := credsConfig.GenerateCredentialChain()
+	if err != nil {
+		return nil, err
+	}
+
+	awsConfig := &aws.Config{
+		Credentials: creds,
+		Region:      aws.String(credsConfig.Region),
+		HTTPClient:  cleanhttp.DefaultClient(),
+	}
+	if endpoint := params["endpoint"]; endpoint != "" {
+		awsConfig.Endpoint = aws.String(endpoint)
+	}
+	if forcePathStyle := params["s3_force_path_style"]; forcePathStyle != "" {
+		b, err := strconv.ParseBool(forcePathStyle)
+		if err != nil {
+			return nil, err
+		}
+		awsConfig.S3ForcePathStyle = aws.Bool(b)
+	}
+
+	return &awsS3Store{
+		client: s3.New(session.New(awsConfig)),
+		bucket: params["bucket"],
+	}, nil
+}
+
+func (s *awsS3Store) Put(name string, data []byte) error {
+	_, err := s.client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(name),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+func (s *awsS3Store) List(prefix string) ([]string, error) {
+	var names []string
+	err := s.client.ListObjectsPages(&s3.ListObjectsInput{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+		for _, object := range page.Contents {
+			names = append(names, aws.StringValue(object.Key))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Delete removes the object; S3 does not fail when it does not exist
+func (s *awsS3Store) Delete(name string) error {
+	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(name),
+	})
+	return err
+}
@@ -0,0 +1,72 @@
+package snapshotstore
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+var azureBlobProvider = &Provider{
+	RequiredParameters:  []string{"account_name", "account_key", "container"},
+	SensitiveParameters: []string{"account_key"},
+	Factory:             newAzureBlobStore,
+}
+
+// azureBlobStore keeps the snapshots in an Azure Blob Storage container
+type azureBlobStore struct {
+	container *storage.Container
+}
+
+// newAzureBlobStore creates a store in the "container" parameter of the
+// "account_name" storage account, which must exist. The optional "endpoint"
+// parameter replaces the default service domain.
+func newAzureBlobStore(params map[string]string) (Store, error) {
+	baseURL := params["endpoint"]
+	if baseURL == "" {
+		baseURL = storage.DefaultBaseURL
+	}
+
+	client, err := storage.NewClient(params["account_name"], params["account_key"], baseURL, storage.DefaultAPIVersion, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure client: %v", err)
+	}
+	client.HTTPClient = cleanhttp.DefaultPooledClient()
+
+	blobClient := client.GetBlobService()
+	return &azureBlobStore{
+		container: blobClient.GetContainerReference(params["container"]),
+	}, nil
+}
+
+func (s *azureBlobStore) Put(name string, data []byte) error {
+	blob := s.container.GetBlobReference(name)
+	return blob.CreateBlockBlobFromReader(bytes.NewReader(data), nil)
+}
+
+func (s *azureBlobStore) List(prefix string) ([]string, error) {
+	var names []string
+	params := storage.ListBlobsParameters{Prefix: prefix}
+	for {
+		list, err := s.container.ListBlobs(params)
+		if err != nil {
+			return nil, err
+		}
+		for _, blob := range list.Blobs {
+			names = append(names, blob.Name)
+		}
+		if list.NextMarker == "" {
+			break
+		}
+		params.Marker = list.NextMarker
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *azureBlobStore) Delete(name string) error {
+	_, err := s.container.GetBlobReference(name).DeleteIfExists(nil)
+	return err
+}
@@ -0,0 +1,87 @@
+package snapshotstore
+
+import (
+	"fmt"
+	"sort"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+var googleGCSProvider = &Provider{
+	RequiredParameters:  []string{"bucket"},
+	SensitiveParameters: []string{"credentials"},
+	Factory:             newGoogleGCSStore,
+}
+
+// googleGCSStore keeps the snapshots in a Google Cloud Storage bucket
+type googleGCSStore struct {
+	client *storage.Client
+	bucket string
+}
+
+// newGoogleGCSStore creates a store in the "bucket" parameter, authenticating
+// with the optional "credentials" service account file contents or the
+// application default credentials
+func newGoogleGCSStore(params map[string]string) (Store, error) {
+	ctx := context.Background()
+
+	var opts []option.ClientOption
+	if credentials := params["credentials"]; credentials != "" {
+		jwtConfig, err := google.JWTConfigFromJSON([]byte(credentials), storage.ScopeReadWrite)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing credentials: %s", err)
+		}
+		opts = append(opts, option.WithTokenSource(jwtConfig.TokenSource(ctx)))
+	}
+
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %v", err)
+	}
+
+	return &googleGCSStore{
+		client: client,
+		bucket: params["bucket"],
+	}, nil
+}
+
+func (s *googleGCSStore) Put(name string, data []byte) error {
+	w := s.client.Bucket(s.bucket).Object(name).NewWriter(context.Background())
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (s *googleGCSStore) List(prefix string) ([]string, error) {
+	it := s.client.Bucket(s.bucket).Objects(context.Background(), &storage.Query{
+		Prefix: prefix,
+	})
+
+	var names []string
+	for {
+		objAttrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, objAttrs.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *googleGCSStore) Delete(name string) error {
+	err := s.client.Bucket(s.bucket).Object(name).Delete(context.Background())
+	if err == storage.ErrObjectNotExist {
+		return nil
+	}
+	return err
+}
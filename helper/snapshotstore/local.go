@@ -0,0 +1,90 @@
+package snapshotstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var localProvider = &Provider{
+	RequiredParameters: []string{"path"},
+	Factory:            newLocalStore,
+}
+
+// localStore keeps the snapshots in a directory of the local file system
+type localStore struct {
+	path string
+}
+
+// newLocalStore creates a store in the directory of the "path" parameter,
+// which is created if it does not exist
+func newLocalStore(params map[string]string) (Store, error) {
+	path := params["path"]
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, err
+	}
+	return &localStore{
+		path: path,
+	}, nil
+}
+
+// Put writes the snapshot to a temporary file first, so that an interrupted
+// upload never leaves a truncated snapshot behind
+func (s *localStore) Put(name string, data []byte) error {
+	fullPath := filepath.Join(s.path, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0700); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(fullPath), ".tmp-")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, fullPath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+	}
+	return err
+}
+
+func (s *localStore) List(prefix string) ([]string, error) {
+	var names []string
+	err := filepath.Walk(s.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.path, path)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *localStore) Delete(name string) error {
+	err := os.Remove(filepath.Join(s.path, filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,124 @@
+// Package snapshotstore provides access to the storage Vault uploads its
+// automated raft snapshots to, such as a local directory or an S3 bucket.
+// Only the operations needed to upload snapshots and to apply their retention
+// are implemented.
+package snapshotstore
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Store is a location snapshots are uploaded to. Snapshot names are slash
+// separated paths.
+type Store interface {
+	// Put uploads the snapshot under the given name, replacing any existing
+	// snapshot with that name
+	Put(name string, data []byte) error
+
+	// List returns the sorted names of the snapshots starting with the given
+	// prefix
+	List(prefix string) ([]string, error)
+
+	// Delete removes the named snapshot. Deleting a snapshot that does not
+	// exist succeeds.
+	Delete(name string) error
+}
+
+// Factory returns the store described by the given configuration parameters
+type Factory func(params map[string]string) (Store, error)
+
+// Provider creates the stores of one kind of storage
+type Provider struct {
+	// RequiredParameters lists the parameters that must be set for stores
+	// of this type
+	RequiredParameters []string
+
+	// SensitiveParameters lists the parameters, such as credentials, that
+	// must not be returned when reading a configuration
+	SensitiveParameters []string
+
+	// Factory creates the store
+	Factory Factory
+}
+
+var (
+	providersLock sync.RWMutex
+	providers     = map[string]*Provider{
+		"local":      localProvider,
+		"aws-s3":     awsS3Provider,
+		"google-gcs": googleGCSProvider,
+		"azure-blob": azureBlobProvider,
+	}
+)
+
+// Register makes a provider available under the given type name, replacing
+// any existing provider for it
+func Register(storageType string, provider *Provider) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+	providers[storageType] = provider
+}
+
+// Types returns the names of the registered provider types
+func Types() []string {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+
+	ret := make([]string, 0, len(providers))
+	for storageType := range providers {
+		ret = append(ret, storageType)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// ValidateParameters checks that the provider for the storage type exists
+// and that all its required parameters are set
+func ValidateParameters(storageType string, params map[string]string) error {
+	provider, err := getProvider(storageType)
+	if err != nil {
+		return err
+	}
+	for _, param := range provider.RequiredParameters {
+		if params[param] == "" {
+			return fmt.Errorf("parameter %q is required for storage of type %q", param, storageType)
+		}
+	}
+	return nil
+}
+
+// SensitiveParameters returns the parameters of stores of the given type
+// that must not be returned when reading their configuration
+func SensitiveParameters(storageType string) []string {
+	provider, err := getProvider(storageType)
+	if err != nil {
+		return nil
+	}
+	return provider.SensitiveParameters
+}
+
+// NewStore creates a store of the given type from its configuration
+// parameters
+func NewStore(storageType string, params map[string]string) (Store, error) {
+	if err := ValidateParameters(storageType, params); err != nil {
+		return nil, err
+	}
+	provider, err := getProvider(storageType)
+	if err != nil {
+		return nil, err
+	}
+	return provider.Factory(params)
+}
+
+func getProvider(storageType string) (*Provider, error) {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+
+	provider, ok := providers[storageType]
+	if !ok {
+		return nil, fmt.Errorf("unknown snapshot storage type %q", storageType)
+	}
+	return provider, nil
+}
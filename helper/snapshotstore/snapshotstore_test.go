@@ -0,0 +1,154 @@
+package snapshotstore
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testStore uploads, lists and deletes snapshots
+func testStore(t *testing.T, s Store) {
+	names := []string{
+		"daily/vault-snapshot-1.snap",
+		"daily/vault-snapshot-2.snap",
+		"hourly/vault-snapshot-1.snap",
+	}
+	for _, name := range names {
+		if err := s.Put(name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := s.List("daily/vault-snapshot-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(list, names[:2]) {
+		t.Fatalf("bad list: %v", list)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := s.Delete(names[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err = s.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(list, names[1:]) {
+		t.Fatalf("bad list: %v", list)
+	}
+}
+
+func TestValidateParameters(t *testing.T) {
+	if err := ValidateParameters("unknown", nil); err == nil {
+		t.Fatal("expected error for unknown type")
+	}
+	if err := ValidateParameters("aws-s3", map[string]string{"region": "us-east-1"}); err == nil {
+		t.Fatal("expected error for missing bucket")
+	}
+	if err := ValidateParameters("aws-s3", map[string]string{"bucket": "backups"}); err != nil {
+		t.Fatal(err)
+	}
+	if sensitive := SensitiveParameters("azure-blob"); !reflect.DeepEqual(sensitive, []string{"account_key"}) {
+		t.Fatalf("bad: %v", sensitive)
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshotstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewStore("local", map[string]string{"path": dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+
+	data, err := ioutil.ReadFile(dir + "/daily/vault-snapshot-2.snap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "daily/vault-snapshot-2.snap" {
+		t.Fatalf("bad: %q", data)
+	}
+}
+
+func TestAWSS3Store(t *testing.T) {
+	var lock sync.Mutex
+	objects := map[string][]byte{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if !strings.HasPrefix(r.URL.Path, "/backups") {
+			t.Fatalf("unexpected path %q", r.URL.Path)
+		}
+		key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/backups"), "/")
+
+		switch r.Method {
+		case "PUT":
+			data, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			objects[key] = data
+		case "DELETE":
+			delete(objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		case "GET":
+			type content struct {
+				Key string
+			}
+			result := struct {
+				XMLName  xml.Name `xml:"ListBucketResult"`
+				Contents []content
+			}{}
+			prefix := r.URL.Query().Get("prefix")
+			var keys []string
+			for key := range objects {
+				if strings.HasPrefix(key, prefix) {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				result.Contents = append(result.Contents, content{Key: key})
+			}
+			xml.NewEncoder(w).Encode(result)
+		default:
+			t.Fatalf("unexpected method %q", r.Method)
+		}
+	}))
+	defer server.Close()
+
+	s, err := NewStore("aws-s3", map[string]string{
+		"bucket":              "backups",
+		"access_key":          "AKIAEXAMPLE",
+		"secret_key":          "secret",
+		"endpoint":            server.URL,
+		"s3_force_path_style": "true",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+
+	lock.Lock()
+	defer lock.Unlock()
+	if string(objects["daily/vault-snapshot-2.snap"]) != "daily/vault-snapshot-2.snap" {
+		t.Fatalf("bad: %v", objects)
+	}
+}
@@ -0,0 +1,42 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/vault/vault"
+)
+
+// estWellKnownPrefix is the standard path of EST (RFC 7030) servers
+const estWellKnownPrefix = "/.well-known/est/"
+
+// handleWellKnownEST serves the standard EST path with the EST endpoints of
+// the PKI mount configured at sys/config/est, rewriting
+// /.well-known/est/<path> to /v1/<mount>/est/<path>
+func handleWellKnownEST(core *vault.Core, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mount := core.ESTMount()
+		if mount == "" {
+			respondError(w, http.StatusNotFound, fmt.Errorf("EST is not configured"))
+			return
+		}
+
+		// The mount path is absolute, so the namespace of the request, if
+		// any, does not apply
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = "/v1/" + mount + "est/" + strings.TrimPrefix(r.URL.Path, estWellKnownPrefix)
+		r2.URL.RawPath = ""
+		r2.Header = make(http.Header, len(r.Header))
+		for k, v := range r.Header {
+			r2.Header[k] = v
+		}
+		r2.Header.Del(NamespaceHeaderName)
+
+		handler.ServeHTTP(w, r2)
+	})
+}
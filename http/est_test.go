@@ -0,0 +1,62 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/builtin/logical/pki"
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestWellKnownEST(t *testing.T) {
+	vault.AddTestLogicalBackend("pki", pki.Factory)
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	// Nothing is served before a mount is configured
+	resp := testHttpGet(t, "", addr+"/.well-known/est/cacerts")
+	testResponseStatus(t, resp, 404)
+
+	resp = testHttpPost(t, token, addr+"/v1/sys/mounts/pki", map[string]interface{}{
+		"type": "pki",
+	})
+	testResponseStatus(t, resp, 204)
+	resp = testHttpPost(t, token, addr+"/v1/pki/root/generate/internal", map[string]interface{}{
+		"common_name": "myvault.com",
+	})
+	testResponseStatus(t, resp, 200)
+	resp = testHttpPost(t, token, addr+"/v1/pki/config/est", map[string]interface{}{
+		"enabled": true,
+	})
+	testResponseStatus(t, resp, 204)
+
+	// Only PKI mounts can serve EST
+	resp = testHttpPost(t, token, addr+"/v1/sys/config/est", map[string]interface{}{
+		"mount": "secret",
+	})
+	testResponseStatus(t, resp, 400)
+	resp = testHttpPost(t, token, addr+"/v1/sys/config/est", map[string]interface{}{
+		"mount": "pki",
+	})
+	testResponseStatus(t, resp, 204)
+
+	var actual map[string]interface{}
+	resp = testHttpGet(t, token, addr+"/v1/sys/config/est")
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &actual)
+	if mount := actual["data"].(map[string]interface{})["mount"]; mount != "pki/" {
+		t.Fatalf("bad mount: %v", mount)
+	}
+
+	resp = testHttpGet(t, "", addr+"/.well-known/est/cacerts")
+	testResponseStatus(t, resp, 200)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/pkcs7-mime; smime-type=certs-only" {
+		t.Fatalf("bad content type: %q", ct)
+	}
+
+	resp = testHttpDelete(t, token, addr+"/v1/sys/config/est")
+	testResponseStatus(t, resp, 204)
+	resp = testHttpGet(t, "", addr+"/.well-known/est/cacerts")
+	testResponseStatus(t, resp, 404)
+}
@@ -615,3 +615,75 @@ func TestHTTP_Forwarding_HelpOperation(t *testing.T) {
 	testHelp(cores[0].Client)
 	testHelp(cores[1].Client)
 }
+
+func TestHTTP_Forwarding_PerfStandby(t *testing.T) {
+	handler1 := http.NewServeMux()
+	handler2 := http.NewServeMux()
+	handler3 := http.NewServeMux()
+
+	coreConfig := &vault.CoreConfig{
+		PerformanceStandby: true,
+	}
+
+	cores := vault.TestCluster(t, []http.Handler{handler1, handler2, handler3}, coreConfig, true)
+	for _, core := range cores {
+		defer core.CloseListeners()
+	}
+
+	handler1.Handle("/", Handler(cores[0].Core))
+	handler2.Handle("/", Handler(cores[1].Core))
+	handler3.Handle("/", Handler(cores[2].Core))
+
+	vault.TestWaitActive(t, cores[0].Core)
+
+	start := time.Now()
+	for !cores[1].Core.PerfStandby() {
+		if time.Now().Sub(start) > 10*time.Second {
+			t.Fatal("core 2 should be a performance standby")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	client := cores[1].Client
+
+	// Writes are forwarded to the active node
+	if _, err := client.Logical().Write("secret/foo", map[string]interface{}{
+		"foo": "bar",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reads are served by the standby
+	secret, err := client.Logical().Read("secret/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == nil || secret.Data["foo"] != "bar" {
+		t.Fatalf("bad: %#v", secret)
+	}
+	keys, err := client.Logical().List("secret/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys == nil || len(keys.Data["keys"].([]interface{})) != 1 {
+		t.Fatalf("bad: %#v", keys)
+	}
+
+	// Wrapped responses are forwarded, since they create tokens
+	client.SetWrappingLookupFunc(func(string, string) string { return "1m" })
+	secret, err = client.Logical().Read("secret/foo")
+	client.SetWrappingLookupFunc(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == nil || secret.WrapInfo == nil || secret.WrapInfo.Token == "" {
+		t.Fatalf("bad: %#v", secret)
+	}
+	secret, err = client.Logical().Unwrap(secret.WrapInfo.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == nil || secret.Data["foo"] != "bar" {
+		t.Fatalf("bad: %#v", secret)
+	}
+}
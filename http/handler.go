@@ -1,9 +1,12 @@
 package http
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/url"
 	"strings"
@@ -12,6 +15,7 @@ import (
 	"github.com/hashicorp/vault/helper/consts"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/helper/parseutil"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/vault"
 )
@@ -32,6 +36,14 @@ const (
 	// not to use request forwarding
 	NoRequestForwardingHeaderName = "X-Vault-No-Request-Forwarding"
 
+	// PolicyOverrideHeaderName is the name of the header overriding the
+	// soft-mandatory rule policies failing for the request
+	PolicyOverrideHeaderName = "X-Vault-Policy-Override"
+
+	// NamespaceHeaderName is the name of the header containing the path of
+	// the namespace the path of the request is relative to
+	NamespaceHeaderName = "X-Vault-Namespace"
+
 	// MaxRequestSize is the maximum accepted request size. This is to prevent
 	// a denial of service attack where no Content-Length is provided and the server
 	// is fed ever more data until it exhausts memory.
@@ -48,9 +60,10 @@ func Handler(core *vault.Core) http.Handler {
 	mux.Handle("/v1/sys/seal", handleSysSeal(core))
 	mux.Handle("/v1/sys/step-down", handleRequestForwarding(core, handleSysStepDown(core)))
 	mux.Handle("/v1/sys/unseal", handleSysUnseal(core))
+	mux.Handle("/v1/sys/storage/raft/join", handleSysRaftJoin(core))
 	mux.Handle("/v1/sys/renew", handleRequestForwarding(core, handleLogical(core, false, nil)))
 	mux.Handle("/v1/sys/renew/", handleRequestForwarding(core, handleLogical(core, false, nil)))
-	mux.Handle("/v1/sys/leases/", handleRequestForwarding(core, handleLogical(core, false, nil)))
+	mux.Handle("/v1/sys/leases/", handlePerfStandbyRequestForwarding(core, handleLogical(core, false, nil)))
 	mux.Handle("/v1/sys/leader", handleSysLeader(core))
 	mux.Handle("/v1/sys/health", handleSysHealth(core))
 	mux.Handle("/v1/sys/generate-root/attempt", handleRequestForwarding(core, handleSysGenerateRootAttempt(core)))
@@ -62,17 +75,19 @@ func Handler(core *vault.Core) http.Handler {
 	mux.Handle("/v1/sys/wrapping/lookup", handleRequestForwarding(core, handleLogical(core, false, wrappingVerificationFunc)))
 	mux.Handle("/v1/sys/wrapping/rewrap", handleRequestForwarding(core, handleLogical(core, false, wrappingVerificationFunc)))
 	mux.Handle("/v1/sys/wrapping/unwrap", handleRequestForwarding(core, handleLogical(core, false, wrappingVerificationFunc)))
-	mux.Handle("/v1/sys/capabilities-self", handleRequestForwarding(core, handleLogical(core, true, nil)))
-	mux.Handle("/v1/sys/", handleRequestForwarding(core, handleLogical(core, true, nil)))
-	mux.Handle("/v1/", handleRequestForwarding(core, handleLogical(core, false, nil)))
+	mux.Handle("/v1/sys/capabilities-self", handlePerfStandbyRequestForwarding(core, handleLogical(core, true, nil)))
+	mux.Handle("/v1/sys/", handlePerfStandbyRequestForwarding(core, handleLogical(core, true, nil)))
+	mux.Handle("/v1/", handlePerfStandbyRequestForwarding(core, handleLogical(core, false, nil)))
+	mux.Handle(estWellKnownPrefix, handleRequestForwarding(core, handleWellKnownEST(core, wrapQuotaHandler(handleLogical(core, false, nil), core))))
 
 	// Wrap the handler in another handler to trigger all help paths.
 	helpWrappedHandler := wrapHelpHandler(mux, core)
 	corsWrappedHandler := wrapCORSHandler(helpWrappedHandler, core)
+	quotaWrappedHandler := wrapQuotaHandler(corsWrappedHandler, core)
 
 	// Wrap the help wrapped handler with another layer with a generic
 	// handler
-	genericWrappedHandler := wrapGenericHandler(corsWrappedHandler)
+	genericWrappedHandler := wrapGenericHandler(quotaWrappedHandler)
 
 	return genericWrappedHandler
 }
@@ -90,6 +105,32 @@ func wrapGenericHandler(h http.Handler) http.Handler {
 	})
 }
 
+// wrapQuotaHandler rejects the API requests exceeding the rate limit quotas
+// with a 429 status
+func wrapQuotaHandler(h http.Handler, core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, ok := requestPath(r)
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		op, _ := requestOperation(r)
+
+		if err := core.ApplyRateLimitQuota(&logical.Request{
+			Operation:   op,
+			Path:        path,
+			ClientToken: r.Header.Get(AuthHeaderName),
+			Connection:  getConnection(r),
+			Headers:     r.Header,
+		}); err != nil {
+			respondError(w, http.StatusTooManyRequests, err)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
 // A lookup on a token that is about to expire returns nil, which means by the
 // time we can validate a wrapping token lookup will return nil since it will
 // be revoked after the call. So we have to do the validation here.
@@ -124,6 +165,55 @@ func stripPrefix(prefix, path string) (string, bool) {
 	return path, true
 }
 
+// rawBodyContentTypes are the request content types whose bodies are not JSON
+// and are handed to backends as-is, for endpoints implementing protocols such
+// as EST and OAuth 2.0, or taking binary data such as raft snapshots
+var rawBodyContentTypes = []string{
+	"application/pkcs10",
+	"application/octet-stream",
+	formContentType,
+}
+
+// formContentType is the content type of form bodies. As it is also the
+// default of clients such as curl, form bodies holding JSON are parsed as JSON.
+const formContentType = "application/x-www-form-urlencoded"
+
+// isRawBodyRequest returns whether the body of the request should be passed
+// through to the backend without being parsed
+func isRawBodyRequest(r *http.Request) bool {
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return strutil.StrListContains(rawBodyContentTypes, contentType)
+}
+
+// parseRawRequest reads the body of the request into a data map, keyed by
+// logical.HTTPRawBody and logical.HTTPContentType
+func parseRawRequest(r *http.Request, w http.ResponseWriter) (map[string]interface{}, error) {
+	limit := http.MaxBytesReader(w, r.Body, MaxRequestSize)
+	body, err := ioutil.ReadAll(limit)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to read request body: {{err}}", err)
+	}
+
+	if contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); contentType == formContentType {
+		if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || trimmed[0] == '{' {
+			var data map[string]interface{}
+			err := jsonutil.DecodeJSONFromReader(bytes.NewReader(trimmed), &data)
+			if err != nil && err != io.EOF {
+				return nil, errwrap.Wrapf("failed to parse JSON input: {{err}}", err)
+			}
+			return data, err
+		}
+	}
+
+	return map[string]interface{}{
+		logical.HTTPContentType: r.Header.Get("Content-Type"),
+		logical.HTTPRawBody:     body,
+	}, nil
+}
+
 func parseRequest(r *http.Request, w http.ResponseWriter, out interface{}) error {
 	// Limit the maximum number of bytes to MaxRequestSize to protect
 	// against an indefinite amount of data being read.
@@ -138,6 +228,17 @@ func parseRequest(r *http.Request, w http.ResponseWriter, out interface{}) error
 // handleRequestForwarding determines whether to forward a request or not,
 // falling back on the older behavior of redirecting the client
 func handleRequestForwarding(core *vault.Core, handler http.Handler) http.Handler {
+	return handleRequestForwardingCommon(core, handler, false)
+}
+
+// handlePerfStandbyRequestForwarding is handleRequestForwarding for the
+// handlers of the logical requests. Performance standbys serve the read
+// requests themselves, and forward those which turn out to need writes.
+func handlePerfStandbyRequestForwarding(core *vault.Core, handler http.Handler) http.Handler {
+	return handleRequestForwardingCommon(core, handler, true)
+}
+
+func handleRequestForwardingCommon(core *vault.Core, handler http.Handler, perfStandbyReads bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Header.Get(vault.IntNoForwardingHeaderName) != "" {
 			handler.ServeHTTP(w, r)
@@ -175,34 +276,47 @@ func handleRequestForwarding(core *vault.Core, handler http.Handler) http.Handle
 			return
 		}
 
+		// Performance standbys serve the read requests, which have no body
+		// and can still be forwarded if they turn out to need writes
+		if perfStandbyReads && core.PerfStandby() && (r.Method == "GET" || r.Method == "LIST") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
 		// Attempt forwarding the request. If we cannot forward -- perhaps it's
 		// been disabled on the active node -- this will return with an
 		// ErrCannotForward and we simply fall back
-		statusCode, header, retBytes, err := core.ForwardRequest(r)
-		if err != nil {
-			if err == vault.ErrCannotForward {
-				core.Logger().Trace("http/handleRequestForwarding: cannot forward (possibly disabled on active node), falling back")
-			} else {
-				core.Logger().Error("http/handleRequestForwarding: error forwarding request", "error", err)
-			}
-
+		if err := forwardRequest(core, w, r); err != nil {
 			// Fall back to redirection
 			handler.ServeHTTP(w, r)
-			return
 		}
+	})
+}
 
-		if header != nil {
-			for k, v := range header {
-				for _, j := range v {
-					w.Header().Add(k, j)
-				}
+// forwardRequest forwards a request to the active node and writes its
+// response. Nothing is written if the request cannot be forwarded.
+func forwardRequest(core *vault.Core, w http.ResponseWriter, r *http.Request) error {
+	statusCode, header, retBytes, err := core.ForwardRequest(r)
+	if err != nil {
+		if err == vault.ErrCannotForward {
+			core.Logger().Trace("http/handleRequestForwarding: cannot forward (possibly disabled on active node), falling back")
+		} else {
+			core.Logger().Error("http/handleRequestForwarding: error forwarding request", "error", err)
+		}
+		return err
+	}
+
+	if header != nil {
+		for k, v := range header {
+			for _, j := range v {
+				w.Header().Add(k, j)
 			}
 		}
+	}
 
-		w.WriteHeader(statusCode)
-		w.Write(retBytes)
-		return
-	})
+	w.WriteHeader(statusCode)
+	w.Write(retBytes)
+	return nil
 }
 
 // request is a helper to perform a request and properly exit in the
@@ -213,6 +327,12 @@ func request(core *vault.Core, w http.ResponseWriter, rawReq *http.Request, r *l
 		respondStandby(core, w, rawReq.URL)
 		return resp, false
 	}
+	if errwrap.Contains(err, consts.ErrPerfStandbyPleaseForward.Error()) {
+		if err := forwardRequest(core, w, rawReq); err != nil {
+			respondStandby(core, w, rawReq.URL)
+		}
+		return resp, false
+	}
 	if respondErrorCommon(w, r, resp, err) {
 		return resp, false
 	}
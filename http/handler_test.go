@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/go-cleanhttp"
@@ -80,7 +81,7 @@ func TestHandler_cors(t *testing.T) {
 		"Access-Control-Allow-Origin":  addr,
 		"Access-Control-Allow-Headers": "*",
 		"Access-Control-Max-Age":       "300",
-		"Vary": "Origin",
+		"Vary":                         "Origin",
 	}
 
 	for expHeader, expected := range expHeaders {
@@ -159,9 +160,11 @@ func TestSysMounts_headerAuth(t *testing.T) {
 				"description": "generic secret storage",
 				"type":        "generic",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -169,9 +172,11 @@ func TestSysMounts_headerAuth(t *testing.T) {
 				"description": "system endpoints used for control, policy and debugging",
 				"type":        "system",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -179,9 +184,11 @@ func TestSysMounts_headerAuth(t *testing.T) {
 				"description": "per-token private secret storage",
 				"type":        "cubbyhole",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": true,
 			},
@@ -190,9 +197,11 @@ func TestSysMounts_headerAuth(t *testing.T) {
 			"description": "generic secret storage",
 			"type":        "generic",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -200,9 +209,11 @@ func TestSysMounts_headerAuth(t *testing.T) {
 			"description": "system endpoints used for control, policy and debugging",
 			"type":        "system",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -210,9 +221,11 @@ func TestSysMounts_headerAuth(t *testing.T) {
 			"description": "per-token private secret storage",
 			"type":        "cubbyhole",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": true,
 		},
@@ -269,6 +282,12 @@ func TestSysMounts_headerAuth_Wrapped(t *testing.T) {
 	}
 	expected["wrap_info"].(map[string]interface{})["token"] = actualToken
 
+	actualAccessor, ok := actual["wrap_info"].(map[string]interface{})["accessor"]
+	if !ok || actualAccessor == "" {
+		t.Fatal("accessor missing in wrap info")
+	}
+	expected["wrap_info"].(map[string]interface{})["accessor"] = actualAccessor
+
 	actualCreationTime, ok := actual["wrap_info"].(map[string]interface{})["creation_time"]
 	if !ok || actualCreationTime == "" {
 		t.Fatal("creation_time missing in wrap info")
@@ -324,3 +343,39 @@ func TestHandler_error(t *testing.T) {
 	}
 
 }
+
+func TestHandler_parseRawRequest(t *testing.T) {
+	for _, tc := range []struct {
+		body     string
+		expected map[string]interface{}
+	}{
+		{
+			"grant_type=authorization_code&code=abc",
+			map[string]interface{}{
+				logical.HTTPContentType: "application/x-www-form-urlencoded",
+				logical.HTTPRawBody:     []byte("grant_type=authorization_code&code=abc"),
+			},
+		},
+		// JSON sent with the default content type of curl is parsed as JSON
+		{
+			`{"value": "bar"}`,
+			map[string]interface{}{
+				"value": "bar",
+			},
+		},
+	} {
+		r := httptest.NewRequest("PUT", "/v1/secret/foo", strings.NewReader(tc.body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if !isRawBodyRequest(r) {
+			t.Fatal("form request is not a raw body request")
+		}
+
+		data, err := parseRawRequest(r, httptest.NewRecorder())
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if !reflect.DeepEqual(data, tc.expected) {
+			t.Fatalf("bad data for %q: %#v", tc.body, data)
+		}
+	}
+}
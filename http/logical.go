@@ -17,41 +17,13 @@ import (
 type PrepareRequestFunc func(*vault.Core, *logical.Request) error
 
 func buildLogicalRequest(core *vault.Core, w http.ResponseWriter, r *http.Request) (*logical.Request, int, error) {
-	// Determine the path...
-	if !strings.HasPrefix(r.URL.Path, "/v1/") {
+	path, ok := requestPath(r)
+	if !ok {
 		return nil, http.StatusNotFound, nil
 	}
-	path := r.URL.Path[len("/v1/"):]
-	if path == "" {
-		return nil, http.StatusNotFound, nil
-	}
-
-	// Determine the operation
-	var op logical.Operation
-	switch r.Method {
-	case "DELETE":
-		op = logical.DeleteOperation
-	case "GET":
-		op = logical.ReadOperation
-		// Need to call ParseForm to get query params loaded
-		queryVals := r.URL.Query()
-		listStr := queryVals.Get("list")
-		if listStr != "" {
-			list, err := strconv.ParseBool(listStr)
-			if err != nil {
-				return nil, http.StatusBadRequest, nil
-			}
-			if list {
-				op = logical.ListOperation
-			}
-		}
-	case "POST", "PUT":
-		op = logical.UpdateOperation
-	case "LIST":
-		op = logical.ListOperation
-	case "OPTIONS":
-	default:
-		return nil, http.StatusMethodNotAllowed, nil
+	op, status := requestOperation(r)
+	if status != 0 {
+		return nil, status, nil
 	}
 
 	if op == logical.ListOperation {
@@ -63,7 +35,12 @@ func buildLogicalRequest(core *vault.Core, w http.ResponseWriter, r *http.Reques
 	// Parse the request if we can
 	var data map[string]interface{}
 	if op == logical.UpdateOperation {
-		err := parseRequest(r, w, &data)
+		var err error
+		if isRawBodyRequest(r) {
+			data, err = parseRawRequest(r, w)
+		} else {
+			err = parseRequest(r, w, &data)
+		}
 		if err == io.EOF {
 			data = nil
 			err = nil
@@ -73,6 +50,20 @@ func buildLogicalRequest(core *vault.Core, w http.ResponseWriter, r *http.Reques
 		}
 	}
 
+	// List requests take their parameters, such as the pagination of the
+	// list, from the query string
+	if op == logical.ListOperation {
+		for k, v := range r.URL.Query() {
+			if k == "list" || len(v) == 0 {
+				continue
+			}
+			if data == nil {
+				data = make(map[string]interface{})
+			}
+			data[k] = v[0]
+		}
+	}
+
 	var err error
 	request_id, err := uuid.GenerateUUID()
 	if err != nil {
@@ -93,9 +84,66 @@ func buildLogicalRequest(core *vault.Core, w http.ResponseWriter, r *http.Reques
 		return nil, http.StatusBadRequest, errwrap.Wrapf("error parsing X-Vault-Wrap-TTL header: {{err}}", err)
 	}
 
+	if v := r.Header.Get(PolicyOverrideHeaderName); v != "" {
+		req.PolicyOverride, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, http.StatusBadRequest, errwrap.Wrapf("error parsing X-Vault-Policy-Override header: {{err}}", err)
+		}
+	}
+
 	return req, 0, nil
 }
 
+// requestPath returns the logical path of a request, relative to the root
+// namespace, and false if it is not an API request
+func requestPath(r *http.Request) (string, bool) {
+	if !strings.HasPrefix(r.URL.Path, "/v1/") {
+		return "", false
+	}
+	path := r.URL.Path[len("/v1/"):]
+	if path == "" {
+		return "", false
+	}
+
+	// Paths are relative to the namespace of the request, if any
+	if ns := strings.Trim(r.Header.Get(NamespaceHeaderName), "/"); ns != "" {
+		path = ns + "/" + path
+	}
+	return path, true
+}
+
+// requestOperation returns the logical operation of a request, or the
+// status to respond with if its method is invalid
+func requestOperation(r *http.Request) (logical.Operation, int) {
+	var op logical.Operation
+	switch r.Method {
+	case "DELETE":
+		op = logical.DeleteOperation
+	case "GET":
+		op = logical.ReadOperation
+		// Need to call ParseForm to get query params loaded
+		queryVals := r.URL.Query()
+		listStr := queryVals.Get("list")
+		if listStr != "" {
+			list, err := strconv.ParseBool(listStr)
+			if err != nil {
+				return "", http.StatusBadRequest
+			}
+			if list {
+				op = logical.ListOperation
+			}
+		}
+	case "POST", "PUT":
+		op = logical.UpdateOperation
+	case "LIST":
+		op = logical.ListOperation
+	case "OPTIONS":
+	default:
+		return "", http.StatusMethodNotAllowed
+	}
+	return op, 0
+}
+
 func handleLogical(core *vault.Core, injectDataIntoTopLevel bool, prepareRequestCallback PrepareRequestFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		req, statusCode, err := buildLogicalRequest(core, w, r)
@@ -151,6 +199,7 @@ func respondLogical(w http.ResponseWriter, r *http.Request, req *logical.Request
 			httpResp = &logical.HTTPResponse{
 				WrapInfo: &logical.HTTPWrapInfo{
 					Token:           resp.WrapInfo.Token,
+					Accessor:        resp.WrapInfo.Accessor,
 					TTL:             int(resp.WrapInfo.TTL.Seconds()),
 					CreationTime:    resp.WrapInfo.CreationTime.Format(time.RFC3339Nano),
 					WrappedAccessor: resp.WrapInfo.WrappedAccessor,
@@ -152,6 +152,7 @@ func TestLogical_StandbyRedirect(t *testing.T) {
 			"ttl":              json.Number("0"),
 			"creation_ttl":     json.Number("0"),
 			"explicit_max_ttl": json.Number("0"),
+			"type":             "service",
 			"expire_time":      nil,
 		},
 		"warnings":  nilWarnings,
@@ -294,3 +295,41 @@ func TestLogical_ListSuffix(t *testing.T) {
 		t.Fatal("trailing slash not found on path")
 	}
 }
+
+func TestLogical_Namespace(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPut(t, token, addr+"/v1/sys/namespaces/ns1", nil)
+	testResponseStatus(t, resp, 200)
+
+	req, _ := http.NewRequest("GET", addr+"/v1/secret/foo", nil)
+	req.Header.Set(NamespaceHeaderName, "/ns1/")
+	lreq, status, err := buildLogicalRequest(core, nil, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != 0 {
+		t.Fatalf("got status %d", status)
+	}
+	if lreq.Path != "ns1/secret/foo" {
+		t.Fatalf("bad: %q", lreq.Path)
+	}
+
+	// The mount paths are relative to the namespace of the header
+	req, _ = http.NewRequest("POST", addr+"/v1/sys/mounts/kv", strings.NewReader(`{"type": "generic"}`))
+	req.Header.Set("X-Vault-Token", token)
+	req.Header.Set(NamespaceHeaderName, "ns1")
+	hresp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testResponseStatus(t, hresp, 204)
+
+	resp = testHttpPut(t, token, addr+"/v1/ns1/kv/foo", map[string]interface{}{
+		"data": "bar",
+	})
+	testResponseStatus(t, resp, 204)
+}
@@ -29,8 +29,10 @@ func TestSysAuth(t *testing.T) {
 				"description": "token based credentials",
 				"type":        "token",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -39,8 +41,10 @@ func TestSysAuth(t *testing.T) {
 			"description": "token based credentials",
 			"type":        "token",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -82,8 +86,10 @@ func TestSysEnableAuth(t *testing.T) {
 				"description": "foo",
 				"type":        "noop",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -91,8 +97,10 @@ func TestSysEnableAuth(t *testing.T) {
 				"description": "token based credentials",
 				"type":        "token",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -101,8 +109,10 @@ func TestSysEnableAuth(t *testing.T) {
 			"description": "foo",
 			"type":        "noop",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -110,8 +120,10 @@ func TestSysEnableAuth(t *testing.T) {
 			"description": "token based credentials",
 			"type":        "token",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -154,8 +166,10 @@ func TestSysDisableAuth(t *testing.T) {
 		"data": map[string]interface{}{
 			"token/": map[string]interface{}{
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"description": "token based credentials",
 				"type":        "token",
@@ -164,8 +178,10 @@ func TestSysDisableAuth(t *testing.T) {
 		},
 		"token/": map[string]interface{}{
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"description": "token based credentials",
 			"type":        "token",
@@ -30,9 +30,11 @@ func TestSysMounts(t *testing.T) {
 				"description": "generic secret storage",
 				"type":        "generic",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -40,9 +42,11 @@ func TestSysMounts(t *testing.T) {
 				"description": "system endpoints used for control, policy and debugging",
 				"type":        "system",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -50,9 +54,11 @@ func TestSysMounts(t *testing.T) {
 				"description": "per-token private secret storage",
 				"type":        "cubbyhole",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": true,
 			},
@@ -61,9 +67,11 @@ func TestSysMounts(t *testing.T) {
 			"description": "generic secret storage",
 			"type":        "generic",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -71,9 +79,11 @@ func TestSysMounts(t *testing.T) {
 			"description": "system endpoints used for control, policy and debugging",
 			"type":        "system",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -81,9 +91,11 @@ func TestSysMounts(t *testing.T) {
 			"description": "per-token private secret storage",
 			"type":        "cubbyhole",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": true,
 		},
@@ -123,9 +135,11 @@ func TestSysMount(t *testing.T) {
 				"description": "foo",
 				"type":        "generic",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -133,9 +147,11 @@ func TestSysMount(t *testing.T) {
 				"description": "generic secret storage",
 				"type":        "generic",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -143,9 +159,11 @@ func TestSysMount(t *testing.T) {
 				"description": "system endpoints used for control, policy and debugging",
 				"type":        "system",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -153,9 +171,11 @@ func TestSysMount(t *testing.T) {
 				"description": "per-token private secret storage",
 				"type":        "cubbyhole",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": true,
 			},
@@ -164,9 +184,11 @@ func TestSysMount(t *testing.T) {
 			"description": "foo",
 			"type":        "generic",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -174,9 +196,11 @@ func TestSysMount(t *testing.T) {
 			"description": "generic secret storage",
 			"type":        "generic",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -184,9 +208,11 @@ func TestSysMount(t *testing.T) {
 			"description": "system endpoints used for control, policy and debugging",
 			"type":        "system",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -194,9 +220,11 @@ func TestSysMount(t *testing.T) {
 			"description": "per-token private secret storage",
 			"type":        "cubbyhole",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": true,
 		},
@@ -258,9 +286,11 @@ func TestSysRemount(t *testing.T) {
 				"description": "foo",
 				"type":        "generic",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -268,9 +298,11 @@ func TestSysRemount(t *testing.T) {
 				"description": "generic secret storage",
 				"type":        "generic",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -278,9 +310,11 @@ func TestSysRemount(t *testing.T) {
 				"description": "system endpoints used for control, policy and debugging",
 				"type":        "system",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -288,9 +322,11 @@ func TestSysRemount(t *testing.T) {
 				"description": "per-token private secret storage",
 				"type":        "cubbyhole",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": true,
 			},
@@ -299,9 +335,11 @@ func TestSysRemount(t *testing.T) {
 			"description": "foo",
 			"type":        "generic",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -309,9 +347,11 @@ func TestSysRemount(t *testing.T) {
 			"description": "generic secret storage",
 			"type":        "generic",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -319,9 +359,11 @@ func TestSysRemount(t *testing.T) {
 			"description": "system endpoints used for control, policy and debugging",
 			"type":        "system",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -329,9 +371,11 @@ func TestSysRemount(t *testing.T) {
 			"description": "per-token private secret storage",
 			"type":        "cubbyhole",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": true,
 		},
@@ -374,9 +418,11 @@ func TestSysUnmount(t *testing.T) {
 				"description": "generic secret storage",
 				"type":        "generic",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -384,9 +430,11 @@ func TestSysUnmount(t *testing.T) {
 				"description": "system endpoints used for control, policy and debugging",
 				"type":        "system",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -394,9 +442,11 @@ func TestSysUnmount(t *testing.T) {
 				"description": "per-token private secret storage",
 				"type":        "cubbyhole",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": true,
 			},
@@ -405,9 +455,11 @@ func TestSysUnmount(t *testing.T) {
 			"description": "generic secret storage",
 			"type":        "generic",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -415,9 +467,11 @@ func TestSysUnmount(t *testing.T) {
 			"description": "system endpoints used for control, policy and debugging",
 			"type":        "system",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -425,9 +479,11 @@ func TestSysUnmount(t *testing.T) {
 			"description": "per-token private secret storage",
 			"type":        "cubbyhole",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": true,
 		},
@@ -467,9 +523,11 @@ func TestSysTuneMount(t *testing.T) {
 				"description": "foo",
 				"type":        "generic",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -477,9 +535,11 @@ func TestSysTuneMount(t *testing.T) {
 				"description": "generic secret storage",
 				"type":        "generic",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -487,9 +547,11 @@ func TestSysTuneMount(t *testing.T) {
 				"description": "system endpoints used for control, policy and debugging",
 				"type":        "system",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -497,9 +559,11 @@ func TestSysTuneMount(t *testing.T) {
 				"description": "per-token private secret storage",
 				"type":        "cubbyhole",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": true,
 			},
@@ -508,9 +572,11 @@ func TestSysTuneMount(t *testing.T) {
 			"description": "foo",
 			"type":        "generic",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -518,9 +584,11 @@ func TestSysTuneMount(t *testing.T) {
 			"description": "generic secret storage",
 			"type":        "generic",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -528,9 +596,11 @@ func TestSysTuneMount(t *testing.T) {
 			"description": "system endpoints used for control, policy and debugging",
 			"type":        "system",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -538,9 +608,11 @@ func TestSysTuneMount(t *testing.T) {
 			"description": "per-token private secret storage",
 			"type":        "cubbyhole",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": true,
 		},
@@ -601,9 +673,11 @@ func TestSysTuneMount(t *testing.T) {
 				"description": "foo",
 				"type":        "generic",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("259196400"),
-					"max_lease_ttl":     json.Number("259200000"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("259196400"),
+					"max_lease_ttl":        json.Number("259200000"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -611,9 +685,11 @@ func TestSysTuneMount(t *testing.T) {
 				"description": "generic secret storage",
 				"type":        "generic",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -621,9 +697,11 @@ func TestSysTuneMount(t *testing.T) {
 				"description": "system endpoints used for control, policy and debugging",
 				"type":        "system",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": false,
 			},
@@ -631,9 +709,11 @@ func TestSysTuneMount(t *testing.T) {
 				"description": "per-token private secret storage",
 				"type":        "cubbyhole",
 				"config": map[string]interface{}{
-					"default_lease_ttl": json.Number("0"),
-					"max_lease_ttl":     json.Number("0"),
-					"force_no_cache":    false,
+					"default_lease_ttl":    json.Number("0"),
+					"max_lease_ttl":        json.Number("0"),
+					"force_no_cache":       false,
+					"default_wrapping_ttl": json.Number("0"),
+					"max_wrapping_ttl":     json.Number("0"),
 				},
 				"local": true,
 			},
@@ -642,9 +722,11 @@ func TestSysTuneMount(t *testing.T) {
 			"description": "foo",
 			"type":        "generic",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("259196400"),
-				"max_lease_ttl":     json.Number("259200000"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("259196400"),
+				"max_lease_ttl":        json.Number("259200000"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -652,9 +734,11 @@ func TestSysTuneMount(t *testing.T) {
 			"description": "generic secret storage",
 			"type":        "generic",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -662,9 +746,11 @@ func TestSysTuneMount(t *testing.T) {
 			"description": "system endpoints used for control, policy and debugging",
 			"type":        "system",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": false,
 		},
@@ -672,9 +758,11 @@ func TestSysTuneMount(t *testing.T) {
 			"description": "per-token private secret storage",
 			"type":        "cubbyhole",
 			"config": map[string]interface{}{
-				"default_lease_ttl": json.Number("0"),
-				"max_lease_ttl":     json.Number("0"),
-				"force_no_cache":    false,
+				"default_lease_ttl":    json.Number("0"),
+				"max_lease_ttl":        json.Number("0"),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": json.Number("0"),
+				"max_wrapping_ttl":     json.Number("0"),
 			},
 			"local": true,
 		},
@@ -698,13 +786,17 @@ func TestSysTuneMount(t *testing.T) {
 		"warnings":       nil,
 		"auth":           nil,
 		"data": map[string]interface{}{
-			"default_lease_ttl": json.Number("259196400"),
-			"max_lease_ttl":     json.Number("259200000"),
-			"force_no_cache":    false,
+			"default_lease_ttl":    json.Number("259196400"),
+			"max_lease_ttl":        json.Number("259200000"),
+			"force_no_cache":       false,
+			"default_wrapping_ttl": json.Number("0"),
+			"max_wrapping_ttl":     json.Number("0"),
 		},
-		"default_lease_ttl": json.Number("259196400"),
-		"max_lease_ttl":     json.Number("259200000"),
-		"force_no_cache":    false,
+		"default_lease_ttl":    json.Number("259196400"),
+		"max_lease_ttl":        json.Number("259200000"),
+		"force_no_cache":       false,
+		"default_wrapping_ttl": json.Number("0"),
+		"max_wrapping_ttl":     json.Number("0"),
 	}
 
 	testResponseStatus(t, resp, 200)
@@ -731,13 +823,17 @@ func TestSysTuneMount(t *testing.T) {
 		"warnings":       nil,
 		"auth":           nil,
 		"data": map[string]interface{}{
-			"default_lease_ttl": json.Number("40"),
-			"max_lease_ttl":     json.Number("80"),
-			"force_no_cache":    false,
+			"default_lease_ttl":    json.Number("40"),
+			"max_lease_ttl":        json.Number("80"),
+			"force_no_cache":       false,
+			"default_wrapping_ttl": json.Number("0"),
+			"max_wrapping_ttl":     json.Number("0"),
 		},
-		"default_lease_ttl": json.Number("40"),
-		"max_lease_ttl":     json.Number("80"),
-		"force_no_cache":    false,
+		"default_lease_ttl":    json.Number("40"),
+		"max_lease_ttl":        json.Number("80"),
+		"force_no_cache":       false,
+		"default_wrapping_ttl": json.Number("0"),
+		"max_wrapping_ttl":     json.Number("0"),
 	}
 
 	testResponseStatus(t, resp, 200)
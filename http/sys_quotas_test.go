@@ -0,0 +1,58 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestSysQuotas_rateLimit(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPut(t, token, addr+"/v1/sys/quotas/rate-limit/secret", map[string]interface{}{
+		"path":     "secret",
+		"rate":     1,
+		"interval": 3600,
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpPut(t, token, addr+"/v1/secret/foo", map[string]interface{}{
+		"value": "bar",
+	})
+	testResponseStatus(t, resp, 204)
+	resp = testHttpGet(t, token, addr+"/v1/secret/foo")
+	testResponseStatus(t, resp, 429)
+
+	// Other paths and the health checks are not limited
+	resp = testHttpGet(t, token, addr+"/v1/sys/policy")
+	testResponseStatus(t, resp, 200)
+	resp = testHttpGet(t, "", addr+"/v1/sys/health")
+	testResponseStatus(t, resp, 200)
+	resp = testHttpGet(t, "", addr+"/v1/sys/health")
+	testResponseStatus(t, resp, 200)
+}
+
+func TestSysQuotas_leaseCount(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPut(t, token, addr+"/v1/sys/quotas/lease-count/tokens", map[string]interface{}{
+		"path":       "auth/token",
+		"max_leases": 1,
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpPost(t, token, addr+"/v1/auth/token/create", map[string]interface{}{
+		"ttl": "1h",
+	})
+	testResponseStatus(t, resp, 200)
+	resp = testHttpPost(t, token, addr+"/v1/auth/token/create", map[string]interface{}{
+		"ttl": "1h",
+	})
+	testResponseStatus(t, resp, 429)
+}
@@ -0,0 +1,53 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/hashicorp/vault/vault"
+)
+
+// handleSysRaftJoin adds an uninitialized node to a raft cluster. It is not
+// authenticated, as the node has no token store until it joins the cluster,
+// just like sys/init.
+func handleSysRaftJoin(core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "PUT", "POST":
+			handleSysRaftJoinPut(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, nil)
+		}
+	})
+}
+
+func handleSysRaftJoinPut(core *vault.Core, w http.ResponseWriter, r *http.Request) {
+	// Parse the request
+	var req RaftJoinRequest
+	if err := parseRequest(r, w, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	switch err := core.JoinRaftCluster(req.LeaderAddress, req.NonVoter); err {
+	case nil:
+	case vault.ErrRaftStorageNotInUse, vault.ErrAlreadyInit:
+		respondError(w, http.StatusBadRequest, err)
+		return
+	default:
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondOk(w, &RaftJoinResponse{
+		Joined: true,
+	})
+}
+
+type RaftJoinRequest struct {
+	LeaderAddress string `json:"leader_address"`
+	NonVoter      bool   `json:"non_voter"`
+}
+
+type RaftJoinResponse struct {
+	Joined bool `json:"joined"`
+}
@@ -0,0 +1,28 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestSysRaftJoin_notRaft(t *testing.T) {
+	core := vault.TestCore(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	resp := testHttpPut(t, "", addr+"/v1/sys/storage/raft/join", map[string]interface{}{
+		"leader_address": "127.0.0.1:8202",
+	})
+	testResponseStatus(t, resp, 400)
+}
+
+func TestSysRaftConfiguration_notRaft(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpGet(t, token, addr+"/v1/sys/storage/raft/configuration")
+	testResponseStatus(t, resp, 400)
+}
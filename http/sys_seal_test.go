@@ -9,8 +9,12 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/hashicorp/vault/helper/logformat"
 	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
 	"github.com/hashicorp/vault/vault"
+	"github.com/hashicorp/vault/vault/seal"
+	log "github.com/mgutz/logxi/v1"
 )
 
 func TestSysSealStatus(t *testing.T) {
@@ -26,11 +30,14 @@ func TestSysSealStatus(t *testing.T) {
 
 	var actual map[string]interface{}
 	expected := map[string]interface{}{
-		"sealed":   true,
-		"t":        json.Number("3"),
-		"n":        json.Number("3"),
-		"progress": json.Number("0"),
-		"nonce":    "",
+		"sealed":        true,
+		"type":          "shamir",
+		"recovery_seal": false,
+		"migration":     false,
+		"t":             json.Number("3"),
+		"n":             json.Number("3"),
+		"progress":      json.Number("0"),
+		"nonce":         "",
 	}
 	testResponseStatus(t, resp, 200)
 	testResponseBody(t, resp, &actual)
@@ -114,11 +121,14 @@ func TestSysUnseal(t *testing.T) {
 
 		var actual map[string]interface{}
 		expected := map[string]interface{}{
-			"sealed":   true,
-			"t":        json.Number("3"),
-			"n":        json.Number("3"),
-			"progress": json.Number(fmt.Sprintf("%d", i+1)),
-			"nonce":    "",
+			"sealed":        true,
+			"type":          "shamir",
+			"recovery_seal": false,
+			"migration":     false,
+			"t":             json.Number("3"),
+			"n":             json.Number("3"),
+			"progress":      json.Number(fmt.Sprintf("%d", i+1)),
+			"nonce":         "",
 		}
 		if i == len(keys)-1 {
 			expected["sealed"] = false
@@ -163,6 +173,61 @@ func TestSysUnseal_badKey(t *testing.T) {
 	testResponseStatus(t, resp, 400)
 }
 
+func TestSysUnseal_Migrate(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	inm := physical.NewInmem(logger)
+
+	core, err := vault.NewCore(&vault.CoreConfig{
+		Physical:     inm,
+		Logger:       logger,
+		DisableMlock: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := vault.TestCoreInit(t, core)
+
+	core, err = vault.NewCore(&vault.CoreConfig{
+		Physical:     inm,
+		Seal:         vault.NewAutoSeal(seal.NewTestSeal()),
+		Logger:       logger,
+		DisableMlock: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	var actual map[string]interface{}
+	resp := testHttpGet(t, "", addr+"/v1/sys/seal-status")
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &actual)
+	if actual["migration"] != true || actual["type"] != "shamir" {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Unsealing without migrating is refused
+	resp = testHttpPut(t, "", addr+"/v1/sys/unseal", map[string]interface{}{
+		"key": hex.EncodeToString(keys[0]),
+	})
+	testResponseStatus(t, resp, 400)
+
+	for _, key := range keys {
+		resp = testHttpPut(t, "", addr+"/v1/sys/unseal", map[string]interface{}{
+			"key":     hex.EncodeToString(key),
+			"migrate": true,
+		})
+		testResponseStatus(t, resp, 200)
+	}
+
+	actual = map[string]interface{}{}
+	testResponseBody(t, resp, &actual)
+	if actual["sealed"] != false || actual["migration"] != false || actual["type"] != seal.Test || actual["recovery_seal"] != true {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
 func TestSysUnseal_Reset(t *testing.T) {
 	core := vault.TestCore(t)
 	ln, addr := TestServer(t, core)
@@ -192,10 +257,13 @@ func TestSysUnseal_Reset(t *testing.T) {
 
 		var actual map[string]interface{}
 		expected := map[string]interface{}{
-			"sealed":   true,
-			"t":        json.Number("3"),
-			"n":        json.Number("5"),
-			"progress": json.Number(strconv.Itoa(i + 1)),
+			"sealed":        true,
+			"type":          "shamir",
+			"recovery_seal": false,
+			"migration":     false,
+			"t":             json.Number("3"),
+			"n":             json.Number("5"),
+			"progress":      json.Number(strconv.Itoa(i + 1)),
 		}
 		testResponseStatus(t, resp, 200)
 		testResponseBody(t, resp, &actual)
@@ -228,10 +296,13 @@ func TestSysUnseal_Reset(t *testing.T) {
 
 	actual = map[string]interface{}{}
 	expected := map[string]interface{}{
-		"sealed":   true,
-		"t":        json.Number("3"),
-		"n":        json.Number("5"),
-		"progress": json.Number("0"),
+		"sealed":        true,
+		"type":          "shamir",
+		"recovery_seal": false,
+		"migration":     false,
+		"t":             json.Number("3"),
+		"n":             json.Number("5"),
+		"progress":      json.Number("0"),
 	}
 	testResponseStatus(t, resp, 200)
 	testResponseBody(t, resp, &actual)
@@ -27,6 +27,13 @@ type Auth struct {
 	// is associated with.
 	Policies []string `json:"policies" mapstructure:"policies" structs:"policies"`
 
+	// GroupAliases is the list of groups the authenticated user is a member
+	// of in the source of the backend, such as LDAP groups. Vault core grants
+	// the policies of the external groups having them as alias. A backend
+	// may return no policies when it returns group aliases, in which case the
+	// login is denied unless an external group grants policies.
+	GroupAliases []string `json:"group_aliases" mapstructure:"group_aliases" structs:"group_aliases"`
+
 	// Metadata is used to attach arbitrary string-type metadata to
 	// an authenticated user. This metadata will be outputted into the
 	// audit log.
@@ -51,6 +58,39 @@ type Auth struct {
 
 	// Number of allowed uses of the issued token
 	NumUses int `json:"num_uses" mapstructure:"num_uses" structs:"num_uses"`
+
+	// BoundCIDRs restricts the addresses the issued token can be used from
+	BoundCIDRs []string `json:"bound_cidrs" mapstructure:"bound_cidrs" structs:"bound_cidrs"`
+
+	// MFARequirement is set by Vault core instead of ClientToken when the
+	// login is subject to MFA enforcements. The login completes once the
+	// requirement is satisfied through sys/mfa/validate.
+	MFARequirement *MFARequirement `json:"mfa_requirement,omitempty" mapstructure:"mfa_requirement" structs:"mfa_requirement"`
+}
+
+// MFARequirement is the MFA a login must complete before a token is issued
+type MFARequirement struct {
+	// MFARequestID identifies the pending login in sys/mfa/validate
+	MFARequestID string `json:"mfa_request_id" mapstructure:"mfa_request_id" structs:"mfa_request_id"`
+
+	// MFAConstraints are keyed by the name of the login enforcements. Each
+	// of them is satisfied by any of its methods.
+	MFAConstraints map[string]*MFAConstraintAny `json:"mfa_constraints" mapstructure:"mfa_constraints" structs:"mfa_constraints"`
+}
+
+// MFAConstraintAny is a constraint satisfied by any of its methods
+type MFAConstraintAny struct {
+	Any []*MFAMethodID `json:"any" mapstructure:"any" structs:"any"`
+}
+
+// MFAMethodID describes an MFA method a login can be completed with
+type MFAMethodID struct {
+	Type string `json:"type" mapstructure:"type" structs:"type"`
+	ID   string `json:"id" mapstructure:"id" structs:"id"`
+
+	// UsesPasscode is whether the method requires a passcode, rather than
+	// a push notification approved by the user
+	UsesPasscode bool `json:"uses_passcode" mapstructure:"uses_passcode" structs:"uses_passcode"`
 }
 
 func (a *Auth) GoString() string {
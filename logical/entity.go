@@ -0,0 +1,16 @@
+package logical
+
+// Entity describes the identity of the client making a request. It is
+// populated by the core from the entity the client token was issued to, and
+// lets backends make decisions, or template values, based on who is calling.
+// Tokens without an entity, such as root tokens, have none.
+type Entity struct {
+	// Name is a non-security sensitive name for the entity, taken from the
+	// display name of the token issued on login
+	Name string `json:"name" structs:"name" mapstructure:"name"`
+
+	// Metadata is the metadata returned by the auth backend at
+	// authentication time, such as the username or organization. Child
+	// tokens cannot change it.
+	Metadata map[string]string `json:"metadata" structs:"metadata" mapstructure:"metadata"`
+}
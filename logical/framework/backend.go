@@ -329,6 +329,11 @@ func (b *Backend) Secret(k string) *Secret {
 	return nil
 }
 
+// GeneratesLeases returns whether the backend may return leased secrets.
+func (b *Backend) GeneratesLeases() bool {
+	return len(b.Secrets) > 0
+}
+
 func (b *Backend) init() {
 	b.pathsRe = make([]*regexp.Regexp, len(b.Paths))
 	for i, p := range b.Paths {
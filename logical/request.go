@@ -77,6 +77,10 @@ type Request struct {
 	// name, but is useful for operators.
 	DisplayName string `json:"display_name" structs:"display_name" mapstructure:"display_name"`
 
+	// Entity is the identity of the client making the request, if known.
+	// It is filled in by the core and is not audit logged.
+	Entity *Entity `json:"-" structs:"-" mapstructure:"-"`
+
 	// MountPoint is provided so that a logical backend can generate
 	// paths relative to itself. The `Path` is effectively the client
 	// request path with the MountPoint trimmed off.
@@ -90,6 +94,10 @@ type Request struct {
 	// WrapInfo contains requested response wrapping parameters
 	WrapInfo *RequestWrapInfo `json:"wrap_info" structs:"wrap_info" mapstructure:"wrap_info"`
 
+	// PolicyOverride is set when the soft-mandatory rule policies failing for
+	// the request are overridden
+	PolicyOverride bool `json:"policy_override" structs:"policy_override" mapstructure:"policy_override"`
+
 	// ClientTokenRemainingUses represents the allowed number of uses left on the
 	// token supplied
 	ClientTokenRemainingUses int `json:"client_token_remaining_uses" structs:"client_token_remaining_uses" mapstructure:"client_token_remaining_uses"`
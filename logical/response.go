@@ -110,3 +110,20 @@ func ListResponse(keys []string) *Response {
 	}
 	return resp
 }
+
+// ListResponseWithInfo is used to format a response to a list operation,
+// along with information about each key
+func ListResponseWithInfo(keys []string, keyInfo map[string]interface{}) *Response {
+	resp := ListResponse(keys)
+
+	info := make(map[string]interface{}, len(keyInfo))
+	for _, key := range keys {
+		if val, ok := keyInfo[key]; ok {
+			info[key] = val
+		}
+	}
+	if len(info) != 0 {
+		resp.Data["key_info"] = info
+	}
+	return resp
+}
@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/helper/managedkeys"
+	"github.com/hashicorp/vault/helper/passwordpolicy"
 	"github.com/hashicorp/vault/helper/pluginutil"
 	"github.com/hashicorp/vault/helper/wrapping"
 )
@@ -52,6 +54,16 @@ type SystemView interface {
 	// MlockEnabled returns the configuration setting for enabling mlock on
 	// plugins.
 	MlockEnabled() bool
+
+	// ManagedKey returns the named managed key, whose private material is
+	// held outside of Vault. It returns managedkeys.ErrNotFound if the key
+	// does not exist or the mount is not allowed to use it.
+	ManagedKey(name string) (managedkeys.Key, error)
+
+	// PasswordPolicy returns the named password policy, used to generate
+	// passwords. It returns passwordpolicy.ErrNotFound if the policy does not
+	// exist.
+	PasswordPolicy(name string) (*passwordpolicy.Policy, error)
 }
 
 type StaticSystemView struct {
@@ -63,6 +75,8 @@ type StaticSystemView struct {
 	Primary             bool
 	EnableMlock         bool
 	ReplicationStateVal consts.ReplicationState
+	ManagedKeys         map[string]managedkeys.Key
+	PasswordPolicies    map[string]string
 }
 
 func (d StaticSystemView) DefaultLeaseTTL() time.Duration {
@@ -100,3 +114,19 @@ func (d StaticSystemView) LookupPlugin(name string) (*pluginutil.PluginRunner, e
 func (d StaticSystemView) MlockEnabled() bool {
 	return d.EnableMlock
 }
+
+func (d StaticSystemView) ManagedKey(name string) (managedkeys.Key, error) {
+	key, ok := d.ManagedKeys[name]
+	if !ok {
+		return nil, managedkeys.ErrNotFound
+	}
+	return key, nil
+}
+
+func (d StaticSystemView) PasswordPolicy(name string) (*passwordpolicy.Policy, error) {
+	raw, ok := d.PasswordPolicies[name]
+	if !ok {
+		return nil, passwordpolicy.ErrNotFound
+	}
+	return passwordpolicy.Parse(raw)
+}
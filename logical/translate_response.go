@@ -27,12 +27,13 @@ func LogicalResponseToHTTPResponse(input *Response) *HTTPResponse {
 	// set up the result structure.
 	if input.Auth != nil {
 		httpResp.Auth = &HTTPAuth{
-			ClientToken:   input.Auth.ClientToken,
-			Accessor:      input.Auth.Accessor,
-			Policies:      input.Auth.Policies,
-			Metadata:      input.Auth.Metadata,
-			LeaseDuration: int(input.Auth.TTL.Seconds()),
-			Renewable:     input.Auth.Renewable,
+			ClientToken:    input.Auth.ClientToken,
+			Accessor:       input.Auth.Accessor,
+			Policies:       input.Auth.Policies,
+			Metadata:       input.Auth.Metadata,
+			LeaseDuration:  int(input.Auth.TTL.Seconds()),
+			Renewable:      input.Auth.Renewable,
+			MFARequirement: input.Auth.MFARequirement,
 		}
 	}
 
@@ -55,10 +56,11 @@ func HTTPResponseToLogicalResponse(input *HTTPResponse) *Response {
 
 	if input.Auth != nil {
 		logicalResp.Auth = &Auth{
-			ClientToken: input.Auth.ClientToken,
-			Accessor:    input.Auth.Accessor,
-			Policies:    input.Auth.Policies,
-			Metadata:    input.Auth.Metadata,
+			ClientToken:    input.Auth.ClientToken,
+			Accessor:       input.Auth.Accessor,
+			Policies:       input.Auth.Policies,
+			Metadata:       input.Auth.Metadata,
+			MFARequirement: input.Auth.MFARequirement,
 		}
 		logicalResp.Auth.Renewable = input.Auth.Renewable
 		logicalResp.Auth.TTL = time.Second * time.Duration(input.Auth.LeaseDuration)
@@ -85,10 +87,13 @@ type HTTPAuth struct {
 	Metadata      map[string]string `json:"metadata"`
 	LeaseDuration int               `json:"lease_duration"`
 	Renewable     bool              `json:"renewable"`
+
+	MFARequirement *MFARequirement `json:"mfa_requirement,omitempty"`
 }
 
 type HTTPWrapInfo struct {
 	Token           string `json:"token"`
+	Accessor        string `json:"accessor"`
 	TTL             int    `json:"ttl"`
 	CreationTime    string `json:"creation_time"`
 	WrappedAccessor string `json:"wrapped_accessor,omitempty"`
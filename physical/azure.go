@@ -1,13 +1,18 @@
 package physical
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	storage "github.com/Azure/azure-sdk-for-go/storage"
@@ -16,18 +21,82 @@ import (
 	"github.com/armon/go-metrics"
 	"github.com/hashicorp/errwrap"
 	cleanhttp "github.com/hashicorp/go-cleanhttp"
+	uuid "github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/helper/strutil"
 )
 
+const (
+	// AzureLockTTL is the duration of the lease of the lock blob. Azure
+	// accepts durations between 15 and 60 seconds.
+	AzureLockTTL = 15 * time.Second
+
+	// AzureLockRenewInterval is the amount of time to wait between the
+	// renewals of a held lease.
+	AzureLockRenewInterval = 5 * time.Second
+
+	// AzureLockRetryInterval is the amount of time to wait if a lock
+	// fails to be acquired before trying again.
+	AzureLockRetryInterval = time.Second
+
+	// azureOAuthAPIVersion is the first version of the storage API
+	// accepting Azure Active Directory tokens
+	azureOAuthAPIVersion = "2017-11-09"
+
+	// azureStorageResource is the resource of the tokens of the storage API
+	azureStorageResource = "https://storage.azure.com/"
+)
+
 // MaxBlobSize at this time
 var MaxBlobSize = 1024 * 1024 * 4
 
+// azureIMDSEndpoint is the Azure Instance Metadata Service, which issues the
+// tokens of managed identities
+var azureIMDSEndpoint = "http://169.254.169.254/metadata/"
+
 // AzureBackend is a physical backend that stores data
 // within an Azure blob container.
 type AzureBackend struct {
 	container  *storage.Container
 	logger     log.Logger
 	permitPool *PermitPool
+	haEnabled  bool
+}
+
+// AzureLock is a lock held with a lease on a blob, which Azure grants to a
+// single instance at a time. The blob holds the value of the lock.
+type AzureLock struct {
+	backend    *AzureBackend
+	value, key string
+
+	// leaseID is the ID of the lease proposed by this instance
+	leaseID string
+
+	lock sync.Mutex
+	held bool
+
+	// stopCh stops renewing the lease when the lock is released
+	stopCh chan struct{}
+
+	// Allow modifying the Lock durations for ease of unit testing.
+	renewInterval time.Duration
+	retryInterval time.Duration
+	ttl           time.Duration
+}
+
+// azureManagedIdentitySender authenticates the requests of a storage client
+// with a token of the managed identity of the virtual machine, instead of the
+// shared key of the account
+type azureManagedIdentitySender struct {
+	// Sender is the default sender of the client, retrying the requests
+	// failing with a server error
+	storage.Sender
+
+	httpClient *http.Client
+	clientID   string
+
+	lock      sync.Mutex
+	token     string
+	expiresOn time.Time
 }
 
 // newAzureBackend constructs an Azure backend using a pre-existing
@@ -50,12 +119,17 @@ func newAzureBackend(conf map[string]string, logger log.Logger) (Backend, error)
 		}
 	}
 
+	// Without an account key, the managed identity of the virtual machine
+	// is used
 	accountKey := os.Getenv("AZURE_ACCOUNT_KEY")
 	if accountKey == "" {
 		accountKey = conf["accountKey"]
-		if accountKey == "" {
-			return nil, fmt.Errorf("'accountKey' must be set")
-		}
+	}
+	useManagedIdentity := accountKey == ""
+	if useManagedIdentity {
+		// The client requires a key to sign the requests, but the
+		// signature is replaced with the token of the identity
+		accountKey = base64.StdEncoding.EncodeToString([]byte("managed-identity"))
 	}
 
 	client, err := storage.NewBasicClient(accountName, accountKey)
@@ -63,6 +137,17 @@ func newAzureBackend(conf map[string]string, logger log.Logger) (Backend, error)
 		return nil, fmt.Errorf("failed to create Azure client: %v", err)
 	}
 	client.HTTPClient = cleanhttp.DefaultPooledClient()
+	if useManagedIdentity {
+		clientID := os.Getenv("AZURE_CLIENT_ID")
+		if clientID == "" {
+			clientID = conf["client_id"]
+		}
+		client.Sender = &azureManagedIdentitySender{
+			Sender:     client.Sender,
+			httpClient: client.HTTPClient,
+			clientID:   clientID,
+		}
+	}
 
 	blobClient := client.GetBlobService()
 	container := blobClient.GetContainerReference(name)
@@ -85,14 +170,86 @@ func newAzureBackend(conf map[string]string, logger log.Logger) (Backend, error)
 		}
 	}
 
+	haEnabled := false
+	haEnabledStr := os.Getenv("AZURE_HA_ENABLED")
+	if haEnabledStr == "" {
+		haEnabledStr = conf["ha_enabled"]
+	}
+	if haEnabledStr != "" {
+		haEnabled, err = strconv.ParseBool(haEnabledStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing ha_enabled parameter: {{err}}", err)
+		}
+	}
+
 	a := &AzureBackend{
 		container:  container,
 		logger:     logger,
 		permitPool: NewPermitPool(maxParInt),
+		haEnabled:  haEnabled,
 	}
 	return a, nil
 }
 
+// Send authenticates the request with the token of the managed identity,
+// refreshing it a minute before it expires
+func (s *azureManagedIdentitySender) Send(c *storage.Client, req *http.Request) (*http.Response, error) {
+	s.lock.Lock()
+	if time.Now().Add(time.Minute).After(s.expiresOn) {
+		token, expiresOn, err := s.requestToken()
+		if err != nil {
+			s.lock.Unlock()
+			return nil, err
+		}
+		s.token, s.expiresOn = token, expiresOn
+	}
+	token := s.token
+	s.lock.Unlock()
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("x-ms-version", azureOAuthAPIVersion)
+	return s.Sender.Send(c, req)
+}
+
+// requestToken requests a token of the storage API from the managed identity,
+// and returns it with its expiration
+func (s *azureManagedIdentitySender) requestToken() (string, time.Time, error) {
+	query := url.Values{}
+	query.Set("api-version", "2018-02-01")
+	query.Set("resource", azureStorageResource)
+	if s.clientID != "" {
+		query.Set("client_id", s.clientID)
+	}
+
+	req, err := http.NewRequest("GET", azureIMDSEndpoint+"identity/oauth2/token?"+query.Encode(), nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Metadata", "true")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("error requesting a managed identity token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("error requesting a managed identity token: instance metadata service returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresOn   string `json:"expires_on"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", time.Time{}, fmt.Errorf("error decoding managed identity token: %v", err)
+	}
+	expiresOn, err := strconv.ParseInt(result.ExpiresOn, 10, 64)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid managed identity token expiration %q", result.ExpiresOn)
+	}
+	return result.AccessToken, time.Unix(expiresOn, 0), nil
+}
+
 // Put is used to insert or update an entry
 func (a *AzureBackend) Put(entry *Entry) error {
 	defer metrics.MeasureSince([]string{"azure", "put"}, time.Now())
@@ -196,3 +353,195 @@ func (a *AzureBackend) List(prefix string) ([]string, error) {
 	sort.Strings(keys)
 	return keys, nil
 }
+
+// LockWith is used for mutual exclusion based on the given key.
+func (a *AzureBackend) LockWith(key, value string) (Lock, error) {
+	leaseID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	return &AzureLock{
+		backend:       a,
+		key:           key,
+		value:         value,
+		leaseID:       leaseID,
+		renewInterval: AzureLockRenewInterval,
+		retryInterval: AzureLockRetryInterval,
+		ttl:           AzureLockTTL,
+	}, nil
+}
+
+// HAEnabled indicates whether the HA functionality should be exposed.
+func (a *AzureBackend) HAEnabled() bool {
+	return a.haEnabled
+}
+
+// Lock tries to acquire the lease of the lock blob. It blocks until either
+// the stop channel is closed or the lease is acquired. The returned channel
+// is closed once the lease is lost.
+func (l *AzureLock) Lock(stopCh <-chan struct{}) (<-chan struct{}, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.held {
+		return nil, fmt.Errorf("lock already held")
+	}
+
+	ticker := time.NewTicker(l.retryInterval)
+	defer ticker.Stop()
+	for {
+		acquired, err := l.acquire()
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			break
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return nil, nil
+		}
+	}
+
+	l.held = true
+	l.stopCh = make(chan struct{})
+	leaderCh := make(chan struct{})
+	go l.periodicallyRenewLease(leaderCh, l.stopCh)
+	return leaderCh, nil
+}
+
+// Unlock releases the lease of the lock blob.
+func (l *AzureLock) Unlock() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.held {
+		return nil
+	}
+
+	l.held = false
+	close(l.stopCh)
+
+	err := l.blob().ReleaseLease(l.leaseID, nil)
+	if isAzureStatus(err, http.StatusConflict) {
+		// The lease was lost meanwhile
+		return nil
+	}
+	return err
+}
+
+// Value checks whether or not the lock is held by any instance of
+// AzureLock, including this one, and returns the current value.
+func (l *AzureLock) Value() (bool, string, error) {
+	blob := l.blob()
+	reader, err := blob.Get(nil)
+	if isAzureStatus(err, http.StatusNotFound) {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	defer reader.Close()
+	value, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return false, "", err
+	}
+
+	switch blob.Properties.LeaseState {
+	case "leased", "breaking":
+		return true, string(value), nil
+	}
+	return false, "", nil
+}
+
+func (l *AzureLock) blob() *storage.Blob {
+	return l.backend.container.GetBlobReference(l.key)
+}
+
+// acquire acquires the lease of the lock blob, creating the blob if needed,
+// and writes the value of the lock. It returns false if another instance
+// holds the lease.
+func (l *AzureLock) acquire() (bool, error) {
+	blob := l.blob()
+	_, err := blob.AcquireLease(int(l.ttl/time.Second), l.leaseID, nil)
+	if isAzureStatus(err, http.StatusNotFound) {
+		// Create the blob, unless another instance created and leased it
+		// concurrently
+		err = blob.CreateBlockBlob(nil)
+		if isAzureStatus(err, http.StatusPreconditionFailed) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		_, err = blob.AcquireLease(int(l.ttl/time.Second), l.leaseID, nil)
+	}
+	if isAzureStatus(err, http.StatusConflict) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := blob.CreateBlockBlobFromReader(bytes.NewReader([]byte(l.value)), &storage.PutBlobOptions{
+		LeaseID: l.leaseID,
+	}); err != nil {
+		blob.ReleaseLease(l.leaseID, nil)
+		return false, err
+	}
+	return true, nil
+}
+
+// periodicallyRenewLease renews the lease until the lock is released, and
+// closes the leader channel when it is lost: either taken over by another
+// instance, or not renewed in time because of errors.
+func (l *AzureLock) periodicallyRenewLease(leaderCh, stopCh chan struct{}) {
+	defer close(leaderCh)
+
+	ticker := time.NewTicker(l.renewInterval)
+	defer ticker.Stop()
+
+	lastRenewal := time.Now()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		err := l.blob().RenewLease(l.leaseID, nil)
+		switch {
+		case isAzureStatus(err, http.StatusConflict, http.StatusNotFound):
+			l.backend.logger.Error("azure: lock lease lost", "key", l.key, "error", err)
+			return
+		case err != nil:
+			l.backend.logger.Warn("azure: failed to renew lock lease", "key", l.key, "error", err)
+			if time.Since(lastRenewal) < l.ttl {
+				continue
+			}
+			l.backend.logger.Error("azure: lock lease expired", "key", l.key)
+			return
+		}
+		lastRenewal = time.Now()
+	}
+}
+
+// isAzureStatus returns whether the error is a response of the storage API
+// with one of the given status codes
+func isAzureStatus(err error, codes ...int) bool {
+	var status int
+	switch err := err.(type) {
+	case storage.AzureStorageServiceError:
+		status = err.StatusCode
+	case storage.UnexpectedStatusCodeError:
+		status = err.Got()
+	default:
+		return false
+	}
+	for _, code := range codes {
+		if status == code {
+			return true
+		}
+	}
+	return false
+}
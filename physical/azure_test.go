@@ -1,8 +1,16 @@
 package physical
 
 import (
+	"encoding/base64"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -49,3 +57,212 @@ func TestAzureBackend(t *testing.T) {
 	testBackend(t, backend)
 	testBackend_ListPrefix(t, backend)
 }
+
+// fakeAzureBlob is a blob of fakeAzure
+type fakeAzureBlob struct {
+	data         []byte
+	leaseID      string
+	leaseExpires time.Time
+}
+
+// fakeAzure implements the subset of the Azure Blob Storage API used by the
+// locks of the backend, and the token endpoint of the Instance Metadata
+// Service
+type fakeAzure struct {
+	lock  sync.Mutex
+	blobs map[string]*fakeAzureBlob
+
+	// leaseUnit is the duration of a second of lease, shortened for tests
+	leaseUnit time.Duration
+
+	// authorizations are the Authorization headers of the storage requests
+	authorizations map[string]bool
+}
+
+func (f *fakeAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if strings.HasPrefix(r.URL.Path, "/metadata/identity/oauth2/token") {
+		if r.Header.Get("Metadata") != "true" || r.URL.Query().Get("resource") != azureStorageResource {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token":"identity-token","expires_on":"%d"}`, time.Now().Add(time.Hour).Unix())
+		return
+	}
+	f.authorizations[r.Header.Get("Authorization")+" "+r.Header.Get("x-ms-version")] = true
+
+	fail := func(status int, code string) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, code)
+	}
+
+	name := r.URL.Path
+	blob := f.blobs[name]
+	leased := blob != nil && blob.leaseID != "" && time.Now().Before(blob.leaseExpires)
+	leaseID := r.Header.Get("x-ms-lease-id")
+
+	switch {
+	case r.Method == "PUT" && r.URL.Query().Get("comp") == "lease":
+		if blob == nil {
+			fail(http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		duration, _ := strconv.Atoi(r.Header.Get("x-ms-lease-duration"))
+		switch r.Header.Get("x-ms-lease-action") {
+		case "acquire":
+			proposed := r.Header.Get("x-ms-proposed-lease-id")
+			if leased && blob.leaseID != proposed {
+				fail(http.StatusConflict, "LeaseAlreadyPresent")
+				return
+			}
+			blob.leaseID = proposed
+			blob.leaseExpires = time.Now().Add(time.Duration(duration) * f.leaseUnit)
+			w.Header().Set("x-ms-lease-id", proposed)
+			w.WriteHeader(http.StatusCreated)
+		case "renew":
+			if blob.leaseID != leaseID {
+				fail(http.StatusConflict, "LeaseIdMismatchWithLeaseOperation")
+				return
+			}
+			blob.leaseExpires = time.Now().Add(15 * f.leaseUnit)
+		case "release":
+			if blob.leaseID != leaseID {
+				fail(http.StatusConflict, "LeaseIdMismatchWithLeaseOperation")
+				return
+			}
+			blob.leaseID = ""
+		}
+
+	case r.Method == "PUT":
+		if leased && blob.leaseID != leaseID {
+			fail(http.StatusPreconditionFailed, "LeaseIdMissing")
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		if blob == nil {
+			blob = &fakeAzureBlob{}
+			f.blobs[name] = blob
+		}
+		blob.data = data
+		w.WriteHeader(http.StatusCreated)
+
+	case r.Method == "GET":
+		if blob == nil {
+			fail(http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		switch {
+		case leased:
+			w.Header().Set("x-ms-lease-state", "leased")
+		case blob.leaseID != "":
+			w.Header().Set("x-ms-lease-state", "expired")
+		default:
+			w.Header().Set("x-ms-lease-state", "available")
+		}
+		w.Write(blob.data)
+
+	default:
+		fail(http.StatusBadRequest, "UnsupportedHttpVerb")
+	}
+}
+
+// testFakeAzureBackend returns a backend using a fake Azure server, and the
+// fake. The backend authenticates with a managed identity.
+func testFakeAzureBackend(t *testing.T) (*AzureBackend, *fakeAzure, func()) {
+	fake := &fakeAzure{
+		blobs:          map[string]*fakeAzureBlob{},
+		leaseUnit:      time.Second,
+		authorizations: map[string]bool{},
+	}
+	server := httptest.NewServer(fake)
+	serverURL, _ := url.Parse(server.URL)
+
+	client, err := storage.NewClient("vaultaccount", base64.StdEncoding.EncodeToString([]byte("unused")), storage.DefaultBaseURL, storage.DefaultAPIVersion, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.HTTPClient = &http.Client{Transport: &redirectTransport{url: serverURL}}
+	client.Sender = &azureManagedIdentitySender{
+		Sender:     client.Sender,
+		httpClient: client.HTTPClient,
+	}
+
+	blobClient := client.GetBlobService()
+	b := &AzureBackend{
+		container:  blobClient.GetContainerReference("vault"),
+		logger:     logformat.NewVaultLogger(log.LevelTrace),
+		permitPool: NewPermitPool(0),
+		haEnabled:  true,
+	}
+	return b, fake, server.Close
+}
+
+func TestAzureBackend_HA(t *testing.T) {
+	b, fake, cleanup := testFakeAzureBackend(t)
+	defer cleanup()
+
+	testHABackend(t, b, b)
+
+	// The requests were authenticated with the token of the managed identity
+	expected := map[string]bool{"Bearer identity-token " + azureOAuthAPIVersion: true}
+	if fmt.Sprint(fake.authorizations) != fmt.Sprint(expected) {
+		t.Fatalf("bad authorizations: %v", fake.authorizations)
+	}
+}
+
+func TestAzureBackend_LockLease(t *testing.T) {
+	b, fake, cleanup := testFakeAzureBackend(t)
+	defer cleanup()
+	fake.leaseUnit = 10 * time.Millisecond
+
+	l, err := b.LockWith("core/lock", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock := l.(*AzureLock)
+	lock.renewInterval = 20 * time.Millisecond
+	lock.retryInterval = 20 * time.Millisecond
+
+	leaderCh, err := lock.Lock(nil)
+	if err != nil || leaderCh == nil {
+		t.Fatalf("failed to acquire the lock: %v", err)
+	}
+
+	// The lease is kept longer than its duration by the renewals
+	time.Sleep(300 * time.Millisecond)
+	select {
+	case <-leaderCh:
+		t.Fatal("lost the lock")
+	default:
+	}
+
+	// Another instance takes over the lease once it is not renewed anymore
+	l2, err := b.LockWith("core/lock", "baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock2 := l2.(*AzureLock)
+	lock2.retryInterval = 20 * time.Millisecond
+	close(lock.stopCh)
+	leaderCh2, err := lock2.Lock(nil)
+	if err != nil || leaderCh2 == nil {
+		t.Fatalf("failed to acquire the lock: %v", err)
+	}
+	held, value, err := lock.Value()
+	if err != nil || !held || value != "baz" {
+		t.Fatalf("bad: %v %q %v", held, value, err)
+	}
+
+	// Releasing the lost lock keeps the new lease
+	lock.stopCh = make(chan struct{})
+	if err := lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if held, _, _ := lock2.Value(); !held {
+		t.Fatal("expected the lock to be held")
+	}
+	lock2.Unlock()
+}
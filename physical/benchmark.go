@@ -0,0 +1,246 @@
+package physical
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	uuid "github.com/hashicorp/go-uuid"
+	log "github.com/mgutz/logxi/v1"
+)
+
+// BenchmarkPrefix is the prefix of the keys written by a storage benchmark.
+// Vault never reads or writes under it, so that a benchmark doesn't touch the
+// data of Vault stored in the same backend.
+const BenchmarkPrefix = "storage-benchmark/"
+
+// benchmarkOperations are the operations run by a benchmark, in the order of
+// its report
+var benchmarkOperations = []Operation{GetOperation, PutOperation, ListOperation, DeleteOperation}
+
+// BenchmarkConfig is the workload run by Benchmark
+type BenchmarkConfig struct {
+	// Operations is the number of operations run
+	Operations int
+
+	// Concurrency is the number of operations run in parallel
+	Concurrency int
+
+	// Keys is the number of keys the operations are spread over. They are
+	// written before the measured operations.
+	Keys int
+
+	// ValueSize is the size in bytes of the written values
+	ValueSize int
+
+	// Mix is the weight of each operation in the workload
+	Mix map[Operation]int
+}
+
+// BenchmarkStats holds the latencies of an operation in a benchmark
+type BenchmarkStats struct {
+	Count  int
+	Errors int
+	Min    time.Duration
+	Max    time.Duration
+	Mean   time.Duration
+	P50    time.Duration
+	P90    time.Duration
+	P99    time.Duration
+}
+
+// BenchmarkResult is the result of a benchmark
+type BenchmarkResult struct {
+	// Duration is the time the measured operations took
+	Duration time.Duration
+
+	// Stats holds the latencies of the operations run
+	Stats map[Operation]*BenchmarkStats
+}
+
+// OperationsPerSecond returns the throughput of the benchmark
+func (r *BenchmarkResult) OperationsPerSecond() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	count := 0
+	for _, stats := range r.Stats {
+		count += stats.Count
+	}
+	return float64(count) / r.Duration.Seconds()
+}
+
+// Operations returns the operations of a benchmark result, in the
+// order of a report
+func (r *BenchmarkResult) Operations() []Operation {
+	var ops []Operation
+	for _, op := range benchmarkOperations {
+		if _, ok := r.Stats[op]; ok {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// Benchmark runs a workload of reads, writes, lists and deletes against the
+// backend and returns the latencies of the operations. The workload only uses
+// keys under a BenchmarkPrefix path unique to the run, which are deleted once
+// it completes.
+func Benchmark(b Backend, conf *BenchmarkConfig, logger log.Logger) (*BenchmarkResult, error) {
+	if conf.Operations <= 0 {
+		return nil, fmt.Errorf("the number of operations must be positive")
+	}
+	if conf.Concurrency <= 0 {
+		return nil, fmt.Errorf("the concurrency must be positive")
+	}
+	if conf.Keys <= 0 {
+		return nil, fmt.Errorf("the number of keys must be positive")
+	}
+	if conf.ValueSize < 0 {
+		return nil, fmt.Errorf("the value size must not be negative")
+	}
+	var ops []Operation
+	for _, op := range benchmarkOperations {
+		weight := conf.Mix[op]
+		if weight < 0 {
+			return nil, fmt.Errorf("the weight of %s operations must not be negative", op)
+		}
+		for i := 0; i < weight; i++ {
+			ops = append(ops, op)
+		}
+	}
+	for op := range conf.Mix {
+		if !isBenchmarkOperation(op) {
+			return nil, fmt.Errorf("unsupported operation %q", op)
+		}
+	}
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("the workload has no operations")
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	prefix := BenchmarkPrefix + id + "/"
+	keys := make([]string, conf.Keys)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%s%08d", prefix, i)
+	}
+	value := make([]byte, conf.ValueSize)
+	rand.Read(value)
+
+	// Whatever happens, remove the keys of the run
+	defer func() {
+		for _, key := range keys {
+			if err := b.Delete(key); err != nil {
+				logger.Error("benchmark: failed to delete key", "key", key, "error", err)
+			}
+		}
+	}()
+
+	logger.Info("benchmark: writing keys", "prefix", prefix, "keys", conf.Keys)
+	for _, key := range keys {
+		if err := b.Put(&Entry{Key: key, Value: value}); err != nil {
+			return nil, fmt.Errorf("failed to write key %q: %v", key, err)
+		}
+	}
+
+	logger.Info("benchmark: running operations", "operations", conf.Operations, "concurrency", conf.Concurrency)
+	latencies := make(map[Operation][]time.Duration)
+	failures := make(map[Operation]int)
+	var l sync.Mutex
+	var wg sync.WaitGroup
+	work := make(chan Operation)
+	start := time.Now()
+	for i := 0; i < conf.Concurrency; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for op := range work {
+				key := keys[r.Intn(len(keys))]
+				opStart := time.Now()
+				var err error
+				switch op {
+				case GetOperation:
+					_, err = b.Get(key)
+				case PutOperation:
+					err = b.Put(&Entry{Key: key, Value: value})
+				case ListOperation:
+					_, err = b.List(prefix)
+				case DeleteOperation:
+					err = b.Delete(key)
+				}
+				latency := time.Since(opStart)
+
+				l.Lock()
+				latencies[op] = append(latencies[op], latency)
+				if err != nil {
+					failures[op]++
+				}
+				l.Unlock()
+			}
+		}(start.UnixNano() + int64(i))
+	}
+	r := rand.New(rand.NewSource(start.UnixNano()))
+	for i := 0; i < conf.Operations; i++ {
+		work <- ops[r.Intn(len(ops))]
+	}
+	close(work)
+	wg.Wait()
+
+	result := &BenchmarkResult{
+		Duration: time.Since(start),
+		Stats:    make(map[Operation]*BenchmarkStats),
+	}
+	for op, opLatencies := range latencies {
+		stats := benchmarkStats(opLatencies)
+		stats.Errors = failures[op]
+		result.Stats[op] = stats
+	}
+	return result, nil
+}
+
+func isBenchmarkOperation(op Operation) bool {
+	for _, o := range benchmarkOperations {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// benchmarkStats computes the statistics of a set of latencies
+func benchmarkStats(latencies []time.Duration) *BenchmarkStats {
+	sort.Sort(durations(latencies))
+
+	var total time.Duration
+	for _, latency := range latencies {
+		total += latency
+	}
+	percentile := func(p int) time.Duration {
+		i := (len(latencies)*p+99)/100 - 1
+		if i < 0 {
+			i = 0
+		}
+		return latencies[i]
+	}
+	return &BenchmarkStats{
+		Count: len(latencies),
+		Min:   latencies[0],
+		Max:   latencies[len(latencies)-1],
+		Mean:  total / time.Duration(len(latencies)),
+		P50:   percentile(50),
+		P90:   percentile(90),
+		P99:   percentile(99),
+	}
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
@@ -0,0 +1,128 @@
+package physical
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	log "github.com/mgutz/logxi/v1"
+)
+
+func TestBenchmark(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	inm := NewInmem(logger)
+	inm.SetErrorRate(DeleteOperation, 1)
+
+	conf := &BenchmarkConfig{
+		Operations:  500,
+		Concurrency: 4,
+		Keys:        10,
+		ValueSize:   128,
+		Mix: map[Operation]int{
+			GetOperation:    60,
+			PutOperation:    30,
+			DeleteOperation: 10,
+		},
+	}
+	result, err := Benchmark(inm, conf, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := 0
+	for _, stats := range result.Stats {
+		count += stats.Count
+		if stats.Min > stats.P50 || stats.P50 > stats.P90 || stats.P90 > stats.P99 || stats.P99 > stats.Max {
+			t.Fatalf("bad: %#v", stats)
+		}
+	}
+	if count != conf.Operations {
+		t.Fatalf("bad: %d", count)
+	}
+	if _, ok := result.Stats[ListOperation]; ok {
+		t.Fatal("unexpected list operations")
+	}
+	for _, op := range []Operation{GetOperation, PutOperation} {
+		if result.Stats[op].Errors != 0 {
+			t.Fatalf("bad: %#v", result.Stats[op])
+		}
+	}
+	if stats := result.Stats[DeleteOperation]; stats.Errors != stats.Count {
+		t.Fatalf("bad: %#v", stats)
+	}
+	if ops := result.Operations(); len(ops) != 3 || ops[0] != GetOperation || ops[2] != DeleteOperation {
+		t.Fatalf("bad: %v", ops)
+	}
+
+	// The keys of the benchmark are removed, and the rest is untouched
+	inm = NewInmem(logger)
+	if err := inm.Put(&Entry{Key: "sys/foo", Value: []byte("bar")}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Benchmark(inm, conf, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := inm.List(BenchmarkPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("bad: %v", keys)
+	}
+	ent, err := inm.Get("sys/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ent == nil || string(ent.Value) != "bar" {
+		t.Fatalf("bad: %#v", ent)
+	}
+}
+
+func TestBenchmark_InvalidConfig(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	inm := NewInmem(logger)
+	valid := BenchmarkConfig{
+		Operations:  1,
+		Concurrency: 1,
+		Keys:        1,
+		Mix:         map[Operation]int{GetOperation: 1},
+	}
+	for _, modify := range []func(*BenchmarkConfig){
+		func(c *BenchmarkConfig) { c.Operations = 0 },
+		func(c *BenchmarkConfig) { c.Concurrency = 0 },
+		func(c *BenchmarkConfig) { c.Keys = 0 },
+		func(c *BenchmarkConfig) { c.ValueSize = -1 },
+		func(c *BenchmarkConfig) { c.Mix = map[Operation]int{GetOperation: -1} },
+		func(c *BenchmarkConfig) { c.Mix = map[Operation]int{"scan": 1} },
+		func(c *BenchmarkConfig) { c.Mix = nil },
+	} {
+		conf := valid
+		modify(&conf)
+		if _, err := Benchmark(inm, &conf, logger); err == nil {
+			t.Fatalf("expected error: %#v", conf)
+		}
+	}
+}
+
+func TestBenchmarkStats(t *testing.T) {
+	var latencies []time.Duration
+	for i := 100; i > 0; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	stats := benchmarkStats(latencies)
+	expected := &BenchmarkStats{
+		Count: 100,
+		Min:   time.Millisecond,
+		Max:   100 * time.Millisecond,
+		Mean:  50500 * time.Microsecond,
+		P50:   50 * time.Millisecond,
+		P90:   90 * time.Millisecond,
+		P99:   99 * time.Millisecond,
+	}
+	if *stats != *expected {
+		t.Fatalf("bad: %#v", stats)
+	}
+}
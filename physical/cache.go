@@ -2,9 +2,14 @@ package physical
 
 import (
 	"fmt"
+	"math"
 	"strings"
+	"sync"
+	"sync/atomic"
 
+	"github.com/armon/go-metrics"
 	"github.com/hashicorp/golang-lru"
+	"github.com/hashicorp/golang-lru/simplelru"
 	"github.com/hashicorp/vault/helper/locksutil"
 	log "github.com/mgutz/logxi/v1"
 )
@@ -14,33 +19,70 @@ const (
 	DefaultCacheSize = 32 * 1024
 )
 
+// CacheConfig is the configuration of a physical cache
+type CacheConfig struct {
+	// Size is the maximum number of cached entries. If zero, the default
+	// size is used. It is ignored if SizeBytes is set.
+	Size int
+
+	// SizeBytes bounds the cache by the total size of the cached keys and
+	// values instead of the number of entries, which suits data sets whose
+	// entries vary a lot in size.
+	SizeBytes int64
+
+	// NegativeCaching enables the caching of the keys which don't exist, so
+	// that reading them again doesn't reach the backend.
+	NegativeCaching bool
+}
+
 // Cache is used to wrap an underlying physical backend
 // and provide an LRU cache layer on top. Most of the reads done by
 // Vault are for policy objects so there is a large read reduction
 // by using a simple write-through cache.
 type Cache struct {
-	backend       Backend
-	transactional Transactional
-	lru           *lru.TwoQueueCache
-	locks         []*locksutil.LockEntry
-	logger        log.Logger
+	backend         Backend
+	transactional   Transactional
+	store           cacheStore
+	negativeCaching bool
+	locks           []*locksutil.LockEntry
+	logger          log.Logger
+
+	// disabled is set while the cache is disabled, in which case the
+	// operations pass through to the backend. It is accessed atomically.
+	disabled uint32
 }
 
 // NewCache returns a physical cache of the given size.
 // If no size is provided, the default size is used.
 func NewCache(b Backend, size int, logger log.Logger) *Cache {
-	if size <= 0 {
-		size = DefaultCacheSize
-	}
-	if logger.IsTrace() {
-		logger.Trace("physical/cache: creating LRU cache", "size", size)
+	return NewCacheWithConfig(b, &CacheConfig{Size: size}, logger)
+}
+
+// NewCacheWithConfig returns a physical cache using the given configuration.
+func NewCacheWithConfig(b Backend, conf *CacheConfig, logger log.Logger) *Cache {
+	var store cacheStore
+	if conf.SizeBytes > 0 {
+		if logger.IsTrace() {
+			logger.Trace("physical/cache: creating LRU cache", "size_bytes", conf.SizeBytes, "negative_caching", conf.NegativeCaching)
+		}
+		store = newByteCacheStore(conf.SizeBytes)
+	} else {
+		size := conf.Size
+		if size <= 0 {
+			size = DefaultCacheSize
+		}
+		if logger.IsTrace() {
+			logger.Trace("physical/cache: creating LRU cache", "size", size, "negative_caching", conf.NegativeCaching)
+		}
+		store = newEntryCacheStore(size)
 	}
-	cache, _ := lru.New2Q(size)
+
 	c := &Cache{
-		backend: b,
-		lru:     cache,
-		locks:   locksutil.CreateLocks(),
-		logger:  logger,
+		backend:         b,
+		store:           store,
+		negativeCaching: conf.NegativeCaching,
+		locks:           locksutil.CreateLocks(),
+		logger:          logger,
 	}
 
 	if txnl, ok := c.backend.(Transactional); ok {
@@ -58,7 +100,30 @@ func (c *Cache) Purge() {
 		defer lock.Unlock()
 	}
 
-	c.lru.Purge()
+	c.store.Purge()
+}
+
+// SetEnabled enables or disables the cache. The cache is purged either way,
+// as the entries may change in the backend while it is disabled.
+func (c *Cache) SetEnabled(enabled bool) {
+	var disabled uint32
+	if !enabled {
+		disabled = 1
+	}
+
+	// Lock the world, so that the operations in progress complete before
+	// the cache is purged
+	for _, lock := range c.locks {
+		lock.Lock()
+		defer lock.Unlock()
+	}
+
+	atomic.StoreUint32(&c.disabled, disabled)
+	c.store.Purge()
+}
+
+func (c *Cache) enabled() bool {
+	return atomic.LoadUint32(&c.disabled) == 0
 }
 
 func (c *Cache) Put(entry *Entry) error {
@@ -67,8 +132,8 @@ func (c *Cache) Put(entry *Entry) error {
 	defer lock.Unlock()
 
 	err := c.backend.Put(entry)
-	if err == nil && !strings.HasPrefix(entry.Key, "core/") {
-		c.lru.Add(entry.Key, entry)
+	if err == nil && c.enabled() && !strings.HasPrefix(entry.Key, "core/") {
+		c.store.Add(entry.Key, entry)
 	}
 	return err
 }
@@ -82,18 +147,16 @@ func (c *Cache) Get(key string) (*Entry, error) {
 	// otherwise we risk certain race conditions upstream. The primary issue is
 	// with the HA mode, we could potentially negatively cache the leader entry
 	// and cause leader discovery to fail.
-	if strings.HasPrefix(key, "core/") {
+	if !c.enabled() || strings.HasPrefix(key, "core/") {
 		return c.backend.Get(key)
 	}
 
-	// Check the LRU first
-	if raw, ok := c.lru.Get(key); ok {
-		if raw == nil {
-			return nil, nil
-		} else {
-			return raw.(*Entry), nil
-		}
+	// Check the LRU first. A nil entry records that the key doesn't exist.
+	if ent, ok := c.store.Get(key); ok {
+		metrics.IncrCounter([]string{"cache", "hit"}, 1)
+		return ent, nil
 	}
+	metrics.IncrCounter([]string{"cache", "miss"}, 1)
 
 	// Read from the underlying backend
 	ent, err := c.backend.Get(key)
@@ -102,8 +165,8 @@ func (c *Cache) Get(key string) (*Entry, error) {
 	}
 
 	// Cache the result
-	if ent != nil {
-		c.lru.Add(key, ent)
+	if ent != nil || c.negativeCaching {
+		c.store.Add(key, ent)
 	}
 
 	return ent, nil
@@ -116,7 +179,7 @@ func (c *Cache) Delete(key string) error {
 
 	err := c.backend.Delete(key)
 	if err == nil && !strings.HasPrefix(key, "core/") {
-		c.lru.Remove(key)
+		c.store.Remove(key)
 	}
 	return err
 }
@@ -142,15 +205,134 @@ func (c *Cache) Transaction(txns []TxnEntry) error {
 	if err := c.transactional.Transaction(txns); err != nil {
 		return err
 	}
+	if !c.enabled() {
+		return nil
+	}
 
 	for _, txn := range txns {
 		switch txn.Operation {
 		case PutOperation:
-			c.lru.Add(txn.Entry.Key, txn.Entry)
+			c.store.Add(txn.Entry.Key, txn.Entry)
 		case DeleteOperation:
-			c.lru.Remove(txn.Entry.Key)
+			c.store.Remove(txn.Entry.Key)
 		}
 	}
 
 	return nil
 }
+
+// cacheStore is the bounded store of the cached entries. A nil entry is the
+// negative cache entry of a key.
+type cacheStore interface {
+	Add(key string, entry *Entry)
+	Get(key string) (*Entry, bool)
+	Remove(key string)
+	Purge()
+}
+
+// entryCacheStore bounds the cache by the number of entries, using a 2Q cache
+// so that a scan of the keys doesn't evict the frequently used ones.
+type entryCacheStore struct {
+	lru *lru.TwoQueueCache
+}
+
+func newEntryCacheStore(size int) *entryCacheStore {
+	cache, _ := lru.New2Q(size)
+	return &entryCacheStore{lru: cache}
+}
+
+func (s *entryCacheStore) Add(key string, entry *Entry) {
+	s.lru.Add(key, entry)
+}
+
+func (s *entryCacheStore) Get(key string) (*Entry, bool) {
+	raw, ok := s.lru.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return raw.(*Entry), true
+}
+
+func (s *entryCacheStore) Remove(key string) {
+	s.lru.Remove(key)
+}
+
+func (s *entryCacheStore) Purge() {
+	s.lru.Purge()
+}
+
+// byteCacheStore bounds the cache by the total size of the cached keys and
+// values, evicting the least recently used entries.
+type byteCacheStore struct {
+	l        sync.Mutex
+	lru      *simplelru.LRU
+	size     int64
+	maxBytes int64
+}
+
+func newByteCacheStore(maxBytes int64) *byteCacheStore {
+	s := &byteCacheStore{
+		maxBytes: maxBytes,
+	}
+	// The number of entries is only bounded by their size
+	s.lru, _ = simplelru.NewLRU(math.MaxInt32, func(key interface{}, value interface{}) {
+		s.size -= cacheEntrySize(key.(string), value.(*Entry))
+	})
+	return s
+}
+
+// cacheEntrySize returns the size accounted for an entry
+func cacheEntrySize(key string, entry *Entry) int64 {
+	size := int64(len(key))
+	if entry != nil {
+		size += int64(len(entry.Value))
+	}
+	return size
+}
+
+func (s *byteCacheStore) Add(key string, entry *Entry) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	// Remove the previous entry so that its size is released
+	s.lru.Remove(key)
+
+	size := cacheEntrySize(key, entry)
+	if size > s.maxBytes {
+		return
+	}
+	s.lru.Add(key, entry)
+	s.size += size
+
+	for s.size > s.maxBytes {
+		if _, _, ok := s.lru.RemoveOldest(); !ok {
+			break
+		}
+		metrics.IncrCounter([]string{"cache", "evict"}, 1)
+	}
+}
+
+func (s *byteCacheStore) Get(key string) (*Entry, bool) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	raw, ok := s.lru.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return raw.(*Entry), true
+}
+
+func (s *byteCacheStore) Remove(key string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.lru.Remove(key)
+}
+
+func (s *byteCacheStore) Purge() {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.lru.Purge()
+}
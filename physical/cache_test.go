@@ -141,3 +141,159 @@ func TestCache_IgnoreCore(t *testing.T) {
 		t.Fatal("expected non-cached value")
 	}
 }
+
+func TestCache_NegativeCaching(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	inm := NewInmem(logger)
+	cache := NewCacheWithConfig(inm, &CacheConfig{NegativeCaching: true}, logger)
+	testBackend(t, cache)
+
+	// The absence of the key is cached
+	ent, err := cache.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ent != nil {
+		t.Fatalf("bad: %#v", ent)
+	}
+	if err := inm.Put(&Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatal(err)
+	}
+	ent, err = cache.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ent != nil {
+		t.Fatalf("expected cached absence, got: %#v", ent)
+	}
+
+	// Writing through the cache replaces the negative entry
+	if err := cache.Put(&Entry{Key: "foo", Value: []byte("baz")}); err != nil {
+		t.Fatal(err)
+	}
+	ent, err = cache.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ent == nil || string(ent.Value) != "baz" {
+		t.Fatalf("bad: %#v", ent)
+	}
+
+	// The absence of core keys is never cached
+	if _, err := cache.Get("core/foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := inm.Put(&Entry{Key: "core/foo", Value: []byte("bar")}); err != nil {
+		t.Fatal(err)
+	}
+	ent, err = cache.Get("core/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ent == nil {
+		t.Fatal("expected core key")
+	}
+}
+
+func TestCache_SizeBytes(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	inm := NewInmem(logger)
+	cache := NewCacheWithConfig(inm, &CacheConfig{SizeBytes: 20}, logger)
+	testBackend(t, cache)
+	testBackend_ListPrefix(t, cache)
+
+	store := cache.store.(*byteCacheStore)
+	store.Purge()
+	if store.size != 0 {
+		t.Fatalf("bad: %d", store.size)
+	}
+
+	for _, key := range []string{"a", "b", "c"} {
+		if err := cache.Put(&Entry{Key: key, Value: []byte("123456789")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if store.size != 20 {
+		t.Fatalf("bad: %d", store.size)
+	}
+	if _, ok := store.Get("a"); ok {
+		t.Fatal("expected the oldest entry to be evicted")
+	}
+	for _, key := range []string{"b", "c"} {
+		if _, ok := store.Get(key); !ok {
+			t.Fatalf("expected %q to be cached", key)
+		}
+	}
+
+	// Entries larger than the cache are not cached
+	if err := cache.Put(&Entry{Key: "d", Value: make([]byte, 20)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Get("d"); ok {
+		t.Fatal("expected the entry not to be cached")
+	}
+	if store.size != 20 {
+		t.Fatalf("bad: %d", store.size)
+	}
+
+	// Replacing an entry releases the size of the previous value
+	if err := cache.Put(&Entry{Key: "c", Value: []byte("1")}); err != nil {
+		t.Fatal(err)
+	}
+	if store.size != 12 {
+		t.Fatalf("bad: %d", store.size)
+	}
+	if err := cache.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	if store.size != 2 {
+		t.Fatalf("bad: %d", store.size)
+	}
+}
+
+func TestCache_SetEnabled(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	inm := NewInmem(logger)
+	cache := NewCache(inm, 0, logger)
+	cache.SetEnabled(false)
+	testBackend(t, cache)
+	cache.SetEnabled(true)
+
+	if err := cache.Put(&Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reads pass through while the cache is disabled
+	cache.SetEnabled(false)
+	if err := inm.Put(&Entry{Key: "foo", Value: []byte("baz")}); err != nil {
+		t.Fatal(err)
+	}
+	ent, err := cache.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ent == nil || string(ent.Value) != "baz" {
+		t.Fatalf("bad: %#v", ent)
+	}
+	if err := cache.Put(&Entry{Key: "zip", Value: []byte("zap")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.store.Get("zip"); ok {
+		t.Fatal("expected the entry not to be cached")
+	}
+
+	// The cache starts empty once enabled again
+	cache.SetEnabled(true)
+	if _, ok := cache.store.Get("foo"); ok {
+		t.Fatal("expected the cache to be purged")
+	}
+	if _, err := cache.Get("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.store.Get("foo"); !ok {
+		t.Fatal("expected the entry to be cached")
+	}
+}
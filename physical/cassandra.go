@@ -0,0 +1,343 @@
+package physical
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/mgutz/logxi/v1"
+
+	"github.com/armon/go-metrics"
+	"github.com/gocql/gocql"
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/helper/parseutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/helper/tlsutil"
+)
+
+const (
+	// DefaultCassandraRetries is the number of times a query failing on its
+	// coordinator is retried on another host
+	DefaultCassandraRetries = 3
+
+	// CassandraRetryBackoffMin and CassandraRetryBackoffMax bound the
+	// exponential backoff between the attempts of a query
+	CassandraRetryBackoffMin = 100 * time.Millisecond
+	CassandraRetryBackoffMax = 5 * time.Second
+)
+
+// CassandraBackend is a physical backend that stores data in a Cassandra
+// table.
+//
+// The rows are partitioned by bucket, the parent paths of the keys: an entry
+// is written in the bucket of its direct parent with its value, and in the
+// buckets of the other parents without it, so that a key is read from a
+// single partition, and listing a prefix reads the partition of the prefix.
+type CassandraBackend struct {
+	sess  *gocql.Session
+	table string
+
+	readConsistency  gocql.Consistency
+	writeConsistency gocql.Consistency
+
+	logger log.Logger
+}
+
+// newCassandraBackend constructs a Cassandra backend using an existing
+// keyspace and table.
+func newCassandraBackend(conf map[string]string, logger log.Logger) (Backend, error) {
+	cluster, err := cassandraClusterConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	keyspace := conf["keyspace"]
+	if keyspace == "" {
+		keyspace = "vault"
+	}
+	table := conf["table"]
+	if table == "" {
+		table = "entries"
+	}
+	cluster.Keyspace = keyspace
+
+	readConsistency, writeConsistency, err := cassandraConsistencies(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := cluster.CreateSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cassandra session: %v", err)
+	}
+
+	c := &CassandraBackend{
+		sess:             sess,
+		table:            `"` + strings.Replace(table, `"`, `""`, -1) + `"`,
+		readConsistency:  readConsistency,
+		writeConsistency: writeConsistency,
+		logger:           logger,
+	}
+
+	// Check the access to the table
+	if _, err := c.Get("core/cassandra-check"); err != nil {
+		sess.Close()
+		return nil, fmt.Errorf("unable to access table %q of keyspace %q: %v", table, keyspace, err)
+	}
+	return c, nil
+}
+
+// cassandraClusterConfig returns the configuration of the connections to the
+// cluster
+func cassandraClusterConfig(conf map[string]string) (*gocql.ClusterConfig, error) {
+	hosts := conf["hosts"]
+	if hosts == "" {
+		hosts = "localhost"
+	}
+	cluster := gocql.NewCluster(strings.Split(hosts, ",")...)
+
+	if protocolVersionStr, ok := conf["protocol_version"]; ok {
+		protocolVersion, err := strconv.Atoi(protocolVersionStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing protocol_version parameter: {{err}}", err)
+		}
+		if protocolVersion < 2 || protocolVersion > 4 {
+			return nil, fmt.Errorf("protocol_version must be 2, 3 or 4")
+		}
+		cluster.ProtoVersion = protocolVersion
+	}
+
+	if timeoutStr, ok := conf["connection_timeout"]; ok {
+		timeout, err := parseutil.ParseDurationSecond(timeoutStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing connection_timeout parameter: {{err}}", err)
+		}
+		cluster.Timeout = timeout
+		cluster.ConnectTimeout = timeout
+	}
+
+	retries := DefaultCassandraRetries
+	if retriesStr, ok := conf["retries"]; ok {
+		var err error
+		retries, err = strconv.Atoi(retriesStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing retries parameter: {{err}}", err)
+		}
+		if retries < 0 {
+			return nil, fmt.Errorf("retries must not be negative")
+		}
+	}
+	// A failed attempt is retried on the next host of the query plan, so
+	// that another node coordinates it. The queries of the backend are
+	// idempotent, so that retrying them after a timeout is safe.
+	cluster.RetryPolicy = &gocql.ExponentialBackoffRetryPolicy{
+		NumRetries: retries,
+		Min:        CassandraRetryBackoffMin,
+		Max:        CassandraRetryBackoffMax,
+	}
+
+	if username := conf["username"]; username != "" {
+		cluster.Authenticator = gocql.PasswordAuthenticator{
+			Username: username,
+			Password: conf["password"],
+		}
+	}
+
+	sslOpts, err := cassandraSslOptions(conf)
+	if err != nil {
+		return nil, err
+	}
+	cluster.SslOpts = sslOpts
+
+	return cluster, nil
+}
+
+// cassandraConsistencies returns the consistency levels of the reads and the
+// writes. Both default to the consistency parameter.
+func cassandraConsistencies(conf map[string]string) (gocql.Consistency, gocql.Consistency, error) {
+	parse := func(name string, def gocql.Consistency) (gocql.Consistency, error) {
+		value, ok := conf[name]
+		if !ok {
+			return def, nil
+		}
+		consistency, err := gocql.ParseConsistencyWrapper(strings.ToUpper(value))
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s %q", name, value)
+		}
+		return consistency, nil
+	}
+
+	consistency, err := parse("consistency", gocql.LocalQuorum)
+	if err != nil {
+		return 0, 0, err
+	}
+	read, err := parse("read_consistency", consistency)
+	if err != nil {
+		return 0, 0, err
+	}
+	write, err := parse("write_consistency", consistency)
+	if err != nil {
+		return 0, 0, err
+	}
+	return read, write, nil
+}
+
+// cassandraSslOptions returns the TLS configuration of the connections, or
+// nil if TLS is disabled. The CA and the client certificate are given either
+// as separate files, or as a PEM bundle.
+func cassandraSslOptions(conf map[string]string) (*gocql.SslOptions, error) {
+	enabled := false
+	if tlsStr, ok := conf["tls"]; ok {
+		var err error
+		enabled, err = strconv.ParseBool(tlsStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing tls parameter: {{err}}", err)
+		}
+	}
+	for _, name := range []string{"tls_ca_file", "tls_cert_file", "tls_key_file", "pem_bundle_file"} {
+		if conf[name] != "" {
+			enabled = true
+		}
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	skipVerify := false
+	if skipVerifyStr, ok := conf["tls_skip_verify"]; ok {
+		var err error
+		skipVerify, err = strconv.ParseBool(skipVerifyStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing tls_skip_verify parameter: {{err}}", err)
+		}
+	}
+
+	tlsConfig := &tls.Config{}
+	if bundleFile := conf["pem_bundle_file"]; bundleFile != "" {
+		pem, err := ioutil.ReadFile(bundleFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pem_bundle_file: %v", err)
+		}
+		bundle, err := certutil.ParsePEMBundle(string(pem))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pem_bundle_file: %v", err)
+		}
+		tlsConfig, err = bundle.GetTLSConfig(certutil.TLSClient)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get TLS configuration from pem_bundle_file: %v", err)
+		}
+	}
+
+	tlsConfig.ServerName = conf["tls_server_name"]
+	tlsConfig.MinVersion = tls.VersionTLS12
+	if minVersion, ok := conf["tls_min_version"]; ok {
+		tlsConfig.MinVersion, ok = tlsutil.TLSLookup[minVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid tls_min_version %q", minVersion)
+		}
+	}
+
+	certFile, keyFile := conf["tls_cert_file"], conf["tls_key_file"]
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("tls_cert_file and tls_key_file must be set together")
+	}
+
+	return &gocql.SslOptions{
+		Config:   tlsConfig,
+		CaPath:   conf["tls_ca_file"],
+		CertPath: certFile,
+		KeyPath:  keyFile,
+
+		// The driver skips the verification of the servers unless enabled
+		EnableHostVerification: !skipVerify,
+	}, nil
+}
+
+// cassandraBuckets returns the parent paths of a key, the nearest last
+func cassandraBuckets(key string) []string {
+	buckets := []string{""}
+	for i := 0; i < len(key); i++ {
+		if key[i] == '/' {
+			buckets = append(buckets, key[:i])
+		}
+	}
+	return buckets
+}
+
+// Put is used to insert or update an entry
+func (c *CassandraBackend) Put(entry *Entry) error {
+	defer metrics.MeasureSince([]string{"cassandra", "put"}, time.Now())
+
+	buckets := cassandraBuckets(entry.Key)
+	batch := c.sess.NewBatch(gocql.LoggedBatch)
+	batch.Cons = c.writeConsistency
+	for i, bucket := range buckets {
+		var value []byte
+		if i == len(buckets)-1 {
+			value = entry.Value
+		}
+		batch.Query("INSERT INTO "+c.table+" (bucket, key, value) VALUES (?, ?, ?)", bucket, entry.Key, value)
+	}
+	return c.sess.ExecuteBatch(batch)
+}
+
+// Get is used to fetch an entry
+func (c *CassandraBackend) Get(key string) (*Entry, error) {
+	defer metrics.MeasureSince([]string{"cassandra", "get"}, time.Now())
+
+	buckets := cassandraBuckets(key)
+	var value []byte
+	err := c.sess.Query("SELECT value FROM "+c.table+" WHERE bucket = ? AND key = ?",
+		buckets[len(buckets)-1], key).Consistency(c.readConsistency).Scan(&value)
+	if err == gocql.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Entry{
+		Key:   key,
+		Value: value,
+	}, nil
+}
+
+// Delete is used to permanently delete an entry
+func (c *CassandraBackend) Delete(key string) error {
+	defer metrics.MeasureSince([]string{"cassandra", "delete"}, time.Now())
+
+	batch := c.sess.NewBatch(gocql.LoggedBatch)
+	batch.Cons = c.writeConsistency
+	for _, bucket := range cassandraBuckets(key) {
+		batch.Query("DELETE FROM "+c.table+" WHERE bucket = ? AND key = ?", bucket, key)
+	}
+	return c.sess.ExecuteBatch(batch)
+}
+
+// List is used to list all the keys under a given
+// prefix, up to the next prefix.
+func (c *CassandraBackend) List(prefix string) ([]string, error) {
+	defer metrics.MeasureSince([]string{"cassandra", "list"}, time.Now())
+
+	bucket := strings.TrimSuffix(prefix, "/")
+	iter := c.sess.Query("SELECT key FROM "+c.table+" WHERE bucket = ?", bucket).
+		Consistency(c.readConsistency).Iter()
+
+	keys := []string{}
+	var key string
+	for iter.Scan(&key) {
+		key = strings.TrimPrefix(key, prefix)
+		if i := strings.Index(key, "/"); i == -1 {
+			keys = append(keys, key)
+		} else {
+			keys = strutil.AppendIfMissing(keys, key[:i+1])
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
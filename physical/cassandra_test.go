@@ -0,0 +1,132 @@
+package physical
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/hashicorp/vault/helper/logformat"
+	log "github.com/mgutz/logxi/v1"
+)
+
+func TestCassandraBackend(t *testing.T) {
+	hosts := os.Getenv("CASSANDRA_HOSTS")
+	if hosts == "" {
+		t.SkipNow()
+	}
+
+	// Create a keyspace and a table for the test
+	cluster := gocql.NewCluster(strings.Split(hosts, ",")...)
+	sess, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sess.Close()
+	keyspace := fmt.Sprintf("vault_%d", time.Now().Unix())
+	for _, stmt := range []string{
+		"CREATE KEYSPACE " + keyspace + " WITH replication = {'class': 'SimpleStrategy', 'replication_factor': 1}",
+		"CREATE TABLE " + keyspace + ".entries (bucket text, key text, value blob, PRIMARY KEY (bucket, key)) WITH CLUSTERING ORDER BY (key ASC)",
+	} {
+		if err := sess.Query(stmt).Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer sess.Query("DROP KEYSPACE " + keyspace).Exec()
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	b, err := NewBackend("cassandra", logger, map[string]string{
+		"hosts":       hosts,
+		"keyspace":    keyspace,
+		"consistency": "one",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create new backend: %v", err)
+	}
+
+	testBackend(t, b)
+	testBackend_ListPrefix(t, b)
+}
+
+func TestCassandraBuckets(t *testing.T) {
+	buckets := cassandraBuckets("foo/bar/baz")
+	expected := []string{"", "foo", "foo/bar"}
+	if !reflect.DeepEqual(buckets, expected) {
+		t.Fatalf("bad: %v", buckets)
+	}
+	if buckets := cassandraBuckets("foo"); !reflect.DeepEqual(buckets, []string{""}) {
+		t.Fatalf("bad: %v", buckets)
+	}
+}
+
+func TestCassandraBackend_Config(t *testing.T) {
+	cluster, err := cassandraClusterConfig(map[string]string{
+		"hosts":              "10.0.0.1,10.0.0.2",
+		"protocol_version":   "4",
+		"connection_timeout": "5s",
+		"retries":            "5",
+		"tls_ca_file":        "/etc/vault/cassandra-ca.pem",
+		"tls_cert_file":      "/etc/vault/cassandra.pem",
+		"tls_key_file":       "/etc/vault/cassandra-key.pem",
+		"tls_min_version":    "tls11",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cluster.Hosts) != 2 || cluster.ProtoVersion != 4 || cluster.Timeout != 5*time.Second {
+		t.Fatalf("bad: %#v", cluster)
+	}
+	if policy, ok := cluster.RetryPolicy.(*gocql.ExponentialBackoffRetryPolicy); !ok || policy.NumRetries != 5 {
+		t.Fatalf("bad retry policy: %#v", cluster.RetryPolicy)
+	}
+	ssl := cluster.SslOpts
+	if ssl == nil || ssl.CaPath != "/etc/vault/cassandra-ca.pem" || ssl.CertPath != "/etc/vault/cassandra.pem" {
+		t.Fatalf("bad TLS options: %#v", ssl)
+	}
+	if !ssl.EnableHostVerification || ssl.MinVersion != tls.VersionTLS11 {
+		t.Fatalf("bad TLS options: %#v", ssl)
+	}
+
+	// TLS is disabled by default
+	cluster, err = cassandraClusterConfig(map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster.SslOpts != nil {
+		t.Fatalf("bad TLS options: %#v", cluster.SslOpts)
+	}
+
+	for _, conf := range []map[string]string{
+		{"protocol_version": "5"},
+		{"retries": "-1"},
+		{"tls_cert_file": "/etc/vault/cassandra.pem"},
+		{"tls": "true", "tls_min_version": "ssl3"},
+	} {
+		if _, err := cassandraClusterConfig(conf); err == nil {
+			t.Fatalf("expected an error with %v", conf)
+		}
+	}
+}
+
+func TestCassandraBackend_Consistencies(t *testing.T) {
+	read, write, err := cassandraConsistencies(map[string]string{})
+	if err != nil || read != gocql.LocalQuorum || write != gocql.LocalQuorum {
+		t.Fatalf("bad: %v %v %v", read, write, err)
+	}
+
+	read, write, err = cassandraConsistencies(map[string]string{
+		"consistency":      "quorum",
+		"read_consistency": "local_one",
+	})
+	if err != nil || read != gocql.LocalOne || write != gocql.Quorum {
+		t.Fatalf("bad: %v %v %v", read, write, err)
+	}
+
+	if _, _, err := cassandraConsistencies(map[string]string{"write_consistency": "most"}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,280 @@
+package physical
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/mgutz/logxi/v1"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/lib/pq"
+)
+
+// CockroachDBMaxTxnRetries is the number of times a transaction failing with
+// a serialization error is retried
+var CockroachDBMaxTxnRetries = 10
+
+// cockroachDBRetryCode is the SQLSTATE of the serialization errors, which
+// CockroachDB returns when a transaction must be retried
+const cockroachDBRetryCode = "40001"
+
+// CockroachDBBackend is a physical backend that stores data in a CockroachDB
+// table. CockroachDB speaks the PostgreSQL protocol, so the backend uses the
+// PostgreSQL driver.
+type CockroachDBBackend struct {
+	table      string
+	client     *sql.DB
+	statements map[string]*sql.Stmt
+	logger     log.Logger
+	permitPool *PermitPool
+}
+
+// newCockroachDBBackend constructs a CockroachDB backend using the given
+// connection URL, creating the table if it doesn't exist.
+func newCockroachDBBackend(conf map[string]string, logger log.Logger) (Backend, error) {
+	connURL, ok := conf["connection_url"]
+	if !ok || connURL == "" {
+		return nil, fmt.Errorf("missing connection_url")
+	}
+
+	table, ok := conf["table"]
+	if !ok {
+		table = "vault_kv_store"
+	}
+	quotedTable := pq.QuoteIdentifier(table)
+
+	maxParStr, ok := conf["max_parallel"]
+	var maxParInt int
+	var err error
+	if ok {
+		maxParInt, err = strconv.Atoi(maxParStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing max_parallel parameter: {{err}}", err)
+		}
+		if logger.IsDebug() {
+			logger.Debug("cockroachdb: max_parallel set", "max_parallel", maxParInt)
+		}
+	}
+
+	// Create CockroachDB handle for the database.
+	db, err := sql.Open("postgres", connURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to cockroachdb: %v", err)
+	}
+
+	// Create the required table if it doesn't exists.
+	createQuery := "CREATE TABLE IF NOT EXISTS " + quotedTable +
+		" (path STRING, value BYTES, PRIMARY KEY (path))"
+	if _, err := db.Exec(createQuery); err != nil {
+		return nil, fmt.Errorf("failed to create cockroachdb table: %v", err)
+	}
+
+	// Setup the backend.
+	c := &CockroachDBBackend{
+		table:      quotedTable,
+		client:     db,
+		statements: make(map[string]*sql.Stmt),
+		logger:     logger,
+		permitPool: NewPermitPool(maxParInt),
+	}
+
+	// Prepare all the statements required
+	statements := map[string]string{
+		"put":    "UPSERT INTO " + quotedTable + " VALUES($1, $2)",
+		"get":    "SELECT value FROM " + quotedTable + " WHERE path = $1",
+		"delete": "DELETE FROM " + quotedTable + " WHERE path = $1",
+		"list":   "SELECT path FROM " + quotedTable + " WHERE path LIKE $1",
+	}
+	for name, query := range statements {
+		if err := c.prepare(name, query); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// prepare is a helper to prepare a query for future execution
+func (c *CockroachDBBackend) prepare(name, query string) error {
+	stmt, err := c.client.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("failed to prepare '%s': %v", name, err)
+	}
+	c.statements[name] = stmt
+	return nil
+}
+
+// Put is used to insert or update an entry.
+func (c *CockroachDBBackend) Put(entry *Entry) error {
+	defer metrics.MeasureSince([]string{"cockroachdb", "put"}, time.Now())
+
+	c.permitPool.Acquire()
+	defer c.permitPool.Release()
+
+	_, err := c.statements["put"].Exec(entry.Key, entry.Value)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Get is used to fetch and entry.
+func (c *CockroachDBBackend) Get(key string) (*Entry, error) {
+	defer metrics.MeasureSince([]string{"cockroachdb", "get"}, time.Now())
+
+	c.permitPool.Acquire()
+	defer c.permitPool.Release()
+
+	var result []byte
+	err := c.statements["get"].QueryRow(key).Scan(&result)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ent := &Entry{
+		Key:   key,
+		Value: result,
+	}
+	return ent, nil
+}
+
+// Delete is used to permanently delete an entry
+func (c *CockroachDBBackend) Delete(key string) error {
+	defer metrics.MeasureSince([]string{"cockroachdb", "delete"}, time.Now())
+
+	c.permitPool.Acquire()
+	defer c.permitPool.Release()
+
+	_, err := c.statements["delete"].Exec(key)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// List is used to list all the keys under a given
+// prefix, up to the next prefix.
+func (c *CockroachDBBackend) List(prefix string) ([]string, error) {
+	defer metrics.MeasureSince([]string{"cockroachdb", "list"}, time.Now())
+
+	c.permitPool.Acquire()
+	defer c.permitPool.Release()
+
+	// Escape the wildcards of the prefix, and add the % wildcard to do the
+	// prefix search
+	likePrefix := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+	rows, err := c.statements["list"].Query(likePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute statement: %v", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		err = rows.Scan(&key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan rows: %v", err)
+		}
+
+		key = strings.TrimPrefix(key, prefix)
+		if i := strings.Index(key, "/"); i == -1 {
+			// Add objects only from the current 'folder'
+			keys = append(keys, key)
+		} else {
+			// Add truncated 'folder' paths
+			keys = strutil.AppendIfMissing(keys, string(key[:i+1]))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows: %v", err)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Transaction applies the operations in a single CockroachDB transaction,
+// retrying it when CockroachDB reports a conflict with a concurrent one.
+func (c *CockroachDBBackend) Transaction(txns []TxnEntry) error {
+	defer metrics.MeasureSince([]string{"cockroachdb", "transaction"}, time.Now())
+	if len(txns) == 0 {
+		return nil
+	}
+
+	c.permitPool.Acquire()
+	defer c.permitPool.Release()
+
+	return c.executeTx(func(tx *sql.Tx) error {
+		for _, txn := range txns {
+			var err error
+			switch txn.Operation {
+			case PutOperation:
+				_, err = tx.Stmt(c.statements["put"]).Exec(txn.Entry.Key, txn.Entry.Value)
+			case DeleteOperation:
+				_, err = tx.Stmt(c.statements["delete"]).Exec(txn.Entry.Key)
+			default:
+				return fmt.Errorf("unsupported transaction operation: %q", txn.Operation)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// executeTx runs f in a transaction following the client-side retry protocol
+// of CockroachDB: the operations run after the cockroach_restart savepoint,
+// and are run again from it after a serialization error, which lets
+// CockroachDB keep the priority of the transaction across the attempts.
+func (c *CockroachDBBackend) executeTx(f func(tx *sql.Tx) error) error {
+	tx, err := c.client.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	if _, err := tx.Exec("SAVEPOINT cockroach_restart"); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to create savepoint: %v", err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := f(tx)
+		if err == nil {
+			// Releasing the savepoint commits the operations, and reports
+			// the serialization errors
+			if _, err = tx.Exec("RELEASE SAVEPOINT cockroach_restart"); err == nil {
+				return tx.Commit()
+			}
+		}
+
+		if !isCockroachDBRetryError(err) || attempt >= CockroachDBMaxTxnRetries {
+			tx.Rollback()
+			return err
+		}
+		metrics.IncrCounter([]string{"cockroachdb", "retry"}, 1)
+		if c.logger.IsDebug() {
+			c.logger.Debug("cockroachdb: retrying transaction", "attempt", attempt+1, "error", err)
+		}
+		if _, err := tx.Exec("ROLLBACK TO SAVEPOINT cockroach_restart"); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to roll back to savepoint: %v", err)
+		}
+	}
+}
+
+// isCockroachDBRetryError returns whether err is a serialization error after
+// which the transaction can be retried
+func isCockroachDBRetryError(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && string(pqErr.Code) == cockroachDBRetryCode
+}
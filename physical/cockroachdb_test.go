@@ -0,0 +1,116 @@
+package physical
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/lib/pq"
+	log "github.com/mgutz/logxi/v1"
+)
+
+func testCockroachDBBackend(t *testing.T) (*CockroachDBBackend, func()) {
+	connURL := os.Getenv("CR_URL")
+	if connURL == "" {
+		t.SkipNow()
+	}
+
+	table := os.Getenv("CR_TABLE")
+	if table == "" {
+		table = "vault_kv_store"
+	}
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	b, err := NewBackend("cockroachdb", logger, map[string]string{
+		"connection_url": connURL,
+		"table":          table,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create new backend: %v", err)
+	}
+
+	c := b.(*CockroachDBBackend)
+	return c, func() {
+		_, err := c.client.Exec("TRUNCATE TABLE " + c.table)
+		if err != nil {
+			t.Fatalf("Failed to truncate table: %v", err)
+		}
+	}
+}
+
+func TestCockroachDBBackend(t *testing.T) {
+	b, cleanup := testCockroachDBBackend(t)
+	defer cleanup()
+
+	testBackend(t, b)
+	testBackend_ListPrefix(t, b)
+
+	// The wildcards of LIKE are matched literally
+	if err := b.Put(&Entry{Key: "a_b/c", Value: []byte("bar")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put(&Entry{Key: "axb/c", Value: []byte("bar")}); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := b.List("a_b/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "c" {
+		t.Fatalf("bad: %v", keys)
+	}
+}
+
+func TestCockroachDBBackend_Transaction(t *testing.T) {
+	b, cleanup := testCockroachDBBackend(t)
+	defer cleanup()
+
+	// Concurrent transactions on the same keys conflict, and are retried
+	var wg sync.WaitGroup
+	errCh := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value := []byte(fmt.Sprintf("%d", i))
+			errCh <- b.Transaction([]TxnEntry{
+				{Operation: PutOperation, Entry: &Entry{Key: "foo", Value: value}},
+				{Operation: PutOperation, Entry: &Entry{Key: "bar", Value: value}},
+				{Operation: DeleteOperation, Entry: &Entry{Key: "baz"}},
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	foo, err := b.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bar, err := b.Get("bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(foo.Value) != string(bar.Value) {
+		t.Fatalf("transactions were interleaved: %q %q", foo.Value, bar.Value)
+	}
+}
+
+func TestCockroachDBBackend_RetryError(t *testing.T) {
+	if !isCockroachDBRetryError(&pq.Error{Code: "40001"}) {
+		t.Fatal("expected a serialization error to be retried")
+	}
+	if isCockroachDBRetryError(&pq.Error{Code: "23505"}) {
+		t.Fatal("expected a unique violation not to be retried")
+	}
+	if isCockroachDBRetryError(fmt.Errorf("40001")) {
+		t.Fatal("expected other errors not to be retried")
+	}
+}
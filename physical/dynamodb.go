@@ -3,6 +3,7 @@ package physical
 import (
 	"fmt"
 	"math"
+	"math/rand"
 	"os"
 	pkgPath "path"
 	"sort"
@@ -19,6 +20,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
@@ -64,6 +66,26 @@ const (
 	// DynamoDBWatchRetryInterval is the amount of time to wait
 	// if a watch fails before trying again.
 	DynamoDBWatchRetryInterval = 5 * time.Second
+
+	// DynamoDBBillingModeProvisioned and DynamoDBBillingModePayPerRequest
+	// are the billing modes tables are created with. On-demand tables
+	// don't have a provisioned capacity.
+	DynamoDBBillingModeProvisioned   = "PROVISIONED"
+	DynamoDBBillingModePayPerRequest = "PAY_PER_REQUEST"
+
+	// DynamoDBMaxBatchSize is the maximum number of write requests of a
+	// BatchWriteItem request.
+	DynamoDBMaxBatchSize = 25
+)
+
+var (
+	// DynamoDBThrottleRetryMax is the number of times throttled writes are
+	// retried before failing.
+	DynamoDBThrottleRetryMax = 10
+	// DynamoDBThrottleBackoffBase is the initial backoff after a throttled
+	// write, doubled after each retry up to DynamoDBThrottleBackoffMax.
+	DynamoDBThrottleBackoffBase = 50 * time.Millisecond
+	DynamoDBThrottleBackoffMax  = 5 * time.Second
 )
 
 // DynamoDBBackend is a physical backend that stores data in
@@ -185,13 +207,33 @@ func newDynamoDBBackend(conf map[string]string, logger log.Logger) (Backend, err
 		&ec2rolecreds.EC2RoleProvider{Client: ec2metadata.New(session.New())},
 	})
 
+	billingMode := strings.ToUpper(conf["billing_mode"])
+	switch billingMode {
+	case "":
+		billingMode = DynamoDBBillingModeProvisioned
+	case DynamoDBBillingModeProvisioned:
+	case DynamoDBBillingModePayPerRequest:
+		if conf["read_capacity"] != "" || conf["write_capacity"] != "" {
+			logger.Warn("physical/dynamodb: read_capacity and write_capacity are ignored with the PAY_PER_REQUEST billing mode")
+		}
+	default:
+		return nil, fmt.Errorf("invalid billing mode: %s", conf["billing_mode"])
+	}
+
 	awsConf := aws.NewConfig().
 		WithCredentials(creds).
 		WithRegion(region).
 		WithEndpoint(endpoint)
+	if maxRetriesStr, ok := conf["max_retries"]; ok {
+		maxRetries, err := strconv.Atoi(maxRetriesStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing max_retries parameter: {{err}}", err)
+		}
+		awsConf = awsConf.WithMaxRetries(maxRetries)
+	}
 	client := dynamodb.New(session.New(awsConf))
 
-	if err := ensureTableExists(client, table, readCapacity, writeCapacity); err != nil {
+	if err := ensureTableExists(client, table, billingMode, readCapacity, writeCapacity); err != nil {
 		return nil, err
 	}
 
@@ -438,22 +480,72 @@ func (d *DynamoDBBackend) HAEnabled() bool {
 // with a maximum size of 25 (which is the limit of BatchWriteItem requests).
 func (d *DynamoDBBackend) batchWriteRequests(requests []*dynamodb.WriteRequest) error {
 	for len(requests) > 0 {
-		batchSize := int(math.Min(float64(len(requests)), 25))
+		batchSize := int(math.Min(float64(len(requests)), DynamoDBMaxBatchSize))
 		batch := requests[:batchSize]
 		requests = requests[batchSize:]
 
+		if err := d.writeBatch(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeBatch executes a BatchWriteItem request. When the table is throttled,
+// either the whole request fails or some of its items are returned as
+// unprocessed; they are retried with an exponential backoff.
+func (d *DynamoDBBackend) writeBatch(batch []*dynamodb.WriteRequest) error {
+	for retries := 0; ; retries++ {
 		d.permitPool.Acquire()
-		_, err := d.client.BatchWriteItem(&dynamodb.BatchWriteItemInput{
+		out, err := d.client.BatchWriteItem(&dynamodb.BatchWriteItemInput{
 			RequestItems: map[string][]*dynamodb.WriteRequest{
 				d.table: batch,
 			},
 		})
 		d.permitPool.Release()
-		if err != nil {
+
+		switch {
+		case err != nil && !isDynamoDBThrottled(err):
 			return err
+		case err == nil && len(out.UnprocessedItems[d.table]) == 0:
+			return nil
+		case err == nil:
+			batch = out.UnprocessedItems[d.table]
 		}
+
+		if retries == DynamoDBThrottleRetryMax {
+			return fmt.Errorf("write throttled after %d retries; consider increasing the write capacity of the table", retries)
+		}
+		metrics.IncrCounter([]string{"dynamodb", "throttled"}, 1)
+		time.Sleep(dynamoDBThrottleBackoff(retries))
 	}
-	return nil
+}
+
+// isDynamoDBThrottled returns whether the error is caused by exceeding the
+// capacity of the table
+func isDynamoDBThrottled(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	switch awsErr.Code() {
+	case dynamodb.ErrCodeProvisionedThroughputExceededException, "ThrottlingException", "RequestLimitExceeded":
+		return true
+	}
+	return false
+}
+
+// dynamoDBThrottleBackoff returns how long to wait before the given retry.
+// Half of the backoff is random, so that concurrent writers don't retry in
+// lockstep.
+func dynamoDBThrottleBackoff(retries int) time.Duration {
+	backoff := DynamoDBThrottleBackoffMax
+	if retries < 16 {
+		if b := DynamoDBThrottleBackoffBase << uint(retries); b < backoff {
+			backoff = b
+		}
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
 }
 
 // Lock tries to acquire the lock by repeatedly trying to create
@@ -670,21 +762,29 @@ WatchLoop:
 	close(lost)
 }
 
+// dynamoDBCreateTableInput is the CreateTable request with the billing mode,
+// which the vendored SDK predates
+type dynamoDBCreateTableInput struct {
+	TableName             *string
+	BillingMode           *string
+	ProvisionedThroughput *dynamodb.ProvisionedThroughput `type:"structure"`
+	KeySchema             []*dynamodb.KeySchemaElement    `type:"list"`
+	AttributeDefinitions  []*dynamodb.AttributeDefinition `type:"list"`
+}
+
 // ensureTableExists creates a DynamoDB table with a given
 // DynamoDB client. If the table already exists, it is not
-// being reconfigured.
-func ensureTableExists(client *dynamodb.DynamoDB, table string, readCapacity, writeCapacity int) error {
+// being reconfigured. The capacity is only set for tables
+// created with the provisioned billing mode.
+func ensureTableExists(client *dynamodb.DynamoDB, table, billingMode string, readCapacity, writeCapacity int) error {
 	_, err := client.DescribeTable(&dynamodb.DescribeTableInput{
 		TableName: aws.String(table),
 	})
 	if awserr, ok := err.(awserr.Error); ok {
 		if awserr.Code() == "ResourceNotFoundException" {
-			_, err = client.CreateTable(&dynamodb.CreateTableInput{
-				TableName: aws.String(table),
-				ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
-					ReadCapacityUnits:  aws.Int64(int64(readCapacity)),
-					WriteCapacityUnits: aws.Int64(int64(writeCapacity)),
-				},
+			input := &dynamoDBCreateTableInput{
+				TableName:   aws.String(table),
+				BillingMode: aws.String(billingMode),
 				KeySchema: []*dynamodb.KeySchemaElement{{
 					AttributeName: aws.String("Path"),
 					KeyType:       aws.String("HASH"),
@@ -699,7 +799,18 @@ func ensureTableExists(client *dynamodb.DynamoDB, table string, readCapacity, wr
 					AttributeName: aws.String("Key"),
 					AttributeType: aws.String("S"),
 				}},
-			})
+			}
+			if billingMode == DynamoDBBillingModeProvisioned {
+				input.ProvisionedThroughput = &dynamodb.ProvisionedThroughput{
+					ReadCapacityUnits:  aws.Int64(int64(readCapacity)),
+					WriteCapacityUnits: aws.Int64(int64(writeCapacity)),
+				}
+			}
+			err = client.NewRequest(&request.Operation{
+				Name:       "CreateTable",
+				HTTPMethod: "POST",
+				HTTPPath:   "/",
+			}, input, &dynamodb.CreateTableOutput{}).Send()
 			if err != nil {
 				return err
 			}
@@ -1,10 +1,13 @@
 package physical
 
 import (
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -118,6 +121,100 @@ func TestDynamoDBHABackend(t *testing.T) {
 // Similar to testHABackend, but using internal implementation details to
 // trigger the lock failure scenario by setting the lock renew period for one
 // of the locks to a higher value than the lock TTL.
+func TestDynamoDBBackend_Throttling(t *testing.T) {
+	defer func(base time.Duration) { DynamoDBThrottleBackoffBase = base }(DynamoDBThrottleBackoffBase)
+	DynamoDBThrottleBackoffBase = time.Millisecond
+
+	var lock sync.Mutex
+	var created map[string]interface{}
+	var batches, throttled int
+	written := map[string]bool{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		var input map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Fatal(err)
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		fail := func(code string) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, `{"__type":"com.amazonaws.dynamodb.v20120810#%s","message":"failed"}`, code)
+		}
+
+		switch r.Header.Get("X-Amz-Target") {
+		case "DynamoDB_20120810.DescribeTable":
+			if created == nil {
+				fail("ResourceNotFoundException")
+				return
+			}
+			fmt.Fprint(w, `{"Table":{"TableStatus":"ACTIVE"}}`)
+		case "DynamoDB_20120810.CreateTable":
+			created = input
+			fmt.Fprint(w, `{}`)
+		case "DynamoDB_20120810.BatchWriteItem":
+			batches++
+			// Throttle the first request, and leave the first item of
+			// the second one unprocessed
+			if batches == 1 {
+				throttled++
+				fail("ProvisionedThroughputExceededException")
+				return
+			}
+			items := input["RequestItems"].(map[string]interface{})["vault"].([]interface{})
+			var unprocessed []interface{}
+			for i, item := range items {
+				if batches == 2 && i == 0 {
+					unprocessed = append(unprocessed, item)
+					continue
+				}
+				put := item.(map[string]interface{})["PutRequest"].(map[string]interface{})["Item"].(map[string]interface{})
+				written[put["Path"].(map[string]interface{})["S"].(string)+"|"+put["Key"].(map[string]interface{})["S"].(string)] = true
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"UnprocessedItems": map[string]interface{}{"vault": unprocessed},
+			})
+		default:
+			t.Fatalf("unexpected target %q", r.Header.Get("X-Amz-Target"))
+		}
+	}))
+	defer server.Close()
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	b, err := NewBackend("dynamodb", logger, map[string]string{
+		"access_key":   "AKIAEXAMPLE",
+		"secret_key":   "secret",
+		"table":        "vault",
+		"endpoint":     server.URL,
+		"billing_mode": "pay_per_request",
+		"max_retries":  "0",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	lock.Lock()
+	if created["BillingMode"] != "PAY_PER_REQUEST" || created["ProvisionedThroughput"] != nil {
+		t.Fatalf("bad create table request: %#v", created)
+	}
+	lock.Unlock()
+
+	if err := b.Put(&Entry{Key: "foo/bar", Value: []byte("baz")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if throttled != 1 || batches != 3 {
+		t.Fatalf("bad: %d throttled, %d batches", throttled, batches)
+	}
+	if !written["foo|bar"] || !written[" |foo/"] {
+		t.Fatalf("bad: %v", written)
+	}
+}
+
 func testDynamoDBLockTTL(t *testing.T, ha HABackend) {
 	// Set much smaller lock times to speed up the test.
 	lockTTL := time.Second * 3
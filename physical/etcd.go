@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/coreos/etcd/client"
+	"github.com/coreos/etcd/pkg/transport"
 	"github.com/coreos/go-semver/semver"
 	log "github.com/mgutz/logxi/v1"
 )
@@ -47,6 +49,20 @@ func newEtcdBackend(conf map[string]string, logger log.Logger) (Backend, error)
 		apiVersion = os.Getenv("ETCD_API")
 	}
 
+	// The data of API v2 is migrated to API v3
+	migrateV2, err := getEtcdMigrateV2(conf)
+	if err != nil {
+		return nil, err
+	}
+	if migrateV2 {
+		switch apiVersion {
+		case "", "3", "etcd3", "v3":
+			apiVersion = "3"
+		default:
+			return nil, errors.New("migrate_v2 requires etcd API v3")
+		}
+	}
+
 	if apiVersion == "" {
 		path, ok := conf["path"]
 		if !ok {
@@ -143,3 +159,38 @@ func getEtcdEndpoints(conf map[string]string) ([]string, error) {
 	// Set a default endpoints list if no option was set
 	return []string{"http://127.0.0.1:2379"}, nil
 }
+
+// getEtcdMigrateV2 returns whether the data written through API v2 must be
+// migrated to API v3
+func getEtcdMigrateV2(conf map[string]string) (bool, error) {
+	migrateV2, ok := getEtcdOption(conf, "migrate_v2", "ETCD_MIGRATE_V2")
+	if !ok || migrateV2 == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(migrateV2)
+	if err != nil {
+		return false, fmt.Errorf("value [%v] of 'migrate_v2' could not be understood", migrateV2)
+	}
+	return b, nil
+}
+
+// getEtcdTLSInfo returns the TLS configuration of the clients, and whether
+// TLS is configured. A bundle file holding both the client certificate, with
+// its chain, and its private key can be given instead of separate files.
+func getEtcdTLSInfo(conf map[string]string) (transport.TLSInfo, bool) {
+	cert, hasCert := conf["tls_cert_file"]
+	key, hasKey := conf["tls_key_file"]
+	if bundle, ok := conf["tls_bundle_file"]; ok {
+		cert, hasCert = bundle, true
+		key, hasKey = bundle, true
+	}
+	ca, hasCa := conf["tls_ca_file"]
+
+	tls := transport.TLSInfo{
+		CAFile:     ca,
+		CertFile:   cert,
+		KeyFile:    key,
+		ServerName: conf["tls_server_name"],
+	}
+	return tls, (hasCert && hasKey) || hasCa
+}
@@ -125,16 +125,8 @@ func newEtcdV2Client(conf map[string]string) (client.Client, error) {
 	// Create a new client from the supplied address and attempt to sync with the
 	// cluster.
 	var cTransport client.CancelableTransport
-	cert, hasCert := conf["tls_cert_file"]
-	key, hasKey := conf["tls_key_file"]
-	ca, hasCa := conf["tls_ca_file"]
-	if (hasCert && hasKey) || hasCa {
+	if tls, ok := getEtcdTLSInfo(conf); ok {
 		var transportErr error
-		tls := transport.TLSInfo{
-			CAFile:   ca,
-			CertFile: cert,
-			KeyFile:  key,
-		}
 		cTransport, transportErr = transport.NewTransport(tls, 30*time.Second)
 
 		if transportErr != nil {
@@ -1,6 +1,7 @@
 package physical
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"os"
@@ -14,7 +15,7 @@ import (
 	"github.com/coreos/etcd/client"
 	"github.com/coreos/etcd/clientv3"
 	"github.com/coreos/etcd/clientv3/concurrency"
-	"github.com/coreos/etcd/pkg/transport"
+	"github.com/hashicorp/vault/helper/parseutil"
 	"github.com/hashicorp/vault/helper/strutil"
 	log "github.com/mgutz/logxi/v1"
 	"golang.org/x/net/context"
@@ -31,10 +32,13 @@ type EtcdBackend struct {
 	permitPool *PermitPool
 
 	etcd *clientv3.Client
+
+	// lockTimeout is the TTL of the leases of the locks
+	lockTimeout time.Duration
 }
 
 // etcd default lease duration is 60s. set to 15s for faster recovery.
-const etcd3LockTimeoutInSeconds = 15
+const etcd3LockTimeout = 15 * time.Second
 
 // newEtcd3Backend constructs a etcd3 backend.
 func newEtcd3Backend(conf map[string]string, logger log.Logger) (Backend, error) {
@@ -70,16 +74,7 @@ func newEtcd3Backend(conf map[string]string, logger log.Logger) (Backend, error)
 		return nil, fmt.Errorf("value [%v] of 'ha_enabled' could not be understood", haEnabled)
 	}
 
-	cert, hasCert := conf["tls_cert_file"]
-	key, hasKey := conf["tls_key_file"]
-	ca, hasCa := conf["tls_ca_file"]
-	if (hasCert && hasKey) || hasCa {
-		tls := transport.TLSInfo{
-			CAFile:   ca,
-			CertFile: cert,
-			KeyFile:  key,
-		}
-
+	if tls, ok := getEtcdTLSInfo(conf); ok {
 		tlscfg, err := tls.ClientConfig()
 		if err != nil {
 			return nil, err
@@ -126,13 +121,40 @@ func newEtcd3Backend(conf map[string]string, logger log.Logger) (Backend, error)
 		}
 	}
 
-	return &EtcdBackend{
-		path:       path,
-		etcd:       etcd,
-		permitPool: NewPermitPool(DefaultParallelOperations),
-		logger:     logger,
-		haEnabled:  haEnabledBool,
-	}, nil
+	lockTimeout := etcd3LockTimeout
+	if lockTimeoutStr, ok := conf["lock_timeout"]; ok {
+		lockTimeout, err = parseutil.ParseDurationSecond(lockTimeoutStr)
+		if err != nil {
+			return nil, fmt.Errorf("value [%v] of 'lock_timeout' could not be understood", lockTimeoutStr)
+		}
+		if lockTimeout < time.Second {
+			return nil, fmt.Errorf("'lock_timeout' must be at least one second")
+		}
+	}
+
+	b := &EtcdBackend{
+		path:        path,
+		etcd:        etcd,
+		permitPool:  NewPermitPool(DefaultParallelOperations),
+		logger:      logger,
+		haEnabled:   haEnabledBool,
+		lockTimeout: lockTimeout,
+	}
+
+	migrateV2, err := getEtcdMigrateV2(conf)
+	if err != nil {
+		return nil, err
+	}
+	if migrateV2 {
+		v2, err := newEtcdV2Client(conf)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.migrateV2(client.NewKeysAPI(v2)); err != nil {
+			return nil, fmt.Errorf("failed to migrate etcd v2 data: %v", err)
+		}
+	}
+	return b, nil
 }
 
 func (c *EtcdBackend) Put(entry *Entry) error {
@@ -187,7 +209,7 @@ func (c *EtcdBackend) List(prefix string) ([]string, error) {
 	c.permitPool.Acquire()
 	defer c.permitPool.Release()
 
-	prefix = path.Join(c.path, prefix)
+	prefix = c.keyPrefix() + prefix
 	resp, err := c.etcd.Get(context.Background(), prefix, clientv3.WithPrefix())
 	if err != nil {
 		return nil, err
@@ -196,7 +218,6 @@ func (c *EtcdBackend) List(prefix string) ([]string, error) {
 	keys := []string{}
 	for _, kv := range resp.Kvs {
 		key := strings.TrimPrefix(string(kv.Key), prefix)
-		key = strings.TrimPrefix(key, "/")
 
 		if len(key) == 0 {
 			continue
@@ -215,7 +236,17 @@ func (e *EtcdBackend) HAEnabled() bool {
 	return e.haEnabled
 }
 
+// keyPrefix returns the prefix of the keys of the entries
+func (c *EtcdBackend) keyPrefix() string {
+	return strings.TrimSuffix(c.path, "/") + "/"
+}
+
 // EtcdLock emplements a lock using and etcd backend.
+//
+// The lock is a key attached to a lease, which is kept alive by the session
+// of the lock while it is held. If the keepalives stop, such as when the
+// instance is partitioned from etcd, the lease expires and the lock is
+// released.
 type EtcdLock struct {
 	lock sync.Mutex
 	held bool
@@ -225,24 +256,18 @@ type EtcdLock struct {
 
 	prefix string
 	value  string
+	ttl    time.Duration
 
 	etcd *clientv3.Client
 }
 
 // Lock is used for mutual exclusion based on the given key.
 func (c *EtcdBackend) LockWith(key, value string) (Lock, error) {
-	session, err := concurrency.NewSession(c.etcd, concurrency.WithTTL(etcd3LockTimeoutInSeconds))
-	if err != nil {
-		return nil, err
-	}
-
-	p := path.Join(c.path, key)
 	return &EtcdLock{
-		etcdSession: session,
-		etcdMu:      concurrency.NewMutex(session, p),
-		prefix:      p,
-		value:       value,
-		etcd:        c.etcd,
+		prefix: path.Join(c.path, key),
+		value:  value,
+		ttl:    c.lockTimeout,
+		etcd:   c.etcd,
 	}, nil
 }
 
@@ -254,24 +279,40 @@ func (c *EtcdLock) Lock(stopCh <-chan struct{}) (<-chan struct{}, error) {
 		return nil, EtcdLockHeldError
 	}
 
+	// Each acquisition has a lease of its own, as the lease is revoked when
+	// the lock is released
+	session, err := concurrency.NewSession(c.etcd, concurrency.WithTTL(int(c.ttl/time.Second)))
+	if err != nil {
+		return nil, err
+	}
+	mu := concurrency.NewMutex(session, c.prefix)
+
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	go func() {
-		<-stopCh
-		cancel()
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
 	}()
-	if err := c.etcdMu.Lock(ctx); err != nil {
+	if err := mu.Lock(ctx); err != nil {
+		session.Close()
 		if err == context.Canceled {
 			return nil, nil
 		}
 		return nil, err
 	}
-	if _, err := c.etcd.Put(ctx, c.etcdMu.Key(), c.value, clientv3.WithLease(c.etcdSession.Lease())); err != nil {
+	if _, err := c.etcd.Put(ctx, mu.Key(), c.value, clientv3.WithLease(session.Lease())); err != nil {
+		session.Close()
 		return nil, err
 	}
 
 	c.held = true
+	c.etcdSession = session
+	c.etcdMu = mu
 
-	return c.etcdSession.Done(), nil
+	return session.Done(), nil
 }
 
 func (c *EtcdLock) Unlock() error {
@@ -282,12 +323,20 @@ func (c *EtcdLock) Unlock() error {
 		return EtcdLockNotHeldError
 	}
 
-	return c.etcdMu.Unlock(context.Background())
+	c.held = false
+	err := c.etcdMu.Unlock(context.Background())
+
+	// Revoking the lease stops the keepalives, and deletes the lock key if
+	// it couldn't be deleted
+	if closeErr := c.etcdSession.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
 
 func (c *EtcdLock) Value() (bool, string, error) {
 	resp, err := c.etcd.Get(context.Background(),
-		c.prefix, clientv3.WithPrefix(),
+		c.prefix+"/", clientv3.WithPrefix(),
 		clientv3.WithSort(clientv3.SortByCreateRevision, clientv3.SortAscend))
 
 	if err != nil {
@@ -299,3 +348,114 @@ func (c *EtcdLock) Value() (bool, string, error) {
 
 	return true, string(resp.Kvs[0].Value), nil
 }
+
+const (
+	// etcd3MigrationInProgress and etcd3MigrationComplete are the values of
+	// the key recording the state of the migration of the v2 data
+	etcd3MigrationInProgress = "in-progress"
+	etcd3MigrationComplete   = "complete"
+
+	// etcd3MaxTxnOps is the default limit of the operations of a transaction
+	etcd3MaxTxnOps = 128
+)
+
+// migrationKey returns the key recording the state of the migration of the
+// v2 data. It is outside of the prefix of the entries, so that it isn't
+// listed.
+func (c *EtcdBackend) migrationKey() string {
+	return strings.TrimSuffix(c.path, "/") + ".v2-migration"
+}
+
+// migrateV2 copies the entries written through API v2 under the path of the
+// backend to the API v3 keyspace, which is separate in etcd 3. The migration
+// runs once: its completion is recorded, and an interrupted migration is
+// started over the next time. The v2 data is left as is.
+func (c *EtcdBackend) migrateV2(kAPI client.KeysAPI) error {
+	ctx := context.Background()
+
+	resp, err := c.etcd.Get(ctx, c.migrationKey())
+	if err != nil {
+		return err
+	}
+	state := ""
+	if len(resp.Kvs) != 0 {
+		state = string(resp.Kvs[0].Value)
+	}
+	if state == etcd3MigrationComplete {
+		return nil
+	}
+
+	// Unless resuming, refuse to overwrite the data written through API v3
+	if state == "" {
+		resp, err := c.etcd.Get(ctx, c.keyPrefix(), clientv3.WithPrefix(), clientv3.WithCountOnly())
+		if err != nil {
+			return err
+		}
+		if resp.Count != 0 {
+			return fmt.Errorf("path %q already holds etcd v3 data", c.path)
+		}
+	}
+
+	v2Resp, err := kAPI.Get(ctx, c.path, &client.GetOptions{Recursive: true})
+	if err != nil && !errorIsMissingKey(err) {
+		return err
+	}
+
+	var ops []clientv3.Op
+	if err == nil {
+		if _, err := c.etcd.Put(ctx, c.migrationKey(), etcd3MigrationInProgress); err != nil {
+			return err
+		}
+		c.logger.Info("etcd: migrating v2 data", "path", c.path)
+		ops, err = c.migrationOps(v2Resp.Node, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	for len(ops) > 0 {
+		n := len(ops)
+		if n > etcd3MaxTxnOps {
+			n = etcd3MaxTxnOps
+		}
+		if _, err := c.etcd.Txn(ctx).Then(ops[:n]...).Commit(); err != nil {
+			return err
+		}
+		ops = ops[n:]
+	}
+
+	if _, err := c.etcd.Put(ctx, c.migrationKey(), etcd3MigrationComplete); err != nil {
+		return err
+	}
+	if state != "" || v2Resp != nil {
+		c.logger.Info("etcd: v2 data migrated", "path", c.path)
+	}
+	return nil
+}
+
+// migrationOps returns the puts copying the v2 entries of the directory,
+// whose key relative to the path of the backend is dir. The lock
+// directories are skipped.
+func (c *EtcdBackend) migrationOps(node *client.Node, dir string) ([]clientv3.Op, error) {
+	var ops []clientv3.Op
+	for _, child := range node.Nodes {
+		name := path.Base(child.Key)
+		switch {
+		case child.Dir && strings.HasPrefix(name, Etcd2NodeLockPrefix):
+		case child.Dir:
+			childOps, err := c.migrationOps(child, dir+name+"/")
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, childOps...)
+		case strings.HasPrefix(name, Etcd2NodeFilePrefix):
+			value, err := base64.StdEncoding.DecodeString(child.Value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode %q: %v", child.Key, err)
+			}
+			key := dir + strings.TrimPrefix(name, Etcd2NodeFilePrefix)
+			ops = append(ops, clientv3.OpPut(path.Join(c.path, key), string(value)))
+		}
+	}
+	return ops, nil
+}
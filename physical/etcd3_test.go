@@ -35,3 +35,91 @@ func TestEtcd3Backend(t *testing.T) {
 	}
 	testHABackend(t, ha, ha)
 }
+
+func TestEtcd3Backend_MigrateV2(t *testing.T) {
+	addr := os.Getenv("ETCD_ADDR")
+	if addr == "" {
+		t.Skipf("Skipped. No etcd3 server found")
+	}
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	conf := map[string]string{
+		"path":     fmt.Sprintf("/vault-migrate-%d", time.Now().Unix()),
+		"etcd_api": "2",
+	}
+
+	// Write entries and a lock through API v2
+	v2, err := NewBackend("etcd", logger, conf)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, key := range []string{"foo", "bar/baz", "bar/qux/quux"} {
+		if err := v2.Put(&Entry{Key: key, Value: []byte(key)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lock, err := v2.(HABackend).LockWith("core/lock", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lock.Lock(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Unlock()
+
+	// The entries are copied to API v3, without the lock
+	delete(conf, "etcd_api")
+	conf["migrate_v2"] = "true"
+	v3, err := NewBackend("etcd", logger, conf)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, key := range []string{"foo", "bar/baz", "bar/qux/quux"} {
+		entry, err := v3.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry == nil || string(entry.Value) != key {
+			t.Fatalf("bad entry for %q: %#v", key, entry)
+		}
+	}
+	keys, err := v3.List("core/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	// The migration runs once, so the v3 data isn't overwritten
+	if err := v3.Put(&Entry{Key: "foo", Value: []byte("new")}); err != nil {
+		t.Fatal(err)
+	}
+	v3, err = NewBackend("etcd", logger, conf)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if entry, err := v3.Get("foo"); err != nil || string(entry.Value) != "new" {
+		t.Fatalf("bad: %#v %v", entry, err)
+	}
+}
+
+func TestGetEtcdTLSInfo(t *testing.T) {
+	if _, ok := getEtcdTLSInfo(map[string]string{"tls_cert_file": "cert.pem"}); ok {
+		t.Fatal("expected TLS not to be configured without a key")
+	}
+
+	bundle := "/etc/vault/etcd-client.pem"
+
+	// The bundle holds both the certificate and the key
+	info, ok := getEtcdTLSInfo(map[string]string{
+		"tls_bundle_file": bundle,
+		"tls_server_name": "etcd.example.com",
+	})
+	if !ok {
+		t.Fatal("expected TLS to be configured")
+	}
+	if info.CertFile != bundle || info.KeyFile != bundle || info.ServerName != "etcd.example.com" {
+		t.Fatalf("bad: %#v", info)
+	}
+}
@@ -1,11 +1,15 @@
 package physical
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
 
@@ -19,9 +23,10 @@ import (
 // at a given file path. It can be used for durable single server
 // situations, or to develop locally where durability is not critical.
 //
-// WARNING: the file backend implementation is currently extremely unsafe
-// and non-performant. It is meant mostly for local testing and development.
-// It can be improved in the future.
+// Entries are written to a temporary file which is synced and then renamed
+// over the entry, so that a crash leaves either the previous or the new
+// version of the entry, never a truncated one. Each entry holds a checksum of
+// its value, verified when it is read.
 type FileBackend struct {
 	sync.RWMutex
 	path       string
@@ -33,6 +38,23 @@ type TransactionalFileBackend struct {
 	FileBackend
 }
 
+// fileEntry is the format of the entries on disk. The entries written before
+// the checksums were introduced don't have one.
+type fileEntry struct {
+	*Entry
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// fileEntryChecksum returns the checksum of the value of an entry
+func fileEntryChecksum(entry *Entry) string {
+	sum := sha256.Sum256(entry.Value)
+	return hex.EncodeToString(sum[:])
+}
+
+// fileTempPrefix prefixes the names of the temporary files, so that they are
+// not listed
+const fileTempPrefix = "."
+
 // newFileBackend constructs a FileBackend using the given directory
 func newFileBackend(conf map[string]string, logger log.Logger) (Backend, error) {
 	path, ok := conf["path"]
@@ -89,6 +111,11 @@ func (b *FileBackend) DeleteInternal(path string) error {
 	if err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("Failed to remove %q: %v", fullPath, err)
 	}
+	if err == nil {
+		if err := syncDir(basePath); err != nil {
+			return err
+		}
+	}
 
 	err = b.cleanupLogicalPath(path)
 
@@ -126,6 +153,9 @@ func (b *FileBackend) cleanupLogicalPath(path string) error {
 			if err != nil {
 				return err
 			}
+			if err := syncDir(filepath.Dir(fullPath)); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -163,8 +193,12 @@ func (b *FileBackend) GetInternal(k string) (*Entry, error) {
 	}
 
 	var entry Entry
-	if err := jsonutil.DecodeJSONFromReader(f, &entry); err != nil {
-		return nil, err
+	stored := fileEntry{Entry: &entry}
+	if err := jsonutil.DecodeJSONFromReader(f, &stored); err != nil {
+		return nil, fmt.Errorf("failed to decode entry %q: %v", k, err)
+	}
+	if stored.Checksum != "" && stored.Checksum != fileEntryChecksum(&entry) {
+		return nil, fmt.Errorf("checksum mismatch for entry %q", k)
 	}
 
 	return &entry, nil
@@ -188,23 +222,80 @@ func (b *FileBackend) PutInternal(entry *Entry) error {
 	path, key := b.expandPath(entry.Key)
 
 	// Make the parent tree
+	if err := b.mkdirAll(path); err != nil {
+		return err
+	}
+
+	// JSON encode the entry and write it to a temporary file, which is only
+	// renamed over the entry once synced to the disk
+	f, err := ioutil.TempFile(path, fileTempPrefix+key)
+	if err != nil {
+		return err
+	}
+	tempPath := f.Name()
+	err = json.NewEncoder(f).Encode(&fileEntry{
+		Entry:    entry,
+		Checksum: fileEntryChecksum(entry),
+	})
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempPath, filepath.Join(path, key))
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	// Sync the directory for the rename to be durable
+	return syncDir(path)
+}
+
+// mkdirAll creates the directory and its missing parents, syncing the parent
+// of each created directory for it to be durable
+func (b *FileBackend) mkdirAll(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	var created []string
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil || dir == filepath.Dir(dir) {
+			break
+		}
+		created = append(created, dir)
+	}
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return err
 	}
+	for _, dir := range created {
+		if err := syncDir(filepath.Dir(dir)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	// JSON encode the entry and write it
-	f, err := os.OpenFile(
-		filepath.Join(path, key),
-		os.O_CREATE|os.O_TRUNC|os.O_WRONLY,
-		0600)
-	if f != nil {
-		defer f.Close()
+// syncDir syncs a directory, so that the creations, renames and removals of
+// its entries are durable. Directories can't be synced on Windows.
+func syncDir(path string) error {
+	if runtime.GOOS == "windows" {
+		return nil
 	}
+
+	dir, err := os.Open(path)
 	if err != nil {
 		return err
 	}
-	enc := json.NewEncoder(f)
-	return enc.Encode(entry)
+	defer dir.Close()
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory %q: %v", path, err)
+	}
+	return nil
 }
 
 func (b *FileBackend) List(prefix string) ([]string, error) {
@@ -245,15 +336,19 @@ func (b *FileBackend) ListInternal(prefix string) ([]string, error) {
 		return nil, err
 	}
 
-	for i, name := range names {
-		if name[0] == '_' {
-			names[i] = name[1:]
-		} else {
-			names[i] = name + "/"
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		switch {
+		case strings.HasPrefix(name, fileTempPrefix):
+			// Skip the temporary files of interrupted writes
+		case name[0] == '_':
+			keys = append(keys, name[1:])
+		default:
+			keys = append(keys, name+"/")
 		}
 	}
 
-	return names, nil
+	return keys, nil
 }
 
 func (b *FileBackend) expandPath(k string) (string, string) {
@@ -174,3 +174,70 @@ func TestFileBackend(t *testing.T) {
 	testBackend(t, b)
 	testBackend_ListPrefix(t, b)
 }
+
+func TestFileBackend_Durability(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	b, err := NewBackend("file", logger, map[string]string{
+		"path": dir,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	e := &Entry{Key: "foo/bar", Value: []byte("test")}
+	if err := b.Put(e); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// No temporary file is left behind
+	names, err := filepath.Glob(filepath.Join(dir, "foo", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || filepath.Base(names[0]) != "_bar" {
+		t.Fatalf("bad: %v", names)
+	}
+
+	// The temporary files of interrupted writes are not listed
+	if err := ioutil.WriteFile(filepath.Join(dir, "foo", "._baz123"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := b.List("foo/")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"bar"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	// A corrupted value is detected by its checksum
+	data, err := ioutil.ReadFile(names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored map[string]interface{}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored["checksum"] == nil {
+		t.Fatalf("expected a checksum: %s", data)
+	}
+	stored["Value"] = "dGVzdDI="
+	data, err = json.Marshal(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(names[0], data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Get("foo/bar"); err == nil {
+		t.Fatal("expected a checksum error")
+	}
+}
@@ -0,0 +1,572 @@
+// +build foundationdb
+
+package physical
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
+	uuid "github.com/hashicorp/go-uuid"
+	log "github.com/mgutz/logxi/v1"
+)
+
+const (
+	// FoundationDBLockTTL is how long a lock is valid without being renewed.
+	FoundationDBLockTTL = 15 * time.Second
+
+	// FoundationDBLockRenewInterval is the amount of time to wait between the
+	// renewals of a held lock.
+	FoundationDBLockRenewInterval = 5 * time.Second
+
+	// FoundationDBLockRetryInterval is the amount of time to wait if a lock
+	// fails to be acquired before trying again.
+	FoundationDBLockRetryInterval = time.Second
+
+	// FoundationDBDefaultAPIVersion is the API version selected when none is
+	// configured
+	FoundationDBDefaultAPIVersion = 520
+
+	// FoundationDBValueChunkSize is the largest value FoundationDB stores in
+	// a single key; larger values are split over several keys.
+	FoundationDBValueChunkSize = 100000
+
+	// FoundationDBTransactionSizeLimit is the largest amount of data
+	// FoundationDB accepts in a transaction.
+	FoundationDBTransactionSizeLimit = 10000000
+
+	// foundationDBListBatchSize is the number of keys read per transaction
+	// when listing, as a transaction may not run longer than five seconds
+	foundationDBListBatchSize = 1000
+
+	// foundationDBVersionsPerSecond is the rate at which the versions of the
+	// database advance
+	foundationDBVersionsPerSecond = 1000000
+
+	// foundationDBTransactionTimeout bounds the retries of a transaction
+	foundationDBTransactionTimeout = 30 * time.Second
+)
+
+// FoundationDBBackend is a physical backend that stores data in a
+// FoundationDB cluster.
+//
+// The entries are stored under the data subspace of the configured path,
+// followed by the Vault key, a NUL byte and the index of the chunk of the
+// value, so that the chunks of an entry are contiguous and the keys can be
+// listed by skipping over the directories.
+type FoundationDBBackend struct {
+	db         fdb.Database
+	dataPrefix []byte
+	lockSpace  subspace.Subspace
+
+	haEnabled  bool
+	permitPool *PermitPool
+	logger     log.Logger
+}
+
+// FoundationDBLock is a lock held by writing a key in the lock subspace. The
+// expiration of a lock is computed from the versions of the database rather
+// than from the clocks of the instances.
+type FoundationDBLock struct {
+	backend    *FoundationDBBackend
+	value, key string
+	identity   string
+
+	lock sync.Mutex
+	held bool
+
+	// stopCh stops renewing the lock when it is released
+	stopCh chan struct{}
+
+	// Allow modifying the Lock durations for ease of unit testing.
+	renewInterval time.Duration
+	retryInterval time.Duration
+	ttl           time.Duration
+}
+
+// foundationDBLockRecord is the value of a lock key
+type foundationDBLockRecord struct {
+	Identity string `json:"identity"`
+	Value    string `json:"value"`
+
+	// Version is the read version of the transaction which last wrote the
+	// lock
+	Version int64 `json:"version"`
+}
+
+// newFoundationDBBackend constructs a FoundationDB backend using the cluster
+// file given in the configuration, or the default cluster file.
+func newFoundationDBBackend(conf map[string]string, logger log.Logger) (Backend, error) {
+	apiVersion := FoundationDBDefaultAPIVersion
+	if apiVersionStr, ok := conf["api_version"]; ok {
+		var err error
+		apiVersion, err = strconv.Atoi(apiVersionStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing api_version parameter: {{err}}", err)
+		}
+	}
+	if err := fdb.APIVersion(apiVersion); err != nil {
+		return nil, errwrap.Wrapf("failed to select FoundationDB API version: {{err}}", err)
+	}
+
+	clusterFile := os.Getenv("FOUNDATIONDB_CLUSTER_FILE")
+	if clusterFile == "" {
+		clusterFile = conf["cluster_file"]
+	}
+
+	path := conf["path"]
+	if path == "" {
+		path = "vault"
+	}
+
+	haEnabled := false
+	haEnabledStr := os.Getenv("FOUNDATIONDB_HA_ENABLED")
+	if haEnabledStr == "" {
+		haEnabledStr = conf["ha_enabled"]
+	}
+	if haEnabledStr != "" {
+		var err error
+		haEnabled, err = strconv.ParseBool(haEnabledStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing ha_enabled parameter: {{err}}", err)
+		}
+	}
+
+	db, err := fdb.OpenDatabase(clusterFile)
+	if err != nil {
+		return nil, fmt.Errorf("error opening FoundationDB database: '%v'", err)
+	}
+	if err := db.Options().SetTransactionTimeout(int64(foundationDBTransactionTimeout / time.Millisecond)); err != nil {
+		return nil, fmt.Errorf("error setting FoundationDB transaction timeout: '%v'", err)
+	}
+
+	maxParStr, ok := conf["max_parallel"]
+	var maxParInt int
+	if ok {
+		maxParInt, err = strconv.Atoi(maxParStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing max_parallel parameter: {{err}}", err)
+		}
+		if logger.IsDebug() {
+			logger.Debug("physical/foundationdb: max_parallel set", "max_parallel", maxParInt)
+		}
+	}
+
+	root := subspace.Sub(path)
+	f := &FoundationDBBackend{
+		db:         db,
+		dataPrefix: root.Sub("data").Bytes(),
+		lockSpace:  root.Sub("lock"),
+		haEnabled:  haEnabled,
+		permitPool: NewPermitPool(maxParInt),
+		logger:     logger,
+	}
+
+	// Check the access to the cluster
+	if _, err := f.Get("core/foundationdb-check"); err != nil {
+		return nil, fmt.Errorf("unable to access FoundationDB cluster: '%v'", err)
+	}
+	return f, nil
+}
+
+// entryRange returns the range of the keys holding the chunks of an entry
+func (f *FoundationDBBackend) entryRange(key string) fdb.KeyRange {
+	begin := make([]byte, 0, len(f.dataPrefix)+len(key)+1)
+	begin = append(append(begin, f.dataPrefix...), key...)
+	end := append(begin[:len(begin):len(begin)], 0x01)
+	begin = append(begin, 0x00)
+	return fdb.KeyRange{Begin: fdb.Key(begin), End: fdb.Key(end)}
+}
+
+// chunkKey returns the key holding a chunk of an entry
+func (f *FoundationDBBackend) chunkKey(key string, index int) fdb.Key {
+	k := f.entryRange(key).Begin.(fdb.Key)
+	var suffix [2]byte
+	binary.BigEndian.PutUint16(suffix[:], uint16(index))
+	return append(k, suffix[:]...)
+}
+
+// checkFoundationDBKey returns an error if the key can't be stored, as the
+// NUL byte separates the key from the index of the chunks
+func checkFoundationDBKey(key string) error {
+	if strings.IndexByte(key, 0) != -1 {
+		return fmt.Errorf("key '%v' contains a NUL byte", key)
+	}
+	return nil
+}
+
+// entrySize returns the amount of data written to store an entry
+func (f *FoundationDBBackend) entrySize(entry *Entry) int {
+	chunks := len(entry.Value)/FoundationDBValueChunkSize + 1
+	return len(entry.Value) + chunks*(len(f.dataPrefix)+len(entry.Key)+3)
+}
+
+// setEntry writes the entry in the transaction, replacing its previous
+// chunks
+func (f *FoundationDBBackend) setEntry(tr fdb.Transaction, entry *Entry) {
+	tr.ClearRange(f.entryRange(entry.Key))
+
+	value := entry.Value
+	for index := 0; index == 0 || len(value) > 0; index++ {
+		n := len(value)
+		if n > FoundationDBValueChunkSize {
+			n = FoundationDBValueChunkSize
+		}
+		tr.Set(f.chunkKey(entry.Key, index), value[:n])
+		value = value[n:]
+	}
+}
+
+// Put is used to insert or update an entry
+func (f *FoundationDBBackend) Put(entry *Entry) error {
+	defer metrics.MeasureSince([]string{"foundationdb", "put"}, time.Now())
+
+	return f.Transaction([]TxnEntry{{Operation: PutOperation, Entry: entry}})
+}
+
+// Get is used to fetch an entry
+func (f *FoundationDBBackend) Get(key string) (*Entry, error) {
+	defer metrics.MeasureSince([]string{"foundationdb", "get"}, time.Now())
+
+	f.permitPool.Acquire()
+	defer f.permitPool.Release()
+
+	value, err := f.db.ReadTransact(func(tr fdb.ReadTransaction) (interface{}, error) {
+		chunks, err := tr.GetRange(f.entryRange(key), fdb.RangeOptions{
+			Mode: fdb.StreamingModeWantAll,
+		}).GetSliceWithError()
+		if err != nil || len(chunks) == 0 {
+			return nil, err
+		}
+
+		var value []byte
+		for _, chunk := range chunks {
+			value = append(value, chunk.Value...)
+		}
+		return value, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading '%v': '%v'", key, err)
+	}
+	if value == nil {
+		return nil, nil
+	}
+	return &Entry{
+		Key:   key,
+		Value: value.([]byte),
+	}, nil
+}
+
+// Delete is used to permanently delete an entry
+func (f *FoundationDBBackend) Delete(key string) error {
+	defer metrics.MeasureSince([]string{"foundationdb", "delete"}, time.Now())
+
+	return f.Transaction([]TxnEntry{{Operation: DeleteOperation, Entry: &Entry{Key: key}}})
+}
+
+// List is used to list all the keys under a given
+// prefix, up to the next prefix.
+//
+// The keys are read in batches, each in its own transaction. After a
+// directory, the reads start past all of its keys, so that listing doesn't
+// read the entries of the directories.
+func (f *FoundationDBBackend) List(prefix string) ([]string, error) {
+	defer metrics.MeasureSince([]string{"foundationdb", "list"}, time.Now())
+
+	f.permitPool.Acquire()
+	defer f.permitPool.Release()
+
+	listPrefix := append(append([]byte{}, f.dataPrefix...), prefix...)
+	end, err := fdb.Strinc(listPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	begin := listPrefix
+	for {
+		batch, err := f.db.ReadTransact(func(tr fdb.ReadTransaction) (interface{}, error) {
+			return tr.GetRange(fdb.KeyRange{Begin: fdb.Key(begin), End: fdb.Key(end)}, fdb.RangeOptions{
+				Limit: foundationDBListBatchSize,
+				Mode:  fdb.StreamingModeWantAll,
+			}).GetSliceWithError()
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error listing '%v': '%v'", prefix, err)
+		}
+
+		kvs := batch.([]fdb.KeyValue)
+		for _, kv := range kvs {
+			if bytes.Compare(kv.Key, begin) < 0 {
+				continue
+			}
+
+			name := kv.Key[len(listPrefix):]
+			name = name[:bytes.IndexByte(name, 0)]
+			if i := bytes.IndexByte(name, '/'); i != -1 {
+				// Skip to the key following the directory
+				keys = append(keys, string(name[:i+1]))
+				begin = append(append([]byte{}, listPrefix...), name[:i]...)
+				begin = append(begin, '/'+1)
+			} else {
+				// Skip the other chunks of the entry
+				keys = append(keys, string(name))
+				begin = append(append([]byte{}, listPrefix...), name...)
+				begin = append(begin, 0x01)
+			}
+		}
+		if len(kvs) < foundationDBListBatchSize {
+			return keys, nil
+		}
+	}
+}
+
+// Transaction applies the operations in a single FoundationDB transaction.
+// FoundationDB limits the size of a transaction, so that the operations
+// can't be larger than FoundationDBTransactionSizeLimit.
+func (f *FoundationDBBackend) Transaction(txns []TxnEntry) error {
+	defer metrics.MeasureSince([]string{"foundationdb", "transaction"}, time.Now())
+	if len(txns) == 0 {
+		return nil
+	}
+
+	size := 0
+	for _, txn := range txns {
+		if err := checkFoundationDBKey(txn.Entry.Key); err != nil {
+			return err
+		}
+		switch txn.Operation {
+		case PutOperation:
+			size += f.entrySize(txn.Entry)
+		case DeleteOperation:
+			size += 2 * (len(f.dataPrefix) + len(txn.Entry.Key) + 1)
+		default:
+			return fmt.Errorf("unsupported transaction operation: %q", txn.Operation)
+		}
+	}
+	if size > FoundationDBTransactionSizeLimit {
+		return fmt.Errorf("transaction of %d bytes exceeds the limit of %d bytes", size, FoundationDBTransactionSizeLimit)
+	}
+
+	f.permitPool.Acquire()
+	defer f.permitPool.Release()
+
+	_, err := f.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		for _, txn := range txns {
+			if txn.Operation == PutOperation {
+				f.setEntry(tr, txn.Entry)
+			} else {
+				tr.ClearRange(f.entryRange(txn.Entry.Key))
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error committing transaction: '%v'", err)
+	}
+	return nil
+}
+
+// LockWith is used for mutual exclusion based on the given key.
+func (f *FoundationDBBackend) LockWith(key, value string) (Lock, error) {
+	identity, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	return &FoundationDBLock{
+		backend:       f,
+		key:           key,
+		value:         value,
+		identity:      identity,
+		renewInterval: FoundationDBLockRenewInterval,
+		retryInterval: FoundationDBLockRetryInterval,
+		ttl:           FoundationDBLockTTL,
+	}, nil
+}
+
+// HAEnabled indicates whether the HA functionality should be exposed.
+func (f *FoundationDBBackend) HAEnabled() bool {
+	return f.haEnabled
+}
+
+// Lock tries to acquire the lock by repeatedly trying to create or take over
+// the lock key. It blocks until either the stop channel is closed or the
+// lock is acquired. The returned channel is closed once the lock is lost.
+func (l *FoundationDBLock) Lock(stopCh <-chan struct{}) (<-chan struct{}, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.held {
+		return nil, fmt.Errorf("lock already held")
+	}
+
+	ticker := time.NewTicker(l.retryInterval)
+	defer ticker.Stop()
+	for {
+		acquired, err := l.writeLock()
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			break
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return nil, nil
+		}
+	}
+
+	l.held = true
+	l.stopCh = make(chan struct{})
+	leaderCh := make(chan struct{})
+	go l.periodicallyRenewLock(leaderCh, l.stopCh)
+	return leaderCh, nil
+}
+
+// Unlock releases the lock by clearing the lock key, unless another instance
+// took it over meanwhile.
+func (l *FoundationDBLock) Unlock() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.held {
+		return nil
+	}
+
+	l.held = false
+	close(l.stopCh)
+
+	_, err := l.backend.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		record, _, err := l.readLock(tr)
+		if err != nil || record == nil || record.Identity != l.identity {
+			return nil, err
+		}
+		tr.Clear(l.backend.lockSpace.Pack(tuple.Tuple{l.key}))
+		return nil, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error releasing lock '%v': '%v'", l.key, err)
+	}
+	return nil
+}
+
+// Value checks whether or not the lock is held by any instance of
+// FoundationDBLock, including this one, and returns the current value.
+func (l *FoundationDBLock) Value() (bool, string, error) {
+	record, err := l.backend.db.ReadTransact(func(tr fdb.ReadTransaction) (interface{}, error) {
+		record, expired, err := l.readLock(tr)
+		if err != nil || record == nil || expired {
+			return (*foundationDBLockRecord)(nil), err
+		}
+		return record, nil
+	})
+	if err != nil {
+		return false, "", err
+	}
+	if record := record.(*foundationDBLockRecord); record != nil {
+		return true, record.Value, nil
+	}
+	return false, "", nil
+}
+
+// readLock reads the lock record, and returns whether it expired at the
+// read version of the transaction
+func (l *FoundationDBLock) readLock(tr fdb.ReadTransaction) (*foundationDBLockRecord, bool, error) {
+	data, err := tr.Get(l.backend.lockSpace.Pack(tuple.Tuple{l.key})).Get()
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading lock '%v': '%v'", l.key, err)
+	}
+	if data == nil {
+		return nil, false, nil
+	}
+
+	record := new(foundationDBLockRecord)
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, false, fmt.Errorf("error decoding lock '%v': '%v'", l.key, err)
+	}
+	version, err := tr.GetReadVersion().Get()
+	if err != nil {
+		return nil, false, err
+	}
+	expired := version-record.Version >= int64(l.ttl.Seconds()*foundationDBVersionsPerSecond)
+	return record, expired, nil
+}
+
+// writeLock creates the lock, takes it over if it expired, or renews it if
+// it is already held by this instance. It returns false if another instance
+// holds the lock.
+func (l *FoundationDBLock) writeLock() (bool, error) {
+	acquired, err := l.backend.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		record, expired, err := l.readLock(tr)
+		if err != nil {
+			return false, err
+		}
+		if record != nil && record.Identity != l.identity && !expired {
+			return false, nil
+		}
+
+		version, err := tr.GetReadVersion().Get()
+		if err != nil {
+			return false, err
+		}
+		data, err := json.Marshal(&foundationDBLockRecord{
+			Identity: l.identity,
+			Value:    l.value,
+			Version:  version,
+		})
+		if err != nil {
+			return false, err
+		}
+		tr.Set(l.backend.lockSpace.Pack(tuple.Tuple{l.key}), data)
+		return true, nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("error writing lock '%v': '%v'", l.key, err)
+	}
+	return acquired.(bool), nil
+}
+
+// periodicallyRenewLock renews the lock until it is released, and closes the
+// leader channel when it is lost: either taken over by another instance, or
+// not renewed in time because of errors.
+func (l *FoundationDBLock) periodicallyRenewLock(leaderCh, stopCh chan struct{}) {
+	defer close(leaderCh)
+
+	ticker := time.NewTicker(l.renewInterval)
+	defer ticker.Stop()
+
+	lastRenewal := time.Now()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		acquired, err := l.writeLock()
+		switch {
+		case err != nil:
+			l.backend.logger.Warn("physical/foundationdb: failed to renew lock", "key", l.key, "error", err)
+			if time.Since(lastRenewal) < l.ttl {
+				continue
+			}
+			l.backend.logger.Error("physical/foundationdb: lock expired", "key", l.key)
+			return
+		case !acquired:
+			l.backend.logger.Error("physical/foundationdb: lock taken over by another instance", "key", l.key)
+			return
+		}
+		lastRenewal = time.Now()
+	}
+}
@@ -0,0 +1,196 @@
+// +build foundationdb
+
+package physical
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/hashicorp/vault/helper/logformat"
+	log "github.com/mgutz/logxi/v1"
+)
+
+// testFoundationDBBackend returns a backend using a path of its own in the
+// cluster given by FOUNDATIONDB_CLUSTER_FILE, and a function clearing it
+func testFoundationDBBackend(t *testing.T) (*FoundationDBBackend, func()) {
+	if os.Getenv("FOUNDATIONDB_CLUSTER_FILE") == "" {
+		t.SkipNow()
+	}
+
+	path := fmt.Sprintf("vault-test-%d", time.Now().UnixNano())
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	b, err := NewBackend("foundationdb", logger, map[string]string{
+		"path":       path,
+		"ha_enabled": "true",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create new backend: %v", err)
+	}
+	f := b.(*FoundationDBBackend)
+
+	return f, func() {
+		_, err := f.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+			for _, prefix := range [][]byte{f.dataPrefix, f.lockSpace.Bytes()} {
+				end, err := fdb.Strinc(prefix)
+				if err != nil {
+					return nil, err
+				}
+				tr.ClearRange(fdb.KeyRange{Begin: fdb.Key(prefix), End: fdb.Key(end)})
+			}
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to clear test path: %v", err)
+		}
+	}
+}
+
+func TestFoundationDBBackend(t *testing.T) {
+	b, cleanup := testFoundationDBBackend(t)
+	defer cleanup()
+
+	testBackend(t, b)
+	testBackend_ListPrefix(t, b)
+}
+
+func TestFoundationDBBackend_LargeValues(t *testing.T) {
+	b, cleanup := testFoundationDBBackend(t)
+	defer cleanup()
+
+	// The value is split over several keys
+	value := make([]byte, 3*FoundationDBValueChunkSize+10)
+	for i := range value {
+		value[i] = byte(i)
+	}
+	if err := b.Put(&Entry{Key: "foo/big", Value: value}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put(&Entry{Key: "foo/bar", Value: []byte("bar")}); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := b.Get("foo/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil || string(entry.Value) != string(value) {
+		t.Fatal("bad value")
+	}
+	keys, err := b.List("foo/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != "bar" || keys[1] != "big" {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	// A smaller value replaces all the chunks
+	if err := b.Put(&Entry{Key: "foo/big", Value: []byte("small")}); err != nil {
+		t.Fatal(err)
+	}
+	if entry, err := b.Get("foo/big"); err != nil || string(entry.Value) != "small" {
+		t.Fatalf("bad: %v %v", entry, err)
+	}
+
+	// Transactions larger than the limit are refused
+	huge := make([]byte, FoundationDBTransactionSizeLimit)
+	if err := b.Put(&Entry{Key: "foo/huge", Value: huge}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestFoundationDBBackend_List(t *testing.T) {
+	b, cleanup := testFoundationDBBackend(t)
+	defer cleanup()
+
+	// List more keys than a batch, with directories in between
+	var txns []TxnEntry
+	for i := 0; i < foundationDBListBatchSize+10; i++ {
+		txns = append(txns, TxnEntry{
+			Operation: PutOperation,
+			Entry:     &Entry{Key: fmt.Sprintf("foo/%05d", i), Value: []byte("bar")},
+		})
+		if i%100 == 0 {
+			txns = append(txns, TxnEntry{
+				Operation: PutOperation,
+				Entry:     &Entry{Key: fmt.Sprintf("foo/%05d/sub", i), Value: []byte("bar")},
+			})
+		}
+	}
+	if err := b.Transaction(txns); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := b.List("foo/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != foundationDBListBatchSize+10+11 {
+		t.Fatalf("bad: %d keys", len(keys))
+	}
+}
+
+func TestFoundationDBBackend_HA(t *testing.T) {
+	b, cleanup := testFoundationDBBackend(t)
+	defer cleanup()
+
+	testHABackend(t, b, b)
+}
+
+func TestFoundationDBBackend_LockTTL(t *testing.T) {
+	b, cleanup := testFoundationDBBackend(t)
+	defer cleanup()
+
+	l, err := b.LockWith("core/lock", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock := l.(*FoundationDBLock)
+	lock.ttl = 500 * time.Millisecond
+	lock.renewInterval = 100 * time.Millisecond
+	lock.retryInterval = 100 * time.Millisecond
+
+	leaderCh, err := lock.Lock(nil)
+	if err != nil || leaderCh == nil {
+		t.Fatalf("failed to acquire the lock: %v", err)
+	}
+
+	// The lock is kept longer than the TTL by the renewals
+	time.Sleep(2 * lock.ttl)
+	select {
+	case <-leaderCh:
+		t.Fatal("lost the lock")
+	default:
+	}
+
+	// Another instance takes over the lock once it is not renewed anymore
+	l2, err := b.LockWith("core/lock", "baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock2 := l2.(*FoundationDBLock)
+	lock2.ttl = lock.ttl
+	lock2.retryInterval = lock.retryInterval
+	close(lock.stopCh)
+	leaderCh2, err := lock2.Lock(nil)
+	if err != nil || leaderCh2 == nil {
+		t.Fatalf("failed to acquire the lock: %v", err)
+	}
+	held, value, err := lock.Value()
+	if err != nil || !held || value != "baz" {
+		t.Fatalf("bad: %v %q %v", held, value, err)
+	}
+
+	// Releasing the lost lock doesn't delete the new one
+	lock.stopCh = make(chan struct{})
+	if err := lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if held, _, err := lock2.Value(); err != nil || !held {
+		t.Fatalf("expected the lock to be kept: %v", err)
+	}
+	lock2.Unlock()
+}
@@ -0,0 +1,16 @@
+// +build !foundationdb
+
+package physical
+
+import (
+	"fmt"
+
+	log "github.com/mgutz/logxi/v1"
+)
+
+// newFoundationDBBackend fails in the builds without the FoundationDB
+// client, which requires cgo and the libfdb_c library; build Vault with the
+// foundationdb tag to use the backend.
+func newFoundationDBBackend(conf map[string]string, logger log.Logger) (Backend, error) {
+	return nil, fmt.Errorf("FoundationDB backend not available in this build; build Vault with the 'foundationdb' tag")
+}
@@ -1,22 +1,54 @@
 package physical
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/errwrap"
+	multierror "github.com/hashicorp/go-multierror"
+	uuid "github.com/hashicorp/go-uuid"
 	log "github.com/mgutz/logxi/v1"
 
 	"cloud.google.com/go/storage"
 	"github.com/armon/go-metrics"
 	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
+	raw "google.golang.org/api/storage/v1"
+	"google.golang.org/api/transport"
+)
+
+const (
+	// GCSLockTTL is how long a lock is valid without being renewed.
+	GCSLockTTL = 15 * time.Second
+
+	// GCSLockRenewInterval is the amount of time to wait between the
+	// renewals of a held lock.
+	GCSLockRenewInterval = 5 * time.Second
+
+	// GCSLockRetryInterval is the amount of time to wait if a lock
+	// fails to be acquired before trying again.
+	GCSLockRetryInterval = time.Second
+
+	// GCSTransactionChunkSize is the maximum number of operations of a
+	// transaction sent concurrently.
+	GCSTransactionChunkSize = 64
+
+	// gcsLockIdentityKey and gcsLockValueKey are the metadata keys of the
+	// lock objects holding the identity of the lock holder and the value
+	// of the lock
+	gcsLockIdentityKey = "vault-lock-identity"
+	gcsLockValueKey    = "vault-lock-value"
 )
 
 // GCSBackend is a physical backend that stores data
@@ -26,6 +58,44 @@ type GCSBackend struct {
 	client     *storage.Client
 	permitPool *PermitPool
 	logger     log.Logger
+
+	// raw is the client of the JSON API the objects are written with, as
+	// only it supports customer-managed encryption keys
+	raw        *raw.Service
+	kmsKeyName string
+
+	haEnabled bool
+}
+
+// GCSLock is a lock held by writing an object with a precondition on its
+// generation, so that only one instance creates or renews it at a time.
+type GCSLock struct {
+	backend    *GCSBackend
+	value, key string
+	identity   string
+
+	lock sync.Mutex
+	held bool
+
+	// generation is the generation of the lock object written by the last
+	// acquisition or renewal
+	generation int64
+
+	// stopCh stops renewing the lock when it is released
+	stopCh chan struct{}
+
+	// Allow modifying the Lock durations for ease of unit testing.
+	renewInterval time.Duration
+	retryInterval time.Duration
+	ttl           time.Duration
+}
+
+// gcsKMSKeyName is a call option setting the customer-managed encryption key
+// of an object
+type gcsKMSKeyName string
+
+func (k gcsKMSKeyName) Get() (string, string) {
+	return "kmsKeyName", string(k)
 }
 
 // newGCSBackend constructs a Google Cloud Storage backend using a pre-existing
@@ -51,11 +121,21 @@ func newGCSBackend(conf map[string]string, logger log.Logger) (Backend, error) {
 		}
 	}
 
-	client, err := storage.NewClient(
+	// The data is read with the storage client, and written with the
+	// JSON API client sharing its authenticated HTTP client
+	httpClient, _, err := transport.NewHTTPClient(
 		context.Background(),
 		option.WithServiceAccountFile(credentialsFile),
+		option.WithScopes(storage.ScopeFullControl),
 	)
-
+	if err != nil {
+		return nil, fmt.Errorf("error establishing storage client: '%v'", err)
+	}
+	client, err := storage.NewClient(context.Background(), option.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, fmt.Errorf("error establishing storage client: '%v'", err)
+	}
+	rawClient, err := raw.New(httpClient)
 	if err != nil {
 		return nil, fmt.Errorf("error establishing storage client: '%v'", err)
 	}
@@ -78,11 +158,26 @@ func newGCSBackend(conf map[string]string, logger log.Logger) (Backend, error) {
 		}
 	}
 
+	haEnabled := false
+	haEnabledStr := os.Getenv("GCS_HA_ENABLED")
+	if haEnabledStr == "" {
+		haEnabledStr = conf["ha_enabled"]
+	}
+	if haEnabledStr != "" {
+		haEnabled, err = strconv.ParseBool(haEnabledStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing ha_enabled parameter: {{err}}", err)
+		}
+	}
+
 	g := GCSBackend{
 		bucketName: bucketName,
 		client:     client,
 		permitPool: NewPermitPool(maxParInt),
 		logger:     logger,
+		raw:        rawClient,
+		kmsKeyName: conf["kms_key_name"],
+		haEnabled:  haEnabled,
 	}
 
 	return &g, nil
@@ -90,22 +185,59 @@ func newGCSBackend(conf map[string]string, logger log.Logger) (Backend, error) {
 
 // Put is used to insert or update an entry
 func (g *GCSBackend) Put(entry *Entry) error {
-	defer metrics.MeasureSince([]string{"gcs", "put"}, time.Now())
+	g.permitPool.Acquire()
+	defer g.permitPool.Release()
 
-	bucket := g.client.Bucket(g.bucketName)
-	writer := bucket.Object(entry.Key).NewWriter(context.Background())
+	return g.PutInternal(entry)
+}
 
+// Get is used to fetch an entry
+func (g *GCSBackend) Get(key string) (*Entry, error) {
 	g.permitPool.Acquire()
 	defer g.permitPool.Release()
 
-	defer writer.Close()
-	_, err := writer.Write(entry.Value)
+	return g.GetInternal(key)
+}
 
-	return err
+// Delete is used to permanently delete an entry
+func (g *GCSBackend) Delete(key string) error {
+	g.permitPool.Acquire()
+	defer g.permitPool.Release()
+
+	return g.DeleteInternal(key)
 }
 
-// Get is used to fetch an entry
-func (g *GCSBackend) Get(key string) (*Entry, error) {
+// PutInternal is used to insert or update an entry
+func (g *GCSBackend) PutInternal(entry *Entry) error {
+	defer metrics.MeasureSince([]string{"gcs", "put"}, time.Now())
+
+	if _, err := g.writeObject(entry.Key, entry.Value, nil, -1); err != nil {
+		return fmt.Errorf("error writing object '%v': '%v'", entry.Key, err)
+	}
+	return nil
+}
+
+// writeObject writes an object with the given contents and metadata. Unless
+// generation is negative, the write only succeeds if the generation of the
+// existing object matches, 0 meaning that the object must not exist.
+func (g *GCSBackend) writeObject(key string, value []byte, metadata map[string]string, generation int64) (*raw.Object, error) {
+	call := g.raw.Objects.Insert(g.bucketName, &raw.Object{
+		Name:     key,
+		Metadata: metadata,
+	}).Media(bytes.NewReader(value))
+	if generation >= 0 {
+		call = call.IfGenerationMatch(generation)
+	}
+
+	var opts []googleapi.CallOption
+	if g.kmsKeyName != "" {
+		opts = append(opts, gcsKMSKeyName(g.kmsKeyName))
+	}
+	return call.Do(opts...)
+}
+
+// GetInternal is used to fetch an entry
+func (g *GCSBackend) GetInternal(key string) (*Entry, error) {
 	defer metrics.MeasureSince([]string{"gcs", "get"}, time.Now())
 
 	bucket := g.client.Bucket(g.bucketName)
@@ -118,9 +250,6 @@ func (g *GCSBackend) Get(key string) (*Entry, error) {
 		return nil, fmt.Errorf("error creating bucket reader: '%v'", err)
 	}
 
-	g.permitPool.Acquire()
-	defer g.permitPool.Release()
-
 	defer reader.Close()
 	value, err := ioutil.ReadAll(reader)
 	if err != nil {
@@ -135,15 +264,11 @@ func (g *GCSBackend) Get(key string) (*Entry, error) {
 	return &ent, nil
 }
 
-// Delete is used to permanently delete an entry
-func (g *GCSBackend) Delete(key string) error {
+// DeleteInternal is used to permanently delete an entry
+func (g *GCSBackend) DeleteInternal(key string) error {
 	defer metrics.MeasureSince([]string{"gcs", "delete"}, time.Now())
 
 	bucket := g.client.Bucket(g.bucketName)
-
-	g.permitPool.Acquire()
-	defer g.permitPool.Release()
-
 	err := bucket.Object(key).Delete(context.Background())
 
 	// deletion of non existent object is OK
@@ -203,3 +328,320 @@ func (g *GCSBackend) List(prefix string) ([]string, error) {
 
 	return keys, nil
 }
+
+// Transaction applies the operations in chunks of concurrent requests. GCS
+// can't update several objects atomically, so when an operation fails, the
+// ones already applied are rolled back.
+func (g *GCSBackend) Transaction(txns []TxnEntry) error {
+	defer metrics.MeasureSince([]string{"gcs", "transaction"}, time.Now())
+
+	var rollbackStack []TxnEntry
+	for len(txns) > 0 {
+		chunk := gcsTransactionChunk(txns, GCSTransactionChunkSize)
+		txns = txns[len(chunk):]
+
+		rollbacks, err := g.applyTransactionChunk(chunk)
+		rollbackStack = append(rollbackStack, rollbacks...)
+		if err == nil {
+			continue
+		}
+
+		retErr := multierror.Append(nil, err)
+		for i := len(rollbackStack) - 1; i >= 0; i-- {
+			txn := rollbackStack[i]
+			var err error
+			switch txn.Operation {
+			case PutOperation:
+				err = g.Put(txn.Entry)
+			case DeleteOperation:
+				err = g.Delete(txn.Entry.Key)
+			}
+			if err != nil {
+				retErr = multierror.Append(retErr, fmt.Errorf("failed to roll back '%v': '%v'", txn.Entry.Key, err))
+			}
+		}
+		return retErr
+	}
+	return nil
+}
+
+// gcsTransactionChunk returns the first operations which can be applied
+// concurrently: at most size of them, and none on the same key, so that
+// the operations on a key are applied in order.
+func gcsTransactionChunk(txns []TxnEntry, size int) []TxnEntry {
+	keys := make(map[string]struct{}, size)
+	for i, txn := range txns {
+		if _, ok := keys[txn.Entry.Key]; ok || i == size {
+			return txns[:i]
+		}
+		keys[txn.Entry.Key] = struct{}{}
+	}
+	return txns
+}
+
+// applyTransactionChunk applies the operations concurrently. It returns the
+// operations rolling back the ones which succeeded, and an error if any
+// failed.
+func (g *GCSBackend) applyTransactionChunk(txns []TxnEntry) ([]TxnEntry, error) {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var rollbacks []TxnEntry
+	var retErr *multierror.Error
+
+	for _, txn := range txns {
+		wg.Add(1)
+		go func(txn TxnEntry) {
+			defer wg.Done()
+
+			g.permitPool.Acquire()
+			defer g.permitPool.Release()
+
+			rollback, err := g.applyTransactionEntry(txn)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				retErr = multierror.Append(retErr, err)
+			} else if rollback != nil {
+				rollbacks = append(rollbacks, *rollback)
+			}
+		}(txn)
+	}
+	wg.Wait()
+
+	return rollbacks, retErr.ErrorOrNil()
+}
+
+// applyTransactionEntry applies an operation, and returns the operation
+// rolling it back, if any
+func (g *GCSBackend) applyTransactionEntry(txn TxnEntry) (*TxnEntry, error) {
+	previous, err := g.GetInternal(txn.Entry.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	switch txn.Operation {
+	case PutOperation:
+		err = g.PutInternal(txn.Entry)
+	case DeleteOperation:
+		if previous == nil {
+			// Nothing to delete or roll back
+			return nil, nil
+		}
+		err = g.DeleteInternal(txn.Entry.Key)
+	default:
+		return nil, fmt.Errorf("unsupported transaction operation: %q", txn.Operation)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if previous == nil {
+		return &TxnEntry{
+			Operation: DeleteOperation,
+			Entry:     &Entry{Key: txn.Entry.Key},
+		}, nil
+	}
+	return &TxnEntry{
+		Operation: PutOperation,
+		Entry:     previous,
+	}, nil
+}
+
+// LockWith is used for mutual exclusion based on the given key.
+func (g *GCSBackend) LockWith(key, value string) (Lock, error) {
+	identity, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	return &GCSLock{
+		backend:       g,
+		key:           key,
+		value:         value,
+		identity:      identity,
+		renewInterval: GCSLockRenewInterval,
+		retryInterval: GCSLockRetryInterval,
+		ttl:           GCSLockTTL,
+	}, nil
+}
+
+// HAEnabled indicates whether the HA functionality should be exposed.
+func (g *GCSBackend) HAEnabled() bool {
+	return g.haEnabled
+}
+
+// Lock tries to acquire the lock by repeatedly trying to create or take over
+// the lock object. It blocks until either the stop channel is closed or the
+// lock is acquired. The returned channel is closed once the lock is lost.
+func (l *GCSLock) Lock(stopCh <-chan struct{}) (<-chan struct{}, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.held {
+		return nil, fmt.Errorf("lock already held")
+	}
+
+	ticker := time.NewTicker(l.retryInterval)
+	defer ticker.Stop()
+	for {
+		acquired, err := l.writeLock()
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			break
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return nil, nil
+		}
+	}
+
+	l.held = true
+	l.stopCh = make(chan struct{})
+	leaderCh := make(chan struct{})
+	go l.periodicallyRenewLock(leaderCh, l.stopCh)
+	return leaderCh, nil
+}
+
+// Unlock releases the lock by deleting the lock object, unless another
+// instance took it over meanwhile.
+func (l *GCSLock) Unlock() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.held {
+		return nil
+	}
+
+	l.held = false
+	close(l.stopCh)
+
+	err := l.backend.raw.Objects.Delete(l.backend.bucketName, l.key).
+		IfGenerationMatch(atomic.LoadInt64(&l.generation)).Do()
+	if isGCSStatus(err, http.StatusNotFound, http.StatusPreconditionFailed) {
+		return nil
+	}
+	return err
+}
+
+// Value checks whether or not the lock is held by any instance of GCSLock,
+// including this one, and returns the current value.
+func (l *GCSLock) Value() (bool, string, error) {
+	obj, err := l.readLock()
+	if err != nil || obj == nil {
+		return false, "", err
+	}
+	expired, err := l.expired(obj)
+	if err != nil || expired {
+		return false, "", err
+	}
+	return true, obj.Metadata[gcsLockValueKey], nil
+}
+
+// readLock returns the lock object, or nil if it doesn't exist
+func (l *GCSLock) readLock() (*raw.Object, error) {
+	obj, err := l.backend.raw.Objects.Get(l.backend.bucketName, l.key).Do()
+	if isGCSStatus(err, http.StatusNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading lock '%v': '%v'", l.key, err)
+	}
+	return obj, nil
+}
+
+// expired returns whether the lock object wasn't renewed for the TTL since
+// the time the storage last updated it
+func (l *GCSLock) expired(obj *raw.Object) (bool, error) {
+	updated, err := time.Parse(time.RFC3339Nano, obj.Updated)
+	if err != nil {
+		return false, fmt.Errorf("error parsing update time of lock '%v': '%v'", l.key, err)
+	}
+	return time.Since(updated) >= l.ttl, nil
+}
+
+// writeLock creates the lock, takes it over if it expired, or renews it if
+// it is already held by this instance. The write is conditioned on the
+// generation of the object read, so that it fails if another instance wrote
+// the lock concurrently. It returns false if another instance holds the
+// lock.
+func (l *GCSLock) writeLock() (bool, error) {
+	obj, err := l.readLock()
+	if err != nil {
+		return false, err
+	}
+
+	var generation int64
+	if obj != nil {
+		if obj.Metadata[gcsLockIdentityKey] != l.identity {
+			expired, err := l.expired(obj)
+			if err != nil || !expired {
+				return false, err
+			}
+		}
+		generation = obj.Generation
+	}
+
+	obj, err = l.backend.writeObject(l.key, nil, map[string]string{
+		gcsLockIdentityKey: l.identity,
+		gcsLockValueKey:    l.value,
+	}, generation)
+	if isGCSStatus(err, http.StatusPreconditionFailed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error writing lock '%v': '%v'", l.key, err)
+	}
+	atomic.StoreInt64(&l.generation, obj.Generation)
+	return true, nil
+}
+
+// periodicallyRenewLock renews the lock until it is released, and closes the
+// leader channel when it is lost: either taken over by another instance, or
+// not renewed in time because of errors.
+func (l *GCSLock) periodicallyRenewLock(leaderCh, stopCh chan struct{}) {
+	defer close(leaderCh)
+
+	ticker := time.NewTicker(l.renewInterval)
+	defer ticker.Stop()
+
+	lastRenewal := time.Now()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		acquired, err := l.writeLock()
+		switch {
+		case err != nil:
+			l.backend.logger.Warn("physical/gcs: failed to renew lock", "key", l.key, "error", err)
+			if time.Since(lastRenewal) < l.ttl {
+				continue
+			}
+			l.backend.logger.Error("physical/gcs: lock expired", "key", l.key)
+			return
+		case !acquired:
+			l.backend.logger.Error("physical/gcs: lock taken over by another instance", "key", l.key)
+			return
+		}
+		lastRenewal = time.Now()
+	}
+}
+
+// isGCSStatus returns whether the error is a response of the JSON API with
+// one of the given status codes
+func isGCSStatus(err error, codes ...int) bool {
+	apiErr, ok := err.(*googleapi.Error)
+	if !ok {
+		return false
+	}
+	for _, code := range codes {
+		if apiErr.Code == code {
+			return true
+		}
+	}
+	return false
+}
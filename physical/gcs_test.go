@@ -1,9 +1,21 @@
 package physical
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -14,6 +26,7 @@ import (
 	"golang.org/x/net/context"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
+	raw "google.golang.org/api/storage/v1"
 )
 
 var ConsistencyDelays = delays{
@@ -93,3 +106,322 @@ func TestGCSBackend(t *testing.T) {
 	testEventuallyConsistentBackend_ListPrefix(t, b, ConsistencyDelays)
 
 }
+
+// fakeGCSObject is an object of fakeGCS
+type fakeGCSObject struct {
+	data       []byte
+	metadata   map[string]string
+	generation int64
+	updated    time.Time
+	kmsKeyName string
+}
+
+// fakeGCS implements the subset of the Google Cloud Storage APIs used by the
+// backend, for a single bucket
+type fakeGCS struct {
+	lock       sync.Mutex
+	objects    map[string]*fakeGCSObject
+	generation int64
+
+	// failKey makes the writes of the key fail
+	failKey string
+}
+
+// redirectTransport sends all the requests to a test server
+type redirectTransport struct {
+	url *url.URL
+}
+
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.URL.Scheme = t.url.Scheme
+	req.URL.Host = t.url.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	const objectsPath = "/storage/v1/b/bucket/o"
+	query := r.URL.Query()
+
+	var name string
+	if strings.HasPrefix(r.URL.Path, objectsPath+"/") {
+		name = strings.TrimPrefix(r.URL.Path, objectsPath+"/")
+	} else if strings.HasPrefix(r.URL.Path, "/bucket/") {
+		name = strings.TrimPrefix(r.URL.Path, "/bucket/")
+	}
+	obj := f.objects[name]
+
+	// checkGeneration checks the generation precondition of the request
+	checkGeneration := func() bool {
+		match := query.Get("ifGenerationMatch")
+		if match == "" {
+			return true
+		}
+		generation, _ := strconv.ParseInt(match, 10, 64)
+		if (obj == nil && generation != 0) || (obj != nil && obj.generation != generation) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			fmt.Fprint(w, `{"error":{"code":412,"message":"Precondition Failed"}}`)
+			return false
+		}
+		return true
+	}
+	notFound := func() {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":{"code":404,"message":"Not Found"}}`)
+	}
+	writeObject := func(name string, obj *fakeGCSObject) {
+		json.NewEncoder(w).Encode(&raw.Object{
+			Name:       name,
+			Bucket:     "bucket",
+			Generation: obj.generation,
+			Metadata:   obj.metadata,
+			Size:       uint64(len(obj.data)),
+			Updated:    obj.updated.Format(time.RFC3339Nano),
+		})
+	}
+
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/upload"+objectsPath:
+		_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		reader := multipart.NewReader(r.Body, params["boundary"])
+		part, _ := reader.NextPart()
+		var attrs raw.Object
+		json.NewDecoder(part).Decode(&attrs)
+		part, _ = reader.NextPart()
+		data, _ := ioutil.ReadAll(part)
+
+		name, obj = attrs.Name, f.objects[attrs.Name]
+		if name == f.failKey {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error":{"code":500,"message":"injected failure"}}`)
+			return
+		}
+		if !checkGeneration() {
+			return
+		}
+		f.generation++
+		obj = &fakeGCSObject{
+			data:       data,
+			metadata:   attrs.Metadata,
+			generation: f.generation,
+			updated:    time.Now(),
+			kmsKeyName: query.Get("kmsKeyName"),
+		}
+		f.objects[name] = obj
+		writeObject(name, obj)
+
+	case r.Method == "GET" && r.URL.Path == objectsPath:
+		prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+		resp := &raw.Objects{}
+		seen := map[string]bool{}
+		for key := range f.objects {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			if i := strings.Index(key[len(prefix):], delimiter); delimiter != "" && i != -1 {
+				dir := key[:len(prefix)+i+1]
+				if !seen[dir] {
+					seen[dir] = true
+					resp.Prefixes = append(resp.Prefixes, dir)
+				}
+				continue
+			}
+			resp.Items = append(resp.Items, &raw.Object{Name: key, Bucket: "bucket"})
+		}
+		sort.Strings(resp.Prefixes)
+		json.NewEncoder(w).Encode(resp)
+
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, objectsPath+"/"):
+		if obj == nil {
+			notFound()
+			return
+		}
+		writeObject(name, obj)
+
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/bucket/"):
+		if obj == nil {
+			notFound()
+			return
+		}
+		w.Write(obj.data)
+
+	case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, objectsPath+"/"):
+		if obj == nil {
+			notFound()
+			return
+		}
+		if !checkGeneration() {
+			return
+		}
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":{"code":400,"message":"unexpected request %s %s"}}`, r.Method, r.URL)
+	}
+}
+
+// testFakeGCSBackend returns a backend using a fake GCS server, and the fake
+func testFakeGCSBackend(t *testing.T) (*GCSBackend, *fakeGCS, func()) {
+	fake := &fakeGCS{objects: map[string]*fakeGCSObject{}}
+	server := httptest.NewServer(fake)
+	serverURL, _ := url.Parse(server.URL)
+	httpClient := &http.Client{Transport: &redirectTransport{url: serverURL}}
+
+	client, err := storage.NewClient(context.Background(), option.WithHTTPClient(httpClient))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawClient, err := raw.New(httpClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &GCSBackend{
+		bucketName: "bucket",
+		client:     client,
+		raw:        rawClient,
+		permitPool: NewPermitPool(0),
+		logger:     logformat.NewVaultLogger(log.LevelTrace),
+		haEnabled:  true,
+	}
+	return b, fake, server.Close
+}
+
+func TestGCSBackend_Fake(t *testing.T) {
+	b, fake, cleanup := testFakeGCSBackend(t)
+	defer cleanup()
+	b.kmsKeyName = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+
+	testBackend(t, b)
+	testBackend_ListPrefix(t, b)
+
+	if err := b.Put(&Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatal(err)
+	}
+	if fake.objects["foo"].kmsKeyName != b.kmsKeyName {
+		t.Fatalf("bad encryption key: %q", fake.objects["foo"].kmsKeyName)
+	}
+}
+
+func TestGCSBackend_Transaction(t *testing.T) {
+	b, fake, cleanup := testFakeGCSBackend(t)
+	defer cleanup()
+
+	if err := b.Put(&Entry{Key: "a", Value: []byte("old")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Spread the operations over several chunks
+	var txns []TxnEntry
+	expected := map[string]string{}
+	for i := 0; i < 2*GCSTransactionChunkSize; i++ {
+		key := fmt.Sprintf("key/%03d", i)
+		txns = append(txns, TxnEntry{
+			Operation: PutOperation,
+			Entry:     &Entry{Key: key, Value: []byte(key)},
+		})
+		expected[key] = key
+	}
+	txns = append(txns,
+		TxnEntry{Operation: PutOperation, Entry: &Entry{Key: "a", Value: []byte("new")}},
+		TxnEntry{Operation: DeleteOperation, Entry: &Entry{Key: "key/000"}},
+	)
+	expected["a"] = "new"
+	delete(expected, "key/000")
+
+	if err := b.Transaction(txns); err != nil {
+		t.Fatal(err)
+	}
+	actual := map[string]string{}
+	for key, obj := range fake.objects {
+		actual[key] = string(obj.data)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %v", actual)
+	}
+
+	// A failure rolls back the operations already applied
+	fake.failKey = "key/050"
+	txns = []TxnEntry{
+		{Operation: PutOperation, Entry: &Entry{Key: "a", Value: []byte("newer")}},
+		{Operation: DeleteOperation, Entry: &Entry{Key: "key/001"}},
+		{Operation: PutOperation, Entry: &Entry{Key: "b", Value: []byte("b")}},
+		{Operation: PutOperation, Entry: &Entry{Key: "key/050", Value: []byte("fail")}},
+	}
+	if err := b.Transaction(txns); err == nil {
+		t.Fatal("expected an error")
+	}
+	actual = map[string]string{}
+	for key, obj := range fake.objects {
+		actual[key] = string(obj.data)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %v", actual)
+	}
+}
+
+func TestGCSBackend_HA(t *testing.T) {
+	b, _, cleanup := testFakeGCSBackend(t)
+	defer cleanup()
+
+	testHABackend(t, b, b)
+}
+
+func TestGCSBackend_LockTTL(t *testing.T) {
+	b, fake, cleanup := testFakeGCSBackend(t)
+	defer cleanup()
+
+	l, err := b.LockWith("core/lock", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock := l.(*GCSLock)
+	lock.ttl = 100 * time.Millisecond
+	lock.renewInterval = 20 * time.Millisecond
+	lock.retryInterval = 20 * time.Millisecond
+
+	leaderCh, err := lock.Lock(nil)
+	if err != nil || leaderCh == nil {
+		t.Fatalf("failed to acquire the lock: %v", err)
+	}
+
+	// The lock is kept longer than the TTL by the renewals
+	time.Sleep(2 * lock.ttl)
+	select {
+	case <-leaderCh:
+		t.Fatal("lost the lock")
+	default:
+	}
+
+	// Another instance takes over the lock once it is not renewed anymore
+	l2, err := b.LockWith("core/lock", "baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock2 := l2.(*GCSLock)
+	lock2.ttl = lock.ttl
+	lock2.retryInterval = lock.retryInterval
+	close(lock.stopCh)
+	leaderCh2, err := lock2.Lock(nil)
+	if err != nil || leaderCh2 == nil {
+		t.Fatalf("failed to acquire the lock: %v", err)
+	}
+	held, value, err := lock.Value()
+	if err != nil || !held || value != "baz" {
+		t.Fatalf("bad: %v %q %v", held, value, err)
+	}
+
+	// Releasing the lost lock doesn't delete the new one
+	lock.stopCh = make(chan struct{})
+	if err := lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.objects["core/lock"]; !ok {
+		t.Fatal("expected the lock to be kept")
+	}
+	lock2.Unlock()
+}
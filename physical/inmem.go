@@ -17,6 +17,7 @@ type InmemBackend struct {
 	root       *radix.Tree
 	permitPool *PermitPool
 	logger     log.Logger
+	faults     inmemFaults
 }
 
 type TransactionalInmemBackend struct {
@@ -51,6 +52,10 @@ func (i *InmemBackend) Put(entry *Entry) error {
 	i.permitPool.Acquire()
 	defer i.permitPool.Release()
 
+	if err := i.faults.inject(PutOperation); err != nil {
+		return err
+	}
+
 	i.Lock()
 	defer i.Unlock()
 
@@ -67,6 +72,10 @@ func (i *InmemBackend) Get(key string) (*Entry, error) {
 	i.permitPool.Acquire()
 	defer i.permitPool.Release()
 
+	if err := i.faults.inject(GetOperation); err != nil {
+		return nil, err
+	}
+
 	i.RLock()
 	defer i.RUnlock()
 
@@ -85,6 +94,10 @@ func (i *InmemBackend) Delete(key string) error {
 	i.permitPool.Acquire()
 	defer i.permitPool.Release()
 
+	if err := i.faults.inject(DeleteOperation); err != nil {
+		return err
+	}
+
 	i.Lock()
 	defer i.Unlock()
 
@@ -102,6 +115,10 @@ func (i *InmemBackend) List(prefix string) ([]string, error) {
 	i.permitPool.Acquire()
 	defer i.permitPool.Release()
 
+	if err := i.faults.inject(ListOperation); err != nil {
+		return nil, err
+	}
+
 	i.RLock()
 	defer i.RUnlock()
 
@@ -135,6 +152,12 @@ func (t *TransactionalInmemBackend) Transaction(txns []TxnEntry) error {
 	t.permitPool.Acquire()
 	defer t.permitPool.Release()
 
+	for _, txn := range txns {
+		if err := t.faults.inject(txn.Operation); err != nil {
+			return err
+		}
+	}
+
 	t.Lock()
 	defer t.Unlock()
 
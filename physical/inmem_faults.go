@@ -0,0 +1,129 @@
+package physical
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInmemPartitioned is returned by the operations of a partitioned
+	// in-memory backend
+	ErrInmemPartitioned = errors.New("inmem: backend is partitioned")
+
+	// ErrInmemFault is returned by the operations failed by the error rate of
+	// an in-memory backend
+	ErrInmemFault = errors.New("inmem: injected fault")
+)
+
+// inmemFaults holds the latencies and the failures injected in the operations
+// of an in-memory backend, so that tests can exercise the behavior of Vault
+// against a slow or unreliable storage. The zero value injects nothing.
+type inmemFaults struct {
+	l           sync.Mutex
+	latency     map[Operation]time.Duration
+	errorRate   map[Operation]float64
+	rand        *rand.Rand
+	partitioned bool
+}
+
+// setLatency sets the latency added to the operations of the given type
+func (f *inmemFaults) setLatency(op Operation, latency time.Duration) {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	if f.latency == nil {
+		f.latency = make(map[Operation]time.Duration)
+	}
+	f.latency[op] = latency
+}
+
+// setErrorRate sets the probability, between 0 and 1, that an operation of the
+// given type fails
+func (f *inmemFaults) setErrorRate(op Operation, rate float64) {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	if f.errorRate == nil {
+		f.errorRate = make(map[Operation]float64)
+	}
+	f.errorRate[op] = rate
+}
+
+// setSeed seeds the source deciding which operations fail
+func (f *inmemFaults) setSeed(seed int64) {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	f.rand = rand.New(rand.NewSource(seed))
+}
+
+func (f *inmemFaults) setPartitioned(partitioned bool) {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	f.partitioned = partitioned
+}
+
+func (f *inmemFaults) isPartitioned() bool {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	return f.partitioned
+}
+
+// inject waits for the latency of the operation, and returns the error it
+// must fail with, if any
+func (f *inmemFaults) inject(op Operation) error {
+	f.l.Lock()
+	latency := f.latency[op]
+	partitioned := f.partitioned
+	fail := false
+	if rate := f.errorRate[op]; rate > 0 {
+		if f.rand == nil {
+			// Without an explicit seed, the failures are still the same
+			// from one run to the next
+			f.rand = rand.New(rand.NewSource(1))
+		}
+		fail = f.rand.Float64() < rate
+	}
+	f.l.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	switch {
+	case partitioned:
+		return ErrInmemPartitioned
+	case fail:
+		return ErrInmemFault
+	}
+	return nil
+}
+
+// SetLatency sets the latency added to the operations of the given type:
+// GetOperation, PutOperation, DeleteOperation or ListOperation. A zero latency
+// removes it.
+func (i *InmemBackend) SetLatency(op Operation, latency time.Duration) {
+	i.faults.setLatency(op, latency)
+}
+
+// SetErrorRate sets the probability, between 0 and 1, that an operation of the
+// given type fails with ErrInmemFault. A transaction fails if any of its
+// operations does.
+func (i *InmemBackend) SetErrorRate(op Operation, rate float64) {
+	i.faults.setErrorRate(op, rate)
+}
+
+// SetFaultSeed seeds the source deciding which operations fail, so that a
+// test sees the same failures on every run.
+func (i *InmemBackend) SetFaultSeed(seed int64) {
+	i.faults.setSeed(seed)
+}
+
+// SetPartitioned simulates a network partition between Vault and the backend:
+// while partitioned, all the operations fail with ErrInmemPartitioned.
+func (i *InmemBackend) SetPartitioned(partitioned bool) {
+	i.faults.setPartitioned(partitioned)
+}
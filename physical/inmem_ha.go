@@ -9,10 +9,11 @@ import (
 
 type InmemHABackend struct {
 	Backend
-	locks  map[string]string
-	l      sync.Mutex
-	cond   *sync.Cond
-	logger log.Logger
+	locks   map[string]string
+	holders map[string]*InmemLock
+	l       sync.Mutex
+	cond    *sync.Cond
+	logger  log.Logger
 }
 
 type TransactionalInmemHABackend struct {
@@ -25,6 +26,7 @@ func NewInmemHA(logger log.Logger) *InmemHABackend {
 	in := &InmemHABackend{
 		Backend: NewInmem(logger),
 		locks:   make(map[string]string),
+		holders: make(map[string]*InmemLock),
 		logger:  logger,
 	}
 	in.cond = sync.NewCond(&in.l)
@@ -36,6 +38,7 @@ func NewTransactionalInmemHA(logger log.Logger) *TransactionalInmemHABackend {
 	inmemHA := InmemHABackend{
 		Backend: transInmem,
 		locks:   make(map[string]string),
+		holders: make(map[string]*InmemLock),
 		logger:  logger,
 	}
 
@@ -69,6 +72,41 @@ func (i *InmemHABackend) HAEnabled() bool {
 	return true
 }
 
+// faults returns the faults injected in the underlying backend
+func (i *InmemHABackend) faults() *inmemFaults {
+	switch b := i.Backend.(type) {
+	case *InmemBackend:
+		return &b.faults
+	case *TransactionalInmemBackend:
+		return &b.faults
+	}
+	return &inmemFaults{}
+}
+
+// SetPartitioned simulates a network partition between Vault and the backend.
+// On top of failing the operations of the backend, the partition makes the
+// holders of the locks lose them, and the acquisitions of locks wait until it
+// ends, like a backend whose lock sessions expire.
+func (i *InmemHABackend) SetPartitioned(partitioned bool) {
+	i.faults().setPartitioned(partitioned)
+
+	i.l.Lock()
+	var lost []*InmemLock
+	if partitioned {
+		for key, holder := range i.holders {
+			lost = append(lost, holder)
+			delete(i.holders, key)
+			delete(i.locks, key)
+		}
+	}
+	i.l.Unlock()
+	i.cond.Broadcast()
+
+	for _, lock := range lost {
+		lock.lose()
+	}
+}
+
 // InmemLock is an in-memory Lock implementation for the HABackend
 type InmemLock struct {
 	in    *InmemHABackend
@@ -94,11 +132,12 @@ func (i *InmemLock) Lock(stopCh <-chan struct{}) (<-chan struct{}, error) {
 		// Wait to acquire the lock
 		i.in.l.Lock()
 		_, ok := i.in.locks[i.key]
-		for ok {
+		for ok || i.in.faults().isPartitioned() {
 			i.in.cond.Wait()
 			_, ok = i.in.locks[i.key]
 		}
 		i.in.locks[i.key] = i.value
+		i.in.holders[i.key] = i
 		i.in.l.Unlock()
 
 		// Signal that lock is held
@@ -107,10 +146,7 @@ func (i *InmemLock) Lock(stopCh <-chan struct{}) (<-chan struct{}, error) {
 		// Handle an early abort
 		release := <-releaseCh
 		if release {
-			i.in.l.Lock()
-			delete(i.in.locks, i.key)
-			i.in.l.Unlock()
-			i.in.cond.Broadcast()
+			i.in.release(i)
 		}
 	}()
 
@@ -141,14 +177,39 @@ func (i *InmemLock) Unlock() error {
 	i.leaderCh = nil
 	i.held = false
 
-	i.in.l.Lock()
-	delete(i.in.locks, i.key)
-	i.in.l.Unlock()
-	i.in.cond.Broadcast()
+	i.in.release(i)
 	return nil
 }
 
+// lose gives up a lock released by a partition
+func (i *InmemLock) lose() {
+	i.l.Lock()
+	defer i.l.Unlock()
+
+	if !i.held {
+		return
+	}
+	close(i.leaderCh)
+	i.leaderCh = nil
+	i.held = false
+}
+
+// release frees the key of a lock, unless it was lost in the meantime
+func (i *InmemHABackend) release(lock *InmemLock) {
+	i.l.Lock()
+	if i.holders[lock.key] == lock {
+		delete(i.holders, lock.key)
+		delete(i.locks, lock.key)
+	}
+	i.l.Unlock()
+	i.cond.Broadcast()
+}
+
 func (i *InmemLock) Value() (bool, string, error) {
+	if i.in.faults().isPartitioned() {
+		return false, "", ErrInmemPartitioned
+	}
+
 	i.in.l.Lock()
 	val, ok := i.in.locks[i.key]
 	i.in.l.Unlock()
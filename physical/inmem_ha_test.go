@@ -2,6 +2,7 @@ package physical
 
 import (
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/helper/logformat"
 	log "github.com/mgutz/logxi/v1"
@@ -13,3 +14,62 @@ func TestInmemHA(t *testing.T) {
 	inm := NewInmemHA(logger)
 	testHABackend(t, inm, inm)
 }
+
+func TestInmemHA_Partition(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	inm := NewInmemHA(logger)
+	lock, err := inm.LockWith("foo", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaderCh, err := lock.Lock(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The partition makes the holder lose the lock
+	inm.SetPartitioned(true)
+	select {
+	case <-leaderCh:
+	case <-time.After(time.Second):
+		t.Fatal("expected the lock to be lost")
+	}
+	if _, _, err := lock.Value(); err != ErrInmemPartitioned {
+		t.Fatalf("bad: %v", err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The lock can't be acquired until the partition ends
+	lock2, err := inm.LockWith("foo", "baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan struct{})
+	go func() {
+		if _, err := lock2.Lock(nil); err == nil {
+			close(acquired)
+		}
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("lock acquired during the partition")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	inm.SetPartitioned(false)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("expected the lock to be acquired")
+	}
+	held, value, err := lock2.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !held || value != "baz" {
+		t.Fatalf("bad: %v %q", held, value)
+	}
+}
@@ -2,6 +2,7 @@ package physical
 
 import (
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/helper/logformat"
 	log "github.com/mgutz/logxi/v1"
@@ -14,3 +15,97 @@ func TestInmem(t *testing.T) {
 	testBackend(t, inm)
 	testBackend_ListPrefix(t, inm)
 }
+
+func TestInmem_Faults(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	inm := NewInmem(logger)
+	if err := inm.Put(&Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Latency
+	inm.SetLatency(GetOperation, 50*time.Millisecond)
+	start := time.Now()
+	if _, err := inm.Get("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("expected latency")
+	}
+	inm.SetLatency(GetOperation, 0)
+
+	// Errors are the same for a given seed
+	failures := func() []bool {
+		inm.SetFaultSeed(42)
+		var out []bool
+		for i := 0; i < 100; i++ {
+			_, err := inm.List("")
+			if err != nil && err != ErrInmemFault {
+				t.Fatal(err)
+			}
+			out = append(out, err != nil)
+		}
+		return out
+	}
+	inm.SetErrorRate(ListOperation, 0.5)
+	first := failures()
+	second := failures()
+	count := 0
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("failures differ at %d", i)
+		}
+		if first[i] {
+			count++
+		}
+	}
+	if count == 0 || count == len(first) {
+		t.Fatalf("bad: %d failures", count)
+	}
+	inm.SetErrorRate(ListOperation, 0)
+	if _, err := inm.List(""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Partition
+	inm.SetPartitioned(true)
+	if err := inm.Put(&Entry{Key: "foo", Value: []byte("baz")}); err != ErrInmemPartitioned {
+		t.Fatalf("bad: %v", err)
+	}
+	if _, err := inm.Get("foo"); err != ErrInmemPartitioned {
+		t.Fatalf("bad: %v", err)
+	}
+	inm.SetPartitioned(false)
+	ent, err := inm.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ent.Value) != "bar" {
+		t.Fatalf("bad: %#v", ent)
+	}
+}
+
+func TestTransactionalInmem_Faults(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	inm := NewTransactionalInmem(logger)
+	inm.SetErrorRate(DeleteOperation, 1)
+
+	txns := []TxnEntry{
+		TxnEntry{Operation: PutOperation, Entry: &Entry{Key: "foo", Value: []byte("bar")}},
+		TxnEntry{Operation: DeleteOperation, Entry: &Entry{Key: "zip"}},
+	}
+	if err := inm.Transaction(txns); err != ErrInmemFault {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// None of the operations is applied
+	ent, err := inm.Get("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ent != nil {
+		t.Fatalf("bad: %#v", ent)
+	}
+}
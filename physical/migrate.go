@@ -0,0 +1,198 @@
+package physical
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	uuid "github.com/hashicorp/go-uuid"
+	log "github.com/mgutz/logxi/v1"
+)
+
+// MigrationLockKey is the key of the entry marking the source and the
+// destination of a storage migration. Vault refuses to start with a storage
+// holding it, so that the source isn't modified while it is copied, and an
+// interrupted copy is never mistaken for a complete one.
+const MigrationLockKey = "core/migration"
+
+// migrationCheckpointInterval is the number of entries copied between the
+// checkpoints saved in the destination
+const migrationCheckpointInterval = 100
+
+// MigrationStatus is the value of the migration lock entries
+type MigrationStatus struct {
+	// ID identifies the migration, so that an interrupted migration is only
+	// resumed between the same storages
+	ID    string    `json:"id"`
+	Start time.Time `json:"start"`
+
+	// Checkpoint is the last key known to be copied to the destination. As
+	// the keys are copied in lexical order, a resumed migration starts after
+	// it.
+	Checkpoint string `json:"checkpoint"`
+}
+
+// ReadMigrationStatus returns the status of the migration the storage is
+// the source or the destination of, or nil if it is not being migrated
+func ReadMigrationStatus(b Backend) (*MigrationStatus, error) {
+	entry, err := b.Get(MigrationLockKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration lock: %v", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	status := new(MigrationStatus)
+	if err := json.Unmarshal(entry.Value, status); err != nil {
+		return nil, fmt.Errorf("failed to decode migration lock: %v", err)
+	}
+	return status, nil
+}
+
+func writeMigrationStatus(b Backend, status *MigrationStatus) error {
+	value, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	if err := b.Put(&Entry{Key: MigrationLockKey, Value: value}); err != nil {
+		return fmt.Errorf("failed to write migration lock: %v", err)
+	}
+	return nil
+}
+
+// Migrate copies all the entries of the source storage to the destination.
+// The destination must be empty, unless it holds a migration from the same
+// source which was interrupted; that migration is then resumed from its last
+// checkpoint. Vault must not be running with either storage.
+func Migrate(source, dest Backend, logger log.Logger) error {
+	sourceStatus, err := ReadMigrationStatus(source)
+	if err != nil {
+		return err
+	}
+	destStatus, err := ReadMigrationStatus(dest)
+	if err != nil {
+		return err
+	}
+
+	var status *MigrationStatus
+	switch {
+	case destStatus == nil:
+		if sourceStatus != nil {
+			return fmt.Errorf("source storage is locked by another migration started at %s; reset it if that migration was abandoned", sourceStatus.Start.Format(time.RFC3339))
+		}
+		keys, err := dest.List("")
+		if err != nil {
+			return fmt.Errorf("failed to list destination storage: %v", err)
+		}
+		if len(keys) != 0 {
+			return fmt.Errorf("destination storage is not empty")
+		}
+
+		id, err := uuid.GenerateUUID()
+		if err != nil {
+			return err
+		}
+		status = &MigrationStatus{
+			ID:    id,
+			Start: time.Now().UTC(),
+		}
+
+		// Lock the source first, so that a destination holding the lock
+		// always has a matching source
+		if err := writeMigrationStatus(source, status); err != nil {
+			return err
+		}
+		if err := writeMigrationStatus(dest, status); err != nil {
+			return err
+		}
+		logger.Info("migration: starting storage migration", "id", status.ID)
+
+	case sourceStatus == nil || sourceStatus.ID != destStatus.ID:
+		return fmt.Errorf("destination storage holds an interrupted migration from another source")
+
+	default:
+		status = destStatus
+		logger.Info("migration: resuming interrupted storage migration", "id", status.ID, "checkpoint", status.Checkpoint)
+	}
+
+	keys, err := collectKeys(source, "")
+	if err != nil {
+		return fmt.Errorf("failed to list source storage: %v", err)
+	}
+
+	copied := 0
+	for _, key := range keys {
+		if key == MigrationLockKey || key <= status.Checkpoint {
+			continue
+		}
+
+		entry, err := source.Get(key)
+		if err != nil {
+			return fmt.Errorf("failed to read %q from source storage: %v", key, err)
+		}
+		if entry == nil {
+			continue
+		}
+		if err := dest.Put(entry); err != nil {
+			return fmt.Errorf("failed to write %q to destination storage: %v", key, err)
+		}
+
+		copied++
+		if copied%migrationCheckpointInterval == 0 {
+			status.Checkpoint = key
+			if err := writeMigrationStatus(dest, status); err != nil {
+				return err
+			}
+			if logger.IsDebug() {
+				logger.Debug("migration: copied entries", "count", copied, "checkpoint", key)
+			}
+		}
+	}
+
+	if err := dest.Delete(MigrationLockKey); err != nil {
+		return fmt.Errorf("failed to remove migration lock of destination storage: %v", err)
+	}
+	if err := source.Delete(MigrationLockKey); err != nil {
+		return fmt.Errorf("failed to remove migration lock of source storage: %v", err)
+	}
+	logger.Info("migration: storage migration complete", "id", status.ID, "copied", copied)
+	return nil
+}
+
+// ResetMigration removes the migration locks of the given storages, so that
+// Vault can start with the source of an abandoned migration again. The
+// entries already copied to the destination are left as is.
+func ResetMigration(backends ...Backend) error {
+	for _, b := range backends {
+		if err := b.Delete(MigrationLockKey); err != nil {
+			return fmt.Errorf("failed to remove migration lock: %v", err)
+		}
+	}
+	return nil
+}
+
+// collectKeys returns all the keys under the prefix, sorted
+func collectKeys(b Backend, prefix string) ([]string, error) {
+	children, err := b.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, child := range children {
+		if strings.HasSuffix(child, "/") {
+			subKeys, err := collectKeys(b, prefix+child)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, subKeys...)
+		} else {
+			keys = append(keys, prefix+child)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,122 @@
+package physical
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	log "github.com/mgutz/logxi/v1"
+)
+
+// failingBackend fails the writes once a number of entries were written
+type failingBackend struct {
+	*InmemBackend
+	remaining int
+}
+
+func (f *failingBackend) Put(entry *Entry) error {
+	if entry.Key != MigrationLockKey {
+		if f.remaining == 0 {
+			return errors.New("injected failure")
+		}
+		f.remaining--
+	}
+	return f.InmemBackend.Put(entry)
+}
+
+func TestMigrate(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	source := NewInmem(logger)
+	for i := 0; i < 250; i++ {
+		key := fmt.Sprintf("logical/%03d", i)
+		if i%2 == 0 {
+			key = fmt.Sprintf("sys/token/%03d", i)
+		}
+		if err := source.Put(&Entry{Key: key, Value: []byte(key)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Interrupt the migration after the first checkpoint
+	dest := &failingBackend{InmemBackend: NewInmem(logger), remaining: 150}
+	if err := Migrate(source, dest, logger); err == nil {
+		t.Fatal("expected the migration to fail")
+	}
+	for _, b := range []Backend{source, dest} {
+		status, err := ReadMigrationStatus(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status == nil {
+			t.Fatal("expected a migration lock")
+		}
+	}
+	status, _ := ReadMigrationStatus(dest)
+	if status.Checkpoint == "" {
+		t.Fatal("expected a checkpoint")
+	}
+
+	// Another source can't use the destination
+	if err := Migrate(NewInmem(logger), dest, logger); err == nil {
+		t.Fatal("expected an error with another source")
+	}
+
+	// Resume the migration from the checkpoint
+	dest.remaining = 150
+	if err := Migrate(source, dest, logger); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := collectKeys(dest, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 250 {
+		t.Fatalf("expected 250 keys, got %d", len(keys))
+	}
+	for _, key := range keys {
+		entry, err := dest.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(entry.Value) != key {
+			t.Fatalf("bad value for %q: %q", key, entry.Value)
+		}
+	}
+	for _, b := range []Backend{source, dest} {
+		if status, err := ReadMigrationStatus(b); err != nil || status != nil {
+			t.Fatalf("expected the lock to be removed: %v %v", status, err)
+		}
+	}
+
+	// The destination is not empty anymore
+	if err := Migrate(source, dest, logger); err == nil {
+		t.Fatal("expected an error with a non-empty destination")
+	}
+}
+
+func TestResetMigration(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+
+	source := NewInmem(logger)
+	if err := source.Put(&Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatal(err)
+	}
+	dest := &failingBackend{InmemBackend: NewInmem(logger)}
+	if err := Migrate(source, dest, logger); err == nil {
+		t.Fatal("expected the migration to fail")
+	}
+
+	// The source is locked to other destinations until reset
+	if err := Migrate(source, NewInmem(logger), logger); err == nil {
+		t.Fatal("expected an error with a locked source")
+	}
+	if err := ResetMigration(source, dest); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(source, NewInmem(logger), logger); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,15 +1,18 @@
 package physical
 
 import (
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"net/url"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/mgutz/logxi/v1"
@@ -24,6 +27,10 @@ import (
 // Reserved values are "true", "false", "skip-verify"
 const mysqlTLSKey = "default"
 
+// MySQLLockMonitorInterval is the amount of time to wait between the checks
+// that a held lock wasn't lost with the connection holding it
+var MySQLLockMonitorInterval = 5 * time.Second
+
 // MySQLBackend is a physical backend that stores data
 // within MySQL database.
 type MySQLBackend struct {
@@ -32,6 +39,27 @@ type MySQLBackend struct {
 	statements map[string]*sql.Stmt
 	logger     log.Logger
 	permitPool *PermitPool
+
+	// dsn is used to open the dedicated connections holding the locks
+	dsn       string
+	haEnabled bool
+}
+
+// MySQLLock is a lock using the named locks of MySQL. Named locks belong to
+// the session which acquired them, so each lock uses a dedicated connection;
+// the lock is released by MySQL when the connection is lost. The value of
+// the lock is kept in the lock table, as named locks don't hold one.
+type MySQLLock struct {
+	backend    *MySQLBackend
+	key, value string
+
+	// name is the name of the MySQL lock, which is limited to 64 characters
+	name string
+
+	lock   sync.Mutex
+	held   bool
+	conn   *sql.DB
+	stopCh chan struct{}
 }
 
 // newMySQLBackend constructs a MySQL backend using the given API client and
@@ -79,15 +107,27 @@ func newMySQLBackend(conf map[string]string, logger log.Logger) (Backend, error)
 	}
 
 	dsnParams := url.Values{}
-	tlsCaFile, ok := conf["tls_ca_file"]
-	if ok {
-		if err := setupMySQLTLSConfig(tlsCaFile); err != nil {
+	if conf["tls_ca_file"] != "" || conf["tls_cert_file"] != "" || conf["tls_server_name"] != "" {
+		if err := setupMySQLTLSConfig(conf); err != nil {
 			return nil, fmt.Errorf("failed register TLS config: %v", err)
 		}
 
 		dsnParams.Add("tls", mysqlTLSKey)
 	}
 
+	haEnabled := false
+	if haEnabledStr, ok := conf["ha_enabled"]; ok {
+		haEnabled, err = strconv.ParseBool(haEnabledStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing ha_enabled parameter: {{err}}", err)
+		}
+	}
+	lockTable, ok := conf["lock_table"]
+	if !ok {
+		lockTable = "vault_lock"
+	}
+	dbLockTable := database + "." + lockTable
+
 	// Create MySQL handle for the database.
 	dsn := username + ":" + password + "@tcp(" + address + ")/?" + dsnParams.Encode()
 	db, err := sql.Open("mysql", dsn)
@@ -107,6 +147,15 @@ func newMySQLBackend(conf map[string]string, logger log.Logger) (Backend, error)
 		return nil, fmt.Errorf("failed to create mysql table: %v", err)
 	}
 
+	// Create the lock table if it doesn't exists.
+	if haEnabled {
+		create_query := "CREATE TABLE IF NOT EXISTS " + dbLockTable +
+			" (node_job varbinary(512), current_leader varbinary(512), PRIMARY KEY (node_job))"
+		if _, err := db.Exec(create_query); err != nil {
+			return nil, fmt.Errorf("failed to create mysql lock table: %v", err)
+		}
+	}
+
 	// Setup the backend.
 	m := &MySQLBackend{
 		dbTable:    dbTable,
@@ -114,6 +163,8 @@ func newMySQLBackend(conf map[string]string, logger log.Logger) (Backend, error)
 		statements: make(map[string]*sql.Stmt),
 		logger:     logger,
 		permitPool: NewPermitPool(maxParInt),
+		dsn:        dsn,
+		haEnabled:  haEnabled,
 	}
 
 	// Prepare all the statements required
@@ -124,6 +175,11 @@ func newMySQLBackend(conf map[string]string, logger log.Logger) (Backend, error)
 		"delete": "DELETE FROM " + dbTable + " WHERE vault_key = ?",
 		"list":   "SELECT vault_key FROM " + dbTable + " WHERE vault_key LIKE ?",
 	}
+	if haEnabled {
+		statements["lock_put"] = "INSERT INTO " + dbLockTable +
+			" VALUES( ?, ? ) ON DUPLICATE KEY UPDATE current_leader=VALUES(current_leader)"
+		statements["lock_get"] = "SELECT current_leader FROM " + dbLockTable + " WHERE node_job = ?"
+	}
 	for name, query := range statements {
 		if err := m.prepare(name, query); err != nil {
 			return nil, err
@@ -231,27 +287,168 @@ func (m *MySQLBackend) List(prefix string) ([]string, error) {
 	return keys, nil
 }
 
-// Establish a TLS connection with a given CA certificate
-// Register a tsl.Config associted with the same key as the dns param from sql.Open
-// foo:bar@tcp(127.0.0.1:3306)/dbname?tls=default
-func setupMySQLTLSConfig(tlsCaFile string) error {
-	rootCertPool := x509.NewCertPool()
+// setupMySQLTLSConfig registers the TLS configuration used by the
+// connections, under the same key as the tls param of the DSN given to
+// sql.Open: foo:bar@tcp(127.0.0.1:3306)/dbname?tls=default
+func setupMySQLTLSConfig(conf map[string]string) error {
+	tlsConfig := &tls.Config{
+		ServerName: conf["tls_server_name"],
+	}
 
-	pem, err := ioutil.ReadFile(tlsCaFile)
-	if err != nil {
-		return err
+	if tlsCaFile := conf["tls_ca_file"]; tlsCaFile != "" {
+		pem, err := ioutil.ReadFile(tlsCaFile)
+		if err != nil {
+			return err
+		}
+		rootCertPool := x509.NewCertPool()
+		if ok := rootCertPool.AppendCertsFromPEM(pem); !ok {
+			return fmt.Errorf("failed to parse CA certificate in %q", tlsCaFile)
+		}
+		tlsConfig.RootCAs = rootCertPool
 	}
 
-	if ok := rootCertPool.AppendCertsFromPEM(pem); !ok {
-		return err
+	certFile, keyFile := conf["tls_cert_file"], conf["tls_key_file"]
+	switch {
+	case certFile != "" && keyFile != "":
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case certFile != "" || keyFile != "":
+		return fmt.Errorf("both tls_cert_file and tls_key_file must be set")
 	}
 
-	err = mysql.RegisterTLSConfig(mysqlTLSKey, &tls.Config{
-		RootCAs: rootCertPool,
-	})
+	return mysql.RegisterTLSConfig(mysqlTLSKey, tlsConfig)
+}
+
+// HAEnabled indicates whether the HA functionality should be exposed.
+func (m *MySQLBackend) HAEnabled() bool {
+	return m.haEnabled
+}
+
+// LockWith is used for mutual exclusion based on the given key.
+func (m *MySQLBackend) LockWith(key, value string) (Lock, error) {
+	// The names of the locks are global to the MySQL server, so they are
+	// scoped to the table
+	sum := sha256.Sum256([]byte(m.dbTable + "/" + key))
+	return &MySQLLock{
+		backend: m,
+		key:     key,
+		value:   value,
+		name:    "vault-" + hex.EncodeToString(sum[:])[:32],
+	}, nil
+}
+
+// Lock tries to acquire the lock, blocking until either the stop channel is
+// closed or the lock could be acquired successfully. The returned channel
+// will be closed once the lock is lost.
+func (l *MySQLLock) Lock(stopCh <-chan struct{}) (<-chan struct{}, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.held {
+		return nil, fmt.Errorf("lock already held")
+	}
+
+	// Use a single connection, as the lock belongs to its session
+	conn, err := sql.Open("mysql", l.backend.dsn)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to connect to mysql: %v", err)
 	}
+	conn.SetMaxOpenConns(1)
+	conn.SetMaxIdleConns(1)
+
+	for {
+		// Wait at most one second for the lock, to check the stop channel
+		var acquired sql.NullInt64
+		if err := conn.QueryRow("SELECT GET_LOCK(?, 1)", l.name).Scan(&acquired); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to acquire lock: %v", err)
+		}
+		if acquired.Valid && acquired.Int64 == 1 {
+			break
+		}
 
-	return nil
+		select {
+		case <-stopCh:
+			conn.Close()
+			return nil, nil
+		default:
+		}
+	}
+
+	if _, err := l.backend.statements["lock_put"].Exec(l.key, l.value); err != nil {
+		conn.Exec("SELECT RELEASE_LOCK(?)", l.name)
+		conn.Close()
+		return nil, fmt.Errorf("failed to write lock value: %v", err)
+	}
+
+	l.held = true
+	l.conn = conn
+	l.stopCh = make(chan struct{})
+	leaderCh := make(chan struct{})
+	go l.monitor(conn, leaderCh, l.stopCh)
+	return leaderCh, nil
+}
+
+// monitor closes the leader channel when the lock is released, or lost
+// because the connection holding it was lost
+func (l *MySQLLock) monitor(conn *sql.DB, leaderCh, stopCh chan struct{}) {
+	defer close(leaderCh)
+
+	ticker := time.NewTicker(MySQLLockMonitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		// A new session, opened after the connection was lost, doesn't
+		// hold the lock
+		var held sql.NullBool
+		err := conn.QueryRow("SELECT IS_USED_LOCK(?) = CONNECTION_ID()", l.name).Scan(&held)
+		if err != nil || !held.Valid || !held.Bool {
+			l.backend.logger.Error("mysql: lock lost", "key", l.key, "error", err)
+			return
+		}
+	}
+}
+
+// Unlock releases the lock and closes its connection.
+func (l *MySQLLock) Unlock() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.held {
+		return nil
+	}
+
+	l.held = false
+	close(l.stopCh)
+	_, err := l.conn.Exec("SELECT RELEASE_LOCK(?)", l.name)
+	l.conn.Close()
+	return err
+}
+
+// Value checks whether or not the lock is held by any instance of MySQLLock,
+// including this one, and returns the current value.
+func (l *MySQLLock) Value() (bool, string, error) {
+	var used sql.NullInt64
+	if err := l.backend.client.QueryRow("SELECT IS_USED_LOCK(?)", l.name).Scan(&used); err != nil {
+		return false, "", err
+	}
+	if !used.Valid {
+		return false, "", nil
+	}
+
+	var value string
+	err := l.backend.statements["lock_get"].QueryRow(l.key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return true, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	return true, value, nil
 }
@@ -56,3 +56,54 @@ func TestMySQLBackend(t *testing.T) {
 	testBackend_ListPrefix(t, b)
 
 }
+
+func TestMySQLBackend_HA(t *testing.T) {
+	address := os.Getenv("MYSQL_ADDR")
+	if address == "" {
+		t.SkipNow()
+	}
+
+	database := os.Getenv("MYSQL_DB")
+	if database == "" {
+		database = "test"
+	}
+
+	table := os.Getenv("MYSQL_TABLE")
+	if table == "" {
+		table = "test"
+	}
+
+	username := os.Getenv("MYSQL_USERNAME")
+	password := os.Getenv("MYSQL_PASSWORD")
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	conf := map[string]string{
+		"address":    address,
+		"database":   database,
+		"table":      table,
+		"username":   username,
+		"password":   password,
+		"ha_enabled": "true",
+		"lock_table": table + "_lock",
+	}
+
+	b, err := NewBackend("mysql", logger, conf)
+	if err != nil {
+		t.Fatalf("Failed to create new backend: %v", err)
+	}
+	b2, err := NewBackend("mysql", logger, conf)
+	if err != nil {
+		t.Fatalf("Failed to create new backend: %v", err)
+	}
+
+	defer func() {
+		mysql := b.(*MySQLBackend)
+		for _, table := range []string{mysql.dbTable, mysql.dbTable + "_lock"} {
+			if _, err := mysql.client.Exec("DROP TABLE " + table); err != nil {
+				t.Fatalf("Failed to drop table: %v", err)
+			}
+		}
+	}()
+
+	testHABackend(t, b.(HABackend), b2.(HABackend))
+}
@@ -61,6 +61,14 @@ type Purgable interface {
 	Purge()
 }
 
+// ToggleableCache is an optional interface for caching backends which can be
+// disabled, such as on the performance standbys, whose storage is written by
+// the active node.
+type ToggleableCache interface {
+	Purgable
+	SetEnabled(bool)
+}
+
 // RedirectDetect is an optional interface that an HABackend
 // can implement. If they do, a redirect address can be automatically
 // detected.
@@ -146,15 +154,20 @@ var builtinBackends = map[string]Factory{
 	"file":                  newFileBackend,
 	"s3":                    newS3Backend,
 	"azure":                 newAzureBackend,
+	"cassandra":             newCassandraBackend,
 	"dynamodb":              newDynamoDBBackend,
 	"etcd":                  newEtcdBackend,
 	"mssql":                 newMsSQLBackend,
 	"mysql":                 newMySQLBackend,
 	"postgresql":            newPostgreSQLBackend,
+	"cockroachdb":           newCockroachDBBackend,
 	"couchdb":               newCouchDBBackend,
 	"couchdb_transactional": newTransactionalCouchDBBackend,
 	"swift":                 newSwiftBackend,
 	"gcs":                   newGCSBackend,
+	"spanner":               newSpannerBackend,
+	"foundationdb":          newFoundationDBBackend,
+	"raft":                  newRaftBackend,
 }
 
 // PermitPool is used to limit maximum outstanding requests
@@ -3,15 +3,32 @@ package physical
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/mgutz/logxi/v1"
 
 	"github.com/armon/go-metrics"
+	uuid "github.com/hashicorp/go-uuid"
 	"github.com/lib/pq"
 )
 
+const (
+	// PostgreSQLLockTTL is how long a lock is valid without being renewed.
+	// It matches the default that Consul API uses, 15 seconds.
+	PostgreSQLLockTTL = 15 * time.Second
+
+	// PostgreSQLLockRenewInterval is the amount of time to wait between the
+	// lock renewals
+	PostgreSQLLockRenewInterval = 5 * time.Second
+
+	// PostgreSQLLockRetryInterval is the amount of time to wait if a lock
+	// fails before trying again
+	PostgreSQLLockRetryInterval = time.Second
+)
+
 // PostgreSQL Backend is a physical backend that stores data
 // within a PostgreSQL database.
 type PostgreSQLBackend struct {
@@ -22,6 +39,31 @@ type PostgreSQLBackend struct {
 	delete_query string
 	list_query   string
 	logger       log.Logger
+
+	haEnabled       bool
+	ha_write_query  string
+	ha_get_query    string
+	ha_delete_query string
+}
+
+// PostgreSQLLock is a lock held in the HA table. Locks expire unless they are
+// renewed by their holder; the expiry is evaluated with the clock of the
+// database, so that the clocks of the Vault nodes don't need to agree.
+type PostgreSQLLock struct {
+	backend    *PostgreSQLBackend
+	value, key string
+	identity   string
+
+	lock sync.Mutex
+	held bool
+
+	// stopCh stops renewing the lock when it is released
+	stopCh chan struct{}
+
+	// Allow modifying the Lock durations for ease of unit testing.
+	renewInterval time.Duration
+	retryInterval time.Duration
+	ttl           time.Duration
 }
 
 // newPostgreSQLBackend constructs a PostgreSQL backend using the given
@@ -63,6 +105,24 @@ func newPostgreSQLBackend(conf map[string]string, logger log.Logger) (Backend, e
 			" UPDATE SET (parent_path, path, key, value) = ($1, $2, $3, $4)"
 	}
 
+	haEnabled := false
+	if haEnabledStr, ok := conf["ha_enabled"]; ok {
+		haEnabled, err = strconv.ParseBool(haEnabledStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing ha_enabled parameter: %v", err)
+		}
+	}
+	// The lock queries rely on the native upsert
+	if haEnabled && upsert_required {
+		return nil, fmt.Errorf("high availability requires PostgreSQL 9.5 or later")
+	}
+
+	unquoted_ha_table, ok := conf["ha_table"]
+	if !ok {
+		unquoted_ha_table = "vault_ha_locks"
+	}
+	quoted_ha_table := pq.QuoteIdentifier(unquoted_ha_table)
+
 	// Setup the backend.
 	m := &PostgreSQLBackend{
 		table:        quoted_table,
@@ -73,7 +133,17 @@ func newPostgreSQLBackend(conf map[string]string, logger log.Logger) (Backend, e
 		list_query: "SELECT key FROM " + quoted_table + " WHERE path = $1" +
 			"UNION SELECT DISTINCT substring(substr(path, length($1)+1) from '^.*?/') FROM " +
 			quoted_table + " WHERE parent_path LIKE concat($1, '%')",
-		logger: logger,
+		logger:    logger,
+		haEnabled: haEnabled,
+		// The lock is only taken over from another identity once it has
+		// expired
+		ha_write_query: "INSERT INTO " + quoted_ha_table + " (ha_identity, ha_key, ha_value, valid_until)" +
+			" VALUES ($1, $2, $3, now() + $4 * interval '1 millisecond')" +
+			" ON CONFLICT (ha_key) DO" +
+			" UPDATE SET (ha_identity, ha_value, valid_until) = ($1, $3, now() + $4 * interval '1 millisecond')" +
+			" WHERE " + quoted_ha_table + ".valid_until < now() OR " + quoted_ha_table + ".ha_identity = $1",
+		ha_get_query:    "SELECT ha_value FROM " + quoted_ha_table + " WHERE ha_key = $1 AND valid_until >= now()",
+		ha_delete_query: "DELETE FROM " + quoted_ha_table + " WHERE ha_key = $1 AND ha_identity = $2",
 	}
 
 	return m, nil
@@ -175,3 +245,138 @@ func (m *PostgreSQLBackend) List(prefix string) ([]string, error) {
 
 	return keys, nil
 }
+
+// HAEnabled indicates whether the HA functionality should be exposed.
+func (m *PostgreSQLBackend) HAEnabled() bool {
+	return m.haEnabled
+}
+
+// LockWith is used for mutual exclusion based on the given key.
+func (m *PostgreSQLBackend) LockWith(key, value string) (Lock, error) {
+	identity, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	return &PostgreSQLLock{
+		backend:       m,
+		key:           key,
+		value:         value,
+		identity:      identity,
+		renewInterval: PostgreSQLLockRenewInterval,
+		retryInterval: PostgreSQLLockRetryInterval,
+		ttl:           PostgreSQLLockTTL,
+	}, nil
+}
+
+// Lock tries to acquire the lock by repeatedly trying to write it to the HA
+// table. It will block until either the stop channel is closed or the lock
+// could be acquired successfully. The returned channel will be closed once
+// the lock is lost.
+func (l *PostgreSQLLock) Lock(stopCh <-chan struct{}) (<-chan struct{}, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.held {
+		return nil, fmt.Errorf("lock already held")
+	}
+
+	ticker := time.NewTicker(l.retryInterval)
+	defer ticker.Stop()
+	for {
+		acquired, err := l.writeLock()
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			break
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return nil, nil
+		}
+	}
+
+	l.held = true
+	l.stopCh = make(chan struct{})
+	leaderCh := make(chan struct{})
+	go l.periodicallyRenewLock(leaderCh, l.stopCh)
+	return leaderCh, nil
+}
+
+// Unlock releases the lock by deleting it from the HA table.
+func (l *PostgreSQLLock) Unlock() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.held {
+		return nil
+	}
+
+	l.held = false
+	close(l.stopCh)
+	_, err := l.backend.client.Exec(l.backend.ha_delete_query, l.key, l.identity)
+	return err
+}
+
+// Value checks whether or not the lock is held by any instance of
+// PostgreSQLLock, including this one, and returns the current value.
+func (l *PostgreSQLLock) Value() (bool, string, error) {
+	var value string
+	err := l.backend.client.QueryRow(l.backend.ha_get_query, l.key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	return true, value, nil
+}
+
+// writeLock creates the lock, or renews it if it is already held by this
+// instance. It returns false if another instance holds the lock.
+func (l *PostgreSQLLock) writeLock() (bool, error) {
+	res, err := l.backend.client.Exec(l.backend.ha_write_query,
+		l.identity, l.key, l.value, int64(l.ttl/time.Millisecond))
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// periodicallyRenewLock renews the lock until it is released, and closes the
+// leader channel when it is lost: either taken over by another instance, or
+// not renewed in time because of errors.
+func (l *PostgreSQLLock) periodicallyRenewLock(leaderCh, stopCh chan struct{}) {
+	defer close(leaderCh)
+
+	ticker := time.NewTicker(l.renewInterval)
+	defer ticker.Stop()
+
+	lastRenewal := time.Now()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		acquired, err := l.writeLock()
+		switch {
+		case err != nil:
+			l.backend.logger.Warn("postgresql: failed to renew lock", "key", l.key, "error", err)
+			if time.Since(lastRenewal) < l.ttl {
+				continue
+			}
+			l.backend.logger.Error("postgresql: lock expired", "key", l.key)
+			return
+		case !acquired:
+			l.backend.logger.Error("postgresql: lock taken over by another instance", "key", l.key)
+			return
+		}
+		lastRenewal = time.Now()
+	}
+}
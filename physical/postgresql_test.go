@@ -45,3 +45,45 @@ func TestPostgreSQLBackend(t *testing.T) {
 	testBackend_ListPrefix(t, b)
 
 }
+
+func TestPostgreSQLBackend_HA(t *testing.T) {
+	connURL := os.Getenv("PGURL")
+	if connURL == "" {
+		t.SkipNow()
+	}
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	conf := map[string]string{
+		"connection_url": connURL,
+		"ha_enabled":     "true",
+		"ha_table":       "vault_ha_locks_test",
+	}
+
+	b, err := NewBackend("postgresql", logger, conf)
+	if err != nil {
+		t.Fatalf("Failed to create new backend: %v", err)
+	}
+	b2, err := NewBackend("postgresql", logger, conf)
+	if err != nil {
+		t.Fatalf("Failed to create new backend: %v", err)
+	}
+
+	pg := b.(*PostgreSQLBackend)
+	_, err = pg.client.Exec(`CREATE TABLE vault_ha_locks_test (
+		ha_key      TEXT COLLATE "C" NOT NULL,
+		ha_identity TEXT COLLATE "C" NOT NULL,
+		ha_value    TEXT COLLATE "C",
+		valid_until TIMESTAMP WITH TIME ZONE NOT NULL,
+		CONSTRAINT ha_key PRIMARY KEY (ha_key)
+	)`)
+	if err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	defer func() {
+		if _, err := pg.client.Exec("DROP TABLE vault_ha_locks_test"); err != nil {
+			t.Fatalf("Failed to drop table: %v", err)
+		}
+	}()
+
+	testHABackend(t, b.(HABackend), b2.(HABackend))
+}
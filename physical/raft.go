@@ -0,0 +1,585 @@
+package physical
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/mgutz/logxi/v1"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/parseutil"
+)
+
+const (
+	// DefaultRaftAddress is the default address of the raft listener
+	DefaultRaftAddress = "127.0.0.1:8202"
+
+	// raftJoinAttempts is how many times joining nodes follow the redirects
+	// of followers to the leader
+	raftJoinAttempts = 5
+)
+
+// RaftBackend is a physical backend storing data in a raft cluster formed by
+// the Vault nodes themselves, so that Vault can run HA without an external
+// storage service. The leader of the cluster holds the HA lock, and is the
+// only node serving writes; all the nodes read their local copy of the data.
+type RaftBackend struct {
+	logger     log.Logger
+	node       *raftNode
+	permitPool *PermitPool
+	haEnabled  bool
+	autopilot  *raftAutopilot
+
+	// redundancyZone is the redundancy zone of the node, in which autopilot
+	// keeps a single voter
+	redundancyZone string
+}
+
+// RaftServer describes a member of the raft cluster
+type RaftServer struct {
+	NodeID         string `json:"node_id" structs:"node_id" mapstructure:"node_id"`
+	Address        string `json:"address" structs:"address" mapstructure:"address"`
+	Leader         bool   `json:"leader" structs:"leader" mapstructure:"leader"`
+	Voter          bool   `json:"voter" structs:"voter" mapstructure:"voter"`
+	RedundancyZone string `json:"redundancy_zone,omitempty" structs:"redundancy_zone" mapstructure:"redundancy_zone"`
+}
+
+// RaftConfiguration is the membership of the raft cluster
+type RaftConfiguration struct {
+	Servers []*RaftServer `json:"servers" structs:"servers" mapstructure:"servers"`
+	Index   uint64        `json:"index" structs:"index" mapstructure:"index"`
+}
+
+// newRaftBackend constructs a RaftBackend, starting its node
+func newRaftBackend(conf map[string]string, logger log.Logger) (Backend, error) {
+	return NewRaftBackend(conf, logger)
+}
+
+// NewRaftBackend constructs a RaftBackend, starting its node
+func NewRaftBackend(conf map[string]string, logger log.Logger) (*RaftBackend, error) {
+	path, ok := conf["path"]
+	if !ok {
+		return nil, fmt.Errorf("'path' must be set")
+	}
+
+	address, ok := conf["address"]
+	if !ok {
+		address = DefaultRaftAddress
+	}
+	advertiseAddress, ok := conf["advertise_address"]
+	if !ok {
+		advertiseAddress = address
+	}
+	if host, _, err := net.SplitHostPort(advertiseAddress); err != nil {
+		return nil, fmt.Errorf("invalid raft advertise address %q: %v", advertiseAddress, err)
+	} else if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		return nil, fmt.Errorf("'advertise_address' must be set when listening on all interfaces")
+	}
+
+	haEnabled := true
+	if haEnabledStr, ok := conf["ha_enabled"]; ok {
+		var err error
+		haEnabled, err = strconv.ParseBool(haEnabledStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing ha_enabled parameter: %v", err)
+		}
+	}
+
+	multiplier := 1
+	if multiplierStr, ok := conf["performance_multiplier"]; ok {
+		var err error
+		multiplier, err = strconv.Atoi(multiplierStr)
+		if err != nil || multiplier < 1 || multiplier > 10 {
+			return nil, fmt.Errorf("performance_multiplier must be an integer between 1 and 10")
+		}
+	}
+
+	snapshotThreshold := uint64(raftDefaultSnapshotThreshold)
+	if thresholdStr, ok := conf["snapshot_threshold"]; ok {
+		var err error
+		snapshotThreshold, err = strconv.ParseUint(thresholdStr, 10, 64)
+		if err != nil || snapshotThreshold == 0 {
+			return nil, fmt.Errorf("snapshot_threshold must be a positive integer")
+		}
+	}
+
+	maxParInt := DefaultParallelOperations
+	if maxParStr, ok := conf["max_parallel"]; ok {
+		var err error
+		maxParInt, err = strconv.Atoi(maxParStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing max_parallel parameter: %v", err)
+		}
+		if logger.IsDebug() {
+			logger.Debug("raft: max_parallel set", "max_parallel", maxParInt)
+		}
+	}
+
+	var tlsConfig *raftTLSConfig
+	tlsDisable := false
+	if tlsDisableStr, ok := conf["tls_disable"]; ok {
+		var err error
+		tlsDisable, err = parseutil.ParseBool(tlsDisableStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing tls_disable parameter: %v", err)
+		}
+	}
+	if !tlsDisable {
+		if conf["tls_cert_file"] == "" || conf["tls_key_file"] == "" || conf["tls_ca_file"] == "" {
+			return nil, fmt.Errorf("'tls_cert_file', 'tls_key_file' and 'tls_ca_file' must be set unless 'tls_disable' is set")
+		}
+		var err error
+		tlsConfig, err = newRaftTLSConfig(conf["tls_cert_file"], conf["tls_key_file"], conf["tls_ca_file"])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	store, entries, err := openRaftStore(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ID of the node is persisted, and can't be changed once set
+	nodeID, err := store.readNodeID()
+	if err != nil {
+		store.close()
+		return nil, err
+	}
+	if confNodeID := conf["node_id"]; nodeID != "" && confNodeID != "" && confNodeID != nodeID {
+		store.close()
+		return nil, fmt.Errorf("node_id %q does not match the ID %q of the existing raft node", confNodeID, nodeID)
+	}
+	if nodeID == "" {
+		nodeID = conf["node_id"]
+		if nodeID == "" {
+			if nodeID, err = uuid.GenerateUUID(); err != nil {
+				store.close()
+				return nil, fmt.Errorf("failed to generate node ID: %v", err)
+			}
+		}
+		if err := store.writeNodeID(nodeID); err != nil {
+			store.close()
+			return nil, err
+		}
+	}
+
+	transport, err := newRaftTransport(address, tlsConfig)
+	if err != nil {
+		store.close()
+		return nil, err
+	}
+
+	node, err := newRaftNode(nodeID, advertiseAddress, store, entries, transport, multiplier, snapshotThreshold, logger)
+	if err != nil {
+		transport.close()
+		store.close()
+		return nil, err
+	}
+
+	b := &RaftBackend{
+		logger:         logger,
+		node:           node,
+		permitPool:     NewPermitPool(maxParInt),
+		haEnabled:      haEnabled,
+		redundancyZone: conf["autopilot_redundancy_zone"],
+	}
+	b.autopilot = newRaftAutopilot(b)
+	go b.autopilot.run()
+
+	return b, nil
+}
+
+// Put is used to insert or update an entry
+func (b *RaftBackend) Put(entry *Entry) error {
+	b.permitPool.Acquire()
+	defer b.permitPool.Release()
+
+	return b.node.applyCommand(&raftCommand{
+		Ops: []raftOperation{
+			{
+				Op:    raftOpPut,
+				Key:   entry.Key,
+				Value: entry.Value,
+			},
+		},
+	})
+}
+
+// Get is used to fetch an entry
+func (b *RaftBackend) Get(key string) (*Entry, error) {
+	b.permitPool.Acquire()
+	defer b.permitPool.Release()
+
+	value, ok := b.node.fsm.get(key)
+	if !ok {
+		return nil, nil
+	}
+	return &Entry{
+		Key:   key,
+		Value: append([]byte(nil), value...),
+	}, nil
+}
+
+// Delete is used to permanently delete an entry
+func (b *RaftBackend) Delete(key string) error {
+	b.permitPool.Acquire()
+	defer b.permitPool.Release()
+
+	return b.node.applyCommand(&raftCommand{
+		Ops: []raftOperation{
+			{
+				Op:  raftOpDelete,
+				Key: key,
+			},
+		},
+	})
+}
+
+// List is used to list all the keys under a given
+// prefix, up to the next prefix.
+func (b *RaftBackend) List(prefix string) ([]string, error) {
+	b.permitPool.Acquire()
+	defer b.permitPool.Release()
+
+	return b.node.fsm.list(prefix), nil
+}
+
+// Transaction atomically applies the entries via a single log entry
+func (b *RaftBackend) Transaction(txns []TxnEntry) error {
+	b.permitPool.Acquire()
+	defer b.permitPool.Release()
+
+	cmd := &raftCommand{
+		Ops: make([]raftOperation, 0, len(txns)),
+	}
+	for _, txn := range txns {
+		switch txn.Operation {
+		case PutOperation:
+			cmd.Ops = append(cmd.Ops, raftOperation{
+				Op:    raftOpPut,
+				Key:   txn.Entry.Key,
+				Value: txn.Entry.Value,
+			})
+		case DeleteOperation:
+			cmd.Ops = append(cmd.Ops, raftOperation{
+				Op:  raftOpDelete,
+				Key: txn.Entry.Key,
+			})
+		default:
+			return fmt.Errorf("%q is not a supported transaction operation", txn.Operation)
+		}
+	}
+	return b.node.applyCommand(cmd)
+}
+
+// NodeID returns the ID of the raft node
+func (b *RaftBackend) NodeID() string {
+	return b.node.id
+}
+
+// Initialized returns whether the node is bootstrapped or part of a cluster
+func (b *RaftBackend) Initialized() bool {
+	return b.node.hasState()
+}
+
+// Bootstrap starts a new cluster made of this node only, and waits for the
+// node to lead it. Nodes which are already bootstrapped or part of a
+// cluster are left as is.
+func (b *RaftBackend) Bootstrap() error {
+	err := b.node.bootstrap(raftConfiguration{
+		Servers: []raftServer{
+			{
+				ID:             b.node.id,
+				Address:        b.node.address,
+				RedundancyZone: b.redundancyZone,
+			},
+		},
+	})
+	switch err {
+	case nil:
+		b.logger.Info("raft: bootstrapped new cluster", "node_id", b.node.id)
+	case errRaftAlreadyBootstrapped:
+		return nil
+	default:
+		return err
+	}
+
+	if err := b.WaitForLeadership(5 * b.node.electionTimeout); err != nil {
+		return fmt.Errorf("timed out waiting for the raft node to lead the new cluster")
+	}
+	return nil
+}
+
+// WaitForLeadership waits for the node to lead its cluster, which is needed
+// to write to the storage when Vault isn't running, such as when migrating
+// data to it
+func (b *RaftBackend) WaitForLeadership(timeout time.Duration) error {
+	timeoutCh := time.After(timeout)
+	for {
+		leaderCh, stateCh := b.node.leadership()
+		if leaderCh != nil {
+			return nil
+		}
+		select {
+		case <-stateCh:
+		case <-timeoutCh:
+			return fmt.Errorf("timed out waiting for the raft node to become the leader")
+		}
+	}
+}
+
+// Join asks the raft cluster, via the node with the given raft address, to
+// add this node to the cluster. Nodes joining as non-voters replicate the
+// data but don't take part in the elections nor in the quorum, which makes
+// them suited to scale reads or to stand by as warm spares.
+func (b *RaftBackend) Join(leaderAddress string, nonVoter bool) error {
+	if b.node.hasState() {
+		return errRaftAlreadyBootstrapped
+	}
+
+	req := &raftJoinRequest{
+		ID:             b.node.id,
+		Address:        b.node.address,
+		NonVoter:       nonVoter,
+		RedundancyZone: b.redundancyZone,
+	}
+	address := leaderAddress
+	for i := 0; i < raftJoinAttempts; i++ {
+		resp := new(raftJoinResponse)
+		if err := b.node.transport.call(address, raftRPCJoin, req, resp, 10*b.node.electionTimeout); err != nil {
+			return fmt.Errorf("failed to join the raft cluster via %q: %v", address, err)
+		}
+		switch {
+		case resp.Error == "":
+			b.logger.Info("raft: joined cluster", "leader_address", address)
+			return nil
+		case resp.LeaderAddress != "" && resp.LeaderAddress != address:
+			address = resp.LeaderAddress
+		default:
+			return fmt.Errorf("failed to join the raft cluster via %q: %s", address, resp.Error)
+		}
+	}
+	return fmt.Errorf("failed to join the raft cluster: too many redirects")
+}
+
+// Configuration returns the latest membership of the cluster
+func (b *RaftBackend) Configuration() *RaftConfiguration {
+	n := b.node
+	n.l.Lock()
+	defer n.l.Unlock()
+
+	config := &RaftConfiguration{
+		Servers: make([]*RaftServer, 0, len(n.config.Servers)),
+		Index:   n.configIndex,
+	}
+	for _, s := range n.config.Servers {
+		config.Servers = append(config.Servers, &RaftServer{
+			NodeID:         s.ID,
+			Address:        s.Address,
+			Leader:         s.ID == n.leaderID,
+			Voter:          !s.NonVoter,
+			RedundancyZone: s.RedundancyZone,
+		})
+	}
+	return config
+}
+
+// RemovePeer removes a node from the cluster
+func (b *RaftBackend) RemovePeer(nodeID string) error {
+	return b.node.removeServer(nodeID)
+}
+
+// TransferLeadership hands the leadership of the cluster over to the node
+// with the given ID, or to the most up to date voter if the ID is empty
+func (b *RaftBackend) TransferLeadership(nodeID string) error {
+	return b.node.transferLeadership(nodeID)
+}
+
+// Snapshot returns a snapshot of the data, as gzipped JSON
+func (b *RaftBackend) Snapshot() ([]byte, error) {
+	n := b.node
+	n.l.Lock()
+	snapshot := n.snapshotLocked()
+	n.l.Unlock()
+
+	return encodeRaftSnapshot(snapshot)
+}
+
+// SnapshotData decodes a snapshot, returning its data
+func SnapshotData(snapshot []byte) (map[string][]byte, error) {
+	decoded, err := decodeRaftSnapshot(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return decoded.Data, nil
+}
+
+// Restore replaces the data of the cluster with the data of a snapshot. The
+// membership of the cluster and the HA locks are not restored.
+func (b *RaftBackend) Restore(snapshot []byte) error {
+	if _, err := decodeRaftSnapshot(snapshot); err != nil {
+		return err
+	}
+
+	return b.node.applyCommand(&raftCommand{
+		Ops: []raftOperation{
+			{
+				Op:    raftOpRestore,
+				Value: snapshot,
+			},
+		},
+	})
+}
+
+// Close shuts the raft node down
+func (b *RaftBackend) Close() error {
+	return b.node.close()
+}
+
+// LockWith is used for mutual exclusion based on the given key.
+func (b *RaftBackend) LockWith(key, value string) (Lock, error) {
+	return &RaftLock{
+		b:     b,
+		key:   key,
+		value: value,
+	}, nil
+}
+
+// HAEnabled indicates whether the HA functionality should be exposed.
+func (b *RaftBackend) HAEnabled() bool {
+	return b.haEnabled
+}
+
+// RaftLock is an HA lock which is only held by the leader of the raft
+// cluster
+type RaftLock struct {
+	b     *RaftBackend
+	key   string
+	value string
+
+	l        sync.Mutex
+	held     bool
+	leaderCh chan struct{}
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+}
+
+// Lock waits for the node to lead the cluster, and records the lock. The
+// returned channel is closed once the node loses the leadership.
+func (l *RaftLock) Lock(stopCh <-chan struct{}) (<-chan struct{}, error) {
+	l.l.Lock()
+	defer l.l.Unlock()
+
+	if l.held {
+		return nil, fmt.Errorf("lock already held")
+	}
+
+	n := l.b.node
+	n.addLockInterest(1)
+	for {
+		raftLeaderCh, stateCh := n.leadership()
+		if raftLeaderCh != nil {
+			err := n.applyCommand(&raftCommand{
+				Ops: []raftOperation{
+					{
+						Op:     raftOpLock,
+						Key:    l.key,
+						Value:  []byte(l.value),
+						NodeID: n.id,
+					},
+				},
+			})
+			switch err {
+			case nil:
+				// Let the standbys learn about the new lock holder
+				n.waitCommitPropagated()
+				l.held = true
+				l.leaderCh = make(chan struct{})
+				l.stopCh = make(chan struct{})
+				l.doneCh = make(chan struct{})
+				go l.monitor(raftLeaderCh, l.leaderCh, l.stopCh, l.doneCh)
+				return l.leaderCh, nil
+			case errRaftNotLeader, errRaftLeadershipLost, errRaftLeadershipTransfer:
+				continue
+			default:
+				n.addLockInterest(-1)
+				return nil, err
+			}
+		}
+
+		select {
+		case <-stateCh:
+		case <-stopCh:
+			n.addLockInterest(-1)
+			return nil, nil
+		case <-n.shutdownCh:
+			n.addLockInterest(-1)
+			return nil, errRaftShutdown
+		}
+	}
+}
+
+// monitor closes the leader channel of the lock when the node loses the
+// leadership, or when the lock is released
+func (l *RaftLock) monitor(raftLeaderCh <-chan struct{}, leaderCh, stopCh, doneCh chan struct{}) {
+	select {
+	case <-raftLeaderCh:
+	case <-stopCh:
+	}
+	close(leaderCh)
+	close(doneCh)
+}
+
+// Unlock releases the lock, handing the leadership of the cluster over to
+// another voter so that another node may acquire the lock
+func (l *RaftLock) Unlock() error {
+	l.l.Lock()
+	defer l.l.Unlock()
+
+	if !l.held {
+		return nil
+	}
+	close(l.stopCh)
+	<-l.doneCh
+	l.held = false
+
+	n := l.b.node
+	n.addLockInterest(-1)
+	err := n.applyCommand(&raftCommand{
+		Ops: []raftOperation{
+			{
+				Op:    raftOpUnlock,
+				Key:   l.key,
+				Value: []byte(l.value),
+			},
+		},
+	})
+	if err != nil {
+		// The leadership was lost, along with the lock
+		return nil
+	}
+
+	if err := n.transferLeadership(""); err != nil {
+		l.b.logger.Debug("raft: not transferring leadership after releasing the lock", "error", err)
+	}
+	return nil
+}
+
+// Value returns the value of the lock, which is only held while its holder
+// leads the cluster
+func (l *RaftLock) Value() (bool, string, error) {
+	lock := l.b.node.fsm.lock(l.key)
+	if lock == nil {
+		return false, "", nil
+	}
+
+	n := l.b.node
+	n.l.Lock()
+	leaderID := n.leaderID
+	n.l.Unlock()
+	return lock.NodeID == leaderID, lock.Value, nil
+}
@@ -0,0 +1,433 @@
+package physical
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// raftAutopilotInterval is how often autopilot evaluates the servers of
+	// the cluster
+	raftAutopilotInterval = 10 * time.Second
+)
+
+const (
+	RaftServerStatusLeader   = "leader"
+	RaftServerStatusVoter    = "voter"
+	RaftServerStatusNonVoter = "non-voter"
+	RaftServerStatusStaging  = "staging"
+)
+
+// RaftAutopilotConfig tunes autopilot, which runs on the leader of the
+// cluster to evaluate the health of the servers, promote the new servers to
+// voters once they are stable, and remove the dead servers
+type RaftAutopilotConfig struct {
+	// CleanupDeadServers enables the removal of the dead servers
+	CleanupDeadServers bool `json:"cleanup_dead_servers"`
+
+	// LastContactThreshold is how long a server may go without contacting
+	// the leader before being unhealthy
+	LastContactThreshold time.Duration `json:"last_contact_threshold"`
+
+	// DeadServerLastContactThreshold is how long a server may go without
+	// contacting the leader before being removed, when the dead servers are
+	// cleaned up
+	DeadServerLastContactThreshold time.Duration `json:"dead_server_last_contact_threshold"`
+
+	// MaxTrailingLogs is how many log entries a server may lag behind the
+	// leader before being unhealthy
+	MaxTrailingLogs uint64 `json:"max_trailing_logs"`
+
+	// MinQuorum is the number of voters below which dead voters are not
+	// removed
+	MinQuorum int `json:"min_quorum"`
+
+	// ServerStabilizationTime is how long a new server must be healthy before
+	// being promoted to a voter
+	ServerStabilizationTime time.Duration `json:"server_stabilization_time"`
+}
+
+// DefaultRaftAutopilotConfig returns the autopilot configuration of the
+// clusters which were not configured
+func DefaultRaftAutopilotConfig() *RaftAutopilotConfig {
+	return &RaftAutopilotConfig{
+		CleanupDeadServers:             false,
+		LastContactThreshold:           10 * time.Second,
+		DeadServerLastContactThreshold: 24 * time.Hour,
+		MaxTrailingLogs:                1000,
+		MinQuorum:                      0,
+		ServerStabilizationTime:        10 * time.Second,
+	}
+}
+
+// RaftAutopilotServer is the health of a server of the cluster, as seen by
+// the leader
+type RaftAutopilotServer struct {
+	NodeID      string        `json:"node_id"`
+	Address     string        `json:"address"`
+	Status      string        `json:"status"`
+	Healthy     bool          `json:"healthy"`
+	LastContact time.Duration `json:"last_contact"`
+	LastIndex   uint64        `json:"last_index"`
+
+	RedundancyZone string `json:"redundancy_zone,omitempty"`
+
+	// StableSince is when the server became healthy, and is zero for
+	// unhealthy servers
+	StableSince time.Time `json:"stable_since"`
+}
+
+// RaftAutopilotState is the health of the cluster, as seen by the leader
+type RaftAutopilotState struct {
+	// Healthy is set when all the voters are healthy
+	Healthy bool `json:"healthy"`
+
+	// FailureTolerance is how many voters may fail without the cluster
+	// losing its quorum
+	FailureTolerance int                             `json:"failure_tolerance"`
+	Leader           string                          `json:"leader"`
+	Voters           []string                        `json:"voters"`
+	Servers          map[string]*RaftAutopilotServer `json:"servers"`
+
+	// RedundancyZones are the redundancy zones of the servers
+	RedundancyZones map[string]*RaftAutopilotZone `json:"redundancy_zones"`
+}
+
+// RaftAutopilotZone is the health of a redundancy zone, in which autopilot
+// keeps a single voter while the other servers stand by to replace it
+type RaftAutopilotZone struct {
+	Servers []string `json:"servers"`
+	Voters  []string `json:"voters"`
+
+	// FailureTolerance is how many servers of the zone may fail without the
+	// zone losing its voter
+	FailureTolerance int `json:"failure_tolerance"`
+}
+
+// raftAutopilot keeps track of the health of the servers while the node
+// leads the cluster
+type raftAutopilot struct {
+	b        *RaftBackend
+	interval time.Duration
+
+	l            sync.Mutex
+	config       *RaftAutopilotConfig
+	term         uint64
+	healthySince map[string]time.Time
+}
+
+func newRaftAutopilot(b *RaftBackend) *raftAutopilot {
+	return &raftAutopilot{
+		b:            b,
+		interval:     raftAutopilotInterval,
+		config:       DefaultRaftAutopilotConfig(),
+		healthySince: make(map[string]time.Time),
+	}
+}
+
+// run evaluates the servers periodically until the node is shut down
+func (a *raftAutopilot) run() {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.b.node.shutdownCh:
+			return
+		case <-ticker.C:
+		}
+
+		a.l.Lock()
+		state := a.evaluateLocked(time.Now())
+		config := *a.config
+		a.l.Unlock()
+		if state == nil {
+			continue
+		}
+
+		// Only one configuration change may be in progress at a time
+		if !a.promoteStableServers(state, &config) && !a.demoteRedundantVoters(state) {
+			a.removeDeadServers(state, &config)
+		}
+	}
+}
+
+// evaluateLocked evaluates the health of the servers, returning nil when
+// the node does not lead the cluster
+func (a *raftAutopilot) evaluateLocked(now time.Time) *RaftAutopilotState {
+	n := a.b.node
+	n.l.Lock()
+	defer n.l.Unlock()
+
+	if n.state != raftLeader {
+		a.healthySince = make(map[string]time.Time)
+		return nil
+	}
+	// The health tracked in previous terms is stale
+	if a.term != n.currentTerm {
+		a.term = n.currentTerm
+		a.healthySince = make(map[string]time.Time)
+	}
+
+	lastIndex := n.lastIndexLocked()
+	state := &RaftAutopilotState{
+		Leader:          n.id,
+		Voters:          []string{},
+		Servers:         make(map[string]*RaftAutopilotServer, len(n.config.Servers)),
+		RedundancyZones: make(map[string]*RaftAutopilotZone),
+	}
+	healthyVoters := 0
+	for _, s := range n.config.Servers {
+		server := &RaftAutopilotServer{
+			NodeID:         s.ID,
+			Address:        s.Address,
+			LastIndex:      lastIndex,
+			RedundancyZone: s.RedundancyZone,
+		}
+		switch {
+		case s.ID == n.id:
+			server.Status = RaftServerStatusLeader
+		case s.Staging:
+			server.Status = RaftServerStatusStaging
+		case s.NonVoter:
+			server.Status = RaftServerStatusNonVoter
+		default:
+			server.Status = RaftServerStatusVoter
+		}
+		if s.ID != n.id {
+			r, ok := n.replicators[s.ID]
+			if !ok {
+				continue
+			}
+			server.LastContact = now.Sub(r.lastContact)
+			server.LastIndex = r.matchIndex
+		}
+
+		server.Healthy = server.LastContact <= a.config.LastContactThreshold &&
+			lastIndex-server.LastIndex <= a.config.MaxTrailingLogs
+		if server.Healthy {
+			since, ok := a.healthySince[s.ID]
+			if !ok {
+				since = now
+				a.healthySince[s.ID] = since
+			}
+			server.StableSince = since
+		} else {
+			delete(a.healthySince, s.ID)
+		}
+
+		if !s.NonVoter {
+			state.Voters = append(state.Voters, s.ID)
+			if server.Healthy {
+				healthyVoters++
+			}
+		}
+		state.Servers[s.ID] = server
+
+		if s.RedundancyZone != "" {
+			zone, ok := state.RedundancyZones[s.RedundancyZone]
+			if !ok {
+				zone = &RaftAutopilotZone{
+					Servers: []string{},
+					Voters:  []string{},
+				}
+				state.RedundancyZones[s.RedundancyZone] = zone
+			}
+			zone.Servers = append(zone.Servers, s.ID)
+			if !s.NonVoter {
+				zone.Voters = append(zone.Voters, s.ID)
+			}
+			if server.Healthy && (!s.NonVoter || s.Staging) {
+				zone.FailureTolerance++
+			}
+		}
+	}
+	for _, zone := range state.RedundancyZones {
+		sort.Strings(zone.Servers)
+		sort.Strings(zone.Voters)
+		if zone.FailureTolerance > 0 {
+			zone.FailureTolerance--
+		}
+	}
+	for id := range a.healthySince {
+		if _, ok := state.Servers[id]; !ok {
+			delete(a.healthySince, id)
+		}
+	}
+
+	sort.Strings(state.Voters)
+	state.Healthy = healthyVoters == len(state.Voters)
+	if tolerance := healthyVoters - (len(state.Voters)/2 + 1); tolerance > 0 {
+		state.FailureTolerance = tolerance
+	}
+	return state
+}
+
+// promoteStableServers promotes a staging server which has been healthy for
+// the stabilization time to a voter, returning whether one was promoted.
+// Servers of a redundancy zone are only promoted when the zone has no
+// healthy voter.
+func (a *raftAutopilot) promoteStableServers(state *RaftAutopilotState, config *RaftAutopilotConfig) bool {
+	now := time.Now()
+	for _, id := range sortedRaftServerIDs(state) {
+		server := state.Servers[id]
+		if server.Status != RaftServerStatusStaging || !server.Healthy || now.Sub(server.StableSince) < config.ServerStabilizationTime {
+			continue
+		}
+		if zone := state.RedundancyZones[server.RedundancyZone]; zone != nil && zone.healthyVoter(state) {
+			continue
+		}
+
+		a.b.logger.Info("raft: autopilot promoting stable server to voter", "id", id, "redundancy_zone", server.RedundancyZone)
+		err := a.b.node.addServer(raftServer{
+			ID:             id,
+			Address:        server.Address,
+			RedundancyZone: server.RedundancyZone,
+		})
+		if err != nil {
+			a.b.logger.Warn("raft: autopilot failed to promote server", "id", id, "error", err)
+		}
+		return true
+	}
+	return false
+}
+
+// demoteRedundantVoters demotes the extra voters of the redundancy zones
+// with more than one voter, such as a failed voter replaced by a spare of its
+// zone, returning whether one was demoted. Unhealthy voters are demoted
+// first, and the leader is never demoted.
+func (a *raftAutopilot) demoteRedundantVoters(state *RaftAutopilotState) bool {
+	zoneNames := make([]string, 0, len(state.RedundancyZones))
+	for name := range state.RedundancyZones {
+		zoneNames = append(zoneNames, name)
+	}
+	sort.Strings(zoneNames)
+
+	for _, name := range zoneNames {
+		zone := state.RedundancyZones[name]
+		if len(zone.Voters) < 2 {
+			continue
+		}
+
+		var target *RaftAutopilotServer
+		for _, id := range zone.Voters {
+			server := state.Servers[id]
+			if server.Status == RaftServerStatusLeader {
+				continue
+			}
+			if target == nil || (target.Healthy && !server.Healthy) {
+				target = server
+			}
+		}
+		if target == nil {
+			continue
+		}
+
+		a.b.logger.Info("raft: autopilot demoting redundant voter", "id", target.NodeID, "redundancy_zone", name, "healthy", target.Healthy)
+		err := a.b.node.addServer(raftServer{
+			ID:             target.NodeID,
+			Address:        target.Address,
+			NonVoter:       true,
+			Staging:        true,
+			RedundancyZone: name,
+		})
+		if err != nil {
+			a.b.logger.Warn("raft: autopilot failed to demote voter", "id", target.NodeID, "error", err)
+		}
+		return true
+	}
+	return false
+}
+
+// healthyVoter returns whether a voter of the zone is healthy
+func (z *RaftAutopilotZone) healthyVoter(state *RaftAutopilotState) bool {
+	for _, id := range z.Voters {
+		if state.Servers[id].Healthy {
+			return true
+		}
+	}
+	return false
+}
+
+// removeDeadServers removes a server which has not contacted the leader for
+// the dead server threshold. Voters are only removed while the remaining
+// voters reach the minimum quorum and a majority of them are healthy.
+func (a *raftAutopilot) removeDeadServers(state *RaftAutopilotState, config *RaftAutopilotConfig) {
+	if !config.CleanupDeadServers {
+		return
+	}
+
+	healthyVoters := 0
+	for _, id := range state.Voters {
+		if state.Servers[id].Healthy {
+			healthyVoters++
+		}
+	}
+
+	for _, id := range sortedRaftServerIDs(state) {
+		server := state.Servers[id]
+		if server.Status == RaftServerStatusLeader || server.LastContact <= config.DeadServerLastContactThreshold {
+			continue
+		}
+
+		if server.Status == RaftServerStatusVoter {
+			remaining := len(state.Voters) - 1
+			if remaining < config.MinQuorum {
+				a.b.logger.Warn("raft: autopilot not removing dead server below the minimum quorum", "id", id, "min_quorum", config.MinQuorum)
+				continue
+			}
+			if healthyVoters < remaining/2+1 {
+				a.b.logger.Warn("raft: autopilot not removing dead server without a healthy majority", "id", id)
+				continue
+			}
+		}
+
+		a.b.logger.Info("raft: autopilot removing dead server", "id", id, "last_contact", server.LastContact)
+		if err := a.b.node.removeServer(id); err != nil {
+			a.b.logger.Warn("raft: autopilot failed to remove dead server", "id", id, "error", err)
+		}
+		return
+	}
+}
+
+func sortedRaftServerIDs(state *RaftAutopilotState) []string {
+	ids := make([]string, 0, len(state.Servers))
+	for id := range state.Servers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// SetAutopilotConfig replaces the autopilot configuration of the node, which
+// is in effect while the node leads the cluster
+func (b *RaftBackend) SetAutopilotConfig(config *RaftAutopilotConfig) {
+	copied := *config
+
+	b.autopilot.l.Lock()
+	b.autopilot.config = &copied
+	b.autopilot.l.Unlock()
+}
+
+// AutopilotConfig returns the autopilot configuration of the node
+func (b *RaftBackend) AutopilotConfig() *RaftAutopilotConfig {
+	b.autopilot.l.Lock()
+	defer b.autopilot.l.Unlock()
+
+	copied := *b.autopilot.config
+	return &copied
+}
+
+// AutopilotState returns the health of the cluster. Only the leader tracks
+// the health of the servers.
+func (b *RaftBackend) AutopilotState() (*RaftAutopilotState, error) {
+	b.autopilot.l.Lock()
+	defer b.autopilot.l.Unlock()
+
+	state := b.autopilot.evaluateLocked(time.Now())
+	if state == nil {
+		return nil, errRaftNotLeader
+	}
+	return state, nil
+}
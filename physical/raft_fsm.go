@@ -0,0 +1,282 @@
+package physical
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/armon/go-radix"
+	"github.com/hashicorp/vault/helper/jsonutil"
+)
+
+// raftEntryType is the type of a raft log entry
+type raftEntryType int
+
+const (
+	// raftEntryNoop is appended by new leaders to commit the entries of the
+	// previous terms
+	raftEntryNoop raftEntryType = iota
+
+	// raftEntryCommand holds a raftCommand applied to the FSM
+	raftEntryCommand
+
+	// raftEntryConfiguration holds the new raftConfiguration of the cluster
+	raftEntryConfiguration
+)
+
+// raftLogEntry is an entry of the replicated log
+type raftLogEntry struct {
+	Index uint64        `json:"index"`
+	Term  uint64        `json:"term"`
+	Type  raftEntryType `json:"type"`
+	Data  []byte        `json:"data,omitempty"`
+}
+
+// raftServer is a member of a raft cluster. Staging servers are non-voters
+// which autopilot promotes to voters once they are stable. Autopilot keeps a
+// single voter per redundancy zone, the other servers of the zone standing by
+// as staging servers.
+type raftServer struct {
+	ID             string `json:"id"`
+	Address        string `json:"address"`
+	NonVoter       bool   `json:"non_voter,omitempty"`
+	Staging        bool   `json:"staging,omitempty"`
+	RedundancyZone string `json:"redundancy_zone,omitempty"`
+}
+
+// raftConfiguration is the membership of a raft cluster
+type raftConfiguration struct {
+	Servers []raftServer `json:"servers"`
+}
+
+// server returns the server with the given ID
+func (c raftConfiguration) server(id string) (raftServer, bool) {
+	for _, s := range c.Servers {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return raftServer{}, false
+}
+
+// voters returns the number of voters
+func (c raftConfiguration) voters() int {
+	voters := 0
+	for _, s := range c.Servers {
+		if !s.NonVoter {
+			voters++
+		}
+	}
+	return voters
+}
+
+// clone returns a deep copy of the configuration
+func (c raftConfiguration) clone() raftConfiguration {
+	return raftConfiguration{
+		Servers: append([]raftServer(nil), c.Servers...),
+	}
+}
+
+const (
+	raftOpPut     = "put"
+	raftOpDelete  = "delete"
+	raftOpLock    = "lock"
+	raftOpUnlock  = "unlock"
+	raftOpRestore = "restore"
+)
+
+// raftOperation is an operation of a raftCommand. Lock operations take the
+// node holding the lock in NodeID, and restore operations an encoded
+// snapshot in Value.
+type raftOperation struct {
+	Op     string `json:"op"`
+	Key    string `json:"key,omitempty"`
+	Value  []byte `json:"value,omitempty"`
+	NodeID string `json:"node_id,omitempty"`
+}
+
+// raftCommand is a set of operations atomically applied to the FSM
+type raftCommand struct {
+	Ops []raftOperation `json:"ops"`
+}
+
+// raftLockEntry is an HA lock held by the leader of the cluster
+type raftLockEntry struct {
+	Value  string `json:"value"`
+	NodeID string `json:"node_id"`
+}
+
+// raftSnapshot is a snapshot of the FSM at a log index. It is encoded as
+// gzipped JSON, both on disk and when saved by operators.
+type raftSnapshot struct {
+	Index              uint64                    `json:"index"`
+	Term               uint64                    `json:"term"`
+	Configuration      raftConfiguration         `json:"configuration"`
+	ConfigurationIndex uint64                    `json:"configuration_index"`
+	Data               map[string][]byte         `json:"data"`
+	Locks              map[string]*raftLockEntry `json:"locks,omitempty"`
+}
+
+func encodeRaftSnapshot(snapshot *raftSnapshot) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		return nil, fmt.Errorf("failed to encode raft snapshot: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress raft snapshot: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeRaftSnapshot(buf []byte) (*raftSnapshot, error) {
+	r, err := gzip.NewReader(bytes.NewReader(buf))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress raft snapshot: %v", err)
+	}
+	defer r.Close()
+
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress raft snapshot: %v", err)
+	}
+
+	snapshot := new(raftSnapshot)
+	if err := jsonutil.DecodeJSON(raw, snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode raft snapshot: %v", err)
+	}
+	if snapshot.Data == nil {
+		snapshot.Data = make(map[string][]byte)
+	}
+	return snapshot, nil
+}
+
+// raftFSM is the state machine of the raft backend: the stored entries and
+// the HA locks. It is only modified by applying committed log entries, and is
+// read locally by Get and List.
+type raftFSM struct {
+	l     sync.RWMutex
+	root  *radix.Tree
+	locks map[string]*raftLockEntry
+}
+
+func newRaftFSM() *raftFSM {
+	return &raftFSM{
+		root:  radix.New(),
+		locks: make(map[string]*raftLockEntry),
+	}
+}
+
+// apply applies a command to the FSM
+func (f *raftFSM) apply(cmd *raftCommand) error {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	for _, op := range cmd.Ops {
+		switch op.Op {
+		case raftOpPut:
+			f.root.Insert(op.Key, op.Value)
+		case raftOpDelete:
+			f.root.Delete(op.Key)
+		case raftOpLock:
+			f.locks[op.Key] = &raftLockEntry{
+				Value:  string(op.Value),
+				NodeID: op.NodeID,
+			}
+		case raftOpUnlock:
+			if lock, ok := f.locks[op.Key]; ok && lock.Value == string(op.Value) {
+				delete(f.locks, op.Key)
+			}
+		case raftOpRestore:
+			snapshot, err := decodeRaftSnapshot(op.Value)
+			if err != nil {
+				return err
+			}
+			f.root = radix.New()
+			for k, v := range snapshot.Data {
+				f.root.Insert(k, v)
+			}
+		default:
+			return fmt.Errorf("unknown raft operation %q", op.Op)
+		}
+	}
+	return nil
+}
+
+// get returns the value of a key, or nil if it does not exist
+func (f *raftFSM) get(key string) ([]byte, bool) {
+	f.l.RLock()
+	defer f.l.RUnlock()
+
+	raw, ok := f.root.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return raw.([]byte), true
+}
+
+// list returns the keys under a prefix, up to the next prefix
+func (f *raftFSM) list(prefix string) []string {
+	f.l.RLock()
+	defer f.l.RUnlock()
+
+	var out []string
+	seen := make(map[string]struct{})
+	f.root.WalkPrefix(prefix, func(s string, v interface{}) bool {
+		trimmed := strings.TrimPrefix(s, prefix)
+		if sep := strings.Index(trimmed, "/"); sep != -1 {
+			trimmed = trimmed[:sep+1]
+			if _, ok := seen[trimmed]; ok {
+				return false
+			}
+			seen[trimmed] = struct{}{}
+		}
+		out = append(out, trimmed)
+		return false
+	})
+	return out
+}
+
+// lock returns the HA lock with the given key
+func (f *raftFSM) lock(key string) *raftLockEntry {
+	f.l.RLock()
+	defer f.l.RUnlock()
+
+	return f.locks[key]
+}
+
+// snapshot returns a copy of the entries and the locks of the FSM
+func (f *raftFSM) snapshot() (map[string][]byte, map[string]*raftLockEntry) {
+	f.l.RLock()
+	defer f.l.RUnlock()
+
+	data := make(map[string][]byte, f.root.Len())
+	f.root.Walk(func(s string, v interface{}) bool {
+		data[s] = v.([]byte)
+		return false
+	})
+	locks := make(map[string]*raftLockEntry, len(f.locks))
+	for k, v := range f.locks {
+		locks[k] = v
+	}
+	return data, locks
+}
+
+// restore replaces the state of the FSM
+func (f *raftFSM) restore(data map[string][]byte, locks map[string]*raftLockEntry) {
+	f.l.Lock()
+	defer f.l.Unlock()
+
+	f.root = radix.New()
+	for k, v := range data {
+		f.root.Insert(k, v)
+	}
+	f.locks = make(map[string]*raftLockEntry, len(locks))
+	for k, v := range locks {
+		f.locks[k] = v
+	}
+}
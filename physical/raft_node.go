@@ -0,0 +1,1442 @@
+package physical
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	log "github.com/mgutz/logxi/v1"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+)
+
+var (
+	// raftBaseHeartbeatInterval and raftBaseElectionTimeout are multiplied by
+	// the performance multiplier of the backend
+	raftBaseHeartbeatInterval = 200 * time.Millisecond
+	raftBaseElectionTimeout   = 1 * time.Second
+)
+
+const (
+	// raftMaxAppendEntries is the maximum number of entries replicated at
+	// once
+	raftMaxAppendEntries = 256
+
+	// raftDefaultSnapshotThreshold is the number of applied entries after
+	// which the log is compacted into a snapshot
+	raftDefaultSnapshotThreshold = 8192
+)
+
+var (
+	errRaftNotLeader            = errors.New("node is not the raft leader")
+	errRaftLeadershipLost       = errors.New("raft leadership lost while committing the entry")
+	errRaftShutdown             = errors.New("raft node is shut down")
+	errRaftLeadershipTransfer   = errors.New("raft leadership transfer in progress")
+	errRaftConfigurationPending = errors.New("a raft configuration change is already in progress")
+	errRaftAlreadyBootstrapped  = errors.New("raft node already has state; it is bootstrapped or part of a cluster")
+)
+
+type raftNodeState int
+
+const (
+	raftFollower raftNodeState = iota
+	raftCandidate
+	raftLeader
+)
+
+func (s raftNodeState) String() string {
+	switch s {
+	case raftFollower:
+		return "follower"
+	case raftCandidate:
+		return "candidate"
+	case raftLeader:
+		return "leader"
+	}
+	return "unknown"
+}
+
+// raftReplicator replicates the log of the leader to a server
+type raftReplicator struct {
+	server raftServer
+
+	nextIndex  uint64
+	matchIndex uint64
+
+	// commitSent is the commit index last acknowledged by the server
+	commitSent uint64
+
+	lastContact time.Time
+	failures    int
+	lockWanted  bool
+
+	triggerCh chan struct{}
+	stopCh    chan struct{}
+}
+
+// trigger wakes up the replicator without blocking
+func (r *raftReplicator) trigger() {
+	select {
+	case r.triggerCh <- struct{}{}:
+	default:
+	}
+}
+
+// raftNode is a member of a raft cluster. All its state is guarded by a
+// single mutex, which is also held while persisting the log and applying
+// committed entries to the FSM.
+type raftNode struct {
+	id      string
+	address string
+	logger  log.Logger
+
+	store     *raftStore
+	fsm       *raftFSM
+	transport *raftTransport
+
+	heartbeatInterval time.Duration
+	electionTimeout   time.Duration
+	snapshotThreshold uint64
+
+	l    sync.Mutex
+	rand *rand.Rand
+
+	state         raftNodeState
+	currentTerm   uint64
+	votedFor      string
+	leaderID      string
+	leaderAddress string
+
+	// lastContact is when the leader was last heard of
+	lastContact      time.Time
+	electionDeadline time.Time
+
+	// entries are the log entries following the snapshot
+	entries       []*raftLogEntry
+	snapshotIndex uint64
+	snapshotTerm  uint64
+
+	snapshotConfig      raftConfiguration
+	snapshotConfigIndex uint64
+
+	// config is the latest configuration of the log, which takes effect as
+	// soon as it is appended
+	config      raftConfiguration
+	configIndex uint64
+
+	commitIndex uint64
+	lastApplied uint64
+
+	// lockInterest is the number of HA locks held or waited for on the node
+	lockInterest int
+
+	// The leader state
+	leaderCh      chan struct{}
+	leaderSince   time.Time
+	replicators   map[string]*raftReplicator
+	futures       map[uint64]chan error
+	transferring  bool
+	transferStart time.Time
+
+	// stateCh is closed and replaced whenever the state or the leader of the
+	// node changes
+	stateCh chan struct{}
+
+	shutdown   bool
+	shutdownCh chan struct{}
+}
+
+// newRaftNode restores a node from its store, and starts it
+func newRaftNode(id, address string, store *raftStore, entries []*raftLogEntry, transport *raftTransport,
+	multiplier int, snapshotThreshold uint64, logger log.Logger) (*raftNode, error) {
+	n := &raftNode{
+		id:                id,
+		address:           address,
+		logger:            logger,
+		store:             store,
+		fsm:               newRaftFSM(),
+		transport:         transport,
+		heartbeatInterval: raftBaseHeartbeatInterval * time.Duration(multiplier),
+		electionTimeout:   raftBaseElectionTimeout * time.Duration(multiplier),
+		snapshotThreshold: snapshotThreshold,
+		rand:              rand.New(rand.NewSource(time.Now().UnixNano())),
+		stateCh:           make(chan struct{}),
+		shutdownCh:        make(chan struct{}),
+	}
+
+	state, err := store.readState()
+	if err != nil {
+		return nil, err
+	}
+	n.currentTerm = state.CurrentTerm
+	n.votedFor = state.VotedFor
+
+	buf, err := store.readSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	if buf != nil {
+		snapshot, err := decodeRaftSnapshot(buf)
+		if err != nil {
+			return nil, err
+		}
+		n.fsm.restore(snapshot.Data, snapshot.Locks)
+		n.snapshotIndex = snapshot.Index
+		n.snapshotTerm = snapshot.Term
+		n.snapshotConfig = snapshot.Configuration
+		n.snapshotConfigIndex = snapshot.ConfigurationIndex
+	}
+
+	// Entries compacted into the snapshot may remain after a crash during
+	// the compaction
+	var kept []*raftLogEntry
+	for _, entry := range entries {
+		if entry.Index > n.snapshotIndex {
+			kept = append(kept, entry)
+		}
+	}
+	for i, entry := range kept {
+		if entry.Index != n.snapshotIndex+uint64(i)+1 {
+			return nil, fmt.Errorf("raft log is not contiguous at index %d", entry.Index)
+		}
+	}
+	if len(kept) != len(entries) {
+		if err := store.rewriteLog(kept); err != nil {
+			return nil, err
+		}
+	}
+	n.entries = kept
+	n.config, n.configIndex = n.latestConfigLocked()
+
+	n.lastApplied = n.snapshotIndex
+	n.commitIndex = n.snapshotIndex
+	if state.CommitIndex > n.commitIndex {
+		n.commitIndex = state.CommitIndex
+		if last := n.lastIndexLocked(); n.commitIndex > last {
+			n.commitIndex = last
+		}
+	}
+	if err := n.applyCommittedLocked(); err != nil {
+		return nil, err
+	}
+
+	n.resetElectionDeadlineLocked()
+	transport.serve(n)
+	go n.run()
+	return n, nil
+}
+
+// run drives the timeouts of the node until it is shut down
+func (n *raftNode) run() {
+	ticker := time.NewTicker(n.heartbeatInterval / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.shutdownCh:
+			return
+		case <-ticker.C:
+		}
+
+		n.l.Lock()
+		n.tickLocked(time.Now())
+		n.l.Unlock()
+	}
+}
+
+func (n *raftNode) tickLocked(now time.Time) {
+	if n.shutdown {
+		return
+	}
+
+	if n.state != raftLeader {
+		if now.After(n.electionDeadline) {
+			if s, ok := n.config.server(n.id); ok && !s.NonVoter {
+				n.startElectionLocked(false)
+			} else {
+				n.resetElectionDeadlineLocked()
+			}
+		}
+		return
+	}
+
+	// Step down when a quorum of the voters can't be reached, so that a
+	// partitioned leader stops serving
+	if now.Sub(n.leaderSince) > n.electionTimeout {
+		contacted := 0
+		if s, ok := n.config.server(n.id); ok && !s.NonVoter {
+			contacted++
+		}
+		for _, r := range n.replicators {
+			if !r.server.NonVoter && now.Sub(r.lastContact) <= n.electionTimeout {
+				contacted++
+			}
+		}
+		if contacted < n.config.voters()/2+1 {
+			n.logger.Warn("raft: failed to contact a quorum of the voters, stepping down", "term", n.currentTerm)
+			n.stepDownLocked(n.currentTerm)
+			return
+		}
+	}
+
+	if n.transferring && now.Sub(n.transferStart) > 2*n.electionTimeout {
+		n.transferring = false
+	}
+
+	// Leaders whose HA lock is not wanted, such as sealed Vault nodes, hand
+	// the leadership over to a node waiting for the lock
+	if n.lockInterest == 0 && !n.transferring && now.Sub(n.leaderSince) > 2*n.electionTimeout {
+		for id, r := range n.replicators {
+			if r.lockWanted && !r.server.NonVoter && r.matchIndex >= n.lastIndexLocked() {
+				n.logger.Info("raft: handing leadership over to a node waiting for the HA lock", "id", id)
+				if target, err := n.startTransferLocked(id); err == nil {
+					go n.completeTransfer(target)
+				}
+				break
+			}
+		}
+	}
+}
+
+// resetElectionDeadlineLocked sets a random election deadline between one
+// and two election timeouts from now
+func (n *raftNode) resetElectionDeadlineLocked() {
+	timeout := n.electionTimeout + time.Duration(n.rand.Int63n(int64(n.electionTimeout)))
+	n.electionDeadline = time.Now().Add(timeout)
+}
+
+// notifyLocked wakes up the waiters for a change of the state or the leader
+func (n *raftNode) notifyLocked() {
+	close(n.stateCh)
+	n.stateCh = make(chan struct{})
+}
+
+func (n *raftNode) persistStateLocked() {
+	if err := n.store.writeState(&raftPersistentState{
+		CurrentTerm: n.currentTerm,
+		VotedFor:    n.votedFor,
+		CommitIndex: n.commitIndex,
+	}); err != nil {
+		n.logger.Error("raft: failed to persist state", "error", err)
+	}
+}
+
+func (n *raftNode) lastIndexLocked() uint64 {
+	if len(n.entries) == 0 {
+		return n.snapshotIndex
+	}
+	return n.entries[len(n.entries)-1].Index
+}
+
+func (n *raftNode) lastTermLocked() uint64 {
+	if len(n.entries) == 0 {
+		return n.snapshotTerm
+	}
+	return n.entries[len(n.entries)-1].Term
+}
+
+// entryLocked returns the entry at an index following the snapshot
+func (n *raftNode) entryLocked(index uint64) *raftLogEntry {
+	if index <= n.snapshotIndex || index > n.lastIndexLocked() {
+		return nil
+	}
+	return n.entries[index-n.snapshotIndex-1]
+}
+
+// termAtLocked returns the term of the entry at an index, if known
+func (n *raftNode) termAtLocked(index uint64) (uint64, bool) {
+	switch {
+	case index == 0:
+		return 0, true
+	case index == n.snapshotIndex:
+		return n.snapshotTerm, true
+	}
+	if entry := n.entryLocked(index); entry != nil {
+		return entry.Term, true
+	}
+	return 0, false
+}
+
+// latestConfigLocked returns the latest configuration of the log
+func (n *raftNode) latestConfigLocked() (raftConfiguration, uint64) {
+	for i := len(n.entries) - 1; i >= 0; i-- {
+		entry := n.entries[i]
+		if entry.Type != raftEntryConfiguration {
+			continue
+		}
+		var config raftConfiguration
+		if err := jsonutil.DecodeJSON(entry.Data, &config); err != nil {
+			n.logger.Error("raft: failed to decode configuration", "index", entry.Index, "error", err)
+			continue
+		}
+		return config, entry.Index
+	}
+	return n.snapshotConfig.clone(), n.snapshotConfigIndex
+}
+
+// appendEntriesLocked durably appends entries following the last entry
+func (n *raftNode) appendEntriesLocked(entries []*raftLogEntry) error {
+	last := n.lastIndexLocked()
+	for i, entry := range entries {
+		if entry.Index != last+uint64(i)+1 {
+			return fmt.Errorf("raft entry %d does not follow the last entry %d", entry.Index, last)
+		}
+	}
+	if err := n.store.appendEntries(entries); err != nil {
+		return err
+	}
+	n.entries = append(n.entries, entries...)
+
+	for _, entry := range entries {
+		if entry.Type != raftEntryConfiguration {
+			continue
+		}
+		var config raftConfiguration
+		if err := jsonutil.DecodeJSON(entry.Data, &config); err != nil {
+			return fmt.Errorf("failed to decode raft configuration: %v", err)
+		}
+		n.config = config
+		n.configIndex = entry.Index
+	}
+	return nil
+}
+
+// truncateLocked removes the entries from the given index
+func (n *raftNode) truncateLocked(index uint64) error {
+	keep := int(index - n.snapshotIndex - 1)
+	if err := n.store.truncate(keep); err != nil {
+		return err
+	}
+	n.entries = n.entries[:keep]
+	n.config, n.configIndex = n.latestConfigLocked()
+	return nil
+}
+
+// appendLocked appends a new entry of the current term on the leader
+func (n *raftNode) appendLocked(entryType raftEntryType, data []byte) (uint64, error) {
+	entry := &raftLogEntry{
+		Index: n.lastIndexLocked() + 1,
+		Term:  n.currentTerm,
+		Type:  entryType,
+		Data:  data,
+	}
+	if err := n.appendEntriesLocked([]*raftLogEntry{entry}); err != nil {
+		return 0, err
+	}
+	if entryType == raftEntryConfiguration {
+		n.syncReplicatorsLocked()
+	}
+	return entry.Index, nil
+}
+
+// applyCommittedLocked applies the committed entries to the FSM, and
+// compacts the log once enough entries have been applied
+func (n *raftNode) applyCommittedLocked() error {
+	for n.lastApplied < n.commitIndex {
+		entry := n.entryLocked(n.lastApplied + 1)
+		if entry == nil {
+			return fmt.Errorf("missing raft entry %d", n.lastApplied+1)
+		}
+
+		var err error
+		if entry.Type == raftEntryCommand {
+			cmd := new(raftCommand)
+			if err = jsonutil.DecodeJSON(entry.Data, cmd); err == nil {
+				err = n.fsm.apply(cmd)
+			}
+			if err != nil {
+				n.logger.Error("raft: failed to apply entry", "index", entry.Index, "error", err)
+			}
+		}
+		n.lastApplied = entry.Index
+
+		if ch, ok := n.futures[entry.Index]; ok {
+			ch <- err
+			delete(n.futures, entry.Index)
+		}
+	}
+
+	// Leaders removed from the configuration step down once the removal is
+	// committed
+	if n.state == raftLeader && n.configIndex <= n.commitIndex {
+		if _, ok := n.config.server(n.id); !ok {
+			n.logger.Info("raft: removed from the configuration, stepping down")
+			n.stepDownLocked(n.currentTerm)
+		}
+	}
+
+	if n.lastApplied-n.snapshotIndex >= n.snapshotThreshold {
+		if err := n.compactLocked(); err != nil {
+			n.logger.Error("raft: failed to compact the log", "error", err)
+		}
+	}
+	return nil
+}
+
+// configAtLocked returns the configuration in effect at an index
+func (n *raftNode) configAtLocked(index uint64) (raftConfiguration, uint64) {
+	for i := len(n.entries) - 1; i >= 0; i-- {
+		entry := n.entries[i]
+		if entry.Index > index || entry.Type != raftEntryConfiguration {
+			continue
+		}
+		var config raftConfiguration
+		if err := jsonutil.DecodeJSON(entry.Data, &config); err == nil {
+			return config, entry.Index
+		}
+	}
+	return n.snapshotConfig.clone(), n.snapshotConfigIndex
+}
+
+// snapshotLocked returns a snapshot of the FSM at the last applied entry
+func (n *raftNode) snapshotLocked() *raftSnapshot {
+	term, _ := n.termAtLocked(n.lastApplied)
+	config, configIndex := n.configAtLocked(n.lastApplied)
+	data, locks := n.fsm.snapshot()
+	return &raftSnapshot{
+		Index:              n.lastApplied,
+		Term:               term,
+		Configuration:      config,
+		ConfigurationIndex: configIndex,
+		Data:               data,
+		Locks:              locks,
+	}
+}
+
+// compactLocked replaces the applied entries of the log with a snapshot
+func (n *raftNode) compactLocked() error {
+	snapshot := n.snapshotLocked()
+	buf, err := encodeRaftSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+	if err := n.store.writeSnapshot(buf); err != nil {
+		return err
+	}
+
+	remaining := append([]*raftLogEntry(nil), n.entries[snapshot.Index-n.snapshotIndex:]...)
+	if err := n.store.rewriteLog(remaining); err != nil {
+		return err
+	}
+	n.entries = remaining
+	n.snapshotIndex = snapshot.Index
+	n.snapshotTerm = snapshot.Term
+	n.snapshotConfig = snapshot.Configuration
+	n.snapshotConfigIndex = snapshot.ConfigurationIndex
+	n.persistStateLocked()
+
+	n.logger.Debug("raft: compacted the log", "index", snapshot.Index)
+	return nil
+}
+
+// stepDownLocked turns the node into a follower of the given term
+func (n *raftNode) stepDownLocked(term uint64) {
+	if term > n.currentTerm {
+		n.currentTerm = term
+		n.votedFor = ""
+		n.leaderID = ""
+		n.leaderAddress = ""
+		n.persistStateLocked()
+	}
+
+	if n.state == raftLeader {
+		n.logger.Info("raft: leaving leader state", "term", n.currentTerm)
+		close(n.leaderCh)
+		n.leaderCh = nil
+		for _, r := range n.replicators {
+			close(r.stopCh)
+		}
+		n.replicators = nil
+		for index, ch := range n.futures {
+			ch <- errRaftLeadershipLost
+			delete(n.futures, index)
+		}
+		n.transferring = false
+		n.leaderID = ""
+		n.leaderAddress = ""
+	}
+	if n.state == raftCandidate {
+		n.leaderID = ""
+		n.leaderAddress = ""
+	}
+
+	n.state = raftFollower
+	n.resetElectionDeadlineLocked()
+	n.notifyLocked()
+}
+
+// startElectionLocked campaigns for the leadership in a new term
+func (n *raftNode) startElectionLocked(leadershipTransfer bool) {
+	if n.state == raftLeader {
+		return
+	}
+
+	n.currentTerm++
+	n.votedFor = n.id
+	n.state = raftCandidate
+	n.leaderID = ""
+	n.leaderAddress = ""
+	n.persistStateLocked()
+	n.resetElectionDeadlineLocked()
+	n.notifyLocked()
+
+	term := n.currentTerm
+	needed := n.config.voters()/2 + 1
+	granted := 1
+	n.logger.Debug("raft: starting election", "term", term)
+	if granted >= needed {
+		n.becomeLeaderLocked()
+		return
+	}
+
+	req := &raftRequestVoteRequest{
+		Term:               term,
+		CandidateID:        n.id,
+		LastLogIndex:       n.lastIndexLocked(),
+		LastLogTerm:        n.lastTermLocked(),
+		LeadershipTransfer: leadershipTransfer,
+	}
+	for _, s := range n.config.Servers {
+		if s.ID == n.id || s.NonVoter {
+			continue
+		}
+		go func(s raftServer) {
+			resp := new(raftRequestVoteResponse)
+			if err := n.transport.call(s.Address, raftRPCRequestVote, req, resp, n.electionTimeout); err != nil {
+				n.logger.Debug("raft: failed to request vote", "id", s.ID, "error", err)
+				return
+			}
+
+			n.l.Lock()
+			defer n.l.Unlock()
+			if resp.Term > n.currentTerm {
+				n.stepDownLocked(resp.Term)
+				return
+			}
+			if n.state != raftCandidate || n.currentTerm != term || !resp.Granted {
+				return
+			}
+			granted++
+			if granted >= needed {
+				n.becomeLeaderLocked()
+			}
+		}(s)
+	}
+}
+
+// becomeLeaderLocked turns a candidate into the leader
+func (n *raftNode) becomeLeaderLocked() {
+	n.logger.Info("raft: entering leader state", "term", n.currentTerm)
+	n.state = raftLeader
+	n.leaderID = n.id
+	n.leaderAddress = n.address
+	n.leaderCh = make(chan struct{})
+	n.leaderSince = time.Now()
+	n.replicators = make(map[string]*raftReplicator)
+	n.futures = make(map[uint64]chan error)
+	n.syncReplicatorsLocked()
+
+	// Commit the entries of the previous terms
+	if _, err := n.appendLocked(raftEntryNoop, nil); err != nil {
+		n.logger.Error("raft: failed to append entry", "error", err)
+		n.stepDownLocked(n.currentTerm)
+		return
+	}
+	n.advanceCommitLocked()
+	n.notifyLocked()
+}
+
+// syncReplicatorsLocked starts and stops the replicators of the leader
+// following the configuration
+func (n *raftNode) syncReplicatorsLocked() {
+	if n.state != raftLeader {
+		return
+	}
+
+	for id, r := range n.replicators {
+		s, ok := n.config.server(id)
+		if !ok {
+			close(r.stopCh)
+			delete(n.replicators, id)
+			continue
+		}
+		r.server = s
+	}
+
+	for _, s := range n.config.Servers {
+		if _, ok := n.replicators[s.ID]; ok || s.ID == n.id {
+			continue
+		}
+		r := &raftReplicator{
+			server:      s,
+			nextIndex:   n.lastIndexLocked() + 1,
+			lastContact: time.Now(),
+			triggerCh:   make(chan struct{}, 1),
+			stopCh:      make(chan struct{}),
+		}
+		n.replicators[s.ID] = r
+		go n.replicate(r, n.currentTerm)
+	}
+}
+
+// replicate sends the new entries, or heartbeats, to a server for as long as
+// the node leads the given term
+func (n *raftNode) replicate(r *raftReplicator, term uint64) {
+	for {
+		more, stop := n.replicateOnce(r, term)
+		if stop {
+			return
+		}
+		if more {
+			continue
+		}
+
+		select {
+		case <-r.stopCh:
+			return
+		case <-n.shutdownCh:
+			return
+		case <-r.triggerCh:
+		case <-time.After(n.heartbeatInterval):
+		}
+	}
+}
+
+// replicateOnce sends an AppendEntries or an InstallSnapshot RPC to a
+// server. It returns whether there is more to send right away, and whether
+// the replicator must stop.
+func (n *raftNode) replicateOnce(r *raftReplicator, term uint64) (bool, bool) {
+	n.l.Lock()
+	if n.state != raftLeader || n.currentTerm != term || isClosed(r.stopCh) {
+		n.l.Unlock()
+		return false, true
+	}
+	if r.nextIndex <= n.snapshotIndex {
+		n.l.Unlock()
+		return n.sendSnapshot(r, term)
+	}
+
+	server := r.server
+	prevIndex := r.nextIndex - 1
+	prevTerm, _ := n.termAtLocked(prevIndex)
+	var entries []*raftLogEntry
+	for i := r.nextIndex; i <= n.lastIndexLocked() && len(entries) < raftMaxAppendEntries; i++ {
+		entries = append(entries, n.entryLocked(i))
+	}
+	req := &raftAppendEntriesRequest{
+		Term:          term,
+		LeaderID:      n.id,
+		LeaderAddress: n.address,
+		PrevLogIndex:  prevIndex,
+		PrevLogTerm:   prevTerm,
+		Entries:       entries,
+		LeaderCommit:  n.commitIndex,
+	}
+	n.l.Unlock()
+
+	resp := new(raftAppendEntriesResponse)
+	err := n.transport.call(server.Address, raftRPCAppendEntries, req, resp, n.electionTimeout)
+
+	n.l.Lock()
+	defer n.l.Unlock()
+	if n.state != raftLeader || n.currentTerm != term || isClosed(r.stopCh) {
+		return false, true
+	}
+	if err != nil {
+		if r.failures%10 == 0 {
+			n.logger.Warn("raft: failed to replicate to server", "id", server.ID, "address", server.Address, "error", err)
+		}
+		r.failures++
+		return false, false
+	}
+	r.failures = 0
+	if resp.Term > n.currentTerm {
+		n.stepDownLocked(resp.Term)
+		return false, true
+	}
+
+	r.lastContact = time.Now()
+	r.lockWanted = resp.LockWanted
+	if !resp.Success {
+		next := resp.LastLogIndex + 1
+		if next >= r.nextIndex {
+			next = r.nextIndex - 1
+		}
+		if next < 1 {
+			next = 1
+		}
+		r.nextIndex = next
+		return true, false
+	}
+
+	if match := prevIndex + uint64(len(entries)); match > r.matchIndex {
+		r.matchIndex = match
+	}
+	r.nextIndex = r.matchIndex + 1
+	r.commitSent = req.LeaderCommit
+	n.advanceCommitLocked()
+
+	return r.nextIndex <= n.lastIndexLocked() || r.commitSent < n.commitIndex, false
+}
+
+// sendSnapshot sends the latest snapshot to a server lagging behind it
+func (n *raftNode) sendSnapshot(r *raftReplicator, term uint64) (bool, bool) {
+	n.l.Lock()
+	buf, err := n.store.readSnapshot()
+	if err != nil {
+		n.l.Unlock()
+		n.logger.Error("raft: failed to read snapshot", "error", err)
+		return false, false
+	}
+	server := r.server
+	req := &raftInstallSnapshotRequest{
+		Term:          term,
+		LeaderID:      n.id,
+		LeaderAddress: n.address,
+		LastIndex:     n.snapshotIndex,
+		LastTerm:      n.snapshotTerm,
+		Snapshot:      buf,
+	}
+	n.l.Unlock()
+
+	n.logger.Info("raft: installing snapshot on server", "id", server.ID, "index", req.LastIndex)
+	resp := new(raftInstallSnapshotResponse)
+	err = n.transport.call(server.Address, raftRPCInstallSnapshot, req, resp, 10*n.electionTimeout)
+
+	n.l.Lock()
+	defer n.l.Unlock()
+	if n.state != raftLeader || n.currentTerm != term || isClosed(r.stopCh) {
+		return false, true
+	}
+	if err != nil {
+		n.logger.Warn("raft: failed to install snapshot on server", "id", server.ID, "error", err)
+		r.failures++
+		return false, false
+	}
+	if resp.Term > n.currentTerm {
+		n.stepDownLocked(resp.Term)
+		return false, true
+	}
+
+	r.lastContact = time.Now()
+	if resp.Success {
+		if req.LastIndex > r.matchIndex {
+			r.matchIndex = req.LastIndex
+		}
+		r.nextIndex = r.matchIndex + 1
+		n.advanceCommitLocked()
+	}
+	return r.nextIndex <= n.lastIndexLocked(), false
+}
+
+// advanceCommitLocked commits the entries of the current term replicated to
+// a quorum of the voters
+func (n *raftNode) advanceCommitLocked() {
+	if n.state != raftLeader {
+		return
+	}
+
+	needed := n.config.voters()/2 + 1
+	for index := n.lastIndexLocked(); index > n.commitIndex; index-- {
+		if term, _ := n.termAtLocked(index); term != n.currentTerm {
+			break
+		}
+
+		matched := 0
+		if s, ok := n.config.server(n.id); ok && !s.NonVoter {
+			matched++
+		}
+		for _, r := range n.replicators {
+			if !r.server.NonVoter && r.matchIndex >= index {
+				matched++
+			}
+		}
+		if matched < needed {
+			continue
+		}
+
+		n.commitIndex = index
+		if err := n.applyCommittedLocked(); err != nil {
+			n.logger.Error("raft: failed to apply committed entries", "error", err)
+		}
+		for _, r := range n.replicators {
+			r.trigger()
+		}
+		return
+	}
+}
+
+// requestVote handles the RequestVote RPC of a candidate
+func (n *raftNode) requestVote(req *raftRequestVoteRequest) *raftRequestVoteResponse {
+	n.l.Lock()
+	defer n.l.Unlock()
+
+	resp := &raftRequestVoteResponse{
+		Term: n.currentTerm,
+	}
+	if n.shutdown || req.Term < n.currentTerm {
+		return resp
+	}
+
+	// Ignore candidates while a leader is known, so that servers which were
+	// removed or partitioned can't disrupt the cluster, unless the leader
+	// transfers its leadership
+	if !req.LeadershipTransfer && (n.state == raftLeader ||
+		(n.leaderID != "" && time.Since(n.lastContact) < n.electionTimeout)) {
+		return resp
+	}
+
+	if req.Term > n.currentTerm {
+		n.stepDownLocked(req.Term)
+		resp.Term = n.currentTerm
+	}
+	if n.votedFor != "" && n.votedFor != req.CandidateID {
+		return resp
+	}
+	lastTerm := n.lastTermLocked()
+	if req.LastLogTerm < lastTerm || (req.LastLogTerm == lastTerm && req.LastLogIndex < n.lastIndexLocked()) {
+		return resp
+	}
+
+	n.votedFor = req.CandidateID
+	n.persistStateLocked()
+	n.resetElectionDeadlineLocked()
+	resp.Granted = true
+	return resp
+}
+
+// setLeaderLocked records the leader of the current term
+func (n *raftNode) setLeaderLocked(id, address string) {
+	n.lastContact = time.Now()
+	n.resetElectionDeadlineLocked()
+	if n.leaderID != id || n.leaderAddress != address {
+		n.leaderID = id
+		n.leaderAddress = address
+		n.notifyLocked()
+	}
+}
+
+// appendEntries handles the AppendEntries RPC of the leader
+func (n *raftNode) appendEntries(req *raftAppendEntriesRequest) *raftAppendEntriesResponse {
+	n.l.Lock()
+	defer n.l.Unlock()
+
+	resp := &raftAppendEntriesResponse{
+		Term:         n.currentTerm,
+		LastLogIndex: n.lastIndexLocked(),
+		LockWanted:   n.lockInterest > 0,
+	}
+	if n.shutdown || req.Term < n.currentTerm {
+		return resp
+	}
+	if req.Term > n.currentTerm || n.state != raftFollower {
+		n.stepDownLocked(req.Term)
+		resp.Term = n.currentTerm
+	}
+	n.setLeaderLocked(req.LeaderID, req.LeaderAddress)
+
+	if req.PrevLogIndex > n.lastIndexLocked() {
+		return resp
+	}
+	if req.PrevLogIndex > n.snapshotIndex {
+		if term, _ := n.termAtLocked(req.PrevLogIndex); term != req.PrevLogTerm {
+			resp.LastLogIndex = req.PrevLogIndex - 1
+			return resp
+		}
+	}
+
+	for i, entry := range req.Entries {
+		if entry.Index <= n.snapshotIndex {
+			continue
+		}
+		if entry.Index <= n.lastIndexLocked() {
+			if term, _ := n.termAtLocked(entry.Index); term == entry.Term {
+				continue
+			}
+			if entry.Index <= n.commitIndex {
+				n.logger.Error("raft: refusing to truncate committed entries", "index", entry.Index)
+				return resp
+			}
+			if err := n.truncateLocked(entry.Index); err != nil {
+				n.logger.Error("raft: failed to truncate the log", "error", err)
+				return resp
+			}
+		}
+		if err := n.appendEntriesLocked(req.Entries[i:]); err != nil {
+			n.logger.Error("raft: failed to append entries", "error", err)
+			return resp
+		}
+		break
+	}
+
+	resp.Success = true
+	resp.LastLogIndex = n.lastIndexLocked()
+
+	commit := req.LeaderCommit
+	if last := req.PrevLogIndex + uint64(len(req.Entries)); commit > last {
+		commit = last
+	}
+	if commit > n.commitIndex {
+		n.commitIndex = commit
+		if err := n.applyCommittedLocked(); err != nil {
+			n.logger.Error("raft: failed to apply committed entries", "error", err)
+		}
+	}
+	return resp
+}
+
+// installSnapshot handles the InstallSnapshot RPC of the leader, replacing
+// the log and the FSM with the snapshot
+func (n *raftNode) installSnapshot(req *raftInstallSnapshotRequest) *raftInstallSnapshotResponse {
+	n.l.Lock()
+	defer n.l.Unlock()
+
+	resp := &raftInstallSnapshotResponse{
+		Term: n.currentTerm,
+	}
+	if n.shutdown || req.Term < n.currentTerm {
+		return resp
+	}
+	if req.Term > n.currentTerm || n.state != raftFollower {
+		n.stepDownLocked(req.Term)
+		resp.Term = n.currentTerm
+	}
+	n.setLeaderLocked(req.LeaderID, req.LeaderAddress)
+
+	if req.LastIndex <= n.commitIndex {
+		resp.Success = true
+		return resp
+	}
+
+	snapshot, err := decodeRaftSnapshot(req.Snapshot)
+	if err != nil {
+		n.logger.Error("raft: failed to decode installed snapshot", "error", err)
+		return resp
+	}
+	if err := n.store.writeSnapshot(req.Snapshot); err != nil {
+		n.logger.Error("raft: failed to store installed snapshot", "error", err)
+		return resp
+	}
+	if err := n.store.rewriteLog(nil); err != nil {
+		n.logger.Error("raft: failed to reset the log", "error", err)
+		return resp
+	}
+
+	n.fsm.restore(snapshot.Data, snapshot.Locks)
+	n.entries = nil
+	n.snapshotIndex = req.LastIndex
+	n.snapshotTerm = req.LastTerm
+	n.snapshotConfig = snapshot.Configuration
+	n.snapshotConfigIndex = snapshot.ConfigurationIndex
+	n.config, n.configIndex = n.latestConfigLocked()
+	n.commitIndex = req.LastIndex
+	n.lastApplied = req.LastIndex
+	n.persistStateLocked()
+
+	n.logger.Info("raft: installed snapshot", "index", req.LastIndex)
+	resp.Success = true
+	return resp
+}
+
+// timeoutNow handles the TimeoutNow RPC of a leader transferring its
+// leadership to the node
+func (n *raftNode) timeoutNow(req *raftTimeoutNowRequest) *raftTimeoutNowResponse {
+	n.l.Lock()
+	defer n.l.Unlock()
+
+	if !n.shutdown && req.Term >= n.currentTerm {
+		if req.Term > n.currentTerm {
+			n.stepDownLocked(req.Term)
+		}
+		n.logger.Info("raft: leadership transferred by the leader, starting election", "leader", req.LeaderID)
+		n.startElectionLocked(true)
+	}
+	return &raftTimeoutNowResponse{
+		Term: n.currentTerm,
+	}
+}
+
+// join handles the request of a node to join the cluster
+func (n *raftNode) join(req *raftJoinRequest) *raftJoinResponse {
+	n.l.Lock()
+	if n.state != raftLeader {
+		leaderAddress := n.leaderAddress
+		n.l.Unlock()
+		return &raftJoinResponse{
+			LeaderAddress: leaderAddress,
+			Error:         errRaftNotLeader.Error(),
+		}
+	}
+	n.l.Unlock()
+
+	// Voters join as staging servers, and only take part in the quorum once
+	// autopilot considers them stable
+	n.logger.Info("raft: adding server", "id", req.ID, "address", req.Address, "non_voter", req.NonVoter, "redundancy_zone", req.RedundancyZone)
+	server := raftServer{
+		ID:             req.ID,
+		Address:        req.Address,
+		NonVoter:       true,
+		Staging:        !req.NonVoter,
+		RedundancyZone: req.RedundancyZone,
+	}
+
+	// Voters rejoining are not staged again
+	n.l.Lock()
+	if s, ok := n.config.server(req.ID); ok && !s.NonVoter && server.Staging && s.Address == server.Address && s.RedundancyZone == server.RedundancyZone {
+		n.l.Unlock()
+		return &raftJoinResponse{}
+	}
+	n.l.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		err := n.addServer(server)
+		switch {
+		case err == nil:
+			return &raftJoinResponse{}
+		case err == errRaftConfigurationPending && attempt < 10:
+			time.Sleep(n.heartbeatInterval)
+		default:
+			return &raftJoinResponse{
+				Error: err.Error(),
+			}
+		}
+	}
+}
+
+// apply appends an entry on the leader, and waits for it to be applied
+func (n *raftNode) apply(entryType raftEntryType, data []byte) error {
+	n.l.Lock()
+	if err := n.checkLeaderLocked(); err != nil {
+		n.l.Unlock()
+		return err
+	}
+
+	index, err := n.appendLocked(entryType, data)
+	if err != nil {
+		n.l.Unlock()
+		return err
+	}
+	ch := make(chan error, 1)
+	n.futures[index] = ch
+	for _, r := range n.replicators {
+		r.trigger()
+	}
+	n.advanceCommitLocked()
+	n.l.Unlock()
+
+	select {
+	case err := <-ch:
+		return err
+	case <-n.shutdownCh:
+		return errRaftShutdown
+	}
+}
+
+// applyCommand applies a command via the log
+func (n *raftNode) applyCommand(cmd *raftCommand) error {
+	buf, err := json.Marshal(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to encode raft command: %v", err)
+	}
+	return n.apply(raftEntryCommand, buf)
+}
+
+func (n *raftNode) checkLeaderLocked() error {
+	switch {
+	case n.shutdown:
+		return errRaftShutdown
+	case n.state != raftLeader:
+		return errRaftNotLeader
+	case n.transferring:
+		return errRaftLeadershipTransfer
+	}
+	return nil
+}
+
+// changeConfiguration applies a change of the configuration. Only one change
+// may be in progress at a time.
+func (n *raftNode) changeConfiguration(change func(raftConfiguration) (raftConfiguration, bool, error)) error {
+	n.l.Lock()
+	if err := n.checkLeaderLocked(); err != nil {
+		n.l.Unlock()
+		return err
+	}
+	if n.configIndex > n.commitIndex {
+		n.l.Unlock()
+		return errRaftConfigurationPending
+	}
+
+	config, changed, err := change(n.config.clone())
+	if err != nil || !changed {
+		n.l.Unlock()
+		return err
+	}
+	n.l.Unlock()
+
+	buf, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to encode raft configuration: %v", err)
+	}
+	return n.apply(raftEntryConfiguration, buf)
+}
+
+// addServer adds a server to the configuration, or updates its address and
+// suffrage
+func (n *raftNode) addServer(server raftServer) error {
+	return n.changeConfiguration(func(config raftConfiguration) (raftConfiguration, bool, error) {
+		for i, s := range config.Servers {
+			if s.ID != server.ID && s.Address == server.Address {
+				return config, false, fmt.Errorf("address %q is already used by server %q", s.Address, s.ID)
+			}
+			if s.ID == server.ID {
+				if s == server {
+					return config, false, nil
+				}
+				config.Servers[i] = server
+				return config, true, nil
+			}
+		}
+		config.Servers = append(config.Servers, server)
+		return config, true, nil
+	})
+}
+
+// removeServer removes a server from the configuration
+func (n *raftNode) removeServer(id string) error {
+	return n.changeConfiguration(func(config raftConfiguration) (raftConfiguration, bool, error) {
+		for i, s := range config.Servers {
+			if s.ID == id {
+				config.Servers = append(config.Servers[:i], config.Servers[i+1:]...)
+				return config, true, nil
+			}
+		}
+		return config, false, fmt.Errorf("server %q is not part of the configuration", id)
+	})
+}
+
+// bootstrap starts a new cluster with the given configuration on a node
+// without any state
+func (n *raftNode) bootstrap(config raftConfiguration) error {
+	n.l.Lock()
+	defer n.l.Unlock()
+
+	if n.currentTerm != 0 || n.lastIndexLocked() != 0 {
+		return errRaftAlreadyBootstrapped
+	}
+
+	buf, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to encode raft configuration: %v", err)
+	}
+	n.currentTerm = 1
+	n.persistStateLocked()
+	if err := n.appendEntriesLocked([]*raftLogEntry{
+		&raftLogEntry{
+			Index: 1,
+			Term:  1,
+			Type:  raftEntryConfiguration,
+			Data:  buf,
+		},
+	}); err != nil {
+		return err
+	}
+
+	// Campaign right away
+	n.electionDeadline = time.Now()
+	return nil
+}
+
+// hasState returns whether the node is bootstrapped or part of a cluster
+func (n *raftNode) hasState() bool {
+	n.l.Lock()
+	defer n.l.Unlock()
+
+	return n.currentTerm != 0 || n.lastIndexLocked() != 0
+}
+
+// transferLeadership hands the leadership over to the voter with the given
+// ID, or to the most up to date voter, preferring voters waiting for the HA
+// lock. It returns once the node lost the leadership.
+func (n *raftNode) transferLeadership(id string) error {
+	n.l.Lock()
+	target, err := n.startTransferLocked(id)
+	n.l.Unlock()
+	if err != nil {
+		return err
+	}
+	return n.completeTransfer(target)
+}
+
+// startTransferLocked picks the target of a leadership transfer, and stops
+// the leader from accepting new entries
+func (n *raftNode) startTransferLocked(id string) (*raftReplicator, error) {
+	if err := n.checkLeaderLocked(); err != nil {
+		return nil, err
+	}
+
+	var target *raftReplicator
+	if id != "" {
+		target = n.replicators[id]
+		if target == nil || target.server.NonVoter {
+			return nil, fmt.Errorf("server %q is not a voter of the cluster", id)
+		}
+	} else {
+		for _, r := range n.replicators {
+			if r.server.NonVoter {
+				continue
+			}
+			if target == nil || (r.lockWanted && !target.lockWanted) ||
+				(r.lockWanted == target.lockWanted && r.matchIndex > target.matchIndex) {
+				target = r
+			}
+		}
+		if target == nil {
+			return nil, fmt.Errorf("no voter to transfer the leadership to")
+		}
+	}
+
+	n.transferring = true
+	n.transferStart = time.Now()
+	return target, nil
+}
+
+// completeTransfer waits for the target of a leadership transfer to catch up
+// with the log, and tells it to start an election
+func (n *raftNode) completeTransfer(target *raftReplicator) error {
+	n.l.Lock()
+	term := n.currentTerm
+	leaderCh := n.leaderCh
+	server := target.server
+	n.l.Unlock()
+
+	cancel := func(err error) error {
+		n.l.Lock()
+		if n.state == raftLeader && n.currentTerm == term {
+			n.transferring = false
+		}
+		n.l.Unlock()
+		return err
+	}
+
+	deadline := time.After(2 * n.electionTimeout)
+	for {
+		n.l.Lock()
+		if n.state != raftLeader || n.currentTerm != term {
+			n.l.Unlock()
+			return nil
+		}
+		caughtUp := target.matchIndex >= n.lastIndexLocked()
+		target.trigger()
+		n.l.Unlock()
+		if caughtUp {
+			break
+		}
+
+		select {
+		case <-deadline:
+			return cancel(fmt.Errorf("timed out waiting for server %q to catch up", server.ID))
+		case <-n.shutdownCh:
+			return errRaftShutdown
+		case <-time.After(n.heartbeatInterval / 10):
+		}
+	}
+
+	n.logger.Info("raft: transferring leadership", "id", server.ID)
+	resp := new(raftTimeoutNowResponse)
+	if err := n.transport.call(server.Address, raftRPCTimeoutNow, &raftTimeoutNowRequest{
+		Term:     term,
+		LeaderID: n.id,
+	}, resp, n.electionTimeout); err != nil {
+		return cancel(fmt.Errorf("failed to transfer leadership to server %q: %v", server.ID, err))
+	}
+
+	select {
+	case <-leaderCh:
+		return nil
+	case <-deadline:
+		return cancel(fmt.Errorf("timed out transferring leadership to server %q", server.ID))
+	case <-n.shutdownCh:
+		return errRaftShutdown
+	}
+}
+
+// leadership returns the leader channel of the node, which is nil unless the
+// node leads the cluster, and a channel closed on the next change of state
+func (n *raftNode) leadership() (chan struct{}, chan struct{}) {
+	n.l.Lock()
+	defer n.l.Unlock()
+
+	if n.state != raftLeader || n.transferring {
+		return nil, n.stateCh
+	}
+	return n.leaderCh, n.stateCh
+}
+
+// waitCommitPropagated waits, up to a heartbeat interval, until the voters
+// learned about the entries committed so far
+func (n *raftNode) waitCommitPropagated() {
+	n.l.Lock()
+	index := n.commitIndex
+	n.l.Unlock()
+
+	deadline := time.Now().Add(n.heartbeatInterval)
+	for time.Now().Before(deadline) {
+		n.l.Lock()
+		done := true
+		if n.state == raftLeader {
+			for _, r := range n.replicators {
+				if !r.server.NonVoter && time.Since(r.lastContact) < n.electionTimeout && r.commitSent < index {
+					done = false
+				}
+			}
+		}
+		n.l.Unlock()
+		if done {
+			return
+		}
+		time.Sleep(n.heartbeatInterval / 20)
+	}
+}
+
+// addLockInterest tracks the HA locks held or waited for on the node
+func (n *raftNode) addLockInterest(delta int) {
+	n.l.Lock()
+	n.lockInterest += delta
+	n.l.Unlock()
+}
+
+// close shuts the node down
+func (n *raftNode) close() error {
+	n.l.Lock()
+	if n.shutdown {
+		n.l.Unlock()
+		return nil
+	}
+	n.stepDownLocked(n.currentTerm)
+	n.shutdown = true
+	n.persistStateLocked()
+	close(n.shutdownCh)
+	n.l.Unlock()
+
+	err := n.transport.close()
+
+	n.l.Lock()
+	defer n.l.Unlock()
+	if closeErr := n.store.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// isClosed returns whether a channel is closed
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
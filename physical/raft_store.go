@@ -0,0 +1,333 @@
+package physical
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+)
+
+const (
+	raftStateFileName    = "raft-state.json"
+	raftLogFileName      = "raft.log"
+	raftSnapshotFileName = "snapshot.gz"
+	raftNodeIDFileName   = "node-id"
+
+	// raftRecordHeaderSize is the size of the header of the log records,
+	// holding the length and the CRC32 checksum of the encoded entry
+	raftRecordHeaderSize = 8
+)
+
+// raftPersistentState is the state of a raft node which must survive
+// restarts. The commit index is only a hint, persisted now and then so that
+// restarted nodes can apply the entries known to be committed right away.
+type raftPersistentState struct {
+	CurrentTerm uint64 `json:"current_term"`
+	VotedFor    string `json:"voted_for"`
+	CommitIndex uint64 `json:"commit_index"`
+}
+
+// raftStore durably stores the state of a raft node in its directory: the
+// current term and vote, the latest snapshot, and the log entries following
+// the snapshot. The log is an append-only file of length-prefixed and
+// checksummed JSON records, which is rewritten when compacted.
+type raftStore struct {
+	path string
+
+	logFile *os.File
+
+	// offsets are the file offsets of the entries in the log file
+	offsets []int64
+	size    int64
+}
+
+// openRaftStore opens the raft store in the given directory, creating it if
+// needed, and returns the log entries it holds
+func openRaftStore(path string) (*raftStore, []*raftLogEntry, error) {
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, nil, fmt.Errorf("failed to create raft directory: %v", err)
+	}
+
+	s := &raftStore{
+		path: path,
+	}
+	entries, err := s.openLog()
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, entries, nil
+}
+
+// openLog reads the entries of the log file. A torn record at the end of the
+// file, left by a crash while appending, is truncated.
+func (s *raftStore) openLog() ([]*raftLogEntry, error) {
+	f, err := os.OpenFile(filepath.Join(s.path, raftLogFileName), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open raft log: %v", err)
+	}
+
+	var entries []*raftLogEntry
+	var offsets []int64
+	var offset int64
+	r := bufio.NewReader(f)
+	for {
+		entry, n, err := readRaftRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if err := f.Truncate(offset); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("failed to truncate torn raft log record: %v", err)
+			}
+			break
+		}
+		entries = append(entries, entry)
+		offsets = append(offsets, offset)
+		offset += n
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to seek raft log: %v", err)
+	}
+
+	s.logFile = f
+	s.offsets = offsets
+	s.size = offset
+	return entries, nil
+}
+
+// readRaftRecord reads a log record, returning the entry and the size of the
+// record
+func readRaftRecord(r io.Reader) (*raftLogEntry, int64, error) {
+	var header [raftRecordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, 0, fmt.Errorf("torn record header")
+		}
+		return nil, 0, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, 0, fmt.Errorf("torn record: %v", err)
+	}
+	if crc32.ChecksumIEEE(buf) != checksum {
+		return nil, 0, fmt.Errorf("record checksum mismatch")
+	}
+
+	entry := new(raftLogEntry)
+	if err := jsonutil.DecodeJSON(buf, entry); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode record: %v", err)
+	}
+	return entry, int64(raftRecordHeaderSize + len(buf)), nil
+}
+
+// encodeRaftRecords encodes entries as log records
+func encodeRaftRecords(entries []*raftLogEntry) ([]byte, []int64, error) {
+	var out []byte
+	sizes := make([]int64, 0, len(entries))
+	for _, entry := range entries {
+		buf, err := json.Marshal(entry)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to encode raft log entry: %v", err)
+		}
+
+		var header [raftRecordHeaderSize]byte
+		binary.BigEndian.PutUint32(header[0:4], uint32(len(buf)))
+		binary.BigEndian.PutUint32(header[4:8], crc32.ChecksumIEEE(buf))
+		out = append(out, header[:]...)
+		out = append(out, buf...)
+		sizes = append(sizes, int64(raftRecordHeaderSize+len(buf)))
+	}
+	return out, sizes, nil
+}
+
+// appendEntries durably appends entries to the log
+func (s *raftStore) appendEntries(entries []*raftLogEntry) error {
+	buf, sizes, err := encodeRaftRecords(entries)
+	if err != nil {
+		return err
+	}
+	if _, err := s.logFile.Write(buf); err != nil {
+		return fmt.Errorf("failed to append to raft log: %v", err)
+	}
+	if err := s.logFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync raft log: %v", err)
+	}
+
+	for _, size := range sizes {
+		s.offsets = append(s.offsets, s.size)
+		s.size += size
+	}
+	return nil
+}
+
+// truncate removes the entries of the log following the first keep entries
+func (s *raftStore) truncate(keep int) error {
+	if keep >= len(s.offsets) {
+		return nil
+	}
+
+	offset := s.offsets[keep]
+	if err := s.logFile.Truncate(offset); err != nil {
+		return fmt.Errorf("failed to truncate raft log: %v", err)
+	}
+	if _, err := s.logFile.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek raft log: %v", err)
+	}
+	if err := s.logFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync raft log: %v", err)
+	}
+
+	s.offsets = s.offsets[:keep]
+	s.size = offset
+	return nil
+}
+
+// rewriteLog atomically replaces the log with the given entries
+func (s *raftStore) rewriteLog(entries []*raftLogEntry) error {
+	buf, sizes, err := encodeRaftRecords(entries)
+	if err != nil {
+		return err
+	}
+	if err := s.writeFileAtomic(raftLogFileName, buf); err != nil {
+		return fmt.Errorf("failed to rewrite raft log: %v", err)
+	}
+
+	s.logFile.Close()
+	f, err := os.OpenFile(filepath.Join(s.path, raftLogFileName), os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open raft log: %v", err)
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to seek raft log: %v", err)
+	}
+
+	s.logFile = f
+	s.offsets = make([]int64, 0, len(sizes))
+	s.size = 0
+	for _, size := range sizes {
+		s.offsets = append(s.offsets, s.size)
+		s.size += size
+	}
+	return nil
+}
+
+// readState reads the persistent state, which is empty for new nodes
+func (s *raftStore) readState() (*raftPersistentState, error) {
+	state := new(raftPersistentState)
+	buf, err := ioutil.ReadFile(filepath.Join(s.path, raftStateFileName))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read raft state: %v", err)
+	}
+	if err := jsonutil.DecodeJSON(buf, state); err != nil {
+		return nil, fmt.Errorf("failed to decode raft state: %v", err)
+	}
+	return state, nil
+}
+
+// writeState durably writes the persistent state
+func (s *raftStore) writeState(state *raftPersistentState) error {
+	buf, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode raft state: %v", err)
+	}
+	if err := s.writeFileAtomic(raftStateFileName, buf); err != nil {
+		return fmt.Errorf("failed to write raft state: %v", err)
+	}
+	return nil
+}
+
+// readSnapshot returns the encoded latest snapshot, or nil if there is none
+func (s *raftStore) readSnapshot() ([]byte, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(s.path, raftSnapshotFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read raft snapshot: %v", err)
+	}
+	return buf, nil
+}
+
+// writeSnapshot durably replaces the latest snapshot
+func (s *raftStore) writeSnapshot(snapshot []byte) error {
+	if err := s.writeFileAtomic(raftSnapshotFileName, snapshot); err != nil {
+		return fmt.Errorf("failed to write raft snapshot: %v", err)
+	}
+	return nil
+}
+
+// readNodeID returns the persisted ID of the node, or an empty string
+func (s *raftStore) readNodeID() (string, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(s.path, raftNodeIDFileName))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read raft node ID: %v", err)
+	}
+	return string(buf), nil
+}
+
+// writeNodeID persists the ID of the node
+func (s *raftStore) writeNodeID(id string) error {
+	if err := s.writeFileAtomic(raftNodeIDFileName, []byte(id)); err != nil {
+		return fmt.Errorf("failed to write raft node ID: %v", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes a file of the store via a synced temporary file,
+// renamed over the file
+func (s *raftStore) writeFileAtomic(name string, buf []byte) error {
+	path := filepath.Join(s.path, name)
+	tmpPath := path + ".tmp"
+
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	// Sync the directory so that the rename is durable
+	dir, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// close closes the log file
+func (s *raftStore) close() error {
+	return s.logFile.Close()
+}
@@ -0,0 +1,707 @@
+package physical
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	log "github.com/mgutz/logxi/v1"
+)
+
+func testRaftAddress(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func testRaftBackend(t *testing.T, path, address string, conf map[string]string) *RaftBackend {
+	raftBaseHeartbeatInterval = 50 * time.Millisecond
+	raftBaseElectionTimeout = 250 * time.Millisecond
+	raftAutopilotInterval = 50 * time.Millisecond
+
+	config := map[string]string{
+		"path":        path,
+		"address":     address,
+		"tls_disable": "true",
+	}
+	for k, v := range conf {
+		config[k] = v
+	}
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	b, err := NewRaftBackend(config, logger)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	autopilotConfig := DefaultRaftAutopilotConfig()
+	autopilotConfig.ServerStabilizationTime = 200 * time.Millisecond
+	b.SetAutopilotConfig(autopilotConfig)
+	return b
+}
+
+// testRaftCluster bootstraps a cluster with the first backend, and joins
+// the others to it
+func testRaftCluster(t *testing.T, count int) ([]*RaftBackend, []string, func()) {
+	var backends []*RaftBackend
+	var paths []string
+	cleanup := func() {
+		for _, b := range backends {
+			b.Close()
+		}
+		for _, path := range paths {
+			os.RemoveAll(path)
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		path, err := ioutil.TempDir("", "vault-raft")
+		if err != nil {
+			cleanup()
+			t.Fatalf("err: %v", err)
+		}
+		paths = append(paths, path)
+		backends = append(backends, testRaftBackend(t, path, testRaftAddress(t), map[string]string{
+			"node_id": fmt.Sprintf("node%d", i+1),
+		}))
+	}
+
+	if err := backends[0].Bootstrap(); err != nil {
+		cleanup()
+		t.Fatalf("err: %v", err)
+	}
+	for _, b := range backends[1:] {
+		if err := b.Join(backends[0].node.address, false); err != nil {
+			cleanup()
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// Wait for autopilot to promote the new servers
+	testRaftWait(t, func() bool {
+		config := backends[0].Configuration()
+		for _, s := range config.Servers {
+			if !s.Voter {
+				return false
+			}
+		}
+		return len(config.Servers) == count
+	})
+	return backends, paths, cleanup
+}
+
+// testRaftWait polls the condition until it holds
+func testRaftWait(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func testRaftLeader(t *testing.T, backends []*RaftBackend) *RaftBackend {
+	var leader *RaftBackend
+	testRaftWait(t, func() bool {
+		for _, b := range backends {
+			if leaderCh, _ := b.node.leadership(); leaderCh != nil {
+				leader = b
+				return true
+			}
+		}
+		return false
+	})
+	return leader
+}
+
+func TestRaftBackend(t *testing.T) {
+	path, err := ioutil.TempDir("", "vault-raft")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(path)
+
+	b := testRaftBackend(t, path, testRaftAddress(t), nil)
+	defer b.Close()
+
+	// Writes fail until the cluster is bootstrapped
+	if err := b.Put(&Entry{Key: "foo", Value: []byte("bar")}); err != errRaftNotLeader {
+		t.Fatalf("expected not leader error, got %v", err)
+	}
+	if err := b.Bootstrap(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	testBackend(t, b)
+	testBackend_ListPrefix(t, b)
+}
+
+func TestRaftBackend_Transaction(t *testing.T) {
+	backends, _, cleanup := testRaftCluster(t, 1)
+	defer cleanup()
+	b := backends[0]
+
+	if err := b.Put(&Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := b.Transaction([]TxnEntry{
+		{Operation: DeleteOperation, Entry: &Entry{Key: "foo"}},
+		{Operation: PutOperation, Entry: &Entry{Key: "zip", Value: []byte("zap")}},
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	keys, err := b.List("")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"zip"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+}
+
+func TestRaftBackend_Restart(t *testing.T) {
+	path, err := ioutil.TempDir("", "vault-raft")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(path)
+
+	// Compact the log along the way
+	conf := map[string]string{
+		"snapshot_threshold": "10",
+	}
+	address := testRaftAddress(t)
+	b := testRaftBackend(t, path, address, conf)
+	if err := b.Bootstrap(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for i := 0; i < 25; i++ {
+		if err := b.Put(&Entry{Key: fmt.Sprintf("foo/%d", i), Value: []byte("bar")}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if err := b.Delete("foo/3"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if b.node.snapshotIndex == 0 {
+		t.Fatalf("expected the log to be compacted")
+	}
+	nodeID := b.NodeID()
+	b.Close()
+
+	b = testRaftBackend(t, path, address, conf)
+	defer b.Close()
+	if b.NodeID() != nodeID {
+		t.Fatalf("bad: node ID %q, expected %q", b.NodeID(), nodeID)
+	}
+
+	// The committed entries are available right away
+	keys, err := b.List("foo/")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(keys) != 24 {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	testRaftLeader(t, []*RaftBackend{b})
+	if err := b.Put(&Entry{Key: "foo/3", Value: []byte("baz")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	out, err := b.Get("foo/3")
+	if err != nil || out == nil || string(out.Value) != "baz" {
+		t.Fatalf("err: %v out: %#v", err, out)
+	}
+
+	// The ID of the node can't be changed
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	if _, err := NewRaftBackend(map[string]string{
+		"path":        path,
+		"address":     testRaftAddress(t),
+		"tls_disable": "true",
+		"node_id":     "other",
+	}, logger); err == nil {
+		t.Fatalf("expected an error changing the node ID")
+	}
+}
+
+func TestRaftBackend_Cluster(t *testing.T) {
+	backends, _, cleanup := testRaftCluster(t, 3)
+	defer cleanup()
+
+	leader := testRaftLeader(t, backends)
+	if err := leader.Put(&Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The entries are replicated to the followers
+	for _, b := range backends {
+		testRaftWait(t, func() bool {
+			out, _ := b.Get("foo")
+			return out != nil && string(out.Value) == "bar"
+		})
+		if b != leader {
+			if err := b.Put(&Entry{Key: "foo", Value: []byte("baz")}); err != errRaftNotLeader {
+				t.Fatalf("expected not leader error, got %v", err)
+			}
+		}
+	}
+
+	config := leader.Configuration()
+	if len(config.Servers) != 3 {
+		t.Fatalf("bad: %#v", config)
+	}
+	for _, s := range config.Servers {
+		if !s.Voter || s.Leader != (s.NodeID == leader.NodeID()) {
+			t.Fatalf("bad: %#v", s)
+		}
+	}
+
+	// Nodes with state can't join another cluster
+	if err := backends[1].Join(leader.node.address, false); err != errRaftAlreadyBootstrapped {
+		t.Fatalf("expected already bootstrapped error, got %v", err)
+	}
+
+	// Transfer the leadership to a given node
+	var target *RaftBackend
+	for _, b := range backends {
+		if b != leader {
+			target = b
+		}
+	}
+	if err := leader.TransferLeadership(target.NodeID()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if newLeader := testRaftLeader(t, backends); newLeader != target {
+		t.Fatalf("bad: leader %q, expected %q", newLeader.NodeID(), target.NodeID())
+	}
+	if err := target.Put(&Entry{Key: "zip", Value: []byte("zap")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Stop and remove the old leader; the remaining nodes form a quorum
+	if err := leader.Close(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := target.RemovePeer(leader.NodeID()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := target.RemovePeer(leader.NodeID()); err == nil {
+		t.Fatalf("expected an error removing a removed node")
+	}
+	if len(target.Configuration().Servers) != 2 {
+		t.Fatalf("bad: %#v", target.Configuration())
+	}
+	if err := target.Put(&Entry{Key: "zip", Value: []byte("zop")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestRaftBackend_Snapshot(t *testing.T) {
+	backends, _, cleanup := testRaftCluster(t, 2)
+	defer cleanup()
+
+	leader := testRaftLeader(t, backends)
+	if err := leader.Put(&Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	snapshot, err := leader.Snapshot()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	data, err := SnapshotData(snapshot)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(data, map[string][]byte{"foo": []byte("bar")}) {
+		t.Fatalf("bad: %v", data)
+	}
+
+	if err := leader.Put(&Entry{Key: "zip", Value: []byte("zap")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := leader.Delete("foo"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err := leader.Restore([]byte("garbage")); err == nil {
+		t.Fatalf("expected an error restoring an invalid snapshot")
+	}
+	if err := leader.Restore(snapshot); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The restore is replicated, and leaves the membership as is
+	for _, b := range backends {
+		testRaftWait(t, func() bool {
+			keys, _ := b.List("")
+			return reflect.DeepEqual(keys, []string{"foo"})
+		})
+		if len(b.Configuration().Servers) != 2 {
+			t.Fatalf("bad: %#v", b.Configuration())
+		}
+	}
+}
+
+func TestRaftBackend_InstallSnapshot(t *testing.T) {
+	conf := map[string]string{
+		"snapshot_threshold": "5",
+	}
+	path, err := ioutil.TempDir("", "vault-raft")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(path)
+	leader := testRaftBackend(t, path, testRaftAddress(t), conf)
+	defer leader.Close()
+	if err := leader.Bootstrap(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		if err := leader.Put(&Entry{Key: fmt.Sprintf("foo/%d", i), Value: []byte("bar")}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// The compacted entries are sent as a snapshot to new nodes
+	path2, err := ioutil.TempDir("", "vault-raft")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(path2)
+	follower := testRaftBackend(t, path2, testRaftAddress(t), conf)
+	defer follower.Close()
+	if err := follower.Join(leader.node.address, false); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	testRaftWait(t, func() bool {
+		keys, _ := follower.List("foo/")
+		return len(keys) == 20
+	})
+	if follower.node.snapshotIndex == 0 {
+		t.Fatalf("expected a snapshot to be installed")
+	}
+}
+
+func TestRaftBackend_HA(t *testing.T) {
+	backends, _, cleanup := testRaftCluster(t, 2)
+	defer cleanup()
+
+	leader := testRaftLeader(t, backends)
+	other := backends[0]
+	if other == leader {
+		other = backends[1]
+	}
+	testHABackend(t, leader, other)
+
+	// The lock is lost along with the leadership
+	lock, err := other.LockWith("bar", "baz")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	testRaftLeader(t, backends)
+	leaderCh, err := lock.Lock(nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := other.TransferLeadership(""); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	select {
+	case <-leaderCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the lock to be lost")
+	}
+	if held, _, err := lock.Value(); err != nil || held {
+		t.Fatalf("err: %v held: %v", err, held)
+	}
+	lock.Unlock()
+}
+
+func TestRaftBackend_TLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-raft-tls")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeCA := func(name string) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: name},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		cert, _ := x509.ParseCertificate(der)
+		ioutil.WriteFile(filepath.Join(dir, name+"-ca.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+		return cert, key
+	}
+	writeCert := func(name string, ca *x509.Certificate, caKey *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		ioutil.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+		ioutil.WriteFile(filepath.Join(dir, name+"-key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	}
+	tlsConf := func(name, caName string) map[string]string {
+		return map[string]string{
+			"tls_disable":   "false",
+			"tls_cert_file": filepath.Join(dir, name+".pem"),
+			"tls_key_file":  filepath.Join(dir, name+"-key.pem"),
+			"tls_ca_file":   filepath.Join(dir, caName+"-ca.pem"),
+		}
+	}
+
+	ca, caKey := writeCA("cluster")
+	other, otherKey := writeCA("other")
+	writeCert("node1", ca, caKey)
+	writeCert("node2", ca, caKey)
+	writeCert("rogue", other, otherKey)
+
+	path1, _ := ioutil.TempDir(dir, "node1")
+	leader := testRaftBackend(t, path1, testRaftAddress(t), tlsConf("node1", "cluster"))
+	defer leader.Close()
+	if err := leader.Bootstrap(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Nodes without a certificate signed by the CA of the cluster can't join
+	path2, _ := ioutil.TempDir(dir, "rogue")
+	rogue := testRaftBackend(t, path2, testRaftAddress(t), tlsConf("rogue", "other"))
+	defer rogue.Close()
+	if err := rogue.Join(leader.node.address, false); err == nil {
+		t.Fatalf("expected an error joining with an untrusted certificate")
+	}
+
+	path3, _ := ioutil.TempDir(dir, "node2")
+	follower := testRaftBackend(t, path3, testRaftAddress(t), tlsConf("node2", "cluster"))
+	defer follower.Close()
+	if err := follower.Join(leader.node.address, false); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := leader.Put(&Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	testRaftWait(t, func() bool {
+		out, _ := follower.Get("foo")
+		return out != nil
+	})
+}
+
+func TestRaftBackend_Autopilot(t *testing.T) {
+	backends, _, cleanup := testRaftCluster(t, 3)
+	defer cleanup()
+
+	leader := testRaftLeader(t, backends)
+	if _, err := leader.AutopilotState(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for _, b := range backends {
+		if b == leader {
+			continue
+		}
+		if _, err := b.AutopilotState(); err != errRaftNotLeader {
+			t.Fatalf("expected not leader error, got %v", err)
+		}
+	}
+
+	testRaftWait(t, func() bool {
+		state, err := leader.AutopilotState()
+		return err == nil && state.Healthy && state.FailureTolerance == 1 && len(state.Voters) == 3
+	})
+
+	// Non-voters are not promoted
+	path, err := ioutil.TempDir("", "vault-raft")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(path)
+	nonVoter := testRaftBackend(t, path, testRaftAddress(t), map[string]string{
+		"node_id": "nonvoter",
+	})
+	if err := nonVoter.Join(leader.node.address, true); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	testRaftWait(t, func() bool {
+		state, err := leader.AutopilotState()
+		return err == nil && state.Servers["nonvoter"] != nil && state.Servers["nonvoter"].Healthy
+	})
+	time.Sleep(500 * time.Millisecond)
+	state, err := leader.AutopilotState()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if status := state.Servers["nonvoter"].Status; status != RaftServerStatusNonVoter {
+		t.Fatalf("bad: %s", status)
+	}
+
+	// Dead servers are removed, unless the voters would fall below the
+	// minimum quorum
+	var dead *RaftBackend
+	for _, b := range backends {
+		if b != leader {
+			dead = b
+			break
+		}
+	}
+	dead.Close()
+	nonVoter.Close()
+
+	config := DefaultRaftAutopilotConfig()
+	config.CleanupDeadServers = true
+	config.LastContactThreshold = 200 * time.Millisecond
+	config.DeadServerLastContactThreshold = 500 * time.Millisecond
+	config.MinQuorum = 3
+	leader.SetAutopilotConfig(config)
+
+	testRaftWait(t, func() bool {
+		state, err := leader.AutopilotState()
+		return err == nil && state.Servers["nonvoter"] == nil && !state.Servers[dead.NodeID()].Healthy
+	})
+	time.Sleep(500 * time.Millisecond)
+	state, err = leader.AutopilotState()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(state.Voters) != 3 || state.Healthy || state.FailureTolerance != 0 {
+		t.Fatalf("bad: %#v", state)
+	}
+
+	config.MinQuorum = 2
+	leader.SetAutopilotConfig(config)
+	testRaftWait(t, func() bool {
+		state, err := leader.AutopilotState()
+		return err == nil && len(state.Voters) == 2 && state.Healthy
+	})
+}
+
+func TestRaftBackend_RedundancyZones(t *testing.T) {
+	var backends []*RaftBackend
+	for i, zone := range []string{"a", "b", "c", "c"} {
+		path, err := ioutil.TempDir("", "vault-raft")
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		defer os.RemoveAll(path)
+		b := testRaftBackend(t, path, testRaftAddress(t), map[string]string{
+			"node_id":                   fmt.Sprintf("node%d", i+1),
+			"autopilot_redundancy_zone": zone,
+		})
+		defer b.Close()
+		config := b.AutopilotConfig()
+		config.LastContactThreshold = 300 * time.Millisecond
+		b.SetAutopilotConfig(config)
+		backends = append(backends, b)
+	}
+
+	if err := backends[0].Bootstrap(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for _, b := range backends[1:] {
+		if err := b.Join(backends[0].node.address, false); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	leader := testRaftLeader(t, backends)
+
+	// A single server of the zone is promoted, the other stands by
+	var voter, spare string
+	testRaftWait(t, func() bool {
+		state, err := leader.AutopilotState()
+		if err != nil {
+			return false
+		}
+		zone := state.RedundancyZones["c"]
+		if zone == nil || len(zone.Voters) != 1 || zone.FailureTolerance != 1 {
+			return false
+		}
+		voter = zone.Voters[0]
+		for _, id := range zone.Servers {
+			if id != voter {
+				spare = id
+			}
+		}
+		return true
+	})
+	time.Sleep(500 * time.Millisecond)
+	state, err := leader.AutopilotState()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(state.Voters) != 3 || state.Servers[spare].Status != RaftServerStatusStaging {
+		t.Fatalf("bad: %#v", state)
+	}
+	for _, s := range leader.Configuration().Servers {
+		if s.RedundancyZone == "" {
+			t.Fatalf("bad: %#v", s)
+		}
+	}
+
+	// The spare replaces the failed voter of its zone
+	if voter == leader.NodeID() {
+		if err := leader.TransferLeadership(""); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		leader = testRaftLeader(t, backends)
+	}
+	for _, b := range backends {
+		if b.NodeID() == voter {
+			b.Close()
+		}
+	}
+	testRaftWait(t, func() bool {
+		state, err := leader.AutopilotState()
+		if err != nil {
+			return false
+		}
+		zone := state.RedundancyZones["c"]
+		return reflect.DeepEqual(zone.Voters, []string{spare}) &&
+			state.Servers[voter].Status == RaftServerStatusStaging
+	})
+}
@@ -0,0 +1,293 @@
+package physical
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/helper/jsonutil"
+)
+
+const (
+	raftRPCRequestVote     = "request_vote"
+	raftRPCAppendEntries   = "append_entries"
+	raftRPCInstallSnapshot = "install_snapshot"
+	raftRPCTimeoutNow      = "timeout_now"
+	raftRPCJoin            = "join"
+
+	// raftMaxRPCSize is the maximum size of the RPC requests, which may hold
+	// snapshots
+	raftMaxRPCSize = 512 * 1024 * 1024
+)
+
+type raftRequestVoteRequest struct {
+	Term               uint64 `json:"term"`
+	CandidateID        string `json:"candidate_id"`
+	LastLogIndex       uint64 `json:"last_log_index"`
+	LastLogTerm        uint64 `json:"last_log_term"`
+	LeadershipTransfer bool   `json:"leadership_transfer"`
+}
+
+type raftRequestVoteResponse struct {
+	Term    uint64 `json:"term"`
+	Granted bool   `json:"granted"`
+}
+
+type raftAppendEntriesRequest struct {
+	Term          uint64          `json:"term"`
+	LeaderID      string          `json:"leader_id"`
+	LeaderAddress string          `json:"leader_address"`
+	PrevLogIndex  uint64          `json:"prev_log_index"`
+	PrevLogTerm   uint64          `json:"prev_log_term"`
+	Entries       []*raftLogEntry `json:"entries"`
+	LeaderCommit  uint64          `json:"leader_commit"`
+}
+
+type raftAppendEntriesResponse struct {
+	Term         uint64 `json:"term"`
+	Success      bool   `json:"success"`
+	LastLogIndex uint64 `json:"last_log_index"`
+
+	// LockWanted is set when the node is waiting for an HA lock, which it
+	// can only acquire once it leads the cluster
+	LockWanted bool `json:"lock_wanted"`
+}
+
+type raftInstallSnapshotRequest struct {
+	Term          uint64 `json:"term"`
+	LeaderID      string `json:"leader_id"`
+	LeaderAddress string `json:"leader_address"`
+	LastIndex     uint64 `json:"last_index"`
+	LastTerm      uint64 `json:"last_term"`
+	Snapshot      []byte `json:"snapshot"`
+}
+
+type raftInstallSnapshotResponse struct {
+	Term    uint64 `json:"term"`
+	Success bool   `json:"success"`
+}
+
+type raftTimeoutNowRequest struct {
+	Term     uint64 `json:"term"`
+	LeaderID string `json:"leader_id"`
+}
+
+type raftTimeoutNowResponse struct {
+	Term uint64 `json:"term"`
+}
+
+type raftJoinRequest struct {
+	ID             string `json:"id"`
+	Address        string `json:"address"`
+	NonVoter       bool   `json:"non_voter"`
+	RedundancyZone string `json:"redundancy_zone"`
+}
+
+type raftJoinResponse struct {
+	// LeaderAddress is the address of the leader, set when the request was
+	// sent to a follower
+	LeaderAddress string `json:"leader_address"`
+	Error         string `json:"error"`
+}
+
+// raftRPCHandler handles the RPCs of the other nodes of the cluster
+type raftRPCHandler interface {
+	requestVote(*raftRequestVoteRequest) *raftRequestVoteResponse
+	appendEntries(*raftAppendEntriesRequest) *raftAppendEntriesResponse
+	installSnapshot(*raftInstallSnapshotRequest) *raftInstallSnapshotResponse
+	timeoutNow(*raftTimeoutNowRequest) *raftTimeoutNowResponse
+	join(*raftJoinRequest) *raftJoinResponse
+}
+
+// raftTransport carries the RPCs between the nodes of a raft cluster, as
+// JSON over HTTP. Unless TLS is disabled, the nodes authenticate each other
+// with certificates signed by the configured CA.
+type raftTransport struct {
+	listener net.Listener
+	server   *http.Server
+	client   *http.Client
+	scheme   string
+}
+
+// newRaftTransport starts listening on the given address. A nil TLS
+// configuration disables TLS.
+func newRaftTransport(address string, tlsConfig *raftTLSConfig) (*raftTransport, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on raft address %q: %v", address, err)
+	}
+
+	transport := &raftTransport{
+		listener: listener,
+		client:   cleanhttp.DefaultPooledClient(),
+		scheme:   "http",
+	}
+	if tlsConfig != nil {
+		transport.listener = tls.NewListener(listener, tlsConfig.server)
+		transport.client.Transport.(*http.Transport).TLSClientConfig = tlsConfig.client
+		transport.scheme = "https"
+	}
+	return transport, nil
+}
+
+// serve handles the RPCs with the given handler until the transport is
+// closed
+func (t *raftTransport) serve(handler raftRPCHandler) {
+	mux := http.NewServeMux()
+	handle := func(rpc string, newRequest func() interface{}, fn func(interface{}) interface{}) {
+		mux.HandleFunc("/raft/v1/"+rpc, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "POST" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			req := newRequest()
+			if err := jsonutil.DecodeJSONFromReader(http.MaxBytesReader(w, r.Body, raftMaxRPCSize), req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(fn(req))
+		})
+	}
+
+	handle(raftRPCRequestVote, func() interface{} { return new(raftRequestVoteRequest) }, func(req interface{}) interface{} {
+		return handler.requestVote(req.(*raftRequestVoteRequest))
+	})
+	handle(raftRPCAppendEntries, func() interface{} { return new(raftAppendEntriesRequest) }, func(req interface{}) interface{} {
+		return handler.appendEntries(req.(*raftAppendEntriesRequest))
+	})
+	handle(raftRPCInstallSnapshot, func() interface{} { return new(raftInstallSnapshotRequest) }, func(req interface{}) interface{} {
+		return handler.installSnapshot(req.(*raftInstallSnapshotRequest))
+	})
+	handle(raftRPCTimeoutNow, func() interface{} { return new(raftTimeoutNowRequest) }, func(req interface{}) interface{} {
+		return handler.timeoutNow(req.(*raftTimeoutNowRequest))
+	})
+	handle(raftRPCJoin, func() interface{} { return new(raftJoinRequest) }, func(req interface{}) interface{} {
+		return handler.join(req.(*raftJoinRequest))
+	})
+
+	t.server = &http.Server{
+		Handler: mux,
+	}
+	go t.server.Serve(t.listener)
+}
+
+// call sends an RPC to the node with the given address
+func (t *raftTransport) call(address, rpc string, req, resp interface{}, timeout time.Duration) error {
+	buf, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequest("POST", fmt.Sprintf("%s://%s/raft/v1/%s", t.scheme, address, rpc), bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	cancelCh := make(chan struct{})
+	httpReq.Cancel = cancelCh
+	timer := time.AfterFunc(timeout, func() {
+		close(cancelCh)
+	})
+	defer timer.Stop()
+
+	httpResp, err := t.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(httpResp.Body)
+		return fmt.Errorf("raft RPC %s to %s failed with status %d: %s", rpc, address, httpResp.StatusCode, bytes.TrimSpace(body))
+	}
+	return jsonutil.DecodeJSONFromReader(httpResp.Body, resp)
+}
+
+// close stops listening for RPCs
+func (t *raftTransport) close() error {
+	if t.server != nil {
+		return t.server.Close()
+	}
+	return t.listener.Close()
+}
+
+// raftTLSConfig holds the TLS configurations of the raft listener and of
+// the connections to the other nodes
+type raftTLSConfig struct {
+	server *tls.Config
+	client *tls.Config
+}
+
+// newRaftTLSConfig loads the certificate of the node and the CA certificate
+// of the cluster. Nodes are identified by their raft addresses, which may
+// not be part of their certificates, so the certificates of the nodes are
+// only verified to be signed by the CA.
+func newRaftTLSConfig(certFile, keyFile, caFile string) (*raftTLSConfig, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load raft TLS certificate: %v", err)
+	}
+
+	caPEM, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read raft TLS CA certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("failed to parse raft TLS CA certificate")
+	}
+
+	return &raftTLSConfig{
+		server: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    pool,
+			MinVersion:   tls.VersionTLS12,
+		},
+		client: &tls.Config{
+			Certificates:       []tls.Certificate{cert},
+			InsecureSkipVerify: true,
+			MinVersion:         tls.VersionTLS12,
+			VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+				return verifyRaftPeerCertificate(pool, rawCerts)
+			},
+		},
+	}, nil
+}
+
+// verifyRaftPeerCertificate verifies that the certificate of a node is
+// signed by the CA of the cluster
+func verifyRaftPeerCertificate(pool *x509.CertPool, rawCerts [][]byte) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("no raft peer certificate")
+	}
+
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("failed to parse raft peer certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	return err
+}
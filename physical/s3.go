@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"os"
 	"sort"
@@ -16,6 +17,8 @@ import (
 	"github.com/armon/go-metrics"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/hashicorp/errwrap"
@@ -24,15 +27,56 @@ import (
 	"github.com/hashicorp/vault/helper/consts"
 )
 
+const (
+	// DefaultS3MaxRetries is the number of times failed requests are retried
+	// when max_retries is not set
+	DefaultS3MaxRetries = 10
+)
+
+var (
+	// S3RetryBackoffBase is the initial backoff after a failed request,
+	// doubled after each retry up to S3RetryBackoffMax.
+	S3RetryBackoffBase = 100 * time.Millisecond
+	S3RetryBackoffMax  = 20 * time.Second
+)
+
 // S3Backend is a physical backend that stores data
 // within an S3 bucket.
 type S3Backend struct {
 	bucket     string
+	kmsKeyID   string
 	client     *s3.S3
 	logger     log.Logger
 	permitPool *PermitPool
 }
 
+// s3Retryer retries the requests failing with a server error or a throttling
+// error, such as the 503 SlowDown responses S3 returns when the request rate
+// of a prefix is too high, with an exponential backoff
+type s3Retryer struct {
+	client.DefaultRetryer
+	logger log.Logger
+}
+
+// RetryRules returns how long to wait before retrying the request. Half of
+// the backoff is random, so that concurrent requests don't retry in lockstep.
+func (r s3Retryer) RetryRules(req *request.Request) time.Duration {
+	metrics.IncrCounter([]string{"s3", "retry"}, 1)
+
+	backoff := S3RetryBackoffMax
+	if req.RetryCount < 16 {
+		if b := S3RetryBackoffBase << uint(req.RetryCount); b < backoff {
+			backoff = b
+		}
+	}
+	backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+
+	if r.logger.IsDebug() {
+		r.logger.Debug("s3: retrying request", "operation", req.Operation.Name, "retry", req.RetryCount+1, "backoff", backoff, "error", req.Error)
+	}
+	return backoff
+}
+
 // newS3Backend constructs a S3 backend using a pre-existing
 // bucket. Credentials can be provided to the backend, sourced
 // from the environment, AWS credential files or by IAM role.
@@ -70,6 +114,31 @@ func newS3Backend(conf map[string]string, logger log.Logger) (Backend, error) {
 		}
 	}
 
+	forcePathStyle := false
+	forcePathStyleStr := os.Getenv("AWS_S3_FORCE_PATH_STYLE")
+	if forcePathStyleStr == "" {
+		forcePathStyleStr = conf["s3_force_path_style"]
+	}
+	if forcePathStyleStr != "" {
+		var err error
+		forcePathStyle, err = strconv.ParseBool(forcePathStyleStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing s3_force_path_style parameter: {{err}}", err)
+		}
+	}
+
+	maxRetries := DefaultS3MaxRetries
+	if maxRetriesStr, ok := conf["max_retries"]; ok {
+		var err error
+		maxRetries, err = strconv.Atoi(maxRetriesStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing max_retries parameter: {{err}}", err)
+		}
+		if maxRetries < 0 {
+			return nil, fmt.Errorf("max_retries cannot be negative")
+		}
+	}
+
 	credsConfig := &awsutil.CredentialsConfig{
 		AccessKey:    accessKey,
 		SecretKey:    secretKey,
@@ -83,14 +152,19 @@ func newS3Backend(conf map[string]string, logger log.Logger) (Backend, error) {
 	pooledTransport := cleanhttp.DefaultPooledTransport()
 	pooledTransport.MaxIdleConnsPerHost = consts.ExpirationRestoreWorkerCount
 
-	s3conn := s3.New(session.New(&aws.Config{
+	awsConf := request.WithRetryer(&aws.Config{
 		Credentials: creds,
 		HTTPClient: &http.Client{
 			Transport: pooledTransport,
 		},
-		Endpoint: aws.String(endpoint),
-		Region:   aws.String(region),
-	}))
+		Endpoint:         aws.String(endpoint),
+		Region:           aws.String(region),
+		S3ForcePathStyle: aws.Bool(forcePathStyle),
+	}, s3Retryer{
+		DefaultRetryer: client.DefaultRetryer{NumMaxRetries: maxRetries},
+		logger:         logger,
+	})
+	s3conn := s3.New(session.New(awsConf))
 
 	_, err = s3conn.ListObjects(&s3.ListObjectsInput{Bucket: &bucket})
 	if err != nil {
@@ -112,6 +186,7 @@ func newS3Backend(conf map[string]string, logger log.Logger) (Backend, error) {
 	s := &S3Backend{
 		client:     s3conn,
 		bucket:     bucket,
+		kmsKeyID:   conf["kms_key_id"],
 		logger:     logger,
 		permitPool: NewPermitPool(maxParInt),
 	}
@@ -125,11 +200,17 @@ func (s *S3Backend) Put(entry *Entry) error {
 	s.permitPool.Acquire()
 	defer s.permitPool.Release()
 
-	_, err := s.client.PutObject(&s3.PutObjectInput{
+	input := &s3.PutObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(entry.Key),
 		Body:   bytes.NewReader(entry.Value),
-	})
+	}
+	if s.kmsKeyID != "" {
+		input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+		input.SSEKMSKeyId = aws.String(s.kmsKeyID)
+	}
+
+	_, err := s.client.PutObject(input)
 
 	if err != nil {
 		return err
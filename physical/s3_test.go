@@ -2,8 +2,12 @@ package physical
 
 import (
 	"fmt"
+	"io/ioutil"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -92,3 +96,78 @@ func TestS3Backend(t *testing.T) {
 	testBackend_ListPrefix(t, b)
 
 }
+
+func TestS3Backend_Options(t *testing.T) {
+	defer func(base time.Duration) { S3RetryBackoffBase = base }(S3RetryBackoffBase)
+	S3RetryBackoffBase = time.Millisecond
+
+	var lock sync.Mutex
+	var putHeaders http.Header
+	var putBody string
+	puts := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/vault-bucket":
+			fmt.Fprint(w, `<ListBucketResult><Name>vault-bucket</Name></ListBucketResult>`)
+		case r.Method == "PUT" && r.URL.Path == "/vault-bucket/foo/bar":
+			// Slow down the first attempt, as S3 does when the request rate
+			// is too high
+			puts++
+			if puts == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprint(w, `<Error><Code>SlowDown</Code><Message>Please reduce your request rate.</Message></Error>`)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			putHeaders = r.Header
+			putBody = string(body)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	b, err := NewBackend("s3", logger, map[string]string{
+		"access_key":          "AKIAEXAMPLE",
+		"secret_key":          "secret",
+		"bucket":              "vault-bucket",
+		"endpoint":            server.URL,
+		"s3_force_path_style": "true",
+		"kms_key_id":          "alias/vault",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := b.Put(&Entry{Key: "foo/bar", Value: []byte("baz")}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if puts != 2 || putBody != "baz" {
+		t.Fatalf("bad: %d puts, body %q", puts, putBody)
+	}
+	if putHeaders.Get("X-Amz-Server-Side-Encryption") != "aws:kms" ||
+		putHeaders.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id") != "alias/vault" {
+		t.Fatalf("bad encryption headers: %v", putHeaders)
+	}
+}
+
+func TestS3Backend_InvalidOptions(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	for _, conf := range []map[string]string{
+		{"bucket": "vault-bucket", "s3_force_path_style": "maybe"},
+		{"bucket": "vault-bucket", "max_retries": "-1"},
+	} {
+		if _, err := NewBackend("s3", logger, conf); err == nil {
+			t.Fatalf("expected an error with %v", conf)
+		}
+	}
+}
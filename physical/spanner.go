@@ -0,0 +1,690 @@
+package physical
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/strutil"
+	log "github.com/mgutz/logxi/v1"
+	"golang.org/x/net/context"
+	"google.golang.org/api/option"
+	"google.golang.org/api/transport"
+)
+
+const (
+	// SpannerLockTTL is how long a lock is valid without being renewed.
+	SpannerLockTTL = 15 * time.Second
+
+	// SpannerLockRenewInterval is the amount of time to wait between the
+	// renewals of a held lock.
+	SpannerLockRenewInterval = 5 * time.Second
+
+	// SpannerLockRetryInterval is the amount of time to wait if a lock
+	// fails to be acquired before trying again.
+	SpannerLockRetryInterval = time.Second
+
+	// spannerScope is the OAuth scope of the data operations
+	spannerScope = "https://www.googleapis.com/auth/spanner.data"
+
+	// spannerListPageSize is the number of keys read per query when listing
+	spannerListPageSize = 1000
+
+	// spannerAbortedRetries is the number of times a transaction aborted by
+	// a conflict with a concurrent transaction is retried
+	spannerAbortedRetries = 10
+)
+
+// spannerEndpoint is the base URL of the Cloud Spanner REST API
+var spannerEndpoint = "https://spanner.googleapis.com/v1/"
+
+// SpannerBackend is a physical backend that stores data in a Google Cloud
+// Spanner database. The client library of Spanner is not available to Vault,
+// so the backend uses the REST API.
+type SpannerBackend struct {
+	database string
+	table    string
+	haTable  string
+
+	httpClient *http.Client
+	endpoint   string
+
+	// sessions holds the idle sessions; a session runs a single transaction
+	// at a time
+	sessionsLock sync.Mutex
+	sessions     []string
+
+	haEnabled  bool
+	permitPool *PermitPool
+	logger     log.Logger
+}
+
+// SpannerLock is a lock held by writing a row in the HA table. The rows are
+// read and written in read-write transactions, and their timestamps come
+// from the database, so that the expiration of a lock doesn't depend on the
+// clocks of the instances.
+type SpannerLock struct {
+	backend    *SpannerBackend
+	value, key string
+	identity   string
+
+	lock sync.Mutex
+	held bool
+
+	// stopCh stops renewing the lock when it is released
+	stopCh chan struct{}
+
+	// Allow modifying the Lock durations for ease of unit testing.
+	renewInterval time.Duration
+	retryInterval time.Duration
+	ttl           time.Duration
+}
+
+// spannerError is an error returned by the Spanner API
+type spannerError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+func (e *spannerError) Error() string {
+	return fmt.Sprintf("spanner API returned status %d (%s): %s", e.Code, e.Status, e.Message)
+}
+
+// isSpannerStatus returns whether err is an API error with the status
+func isSpannerStatus(err error, status string) bool {
+	apiErr, ok := err.(*spannerError)
+	return ok && apiErr.Status == status
+}
+
+// spannerMutation is a write of a commit
+type spannerMutation struct {
+	InsertOrUpdate *spannerWrite  `json:"insertOrUpdate,omitempty"`
+	Delete         *spannerDelete `json:"delete,omitempty"`
+}
+
+type spannerWrite struct {
+	Table   string          `json:"table"`
+	Columns []string        `json:"columns"`
+	Values  [][]interface{} `json:"values"`
+}
+
+type spannerDelete struct {
+	Table  string `json:"table"`
+	KeySet struct {
+		Keys [][]string `json:"keys"`
+	} `json:"keySet"`
+}
+
+// newSpannerBackend constructs a Spanner backend using the tables of an
+// existing database
+func newSpannerBackend(conf map[string]string, logger log.Logger) (Backend, error) {
+	database := os.Getenv("GOOGLE_SPANNER_DATABASE")
+	if database == "" {
+		database = conf["database"]
+		if database == "" {
+			return nil, fmt.Errorf("env var GOOGLE_SPANNER_DATABASE or configuration parameter 'database' must be set")
+		}
+	}
+	if !strings.HasPrefix(database, "projects/") {
+		return nil, fmt.Errorf("database must be of the form projects/<project>/instances/<instance>/databases/<database>")
+	}
+
+	table := conf["table"]
+	if table == "" {
+		table = "Vault"
+	}
+	haTable := conf["ha_table"]
+	if haTable == "" {
+		haTable = "VaultHA"
+	}
+
+	haEnabled := false
+	haEnabledStr := os.Getenv("GOOGLE_SPANNER_HA_ENABLED")
+	if haEnabledStr == "" {
+		haEnabledStr = conf["ha_enabled"]
+	}
+	if haEnabledStr != "" {
+		var err error
+		haEnabled, err = strconv.ParseBool(haEnabledStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing ha_enabled parameter: {{err}}", err)
+		}
+	}
+
+	// Without a service account file, the application default credentials
+	// are used
+	opts := []option.ClientOption{option.WithScopes(spannerScope)}
+	if credentialsFile := conf["credentials_file"]; credentialsFile != "" {
+		opts = append(opts, option.WithServiceAccountFile(credentialsFile))
+	}
+	httpClient, _, err := transport.NewHTTPClient(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error establishing spanner client: '%v'", err)
+	}
+
+	maxParStr, ok := conf["max_parallel"]
+	var maxParInt int
+	if ok {
+		maxParInt, err = strconv.Atoi(maxParStr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed parsing max_parallel parameter: {{err}}", err)
+		}
+		if logger.IsDebug() {
+			logger.Debug("physical/spanner: max_parallel set", "max_parallel", maxParInt)
+		}
+	}
+
+	s := &SpannerBackend{
+		database:   database,
+		table:      table,
+		haTable:    haTable,
+		httpClient: httpClient,
+		endpoint:   spannerEndpoint,
+		haEnabled:  haEnabled,
+		permitPool: NewPermitPool(maxParInt),
+		logger:     logger,
+	}
+
+	// Check the access to the table
+	if _, err := s.Get("core/spanner-check"); err != nil {
+		return nil, fmt.Errorf("unable to access table '%s' of database '%s': '%v'", table, database, err)
+	}
+	return s, nil
+}
+
+// Put is used to insert or update an entry
+func (s *SpannerBackend) Put(entry *Entry) error {
+	defer metrics.MeasureSince([]string{"spanner", "put"}, time.Now())
+
+	s.permitPool.Acquire()
+	defer s.permitPool.Release()
+
+	return s.commit([]spannerMutation{s.putMutation(entry)})
+}
+
+// Get is used to fetch an entry
+func (s *SpannerBackend) Get(key string) (*Entry, error) {
+	defer metrics.MeasureSince([]string{"spanner", "get"}, time.Now())
+
+	s.permitPool.Acquire()
+	defer s.permitPool.Release()
+
+	rows, err := s.query(nil, "SELECT Value FROM "+s.table+" WHERE Key = @key", map[string]string{
+		"key": key,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading '%v': '%v'", key, err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	encoded, _ := rows[0][0].(string)
+	value, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding '%v': '%v'", key, err)
+	}
+	return &Entry{
+		Key:   key,
+		Value: value,
+	}, nil
+}
+
+// Delete is used to permanently delete an entry
+func (s *SpannerBackend) Delete(key string) error {
+	defer metrics.MeasureSince([]string{"spanner", "delete"}, time.Now())
+
+	s.permitPool.Acquire()
+	defer s.permitPool.Release()
+
+	return s.commit([]spannerMutation{s.deleteMutation(s.table, key)})
+}
+
+// List is used to list all the keys under a given
+// prefix, up to the next prefix.
+func (s *SpannerBackend) List(prefix string) ([]string, error) {
+	defer metrics.MeasureSince([]string{"spanner", "list"}, time.Now())
+
+	s.permitPool.Acquire()
+	defer s.permitPool.Release()
+
+	// The keys are read in pages, as the size of the results of a query is
+	// limited
+	keys := []string{}
+	after := ""
+	for {
+		rows, err := s.query(nil, "SELECT Key FROM "+s.table+
+			" WHERE STARTS_WITH(Key, @prefix) AND Key > @after ORDER BY Key LIMIT "+strconv.Itoa(spannerListPageSize),
+			map[string]string{
+				"prefix": prefix,
+				"after":  after,
+			})
+		if err != nil {
+			return nil, fmt.Errorf("error listing '%v': '%v'", prefix, err)
+		}
+
+		for _, row := range rows {
+			after, _ = row[0].(string)
+			key := strings.TrimPrefix(after, prefix)
+			if i := strings.Index(key, "/"); i == -1 {
+				keys = append(keys, key)
+			} else {
+				keys = strutil.AppendIfMissing(keys, key[:i+1])
+			}
+		}
+		if len(rows) < spannerListPageSize {
+			return keys, nil
+		}
+	}
+}
+
+// Transaction applies the operations in a single commit, which Spanner
+// applies atomically and in order.
+func (s *SpannerBackend) Transaction(txns []TxnEntry) error {
+	defer metrics.MeasureSince([]string{"spanner", "transaction"}, time.Now())
+	if len(txns) == 0 {
+		return nil
+	}
+
+	mutations := make([]spannerMutation, 0, len(txns))
+	for _, txn := range txns {
+		switch txn.Operation {
+		case PutOperation:
+			mutations = append(mutations, s.putMutation(txn.Entry))
+		case DeleteOperation:
+			mutations = append(mutations, s.deleteMutation(s.table, txn.Entry.Key))
+		default:
+			return fmt.Errorf("unsupported transaction operation: %q", txn.Operation)
+		}
+	}
+
+	s.permitPool.Acquire()
+	defer s.permitPool.Release()
+
+	return s.commit(mutations)
+}
+
+func (s *SpannerBackend) putMutation(entry *Entry) spannerMutation {
+	return spannerMutation{
+		InsertOrUpdate: &spannerWrite{
+			Table:   s.table,
+			Columns: []string{"Key", "Value"},
+			Values:  [][]interface{}{{entry.Key, base64.StdEncoding.EncodeToString(entry.Value)}},
+		},
+	}
+}
+
+func (s *SpannerBackend) deleteMutation(table, key string) spannerMutation {
+	mutation := spannerMutation{
+		Delete: &spannerDelete{Table: table},
+	}
+	mutation.Delete.KeySet.Keys = [][]string{{key}}
+	return mutation
+}
+
+// commit applies the mutations in a single-use read-write transaction
+func (s *SpannerBackend) commit(mutations []spannerMutation) error {
+	return s.runTransaction(func(*spannerTransaction) ([]spannerMutation, error) {
+		return mutations, nil
+	}, false)
+}
+
+// runTransaction runs a read-write transaction, retrying it when it is
+// aborted by a concurrent one. When read is true, a transaction is begun for
+// f to read in, otherwise f gets nil and the mutations are committed in a
+// single-use transaction. f returns the mutations to commit, or nil to roll
+// back.
+func (s *SpannerBackend) runTransaction(f func(*spannerTransaction) ([]spannerMutation, error), read bool) error {
+	var err error
+	for attempt := 0; attempt < spannerAbortedRetries; attempt++ {
+		err = s.withSession(func(session string) error {
+			body := map[string]interface{}{}
+			var transaction *spannerTransaction
+			if read {
+				var begun struct {
+					ID string `json:"id"`
+				}
+				if err := s.do(session+":beginTransaction", map[string]interface{}{
+					"options": map[string]interface{}{"readWrite": map[string]interface{}{}},
+				}, &begun); err != nil {
+					return err
+				}
+				transaction = &spannerTransaction{session: session, id: begun.ID}
+				body["transactionId"] = begun.ID
+			} else {
+				body["singleUseTransaction"] = map[string]interface{}{"readWrite": map[string]interface{}{}}
+			}
+
+			mutations, err := f(transaction)
+			if err != nil || mutations == nil {
+				if transaction != nil {
+					s.do(session+":rollback", map[string]interface{}{"transactionId": transaction.id}, nil)
+				}
+				return err
+			}
+
+			body["mutations"] = mutations
+			return s.do(session+":commit", body, nil)
+		})
+		if !isSpannerStatus(err, "ABORTED") {
+			return err
+		}
+		time.Sleep(time.Duration(attempt+1) * 10 * time.Millisecond)
+	}
+	return err
+}
+
+// query runs a SQL query with string parameters, in the read-write
+// transaction or a strong single-use read-only one, and returns its rows
+func (s *SpannerBackend) query(transaction *spannerTransaction, sql string, params map[string]string) ([][]interface{}, error) {
+	paramTypes := map[string]interface{}{}
+	for name := range params {
+		paramTypes[name] = map[string]string{"code": "STRING"}
+	}
+	body := map[string]interface{}{
+		"sql":        sql,
+		"params":     params,
+		"paramTypes": paramTypes,
+	}
+
+	var result struct {
+		Rows [][]interface{} `json:"rows"`
+	}
+	if transaction != nil {
+		body["transaction"] = map[string]string{"id": transaction.id}
+		err := s.do(transaction.session+":executeSql", body, &result)
+		return result.Rows, err
+	}
+
+	body["transaction"] = map[string]interface{}{
+		"singleUse": map[string]interface{}{
+			"readOnly": map[string]interface{}{"strong": true},
+		},
+	}
+	err := s.withSession(func(session string) error {
+		return s.do(session+":executeSql", body, &result)
+	})
+	return result.Rows, err
+}
+
+// spannerTransaction identifies a read-write transaction
+type spannerTransaction struct {
+	session, id string
+}
+
+// withSession runs f with an idle session, creating one if needed. Sessions
+// deleted by Spanner after being idle for an hour are discarded, and f is run
+// again with a new one.
+func (s *SpannerBackend) withSession(f func(session string) error) error {
+	s.sessionsLock.Lock()
+	var session string
+	if n := len(s.sessions); n > 0 {
+		session = s.sessions[n-1]
+		s.sessions = s.sessions[:n-1]
+	}
+	s.sessionsLock.Unlock()
+
+	pooled := session != ""
+	if !pooled {
+		var created struct {
+			Name string `json:"name"`
+		}
+		if err := s.do(s.database+"/sessions", map[string]interface{}{}, &created); err != nil {
+			return fmt.Errorf("error creating session: %v", err)
+		}
+		session = created.Name
+	}
+
+	err := f(session)
+	if isSpannerStatus(err, "NOT_FOUND") && strings.Contains(err.Error(), "Session not found") {
+		if pooled {
+			return s.withSession(f)
+		}
+		return err
+	}
+
+	s.sessionsLock.Lock()
+	s.sessions = append(s.sessions, session)
+	s.sessionsLock.Unlock()
+	return err
+}
+
+// do sends a request to the API, and decodes its response in out if not nil
+func (s *SpannerBackend) do(path string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error *spannerError `json:"error"`
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		if err := json.Unmarshal(data, &apiErr); err != nil || apiErr.Error == nil {
+			return fmt.Errorf("spanner API returned status %d: %s", resp.StatusCode, data)
+		}
+		return apiErr.Error
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// LockWith is used for mutual exclusion based on the given key.
+func (s *SpannerBackend) LockWith(key, value string) (Lock, error) {
+	identity, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	return &SpannerLock{
+		backend:       s,
+		key:           key,
+		value:         value,
+		identity:      identity,
+		renewInterval: SpannerLockRenewInterval,
+		retryInterval: SpannerLockRetryInterval,
+		ttl:           SpannerLockTTL,
+	}, nil
+}
+
+// HAEnabled indicates whether the HA functionality should be exposed.
+func (s *SpannerBackend) HAEnabled() bool {
+	return s.haEnabled
+}
+
+// Lock tries to acquire the lock by repeatedly trying to create or take over
+// the lock row. It blocks until either the stop channel is closed or the lock
+// is acquired. The returned channel is closed once the lock is lost.
+func (l *SpannerLock) Lock(stopCh <-chan struct{}) (<-chan struct{}, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.held {
+		return nil, fmt.Errorf("lock already held")
+	}
+
+	ticker := time.NewTicker(l.retryInterval)
+	defer ticker.Stop()
+	for {
+		acquired, err := l.writeLock()
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			break
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return nil, nil
+		}
+	}
+
+	l.held = true
+	l.stopCh = make(chan struct{})
+	leaderCh := make(chan struct{})
+	go l.periodicallyRenewLock(leaderCh, l.stopCh)
+	return leaderCh, nil
+}
+
+// Unlock releases the lock by deleting the lock row, unless another instance
+// took it over meanwhile.
+func (l *SpannerLock) Unlock() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.held {
+		return nil
+	}
+
+	l.held = false
+	close(l.stopCh)
+
+	return l.backend.runTransaction(func(transaction *spannerTransaction) ([]spannerMutation, error) {
+		current, err := l.readLock(transaction)
+		if err != nil || current.identity != l.identity {
+			return nil, err
+		}
+		return []spannerMutation{l.backend.deleteMutation(l.backend.haTable, l.key)}, nil
+	}, true)
+}
+
+// Value checks whether or not the lock is held by any instance of
+// SpannerLock, including this one, and returns the current value.
+func (l *SpannerLock) Value() (bool, string, error) {
+	current, err := l.readLock(nil)
+	if err != nil {
+		return false, "", err
+	}
+	if current.identity == "" || current.expired {
+		return false, "", nil
+	}
+	return true, current.value, nil
+}
+
+// spannerLockRow is the state of a lock row
+type spannerLockRow struct {
+	identity, value string
+	expired         bool
+
+	// now is the time of the database
+	now string
+}
+
+// readLock reads the lock row along with the time of the database
+func (l *SpannerLock) readLock(transaction *spannerTransaction) (*spannerLockRow, error) {
+	table := l.backend.haTable
+	rows, err := l.backend.query(transaction,
+		"SELECT CURRENT_TIMESTAMP(), "+
+			"(SELECT Identity FROM "+table+" WHERE Key = @key), "+
+			"(SELECT Value FROM "+table+" WHERE Key = @key), "+
+			"(SELECT TIMESTAMP_DIFF(CURRENT_TIMESTAMP(), Timestamp, MILLISECOND) FROM "+table+" WHERE Key = @key)",
+		map[string]string{"key": l.key})
+	if err != nil {
+		return nil, fmt.Errorf("error reading lock '%v': '%v'", l.key, err)
+	}
+	if len(rows) != 1 || len(rows[0]) != 4 {
+		return nil, fmt.Errorf("unexpected result reading lock '%v'", l.key)
+	}
+
+	row := &spannerLockRow{}
+	row.now, _ = rows[0][0].(string)
+	row.identity, _ = rows[0][1].(string)
+	row.value, _ = rows[0][2].(string)
+	if age, ok := rows[0][3].(string); ok {
+		ms, err := strconv.ParseInt(age, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing age of lock '%v': '%v'", l.key, err)
+		}
+		row.expired = time.Duration(ms)*time.Millisecond >= l.ttl
+	}
+	return row, nil
+}
+
+// writeLock creates the lock, takes it over if it expired, or renews it if
+// it is already held by this instance. It returns false if another instance
+// holds the lock.
+func (l *SpannerLock) writeLock() (bool, error) {
+	acquired := false
+	err := l.backend.runTransaction(func(transaction *spannerTransaction) ([]spannerMutation, error) {
+		current, err := l.readLock(transaction)
+		if err != nil {
+			return nil, err
+		}
+		if current.identity != "" && current.identity != l.identity && !current.expired {
+			acquired = false
+			return nil, nil
+		}
+
+		acquired = true
+		return []spannerMutation{{
+			InsertOrUpdate: &spannerWrite{
+				Table:   l.backend.haTable,
+				Columns: []string{"Key", "Value", "Identity", "Timestamp"},
+				Values:  [][]interface{}{{l.key, l.value, l.identity, current.now}},
+			},
+		}}, nil
+	}, true)
+	if err != nil {
+		return false, err
+	}
+	return acquired, nil
+}
+
+// periodicallyRenewLock renews the lock until it is released, and closes the
+// leader channel when it is lost: either taken over by another instance, or
+// not renewed in time because of errors.
+func (l *SpannerLock) periodicallyRenewLock(leaderCh, stopCh chan struct{}) {
+	defer close(leaderCh)
+
+	ticker := time.NewTicker(l.renewInterval)
+	defer ticker.Stop()
+
+	lastRenewal := time.Now()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		acquired, err := l.writeLock()
+		switch {
+		case err != nil:
+			l.backend.logger.Warn("physical/spanner: failed to renew lock", "key", l.key, "error", err)
+			if time.Since(lastRenewal) < l.ttl {
+				continue
+			}
+			l.backend.logger.Error("physical/spanner: lock expired", "key", l.key)
+			return
+		case !acquired:
+			l.backend.logger.Error("physical/spanner: lock taken over by another instance", "key", l.key)
+			return
+		}
+		lastRenewal = time.Now()
+	}
+}
@@ -0,0 +1,337 @@
+package physical
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	log "github.com/mgutz/logxi/v1"
+)
+
+// fakeSpannerLock is a row of the HA table of fakeSpanner
+type fakeSpannerLock struct {
+	value, identity string
+	timestamp       time.Time
+}
+
+// fakeSpanner implements the subset of the Spanner REST API used by the
+// backend, answering the queries of the backend only. Read-write
+// transactions are aborted when the HA table was modified since they began.
+type fakeSpanner struct {
+	lock     sync.Mutex
+	data     map[string][]byte
+	locks    map[string]*fakeSpannerLock
+	sessions map[string]bool
+
+	// haVersion is incremented by the writes to the HA table, and
+	// transactions holds the version each transaction began at
+	haVersion    int
+	transactions map[string]int
+	counter      int
+
+	// abortCommits makes the next commits abort
+	abortCommits int
+}
+
+func newFakeSpanner() *fakeSpanner {
+	return &fakeSpanner{
+		data:         map[string][]byte{},
+		locks:        map[string]*fakeSpannerLock{},
+		sessions:     map[string]bool{},
+		transactions: map[string]int{},
+	}
+}
+
+func (f *fakeSpanner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var body struct {
+		SQL           string            `json:"sql"`
+		Params        map[string]string `json:"params"`
+		Transaction   map[string]string `json:"transaction"`
+		TransactionID string            `json:"transactionId"`
+		Mutations     []struct {
+			InsertOrUpdate *spannerWrite  `json:"insertOrUpdate"`
+			Delete         *spannerDelete `json:"delete"`
+		} `json:"mutations"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	fail := func(code int, status, message string) {
+		w.WriteHeader(code)
+		fmt.Fprintf(w, `{"error":{"code":%d,"status":%q,"message":%q}}`, code, status, message)
+	}
+	reply := func(v interface{}) {
+		json.NewEncoder(w).Encode(v)
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	if strings.HasSuffix(path, "/sessions") {
+		f.counter++
+		name := fmt.Sprintf("%s/%d", path, f.counter)
+		f.sessions[name] = true
+		reply(map[string]string{"name": name})
+		return
+	}
+
+	i := strings.LastIndex(path, ":")
+	if i == -1 {
+		fail(http.StatusNotFound, "NOT_FOUND", "unknown path")
+		return
+	}
+	if !f.sessions[path[:i]] {
+		fail(http.StatusNotFound, "NOT_FOUND", "Session not found: "+path[:i])
+		return
+	}
+
+	switch path[i+1:] {
+	case "beginTransaction":
+		f.counter++
+		id := strconv.Itoa(f.counter)
+		f.transactions[id] = f.haVersion
+		reply(map[string]string{"id": id})
+
+	case "rollback":
+		delete(f.transactions, body.TransactionID)
+		reply(map[string]string{})
+
+	case "executeSql":
+		key := body.Params["key"]
+		var rows [][]interface{}
+		switch {
+		case strings.HasPrefix(body.SQL, "SELECT Value FROM Vault WHERE Key = @key"):
+			if value, ok := f.data[key]; ok {
+				rows = append(rows, []interface{}{base64.StdEncoding.EncodeToString(value)})
+			}
+
+		case strings.HasPrefix(body.SQL, "SELECT Key FROM Vault WHERE STARTS_WITH(Key, @prefix) AND Key > @after ORDER BY Key LIMIT"):
+			var keys []string
+			for k := range f.data {
+				if strings.HasPrefix(k, body.Params["prefix"]) && k > body.Params["after"] {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if len(rows) == spannerListPageSize {
+					break
+				}
+				rows = append(rows, []interface{}{k})
+			}
+
+		case strings.HasPrefix(body.SQL, "SELECT CURRENT_TIMESTAMP(), (SELECT Identity FROM VaultHA"):
+			now := time.Now()
+			row := []interface{}{now.UTC().Format(time.RFC3339Nano), nil, nil, nil}
+			if lock, ok := f.locks[key]; ok {
+				row[1], row[2] = lock.identity, lock.value
+				row[3] = strconv.FormatInt(int64(now.Sub(lock.timestamp)/time.Millisecond), 10)
+			}
+			rows = append(rows, row)
+
+		default:
+			fail(http.StatusBadRequest, "INVALID_ARGUMENT", "unexpected query: "+body.SQL)
+			return
+		}
+		reply(map[string]interface{}{"rows": rows})
+
+	case "commit":
+		if f.abortCommits > 0 {
+			f.abortCommits--
+			fail(http.StatusConflict, "ABORTED", "Transaction was aborted.")
+			return
+		}
+		if body.TransactionID != "" {
+			version, ok := f.transactions[body.TransactionID]
+			delete(f.transactions, body.TransactionID)
+			if !ok || version != f.haVersion {
+				fail(http.StatusConflict, "ABORTED", "Transaction was aborted.")
+				return
+			}
+		}
+
+		for _, mutation := range body.Mutations {
+			switch {
+			case mutation.InsertOrUpdate != nil && mutation.InsertOrUpdate.Table == "Vault":
+				values := mutation.InsertOrUpdate.Values[0]
+				value, _ := base64.StdEncoding.DecodeString(values[1].(string))
+				f.data[values[0].(string)] = value
+			case mutation.InsertOrUpdate != nil && mutation.InsertOrUpdate.Table == "VaultHA":
+				values := mutation.InsertOrUpdate.Values[0]
+				timestamp, _ := time.Parse(time.RFC3339Nano, values[3].(string))
+				f.locks[values[0].(string)] = &fakeSpannerLock{
+					value:     values[1].(string),
+					identity:  values[2].(string),
+					timestamp: timestamp,
+				}
+				f.haVersion++
+			case mutation.Delete != nil && mutation.Delete.Table == "Vault":
+				delete(f.data, mutation.Delete.KeySet.Keys[0][0])
+			case mutation.Delete != nil && mutation.Delete.Table == "VaultHA":
+				delete(f.locks, mutation.Delete.KeySet.Keys[0][0])
+				f.haVersion++
+			}
+		}
+		reply(map[string]string{"commitTimestamp": time.Now().UTC().Format(time.RFC3339Nano)})
+
+	default:
+		fail(http.StatusNotFound, "NOT_FOUND", "unknown method")
+	}
+}
+
+// testFakeSpannerBackend returns a backend using a fake Spanner server, and
+// the fake
+func testFakeSpannerBackend(t *testing.T) (*SpannerBackend, *fakeSpanner, func()) {
+	fake := newFakeSpanner()
+	server := httptest.NewServer(fake)
+
+	b := &SpannerBackend{
+		database:   "projects/p/instances/i/databases/d",
+		table:      "Vault",
+		haTable:    "VaultHA",
+		httpClient: http.DefaultClient,
+		endpoint:   server.URL + "/v1/",
+		haEnabled:  true,
+		permitPool: NewPermitPool(0),
+		logger:     logformat.NewVaultLogger(log.LevelTrace),
+	}
+	return b, fake, server.Close
+}
+
+func TestSpannerBackend(t *testing.T) {
+	b, fake, cleanup := testFakeSpannerBackend(t)
+	defer cleanup()
+
+	testBackend(t, b)
+	testBackend_ListPrefix(t, b)
+
+	// Aborted commits are retried
+	fake.abortCommits = 2
+	if err := b.Put(&Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Expired sessions are replaced
+	fake.sessions = map[string]bool{}
+	if entry, err := b.Get("foo"); err != nil || entry == nil || string(entry.Value) != "bar" {
+		t.Fatalf("bad: %#v %v", entry, err)
+	}
+}
+
+func TestSpannerBackend_List(t *testing.T) {
+	b, _, cleanup := testFakeSpannerBackend(t)
+	defer cleanup()
+
+	// List more keys than a page
+	var txns []TxnEntry
+	for i := 0; i < spannerListPageSize+10; i++ {
+		txns = append(txns, TxnEntry{
+			Operation: PutOperation,
+			Entry:     &Entry{Key: fmt.Sprintf("foo/%05d", i), Value: []byte("bar")},
+		})
+	}
+	txns = append(txns, TxnEntry{Operation: PutOperation, Entry: &Entry{Key: "foo/sub/key"}})
+	if err := b.Transaction(txns); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := b.List("foo/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != spannerListPageSize+11 || keys[len(keys)-1] != "sub/" {
+		t.Fatalf("bad: %d keys, last %q", len(keys), keys[len(keys)-1])
+	}
+}
+
+func TestSpannerBackend_Transaction(t *testing.T) {
+	b, fake, cleanup := testFakeSpannerBackend(t)
+	defer cleanup()
+
+	if err := b.Put(&Entry{Key: "a", Value: []byte("old")}); err != nil {
+		t.Fatal(err)
+	}
+	err := b.Transaction([]TxnEntry{
+		{Operation: PutOperation, Entry: &Entry{Key: "b", Value: []byte("b")}},
+		{Operation: DeleteOperation, Entry: &Entry{Key: "a"}},
+		{Operation: PutOperation, Entry: &Entry{Key: "c", Value: []byte("c")}},
+		{Operation: DeleteOperation, Entry: &Entry{Key: "c"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.data) != 1 || string(fake.data["b"]) != "b" {
+		t.Fatalf("bad: %v", fake.data)
+	}
+}
+
+func TestSpannerBackend_HA(t *testing.T) {
+	b, _, cleanup := testFakeSpannerBackend(t)
+	defer cleanup()
+
+	testHABackend(t, b, b)
+}
+
+func TestSpannerBackend_LockTTL(t *testing.T) {
+	b, fake, cleanup := testFakeSpannerBackend(t)
+	defer cleanup()
+
+	l, err := b.LockWith("core/lock", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock := l.(*SpannerLock)
+	lock.ttl = 100 * time.Millisecond
+	lock.renewInterval = 20 * time.Millisecond
+	lock.retryInterval = 20 * time.Millisecond
+
+	leaderCh, err := lock.Lock(nil)
+	if err != nil || leaderCh == nil {
+		t.Fatalf("failed to acquire the lock: %v", err)
+	}
+
+	// The lock is kept longer than the TTL by the renewals
+	time.Sleep(2 * lock.ttl)
+	select {
+	case <-leaderCh:
+		t.Fatal("lost the lock")
+	default:
+	}
+
+	// Another instance takes over the lock once it is not renewed anymore
+	l2, err := b.LockWith("core/lock", "baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock2 := l2.(*SpannerLock)
+	lock2.ttl = lock.ttl
+	lock2.retryInterval = lock.retryInterval
+	close(lock.stopCh)
+	leaderCh2, err := lock2.Lock(nil)
+	if err != nil || leaderCh2 == nil {
+		t.Fatalf("failed to acquire the lock: %v", err)
+	}
+	held, value, err := lock.Value()
+	if err != nil || !held || value != "baz" {
+		t.Fatalf("bad: %v %q %v", held, value, err)
+	}
+
+	// Releasing the lost lock doesn't delete the new one
+	lock.stopCh = make(chan struct{})
+	if err := lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.locks["core/lock"]; !ok {
+		t.Fatal("expected the lock to be kept")
+	}
+	lock2.Unlock()
+}
@@ -1,6 +1,7 @@
 package cassandra
 
 import (
+	"fmt"
 	"strings"
 	"time"
 
@@ -18,6 +19,7 @@ import (
 const (
 	defaultUserCreationCQL = `CREATE USER '{{username}}' WITH PASSWORD '{{password}}' NOSUPERUSER;`
 	defaultUserDeletionCQL = `DROP USER '{{username}}';`
+	defaultUserRotationCQL = `ALTER USER '{{username}}' WITH PASSWORD '{{password}}';`
 	cassandraTypeName      = "cassandra"
 )
 
@@ -47,14 +49,9 @@ func New() (interface{}, error) {
 	return dbType, nil
 }
 
-// Run instantiates a Cassandra object, and runs the RPC server for the plugin
+// Run runs the plugin server, which creates a Cassandra object for each connection
 func Run(apiTLSConfig *api.TLSConfig) error {
-	dbType, err := New()
-	if err != nil {
-		return err
-	}
-
-	plugins.Serve(dbType.(*Cassandra), apiTLSConfig)
+	plugins.ServeMultiplex(New, apiTLSConfig)
 
 	return nil
 }
@@ -142,6 +139,56 @@ func (c *Cassandra) RenewUser(statements dbplugin.Statements, username string, e
 	return nil
 }
 
+// SetCredentials sets the password of an existing user using the rotation
+// statements, generating a new password unless one is given
+func (c *Cassandra) SetCredentials(statements dbplugin.Statements, staticUser dbplugin.StaticUserConfig) (username string, password string, err error) {
+	if staticUser.Username == "" {
+		return "", "", fmt.Errorf("username is required to set credentials")
+	}
+	if staticUser.CredentialType != "" && staticUser.CredentialType != dbplugin.CredentialTypePassword {
+		return "", "", dbplugin.ErrUnsupportedCredentialType
+	}
+
+	// Grab the lock
+	c.Lock()
+	defer c.Unlock()
+
+	session, err := c.getConnection()
+	if err != nil {
+		return "", "", err
+	}
+
+	rotationCQL := statements.RotationStatements
+	if rotationCQL == "" {
+		rotationCQL = defaultUserRotationCQL
+	}
+
+	password = staticUser.Password
+	if password == "" {
+		password, err = c.GeneratePassword()
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	for _, query := range strutil.ParseArbitraryStringSlice(rotationCQL, ";") {
+		query = strings.TrimSpace(query)
+		if len(query) == 0 {
+			continue
+		}
+
+		err := session.Query(dbutil.QueryHelper(query, map[string]string{
+			"username": staticUser.Username,
+			"password": password,
+		})).Exec()
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	return staticUser.Username, password, nil
+}
+
 // RevokeUser attempts to drop the specified user.
 func (c *Cassandra) RevokeUser(statements dbplugin.Statements, username string) error {
 	// Grab the lock
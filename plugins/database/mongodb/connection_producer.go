@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/hashicorp/vault/plugins/helper/database/connutil"
+	"github.com/hashicorp/vault/plugins/helper/database/dbutil"
 	"github.com/mitchellh/mapstructure"
 
 	"gopkg.in/mgo.v2"
@@ -22,6 +23,12 @@ import (
 type mongoDBConnectionProducer struct {
 	ConnectionURL string `json:"connection_url" structs:"connection_url" mapstructure:"connection_url"`
 
+	// Username and Password are substituted for the "{{username}}" and
+	// "{{password}}" templates in the connection URL, which allows Vault to
+	// rotate the password
+	Username string `json:"username" structs:"username" mapstructure:"username"`
+	Password string `json:"password" structs:"password" mapstructure:"password"`
+
 	Initialized bool
 	Type        string
 	session     *mgo.Session
@@ -69,7 +76,10 @@ func (c *mongoDBConnectionProducer) Connection() (interface{}, error) {
 		return c.session, nil
 	}
 
-	dialInfo, err := parseMongoURL(c.ConnectionURL)
+	dialInfo, err := parseMongoURL(dbutil.QueryHelper(c.ConnectionURL, map[string]string{
+		"username": c.Username,
+		"password": c.Password,
+	}))
 	if err != nil {
 		return nil, err
 	}
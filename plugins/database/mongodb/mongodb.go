@@ -43,14 +43,9 @@ func New() (interface{}, error) {
 	return dbType, nil
 }
 
-// Run instantiates a MongoDB object, and runs the RPC server for the plugin
+// Run runs the plugin server, which creates a MongoDB object for each connection
 func Run(apiTLSConfig *api.TLSConfig) error {
-	dbType, err := New()
-	if err != nil {
-		return err
-	}
-
-	plugins.Serve(dbType.(*MongoDB), apiTLSConfig)
+	plugins.ServeMultiplex(New, apiTLSConfig)
 
 	return nil
 }
@@ -137,6 +132,64 @@ func (m *MongoDB) RenewUser(statements dbplugin.Statements, username string, exp
 	return nil
 }
 
+// SetCredentials sets the password of an existing user, generating a new
+// password unless one is given. The rotation statement is a JSON blob with the
+// user's authentication database, which defaults to "admin":
+//
+// JSON Example:
+//  { "db": "admin" }
+func (m *MongoDB) SetCredentials(statements dbplugin.Statements, staticUser dbplugin.StaticUserConfig) (username string, password string, err error) {
+	if staticUser.Username == "" {
+		return "", "", fmt.Errorf("username is required to set credentials")
+	}
+	if staticUser.CredentialType != "" && staticUser.CredentialType != dbplugin.CredentialTypePassword {
+		return "", "", dbplugin.ErrUnsupportedCredentialType
+	}
+
+	// Grab the lock
+	m.Lock()
+	defer m.Unlock()
+
+	session, err := m.getConnection()
+	if err != nil {
+		return "", "", err
+	}
+
+	rotationStatement := statements.RotationStatements
+	if rotationStatement == "" {
+		rotationStatement = `{}`
+	}
+
+	var mongoCS mongoDBStatement
+	err = json.Unmarshal([]byte(rotationStatement), &mongoCS)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Default to "admin" if no db provided
+	if mongoCS.DB == "" {
+		mongoCS.DB = "admin"
+	}
+
+	password = staticUser.Password
+	if password == "" {
+		password, err = m.GeneratePassword()
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	err = session.DB(mongoCS.DB).Run(updateUserCommand{
+		Username: staticUser.Username,
+		Password: password,
+	}, nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	return staticUser.Username, password, nil
+}
+
 // RevokeUser drops the specified user from the authentication databse. If none is provided
 // in the revocation statement, the default "admin" authentication database will be assumed.
 func (m *MongoDB) RevokeUser(statements dbplugin.Statements, username string) error {
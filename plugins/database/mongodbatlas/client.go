@@ -0,0 +1,313 @@
+package mongodbatlas
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+// defaultAtlasURL is the base URL of the MongoDB Atlas API
+const defaultAtlasURL = "https://cloud.mongodb.com/api/atlas/v1.0"
+
+// atlasClient makes calls to the MongoDB Atlas API for a project, using a
+// programmatic API key. The API authenticates requests with HTTP digest
+// authentication.
+type atlasClient struct {
+	baseURL    string
+	projectID  string
+	publicKey  string
+	privateKey string
+
+	httpClient *http.Client
+}
+
+func newAtlasClient(baseURL, projectID, publicKey, privateKey string) *atlasClient {
+	httpClient := cleanhttp.DefaultClient()
+	httpClient.Timeout = 30 * time.Second
+
+	return &atlasClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		projectID:  projectID,
+		publicKey:  publicKey,
+		privateKey: privateKey,
+		httpClient: httpClient,
+	}
+}
+
+// atlasError is an error returned by the Atlas API
+type atlasError struct {
+	StatusCode int    `json:"error"`
+	ErrorCode  string `json:"errorCode"`
+	Detail     string `json:"detail"`
+}
+
+func (e *atlasError) Error() string {
+	if e.ErrorCode == "" {
+		return fmt.Sprintf("atlas API returned status %d: %s", e.StatusCode, e.Detail)
+	}
+	return fmt.Sprintf("atlas API returned status %d (%s): %s", e.StatusCode, e.ErrorCode, e.Detail)
+}
+
+// isNotFound returns whether err is an Atlas API error for a missing resource
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*atlasError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+type atlasRole struct {
+	DatabaseName   string `json:"databaseName"`
+	RoleName       string `json:"roleName"`
+	CollectionName string `json:"collectionName,omitempty"`
+}
+
+type atlasScope struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type atlasDatabaseUser struct {
+	DatabaseName string       `json:"databaseName,omitempty"`
+	GroupID      string       `json:"groupId,omitempty"`
+	Username     string       `json:"username,omitempty"`
+	Password     string       `json:"password,omitempty"`
+	Roles        []atlasRole  `json:"roles,omitempty"`
+	Scopes       []atlasScope `json:"scopes,omitempty"`
+}
+
+type atlasAccessListEntry struct {
+	CIDRBlock string `json:"cidrBlock,omitempty"`
+	IPAddress string `json:"ipAddress,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+}
+
+// key returns the CIDR block or IP address identifying the entry
+func (e atlasAccessListEntry) key() string {
+	if e.CIDRBlock != "" {
+		return e.CIDRBlock
+	}
+	return e.IPAddress
+}
+
+type atlasAccessListPage struct {
+	Results    []atlasAccessListEntry `json:"results"`
+	TotalCount int                    `json:"totalCount"`
+}
+
+func (c *atlasClient) createDatabaseUser(user *atlasDatabaseUser) error {
+	user.GroupID = c.projectID
+	return c.do("POST", c.projectPath("databaseUsers"), user, nil)
+}
+
+func (c *atlasClient) updateDatabaseUser(user *atlasDatabaseUser) error {
+	path := c.projectPath("databaseUsers", user.DatabaseName, user.Username)
+	return c.do("PATCH", path, user, nil)
+}
+
+func (c *atlasClient) deleteDatabaseUser(databaseName, username string) error {
+	return c.do("DELETE", c.projectPath("databaseUsers", databaseName, username), nil, nil)
+}
+
+// listAccessList returns all entries of the IP access list of the project
+func (c *atlasClient) listAccessList() ([]atlasAccessListEntry, error) {
+	var entries []atlasAccessListEntry
+	for page := 1; ; page++ {
+		var resp atlasAccessListPage
+		path := fmt.Sprintf("%s?itemsPerPage=500&pageNum=%d", c.projectPath("accessList"), page)
+		if err := c.do("GET", path, nil, &resp); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, resp.Results...)
+		if len(resp.Results) == 0 || len(entries) >= resp.TotalCount {
+			return entries, nil
+		}
+	}
+}
+
+func (c *atlasClient) addAccessListEntries(entries []atlasAccessListEntry) error {
+	return c.do("POST", c.projectPath("accessList"), entries, nil)
+}
+
+func (c *atlasClient) deleteAccessListEntry(entry atlasAccessListEntry) error {
+	return c.do("DELETE", c.projectPath("accessList", entry.key()), nil, nil)
+}
+
+// projectPath returns the API path of a resource of the project, escaping
+// each element.
+func (c *atlasClient) projectPath(elems ...string) string {
+	path := "/groups/" + url.PathEscape(c.projectID)
+	for _, elem := range elems {
+		path += "/" + url.PathEscape(elem)
+	}
+	return path
+}
+
+// do makes a request to the API, encoding in as the JSON body and decoding the
+// response into out if they are set.
+func (c *atlasClient) do(method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The first request is answered with a digest challenge, which is
+	// answered by the second
+	resp, err := c.send(method, path, body, "")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		drainBody(resp)
+
+		authorization, err := c.digestAuthorization(method, path, challenge)
+		if err != nil {
+			return err
+		}
+		resp, err = c.send(method, path, body, authorization)
+		if err != nil {
+			return err
+		}
+	}
+	defer drainBody(resp)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &atlasError{}
+		if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil || apiErr.Detail == "" {
+			apiErr.Detail = http.StatusText(resp.StatusCode)
+		}
+		apiErr.StatusCode = resp.StatusCode
+		return apiErr
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("error decoding atlas API response: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func (c *atlasClient) send(method, path string, body []byte, authorization string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+// digestAuthorization answers a digest challenge as described in RFC 2617,
+// using the MD5 algorithm and the "auth" quality of protection.
+func (c *atlasClient) digestAuthorization(method, path, challenge string) (string, error) {
+	if !strings.HasPrefix(challenge, "Digest ") {
+		return "", fmt.Errorf("atlas API did not return a digest authentication challenge")
+	}
+	params := parseDigestChallenge(strings.TrimPrefix(challenge, "Digest "))
+
+	if algorithm := params["algorithm"]; algorithm != "" && !strings.EqualFold(algorithm, "MD5") {
+		return "", fmt.Errorf("unsupported digest algorithm %q", algorithm)
+	}
+
+	// The URI is the path of the request, including the base path
+	u, err := url.Parse(c.baseURL + path)
+	if err != nil {
+		return "", err
+	}
+	uri := u.RequestURI()
+
+	cnonceBytes := make([]byte, 16)
+	if _, err := rand.Read(cnonceBytes); err != nil {
+		return "", err
+	}
+	cnonce := hex.EncodeToString(cnonceBytes)
+	nc := "00000001"
+
+	ha1 := md5Hex(c.publicKey + ":" + params["realm"] + ":" + c.privateKey)
+	ha2 := md5Hex(method + ":" + uri)
+	response := md5Hex(ha1 + ":" + params["nonce"] + ":" + nc + ":" + cnonce + ":auth:" + ha2)
+
+	authorization := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", qop=auth, nc=%s, cnonce="%s", response="%s", algorithm=MD5`,
+		c.publicKey, params["realm"], params["nonce"], uri, nc, cnonce, response)
+	if opaque, ok := params["opaque"]; ok {
+		authorization += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+
+	return authorization, nil
+}
+
+// parseDigestChallenge parses the comma separated key="value" pairs of a
+// digest challenge.
+func parseDigestChallenge(s string) map[string]string {
+	params := make(map[string]string)
+	for s != "" {
+		s = strings.TrimLeft(s, ", ")
+
+		i := strings.Index(s, "=")
+		if i < 0 {
+			break
+		}
+		key := strings.TrimSpace(s[:i])
+		s = s[i+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.Index(s[1:], `"`)
+			if end < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+		} else {
+			end := strings.Index(s, ",")
+			if end < 0 {
+				value, s = s, ""
+			} else {
+				value, s = s[:end], s[end:]
+			}
+		}
+
+		params[key] = strings.TrimSpace(value)
+	}
+
+	return params
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// drainBody reads the rest of the body so that the connection can be reused
+func drainBody(resp *http.Response) {
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
@@ -0,0 +1,91 @@
+package mongodbatlas
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/vault/plugins/helper/database/connutil"
+	"github.com/mitchellh/mapstructure"
+)
+
+// mongoDBAtlasConnectionProducer implements ConnectionProducer and provides a
+// client for the Atlas API of a project.
+type mongoDBAtlasConnectionProducer struct {
+	PublicKey  string `json:"public_key" structs:"public_key" mapstructure:"public_key"`
+	PrivateKey string `json:"private_key" structs:"private_key" mapstructure:"private_key"`
+	ProjectID  string `json:"project_id" structs:"project_id" mapstructure:"project_id"`
+
+	// APIURL overrides the base URL of the Atlas API
+	APIURL string `json:"api_url" structs:"api_url" mapstructure:"api_url"`
+
+	Initialized bool
+	Type        string
+	client      *atlasClient
+	sync.Mutex
+}
+
+// Initialize parses connection configuration.
+func (c *mongoDBAtlasConnectionProducer) Initialize(conf map[string]interface{}, verifyConnection bool) error {
+	c.Lock()
+	defer c.Unlock()
+
+	err := mapstructure.WeakDecode(conf, c)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(c.PublicKey) == 0:
+		return fmt.Errorf("public_key cannot be empty")
+	case len(c.PrivateKey) == 0:
+		return fmt.Errorf("private_key cannot be empty")
+	case len(c.ProjectID) == 0:
+		return fmt.Errorf("project_id cannot be empty")
+	}
+
+	if c.APIURL == "" {
+		c.APIURL = defaultAtlasURL
+	}
+
+	// Set initialized to true at this point since all fields are set,
+	// and the connection can be established at a later time.
+	c.Initialized = true
+
+	if verifyConnection {
+		client, err := c.Connection()
+		if err != nil {
+			return fmt.Errorf("error verifying connection: %s", err)
+		}
+
+		// Listing the access list checks the key and its access to the project
+		if _, err := client.(*atlasClient).listAccessList(); err != nil {
+			return fmt.Errorf("error verifying connection: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// Connection returns the client of the Atlas API.
+func (c *mongoDBAtlasConnectionProducer) Connection() (interface{}, error) {
+	if !c.Initialized {
+		return nil, connutil.ErrNotInitialized
+	}
+
+	if c.client == nil {
+		c.client = newAtlasClient(c.APIURL, c.ProjectID, c.PublicKey, c.PrivateKey)
+	}
+
+	return c.client, nil
+}
+
+// Close releases the client. The Atlas API is stateless, so there is no
+// connection to terminate.
+func (c *mongoDBAtlasConnectionProducer) Close() error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.client = nil
+
+	return nil
+}
@@ -0,0 +1,347 @@
+package mongodbatlas
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/plugins"
+	"github.com/hashicorp/vault/plugins/helper/database/connutil"
+	"github.com/hashicorp/vault/plugins/helper/database/credsutil"
+	"github.com/hashicorp/vault/plugins/helper/database/dbutil"
+)
+
+const mongoDBAtlasTypeName = "mongodbatlas"
+
+// authDatabaseName is the authentication database of the users created by the
+// plugin. Atlas requires password authenticated users to be in "admin".
+const authDatabaseName = "admin"
+
+// MongoDBAtlas is an implementation of Database interface that manages the
+// database users of a MongoDB Atlas project through the Atlas API.
+type MongoDBAtlas struct {
+	connutil.ConnectionProducer
+	credsutil.CredentialsProducer
+}
+
+// New returns a new MongoDBAtlas instance
+func New() (interface{}, error) {
+	connProducer := &mongoDBAtlasConnectionProducer{}
+	connProducer.Type = mongoDBAtlasTypeName
+
+	credsProducer := &credsutil.SQLCredentialsProducer{
+		DisplayNameLen: 15,
+		RoleNameLen:    15,
+		UsernameLen:    100,
+		Separator:      "-",
+	}
+
+	dbType := &MongoDBAtlas{
+		ConnectionProducer:  connProducer,
+		CredentialsProducer: credsProducer,
+	}
+	return dbType, nil
+}
+
+// Run runs the plugin server, which creates a MongoDBAtlas object for each connection
+func Run(apiTLSConfig *api.TLSConfig) error {
+	plugins.ServeMultiplex(New, apiTLSConfig)
+
+	return nil
+}
+
+// Type returns the TypeName for this backend
+func (m *MongoDBAtlas) Type() (string, error) {
+	return mongoDBAtlasTypeName, nil
+}
+
+func (m *MongoDBAtlas) getConnection() (*atlasClient, error) {
+	client, err := m.Connection()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.(*atlasClient), nil
+}
+
+// CreateUser creates a database user in the Atlas project as instructed by the
+// CreationStatement provided. The creation statement is a JSON blob that has
+// an array of roles, each with a role, a db and an optional collection, an
+// optional array of scopes limiting the clusters and data lakes the user can
+// access, and an optional array of IP addresses and CIDR blocks to add to the
+// IP access list of the project:
+//
+// JSON Example:
+//  { "roles": [{ "role": "readWrite", "db": "foo" }], "scopes": [{ "name": "Cluster0", "type": "CLUSTER" }], "access_list": ["192.0.2.0/24"] }
+func (m *MongoDBAtlas) CreateUser(statements dbplugin.Statements, usernameConfig dbplugin.UsernameConfig, expiration time.Time) (username string, password string, err error) {
+	// Grab the lock
+	m.Lock()
+	defer m.Unlock()
+
+	if statements.CreationStatements == "" {
+		return "", "", dbutil.ErrEmptyCreationStatement
+	}
+
+	var stmt atlasStatement
+	if err := json.Unmarshal([]byte(statements.CreationStatements), &stmt); err != nil {
+		return "", "", err
+	}
+
+	if len(stmt.Roles) == 0 {
+		return "", "", fmt.Errorf("roles array is required in creation statement")
+	}
+
+	accessList, err := stmt.accessListEntries()
+	if err != nil {
+		return "", "", err
+	}
+
+	client, err := m.getConnection()
+	if err != nil {
+		return "", "", err
+	}
+
+	username, err = m.GenerateUsername(usernameConfig)
+	if err != nil {
+		return "", "", err
+	}
+
+	password, err = m.GeneratePassword()
+	if err != nil {
+		return "", "", err
+	}
+
+	// The access list is shared by all users of the project, so only the
+	// entries that are missing are added, and tagged for removal on
+	// revocation
+	added, err := addAccessListEntries(client, accessList, username)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = client.createDatabaseUser(&atlasDatabaseUser{
+		DatabaseName: authDatabaseName,
+		Username:     username,
+		Password:     password,
+		Roles:        stmt.Roles.toAtlasRoles(),
+		Scopes:       stmt.Scopes,
+	})
+	if err != nil {
+		// Best effort removal of the entries added for the user
+		for _, entry := range added {
+			client.deleteAccessListEntry(entry)
+		}
+		return "", "", err
+	}
+
+	return username, password, nil
+}
+
+// RenewUser is not supported on MongoDB Atlas, so this is a no-op.
+func (m *MongoDBAtlas) RenewUser(statements dbplugin.Statements, username string, expiration time.Time) error {
+	// NOOP
+	return nil
+}
+
+// SetCredentials sets the password of an existing database user of the
+// project, generating a new password unless one is given. No rotation
+// statements are used.
+func (m *MongoDBAtlas) SetCredentials(statements dbplugin.Statements, staticUser dbplugin.StaticUserConfig) (username string, password string, err error) {
+	if staticUser.Username == "" {
+		return "", "", fmt.Errorf("username is required to set credentials")
+	}
+	if staticUser.CredentialType != "" && staticUser.CredentialType != dbplugin.CredentialTypePassword {
+		return "", "", dbplugin.ErrUnsupportedCredentialType
+	}
+
+	// Grab the lock
+	m.Lock()
+	defer m.Unlock()
+
+	client, err := m.getConnection()
+	if err != nil {
+		return "", "", err
+	}
+
+	password = staticUser.Password
+	if password == "" {
+		password, err = m.GeneratePassword()
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	err = client.updateDatabaseUser(&atlasDatabaseUser{
+		DatabaseName: authDatabaseName,
+		Username:     staticUser.Username,
+		Password:     password,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return staticUser.Username, password, nil
+}
+
+// RevokeUser deletes the database user from the project, along with the IP
+// access list entries that were added for it. No revocation statements are
+// used.
+func (m *MongoDBAtlas) RevokeUser(statements dbplugin.Statements, username string) error {
+	// Grab the lock
+	m.Lock()
+	defer m.Unlock()
+
+	client, err := m.getConnection()
+	if err != nil {
+		return err
+	}
+
+	err = client.deleteDatabaseUser(authDatabaseName, username)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	entries, err := client.listAccessList()
+	if err != nil {
+		return err
+	}
+
+	comment := accessListComment(username)
+	for _, entry := range entries {
+		if entry.Comment != comment {
+			continue
+		}
+
+		err := client.deleteAccessListEntry(entry)
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addAccessListEntries adds the entries that are not yet in the access list
+// of the project, and returns them.
+func addAccessListEntries(client *atlasClient, entries []atlasAccessListEntry, username string) ([]atlasAccessListEntry, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	existing, err := client.listAccessList()
+	if err != nil {
+		return nil, err
+	}
+
+	present := make(map[string]bool, len(existing))
+	for _, entry := range existing {
+		if key, err := normalizeCIDR(entry.key()); err == nil {
+			present[key] = true
+		}
+	}
+
+	var missing []atlasAccessListEntry
+	for _, entry := range entries {
+		key, _ := normalizeCIDR(entry.key())
+		if present[key] {
+			continue
+		}
+		present[key] = true
+
+		entry.Comment = accessListComment(username)
+		missing = append(missing, entry)
+	}
+
+	if len(missing) == 0 {
+		return nil, nil
+	}
+
+	if err := client.addAccessListEntries(missing); err != nil {
+		return nil, err
+	}
+
+	return missing, nil
+}
+
+// accessListComment returns the comment of the access list entries added for
+// a user, which identifies them on revocation.
+func accessListComment(username string) string {
+	return "Vault database user " + username
+}
+
+// normalizeCIDR returns the CIDR block of an IP address or CIDR block, so
+// that entries can be compared however they were given.
+func normalizeCIDR(s string) (string, error) {
+	if strings.Contains(s, "/") {
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return "", err
+		}
+		return ipNet.String(), nil
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP address %q", s)
+	}
+	if ip.To4() != nil {
+		return ip.String() + "/32", nil
+	}
+	return ip.String() + "/128", nil
+}
+
+type atlasStatementRole struct {
+	Role       string `json:"role"`
+	DB         string `json:"db"`
+	Collection string `json:"collection"`
+}
+
+type atlasStatementRoles []atlasStatementRole
+
+// toAtlasRoles converts the roles of a statement to the format of the Atlas
+// API, in which the database is required. It defaults to "admin".
+func (roles atlasStatementRoles) toAtlasRoles() []atlasRole {
+	atlasRoles := make([]atlasRole, 0, len(roles))
+	for _, role := range roles {
+		db := role.DB
+		if db == "" {
+			db = authDatabaseName
+		}
+
+		atlasRoles = append(atlasRoles, atlasRole{
+			DatabaseName:   db,
+			RoleName:       role.Role,
+			CollectionName: role.Collection,
+		})
+	}
+	return atlasRoles
+}
+
+type atlasStatement struct {
+	Roles      atlasStatementRoles `json:"roles"`
+	Scopes     []atlasScope        `json:"scopes"`
+	AccessList []string            `json:"access_list"`
+}
+
+// accessListEntries validates the access list of the statement and returns
+// its entries.
+func (s *atlasStatement) accessListEntries() ([]atlasAccessListEntry, error) {
+	entries := make([]atlasAccessListEntry, 0, len(s.AccessList))
+	for _, value := range s.AccessList {
+		value = strings.TrimSpace(value)
+		if _, err := normalizeCIDR(value); err != nil {
+			return nil, fmt.Errorf("invalid access_list entry %q", value)
+		}
+
+		if strings.Contains(value, "/") {
+			entries = append(entries, atlasAccessListEntry{CIDRBlock: value})
+		} else {
+			entries = append(entries, atlasAccessListEntry{IPAddress: value})
+		}
+	}
+	return entries, nil
+}
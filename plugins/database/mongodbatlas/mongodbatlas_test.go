@@ -0,0 +1,353 @@
+package mongodbatlas
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+)
+
+const (
+	testPublicKey  = "public-key"
+	testPrivateKey = "private-key"
+	testProjectID  = "5a0a1e7e0f2912c554080adc"
+	testRealm      = "MMS Public API"
+	testNonce      = "dcd98b7102dd2f0e8b11d0f600bfb0c093"
+)
+
+const testMongoDBAtlasRole = `{ "roles": [{ "role": "readWrite", "db": "foo" }, { "role": "read", "db": "bar", "collection": "baz" }], "scopes": [{ "name": "Cluster0", "type": "CLUSTER" }], "access_list": ["192.0.2.1", "198.51.100.0/24", "203.0.113.7"] }`
+
+// fakeAtlas implements the parts of the Atlas API used by the plugin,
+// including digest authentication.
+type fakeAtlas struct {
+	sync.Mutex
+	users      map[string]*atlasDatabaseUser
+	accessList map[string]atlasAccessListEntry
+}
+
+func prepareFakeAtlas(t *testing.T) (*fakeAtlas, func(), map[string]interface{}) {
+	f := &fakeAtlas{
+		users: make(map[string]*atlasDatabaseUser),
+		accessList: map[string]atlasAccessListEntry{
+			// An entry managed outside of Vault
+			"203.0.113.7/32": {CIDRBlock: "203.0.113.7/32", IPAddress: "203.0.113.7", Comment: "office"},
+		},
+	}
+
+	srv := httptest.NewServer(f)
+
+	connectionDetails := map[string]interface{}{
+		"public_key":  testPublicKey,
+		"private_key": testPrivateKey,
+		"project_id":  testProjectID,
+		"api_url":     srv.URL + "/api/atlas/v1.0",
+	}
+
+	return f, srv.Close, connectionDetails
+}
+
+func (f *fakeAtlas) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !f.authorized(r) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="%s", domain="", nonce="%s", algorithm=MD5, qop="auth", stale=false`, testRealm, testNonce))
+		f.error(w, http.StatusUnauthorized, "", "You are not authorized for this resource.")
+		return
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	prefix := "/api/atlas/v1.0/groups/" + testProjectID + "/"
+	if !strings.HasPrefix(r.URL.EscapedPath(), prefix) {
+		f.error(w, http.StatusNotFound, "RESOURCE_NOT_FOUND", "Not found")
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), prefix), "/")
+	for i := range parts {
+		parts[i], _ = url.PathUnescape(parts[i])
+	}
+
+	switch {
+	case parts[0] == "databaseUsers" && len(parts) == 1 && r.Method == "POST":
+		var user atlasDatabaseUser
+		json.NewDecoder(r.Body).Decode(&user)
+		if _, ok := f.users[user.Username]; ok {
+			f.error(w, http.StatusConflict, "USER_ALREADY_EXISTS", "The user already exists.")
+			return
+		}
+		f.users[user.Username] = &user
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(user)
+
+	case parts[0] == "databaseUsers" && len(parts) == 3:
+		user, ok := f.users[parts[2]]
+		if !ok || parts[1] != "admin" {
+			f.error(w, http.StatusNotFound, "USERNAME_NOT_FOUND", "No user with username exists.")
+			return
+		}
+		switch r.Method {
+		case "PATCH":
+			var update atlasDatabaseUser
+			json.NewDecoder(r.Body).Decode(&update)
+			user.Password = update.Password
+			json.NewEncoder(w).Encode(user)
+		case "DELETE":
+			delete(f.users, parts[2])
+			w.WriteHeader(http.StatusAccepted)
+		}
+
+	case parts[0] == "accessList" && len(parts) == 1 && r.Method == "GET":
+		page := atlasAccessListPage{TotalCount: len(f.accessList)}
+		for _, entry := range f.accessList {
+			page.Results = append(page.Results, entry)
+		}
+		if r.URL.Query().Get("pageNum") != "1" {
+			page.Results = nil
+		}
+		json.NewEncoder(w).Encode(page)
+
+	case parts[0] == "accessList" && len(parts) == 1 && r.Method == "POST":
+		var entries []atlasAccessListEntry
+		json.NewDecoder(r.Body).Decode(&entries)
+		for _, entry := range entries {
+			key, err := normalizeCIDR(entry.key())
+			if err != nil {
+				f.error(w, http.StatusBadRequest, "INVALID_IP_ADDRESS_OR_CIDR_NOTATION", err.Error())
+				return
+			}
+			entry.CIDRBlock = key
+			f.accessList[key] = entry
+		}
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, "{}")
+
+	case parts[0] == "accessList" && len(parts) == 2 && r.Method == "DELETE":
+		key, _ := normalizeCIDR(parts[1])
+		if _, ok := f.accessList[key]; !ok {
+			f.error(w, http.StatusNotFound, "ACCESS_LIST_ENTRY_NOT_FOUND", "IP address not on access list.")
+			return
+		}
+		delete(f.accessList, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		f.error(w, http.StatusNotFound, "RESOURCE_NOT_FOUND", "Not found")
+	}
+}
+
+func (f *fakeAtlas) authorized(r *http.Request) bool {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Digest ") {
+		return false
+	}
+	params := parseDigestChallenge(strings.TrimPrefix(authorization, "Digest "))
+
+	ha1 := md5Hex(testPublicKey + ":" + testRealm + ":" + testPrivateKey)
+	ha2 := md5Hex(r.Method + ":" + r.URL.RequestURI())
+	expected := md5Hex(ha1 + ":" + testNonce + ":" + params["nc"] + ":" + params["cnonce"] + ":" + params["qop"] + ":" + ha2)
+
+	return params["username"] == testPublicKey && params["uri"] == r.URL.RequestURI() && params["response"] == expected
+}
+
+func (f *fakeAtlas) error(w http.ResponseWriter, code int, errorCode, detail string) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(&atlasError{
+		StatusCode: code,
+		ErrorCode:  errorCode,
+		Detail:     detail,
+	})
+}
+
+func TestMongoDBAtlas_Initialize(t *testing.T) {
+	_, cleanup, connectionDetails := prepareFakeAtlas(t)
+	defer cleanup()
+
+	dbRaw, err := New()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	db := dbRaw.(*MongoDBAtlas)
+	connProducer := db.ConnectionProducer.(*mongoDBAtlasConnectionProducer)
+
+	err = db.Initialize(connectionDetails, true)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !connProducer.Initialized {
+		t.Fatal("Database should be initalized")
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Bad keys fail the verification
+	connectionDetails["private_key"] = "wrong"
+	dbRaw, _ = New()
+	if err := dbRaw.(*MongoDBAtlas).Initialize(connectionDetails, true); err == nil {
+		t.Fatal("expected error verifying connection with a bad key")
+	}
+
+	// The project is required
+	delete(connectionDetails, "project_id")
+	dbRaw, _ = New()
+	if err := dbRaw.(*MongoDBAtlas).Initialize(connectionDetails, false); err == nil {
+		t.Fatal("expected error without project_id")
+	}
+}
+
+func TestMongoDBAtlas_CreateUser(t *testing.T) {
+	f, cleanup, connectionDetails := prepareFakeAtlas(t)
+	defer cleanup()
+
+	dbRaw, err := New()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	db := dbRaw.(*MongoDBAtlas)
+	err = db.Initialize(connectionDetails, true)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	statements := dbplugin.Statements{
+		CreationStatements: testMongoDBAtlasRole,
+	}
+
+	usernameConfig := dbplugin.UsernameConfig{
+		DisplayName: "test",
+		RoleName:    "test",
+	}
+
+	username, password, err := db.CreateUser(statements, usernameConfig, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	user, ok := f.users[username]
+	if !ok {
+		t.Fatalf("user %q was not created", username)
+	}
+	if user.Password != password || user.DatabaseName != "admin" || user.GroupID != testProjectID {
+		t.Fatalf("bad user: %#v", user)
+	}
+	expectedRoles := []atlasRole{
+		{DatabaseName: "foo", RoleName: "readWrite"},
+		{DatabaseName: "bar", RoleName: "read", CollectionName: "baz"},
+	}
+	if fmt.Sprintf("%v", user.Roles) != fmt.Sprintf("%v", expectedRoles) {
+		t.Fatalf("bad roles: %#v", user.Roles)
+	}
+	if len(user.Scopes) != 1 || user.Scopes[0].Name != "Cluster0" || user.Scopes[0].Type != "CLUSTER" {
+		t.Fatalf("bad scopes: %#v", user.Scopes)
+	}
+
+	// The missing entries are added, and the existing entry is left as is
+	comment := accessListComment(username)
+	for key, expected := range map[string]string{
+		"192.0.2.1/32":    comment,
+		"198.51.100.0/24": comment,
+		"203.0.113.7/32":  "office",
+	} {
+		if entry, ok := f.accessList[key]; !ok || entry.Comment != expected {
+			t.Fatalf("bad access list entry %q: %#v", key, entry)
+		}
+	}
+
+	// Missing roles are rejected
+	_, _, err = db.CreateUser(dbplugin.Statements{CreationStatements: `{ "access_list": ["192.0.2.1"] }`}, usernameConfig, time.Now().Add(time.Minute))
+	if err == nil {
+		t.Fatal("expected error without roles")
+	}
+
+	// Invalid entries are rejected
+	_, _, err = db.CreateUser(dbplugin.Statements{CreationStatements: `{ "roles": [{ "role": "read" }], "access_list": ["192.0.2"] }`}, usernameConfig, time.Now().Add(time.Minute))
+	if err == nil {
+		t.Fatal("expected error with an invalid access list entry")
+	}
+}
+
+func TestMongoDBAtlas_SetCredentials(t *testing.T) {
+	f, cleanup, connectionDetails := prepareFakeAtlas(t)
+	defer cleanup()
+
+	f.users["static"] = &atlasDatabaseUser{DatabaseName: "admin", Username: "static", Password: "old"}
+
+	dbRaw, err := New()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	db := dbRaw.(*MongoDBAtlas)
+	err = db.Initialize(connectionDetails, true)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	username, password, err := db.SetCredentials(dbplugin.Statements{}, dbplugin.StaticUserConfig{Username: "static"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if username != "static" || password == "" || f.users["static"].Password != password {
+		t.Fatalf("bad credentials: %q %q", username, password)
+	}
+
+	_, _, err = db.SetCredentials(dbplugin.Statements{}, dbplugin.StaticUserConfig{Username: "missing"})
+	if err == nil {
+		t.Fatal("expected error for a missing user")
+	}
+}
+
+func TestMongoDBAtlas_RevokeUser(t *testing.T) {
+	f, cleanup, connectionDetails := prepareFakeAtlas(t)
+	defer cleanup()
+
+	dbRaw, err := New()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	db := dbRaw.(*MongoDBAtlas)
+	err = db.Initialize(connectionDetails, true)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	statements := dbplugin.Statements{
+		CreationStatements: testMongoDBAtlasRole,
+	}
+
+	usernameConfig := dbplugin.UsernameConfig{
+		DisplayName: "test",
+		RoleName:    "test",
+	}
+
+	username, _, err := db.CreateUser(statements, usernameConfig, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = db.RevokeUser(statements, username)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, ok := f.users[username]; ok {
+		t.Fatal("user was not deleted")
+	}
+	if len(f.accessList) != 1 || f.accessList["203.0.113.7/32"].Comment != "office" {
+		t.Fatalf("bad access list: %#v", f.accessList)
+	}
+
+	// Revoking a missing user succeeds
+	err = db.RevokeUser(statements, username)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
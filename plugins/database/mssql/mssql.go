@@ -17,6 +17,8 @@ import (
 
 const msSQLTypeName = "mssql"
 
+const defaultMSSQLRotationStmts = `ALTER LOGIN [{{name}}] WITH PASSWORD = '{{password}}';`
+
 // MSSQL is an implementation of Database interface
 type MSSQL struct {
 	connutil.ConnectionProducer
@@ -42,14 +44,9 @@ func New() (interface{}, error) {
 	return dbType, nil
 }
 
-// Run instantiates a MSSQL object, and runs the RPC server for the plugin
+// Run runs the plugin server, which creates a MSSQL object for each connection
 func Run(apiTLSConfig *api.TLSConfig) error {
-	dbType, err := New()
-	if err != nil {
-		return err
-	}
-
-	plugins.Serve(dbType.(*MSSQL), apiTLSConfig)
+	plugins.ServeMultiplex(New, apiTLSConfig)
 
 	return nil
 }
@@ -142,6 +139,74 @@ func (m *MSSQL) RenewUser(statements dbplugin.Statements, username string, expir
 	return nil
 }
 
+// SetCredentials sets the password of an existing login using the rotation
+// statements, generating a new password unless one is given
+func (m *MSSQL) SetCredentials(statements dbplugin.Statements, staticUser dbplugin.StaticUserConfig) (username string, password string, err error) {
+	if staticUser.Username == "" {
+		return "", "", fmt.Errorf("username is required to set credentials")
+	}
+	if staticUser.CredentialType != "" && staticUser.CredentialType != dbplugin.CredentialTypePassword {
+		return "", "", dbplugin.ErrUnsupportedCredentialType
+	}
+
+	// Grab the lock
+	m.Lock()
+	defer m.Unlock()
+
+	// Get the connection
+	db, err := m.getConnection()
+	if err != nil {
+		return "", "", err
+	}
+
+	rotationStmts := statements.RotationStatements
+	if rotationStmts == "" {
+		rotationStmts = defaultMSSQLRotationStmts
+	}
+
+	password = staticUser.Password
+	if password == "" {
+		password, err = m.GeneratePassword()
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	// Start a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return "", "", err
+	}
+	defer tx.Rollback()
+
+	// Execute each query
+	for _, query := range strutil.ParseArbitraryStringSlice(rotationStmts, ";") {
+		query = strings.TrimSpace(query)
+		if len(query) == 0 {
+			continue
+		}
+
+		stmt, err := tx.Prepare(dbutil.QueryHelper(query, map[string]string{
+			"name":     staticUser.Username,
+			"password": password,
+		}))
+		if err != nil {
+			return "", "", err
+		}
+		defer stmt.Close()
+		if _, err := stmt.Exec(); err != nil {
+			return "", "", err
+		}
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return "", "", err
+	}
+
+	return staticUser.Username, password, nil
+}
+
 // RevokeUser attempts to drop the specified user. It will first attempt to disable login,
 // then kill pending connections from that user, and finally drop the user and login from the
 // database instance.
@@ -2,6 +2,7 @@ package mysql
 
 import (
 	"database/sql"
+	"fmt"
 	"strings"
 	"time"
 
@@ -19,6 +20,9 @@ const (
 		REVOKE ALL PRIVILEGES, GRANT OPTION FROM '{{name}}'@'%'; 
 		DROP USER '{{name}}'@'%'
 	`
+	defaultMySQLRotationStmts = `
+		ALTER USER '{{name}}'@'%' IDENTIFIED BY '{{password}}'
+	`
 	mySQLTypeName = "mysql"
 )
 
@@ -56,15 +60,9 @@ func New(metadataLen, usernameLen int) func() (interface{}, error) {
 	}
 }
 
-// Run instantiates a MySQL object, and runs the RPC server for the plugin
+// Run runs the plugin server, which creates a MySQL object for each connection
 func Run(apiTLSConfig *api.TLSConfig) error {
-	f := New(MetadataLen, UsernameLen)
-	dbType, err := f()
-	if err != nil {
-		return err
-	}
-
-	plugins.Serve(dbType.(*MySQL), apiTLSConfig)
+	plugins.ServeMultiplex(New(MetadataLen, UsernameLen), apiTLSConfig)
 
 	return nil
 }
@@ -153,6 +151,71 @@ func (m *MySQL) RenewUser(statements dbplugin.Statements, username string, expir
 	return nil
 }
 
+// SetCredentials sets the password of an existing user using the rotation
+// statements, generating a new password unless one is given
+func (m *MySQL) SetCredentials(statements dbplugin.Statements, staticUser dbplugin.StaticUserConfig) (username string, password string, err error) {
+	if staticUser.Username == "" {
+		return "", "", fmt.Errorf("username is required to set credentials")
+	}
+	if staticUser.CredentialType != "" && staticUser.CredentialType != dbplugin.CredentialTypePassword {
+		return "", "", dbplugin.ErrUnsupportedCredentialType
+	}
+
+	// Grab the lock
+	m.Lock()
+	defer m.Unlock()
+
+	// Get the connection
+	db, err := m.getConnection()
+	if err != nil {
+		return "", "", err
+	}
+
+	rotationStmts := statements.RotationStatements
+	if rotationStmts == "" {
+		rotationStmts = defaultMySQLRotationStmts
+	}
+
+	password = staticUser.Password
+	if password == "" {
+		password, err = m.GeneratePassword()
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	// Start a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		return "", "", err
+	}
+	defer tx.Rollback()
+
+	for _, query := range strutil.ParseArbitraryStringSlice(rotationStmts, ";") {
+		query = strings.TrimSpace(query)
+		if len(query) == 0 {
+			continue
+		}
+
+		// As with revocation, these are not prepared statements because
+		// MySQL does not support preparing account management commands
+		query = dbutil.QueryHelper(query, map[string]string{
+			"name":     staticUser.Username,
+			"password": password,
+		})
+		if _, err := tx.Exec(query); err != nil {
+			return "", "", err
+		}
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return "", "", err
+	}
+
+	return staticUser.Username, password, nil
+}
+
 func (m *MySQL) RevokeUser(statements dbplugin.Statements, username string) error {
 	// Grab the read lock
 	m.Lock()
@@ -20,6 +20,9 @@ const (
 	postgreSQLTypeName      string = "postgres"
 	defaultPostgresRenewSQL        = `
 ALTER ROLE "{{name}}" VALID UNTIL '{{expiration}}';
+`
+	defaultPostgresRotationSQL = `
+ALTER ROLE "{{name}}" WITH PASSWORD '{{password}}';
 `
 )
 
@@ -43,14 +46,9 @@ func New() (interface{}, error) {
 	return dbType, nil
 }
 
-// Run instantiates a PostgreSQL object, and runs the RPC server for the plugin
+// Run runs the plugin server, which creates a PostgreSQL object for each connection
 func Run(apiTLSConfig *api.TLSConfig) error {
-	dbType, err := New()
-	if err != nil {
-		return err
-	}
-
-	plugins.Serve(dbType.(*PostgreSQL), apiTLSConfig)
+	plugins.ServeMultiplex(New, apiTLSConfig)
 
 	return nil
 }
@@ -200,6 +198,71 @@ func (p *PostgreSQL) RenewUser(statements dbplugin.Statements, username string,
 	return nil
 }
 
+// SetCredentials sets the password of an existing user using the rotation
+// statements, generating a new password unless one is given
+func (p *PostgreSQL) SetCredentials(statements dbplugin.Statements, staticUser dbplugin.StaticUserConfig) (username string, password string, err error) {
+	if staticUser.Username == "" {
+		return "", "", fmt.Errorf("username is required to set credentials")
+	}
+	if staticUser.CredentialType != "" && staticUser.CredentialType != dbplugin.CredentialTypePassword {
+		return "", "", dbplugin.ErrUnsupportedCredentialType
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	rotationStmts := statements.RotationStatements
+	if rotationStmts == "" {
+		rotationStmts = defaultPostgresRotationSQL
+	}
+
+	password = staticUser.Password
+	if password == "" {
+		password, err = p.GeneratePassword()
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	db, err := p.getConnection()
+	if err != nil {
+		return "", "", err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", "", err
+	}
+	defer func() {
+		tx.Rollback()
+	}()
+
+	for _, query := range strutil.ParseArbitraryStringSlice(rotationStmts, ";") {
+		query = strings.TrimSpace(query)
+		if len(query) == 0 {
+			continue
+		}
+		stmt, err := tx.Prepare(dbutil.QueryHelper(query, map[string]string{
+			"name":     staticUser.Username,
+			"password": password,
+		}))
+		if err != nil {
+			return "", "", err
+		}
+
+		defer stmt.Close()
+		if _, err := stmt.Exec(); err != nil {
+			return "", "", err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", "", err
+	}
+
+	return staticUser.Username, password, nil
+}
+
 func (p *PostgreSQL) RevokeUser(statements dbplugin.Statements, username string) error {
 	// Grab the lock
 	p.Lock()
@@ -0,0 +1,184 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/helper/parseutil"
+	"github.com/hashicorp/vault/plugins/helper/database/connutil"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	// persistenceModeACLFile saves ACL changes to the ACL file of the server
+	persistenceModeACLFile = "ACLFILE"
+
+	// persistenceModeRewrite saves ACL changes to the configuration file of
+	// the server
+	persistenceModeRewrite = "REWRITE"
+)
+
+// redisConnectionProducer implements ConnectionProducer and provides an
+// interface for Redis servers to make connections.
+type redisConnectionProducer struct {
+	Host              string      `json:"host" structs:"host" mapstructure:"host"`
+	Port              int         `json:"port" structs:"port" mapstructure:"port"`
+	Username          string      `json:"username" structs:"username" mapstructure:"username"`
+	Password          string      `json:"password" structs:"password" mapstructure:"password"`
+	TLS               bool        `json:"tls" structs:"tls" mapstructure:"tls"`
+	InsecureTLS       bool        `json:"insecure_tls" structs:"insecure_tls" mapstructure:"insecure_tls"`
+	CACert            string      `json:"ca_cert" structs:"ca_cert" mapstructure:"ca_cert"`
+	ConnectTimeoutRaw interface{} `json:"connect_timeout" structs:"connect_timeout" mapstructure:"connect_timeout"`
+
+	// PersistenceMode sets how ACL changes are saved so that they survive
+	// restarts of the server, if at all
+	PersistenceMode string `json:"persistence_mode" structs:"persistence_mode" mapstructure:"persistence_mode"`
+
+	connectTimeout time.Duration
+	tlsConfig      *tls.Config
+
+	Initialized bool
+	Type        string
+	conn        *redisConn
+	sync.Mutex
+}
+
+func (c *redisConnectionProducer) Initialize(conf map[string]interface{}, verifyConnection bool) error {
+	c.Lock()
+	defer c.Unlock()
+
+	err := mapstructure.WeakDecode(conf, c)
+	if err != nil {
+		return err
+	}
+
+	if c.ConnectTimeoutRaw == nil {
+		c.ConnectTimeoutRaw = "10s"
+	}
+	c.connectTimeout, err = parseutil.ParseDurationSecond(c.ConnectTimeoutRaw)
+	if err != nil {
+		return fmt.Errorf("invalid connect_timeout: %s", err)
+	}
+
+	if len(c.Host) == 0 {
+		return fmt.Errorf("host cannot be empty")
+	}
+	if c.Port == 0 {
+		c.Port = 6379
+	}
+
+	switch c.PersistenceMode {
+	case "", persistenceModeACLFile, persistenceModeRewrite:
+	default:
+		return fmt.Errorf("persistence_mode must be %q or %q", persistenceModeACLFile, persistenceModeRewrite)
+	}
+
+	c.tlsConfig = nil
+	if c.TLS {
+		c.tlsConfig = &tls.Config{
+			ServerName:         c.Host,
+			InsecureSkipVerify: c.InsecureTLS,
+		}
+		if c.CACert != "" {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM([]byte(c.CACert)) {
+				return fmt.Errorf("ca_cert does not contain a PEM encoded certificate")
+			}
+			c.tlsConfig.RootCAs = pool
+		}
+	}
+
+	// Set initialized to true at this point since all fields are set,
+	// and the connection can be established at a later time.
+	c.Initialized = true
+
+	if verifyConnection {
+		conn, err := c.Connection()
+		if err != nil {
+			return fmt.Errorf("error verifying connection: %s", err)
+		}
+
+		if _, err := conn.(*redisConn).do("PING"); err != nil {
+			return fmt.Errorf("error verifying connection: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func (c *redisConnectionProducer) Connection() (interface{}, error) {
+	if !c.Initialized {
+		return nil, connutil.ErrNotInitialized
+	}
+
+	// If we already have a connection, return it
+	if c.conn != nil {
+		return c.conn, nil
+	}
+
+	addr := net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	conn, err := dialRedis(addr, c.tlsConfig, c.connectTimeout, c.Username, c.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	c.conn = conn
+
+	return conn, nil
+}
+
+// do runs a command on the connection. The connection is dropped on errors
+// other than error replies, so that the next command reconnects. The caller
+// must hold the lock.
+func (c *redisConnectionProducer) do(args ...string) (interface{}, error) {
+	conn, err := c.Connection()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.(*redisConn).do(args...)
+	if err != nil {
+		if _, ok := err.(redisError); !ok {
+			c.conn.Close()
+			c.conn = nil
+		}
+		return nil, err
+	}
+
+	return reply, nil
+}
+
+// persist saves the ACL changes according to the persistence mode. The caller
+// must hold the lock.
+func (c *redisConnectionProducer) persist() error {
+	var err error
+	switch c.PersistenceMode {
+	case persistenceModeACLFile:
+		_, err = c.do("ACL", "SAVE")
+	case persistenceModeRewrite:
+		_, err = c.do("CONFIG", "REWRITE")
+	}
+	if err != nil {
+		return fmt.Errorf("error persisting ACL changes: %s", err)
+	}
+	return nil
+}
+
+func (c *redisConnectionProducer) Close() error {
+	// Grab the write lock
+	c.Lock()
+	defer c.Unlock()
+
+	if c.conn != nil {
+		c.conn.Close()
+	}
+
+	c.conn = nil
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/plugins"
+	"github.com/hashicorp/vault/plugins/helper/database/connutil"
+	"github.com/hashicorp/vault/plugins/helper/database/credsutil"
+	"github.com/hashicorp/vault/plugins/helper/database/dbutil"
+)
+
+const redisTypeName = "redis"
+
+// Redis is an implementation of Database interface that manages the ACL users
+// of Redis 6 and later.
+type Redis struct {
+	connutil.ConnectionProducer
+	credsutil.CredentialsProducer
+}
+
+// New returns a new Redis instance
+func New() (interface{}, error) {
+	connProducer := &redisConnectionProducer{}
+	connProducer.Type = redisTypeName
+
+	credsProducer := &credsutil.SQLCredentialsProducer{
+		DisplayNameLen: 15,
+		RoleNameLen:    15,
+		UsernameLen:    100,
+		Separator:      "-",
+	}
+
+	dbType := &Redis{
+		ConnectionProducer:  connProducer,
+		CredentialsProducer: credsProducer,
+	}
+	return dbType, nil
+}
+
+// Run runs the plugin server, which creates a Redis object for each connection
+func Run(apiTLSConfig *api.TLSConfig) error {
+	plugins.ServeMultiplex(New, apiTLSConfig)
+
+	return nil
+}
+
+// Type returns the TypeName for this backend
+func (r *Redis) Type() (string, error) {
+	return redisTypeName, nil
+}
+
+func (r *Redis) producer() *redisConnectionProducer {
+	return r.ConnectionProducer.(*redisConnectionProducer)
+}
+
+// CreateUser creates an ACL user with the rules of the creation statement,
+// which is a JSON array of ACL rules, or a string of space separated rules:
+//
+// JSON Example:
+//  ["~cache:*", "+@read", "+@connection"]
+//
+// The user is created with no permissions other than the given rules, and
+// with the generated password.
+func (r *Redis) CreateUser(statements dbplugin.Statements, usernameConfig dbplugin.UsernameConfig, expiration time.Time) (username string, password string, err error) {
+	if statements.CreationStatements == "" {
+		return "", "", dbutil.ErrEmptyCreationStatement
+	}
+
+	rules, err := parseACLRules(statements.CreationStatements)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Grab the lock
+	r.Lock()
+	defer r.Unlock()
+
+	username, err = r.GenerateUsername(usernameConfig)
+	if err != nil {
+		return "", "", err
+	}
+
+	password, err = r.GeneratePassword()
+	if err != nil {
+		return "", "", err
+	}
+
+	args := append([]string{"ACL", "SETUSER", username, "reset", "on", ">" + password}, rules...)
+	if _, err := r.producer().do(args...); err != nil {
+		return "", "", err
+	}
+
+	if err := r.producer().persist(); err != nil {
+		return "", "", err
+	}
+
+	return username, password, nil
+}
+
+// RenewUser is not supported on Redis, so this is a no-op.
+func (r *Redis) RenewUser(statements dbplugin.Statements, username string, expiration time.Time) error {
+	// NOOP
+	return nil
+}
+
+// RevokeUser deletes the ACL user. No revocation statements are used.
+func (r *Redis) RevokeUser(statements dbplugin.Statements, username string) error {
+	// Grab the lock
+	r.Lock()
+	defer r.Unlock()
+
+	if _, err := r.producer().do("ACL", "DELUSER", username); err != nil {
+		return err
+	}
+
+	return r.producer().persist()
+}
+
+// SetCredentials replaces the passwords of an existing ACL user, generating a
+// new password unless one is given. The rules of the user are left as is. No
+// rotation statements are used.
+func (r *Redis) SetCredentials(statements dbplugin.Statements, staticUser dbplugin.StaticUserConfig) (username string, password string, err error) {
+	if staticUser.Username == "" {
+		return "", "", fmt.Errorf("username is required to set credentials")
+	}
+	if staticUser.CredentialType != "" && staticUser.CredentialType != dbplugin.CredentialTypePassword {
+		return "", "", dbplugin.ErrUnsupportedCredentialType
+	}
+
+	// Grab the lock
+	r.Lock()
+	defer r.Unlock()
+
+	// ACL SETUSER creates missing users, so check that the user exists
+	reply, err := r.producer().do("ACL", "GETUSER", staticUser.Username)
+	if err != nil {
+		return "", "", err
+	}
+	if reply == nil {
+		return "", "", fmt.Errorf("user %q does not exist", staticUser.Username)
+	}
+
+	password = staticUser.Password
+	if password == "" {
+		password, err = r.GeneratePassword()
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	if _, err := r.producer().do("ACL", "SETUSER", staticUser.Username, "resetpass", ">"+password); err != nil {
+		return "", "", err
+	}
+
+	if err := r.producer().persist(); err != nil {
+		return "", "", err
+	}
+
+	return staticUser.Username, password, nil
+}
+
+// parseACLRules parses the rules of a creation statement. Rules setting or
+// resetting passwords are rejected, as Vault manages the password of the user.
+func parseACLRules(stmt string) ([]string, error) {
+	var rules []string
+	if strings.HasPrefix(strings.TrimSpace(stmt), "[") {
+		if err := json.Unmarshal([]byte(stmt), &rules); err != nil {
+			return nil, fmt.Errorf("error parsing creation statement: %s", err)
+		}
+	} else {
+		rules = strings.Fields(stmt)
+	}
+
+	for _, rule := range rules {
+		switch {
+		case rule == "":
+			return nil, fmt.Errorf("empty ACL rule in creation statement")
+		case strings.ContainsAny(rule[:1], "><#!"),
+			strings.EqualFold(rule, "nopass"),
+			strings.EqualFold(rule, "resetpass"),
+			strings.EqualFold(rule, "reset"):
+			return nil, fmt.Errorf("ACL rule %q changes passwords, which are managed by Vault", rule)
+		}
+	}
+
+	return rules, nil
+}
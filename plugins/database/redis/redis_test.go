@@ -0,0 +1,356 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+)
+
+// fakeRedis is a Redis server supporting the commands used by the plugin. Its
+// ACL users are a map of usernames to their rules.
+type fakeRedis struct {
+	sync.Mutex
+	listener net.Listener
+	users    map[string][]string
+	commands [][]string
+}
+
+func prepareFakeRedis(t *testing.T) (*fakeRedis, func(), map[string]interface{}) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeRedis{
+		listener: listener,
+		users: map[string][]string{
+			"default": {"on", ">secret", "+@all"},
+			"app":     {"on", ">app", "+@read"},
+		},
+	}
+	go f.serve()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	connectionDetails := map[string]interface{}{
+		"host":             host,
+		"port":             port,
+		"username":         "default",
+		"password":         "secret",
+		"persistence_mode": "ACLFILE",
+	}
+
+	return f, func() { listener.Close() }, connectionDetails
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	authenticated := false
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+
+		f.Lock()
+		f.commands = append(f.commands, args)
+		reply := f.exec(args, &authenticated)
+		f.Unlock()
+
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) exec(args []string, authenticated *bool) string {
+	cmd := strings.ToUpper(strings.Join(args[:min(len(args), 2)], " "))
+	if args[0] == "AUTH" {
+		if len(args) == 3 && contains(f.users[args[1]], ">"+args[2]) {
+			*authenticated = true
+			return "+OK\r\n"
+		}
+		return "-WRONGPASS invalid username-password pair\r\n"
+	}
+	if !*authenticated {
+		return "-NOAUTH Authentication required.\r\n"
+	}
+
+	switch {
+	case cmd == "PING":
+		return "+PONG\r\n"
+	case cmd == "ACL SAVE":
+		return "+OK\r\n"
+	case cmd == "ACL GETUSER":
+		rules, ok := f.users[args[2]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		reply := fmt.Sprintf("*2\r\n$5\r\nflags\r\n*%d\r\n", len(rules))
+		for _, rule := range rules {
+			reply += fmt.Sprintf("$%d\r\n%s\r\n", len(rule), rule)
+		}
+		return reply
+	case cmd == "ACL SETUSER":
+		rules := f.users[args[2]]
+		for _, rule := range args[3:] {
+			switch rule {
+			case "reset":
+				rules = nil
+			case "resetpass":
+				var kept []string
+				for _, r := range rules {
+					if !strings.HasPrefix(r, ">") {
+						kept = append(kept, r)
+					}
+				}
+				rules = kept
+			default:
+				rules = append(rules, rule)
+			}
+		}
+		f.users[args[2]] = rules
+		return "+OK\r\n"
+	case cmd == "ACL DELUSER":
+		_, ok := f.users[args[2]]
+		delete(f.users, args[2])
+		if ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		if _, err := reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func (f *fakeRedis) lastCommands(n int) [][]string {
+	f.Lock()
+	defer f.Unlock()
+
+	if len(f.commands) < n {
+		return f.commands
+	}
+	return f.commands[len(f.commands)-n:]
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRedis_Initialize(t *testing.T) {
+	_, cleanup, connectionDetails := prepareFakeRedis(t)
+	defer cleanup()
+
+	dbRaw, err := New()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	db := dbRaw.(*Redis)
+	connProducer := db.ConnectionProducer.(*redisConnectionProducer)
+
+	err = db.Initialize(connectionDetails, true)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !connProducer.Initialized {
+		t.Fatal("Database should be initalized")
+	}
+
+	err = db.Close()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	connectionDetails["password"] = "wrong"
+	dbRaw, _ = New()
+	if err := dbRaw.(*Redis).Initialize(connectionDetails, true); err == nil {
+		t.Fatal("expected error verifying connection with a bad password")
+	}
+
+	connectionDetails["persistence_mode"] = "SNAPSHOT"
+	dbRaw, _ = New()
+	if err := dbRaw.(*Redis).Initialize(connectionDetails, false); err == nil {
+		t.Fatal("expected error with an invalid persistence mode")
+	}
+}
+
+func TestRedis_CreateUser(t *testing.T) {
+	f, cleanup, connectionDetails := prepareFakeRedis(t)
+	defer cleanup()
+
+	dbRaw, err := New()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	db := dbRaw.(*Redis)
+	err = db.Initialize(connectionDetails, true)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	usernameConfig := dbplugin.UsernameConfig{
+		DisplayName: "test",
+		RoleName:    "test",
+	}
+
+	// Test with no configured Creation Statememt
+	_, _, err = db.CreateUser(dbplugin.Statements{}, usernameConfig, time.Now().Add(time.Minute))
+	if err == nil {
+		t.Fatal("Expected error when no creation statement is provided")
+	}
+
+	for _, stmt := range []string{`["~cache:*", "+@read"]`, `~cache:* +@read`} {
+		username, password, err := db.CreateUser(dbplugin.Statements{CreationStatements: stmt}, usernameConfig, time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		expected := []string{"on", ">" + password, "~cache:*", "+@read"}
+		if fmt.Sprint(f.users[username]) != fmt.Sprint(expected) {
+			t.Fatalf("bad rules: %v", f.users[username])
+		}
+		if last := f.lastCommands(1); fmt.Sprint(last) != "[[ACL SAVE]]" {
+			t.Fatalf("ACLs were not saved: %v", last)
+		}
+
+		// The credentials work
+		if _, err := dialRedis(connectionDetails["host"].(string)+":"+connectionDetails["port"].(string), nil, time.Second, username, password); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// Rules changing the password are rejected
+	for _, stmt := range []string{`["+@read", "nopass"]`, `+@read >password`, `reset +@all`} {
+		_, _, err = db.CreateUser(dbplugin.Statements{CreationStatements: stmt}, usernameConfig, time.Now().Add(time.Minute))
+		if err == nil {
+			t.Fatalf("expected error for statement %q", stmt)
+		}
+	}
+}
+
+func TestRedis_RevokeUser(t *testing.T) {
+	f, cleanup, connectionDetails := prepareFakeRedis(t)
+	defer cleanup()
+
+	dbRaw, err := New()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	db := dbRaw.(*Redis)
+	err = db.Initialize(connectionDetails, true)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	usernameConfig := dbplugin.UsernameConfig{
+		DisplayName: "test",
+		RoleName:    "test",
+	}
+
+	username, _, err := db.CreateUser(dbplugin.Statements{CreationStatements: `+@read`}, usernameConfig, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = db.RevokeUser(dbplugin.Statements{}, username)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, ok := f.users[username]; ok {
+		t.Fatal("user was not deleted")
+	}
+
+	// Revoking a missing user succeeds
+	err = db.RevokeUser(dbplugin.Statements{}, username)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestRedis_SetCredentials(t *testing.T) {
+	f, cleanup, connectionDetails := prepareFakeRedis(t)
+	defer cleanup()
+
+	dbRaw, err := New()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	db := dbRaw.(*Redis)
+	err = db.Initialize(connectionDetails, true)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	username, password, err := db.SetCredentials(dbplugin.Statements{}, dbplugin.StaticUserConfig{Username: "app"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{"on", "+@read", ">" + password}
+	if username != "app" || fmt.Sprint(f.users["app"]) != fmt.Sprint(expected) {
+		t.Fatalf("bad rules: %v", f.users["app"])
+	}
+
+	_, _, err = db.SetCredentials(dbplugin.Statements{}, dbplugin.StaticUserConfig{Username: "missing"})
+	if err == nil {
+		t.Fatal("expected error for a missing user")
+	}
+	if _, ok := f.users["missing"]; ok {
+		t.Fatal("missing user was created")
+	}
+}
@@ -0,0 +1,231 @@
+package redisenterprise
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+// reClient makes calls to the REST API of a Redis Enterprise cluster,
+// authenticating as a cluster user with HTTP basic authentication.
+type reClient struct {
+	url      string
+	username string
+	password string
+
+	httpClient *http.Client
+}
+
+func newREClient(url, username, password string, tlsConfig *tls.Config) *reClient {
+	transport := cleanhttp.DefaultTransport()
+	transport.TLSClientConfig = tlsConfig
+
+	return &reClient{
+		url:      strings.TrimSuffix(url, "/"),
+		username: username,
+		password: password,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   30 * time.Second,
+		},
+	}
+}
+
+// reError is an error returned by the API
+type reError struct {
+	StatusCode  int
+	ErrorCode   string `json:"error_code"`
+	Description string `json:"description"`
+}
+
+func (e *reError) Error() string {
+	if e.ErrorCode == "" {
+		return fmt.Sprintf("redis enterprise API returned status %d: %s", e.StatusCode, e.Description)
+	}
+	return fmt.Sprintf("redis enterprise API returned status %d (%s): %s", e.StatusCode, e.ErrorCode, e.Description)
+}
+
+// isNotFound returns whether err is an API error for a missing resource
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*reError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+type reUser struct {
+	UID        int    `json:"uid,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Email      string `json:"email,omitempty"`
+	Password   string `json:"password,omitempty"`
+	AuthMethod string `json:"auth_method,omitempty"`
+	RoleUIDs   []int  `json:"role_uids,omitempty"`
+}
+
+type reRole struct {
+	UID        int    `json:"uid,omitempty"`
+	Name       string `json:"name"`
+	Management string `json:"management"`
+}
+
+type reACL struct {
+	UID  int    `json:"uid"`
+	Name string `json:"name"`
+}
+
+type reRolePermission struct {
+	RoleUID     int `json:"role_uid"`
+	RedisACLUID int `json:"redis_acl_uid"`
+}
+
+type reDatabase struct {
+	UID              int                `json:"uid"`
+	Name             string             `json:"name"`
+	RolesPermissions []reRolePermission `json:"roles_permissions"`
+}
+
+// findUser returns the user with the given name or, as cluster users log in
+// with their email, email.
+func (c *reClient) findUser(name string) (*reUser, error) {
+	var users []reUser
+	if err := c.do("GET", "/v1/users", nil, &users); err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if user.Name == name || (user.Email != "" && user.Email == name) {
+			return &user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *reClient) createUser(user *reUser) (*reUser, error) {
+	created := &reUser{}
+	if err := c.do("POST", "/v1/users", user, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (c *reClient) setUserPassword(uid int, password string) error {
+	return c.do("PUT", fmt.Sprintf("/v1/users/%d", uid), &reUser{Password: password}, nil)
+}
+
+func (c *reClient) deleteUser(uid int) error {
+	return c.do("DELETE", fmt.Sprintf("/v1/users/%d", uid), nil, nil)
+}
+
+func (c *reClient) findRole(name string) (*reRole, error) {
+	var roles []reRole
+	if err := c.do("GET", "/v1/roles", nil, &roles); err != nil {
+		return nil, err
+	}
+	for _, role := range roles {
+		if role.Name == name {
+			return &role, nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *reClient) createRole(role *reRole) (*reRole, error) {
+	created := &reRole{}
+	if err := c.do("POST", "/v1/roles", role, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (c *reClient) deleteRole(uid int) error {
+	return c.do("DELETE", fmt.Sprintf("/v1/roles/%d", uid), nil, nil)
+}
+
+func (c *reClient) findACL(name string) (*reACL, error) {
+	var acls []reACL
+	if err := c.do("GET", "/v1/redis_acls", nil, &acls); err != nil {
+		return nil, err
+	}
+	for _, acl := range acls {
+		if acl.Name == name {
+			return &acl, nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *reClient) findDatabase(name string) (*reDatabase, error) {
+	var databases []reDatabase
+	if err := c.do("GET", "/v1/bdbs?fields=uid,name,roles_permissions", nil, &databases); err != nil {
+		return nil, err
+	}
+	for _, database := range databases {
+		if database.Name == name {
+			return &database, nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *reClient) setRolesPermissions(uid int, permissions []reRolePermission) error {
+	if permissions == nil {
+		permissions = []reRolePermission{}
+	}
+	return c.do("PUT", fmt.Sprintf("/v1/bdbs/%d", uid), map[string]interface{}{
+		"roles_permissions": permissions,
+	}, nil)
+}
+
+// do makes a request to the API, encoding in as the JSON body and decoding the
+// response into out if they are set.
+func (c *reClient) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.url+path, body)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.username, c.password)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &reError{}
+		if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil || apiErr.Description == "" {
+			apiErr.Description = http.StatusText(resp.StatusCode)
+		}
+		apiErr.StatusCode = resp.StatusCode
+		return apiErr
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("error decoding redis enterprise API response: %s", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package redisenterprise
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/vault/plugins/helper/database/connutil"
+	"github.com/mitchellh/mapstructure"
+)
+
+// redisEnterpriseConnectionProducer implements ConnectionProducer and
+// provides a client for the REST API of a Redis Enterprise cluster.
+type redisEnterpriseConnectionProducer struct {
+	URL         string `json:"url" structs:"url" mapstructure:"url"`
+	Username    string `json:"username" structs:"username" mapstructure:"username"`
+	Password    string `json:"password" structs:"password" mapstructure:"password"`
+	InsecureTLS bool   `json:"insecure_tls" structs:"insecure_tls" mapstructure:"insecure_tls"`
+	CACert      string `json:"ca_cert" structs:"ca_cert" mapstructure:"ca_cert"`
+
+	// Database is the name of the database that the ACLs of roles are
+	// granted on
+	Database string `json:"database" structs:"database" mapstructure:"database"`
+
+	tlsConfig *tls.Config
+
+	Initialized bool
+	Type        string
+	client      *reClient
+	sync.Mutex
+}
+
+// Initialize parses connection configuration.
+func (c *redisEnterpriseConnectionProducer) Initialize(conf map[string]interface{}, verifyConnection bool) error {
+	c.Lock()
+	defer c.Unlock()
+
+	err := mapstructure.WeakDecode(conf, c)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(c.URL) == 0:
+		return fmt.Errorf("url cannot be empty")
+	case len(c.Username) == 0:
+		return fmt.Errorf("username cannot be empty")
+	case len(c.Password) == 0:
+		return fmt.Errorf("password cannot be empty")
+	}
+
+	c.tlsConfig = &tls.Config{
+		InsecureSkipVerify: c.InsecureTLS,
+	}
+	if c.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(c.CACert)) {
+			return fmt.Errorf("ca_cert does not contain a PEM encoded certificate")
+		}
+		c.tlsConfig.RootCAs = pool
+	}
+
+	// Set initialized to true at this point since all fields are set,
+	// and the connection can be established at a later time.
+	c.Initialized = true
+
+	if verifyConnection {
+		client, err := c.Connection()
+		if err != nil {
+			return fmt.Errorf("error verifying connection: %s", err)
+		}
+
+		if c.Database != "" {
+			database, err := client.(*reClient).findDatabase(c.Database)
+			if err != nil {
+				return fmt.Errorf("error verifying connection: %s", err)
+			}
+			if database == nil {
+				return fmt.Errorf("error verifying connection: database %q does not exist", c.Database)
+			}
+		} else if _, err := client.(*reClient).findRole(""); err != nil {
+			return fmt.Errorf("error verifying connection: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// Connection returns the client of the REST API.
+func (c *redisEnterpriseConnectionProducer) Connection() (interface{}, error) {
+	if !c.Initialized {
+		return nil, connutil.ErrNotInitialized
+	}
+
+	if c.client == nil {
+		c.client = newREClient(c.URL, c.Username, c.Password, c.tlsConfig)
+	}
+
+	return c.client, nil
+}
+
+// Close releases the client. The REST API is stateless, so there is no
+// connection to terminate.
+func (c *redisEnterpriseConnectionProducer) Close() error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.client = nil
+
+	return nil
+}
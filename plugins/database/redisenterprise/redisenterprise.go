@@ -0,0 +1,311 @@
+package redisenterprise
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/plugins"
+	"github.com/hashicorp/vault/plugins/helper/database/connutil"
+	"github.com/hashicorp/vault/plugins/helper/database/credsutil"
+	"github.com/hashicorp/vault/plugins/helper/database/dbutil"
+)
+
+const redisEnterpriseTypeName = "redisenterprise"
+
+// RedisEnterprise is an implementation of Database interface that manages the
+// users of a Redis Enterprise cluster through its REST API.
+type RedisEnterprise struct {
+	connutil.ConnectionProducer
+	credsutil.CredentialsProducer
+}
+
+// New returns a new RedisEnterprise instance
+func New() (interface{}, error) {
+	connProducer := &redisEnterpriseConnectionProducer{}
+	connProducer.Type = redisEnterpriseTypeName
+
+	credsProducer := &credsutil.SQLCredentialsProducer{
+		DisplayNameLen: 15,
+		RoleNameLen:    15,
+		UsernameLen:    100,
+		Separator:      "-",
+	}
+
+	dbType := &RedisEnterprise{
+		ConnectionProducer:  connProducer,
+		CredentialsProducer: credsProducer,
+	}
+	return dbType, nil
+}
+
+// Run runs the plugin server, which creates a RedisEnterprise object for each connection
+func Run(apiTLSConfig *api.TLSConfig) error {
+	plugins.ServeMultiplex(New, apiTLSConfig)
+
+	return nil
+}
+
+// Type returns the TypeName for this backend
+func (r *RedisEnterprise) Type() (string, error) {
+	return redisEnterpriseTypeName, nil
+}
+
+func (r *RedisEnterprise) producer() *redisEnterpriseConnectionProducer {
+	return r.ConnectionProducer.(*redisEnterpriseConnectionProducer)
+}
+
+func (r *RedisEnterprise) getConnection() (*reClient, error) {
+	client, err := r.Connection()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.(*reClient), nil
+}
+
+// reStatement is the creation statement of the plugin
+type reStatement struct {
+	Role string `json:"role"`
+	ACL  string `json:"acl"`
+}
+
+// CreateUser creates a user of the cluster as instructed by the creation
+// statement, a JSON blob with either the name of an existing role to give the
+// user, or the name of a Redis ACL to grant it on the database of the
+// connection:
+//
+// JSON Example:
+//  { "role": "db-viewer" }
+//  { "acl": "Read-Only" }
+//
+// For ACLs, a role dedicated to the user is created and bound to the ACL on
+// the database. It is deleted along with the user.
+func (r *RedisEnterprise) CreateUser(statements dbplugin.Statements, usernameConfig dbplugin.UsernameConfig, expiration time.Time) (username string, password string, err error) {
+	if statements.CreationStatements == "" {
+		return "", "", dbutil.ErrEmptyCreationStatement
+	}
+
+	var stmt reStatement
+	if err := json.Unmarshal([]byte(statements.CreationStatements), &stmt); err != nil {
+		return "", "", err
+	}
+	if (stmt.Role == "") == (stmt.ACL == "") {
+		return "", "", fmt.Errorf("creation statement must contain either a role or an acl")
+	}
+
+	// Grab the lock
+	r.Lock()
+	defer r.Unlock()
+
+	client, err := r.getConnection()
+	if err != nil {
+		return "", "", err
+	}
+
+	username, err = r.GenerateUsername(usernameConfig)
+	if err != nil {
+		return "", "", err
+	}
+
+	password, err = r.GeneratePassword()
+	if err != nil {
+		return "", "", err
+	}
+
+	var roleUID int
+	if stmt.Role != "" {
+		role, err := client.findRole(stmt.Role)
+		if err != nil {
+			return "", "", err
+		}
+		if role == nil {
+			return "", "", fmt.Errorf("role %q does not exist", stmt.Role)
+		}
+		roleUID = role.UID
+	} else {
+		roleUID, err = r.createACLRole(client, username, stmt.ACL)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	_, err = client.createUser(&reUser{
+		Name:       username,
+		Password:   password,
+		AuthMethod: "regular",
+		RoleUIDs:   []int{roleUID},
+	})
+	if err != nil {
+		if stmt.ACL != "" {
+			// Best effort removal of the role created for the user
+			r.deleteACLRole(client, username)
+		}
+		return "", "", err
+	}
+
+	return username, password, nil
+}
+
+// createACLRole creates a role for the user, and binds it to the ACL on the
+// database of the connection.
+func (r *RedisEnterprise) createACLRole(client *reClient, username, aclName string) (int, error) {
+	databaseName := r.producer().Database
+	if databaseName == "" {
+		return 0, fmt.Errorf("the database connection parameter is required to grant ACLs")
+	}
+
+	acl, err := client.findACL(aclName)
+	if err != nil {
+		return 0, err
+	}
+	if acl == nil {
+		return 0, fmt.Errorf("redis ACL %q does not exist", aclName)
+	}
+
+	database, err := client.findDatabase(databaseName)
+	if err != nil {
+		return 0, err
+	}
+	if database == nil {
+		return 0, fmt.Errorf("database %q does not exist", databaseName)
+	}
+
+	// Roles with no management access only grant access to databases
+	role, err := client.createRole(&reRole{
+		Name:       username,
+		Management: "none",
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	permissions := append(database.RolesPermissions, reRolePermission{
+		RoleUID:     role.UID,
+		RedisACLUID: acl.UID,
+	})
+	if err := client.setRolesPermissions(database.UID, permissions); err != nil {
+		client.deleteRole(role.UID)
+		return 0, err
+	}
+
+	return role.UID, nil
+}
+
+// deleteACLRole deletes the role created for the user, if any, and its
+// binding on the database of the connection.
+func (r *RedisEnterprise) deleteACLRole(client *reClient, username string) error {
+	role, err := client.findRole(username)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return nil
+	}
+
+	if databaseName := r.producer().Database; databaseName != "" {
+		database, err := client.findDatabase(databaseName)
+		if err != nil {
+			return err
+		}
+
+		if database != nil {
+			var permissions []reRolePermission
+			for _, permission := range database.RolesPermissions {
+				if permission.RoleUID != role.UID {
+					permissions = append(permissions, permission)
+				}
+			}
+
+			if len(permissions) != len(database.RolesPermissions) {
+				if err := client.setRolesPermissions(database.UID, permissions); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	err = client.deleteRole(role.UID)
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// RenewUser is not supported on Redis Enterprise, so this is a no-op.
+func (r *RedisEnterprise) RenewUser(statements dbplugin.Statements, username string, expiration time.Time) error {
+	// NOOP
+	return nil
+}
+
+// RevokeUser deletes the user from the cluster, along with the role created
+// for it, if any. No revocation statements are used.
+func (r *RedisEnterprise) RevokeUser(statements dbplugin.Statements, username string) error {
+	// Grab the lock
+	r.Lock()
+	defer r.Unlock()
+
+	client, err := r.getConnection()
+	if err != nil {
+		return err
+	}
+
+	user, err := client.findUser(username)
+	if err != nil {
+		return err
+	}
+	if user != nil {
+		err := client.deleteUser(user.UID)
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+
+	return r.deleteACLRole(client, username)
+}
+
+// SetCredentials sets the password of an existing user of the cluster,
+// generating a new password unless one is given. No rotation statements are
+// used.
+func (r *RedisEnterprise) SetCredentials(statements dbplugin.Statements, staticUser dbplugin.StaticUserConfig) (username string, password string, err error) {
+	if staticUser.Username == "" {
+		return "", "", fmt.Errorf("username is required to set credentials")
+	}
+	if staticUser.CredentialType != "" && staticUser.CredentialType != dbplugin.CredentialTypePassword {
+		return "", "", dbplugin.ErrUnsupportedCredentialType
+	}
+
+	// Grab the lock
+	r.Lock()
+	defer r.Unlock()
+
+	client, err := r.getConnection()
+	if err != nil {
+		return "", "", err
+	}
+
+	user, err := client.findUser(staticUser.Username)
+	if err != nil {
+		return "", "", err
+	}
+	if user == nil {
+		return "", "", fmt.Errorf("user %q does not exist", staticUser.Username)
+	}
+
+	password = staticUser.Password
+	if password == "" {
+		password, err = r.GeneratePassword()
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	if err := client.setUserPassword(user.UID, password); err != nil {
+		return "", "", err
+	}
+
+	return staticUser.Username, password, nil
+}
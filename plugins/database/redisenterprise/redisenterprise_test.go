@@ -0,0 +1,336 @@
+package redisenterprise
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+)
+
+// fakeCluster implements the parts of the Redis Enterprise REST API used by
+// the plugin.
+type fakeCluster struct {
+	sync.Mutex
+	nextUID  int
+	users    map[int]*reUser
+	roles    map[int]*reRole
+	acls     []reACL
+	database reDatabase
+}
+
+func prepareFakeCluster(t *testing.T) (*fakeCluster, func(), map[string]interface{}) {
+	f := &fakeCluster{
+		nextUID: 100,
+		users: map[int]*reUser{
+			1: {UID: 1, Name: "admin", Email: "admin@example.com", Password: "secret", RoleUIDs: []int{1}},
+			2: {UID: 2, Name: "app", Password: "app", RoleUIDs: []int{2}},
+		},
+		roles: map[int]*reRole{
+			1: {UID: 1, Name: "Admin", Management: "admin"},
+			2: {UID: 2, Name: "db-viewer", Management: "db_viewer"},
+		},
+		acls: []reACL{{UID: 1, Name: "Full Access"}, {UID: 2, Name: "Read-Only"}},
+		database: reDatabase{
+			UID:              1,
+			Name:             "cache",
+			RolesPermissions: []reRolePermission{{RoleUID: 2, RedisACLUID: 2}},
+		},
+	}
+
+	srv := httptest.NewServer(f)
+
+	connectionDetails := map[string]interface{}{
+		"url":      srv.URL,
+		"username": "admin@example.com",
+		"password": "secret",
+		"database": "cache",
+	}
+
+	return f, srv.Close, connectionDetails
+}
+
+func (f *fakeCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	username, password, ok := r.BasicAuth()
+	if !ok || username != "admin@example.com" || password != f.users[1].Password {
+		f.error(w, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/"), "/")
+	var uid int
+	if len(parts) == 2 {
+		uid, _ = strconv.Atoi(parts[1])
+	}
+
+	switch {
+	case parts[0] == "users" && len(parts) == 1 && r.Method == "GET":
+		var users []reUser
+		for _, user := range f.users {
+			users = append(users, *user)
+		}
+		json.NewEncoder(w).Encode(users)
+
+	case parts[0] == "users" && len(parts) == 1 && r.Method == "POST":
+		var user reUser
+		json.NewDecoder(r.Body).Decode(&user)
+		for _, roleUID := range user.RoleUIDs {
+			if f.roles[roleUID] == nil {
+				f.error(w, http.StatusBadRequest, "invalid_role", "role does not exist")
+				return
+			}
+		}
+		f.nextUID++
+		user.UID = f.nextUID
+		f.users[user.UID] = &user
+		json.NewEncoder(w).Encode(user)
+
+	case parts[0] == "users" && len(parts) == 2 && f.users[uid] == nil:
+		f.error(w, http.StatusNotFound, "user_not_exist", "User does not exist")
+
+	case parts[0] == "users" && len(parts) == 2 && r.Method == "PUT":
+		var update reUser
+		json.NewDecoder(r.Body).Decode(&update)
+		f.users[uid].Password = update.Password
+		json.NewEncoder(w).Encode(f.users[uid])
+
+	case parts[0] == "users" && len(parts) == 2 && r.Method == "DELETE":
+		delete(f.users, uid)
+
+	case parts[0] == "roles" && len(parts) == 1 && r.Method == "GET":
+		var roles []reRole
+		for _, role := range f.roles {
+			roles = append(roles, *role)
+		}
+		json.NewEncoder(w).Encode(roles)
+
+	case parts[0] == "roles" && len(parts) == 1 && r.Method == "POST":
+		var role reRole
+		json.NewDecoder(r.Body).Decode(&role)
+		f.nextUID++
+		role.UID = f.nextUID
+		f.roles[role.UID] = &role
+		json.NewEncoder(w).Encode(role)
+
+	case parts[0] == "roles" && len(parts) == 2 && r.Method == "DELETE":
+		for _, permission := range f.database.RolesPermissions {
+			if permission.RoleUID == uid {
+				f.error(w, http.StatusConflict, "role_in_use", "Role is in use by a database")
+				return
+			}
+		}
+		delete(f.roles, uid)
+
+	case parts[0] == "redis_acls" && r.Method == "GET":
+		json.NewEncoder(w).Encode(f.acls)
+
+	case parts[0] == "bdbs" && len(parts) == 1 && r.Method == "GET":
+		json.NewEncoder(w).Encode([]reDatabase{f.database})
+
+	case parts[0] == "bdbs" && len(parts) == 2 && r.Method == "PUT" && uid == f.database.UID:
+		var update reDatabase
+		json.NewDecoder(r.Body).Decode(&update)
+		f.database.RolesPermissions = update.RolesPermissions
+		json.NewEncoder(w).Encode(f.database)
+
+	default:
+		f.error(w, http.StatusNotFound, "not_found", "Not found")
+	}
+}
+
+func (f *fakeCluster) error(w http.ResponseWriter, code int, errorCode, description string) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error_code":  errorCode,
+		"description": description,
+	})
+}
+
+func newTestRedisEnterprise(t *testing.T, connectionDetails map[string]interface{}) *RedisEnterprise {
+	dbRaw, err := New()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	db := dbRaw.(*RedisEnterprise)
+
+	err = db.Initialize(connectionDetails, true)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	return db
+}
+
+func TestRedisEnterprise_Initialize(t *testing.T) {
+	_, cleanup, connectionDetails := prepareFakeCluster(t)
+	defer cleanup()
+
+	db := newTestRedisEnterprise(t, connectionDetails)
+	if !db.producer().Initialized {
+		t.Fatal("Database should be initalized")
+	}
+
+	err := db.Close()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	connectionDetails["database"] = "missing"
+	dbRaw, _ := New()
+	if err := dbRaw.(*RedisEnterprise).Initialize(connectionDetails, true); err == nil {
+		t.Fatal("expected error verifying connection with a missing database")
+	}
+
+	connectionDetails["password"] = "wrong"
+	delete(connectionDetails, "database")
+	dbRaw, _ = New()
+	if err := dbRaw.(*RedisEnterprise).Initialize(connectionDetails, true); err == nil {
+		t.Fatal("expected error verifying connection with a bad password")
+	}
+}
+
+func TestRedisEnterprise_CreateUser_Role(t *testing.T) {
+	f, cleanup, connectionDetails := prepareFakeCluster(t)
+	defer cleanup()
+
+	db := newTestRedisEnterprise(t, connectionDetails)
+
+	usernameConfig := dbplugin.UsernameConfig{
+		DisplayName: "test",
+		RoleName:    "test",
+	}
+
+	// Test with no configured Creation Statememt
+	_, _, err := db.CreateUser(dbplugin.Statements{}, usernameConfig, time.Now().Add(time.Minute))
+	if err == nil {
+		t.Fatal("Expected error when no creation statement is provided")
+	}
+
+	for _, stmt := range []string{`{}`, `{ "role": "db-viewer", "acl": "Read-Only" }`, `{ "role": "missing" }`} {
+		_, _, err := db.CreateUser(dbplugin.Statements{CreationStatements: stmt}, usernameConfig, time.Now().Add(time.Minute))
+		if err == nil {
+			t.Fatalf("expected error for statement %q", stmt)
+		}
+	}
+
+	statements := dbplugin.Statements{
+		CreationStatements: `{ "role": "db-viewer" }`,
+	}
+	username, password, err := db.CreateUser(statements, usernameConfig, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	user, _ := db.producer().client.findUser(username)
+	if user == nil || f.users[user.UID].Password != password || fmt.Sprint(user.RoleUIDs) != "[2]" {
+		t.Fatalf("bad user: %#v", user)
+	}
+
+	err = db.RevokeUser(statements, username)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, ok := f.users[user.UID]; ok {
+		t.Fatal("user was not deleted")
+	}
+	if _, ok := f.roles[2]; !ok {
+		t.Fatal("existing role was deleted")
+	}
+}
+
+func TestRedisEnterprise_CreateUser_ACL(t *testing.T) {
+	f, cleanup, connectionDetails := prepareFakeCluster(t)
+	defer cleanup()
+
+	db := newTestRedisEnterprise(t, connectionDetails)
+
+	usernameConfig := dbplugin.UsernameConfig{
+		DisplayName: "test",
+		RoleName:    "test",
+	}
+
+	statements := dbplugin.Statements{
+		CreationStatements: `{ "acl": "Full Access" }`,
+	}
+	username, _, err := db.CreateUser(statements, usernameConfig, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	role, _ := db.producer().client.findRole(username)
+	if role == nil || role.Management != "none" {
+		t.Fatalf("bad role: %#v", role)
+	}
+	user, _ := db.producer().client.findUser(username)
+	if user == nil || fmt.Sprint(user.RoleUIDs) != fmt.Sprint([]int{role.UID}) {
+		t.Fatalf("bad user: %#v", user)
+	}
+	expected := []reRolePermission{{RoleUID: 2, RedisACLUID: 2}, {RoleUID: role.UID, RedisACLUID: 1}}
+	if fmt.Sprint(f.database.RolesPermissions) != fmt.Sprint(expected) {
+		t.Fatalf("bad permissions: %v", f.database.RolesPermissions)
+	}
+
+	err = db.RevokeUser(statements, username)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(f.users) != 2 || len(f.roles) != 2 {
+		t.Fatalf("user and role were not deleted: %v %v", f.users, f.roles)
+	}
+	if fmt.Sprint(f.database.RolesPermissions) != fmt.Sprint(expected[:1]) {
+		t.Fatalf("bad permissions: %v", f.database.RolesPermissions)
+	}
+
+	// Revoking a missing user succeeds
+	err = db.RevokeUser(statements, username)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Missing ACLs are rejected without leaving a role behind
+	_, _, err = db.CreateUser(dbplugin.Statements{CreationStatements: `{ "acl": "missing" }`}, usernameConfig, time.Now().Add(time.Minute))
+	if err == nil {
+		t.Fatal("expected error for a missing ACL")
+	}
+	if len(f.roles) != 2 {
+		t.Fatalf("bad roles: %v", f.roles)
+	}
+}
+
+func TestRedisEnterprise_SetCredentials(t *testing.T) {
+	f, cleanup, connectionDetails := prepareFakeCluster(t)
+	defer cleanup()
+
+	db := newTestRedisEnterprise(t, connectionDetails)
+
+	username, password, err := db.SetCredentials(dbplugin.Statements{}, dbplugin.StaticUserConfig{Username: "app"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if username != "app" || f.users[2].Password != password {
+		t.Fatalf("bad credentials: %q %q", username, password)
+	}
+
+	// Users are also found by email, which cluster users log in with
+	_, password, err = db.SetCredentials(dbplugin.Statements{}, dbplugin.StaticUserConfig{Username: "admin@example.com"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if f.users[1].Password != password {
+		t.Fatal("password was not set")
+	}
+
+	_, _, err = db.SetCredentials(dbplugin.Statements{}, dbplugin.StaticUserConfig{Username: "missing"})
+	if err == nil {
+		t.Fatal("expected error for a missing user")
+	}
+}
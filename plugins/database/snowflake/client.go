@@ -0,0 +1,268 @@
+package snowflake
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/helper/certutil"
+)
+
+const (
+	// statementTimeout is the number of seconds Snowflake lets a statement
+	// run before cancelling it
+	statementTimeout = 60
+
+	// pollInterval is the time waited between checks of a statement that is
+	// still running
+	pollInterval = 500 * time.Millisecond
+
+	// tokenTTL is the lifetime of the JWTs authenticating requests, which
+	// Snowflake limits to an hour
+	tokenTTL = 59 * time.Minute
+)
+
+// snowflakeClient executes statements through the Snowflake SQL API. Requests
+// are authenticated with a JWT signed by the RSA key pair of the user, as
+// Snowflake deprecates password authentication for services.
+type snowflakeClient struct {
+	apiURL     string
+	account    string
+	username   string
+	privateKey *rsa.PrivateKey
+
+	role      string
+	warehouse string
+	database  string
+
+	httpClient *http.Client
+}
+
+type statementRequest struct {
+	Statement string `json:"statement"`
+	Timeout   int    `json:"timeout"`
+	Role      string `json:"role,omitempty"`
+	Warehouse string `json:"warehouse,omitempty"`
+	Database  string `json:"database,omitempty"`
+}
+
+type statementResponse struct {
+	Code            string `json:"code"`
+	Message         string `json:"message"`
+	StatementHandle string `json:"statementHandle"`
+}
+
+// exec executes a single statement, waiting for it to complete.
+func (c *snowflakeClient) exec(statement string) error {
+	body, err := json.Marshal(&statementRequest{
+		Statement: statement,
+		Timeout:   statementTimeout,
+		Role:      c.role,
+		Warehouse: c.warehouse,
+		Database:  c.database,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do("POST", "/api/v2/statements", body)
+	if err != nil {
+		return err
+	}
+
+	// Statements that do not complete right away are polled for until they
+	// do, or Snowflake times them out
+	for resp.StatusCode == http.StatusAccepted {
+		time.Sleep(pollInterval)
+
+		resp, err = c.do("GET", "/api/v2/statements/"+url.PathEscape(resp.StatementHandle), nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type apiResponse struct {
+	statementResponse
+	StatusCode int
+}
+
+func (c *snowflakeClient) do(method, path string, body []byte) (*apiResponse, error) {
+	token, err := c.token()
+	if err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, c.apiURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Snowflake-Authorization-Token-Type", "KEYPAIR_JWT")
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	result := &apiResponse{StatusCode: resp.StatusCode}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&result.statementResponse)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return result, nil
+	case http.StatusAccepted:
+		if decodeErr != nil || result.StatementHandle == "" {
+			return nil, fmt.Errorf("snowflake did not return the handle of the running statement")
+		}
+		return result, nil
+	}
+
+	if decodeErr != nil || result.Message == "" {
+		return nil, fmt.Errorf("snowflake returned status %d", resp.StatusCode)
+	}
+	if result.Code != "" {
+		return nil, fmt.Errorf("snowflake returned error %s: %s", result.Code, result.Message)
+	}
+	return nil, fmt.Errorf("snowflake returned status %d: %s", resp.StatusCode, result.Message)
+}
+
+// token returns a JWT authenticating the user with its key pair
+func (c *snowflakeClient) token() (string, error) {
+	fingerprint, err := publicKeyFingerprint(&c.privateKey.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	qualifiedUsername := accountIdentifier(c.account) + "." + strings.ToUpper(c.username)
+	now := time.Now()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": qualifiedUsername + "." + fingerprint,
+		"sub": qualifiedUsername,
+		"iat": now.Unix(),
+		"exp": now.Add(tokenTTL).Unix(),
+	})
+
+	return token.SignedString(c.privateKey)
+}
+
+// accountIdentifier returns the account as used in JWTs: in upper case, and
+// without the region and cloud of account locators such as
+// "xy12345.us-east-2.aws".
+func accountIdentifier(account string) string {
+	if i := strings.Index(account, "."); i >= 0 {
+		account = account[:i]
+	}
+	return strings.ToUpper(account)
+}
+
+// defaultAPIURL returns the URL of the SQL API of an account
+func defaultAPIURL(account string) string {
+	return fmt.Sprintf("https://%s.snowflakecomputing.com", strings.ToLower(account))
+}
+
+func newSnowflakeClient(apiURL, account, username string, privateKey *rsa.PrivateKey) *snowflakeClient {
+	httpClient := cleanhttp.DefaultClient()
+	httpClient.Timeout = (statementTimeout + 10) * time.Second
+
+	return &snowflakeClient{
+		apiURL:     strings.TrimSuffix(apiURL, "/"),
+		account:    account,
+		username:   username,
+		privateKey: privateKey,
+		httpClient: httpClient,
+	}
+}
+
+// publicKeyFingerprint returns the fingerprint Snowflake identifies public
+// keys with: the SHA-256 digest of the DER encoded key.
+func publicKeyFingerprint(publicKey *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(der)
+	return "SHA256:" + base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// encodePublicKey returns the public key in the format of the RSA_PUBLIC_KEY
+// user property: the base64 encoded DER key, without the PEM armor.
+func encodePublicKey(publicKey *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(der), nil
+}
+
+// parsePrivateKey parses an unencrypted PEM encoded RSA private key, in either
+// the PKCS #8 or the PKCS #1 format.
+func parsePrivateKey(s string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("private key is not PEM encoded")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("private key is not an RSA key")
+		}
+		return rsaKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %q", block.Type)
+	}
+}
+
+// encodePrivateKey returns the PEM encoded PKCS #8 private key, the format
+// expected by the Snowflake drivers.
+func encodePrivateKey(privateKey *rsa.PrivateKey) (string, error) {
+	der, err := certutil.MarshalPKCS8RSAPrivateKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	})), nil
+}
@@ -0,0 +1,108 @@
+package snowflake
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/vault/plugins/helper/database/connutil"
+	"github.com/mitchellh/mapstructure"
+)
+
+// snowflakeConnectionProducer implements ConnectionProducer and provides a
+// client for the SQL API of a Snowflake account.
+type snowflakeConnectionProducer struct {
+	Account string `json:"account" structs:"account" mapstructure:"account"`
+
+	// Username and PrivateKey are the user Vault connects as, and the PEM
+	// encoded private key of its key pair
+	Username   string `json:"username" structs:"username" mapstructure:"username"`
+	PrivateKey string `json:"private_key" structs:"private_key" mapstructure:"private_key"`
+
+	// Role, Warehouse and Database set the context statements are executed in
+	Role      string `json:"role" structs:"role" mapstructure:"role"`
+	Warehouse string `json:"warehouse" structs:"warehouse" mapstructure:"warehouse"`
+	Database  string `json:"database" structs:"database" mapstructure:"database"`
+
+	// APIURL overrides the URL of the account's SQL API
+	APIURL string `json:"api_url" structs:"api_url" mapstructure:"api_url"`
+
+	Initialized bool
+	Type        string
+	privateKey  *rsa.PrivateKey
+	client      *snowflakeClient
+	sync.Mutex
+}
+
+// Initialize parses connection configuration.
+func (c *snowflakeConnectionProducer) Initialize(conf map[string]interface{}, verifyConnection bool) error {
+	c.Lock()
+	defer c.Unlock()
+
+	err := mapstructure.WeakDecode(conf, c)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(c.Account) == 0:
+		return fmt.Errorf("account cannot be empty")
+	case len(c.Username) == 0:
+		return fmt.Errorf("username cannot be empty")
+	case len(c.PrivateKey) == 0:
+		return fmt.Errorf("private_key cannot be empty")
+	}
+
+	c.privateKey, err = parsePrivateKey(c.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("error parsing private_key: %s", err)
+	}
+
+	if c.APIURL == "" {
+		c.APIURL = defaultAPIURL(c.Account)
+	}
+
+	// Set initialized to true at this point since all fields are set,
+	// and the connection can be established at a later time.
+	c.Initialized = true
+
+	if verifyConnection {
+		client, err := c.Connection()
+		if err != nil {
+			return fmt.Errorf("error verifying connection: %s", err)
+		}
+
+		if err := client.(*snowflakeClient).exec("SELECT 1"); err != nil {
+			return fmt.Errorf("error verifying connection: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// Connection returns the client of the SQL API.
+func (c *snowflakeConnectionProducer) Connection() (interface{}, error) {
+	if !c.Initialized {
+		return nil, connutil.ErrNotInitialized
+	}
+
+	if c.client == nil {
+		c.client = newSnowflakeClient(c.APIURL, c.Account, c.Username, c.privateKey)
+		c.client.role = c.Role
+		c.client.warehouse = c.Warehouse
+		c.client.database = c.Database
+	}
+
+	return c.client, nil
+}
+
+// Close releases the client. The SQL API is stateless, so there is no
+// connection to terminate.
+func (c *snowflakeConnectionProducer) Close() error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.client = nil
+
+	return nil
+}
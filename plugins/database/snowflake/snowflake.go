@@ -0,0 +1,275 @@
+package snowflake
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/plugins"
+	"github.com/hashicorp/vault/plugins/helper/database/connutil"
+	"github.com/hashicorp/vault/plugins/helper/database/credsutil"
+	"github.com/hashicorp/vault/plugins/helper/database/dbutil"
+)
+
+const (
+	snowflakeTypeName = "snowflake"
+
+	defaultSnowflakeRevocationStmts = `
+		DROP USER IF EXISTS "{{name}}";
+	`
+
+	defaultSnowflakePasswordRotationStmts = `
+		ALTER USER "{{name}}" SET PASSWORD = '{{password}}';
+	`
+
+	defaultSnowflakeKeyRotationStmts = `
+		ALTER USER "{{name}}" SET RSA_PUBLIC_KEY = '{{public_key}}';
+	`
+
+	// rsaKeyBits is the size of the RSA keys generated for users
+	rsaKeyBits = 2048
+)
+
+// Snowflake is an implementation of Database interface that executes
+// statements through the Snowflake SQL API.
+type Snowflake struct {
+	connutil.ConnectionProducer
+	credsutil.CredentialsProducer
+}
+
+// New returns a new Snowflake instance
+func New() (interface{}, error) {
+	connProducer := &snowflakeConnectionProducer{}
+	connProducer.Type = snowflakeTypeName
+
+	credsProducer := &credsutil.SQLCredentialsProducer{
+		DisplayNameLen: 15,
+		RoleNameLen:    15,
+		UsernameLen:    255,
+		Separator:      "_",
+	}
+
+	dbType := &Snowflake{
+		ConnectionProducer:  connProducer,
+		CredentialsProducer: credsProducer,
+	}
+	return dbType, nil
+}
+
+// Run runs the plugin server, which creates a Snowflake object for each connection
+func Run(apiTLSConfig *api.TLSConfig) error {
+	plugins.ServeMultiplex(New, apiTLSConfig)
+
+	return nil
+}
+
+// Type returns the TypeName for this backend
+func (s *Snowflake) Type() (string, error) {
+	return snowflakeTypeName, nil
+}
+
+func (s *Snowflake) getConnection() (*snowflakeClient, error) {
+	client, err := s.Connection()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.(*snowflakeClient), nil
+}
+
+// CreateUser executes the creation statements, in which the "name",
+// "password" and "expiration" variables are substituted. The SQL API does not
+// support transactions across statements, so the user is dropped if one of
+// the statements fails.
+func (s *Snowflake) CreateUser(statements dbplugin.Statements, usernameConfig dbplugin.UsernameConfig, expiration time.Time) (username string, password string, err error) {
+	if statements.CreationStatements == "" {
+		return "", "", dbutil.ErrEmptyCreationStatement
+	}
+
+	// Grab the lock
+	s.Lock()
+	defer s.Unlock()
+
+	username, err = s.GenerateUsername(usernameConfig)
+	if err != nil {
+		return "", "", err
+	}
+
+	password, err = s.GeneratePassword()
+	if err != nil {
+		return "", "", err
+	}
+
+	expirationStr, err := s.GenerateExpiration(expiration)
+	if err != nil {
+		return "", "", err
+	}
+
+	client, err := s.getConnection()
+	if err != nil {
+		return "", "", err
+	}
+
+	err = execStatements(client, statements.CreationStatements, map[string]string{
+		"name":       username,
+		"password":   password,
+		"expiration": expirationStr,
+	})
+	if err != nil {
+		// Best effort removal of the partially created user
+		execStatements(client, defaultSnowflakeRevocationStmts, map[string]string{
+			"name": username,
+		})
+		return "", "", err
+	}
+
+	return username, password, nil
+}
+
+// RenewUser executes the renew statements, if any, in which the "name" and
+// "expiration" variables are substituted.
+func (s *Snowflake) RenewUser(statements dbplugin.Statements, username string, expiration time.Time) error {
+	if statements.RenewStatements == "" {
+		return nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	expirationStr, err := s.GenerateExpiration(expiration)
+	if err != nil {
+		return err
+	}
+
+	client, err := s.getConnection()
+	if err != nil {
+		return err
+	}
+
+	return execStatements(client, statements.RenewStatements, map[string]string{
+		"name":       username,
+		"expiration": expirationStr,
+	})
+}
+
+// RevokeUser executes the revocation statements, which default to dropping
+// the user.
+func (s *Snowflake) RevokeUser(statements dbplugin.Statements, username string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	revocationStmts := statements.RevocationStatements
+	if revocationStmts == "" {
+		revocationStmts = defaultSnowflakeRevocationStmts
+	}
+
+	client, err := s.getConnection()
+	if err != nil {
+		return err
+	}
+
+	return execStatements(client, revocationStmts, map[string]string{
+		"name": username,
+	})
+}
+
+// SetCredentials sets the password or, for the rsa_private_key credential
+// type, the RSA public key of an existing user. A new password or key pair is
+// generated unless one is given, and for key pairs the PEM encoded private
+// key is returned in place of the password. The "name", "password" and
+// "public_key" variables are substituted in the rotation statements.
+func (s *Snowflake) SetCredentials(statements dbplugin.Statements, staticUser dbplugin.StaticUserConfig) (username string, password string, err error) {
+	if staticUser.Username == "" {
+		return "", "", fmt.Errorf("username is required to set credentials")
+	}
+
+	// Grab the lock
+	s.Lock()
+	defer s.Unlock()
+
+	rotationStmts := statements.RotationStatements
+	password = staticUser.Password
+	var publicKey string
+
+	switch staticUser.CredentialType {
+	case "", dbplugin.CredentialTypePassword:
+		if rotationStmts == "" {
+			rotationStmts = defaultSnowflakePasswordRotationStmts
+		}
+
+		if password == "" {
+			password, err = s.GeneratePassword()
+			if err != nil {
+				return "", "", err
+			}
+		}
+
+	case dbplugin.CredentialTypeRSAPrivateKey:
+		if rotationStmts == "" {
+			rotationStmts = defaultSnowflakeKeyRotationStmts
+		}
+
+		var privateKey *rsa.PrivateKey
+		if password == "" {
+			privateKey, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+			if err != nil {
+				return "", "", err
+			}
+			password, err = encodePrivateKey(privateKey)
+			if err != nil {
+				return "", "", err
+			}
+		} else {
+			privateKey, err = parsePrivateKey(password)
+			if err != nil {
+				return "", "", err
+			}
+		}
+
+		publicKey, err = encodePublicKey(&privateKey.PublicKey)
+		if err != nil {
+			return "", "", err
+		}
+
+	default:
+		return "", "", dbplugin.ErrUnsupportedCredentialType
+	}
+
+	client, err := s.getConnection()
+	if err != nil {
+		return "", "", err
+	}
+
+	err = execStatements(client, rotationStmts, map[string]string{
+		"name":       staticUser.Username,
+		"password":   password,
+		"public_key": publicKey,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return staticUser.Username, password, nil
+}
+
+// execStatements executes each of the semicolon separated statements, with
+// the variables substituted.
+func execStatements(client *snowflakeClient, statements string, data map[string]string) error {
+	for _, query := range strutil.ParseArbitraryStringSlice(statements, ";") {
+		query = strings.TrimSpace(query)
+		if len(query) == 0 {
+			continue
+		}
+
+		if err := client.exec(dbutil.QueryHelper(query, data)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
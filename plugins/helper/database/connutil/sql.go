@@ -11,6 +11,7 @@ import (
 	_ "github.com/denisenkom/go-mssqldb"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/hashicorp/vault/helper/parseutil"
+	"github.com/hashicorp/vault/plugins/helper/database/dbutil"
 	_ "github.com/lib/pq"
 	"github.com/mitchellh/mapstructure"
 )
@@ -22,6 +23,12 @@ type SQLConnectionProducer struct {
 	MaxIdleConnections       int         `json:"max_idle_connections" structs:"max_idle_connections" mapstructure:"max_idle_connections"`
 	MaxConnectionLifetimeRaw interface{} `json:"max_connection_lifetime" structs:"max_connection_lifetime" mapstructure:"max_connection_lifetime"`
 
+	// Username and Password are substituted for the "{{username}}" and
+	// "{{password}}" templates in the connection URL, which allows Vault to
+	// rotate the password
+	Username string `json:"username" structs:"username" mapstructure:"username"`
+	Password string `json:"password" structs:"password" mapstructure:"password"`
+
 	Type                  string
 	maxConnectionLifetime time.Duration
 	Initialized           bool
@@ -100,7 +107,10 @@ func (c *SQLConnectionProducer) Connection() (interface{}, error) {
 	}
 
 	// Otherwise, attempt to make connection
-	conn := c.ConnectionURL
+	conn := dbutil.QueryHelper(c.ConnectionURL, map[string]string{
+		"username": c.Username,
+		"password": c.Password,
+	})
 
 	// Ensure timezone is set to UTC for all the conenctions
 	if strings.HasPrefix(conn, "postgres://") || strings.HasPrefix(conn, "postgresql://") {
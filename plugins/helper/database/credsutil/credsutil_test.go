@@ -2,7 +2,10 @@ package credsutil
 
 import (
 	"bytes"
+	"regexp"
 	"testing"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
 )
 
 // RandomAlphaNumericOfLen returns a random byte slice of characters [A-Za-z0-9]
@@ -28,3 +31,39 @@ func TestRandomAlphaNumericOfLen(t *testing.T) {
 		t.Fatal("returned byte slice is empty")
 	}
 }
+
+func TestGenerateUsernameFromTemplate(t *testing.T) {
+	config := dbplugin.UsernameConfig{
+		DisplayName: "token-Alice",
+		RoleName:    "readonly",
+	}
+
+	username, err := GenerateUsernameFromTemplate(`{{.RoleName}}_{{.DisplayName | truncate 5 | lowercase | replace "-" "_"}}_{{random 8}}`, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^readonly_token_[A-Za-z0-9]{8}$`).MatchString(username) {
+		t.Fatalf("bad username: %q", username)
+	}
+
+	for _, tpl := range []string{`{{.Missing}}`, `{{random}}`, `{{.RoleName`, `   `} {
+		if _, err := GenerateUsernameFromTemplate(tpl, config); err == nil {
+			t.Fatalf("expected error for template %q", tpl)
+		}
+	}
+
+	// Usernames generated from templates are not truncated
+	scp := &SQLCredentialsProducer{UsernameLen: 16}
+	config.Template = `{{.RoleName}}-{{random 8}}`
+	if _, err := scp.GenerateUsername(config); err == nil {
+		t.Fatal("expected error for username longer than the limit")
+	}
+	config.Template = `{{.RoleName}}-{{random 7}}`
+	username, err = scp.GenerateUsername(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(username) != 16 {
+		t.Fatalf("bad username: %q", username)
+	}
+}
@@ -18,6 +18,21 @@ type SQLCredentialsProducer struct {
 }
 
 func (scp *SQLCredentialsProducer) GenerateUsername(config dbplugin.UsernameConfig) (string, error) {
+	if config.Template != "" {
+		username, err := GenerateUsernameFromTemplate(config.Template, config)
+		if err != nil {
+			return "", err
+		}
+
+		// Truncating could make the usernames collide, so the template must
+		// be fixed instead
+		if scp.UsernameLen > 0 && len(username) > scp.UsernameLen {
+			return "", fmt.Errorf("username %q generated from the template is longer than %d characters", username, scp.UsernameLen)
+		}
+
+		return username, nil
+	}
+
 	displayName := config.DisplayName
 	if scp.DisplayNameLen > 0 && len(displayName) > scp.DisplayNameLen {
 		displayName = displayName[:scp.DisplayNameLen]
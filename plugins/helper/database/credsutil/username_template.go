@@ -0,0 +1,84 @@
+package credsutil
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+)
+
+// usernameTemplateFuncs are the functions available to username templates
+var usernameTemplateFuncs = template.FuncMap{
+	"random": func(n int) (string, error) {
+		s, err := RandomAlphaNumericOfLen(n)
+		return string(s), err
+	},
+	"truncate": func(n int, s string) string {
+		if n >= 0 && len(s) > n {
+			return s[:n]
+		}
+		return s
+	},
+	"lowercase": strings.ToLower,
+	"uppercase": strings.ToUpper,
+	"replace": func(old, new, s string) string {
+		return strings.Replace(s, old, new, -1)
+	},
+	"unix_time": func() int64 {
+		return time.Now().UTC().Unix()
+	},
+	"uuid": uuid.GenerateUUID,
+}
+
+// usernameTemplateData is the data username templates are rendered with
+type usernameTemplateData struct {
+	DisplayName string
+	RoleName    string
+}
+
+// GenerateUsernameFromTemplate renders a username from a Go text/template,
+// such as "{{.RoleName}}_{{.DisplayName | truncate 8}}_{{random 8}}". The
+// template is given the DisplayName and RoleName of the username config, and
+// the following functions:
+//
+//	random N          - N random alphanumeric characters
+//	truncate N S      - S truncated to N characters
+//	lowercase S       - S in lower case
+//	uppercase S       - S in upper case
+//	replace OLD NEW S - S with all occurrences of OLD replaced by NEW
+//	unix_time         - the current Unix time in seconds
+//	uuid              - a random UUID
+func GenerateUsernameFromTemplate(tpl string, config dbplugin.UsernameConfig) (string, error) {
+	t, err := template.New("username").Funcs(usernameTemplateFuncs).Option("missingkey=error").Parse(tpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid username template: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, &usernameTemplateData{
+		DisplayName: config.DisplayName,
+		RoleName:    config.RoleName,
+	}); err != nil {
+		return "", fmt.Errorf("error rendering username template: %s", err)
+	}
+
+	username := strings.TrimSpace(buf.String())
+	if username == "" {
+		return "", fmt.Errorf("username template rendered an empty username")
+	}
+
+	return username, nil
+}
+
+// ValidateUsernameTemplate checks that a username template can be rendered
+func ValidateUsernameTemplate(tpl string) error {
+	_, err := GenerateUsernameFromTemplate(tpl, dbplugin.UsernameConfig{
+		DisplayName: "display-name",
+		RoleName:    "role-name",
+	})
+	return err
+}
@@ -29,3 +29,35 @@ func Serve(plugin interface{}, tlsConfig *api.TLSConfig) {
 	}
 
 }
+
+// ServeMultiplex is like Serve, but takes a factory creating instances of the
+// plugin. An instance is created for each connection made to the plugin, so
+// that a single plugin process can serve many mounts.
+func ServeMultiplex(factory func() (interface{}, error), tlsConfig *api.TLSConfig) {
+	tlsProvider := pluginutil.VaultPluginTLSProvider(tlsConfig)
+
+	err := pluginutil.OptionallyEnableMlock()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	plugin, err := factory()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	switch plugin.(type) {
+	case dbplugin.Database:
+		dbplugin.ServeMultiplex(func() (dbplugin.Database, error) {
+			raw, err := factory()
+			if err != nil {
+				return nil, err
+			}
+			return raw.(dbplugin.Database), nil
+		}, tlsProvider)
+	default:
+		fmt.Println("Unsupported plugin type")
+	}
+}
@@ -74,6 +74,7 @@ func NewACL(policies []*Policy) (*ACL, error) {
 				existingPerms.CapabilitiesBitmap = DenyCapabilityInt
 				existingPerms.AllowedParameters = nil
 				existingPerms.DeniedParameters = nil
+				existingPerms.ControlGroup = nil
 				goto INSERT
 
 			default:
@@ -104,6 +105,10 @@ func NewACL(policies []*Policy) (*ACL, error) {
 				existingPerms.MinWrappingTTL = pc.Permissions.MinWrappingTTL
 			}
 
+			// The factors of the control groups of both policies must be
+			// satisfied
+			existingPerms.ControlGroup = existingPerms.ControlGroup.merge(pc.Permissions.ControlGroup)
+
 			if len(pc.Permissions.AllowedParameters) > 0 {
 				if existingPerms.AllowedParameters == nil {
 					existingPerms.AllowedParameters = pc.Permissions.AllowedParameters
@@ -201,6 +206,23 @@ CHECK:
 	return
 }
 
+// ControlGroup returns the control group which must authorize the requests
+// on the given path, or nil if their responses are released right away
+func (a *ACL) ControlGroup(path string) *ControlGroup {
+	if a.root {
+		return nil
+	}
+
+	raw, ok := a.exactRules.Get(path)
+	if !ok {
+		_, raw, ok = a.globRules.LongestPrefix(path)
+		if !ok {
+			return nil
+		}
+	}
+	return raw.(*Permissions).ControlGroup
+}
+
 // AllowOperation is used to check if the given operation is permitted. The
 // first bool indicates if an op is allowed, the second whether sudo priviliges
 // exist for that op and path.
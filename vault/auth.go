@@ -53,29 +53,39 @@ func (c *Core) enableCredential(entry *MountEntry) error {
 		return fmt.Errorf("backend path must be specified")
 	}
 
+	// Ensure the token backend is a singleton
+	if entry.Type == "token" {
+		return fmt.Errorf("token credential backend cannot be instantiated")
+	}
+
+	return c.enableCredentialInternal(entry)
+}
+
+// enableCredentialInternal enables a credential backend without the check
+// protecting the token store, which namespaces have their own instance of
+func (c *Core) enableCredentialInternal(entry *MountEntry) error {
 	c.authLock.Lock()
 	defer c.authLock.Unlock()
 
 	// Look for matching name
+	path := entry.APIPath()
 	for _, ent := range c.auth.Entries {
 		switch {
 		// Existing is oauth/github/ new is oauth/ or
 		// existing is oauth/ and new is oauth/github/
-		case strings.HasPrefix(ent.Path, entry.Path):
+		case strings.HasPrefix(ent.APIPath(), path):
 			fallthrough
-		case strings.HasPrefix(entry.Path, ent.Path):
+		case strings.HasPrefix(path, ent.APIPath()):
 			return logical.CodedError(409, "path is already in use")
 		}
 	}
 
-	// Ensure the token backend is a singleton
-	if entry.Type == "token" {
-		return fmt.Errorf("token credential backend cannot be instantiated")
-	}
-
-	if match := c.router.MatchingMount(credentialRoutePrefix + entry.Path); match != "" {
+	if match := c.router.MatchingMount(path); match != "" {
 		return logical.CodedError(409, fmt.Sprintf("existing mount at %s", match))
 	}
+	if ns := c.namespaceStore.Resolve(path); ns.ID != entry.Namespace().ID {
+		return logical.CodedError(409, fmt.Sprintf("existing namespace at %s", ns.Path))
+	}
 
 	// Generate a new UUID and view
 	if entry.UUID == "" {
@@ -88,20 +98,12 @@ func (c *Core) enableCredential(entry *MountEntry) error {
 
 	viewPath := credentialBarrierPrefix + entry.UUID + "/"
 	view := NewBarrierView(c.barrier, viewPath)
-	sysView := c.mountEntrySysView(entry)
 
 	// Create the new backend
-	backend, err := c.newCredentialBackend(entry.Type, sysView, view, nil)
+	backend, err := c.newCredentialEntryBackend(entry, view)
 	if err != nil {
 		return err
 	}
-	if backend == nil {
-		return fmt.Errorf("nil backend returned from %q factory", entry.Type)
-	}
-
-	if err := backend.Initialize(); err != nil {
-		return err
-	}
 
 	// Update the auth table
 	newTable := c.auth.shallowClone()
@@ -112,7 +114,6 @@ func (c *Core) enableCredential(entry *MountEntry) error {
 
 	c.auth = newTable
 
-	path := credentialRoutePrefix + entry.Path
 	if err := c.router.Mount(backend, path, entry, view); err != nil {
 		return err
 	}
@@ -126,6 +127,12 @@ func (c *Core) enableCredential(entry *MountEntry) error {
 // disableCredential is used to disable an existing credential backend; the
 // boolean indicates if it existed
 func (c *Core) disableCredential(path string) (bool, error) {
+	return c.disableNamespaceCredential(rootNamespace, path)
+}
+
+// disableNamespaceCredential disables a credential backend of a namespace,
+// at a path relative to "auth/" within the namespace
+func (c *Core) disableNamespaceCredential(ns *NamespaceEntry, path string) (bool, error) {
 	// Ensure we end the path in a slash
 	if !strings.HasSuffix(path, "/") {
 		path += "/"
@@ -136,15 +143,21 @@ func (c *Core) disableCredential(path string) (bool, error) {
 		return true, fmt.Errorf("token credential backend cannot be disabled")
 	}
 
+	return c.disableCredentialInternal(ns.Path + credentialRoutePrefix + path)
+}
+
+// disableCredentialInternal disables the credential backend at the given API
+// path, including the token stores of namespaces
+func (c *Core) disableCredentialInternal(fullPath string) (bool, error) {
 	// Store the view for this backend
-	fullPath := credentialRoutePrefix + path
 	view := c.router.MatchingStorageView(fullPath)
 	if view == nil {
 		return false, fmt.Errorf("no matching backend %s", fullPath)
 	}
+	entry := c.router.MatchingMountEntry(fullPath)
 
 	// Mark the entry as tainted
-	if err := c.taintCredEntry(path); err != nil {
+	if err := c.taintCredEntry(fullPath); err != nil {
 		return true, err
 	}
 
@@ -176,17 +189,25 @@ func (c *Core) disableCredential(path string) (bool, error) {
 		}
 	}
 
+	// Clear the users locked out of the backend
+	if entry != nil {
+		if err := c.userLockoutManager.clearMount(entry.UUID); err != nil {
+			return true, err
+		}
+	}
+
 	// Remove the mount table entry
-	if err := c.removeCredEntry(path); err != nil {
+	if err := c.removeCredEntry(fullPath); err != nil {
 		return true, err
 	}
 	if c.logger.IsInfo() {
-		c.logger.Info("core: disabled credential backend", "path", path)
+		c.logger.Info("core: disabled credential backend", "path", fullPath)
 	}
 	return true, nil
 }
 
-// removeCredEntry is used to remove an entry in the auth table
+// removeCredEntry is used to remove the entry at the given API path in the
+// auth table
 func (c *Core) removeCredEntry(path string) error {
 	c.authLock.Lock()
 	defer c.authLock.Unlock()
@@ -209,7 +230,8 @@ func (c *Core) removeCredEntry(path string) error {
 	return nil
 }
 
-// taintCredEntry is used to mark an entry in the auth table as tainted
+// taintCredEntry is used to mark the entry at the given API path in the auth
+// table as tainted
 func (c *Core) taintCredEntry(path string) error {
 	c.authLock.Lock()
 	defer c.authLock.Unlock()
@@ -277,6 +299,9 @@ func (c *Core) loadCredentials() error {
 			needPersist = true
 		}
 
+		// Resolve the namespaces of the entries
+		c.auth.Entries = c.resolveEntryNamespaces(c.auth.Entries)
+
 		// Upgrade to table-scoped entries
 		for _, entry := range c.auth.Entries {
 			if entry.Table == "" {
@@ -381,37 +406,37 @@ func (c *Core) setupCredentials() error {
 	c.authLock.Lock()
 	defer c.authLock.Unlock()
 
-	for _, entry := range c.auth.Entries {
+	for _, entry := range namespaceOrderedEntries(c.auth.Entries) {
 		// Work around some problematic code that existed in master for a while
 		if strings.HasPrefix(entry.Path, credentialRoutePrefix) {
 			entry.Path = strings.TrimPrefix(entry.Path, credentialRoutePrefix)
 			persistNeeded = true
 		}
 
-		// Create a barrier view using the UUID
+		// The mounts filtered out by the primary of a performance secondary
+		// are not available
+		if c.replicationFilteredMount(entry) {
+			continue
+		}
+
+		// Create a barrier view using the UUID. The replicated mounts of a
+		// performance secondary are written by its primary only.
 		viewPath := credentialBarrierPrefix + entry.UUID + "/"
 		view = NewBarrierView(c.barrier, viewPath)
-		sysView := c.mountEntrySysView(entry)
+		view.readonly = c.perfSecondaryReadOnlyMount(entry)
 
 		// Initialize the backend
-		backend, err = c.newCredentialBackend(entry.Type, sysView, view, nil)
+		backend, err = c.newCredentialEntryBackend(entry, view)
 		if err != nil {
 			c.logger.Error("core: failed to create credential entry", "path", entry.Path, "error", err)
 			return errLoadAuthFailed
 		}
-		if backend == nil {
-			return fmt.Errorf("nil backend returned from %q factory", entry.Type)
-		}
-
-		if err := backend.Initialize(); err != nil {
-			return err
-		}
 
 		// Mount the backend
-		path := credentialRoutePrefix + entry.Path
+		path := entry.APIPath()
 		err = c.router.Mount(backend, path, entry, view)
 		if err != nil {
-			c.logger.Error("core: failed to mount auth entry", "path", entry.Path, "error", err)
+			c.logger.Error("core: failed to mount auth entry", "path", path, "error", err)
 			return errLoadAuthFailed
 		}
 
@@ -421,12 +446,13 @@ func (c *Core) setupCredentials() error {
 		}
 
 		// Check if this is the token store
-		if entry.Type == "token" {
+		if entry.Type == "token" && entry.Namespace().ID == rootNamespaceID {
 			c.tokenStore = backend.(*TokenStore)
 
 			// this is loaded *after* the normal mounts, including cubbyhole
 			c.router.tokenStoreSalt = c.tokenStore.salt
 			c.tokenStore.cubbyholeBackend = c.router.MatchingBackend("cubbyhole/").(*CubbyholeBackend)
+			c.tokenStore.namespaceCubbyhole = c.namespaceCubbyhole
 		}
 	}
 
@@ -446,7 +472,7 @@ func (c *Core) teardownCredentials() error {
 	if c.auth != nil {
 		authTable := c.auth.shallowClone()
 		for _, e := range authTable.Entries {
-			backend := c.router.MatchingBackend(credentialRoutePrefix + e.Path)
+			backend := c.router.MatchingBackend(e.APIPath())
 			if backend != nil {
 				backend.Cleanup()
 			}
@@ -458,6 +484,32 @@ func (c *Core) teardownCredentials() error {
 	return nil
 }
 
+// newCredentialEntryBackend creates and initializes the backend of an auth
+// entry. The token store of a namespace is the one of the root namespace,
+// restricted to the paths available within namespaces.
+func (c *Core) newCredentialEntryBackend(entry *MountEntry, view *BarrierView) (logical.Backend, error) {
+	if entry.Type == "token" && entry.Namespace().ID != rootNamespaceID {
+		if c.tokenStore == nil {
+			return nil, fmt.Errorf("token store of the root namespace is not mounted")
+		}
+		return newNamespaceBackend(c.tokenStore, namespaceTokenPaths), nil
+	}
+
+	sysView := c.mountEntrySysView(entry)
+	backend, err := c.newCredentialBackend(entry.Type, sysView, view, nil)
+	if err != nil {
+		return nil, err
+	}
+	if backend == nil {
+		return nil, fmt.Errorf("nil backend returned from %q factory", entry.Type)
+	}
+
+	if err := backend.Initialize(); err != nil {
+		return nil, err
+	}
+	return backend, nil
+}
+
 // newCredentialBackend is used to create and configure a new credential backend by name
 func (c *Core) newCredentialBackend(
 	t string, sysView logical.SystemView, view logical.Storage, conf map[string]string) (logical.Backend, error) {
@@ -54,6 +54,10 @@ const (
 	masterKeyPath = "core/master"
 )
 
+// BarrierWriteObserver is called with the key and the entry of every write
+// through the barrier. The entry is nil if the key was deleted.
+type BarrierWriteObserver func(key string, entry *Entry)
+
 // SecurityBarrier is a critical component of Vault. It is used to wrap
 // an untrusted physical backend and provide a single point of encryption,
 // decryption and checksum verification. The goal is to ensure that any
@@ -127,6 +131,17 @@ type SecurityBarrier interface {
 	// For replication we must send over the keyring, so this must be available
 	Keyring() (*Keyring, error)
 
+	// SetReadOnly makes the writes through the barrier fail with
+	// logical.ErrReadOnly. This is used by the performance standbys, which
+	// read the storage written by the active node.
+	SetReadOnly(readOnly bool)
+
+	// SetWriteObserver registers a function which is called after every
+	// write through the barrier, with a nil entry for the deletions. The
+	// replication uses it to track the updated keys. A nil function removes
+	// the observer.
+	SetWriteObserver(observer BarrierWriteObserver)
+
 	// SecurityBarrier must provide the storage APIs
 	BarrierStorage
 
@@ -7,12 +7,15 @@ import (
 	"crypto/subtle"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/armon/go-metrics"
 	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/physical"
 )
 
@@ -61,16 +64,27 @@ type AESGCMBarrier struct {
 	// future versioning of barrier implementations. It's var instead
 	// of const to allow for testing
 	currentAESGCMVersionByte byte
+
+	// randReader is the source of the randomness of the generated keys
+	randReader io.Reader
+
+	// readOnly is set while the writes are rejected, see SetReadOnly. It is
+	// accessed atomically.
+	readOnly uint32
+
+	// observer is called after the writes, see SetWriteObserver
+	observer BarrierWriteObserver
 }
 
 // NewAESGCMBarrier is used to construct a new barrier that uses
 // the provided physical backend for storage.
 func NewAESGCMBarrier(physical physical.Backend) (*AESGCMBarrier, error) {
 	b := &AESGCMBarrier{
-		backend: physical,
-		sealed:  true,
-		cache:   make(map[uint32]cipher.AEAD),
+		backend:                  physical,
+		sealed:                   true,
+		cache:                    make(map[uint32]cipher.AEAD),
 		currentAESGCMVersionByte: byte(AESGCMVersion2),
+		randReader:               rand.Reader,
 	}
 	return b, nil
 }
@@ -194,7 +208,7 @@ func (b *AESGCMBarrier) persistKeyring(keyring *Keyring) error {
 func (b *AESGCMBarrier) GenerateKey() ([]byte, error) {
 	// Generate a 256bit key
 	buf := make([]byte, 2*aes.BlockSize)
-	_, err := rand.Read(buf)
+	_, err := io.ReadFull(b.randReader, buf)
 	return buf, err
 }
 
@@ -270,6 +284,38 @@ func (b *AESGCMBarrier) ReloadKeyring() error {
 	return nil
 }
 
+// verifyKeyring checks that an encrypted keyring, such as the keyring held
+// by a storage snapshot, can be decrypted with the current master key
+func (b *AESGCMBarrier) verifyKeyring(value []byte) error {
+	b.l.RLock()
+	defer b.l.RUnlock()
+	if b.sealed {
+		return ErrBarrierSealed
+	}
+
+	gcm, err := b.aeadFromKey(b.keyring.MasterKey())
+	if err != nil {
+		return err
+	}
+	if len(value) < 5+gcm.NonceSize()+gcm.Overhead() {
+		return ErrBarrierInvalidKey
+	}
+
+	plain, err := b.decrypt(keyringPath, gcm, value)
+	defer memzero(plain)
+	if err != nil {
+		if strings.Contains(err.Error(), "message authentication failed") {
+			return ErrBarrierInvalidKey
+		}
+		return err
+	}
+
+	if _, err := DeserializeKeyring(plain); err != nil {
+		return fmt.Errorf("keyring deserialization failed: %v", err)
+	}
+	return nil
+}
+
 // ReloadMasterKey is used to re-read the underlying masterkey.
 // This is used for HA deployments to ensure the latest master key
 // is available for keyring reloading.
@@ -634,6 +680,9 @@ func (b *AESGCMBarrier) Put(entry *Entry) error {
 	if b.sealed {
 		return ErrBarrierSealed
 	}
+	if atomic.LoadUint32(&b.readOnly) == 1 {
+		return logical.ErrReadOnly
+	}
 
 	term := b.keyring.ActiveTerm()
 	primary, err := b.aeadForTerm(term)
@@ -645,7 +694,14 @@ func (b *AESGCMBarrier) Put(entry *Entry) error {
 		Key:   entry.Key,
 		Value: b.encrypt(entry.Key, term, primary, entry.Value),
 	}
-	return b.backend.Put(pe)
+	if err := b.backend.Put(pe); err != nil {
+		return err
+	}
+
+	if b.observer != nil {
+		b.observer(entry.Key, entry)
+	}
+	return nil
 }
 
 // Get is used to fetch an entry
@@ -687,8 +743,18 @@ func (b *AESGCMBarrier) Delete(key string) error {
 	if b.sealed {
 		return ErrBarrierSealed
 	}
+	if atomic.LoadUint32(&b.readOnly) == 1 {
+		return logical.ErrReadOnly
+	}
 
-	return b.backend.Delete(key)
+	if err := b.backend.Delete(key); err != nil {
+		return err
+	}
+
+	if b.observer != nil {
+		b.observer(key, nil)
+	}
+	return nil
 }
 
 // List is used ot list all the keys under a given
@@ -704,6 +770,23 @@ func (b *AESGCMBarrier) List(prefix string) ([]string, error) {
 	return b.backend.List(prefix)
 }
 
+// SetReadOnly makes the writes through the barrier fail with
+// logical.ErrReadOnly
+func (b *AESGCMBarrier) SetReadOnly(readOnly bool) {
+	var value uint32
+	if readOnly {
+		value = 1
+	}
+	atomic.StoreUint32(&b.readOnly, value)
+}
+
+// SetWriteObserver registers the function called after every write
+func (b *AESGCMBarrier) SetWriteObserver(observer BarrierWriteObserver) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	b.observer = observer
+}
+
 // aeadForTerm returns the AES-GCM AEAD for the given term
 func (b *AESGCMBarrier) aeadForTerm(term uint32) (cipher.AEAD, error) {
 	// Check for the keyring
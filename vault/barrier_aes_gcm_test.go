@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/physical"
 	log "github.com/mgutz/logxi/v1"
 )
@@ -460,3 +461,29 @@ func TestEncrypt_BarrierEncryptor(t *testing.T) {
 		t.Fatalf("bad: %s", plain)
 	}
 }
+
+func TestAESGCMBarrier_ReadOnly(t *testing.T) {
+	_, b, _ := mockBarrier(t)
+
+	entry := &Entry{Key: "test", Value: []byte("test")}
+	if err := b.Put(entry); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	b.SetReadOnly(true)
+	if err := b.Put(entry); err != logical.ErrReadOnly {
+		t.Fatalf("err: %v", err)
+	}
+	if err := b.Delete("test"); err != logical.ErrReadOnly {
+		t.Fatalf("err: %v", err)
+	}
+	out, err := b.Get("test")
+	if err != nil || out == nil {
+		t.Fatalf("err: %v out: %#v", err, out)
+	}
+
+	b.SetReadOnly(false)
+	if err := b.Delete("test"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
@@ -338,42 +338,52 @@ func testCluster_ForwardRequests(t *testing.T, c *TestClusterCore, remoteCoreID
 		t.Fatal("core should not be leader")
 	}
 
-	bodBuf := bytes.NewReader([]byte(`{ "foo": "bar", "zip": "zap" }`))
-	req, err := http.NewRequest("PUT", "https://pushit.real.good:9281/"+remoteCoreID, bodBuf)
-	if err != nil {
-		t.Fatal(err)
-	}
-	req.Header.Add("X-Vault-Token", c.Root)
-
-	statusCode, header, respBytes, err := c.ForwardRequest(req)
-	if err != nil {
-		t.Fatalf("err: %v", err)
+	c.requestForwardingConnectionLock.RLock()
+	poolSize := len(c.rpcForwardingClients)
+	c.requestForwardingConnectionLock.RUnlock()
+	if poolSize != requestForwardingPoolSize {
+		t.Fatalf("expected %d pooled forwarding clients, got %d", requestForwardingPoolSize, poolSize)
 	}
 
-	if header == nil {
-		t.Fatal("err: expected at least a content-type header")
-	}
-	if header.Get("Content-Type") != "application/json" {
-		t.Fatalf("bad content-type: %s", header.Get("Content-Type"))
-	}
+	// Go through all of the pooled connections
+	for i := 0; i <= poolSize; i++ {
+		bodBuf := bytes.NewReader([]byte(`{ "foo": "bar", "zip": "zap" }`))
+		req, err := http.NewRequest("PUT", "https://pushit.real.good:9281/"+remoteCoreID, bodBuf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("X-Vault-Token", c.Root)
 
-	body := string(respBytes)
+		statusCode, header, respBytes, err := c.ForwardRequest(req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
 
-	if body != remoteCoreID {
-		t.Fatalf("expected %s, got %s", remoteCoreID, body)
-	}
-	switch body {
-	case "core1":
-		if statusCode != 201 {
-			t.Fatal("bad response")
+		if header == nil {
+			t.Fatal("err: expected at least a content-type header")
 		}
-	case "core2":
-		if statusCode != 202 {
-			t.Fatal("bad response")
+		if header.Get("Content-Type") != "application/json" {
+			t.Fatalf("bad content-type: %s", header.Get("Content-Type"))
 		}
-	case "core3":
-		if statusCode != 203 {
-			t.Fatal("bad response")
+
+		body := string(respBytes)
+
+		if body != remoteCoreID {
+			t.Fatalf("expected %s, got %s", remoteCoreID, body)
+		}
+		switch body {
+		case "core1":
+			if statusCode != 201 {
+				t.Fatal("bad response")
+			}
+		case "core2":
+			if statusCode != 202 {
+				t.Fatal("bad response")
+			}
+		case "core3":
+			if statusCode != 203 {
+				t.Fatal("bad response")
+			}
 		}
 	}
 }
@@ -0,0 +1,361 @@
+package vault
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/parseutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// controlGroupDefaultTTL is the TTL of the wrapping tokens of the
+	// requests under a control group without a TTL
+	controlGroupDefaultTTL = 24 * time.Hour
+
+	// controlGroupCubbyholePath is where a control group request is stored,
+	// in the cubbyhole of the wrapping token holding its response
+	controlGroupCubbyholePath = "cubbyhole/control-group"
+)
+
+var (
+	// controlGroupExemptPaths are the paths whose requests are never under a
+	// control group, since they are used to authorize and release the
+	// responses of the other requests
+	controlGroupExemptPaths = []string{
+		"sys/wrapping/",
+		"sys/control-group/",
+	}
+
+	// controlGroupUnwrapPaths are the paths which release the response held
+	// by a wrapping token
+	controlGroupUnwrapPaths = []string{
+		"sys/wrapping/unwrap",
+		"sys/wrapping/rewrap",
+		"cubbyhole/response",
+	}
+)
+
+// ControlGroup requires the requests on the paths of a policy to be
+// authorized before their response is released. The response is wrapped,
+// and the wrapping token cannot be unwrapped until each factor got its
+// approvals.
+type ControlGroup struct {
+	TTL     time.Duration         `json:"ttl"`
+	Factors []*ControlGroupFactor `json:"factors"`
+}
+
+// ControlGroupFactor is satisfied once Approvals members of one of the
+// external groups GroupNames authorized the request
+type ControlGroupFactor struct {
+	Name       string   `json:"name"`
+	GroupNames []string `json:"group_names"`
+	Approvals  int      `json:"approvals"`
+}
+
+// parseControlGroup builds a control group from the policy syntax
+func parseControlGroup(hcl *ControlGroupHCL) (*ControlGroup, error) {
+	controlGroup := &ControlGroup{
+		TTL: controlGroupDefaultTTL,
+	}
+	if hcl.TTL != nil {
+		ttl, err := parseutil.ParseDurationSecond(hcl.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl: %v", err)
+		}
+		if ttl > 0 {
+			controlGroup.TTL = ttl
+		}
+	}
+
+	if len(hcl.Factors) == 0 {
+		return nil, fmt.Errorf("at least one factor must be specified")
+	}
+	for name, factor := range hcl.Factors {
+		if factor == nil || factor.Identity == nil || len(factor.Identity.GroupNames) == 0 {
+			return nil, fmt.Errorf("factor %q: identity group_names must be specified", name)
+		}
+		approvals := factor.Identity.Approvals
+		if approvals < 0 {
+			return nil, fmt.Errorf("factor %q: approvals cannot be negative", name)
+		}
+		if approvals == 0 {
+			approvals = 1
+		}
+		controlGroup.Factors = append(controlGroup.Factors, &ControlGroupFactor{
+			Name:       name,
+			GroupNames: factor.Identity.GroupNames,
+			Approvals:  approvals,
+		})
+	}
+	sort.Slice(controlGroup.Factors, func(i, j int) bool {
+		return controlGroup.Factors[i].Name < controlGroup.Factors[j].Name
+	})
+	return controlGroup, nil
+}
+
+func (g *ControlGroup) clone() *ControlGroup {
+	if g == nil {
+		return nil
+	}
+	return &ControlGroup{
+		TTL:     g.TTL,
+		Factors: append([]*ControlGroupFactor(nil), g.Factors...),
+	}
+}
+
+// merge returns the control group requiring the factors of both groups, with
+// the shortest TTL
+func (g *ControlGroup) merge(other *ControlGroup) *ControlGroup {
+	switch {
+	case other == nil:
+		return g
+	case g == nil:
+		return other.clone()
+	}
+
+	merged := g.clone()
+	merged.Factors = append(merged.Factors, other.Factors...)
+	if other.TTL < merged.TTL {
+		merged.TTL = other.TTL
+	}
+	return merged
+}
+
+// controlGroupRequest is a request waiting for the approvals of its control
+// group
+type controlGroupRequest struct {
+	Path                 string                  `json:"path"`
+	RequesterAccessor    string                  `json:"requester_accessor"`
+	RequesterDisplayName string                  `json:"requester_display_name"`
+	RequesterEntity      string                  `json:"requester_entity"`
+	CreationTime         time.Time               `json:"creation_time"`
+	ControlGroup         *ControlGroup           `json:"control_group"`
+	Approvals            []*controlGroupApproval `json:"approvals"`
+}
+
+// controlGroupApproval is the authorization of a request by a member of the
+// groups of a factor
+type controlGroupApproval struct {
+	Factor      string    `json:"factor"`
+	Accessor    string    `json:"accessor"`
+	DisplayName string    `json:"display_name"`
+	Entity      string    `json:"entity"`
+	Time        time.Time `json:"time"`
+}
+
+// approved returns whether each factor got its approvals
+func (r *controlGroupRequest) approved() bool {
+	for _, factor := range r.ControlGroup.Factors {
+		if r.factorApprovals(factor.Name) < factor.Approvals {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *controlGroupRequest) factorApprovals(name string) int {
+	count := 0
+	for _, approval := range r.Approvals {
+		if approval.Factor == name {
+			count++
+		}
+	}
+	return count
+}
+
+// authorize records the approval of a token for each factor it can approve
+// which still needs approvals, and returns whether it approved any. Each
+// entity approves a factor once, whichever of its tokens it uses; tokens
+// without an entity are told apart by their accessor.
+func (r *controlGroupRequest) authorize(te *TokenEntry) bool {
+	authorized := false
+	for _, factor := range r.ControlGroup.Factors {
+		if r.factorApprovals(factor.Name) >= factor.Approvals {
+			continue
+		}
+		member := false
+		for _, group := range factor.GroupNames {
+			if strutil.StrListContains(te.ExternalGroups, group) {
+				member = true
+				break
+			}
+		}
+		if !member {
+			continue
+		}
+		approvedBefore := false
+		for _, approval := range r.Approvals {
+			if approval.Factor != factor.Name {
+				continue
+			}
+			if te.EntityName != "" && approval.Entity == te.EntityName ||
+				te.EntityName == "" && approval.Accessor == te.Accessor {
+				approvedBefore = true
+				break
+			}
+		}
+		if approvedBefore {
+			continue
+		}
+
+		r.Approvals = append(r.Approvals, &controlGroupApproval{
+			Factor:      factor.Name,
+			Accessor:    te.Accessor,
+			DisplayName: te.DisplayName,
+			Entity:      te.EntityName,
+			Time:        time.Now(),
+		})
+		authorized = true
+	}
+	return authorized
+}
+
+// requestControlGroup returns the control group which must authorize a
+// request allowed by an ACL, if any
+func (c *Core) requestControlGroup(acl *ACL, req *logical.Request) *ControlGroup {
+	for _, prefix := range controlGroupExemptPaths {
+		if strings.HasPrefix(req.Path, prefix) {
+			return nil
+		}
+	}
+	return acl.ControlGroup(req.Path)
+}
+
+// createControlGroupRequest records a request under a control group in the
+// cubbyhole of the wrapping token holding its response
+func (c *Core) createControlGroupRequest(req *logical.Request, auth *logical.Auth, wrappingToken string, controlGroup *ControlGroup) error {
+	request := &controlGroupRequest{
+		Path:         req.Path,
+		CreationTime: time.Now(),
+		ControlGroup: controlGroup,
+	}
+	if auth != nil {
+		request.RequesterAccessor = auth.Accessor
+		request.RequesterDisplayName = auth.DisplayName
+	}
+
+	// The accessor is only set on the requests coming through the API, and
+	// the entity is only known from the token
+	te, err := c.tokenStore.Lookup(req.ClientToken)
+	if err != nil {
+		return err
+	}
+	if te != nil {
+		if request.RequesterAccessor == "" {
+			request.RequesterAccessor = te.Accessor
+		}
+		request.RequesterEntity = te.EntityName
+	}
+	return c.persistControlGroupRequest(wrappingToken, request)
+}
+
+func (c *Core) persistControlGroupRequest(wrappingToken string, request *controlGroupRequest) error {
+	encoded, err := jsonutil.EncodeJSON(request)
+	if err != nil {
+		return err
+	}
+	resp, err := c.router.Route(&logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        controlGroupCubbyholePath,
+		ClientToken: wrappingToken,
+		Data: map[string]interface{}{
+			"request": string(encoded),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if resp != nil && resp.IsError() {
+		return resp.Error()
+	}
+	return nil
+}
+
+// controlGroupRequest returns the control group request held by a wrapping
+// token, or nil if its response is not under a control group
+func (c *Core) controlGroupRequest(wrappingToken string) (*controlGroupRequest, error) {
+	resp, err := c.router.Route(&logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        controlGroupCubbyholePath,
+		ClientToken: wrappingToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.Data == nil {
+		return nil, nil
+	}
+	encoded, ok := resp.Data["request"].(string)
+	if !ok {
+		return nil, fmt.Errorf("could not decode the control group request")
+	}
+
+	var request controlGroupRequest
+	if err := jsonutil.DecodeJSON([]byte(encoded), &request); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// controlGroupWrappingToken returns the wrapping token of a control group
+// request from its accessor
+func (c *Core) controlGroupWrappingToken(accessor string) (string, error) {
+	aEntry, err := c.tokenStore.lookupByAccessor(accessor, false)
+	if err != nil || aEntry.TokenID == "" {
+		return "", fmt.Errorf("invalid accessor")
+	}
+	return aEntry.TokenID, nil
+}
+
+// checkControlGroupUnwrap rejects the unwrapping of the response of a
+// request whose control group didn't approve it yet. The wrapping token is
+// not used, so it can be unwrapped once the request is authorized.
+func (c *Core) checkControlGroupUnwrap(req *logical.Request) error {
+	if !strutil.StrListContains(controlGroupUnwrapPaths, req.Path) {
+		return nil
+	}
+
+	token := req.ClientToken
+	if dataToken, ok := req.Data["token"].(string); ok && dataToken != "" && req.Path != "cubbyhole/response" {
+		token = dataToken
+	}
+
+	request, err := c.controlGroupRequest(token)
+	if err != nil {
+		// Invalid tokens are rejected by the unwrapping itself
+		return nil
+	}
+	if request != nil && !request.approved() {
+		return fmt.Errorf("request is not authorized by its control group yet")
+	}
+	return nil
+}
+
+// controlGroupStatus returns the status of a control group request as
+// response data
+func controlGroupStatus(request *controlGroupRequest) map[string]interface{} {
+	approvals := make([]map[string]interface{}, 0, len(request.Approvals))
+	for _, approval := range request.Approvals {
+		approvals = append(approvals, map[string]interface{}{
+			"factor":       approval.Factor,
+			"accessor":     approval.Accessor,
+			"display_name": approval.DisplayName,
+			"entity":       approval.Entity,
+			"time":         approval.Time.Format(time.RFC3339Nano),
+		})
+	}
+	return map[string]interface{}{
+		"approved":               request.approved(),
+		"request_path":           request.Path,
+		"requester_accessor":     request.RequesterAccessor,
+		"requester_display_name": request.RequesterDisplayName,
+		"requester_entity":       request.RequesterEntity,
+		"creation_time":          request.CreationTime.Format(time.RFC3339Nano),
+		"authorizations":         approvals,
+	}
+}
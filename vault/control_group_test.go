@@ -0,0 +1,218 @@
+package vault
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestControlGroup_authorize(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	mounts := map[string][]string{
+		"requesters": {"devs"},
+		"approvers":  {"managers"},
+		"approvers2": {"managers"},
+	}
+	noops := make(map[string]*NoopBackend, len(mounts))
+	for path := range mounts {
+		noop := &NoopBackend{
+			Login: []string{"login"},
+		}
+		noops[path] = noop
+		c.credentialBackends["noop-"+path] = func(conf *logical.BackendConfig) (logical.Backend, error) {
+			return noop, nil
+		}
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/"+path)
+		req.Data["type"] = "noop-" + path
+		req.ClientToken = root
+		if _, err := c.HandleRequest(req); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	for name, rules := range map[string]string{
+		"reader": `
+path "secret/foo" {
+	capabilities = ["read"]
+	control_group = {
+		ttl = "1h"
+		factor "managers" {
+			identity {
+				group_names = ["managers"]
+				approvals = 2
+			}
+		}
+	}
+}`,
+		"approver": `
+path "sys/control-group/*" {
+	capabilities = ["update"]
+}`,
+	} {
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/policy/"+name)
+		req.Data["rules"] = rules
+		req.ClientToken = root
+		if _, err := c.HandleRequest(req); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	for name, data := range map[string]map[string]interface{}{
+		"devs":     {"policies": "reader,approver", "aliases": "requesters:devs"},
+		"managers": {"policies": "approver", "aliases": []string{"approvers:managers", "approvers2:managers", "requesters:devs"}},
+	} {
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/groups/external/"+name)
+		req.Data = data
+		req.ClientToken = root
+		if resp, err := c.HandleRequest(req); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v resp: %#v", err, resp)
+		}
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.Data["value"] = "bar"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	login := func(path string) string {
+		// Logins modify the auth of the response, so each gets its own
+		noops[path].Response = &logical.Response{
+			Auth: &logical.Auth{
+				GroupAliases: mounts[path],
+				DisplayName:  path,
+			},
+		}
+		resp, err := c.HandleRequest(&logical.Request{Path: "auth/" + path + "/login"})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return resp.Auth.ClientToken
+	}
+	requester := login("requesters")
+	approvers := []string{login("approvers"), login("approvers"), login("approvers2")}
+
+	// The response of the request is wrapped with the TTL of the control
+	// group
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+	req.ClientToken = requester
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.WrapInfo == nil || resp.WrapInfo.Accessor == "" || resp.WrapInfo.TTL != time.Hour || resp.Data != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	wrappingToken, accessor := resp.WrapInfo.Token, resp.WrapInfo.Accessor
+
+	unwrap := func() (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/wrapping/unwrap")
+		req.ClientToken = wrappingToken
+		return c.HandleRequest(req)
+	}
+	authorize := func(token string) (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/control-group/authorize")
+		req.Data["accessor"] = accessor
+		req.ClientToken = token
+		return c.HandleRequest(req)
+	}
+
+	// The response cannot be released before the request is authorized
+	for _, path := range []string{"sys/wrapping/unwrap", "cubbyhole/response"} {
+		req := logical.TestRequest(t, logical.UpdateOperation, path)
+		if path == "cubbyhole/response" {
+			req.Operation = logical.ReadOperation
+		}
+		req.ClientToken = wrappingToken
+		if _, err := c.HandleRequest(req); err == nil {
+			t.Fatalf("expected error releasing the response through %q", path)
+		}
+	}
+
+	// Requesters cannot authorize their own requests, even with another
+	// token of their entity, and approvers count once per entity
+	for _, token := range []string{requester, login("requesters")} {
+		if _, err := authorize(token); !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+			t.Fatalf("expected permission denied, got: %v", err)
+		}
+	}
+	resp, err = authorize(approvers[0])
+	if err != nil || resp.Data["approved"] != false {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+	for _, token := range approvers[:2] {
+		if _, err := authorize(token); !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+			t.Fatalf("expected permission denied, got: %v", err)
+		}
+	}
+	if _, err := unwrap(); err == nil {
+		t.Fatal("expected error unwrapping a partially authorized request")
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/control-group/request")
+	req.Data["accessor"] = accessor
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["approved"] != false || resp.Data["request_path"] != "secret/foo" ||
+		resp.Data["requester_display_name"] != "requesters-requesters" ||
+		resp.Data["requester_entity"] == "" ||
+		len(resp.Data["authorizations"].([]map[string]interface{})) != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp, err = authorize(approvers[2])
+	if err != nil || resp.Data["approved"] != true {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+
+	resp, err = unwrap()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.Data[logical.HTTPRawBody] == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestControlGroup_parse(t *testing.T) {
+	policy, err := Parse(`
+path "secret/*" {
+	capabilities = ["read"]
+	control_group = {
+		factor "ops" {
+			identity {
+				group_names = ["ops", "sre"]
+			}
+		}
+		factor "managers" {
+			identity {
+				group_names = ["managers"]
+				approvals = 2
+			}
+		}
+	}
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cg := policy.Paths[0].Permissions.ControlGroup
+	if cg == nil || cg.TTL != controlGroupDefaultTTL || len(cg.Factors) != 2 ||
+		cg.Factors[0].Name != "managers" || cg.Factors[0].Approvals != 2 ||
+		cg.Factors[1].Name != "ops" || cg.Factors[1].Approvals != 1 || len(cg.Factors[1].GroupNames) != 2 {
+		t.Fatalf("bad control group: %#v", cg)
+	}
+
+	for _, rules := range []string{
+		`path "secret/*" { capabilities = ["read"] control_group = { ttl = "1h" } }`,
+		`path "secret/*" { capabilities = ["read"] control_group = { factor "ops" { identity { approvals = 1 } } } }`,
+	} {
+		if _, err := Parse(rules); err == nil {
+			t.Fatalf("expected error parsing %q", rules)
+		}
+	}
+}
@@ -3,14 +3,17 @@ package vault
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/rand"
 	"crypto/subtle"
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -24,6 +27,7 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/cidrutil"
 	"github.com/hashicorp/vault/helper/consts"
 	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/helper/jsonutil"
@@ -32,6 +36,7 @@ import (
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/physical"
 	"github.com/hashicorp/vault/shamir"
+	"github.com/hashicorp/vault/vault/seal"
 	cache "github.com/patrickmn/go-cache"
 )
 
@@ -82,6 +87,14 @@ var (
 	// is attempted to be unsealed.
 	ErrNotInit = errors.New("Vault is not initialized")
 
+	// ErrSealMigrationPending is returned when unsealing without migrating
+	// while the configured seal differs from the seal of the stored data.
+	ErrSealMigrationPending = errors.New("seal migration is pending, unseal with the migrate option")
+
+	// ErrNoSealMigration is returned when unsealing with the migrate option
+	// while no seal migration is pending.
+	ErrNoSealMigration = errors.New("no seal migration is pending")
+
 	// ErrInternalError is returned when we don't want to leak
 	// any information about an internal error
 	ErrInternalError = errors.New("internal error")
@@ -164,12 +177,25 @@ type Core struct {
 	// physical backend is the un-trusted backend with durable data
 	physical physical.Backend
 
+	// raftStorage is set when the physical backend is the integrated raft
+	// storage, which is managed through sys/storage/raft
+	raftStorage *physical.RaftBackend
+
 	// Our Seal, for seal configuration information
 	seal Seal
 
+	// migrationTargetSeal is the configured seal while the stored data is
+	// still sealed by seal, until unsealing with the migrate option migrates
+	// it. It is nil when no seal migration is pending.
+	migrationTargetSeal Seal
+
 	// barrier is the security barrier wrapping the physical backend
 	barrier SecurityBarrier
 
+	// secureRandomReader is the source of randomness of the critical keys,
+	// such as the master key and the root tokens
+	secureRandomReader io.Reader
+
 	// router is responsible for managing the mount points for logical backends.
 	router *Router
 
@@ -191,6 +217,13 @@ type Core struct {
 	standbyStopCh    chan struct{}
 	manualStepDownCh chan struct{}
 
+	// perfStandbyEnabled is set when the standby serves the read requests.
+	// perfStandby is set while it does so, and is accessed atomically.
+	// perfStandbyTables is the digest of the tables it loaded.
+	perfStandbyEnabled bool
+	perfStandby        uint32
+	perfStandbyTables  []byte
+
 	// unlockInfo has the keys provided to Unseal until the threshold number of parts is available, as well as the operation nonce
 	unlockInfo *unlockInformation
 
@@ -326,18 +359,37 @@ type Core struct {
 	rpcClientConnContext context.Context
 	// The function for canceling the client connection
 	rpcClientConnCancelFunc context.CancelFunc
-	// The grpc ClientConn for RPC calls
-	rpcClientConn *grpc.ClientConn
-	// The grpc forwarding client
-	rpcForwardingClient *forwardingClient
+	// The pool of grpc ClientConns for RPC calls
+	rpcClientConns []*grpc.ClientConn
+	// The grpc forwarding clients, one per pooled connection
+	rpcForwardingClients []*forwardingClient
+	// The index of the forwarding client to use next, incremented atomically
+	rpcForwardingClientIndex uint32
 
 	// CORS Information
 	corsConfig *CORSConfig
 
+	// estConfig configures the PKI mount serving EST at the standard path
+	estConfig     *ESTConfig
+	estConfigLock sync.RWMutex
+
 	// replicationState keeps the current replication state cached for quick
 	// lookup
 	replicationState consts.ReplicationState
 
+	// perfReplication and drReplication are the states of the performance
+	// and DR replication
+	perfReplication *replicationSet
+	drReplication   *replicationSet
+
+	// replicationTransportFactory replaces the API transport of the
+	// secondaries in tests
+	replicationTransportFactory func(*replicationConfig, string) (replicationTransport, error)
+
+	// controlGroupLock serializes the authorizations of the requests under
+	// a control group
+	controlGroupLock sync.Mutex
+
 	// uiEnabled indicates whether Vault Web UI is enabled or not
 	uiEnabled bool
 
@@ -347,6 +399,46 @@ type Core struct {
 	// pluginCatalog is used to manage plugin configurations
 	pluginCatalog *PluginCatalog
 
+	// managedKeyRegistry is used to manage the keys held in external devices
+	managedKeyRegistry *ManagedKeyRegistry
+
+	// passwordPolicyStore is used to manage the policies passwords are
+	// generated from
+	passwordPolicyStore *PasswordPolicyStore
+
+	// externalGroupStore is used to manage the groups mapping the groups of
+	// auth backends to policies
+	externalGroupStore *ExternalGroupStore
+
+	// entityStore is used to manage the entities users log in as
+	entityStore *EntityStore
+
+	// rgpStore and egpStore are used to manage the rule policies governing
+	// the tokens and the request paths
+	rgpStore *RulePolicyStore
+	egpStore *RulePolicyStore
+
+	// namespaceStore is used to manage the namespaces
+	namespaceStore *NamespaceStore
+
+	// loginMFAStore is used to manage the MFA methods and enforcements
+	// logins are subject to
+	loginMFAStore *LoginMFAStore
+
+	// userLockoutManager is used to lock users out of auth mounts after
+	// failed logins
+	userLockoutManager *UserLockoutManager
+
+	// quotaManager is used to manage the quotas limiting the requests
+	quotaManager *QuotaManager
+
+	// secretsSync is used to push KV secrets to external secret stores
+	secretsSync *SecretsSyncManager
+
+	// raftSnapshotAuto is used to take periodic snapshots of the raft
+	// storage
+	raftSnapshotAuto *RaftSnapshotAutoManager
+
 	enableMlock bool
 }
 
@@ -367,6 +459,12 @@ type CoreConfig struct {
 
 	Seal Seal `json:"seal" structs:"seal" mapstructure:"seal"`
 
+	// The seal the stored data is migrated from, when it is not Shamir
+	MigrationSeal Seal `json:"migration_seal" structs:"migration_seal" mapstructure:"migration_seal"`
+
+	// EntropySource augments the randomness of the critical keys when set
+	EntropySource seal.EntropySource `json:"entropy_source" structs:"entropy_source" mapstructure:"entropy_source"`
+
 	Logger log.Logger `json:"logger" structs:"logger" mapstructure:"logger"`
 
 	// Disables the LRU cache on the physical backend
@@ -378,6 +476,15 @@ type CoreConfig struct {
 	// Custom cache size for the LRU cache on the physical backend, or zero for default
 	CacheSize int `json:"cache_size" structs:"cache_size" mapstructure:"cache_size"`
 
+	// Bounds the LRU cache by the size of the cached entries instead of their number
+	CacheSizeBytes int64 `json:"cache_size_bytes" structs:"cache_size_bytes" mapstructure:"cache_size_bytes"`
+
+	// Caches the absence of the keys read from the physical backend
+	CacheNegative bool `json:"cache_negative" structs:"cache_negative" mapstructure:"cache_negative"`
+
+	// Serves the read requests on the standbys instead of forwarding them
+	PerformanceStandby bool `json:"performance_standby" structs:"performance_standby" mapstructure:"performance_standby"`
+
 	// Set as the leader address for HA
 	RedirectAddr string `json:"redirect_addr" structs:"redirect_addr" mapstructure:"redirect_addr"`
 
@@ -447,19 +554,30 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 		defaultLeaseTTL:                  conf.DefaultLeaseTTL,
 		maxLeaseTTL:                      conf.MaxLeaseTTL,
 		cachingDisabled:                  conf.DisableCache,
+		perfStandbyEnabled:               conf.PerformanceStandby,
 		clusterName:                      conf.ClusterName,
 		clusterListenerShutdownCh:        make(chan struct{}),
 		clusterListenerShutdownSuccessCh: make(chan struct{}),
 		clusterPeerClusterAddrsCache:     cache.New(3*heartbeatInterval, time.Second),
 		enableMlock:                      !conf.DisableMlock,
+		perfReplication:                  newPerfReplicationSet(),
+		drReplication:                    newDRReplicationSet(),
 	}
 
 	// Load CORS config and provide core
 	c.corsConfig = &CORSConfig{core: c}
 
+	if raftStorage, ok := conf.Physical.(*physical.RaftBackend); ok {
+		c.raftStorage = raftStorage
+	}
+
 	// Wrap the physical backend in a cache layer if enabled and not already wrapped
 	if _, isCache := conf.Physical.(*physical.Cache); !conf.DisableCache && !isCache {
-		c.physical = physical.NewCache(conf.Physical, conf.CacheSize, conf.Logger)
+		c.physical = physical.NewCacheWithConfig(conf.Physical, &physical.CacheConfig{
+			Size:            conf.CacheSize,
+			SizeBytes:       conf.CacheSizeBytes,
+			NegativeCaching: conf.CacheNegative,
+		}, conf.Logger)
 	}
 
 	if !conf.DisableMlock {
@@ -486,11 +604,18 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 		}
 	}
 
+	c.secureRandomReader = rand.Reader
+	if conf.EntropySource != nil {
+		c.secureRandomReader = &entropyAugmentedReader{source: conf.EntropySource}
+	}
+
 	// Construct a new AES-GCM barrier
-	c.barrier, err = NewAESGCMBarrier(c.physical)
+	barrier, err := NewAESGCMBarrier(c.physical)
 	if err != nil {
 		return nil, fmt.Errorf("barrier setup failed: %v", err)
 	}
+	barrier.randReader = c.secureRandomReader
+	c.barrier = barrier
 
 	if conf.HAPhysical != nil && conf.HAPhysical.HAEnabled() {
 		c.ha = conf.HAPhysical
@@ -540,8 +665,19 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 	}
 	c.seal.SetCore(c)
 
+	if err := c.setupSealMigration(conf.MigrationSeal); err != nil {
+		if !errwrap.ContainsType(err, new(NonFatalError)) {
+			return nil, err
+		}
+		return c, err
+	}
+
 	// Attempt unsealing with stored keys; if there are no stored keys this
-	// returns nil, otherwise returns nil or an error
+	// returns nil, otherwise returns nil or an error. A pending seal
+	// migration needs the keys of the operators.
+	if c.migrationTargetSeal != nil {
+		return c, nil
+	}
 	storedKeyErr := c.UnsealWithStoredKeys()
 
 	return c, storedKeyErr
@@ -618,8 +754,22 @@ func (c *Core) fetchACLandTokenEntry(req *logical.Request) (*ACL, *TokenEntry, e
 		return nil, nil, logical.ErrPermissionDenied
 	}
 
+	// Ensure the token is used from an address it is bound to
+	if len(te.BoundCIDRs) != 0 {
+		if req.Connection == nil || req.Connection.RemoteAddr == "" {
+			return nil, nil, logical.ErrPermissionDenied
+		}
+		belongs, err := cidrutil.IPBelongsToCIDRBlocksSlice(req.Connection.RemoteAddr, te.BoundCIDRs)
+		if err != nil || !belongs {
+			return nil, nil, logical.ErrPermissionDenied
+		}
+	}
+
 	// Construct the corresponding ACL object
-	acl, err := c.policyStore.ACL(te.Policies...)
+	acl, err := c.tokenACL(te)
+	if err == errMissingNamespace {
+		return nil, nil, logical.ErrPermissionDenied
+	}
 	if err != nil {
 		c.logger.Error("core: failed to construct ACL", "error", err)
 		return nil, nil, ErrInternalError
@@ -628,12 +778,35 @@ func (c *Core) fetchACLandTokenEntry(req *logical.Request) (*ACL, *TokenEntry, e
 	return acl, te, nil
 }
 
-func (c *Core) checkToken(req *logical.Request) (*logical.Auth, *TokenEntry, error) {
+// tokenACL returns the ACL built from the policies of a token, which are
+// those of the namespace of the token
+func (c *Core) tokenACL(te *TokenEntry) (*ACL, error) {
+	ns := c.namespaceStore.ByID(te.NamespaceID)
+	if ns == nil {
+		return nil, errMissingNamespace
+	}
+	return c.policyStoreForNamespace(ns).ACL(te.Policies...)
+}
+
+// isCubbyholePath returns whether a path is routed to the cubbyhole of the
+// root namespace or of any other
+func (c *Core) isCubbyholePath(path string) bool {
+	if strings.HasPrefix(path, "cubbyhole/") {
+		return true
+	}
+	me := c.router.MatchingMountEntry(path)
+	return me != nil && me.Type == "cubbyhole"
+}
+
+// checkToken validates the token of a request and checks that its policies
+// allow it. It also returns the control group which must authorize the
+// request before its response is released, if any.
+func (c *Core) checkToken(req *logical.Request) (*logical.Auth, *TokenEntry, *ControlGroup, error) {
 	defer metrics.MeasureSince([]string{"core", "check_token"}, time.Now())
 
 	acl, te, err := c.fetchACLandTokenEntry(req)
 	if err != nil {
-		return nil, te, err
+		return nil, te, nil, err
 	}
 
 	// Check if this is a root protected path
@@ -655,9 +828,9 @@ func (c *Core) checkToken(req *logical.Request) (*logical.Auth, *TokenEntry, err
 		default:
 			c.logger.Error("core: failed to run existence check", "error", err)
 			if _, ok := err.(errutil.UserError); ok {
-				return nil, nil, err
+				return nil, nil, nil, err
 			} else {
-				return nil, nil, ErrInternalError
+				return nil, nil, nil, ErrInternalError
 			}
 		}
 
@@ -684,19 +857,34 @@ func (c *Core) checkToken(req *logical.Request) (*logical.Auth, *TokenEntry, err
 		DisplayName: te.DisplayName,
 	}
 
+	// Batch tokens are not persisted, so there is nothing to tie a cubbyhole
+	// to
+	if te.Type == tokenTypeBatch && c.isCubbyholePath(req.Path) {
+		return auth, te, nil, fmt.Errorf("batch tokens cannot use the cubbyhole")
+	}
+
 	// Check the standard non-root ACLs. Return the token entry if it's not
 	// allowed so we can decrement the use count.
 	allowed, rootPrivs := acl.AllowOperation(req)
 	if !allowed {
 		// Return auth for audit logging even if not allowed
-		return auth, te, logical.ErrPermissionDenied
+		return auth, te, nil, logical.ErrPermissionDenied
 	}
 	if rootPath && !rootPrivs {
 		// Return auth for audit logging even if not allowed
-		return auth, te, logical.ErrPermissionDenied
+		return auth, te, nil, logical.ErrPermissionDenied
 	}
 
-	return auth, te, nil
+	// The rule policies are evaluated once the ACLs allow the request
+	if err := c.checkRulePolicies(req, te); err != nil {
+		if _, ok := err.(*RulePolicyError); !ok {
+			c.logger.Error("core: failed to evaluate rule policies", "request_path", req.Path, "error", err)
+			return auth, te, nil, ErrInternalError
+		}
+		return auth, te, nil, err
+	}
+
+	return auth, te, c.requestControlGroup(acl, req), nil
 }
 
 // Sealed checks if the Vault is current sealed
@@ -845,14 +1033,8 @@ func (c *Core) ResetUnsealProcess() {
 func (c *Core) Unseal(key []byte) (bool, error) {
 	defer metrics.MeasureSince([]string{"core", "unseal"}, time.Now())
 
-	// Verify the key length
-	min, max := c.barrier.KeyLength()
-	max += shamir.ShareOverhead
-	if len(key) < min {
-		return false, &ErrInvalidKey{fmt.Sprintf("key is shorter than minimum %d bytes", min)}
-	}
-	if len(key) > max {
-		return false, &ErrInvalidKey{fmt.Sprintf("key is longer than maximum %d bytes", max)}
+	if err := c.checkKeyLength(key); err != nil {
+		return false, err
 	}
 
 	// Get the seal configuration
@@ -874,6 +1056,10 @@ func (c *Core) Unseal(key []byte) (bool, error) {
 		return true, nil
 	}
 
+	if c.migrationTargetSeal != nil {
+		return false, ErrSealMigrationPending
+	}
+
 	masterKey, err := c.unsealPart(config, key)
 	if err != nil {
 		return false, err
@@ -885,6 +1071,19 @@ func (c *Core) Unseal(key []byte) (bool, error) {
 	return false, nil
 }
 
+// checkKeyLength verifies the length of a key part given to unseal
+func (c *Core) checkKeyLength(key []byte) error {
+	min, max := c.barrier.KeyLength()
+	max += shamir.ShareOverhead
+	if len(key) < min {
+		return &ErrInvalidKey{fmt.Sprintf("key is shorter than minimum %d bytes", min)}
+	}
+	if len(key) > max {
+		return &ErrInvalidKey{fmt.Sprintf("key is longer than maximum %d bytes", max)}
+	}
+	return nil
+}
+
 func (c *Core) unsealPart(config *SealConfig, key []byte) ([]byte, error) {
 	// Check if we already have this piece
 	if c.unlockInfo != nil {
@@ -1285,12 +1484,22 @@ func (c *Core) postUnseal() (retErr error) {
 		c.seal.SetRecoveryConfig(nil)
 	}
 
+	if err := c.loadReplicationState(); err != nil {
+		return err
+	}
+	if c.ReplicationState().HasState(consts.ReplicationDRSecondary) {
+		return c.postUnsealDRSecondary()
+	}
+
 	if err := enterprisePostUnseal(c); err != nil {
 		return err
 	}
 	if err := c.ensureWrappingKey(); err != nil {
 		return err
 	}
+	if err := c.setupNamespaceStore(); err != nil {
+		return err
+	}
 	if err := c.loadMounts(); err != nil {
 		return err
 	}
@@ -1306,6 +1515,12 @@ func (c *Core) postUnseal() (retErr error) {
 	if err := c.loadCORSConfig(); err != nil {
 		return err
 	}
+	if err := c.loadESTConfig(); err != nil {
+		return err
+	}
+	if err := c.loadRaftAutopilotConfig(); err != nil {
+		return err
+	}
 	if err := c.loadCredentials(); err != nil {
 		return err
 	}
@@ -1327,6 +1542,42 @@ func (c *Core) postUnseal() (retErr error) {
 	if err := c.setupPluginCatalog(); err != nil {
 		return err
 	}
+	if err := c.setupManagedKeyRegistry(); err != nil {
+		return err
+	}
+	if err := c.setupPasswordPolicyStore(); err != nil {
+		return err
+	}
+	if err := c.setupExternalGroupStore(); err != nil {
+		return err
+	}
+	if err := c.setupEntityStore(); err != nil {
+		return err
+	}
+	if err := c.setupRulePolicyStores(); err != nil {
+		return err
+	}
+	if err := c.setupLoginMFAStore(); err != nil {
+		return err
+	}
+	if err := c.setupUserLockoutManager(); err != nil {
+		return err
+	}
+	if err := c.setupQuotaManager(); err != nil {
+		return err
+	}
+	if err := c.setupSecretsSync(); err != nil {
+		return err
+	}
+	if err := c.setupRaftSnapshotAuto(); err != nil {
+		return err
+	}
+	if err := startReplication(c); err != nil {
+		return err
+	}
+	if err := c.startReplicationSecondaries(); err != nil {
+		return err
+	}
 
 	if c.ha != nil {
 		if err := c.startClusterListener(); err != nil {
@@ -1359,6 +1610,16 @@ func (c *Core) preSeal() error {
 
 	c.stopClusterListener()
 
+	// Let the pushes to sync destinations complete while the barrier is
+	// unsealed
+	if c.secretsSync != nil {
+		c.secretsSync.wait()
+	}
+	c.stopRaftSnapshotAuto()
+	if err := stopReplication(c); err != nil {
+		result = multierror.Append(result, errwrap.Wrapf("error stopping replication: {{err}}", err))
+	}
+
 	if err := c.teardownAudits(); err != nil {
 		result = multierror.Append(result, errwrap.Wrapf("error tearing down audits: {{err}}", err))
 	}
@@ -1377,6 +1638,9 @@ func (c *Core) preSeal() error {
 	if err := c.unloadMounts(); err != nil {
 		result = multierror.Append(result, errwrap.Wrapf("error unloading mounts: {{err}}", err))
 	}
+	if err := c.teardownNamespaceStore(); err != nil {
+		result = multierror.Append(result, errwrap.Wrapf("error tearing down namespace store: {{err}}", err))
+	}
 	if err := enterprisePreSeal(c); err != nil {
 		result = multierror.Append(result, err)
 	}
@@ -1397,14 +1661,6 @@ func enterprisePreSealImpl(c *Core) error {
 	return nil
 }
 
-func startReplicationImpl(c *Core) error {
-	return nil
-}
-
-func stopReplicationImpl(c *Core) error {
-	return nil
-}
-
 // runStandby is a long running routine that is used when an HA backend
 // is enabled. It waits until we are leader and switches this Vault to
 // active.
@@ -1427,6 +1683,19 @@ func (c *Core) runStandby(doneCh, stopCh, manualStepDownCh chan struct{}) {
 		close(checkLeaderStop)
 		<-checkLeaderDone
 	}()
+	// Keep the performance standby up to date with the active node
+	if c.perfStandbyEnabled {
+		perfStandbyDone := make(chan struct{})
+		perfStandbyStop := make(chan struct{})
+		go c.periodicPerfStandbyRefresh(perfStandbyDone, perfStandbyStop)
+		defer func() {
+			close(perfStandbyStop)
+			<-perfStandbyDone
+			c.stateLock.Lock()
+			c.teardownPerfStandby()
+			c.stateLock.Unlock()
+		}()
+	}
 
 	for {
 		// Check for a shutdown
@@ -1436,6 +1705,15 @@ func (c *Core) runStandby(doneCh, stopCh, manualStepDownCh chan struct{}) {
 		default:
 		}
 
+		// Serve the read requests while waiting for the lock
+		if c.perfStandbyEnabled {
+			c.stateLock.Lock()
+			if err := c.setupPerfStandby(); err != nil {
+				c.logger.Warn("core: performance standby setup failed, retrying later", "error", err)
+			}
+			c.stateLock.Unlock()
+		}
+
 		// Create a lock
 		uuid, err := uuid.GenerateUUID()
 		if err != nil {
@@ -1465,6 +1743,10 @@ func (c *Core) runStandby(doneCh, stopCh, manualStepDownCh chan struct{}) {
 		// before advertising;
 		c.stateLock.Lock()
 
+		// Stop serving the read requests, as the state is set up again for
+		// active operation
+		c.teardownPerfStandby()
+
 		// This block is used to wipe barrier/seal state and verify that
 		// everything is sane. If we have no sanity in the barrier, we actually
 		// seal, as there's little we can do.
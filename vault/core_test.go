@@ -689,6 +689,10 @@ func TestCore_HandleLogin_Token(t *testing.T) {
 		DisplayName:  "foo-armon",
 		TTL:          time.Hour * 24,
 		CreationTime: te.CreationTime,
+		EntityName:   "foo-armon",
+		EntityMeta: map[string]string{
+			"user": "armon",
+		},
 	}
 
 	if !reflect.DeepEqual(te, expect) {
@@ -701,6 +705,57 @@ func TestCore_HandleLogin_Token(t *testing.T) {
 	}
 }
 
+func TestCore_HandleLogin_BoundCIDRs(t *testing.T) {
+	noop := &NoopBackend{
+		Login: []string{"login"},
+		Response: &logical.Response{
+			Auth: &logical.Auth{
+				Policies:   []string{"foo"},
+				BoundCIDRs: []string{"10.0.0.0/8"},
+			},
+		},
+	}
+	c, _, root := TestCoreUnsealed(t)
+	c.credentialBackends["noop"] = func(conf *logical.BackendConfig) (logical.Backend, error) {
+		return noop, nil
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	lresp, err := c.HandleRequest(&logical.Request{Path: "auth/foo/login"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The token can only be used from the bound addresses
+	for addr, allowed := range map[string]bool{
+		"":          false,
+		"127.0.0.1": false,
+		"10.1.2.3":  true,
+	} {
+		req := logical.TestRequest(t, logical.ReadOperation, "auth/token/lookup-self")
+		req.ClientToken = lresp.Auth.ClientToken
+		if addr != "" {
+			req.Connection = &logical.Connection{RemoteAddr: addr}
+		}
+		resp, err := c.HandleRequest(req)
+		if allowed && err != nil {
+			t.Fatalf("%q: err: %v", addr, err)
+		}
+		if !allowed && (err == nil || !errwrap.Contains(err, logical.ErrPermissionDenied.Error())) {
+			t.Fatalf("%q: expected permission denied, got %v", addr, err)
+		}
+		if allowed && !reflect.DeepEqual(resp.Data["bound_cidrs"], []string{"10.0.0.0/8"}) {
+			t.Fatalf("bad: %#v", resp.Data)
+		}
+	}
+}
+
 func TestCore_HandleRequest_AuditTrail(t *testing.T) {
 	// Create a noop audit backend
 	noop := &NoopAudit{}
@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/helper/managedkeys"
+	"github.com/hashicorp/vault/helper/passwordpolicy"
 	"github.com/hashicorp/vault/helper/pluginutil"
 	"github.com/hashicorp/vault/helper/wrapping"
 	"github.com/hashicorp/vault/logical"
@@ -40,7 +42,7 @@ func (d dynamicSystemView) SudoPrivilege(path string, token string) bool {
 	}
 
 	// Construct the corresponding ACL object
-	acl, err := d.core.policyStore.ACL(te.Policies...)
+	acl, err := d.core.tokenACL(te)
 	if err != nil {
 		d.core.logger.Error("failed to retrieve ACL for token's policies", "token_policies", te.Policies, "error", err)
 		return false
@@ -79,7 +81,7 @@ func (d dynamicSystemView) Tainted() bool {
 
 // CachingDisabled indicates whether to use caching behavior
 func (d dynamicSystemView) CachingDisabled() bool {
-	return d.core.cachingDisabled || (d.mountEntry != nil && d.mountEntry.Config.ForceNoCache)
+	return d.core.cachingDisabled || d.core.PerfStandby() || (d.mountEntry != nil && d.mountEntry.Config.ForceNoCache)
 }
 
 // Checks if this is a primary Vault instance.
@@ -132,6 +134,16 @@ func (d dynamicSystemView) LookupPlugin(name string) (*pluginutil.PluginRunner,
 	return r, nil
 }
 
+// ManagedKey returns the named managed key, if the mount is allowed to use it
+func (d dynamicSystemView) ManagedKey(name string) (managedkeys.Key, error) {
+	return d.core.managedKeyRegistry.Key(name, d.mountEntry.Path)
+}
+
+// PasswordPolicy returns the named password policy
+func (d dynamicSystemView) PasswordPolicy(name string) (*passwordpolicy.Policy, error) {
+	return d.core.passwordPolicyStore.Policy(name)
+}
+
 // MlockEnabled returns the configuration setting for enabling mlock on plugins.
 func (d dynamicSystemView) MlockEnabled() bool {
 	return d.core.enableMlock
@@ -0,0 +1,424 @@
+package vault
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+var (
+	entitiesPath = "core/entities/"
+
+	// entityPrefix and entityAliasPrefix are the sub-paths of the entities,
+	// and of the index of their aliases, in the views of the entity stores
+	entityPrefix      = "entity/"
+	entityAliasPrefix = "alias/"
+)
+
+// EntityEntry is a stored entity. An entity is a user, who may log in through
+// several auth backends under one of its aliases. The metadata of an entity
+// is set by operators, so that backends can trust it.
+type EntityEntry struct {
+	Name string `json:"name"`
+
+	Metadata map[string]string `json:"metadata"`
+
+	Aliases []EntityAlias `json:"aliases"`
+}
+
+// EntityAlias is the name of an entity in the auth backend mounted at
+// MountPath, that is the display name the backend returns on login
+type EntityAlias struct {
+	// MountPath is the path of the auth backend, relative to "auth/" and
+	// with a trailing slash
+	MountPath string `json:"mount_path"`
+
+	Name string `json:"name"`
+
+	// Metadata is custom metadata of the alias
+	Metadata map[string]string `json:"metadata"`
+}
+
+// ParseEntityAlias parses an alias in the "<mount path>:<name>" format
+func ParseEntityAlias(s string) (EntityAlias, error) {
+	mountPath, name, err := parseAlias(s)
+	if err != nil {
+		return EntityAlias{}, err
+	}
+	return EntityAlias{
+		MountPath: mountPath,
+		Name:      name,
+	}, nil
+}
+
+// parseAlias parses an alias in the "<mount path>:<name>" format, returning
+// the mount path relative to "auth/" and with a trailing slash
+func parseAlias(s string) (string, string, error) {
+	idx := strings.Index(s, ":")
+	if idx <= 0 || idx == len(s)-1 {
+		return "", "", fmt.Errorf("alias %q is not in the \"<mount path>:<name>\" format", s)
+	}
+
+	mountPath := strings.Trim(s[:idx], "/")
+	mountPath = strings.TrimPrefix(mountPath, credentialRoutePrefix)
+	return mountPath + "/", s[idx+1:], nil
+}
+
+// String returns the alias in the "<mount path>:<name>" format
+func (a EntityAlias) String() string {
+	return strings.TrimSuffix(a.MountPath, "/") + ":" + a.Name
+}
+
+// indexKey returns the key of the alias in the alias index
+func (a EntityAlias) indexKey() string {
+	return entityAliasPrefix + hex.EncodeToString([]byte(a.String()))
+}
+
+// alias returns the alias of the entity with the same mount path and name as
+// the given one, or nil if there is none
+func (e *EntityEntry) alias(a EntityAlias) *EntityAlias {
+	for i := range e.Aliases {
+		if e.Aliases[i].String() == a.String() {
+			return &e.Aliases[i]
+		}
+	}
+	return nil
+}
+
+// Entity returns the entity a user logging in with the given alias is
+// attributed, with the metadata returned by the auth backend on login. The
+// metadata of the alias, then the metadata of the entity, take precedence.
+func (e *EntityEntry) Entity(alias *EntityAlias, loginMeta map[string]string) *logical.Entity {
+	meta := make(map[string]string, len(loginMeta)+len(e.Metadata))
+	for k, v := range loginMeta {
+		meta[k] = v
+	}
+	if alias != nil {
+		for k, v := range alias.Metadata {
+			meta[k] = v
+		}
+	}
+	for k, v := range e.Metadata {
+		meta[k] = v
+	}
+	return &logical.Entity{
+		Name:     e.Name,
+		Metadata: meta,
+	}
+}
+
+// EntityStore keeps the entities, along with an index of their aliases
+type EntityStore struct {
+	view *BarrierView
+
+	// modifyLock serializes the modifications of the entities, which keep
+	// the alias index consistent
+	modifyLock sync.Mutex
+}
+
+func (c *Core) setupEntityStore() error {
+	c.entityStore = &EntityStore{
+		view: NewBarrierView(c.barrier, entitiesPath),
+	}
+
+	return nil
+}
+
+// Get retrieves the named entity, or nil if it does not exist
+func (s *EntityStore) Get(name string) (*EntityEntry, error) {
+	out, err := s.view.Get(entityPrefix + name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve entity %q: %v", name, err)
+	}
+	if out == nil {
+		return nil, nil
+	}
+
+	entry := new(EntityEntry)
+	if err := jsonutil.DecodeJSON(out.Value, entry); err != nil {
+		return nil, fmt.Errorf("failed to decode entity entry: %v", err)
+	}
+	return entry, nil
+}
+
+// List returns the names of the entities
+func (s *EntityStore) List() ([]string, error) {
+	return logical.CollectKeys(s.view.SubView(entityPrefix))
+}
+
+// ByAlias returns the entity having the given alias, and its alias, or nil if
+// there is none
+func (s *EntityStore) ByAlias(alias EntityAlias) (*EntityEntry, *EntityAlias, error) {
+	out, err := s.view.Get(alias.indexKey())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve entity alias %q: %v", alias, err)
+	}
+	if out == nil {
+		return nil, nil, nil
+	}
+
+	entry, err := s.Get(string(out.Value))
+	if err != nil || entry == nil {
+		return nil, nil, err
+	}
+	return entry, entry.alias(alias), nil
+}
+
+// Set stores an entity, replacing its aliases. Aliases belong to a single
+// entity.
+func (s *EntityStore) Set(entry *EntityEntry) error {
+	s.modifyLock.Lock()
+	defer s.modifyLock.Unlock()
+
+	existing, err := s.Get(entry.Name)
+	if err != nil {
+		return err
+	}
+	if err := s.checkAliases(entry); err != nil {
+		return err
+	}
+	return s.set(existing, entry)
+}
+
+// Create stores new entities, unless one of them already exists or has an
+// alias of another entity
+func (s *EntityStore) Create(entries []*EntityEntry) error {
+	s.modifyLock.Lock()
+	defer s.modifyLock.Unlock()
+
+	// Check all the entities before storing any
+	names := make(map[string]bool, len(entries))
+	aliases := make(map[string]string)
+	for _, entry := range entries {
+		if names[entry.Name] {
+			return logical.CodedError(400, fmt.Sprintf("entity %q is given more than once", entry.Name))
+		}
+		names[entry.Name] = true
+
+		existing, err := s.Get(entry.Name)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return logical.CodedError(400, fmt.Sprintf("entity %q already exists", entry.Name))
+		}
+		if err := s.checkAliases(entry); err != nil {
+			return err
+		}
+		for _, alias := range entry.Aliases {
+			if other, ok := aliases[alias.String()]; ok {
+				return logical.CodedError(400, fmt.Sprintf("alias %q is given to both entities %q and %q", alias, other, entry.Name))
+			}
+			aliases[alias.String()] = entry.Name
+		}
+	}
+
+	for _, entry := range entries {
+		if err := s.set(nil, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes an entity and its aliases
+func (s *EntityStore) Delete(name string) error {
+	s.modifyLock.Lock()
+	defer s.modifyLock.Unlock()
+
+	existing, err := s.Get(name)
+	if err != nil || existing == nil {
+		return err
+	}
+	return s.delete(existing)
+}
+
+// Merge merges entities into another one, which gets their aliases. The
+// metadata of the entities merged is kept, unless the entity they are merged
+// into has metadata with the same key.
+func (s *EntityStore) Merge(to string, from []string) error {
+	s.modifyLock.Lock()
+	defer s.modifyLock.Unlock()
+
+	toEntry, err := s.Get(to)
+	if err != nil {
+		return err
+	}
+	if toEntry == nil {
+		return logical.CodedError(400, fmt.Sprintf("entity %q does not exist", to))
+	}
+	existing := *toEntry
+
+	var fromEntries []*EntityEntry
+	seen := make(map[string]bool, len(from))
+	for _, name := range from {
+		if name == to {
+			return logical.CodedError(400, fmt.Sprintf("cannot merge entity %q into itself", name))
+		}
+		// Merging the same entity twice would duplicate its aliases
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		fromEntry, err := s.Get(name)
+		if err != nil {
+			return err
+		}
+		if fromEntry == nil {
+			return logical.CodedError(400, fmt.Sprintf("entity %q does not exist", name))
+		}
+		fromEntries = append(fromEntries, fromEntry)
+	}
+
+	merged := &EntityEntry{
+		Name:     toEntry.Name,
+		Metadata: make(map[string]string),
+		Aliases:  append([]EntityAlias{}, toEntry.Aliases...),
+	}
+	for _, fromEntry := range fromEntries {
+		for k, v := range fromEntry.Metadata {
+			merged.Metadata[k] = v
+		}
+		merged.Aliases = append(merged.Aliases, fromEntry.Aliases...)
+	}
+	for k, v := range toEntry.Metadata {
+		merged.Metadata[k] = v
+	}
+
+	// The aliases of the merged entities are moved first, so that they are
+	// never left without an entity
+	if err := s.set(&existing, merged); err != nil {
+		return err
+	}
+	for _, fromEntry := range fromEntries {
+		if err := s.view.Delete(entityPrefix + fromEntry.Name); err != nil {
+			return fmt.Errorf("failed to delete entity %q: %v", fromEntry.Name, err)
+		}
+	}
+	return nil
+}
+
+// SetAlias adds an alias to an entity, or updates the metadata of an alias
+// of the entity
+func (s *EntityStore) SetAlias(name string, alias EntityAlias) error {
+	s.modifyLock.Lock()
+	defer s.modifyLock.Unlock()
+
+	existing, err := s.Get(name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return logical.CodedError(400, fmt.Sprintf("entity %q does not exist", name))
+	}
+
+	entry := *existing
+	entry.Aliases = append([]EntityAlias{}, existing.Aliases...)
+	if current := entry.alias(alias); current != nil {
+		*current = alias
+	} else {
+		entry.Aliases = append(entry.Aliases, alias)
+	}
+	if err := s.checkAliases(&entry); err != nil {
+		return err
+	}
+	return s.set(existing, &entry)
+}
+
+// DeleteAlias removes an alias from its entity
+func (s *EntityStore) DeleteAlias(alias EntityAlias) error {
+	s.modifyLock.Lock()
+	defer s.modifyLock.Unlock()
+
+	existing, _, err := s.ByAlias(alias)
+	if err != nil || existing == nil {
+		return err
+	}
+
+	entry := *existing
+	entry.Aliases = nil
+	for _, a := range existing.Aliases {
+		if a.String() != alias.String() {
+			entry.Aliases = append(entry.Aliases, a)
+		}
+	}
+	return s.set(existing, &entry)
+}
+
+// checkAliases returns an error if an entity has an alias twice, or an alias
+// of another entity
+func (s *EntityStore) checkAliases(entry *EntityEntry) error {
+	seen := make(map[string]bool, len(entry.Aliases))
+	for _, alias := range entry.Aliases {
+		if seen[alias.String()] {
+			return logical.CodedError(400, fmt.Sprintf("alias %q is given more than once", alias))
+		}
+		seen[alias.String()] = true
+
+		out, err := s.view.Get(alias.indexKey())
+		if err != nil {
+			return fmt.Errorf("failed to retrieve entity alias %q: %v", alias, err)
+		}
+		if out != nil && string(out.Value) != entry.Name {
+			return logical.CodedError(400, fmt.Sprintf("alias %q belongs to entity %q", alias, string(out.Value)))
+		}
+	}
+	return nil
+}
+
+// set stores an entity and indexes its aliases, removing from the index the
+// aliases the existing entry, if any, no longer has
+func (s *EntityStore) set(existing, entry *EntityEntry) error {
+	if entry.Name == "" || strings.Contains(entry.Name, "..") {
+		return logical.CodedError(400, fmt.Sprintf("invalid entity name %q", entry.Name))
+	}
+
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode entity entry: %v", err)
+	}
+	if err := s.view.Put(&logical.StorageEntry{
+		Key:   entityPrefix + entry.Name,
+		Value: buf,
+	}); err != nil {
+		return fmt.Errorf("failed to persist entity entry: %v", err)
+	}
+
+	for _, alias := range entry.Aliases {
+		if err := s.view.Put(&logical.StorageEntry{
+			Key:   alias.indexKey(),
+			Value: []byte(entry.Name),
+		}); err != nil {
+			return fmt.Errorf("failed to persist entity alias %q: %v", alias, err)
+		}
+	}
+	if existing != nil {
+		for _, alias := range existing.Aliases {
+			if entry.alias(alias) == nil {
+				if err := s.view.Delete(alias.indexKey()); err != nil {
+					return fmt.Errorf("failed to delete entity alias %q: %v", alias, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// delete removes an entity and its aliases from the index
+func (s *EntityStore) delete(entry *EntityEntry) error {
+	for _, alias := range entry.Aliases {
+		if err := s.view.Delete(alias.indexKey()); err != nil {
+			return fmt.Errorf("failed to delete entity alias %q: %v", alias, err)
+		}
+	}
+	if err := s.view.Delete(entityPrefix + entry.Name); err != nil {
+		return fmt.Errorf("failed to delete entity %q: %v", entry.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestEntities_login(t *testing.T) {
+	noop := &NoopBackend{
+		Login: []string{"login"},
+		Response: &logical.Response{
+			Auth: &logical.Auth{
+				Policies: []string{"creator"},
+				Metadata: map[string]string{
+					"user": "armon",
+					"team": "login",
+				},
+				DisplayName: "armon",
+			},
+		},
+	}
+	c, _, root := TestCoreUnsealed(t)
+	c.credentialBackends["noop"] = func(conf *logical.BackendConfig) (logical.Backend, error) {
+		return noop, nil
+	}
+
+	request := func(token, path string, data map[string]interface{}) *logical.Response {
+		req := logical.TestRequest(t, logical.UpdateOperation, path)
+		req.Data = data
+		req.ClientToken = token
+		resp, err := c.HandleRequest(req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v resp: %#v", err, resp)
+		}
+		return resp
+	}
+	request(root, "sys/auth/foo", map[string]interface{}{"type": "noop"})
+	request(root, "sys/policy/creator", map[string]interface{}{
+		"rules": `path "auth/token/create" { capabilities = ["update"] }`,
+	})
+	request(root, "sys/entities/batch", map[string]interface{}{
+		"entities": []interface{}{
+			map[string]interface{}{
+				"name": "armon",
+				"metadata": map[string]interface{}{
+					"team": "core",
+				},
+				"aliases": []interface{}{
+					map[string]interface{}{
+						"alias": "foo:armon",
+						"metadata": map[string]interface{}{
+							"team":  "alias",
+							"email": "armon@example.com",
+						},
+					},
+				},
+			},
+		},
+	})
+
+	// Entities cannot be created twice, nor take the alias of another one
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/entities/batch")
+	req.Data["entities"] = []interface{}{
+		map[string]interface{}{"name": "armon"},
+	}
+	req.ClientToken = root
+	if resp, err := c.HandleRequest(req); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("expected error creating an existing entity")
+	}
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/entities/name/other")
+	req.Data["aliases"] = "foo:armon"
+	req.ClientToken = root
+	if resp, err := c.HandleRequest(req); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("expected error taking the alias of another entity")
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/entity-aliases/auth/foo/:armon")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["entity"] != "armon" || resp.Data["metadata"].(map[string]string)["email"] != "armon@example.com" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The metadata of the entity, then of the alias, override the metadata
+	// of the login
+	lresp, err := c.HandleRequest(&logical.Request{Path: "auth/foo/login"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := map[string]string{
+		"user":  "armon",
+		"team":  "core",
+		"email": "armon@example.com",
+	}
+	te, err := c.tokenStore.Lookup(lresp.Auth.ClientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if te.EntityName != "armon" || !reflect.DeepEqual(te.EntityMeta, expected) {
+		t.Fatalf("bad token: %#v", te)
+	}
+
+	// Child tokens belong to the same entity, whatever their metadata
+	resp = request(lresp.Auth.ClientToken, "auth/token/create", map[string]interface{}{
+		"meta": map[string]interface{}{
+			"team": "forged",
+		},
+	})
+	te, err = c.tokenStore.Lookup(resp.Auth.ClientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if te.EntityName != "armon" || !reflect.DeepEqual(te.EntityMeta, expected) {
+		t.Fatalf("bad token: %#v", te)
+	}
+
+	// Token roles resolve their entity aliases in the token store
+	request(root, "sys/entities/name/service", map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"team": "ops",
+		},
+		"aliases": "token:service",
+	})
+	request(root, "auth/token/roles/service", map[string]interface{}{
+		"allowed_entity_aliases": "service",
+	})
+	resp = request(root, "auth/token/create/service", map[string]interface{}{
+		"entity_alias": "service",
+	})
+	te, err = c.tokenStore.Lookup(resp.Auth.ClientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if te.EntityName != "service" || !reflect.DeepEqual(te.EntityMeta, map[string]string{"team": "ops"}) {
+		t.Fatalf("bad token: %#v", te)
+	}
+}
+
+func TestEntities_merge(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	for name, data := range map[string]map[string]interface{}{
+		"alice": {
+			"metadata": map[string]interface{}{"team": "core"},
+			"aliases":  "userpass:alice",
+		},
+		"alice-github": {
+			"metadata": map[string]interface{}{"team": "web", "github": "alice"},
+			"aliases":  "github:alice",
+		},
+		"alice-ldap": {
+			"aliases": "ldap:alice",
+		},
+	} {
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/entities/name/"+name)
+		req.Data = data
+		req.ClientToken = root
+		if resp, err := c.HandleRequest(req); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v resp: %#v", err, resp)
+		}
+	}
+
+	// An entity cannot be merged into itself
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/entities/merge")
+	req.Data["to_entity"] = "alice"
+	req.Data["from_entities"] = "alice-github,alice"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// Repeated names are only merged once
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/entities/merge")
+	req.Data["to_entity"] = "alice"
+	req.Data["from_entities"] = "alice-github,alice-ldap,alice-github"
+	req.ClientToken = root
+	if resp, err := c.HandleRequest(req); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.ListOperation, "sys/entities/")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"alice"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/entities/name/alice")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["metadata"], map[string]string{"team": "core", "github": "alice"}) ||
+		len(resp.Data["aliases"].([]string)) != 3 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	for _, s := range []string{"userpass:alice", "github:alice", "ldap:alice"} {
+		alias, err := ParseEntityAlias(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, _, err := c.entityStore.ByAlias(alias)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry == nil || entry.Name != "alice" {
+			t.Fatalf("bad entity for %q: %#v", s, entry)
+		}
+	}
+
+	// Removing an alias removes it from the index
+	req = logical.TestRequest(t, logical.DeleteOperation, "sys/entity-aliases/ldap:alice")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	entry, _, err := c.entityStore.ByAlias(EntityAlias{MountPath: "ldap/", Name: "alice"})
+	if err != nil || entry != nil {
+		t.Fatalf("bad: %#v %v", entry, err)
+	}
+}
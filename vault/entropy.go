@@ -0,0 +1,34 @@
+package vault
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"github.com/hashicorp/vault/vault/seal"
+)
+
+// entropyAugmentedReader reads random bytes from the system generator mixed
+// with random bytes from an external source, such as an HSM, so that the
+// result is at least as strong as the strongest of the two. Reads fail when
+// the external source fails, rather than silently falling back to the system
+// generator.
+type entropyAugmentedReader struct {
+	source seal.EntropySource
+}
+
+func (r *entropyAugmentedReader) Read(p []byte) (int, error) {
+	if _, err := rand.Read(p); err != nil {
+		return 0, err
+	}
+	external, err := r.source.GenerateRandom(len(p))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read from the entropy source: %v", err)
+	}
+	if len(external) != len(p) {
+		return 0, fmt.Errorf("entropy source returned %d bytes, expected %d", len(external), len(p))
+	}
+	for i := range p {
+		p[i] ^= external[i]
+	}
+	return len(p), nil
+}
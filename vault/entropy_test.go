@@ -0,0 +1,79 @@
+package vault
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/physical"
+	log "github.com/mgutz/logxi/v1"
+)
+
+type testEntropySource struct {
+	calls int
+	err   error
+}
+
+func (s *testEntropySource) GenerateRandom(n int) ([]byte, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return make([]byte, n), nil
+}
+
+func TestEntropyAugmentedReader(t *testing.T) {
+	source := &testEntropySource{}
+	r := &entropyAugmentedReader{source: source}
+
+	buf := make([]byte, 32)
+	n, err := r.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 32 || source.calls != 1 {
+		t.Fatalf("bad: %d %d", n, source.calls)
+	}
+
+	// The reader fails closed
+	source.err = fmt.Errorf("HSM unavailable")
+	if _, err := r.Read(buf); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestCore_EntropyAugmentation(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	inm := physical.NewInmem(logger)
+	source := &testEntropySource{}
+
+	conf := testCoreConfig(t, inm, logger)
+	conf.EntropySource = source
+	core, err := NewCore(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The master key and the root token are generated from the source
+	result, err := core.Initialize(&InitParams{
+		BarrierConfig: &SealConfig{
+			SecretShares:    1,
+			SecretThreshold: 1,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source.calls < 2 {
+		t.Fatalf("bad: %d", source.calls)
+	}
+	if result.RootToken == "" {
+		t.Fatal("expected root token")
+	}
+
+	// Without the source, no critical key can be generated
+	source.err = fmt.Errorf("HSM unavailable")
+	if _, err := core.barrier.GenerateKey(); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,68 @@
+package vault
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// estConfigPath is the path of the EST configuration in the system config
+// view
+const estConfigPath = "est"
+
+// ESTConfig configures the PKI mount serving EST (RFC 7030) at the standard
+// /.well-known/est/ path of the server, outside of the API
+type ESTConfig struct {
+	// Mount is the path of the PKI mount, with a trailing slash
+	Mount string `json:"mount"`
+}
+
+// This should only be called with the core state lock held for writing
+func (c *Core) loadESTConfig() error {
+	view := c.systemBarrierView.SubView("config/")
+	out, err := view.Get(estConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to read EST config: %v", err)
+	}
+
+	config := new(ESTConfig)
+	if out != nil {
+		if err := out.DecodeJSON(config); err != nil {
+			return err
+		}
+	}
+
+	c.estConfigLock.Lock()
+	c.estConfig = config
+	c.estConfigLock.Unlock()
+	return nil
+}
+
+// saveESTConfig saves the EST configuration, and puts it in effect
+func (c *Core) saveESTConfig(config *ESTConfig) error {
+	view := c.systemBarrierView.SubView("config/")
+	entry, err := logical.StorageEntryJSON(estConfigPath, config)
+	if err != nil {
+		return fmt.Errorf("failed to create EST config entry: %v", err)
+	}
+	if err := view.Put(entry); err != nil {
+		return fmt.Errorf("failed to save EST config: %v", err)
+	}
+
+	c.estConfigLock.Lock()
+	c.estConfig = config
+	c.estConfigLock.Unlock()
+	return nil
+}
+
+// ESTMount returns the path of the PKI mount serving EST at the
+// /.well-known/est/ path, or an empty string if there is none
+func (c *Core) ESTMount() string {
+	c.estConfigLock.RLock()
+	defer c.estConfigLock.RUnlock()
+
+	if c.estConfig == nil {
+		return ""
+	}
+	return c.estConfig.Mount
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"path"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -16,6 +17,7 @@ import (
 	multierror "github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/helper/fairshare"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/helper/locksutil"
 	"github.com/hashicorp/vault/logical"
@@ -41,6 +43,9 @@ const (
 	// minRevokeDelay is used to prevent an instant revoke on restore
 	minRevokeDelay = 5 * time.Second
 
+	// revokeWorkerCount is the number of workers revoking the expired leases
+	revokeWorkerCount = 64
+
 	// maxLeaseDuration is the default maximum lease duration
 	maxLeaseTTL = 32 * 24 * time.Hour
 
@@ -62,6 +67,39 @@ type ExpirationManager struct {
 	pending     map[string]*time.Timer
 	pendingLock sync.Mutex
 
+	// irrevocable holds the leases whose revocation failed for good, by ID.
+	// It is guarded by pendingLock.
+	irrevocable map[string]*leaseEntry
+
+	// jobManager revokes the expired leases, sharing its workers between
+	// the mounts of the leases
+	jobManager *fairshare.JobManager
+
+	// restoreMode is set while the leases are restored in the background.
+	// Until then, the leases are restored on demand when they are used,
+	// under their restore lock. restoreLoaded holds the IDs of the leases
+	// restored so far, and restoreDoneCh is closed once the restore ends,
+	// for the operations on all the leases which wait for it.
+	restoreMode       int32
+	restoreLocks      []*locksutil.LockEntry
+	restoreLoaded     map[string]struct{}
+	restoreLoadedLock sync.Mutex
+	restoreQuitCh     chan struct{}
+	restoreDoneCh     chan struct{}
+
+	// leaseCountQuota returns the lease count quota applying to the leases
+	// of a path, if any
+	leaseCountQuota func(path string) *LeaseCountQuota
+
+	// quotaCounts caches the number of the stored leases under the paths of
+	// the lease count quotas, counted from the storage on first use so that
+	// the leases not restored yet and the irrevocable leases are included.
+	// The registrations of leases under a quota hold quotaLock, so that the
+	// quota is checked and the lease counted atomically, while the
+	// revocations share it.
+	quotaCounts map[string]*int64
+	quotaLock   sync.RWMutex
+
 	tidyLock int64
 }
 
@@ -73,12 +111,19 @@ func NewExpirationManager(router *Router, view *BarrierView, ts *TokenStore, log
 
 	}
 	exp := &ExpirationManager{
-		router:     router,
-		idView:     view.SubView(leaseViewPrefix),
-		tokenView:  view.SubView(tokenViewPrefix),
-		tokenStore: ts,
-		logger:     logger,
-		pending:    make(map[string]*time.Timer),
+		router:      router,
+		idView:      view.SubView(leaseViewPrefix),
+		tokenView:   view.SubView(tokenViewPrefix),
+		tokenStore:  ts,
+		logger:      logger,
+		pending:     make(map[string]*time.Timer),
+		irrevocable: make(map[string]*leaseEntry),
+		jobManager:  fairshare.NewJobManager(revokeWorkerCount),
+
+		restoreLocks:  locksutil.CreateLocks(),
+		restoreLoaded: make(map[string]struct{}),
+
+		quotaCounts: make(map[string]*int64),
 	}
 	return exp
 }
@@ -93,16 +138,33 @@ func (c *Core) setupExpiration() error {
 
 	// Create the manager
 	mgr := NewExpirationManager(c.router, view, c.tokenStore, c.logger)
+	mgr.leaseCountQuota = func(path string) *LeaseCountQuota {
+		if c.quotaManager == nil {
+			return nil
+		}
+		return c.quotaManager.leaseCountQuota(path)
+	}
 	c.expiration = mgr
 
 	// Link the token store to this
 	c.tokenStore.SetExpirationManager(mgr)
 
-	// Restore the existing state
+	// Restore the existing state in the background, so that the leases do
+	// not delay the unseal. The vault is sealed if they cannot be restored.
 	c.logger.Info("expiration: restoring leases")
-	if err := c.expiration.Restore(); err != nil {
-		return fmt.Errorf("expiration state restore failed: %v", err)
-	}
+	quit := mgr.startRestore()
+	go func() {
+		if err := mgr.restore(quit); err != nil {
+			c.logger.Error("expiration: failed to restore leases, sealing", "error", err)
+			c.stateLock.Lock()
+			defer c.stateLock.Unlock()
+			if c.expiration == mgr && !c.sealed {
+				if err := c.sealInternal(); err != nil {
+					c.logger.Error("expiration: failed to seal", "error", err)
+				}
+			}
+		}
+	}()
 	return nil
 }
 
@@ -136,6 +198,8 @@ func (m *ExpirationManager) Tidy() error {
 
 	defer atomic.CompareAndSwapInt64(&m.tidyLock, 1, 0)
 
+	m.waitRestore()
+
 	m.logger.Info("expiration: beginning tidy operation on leases")
 	defer m.logger.Info("expiration: finished tidy operation on leases")
 
@@ -227,11 +291,25 @@ func (m *ExpirationManager) Tidy() error {
 	return tidyErrors.ErrorOrNil()
 }
 
-// Restore is used to recover the lease states when starting.
-// This is used after starting the vault.
+// Restore is used to recover the lease states when starting. The leases are
+// loaded by a pool of workers, while the manager is in restore mode: the
+// leases used before being loaded are restored on demand. Restore returns
+// once all the leases are restored, or the manager is stopped.
 func (m *ExpirationManager) Restore() error {
-	m.pendingLock.Lock()
-	defer m.pendingLock.Unlock()
+	return m.restore(m.startRestore())
+}
+
+// restore restores the leases once the manager is in restore mode, unless
+// the manager is stopped first
+func (m *ExpirationManager) restore(quit chan struct{}) error {
+	defer metrics.MeasureSince([]string{"expire", "restore"}, time.Now())
+	defer m.endRestore()
+
+	select {
+	case <-quit:
+		return nil
+	default:
+	}
 
 	// Accumulate existing leases
 	m.logger.Debug("expiration: collecting leases")
@@ -243,10 +321,7 @@ func (m *ExpirationManager) Restore() error {
 
 	// Make the channels used for the worker pool
 	broker := make(chan string)
-	quit := make(chan bool)
-	// Buffer these channels to prevent deadlocks
-	errs := make(chan error, len(existing))
-	result := make(chan *leaseEntry, len(existing))
+	errs := make(chan error, consts.ExpirationRestoreWorkerCount)
 
 	// Use a wait group
 	wg := &sync.WaitGroup{}
@@ -256,110 +331,188 @@ func (m *ExpirationManager) Restore() error {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-
-			for {
-				select {
-				case leaseID, ok := <-broker:
-					// broker has been closed, we are done
-					if !ok {
-						return
-					}
-
-					le, err := m.loadEntry(leaseID)
-					if err != nil {
-						errs <- err
-						continue
-					}
-
-					// Write results out to the result channel
-					result <- le
-
-				// quit early
-				case <-quit:
+			for leaseID := range broker {
+				if err := m.processRestore(leaseID); err != nil {
+					errs <- err
 					return
 				}
 			}
 		}()
 	}
 
-	// Distribute the collected keys to the workers in a go routine
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
+	// Distribute the collected keys to the workers, until they are all
+	// restored, the manager is stopped, or a worker fails
+	var restoreErr error
+	func() {
+		defer close(broker)
 		for i, leaseID := range existing {
 			if i%500 == 0 {
 				m.logger.Trace("expiration: leases loading", "progress", i)
 			}
 
 			select {
+			case broker <- leaseID:
+			case restoreErr = <-errs:
+				return
 			case <-quit:
 				return
-
-			default:
-				broker <- leaseID
 			}
 		}
-
-		// Close the broker, causing worker routines to exit
-		close(broker)
 	}()
 
-	// Restore each key by pulling from the result chan
-	for i := 0; i < len(existing); i++ {
+	// Let all go routines finish
+	wg.Wait()
+	if restoreErr == nil {
 		select {
-		case err := <-errs:
-			// Close all go routines
-			close(quit)
+		case restoreErr = <-errs:
+		default:
+		}
+	}
+	if restoreErr != nil {
+		return restoreErr
+	}
 
-			return err
+	select {
+	case <-quit:
+		m.logger.Debug("expiration: restore stopped")
+		return nil
+	default:
+	}
 
-		case le := <-result:
+	m.pendingLock.Lock()
+	restored := len(m.pending)
+	m.pendingLock.Unlock()
+	if restored > 0 {
+		if m.logger.IsInfo() {
+			m.logger.Info("expire: leases restored", "restored_lease_count", restored)
+		}
+	}
 
-			// If there is no entry, nothing to restore
-			if le == nil {
-				continue
-			}
+	return nil
+}
 
-			// If there is no expiry time, don't do anything
-			if le.ExpireTime.IsZero() {
-				continue
-			}
+// startRestore puts the manager in restore mode, and returns the channel
+// closed when the manager is stopped. The revocations are started along
+// with the restore, since they are stopped along with the manager.
+func (m *ExpirationManager) startRestore() chan struct{} {
+	m.restoreLoadedLock.Lock()
+	defer m.restoreLoadedLock.Unlock()
+	m.restoreQuitCh = make(chan struct{})
+	m.restoreDoneCh = make(chan struct{})
+	atomic.StoreInt32(&m.restoreMode, 1)
+	m.jobManager.Start()
+	return m.restoreQuitCh
+}
 
-			// Determine the remaining time to expiration
-			expires := le.ExpireTime.Sub(time.Now())
-			if expires <= 0 {
-				expires = minRevokeDelay
-			}
+// endRestore leaves the restore mode
+func (m *ExpirationManager) endRestore() {
+	m.restoreLoadedLock.Lock()
+	defer m.restoreLoadedLock.Unlock()
+	atomic.StoreInt32(&m.restoreMode, 0)
+	m.restoreLoaded = make(map[string]struct{})
+	m.restoreQuitCh = nil
+	if m.restoreDoneCh != nil {
+		close(m.restoreDoneCh)
+		m.restoreDoneCh = nil
+	}
+}
 
-			// Setup revocation timer
-			m.pending[le.LeaseID] = time.AfterFunc(expires, func() {
-				m.expireID(le.LeaseID)
-			})
-		}
+// waitRestore waits for the restore of the leases to end, if they are being
+// restored. The operations on all the leases under a prefix wait for it,
+// since the leases not restored yet are only known to the storage.
+func (m *ExpirationManager) waitRestore() {
+	m.restoreLoadedLock.Lock()
+	done := m.restoreDoneCh
+	m.restoreLoadedLock.Unlock()
+	if done != nil {
+		<-done
 	}
+}
 
-	// Let all go routines finish
-	wg.Wait()
+// inRestoreMode returns whether the leases are being restored
+func (m *ExpirationManager) inRestoreMode() bool {
+	return atomic.LoadInt32(&m.restoreMode) == 1
+}
 
-	if len(m.pending) > 0 {
-		if m.logger.IsInfo() {
-			m.logger.Info("expire: leases restored", "restored_lease_count", len(m.pending))
+// processRestore restores the expiration of a lease, unless it is already
+// restored or the manager is not in restore mode
+func (m *ExpirationManager) processRestore(leaseID string) error {
+	if !m.inRestoreMode() {
+		return nil
+	}
+
+	lock := locksutil.LockForKey(m.restoreLocks, leaseID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	m.restoreLoadedLock.Lock()
+	_, loaded := m.restoreLoaded[leaseID]
+	m.restoreLoadedLock.Unlock()
+	if loaded {
+		return nil
+	}
+
+	le, err := m.loadEntry(leaseID)
+	if err != nil {
+		return err
+	}
+
+	// Irrevocable leases are not revoked again until an operator does
+	if le != nil && le.irrevocable() {
+		m.pendingLock.Lock()
+		m.irrevocable[leaseID] = le.irrevocableEntry()
+		m.pendingLock.Unlock()
+	}
+
+	// Leases without expiry time do not expire
+	if le != nil && !le.ExpireTime.IsZero() && !le.irrevocable() {
+		// Determine the remaining time to expiration
+		expires := le.ExpireTime.Sub(time.Now())
+		if expires <= 0 {
+			expires = minRevokeDelay
+		}
+
+		// Setup revocation timer, unless the lease was registered or renewed
+		// since the restore started
+		m.pendingLock.Lock()
+		if _, ok := m.pending[leaseID]; !ok {
+			m.pending[leaseID] = time.AfterFunc(expires, func() {
+				m.expireID(leaseID)
+			})
 		}
+		m.pendingLock.Unlock()
 	}
 
+	m.restoreLoadedLock.Lock()
+	m.restoreLoaded[leaseID] = struct{}{}
+	m.restoreLoadedLock.Unlock()
 	return nil
 }
 
 // Stop is used to prevent further automatic revocations.
 // This must be called before sealing the view.
 func (m *ExpirationManager) Stop() error {
+	// Stop restoring the leases
+	m.restoreLoadedLock.Lock()
+	if m.restoreQuitCh != nil {
+		close(m.restoreQuitCh)
+		m.restoreQuitCh = nil
+	}
+	m.restoreLoadedLock.Unlock()
+
 	// Stop all the pending expiration timers
 	m.pendingLock.Lock()
 	for _, timer := range m.pending {
 		timer.Stop()
 	}
 	m.pending = make(map[string]*time.Timer)
+	m.irrevocable = make(map[string]*leaseEntry)
 	m.pendingLock.Unlock()
+
+	m.resetQuotaCounts()
+
+	// Drop the queued revocations and wait for the running ones
+	m.jobManager.Stop()
 	return nil
 }
 
@@ -374,6 +527,12 @@ func (m *ExpirationManager) Revoke(leaseID string) error {
 // during revocation and still remove entries/index/lease timers
 func (m *ExpirationManager) revokeCommon(leaseID string, force, skipToken bool) error {
 	defer metrics.MeasureSince([]string{"expire", "revoke-common"}, time.Now())
+	// Restore the lease first if it was not yet, so that its expiration is
+	// not restored after its revocation
+	if err := m.processRestore(leaseID); err != nil {
+		return err
+	}
+
 	// Load the entry
 	le, err := m.loadEntry(leaseID)
 	if err != nil {
@@ -399,7 +558,7 @@ func (m *ExpirationManager) revokeCommon(leaseID string, force, skipToken bool)
 	}
 
 	// Delete the entry
-	if err := m.deleteEntry(leaseID); err != nil {
+	if err := m.deleteCountedEntry(leaseID); err != nil {
 		return err
 	}
 
@@ -416,18 +575,27 @@ func (m *ExpirationManager) revokeCommon(leaseID string, force, skipToken bool)
 		timer.Stop()
 		delete(m.pending, leaseID)
 	}
+	delete(m.irrevocable, leaseID)
 	m.pendingLock.Unlock()
 	return nil
 }
 
 // RevokeForce works similarly to RevokePrefix but continues in the case of a
-// revocation error; this is mostly meant for recovery operations
+// revocation error; this is mostly meant for recovery operations.
 func (m *ExpirationManager) RevokeForce(prefix string) error {
 	defer metrics.MeasureSince([]string{"expire", "revoke-force"}, time.Now())
 
 	return m.revokePrefixCommon(prefix, true)
 }
 
+// RevokeForceLease works similarly to Revoke but removes the lease even if
+// its revocation fails; this is mostly meant for removing irrevocable leases.
+func (m *ExpirationManager) RevokeForceLease(leaseID string) error {
+	defer metrics.MeasureSince([]string{"expire", "revoke-force-lease"}, time.Now())
+
+	return m.revokeCommon(leaseID, true, false)
+}
+
 // RevokePrefix is used to revoke all secrets with a given prefix.
 // The prefix maps to that of the mount table to make this simpler
 // to reason about.
@@ -474,6 +642,8 @@ func (m *ExpirationManager) RevokeByToken(te *TokenEntry) error {
 }
 
 func (m *ExpirationManager) revokePrefixCommon(prefix string, force bool) error {
+	m.waitRestore()
+
 	// Ensure there is a trailing slash
 	if !strings.HasSuffix(prefix, "/") {
 		prefix = prefix + "/"
@@ -501,6 +671,10 @@ func (m *ExpirationManager) revokePrefixCommon(prefix string, force bool) error
 // and a renew interval. The increment may be ignored.
 func (m *ExpirationManager) Renew(leaseID string, increment time.Duration) (*logical.Response, error) {
 	defer metrics.MeasureSince([]string{"expire", "renew"}, time.Now())
+	if err := m.processRestore(leaseID); err != nil {
+		return nil, err
+	}
+
 	// Load the entry
 	le, err := m.loadEntry(leaseID)
 	if err != nil {
@@ -561,6 +735,9 @@ func (m *ExpirationManager) RenewToken(req *logical.Request, source string, toke
 	defer metrics.MeasureSince([]string{"expire", "renew-token"}, time.Now())
 	// Compute the Lease ID
 	leaseID := path.Join(source, m.tokenStore.SaltID(token))
+	if err := m.processRestore(leaseID); err != nil {
+		return nil, err
+	}
 
 	// Load the entry
 	le, err := m.loadEntry(leaseID)
@@ -643,6 +820,13 @@ func (m *ExpirationManager) Register(req *logical.Request, resp *logical.Respons
 
 	leaseID := path.Join(req.Path, leaseUUID)
 
+	// The lease is checked against its quota and counted atomically
+	quota := m.quotaFor(req.Path)
+	if quota != nil {
+		m.quotaLock.Lock()
+		defer m.quotaLock.Unlock()
+	}
+
 	defer func() {
 		// If there is an error we want to rollback as much as possible (note
 		// that errors here are ignored to do as much cleanup as we can). We
@@ -666,6 +850,12 @@ func (m *ExpirationManager) Register(req *logical.Request, resp *logical.Respons
 		}
 	}()
 
+	if quota != nil {
+		if err := m.checkQuota(quota, req.Path); err != nil {
+			return "", err
+		}
+	}
+
 	le := leaseEntry{
 		LeaseID:     leaseID,
 		ClientToken: req.ClientToken,
@@ -689,6 +879,10 @@ func (m *ExpirationManager) Register(req *logical.Request, resp *logical.Respons
 	// Setup revocation timer if there is a lease
 	m.updatePending(&le, resp.Secret.LeaseTotal())
 
+	if quota != nil {
+		m.countLease(le.LeaseID, 1)
+	}
+
 	// Done
 	return le.LeaseID, nil
 }
@@ -707,6 +901,16 @@ func (m *ExpirationManager) RegisterAuth(source string, auth *logical.Auth) erro
 		return fmt.Errorf("expiration: %s", consts.ErrPathContainsParentReferences)
 	}
 
+	// The lease is checked against its quota and counted atomically
+	quota := m.quotaFor(source)
+	if quota != nil {
+		m.quotaLock.Lock()
+		defer m.quotaLock.Unlock()
+		if err := m.checkQuota(quota, source); err != nil {
+			return err
+		}
+	}
+
 	// Create a lease entry
 	le := leaseEntry{
 		LeaseID:     path.Join(source, m.tokenStore.SaltID(auth.ClientToken)),
@@ -724,6 +928,10 @@ func (m *ExpirationManager) RegisterAuth(source string, auth *logical.Auth) erro
 
 	// Setup revocation timer
 	m.updatePending(&le, auth.LeaseTotal())
+
+	if quota != nil {
+		m.countLease(le.LeaseID, 1)
+	}
 	return nil
 }
 
@@ -742,6 +950,9 @@ func (m *ExpirationManager) FetchLeaseTimesByToken(source, token string) (*lease
 // those values copied over.
 func (m *ExpirationManager) FetchLeaseTimes(leaseID string) (*leaseEntry, error) {
 	defer metrics.MeasureSince([]string{"expire", "fetch-lease-times"}, time.Now())
+	if err := m.processRestore(leaseID); err != nil {
+		return nil, err
+	}
 
 	// Load the entry
 	le, err := m.loadEntry(leaseID)
@@ -801,25 +1012,203 @@ func (m *ExpirationManager) updatePending(le *leaseEntry, leaseTotal time.Durati
 	}
 }
 
-// expireID is invoked when a given ID is expired
+// quotaFor returns the lease count quota applying to the leases of a path,
+// if any
+func (m *ExpirationManager) quotaFor(path string) *LeaseCountQuota {
+	if m.leaseCountQuota == nil {
+		return nil
+	}
+	return m.leaseCountQuota(path)
+}
+
+// checkQuota returns ErrLeaseCountQuotaExceeded if a new lease on the given
+// path would exceed its lease count quota. quotaLock must be held.
+func (m *ExpirationManager) checkQuota(quota *LeaseCountQuota, path string) error {
+	count, err := m.quotaCountLocked(quota.Path)
+	if err != nil {
+		return err
+	}
+	if count >= int64(quota.MaxLeases) {
+		m.logger.Warn("expiration: lease count quota exceeded", "quota", quota.Name, "request_path", path, "leases", count)
+		return ErrLeaseCountQuotaExceeded
+	}
+	return nil
+}
+
+// quotaCount returns the number of the stored leases under the path of a
+// lease count quota
+func (m *ExpirationManager) quotaCount(quotaPath string) (int, error) {
+	m.quotaLock.Lock()
+	defer m.quotaLock.Unlock()
+	count, err := m.quotaCountLocked(quotaPath)
+	return int(count), err
+}
+
+// quotaCountLocked returns the number of the stored leases under the path of
+// a lease count quota, counting them from the storage the first time.
+// quotaLock must be held.
+func (m *ExpirationManager) quotaCountLocked(quotaPath string) (int64, error) {
+	if counter, ok := m.quotaCounts[quotaPath]; ok {
+		return atomic.LoadInt64(counter), nil
+	}
+
+	prefix := quotaPath
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	existing, err := logical.CollectKeys(m.idView.SubView(prefix))
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan for leases: %v", err)
+	}
+	count := int64(len(existing))
+	m.quotaCounts[quotaPath] = &count
+	return count, nil
+}
+
+// countLease adds delta to the cached counts of the quota paths matching a
+// lease ID. quotaLock must be held, at least for reading.
+func (m *ExpirationManager) countLease(leaseID string, delta int64) {
+	for quotaPath, counter := range m.quotaCounts {
+		if quotaPathMatches(quotaPath, leaseID) {
+			atomic.AddInt64(counter, delta)
+		}
+	}
+}
+
+// deleteCountedEntry deletes a lease entry, and counts it out of the lease
+// count quotas if it still existed
+func (m *ExpirationManager) deleteCountedEntry(leaseID string) error {
+	m.quotaLock.RLock()
+	defer m.quotaLock.RUnlock()
+
+	counted := false
+	for quotaPath := range m.quotaCounts {
+		if quotaPathMatches(quotaPath, leaseID) {
+			counted = true
+			break
+		}
+	}
+	if !counted {
+		return m.deleteEntry(leaseID)
+	}
+
+	// Concurrent revocations of the lease must only count it out once
+	lock := locksutil.LockForKey(m.restoreLocks, leaseID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	le, err := m.loadEntry(leaseID)
+	if err != nil {
+		return err
+	}
+	if le == nil {
+		return nil
+	}
+	if err := m.deleteEntry(leaseID); err != nil {
+		return err
+	}
+	m.countLease(leaseID, -1)
+	return nil
+}
+
+// resetQuotaCounts forgets the cached lease counts, which are counted from
+// the storage again when next needed
+func (m *ExpirationManager) resetQuotaCounts() {
+	m.quotaLock.Lock()
+	m.quotaCounts = make(map[string]*int64)
+	m.quotaLock.Unlock()
+}
+
+// expireID is invoked when a given ID is expired, and queues its revocation
+// with the other expired leases of its mount
 func (m *ExpirationManager) expireID(leaseID string) {
 	// Clear from the pending expiration
 	m.pendingLock.Lock()
 	delete(m.pending, leaseID)
 	m.pendingLock.Unlock()
 
-	for attempt := uint(0); attempt < maxRevokeAttempts; attempt++ {
-		err := m.Revoke(leaseID)
-		if err == nil {
-			if m.logger.IsInfo() {
-				m.logger.Info("expire: revoked lease", "lease_id", leaseID)
-			}
-			return
+	m.jobManager.AddJob(&revocationJob{
+		m:       m,
+		leaseID: leaseID,
+	}, m.router.MatchingMount(leaseID))
+}
+
+// revocationJob revokes an expired lease, and retries with an exponential
+// backoff until it succeeds or the attempts are exhausted
+type revocationJob struct {
+	m       *ExpirationManager
+	leaseID string
+	attempt uint
+}
+
+func (j *revocationJob) Execute() error {
+	if err := j.m.Revoke(j.leaseID); err != nil {
+		return err
+	}
+	if j.m.logger.IsInfo() {
+		j.m.logger.Info("expire: revoked lease", "lease_id", j.leaseID)
+	}
+	return nil
+}
+
+func (j *revocationJob) OnFailure(err error) {
+	j.m.logger.Error("expire: failed to revoke lease", "lease_id", j.leaseID, "error", err)
+	j.attempt++
+	if j.attempt >= maxRevokeAttempts {
+		j.m.logger.Error("expire: maximum revoke attempts reached, marking lease irrevocable", "lease_id", j.leaseID)
+		if err := j.m.markLeaseIrrevocable(j.leaseID, err); err != nil {
+			j.m.logger.Error("expire: failed to mark lease irrevocable", "lease_id", j.leaseID, "error", err)
 		}
-		m.logger.Error("expire: failed to revoke lease", "lease_id", leaseID, "error", err)
-		time.Sleep((1 << attempt) * revokeRetryBase)
+		return
 	}
-	m.logger.Error("expire: maximum revoke attempts reached", "lease_id", leaseID)
+
+	// The retry is dropped if the manager is stopped in the meantime
+	time.AfterFunc((1<<(j.attempt-1))*revokeRetryBase, func() {
+		j.m.jobManager.AddJob(j, j.m.router.MatchingMount(j.leaseID))
+	})
+}
+
+// markLeaseIrrevocable records the error of the last revocation attempt of a
+// lease, so that it is no longer revoked automatically
+func (m *ExpirationManager) markLeaseIrrevocable(leaseID string, revokeErr error) error {
+	le, err := m.loadEntry(leaseID)
+	if err != nil {
+		return err
+	}
+	if le == nil {
+		return nil
+	}
+
+	le.RevokeErr = revokeErr.Error()
+	if err := m.persistEntry(le); err != nil {
+		return err
+	}
+
+	m.pendingLock.Lock()
+	m.irrevocable[leaseID] = le.irrevocableEntry()
+	m.pendingLock.Unlock()
+	return nil
+}
+
+// irrevocableLeases returns the irrevocable leases whose ID has the given
+// prefix, sorted by ID
+func (m *ExpirationManager) irrevocableLeases(prefix string) []*leaseEntry {
+	// The irrevocable leases are only known once restored
+	m.waitRestore()
+
+	m.pendingLock.Lock()
+	defer m.pendingLock.Unlock()
+
+	var leases []*leaseEntry
+	for leaseID, le := range m.irrevocable {
+		if strings.HasPrefix(leaseID, prefix) {
+			leases = append(leases, le)
+		}
+	}
+	sort.Slice(leases, func(i, j int) bool {
+		return leases[i].LeaseID < leases[j].LeaseID
+	})
+	return leases
 }
 
 // revokeEntry is used to attempt revocation of an internal entry
@@ -864,7 +1253,7 @@ func (m *ExpirationManager) renewAuthEntry(req *logical.Request, le *leaseEntry,
 	auth := *le.Auth
 	auth.IssueTime = le.IssueTime
 	auth.Increment = increment
-	if strings.HasPrefix(le.Path, "auth/token/") {
+	if m.router.IsTokenStorePath(le.Path) {
 		auth.ClientToken = le.ClientToken
 	} else {
 		auth.ClientToken = ""
@@ -983,6 +1372,7 @@ func (m *ExpirationManager) emitMetrics() {
 	num := len(m.pending)
 	m.pendingLock.Unlock()
 	metrics.SetGauge([]string{"expire", "num_leases"}, float32(num))
+	metrics.SetGauge([]string{"expire", "pending_revocations"}, float32(m.jobManager.PendingJobs()))
 }
 
 // leaseEntry is used to structure the values the expiration
@@ -997,6 +1387,27 @@ type leaseEntry struct {
 	IssueTime       time.Time              `json:"issue_time"`
 	ExpireTime      time.Time              `json:"expire_time"`
 	LastRenewalTime time.Time              `json:"last_renewal_time"`
+
+	// RevokeErr is the error of the last revocation attempt of an
+	// irrevocable lease
+	RevokeErr string `json:"revoke_err"`
+}
+
+// irrevocable returns whether the lease could not be revoked
+func (le *leaseEntry) irrevocable() bool {
+	return le.RevokeErr != ""
+}
+
+// irrevocableEntry returns a copy of the entry of an irrevocable lease,
+// without its secret and data, to be kept in memory
+func (le *leaseEntry) irrevocableEntry() *leaseEntry {
+	return &leaseEntry{
+		LeaseID:    le.LeaseID,
+		Path:       le.Path,
+		IssueTime:  le.IssueTime,
+		ExpireTime: le.ExpireTime,
+		RevokeErr:  le.RevokeErr,
+	}
 }
 
 // encode is used to JSON encode the lease entry
@@ -1010,6 +1421,9 @@ func (le *leaseEntry) renewable() (bool, error) {
 	// If there is no entry, cannot review
 	case le == nil || le.ExpireTime.IsZero():
 		err = fmt.Errorf("lease not found or lease is not renewable")
+	// Irrevocable leases are left for operators to remove
+	case le.irrevocable():
+		err = fmt.Errorf("lease is irrevocable")
 	// Determine if the lease is expired
 	case le.ExpireTime.Before(time.Now()):
 		err = fmt.Errorf("lease expired")
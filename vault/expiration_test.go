@@ -403,6 +403,131 @@ func TestExpiration_Restore(t *testing.T) {
 	}
 }
 
+func TestExpiration_Restore_lazy(t *testing.T) {
+	exp := mockExpiration(t)
+	noop := &NoopBackend{}
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "logical/")
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.router.Mount(noop, "prod/aws/", &MountEntry{UUID: meUUID}, view)
+
+	var leaseIDs []string
+	for _, path := range []string{"prod/aws/foo", "prod/aws/bar", "prod/aws/zip"} {
+		req := &logical.Request{
+			Operation:   logical.ReadOperation,
+			Path:        path,
+			ClientToken: "foobar",
+		}
+		resp := &logical.Response{
+			Secret: &logical.Secret{
+				LeaseOptions: logical.LeaseOptions{
+					TTL: time.Hour,
+				},
+			},
+		}
+		leaseID, err := exp.Register(req, resp)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		leaseIDs = append(leaseIDs, leaseID)
+	}
+	if err := exp.Stop(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pending := func(leaseID string) bool {
+		exp.pendingLock.Lock()
+		defer exp.pendingLock.Unlock()
+		_, ok := exp.pending[leaseID]
+		return ok
+	}
+
+	// Leases used while in restore mode are restored on demand, and the
+	// revoked ones are not restored afterwards
+	quit := exp.startRestore()
+	if _, err := exp.FetchLeaseTimes(leaseIDs[0]); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !pending(leaseIDs[0]) || pending(leaseIDs[2]) {
+		t.Fatal("expected only the used lease to be restored")
+	}
+	if err := exp.Revoke(leaseIDs[1]); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err := exp.restore(quit); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if exp.inRestoreMode() {
+		t.Fatal("expected the restore mode to end")
+	}
+	if !pending(leaseIDs[0]) || pending(leaseIDs[1]) || !pending(leaseIDs[2]) {
+		t.Fatal("bad restored leases")
+	}
+}
+
+func TestExpiration_Restore_wait(t *testing.T) {
+	exp := mockExpiration(t)
+	noop := &NoopBackend{}
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "logical/")
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.router.Mount(noop, "prod/aws/", &MountEntry{UUID: meUUID}, view)
+
+	req := &logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "prod/aws/foo",
+		ClientToken: "foobar",
+	}
+	resp := &logical.Response{
+		Secret: &logical.Secret{
+			LeaseOptions: logical.LeaseOptions{
+				TTL: time.Hour,
+			},
+		},
+	}
+	leaseID, err := exp.Register(req, resp)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := exp.markLeaseIrrevocable(leaseID, fmt.Errorf("failed")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := exp.Stop(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The irrevocable leases are only listed once they are all restored
+	quit := exp.startRestore()
+	listed := make(chan []*leaseEntry)
+	go func() {
+		listed <- exp.irrevocableLeases("prod/")
+	}()
+	select {
+	case <-listed:
+		t.Fatal("expected the listing to wait for the restore")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := exp.restore(quit); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	select {
+	case leases := <-listed:
+		if len(leases) != 1 || leases[0].LeaseID != leaseID {
+			t.Fatalf("bad: %#v", leases)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the listing")
+	}
+}
+
 func TestExpiration_Register(t *testing.T) {
 	exp := mockExpiration(t)
 	req := &logical.Request{
@@ -542,6 +667,80 @@ func TestExpiration_Revoke(t *testing.T) {
 	}
 }
 
+func TestExpiration_irrevocable(t *testing.T) {
+	exp := mockExpiration(t)
+	noop := &NoopBackend{}
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "logical/")
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.router.Mount(noop, "prod/aws/", &MountEntry{UUID: meUUID}, view)
+
+	req := &logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "prod/aws/foo",
+		ClientToken: "foobar",
+	}
+	resp := &logical.Response{
+		Secret: &logical.Secret{
+			LeaseOptions: logical.LeaseOptions{
+				TTL: time.Hour,
+			},
+		},
+	}
+	id, err := exp.Register(req, resp)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The lease is marked irrevocable once the last revoke attempt fails
+	noop.Response = logical.ErrorResponse("revocation failed")
+	job := &revocationJob{m: exp, leaseID: id, attempt: maxRevokeAttempts - 1}
+	err = job.Execute()
+	if err == nil {
+		t.Fatal("expected revocation to fail")
+	}
+	job.OnFailure(err)
+
+	leases := exp.irrevocableLeases("prod/")
+	if len(leases) != 1 || leases[0].LeaseID != id || leases[0].RevokeErr != err.Error() {
+		t.Fatalf("bad: %#v", leases)
+	}
+	if _, err := exp.Renew(id, 0); err == nil {
+		t.Fatal("expected irrevocable lease not to be renewable")
+	}
+
+	// Irrevocable leases are restored without being scheduled for revocation
+	if err := exp.Stop(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := exp.Restore(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(exp.irrevocableLeases("")) != 1 {
+		t.Fatal("expected the irrevocable lease to be restored")
+	}
+	exp.pendingLock.Lock()
+	_, pending := exp.pending[id]
+	exp.pendingLock.Unlock()
+	if pending {
+		t.Fatal("expected the irrevocable lease not to be pending")
+	}
+
+	// Forced revocations remove irrevocable leases
+	if err := exp.RevokeForceLease(id); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(exp.irrevocableLeases("")) != 0 {
+		t.Fatal("expected the irrevocable lease to be removed")
+	}
+	if le, err := exp.loadEntry(id); err != nil || le != nil {
+		t.Fatalf("expected the lease to be removed, err: %v le: %#v", err, le)
+	}
+}
+
 func TestExpiration_RevokeOnExpire(t *testing.T) {
 	exp := mockExpiration(t)
 	noop := &NoopBackend{}
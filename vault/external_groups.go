@@ -0,0 +1,151 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+var externalGroupsPath = "core/external-groups/"
+
+// ExternalGroupEntry is a stored external group. The members of an external
+// group are the users an auth backend reports as members of one of its
+// aliases when they log in.
+type ExternalGroupEntry struct {
+	Name string `json:"name"`
+
+	// Policies are granted to the tokens of the members of the group
+	Policies []string `json:"policies"`
+
+	// Aliases are the groups of auth backends making up the group
+	Aliases []ExternalGroupAlias `json:"aliases"`
+}
+
+// ExternalGroupAlias is a group reported by the auth backend mounted at
+// MountPath, such as an LDAP group
+type ExternalGroupAlias struct {
+	// MountPath is the path of the auth backend, relative to "auth/" and
+	// with a trailing slash
+	MountPath string `json:"mount_path"`
+
+	Name string `json:"name"`
+}
+
+// ParseExternalGroupAlias parses an alias in the "<mount path>:<group name>"
+// format
+func ParseExternalGroupAlias(s string) (ExternalGroupAlias, error) {
+	mountPath, name, err := parseAlias(s)
+	if err != nil {
+		return ExternalGroupAlias{}, err
+	}
+	return ExternalGroupAlias{
+		MountPath: mountPath,
+		Name:      name,
+	}, nil
+}
+
+// String returns the alias in the "<mount path>:<group name>" format
+func (a ExternalGroupAlias) String() string {
+	return strings.TrimSuffix(a.MountPath, "/") + ":" + a.Name
+}
+
+// ExternalGroupStore keeps the external groups mapping the groups of auth
+// backends to policies
+type ExternalGroupStore struct {
+	view *BarrierView
+}
+
+func (c *Core) setupExternalGroupStore() error {
+	c.externalGroupStore = &ExternalGroupStore{
+		view: NewBarrierView(c.barrier, externalGroupsPath),
+	}
+
+	return nil
+}
+
+// Get retrieves the named external group, or nil if it does not exist
+func (s *ExternalGroupStore) Get(name string) (*ExternalGroupEntry, error) {
+	out, err := s.view.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve external group %q: %v", name, err)
+	}
+	if out == nil {
+		return nil, nil
+	}
+
+	entry := new(ExternalGroupEntry)
+	if err := jsonutil.DecodeJSON(out.Value, entry); err != nil {
+		return nil, fmt.Errorf("failed to decode external group entry: %v", err)
+	}
+	return entry, nil
+}
+
+// Set stores an external group
+func (s *ExternalGroupStore) Set(entry *ExternalGroupEntry) error {
+	if strings.Contains(entry.Name, "..") {
+		return fmt.Errorf("external group names cannot contain \"..\"")
+	}
+
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode external group entry: %v", err)
+	}
+
+	if err := s.view.Put(&logical.StorageEntry{
+		Key:   entry.Name,
+		Value: buf,
+	}); err != nil {
+		return fmt.Errorf("failed to persist external group entry: %v", err)
+	}
+	return nil
+}
+
+// Delete removes an external group
+func (s *ExternalGroupStore) Delete(name string) error {
+	return s.view.Delete(name)
+}
+
+// List returns the names of the external groups
+func (s *ExternalGroupStore) List() ([]string, error) {
+	return logical.CollectKeys(s.view)
+}
+
+// Resolve returns the names of the external groups having one of the given
+// groups of the auth backend mounted at mountPath as alias, and the policies
+// they grant
+func (s *ExternalGroupStore) Resolve(mountPath string, groupAliases []string) ([]string, []string, error) {
+	if len(groupAliases) == 0 {
+		return nil, nil, nil
+	}
+
+	names, err := s.List()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var groups, policies []string
+	for _, name := range names {
+		entry, err := s.Get(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if entry == nil {
+			continue
+		}
+		for _, alias := range entry.Aliases {
+			if alias.MountPath == mountPath && strutil.StrListContains(groupAliases, alias.Name) {
+				groups = append(groups, entry.Name)
+				policies = append(policies, entry.Policies...)
+				break
+			}
+		}
+	}
+
+	sort.Strings(groups)
+	return groups, strutil.RemoveDuplicates(policies, true), nil
+}
@@ -0,0 +1,108 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestExternalGroups_login(t *testing.T) {
+	noop := &NoopBackend{
+		Login: []string{"login"},
+		Response: &logical.Response{
+			Auth: &logical.Auth{
+				GroupAliases: []string{"engineering", "everyone"},
+				Metadata: map[string]string{
+					"user": "armon",
+				},
+				DisplayName: "armon",
+			},
+		},
+	}
+	c, _, root := TestCoreUnsealed(t)
+	c.credentialBackends["noop"] = func(conf *logical.BackendConfig) (logical.Backend, error) {
+		return noop, nil
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Without external groups, users without policies cannot log in
+	if _, err := c.HandleRequest(&logical.Request{Path: "auth/foo/login"}); err == nil {
+		t.Fatal("expected error logging in without policies")
+	}
+
+	for name, data := range map[string]map[string]interface{}{
+		"eng": {
+			"policies": "dev,ops",
+			"aliases":  []string{"auth/foo/:engineering", "other:engineering"},
+		},
+		"unrelated": {
+			"policies": "admin",
+			"aliases":  "other:everyone",
+		},
+	} {
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/groups/external/"+name)
+		req.Data = data
+		req.ClientToken = root
+		if resp, err := c.HandleRequest(req); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v resp: %#v", err, resp)
+		}
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/groups/external/eng")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["aliases"], []string{"foo:engineering", "other:engineering"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	lresp, err := c.HandleRequest(&logical.Request{Path: "auth/foo/login"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	te, err := c.tokenStore.Lookup(lresp.Auth.ClientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(te.Policies, []string{"default", "dev", "ops"}) || te.Meta["external_groups"] != "eng" {
+		t.Fatalf("bad token: %#v", te)
+	}
+
+	// Policies which cannot be assigned are rejected
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/groups/external/bad")
+	req.Data["policies"] = "root"
+	req.ClientToken = root
+	if resp, err := c.HandleRequest(req); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("expected error assigning the root policy")
+	}
+}
+
+func TestParseExternalGroupAlias(t *testing.T) {
+	for in, expected := range map[string]ExternalGroupAlias{
+		"ldap:engineering":      {MountPath: "ldap/", Name: "engineering"},
+		"auth/ldap/:ops:admins": {MountPath: "ldap/", Name: "ops:admins"},
+	} {
+		alias, err := ParseExternalGroupAlias(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if alias != expected {
+			t.Fatalf("bad alias for %q: %#v", in, alias)
+		}
+	}
+
+	for _, in := range []string{"ldap", ":engineering", "ldap:"} {
+		if _, err := ParseExternalGroupAlias(in); err == nil {
+			t.Fatalf("expected error parsing %q", in)
+		}
+	}
+}
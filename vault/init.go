@@ -127,6 +127,14 @@ func (c *Core) Initialize(initParams *InitParams) (*InitResult, error) {
 		return nil, ErrAlreadyInit
 	}
 
+	// Nodes using the raft storage start a new cluster when initialized
+	if c.raftStorage != nil {
+		if err := c.raftStorage.Bootstrap(); err != nil {
+			c.logger.Error("core: failed to bootstrap raft storage", "error", err)
+			return nil, fmt.Errorf("error bootstrapping raft storage: %v", err)
+		}
+	}
+
 	err = c.seal.Init()
 	if err != nil {
 		c.logger.Error("core: failed to initialize seal", "error", err)
@@ -5,12 +5,20 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/helper/managedkeys"
 	"github.com/hashicorp/vault/helper/parseutil"
+	"github.com/hashicorp/vault/helper/passwordpolicy"
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/secretsync"
+	"github.com/hashicorp/vault/helper/snapshotstore"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/helper/wrapping"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -25,22 +33,29 @@ var (
 	}
 
 	replicationPaths = func(b *SystemBackend) []*framework.Path {
-		return []*framework.Path{
+		paths := []*framework.Path{
 			&framework.Path{
 				Pattern: "replication/status",
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.ReadOperation: func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-						var state consts.ReplicationState
-						resp := &logical.Response{
-							Data: map[string]interface{}{
-								"mode": state.String(),
-							},
-						}
-						return resp, nil
-					},
+					logical.ReadOperation: b.handleReplicationStatus,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication-status"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication-status"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "replication/reindex",
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleReplicationReindex,
 				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication-reindex"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication-reindex"][1]),
 			},
 		}
+		paths = append(paths, b.replicationSetPaths(b.Core.perfReplication)...)
+		return append(paths, b.replicationSetPaths(b.Core.drReplication)...)
 	}
 )
 
@@ -61,19 +76,38 @@ func NewSystemBackend(core *Core) *SystemBackend {
 				"raw/*",
 				"replication/primary/secondary-token",
 				"replication/reindex",
+				"replication/performance/primary/*",
+				"replication/performance/secondary/*",
+				"replication/dr/primary/*",
+				"replication/dr/secondary/*",
 				"rotate",
 				"config/cors",
+				"config/est",
 				"config/auditing/*",
 				"plugins/catalog/*",
+				"managed-keys/*",
+				"groups/external/*",
+				"entities/*",
+				"entity-aliases/*",
+				"locked-users/*",
+				"sync/*",
 				"revoke-prefix/*",
 				"leases/revoke-prefix/*",
 				"leases/revoke-force/*",
+				"leases/revoke-force-lease",
+				"leases/revoke-force-lease/*",
 				"leases/lookup/*",
+				"storage/raft/*",
 			},
 
 			Unauthenticated: []string{
 				"wrapping/pubkey",
 				"replication/status",
+				"replication/performance/status",
+				"replication/performance/internal/*",
+				"replication/dr/status",
+				"replication/dr/internal/*",
+				"mfa/validate",
 			},
 		},
 
@@ -124,6 +158,26 @@ func NewSystemBackend(core *Core) *SystemBackend {
 				HelpSynopsis:    strings.TrimSpace(sysHelp["config/cors"][1]),
 			},
 
+			&framework.Path{
+				Pattern: "config/est$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"mount": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The path of the PKI mount serving EST at the /.well-known/est/ path of the server.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleESTConfigRead,
+					logical.UpdateOperation: b.handleESTConfigUpdate,
+					logical.DeleteOperation: b.handleESTConfigDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["config/est"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["config/est"][1]),
+			},
+
 			&framework.Path{
 				Pattern: "capabilities$",
 
@@ -223,6 +277,22 @@ func NewSystemBackend(core *Core) *SystemBackend {
 						Type:        framework.TypeString,
 						Description: strings.TrimSpace(sysHelp["tune_max_lease_ttl"][0]),
 					},
+					"default_wrapping_ttl": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["tune_default_wrapping_ttl"][0]),
+					},
+					"max_wrapping_ttl": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["tune_max_wrapping_ttl"][0]),
+					},
+					"token_type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["tune_token_type"][0]),
+					},
+					"user_lockout_config": &framework.FieldSchema{
+						Type:        framework.TypeMap,
+						Description: strings.TrimSpace(sysHelp["tune_user_lockout_config"][0]),
+					},
 				},
 				Callbacks: map[logical.Operation]framework.OperationFunc{
 					logical.ReadOperation:   b.handleAuthTuneRead,
@@ -248,6 +318,14 @@ func NewSystemBackend(core *Core) *SystemBackend {
 						Type:        framework.TypeString,
 						Description: strings.TrimSpace(sysHelp["tune_max_lease_ttl"][0]),
 					},
+					"default_wrapping_ttl": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["tune_default_wrapping_ttl"][0]),
+					},
+					"max_wrapping_ttl": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["tune_max_wrapping_ttl"][0]),
+					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -430,6 +508,28 @@ func NewSystemBackend(core *Core) *SystemBackend {
 				HelpDescription: strings.TrimSpace(sysHelp["revoke-force"][1]),
 			},
 
+			&framework.Path{
+				Pattern: "leases/revoke-force-lease" + framework.OptionalParamRegex("url_lease_id"),
+
+				Fields: map[string]*framework.FieldSchema{
+					"url_lease_id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["lease_id"][0]),
+					},
+					"lease_id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["lease_id"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleRevokeForceLease,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["revoke-force-lease"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["revoke-force-lease"][1]),
+			},
+
 			&framework.Path{
 				Pattern: "(leases/)?revoke-prefix/(?P<prefix>.+)",
 
@@ -459,6 +559,43 @@ func NewSystemBackend(core *Core) *SystemBackend {
 				HelpDescription: strings.TrimSpace(sysHelp["tidy_leases"][1]),
 			},
 
+			&framework.Path{
+				Pattern: "leases/count$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["leases-count-type"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleLeaseCount,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["leases-count"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["leases-count"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "leases/irrevocable$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"limit": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Default:     10000,
+						Description: strings.TrimSpace(sysHelp["leases-irrevocable-limit"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleIrrevocableLeases,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["leases-irrevocable"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["leases-irrevocable"][1]),
+			},
+
 			&framework.Path{
 				Pattern: "auth$",
 
@@ -816,373 +953,3783 @@ func NewSystemBackend(core *Core) *SystemBackend {
 				HelpSynopsis:    strings.TrimSpace(sysHelp["plugin-catalog"][0]),
 				HelpDescription: strings.TrimSpace(sysHelp["plugin-catalog"][1]),
 			},
-		},
-	}
-
-	b.Backend.Paths = append(b.Backend.Paths, replicationPaths(b)...)
+			&framework.Path{
+				Pattern: "managed-keys/?$",
 
-	b.Backend.Invalidate = b.invalidate
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleManagedKeysList,
+				},
 
-	return b
-}
+				HelpSynopsis:    strings.TrimSpace(sysHelp["managed-keys"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["managed-keys"][1]),
+			},
+			&framework.Path{
+				Pattern: "managed-keys/(?P<name>.+)",
 
-// SystemBackend implements logical.Backend and is used to interact with
-// the core of the system. This backend is hardcoded to exist at the "sys"
-// prefix. Conceptually it is similar to procfs on Linux.
-type SystemBackend struct {
-	*framework.Backend
-	Core *Core
-}
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The name of the managed key",
+					},
+					"type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: `The type of device holding the key, such as "awskms"`,
+					},
+					"parameters": &framework.FieldSchema{
+						Type: framework.TypeMap,
+						Description: `Parameters used to access the key, which
+						depend on the type`,
+					},
+					"allowed_mounts": &framework.FieldSchema{
+						Type: framework.TypeCommaStringSlice,
+						Description: `Paths of the mounts allowed to use the key,
+						or "*" for all mounts`,
+					},
+				},
 
-// handleCORSRead returns the current CORS configuration
-func (b *SystemBackend) handleCORSRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	corsConf := b.Core.corsConfig
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleManagedKeysUpdate,
+					logical.DeleteOperation: b.handleManagedKeysDelete,
+					logical.ReadOperation:   b.handleManagedKeysRead,
+				},
 
-	enabled := corsConf.IsEnabled()
+				HelpSynopsis:    strings.TrimSpace(sysHelp["managed-keys"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["managed-keys"][1]),
+			},
+			&framework.Path{
+				Pattern: "policies/password/?$",
 
-	resp := &logical.Response{
-		Data: map[string]interface{}{
-			"enabled": enabled,
-		},
-	}
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handlePasswordPoliciesList,
+				},
 
-	if enabled {
-		corsConf.RLock()
-		resp.Data["allowed_origins"] = corsConf.AllowedOrigins
-		corsConf.RUnlock()
-	}
+				HelpSynopsis:    strings.TrimSpace(sysHelp["password-policies"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["password-policies"][1]),
+			},
+			&framework.Path{
+				Pattern: "policies/password/(?P<name>.+)/generate$",
 
-	return resp, nil
-}
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The name of the password policy",
+					},
+				},
 
-// handleCORSUpdate sets the list of origins that are allowed to make
-// cross-origin requests and sets the CORS enabled flag to true
-func (b *SystemBackend) handleCORSUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	origins := d.Get("allowed_origins").([]string)
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handlePasswordPoliciesGenerate,
+				},
 
-	return nil, b.Core.corsConfig.Enable(origins)
-}
+				HelpSynopsis:    strings.TrimSpace(sysHelp["password-policies-generate"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["password-policies-generate"][1]),
+			},
+			&framework.Path{
+				Pattern: "policies/password/(?P<name>.+)",
 
-// handleCORSDelete clears the allowed origins and sets the CORS enabled flag
-// to false
-func (b *SystemBackend) handleCORSDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	return nil, b.Core.corsConfig.Disable()
-}
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The name of the password policy",
+					},
+					"policy": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The password policy, in HCL or JSON",
+					},
+				},
 
-func (b *SystemBackend) handleTidyLeases(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	err := b.Core.expiration.Tidy()
-	if err != nil {
-		b.Backend.Logger().Error("sys: failed to tidy leases", "error", err)
-		return handleError(err)
-	}
-	return nil, err
-}
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handlePasswordPoliciesUpdate,
+					logical.DeleteOperation: b.handlePasswordPoliciesDelete,
+					logical.ReadOperation:   b.handlePasswordPoliciesRead,
+				},
 
-func (b *SystemBackend) invalidate(key string) {
-	if b.Core.logger.IsTrace() {
-		b.Core.logger.Trace("sys: invalidating key", "key", key)
-	}
-	switch {
-	case strings.HasPrefix(key, policySubPath):
-		b.Core.stateLock.RLock()
-		defer b.Core.stateLock.RUnlock()
-		if b.Core.policyStore != nil {
-			b.Core.policyStore.invalidate(strings.TrimPrefix(key, policySubPath))
-		}
-	}
-}
+				HelpSynopsis:    strings.TrimSpace(sysHelp["password-policies"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["password-policies"][1]),
+			},
+			&framework.Path{
+				Pattern: "groups/external/?$",
 
-func (b *SystemBackend) handlePluginCatalogList(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	plugins, err := b.Core.pluginCatalog.List()
-	if err != nil {
-		return nil, err
-	}
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleExternalGroupsList,
+				},
 
-	return logical.ListResponse(plugins), nil
-}
+				HelpSynopsis:    strings.TrimSpace(sysHelp["external-groups"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["external-groups"][1]),
+			},
+			&framework.Path{
+				Pattern: "groups/external/(?P<name>.+)",
 
-func (b *SystemBackend) handlePluginCatalogUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	pluginName := d.Get("name").(string)
-	if pluginName == "" {
-		return logical.ErrorResponse("missing plugin name"), nil
-	}
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The name of the external group",
+					},
+					"policies": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: "The policies granted to the members of the group",
+					},
+					"aliases": &framework.FieldSchema{
+						Type:        framework.TypeStringSlice,
+						Description: `The groups of auth backends making up the group, in the "<mount path>:<group name>" format`,
+					},
+				},
 
-	sha256 := d.Get("sha_256").(string)
-	if sha256 == "" {
-		return logical.ErrorResponse("missing SHA-256 value"), nil
-	}
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleExternalGroupsUpdate,
+					logical.DeleteOperation: b.handleExternalGroupsDelete,
+					logical.ReadOperation:   b.handleExternalGroupsRead,
+				},
 
-	command := d.Get("command").(string)
-	if command == "" {
-		return logical.ErrorResponse("missing command value"), nil
-	}
+				HelpSynopsis:    strings.TrimSpace(sysHelp["external-groups"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["external-groups"][1]),
+			},
+			&framework.Path{
+				Pattern: "entities/?$",
 
-	sha256Bytes, err := hex.DecodeString(sha256)
-	if err != nil {
-		return logical.ErrorResponse("Could not decode SHA-256 value from Hex"), err
-	}
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleEntitiesList,
+				},
 
-	err = b.Core.pluginCatalog.Set(pluginName, command, sha256Bytes)
-	if err != nil {
-		return nil, err
-	}
+				HelpSynopsis:    strings.TrimSpace(sysHelp["entities"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["entities"][1]),
+			},
+			&framework.Path{
+				Pattern: "entities/batch$",
 
-	return nil, nil
-}
+				Fields: map[string]*framework.FieldSchema{
+					"entities": &framework.FieldSchema{
+						Type:        framework.TypeSlice,
+						Description: `The entities to create, each with a "name", and optionally "metadata" and "aliases" having an "alias" and optionally "metadata"`,
+					},
+				},
 
-func (b *SystemBackend) handlePluginCatalogRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	pluginName := d.Get("name").(string)
-	if pluginName == "" {
-		return logical.ErrorResponse("missing plugin name"), nil
-	}
-	plugin, err := b.Core.pluginCatalog.Get(pluginName)
-	if err != nil {
-		return nil, err
-	}
-	if plugin == nil {
-		return nil, nil
-	}
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleEntitiesBatch,
+				},
 
-	return &logical.Response{
-		Data: map[string]interface{}{
-			"plugin": plugin,
-		},
-	}, nil
-}
+				HelpSynopsis:    strings.TrimSpace(sysHelp["entities-batch"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["entities-batch"][1]),
+			},
+			&framework.Path{
+				Pattern: "entities/merge$",
 
-func (b *SystemBackend) handlePluginCatalogDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	pluginName := d.Get("name").(string)
+				Fields: map[string]*framework.FieldSchema{
+					"to_entity": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The name of the entity to merge the entities into",
+					},
+					"from_entities": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: "The names of the entities to merge",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleEntitiesMerge,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["entities-merge"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["entities-merge"][1]),
+			},
+			&framework.Path{
+				Pattern: "entities/name/(?P<name>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The name of the entity",
+					},
+					"metadata": &framework.FieldSchema{
+						Type:        framework.TypeMap,
+						Description: "The metadata of the entity, available to backends templating from the identity of the requester",
+					},
+					"aliases": &framework.FieldSchema{
+						Type:        framework.TypeStringSlice,
+						Description: `The names of the entity in auth backends, in the "<mount path>:<name>" format`,
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleEntitiesUpdate,
+					logical.DeleteOperation: b.handleEntitiesDelete,
+					logical.ReadOperation:   b.handleEntitiesRead,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["entities"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["entities"][1]),
+			},
+			&framework.Path{
+				Pattern: "entity-aliases/(?P<alias>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"alias": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: `The alias, in the "<mount path>:<name>" format`,
+					},
+					"entity": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The name of the entity of the alias",
+					},
+					"metadata": &framework.FieldSchema{
+						Type:        framework.TypeMap,
+						Description: "The metadata of the alias",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleEntityAliasesUpdate,
+					logical.DeleteOperation: b.handleEntityAliasesDelete,
+					logical.ReadOperation:   b.handleEntityAliasesRead,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["entity-aliases"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["entity-aliases"][1]),
+			},
+			&framework.Path{
+				Pattern: "control-group/request$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"accessor": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The accessor of the wrapping token of the request",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleControlGroupRequest,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["control-group-request"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["control-group-request"][1]),
+			},
+			&framework.Path{
+				Pattern: "control-group/authorize$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"accessor": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The accessor of the wrapping token of the request",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleControlGroupAuthorize,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["control-group-authorize"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["control-group-authorize"][1]),
+			},
+			&framework.Path{
+				Pattern: "namespaces/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleNamespacesList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["namespaces"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["namespaces"][1]),
+			},
+			&framework.Path{
+				Pattern: "namespaces/(?P<name>[^/]+)$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The name of the namespace",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleNamespacesCreate,
+					logical.DeleteOperation: b.handleNamespacesDelete,
+					logical.ReadOperation:   b.handleNamespacesRead,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["namespaces"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["namespaces"][1]),
+			},
+			&framework.Path{
+				Pattern: "locked-users/?$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"mount": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The path of an auth mount to only return the locked users of",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleLockedUsersRead,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["locked-users"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["locked-users"][1]),
+			},
+			&framework.Path{
+				Pattern: "locked-users/(?P<mount>.+)/unlock/(?P<user>[^/]+)$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"mount": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The path of the auth mount",
+					},
+					"user": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The name of the user to unlock",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleLockedUsersUnlock,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["locked-users"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["locked-users"][1]),
+			},
+			&framework.Path{
+				Pattern: "mfa/validate$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"mfa_request_id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The ID of the MFA request returned by the login",
+					},
+					"mfa_payload": &framework.FieldSchema{
+						Type:        framework.TypeMap,
+						Description: "The passcodes of the MFA methods used, keyed by method ID. Methods using push notifications are given an empty list.",
+					},
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-validate"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa-validate"][1]),
+			},
+			&framework.Path{
+				Pattern: "mfa/method/?$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The type of the MFA methods",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleMFAMethodList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-method"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa-method"][1]),
+			},
+			&framework.Path{
+				Pattern: "mfa/method/totp/generate$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"method_id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The ID of the TOTP MFA method",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleMFATOTPGenerate,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-totp-generate"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa-totp-generate"][1]),
+			},
+			&framework.Path{
+				Pattern: "mfa/method/totp/admin-(?P<action>generate|destroy)$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"action": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Whether to generate or destroy the secret",
+					},
+					"method_id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The ID of the TOTP MFA method",
+					},
+					"entity_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The name of the entity, which is the display name of its tokens",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleMFATOTPAdmin,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-totp-admin"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa-totp-admin"][1]),
+			},
+			&framework.Path{
+				Pattern: "mfa/method/(?P<type>totp|duo|okta|pingid)/?$",
+
+				Fields: mfaMethodFields(),
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation:   b.handleMFAMethodList,
+					logical.UpdateOperation: b.handleMFAMethodUpdate,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-method"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa-method"][1]),
+			},
+			&framework.Path{
+				Pattern: "mfa/method/(?P<type>totp|duo|okta|pingid)/(?P<method_id>[^/]+)$",
+
+				Fields: mfaMethodFields(),
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleMFAMethodRead,
+					logical.UpdateOperation: b.handleMFAMethodUpdate,
+					logical.DeleteOperation: b.handleMFAMethodDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-method"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa-method"][1]),
+			},
+			&framework.Path{
+				Pattern: "mfa/login-enforcement/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleMFAEnforcementList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-login-enforcement"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa-login-enforcement"][1]),
+			},
+			&framework.Path{
+				Pattern: "mfa/login-enforcement/(?P<name>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The name of the login enforcement",
+					},
+					"mfa_method_ids": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: "The IDs of the MFA methods, any of which satisfies the enforcement",
+					},
+					"auth_method_paths": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: "The mount paths of the auth backends whose logins are subject to the enforcement",
+					},
+					"auth_method_types": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: "The types of the auth backends whose logins are subject to the enforcement",
+					},
+					"identity_entity_names": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: "The names of the entities subject to the enforcement, which are the display names of their tokens",
+					},
+					"identity_group_names": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: "The names of the external groups whose members are subject to the enforcement",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleMFAEnforcementUpdate,
+					logical.DeleteOperation: b.handleMFAEnforcementDelete,
+					logical.ReadOperation:   b.handleMFAEnforcementRead,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-login-enforcement"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa-login-enforcement"][1]),
+			},
+			&framework.Path{
+				Pattern: "sync/destinations/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleSyncDestinationsList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["sync-destinations"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["sync-destinations"][1]),
+			},
+			&framework.Path{
+				Pattern: "sync/destinations/(?P<type>[^/]+)/(?P<name>[^/]+)$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The type of the destination: aws-sm, azure-kv or gcp-sm",
+					},
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The name of the destination",
+					},
+					"parameters": &framework.FieldSchema{
+						Type:        framework.TypeMap,
+						Description: "The parameters used to access the destination, which depend on its type",
+					},
+					"fields": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: "The fields of the secrets pushed to the destination. All fields are pushed if empty.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleSyncDestinationsUpdate,
+					logical.DeleteOperation: b.handleSyncDestinationsDelete,
+					logical.ReadOperation:   b.handleSyncDestinationsRead,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["sync-destinations"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["sync-destinations"][1]),
+			},
+			&framework.Path{
+				Pattern: "sync/destinations/(?P<type>[^/]+)/(?P<name>[^/]+)/associations$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The type of the destination",
+					},
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The name of the destination",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleSyncAssociationsRead,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["sync-associations"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["sync-associations"][1]),
+			},
+			&framework.Path{
+				Pattern: "sync/destinations/(?P<type>[^/]+)/(?P<name>[^/]+)/associations/(?P<action>set|remove)$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The type of the destination",
+					},
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The name of the destination",
+					},
+					"action": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Whether to set or remove the association",
+					},
+					"mount": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The path of the KV mount of the secret",
+					},
+					"secret_path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The path of the secret within the mount",
+					},
+					"secret_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The name of the secret in the destination. Defaults to a name derived from the mount and path.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleSyncAssociationsUpdate,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["sync-associations"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["sync-associations"][1]),
+			},
+			&framework.Path{
+				Pattern: "sync/destinations/(?P<type>[^/]+)/(?P<name>[^/]+)/drift$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The type of the destination",
+					},
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The name of the destination",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleSyncDriftRead,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["sync-drift"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["sync-drift"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "storage/raft/configuration$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleRaftConfigurationRead,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["raft-configuration"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["raft-configuration"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "storage/raft/remove-peer$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"server_id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The node ID of the server to remove from the raft cluster.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleRaftRemovePeer,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["raft-remove-peer"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["raft-remove-peer"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "storage/raft/transfer-leadership$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"server_id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The node ID of the voter to hand the leadership over to. Defaults to the most up to date voter.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleRaftTransferLeadership,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["raft-transfer-leadership"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["raft-transfer-leadership"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "storage/raft/snapshot$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleRaftSnapshotRead,
+					logical.UpdateOperation: b.handleRaftSnapshotRestore(false),
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["raft-snapshot"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["raft-snapshot"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "storage/raft/snapshot-force$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleRaftSnapshotRestore(true),
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["raft-snapshot-force"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["raft-snapshot-force"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "storage/raft/autopilot/configuration$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"cleanup_dead_servers": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: "Whether to remove the dead servers from the raft cluster.",
+					},
+					"last_contact_threshold": &framework.FieldSchema{
+						Type:        framework.TypeDurationSecond,
+						Description: "How long a server may go without contacting the leader before being unhealthy.",
+					},
+					"dead_server_last_contact_threshold": &framework.FieldSchema{
+						Type:        framework.TypeDurationSecond,
+						Description: "How long a server may go without contacting the leader before being removed as dead. Must be at least one minute.",
+					},
+					"max_trailing_logs": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "How many log entries a server may lag behind the leader before being unhealthy.",
+					},
+					"min_quorum": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "The number of voters below which dead voters are not removed. Must be at least 3 when removing the dead servers.",
+					},
+					"server_stabilization_time": &framework.FieldSchema{
+						Type:        framework.TypeDurationSecond,
+						Description: "How long a new server must be healthy before being promoted to a voter.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleRaftAutopilotConfigRead,
+					logical.UpdateOperation: b.handleRaftAutopilotConfigUpdate,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["raft-autopilot-configuration"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["raft-autopilot-configuration"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "storage/raft/autopilot/state$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleRaftAutopilotStateRead,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["raft-autopilot-state"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["raft-autopilot-state"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "storage/raft/snapshot-auto/config/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleRaftSnapshotAutoConfigList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["raft-snapshot-auto-config"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["raft-snapshot-auto-config"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "storage/raft/snapshot-auto/config/(?P<name>[^/]+)$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The name of the configuration.",
+					},
+					"interval": &framework.FieldSchema{
+						Type:        framework.TypeDurationSecond,
+						Description: "How often to take a snapshot. Required when creating the configuration.",
+					},
+					"retain": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Default:     1,
+						Description: "How many snapshots to keep in the storage. Older snapshots are deleted after each upload.",
+					},
+					"path_prefix": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The directory of the snapshots in the storage.",
+					},
+					"file_prefix": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Default:     raftSnapshotAutoDefaultFilePrefix,
+						Description: "The prefix of the names of the snapshots, which are followed by the time of the snapshot.",
+					},
+					"storage_type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The type of the storage the snapshots are uploaded to: local, aws-s3, google-gcs or azure-blob.",
+					},
+					"parameters": &framework.FieldSchema{
+						Type:        framework.TypeMap,
+						Description: "The parameters used to access the storage, which depend on its type.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleRaftSnapshotAutoConfigRead,
+					logical.UpdateOperation: b.handleRaftSnapshotAutoConfigUpdate,
+					logical.DeleteOperation: b.handleRaftSnapshotAutoConfigDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["raft-snapshot-auto-config"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["raft-snapshot-auto-config"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "storage/raft/snapshot-auto/status/(?P<name>[^/]+)$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The name of the configuration.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleRaftSnapshotAutoStatusRead,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["raft-snapshot-auto-status"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["raft-snapshot-auto-status"][1]),
+			},
+		},
+	}
+
+	b.Backend.Paths = append(b.Backend.Paths, replicationPaths(b)...)
+	b.Backend.Paths = append(b.Backend.Paths, b.rulePolicyPaths(rulePolicyTypeRGP)...)
+	b.Backend.Paths = append(b.Backend.Paths, b.rulePolicyPaths(rulePolicyTypeEGP)...)
+	b.Backend.Paths = append(b.Backend.Paths, b.quotaPaths()...)
+
+	b.Backend.Invalidate = b.invalidate
+
+	return b
+}
+
+// SystemBackend implements logical.Backend and is used to interact with
+// the core of the system. This backend is hardcoded to exist at the "sys"
+// prefix. Conceptually it is similar to procfs on Linux.
+type SystemBackend struct {
+	*framework.Backend
+	Core *Core
+}
+
+// namespace returns the namespace of the system backend a request was
+// routed to
+func (b *SystemBackend) namespace(req *logical.Request) *NamespaceEntry {
+	if me := b.Core.router.MatchingMountEntry(req.MountPoint); me != nil {
+		return me.Namespace()
+	}
+	return rootNamespace
+}
+
+// handleCORSRead returns the current CORS configuration
+func (b *SystemBackend) handleCORSRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	corsConf := b.Core.corsConfig
+
+	enabled := corsConf.IsEnabled()
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"enabled": enabled,
+		},
+	}
+
+	if enabled {
+		corsConf.RLock()
+		resp.Data["allowed_origins"] = corsConf.AllowedOrigins
+		corsConf.RUnlock()
+	}
+
+	return resp, nil
+}
+
+// handleCORSUpdate sets the list of origins that are allowed to make
+// cross-origin requests and sets the CORS enabled flag to true
+func (b *SystemBackend) handleCORSUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	origins := d.Get("allowed_origins").([]string)
+
+	return nil, b.Core.corsConfig.Enable(origins)
+}
+
+// handleCORSDelete clears the allowed origins and sets the CORS enabled flag
+// to false
+func (b *SystemBackend) handleCORSDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return nil, b.Core.corsConfig.Disable()
+}
+
+// handleESTConfigRead returns the PKI mount serving EST at the standard path
+func (b *SystemBackend) handleESTConfigRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"mount": b.Core.ESTMount(),
+		},
+	}, nil
+}
+
+// handleESTConfigUpdate sets the PKI mount serving EST at the standard path
+func (b *SystemBackend) handleESTConfigUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	mount := strings.Trim(d.Get("mount").(string), "/")
+	if mount == "" {
+		return logical.ErrorResponse("missing mount"), nil
+	}
+	mount += "/"
+
+	if me := b.Core.router.MatchingMountEntry(mount); me == nil || b.Core.router.MatchingMount(mount) != mount || me.Type != "pki" {
+		return logical.ErrorResponse(fmt.Sprintf("no PKI backend is mounted at %q", mount)), nil
+	}
+
+	return nil, b.Core.saveESTConfig(&ESTConfig{Mount: mount})
+}
+
+// handleESTConfigDelete stops serving EST at the standard path
+func (b *SystemBackend) handleESTConfigDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return nil, b.Core.saveESTConfig(&ESTConfig{})
+}
+
+func (b *SystemBackend) handleTidyLeases(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	err := b.Core.expiration.Tidy()
+	if err != nil {
+		b.Backend.Logger().Error("sys: failed to tidy leases", "error", err)
+		return handleError(err)
+	}
+	return nil, err
+}
+
+func (b *SystemBackend) invalidate(key string) {
+	if b.Core.logger.IsTrace() {
+		b.Core.logger.Trace("sys: invalidating key", "key", key)
+	}
+	switch {
+	case strings.HasPrefix(key, policySubPath):
+		b.Core.stateLock.RLock()
+		defer b.Core.stateLock.RUnlock()
+		if b.Core.policyStore != nil {
+			b.Core.policyStore.invalidate(strings.TrimPrefix(key, policySubPath))
+		}
+	}
+}
+
+func (b *SystemBackend) handlePluginCatalogList(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	plugins, err := b.Core.pluginCatalog.List()
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(plugins), nil
+}
+
+func (b *SystemBackend) handlePluginCatalogUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	pluginName := d.Get("name").(string)
+	if pluginName == "" {
+		return logical.ErrorResponse("missing plugin name"), nil
+	}
+
+	sha256 := d.Get("sha_256").(string)
+	if sha256 == "" {
+		return logical.ErrorResponse("missing SHA-256 value"), nil
+	}
+
+	command := d.Get("command").(string)
+	if command == "" {
+		return logical.ErrorResponse("missing command value"), nil
+	}
+
+	sha256Bytes, err := hex.DecodeString(sha256)
+	if err != nil {
+		return logical.ErrorResponse("Could not decode SHA-256 value from Hex"), err
+	}
+
+	err = b.Core.pluginCatalog.Set(pluginName, command, sha256Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handlePluginCatalogRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	pluginName := d.Get("name").(string)
+	if pluginName == "" {
+		return logical.ErrorResponse("missing plugin name"), nil
+	}
+	plugin, err := b.Core.pluginCatalog.Get(pluginName)
+	if err != nil {
+		return nil, err
+	}
+	if plugin == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"plugin": plugin,
+		},
+	}, nil
+}
+
+func (b *SystemBackend) handleManagedKeysList(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	keys, err := b.Core.managedKeyRegistry.List()
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(keys), nil
+}
+
+func (b *SystemBackend) handleManagedKeysUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing managed key name"), nil
+	}
+
+	keyType := d.Get("type").(string)
+	if keyType == "" {
+		return logical.ErrorResponse("missing managed key type"), nil
+	}
+
+	var parameters map[string]string
+	if err := mapstructure.Decode(d.Get("parameters"), &parameters); err != nil {
+		return logical.ErrorResponse("managed key parameters must be strings"), nil
+	}
+
+	// Mount paths are stored with a trailing slash, as in the mount table
+	var allowedMounts []string
+	for _, mount := range d.Get("allowed_mounts").([]string) {
+		if mount != "*" && !strings.HasSuffix(mount, "/") {
+			mount += "/"
+		}
+		allowedMounts = append(allowedMounts, mount)
+	}
+
+	entry := &ManagedKeyEntry{
+		Name:          name,
+		Type:          keyType,
+		Parameters:    parameters,
+		AllowedMounts: allowedMounts,
+	}
+	if err := managedkeys.ValidateParameters(keyType, parameters); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := b.Core.managedKeyRegistry.Set(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handleManagedKeysRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing managed key name"), nil
+	}
+	entry, err := b.Core.managedKeyRegistry.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	parameters := make(map[string]string, len(entry.Parameters))
+	for k, v := range entry.Parameters {
+		parameters[k] = v
+	}
+	for _, sensitive := range managedkeys.SensitiveParameters(entry.Type) {
+		delete(parameters, sensitive)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"type":           entry.Type,
+			"parameters":     parameters,
+			"allowed_mounts": entry.AllowedMounts,
+		},
+	}, nil
+}
+
+func (b *SystemBackend) handleManagedKeysDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing managed key name"), nil
+	}
+	if err := b.Core.managedKeyRegistry.Delete(name); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handlePasswordPoliciesList(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	names, err := b.Core.passwordPolicyStore.List()
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(names), nil
+}
+
+func (b *SystemBackend) handlePasswordPoliciesUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing password policy name"), nil
+	}
+
+	policy := d.Get("policy").(string)
+	if policy == "" {
+		return logical.ErrorResponse("missing password policy"), nil
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(policy); err == nil {
+		policy = string(decoded)
+	}
+
+	// Policies must be able to generate passwords before being stored
+	parsed, err := passwordpolicy.Parse(policy)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if _, err := parsed.Generate(); err != nil {
+		return nil, err
+	}
+
+	if err := b.Core.passwordPolicyStore.Set(&PasswordPolicyEntry{
+		Name:   name,
+		Policy: policy,
+	}); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handlePasswordPoliciesRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing password policy name"), nil
+	}
+	entry, err := b.Core.passwordPolicyStore.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"policy": entry.Policy,
+		},
+	}, nil
+}
+
+func (b *SystemBackend) handlePasswordPoliciesDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing password policy name"), nil
+	}
+	if err := b.Core.passwordPolicyStore.Delete(name); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handlePasswordPoliciesGenerate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	policy, err := b.Core.passwordPolicyStore.Policy(name)
+	if err == passwordpolicy.ErrNotFound {
+		return logical.ErrorResponse(fmt.Sprintf("password policy %q not found", name)), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := policy.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"password": password,
+		},
+	}, nil
+}
+
+// rulePolicyPaths returns the paths managing the rule policies of the given
+// type, under policies/<kind>/
+func (b *SystemBackend) rulePolicyPaths(kind string) []*framework.Path {
+	fields := map[string]*framework.FieldSchema{
+		"name": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The name of the policy",
+		},
+		"policy": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The rules of the policy, optionally base64-encoded",
+		},
+		"enforcement_level": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Default:     enforcementLevelHardMandatory,
+			Description: "The enforcement level of the policy: advisory, soft-mandatory or hard-mandatory",
+		},
+	}
+	if kind == rulePolicyTypeEGP {
+		fields["paths"] = &framework.FieldSchema{
+			Type:        framework.TypeCommaStringSlice,
+			Description: `The request paths the policy applies to, which are prefixes when ending with "*"`,
+		}
+	}
+
+	return []*framework.Path{
+		&framework.Path{
+			Pattern: "policies/" + kind + "/?$",
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.handleRulePoliciesList(kind),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp[kind][0]),
+			HelpDescription: strings.TrimSpace(sysHelp[kind][1]),
+		},
+		&framework.Path{
+			Pattern: "policies/" + kind + "/(?P<name>.+)",
+
+			Fields: fields,
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.handleRulePoliciesUpdate(kind),
+				logical.DeleteOperation: b.handleRulePoliciesDelete(kind),
+				logical.ReadOperation:   b.handleRulePoliciesRead(kind),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp[kind][0]),
+			HelpDescription: strings.TrimSpace(sysHelp[kind][1]),
+		},
+	}
+}
+
+// rulePolicyStore returns the store of the rule policies of the given type.
+// Rule policies are only managed in the root namespace.
+func (b *SystemBackend) rulePolicyStore(req *logical.Request, kind string) (*RulePolicyStore, *logical.Response) {
+	if b.namespace(req).ID != rootNamespaceID {
+		return nil, logical.ErrorResponse("rule policies can only be managed in the root namespace")
+	}
+	return b.Core.rulePolicyStore(kind), nil
+}
+
+func (b *SystemBackend) handleRulePoliciesList(kind string) framework.OperationFunc {
+	return func(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		store, errResp := b.rulePolicyStore(req, kind)
+		if errResp != nil {
+			return errResp, logical.ErrInvalidRequest
+		}
+
+		names, err := store.List()
+		if err != nil {
+			return nil, err
+		}
+		return logical.ListResponse(names), nil
+	}
+}
+
+func (b *SystemBackend) handleRulePoliciesUpdate(kind string) framework.OperationFunc {
+	return func(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		store, errResp := b.rulePolicyStore(req, kind)
+		if errResp != nil {
+			return errResp, logical.ErrInvalidRequest
+		}
+
+		name := d.Get("name").(string)
+		if name == "" {
+			return logical.ErrorResponse("missing policy name"), nil
+		}
+		policy := d.Get("policy").(string)
+		if policy == "" {
+			return logical.ErrorResponse("missing policy"), nil
+		}
+		if decoded, err := base64.StdEncoding.DecodeString(policy); err == nil {
+			policy = string(decoded)
+		}
+
+		entry := &RulePolicyEntry{
+			Name:             name,
+			Policy:           policy,
+			EnforcementLevel: d.Get("enforcement_level").(string),
+		}
+		if kind == rulePolicyTypeEGP {
+			entry.Paths = d.Get("paths").([]string)
+		}
+		if err := store.Set(entry); err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+
+		return nil, nil
+	}
+}
+
+func (b *SystemBackend) handleRulePoliciesRead(kind string) framework.OperationFunc {
+	return func(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		store, errResp := b.rulePolicyStore(req, kind)
+		if errResp != nil {
+			return errResp, logical.ErrInvalidRequest
+		}
+
+		entry, err := store.Get(d.Get("name").(string))
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			return nil, nil
+		}
+
+		resp := &logical.Response{
+			Data: map[string]interface{}{
+				"name":              entry.Name,
+				"policy":            entry.Policy,
+				"enforcement_level": entry.EnforcementLevel,
+			},
+		}
+		if kind == rulePolicyTypeEGP {
+			resp.Data["paths"] = entry.Paths
+		}
+		return resp, nil
+	}
+}
+
+func (b *SystemBackend) handleRulePoliciesDelete(kind string) framework.OperationFunc {
+	return func(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		store, errResp := b.rulePolicyStore(req, kind)
+		if errResp != nil {
+			return errResp, logical.ErrInvalidRequest
+		}
+
+		if err := store.Delete(d.Get("name").(string)); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+}
+
+// quotaPaths returns the paths managing the quotas, under quotas/
+func (b *SystemBackend) quotaPaths() []*framework.Path {
+	return []*framework.Path{
+		&framework.Path{
+			Pattern: "quotas/config$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"rate_limit_exempt_paths": &framework.FieldSchema{
+					Type:        framework.TypeCommaStringSlice,
+					Description: "The request path prefixes not subject to rate limit quotas",
+				},
+				"enable_rate_limit_audit_logging": &framework.FieldSchema{
+					Type:        framework.TypeBool,
+					Description: "Whether the requests rejected by rate limit quotas are audit logged",
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.handleQuotasConfigUpdate,
+				logical.ReadOperation:   b.handleQuotasConfigRead,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["quotas-config"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["quotas-config"][1]),
+		},
+		&framework.Path{
+			Pattern: "quotas/rate-limit/?$",
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.handleRateLimitQuotasList,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["rate-limit-quotas"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["rate-limit-quotas"][1]),
+		},
+		&framework.Path{
+			Pattern: "quotas/rate-limit/(?P<name>.+)",
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The name of the quota",
+				},
+				"path": &framework.FieldSchema{
+					Type: framework.TypeString,
+					Description: `The namespace, mount or request path prefix the
+					quota applies to, or empty for all the requests`,
+				},
+				"rate": &framework.FieldSchema{
+					Type:        framework.TypeInt,
+					Description: "The number of requests allowed per interval to each client",
+				},
+				"interval": &framework.FieldSchema{
+					Type:        framework.TypeDurationSecond,
+					Default:     int(rateLimitDefaultInterval.Seconds()),
+					Description: "The interval the requests are counted over",
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.handleRateLimitQuotasUpdate,
+				logical.DeleteOperation: b.handleRateLimitQuotasDelete,
+				logical.ReadOperation:   b.handleRateLimitQuotasRead,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["rate-limit-quotas"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["rate-limit-quotas"][1]),
+		},
+		&framework.Path{
+			Pattern: "quotas/lease-count/?$",
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.handleLeaseCountQuotasList,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["lease-count-quotas"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["lease-count-quotas"][1]),
+		},
+		&framework.Path{
+			Pattern: "quotas/lease-count/(?P<name>.+)",
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The name of the quota",
+				},
+				"path": &framework.FieldSchema{
+					Type: framework.TypeString,
+					Description: `The namespace, mount or request path prefix the
+					quota applies to, or empty for all the leases`,
+				},
+				"max_leases": &framework.FieldSchema{
+					Type:        framework.TypeInt,
+					Description: "The maximum number of leases of the path",
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.handleLeaseCountQuotasUpdate,
+				logical.DeleteOperation: b.handleLeaseCountQuotasDelete,
+				logical.ReadOperation:   b.handleLeaseCountQuotasRead,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["lease-count-quotas"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["lease-count-quotas"][1]),
+		},
+	}
+}
+
+// quotaPath canonicalizes the path of a quota, which must be empty or the
+// path of a namespace or within a mount. Namespaces and mounts are given a
+// trailing slash.
+func (b *SystemBackend) quotaPath(path string) (string, error) {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return "", nil
+	}
+	if ns := b.Core.namespaceStore.ByPath(path); ns != nil {
+		return ns.Path, nil
+	}
+
+	mount := b.Core.router.MatchingMount(path + "/")
+	if mount == "" {
+		return "", fmt.Errorf("no namespace or mount at path %q", path)
+	}
+	if mount == path+"/" {
+		return mount, nil
+	}
+	return path, nil
+}
+
+// checkQuotasNamespace returns an error response unless the request is made
+// in the root namespace, where quotas are managed
+func (b *SystemBackend) checkQuotasNamespace(req *logical.Request) *logical.Response {
+	if b.namespace(req).ID != rootNamespaceID {
+		return logical.ErrorResponse("quotas can only be managed in the root namespace")
+	}
+	return nil
+}
+
+func (b *SystemBackend) handleQuotasConfigRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if errResp := b.checkQuotasNamespace(req); errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+
+	config := b.Core.quotaManager.Config()
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"rate_limit_exempt_paths":         config.RateLimitExemptPaths,
+			"enable_rate_limit_audit_logging": config.EnableRateLimitAuditLogging,
+		},
+	}, nil
+}
+
+func (b *SystemBackend) handleQuotasConfigUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if errResp := b.checkQuotasNamespace(req); errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+
+	config := b.Core.quotaManager.Config()
+	if raw, ok := d.GetOk("rate_limit_exempt_paths"); ok {
+		config.RateLimitExemptPaths = raw.([]string)
+	}
+	if raw, ok := d.GetOk("enable_rate_limit_audit_logging"); ok {
+		config.EnableRateLimitAuditLogging = raw.(bool)
+	}
+	if err := b.Core.quotaManager.SetConfig(config); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handleRateLimitQuotasList(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if errResp := b.checkQuotasNamespace(req); errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+
+	return logical.ListResponse(b.Core.quotaManager.RateLimitQuotas()), nil
+}
+
+func (b *SystemBackend) handleRateLimitQuotasUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if errResp := b.checkQuotasNamespace(req); errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing quota name"), nil
+	}
+	path, err := b.quotaPath(d.Get("path").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.quotaManager.SetRateLimitQuota(&RateLimitQuota{
+		Name:     name,
+		Path:     path,
+		Rate:     d.Get("rate").(int),
+		Interval: time.Duration(d.Get("interval").(int)) * time.Second,
+	}); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handleRateLimitQuotasRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if errResp := b.checkQuotasNamespace(req); errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+
+	quota := b.Core.quotaManager.RateLimitQuota(d.Get("name").(string))
+	if quota == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":     quota.Name,
+			"path":     quota.Path,
+			"rate":     quota.Rate,
+			"interval": int64(quota.Interval.Seconds()),
+		},
+	}, nil
+}
+
+func (b *SystemBackend) handleRateLimitQuotasDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if errResp := b.checkQuotasNamespace(req); errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.quotaManager.DeleteRateLimitQuota(d.Get("name").(string)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *SystemBackend) handleLeaseCountQuotasList(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if errResp := b.checkQuotasNamespace(req); errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+
+	return logical.ListResponse(b.Core.quotaManager.LeaseCountQuotas()), nil
+}
+
+func (b *SystemBackend) handleLeaseCountQuotasUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if errResp := b.checkQuotasNamespace(req); errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing quota name"), nil
+	}
+	path, err := b.quotaPath(d.Get("path").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.quotaManager.SetLeaseCountQuota(&LeaseCountQuota{
+		Name:      name,
+		Path:      path,
+		MaxLeases: d.Get("max_leases").(int),
+	}); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	// The leases are counted again under the path of the quota
+	b.Core.expiration.resetQuotaCounts()
+	return nil, nil
+}
+
+func (b *SystemBackend) handleLeaseCountQuotasRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if errResp := b.checkQuotasNamespace(req); errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+
+	quota := b.Core.quotaManager.LeaseCountQuota(d.Get("name").(string))
+	if quota == nil {
+		return nil, nil
+	}
+
+	count, err := b.Core.expiration.quotaCount(quota.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":       quota.Name,
+			"path":       quota.Path,
+			"max_leases": quota.MaxLeases,
+			"counter":    count,
+		},
+	}, nil
+}
+
+func (b *SystemBackend) handleLeaseCountQuotasDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if errResp := b.checkQuotasNamespace(req); errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.quotaManager.DeleteLeaseCountQuota(d.Get("name").(string)); err != nil {
+		return nil, err
+	}
+	b.Core.expiration.resetQuotaCounts()
+	return nil, nil
+}
+
+func (b *SystemBackend) handleExternalGroupsList(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	names, err := b.Core.externalGroupStoreForNamespace(b.namespace(req)).List()
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(names), nil
+}
+
+func (b *SystemBackend) handleExternalGroupsUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing external group name"), nil
+	}
+
+	entry, err := b.Core.externalGroupStoreForNamespace(b.namespace(req)).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		entry = &ExternalGroupEntry{Name: name}
+	}
+
+	if raw, ok := d.GetOk("policies"); ok {
+		entry.Policies = policyutil.SanitizePolicies(raw.([]string), false)
+		for _, policy := range entry.Policies {
+			if policy == "root" || strutil.StrListContains(nonAssignablePolicies, policy) {
+				return logical.ErrorResponse(fmt.Sprintf("cannot assign policy %q", policy)), nil
+			}
+		}
+	}
+	if raw, ok := d.GetOk("aliases"); ok {
+		entry.Aliases = nil
+		for _, s := range raw.([]string) {
+			alias, err := ParseExternalGroupAlias(s)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+			entry.Aliases = append(entry.Aliases, alias)
+		}
+	}
+
+	if err := b.Core.externalGroupStoreForNamespace(b.namespace(req)).Set(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handleExternalGroupsRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing external group name"), nil
+	}
+	entry, err := b.Core.externalGroupStoreForNamespace(b.namespace(req)).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	aliases := make([]string, 0, len(entry.Aliases))
+	for _, alias := range entry.Aliases {
+		aliases = append(aliases, alias.String())
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"policies": entry.Policies,
+			"aliases":  aliases,
+		},
+	}, nil
+}
+
+func (b *SystemBackend) handleExternalGroupsDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing external group name"), nil
+	}
+	if err := b.Core.externalGroupStoreForNamespace(b.namespace(req)).Delete(name); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// controlGroupRequest returns the control group request whose wrapping token
+// has the accessor given in the request, and its wrapping token. It returns
+// an error response if there is none.
+func (b *SystemBackend) controlGroupRequest(d *framework.FieldData) (string, *controlGroupRequest, *logical.Response, error) {
+	accessor := d.Get("accessor").(string)
+	if accessor == "" {
+		return "", nil, logical.ErrorResponse("missing accessor"), logical.ErrInvalidRequest
+	}
+
+	token, err := b.Core.controlGroupWrappingToken(accessor)
+	if err != nil {
+		return "", nil, logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	request, err := b.Core.controlGroupRequest(token)
+	if err != nil {
+		resp, err := handleError(err)
+		return "", nil, resp, err
+	}
+	if request == nil {
+		return "", nil, logical.ErrorResponse("no control group request found for the accessor"), logical.ErrInvalidRequest
+	}
+	return token, request, nil, nil
+}
+
+func (b *SystemBackend) handleControlGroupRequest(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	_, request, resp, err := b.controlGroupRequest(d)
+	if request == nil {
+		return resp, err
+	}
+
+	return &logical.Response{
+		Data: controlGroupStatus(request),
+	}, nil
+}
+
+func (b *SystemBackend) handleControlGroupAuthorize(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	te, err := b.Core.tokenStore.Lookup(req.ClientToken)
+	if err != nil {
+		return handleError(err)
+	}
+	if te == nil {
+		return nil, logical.ErrPermissionDenied
+	}
+
+	b.Core.controlGroupLock.Lock()
+	defer b.Core.controlGroupLock.Unlock()
+
+	token, request, resp, err := b.controlGroupRequest(d)
+	if request == nil {
+		return resp, err
+	}
+	if te.Accessor != "" && te.Accessor == request.RequesterAccessor ||
+		te.EntityName != "" && te.EntityName == request.RequesterEntity {
+		return logical.ErrorResponse("requesters cannot authorize their own requests"), logical.ErrPermissionDenied
+	}
+
+	if !request.approved() {
+		if !request.authorize(te) {
+			return logical.ErrorResponse("token is not allowed to authorize the request"), logical.ErrPermissionDenied
+		}
+		if err := b.Core.persistControlGroupRequest(token, request); err != nil {
+			return handleError(err)
+		}
+		b.Core.logger.Info("core: control group request authorized", "request_path", request.Path, "approver", te.DisplayName)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"approved": request.approved(),
+		},
+	}, nil
+}
+
+func (b *SystemBackend) handleNamespacesList(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	var names []string
+	for _, ns := range b.Core.namespaceStore.Children(b.namespace(req)) {
+		names = append(names, ns.Name()+"/")
+	}
+
+	return logical.ListResponse(names), nil
+}
+
+func (b *SystemBackend) handleNamespacesRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns := b.Core.namespaceStore.ByPath(b.namespace(req).Path + d.Get("name").(string))
+	if ns == nil {
+		return nil, nil
+	}
+
+	return namespaceResponse(ns), nil
+}
+
+func (b *SystemBackend) handleNamespacesCreate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing namespace name"), nil
+	}
+
+	ns, err := b.Core.createNamespace(b.namespace(req), name)
+	if err != nil {
+		b.Backend.Logger().Error("sys: namespace creation failed", "name", name, "error", err)
+		return handleError(err)
+	}
+
+	return namespaceResponse(ns), nil
+}
+
+func (b *SystemBackend) handleNamespacesDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns := b.Core.namespaceStore.ByPath(b.namespace(req).Path + d.Get("name").(string))
+	if ns == nil || ns.ID == rootNamespaceID {
+		return nil, nil
+	}
+
+	if err := b.Core.deleteNamespace(ns); err != nil {
+		b.Backend.Logger().Error("sys: namespace deletion failed", "path", ns.Path, "error", err)
+		return handleError(err)
+	}
+
+	return nil, nil
+}
+
+func namespaceResponse(ns *NamespaceEntry) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"id":   ns.ID,
+			"path": ns.Path,
+		},
+	}
+}
+
+func (b *SystemBackend) handleEntitiesList(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	names, err := b.Core.entityStoreForNamespace(b.namespace(req)).List()
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(names), nil
+}
+
+// entityMetadata decodes the metadata of an entity or alias
+func entityMetadata(raw interface{}) (map[string]string, error) {
+	var meta map[string]string
+	if err := mapstructure.WeakDecode(raw, &meta); err != nil {
+		return nil, fmt.Errorf("invalid metadata: %v", err)
+	}
+	return meta, nil
+}
+
+func (b *SystemBackend) handleEntitiesBatch(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	var raw []struct {
+		Name     string                 `mapstructure:"name"`
+		Metadata map[string]interface{} `mapstructure:"metadata"`
+		Aliases  []struct {
+			Alias    string                 `mapstructure:"alias"`
+			Metadata map[string]interface{} `mapstructure:"metadata"`
+		} `mapstructure:"aliases"`
+	}
+	if err := mapstructure.WeakDecode(d.Get("entities"), &raw); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid entities: %v", err)), nil
+	}
+	if len(raw) == 0 {
+		return logical.ErrorResponse("missing entities"), nil
+	}
+
+	entries := make([]*EntityEntry, 0, len(raw))
+	for _, r := range raw {
+		if r.Name == "" {
+			return logical.ErrorResponse("missing entity name"), nil
+		}
+		meta, err := entityMetadata(r.Metadata)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		entry := &EntityEntry{
+			Name:     r.Name,
+			Metadata: meta,
+		}
+		for _, a := range r.Aliases {
+			alias, err := ParseEntityAlias(a.Alias)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+			if alias.Metadata, err = entityMetadata(a.Metadata); err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+			entry.Aliases = append(entry.Aliases, alias)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := b.Core.entityStoreForNamespace(b.namespace(req)).Create(entries); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handleEntitiesMerge(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	to := d.Get("to_entity").(string)
+	if to == "" {
+		return logical.ErrorResponse("missing entity to merge into"), nil
+	}
+	from := d.Get("from_entities").([]string)
+	if len(from) == 0 {
+		return logical.ErrorResponse("missing entities to merge"), nil
+	}
+
+	if err := b.Core.entityStoreForNamespace(b.namespace(req)).Merge(to, from); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handleEntitiesUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing entity name"), nil
+	}
+
+	store := b.Core.entityStoreForNamespace(b.namespace(req))
+	existing, err := store.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	entry := &EntityEntry{Name: name}
+	if existing != nil {
+		*entry = *existing
+	}
+
+	if raw, ok := d.GetOk("metadata"); ok {
+		if entry.Metadata, err = entityMetadata(raw); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+	if raw, ok := d.GetOk("aliases"); ok {
+		// Aliases the entity keeps also keep their metadata
+		entry.Aliases = nil
+		for _, s := range raw.([]string) {
+			alias, err := ParseEntityAlias(s)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+			if existing != nil {
+				if current := existing.alias(alias); current != nil {
+					alias = *current
+				}
+			}
+			entry.Aliases = append(entry.Aliases, alias)
+		}
+	}
+
+	if err := store.Set(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handleEntitiesRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing entity name"), nil
+	}
+	entry, err := b.Core.entityStoreForNamespace(b.namespace(req)).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	aliases := make([]string, 0, len(entry.Aliases))
+	for _, alias := range entry.Aliases {
+		aliases = append(aliases, alias.String())
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"metadata": entry.Metadata,
+			"aliases":  aliases,
+		},
+	}, nil
+}
+
+func (b *SystemBackend) handleEntitiesDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing entity name"), nil
+	}
+	if err := b.Core.entityStoreForNamespace(b.namespace(req)).Delete(name); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handleEntityAliasesUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	alias, err := ParseEntityAlias(d.Get("alias").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	store := b.Core.entityStoreForNamespace(b.namespace(req))
+	existing, current, err := store.ByAlias(alias)
+	if err != nil {
+		return nil, err
+	}
+
+	name := d.Get("entity").(string)
+	if name == "" {
+		if existing == nil {
+			return logical.ErrorResponse("missing entity name"), nil
+		}
+		name = existing.Name
+	}
+	if existing != nil && existing.Name != name {
+		return logical.ErrorResponse(fmt.Sprintf("alias %q belongs to entity %q", alias, existing.Name)), nil
+	}
+	if current != nil {
+		alias.Metadata = current.Metadata
+	}
+	if raw, ok := d.GetOk("metadata"); ok {
+		if alias.Metadata, err = entityMetadata(raw); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	if err := store.SetAlias(name, alias); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handleEntityAliasesRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	alias, err := ParseEntityAlias(d.Get("alias").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	entry, current, err := b.Core.entityStoreForNamespace(b.namespace(req)).ByAlias(alias)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil || current == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"entity":   entry.Name,
+			"metadata": current.Metadata,
+		},
+	}, nil
+}
+
+func (b *SystemBackend) handleEntityAliasesDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	alias, err := ParseEntityAlias(d.Get("alias").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := b.Core.entityStoreForNamespace(b.namespace(req)).DeleteAlias(alias); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// handleLockedUsersRead returns the users locked out of auth mounts, by the
+// path of their mount
+func (b *SystemBackend) handleLockedUsersRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	mount := d.Get("mount").(string)
+	if mount != "" {
+		mount = sanitizeMountPath(strings.TrimPrefix(strings.Trim(mount, "/"), credentialRoutePrefix))
+	}
+
+	b.Core.authLock.RLock()
+	defer b.Core.authLock.RUnlock()
+
+	byMount := make(map[string]interface{})
+	for _, entry := range b.Core.auth.Entries {
+		if mount != "" && entry.Path != mount {
+			continue
+		}
+
+		lockedUsers, err := b.Core.userLockoutManager.LockedUsers(entry.UUID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Users whose lockout has expired are unlocked when they log in
+		users := make(map[string]interface{}, len(lockedUsers))
+		for user, lockedUser := range lockedUsers {
+			expiration := lockedUser.LockoutTime.Add(entry.Config.UserLockoutConfig.duration())
+			if time.Now().After(expiration) {
+				continue
+			}
+			users[user] = map[string]interface{}{
+				"lockout_time":          lockedUser.LockoutTime,
+				"lockout_expiration":    expiration,
+				"failed_login_attempts": lockedUser.FailedLoginAttempts,
+			}
+		}
+		if len(users) > 0 {
+			byMount[entry.Path] = users
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"locked_users": byMount,
+		},
+	}, nil
+}
+
+// handleLockedUsersUnlock unlocks a user locked out of an auth mount
+func (b *SystemBackend) handleLockedUsersUnlock(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	mount := sanitizeMountPath(strings.TrimPrefix(d.Get("mount").(string), credentialRoutePrefix))
+	user := strings.ToLower(d.Get("user").(string))
+
+	entry := b.Core.router.MatchingMountEntry(credentialRoutePrefix + mount)
+	if entry == nil || entry.Path != mount {
+		return logical.ErrorResponse(fmt.Sprintf("no auth mount at %q", mount)), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.userLockoutManager.Unlock(entry.UUID, user); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// mfaMethodFields returns the fields of the MFA method paths, which include
+// the configuration of all types of methods
+func mfaMethodFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"type": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The type of the MFA method: totp, duo, okta or pingid",
+		},
+		"method_id": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The ID of the MFA method",
+		},
+		"issuer": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "TOTP: the name of the issuer of the secrets",
+		},
+		"period": &framework.FieldSchema{
+			Type:        framework.TypeDurationSecond,
+			Description: "TOTP: the validity period of the passcodes. Defaults to 30 seconds.",
+		},
+		"key_size": &framework.FieldSchema{
+			Type:        framework.TypeInt,
+			Description: "TOTP: the size in bytes of the secrets. Defaults to 20.",
+		},
+		"qr_size": &framework.FieldSchema{
+			Type:        framework.TypeInt,
+			Description: "TOTP: the size in pixels of the QR codes of the secrets, or 0 for no QR codes. Defaults to 200.",
+		},
+		"algorithm": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "TOTP: the hash algorithm of the passcodes: SHA1, SHA256 or SHA512. Defaults to SHA1.",
+		},
+		"digits": &framework.FieldSchema{
+			Type:        framework.TypeInt,
+			Description: "TOTP: the number of digits of the passcodes, 6 or 8. Defaults to 6.",
+		},
+		"skew": &framework.FieldSchema{
+			Type:        framework.TypeInt,
+			Description: "TOTP: the number of periods before or after the current one whose passcodes are accepted, 0 or 1. Defaults to 1.",
+		},
+		"integration_key": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Duo: the integration key",
+		},
+		"secret_key": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Duo: the secret key",
+		},
+		"api_hostname": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Duo: the API hostname",
+		},
+		"push_info": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Duo: URL-encoded key/value pairs displayed in push notifications",
+		},
+		"use_passcode": &framework.FieldSchema{
+			Type:        framework.TypeBool,
+			Description: "Duo: whether users are asked for a passcode rather than sent a push notification",
+		},
+		"org_name": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Okta: the name of the organization",
+		},
+		"api_token": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Okta: the API token",
+		},
+		"base_url": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: `Okta: the base domain of the organization. Defaults to "okta.com".`,
+		},
+		"primary_email": &framework.FieldSchema{
+			Type:        framework.TypeBool,
+			Description: "Okta: whether users are looked up by primary email rather than by login",
+		},
+		"settings_file_base64": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "PingID: the settings file downloaded from the PingID admin portal, encoded in base64",
+		},
+		"username_format": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: `Duo, Okta and PingID: the identity template of the usernames of the users. Defaults to "{{identity.entity.metadata.username}}".`,
+		},
+	}
+}
+
+func (b *SystemBackend) handleMFAMethodList(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ids, err := b.Core.loginMFAStore.ListMethods(d.Get("type").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(ids), nil
+}
+
+func (b *SystemBackend) handleMFAMethodUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	methodType := d.Get("type").(string)
+	id := d.Get("method_id").(string)
+
+	var method *MFAMethodEntry
+	if id == "" {
+		var err error
+		if id, err = uuid.GenerateUUID(); err != nil {
+			return nil, err
+		}
+		method = &MFAMethodEntry{
+			ID:   id,
+			Type: methodType,
+		}
+	} else {
+		var err error
+		if method, err = b.Core.loginMFAStore.Method(id); err != nil {
+			return nil, err
+		}
+		if method == nil || method.Type != methodType {
+			return logical.ErrorResponse(fmt.Sprintf("%s MFA method %q not found", methodType, id)), nil
+		}
+	}
+
+	var err error
+	switch methodType {
+	case mfaMethodTypeTOTP:
+		err = parseTOTPMFAConfig(method, d)
+	case mfaMethodTypeDuo:
+		err = parseDuoMFAConfig(method, d)
+	case mfaMethodTypeOkta:
+		err = parseOktaMFAConfig(method, d)
+	case mfaMethodTypePingID:
+		err = parsePingIDMFAConfig(method, d)
+	default:
+		err = fmt.Errorf("unsupported MFA method type %q", methodType)
+	}
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if err := b.Core.loginMFAStore.SetMethod(method); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"method_id": method.ID,
+		},
+	}, nil
+}
+
+func parseTOTPMFAConfig(method *MFAMethodEntry, d *framework.FieldData) error {
+	if method.TOTP == nil {
+		method.TOTP = &TOTPMFAConfig{
+			Period:    30,
+			KeySize:   20,
+			QRSize:    200,
+			Algorithm: "SHA1",
+			Digits:    6,
+			Skew:      1,
+		}
+	}
+	config := method.TOTP
+
+	if raw, ok := d.GetOk("issuer"); ok {
+		config.Issuer = raw.(string)
+	}
+	if raw, ok := d.GetOk("period"); ok {
+		config.Period = uint(raw.(int))
+	}
+	if raw, ok := d.GetOk("key_size"); ok {
+		config.KeySize = uint(raw.(int))
+	}
+	if raw, ok := d.GetOk("qr_size"); ok {
+		config.QRSize = raw.(int)
+	}
+	if raw, ok := d.GetOk("algorithm"); ok {
+		config.Algorithm = raw.(string)
+	}
+	if raw, ok := d.GetOk("digits"); ok {
+		config.Digits = raw.(int)
+	}
+	if raw, ok := d.GetOk("skew"); ok {
+		config.Skew = uint(raw.(int))
+	}
+
+	switch {
+	case config.Issuer == "":
+		return fmt.Errorf("missing issuer")
+	case config.Period == 0:
+		return fmt.Errorf("period must be positive")
+	case config.KeySize == 0:
+		return fmt.Errorf("key_size must be positive")
+	case config.QRSize < 0:
+		return fmt.Errorf("qr_size cannot be negative")
+	case config.Skew > 1:
+		return fmt.Errorf("skew must be 0 or 1")
+	}
+	_, _, err := config.otpOptions()
+	return err
+}
+
+func parseDuoMFAConfig(method *MFAMethodEntry, d *framework.FieldData) error {
+	if method.Duo == nil {
+		method.Duo = &DuoMFAConfig{}
+	}
+	config := method.Duo
+
+	if raw, ok := d.GetOk("integration_key"); ok {
+		config.IntegrationKey = raw.(string)
+	}
+	if raw, ok := d.GetOk("secret_key"); ok {
+		config.SecretKey = raw.(string)
+	}
+	if raw, ok := d.GetOk("api_hostname"); ok {
+		config.APIHostname = raw.(string)
+	}
+	if raw, ok := d.GetOk("push_info"); ok {
+		config.PushInfo = raw.(string)
+	}
+	if raw, ok := d.GetOk("use_passcode"); ok {
+		config.UsePasscode = raw.(bool)
+	}
+	if raw, ok := d.GetOk("username_format"); ok {
+		config.UsernameFormat = raw.(string)
+	}
+
+	switch {
+	case config.IntegrationKey == "":
+		return fmt.Errorf("missing integration_key")
+	case config.SecretKey == "":
+		return fmt.Errorf("missing secret_key")
+	case config.APIHostname == "":
+		return fmt.Errorf("missing api_hostname")
+	}
+	return nil
+}
+
+func parseOktaMFAConfig(method *MFAMethodEntry, d *framework.FieldData) error {
+	if method.Okta == nil {
+		method.Okta = &OktaMFAConfig{}
+	}
+	config := method.Okta
+
+	if raw, ok := d.GetOk("org_name"); ok {
+		config.OrgName = raw.(string)
+	}
+	if raw, ok := d.GetOk("api_token"); ok {
+		config.APIToken = raw.(string)
+	}
+	if raw, ok := d.GetOk("base_url"); ok {
+		config.BaseURL = raw.(string)
+	}
+	if raw, ok := d.GetOk("primary_email"); ok {
+		config.PrimaryEmail = raw.(bool)
+	}
+	if raw, ok := d.GetOk("username_format"); ok {
+		config.UsernameFormat = raw.(string)
+	}
+
+	switch {
+	case config.OrgName == "":
+		return fmt.Errorf("missing org_name")
+	case config.APIToken == "":
+		return fmt.Errorf("missing api_token")
+	}
+	return nil
+}
+
+func parsePingIDMFAConfig(method *MFAMethodEntry, d *framework.FieldData) error {
+	usernameFormat := ""
+	if method.PingID != nil {
+		usernameFormat = method.PingID.UsernameFormat
+	}
+	if raw, ok := d.GetOk("username_format"); ok {
+		usernameFormat = raw.(string)
+	}
+
+	if raw, ok := d.GetOk("settings_file_base64"); ok {
+		settings, err := base64.StdEncoding.DecodeString(raw.(string))
+		if err != nil {
+			return fmt.Errorf("failed to decode settings_file_base64: %v", err)
+		}
+		if method.PingID, err = parsePingIDSettings(string(settings)); err != nil {
+			return err
+		}
+	}
+	if method.PingID == nil {
+		return fmt.Errorf("missing settings_file_base64")
+	}
+
+	method.PingID.UsernameFormat = usernameFormat
+	return nil
+}
+
+func (b *SystemBackend) handleMFAMethodRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	methodType := d.Get("type").(string)
+	method, err := b.Core.loginMFAStore.Method(d.Get("method_id").(string))
+	if err != nil {
+		return nil, err
+	}
+	if method == nil || method.Type != methodType {
+		return nil, nil
+	}
+
+	data := map[string]interface{}{
+		"id":   method.ID,
+		"type": method.Type,
+	}
+
+	// Secret keys and tokens are not returned
+	switch method.Type {
+	case mfaMethodTypeTOTP:
+		data["issuer"] = method.TOTP.Issuer
+		data["period"] = method.TOTP.Period
+		data["key_size"] = method.TOTP.KeySize
+		data["qr_size"] = method.TOTP.QRSize
+		data["algorithm"] = method.TOTP.Algorithm
+		data["digits"] = method.TOTP.Digits
+		data["skew"] = method.TOTP.Skew
+	case mfaMethodTypeDuo:
+		data["integration_key"] = method.Duo.IntegrationKey
+		data["api_hostname"] = method.Duo.APIHostname
+		data["push_info"] = method.Duo.PushInfo
+		data["use_passcode"] = method.Duo.UsePasscode
+		data["username_format"] = method.Duo.UsernameFormat
+	case mfaMethodTypeOkta:
+		data["org_name"] = method.Okta.OrgName
+		data["base_url"] = method.Okta.BaseURL
+		data["primary_email"] = method.Okta.PrimaryEmail
+		data["username_format"] = method.Okta.UsernameFormat
+	case mfaMethodTypePingID:
+		data["use_signature"] = method.PingID.UseSignature
+		data["idp_url"] = method.PingID.IDPURL
+		data["org_alias"] = method.PingID.OrgAlias
+		data["admin_url"] = method.PingID.AdminURL
+		data["authenticator_id"] = method.PingID.AuthenticatorID
+		data["username_format"] = method.PingID.UsernameFormat
+	}
+
+	return &logical.Response{
+		Data: data,
+	}, nil
+}
+
+func (b *SystemBackend) handleMFAMethodDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	methodType := d.Get("type").(string)
+	id := d.Get("method_id").(string)
+	method, err := b.Core.loginMFAStore.Method(id)
+	if err != nil {
+		return nil, err
+	}
+	if method == nil || method.Type != methodType {
+		return nil, nil
+	}
+
+	if err := b.Core.loginMFAStore.DeleteMethod(id); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return nil, nil
+}
+
+// totpMethod returns the TOTP method of the request, or an error response
+func (b *SystemBackend) totpMethod(d *framework.FieldData) (*MFAMethodEntry, *logical.Response, error) {
+	id := d.Get("method_id").(string)
+	if id == "" {
+		return nil, logical.ErrorResponse("missing method_id"), nil
+	}
+	method, err := b.Core.loginMFAStore.Method(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if method == nil || method.Type != mfaMethodTypeTOTP {
+		return nil, logical.ErrorResponse(fmt.Sprintf("TOTP MFA method %q not found", id)), nil
+	}
+	return method, nil, nil
+}
+
+func (b *SystemBackend) handleMFATOTPGenerate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	method, resp, err := b.totpMethod(d)
+	if method == nil {
+		return resp, err
+	}
+	if req.Entity == nil || req.Entity.Name == "" {
+		return logical.ErrorResponse("no entity is attached to the request"), nil
+	}
+
+	// Entities cannot replace their own secrets, as the secrets are the
+	// second factor of their logins
+	secret, err := b.Core.loginMFAStore.TOTPSecret(method.ID, req.Entity.Name)
+	if err != nil {
+		return nil, err
+	}
+	if secret != "" {
+		resp := &logical.Response{}
+		resp.AddWarning("the entity already has a secret for the MFA method")
+		return resp, nil
+	}
+
+	return b.totpSecretResponse(method, req.Entity.Name)
+}
+
+func (b *SystemBackend) handleMFATOTPAdmin(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	method, resp, err := b.totpMethod(d)
+	if method == nil {
+		return resp, err
+	}
+	entityName := d.Get("entity_name").(string)
+	if entityName == "" {
+		return logical.ErrorResponse("missing entity_name"), nil
+	}
+
+	if d.Get("action").(string) == "destroy" {
+		return nil, b.Core.loginMFAStore.DeleteTOTPSecret(method.ID, entityName)
+	}
+	return b.totpSecretResponse(method, entityName)
+}
+
+func (b *SystemBackend) totpSecretResponse(method *MFAMethodEntry, entityName string) (*logical.Response, error) {
+	url, barcode, err := b.Core.generateTOTPSecret(method, entityName)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		"url": url,
+	}
+	if barcode != "" {
+		data["barcode"] = barcode
+	}
+	return &logical.Response{
+		Data: data,
+	}, nil
+}
+
+func (b *SystemBackend) handleMFAEnforcementList(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	names, err := b.Core.loginMFAStore.ListEnforcements()
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(names), nil
+}
+
+func (b *SystemBackend) handleMFAEnforcementUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing login enforcement name"), nil
+	}
+
+	enforcement, err := b.Core.loginMFAStore.Enforcement(name)
+	if err != nil {
+		return nil, err
+	}
+	if enforcement == nil {
+		enforcement = &MFAEnforcementEntry{Name: name}
+	}
+
+	if raw, ok := d.GetOk("mfa_method_ids"); ok {
+		enforcement.MFAMethodIDs = strutil.RemoveDuplicates(raw.([]string), false)
+	}
+	if raw, ok := d.GetOk("auth_method_paths"); ok {
+		enforcement.AuthMethodPaths = nil
+		for _, path := range raw.([]string) {
+			path = strings.TrimPrefix(strings.Trim(path, "/"), credentialRoutePrefix)
+			enforcement.AuthMethodPaths = append(enforcement.AuthMethodPaths, path+"/")
+		}
+	}
+	if raw, ok := d.GetOk("auth_method_types"); ok {
+		enforcement.AuthMethodTypes = raw.([]string)
+	}
+	if raw, ok := d.GetOk("identity_entity_names"); ok {
+		enforcement.IdentityEntityNames = raw.([]string)
+	}
+	if raw, ok := d.GetOk("identity_group_names"); ok {
+		enforcement.IdentityGroupNames = raw.([]string)
+	}
+
+	if len(enforcement.MFAMethodIDs) == 0 {
+		return logical.ErrorResponse("missing mfa_method_ids"), nil
+	}
+	for _, id := range enforcement.MFAMethodIDs {
+		method, err := b.Core.loginMFAStore.Method(id)
+		if err != nil {
+			return nil, err
+		}
+		if method == nil {
+			return logical.ErrorResponse(fmt.Sprintf("MFA method %q not found", id)), nil
+		}
+	}
+	if len(enforcement.AuthMethodPaths) == 0 && len(enforcement.AuthMethodTypes) == 0 &&
+		len(enforcement.IdentityEntityNames) == 0 && len(enforcement.IdentityGroupNames) == 0 {
+		return logical.ErrorResponse("one of auth_method_paths, auth_method_types, identity_entity_names or identity_group_names must be set"), nil
+	}
+
+	if err := b.Core.loginMFAStore.SetEnforcement(enforcement); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handleMFAEnforcementRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing login enforcement name"), nil
+	}
+	enforcement, err := b.Core.loginMFAStore.Enforcement(name)
+	if err != nil {
+		return nil, err
+	}
+	if enforcement == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":                  enforcement.Name,
+			"mfa_method_ids":        enforcement.MFAMethodIDs,
+			"auth_method_paths":     enforcement.AuthMethodPaths,
+			"auth_method_types":     enforcement.AuthMethodTypes,
+			"identity_entity_names": enforcement.IdentityEntityNames,
+			"identity_group_names":  enforcement.IdentityGroupNames,
+		},
+	}, nil
+}
+
+func (b *SystemBackend) handleMFAEnforcementDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing login enforcement name"), nil
+	}
+	if err := b.Core.loginMFAStore.DeleteEnforcement(name); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handleSyncDestinationsList(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	keys, err := b.Core.secretsSync.List()
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(keys), nil
+}
+
+func (b *SystemBackend) handleSyncDestinationsUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	destType := d.Get("type").(string)
+	name := d.Get("name").(string)
+
+	params := map[string]string{}
+	if err := mapstructure.WeakDecode(d.Get("parameters").(map[string]interface{}), &params); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid parameters: %v", err)), nil
+	}
+
+	// Parameters which are not given are kept, so that credentials do not
+	// have to be sent again to change other settings
+	entry, err := b.Core.secretsSync.Get(destType, name)
+	if err != nil {
+		return nil, err
+	}
+	fields := d.Get("fields").([]string)
+	if entry != nil {
+		for k, v := range entry.Parameters {
+			if _, ok := params[k]; !ok {
+				params[k] = v
+			}
+		}
+		if _, ok := d.GetOk("fields"); !ok {
+			fields = entry.Fields
+		}
+	}
+
+	if err := b.Core.secretsSync.Set(destType, name, params, fields); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handleSyncDestinationsRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entry, err := b.Core.secretsSync.Get(d.Get("type").(string), d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	// Sensitive parameters are never returned
+	params := make(map[string]string, len(entry.Parameters))
+	sensitive := secretsync.SensitiveParameters(entry.Type)
+	for k, v := range entry.Parameters {
+		if !strutil.StrListContains(sensitive, k) {
+			params[k] = v
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"type":       entry.Type,
+			"name":       entry.Name,
+			"parameters": params,
+			"fields":     entry.Fields,
+		},
+	}, nil
+}
+
+func (b *SystemBackend) handleSyncDestinationsDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.secretsSync.Delete(d.Get("type").(string), d.Get("name").(string)); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handleSyncAssociationsRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entry, err := b.Core.secretsSync.Get(d.Get("type").(string), d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	associations := make(map[string]interface{}, len(entry.Associations))
+	for key, assoc := range entry.Associations {
+		associations[key] = syncAssociationData(assoc)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"associations": associations,
+		},
+	}, nil
+}
+
+func (b *SystemBackend) handleSyncAssociationsUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	destType := d.Get("type").(string)
+	name := d.Get("name").(string)
+	mount := d.Get("mount").(string)
+	secretPath := d.Get("secret_path").(string)
+	if mount == "" {
+		return logical.ErrorResponse("missing mount"), nil
+	}
+	if secretPath == "" {
+		return logical.ErrorResponse("missing secret_path"), nil
+	}
+
+	if d.Get("action").(string) == "remove" {
+		if err := b.Core.secretsSync.Unassociate(destType, name, mount, secretPath); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		return nil, nil
+	}
+
+	assoc, err := b.Core.secretsSync.Associate(destType, name, mount, secretPath, d.Get("secret_name").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return &logical.Response{
+		Data: syncAssociationData(assoc),
+	}, nil
+}
+
+func (b *SystemBackend) handleSyncDriftRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	drift, err := b.Core.secretsSync.Drift(d.Get("type").(string), d.Get("name").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	associations := make(map[string]interface{}, len(drift))
+	for key, status := range drift {
+		associations[key] = status
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"associations": associations,
+		},
+	}, nil
+}
+
+func syncAssociationData(assoc *SyncAssociation) map[string]interface{} {
+	return map[string]interface{}{
+		"mount":       assoc.Mount,
+		"secret_path": assoc.Path,
+		"secret_name": assoc.SecretName,
+		"sync_status": assoc.SyncStatus,
+		"last_error":  assoc.LastError,
+		"updated_at":  assoc.UpdatedAt,
+	}
+}
+
+func (b *SystemBackend) handlePluginCatalogDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	pluginName := d.Get("name").(string)
 	if pluginName == "" {
 		return logical.ErrorResponse("missing plugin name"), nil
 	}
-	err := b.Core.pluginCatalog.Delete(pluginName)
-	if err != nil {
-		return nil, err
+	err := b.Core.pluginCatalog.Delete(pluginName)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// handleAuditedHeaderUpdate creates or overwrites a header entry
+func (b *SystemBackend) handleAuditedHeaderUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	header := d.Get("header").(string)
+	hmac := d.Get("hmac").(bool)
+	if header == "" {
+		return logical.ErrorResponse("missing header name"), nil
+	}
+
+	headerConfig := b.Core.AuditedHeadersConfig()
+	err := headerConfig.add(header, hmac)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// handleAudtedHeaderDelete deletes the header with the given name
+func (b *SystemBackend) handleAuditedHeaderDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	header := d.Get("header").(string)
+	if header == "" {
+		return logical.ErrorResponse("missing header name"), nil
+	}
+
+	headerConfig := b.Core.AuditedHeadersConfig()
+	err := headerConfig.remove(header)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// handleAuditedHeaderRead returns the header configuration for the given header name
+func (b *SystemBackend) handleAuditedHeaderRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	header := d.Get("header").(string)
+	if header == "" {
+		return logical.ErrorResponse("missing header name"), nil
+	}
+
+	headerConfig := b.Core.AuditedHeadersConfig()
+	settings, ok := headerConfig.Headers[header]
+	if !ok {
+		return logical.ErrorResponse("Could not find header in config"), nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			header: settings,
+		},
+	}, nil
+}
+
+// handleAuditedHeadersRead returns the whole audited headers config
+func (b *SystemBackend) handleAuditedHeadersRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	headerConfig := b.Core.AuditedHeadersConfig()
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"headers": headerConfig.Headers,
+		},
+	}, nil
+}
+
+// handleCapabilities returns the ACL capabilities of the token for a given path
+func (b *SystemBackend) handleCapabilities(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	token := d.Get("token").(string)
+	if token == "" {
+		token = req.ClientToken
+	}
+	capabilities, err := b.Core.Capabilities(token, b.namespace(req).Path+d.Get("path").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"capabilities": capabilities,
+		},
+	}, nil
+}
+
+// handleCapabilitiesAccessor returns the ACL capabilities of the
+// token associted with the given accessor for a given path.
+func (b *SystemBackend) handleCapabilitiesAccessor(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	accessor := d.Get("accessor").(string)
+	if accessor == "" {
+		return logical.ErrorResponse("missing accessor"), nil
+	}
+
+	aEntry, err := b.Core.tokenStore.lookupByAccessor(accessor, false)
+	if err != nil {
+		return nil, err
+	}
+
+	capabilities, err := b.Core.Capabilities(aEntry.TokenID, b.namespace(req).Path+d.Get("path").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"capabilities": capabilities,
+		},
+	}, nil
+}
+
+// handleRekeyRetrieve returns backed-up, PGP-encrypted unseal keys from a
+// rekey operation
+func (b *SystemBackend) handleRekeyRetrieve(
+	req *logical.Request,
+	data *framework.FieldData,
+	recovery bool) (*logical.Response, error) {
+	backup, err := b.Core.RekeyRetrieveBackup(recovery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up backed-up keys: %v", err)
+	}
+	if backup == nil {
+		return logical.ErrorResponse("no backed-up keys found"), nil
+	}
+
+	keysB64 := map[string][]string{}
+	for k, v := range backup.Keys {
+		for _, j := range v {
+			currB64Keys := keysB64[k]
+			if currB64Keys == nil {
+				currB64Keys = []string{}
+			}
+			key, err := hex.DecodeString(j)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding hex-encoded backup key: %v", err)
+			}
+			currB64Keys = append(currB64Keys, base64.StdEncoding.EncodeToString(key))
+			keysB64[k] = currB64Keys
+		}
+	}
+
+	// Format the status
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"nonce":       backup.Nonce,
+			"keys":        backup.Keys,
+			"keys_base64": keysB64,
+		},
+	}
+
+	return resp, nil
+}
+
+func (b *SystemBackend) handleRekeyRetrieveBarrier(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.handleRekeyRetrieve(req, data, false)
+}
+
+func (b *SystemBackend) handleRekeyRetrieveRecovery(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.handleRekeyRetrieve(req, data, true)
+}
+
+// handleRekeyDelete deletes backed-up, PGP-encrypted unseal keys from a rekey
+// operation
+func (b *SystemBackend) handleRekeyDelete(
+	req *logical.Request,
+	data *framework.FieldData,
+	recovery bool) (*logical.Response, error) {
+	err := b.Core.RekeyDeleteBackup(recovery)
+	if err != nil {
+		return nil, fmt.Errorf("error during deletion of backed-up keys: %v", err)
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handleRekeyDeleteBarrier(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.handleRekeyDelete(req, data, false)
+}
+
+func (b *SystemBackend) handleRekeyDeleteRecovery(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.handleRekeyDelete(req, data, true)
+}
+
+// handleMountTable handles the "mounts" endpoint to provide the mount table
+func (b *SystemBackend) handleMountTable(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.Core.mountsLock.RLock()
+	defer b.Core.mountsLock.RUnlock()
+
+	resp := &logical.Response{
+		Data: make(map[string]interface{}),
+	}
+
+	ns := b.namespace(req)
+	for _, entry := range b.Core.mounts.Entries {
+		if entry.Namespace().ID != ns.ID {
+			continue
+		}
+		info := map[string]interface{}{
+			"type":        entry.Type,
+			"description": entry.Description,
+			"config": map[string]interface{}{
+				"default_lease_ttl":    int64(entry.Config.DefaultLeaseTTL.Seconds()),
+				"max_lease_ttl":        int64(entry.Config.MaxLeaseTTL.Seconds()),
+				"force_no_cache":       entry.Config.ForceNoCache,
+				"default_wrapping_ttl": int64(entry.Config.DefaultWrappingTTL.Seconds()),
+				"max_wrapping_ttl":     int64(entry.Config.MaxWrappingTTL.Seconds()),
+			},
+			"local": entry.Local,
+		}
+
+		resp.Data[entry.Path] = info
+	}
+
+	return resp, nil
+}
+
+// handleMount is used to mount a new path
+func (b *SystemBackend) handleMount(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.Core.clusterParamsLock.RLock()
+	repState := b.Core.replicationState
+	b.Core.clusterParamsLock.RUnlock()
+
+	local := data.Get("local").(bool)
+	if !local && repState.HasState(consts.ReplicationSecondary) {
+		return logical.ErrorResponse("cannot add a non-local mount to a replication secondary"), nil
+	}
+
+	// Get all the options
+	path := data.Get("path").(string)
+	logicalType := data.Get("type").(string)
+	description := data.Get("description").(string)
+
+	path = sanitizeMountPath(path)
+
+	var config MountConfig
+
+	var apiConfig struct {
+		DefaultLeaseTTL string `json:"default_lease_ttl" structs:"default_lease_ttl" mapstructure:"default_lease_ttl"`
+		MaxLeaseTTL     string `json:"max_lease_ttl" structs:"max_lease_ttl" mapstructure:"max_lease_ttl"`
+		ForceNoCache    bool   `json:"force_no_cache" structs:"force_no_cache" mapstructure:"force_no_cache"`
+
+		DefaultWrappingTTL string `json:"default_wrapping_ttl" structs:"default_wrapping_ttl" mapstructure:"default_wrapping_ttl"`
+		MaxWrappingTTL     string `json:"max_wrapping_ttl" structs:"max_wrapping_ttl" mapstructure:"max_wrapping_ttl"`
+	}
+	configMap := data.Get("config").(map[string]interface{})
+	if configMap != nil && len(configMap) != 0 {
+		err := mapstructure.Decode(configMap, &apiConfig)
+		if err != nil {
+			return logical.ErrorResponse(
+					"unable to convert given mount config information"),
+				logical.ErrInvalidRequest
+		}
+	}
+
+	switch apiConfig.DefaultLeaseTTL {
+	case "":
+	case "system":
+	default:
+		tmpDef, err := parseutil.ParseDurationSecond(apiConfig.DefaultLeaseTTL)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf(
+					"unable to parse default TTL of %s: %s", apiConfig.DefaultLeaseTTL, err)),
+				logical.ErrInvalidRequest
+		}
+		config.DefaultLeaseTTL = tmpDef
+	}
+
+	switch apiConfig.MaxLeaseTTL {
+	case "":
+	case "system":
+	default:
+		tmpMax, err := parseutil.ParseDurationSecond(apiConfig.MaxLeaseTTL)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf(
+					"unable to parse max TTL of %s: %s", apiConfig.MaxLeaseTTL, err)),
+				logical.ErrInvalidRequest
+		}
+		config.MaxLeaseTTL = tmpMax
+	}
+
+	if config.MaxLeaseTTL != 0 && config.DefaultLeaseTTL > config.MaxLeaseTTL {
+		return logical.ErrorResponse(
+				"given default lease TTL greater than given max lease TTL"),
+			logical.ErrInvalidRequest
+	}
+
+	if config.DefaultLeaseTTL > b.Core.maxLeaseTTL {
+		return logical.ErrorResponse(fmt.Sprintf(
+				"given default lease TTL greater than system max lease TTL of %d", int(b.Core.maxLeaseTTL.Seconds()))),
+			logical.ErrInvalidRequest
+	}
+
+	// Copy over the force no cache if set
+	if apiConfig.ForceNoCache {
+		config.ForceNoCache = true
+	}
+
+	if apiConfig.DefaultWrappingTTL != "" {
+		tmpDef, err := parseWrappingTTL(apiConfig.DefaultWrappingTTL)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf(
+					"unable to parse default wrapping TTL of %s: %s", apiConfig.DefaultWrappingTTL, err)),
+				logical.ErrInvalidRequest
+		}
+		config.DefaultWrappingTTL = tmpDef
+	}
+
+	if apiConfig.MaxWrappingTTL != "" {
+		tmpMax, err := parseWrappingTTL(apiConfig.MaxWrappingTTL)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf(
+					"unable to parse max wrapping TTL of %s: %s", apiConfig.MaxWrappingTTL, err)),
+				logical.ErrInvalidRequest
+		}
+		config.MaxWrappingTTL = tmpMax
+	}
+
+	if config.MaxWrappingTTL != 0 && config.DefaultWrappingTTL > config.MaxWrappingTTL {
+		return logical.ErrorResponse(
+				"given default wrapping TTL greater than given max wrapping TTL"),
+			logical.ErrInvalidRequest
+	}
+
+	if logicalType == "" {
+		return logical.ErrorResponse(
+				"backend type must be specified as a string"),
+			logical.ErrInvalidRequest
+	}
+
+	// Create the mount entry
+	me := &MountEntry{
+		Table:       mountTableType,
+		Path:        path,
+		Type:        logicalType,
+		Description: description,
+		Config:      config,
+		Local:       local,
+	}
+	setMountEntryNamespace(me, b.namespace(req))
+
+	// Attempt mount
+	if err := b.Core.mount(me); err != nil {
+		b.Backend.Logger().Error("sys: mount failed", "path", me.Path, "error", err)
+		return handleError(err)
+	}
+
+	return nil, nil
+}
+
+// used to intercept an HTTPCodedError so it goes back to callee
+func handleError(
+	err error) (*logical.Response, error) {
+	switch err.(type) {
+	case logical.HTTPCodedError:
+		return logical.ErrorResponse(err.Error()), err
+	default:
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+}
+
+// handleUnmount is used to unmount a path
+func (b *SystemBackend) handleUnmount(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.Core.clusterParamsLock.RLock()
+	repState := b.Core.replicationState
+	b.Core.clusterParamsLock.RUnlock()
+
+	suffix := strings.TrimPrefix(req.Path, "mounts/")
+	if len(suffix) == 0 {
+		return logical.ErrorResponse("path cannot be blank"), logical.ErrInvalidRequest
+	}
+
+	suffix = b.namespace(req).Path + sanitizeMountPath(suffix)
+
+	entry := b.Core.router.MatchingMountEntry(suffix)
+	if entry != nil && !entry.Local && repState.HasState(consts.ReplicationSecondary) {
+		return logical.ErrorResponse("cannot unmount a non-local mount on a replication secondary"), nil
+	}
+
+	// Attempt unmount
+	if existed, err := b.Core.unmount(suffix); existed && err != nil {
+		b.Backend.Logger().Error("sys: unmount failed", "path", suffix, "error", err)
+		return handleError(err)
+	}
+
+	return nil, nil
+}
+
+// handleRemount is used to remount a path
+func (b *SystemBackend) handleRemount(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.Core.clusterParamsLock.RLock()
+	repState := b.Core.replicationState
+	b.Core.clusterParamsLock.RUnlock()
+
+	// Get the paths
+	fromPath := data.Get("from").(string)
+	toPath := data.Get("to").(string)
+	if fromPath == "" || toPath == "" {
+		return logical.ErrorResponse(
+				"both 'from' and 'to' path must be specified as a string"),
+			logical.ErrInvalidRequest
+	}
+
+	ns := b.namespace(req)
+	fromPath = ns.Path + sanitizeMountPath(fromPath)
+	toPath = ns.Path + sanitizeMountPath(toPath)
+
+	entry := b.Core.router.MatchingMountEntry(fromPath)
+	if entry != nil && !entry.Local && repState.HasState(consts.ReplicationSecondary) {
+		return logical.ErrorResponse("cannot remount a non-local mount on a replication secondary"), nil
+	}
+
+	// Attempt remount
+	if err := b.Core.remount(fromPath, toPath); err != nil {
+		b.Backend.Logger().Error("sys: remount failed", "from_path", fromPath, "to_path", toPath, "error", err)
+		return handleError(err)
+	}
+
+	return nil, nil
+}
+
+// handleAuthTuneRead is used to get config settings on a auth path
+func (b *SystemBackend) handleAuthTuneRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+	if path == "" {
+		return logical.ErrorResponse(
+				"path must be specified as a string"),
+			logical.ErrInvalidRequest
+	}
+	return b.handleTuneReadCommon(b.namespace(req).Path + "auth/" + path)
+}
+
+// handleMountTuneRead is used to get config settings on a backend
+func (b *SystemBackend) handleMountTuneRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+	if path == "" {
+		return logical.ErrorResponse(
+				"path must be specified as a string"),
+			logical.ErrInvalidRequest
+	}
+
+	// This call will read both logical backend's configuration as well as auth backends'.
+	// Retaining this behavior for backward compatibility. If this behavior is not desired,
+	// an error can be returned if path has a prefix of "auth/".
+	return b.handleTuneReadCommon(b.namespace(req).Path + path)
+}
+
+// handleTuneReadCommon returns the config settings of a path
+func (b *SystemBackend) handleTuneReadCommon(path string) (*logical.Response, error) {
+	path = sanitizeMountPath(path)
+
+	sysView := b.Core.router.MatchingSystemView(path)
+	if sysView == nil {
+		b.Backend.Logger().Error("sys: cannot fetch sysview", "path", path)
+		return handleError(fmt.Errorf("sys: cannot fetch sysview for path %s", path))
+	}
+
+	mountEntry := b.Core.router.MatchingMountEntry(path)
+	if mountEntry == nil {
+		b.Backend.Logger().Error("sys: cannot fetch mount entry", "path", path)
+		return handleError(fmt.Errorf("sys: cannot fetch mount entry for path %s", path))
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"default_lease_ttl":    int(sysView.DefaultLeaseTTL().Seconds()),
+			"max_lease_ttl":        int(sysView.MaxLeaseTTL().Seconds()),
+			"force_no_cache":       mountEntry.Config.ForceNoCache,
+			"default_wrapping_ttl": int(mountEntry.Config.DefaultWrappingTTL.Seconds()),
+			"max_wrapping_ttl":     int(mountEntry.Config.MaxWrappingTTL.Seconds()),
+		},
+	}
+
+	// Auth mounts are tuned with the type of the tokens they issue, and the
+	// lockout of their users
+	if mountEntry.Table == credentialTableType {
+		tokenType := mountEntry.Config.TokenType
+		if tokenType == "" {
+			tokenType = "default"
+		}
+		lockout := &mountEntry.Config.UserLockoutConfig
+		resp.Data["token_type"] = tokenType
+		resp.Data["user_lockout_config"] = map[string]interface{}{
+			"lockout_threshold":              lockout.LockoutThreshold,
+			"lockout_duration":               int(lockout.duration().Seconds()),
+			"lockout_counter_reset_duration": int(lockout.counterResetDuration().Seconds()),
+		}
+	}
+
+	return resp, nil
+}
+
+// handleAuthTuneWrite is used to set config settings on an auth path
+func (b *SystemBackend) handleAuthTuneWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+	if path == "" {
+		return logical.ErrorResponse("path must be specified as a string"),
+			logical.ErrInvalidRequest
 	}
+	return b.handleTuneWriteCommon(b.namespace(req).Path+"auth/"+path, data)
+}
 
-	return nil, nil
+// handleMountTuneWrite is used to set config settings on a backend
+func (b *SystemBackend) handleMountTuneWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+	if path == "" {
+		return logical.ErrorResponse("path must be specified as a string"),
+			logical.ErrInvalidRequest
+	}
+	// This call will write both logical backend's configuration as well as auth backends'.
+	// Retaining this behavior for backward compatibility. If this behavior is not desired,
+	// an error can be returned if path has a prefix of "auth/".
+	return b.handleTuneWriteCommon(b.namespace(req).Path+path, data)
 }
 
-// handleAuditedHeaderUpdate creates or overwrites a header entry
-func (b *SystemBackend) handleAuditedHeaderUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	header := d.Get("header").(string)
-	hmac := d.Get("hmac").(bool)
-	if header == "" {
-		return logical.ErrorResponse("missing header name"), nil
+// handleTuneWriteCommon is used to set config settings on a path
+func (b *SystemBackend) handleTuneWriteCommon(
+	path string, data *framework.FieldData) (*logical.Response, error) {
+	b.Core.clusterParamsLock.RLock()
+	repState := b.Core.replicationState
+	b.Core.clusterParamsLock.RUnlock()
+
+	path = sanitizeMountPath(path)
+
+	// Prevent protected paths from being changed, within any namespace
+	ns := b.Core.namespaceStore.Resolve(path)
+	for _, p := range untunableMounts {
+		if strings.HasPrefix(strings.TrimPrefix(path, ns.Path), p) {
+			b.Backend.Logger().Error("sys: cannot tune this mount", "path", path)
+			return handleError(fmt.Errorf("sys: cannot tune '%s'", path))
+		}
 	}
 
-	headerConfig := b.Core.AuditedHeadersConfig()
-	err := headerConfig.add(header, hmac)
-	if err != nil {
-		return nil, err
+	mountEntry := b.Core.router.MatchingMountEntry(path)
+	if mountEntry == nil {
+		b.Backend.Logger().Error("sys: tune failed: no mount entry found", "path", path)
+		return handleError(fmt.Errorf("sys: tune of path '%s' failed: no mount entry found", path))
+	}
+	if mountEntry != nil && !mountEntry.Local && repState.HasState(consts.ReplicationSecondary) {
+		return logical.ErrorResponse("cannot tune a non-local mount on a replication secondary"), nil
 	}
 
-	return nil, nil
-}
+	var lock *sync.RWMutex
+	switch {
+	case mountEntry.Table == credentialTableType:
+		lock = &b.Core.authLock
+	default:
+		lock = &b.Core.mountsLock
+	}
 
-// handleAudtedHeaderDelete deletes the header with the given name
-func (b *SystemBackend) handleAuditedHeaderDelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	header := d.Get("header").(string)
-	if header == "" {
-		return logical.ErrorResponse("missing header name"), nil
+	// Wrapping TTL policy. This is applied first as the lock is held until
+	// the end of the function when tuning lease TTLs.
+	{
+		var newDefault, newMax *time.Duration
+		if defTTL := data.Get("default_wrapping_ttl").(string); defTTL != "" {
+			tmpDef, err := parseWrappingTTL(defTTL)
+			if err != nil {
+				return handleError(err)
+			}
+			newDefault = &tmpDef
+		}
+
+		if maxTTL := data.Get("max_wrapping_ttl").(string); maxTTL != "" {
+			tmpMax, err := parseWrappingTTL(maxTTL)
+			if err != nil {
+				return handleError(err)
+			}
+			newMax = &tmpMax
+		}
+
+		if newDefault != nil || newMax != nil {
+			lock.Lock()
+			err := b.tuneMountWrappingTTLs(path, mountEntry, newDefault, newMax)
+			lock.Unlock()
+			if err != nil {
+				b.Backend.Logger().Error("sys: tuning failed", "path", path, "error", err)
+				return handleError(err)
+			}
+		}
 	}
 
-	headerConfig := b.Core.AuditedHeadersConfig()
-	err := headerConfig.remove(header)
-	if err != nil {
-		return nil, err
+	// Token type and user lockout, which are only set on auth mounts
+	if raw, ok := data.GetOk("token_type"); ok {
+		tokenType := raw.(string)
+		switch tokenType {
+		case "", "default":
+			tokenType = ""
+		case tokenTypeService, tokenTypeBatch:
+		default:
+			return logical.ErrorResponse(fmt.Sprintf("invalid token_type %q", tokenType)), logical.ErrInvalidRequest
+		}
+
+		lock.Lock()
+		err := b.tuneMountTokenType(path, mountEntry, tokenType)
+		lock.Unlock()
+		if err != nil {
+			b.Backend.Logger().Error("sys: tuning failed", "path", path, "error", err)
+			return handleError(err)
+		}
+	}
+	if raw, ok := data.GetOk("user_lockout_config"); ok {
+		config, err := parseUserLockoutConfig(mountEntry.Config.UserLockoutConfig, raw.(map[string]interface{}))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		if config.LockoutThreshold > 0 && !strutil.StrListContains(userLockoutMountTypes, mountEntry.Type) {
+			return logical.ErrorResponse(fmt.Sprintf("user lockout is not supported by %q auth backends", mountEntry.Type)), logical.ErrInvalidRequest
+		}
+
+		lock.Lock()
+		err = b.tuneMountUserLockout(path, mountEntry, config)
+		lock.Unlock()
+		if err != nil {
+			b.Backend.Logger().Error("sys: tuning failed", "path", path, "error", err)
+			return handleError(err)
+		}
+	}
+
+	// Timing configuration parameters
+	{
+		var newDefault, newMax *time.Duration
+		defTTL := data.Get("default_lease_ttl").(string)
+		switch defTTL {
+		case "":
+		case "system":
+			tmpDef := time.Duration(0)
+			newDefault = &tmpDef
+		default:
+			tmpDef, err := parseutil.ParseDurationSecond(defTTL)
+			if err != nil {
+				return handleError(err)
+			}
+			newDefault = &tmpDef
+		}
+
+		maxTTL := data.Get("max_lease_ttl").(string)
+		switch maxTTL {
+		case "":
+		case "system":
+			tmpMax := time.Duration(0)
+			newMax = &tmpMax
+		default:
+			tmpMax, err := parseutil.ParseDurationSecond(maxTTL)
+			if err != nil {
+				return handleError(err)
+			}
+			newMax = &tmpMax
+		}
+
+		if newDefault != nil || newMax != nil {
+			lock.Lock()
+			defer lock.Unlock()
+
+			if err := b.tuneMountTTLs(path, mountEntry, newDefault, newMax); err != nil {
+				b.Backend.Logger().Error("sys: tuning failed", "path", path, "error", err)
+				return handleError(err)
+			}
+		}
 	}
 
 	return nil, nil
 }
 
-// handleAuditedHeaderRead returns the header configuration for the given header name
-func (b *SystemBackend) handleAuditedHeaderRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	header := d.Get("header").(string)
-	if header == "" {
-		return logical.ErrorResponse("missing header name"), nil
+// handleLease is use to view the metadata for a given LeaseID
+func (b *SystemBackend) handleLeaseLookup(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	leaseID := data.Get("lease_id").(string)
+	if leaseID == "" {
+		return logical.ErrorResponse("lease_id must be specified"),
+			logical.ErrInvalidRequest
 	}
 
-	headerConfig := b.Core.AuditedHeadersConfig()
-	settings, ok := headerConfig.Headers[header]
-	if !ok {
-		return logical.ErrorResponse("Could not find header in config"), nil
+	leaseTimes, err := b.Core.expiration.FetchLeaseTimes(leaseID)
+	if err != nil {
+		b.Backend.Logger().Error("sys: error retrieving lease", "lease_id", leaseID, "error", err)
+		return handleError(err)
+	}
+	if leaseTimes == nil {
+		return logical.ErrorResponse("invalid lease"), logical.ErrInvalidRequest
 	}
 
-	return &logical.Response{
+	resp := &logical.Response{
 		Data: map[string]interface{}{
-			header: settings,
+			"id":           leaseID,
+			"issue_time":   leaseTimes.IssueTime,
+			"expire_time":  nil,
+			"last_renewal": nil,
+			"ttl":          int64(0),
 		},
-	}, nil
+	}
+	renewable, _ := leaseTimes.renewable()
+	resp.Data["renewable"] = renewable
+
+	if !leaseTimes.LastRenewalTime.IsZero() {
+		resp.Data["last_renewal"] = leaseTimes.LastRenewalTime
+	}
+	if !leaseTimes.ExpireTime.IsZero() {
+		resp.Data["expire_time"] = leaseTimes.ExpireTime
+		resp.Data["ttl"] = leaseTimes.ttl()
+	}
+	return resp, nil
 }
 
-// handleAuditedHeadersRead returns the whole audited headers config
-func (b *SystemBackend) handleAuditedHeadersRead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	headerConfig := b.Core.AuditedHeadersConfig()
+func (b *SystemBackend) handleLeaseLookupList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	prefix := data.Get("prefix").(string)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
 
-	return &logical.Response{
-		Data: map[string]interface{}{
-			"headers": headerConfig.Headers,
-		},
-	}, nil
+	keys, err := b.Core.expiration.idView.List(prefix)
+	if err != nil {
+		b.Backend.Logger().Error("sys: error listing leases", "prefix", prefix, "error", err)
+		return handleError(err)
+	}
+	return logical.ListResponse(keys), nil
 }
 
-// handleCapabilities returns the ACL capabilities of the token for a given path
-func (b *SystemBackend) handleCapabilities(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	token := d.Get("token").(string)
-	if token == "" {
-		token = req.ClientToken
+// handleLeaseCount returns the number of the irrevocable leases of the
+// namespace, in total and by mount
+func (b *SystemBackend) handleLeaseCount(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if leaseType := data.Get("type").(string); leaseType != "irrevocable" {
+		return logical.ErrorResponse(fmt.Sprintf("unsupported lease type %q", leaseType)),
+			logical.ErrInvalidRequest
 	}
-	capabilities, err := b.Core.Capabilities(token, d.Get("path").(string))
-	if err != nil {
-		return nil, err
+
+	leases := b.Core.expiration.irrevocableLeases(b.namespace(req).Path)
+	counts := make(map[string]int)
+	for _, le := range leases {
+		counts[b.Core.router.MatchingMount(le.LeaseID)]++
 	}
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"capabilities": capabilities,
+			"lease_count": len(leases),
+			"counts":      counts,
 		},
 	}, nil
 }
 
-// handleCapabilitiesAccessor returns the ACL capabilities of the
-// token associted with the given accessor for a given path.
-func (b *SystemBackend) handleCapabilitiesAccessor(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	accessor := d.Get("accessor").(string)
-	if accessor == "" {
-		return logical.ErrorResponse("missing accessor"), nil
+// handleIrrevocableLeases lists the irrevocable leases of the namespace,
+// along with the error of their last revocation attempt
+func (b *SystemBackend) handleIrrevocableLeases(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	limit := data.Get("limit").(int)
+	if limit < 0 {
+		return logical.ErrorResponse("limit must not be negative"), logical.ErrInvalidRequest
 	}
 
-	aEntry, err := b.Core.tokenStore.lookupByAccessor(accessor, false)
-	if err != nil {
-		return nil, err
+	leases := b.Core.expiration.irrevocableLeases(b.namespace(req).Path)
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"lease_count": len(leases),
+		},
+	}
+	if limit > 0 && len(leases) > limit {
+		resp.AddWarning(fmt.Sprintf("listing the first %d of %d irrevocable leases", limit, len(leases)))
+		leases = leases[:limit]
+	}
+
+	list := make([]map[string]interface{}, 0, len(leases))
+	for _, le := range leases {
+		list = append(list, map[string]interface{}{
+			"lease_id":    le.LeaseID,
+			"mount":       b.Core.router.MatchingMount(le.LeaseID),
+			"expire_time": le.ExpireTime,
+			"error":       le.RevokeErr,
+		})
+	}
+	resp.Data["leases"] = list
+	return resp, nil
+}
+
+// handleRenew is used to renew a lease with a given LeaseID
+func (b *SystemBackend) handleRenew(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Get all the options
+	leaseID := data.Get("lease_id").(string)
+	if leaseID == "" {
+		leaseID = data.Get("url_lease_id").(string)
+	}
+	if leaseID == "" {
+		return logical.ErrorResponse("lease_id must be specified"),
+			logical.ErrInvalidRequest
 	}
+	incrementRaw := data.Get("increment").(int)
 
-	capabilities, err := b.Core.Capabilities(aEntry.TokenID, d.Get("path").(string))
-	if err != nil {
-		return nil, err
+	// Namespaces can only renew their own leases
+	if ns := b.namespace(req); !strings.HasPrefix(leaseID, ns.Path) {
+		return logical.ErrorResponse("lease does not belong to the namespace"), logical.ErrPermissionDenied
 	}
 
-	return &logical.Response{
-		Data: map[string]interface{}{
-			"capabilities": capabilities,
-		},
-	}, nil
-}
+	// Convert the increment
+	increment := time.Duration(incrementRaw) * time.Second
 
-// handleRekeyRetrieve returns backed-up, PGP-encrypted unseal keys from a
-// rekey operation
-func (b *SystemBackend) handleRekeyRetrieve(
-	req *logical.Request,
-	data *framework.FieldData,
-	recovery bool) (*logical.Response, error) {
-	backup, err := b.Core.RekeyRetrieveBackup(recovery)
+	// Invoke the expiration manager directly
+	resp, err := b.Core.expiration.Renew(leaseID, increment)
 	if err != nil {
-		return nil, fmt.Errorf("unable to look up backed-up keys: %v", err)
-	}
-	if backup == nil {
-		return logical.ErrorResponse("no backed-up keys found"), nil
+		b.Backend.Logger().Error("sys: lease renewal failed", "lease_id", leaseID, "error", err)
+		return handleError(err)
 	}
+	return resp, err
+}
 
-	keysB64 := map[string][]string{}
-	for k, v := range backup.Keys {
-		for _, j := range v {
-			currB64Keys := keysB64[k]
-			if currB64Keys == nil {
-				currB64Keys = []string{}
-			}
-			key, err := hex.DecodeString(j)
-			if err != nil {
-				return nil, fmt.Errorf("error decoding hex-encoded backup key: %v", err)
-			}
-			currB64Keys = append(currB64Keys, base64.StdEncoding.EncodeToString(key))
-			keysB64[k] = currB64Keys
-		}
+// handleRevoke is used to revoke a given LeaseID
+func (b *SystemBackend) handleRevoke(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Get all the options
+	leaseID := data.Get("lease_id").(string)
+	if leaseID == "" {
+		leaseID = data.Get("url_lease_id").(string)
 	}
-
-	// Format the status
-	resp := &logical.Response{
-		Data: map[string]interface{}{
-			"nonce":       backup.Nonce,
-			"keys":        backup.Keys,
-			"keys_base64": keysB64,
-		},
+	if leaseID == "" {
+		return logical.ErrorResponse("lease_id must be specified"),
+			logical.ErrInvalidRequest
 	}
 
-	return resp, nil
+	// Invoke the expiration manager directly
+	if err := b.Core.expiration.Revoke(leaseID); err != nil {
+		b.Backend.Logger().Error("sys: lease revocation failed", "lease_id", leaseID, "error", err)
+		return handleError(err)
+	}
+	return nil, nil
 }
 
-func (b *SystemBackend) handleRekeyRetrieveBarrier(
+// handleRevokePrefix is used to revoke a prefix with many LeaseIDs
+func (b *SystemBackend) handleRevokePrefix(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return b.handleRekeyRetrieve(req, data, false)
+	return b.handleRevokePrefixCommon(req, data, false)
 }
 
-func (b *SystemBackend) handleRekeyRetrieveRecovery(
+// handleRevokeForce is used to revoke a prefix with many LeaseIDs, ignoring errors
+func (b *SystemBackend) handleRevokeForce(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return b.handleRekeyRetrieve(req, data, true)
+	return b.handleRevokePrefixCommon(req, data, true)
 }
 
-// handleRekeyDelete deletes backed-up, PGP-encrypted unseal keys from a rekey
-// operation
-func (b *SystemBackend) handleRekeyDelete(
-	req *logical.Request,
-	data *framework.FieldData,
-	recovery bool) (*logical.Response, error) {
-	err := b.Core.RekeyDeleteBackup(recovery)
-	if err != nil {
-		return nil, fmt.Errorf("error during deletion of backed-up keys: %v", err)
+// handleRevokeForceLease is used to revoke a single lease, ignoring errors
+func (b *SystemBackend) handleRevokeForceLease(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	leaseID := data.Get("lease_id").(string)
+	if leaseID == "" {
+		leaseID = data.Get("url_lease_id").(string)
+	}
+	if leaseID == "" {
+		return logical.ErrorResponse("lease_id must be specified"),
+			logical.ErrInvalidRequest
 	}
 
+	if err := b.Core.expiration.RevokeForceLease(leaseID); err != nil {
+		b.Backend.Logger().Error("sys: forced lease revocation failed", "lease_id", leaseID, "error", err)
+		return handleError(err)
+	}
 	return nil, nil
 }
 
-func (b *SystemBackend) handleRekeyDeleteBarrier(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return b.handleRekeyDelete(req, data, false)
-}
+// handleRevokePrefixCommon is used to revoke a prefix with many LeaseIDs
+func (b *SystemBackend) handleRevokePrefixCommon(
+	req *logical.Request, data *framework.FieldData, force bool) (*logical.Response, error) {
+	// Get all the options
+	prefix := data.Get("prefix").(string)
 
-func (b *SystemBackend) handleRekeyDeleteRecovery(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return b.handleRekeyDelete(req, data, true)
+	// Invoke the expiration manager directly
+	var err error
+	if force {
+		err = b.Core.expiration.RevokeForce(prefix)
+	} else {
+		err = b.Core.expiration.RevokePrefix(prefix)
+	}
+	if err != nil {
+		b.Backend.Logger().Error("sys: revoke prefix failed", "prefix", prefix, "error", err)
+		return handleError(err)
+	}
+	return nil, nil
 }
 
-// handleMountTable handles the "mounts" endpoint to provide the mount table
-func (b *SystemBackend) handleMountTable(
+// handleAuthTable handles the "auth" endpoint to provide the auth table
+func (b *SystemBackend) handleAuthTable(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	b.Core.mountsLock.RLock()
-	defer b.Core.mountsLock.RUnlock()
+	b.Core.authLock.RLock()
+	defer b.Core.authLock.RUnlock()
 
 	resp := &logical.Response{
 		Data: make(map[string]interface{}),
 	}
-
-	for _, entry := range b.Core.mounts.Entries {
+	ns := b.namespace(req)
+	for _, entry := range b.Core.auth.Entries {
+		if entry.Namespace().ID != ns.ID {
+			continue
+		}
 		info := map[string]interface{}{
 			"type":        entry.Type,
 			"description": entry.Description,
 			"config": map[string]interface{}{
-				"default_lease_ttl": int64(entry.Config.DefaultLeaseTTL.Seconds()),
-				"max_lease_ttl":     int64(entry.Config.MaxLeaseTTL.Seconds()),
-				"force_no_cache":    entry.Config.ForceNoCache,
+				"default_lease_ttl":    int64(entry.Config.DefaultLeaseTTL.Seconds()),
+				"max_lease_ttl":        int64(entry.Config.MaxLeaseTTL.Seconds()),
+				"default_wrapping_ttl": int64(entry.Config.DefaultWrappingTTL.Seconds()),
+				"max_wrapping_ttl":     int64(entry.Config.MaxWrappingTTL.Seconds()),
 			},
 			"local": entry.Local,
 		}
-
 		resp.Data[entry.Path] = info
 	}
-
 	return resp, nil
 }
 
-// handleMount is used to mount a new path
-func (b *SystemBackend) handleMount(
+// handleEnableAuth is used to enable a new credential backend
+func (b *SystemBackend) handleEnableAuth(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	b.Core.clusterParamsLock.RLock()
 	repState := b.Core.replicationState
 	b.Core.clusterParamsLock.RUnlock()
 
 	local := data.Get("local").(bool)
-	if !local && repState == consts.ReplicationSecondary {
+	if !local && repState.HasState(consts.ReplicationSecondary) {
 		return logical.ErrorResponse("cannot add a non-local mount to a replication secondary"), nil
 	}
 
@@ -1191,862 +4738,1438 @@ func (b *SystemBackend) handleMount(
 	logicalType := data.Get("type").(string)
 	description := data.Get("description").(string)
 
-	path = sanitizeMountPath(path)
-
-	var config MountConfig
-
-	var apiConfig struct {
-		DefaultLeaseTTL string `json:"default_lease_ttl" structs:"default_lease_ttl" mapstructure:"default_lease_ttl"`
-		MaxLeaseTTL     string `json:"max_lease_ttl" structs:"max_lease_ttl" mapstructure:"max_lease_ttl"`
-		ForceNoCache    bool   `json:"force_no_cache" structs:"force_no_cache" mapstructure:"force_no_cache"`
-	}
-	configMap := data.Get("config").(map[string]interface{})
-	if configMap != nil && len(configMap) != 0 {
-		err := mapstructure.Decode(configMap, &apiConfig)
-		if err != nil {
-			return logical.ErrorResponse(
-					"unable to convert given mount config information"),
-				logical.ErrInvalidRequest
-		}
-	}
-
-	switch apiConfig.DefaultLeaseTTL {
-	case "":
-	case "system":
-	default:
-		tmpDef, err := parseutil.ParseDurationSecond(apiConfig.DefaultLeaseTTL)
-		if err != nil {
-			return logical.ErrorResponse(fmt.Sprintf(
-					"unable to parse default TTL of %s: %s", apiConfig.DefaultLeaseTTL, err)),
-				logical.ErrInvalidRequest
-		}
-		config.DefaultLeaseTTL = tmpDef
-	}
-
-	switch apiConfig.MaxLeaseTTL {
-	case "":
-	case "system":
-	default:
-		tmpMax, err := parseutil.ParseDurationSecond(apiConfig.MaxLeaseTTL)
-		if err != nil {
-			return logical.ErrorResponse(fmt.Sprintf(
-					"unable to parse max TTL of %s: %s", apiConfig.MaxLeaseTTL, err)),
-				logical.ErrInvalidRequest
-		}
-		config.MaxLeaseTTL = tmpMax
-	}
-
-	if config.MaxLeaseTTL != 0 && config.DefaultLeaseTTL > config.MaxLeaseTTL {
-		return logical.ErrorResponse(
-				"given default lease TTL greater than given max lease TTL"),
-			logical.ErrInvalidRequest
-	}
-
-	if config.DefaultLeaseTTL > b.Core.maxLeaseTTL {
-		return logical.ErrorResponse(fmt.Sprintf(
-				"given default lease TTL greater than system max lease TTL of %d", int(b.Core.maxLeaseTTL.Seconds()))),
-			logical.ErrInvalidRequest
-	}
-
-	// Copy over the force no cache if set
-	if apiConfig.ForceNoCache {
-		config.ForceNoCache = true
-	}
-
 	if logicalType == "" {
 		return logical.ErrorResponse(
 				"backend type must be specified as a string"),
 			logical.ErrInvalidRequest
 	}
 
+	path = sanitizeMountPath(path)
+
 	// Create the mount entry
 	me := &MountEntry{
-		Table:       mountTableType,
+		Table:       credentialTableType,
 		Path:        path,
 		Type:        logicalType,
 		Description: description,
-		Config:      config,
 		Local:       local,
 	}
+	setMountEntryNamespace(me, b.namespace(req))
 
-	// Attempt mount
-	if err := b.Core.mount(me); err != nil {
-		b.Backend.Logger().Error("sys: mount failed", "path", me.Path, "error", err)
+	// Attempt enabling
+	if err := b.Core.enableCredential(me); err != nil {
+		b.Backend.Logger().Error("sys: enable auth mount failed", "path", me.Path, "error", err)
 		return handleError(err)
 	}
+	return nil, nil
+}
+
+// handleDisableAuth is used to disable a credential backend
+func (b *SystemBackend) handleDisableAuth(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	suffix := strings.TrimPrefix(req.Path, "auth/")
+	if len(suffix) == 0 {
+		return logical.ErrorResponse("path cannot be blank"), logical.ErrInvalidRequest
+	}
+
+	suffix = sanitizeMountPath(suffix)
 
+	// Attempt disable
+	if existed, err := b.Core.disableNamespaceCredential(b.namespace(req), suffix); existed && err != nil {
+		b.Backend.Logger().Error("sys: disable auth mount failed", "path", suffix, "error", err)
+		return handleError(err)
+	}
 	return nil, nil
 }
 
-// used to intercept an HTTPCodedError so it goes back to callee
-func handleError(
-	err error) (*logical.Response, error) {
-	switch err.(type) {
-	case logical.HTTPCodedError:
-		return logical.ErrorResponse(err.Error()), err
-	default:
-		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+// handlePolicyList handles the "policy" endpoint to provide the enabled policies
+func (b *SystemBackend) handlePolicyList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Get all the configured policies
+	policies, err := b.Core.policyStoreForNamespace(b.namespace(req)).ListPolicies()
+
+	// Add the special "root" policy, which only the root namespace has
+	if b.namespace(req).ID == rootNamespaceID {
+		policies = append(policies, "root")
+	}
+	resp := logical.ListResponse(policies)
+
+	// Backwords compatibility
+	resp.Data["policies"] = resp.Data["keys"]
+
+	return resp, err
+}
+
+// handlePolicyRead handles the "policy/<name>" endpoint to read a policy
+func (b *SystemBackend) handlePolicyRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	policy, err := b.Core.policyStoreForNamespace(b.namespace(req)).GetPolicy(name)
+	if err != nil {
+		return handleError(err)
+	}
+
+	if policy == nil {
+		return nil, nil
 	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":  name,
+			"rules": policy.Raw,
+		},
+	}, nil
 }
 
-// handleUnmount is used to unmount a path
-func (b *SystemBackend) handleUnmount(
+// handlePolicySet handles the "policy/<name>" endpoint to set a policy
+func (b *SystemBackend) handlePolicySet(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	b.Core.clusterParamsLock.RLock()
-	repState := b.Core.replicationState
-	b.Core.clusterParamsLock.RUnlock()
+	name := data.Get("name").(string)
 
-	suffix := strings.TrimPrefix(req.Path, "mounts/")
-	if len(suffix) == 0 {
-		return logical.ErrorResponse("path cannot be blank"), logical.ErrInvalidRequest
+	rulesRaw, ok := data.GetOk("rules")
+	if !ok {
+		return logical.ErrorResponse("'rules' parameter not supplied"), nil
 	}
 
-	suffix = sanitizeMountPath(suffix)
-
-	entry := b.Core.router.MatchingMountEntry(suffix)
-	if entry != nil && !entry.Local && repState == consts.ReplicationSecondary {
-		return logical.ErrorResponse("cannot unmount a non-local mount on a replication secondary"), nil
+	rules := rulesRaw.(string)
+	if rules == "" {
+		return logical.ErrorResponse("'rules' parameter empty"), nil
 	}
 
-	// Attempt unmount
-	if existed, err := b.Core.unmount(suffix); existed && err != nil {
-		b.Backend.Logger().Error("sys: unmount failed", "path", suffix, "error", err)
+	// Validate the rules parse
+	parse, err := Parse(rules)
+	if err != nil {
 		return handleError(err)
 	}
 
+	// Override the name
+	parse.Name = strings.ToLower(name)
+
+	// Update the policy
+	if err := b.Core.policyStoreForNamespace(b.namespace(req)).SetPolicy(parse); err != nil {
+		return handleError(err)
+	}
 	return nil, nil
 }
 
-// handleRemount is used to remount a path
-func (b *SystemBackend) handleRemount(
+// handlePolicyDelete handles the "policy/<name>" endpoint to delete a policy
+func (b *SystemBackend) handlePolicyDelete(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	b.Core.clusterParamsLock.RLock()
-	repState := b.Core.replicationState
-	b.Core.clusterParamsLock.RUnlock()
-
-	// Get the paths
-	fromPath := data.Get("from").(string)
-	toPath := data.Get("to").(string)
-	if fromPath == "" || toPath == "" {
-		return logical.ErrorResponse(
-				"both 'from' and 'to' path must be specified as a string"),
-			logical.ErrInvalidRequest
-	}
-
-	fromPath = sanitizeMountPath(fromPath)
-	toPath = sanitizeMountPath(toPath)
-
-	entry := b.Core.router.MatchingMountEntry(fromPath)
-	if entry != nil && !entry.Local && repState == consts.ReplicationSecondary {
-		return logical.ErrorResponse("cannot remount a non-local mount on a replication secondary"), nil
-	}
+	name := data.Get("name").(string)
 
-	// Attempt remount
-	if err := b.Core.remount(fromPath, toPath); err != nil {
-		b.Backend.Logger().Error("sys: remount failed", "from_path", fromPath, "to_path", toPath, "error", err)
+	if err := b.Core.policyStoreForNamespace(b.namespace(req)).DeletePolicy(name); err != nil {
 		return handleError(err)
 	}
-
 	return nil, nil
 }
 
-// handleAuthTuneRead is used to get config settings on a auth path
-func (b *SystemBackend) handleAuthTuneRead(
+// handleAuditTable handles the "audit" endpoint to provide the audit table
+func (b *SystemBackend) handleAuditTable(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
-	if path == "" {
-		return logical.ErrorResponse(
-				"path must be specified as a string"),
-			logical.ErrInvalidRequest
+	b.Core.auditLock.RLock()
+	defer b.Core.auditLock.RUnlock()
+
+	resp := &logical.Response{
+		Data: make(map[string]interface{}),
+	}
+	for _, entry := range b.Core.audit.Entries {
+		info := map[string]interface{}{
+			"path":        entry.Path,
+			"type":        entry.Type,
+			"description": entry.Description,
+			"options":     entry.Options,
+			"local":       entry.Local,
+		}
+		resp.Data[entry.Path] = info
 	}
-	return b.handleTuneReadCommon("auth/" + path)
+	return resp, nil
 }
 
-// handleMountTuneRead is used to get config settings on a backend
-func (b *SystemBackend) handleMountTuneRead(
+// handleAuditHash is used to fetch the hash of the given input data with the
+// specified audit backend's salt
+func (b *SystemBackend) handleAuditHash(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	path := data.Get("path").(string)
-	if path == "" {
-		return logical.ErrorResponse(
-				"path must be specified as a string"),
-			logical.ErrInvalidRequest
+	input := data.Get("input").(string)
+	if input == "" {
+		return logical.ErrorResponse("the \"input\" parameter is empty"), nil
 	}
 
-	// This call will read both logical backend's configuration as well as auth backends'.
-	// Retaining this behavior for backward compatibility. If this behavior is not desired,
-	// an error can be returned if path has a prefix of "auth/".
-	return b.handleTuneReadCommon(path)
-}
-
-// handleTuneReadCommon returns the config settings of a path
-func (b *SystemBackend) handleTuneReadCommon(path string) (*logical.Response, error) {
 	path = sanitizeMountPath(path)
 
-	sysView := b.Core.router.MatchingSystemView(path)
-	if sysView == nil {
-		b.Backend.Logger().Error("sys: cannot fetch sysview", "path", path)
-		return handleError(fmt.Errorf("sys: cannot fetch sysview for path %s", path))
-	}
-
-	mountEntry := b.Core.router.MatchingMountEntry(path)
-	if mountEntry == nil {
-		b.Backend.Logger().Error("sys: cannot fetch mount entry", "path", path)
-		return handleError(fmt.Errorf("sys: cannot fetch mount entry for path %s", path))
+	hash, err := b.Core.auditBroker.GetHash(path, input)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
 
-	resp := &logical.Response{
+	return &logical.Response{
 		Data: map[string]interface{}{
-			"default_lease_ttl": int(sysView.DefaultLeaseTTL().Seconds()),
-			"max_lease_ttl":     int(sysView.MaxLeaseTTL().Seconds()),
-			"force_no_cache":    mountEntry.Config.ForceNoCache,
+			"hash": hash,
 		},
-	}
-
-	return resp, nil
-}
-
-// handleAuthTuneWrite is used to set config settings on an auth path
-func (b *SystemBackend) handleAuthTuneWrite(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
-	if path == "" {
-		return logical.ErrorResponse("path must be specified as a string"),
-			logical.ErrInvalidRequest
-	}
-	return b.handleTuneWriteCommon("auth/"+path, data)
+	}, nil
 }
 
-// handleMountTuneWrite is used to set config settings on a backend
-func (b *SystemBackend) handleMountTuneWrite(
+// handleEnableAudit is used to enable a new audit backend
+func (b *SystemBackend) handleEnableAudit(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
-	if path == "" {
-		return logical.ErrorResponse("path must be specified as a string"),
-			logical.ErrInvalidRequest
-	}
-	// This call will write both logical backend's configuration as well as auth backends'.
-	// Retaining this behavior for backward compatibility. If this behavior is not desired,
-	// an error can be returned if path has a prefix of "auth/".
-	return b.handleTuneWriteCommon(path, data)
-}
-
-// handleTuneWriteCommon is used to set config settings on a path
-func (b *SystemBackend) handleTuneWriteCommon(
-	path string, data *framework.FieldData) (*logical.Response, error) {
 	b.Core.clusterParamsLock.RLock()
 	repState := b.Core.replicationState
 	b.Core.clusterParamsLock.RUnlock()
 
-	path = sanitizeMountPath(path)
+	local := data.Get("local").(bool)
+	if !local && repState.HasState(consts.ReplicationSecondary) {
+		return logical.ErrorResponse("cannot add a non-local mount to a replication secondary"), nil
+	}
 
-	// Prevent protected paths from being changed
-	for _, p := range untunableMounts {
-		if strings.HasPrefix(path, p) {
-			b.Backend.Logger().Error("sys: cannot tune this mount", "path", path)
-			return handleError(fmt.Errorf("sys: cannot tune '%s'", path))
+	// Get all the options
+	path := data.Get("path").(string)
+	backendType := data.Get("type").(string)
+	description := data.Get("description").(string)
+	options := data.Get("options").(map[string]interface{})
+
+	optionMap := make(map[string]string)
+	for k, v := range options {
+		vStr, ok := v.(string)
+		if !ok {
+			return logical.ErrorResponse("options must be string valued"),
+				logical.ErrInvalidRequest
 		}
+		optionMap[k] = vStr
 	}
 
-	mountEntry := b.Core.router.MatchingMountEntry(path)
-	if mountEntry == nil {
-		b.Backend.Logger().Error("sys: tune failed: no mount entry found", "path", path)
-		return handleError(fmt.Errorf("sys: tune of path '%s' failed: no mount entry found", path))
-	}
-	if mountEntry != nil && !mountEntry.Local && repState == consts.ReplicationSecondary {
-		return logical.ErrorResponse("cannot tune a non-local mount on a replication secondary"), nil
+	// Create the mount entry
+	me := &MountEntry{
+		Table:       auditTableType,
+		Path:        path,
+		Type:        backendType,
+		Description: description,
+		Options:     optionMap,
+		Local:       local,
 	}
 
-	var lock *sync.RWMutex
-	switch {
-	case strings.HasPrefix(path, "auth/"):
-		lock = &b.Core.authLock
-	default:
-		lock = &b.Core.mountsLock
+	// Attempt enabling
+	if err := b.Core.enableAudit(me); err != nil {
+		b.Backend.Logger().Error("sys: enable audit mount failed", "path", me.Path, "error", err)
+		return handleError(err)
 	}
+	return nil, nil
+}
 
-	// Timing configuration parameters
-	{
-		var newDefault, newMax *time.Duration
-		defTTL := data.Get("default_lease_ttl").(string)
-		switch defTTL {
-		case "":
-		case "system":
-			tmpDef := time.Duration(0)
-			newDefault = &tmpDef
-		default:
-			tmpDef, err := parseutil.ParseDurationSecond(defTTL)
-			if err != nil {
-				return handleError(err)
-			}
-			newDefault = &tmpDef
-		}
-
-		maxTTL := data.Get("max_lease_ttl").(string)
-		switch maxTTL {
-		case "":
-		case "system":
-			tmpMax := time.Duration(0)
-			newMax = &tmpMax
-		default:
-			tmpMax, err := parseutil.ParseDurationSecond(maxTTL)
-			if err != nil {
-				return handleError(err)
-			}
-			newMax = &tmpMax
-		}
-
-		if newDefault != nil || newMax != nil {
-			lock.Lock()
-			defer lock.Unlock()
+// handleDisableAudit is used to disable an audit backend
+func (b *SystemBackend) handleDisableAudit(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
 
-			if err := b.tuneMountTTLs(path, mountEntry, newDefault, newMax); err != nil {
-				b.Backend.Logger().Error("sys: tuning failed", "path", path, "error", err)
-				return handleError(err)
-			}
-		}
+	// Attempt disable
+	if existed, err := b.Core.disableAudit(path); existed && err != nil {
+		b.Backend.Logger().Error("sys: disable audit mount failed", "path", path, "error", err)
+		return handleError(err)
 	}
-
 	return nil, nil
 }
 
-// handleLease is use to view the metadata for a given LeaseID
-func (b *SystemBackend) handleLeaseLookup(
+// handleRawRead is used to read directly from the barrier
+func (b *SystemBackend) handleRawRead(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	leaseID := data.Get("lease_id").(string)
-	if leaseID == "" {
-		return logical.ErrorResponse("lease_id must be specified"),
-			logical.ErrInvalidRequest
+	path := data.Get("path").(string)
+
+	// Prevent access of protected paths
+	for _, p := range protectedPaths {
+		if strings.HasPrefix(path, p) {
+			err := fmt.Sprintf("cannot read '%s'", path)
+			return logical.ErrorResponse(err), logical.ErrInvalidRequest
+		}
 	}
 
-	leaseTimes, err := b.Core.expiration.FetchLeaseTimes(leaseID)
+	entry, err := b.Core.barrier.Get(path)
 	if err != nil {
-		b.Backend.Logger().Error("sys: error retrieving lease", "lease_id", leaseID, "error", err)
 		return handleError(err)
 	}
-	if leaseTimes == nil {
-		return logical.ErrorResponse("invalid lease"), logical.ErrInvalidRequest
+	if entry == nil {
+		return nil, nil
 	}
-
 	resp := &logical.Response{
 		Data: map[string]interface{}{
-			"id":           leaseID,
-			"issue_time":   leaseTimes.IssueTime,
-			"expire_time":  nil,
-			"last_renewal": nil,
-			"ttl":          int64(0),
+			"value": string(entry.Value),
 		},
 	}
-	renewable, _ := leaseTimes.renewable()
-	resp.Data["renewable"] = renewable
+	return resp, nil
+}
 
-	if !leaseTimes.LastRenewalTime.IsZero() {
-		resp.Data["last_renewal"] = leaseTimes.LastRenewalTime
+// handleRawWrite is used to write directly to the barrier
+func (b *SystemBackend) handleRawWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+
+	// Prevent access of protected paths
+	for _, p := range protectedPaths {
+		if strings.HasPrefix(path, p) {
+			err := fmt.Sprintf("cannot write '%s'", path)
+			return logical.ErrorResponse(err), logical.ErrInvalidRequest
+		}
 	}
-	if !leaseTimes.ExpireTime.IsZero() {
-		resp.Data["expire_time"] = leaseTimes.ExpireTime
-		resp.Data["ttl"] = leaseTimes.ttl()
+
+	value := data.Get("value").(string)
+	entry := &Entry{
+		Key:   path,
+		Value: []byte(value),
 	}
-	return resp, nil
+	if err := b.Core.barrier.Put(entry); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	return nil, nil
 }
 
-func (b *SystemBackend) handleLeaseLookupList(
+// handleRawDelete is used to delete directly from the barrier
+func (b *SystemBackend) handleRawDelete(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	prefix := data.Get("prefix").(string)
-	if prefix != "" && !strings.HasSuffix(prefix, "/") {
-		prefix = prefix + "/"
+	path := data.Get("path").(string)
+
+	// Prevent access of protected paths
+	for _, p := range protectedPaths {
+		if strings.HasPrefix(path, p) {
+			err := fmt.Sprintf("cannot delete '%s'", path)
+			return logical.ErrorResponse(err), logical.ErrInvalidRequest
+		}
 	}
 
-	keys, err := b.Core.expiration.idView.List(prefix)
-	if err != nil {
-		b.Backend.Logger().Error("sys: error listing leases", "prefix", prefix, "error", err)
+	if err := b.Core.barrier.Delete(path); err != nil {
 		return handleError(err)
 	}
-	return logical.ListResponse(keys), nil
+	return nil, nil
 }
 
-// handleRenew is used to renew a lease with a given LeaseID
-func (b *SystemBackend) handleRenew(
+// handleKeyStatus returns status information about the backend key
+func (b *SystemBackend) handleKeyStatus(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Get all the options
-	leaseID := data.Get("lease_id").(string)
-	if leaseID == "" {
-		leaseID = data.Get("url_lease_id").(string)
+	// Get the key info
+	info, err := b.Core.barrier.ActiveKeyInfo()
+	if err != nil {
+		return nil, err
 	}
-	if leaseID == "" {
-		return logical.ErrorResponse("lease_id must be specified"),
-			logical.ErrInvalidRequest
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"term":         info.Term,
+			"install_time": info.InstallTime.Format(time.RFC3339Nano),
+		},
 	}
-	incrementRaw := data.Get("increment").(int)
+	return resp, nil
+}
 
-	// Convert the increment
-	increment := time.Duration(incrementRaw) * time.Second
+// handleRotate is used to trigger a key rotation
+func (b *SystemBackend) handleRotate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.Core.clusterParamsLock.RLock()
+	repState := b.Core.replicationState
+	b.Core.clusterParamsLock.RUnlock()
+	if repState.HasState(consts.ReplicationSecondary) {
+		return logical.ErrorResponse("cannot rotate on a replication secondary"), nil
+	}
 
-	// Invoke the expiration manager directly
-	resp, err := b.Core.expiration.Renew(leaseID, increment)
+	// Rotate to the new term
+	newTerm, err := b.Core.barrier.Rotate()
 	if err != nil {
-		b.Backend.Logger().Error("sys: lease renewal failed", "lease_id", leaseID, "error", err)
+		b.Backend.Logger().Error("sys: failed to create new encryption key", "error", err)
 		return handleError(err)
 	}
-	return resp, err
-}
+	b.Backend.Logger().Info("sys: installed new encryption key")
 
-// handleRevoke is used to revoke a given LeaseID
-func (b *SystemBackend) handleRevoke(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Get all the options
-	leaseID := data.Get("lease_id").(string)
-	if leaseID == "" {
-		leaseID = data.Get("url_lease_id").(string)
-	}
-	if leaseID == "" {
-		return logical.ErrorResponse("lease_id must be specified"),
-			logical.ErrInvalidRequest
+	// In HA mode, we need to an upgrade path for the standby instances
+	if b.Core.ha != nil {
+		// Create the upgrade path to the new term
+		if err := b.Core.barrier.CreateUpgrade(newTerm); err != nil {
+			b.Backend.Logger().Error("sys: failed to create new upgrade", "term", newTerm, "error", err)
+		}
+
+		// Schedule the destroy of the upgrade path
+		time.AfterFunc(keyRotateGracePeriod, func() {
+			if err := b.Core.barrier.DestroyUpgrade(newTerm); err != nil {
+				b.Backend.Logger().Error("sys: failed to destroy upgrade", "term", newTerm, "error", err)
+			}
+		})
 	}
 
-	// Invoke the expiration manager directly
-	if err := b.Core.expiration.Revoke(leaseID); err != nil {
-		b.Backend.Logger().Error("sys: lease revocation failed", "lease_id", leaseID, "error", err)
-		return handleError(err)
+	// Write to the canary path, which will force a synchronous truing during
+	// replication
+	if err := b.Core.barrier.Put(&Entry{
+		Key:   coreKeyringCanaryPath,
+		Value: []byte(fmt.Sprintf("new-rotation-term-%d", newTerm)),
+	}); err != nil {
+		b.Core.logger.Error("core: error saving keyring canary", "error", err)
+		return nil, fmt.Errorf("failed to save keyring canary: %v", err)
 	}
+
 	return nil, nil
 }
 
-// handleRevokePrefix is used to revoke a prefix with many LeaseIDs
-func (b *SystemBackend) handleRevokePrefix(
+// handleRaftConfigurationRead returns the membership of the raft cluster
+func (b *SystemBackend) handleRaftConfigurationRead(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return b.handleRevokePrefixCommon(req, data, false)
-}
+	raftStorage := b.Core.raftStorage
+	if raftStorage == nil {
+		return handleError(ErrRaftStorageNotInUse)
+	}
 
-// handleRevokeForce is used to revoke a prefix with many LeaseIDs, ignoring errors
-func (b *SystemBackend) handleRevokeForce(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return b.handleRevokePrefixCommon(req, data, true)
+	config := raftStorage.Configuration()
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"servers": config.Servers,
+			"index":   config.Index,
+		},
+	}, nil
 }
 
-// handleRevokePrefixCommon is used to revoke a prefix with many LeaseIDs
-func (b *SystemBackend) handleRevokePrefixCommon(
-	req *logical.Request, data *framework.FieldData, force bool) (*logical.Response, error) {
-	// Get all the options
-	prefix := data.Get("prefix").(string)
+// handleRaftRemovePeer removes a server from the raft cluster
+func (b *SystemBackend) handleRaftRemovePeer(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	raftStorage := b.Core.raftStorage
+	if raftStorage == nil {
+		return handleError(ErrRaftStorageNotInUse)
+	}
 
-	// Invoke the expiration manager directly
-	var err error
-	if force {
-		err = b.Core.expiration.RevokeForce(prefix)
-	} else {
-		err = b.Core.expiration.RevokePrefix(prefix)
+	serverID := data.Get("server_id").(string)
+	if serverID == "" {
+		return logical.ErrorResponse("server_id must be provided"), logical.ErrInvalidRequest
 	}
-	if err != nil {
-		b.Backend.Logger().Error("sys: revoke prefix failed", "prefix", prefix, "error", err)
+	if serverID == raftStorage.NodeID() {
+		return logical.ErrorResponse("the active node can't be removed; transfer the leadership first"), logical.ErrInvalidRequest
+	}
+
+	if err := raftStorage.RemovePeer(serverID); err != nil {
+		b.Backend.Logger().Error("sys: failed to remove raft peer", "server_id", serverID, "error", err)
 		return handleError(err)
 	}
+	b.Backend.Logger().Info("sys: removed raft peer", "server_id", serverID)
 	return nil, nil
 }
 
-// handleAuthTable handles the "auth" endpoint to provide the auth table
-func (b *SystemBackend) handleAuthTable(
+// handleRaftTransferLeadership hands the leadership of the raft cluster, and
+// with it the HA lock, over to another voter
+func (b *SystemBackend) handleRaftTransferLeadership(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	b.Core.authLock.RLock()
-	defer b.Core.authLock.RUnlock()
-
-	resp := &logical.Response{
-		Data: make(map[string]interface{}),
+	raftStorage := b.Core.raftStorage
+	if raftStorage == nil {
+		return handleError(ErrRaftStorageNotInUse)
 	}
-	for _, entry := range b.Core.auth.Entries {
-		info := map[string]interface{}{
-			"type":        entry.Type,
-			"description": entry.Description,
-			"config": map[string]interface{}{
-				"default_lease_ttl": int64(entry.Config.DefaultLeaseTTL.Seconds()),
-				"max_lease_ttl":     int64(entry.Config.MaxLeaseTTL.Seconds()),
-			},
-			"local": entry.Local,
-		}
-		resp.Data[entry.Path] = info
+
+	serverID := data.Get("server_id").(string)
+	if err := raftStorage.TransferLeadership(serverID); err != nil {
+		b.Backend.Logger().Error("sys: failed to transfer raft leadership", "server_id", serverID, "error", err)
+		return handleError(err)
 	}
-	return resp, nil
+	b.Backend.Logger().Info("sys: transferred raft leadership", "server_id", serverID)
+	return nil, nil
 }
 
-// handleEnableAuth is used to enable a new credential backend
-func (b *SystemBackend) handleEnableAuth(
+// handleRaftSnapshotRead returns a snapshot of the raft storage
+func (b *SystemBackend) handleRaftSnapshotRead(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	b.Core.clusterParamsLock.RLock()
-	repState := b.Core.replicationState
-	b.Core.clusterParamsLock.RUnlock()
+	raftStorage := b.Core.raftStorage
+	if raftStorage == nil {
+		return handleError(ErrRaftStorageNotInUse)
+	}
 
-	local := data.Get("local").(bool)
-	if !local && repState == consts.ReplicationSecondary {
-		return logical.ErrorResponse("cannot add a non-local mount to a replication secondary"), nil
+	snapshot, err := raftStorage.Snapshot()
+	if err != nil {
+		b.Backend.Logger().Error("sys: failed to take raft snapshot", "error", err)
+		return nil, err
 	}
 
-	// Get all the options
-	path := data.Get("path").(string)
-	logicalType := data.Get("type").(string)
-	description := data.Get("description").(string)
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode:  200,
+			logical.HTTPRawBody:     snapshot,
+			logical.HTTPContentType: "application/octet-stream",
+		},
+	}, nil
+}
 
-	if logicalType == "" {
-		return logical.ErrorResponse(
-				"backend type must be specified as a string"),
-			logical.ErrInvalidRequest
+// handleRaftAutopilotConfigRead returns the autopilot configuration
+func (b *SystemBackend) handleRaftAutopilotConfigRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	raftStorage := b.Core.raftStorage
+	if raftStorage == nil {
+		return handleError(ErrRaftStorageNotInUse)
 	}
 
-	path = sanitizeMountPath(path)
+	config := raftStorage.AutopilotConfig()
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"cleanup_dead_servers":               config.CleanupDeadServers,
+			"last_contact_threshold":             config.LastContactThreshold.String(),
+			"dead_server_last_contact_threshold": config.DeadServerLastContactThreshold.String(),
+			"max_trailing_logs":                  config.MaxTrailingLogs,
+			"min_quorum":                         config.MinQuorum,
+			"server_stabilization_time":          config.ServerStabilizationTime.String(),
+		},
+	}, nil
+}
 
-	// Create the mount entry
-	me := &MountEntry{
-		Table:       credentialTableType,
-		Path:        path,
-		Type:        logicalType,
-		Description: description,
-		Local:       local,
+// handleRaftAutopilotConfigUpdate updates the autopilot configuration
+func (b *SystemBackend) handleRaftAutopilotConfigUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	raftStorage := b.Core.raftStorage
+	if raftStorage == nil {
+		return handleError(ErrRaftStorageNotInUse)
+	}
+
+	config := raftStorage.AutopilotConfig()
+	if raw, ok := data.GetOk("cleanup_dead_servers"); ok {
+		config.CleanupDeadServers = raw.(bool)
+	}
+	if raw, ok := data.GetOk("last_contact_threshold"); ok {
+		config.LastContactThreshold = time.Duration(raw.(int)) * time.Second
+	}
+	if raw, ok := data.GetOk("dead_server_last_contact_threshold"); ok {
+		config.DeadServerLastContactThreshold = time.Duration(raw.(int)) * time.Second
+	}
+	if raw, ok := data.GetOk("max_trailing_logs"); ok {
+		if raw.(int) < 0 {
+			return logical.ErrorResponse("max_trailing_logs must not be negative"), logical.ErrInvalidRequest
+		}
+		config.MaxTrailingLogs = uint64(raw.(int))
+	}
+	if raw, ok := data.GetOk("min_quorum"); ok {
+		config.MinQuorum = raw.(int)
+	}
+	if raw, ok := data.GetOk("server_stabilization_time"); ok {
+		config.ServerStabilizationTime = time.Duration(raw.(int)) * time.Second
 	}
 
-	// Attempt enabling
-	if err := b.Core.enableCredential(me); err != nil {
-		b.Backend.Logger().Error("sys: enable auth mount failed", "path", me.Path, "error", err)
+	switch {
+	case config.LastContactThreshold <= 0:
+		return logical.ErrorResponse("last_contact_threshold must be positive"), logical.ErrInvalidRequest
+	case config.DeadServerLastContactThreshold < time.Minute:
+		return logical.ErrorResponse("dead_server_last_contact_threshold must be at least one minute"), logical.ErrInvalidRequest
+	case config.ServerStabilizationTime < 0:
+		return logical.ErrorResponse("server_stabilization_time must not be negative"), logical.ErrInvalidRequest
+	case config.CleanupDeadServers && config.MinQuorum < 3:
+		return logical.ErrorResponse("min_quorum must be at least 3 when cleaning up dead servers"), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.saveRaftAutopilotConfig(config); err != nil {
 		return handleError(err)
 	}
 	return nil, nil
 }
 
-// handleDisableAuth is used to disable a credential backend
-func (b *SystemBackend) handleDisableAuth(
+// handleRaftAutopilotStateRead returns the health of the raft cluster
+func (b *SystemBackend) handleRaftAutopilotStateRead(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	suffix := strings.TrimPrefix(req.Path, "auth/")
-	if len(suffix) == 0 {
-		return logical.ErrorResponse("path cannot be blank"), logical.ErrInvalidRequest
+	raftStorage := b.Core.raftStorage
+	if raftStorage == nil {
+		return handleError(ErrRaftStorageNotInUse)
 	}
 
-	suffix = sanitizeMountPath(suffix)
-
-	// Attempt disable
-	if existed, err := b.Core.disableCredential(suffix); existed && err != nil {
-		b.Backend.Logger().Error("sys: disable auth mount failed", "path", suffix, "error", err)
+	state, err := raftStorage.AutopilotState()
+	if err != nil {
 		return handleError(err)
 	}
-	return nil, nil
-}
-
-// handlePolicyList handles the "policy" endpoint to provide the enabled policies
-func (b *SystemBackend) handlePolicyList(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Get all the configured policies
-	policies, err := b.Core.policyStore.ListPolicies()
 
-	// Add the special "root" policy
-	policies = append(policies, "root")
-	resp := logical.ListResponse(policies)
+	servers := make(map[string]interface{}, len(state.Servers))
+	for id, server := range state.Servers {
+		stableSince := ""
+		if !server.StableSince.IsZero() {
+			stableSince = server.StableSince.Format(time.RFC3339Nano)
+		}
+		servers[id] = map[string]interface{}{
+			"node_id":         server.NodeID,
+			"address":         server.Address,
+			"status":          server.Status,
+			"healthy":         server.Healthy,
+			"last_contact":    server.LastContact.String(),
+			"last_index":      server.LastIndex,
+			"stable_since":    stableSince,
+			"redundancy_zone": server.RedundancyZone,
+		}
+	}
 
-	// Backwords compatibility
-	resp.Data["policies"] = resp.Data["keys"]
+	zones := make(map[string]interface{}, len(state.RedundancyZones))
+	for name, zone := range state.RedundancyZones {
+		zones[name] = map[string]interface{}{
+			"servers":           zone.Servers,
+			"voters":            zone.Voters,
+			"failure_tolerance": zone.FailureTolerance,
+		}
+	}
 
-	return resp, err
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"healthy":           state.Healthy,
+			"failure_tolerance": state.FailureTolerance,
+			"leader":            state.Leader,
+			"voters":            state.Voters,
+			"servers":           servers,
+			"redundancy_zones":  zones,
+		},
+	}, nil
 }
 
-// handlePolicyRead handles the "policy/<name>" endpoint to read a policy
-func (b *SystemBackend) handlePolicyRead(
+// handleRaftSnapshotAutoConfigList lists the automated snapshot
+// configurations
+func (b *SystemBackend) handleRaftSnapshotAutoConfigList(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	name := data.Get("name").(string)
+	manager := b.Core.raftSnapshotAuto
+	if manager == nil {
+		return handleError(ErrRaftStorageNotInUse)
+	}
 
-	policy, err := b.Core.policyStore.GetPolicy(name)
+	names, err := manager.List()
 	if err != nil {
 		return handleError(err)
 	}
+	return logical.ListResponse(names), nil
+}
 
-	if policy == nil {
+// handleRaftSnapshotAutoConfigRead returns an automated snapshot
+// configuration, without its sensitive parameters
+func (b *SystemBackend) handleRaftSnapshotAutoConfigRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	manager := b.Core.raftSnapshotAuto
+	if manager == nil {
+		return handleError(ErrRaftStorageNotInUse)
+	}
+
+	config, err := manager.Get(data.Get("name").(string))
+	if err != nil {
+		return handleError(err)
+	}
+	if config == nil {
 		return nil, nil
 	}
 
+	params := make(map[string]string, len(config.Parameters))
+	sensitive := snapshotstore.SensitiveParameters(config.StorageType)
+	for k, v := range config.Parameters {
+		if !strutil.StrListContains(sensitive, k) {
+			params[k] = v
+		}
+	}
+
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"name":  name,
-			"rules": policy.Raw,
+			"interval":     int64(config.Interval.Seconds()),
+			"retain":       config.Retain,
+			"path_prefix":  config.PathPrefix,
+			"file_prefix":  config.FilePrefix,
+			"storage_type": config.StorageType,
+			"parameters":   params,
 		},
 	}, nil
 }
 
-// handlePolicySet handles the "policy/<name>" endpoint to set a policy
-func (b *SystemBackend) handlePolicySet(
+// handleRaftSnapshotAutoConfigUpdate creates or updates an automated
+// snapshot configuration
+func (b *SystemBackend) handleRaftSnapshotAutoConfigUpdate(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	name := data.Get("name").(string)
-
-	rulesRaw, ok := data.GetOk("rules")
-	if !ok {
-		return logical.ErrorResponse("'rules' parameter not supplied"), nil
-	}
-
-	rules := rulesRaw.(string)
-	if rules == "" {
-		return logical.ErrorResponse("'rules' parameter empty"), nil
+	manager := b.Core.raftSnapshotAuto
+	if manager == nil {
+		return handleError(ErrRaftStorageNotInUse)
 	}
 
-	// Validate the rules parse
-	parse, err := Parse(rules)
+	name := data.Get("name").(string)
+	config, err := manager.Get(name)
 	if err != nil {
 		return handleError(err)
 	}
+	if config == nil {
+		if _, ok := data.GetOk("interval"); !ok {
+			return logical.ErrorResponse("interval is required"), logical.ErrInvalidRequest
+		}
+		config = &RaftSnapshotAutoConfig{
+			Name:       name,
+			Retain:     data.Get("retain").(int),
+			FilePrefix: data.Get("file_prefix").(string),
+			Parameters: map[string]string{},
+		}
+	}
 
-	// Override the name
-	parse.Name = strings.ToLower(name)
+	if raw, ok := data.GetOk("interval"); ok {
+		config.Interval = time.Duration(raw.(int)) * time.Second
+	}
+	if raw, ok := data.GetOk("retain"); ok {
+		config.Retain = raw.(int)
+	}
+	if raw, ok := data.GetOk("path_prefix"); ok {
+		config.PathPrefix = raw.(string)
+	}
+	if raw, ok := data.GetOk("file_prefix"); ok {
+		config.FilePrefix = raw.(string)
+	}
+	if raw, ok := data.GetOk("storage_type"); ok {
+		// The parameters of another storage type do not apply
+		if config.StorageType != raw.(string) {
+			config.Parameters = map[string]string{}
+		}
+		config.StorageType = raw.(string)
+	}
 
-	// Update the policy
-	if err := b.Core.policyStore.SetPolicy(parse); err != nil {
-		return handleError(err)
+	// Parameters which are not given are kept, so that credentials do not
+	// have to be sent again to change other settings
+	params := map[string]string{}
+	if err := mapstructure.WeakDecode(data.Get("parameters").(map[string]interface{}), &params); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid parameters: %v", err)), logical.ErrInvalidRequest
+	}
+	for k, v := range params {
+		config.Parameters[k] = v
+	}
+
+	if err := manager.Set(config); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
 	}
 	return nil, nil
 }
 
-// handlePolicyDelete handles the "policy/<name>" endpoint to delete a policy
-func (b *SystemBackend) handlePolicyDelete(
+// handleRaftSnapshotAutoConfigDelete deletes an automated snapshot
+// configuration
+func (b *SystemBackend) handleRaftSnapshotAutoConfigDelete(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	name := data.Get("name").(string)
+	manager := b.Core.raftSnapshotAuto
+	if manager == nil {
+		return handleError(ErrRaftStorageNotInUse)
+	}
 
-	if err := b.Core.policyStore.DeletePolicy(name); err != nil {
+	if err := manager.Delete(data.Get("name").(string)); err != nil {
 		return handleError(err)
 	}
 	return nil, nil
 }
 
-// handleAuditTable handles the "audit" endpoint to provide the audit table
-func (b *SystemBackend) handleAuditTable(
+// handleRaftSnapshotAutoStatusRead returns the outcome of the automated
+// snapshots of a configuration
+func (b *SystemBackend) handleRaftSnapshotAutoStatusRead(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	b.Core.auditLock.RLock()
-	defer b.Core.auditLock.RUnlock()
+	manager := b.Core.raftSnapshotAuto
+	if manager == nil {
+		return handleError(ErrRaftStorageNotInUse)
+	}
 
-	resp := &logical.Response{
-		Data: make(map[string]interface{}),
+	status := manager.Status(data.Get("name").(string))
+	if status == nil {
+		return nil, nil
 	}
-	for _, entry := range b.Core.audit.Entries {
-		info := map[string]interface{}{
-			"path":        entry.Path,
-			"type":        entry.Type,
-			"description": entry.Description,
-			"options":     entry.Options,
-			"local":       entry.Local,
+
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
 		}
-		resp.Data[entry.Path] = info
+		return t.Format(time.RFC3339Nano)
 	}
-	return resp, nil
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"last_snapshot_start": formatTime(status.LastSnapshotStart),
+			"last_snapshot_end":   formatTime(status.LastSnapshotEnd),
+			"last_snapshot_name":  status.LastSnapshotName,
+			"last_snapshot_size":  status.LastSnapshotSize,
+			"last_error":          status.LastError,
+			"consecutive_errors":  status.ConsecutiveErrors,
+			"next_snapshot_start": formatTime(status.NextSnapshotStart),
+		},
+	}, nil
 }
 
-// handleAuditHash is used to fetch the hash of the given input data with the
-// specified audit backend's salt
-func (b *SystemBackend) handleAuditHash(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
-	input := data.Get("input").(string)
-	if input == "" {
-		return logical.ErrorResponse("the \"input\" parameter is empty"), nil
+// handleRaftSnapshotRestore returns a handler restoring the snapshot held by
+// the request body. Forced restores skip checking the keys of the snapshot.
+func (b *SystemBackend) handleRaftSnapshotRestore(force bool) framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		snapshot, ok := req.Data[logical.HTTPRawBody].([]byte)
+		if !ok || len(snapshot) == 0 {
+			return logical.ErrorResponse("the snapshot must be provided as the request body"), logical.ErrInvalidRequest
+		}
+
+		if err := b.Core.restoreRaftSnapshot(snapshot, force); err != nil {
+			return handleError(err)
+		}
+		return nil, nil
 	}
+}
 
-	path = sanitizeMountPath(path)
+// replicationSetPaths returns the paths managing a replication set, under
+// replication/<kind>/
+func (b *SystemBackend) replicationSetPaths(r *replicationSet) []*framework.Path {
+	prefix := "replication/" + r.kind + "/"
+	help := func(name string) (string, string) {
+		key := "replication-" + r.kind + "-" + name
+		return strings.TrimSpace(sysHelp[key][0]), strings.TrimSpace(sysHelp[key][1])
+	}
+	primarySynopsis, primaryDescription := help("primary")
+	tokenSynopsis, tokenDescription := help("secondary-token")
+	secondarySynopsis, secondaryDescription := help("secondary")
+	internalSynopsis, internalDescription := help("internal")
+
+	secondaryIDFields := map[string]*framework.FieldSchema{
+		"id": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The unique identifier of the secondary.",
+		},
+	}
+	activationFields := map[string]*framework.FieldSchema{
+		"token": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The activation token generated by the primary.",
+		},
+		"primary_api_addr": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The API address of the primary, overriding the address in the activation token.",
+		},
+		"ca_file": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The path to a PEM-encoded CA certificate verifying the API certificate of the primary.",
+		},
+		"ca_path": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The path to a directory of PEM-encoded CA certificates verifying the API certificate of the primary.",
+		},
+	}
+	internalFields := map[string]*framework.FieldSchema{
+		"op": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The operation of the secondary: wal, merkle, buckets or forward.",
+		},
+		"id": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The identifier of the secondary.",
+		},
+		"secret": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The secret of the secondary.",
+		},
+		"epoch": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The epoch of the WALs known by the secondary.",
+		},
+		"from": &framework.FieldSchema{
+			Type:        framework.TypeInt,
+			Description: "The index of the last WAL applied by the secondary.",
+		},
+		"buckets": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The comma-separated merkle buckets to fetch.",
+		},
+		"request": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The JSON-encoded request forwarded by a performance secondary.",
+		},
+	}
+	internalOps := "wal|merkle|buckets"
+	if r == b.Core.perfReplication {
+		internalOps += "|forward"
+	}
 
-	hash, err := b.Core.auditBroker.GetHash(path, input)
-	if err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+	paths := []*framework.Path{
+		&framework.Path{
+			Pattern: prefix + "status",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.handleReplicationSetStatus(r),
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["replication-status"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["replication-status"][1]),
+		},
+
+		&framework.Path{
+			Pattern: prefix + "primary/enable",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.handleReplicationPrimaryEnable(r),
+			},
+
+			HelpSynopsis:    primarySynopsis,
+			HelpDescription: primaryDescription,
+		},
+
+		&framework.Path{
+			Pattern: prefix + "primary/disable",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.handleReplicationPrimaryDisable(r),
+			},
+
+			HelpSynopsis:    primarySynopsis,
+			HelpDescription: primaryDescription,
+		},
+
+		&framework.Path{
+			Pattern: prefix + "primary/demote",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.handleReplicationPrimaryDemote(r),
+			},
+
+			HelpSynopsis:    primarySynopsis,
+			HelpDescription: primaryDescription,
+		},
+
+		&framework.Path{
+			Pattern: prefix + "primary/secondary-token",
+			Fields:  secondaryIDFields,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.handleReplicationPrimarySecondaryToken(r),
+			},
+
+			HelpSynopsis:    tokenSynopsis,
+			HelpDescription: tokenDescription,
+		},
+
+		&framework.Path{
+			Pattern: prefix + "primary/revoke-secondary",
+			Fields:  secondaryIDFields,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.handleReplicationPrimaryRevokeSecondary(r),
+			},
+
+			HelpSynopsis:    tokenSynopsis,
+			HelpDescription: tokenDescription,
+		},
+
+		&framework.Path{
+			Pattern: prefix + "secondary/enable",
+			Fields:  activationFields,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.handleReplicationSecondaryEnable(r),
+			},
+
+			HelpSynopsis:    secondarySynopsis,
+			HelpDescription: secondaryDescription,
+		},
+
+		&framework.Path{
+			Pattern: prefix + "secondary/promote",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.handleReplicationSecondaryPromote(r),
+			},
+
+			HelpSynopsis:    secondarySynopsis,
+			HelpDescription: secondaryDescription,
+		},
+
+		&framework.Path{
+			Pattern: prefix + "secondary/update-primary",
+			Fields:  activationFields,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.handleReplicationSecondaryUpdatePrimary(r),
+			},
+
+			HelpSynopsis:    secondarySynopsis,
+			HelpDescription: secondaryDescription,
+		},
+
+		&framework.Path{
+			Pattern: prefix + "internal/(?P<op>" + internalOps + ")",
+			Fields:  internalFields,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.handleReplicationInternal(r),
+			},
+
+			HelpSynopsis:    internalSynopsis,
+			HelpDescription: internalDescription,
+		},
+	}
+
+	if r == b.Core.perfReplication {
+		paths = append(paths, &framework.Path{
+			Pattern: prefix + "primary/paths-filter/(?P<id>.+)",
+			Fields: map[string]*framework.FieldSchema{
+				"id": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The unique identifier of the secondary.",
+				},
+				"mode": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The mode of the filter: allow ships only the given paths to the secondary, deny ships all the paths but the given ones.",
+				},
+				"paths": &framework.FieldSchema{
+					Type:        framework.TypeCommaStringSlice,
+					Description: "The paths of the mounts or namespaces filtered.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.handlePerfPathsFilterRead,
+				logical.UpdateOperation: b.handlePerfPathsFilterWrite,
+				logical.DeleteOperation: b.handlePerfPathsFilterDelete,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["replication-performance-paths-filter"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["replication-performance-paths-filter"][1]),
+		})
 	}
+	return paths
+}
 
+// handleReplicationStatus returns the replication status of the cluster
+func (b *SystemBackend) handleReplicationStatus(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"hash": hash,
+			"mode":        b.Core.ReplicationState().String(),
+			"performance": b.Core.replicationStatus(b.Core.perfReplication),
+			"dr":          b.Core.replicationStatus(b.Core.drReplication),
 		},
 	}, nil
 }
 
-// handleEnableAudit is used to enable a new audit backend
-func (b *SystemBackend) handleEnableAudit(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	b.Core.clusterParamsLock.RLock()
-	repState := b.Core.replicationState
-	b.Core.clusterParamsLock.RUnlock()
+// handleReplicationSetStatus returns the status of a replication set
+func (b *SystemBackend) handleReplicationSetStatus(r *replicationSet) framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		return &logical.Response{
+			Data: b.Core.replicationStatus(r),
+		}, nil
+	}
+}
 
-	local := data.Get("local").(bool)
-	if !local && repState == consts.ReplicationSecondary {
-		return logical.ErrorResponse("cannot add a non-local mount to a replication secondary"), nil
+// handleReplicationReindex rebuilds the merkle index of the enabled
+// replication sets from the storage
+func (b *SystemBackend) handleReplicationReindex(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	state := b.Core.ReplicationState()
+	reindexed := false
+	for _, r := range b.Core.replicationSets() {
+		if !state.HasState(r.primaryState | r.secondaryState) {
+			continue
+		}
+		if err := b.Core.replicationReindex(r); err != nil {
+			return handleError(err)
+		}
+		reindexed = true
 	}
+	if !reindexed {
+		return logical.ErrorResponse("replication is not enabled"), logical.ErrInvalidRequest
+	}
+	return nil, nil
+}
 
-	// Get all the options
-	path := data.Get("path").(string)
-	backendType := data.Get("type").(string)
-	description := data.Get("description").(string)
-	options := data.Get("options").(map[string]interface{})
+// handleReplicationPrimaryEnable enables a replication set as a primary
+func (b *SystemBackend) handleReplicationPrimaryEnable(r *replicationSet) framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		if b.Core.ReplicationState().HasState(r.primaryState | r.secondaryState) {
+			return logical.ErrorResponse(fmt.Sprintf("%s replication is already enabled", r.name)), logical.ErrInvalidRequest
+		}
 
-	optionMap := make(map[string]string)
-	for k, v := range options {
-		vStr, ok := v.(string)
-		if !ok {
-			return logical.ErrorResponse("options must be string valued"),
-				logical.ErrInvalidRequest
+		cluster, err := b.Core.Cluster()
+		if err != nil {
+			return handleError(err)
 		}
-		optionMap[k] = vStr
+		if cluster == nil || cluster.ID == "" {
+			return handleError(fmt.Errorf("cluster information not available"))
+		}
+
+		if err := b.Core.persistReplicationConfig(r, &replicationConfig{
+			Mode:             replicationModePrimary,
+			PrimaryClusterID: cluster.ID,
+		}); err != nil {
+			return handleError(err)
+		}
+		if err := b.Core.loadReplicationSetState(r); err != nil {
+			return handleError(err)
+		}
+		if err := b.Core.startReplicationSet(r); err != nil {
+			return handleError(err)
+		}
+		return nil, nil
 	}
+}
 
-	// Create the mount entry
-	me := &MountEntry{
-		Table:       auditTableType,
-		Path:        path,
-		Type:        backendType,
-		Description: description,
-		Options:     optionMap,
-		Local:       local,
+// handleReplicationPrimaryDisable disables the replication of a primary. Its
+// secondaries can't connect to it anymore.
+func (b *SystemBackend) handleReplicationPrimaryDisable(r *replicationSet) framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		if !b.Core.ReplicationState().HasState(r.primaryState) {
+			return logical.ErrorResponse(fmt.Sprintf("%s replication is not enabled as a primary", r.name)), logical.ErrInvalidRequest
+		}
+
+		if err := b.Core.persistReplicationConfig(r, nil); err != nil {
+			return handleError(err)
+		}
+		secondaries, err := b.Core.barrier.List(r.secondariesPath)
+		if err != nil {
+			return handleError(err)
+		}
+		for _, id := range secondaries {
+			if err := b.Core.barrier.Delete(r.secondariesPath + id); err != nil {
+				return handleError(err)
+			}
+		}
+
+		b.Core.stopReplicationSet(r)
+		if err := b.Core.loadReplicationSetState(r); err != nil {
+			return handleError(err)
+		}
+		return nil, nil
 	}
+}
+
+// handleReplicationPrimaryDemote turns a primary into a secondary without a
+// primary, which can be promoted again or pointed to the new primary
+func (b *SystemBackend) handleReplicationPrimaryDemote(r *replicationSet) framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		if !b.Core.ReplicationState().HasState(r.primaryState) {
+			return logical.ErrorResponse(fmt.Sprintf("%s replication is not enabled as a primary", r.name)), logical.ErrInvalidRequest
+		}
+
+		r.l.RLock()
+		clusterID := r.config.PrimaryClusterID
+		r.l.RUnlock()
+
+		if err := b.Core.persistReplicationConfig(r, &replicationConfig{
+			Mode:             replicationModeSecondary,
+			PrimaryClusterID: clusterID,
+		}); err != nil {
+			return handleError(err)
+		}
+		go b.Core.reloadReplication()
 
-	// Attempt enabling
-	if err := b.Core.enableAudit(me); err != nil {
-		b.Backend.Logger().Error("sys: enable audit mount failed", "path", me.Path, "error", err)
-		return handleError(err)
+		resp := &logical.Response{}
+		if r == b.Core.drReplication {
+			resp.AddWarning("This cluster is being demoted to a DR secondary and will only serve the replication requests.")
+		} else {
+			resp.AddWarning(fmt.Sprintf("This cluster is being demoted to a %s secondary.", r.name))
+		}
+		return resp, nil
 	}
-	return nil, nil
 }
 
-// handleDisableAudit is used to disable an audit backend
-func (b *SystemBackend) handleDisableAudit(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
+// handleReplicationPrimarySecondaryToken registers a secondary and returns
+// the token activating it
+func (b *SystemBackend) handleReplicationPrimarySecondaryToken(r *replicationSet) framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		id := data.Get("id").(string)
+		if id == "" {
+			return logical.ErrorResponse("id must be specified"), logical.ErrInvalidRequest
+		}
 
-	// Attempt disable
-	if existed, err := b.Core.disableAudit(path); existed && err != nil {
-		b.Backend.Logger().Error("sys: disable audit mount failed", "path", path, "error", err)
-		return handleError(err)
+		token, err := b.Core.generateReplicationActivationToken(r, id)
+		if err != nil {
+			return handleError(err)
+		}
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"token": token,
+			},
+		}, nil
 	}
-	return nil, nil
 }
 
-// handleRawRead is used to read directly from the barrier
-func (b *SystemBackend) handleRawRead(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
+// handleReplicationPrimaryRevokeSecondary revokes the credentials of a
+// secondary
+func (b *SystemBackend) handleReplicationPrimaryRevokeSecondary(r *replicationSet) framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		id := data.Get("id").(string)
+		if id == "" {
+			return logical.ErrorResponse("id must be specified"), logical.ErrInvalidRequest
+		}
 
-	// Prevent access of protected paths
-	for _, p := range protectedPaths {
-		if strings.HasPrefix(path, p) {
-			err := fmt.Sprintf("cannot read '%s'", path)
-			return logical.ErrorResponse(err), logical.ErrInvalidRequest
+		if !b.Core.ReplicationState().HasState(r.primaryState) {
+			return logical.ErrorResponse(fmt.Sprintf("%s replication is not enabled as a primary", r.name)), logical.ErrInvalidRequest
 		}
+		if err := b.Core.barrier.Delete(r.secondariesPath + id); err != nil {
+			return handleError(err)
+		}
+		return nil, nil
 	}
+}
 
-	entry, err := b.Core.barrier.Get(path)
+// replicationSecondaryConfig returns the configuration of a secondary
+// connecting to the primary of the given activation token
+func replicationSecondaryConfig(data *framework.FieldData) (*replicationConfig, error) {
+	token, err := parseReplicationActivationToken(data.Get("token").(string))
 	if err != nil {
-		return handleError(err)
+		return nil, err
 	}
-	if entry == nil {
-		return nil, nil
+
+	conf := &replicationConfig{
+		Mode:             replicationModeSecondary,
+		PrimaryClusterID: token.PrimaryClusterID,
+		PrimaryAPIAddr:   token.PrimaryAPIAddr,
+		SecondaryID:      token.ID,
+		Secret:           token.Secret,
+		CAFile:           data.Get("ca_file").(string),
+		CAPath:           data.Get("ca_path").(string),
 	}
-	resp := &logical.Response{
-		Data: map[string]interface{}{
-			"value": string(entry.Value),
-		},
+	if addr := data.Get("primary_api_addr").(string); addr != "" {
+		conf.PrimaryAPIAddr = addr
 	}
-	return resp, nil
+	if conf.PrimaryAPIAddr == "" {
+		return nil, fmt.Errorf("the API address of the primary is unknown, primary_api_addr must be specified")
+	}
+	return conf, nil
 }
 
-// handleRawWrite is used to write directly to the barrier
-func (b *SystemBackend) handleRawWrite(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
+// handleReplicationSecondaryEnable enables a replication set as a secondary.
+// The replicated data of the cluster is replaced by the data of the primary.
+func (b *SystemBackend) handleReplicationSecondaryEnable(r *replicationSet) framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		if b.Core.ReplicationState().HasState(r.primaryState | r.secondaryState) {
+			return logical.ErrorResponse(fmt.Sprintf("%s replication is already enabled", r.name)), logical.ErrInvalidRequest
+		}
 
-	// Prevent access of protected paths
-	for _, p := range protectedPaths {
-		if strings.HasPrefix(path, p) {
-			err := fmt.Sprintf("cannot write '%s'", path)
-			return logical.ErrorResponse(err), logical.ErrInvalidRequest
+		conf, err := replicationSecondaryConfig(data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		if err := b.Core.replicationCheckPrimary(r, conf); err != nil {
+			return handleError(err)
 		}
-	}
 
-	value := data.Get("value").(string)
-	entry := &Entry{
-		Key:   path,
-		Value: []byte(value),
+		if err := b.Core.persistReplicationConfig(r, conf); err != nil {
+			return handleError(err)
+		}
+		go b.Core.reloadReplication()
+
+		resp := &logical.Response{}
+		if r == b.Core.drReplication {
+			resp.AddWarning("This cluster is being enabled as a DR secondary. Its data is replaced by the data of the primary, including the tokens, and it will only serve the replication requests.")
+		} else {
+			resp.AddWarning(fmt.Sprintf("This cluster is being enabled as a %s secondary. Its data is replaced by the data of the primary, except for its tokens, leases and local mounts.", r.name))
+		}
+		return resp, nil
 	}
-	if err := b.Core.barrier.Put(entry); err != nil {
-		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+}
+
+// handleReplicationSecondaryPromote promotes a secondary to a primary, after
+// a failure of its primary
+func (b *SystemBackend) handleReplicationSecondaryPromote(r *replicationSet) framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		if !b.Core.ReplicationState().HasState(r.secondaryState) {
+			return logical.ErrorResponse(fmt.Sprintf("%s replication is not enabled as a secondary", r.name)), logical.ErrInvalidRequest
+		}
+
+		r.l.RLock()
+		clusterID := r.config.PrimaryClusterID
+		r.l.RUnlock()
+
+		if err := b.Core.persistReplicationConfig(r, &replicationConfig{
+			Mode:             replicationModePrimary,
+			PrimaryClusterID: clusterID,
+		}); err != nil {
+			return handleError(err)
+		}
+		go b.Core.reloadReplication()
+
+		resp := &logical.Response{}
+		resp.AddWarning(fmt.Sprintf("This cluster is being promoted to a %s primary. The secondaries of the former primary must be given new activation tokens.", r.name))
+		return resp, nil
 	}
-	return nil, nil
 }
 
-// handleRawDelete is used to delete directly from the barrier
-func (b *SystemBackend) handleRawDelete(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
+// handleReplicationSecondaryUpdatePrimary points a secondary to another
+// primary of its replication set. A blank token disconnects it from its
+// primary.
+func (b *SystemBackend) handleReplicationSecondaryUpdatePrimary(r *replicationSet) framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		if !b.Core.ReplicationState().HasState(r.secondaryState) {
+			return logical.ErrorResponse(fmt.Sprintf("%s replication is not enabled as a secondary", r.name)), logical.ErrInvalidRequest
+		}
 
-	// Prevent access of protected paths
-	for _, p := range protectedPaths {
-		if strings.HasPrefix(path, p) {
-			err := fmt.Sprintf("cannot delete '%s'", path)
-			return logical.ErrorResponse(err), logical.ErrInvalidRequest
+		r.l.RLock()
+		clusterID := r.config.PrimaryClusterID
+		r.l.RUnlock()
+
+		conf := &replicationConfig{
+			Mode:             replicationModeSecondary,
+			PrimaryClusterID: clusterID,
+		}
+		if data.Get("token").(string) != "" {
+			var err error
+			if conf, err = replicationSecondaryConfig(data); err != nil {
+				return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+			}
+			if clusterID != "" && conf.PrimaryClusterID != clusterID {
+				return logical.ErrorResponse("the activation token belongs to another replication set"), logical.ErrInvalidRequest
+			}
+			if err := b.Core.replicationCheckPrimary(r, conf); err != nil {
+				return handleError(err)
+			}
+		}
+
+		if err := b.Core.persistReplicationConfig(r, conf); err != nil {
+			return handleError(err)
+		}
+		if err := b.Core.loadReplicationSetState(r); err != nil {
+			return handleError(err)
 		}
+		return nil, nil
 	}
+}
 
-	if err := b.Core.barrier.Delete(path); err != nil {
-		return handleError(err)
+// handleReplicationInternal serves the WALs and the merkle index of a
+// primary to its secondaries, which authenticate with their activation
+// credentials. The performance secondaries also forward their writes.
+func (b *SystemBackend) handleReplicationInternal(r *replicationSet) framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		secondary, err := b.Core.checkReplicationSecondary(r, data.Get("id").(string), data.Get("secret").(string))
+		if err != nil {
+			if err == logical.ErrPermissionDenied {
+				return nil, err
+			}
+			return handleError(err)
+		}
+		shipped, filteredMounts := b.Core.replicationPathsFilter(secondary)
+
+		switch data.Get("op").(string) {
+		case "wal":
+			entries, last, ok, err := b.Core.replicationWALsSince(r, data.Get("epoch").(string), uint64(data.Get("from").(int)), shipped)
+			if err != nil {
+				return handleError(err)
+			}
+			if !ok {
+				return &logical.Response{
+					Data: map[string]interface{}{
+						"reset": true,
+					},
+				}, nil
+			}
+			return &logical.Response{
+				Data: map[string]interface{}{
+					"reset":           false,
+					"last":            last,
+					"entries":         replicationEntriesData(entries),
+					"filtered_mounts": filteredMounts,
+				},
+			}, nil
+
+		case "merkle":
+			epoch, last, hashes, err := b.Core.replicationMerkleState(r, shipped)
+			if err != nil {
+				return handleError(err)
+			}
+			return &logical.Response{
+				Data: map[string]interface{}{
+					"epoch":           epoch,
+					"last":            last,
+					"buckets":         hashes,
+					"filtered_mounts": filteredMounts,
+				},
+			}, nil
+
+		case "buckets":
+			var buckets []int
+			for _, raw := range strutil.ParseDedupAndSortStrings(data.Get("buckets").(string), ",") {
+				bucket, err := strconv.Atoi(raw)
+				if err != nil {
+					return logical.ErrorResponse(fmt.Sprintf("invalid merkle bucket %q", raw)), logical.ErrInvalidRequest
+				}
+				buckets = append(buckets, bucket)
+			}
+			entries, err := b.Core.replicationBucketEntries(r, buckets, shipped)
+			if err != nil {
+				return handleError(err)
+			}
+			return &logical.Response{
+				Data: map[string]interface{}{
+					"entries": replicationEntriesData(entries),
+				},
+			}, nil
+
+		case "forward":
+			result, err := b.Core.replicationRouteForwarded(r, data.Get("request").(string))
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+			}
+			return &logical.Response{
+				Data: result,
+			}, nil
+		}
+
+		return nil, logical.ErrUnsupportedPath
 	}
-	return nil, nil
 }
 
-// handleKeyStatus returns status information about the backend key
-func (b *SystemBackend) handleKeyStatus(
+// handlePerfPathsFilterRead returns the paths filter of a performance
+// secondary
+func (b *SystemBackend) handlePerfPathsFilterRead(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Get the key info
-	info, err := b.Core.barrier.ActiveKeyInfo()
+	secondary, err := b.Core.replicationSecondary(b.Core.perfReplication, data.Get("id").(string))
 	if err != nil {
-		return nil, err
+		return handleError(err)
 	}
-
-	resp := &logical.Response{
+	if secondary == nil || secondary.FilterMode == "" {
+		return nil, nil
+	}
+	return &logical.Response{
 		Data: map[string]interface{}{
-			"term":         info.Term,
-			"install_time": info.InstallTime.Format(time.RFC3339Nano),
+			"mode":  secondary.FilterMode,
+			"paths": secondary.FilterPaths,
 		},
-	}
-	return resp, nil
+	}, nil
 }
 
-// handleRotate is used to trigger a key rotation
-func (b *SystemBackend) handleRotate(
+// handlePerfPathsFilterWrite sets the paths filter of a performance
+// secondary. The secondary reconciles its data on its next sync.
+func (b *SystemBackend) handlePerfPathsFilterWrite(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	b.Core.clusterParamsLock.RLock()
-	repState := b.Core.replicationState
-	b.Core.clusterParamsLock.RUnlock()
-	if repState == consts.ReplicationSecondary {
-		return logical.ErrorResponse("cannot rotate on a replication secondary"), nil
+	r := b.Core.perfReplication
+	if !b.Core.ReplicationState().HasState(r.primaryState) {
+		return logical.ErrorResponse("performance replication is not enabled as a primary"), logical.ErrInvalidRequest
 	}
 
-	// Rotate to the new term
-	newTerm, err := b.Core.barrier.Rotate()
-	if err != nil {
-		b.Backend.Logger().Error("sys: failed to create new encryption key", "error", err)
-		return handleError(err)
+	mode := data.Get("mode").(string)
+	switch mode {
+	case replicationFilterAllow, replicationFilterDeny:
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("mode must be %q or %q", replicationFilterAllow, replicationFilterDeny)), logical.ErrInvalidRequest
 	}
-	b.Backend.Logger().Info("sys: installed new encryption key")
-
-	// In HA mode, we need to an upgrade path for the standby instances
-	if b.Core.ha != nil {
-		// Create the upgrade path to the new term
-		if err := b.Core.barrier.CreateUpgrade(newTerm); err != nil {
-			b.Backend.Logger().Error("sys: failed to create new upgrade", "term", newTerm, "error", err)
+	var paths []string
+	for _, path := range data.Get("paths").([]string) {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, sanitizeMountPath(path))
 		}
-
-		// Schedule the destroy of the upgrade path
-		time.AfterFunc(keyRotateGracePeriod, func() {
-			if err := b.Core.barrier.DestroyUpgrade(newTerm); err != nil {
-				b.Backend.Logger().Error("sys: failed to destroy upgrade", "term", newTerm, "error", err)
-			}
-		})
+	}
+	if len(paths) == 0 {
+		return logical.ErrorResponse("paths must be specified"), logical.ErrInvalidRequest
 	}
 
-	// Write to the canary path, which will force a synchronous truing during
-	// replication
-	if err := b.Core.barrier.Put(&Entry{
-		Key:   coreKeyringCanaryPath,
-		Value: []byte(fmt.Sprintf("new-rotation-term-%d", newTerm)),
-	}); err != nil {
-		b.Core.logger.Error("core: error saving keyring canary", "error", err)
-		return nil, fmt.Errorf("failed to save keyring canary: %v", err)
+	secondary, err := b.Core.replicationSecondary(r, data.Get("id").(string))
+	if err != nil {
+		return handleError(err)
+	}
+	if secondary == nil {
+		return logical.ErrorResponse("unknown secondary"), logical.ErrInvalidRequest
+	}
+	secondary.FilterMode = mode
+	secondary.FilterPaths = paths
+	if err := b.Core.persistReplicationSecondary(r, secondary); err != nil {
+		return handleError(err)
 	}
+	return nil, nil
+}
 
+// handlePerfPathsFilterDelete removes the paths filter of a performance
+// secondary, which receives all the replicated data again
+func (b *SystemBackend) handlePerfPathsFilterDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	r := b.Core.perfReplication
+	secondary, err := b.Core.replicationSecondary(r, data.Get("id").(string))
+	if err != nil {
+		return handleError(err)
+	}
+	if secondary == nil || secondary.FilterMode == "" {
+		return nil, nil
+	}
+	secondary.FilterMode = ""
+	secondary.FilterPaths = nil
+	if err := b.Core.persistReplicationSecondary(r, secondary); err != nil {
+		return handleError(err)
+	}
 	return nil, nil
 }
 
+// replicationEntriesData returns the replicated entries as response data. The
+// values are base64-encoded strings so that they are hashed in the audit log.
+func replicationEntriesData(entries []*replicationWALEntry) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		item := map[string]interface{}{
+			"key": entry.Key,
+		}
+		if entry.Deleted {
+			item["deleted"] = true
+		} else {
+			item["value"] = base64.StdEncoding.EncodeToString(entry.Value)
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
 func (b *SystemBackend) handleWrappingPubkey(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	x, _ := b.Core.wrappingJWTKey.X.MarshalText()
@@ -2319,6 +6442,27 @@ This path responds to the following HTTP methods.
         Clears the CORS configuration and disables acceptance of CORS requests.
 		`,
 	},
+	"config/est": {
+		"Configures the PKI mount serving EST at the standard path.",
+		`
+EST (RFC 7030) clients expect the server at the /.well-known/est/ path, while
+the EST endpoints of PKI mounts are under /v1/<mount>/est/. Requests to
+/.well-known/est/<path> are served by the EST endpoints of the configured PKI
+mount, as /v1/<mount>/est/<path>, so that labels select roles the same way.
+EST must also be enabled on the mount via its "config/est" endpoint.
+
+This path responds to the following HTTP methods.
+
+    GET /
+        Returns the path of the PKI mount serving EST at the standard path.
+
+    POST /
+        Sets the path of the PKI mount serving EST at the standard path.
+
+    DELETE /
+        Stops serving EST at the standard path.
+		`,
+	},
 	"init": {
 		"Initializes or returns the initialization status of the Vault.",
 		`
@@ -2445,6 +6589,14 @@ and is unaffected by replication.`,
 		`The max lease TTL for this mount.`,
 	},
 
+	"tune_default_wrapping_ttl": {
+		`The TTL with which responses of this mount are wrapped if wrapping is not requested. "0" disables it.`,
+	},
+
+	"tune_max_wrapping_ttl": {
+		`The max TTL of the wrapping tokens of responses of this mount. "0" disables it.`,
+	},
+
 	"remount": {
 		"Move the mount point of an already-mounted backend.",
 		`
@@ -2458,7 +6610,16 @@ This path responds to the following HTTP methods.
 	"auth_tune": {
 		"Tune the configuration parameters for an auth path.",
 		`Read and write the 'default-lease-ttl' and 'max-lease-ttl' values of
-the auth path.`,
+the auth path, the type of the tokens issued by its logins, and the lockout
+of its users.`,
+	},
+
+	"tune_token_type": {
+		`The type of the tokens issued by logins to this auth mount: "service", "batch" or "default", which issues service tokens.`,
+	},
+
+	"tune_user_lockout_config": {
+		`The user lockout of this auth mount: "lockout_threshold" failed logins, each within "lockout_counter_reset_duration" of the previous one, lock users out for "lockout_duration". A zero threshold disables it.`,
 	},
 
 	"mount_tune": {
@@ -2531,6 +6692,17 @@ of external secrets. Access to this prefix should be tightly controlled.
 		"",
 	},
 
+	"revoke-force-lease": {
+		"Revoke a single lease, ignoring errors.",
+		`
+See the path help for 'revoke'; this behaves the same, except that it ignores
+errors encountered during revocation and removes the lease regardless. This is
+mostly meant for removing irrevocable leases once the underlying issue is
+addressed. This is a DANGEROUS operation as it removes Vault's oversight of the
+external secret. Access to this path should be tightly controlled.
+		`,
+	},
+
 	"auth-table": {
 		"List the currently enabled credential backends.",
 		`
@@ -2668,9 +6840,96 @@ Enable a new audit backend or disable an existing backend.
 	"rotate": {
 		"Rotates the backend encryption key used to persist data.",
 		`
-		Rotate generates a new encryption key which is used to encrypt all
-		data going to the storage backend. The old encryption keys are kept so
-		that data encrypted using those keys can still be decrypted.
+		Rotate generates a new encryption key which is used to encrypt all
+		data going to the storage backend. The old encryption keys are kept so
+		that data encrypted using those keys can still be decrypted.
+		`,
+	},
+
+	"raft-configuration": {
+		"Returns the membership of the raft cluster.",
+		`
+		Returns the servers of the raft cluster, with their node IDs and raft
+		addresses, whether they are voters, and which of them leads the cluster.
+		`,
+	},
+
+	"raft-remove-peer": {
+		"Removes a server from the raft cluster.",
+		`
+		Removes the server with the given node ID from the raft cluster. The
+		removed server stops taking part in the cluster, and can't rejoin it
+		without its raft data being removed.
+		`,
+	},
+
+	"raft-transfer-leadership": {
+		"Hands the leadership of the raft cluster over to another voter.",
+		`
+		Hands the leadership of the raft cluster over to the voter with the
+		given node ID, or to the most up to date voter. The active node steps
+		down, as the HA lock is held by the leader of the cluster.
+		`,
+	},
+
+	"raft-snapshot": {
+		"Saves or restores a snapshot of the raft storage.",
+		`
+		Reading this endpoint returns a gzipped snapshot of the data of the raft
+		cluster. Writing a snapshot, as the request body, replaces the data of
+		the cluster with the data of the snapshot, which must be encrypted with
+		the current master key. The active node then steps down to load the
+		restored data. The membership of the cluster is not restored.
+		`,
+	},
+
+	"raft-snapshot-force": {
+		"Restores a snapshot of the raft storage encrypted with other keys.",
+		`
+		Replaces the data of the raft cluster with the data of the snapshot in
+		the request body, without checking that it is encrypted with the current
+		master key. The node seals once the snapshot is restored, and must be
+		unsealed with the unseal keys of the snapshot.
+		`,
+	},
+
+	"raft-autopilot-configuration": {
+		"Configures autopilot, which manages the servers of the raft cluster.",
+		`
+		Autopilot runs on the active node to evaluate the health of the servers
+		of the raft cluster. New servers join the cluster as non-voters, and are
+		promoted to voters once they have been healthy for the stabilization
+		time. When enabled, servers which have not contacted the leader for the
+		dead server threshold are removed, unless the voters would fall below
+		the minimum quorum.
+		`,
+	},
+
+	"raft-autopilot-state": {
+		"Returns the health of the servers of the raft cluster.",
+		`
+		Returns whether all the voters are healthy, how many voters may fail
+		without the cluster losing its quorum, and the health of each server:
+		its status, last contact with the leader and last replicated index.
+		The servers and voters of each redundancy zone are also returned.
+		`,
+	},
+
+	"raft-snapshot-auto-config": {
+		"Configures periodic snapshots of the raft storage.",
+		`
+The active node takes a snapshot of the raft storage at the configured
+interval, and uploads it to a local directory or to an S3, GCS or Azure Blob
+Storage bucket. Only the configured number of snapshots is retained; older
+ones are deleted after each upload.
+		`,
+	},
+
+	"raft-snapshot-auto-status": {
+		"Returns the outcome of the periodic snapshots of a configuration.",
+		`
+Returns the time, name and size of the last snapshot taken for the
+configuration since the node became active, and the last error if it failed.
 		`,
 	},
 
@@ -2769,6 +7028,433 @@ This path responds to the following HTTP methods.
         Delete the plugin with the given name.
 		`,
 	},
+	"managed-keys": {
+		`Configures the keys held in external devices`,
+		`
+Managed keys are keys whose private material is held outside of Vault, such
+as in a cloud KMS. Backends that support them delegate all operations using
+the private key to the device holding it. A key can only be used by the
+mounts listed in its "allowed_mounts".
+
+This path responds to the following HTTP methods.
+    LIST /
+        Returns a list of names of configured managed keys.
+
+    GET /<name>
+        Retrieve the configuration of the named managed key.
+
+    PUT /<name>
+        Add or update a managed key.
+
+    DELETE /<name>
+        Delete the managed key with the given name.
+		`,
+	},
+	"password-policies": {
+		`Configures the policies passwords are generated from`,
+		`
+Password policies describe the length of generated passwords and the
+characters they are made of. Backends that generate passwords, such as
+RabbitMQ, can be configured to use a policy by name.
+
+This path responds to the following HTTP methods.
+    LIST /
+        Returns a list of names of password policies.
+
+    GET /<name>
+        Retrieve the named password policy.
+
+    PUT /<name>
+        Add or update a password policy.
+
+    DELETE /<name>
+        Delete the password policy with the given name.
+		`,
+	},
+	"sync-destinations": {
+		`Configures the external secret stores KV secrets are pushed to`,
+		`
+Sync destinations are external secret stores, such as AWS Secrets Manager,
+which KV secrets are pushed to. The supported types are "aws-sm",
+"azure-kv" and "gcp-sm", and their parameters depend on the type. Sensitive
+parameters are never returned.
+
+This path responds to the following HTTP methods.
+    LIST /
+        Returns a list of destinations, as "<type>/<name>".
+
+    GET /<type>/<name>
+        Retrieve the named destination.
+
+    PUT /<type>/<name>
+        Add or update a destination.
+
+    DELETE /<type>/<name>
+        Delete a destination which has no associated secrets.
+		`,
+	},
+	"sync-associations": {
+		`Configures the KV secrets pushed to a sync destination`,
+		`
+Associating a KV secret with a destination pushes it to the destination, and
+pushes it again every time it is written or deleted. The secret is stored as
+a JSON object of its fields.
+
+This path responds to the following HTTP methods.
+    GET /<type>/<name>/associations
+        Returns the secrets associated with the destination and the result of
+        their last push.
+
+    PUT /<type>/<name>/associations/set
+        Associate a secret with the destination and push it.
+
+    PUT /<type>/<name>/associations/remove
+        Remove the association and delete the secret from the destination.
+		`,
+	},
+	"sync-drift": {
+		`Compares a sync destination with the secrets associated with it`,
+		`
+Reports whether each secret associated with the destination is in sync,
+missing from the destination, or was changed outside of Vault.
+		`,
+	},
+	"locked-users": {
+		`Lists and unlocks the users locked out of auth mounts`,
+		`
+Users of the userpass, LDAP, Okta and RADIUS auth backends are locked out of
+their mount after failed logins, once the lockout threshold of the mount is
+tuned with the "user_lockout_config" parameter. They are unlocked when the
+lockout duration of the mount expires, or with this path.
+
+This path responds to the following HTTP methods.
+    GET /
+        Returns the locked users of all auth mounts, or of the auth mount
+        given by the "mount" parameter.
+
+    POST /<mount>/unlock/<user>
+        Unlocks a user of an auth mount.
+		`,
+	},
+
+	"external-groups": {
+		`Configures the groups mapping the groups of auth backends to policies`,
+		`
+External groups grant policies to the users an auth backend reports as
+members of one of their aliases, such as LDAP groups. Aliases are written in
+the "<mount path>:<group name>" format, for example "ldap:engineering".
+Groups are resolved when users log in, so changes apply to new tokens.
+
+This path responds to the following HTTP methods.
+    LIST /
+        Returns a list of names of external groups.
+
+    GET /<name>
+        Retrieve the named external group.
+
+    PUT /<name>
+        Add or update an external group.
+
+    DELETE /<name>
+        Delete the named external group.
+		`,
+	},
+	"rgp": {
+		`Manages the role governing policies (RGPs)`,
+		`
+RGPs are rule policies applying to the tokens having them among their
+policies, including the policies granted by external groups. They are
+evaluated against the request, the token, its identity and MFA status and the
+time once the ACL policies allow a request. The "main" rule of each policy
+must be true, unless the policy is advisory, or soft-mandatory and the
+request sets the X-Vault-Policy-Override header.
+
+This path responds to the following HTTP methods.
+    LIST /
+        Returns a list of names of RGPs.
+
+    GET /<name>
+        Retrieve the named RGP.
+
+    PUT /<name>
+        Add or update an RGP.
+
+    DELETE /<name>
+        Delete the named RGP.
+		`,
+	},
+	"egp": {
+		`Manages the endpoint governing policies (EGPs)`,
+		`
+EGPs are rule policies applying to the requests on their paths, whatever the
+token of the request, including the logins. They are evaluated like the RGPs.
+Paths ending with "*" are prefixes.
+
+This path responds to the following HTTP methods.
+    LIST /
+        Returns a list of names of EGPs.
+
+    GET /<name>
+        Retrieve the named EGP.
+
+    PUT /<name>
+        Add or update an EGP.
+
+    DELETE /<name>
+        Delete the named EGP.
+		`,
+	},
+	"quotas-config": {
+		`Configures the quotas`,
+		`
+Configures the request path prefixes exempt from rate limit quotas, which
+default to sys/health, sys/leader and sys/seal-status, and whether the
+requests rejected by rate limit quotas are audit logged.
+		`,
+	},
+	"rate-limit-quotas": {
+		`Manages the rate limit quotas`,
+		`
+Rate limit quotas limit each client to a number of requests per interval.
+A quota applies to all the requests, to the requests of a namespace or mount,
+or to the requests on a path prefix, and requests are only subject to the
+most specific quota applying to them. Requests exceeding their quota are
+rejected with a 429 status.
+
+This path responds to the following HTTP methods.
+    LIST /
+        Returns a list of names of rate limit quotas.
+
+    GET /<name>
+        Retrieve the named rate limit quota.
+
+    PUT /<name>
+        Add or update a rate limit quota.
+
+    DELETE /<name>
+        Delete the named rate limit quota.
+		`,
+	},
+	"lease-count-quotas": {
+		`Manages the lease count quotas`,
+		`
+Lease count quotas cap the number of leases of all the requests, of a
+namespace or mount, or of a request path prefix, including the leases of the
+tokens. Leases are only subject to the most specific quota applying to them.
+The requests which would create a lease exceeding their quota fail with a 429
+status, and the secrets they generated are revoked.
+
+This path responds to the following HTTP methods.
+    LIST /
+        Returns a list of names of lease count quotas.
+
+    GET /<name>
+        Retrieve the named lease count quota and its lease count.
+
+    PUT /<name>
+        Add or update a lease count quota.
+
+    DELETE /<name>
+        Delete the named lease count quota.
+		`,
+	},
+	"control-group-request": {
+		`Checks the status of a request under a control group`,
+		`
+Requests on paths whose policy sets a control group get a wrapped response,
+which cannot be unwrapped until enough members of the groups of each factor
+authorized the request. Given the accessor of the wrapping token, this returns
+the path and requester of the request, the authorizations it got and whether
+it is approved.
+		`,
+	},
+	"control-group-authorize": {
+		`Authorizes a request under a control group`,
+		`
+Given the accessor of the wrapping token of a request under a control group,
+this records the authorization of the request by the token of the request,
+for each factor whose external groups it is a member of. Requesters cannot
+authorize their own requests, and each approver counts once per factor.
+		`,
+	},
+	"namespaces": {
+		`Manages the namespaces within the namespace of the request`,
+		`
+Namespaces have their own mounts, auth backends, policies, tokens and external
+groups. Their paths are those of the root namespace prefixed with the path of
+the namespace, so "sys/mounts" of the "engineering" namespace is
+"engineering/sys/mounts", which can also be requested as "sys/mounts" with the
+"X-Vault-Namespace" header set to "engineering". Namespaces are nested by
+creating them within another namespace.
+
+This path responds to the following HTTP methods.
+    LIST /
+        Returns the names of the namespaces within the namespace.
+
+    GET /<name>
+        Retrieve the ID and path of the named namespace.
+
+    PUT /<name>
+        Create the named namespace.
+
+    DELETE /<name>
+        Delete the named namespace, along with its mounts, tokens, leases and
+        policies. Namespaces with child namespaces cannot be deleted.
+		`,
+	},
+	"mfa-validate": {
+		`Completes a login subject to MFA enforcements`,
+		`
+Logins subject to login enforcements return an MFA requirement instead of a
+token. This unauthenticated path completes them: it takes the ID of the MFA
+request, and a payload mapping the IDs of the MFA methods used to their
+passcodes. Methods using push notifications are given an empty list, and the
+request waits for the user to approve the notification. Each enforcement must
+be satisfied by one of its methods. The token of the login is returned.
+		`,
+	},
+	"mfa-method": {
+		`Configures the MFA methods logins can be subject to`,
+		`
+MFA methods are of the totp, duo, okta and pingid types. Writing to
+sys/mfa/method/<type> creates a method and returns its ID. The secret keys and
+tokens of the methods are not returned when reading them.
+
+The users of Duo, Okta and PingID are named after the "username_format"
+identity template, which defaults to "{{identity.entity.metadata.username}}".
+Each entity has its own TOTP secret, generated with
+sys/mfa/method/totp/generate.
+
+This path responds to the following HTTP methods.
+    LIST /
+        Returns a list of the IDs of the methods.
+
+    LIST /<type>
+        Returns a list of the IDs of the methods of a type.
+
+    PUT /<type>
+        Create a method.
+
+    GET /<type>/<method_id>
+        Retrieve a method.
+
+    PUT /<type>/<method_id>
+        Update a method.
+
+    DELETE /<type>/<method_id>
+        Delete a method which is not used by login enforcements.
+		`,
+	},
+	"mfa-totp-generate": {
+		`Generates the TOTP secret of the requesting entity`,
+		`
+Generates the secret of the entity of the client token for a TOTP method, and
+returns its otpauth URL and a PNG QR code of it encoded in base64. Entities
+which already have a secret must have it destroyed by an administrator to
+generate a new one.
+		`,
+	},
+	"mfa-totp-admin": {
+		`Generates or destroys the TOTP secret of an entity`,
+		`
+Generates the secret of an entity for a TOTP method, replacing its existing
+secret, or destroys it. Entities are named after the display names of their
+tokens, such as "userpass-armon".
+		`,
+	},
+	"mfa-login-enforcement": {
+		`Configures the logins which must be completed with MFA`,
+		`
+Login enforcements bind MFA methods to auth backends, by mount path or type,
+to entities and to external groups. Logins matching any binding of an
+enforcement must be completed with any of its methods through
+sys/mfa/validate.
+
+This path responds to the following HTTP methods.
+    LIST /
+        Returns a list of names of login enforcements.
+
+    GET /<name>
+        Retrieve the named login enforcement.
+
+    PUT /<name>
+        Add or update a login enforcement.
+
+    DELETE /<name>
+        Delete the named login enforcement.
+		`,
+	},
+	"password-policies-generate": {
+		`Generates a password from a password policy`,
+		`
+This path generates a password from the named password policy, to check the
+passwords it produces.
+		`,
+	},
+	"entities": {
+		`Configures the entities, the users of auth backends`,
+		`
+Entities are users, who may log in through several auth backends under one of
+their aliases. Aliases are written in the "<mount path>:<name>" format, where
+name is the display name the backend returns on login, for example
+"userpass:alice", or "token:<entity alias>" for token roles.
+
+The metadata of an entity, and then of its alias, override the metadata the
+auth backend returns on login. It is available to backends templating from the
+identity of the requester, such as PKI roles; since it is set by operators,
+tokens cannot change it. Entities are resolved when users log in, so changes
+apply to new tokens.
+
+This path responds to the following HTTP methods.
+    LIST /
+        Returns a list of names of entities.
+
+    GET /name/<name>
+        Retrieve the named entity.
+
+    PUT /name/<name>
+        Add or update an entity.
+
+    DELETE /name/<name>
+        Delete the named entity and its aliases.
+		`,
+	},
+
+	"entities-batch": {
+		`Creates several entities at once`,
+		`
+Creates the given entities, along with their aliases. No entity is created if
+one of them already exists, or has an alias of another entity.
+		`,
+	},
+
+	"entities-merge": {
+		`Merges entities into another one`,
+		`
+Merges entities into another one, which gets their aliases, then deletes them.
+The metadata of the entities merged is kept, unless the entity they are merged
+into has metadata with the same key.
+		`,
+	},
+
+	"entity-aliases": {
+		`Configures the aliases of entities`,
+		`
+Adds an alias to an entity, or updates the metadata of an alias. The metadata
+of an alias overrides the metadata the auth backend returns on login, and is
+overridden by the metadata of its entity.
+
+This path responds to the following HTTP methods.
+    GET /<alias>
+        Retrieve the entity and the metadata of an alias.
+
+    PUT /<alias>
+        Add or update an alias.
+
+    DELETE /<alias>
+        Delete an alias.
+		`,
+	},
 	"leases": {
 		`View or list lease metadata.`,
 		`
@@ -2786,4 +7472,134 @@ This path responds to the following HTTP methods.
 		`The path to list leases under. Example: "aws/creds/deploy"`,
 		"",
 	},
+
+	"leases-count": {
+		`Count the irrevocable leases.`,
+		`
+This path returns the number of the leases of the namespace which could not be
+revoked after the maximum number of attempts, in total and by mount. These
+leases are no longer revoked automatically, and can be removed with the
+'revoke-force-lease' endpoint once the underlying issue is addressed.
+		`,
+	},
+
+	"leases-count-type": {
+		`The type of the leases to count. Only "irrevocable" is supported.`,
+		"",
+	},
+
+	"leases-irrevocable": {
+		`List the irrevocable leases.`,
+		`
+This path lists the leases of the namespace which could not be revoked after
+the maximum number of attempts, along with the error of their last revocation
+attempt. These leases are no longer revoked automatically, and can be removed
+with the 'revoke-force-lease' endpoint once the underlying issue is addressed.
+		`,
+	},
+
+	"leases-irrevocable-limit": {
+		`The maximum number of leases to list, or 0 to list all of them. Defaults to 10000.`,
+		"",
+	},
+
+	"replication-status": {
+		`Returns the replication status of the cluster.`,
+		`
+This path returns the replication mode of the cluster, and the status of its
+performance and DR replication, such as the index of the last WAL of a primary
+or the progress of a secondary.
+		`,
+	},
+
+	"replication-reindex": {
+		`Reindexes the replicated data.`,
+		`
+This path rebuilds the merkle index of the replicated data from the storage.
+The secondaries compare it with the index of their primary to reconcile their
+data.
+		`,
+	},
+
+	"replication-performance-primary": {
+		`Manages the performance replication of a primary.`,
+		`
+This path enables the performance replication as a primary, disables it, or
+demotes the primary to a secondary, which can be promoted again or pointed to
+the new primary.
+		`,
+	},
+
+	"replication-performance-secondary-token": {
+		`Manages the secondaries known by a performance primary.`,
+		`
+This path generates the activation token of a secondary, or revokes the
+credentials of a secondary, which can't connect to the primary anymore.
+		`,
+	},
+
+	"replication-performance-paths-filter": {
+		`Manages the paths filter of a performance secondary.`,
+		`
+This path sets the mounts and namespaces whose data is shipped to a
+performance secondary. In allow mode, only the given paths are shipped; in
+deny mode, all the paths but the given ones are. The filtered mounts are not
+available on the secondary.
+		`,
+	},
+
+	"replication-performance-secondary": {
+		`Manages the performance replication of a secondary.`,
+		`
+This path enables the performance replication as a secondary with the
+activation token generated by the primary, promotes the secondary to a
+primary, or points it to another primary of its replication set. The
+replicated data of a secondary is replaced by the data of its primary, while
+its tokens, leases and local mounts are kept.
+		`,
+	},
+
+	"replication-performance-internal": {
+		`Serves the replicated data to the performance secondaries.`,
+		`
+This path is used by the performance secondaries to stream the WALs of their
+primary, to reconcile their data with its merkle index, and to forward the
+requests writing replicated data.
+		`,
+	},
+
+	"replication-dr-primary": {
+		`Manages the DR replication of a primary.`,
+		`
+This path enables the DR replication as a primary, disables it, or demotes the
+primary to a secondary, which only serves the replication requests until it is
+promoted again or pointed to the new primary.
+		`,
+	},
+
+	"replication-dr-secondary-token": {
+		`Manages the secondaries known by a DR primary.`,
+		`
+This path generates the activation token of a secondary, or revokes the
+credentials of a secondary, which can't connect to the primary anymore.
+		`,
+	},
+
+	"replication-dr-secondary": {
+		`Manages the DR replication of a secondary.`,
+		`
+This path enables the DR replication as a secondary with the activation token
+generated by the primary, promotes the secondary to a primary, or points it to
+another primary of its replication set. The data of a secondary is replaced by
+the data of its primary.
+		`,
+	},
+
+	"replication-dr-internal": {
+		`Serves the replicated data to the DR secondaries.`,
+		`
+This path is used by the DR secondaries to stream the WALs of their primary,
+and to reconcile their data with its merkle index.
+		`,
+	},
 }
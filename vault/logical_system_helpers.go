@@ -2,8 +2,11 @@ package vault
 
 import (
 	"fmt"
-	"strings"
+	"strconv"
 	"time"
+
+	"github.com/hashicorp/vault/helper/parseutil"
+	"github.com/mitchellh/mapstructure"
 )
 
 // tuneMount is used to set config on a mount point
@@ -66,7 +69,7 @@ func (b *SystemBackend) tuneMountTTLs(path string, me *MountEntry, newDefault, n
 	// Update the mount table
 	var err error
 	switch {
-	case strings.HasPrefix(path, "auth/"):
+	case me.Table == credentialTableType:
 		err = b.Core.persistAuth(b.Core.auth, me.Local)
 	default:
 		err = b.Core.persistMounts(b.Core.mounts, me.Local)
@@ -83,3 +86,154 @@ func (b *SystemBackend) tuneMountTTLs(path string, me *MountEntry, newDefault, n
 
 	return nil
 }
+
+// tuneMountWrappingTTLs sets the wrapping TTL policy of a mount
+func (b *SystemBackend) tuneMountWrappingTTLs(path string, me *MountEntry, newDefault, newMax *time.Duration) error {
+	meConfig := &me.Config
+
+	defaultTTL := meConfig.DefaultWrappingTTL
+	maxTTL := meConfig.MaxWrappingTTL
+	if newDefault != nil {
+		defaultTTL = *newDefault
+	}
+	if newMax != nil {
+		maxTTL = *newMax
+	}
+	if defaultTTL == meConfig.DefaultWrappingTTL && maxTTL == meConfig.MaxWrappingTTL {
+		return nil
+	}
+
+	if maxTTL != 0 && defaultTTL > maxTTL {
+		return fmt.Errorf("backend default wrapping TTL of %d greater than backend max wrapping TTL of %d",
+			int(defaultTTL.Seconds()), int(maxTTL.Seconds()))
+	}
+
+	origMax := meConfig.MaxWrappingTTL
+	origDefault := meConfig.DefaultWrappingTTL
+
+	meConfig.MaxWrappingTTL = maxTTL
+	meConfig.DefaultWrappingTTL = defaultTTL
+
+	// Update the mount table
+	var err error
+	switch {
+	case me.Table == credentialTableType:
+		err = b.Core.persistAuth(b.Core.auth, me.Local)
+	default:
+		err = b.Core.persistMounts(b.Core.mounts, me.Local)
+	}
+	if err != nil {
+		meConfig.MaxWrappingTTL = origMax
+		meConfig.DefaultWrappingTTL = origDefault
+		return fmt.Errorf("failed to update mount table, rolling back wrapping TTL changes")
+	}
+
+	if b.Core.logger.IsInfo() {
+		b.Core.logger.Info("core: mount tuning successful", "path", path)
+	}
+
+	return nil
+}
+
+// tuneMountTokenType sets the type of the tokens issued by an auth mount
+func (b *SystemBackend) tuneMountTokenType(path string, me *MountEntry, tokenType string) error {
+	if tokenType == me.Config.TokenType {
+		return nil
+	}
+
+	origTokenType := me.Config.TokenType
+	me.Config.TokenType = tokenType
+
+	// Update the mount table
+	if err := b.Core.persistAuth(b.Core.auth, me.Local); err != nil {
+		me.Config.TokenType = origTokenType
+		return fmt.Errorf("failed to update mount table, rolling back token type changes")
+	}
+
+	if b.Core.logger.IsInfo() {
+		b.Core.logger.Info("core: mount tuning successful", "path", path)
+	}
+
+	return nil
+}
+
+// tuneMountUserLockout sets the user lockout configuration of an auth mount
+func (b *SystemBackend) tuneMountUserLockout(path string, me *MountEntry, config UserLockoutConfig) error {
+	if config == me.Config.UserLockoutConfig {
+		return nil
+	}
+
+	origConfig := me.Config.UserLockoutConfig
+	me.Config.UserLockoutConfig = config
+
+	// Update the mount table
+	if err := b.Core.persistAuth(b.Core.auth, me.Local); err != nil {
+		me.Config.UserLockoutConfig = origConfig
+		return fmt.Errorf("failed to update mount table, rolling back user lockout changes")
+	}
+
+	if b.Core.logger.IsInfo() {
+		b.Core.logger.Info("core: mount tuning successful", "path", path)
+	}
+
+	return nil
+}
+
+// parseUserLockoutConfig updates a user lockout configuration with the
+// parameters which are set
+func parseUserLockoutConfig(config UserLockoutConfig, raw map[string]interface{}) (UserLockoutConfig, error) {
+	var input struct {
+		LockoutThreshold            string `mapstructure:"lockout_threshold"`
+		LockoutDuration             string `mapstructure:"lockout_duration"`
+		LockoutCounterResetDuration string `mapstructure:"lockout_counter_reset_duration"`
+	}
+	if err := mapstructure.WeakDecode(raw, &input); err != nil {
+		return config, err
+	}
+
+	if input.LockoutThreshold != "" {
+		threshold, err := strconv.Atoi(input.LockoutThreshold)
+		if err != nil {
+			return config, fmt.Errorf("invalid lockout_threshold: %v", err)
+		}
+		if threshold < 0 {
+			return config, fmt.Errorf("lockout_threshold cannot be negative")
+		}
+		config.LockoutThreshold = threshold
+	}
+	if input.LockoutDuration != "" {
+		duration, err := parseutil.ParseDurationSecond(input.LockoutDuration)
+		if err != nil {
+			return config, fmt.Errorf("invalid lockout_duration: %v", err)
+		}
+		if duration < 0 {
+			return config, fmt.Errorf("lockout_duration cannot be negative")
+		}
+		config.LockoutDuration = duration
+	}
+	if input.LockoutCounterResetDuration != "" {
+		duration, err := parseutil.ParseDurationSecond(input.LockoutCounterResetDuration)
+		if err != nil {
+			return config, fmt.Errorf("invalid lockout_counter_reset_duration: %v", err)
+		}
+		if duration < 0 {
+			return config, fmt.Errorf("lockout_counter_reset_duration cannot be negative")
+		}
+		config.LockoutCounterResetDuration = duration
+	}
+
+	return config, nil
+}
+
+// parseWrappingTTL parses the wrapping TTL of a mount, where zero disables
+// the policy
+func parseWrappingTTL(raw string) (time.Duration, error) {
+	ttl, err := parseutil.ParseDurationSecond(raw)
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, fmt.Errorf("wrapping TTL cannot be negative")
+	}
+	return ttl, nil
+}
@@ -30,14 +30,28 @@ func TestSystemBackend_RootPaths(t *testing.T) {
 		"raw/*",
 		"replication/primary/secondary-token",
 		"replication/reindex",
+		"replication/performance/primary/*",
+		"replication/performance/secondary/*",
+		"replication/dr/primary/*",
+		"replication/dr/secondary/*",
 		"rotate",
 		"config/cors",
+		"config/est",
 		"config/auditing/*",
 		"plugins/catalog/*",
+		"managed-keys/*",
+		"groups/external/*",
+		"entities/*",
+		"entity-aliases/*",
+		"locked-users/*",
+		"sync/*",
 		"revoke-prefix/*",
 		"leases/revoke-prefix/*",
 		"leases/revoke-force/*",
+		"leases/revoke-force-lease",
+		"leases/revoke-force-lease/*",
 		"leases/lookup/*",
+		"storage/raft/*",
 	}
 
 	b := testSystemBackend(t)
@@ -116,9 +130,11 @@ func TestSystemBackend_mounts(t *testing.T) {
 			"type":        "generic",
 			"description": "generic secret storage",
 			"config": map[string]interface{}{
-				"default_lease_ttl": resp.Data["secret/"].(map[string]interface{})["config"].(map[string]interface{})["default_lease_ttl"].(int64),
-				"max_lease_ttl":     resp.Data["secret/"].(map[string]interface{})["config"].(map[string]interface{})["max_lease_ttl"].(int64),
-				"force_no_cache":    false,
+				"default_lease_ttl":    resp.Data["secret/"].(map[string]interface{})["config"].(map[string]interface{})["default_lease_ttl"].(int64),
+				"max_lease_ttl":        resp.Data["secret/"].(map[string]interface{})["config"].(map[string]interface{})["max_lease_ttl"].(int64),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": int64(0),
+				"max_wrapping_ttl":     int64(0),
 			},
 			"local": false,
 		},
@@ -126,9 +142,11 @@ func TestSystemBackend_mounts(t *testing.T) {
 			"type":        "system",
 			"description": "system endpoints used for control, policy and debugging",
 			"config": map[string]interface{}{
-				"default_lease_ttl": resp.Data["sys/"].(map[string]interface{})["config"].(map[string]interface{})["default_lease_ttl"].(int64),
-				"max_lease_ttl":     resp.Data["sys/"].(map[string]interface{})["config"].(map[string]interface{})["max_lease_ttl"].(int64),
-				"force_no_cache":    false,
+				"default_lease_ttl":    resp.Data["sys/"].(map[string]interface{})["config"].(map[string]interface{})["default_lease_ttl"].(int64),
+				"max_lease_ttl":        resp.Data["sys/"].(map[string]interface{})["config"].(map[string]interface{})["max_lease_ttl"].(int64),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": int64(0),
+				"max_wrapping_ttl":     int64(0),
 			},
 			"local": false,
 		},
@@ -136,9 +154,11 @@ func TestSystemBackend_mounts(t *testing.T) {
 			"description": "per-token private secret storage",
 			"type":        "cubbyhole",
 			"config": map[string]interface{}{
-				"default_lease_ttl": resp.Data["cubbyhole/"].(map[string]interface{})["config"].(map[string]interface{})["default_lease_ttl"].(int64),
-				"max_lease_ttl":     resp.Data["cubbyhole/"].(map[string]interface{})["config"].(map[string]interface{})["max_lease_ttl"].(int64),
-				"force_no_cache":    false,
+				"default_lease_ttl":    resp.Data["cubbyhole/"].(map[string]interface{})["config"].(map[string]interface{})["default_lease_ttl"].(int64),
+				"max_lease_ttl":        resp.Data["cubbyhole/"].(map[string]interface{})["config"].(map[string]interface{})["max_lease_ttl"].(int64),
+				"force_no_cache":       false,
+				"default_wrapping_ttl": int64(0),
+				"max_wrapping_ttl":     int64(0),
 			},
 			"local": true,
 		},
@@ -1101,6 +1121,87 @@ func TestSystemBackend_revokePrefixAuth_origUrl(t *testing.T) {
 	}
 }
 
+func TestSystemBackend_irrevocableLeases(t *testing.T) {
+	core, b, root := testCoreSystemBackend(t)
+
+	// Create a key with a lease
+	req := logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.Data["foo"] = "bar"
+	req.Data["lease"] = "1h"
+	req.ClientToken = root
+	resp, err := core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Read a key with a LeaseID, and mark the lease irrevocable
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+	req.ClientToken = root
+	resp, err = core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.Secret == nil || resp.Secret.LeaseID == "" {
+		t.Fatalf("bad: %#v", resp)
+	}
+	leaseID := resp.Secret.LeaseID
+	if err := core.expiration.markLeaseIrrevocable(leaseID, fmt.Errorf("revocation failed")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "leases/count")
+	req.Data["type"] = "irrevocable"
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["lease_count"] != 1 || !reflect.DeepEqual(resp.Data["counts"], map[string]int{"secret/": 1}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "leases/irrevocable")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	leases := resp.Data["leases"].([]map[string]interface{})
+	if len(leases) != 1 || leases[0]["lease_id"] != leaseID || leases[0]["mount"] != "secret/" || leases[0]["error"] != "revocation failed" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Only irrevocable leases can be counted
+	req = logical.TestRequest(t, logical.ReadOperation, "leases/count")
+	req.Data["type"] = "expiring"
+	if _, err := b.HandleRequest(req); err != logical.ErrInvalidRequest {
+		t.Fatalf("expected invalid request, got err: %v", err)
+	}
+
+	// Irrevocable leases cannot be renewed, but can be force revoked
+	req = logical.TestRequest(t, logical.UpdateOperation, "leases/renew/"+leaseID)
+	resp, err = b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest || resp.Data["error"] != "lease is irrevocable" {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+	req = logical.TestRequest(t, logical.UpdateOperation, "leases/revoke-force-lease")
+	req.Data["lease_id"] = leaseID
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "leases/count")
+	req.Data["type"] = "irrevocable"
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["lease_count"] != 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if le, err := core.expiration.loadEntry(leaseID); err != nil || le != nil {
+		t.Fatalf("expected the lease to be removed, err: %v le: %#v", err, le)
+	}
+}
+
 func TestSystemBackend_authTable(t *testing.T) {
 	b := testSystemBackend(t)
 	req := logical.TestRequest(t, logical.ReadOperation, "auth")
@@ -1114,8 +1215,10 @@ func TestSystemBackend_authTable(t *testing.T) {
 			"type":        "token",
 			"description": "token based credentials",
 			"config": map[string]interface{}{
-				"default_lease_ttl": int64(0),
-				"max_lease_ttl":     int64(0),
+				"default_lease_ttl":    int64(0),
+				"max_lease_ttl":        int64(0),
+				"default_wrapping_ttl": int64(0),
+				"max_wrapping_ttl":     int64(0),
 			},
 			"local": false,
 		},
@@ -1697,3 +1800,126 @@ func TestSystemBackend_PluginCatalog_CRUD(t *testing.T) {
 		t.Fatalf("expected nil response, plugin not deleted correctly got resp: %v, err: %v", resp, err)
 	}
 }
+
+func TestSystemBackend_ManagedKeys_CRUD(t *testing.T) {
+	_, b, _ := testCoreSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "managed-keys/kms-key")
+	req.Data["type"] = "awskms"
+	req.Data["parameters"] = map[string]interface{}{
+		"region": "us-west-2",
+	}
+	resp, err := b.HandleRequest(req)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response without key_id, got err: %v resp: %#v", err, resp)
+	}
+
+	req.Data["parameters"] = map[string]interface{}{
+		"region":     "us-west-2",
+		"key_id":     "alias/vault",
+		"access_key": "AKIAEXAMPLE",
+		"secret_key": "secret",
+	}
+	req.Data["allowed_mounts"] = "transit,pki/"
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "managed-keys/kms-key")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := map[string]interface{}{
+		"type": "awskms",
+		"parameters": map[string]string{
+			"region":     "us-west-2",
+			"key_id":     "alias/vault",
+			"access_key": "AKIAEXAMPLE",
+		},
+		"allowed_mounts": []string{"transit/", "pki/"},
+	}
+	if !reflect.DeepEqual(resp.Data, expected) {
+		t.Fatalf("bad: got %#v\n expected %#v", resp.Data, expected)
+	}
+
+	req = logical.TestRequest(t, logical.ListOperation, "managed-keys/")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"kms-key"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "managed-keys/kms-key")
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "managed-keys/kms-key")
+	resp, err = b.HandleRequest(req)
+	if err != nil || resp != nil {
+		t.Fatalf("expected no key, got err: %v resp: %#v", err, resp)
+	}
+}
+
+func TestSystemBackend_PasswordPolicies_CRUD(t *testing.T) {
+	_, b, _ := testCoreSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "policies/password/digits")
+	req.Data["policy"] = `length = 0`
+	resp, err := b.HandleRequest(req)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response for an invalid policy, got err: %v resp: %#v", err, resp)
+	}
+
+	policy := `
+length = 12
+rule "charset" {
+  charset = "0123456789"
+}`
+	req.Data["policy"] = policy
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "policies/password/digits")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["policy"] != policy {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "policies/password/digits/generate")
+	resp, err = b.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+	password := resp.Data["password"].(string)
+	if len(password) != 12 || strings.Trim(password, "0123456789") != "" {
+		t.Fatalf("bad password: %q", password)
+	}
+
+	req = logical.TestRequest(t, logical.ListOperation, "policies/password/")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"digits"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "policies/password/digits")
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "policies/password/digits/generate")
+	resp, err = b.HandleRequest(req)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response, got err: %v resp: %#v", err, resp)
+	}
+}
@@ -0,0 +1,559 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	loginMFAPath = "core/login-mfa/"
+
+	// loginMFAValidatePath is the path logins subject to MFA enforcements
+	// are completed at
+	loginMFAValidatePath = "sys/mfa/validate"
+
+	// loginMFARequestTTL is how long a login has to complete its MFA
+	// requirement
+	loginMFARequestTTL = 5 * time.Minute
+
+	// loginMFAMaxAttempts is the number of failed validations after which
+	// a pending login is discarded
+	loginMFAMaxAttempts = 5
+)
+
+const (
+	mfaMethodTypeTOTP   = "totp"
+	mfaMethodTypeDuo    = "duo"
+	mfaMethodTypeOkta   = "okta"
+	mfaMethodTypePingID = "pingid"
+)
+
+// MFAMethodEntry is the configuration of a login MFA method. Only the
+// configuration of its type is set.
+type MFAMethodEntry struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+
+	TOTP   *TOTPMFAConfig   `json:"totp,omitempty"`
+	Duo    *DuoMFAConfig    `json:"duo,omitempty"`
+	Okta   *OktaMFAConfig   `json:"okta,omitempty"`
+	PingID *PingIDMFAConfig `json:"pingid,omitempty"`
+}
+
+// UsesPasscode returns whether the method is completed with a passcode,
+// rather than with a push notification approved by the user
+func (m *MFAMethodEntry) UsesPasscode() bool {
+	switch m.Type {
+	case mfaMethodTypeTOTP:
+		return true
+	case mfaMethodTypeDuo:
+		return m.Duo.UsePasscode
+	default:
+		return false
+	}
+}
+
+// MFAEnforcementEntry binds MFA methods to the logins they are required for.
+// A login is subject to the enforcement if it matches any of its bindings,
+// and must then be completed with any of its methods.
+type MFAEnforcementEntry struct {
+	Name         string   `json:"name"`
+	MFAMethodIDs []string `json:"mfa_method_ids"`
+
+	// AuthMethodPaths are the mount paths of auth backends, relative to
+	// "auth/" and with a trailing slash
+	AuthMethodPaths []string `json:"auth_method_paths"`
+
+	// AuthMethodTypes are the types of auth backends
+	AuthMethodTypes []string `json:"auth_method_types"`
+
+	// IdentityEntityNames are the names of the entities, which are the
+	// display names of their tokens, such as "userpass-armon"
+	IdentityEntityNames []string `json:"identity_entity_names"`
+
+	// IdentityGroupNames are the names of external groups
+	IdentityGroupNames []string `json:"identity_group_names"`
+}
+
+// pendingMFALogin is a login waiting for its MFA requirement to be satisfied
+type pendingMFALogin struct {
+	// path is the path of the login request
+	path string
+
+	// response is the response of the auth backend, which is used to
+	// complete the login
+	response *logical.Response
+
+	// entity is the identity of the user logging in
+	entity *logical.Entity
+
+	// remoteAddr is the address of the client logging in
+	remoteAddr string
+
+	// constraints are the method IDs of the enforcements applying
+	constraints map[string][]string
+
+	attempts  int
+	expiresAt time.Time
+}
+
+// LoginMFAStore keeps the login MFA methods and enforcements, the TOTP
+// secrets of the entities, and the logins waiting for MFA
+type LoginMFAStore struct {
+	view *BarrierView
+
+	l       sync.Mutex
+	pending map[string]*pendingMFALogin
+
+	// usedPasscodes prevents TOTP passcodes from being used twice while
+	// they are valid
+	usedPasscodes map[string]time.Time
+}
+
+func (c *Core) setupLoginMFAStore() error {
+	c.loginMFAStore = &LoginMFAStore{
+		view:          NewBarrierView(c.barrier, loginMFAPath),
+		pending:       make(map[string]*pendingMFALogin),
+		usedPasscodes: make(map[string]time.Time),
+	}
+
+	return nil
+}
+
+func (s *LoginMFAStore) get(key string, out interface{}) (bool, error) {
+	entry, err := s.view.Get(key)
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		return false, nil
+	}
+	if err := jsonutil.DecodeJSON(entry.Value, out); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *LoginMFAStore) put(key string, in interface{}) error {
+	buf, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return s.view.Put(&logical.StorageEntry{
+		Key:   key,
+		Value: buf,
+	})
+}
+
+// Method retrieves a method, or nil if it does not exist
+func (s *LoginMFAStore) Method(id string) (*MFAMethodEntry, error) {
+	method := new(MFAMethodEntry)
+	ok, err := s.get("method/"+id, method)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve MFA method %q: %v", id, err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return method, nil
+}
+
+// SetMethod stores a method
+func (s *LoginMFAStore) SetMethod(method *MFAMethodEntry) error {
+	if err := s.put("method/"+method.ID, method); err != nil {
+		return fmt.Errorf("failed to persist MFA method: %v", err)
+	}
+	return nil
+}
+
+// DeleteMethod removes a method and the TOTP secrets generated for it. It
+// fails if an enforcement uses the method.
+func (s *LoginMFAStore) DeleteMethod(id string) error {
+	names, err := s.ListEnforcements()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		enforcement, err := s.Enforcement(name)
+		if err != nil {
+			return err
+		}
+		if enforcement != nil && strutil.StrListContains(enforcement.MFAMethodIDs, id) {
+			return fmt.Errorf("MFA method is used by login enforcement %q", name)
+		}
+	}
+
+	if err := logical.ClearView(s.view.SubView("totp/" + id + "/")); err != nil {
+		return err
+	}
+	return s.view.Delete("method/" + id)
+}
+
+// ListMethods returns the IDs of the methods of the given type, or of all
+// methods if it is empty
+func (s *LoginMFAStore) ListMethods(methodType string) ([]string, error) {
+	ids, err := s.view.List("method/")
+	if err != nil {
+		return nil, err
+	}
+	if methodType == "" {
+		return ids, nil
+	}
+
+	var ret []string
+	for _, id := range ids {
+		method, err := s.Method(id)
+		if err != nil {
+			return nil, err
+		}
+		if method != nil && method.Type == methodType {
+			ret = append(ret, id)
+		}
+	}
+	return ret, nil
+}
+
+// Enforcement retrieves an enforcement, or nil if it does not exist
+func (s *LoginMFAStore) Enforcement(name string) (*MFAEnforcementEntry, error) {
+	enforcement := new(MFAEnforcementEntry)
+	ok, err := s.get("enforcement/"+name, enforcement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve login enforcement %q: %v", name, err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	return enforcement, nil
+}
+
+// SetEnforcement stores an enforcement
+func (s *LoginMFAStore) SetEnforcement(enforcement *MFAEnforcementEntry) error {
+	if strings.Contains(enforcement.Name, "..") {
+		return fmt.Errorf("login enforcement names cannot contain \"..\"")
+	}
+	if err := s.put("enforcement/"+enforcement.Name, enforcement); err != nil {
+		return fmt.Errorf("failed to persist login enforcement: %v", err)
+	}
+	return nil
+}
+
+// DeleteEnforcement removes an enforcement
+func (s *LoginMFAStore) DeleteEnforcement(name string) error {
+	return s.view.Delete("enforcement/" + name)
+}
+
+// ListEnforcements returns the names of the enforcements
+func (s *LoginMFAStore) ListEnforcements() ([]string, error) {
+	return logical.CollectKeys(s.view.SubView("enforcement/"))
+}
+
+// TOTPSecret returns the TOTP secret of an entity for a method, or an empty
+// string if none was generated
+func (s *LoginMFAStore) TOTPSecret(methodID, entityName string) (string, error) {
+	entry, err := s.view.Get("totp/" + methodID + "/" + entityName)
+	if err != nil {
+		return "", err
+	}
+	if entry == nil {
+		return "", nil
+	}
+	return string(entry.Value), nil
+}
+
+// SetTOTPSecret stores the TOTP secret of an entity for a method
+func (s *LoginMFAStore) SetTOTPSecret(methodID, entityName, secret string) error {
+	if strings.Contains(entityName, "..") {
+		return fmt.Errorf("entity names cannot contain \"..\"")
+	}
+	return s.view.Put(&logical.StorageEntry{
+		Key:   "totp/" + methodID + "/" + entityName,
+		Value: []byte(secret),
+	})
+}
+
+// DeleteTOTPSecret removes the TOTP secret of an entity for a method
+func (s *LoginMFAStore) DeleteTOTPSecret(methodID, entityName string) error {
+	return s.view.Delete("totp/" + methodID + "/" + entityName)
+}
+
+// requirement returns the MFA requirement of a login through the auth
+// backend mounted at mountPath, or nil if no enforcement applies
+func (s *LoginMFAStore) requirement(mountPath, mountType, entityName string, groups []string) (map[string][]string, *logical.MFARequirement, error) {
+	names, err := s.ListEnforcements()
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(names)
+
+	constraints := make(map[string][]string)
+	requirement := &logical.MFARequirement{
+		MFAConstraints: make(map[string]*logical.MFAConstraintAny),
+	}
+	for _, name := range names {
+		enforcement, err := s.Enforcement(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if enforcement == nil || !enforcement.applies(mountPath, mountType, entityName, groups) {
+			continue
+		}
+
+		constraint := &logical.MFAConstraintAny{}
+		for _, id := range enforcement.MFAMethodIDs {
+			method, err := s.Method(id)
+			if err != nil {
+				return nil, nil, err
+			}
+			if method == nil {
+				continue
+			}
+			constraint.Any = append(constraint.Any, &logical.MFAMethodID{
+				Type:         method.Type,
+				ID:           method.ID,
+				UsesPasscode: method.UsesPasscode(),
+			})
+			constraints[name] = append(constraints[name], method.ID)
+		}
+		if len(constraint.Any) == 0 {
+			return nil, nil, fmt.Errorf("login enforcement %q has no MFA methods", name)
+		}
+		requirement.MFAConstraints[name] = constraint
+	}
+
+	if len(constraints) == 0 {
+		return nil, nil, nil
+	}
+	return constraints, requirement, nil
+}
+
+func (e *MFAEnforcementEntry) applies(mountPath, mountType, entityName string, groups []string) bool {
+	if strutil.StrListContains(e.AuthMethodPaths, mountPath) ||
+		strutil.StrListContains(e.AuthMethodTypes, mountType) ||
+		strutil.StrListContains(e.IdentityEntityNames, entityName) {
+		return true
+	}
+	for _, group := range groups {
+		if strutil.StrListContains(e.IdentityGroupNames, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// addPending keeps a login until its MFA requirement is satisfied, and
+// returns the ID of the request
+func (s *LoginMFAStore) addPending(login *pendingMFALogin) (string, error) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	now := time.Now()
+	for k, v := range s.pending {
+		if now.After(v.expiresAt) {
+			delete(s.pending, k)
+		}
+	}
+	for k, expiresAt := range s.usedPasscodes {
+		if now.After(expiresAt) {
+			delete(s.usedPasscodes, k)
+		}
+	}
+
+	login.expiresAt = now.Add(loginMFARequestTTL)
+	s.pending[id] = login
+	return id, nil
+}
+
+// getPending returns a pending login which has not expired
+func (s *LoginMFAStore) getPending(id string) *pendingMFALogin {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	login, ok := s.pending[id]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(login.expiresAt) {
+		delete(s.pending, id)
+		return nil
+	}
+	return login
+}
+
+// failPending counts a failed validation of a pending login, discarding it
+// after too many of them
+func (s *LoginMFAStore) failPending(id string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if login, ok := s.pending[id]; ok {
+		login.attempts++
+		if login.attempts >= loginMFAMaxAttempts {
+			delete(s.pending, id)
+		}
+	}
+}
+
+// removePending removes a pending login, returning false if it was already
+// removed by a concurrent validation
+func (s *LoginMFAStore) removePending(id string) bool {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if _, ok := s.pending[id]; !ok {
+		return false
+	}
+	delete(s.pending, id)
+	return true
+}
+
+// usePasscode records the use of a TOTP passcode, returning false if it was
+// already used
+func (s *LoginMFAStore) usePasscode(methodID, entityName, passcode string, validity time.Duration) bool {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	key := methodID + "/" + entityName + "/" + passcode
+	if expiresAt, ok := s.usedPasscodes[key]; ok && time.Now().Before(expiresAt) {
+		return false
+	}
+	s.usedPasscodes[key] = time.Now().Add(validity)
+	return true
+}
+
+// loginMFARequirement returns the MFA requirement of a login, keeping the
+// login until it is satisfied. It returns nil if no enforcement applies.
+func (c *Core) loginMFARequirement(req *logical.Request, path string, resp *logical.Response, entity *logical.Entity, groups []string) (*logical.MFARequirement, error) {
+	mountType := ""
+	if me := c.router.MatchingMountEntry(path); me != nil {
+		mountType = me.Type
+	}
+	mountPath := strings.TrimPrefix(c.router.MatchingMount(path), credentialRoutePrefix)
+
+	constraints, requirement, err := c.loginMFAStore.requirement(mountPath, mountType, entity.Name, groups)
+	if err != nil || requirement == nil {
+		return nil, err
+	}
+
+	login := &pendingMFALogin{
+		path:        path,
+		response:    resp,
+		entity:      entity,
+		constraints: constraints,
+	}
+	if req.Connection != nil {
+		login.remoteAddr = req.Connection.RemoteAddr
+	}
+	requirement.MFARequestID, err = c.loginMFAStore.addPending(login)
+	if err != nil {
+		return nil, err
+	}
+
+	return requirement, nil
+}
+
+// validateLoginMFA validates the MFA payload of a request to
+// sys/mfa/validate, and returns the pending login it completes
+func (c *Core) validateLoginMFA(req *logical.Request) (*pendingMFALogin, error) {
+	var data struct {
+		RequestID string              `mapstructure:"mfa_request_id"`
+		Payload   map[string][]string `mapstructure:"mfa_payload"`
+	}
+	if err := mapstructure.WeakDecode(req.Data, &data); err != nil {
+		return nil, fmt.Errorf("invalid MFA payload: %v", err)
+	}
+	if data.RequestID == "" {
+		return nil, fmt.Errorf("missing mfa_request_id")
+	}
+
+	login := c.loginMFAStore.getPending(data.RequestID)
+	if login == nil {
+		return nil, fmt.Errorf("MFA request %q not found or expired", data.RequestID)
+	}
+
+	validated := make(map[string]error)
+	names := make([]string, 0, len(login.constraints))
+	for name := range login.constraints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		satisfied := false
+		var lastErr error
+		for _, id := range login.constraints[name] {
+			passcodes, ok := data.Payload[id]
+			if !ok {
+				continue
+			}
+			err, done := validated[id]
+			if !done {
+				passcode := ""
+				if len(passcodes) > 0 {
+					passcode = passcodes[0]
+				}
+				err = c.validateMFAMethod(login, id, passcode)
+				validated[id] = err
+			}
+			if err == nil {
+				satisfied = true
+				break
+			}
+			lastErr = err
+		}
+		if !satisfied {
+			c.loginMFAStore.failPending(data.RequestID)
+			if lastErr != nil {
+				return nil, fmt.Errorf("login MFA validation failed for enforcement %q: %v", name, lastErr)
+			}
+			return nil, fmt.Errorf("login MFA enforcement %q is not satisfied by the payload", name)
+		}
+	}
+
+	if !c.loginMFAStore.removePending(data.RequestID) {
+		return nil, fmt.Errorf("MFA request %q not found or expired", data.RequestID)
+	}
+	return login, nil
+}
+
+// validateMFAMethod validates the passcode given for a method, or waits for
+// the user to approve the push notification it sends
+func (c *Core) validateMFAMethod(login *pendingMFALogin, methodID, passcode string) error {
+	method, err := c.loginMFAStore.Method(methodID)
+	if err != nil {
+		return err
+	}
+	if method == nil {
+		return fmt.Errorf("MFA method %q not found", methodID)
+	}
+
+	if method.UsesPasscode() && passcode == "" {
+		return fmt.Errorf("MFA method %q requires a passcode", methodID)
+	}
+
+	switch method.Type {
+	case mfaMethodTypeTOTP:
+		return c.validateTOTP(method, login.entity, passcode)
+	case mfaMethodTypeDuo:
+		return validateDuo(method.Duo, login.entity, login.remoteAddr, passcode)
+	case mfaMethodTypeOkta:
+		return validateOkta(method.Okta, login.entity, passcode)
+	case mfaMethodTypePingID:
+		return validatePingID(method.PingID, login.entity)
+	default:
+		return fmt.Errorf("unsupported MFA method type %q", method.Type)
+	}
+}
@@ -0,0 +1,527 @@
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/duosecurity/duo_api_golang"
+	"github.com/duosecurity/duo_api_golang/authapi"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/helper/identitytpl"
+	"github.com/hashicorp/vault/logical"
+	otplib "github.com/pquerna/otp"
+	totplib "github.com/pquerna/otp/totp"
+)
+
+const (
+	// mfaDefaultUsernameFormat is the template of the usernames of the
+	// users in external MFA providers
+	mfaDefaultUsernameFormat = "{{identity.entity.metadata.username}}"
+
+	// mfaPushTimeout is how long to wait for users to approve push
+	// notifications
+	mfaPushTimeout = time.Minute
+)
+
+// TOTPMFAConfig is the configuration of a TOTP login MFA method. Each entity
+// has its own secret, generated through sys/mfa/method/totp/generate.
+type TOTPMFAConfig struct {
+	Issuer    string `json:"issuer"`
+	Period    uint   `json:"period"`
+	KeySize   uint   `json:"key_size"`
+	QRSize    int    `json:"qr_size"`
+	Algorithm string `json:"algorithm"`
+	Digits    int    `json:"digits"`
+	Skew      uint   `json:"skew"`
+}
+
+// DuoMFAConfig is the configuration of a Duo login MFA method
+type DuoMFAConfig struct {
+	IntegrationKey string `json:"integration_key"`
+	SecretKey      string `json:"secret_key"`
+	APIHostname    string `json:"api_hostname"`
+	PushInfo       string `json:"push_info"`
+	UsePasscode    bool   `json:"use_passcode"`
+	UsernameFormat string `json:"username_format"`
+}
+
+// OktaMFAConfig is the configuration of an Okta login MFA method
+type OktaMFAConfig struct {
+	OrgName        string `json:"org_name"`
+	APIToken       string `json:"api_token"`
+	BaseURL        string `json:"base_url"`
+	PrimaryEmail   bool   `json:"primary_email"`
+	UsernameFormat string `json:"username_format"`
+}
+
+// PingIDMFAConfig is the configuration of a PingID login MFA method, taken
+// from the settings file downloaded from the PingID admin portal
+type PingIDMFAConfig struct {
+	UseBase64Key    string `json:"use_base64_key"`
+	UseSignature    bool   `json:"use_signature"`
+	Token           string `json:"token"`
+	IDPURL          string `json:"idp_url"`
+	OrgAlias        string `json:"org_alias"`
+	AdminURL        string `json:"admin_url"`
+	AuthenticatorID string `json:"authenticator_id"`
+	UsernameFormat  string `json:"username_format"`
+}
+
+// parsePingIDSettings parses a PingID settings file, which is in the Java
+// properties format
+func parsePingIDSettings(settings string) (*PingIDMFAConfig, error) {
+	config := &PingIDMFAConfig{}
+	scanner := bufio.NewScanner(strings.NewReader(settings))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		idx := strings.Index(line, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid line %q in PingID settings", line)
+		}
+		key, value := strings.TrimSpace(line[:idx]), strings.TrimSpace(line[idx+1:])
+		switch key {
+		case "use_base64_key":
+			config.UseBase64Key = value
+		case "use_signature":
+			config.UseSignature = value == "true"
+		case "token":
+			config.Token = value
+		case "idp_url":
+			config.IDPURL = value
+		case "org_alias":
+			config.OrgAlias = value
+		case "admin_url":
+			config.AdminURL = value
+		case "authenticator_id":
+			config.AuthenticatorID = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case config.UseBase64Key == "":
+		return nil, fmt.Errorf("PingID settings are missing use_base64_key")
+	case config.Token == "":
+		return nil, fmt.Errorf("PingID settings are missing token")
+	case config.IDPURL == "":
+		return nil, fmt.Errorf("PingID settings are missing idp_url")
+	case config.OrgAlias == "":
+		return nil, fmt.Errorf("PingID settings are missing org_alias")
+	}
+	return config, nil
+}
+
+// mfaUsername returns the username of an entity in an external MFA provider
+func mfaUsername(format string, entity *logical.Entity) (string, error) {
+	if format == "" {
+		format = mfaDefaultUsernameFormat
+	}
+	_, username, err := identitytpl.PopulateString(entity, format)
+	if err != nil {
+		return "", fmt.Errorf("failed to determine the MFA username: %v", err)
+	}
+	if username == "" {
+		return "", fmt.Errorf("MFA username is empty")
+	}
+	return username, nil
+}
+
+func (c *TOTPMFAConfig) otpOptions() (otplib.Algorithm, otplib.Digits, error) {
+	var algorithm otplib.Algorithm
+	switch c.Algorithm {
+	case "SHA1":
+		algorithm = otplib.AlgorithmSHA1
+	case "SHA256":
+		algorithm = otplib.AlgorithmSHA256
+	case "SHA512":
+		algorithm = otplib.AlgorithmSHA512
+	default:
+		return 0, 0, fmt.Errorf("unsupported algorithm %q", c.Algorithm)
+	}
+
+	var digits otplib.Digits
+	switch c.Digits {
+	case 6:
+		digits = otplib.DigitsSix
+	case 8:
+		digits = otplib.DigitsEight
+	default:
+		return 0, 0, fmt.Errorf("digits must be 6 or 8")
+	}
+
+	return algorithm, digits, nil
+}
+
+// generateTOTPSecret generates and stores the TOTP secret of an entity for
+// a method. It returns the otpauth URL of the secret, and a PNG QR code of
+// it encoded in base64 if the method has a QR code size.
+func (c *Core) generateTOTPSecret(method *MFAMethodEntry, entityName string) (string, string, error) {
+	config := method.TOTP
+	algorithm, digits, err := config.otpOptions()
+	if err != nil {
+		return "", "", err
+	}
+
+	key, err := totplib.Generate(totplib.GenerateOpts{
+		Issuer:      config.Issuer,
+		AccountName: entityName,
+		Period:      config.Period,
+		SecretSize:  config.KeySize,
+		Algorithm:   algorithm,
+		Digits:      digits,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	var encoded string
+	if config.QRSize > 0 {
+		code, err := qr.Encode(key.String(), qr.M, qr.Auto)
+		if err != nil {
+			return "", "", err
+		}
+		if code, err = barcode.Scale(code, config.QRSize, config.QRSize); err != nil {
+			return "", "", err
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, code); err != nil {
+			return "", "", err
+		}
+		encoded = base64.StdEncoding.EncodeToString(buf.Bytes())
+	}
+
+	if err := c.loginMFAStore.SetTOTPSecret(method.ID, entityName, key.Secret()); err != nil {
+		return "", "", err
+	}
+	return key.String(), encoded, nil
+}
+
+// validateTOTP validates a TOTP passcode against the secret of the entity.
+// Passcodes cannot be used twice.
+func (c *Core) validateTOTP(method *MFAMethodEntry, entity *logical.Entity, passcode string) error {
+	config := method.TOTP
+	secret, err := c.loginMFAStore.TOTPSecret(method.ID, entity.Name)
+	if err != nil {
+		return err
+	}
+	if secret == "" {
+		return fmt.Errorf("entity has no TOTP secret for the MFA method")
+	}
+
+	algorithm, digits, err := config.otpOptions()
+	if err != nil {
+		return err
+	}
+	valid, err := totplib.ValidateCustom(passcode, secret, time.Now(), totplib.ValidateOpts{
+		Period:    config.Period,
+		Skew:      config.Skew,
+		Digits:    digits,
+		Algorithm: algorithm,
+	})
+	if err != nil && err != otplib.ErrValidateInputInvalidLength {
+		return err
+	}
+	if !valid {
+		return fmt.Errorf("invalid TOTP passcode")
+	}
+
+	validity := time.Duration(config.Period*(2*config.Skew+1)) * time.Second
+	if !c.loginMFAStore.usePasscode(method.ID, entity.Name, passcode, validity) {
+		return fmt.Errorf("TOTP passcode has already been used")
+	}
+	return nil
+}
+
+// validateDuo authenticates the user with Duo, using the passcode if given
+// and a push notification otherwise
+func validateDuo(config *DuoMFAConfig, entity *logical.Entity, remoteAddr, passcode string) error {
+	username, err := mfaUsername(config.UsernameFormat, entity)
+	if err != nil {
+		return err
+	}
+
+	client := authapi.NewAuthApi(*duoapi.NewDuoApi(
+		config.IntegrationKey,
+		config.SecretKey,
+		config.APIHostname,
+		"vault",
+		duoapi.SetTimeout(mfaPushTimeout),
+	))
+
+	preauth, err := client.Preauth(
+		authapi.PreauthUsername(username),
+		authapi.PreauthIpAddr(remoteAddr),
+	)
+	if err != nil || preauth == nil {
+		return fmt.Errorf("could not call Duo preauth")
+	}
+	if preauth.StatResult.Stat != "OK" {
+		return duoError("could not look up Duo user information", &preauth.StatResult)
+	}
+
+	switch preauth.Response.Result {
+	case "allow":
+		return nil
+	case "auth":
+	default:
+		return fmt.Errorf("Duo denied the login: %s", preauth.Response.Status_Msg)
+	}
+
+	factor := "push"
+	options := []func(*url.Values){authapi.AuthUsername(username)}
+	if passcode != "" {
+		factor = "passcode"
+		options = append(options, authapi.AuthPasscode(passcode))
+	} else {
+		options = append(options, authapi.AuthDevice("auto"))
+		if config.PushInfo != "" {
+			options = append(options, authapi.AuthPushinfo(config.PushInfo))
+		}
+	}
+
+	result, err := client.Auth(factor, options...)
+	if err != nil || result == nil {
+		return fmt.Errorf("could not call Duo auth")
+	}
+	if result.StatResult.Stat != "OK" {
+		return duoError("could not authenticate Duo user", &result.StatResult)
+	}
+	if result.Response.Result != "allow" {
+		return fmt.Errorf("Duo denied the login: %s", result.Response.Status_Msg)
+	}
+	return nil
+}
+
+func duoError(msg string, result *authapi.StatResult) error {
+	if result.Message != nil {
+		msg = msg + ": " + *result.Message
+	}
+	if result.Message_Detail != nil {
+		msg = msg + " (" + *result.Message_Detail + ")"
+	}
+	return fmt.Errorf("%s", msg)
+}
+
+// oktaMFAClient is a client of the users and factors APIs of Okta
+type oktaMFAClient struct {
+	httpClient *http.Client
+	apiURL     string
+	token      string
+}
+
+type oktaFactorResult struct {
+	FactorResult string `json:"factorResult"`
+	Links        struct {
+		Poll struct {
+			Href string `json:"href"`
+		} `json:"poll"`
+	} `json:"_links"`
+}
+
+// validateOkta verifies the Okta Verify TOTP passcode of the user if given,
+// and sends an Okta Verify push notification otherwise
+func validateOkta(config *OktaMFAConfig, entity *logical.Entity, passcode string) error {
+	username, err := mfaUsername(config.UsernameFormat, entity)
+	if err != nil {
+		return err
+	}
+
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = "okta.com"
+	}
+	client := &oktaMFAClient{
+		httpClient: cleanhttp.DefaultClient(),
+		apiURL:     "https://" + config.OrgName + "." + baseURL + "/api/v1/",
+		token:      config.APIToken,
+	}
+
+	var user struct {
+		ID string `json:"id"`
+	}
+	if config.PrimaryEmail {
+		var users []struct {
+			ID string `json:"id"`
+		}
+		query := url.Values{"search": []string{fmt.Sprintf("profile.email eq %q", username)}}
+		if err := client.call("GET", client.apiURL+"users?"+query.Encode(), nil, &users); err != nil {
+			return err
+		}
+		if len(users) != 1 {
+			return fmt.Errorf("found %d Okta users with the primary email %q", len(users), username)
+		}
+		user.ID = users[0].ID
+	} else if err := client.call("GET", client.apiURL+"users/"+url.PathEscape(username), nil, &user); err != nil {
+		return err
+	}
+
+	var factors []struct {
+		ID         string `json:"id"`
+		FactorType string `json:"factorType"`
+		Provider   string `json:"provider"`
+	}
+	if err := client.call("GET", client.apiURL+"users/"+user.ID+"/factors", nil, &factors); err != nil {
+		return err
+	}
+
+	factorType := "push"
+	if passcode != "" {
+		factorType = "token:software:totp"
+	}
+	factorID := ""
+	for _, f := range factors {
+		if f.FactorType == factorType && f.Provider == "OKTA" {
+			factorID = f.ID
+			break
+		}
+	}
+	if factorID == "" {
+		return fmt.Errorf("user has no Okta Verify %s factor", factorType)
+	}
+
+	var request map[string]interface{}
+	if passcode != "" {
+		request = map[string]interface{}{"passCode": passcode}
+	}
+	var result oktaFactorResult
+	if err := client.call("POST", client.apiURL+"users/"+user.ID+"/factors/"+factorID+"/verify", request, &result); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(mfaPushTimeout)
+	for result.FactorResult == "WAITING" && result.Links.Poll.Href != "" {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for the Okta push notification to be approved")
+		}
+		time.Sleep(time.Second)
+		if err := client.call("GET", result.Links.Poll.Href, nil, &result); err != nil {
+			return err
+		}
+	}
+
+	if result.FactorResult != "SUCCESS" {
+		return fmt.Errorf("Okta factor verification failed: %s", strings.ToLower(result.FactorResult))
+	}
+	return nil
+}
+
+func (c *oktaMFAClient) call(method, endpoint string, request, response interface{}) error {
+	var body []byte
+	if request != nil {
+		var err error
+		if body, err = json.Marshal(request); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "SSWS "+c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		var apiErr struct {
+			ErrorSummary string `json:"errorSummary"`
+		}
+		if err := json.Unmarshal(respBody, &apiErr); err == nil && apiErr.ErrorSummary != "" {
+			return fmt.Errorf("Okta API error: %s", apiErr.ErrorSummary)
+		}
+		return fmt.Errorf("unexpected status code %d from the Okta API", resp.StatusCode)
+	}
+
+	return json.Unmarshal(respBody, response)
+}
+
+// validatePingID sends a PingID push notification to the user and waits
+// for it to be approved
+func validatePingID(config *PingIDMFAConfig, entity *logical.Entity) error {
+	username, err := mfaUsername(config.UsernameFormat, entity)
+	if err != nil {
+		return err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(config.UseBase64Key)
+	if err != nil {
+		return fmt.Errorf("invalid PingID key: %v", err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"reqHeader": map[string]interface{}{
+			"locale":    "en",
+			"orgAlias":  config.OrgAlias,
+			"secretKey": config.Token,
+			"timestamp": time.Now().Format("2006-01-02 15:04:05.000"),
+			"version":   "4.9",
+		},
+		"reqBody": map[string]interface{}{
+			"spAlias":  "web",
+			"userName": username,
+			"authType": "CONFIRM",
+		},
+	})
+	token.Header["org_alias"] = config.OrgAlias
+	token.Header["token"] = config.Token
+	signed, err := token.SignedString(key)
+	if err != nil {
+		return err
+	}
+
+	client := cleanhttp.DefaultClient()
+	client.Timeout = mfaPushTimeout
+	resp, err := client.Post(strings.TrimSuffix(config.IDPURL, "/")+"/rest/4/authonline/do", "application/json", strings.NewReader(signed))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// The response is a token signed with the same key
+	parsed, err := jwt.Parse(strings.TrimSpace(string(body)), func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return key, nil
+	})
+	if err != nil {
+		return fmt.Errorf("invalid PingID response: %v", err)
+	}
+	claims, _ := parsed.Claims.(jwt.MapClaims)
+	respBody, _ := claims["responseBody"].(map[string]interface{})
+	if errorID, _ := respBody["errorId"].(float64); errorID != 200 {
+		return fmt.Errorf("PingID authentication failed: %v", respBody["errorMsg"])
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package vault
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	otplib "github.com/pquerna/otp"
+	totplib "github.com/pquerna/otp/totp"
+)
+
+func TestLoginMFA_TOTP(t *testing.T) {
+	noop := &NoopBackend{
+		Login: []string{"login"},
+	}
+	c, _, root := TestCoreUnsealed(t)
+	c.credentialBackends["noop"] = func(conf *logical.BackendConfig) (logical.Backend, error) {
+		return noop, nil
+	}
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		req := logical.TestRequest(t, op, path)
+		req.Data = data
+		req.ClientToken = root
+		resp, err := c.HandleRequest(req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v resp: %#v", err, resp)
+		}
+		return resp
+	}
+	login := func() *logical.Response {
+		noop.Response = &logical.Response{
+			Auth: &logical.Auth{
+				Policies:    []string{"foo"},
+				DisplayName: "armon",
+				Metadata: map[string]string{
+					"username": "armon",
+				},
+			},
+		}
+		resp, err := c.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "auth/foo/login",
+		})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return resp
+	}
+	validate := func(requestID, methodID, passcode string) (*logical.Response, error) {
+		return c.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "sys/mfa/validate",
+			Data: map[string]interface{}{
+				"mfa_request_id": requestID,
+				"mfa_payload": map[string]interface{}{
+					methodID: []interface{}{passcode},
+				},
+			},
+		})
+	}
+
+	request(logical.UpdateOperation, "sys/auth/foo", map[string]interface{}{
+		"type": "noop",
+	})
+
+	resp := request(logical.UpdateOperation, "sys/mfa/method/totp", map[string]interface{}{
+		"issuer": "vault",
+	})
+	methodID := resp.Data["method_id"].(string)
+
+	resp = request(logical.ReadOperation, "sys/mfa/method/totp/"+methodID, nil)
+	if resp.Data["issuer"] != "vault" || resp.Data["digits"] != 6 || resp.Data["algorithm"] != "SHA1" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp = request(logical.UpdateOperation, "sys/mfa/method/totp/admin-generate", map[string]interface{}{
+		"method_id":   methodID,
+		"entity_name": "foo-armon",
+	})
+	if resp.Data["barcode"] == "" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	key, err := otplib.NewKeyFromURL(resp.Data["url"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Logins are not subject to MFA without enforcements
+	if resp := login(); resp.Auth.ClientToken == "" {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+
+	request(logical.UpdateOperation, "sys/mfa/login-enforcement/foo", map[string]interface{}{
+		"mfa_method_ids":    methodID,
+		"auth_method_paths": "auth/foo",
+	})
+	resp = request(logical.ReadOperation, "sys/mfa/login-enforcement/foo", nil)
+	if !reflect.DeepEqual(resp.Data["auth_method_paths"], []string{"foo/"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Methods used by enforcements cannot be deleted
+	req := logical.TestRequest(t, logical.DeleteOperation, "sys/mfa/method/totp/"+methodID)
+	req.ClientToken = root
+	if resp, err := c.HandleRequest(req); err == nil && !resp.IsError() {
+		t.Fatal("expected an error deleting a method in use")
+	}
+
+	resp = login()
+	if resp.Auth.ClientToken != "" || resp.Auth.MFARequirement == nil {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+	requirement := resp.Auth.MFARequirement
+	expected := map[string]*logical.MFAConstraintAny{
+		"foo": &logical.MFAConstraintAny{
+			Any: []*logical.MFAMethodID{
+				&logical.MFAMethodID{Type: "totp", ID: methodID, UsesPasscode: true},
+			},
+		},
+	}
+	if !reflect.DeepEqual(requirement.MFAConstraints, expected) {
+		t.Fatalf("bad: %#v", requirement.MFAConstraints)
+	}
+
+	if _, err := validate(requirement.MFARequestID, methodID, "000000"); err == nil {
+		t.Fatal("expected an error with an invalid passcode")
+	}
+
+	passcode, err := totplib.GenerateCode(key.Secret(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = validate(requirement.MFARequestID, methodID, passcode)
+	if err != nil {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+	te, err := c.tokenStore.Lookup(resp.Auth.ClientToken)
+	if err != nil || te == nil {
+		t.Fatalf("err: %v", err)
+	}
+	if te.Path != "auth/foo/login" || te.DisplayName != "foo-armon" || !reflect.DeepEqual(te.Policies, []string{"default", "foo"}) {
+		t.Fatalf("bad token: %#v", te)
+	}
+
+	// MFA requests are completed once
+	if _, err := validate(requirement.MFARequestID, methodID, passcode); err == nil {
+		t.Fatal("expected an error completing a login twice")
+	}
+
+	// Passcodes cannot be used twice
+	requirement = login().Auth.MFARequirement
+	if _, err := validate(requirement.MFARequestID, methodID, passcode); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("expected an error using a passcode twice, got %v", err)
+	}
+
+	// Enforcements bound to other entities do not apply
+	request(logical.UpdateOperation, "sys/mfa/login-enforcement/foo", map[string]interface{}{
+		"auth_method_paths":     "",
+		"identity_entity_names": "foo-other",
+	})
+	if resp := login(); resp.Auth.ClientToken == "" {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+
+	// Entities generate their own secret once
+	request(logical.UpdateOperation, "sys/policy/foo", map[string]interface{}{
+		"rules": `path "sys/mfa/method/totp/generate" { capabilities = ["update"] }`,
+	})
+	noop.Response = &logical.Response{
+		Auth: &logical.Auth{
+			Policies:    []string{"foo"},
+			DisplayName: "mitchellh",
+		},
+	}
+	resp, err = c.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "auth/foo/login",
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	generate := logical.TestRequest(t, logical.UpdateOperation, "sys/mfa/method/totp/generate")
+	generate.Data["method_id"] = methodID
+	generate.ClientToken = resp.Auth.ClientToken
+	resp, err = c.HandleRequest(generate)
+	if err != nil || resp.Data["url"] == nil || len(resp.Warnings) != 0 {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+	resp, err = c.HandleRequest(generate)
+	if err != nil || resp.Data["url"] != nil || len(resp.Warnings) != 1 {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+
+	// Tokens without an entity, such as root tokens, have no secret to
+	// generate
+	generate.ClientToken = root
+	if resp, err := c.HandleRequest(generate); err != nil || !resp.IsError() {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+
+	request(logical.DeleteOperation, "sys/mfa/login-enforcement/foo", nil)
+	request(logical.DeleteOperation, "sys/mfa/method/totp/"+methodID, nil)
+	secret, err := c.loginMFAStore.TOTPSecret(methodID, "foo-armon")
+	if err != nil || secret != "" {
+		t.Fatalf("expected the secrets of the method to be deleted: %v", err)
+	}
+}
+
+func TestParsePingIDSettings(t *testing.T) {
+	config, err := parsePingIDSettings(`#Auto-Generated from PingOne
+use_base64_key=c2VjcmV0
+use_signature=true
+token=abc
+idp_url=https://idpxnyl3m.pingidentity.com/pingid
+org_alias=org
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &PingIDMFAConfig{
+		UseBase64Key: "c2VjcmV0",
+		UseSignature: true,
+		Token:        "abc",
+		IDPURL:       "https://idpxnyl3m.pingidentity.com/pingid",
+		OrgAlias:     "org",
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Fatalf("bad: %#v", config)
+	}
+
+	if _, err := parsePingIDSettings("token=abc"); err == nil {
+		t.Fatal("expected an error for incomplete settings")
+	}
+}
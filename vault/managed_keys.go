@@ -0,0 +1,159 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/managedkeys"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+var managedKeysPath = "core/managed-keys/"
+
+// ManagedKeyEntry is the configuration of a managed key
+type ManagedKeyEntry struct {
+	Name string `json:"name"`
+
+	// Type is the managed key provider type, such as "awskms"
+	Type string `json:"type"`
+
+	// Parameters are passed to the provider to access the key
+	Parameters map[string]string `json:"parameters"`
+
+	// AllowedMounts lists the paths of the mounts that may use the key, or
+	// "*" for all mounts
+	AllowedMounts []string `json:"allowed_mounts"`
+}
+
+// ManagedKeyRegistry keeps a record of the managed keys known to Vault, whose
+// private material is held in external devices. Keys must be registered
+// before backends can use them.
+type ManagedKeyRegistry struct {
+	view *BarrierView
+
+	// keys holds the keys created from the configured entries, so that
+	// providers are not set up again for each operation
+	keys map[string]managedkeys.Key
+
+	lock sync.RWMutex
+}
+
+func (c *Core) setupManagedKeyRegistry() error {
+	c.managedKeyRegistry = &ManagedKeyRegistry{
+		view: NewBarrierView(c.barrier, managedKeysPath),
+		keys: map[string]managedkeys.Key{},
+	}
+
+	return nil
+}
+
+// Get retrieves the configuration of the named managed key, or nil if it does
+// not exist
+func (r *ManagedKeyRegistry) Get(name string) (*ManagedKeyEntry, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.get(name)
+}
+
+func (r *ManagedKeyRegistry) get(name string) (*ManagedKeyEntry, error) {
+	out, err := r.view.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve managed key %q: %v", name, err)
+	}
+	if out == nil {
+		return nil, nil
+	}
+
+	entry := new(ManagedKeyEntry)
+	if err := jsonutil.DecodeJSON(out.Value, entry); err != nil {
+		return nil, fmt.Errorf("failed to decode managed key entry: %v", err)
+	}
+	return entry, nil
+}
+
+// Set registers a managed key, or updates the configuration of an existing
+// one
+func (r *ManagedKeyRegistry) Set(entry *ManagedKeyEntry) error {
+	if strings.Contains(entry.Name, "..") {
+		return fmt.Errorf("managed key names cannot contain \"..\"")
+	}
+	if err := managedkeys.ValidateParameters(entry.Type, entry.Parameters); err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode managed key entry: %v", err)
+	}
+
+	if err := r.view.Put(&logical.StorageEntry{
+		Key:   entry.Name,
+		Value: buf,
+	}); err != nil {
+		return fmt.Errorf("failed to persist managed key entry: %v", err)
+	}
+
+	delete(r.keys, entry.Name)
+	return nil
+}
+
+// Delete removes a managed key. The key material itself is not affected.
+func (r *ManagedKeyRegistry) Delete(name string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.keys, name)
+	return r.view.Delete(name)
+}
+
+// List returns the names of the managed keys
+func (r *ManagedKeyRegistry) List() ([]string, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return logical.CollectKeys(r.view)
+}
+
+// Key returns the named managed key for use by the mount at the given path.
+// It returns managedkeys.ErrNotFound if the key does not exist or the mount is
+// not allowed to use it.
+func (r *ManagedKeyRegistry) Key(name, mountPath string) (managedkeys.Key, error) {
+	r.lock.RLock()
+	entry, err := r.get(name)
+	key := r.keys[name]
+	r.lock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil ||
+		!(strutil.StrListContains(entry.AllowedMounts, "*") ||
+			strutil.StrListContains(entry.AllowedMounts, mountPath)) {
+		return nil, managedkeys.ErrNotFound
+	}
+	if key != nil {
+		return key, nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// The key may have been created while waiting for the lock
+	if key := r.keys[name]; key != nil {
+		return key, nil
+	}
+
+	key, err = managedkeys.NewKey(entry.Type, entry.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up managed key %q: %v", name, err)
+	}
+	r.keys[name] = key
+	return key, nil
+}
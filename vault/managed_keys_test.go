@@ -0,0 +1,72 @@
+package vault
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/managedkeys"
+)
+
+func TestManagedKeyRegistry_Key(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+
+	// Register a provider backed by software keys, counting how often keys
+	// are created
+	created := 0
+	managedkeys.Register("test-software", &managedkeys.Provider{
+		Factory: func(params map[string]string) (managedkeys.Key, error) {
+			created++
+			return rsa.GenerateKey(rand.Reader, 2048)
+		},
+	})
+
+	if _, err := c.managedKeyRegistry.Key("test", "transit/"); err != managedkeys.ErrNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	err := c.managedKeyRegistry.Set(&ManagedKeyEntry{
+		Name:          "test",
+		Type:          "test-software",
+		AllowedMounts: []string{"transit/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.managedKeyRegistry.Key("test", "pki/"); err != managedkeys.ErrNotFound {
+		t.Fatalf("expected not found for disallowed mount, got %v", err)
+	}
+
+	key, err := c.managedKeyRegistry.Key("test", "transit/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := key.(crypto.Decrypter); !ok {
+		t.Fatal("expected key to support decryption")
+	}
+
+	// Keys are reused until their configuration changes
+	if _, err := c.managedKeyRegistry.Key("test", "transit/"); err != nil {
+		t.Fatal(err)
+	}
+	if created != 1 {
+		t.Fatalf("expected key to be created once, got %d", created)
+	}
+
+	err = c.managedKeyRegistry.Set(&ManagedKeyEntry{
+		Name:          "test",
+		Type:          "test-software",
+		AllowedMounts: []string{"*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.managedKeyRegistry.Key("test", "pki/"); err != nil {
+		t.Fatal(err)
+	}
+	if created != 2 {
+		t.Fatalf("expected key to be created again, got %d", created)
+	}
+}
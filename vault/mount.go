@@ -97,11 +97,11 @@ func (t *MountTable) Hash() ([]byte, error) {
 	return hash[:], nil
 }
 
-// setTaint is used to set the taint on given entry
+// setTaint is used to set the taint on the entry at the given API path
 func (t *MountTable) setTaint(path string, value bool) *MountEntry {
 	n := len(t.Entries)
 	for i := 0; i < n; i++ {
-		if t.Entries[i].Path == path {
+		if t.Entries[i].APIPath() == path {
 			t.Entries[i].Tainted = value
 			return t.Entries[i]
 		}
@@ -109,12 +109,12 @@ func (t *MountTable) setTaint(path string, value bool) *MountEntry {
 	return nil
 }
 
-// remove is used to remove a given path entry; returns the entry that was
-// removed
+// remove is used to remove the entry at the given API path; returns the
+// entry that was removed
 func (t *MountTable) remove(path string) *MountEntry {
 	n := len(t.Entries)
 	for i := 0; i < n; i++ {
-		if entry := t.Entries[i]; entry.Path == path {
+		if entry := t.Entries[i]; entry.APIPath() == path {
 			t.Entries[i], t.Entries[n-1] = t.Entries[n-1], nil
 			t.Entries = t.Entries[:n-1]
 			return entry
@@ -143,6 +143,33 @@ type MountEntry struct {
 	Options     map[string]string `json:"options"`           // Backend options
 	Local       bool              `json:"local"`             // Local mounts are not replicated or affected by replication
 	Tainted     bool              `json:"tainted,omitempty"` // Set as a Write-Ahead flag for unmount/remount
+
+	// NamespaceID is the ID of the namespace of the mount, within which Path
+	// is. Mounts of the root namespace have no namespace ID.
+	NamespaceID string `json:"namespace_id,omitempty"`
+
+	// namespace is the namespace of NamespaceID, resolved when the mount
+	// table is loaded
+	namespace *NamespaceEntry
+}
+
+// Namespace returns the namespace of the mount
+func (e *MountEntry) Namespace() *NamespaceEntry {
+	if e.namespace == nil {
+		return rootNamespace
+	}
+	return e.namespace
+}
+
+// APIPath returns the path the mount is routed at, which is the path of the
+// mount prefixed with the path of its namespace and, for auth backends,
+// with "auth/"
+func (e *MountEntry) APIPath() string {
+	path := e.Path
+	if e.Table == credentialTableType {
+		path = credentialRoutePrefix + path
+	}
+	return e.Namespace().Path + path
 }
 
 // MountConfig is used to hold settable options
@@ -150,6 +177,19 @@ type MountConfig struct {
 	DefaultLeaseTTL time.Duration `json:"default_lease_ttl" structs:"default_lease_ttl" mapstructure:"default_lease_ttl"` // Override for global default
 	MaxLeaseTTL     time.Duration `json:"max_lease_ttl" structs:"max_lease_ttl" mapstructure:"max_lease_ttl"`             // Override for global default
 	ForceNoCache    bool          `json:"force_no_cache" structs:"force_no_cache" mapstructure:"force_no_cache"`          // Override for global default
+
+	// DefaultWrappingTTL, if set, wraps the responses of the mount that are
+	// not requested to be wrapped, and MaxWrappingTTL caps the TTL of the
+	// wrapping tokens of the responses of the mount
+	DefaultWrappingTTL time.Duration `json:"default_wrapping_ttl,omitempty" structs:"default_wrapping_ttl" mapstructure:"default_wrapping_ttl"`
+	MaxWrappingTTL     time.Duration `json:"max_wrapping_ttl,omitempty" structs:"max_wrapping_ttl" mapstructure:"max_wrapping_ttl"`
+
+	// TokenType is the type of the tokens issued by logins to an auth
+	// mount. Empty issues service tokens.
+	TokenType string `json:"token_type,omitempty" structs:"token_type" mapstructure:"token_type"`
+
+	// UserLockoutConfig locks users out of an auth mount after failed logins
+	UserLockoutConfig UserLockoutConfig `json:"user_lockout_config" structs:"user_lockout_config" mapstructure:"user_lockout_config"`
 }
 
 // Returns a deep copy of the mount entry
@@ -168,6 +208,8 @@ func (e *MountEntry) Clone() *MountEntry {
 		Options:     optClone,
 		Local:       e.Local,
 		Tainted:     e.Tainted,
+		NamespaceID: e.NamespaceID,
+		namespace:   e.namespace,
 	}
 }
 
@@ -192,13 +234,23 @@ func (c *Core) mount(entry *MountEntry) error {
 		}
 	}
 
+	return c.mountInternal(entry)
+}
+
+// mountInternal mounts a backend without the checks protecting the
+// singleton mounts, which namespaces have their own instances of
+func (c *Core) mountInternal(entry *MountEntry) error {
 	c.mountsLock.Lock()
 	defer c.mountsLock.Unlock()
 
-	// Verify there is no conflicting mount
-	if match := c.router.MatchingMount(entry.Path); match != "" {
+	// Verify there is no conflicting mount or namespace
+	path := entry.APIPath()
+	if match := c.router.MatchingMount(path); match != "" {
 		return logical.CodedError(409, fmt.Sprintf("existing mount at %s", match))
 	}
+	if ns := c.namespaceStore.Resolve(path); ns.ID != entry.Namespace().ID {
+		return logical.CodedError(409, fmt.Sprintf("existing namespace at %s", ns.Path))
+	}
 
 	// Generate a new UUID and view
 	if entry.UUID == "" {
@@ -210,21 +262,11 @@ func (c *Core) mount(entry *MountEntry) error {
 	}
 	viewPath := backendBarrierPrefix + entry.UUID + "/"
 	view := NewBarrierView(c.barrier, viewPath)
-	sysView := c.mountEntrySysView(entry)
 
-	backend, err := c.newLogicalBackend(entry.Type, sysView, view, nil)
+	backend, err := c.newMountEntryBackend(entry, view)
 	if err != nil {
 		return err
 	}
-	if backend == nil {
-		return fmt.Errorf("nil backend of type %q returned from creation function", entry.Type)
-	}
-
-	// Call initialize; this takes care of init tasks that must be run after
-	// the ignore paths are collected
-	if err := backend.Initialize(); err != nil {
-		return err
-	}
 
 	newTable := c.mounts.shallowClone()
 	newTable.Entries = append(newTable.Entries, entry)
@@ -234,31 +276,38 @@ func (c *Core) mount(entry *MountEntry) error {
 	}
 	c.mounts = newTable
 
-	if err := c.router.Mount(backend, entry.Path, entry, view); err != nil {
+	if err := c.router.Mount(backend, path, entry, view); err != nil {
 		return err
 	}
 
 	if c.logger.IsInfo() {
-		c.logger.Info("core: successful mount", "path", entry.Path, "type", entry.Type)
+		c.logger.Info("core: successful mount", "path", path, "type", entry.Type)
 	}
 	return nil
 }
 
-// Unmount is used to unmount a path. The boolean indicates whether the mount
-// was found.
+// Unmount is used to unmount an API path. The boolean indicates whether the
+// mount was found.
 func (c *Core) unmount(path string) (bool, error) {
 	// Ensure we end the path in a slash
 	if !strings.HasSuffix(path, "/") {
 		path += "/"
 	}
 
-	// Prevent protected paths from being unmounted
+	// Prevent protected paths from being unmounted, within any namespace
+	ns := c.namespaceStore.Resolve(path)
 	for _, p := range protectedMounts {
-		if strings.HasPrefix(path, p) {
+		if strings.HasPrefix(strings.TrimPrefix(path, ns.Path), p) {
 			return true, fmt.Errorf("cannot unmount '%s'", path)
 		}
 	}
 
+	return c.unmountInternal(path)
+}
+
+// unmountInternal unmounts an API path without the checks protecting the
+// required mounts, which are removed along with their namespace
+func (c *Core) unmountInternal(path string) (bool, error) {
 	// Verify exact match of the route
 	match := c.router.MatchingMount(path)
 	if match == "" || path != match {
@@ -376,9 +425,10 @@ func (c *Core) remount(src, dst string) error {
 		dst += "/"
 	}
 
-	// Prevent protected paths from being remounted
+	// Prevent protected paths from being remounted, within any namespace
+	ns := c.namespaceStore.Resolve(src)
 	for _, p := range protectedMounts {
-		if strings.HasPrefix(src, p) {
+		if strings.HasPrefix(strings.TrimPrefix(src, ns.Path), p) {
 			return fmt.Errorf("cannot remount '%s'", src)
 		}
 	}
@@ -393,6 +443,11 @@ func (c *Core) remount(src, dst string) error {
 		return fmt.Errorf("existing mount at '%s'", match)
 	}
 
+	// Mounts cannot move between namespaces
+	if dstNS := c.namespaceStore.Resolve(dst); dstNS.ID != ns.ID {
+		return fmt.Errorf("cannot remount '%s' to a different namespace", src)
+	}
+
 	// Mark the entry as tainted
 	if err := c.taintMountEntry(src); err != nil {
 		return err
@@ -416,8 +471,8 @@ func (c *Core) remount(src, dst string) error {
 	c.mountsLock.Lock()
 	var ent *MountEntry
 	for _, ent = range c.mounts.Entries {
-		if ent.Path == src {
-			ent.Path = dst
+		if ent.APIPath() == src {
+			ent.Path = strings.TrimPrefix(dst, ns.Path)
 			ent.Tainted = false
 			break
 		}
@@ -430,7 +485,7 @@ func (c *Core) remount(src, dst string) error {
 
 	// Update the mount table
 	if err := c.persistMounts(c.mounts, ent.Local); err != nil {
-		ent.Path = src
+		ent.Path = strings.TrimPrefix(src, ns.Path)
 		ent.Tainted = true
 		c.mountsLock.Unlock()
 		c.logger.Error("core: failed to update mounts table", "error", err)
@@ -507,7 +562,7 @@ func (c *Core) loadMounts() error {
 		for _, requiredMount := range requiredMountTable().Entries {
 			foundRequired := false
 			for _, coreMount := range c.mounts.Entries {
-				if coreMount.Type == requiredMount.Type {
+				if coreMount.Type == requiredMount.Type && coreMount.NamespaceID == "" {
 					foundRequired = true
 					break
 				}
@@ -519,12 +574,15 @@ func (c *Core) loadMounts() error {
 			// ensure this comes over. If we upgrade first, we simply don't
 			// create the mount, so we won't conflict when we sync. If this is
 			// local (e.g. cubbyhole) we do still add it.
-			if !foundRequired && (c.replicationState != consts.ReplicationSecondary || requiredMount.Local) {
+			if !foundRequired && (!c.replicationState.HasState(consts.ReplicationSecondary) || requiredMount.Local) {
 				c.mounts.Entries = append(c.mounts.Entries, requiredMount)
 				needPersist = true
 			}
 		}
 
+		// Resolve the namespaces of the entries
+		c.mounts.Entries = c.resolveEntryNamespaces(c.mounts.Entries)
+
 		// Upgrade to table-scoped entries
 		for _, entry := range c.mounts.Entries {
 			if entry.Type == "cubbyhole" && !entry.Local {
@@ -635,59 +693,127 @@ func (c *Core) setupMounts() error {
 	var view *BarrierView
 	var err error
 
-	for _, entry := range c.mounts.Entries {
+	for _, entry := range namespaceOrderedEntries(c.mounts.Entries) {
+		// The mounts filtered out by the primary of a performance secondary
+		// are not available
+		if c.replicationFilteredMount(entry) {
+			continue
+		}
+
 		// Initialize the backend, special casing for system
 		barrierPath := backendBarrierPrefix + entry.UUID + "/"
-		if entry.Type == "system" {
+		root := entry.Namespace().ID == rootNamespaceID
+		if entry.Type == "system" && root {
 			barrierPath = systemBarrierPrefix
 		}
 
-		// Create a barrier view using the UUID
+		// Create a barrier view using the UUID. The replicated mounts of a
+		// performance secondary are written by its primary only.
 		view = NewBarrierView(c.barrier, barrierPath)
-		sysView := c.mountEntrySysView(entry)
-		// Initialize the backend
+		view.readonly = c.perfSecondaryReadOnlyMount(entry)
+
 		// Create the new backend
-		backend, err = c.newLogicalBackend(entry.Type, sysView, view, nil)
+		backend, err = c.newMountEntryBackend(entry, view)
 		if err != nil {
 			c.logger.Error("core: failed to create mount entry", "path", entry.Path, "error", err)
 			return errLoadMountsFailed
 		}
-		if backend == nil {
-			return fmt.Errorf("created mount entry of type %q is nil", entry.Type)
-		}
 
-		if err := backend.Initialize(); err != nil {
-			return err
-		}
-
-		switch entry.Type {
-		case "system":
+		if entry.Type == "system" && root {
 			c.systemBarrierView = view
-		case "cubbyhole":
-			ch := backend.(*CubbyholeBackend)
-			ch.saltUUID = entry.UUID
-			ch.storageView = view
 		}
 
 		// Mount the backend
-		err = c.router.Mount(backend, entry.Path, entry, view)
+		path := entry.APIPath()
+		err = c.router.Mount(backend, path, entry, view)
 		if err != nil {
-			c.logger.Error("core: failed to mount entry", "path", entry.Path, "error", err)
+			c.logger.Error("core: failed to mount entry", "path", path, "error", err)
 			return errLoadMountsFailed
 		} else {
 			if c.logger.IsInfo() {
-				c.logger.Info("core: successfully mounted backend", "type", entry.Type, "path", entry.Path)
+				c.logger.Info("core: successfully mounted backend", "type", entry.Type, "path", path)
 			}
 		}
 
 		// Ensure the path is tainted if set in the mount table
 		if entry.Tainted {
-			c.router.Taint(entry.Path)
+			c.router.Taint(path)
 		}
 	}
 	return nil
 }
 
+// newMountEntryBackend creates and initializes the backend of a mount
+// entry. The system backend of a namespace is the one of the root
+// namespace, restricted to the paths available within namespaces.
+func (c *Core) newMountEntryBackend(entry *MountEntry, view *BarrierView) (logical.Backend, error) {
+	if entry.Type == "system" && entry.Namespace().ID != rootNamespaceID {
+		backend := c.router.MatchingBackend(systemBarrierPrefix)
+		if backend == nil {
+			return nil, fmt.Errorf("system backend of the root namespace is not mounted")
+		}
+		return newNamespaceBackend(backend, namespaceSystemPaths), nil
+	}
+
+	sysView := c.mountEntrySysView(entry)
+	backend, err := c.newLogicalBackend(entry.Type, sysView, view, nil)
+	if err != nil {
+		return nil, err
+	}
+	if backend == nil {
+		return nil, fmt.Errorf("nil backend of type %q returned from creation function", entry.Type)
+	}
+
+	// Call initialize; this takes care of init tasks that must be run after
+	// the ignore paths are collected
+	if err := backend.Initialize(); err != nil {
+		return nil, err
+	}
+
+	if entry.Type == "cubbyhole" {
+		ch := backend.(*CubbyholeBackend)
+		ch.saltUUID = entry.UUID
+		ch.storageView = view
+	}
+	return backend, nil
+}
+
+// resolveEntryNamespaces resolves the namespaces of mount entries, dropping
+// the entries of namespaces which no longer exist
+func (c *Core) resolveEntryNamespaces(entries []*MountEntry) []*MountEntry {
+	resolved := entries[:0]
+	for _, entry := range entries {
+		ns := c.namespaceStore.ByID(entry.NamespaceID)
+		if ns == nil {
+			c.logger.Error("core: dropping mount entry of missing namespace", "path", entry.Path, "namespace_id", entry.NamespaceID)
+			continue
+		}
+		if ns.ID != rootNamespaceID {
+			entry.namespace = ns
+		}
+		resolved = append(resolved, entry)
+	}
+	return resolved
+}
+
+// namespaceOrderedEntries returns the entries of the root namespace followed
+// by the entries of the other namespaces, whose system backend and token
+// store are those of the root namespace
+func namespaceOrderedEntries(entries []*MountEntry) []*MountEntry {
+	ordered := make([]*MountEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Namespace().ID == rootNamespaceID {
+			ordered = append(ordered, entry)
+		}
+	}
+	for _, entry := range entries {
+		if entry.Namespace().ID != rootNamespaceID {
+			ordered = append(ordered, entry)
+		}
+	}
+	return ordered
+}
+
 // unloadMounts is used before we seal the vault to reset the mounts to
 // their unloaded state, calling Cleanup if defined. This is reversed by load and setup mounts.
 func (c *Core) unloadMounts() error {
@@ -697,7 +823,7 @@ func (c *Core) unloadMounts() error {
 	if c.mounts != nil {
 		mountTable := c.mounts.shallowClone()
 		for _, e := range mountTable.Entries {
-			backend := c.router.MatchingBackend(e.Path)
+			backend := c.router.MatchingBackend(e.APIPath())
 			if backend != nil {
 				backend.Cleanup()
 			}
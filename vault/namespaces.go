@@ -0,0 +1,567 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/armon/go-radix"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// coreNamespacesPath is the storage prefix of the namespace entries
+	coreNamespacesPath = "core/namespaces/"
+
+	// namespaceBarrierPrefix is the storage prefix of the policies and
+	// external groups of the namespaces, followed by their ID
+	namespaceBarrierPrefix = "namespaces/"
+
+	// namespaceGroupsSubPath is the sub-path of the external groups of a
+	// namespace
+	namespaceGroupsSubPath = "external-groups/"
+
+	// namespaceEntitiesSubPath is the sub-path of the entities of a
+	// namespace
+	namespaceEntitiesSubPath = "entities/"
+
+	// rootNamespaceID is the ID of the root namespace. Mount entries and
+	// tokens of the root namespace have no namespace ID.
+	rootNamespaceID = "root"
+)
+
+var (
+	// rootNamespace is the namespace of the paths outside of any namespace
+	rootNamespace = &NamespaceEntry{ID: rootNamespaceID}
+
+	// errNamespaceNotEmpty is returned deleting a namespace with child
+	// namespaces
+	errNamespaceNotEmpty = errors.New("namespace has child namespaces")
+
+	// errMissingNamespace is returned using a token of a deleted namespace
+	errMissingNamespace = errors.New("namespace of the token does not exist")
+
+	namespaceNameRegex = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+	// reservedNamespaceNames cannot be used as the name of a namespace, as
+	// they conflict with the paths of the root namespace or of the
+	// namespaces themselves
+	reservedNamespaceNames = []string{
+		"root",
+		"sys",
+		"auth",
+		"audit",
+		"cubbyhole",
+		"identity",
+	}
+
+	// namespaceSystemPaths are the paths of the system backend available
+	// within namespaces. The other paths manage the whole Vault and are only
+	// available in the root namespace.
+	namespaceSystemPaths = []string{
+		"auth",
+		"capabilities",
+		"groups/external",
+		"leases/renew",
+		"mounts",
+		"namespaces",
+		"policy",
+		"remount",
+		"renew",
+	}
+
+	// namespaceTokenPaths are the paths of the token store available within
+	// namespaces
+	namespaceTokenPaths = []string{
+		"create",
+		"create-orphan",
+		"lookup-self",
+		"renew-self",
+		"revoke-self",
+	}
+)
+
+// NamespaceEntry is a namespace. Each namespace has its own mounts, auth
+// backends, policies, tokens and external groups, and its paths are those of
+// the root namespace prefixed with the path of the namespace.
+type NamespaceEntry struct {
+	ID string `json:"id"`
+
+	// Path is the path of the namespace from the root namespace, with a
+	// trailing slash, such as "engineering/frontend/". It is empty for the
+	// root namespace.
+	Path string `json:"path"`
+}
+
+// Name returns the last element of the path of the namespace
+func (n *NamespaceEntry) Name() string {
+	path := strings.TrimSuffix(n.Path, "/")
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// namespaceStores are the stores of the data of a namespace kept outside of
+// its mounts
+type namespaceStores struct {
+	policies *PolicyStore
+	groups   *ExternalGroupStore
+	entities *EntityStore
+}
+
+// NamespaceStore keeps the namespaces and resolves paths to the namespace
+// they belong to
+type NamespaceStore struct {
+	view *BarrierView
+
+	// modifyLock serializes the creation and deletion of namespaces, which
+	// span the namespace entries and the mount tables
+	modifyLock sync.Mutex
+
+	l      sync.RWMutex
+	byID   map[string]*NamespaceEntry
+	byPath *radix.Tree
+	stores map[string]*namespaceStores
+}
+
+// setupNamespaceStore loads the namespaces. This runs before the mount
+// tables are loaded, since their entries refer to namespaces.
+func (c *Core) setupNamespaceStore() error {
+	s := &NamespaceStore{
+		view:   NewBarrierView(c.barrier, coreNamespacesPath),
+		byID:   make(map[string]*NamespaceEntry),
+		byPath: radix.New(),
+		stores: make(map[string]*namespaceStores),
+	}
+
+	ids, err := logical.CollectKeys(s.view)
+	if err != nil {
+		c.logger.Error("core: failed to list namespaces", "error", err)
+		return err
+	}
+	for _, id := range ids {
+		raw, err := s.view.Get(id)
+		if err != nil {
+			c.logger.Error("core: failed to read namespace", "id", id, "error", err)
+			return err
+		}
+		if raw == nil {
+			continue
+		}
+		entry := new(NamespaceEntry)
+		if err := raw.DecodeJSON(entry); err != nil {
+			c.logger.Error("core: failed to decode namespace", "id", id, "error", err)
+			return err
+		}
+		s.insert(entry)
+	}
+
+	c.namespaceStore = s
+	return nil
+}
+
+// teardownNamespaceStore is used to reverse setupNamespaceStore when the
+// vault is being sealed
+func (c *Core) teardownNamespaceStore() error {
+	c.namespaceStore = nil
+	return nil
+}
+
+func (s *NamespaceStore) insert(entry *NamespaceEntry) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	s.byID[entry.ID] = entry
+	s.byPath.Insert(entry.Path, entry)
+}
+
+func (s *NamespaceStore) remove(entry *NamespaceEntry) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	delete(s.byID, entry.ID)
+	delete(s.stores, entry.ID)
+	s.byPath.Delete(entry.Path)
+}
+
+// ByID returns the namespace with the given ID, or nil if it does not exist.
+// The empty ID is the root namespace.
+func (s *NamespaceStore) ByID(id string) *NamespaceEntry {
+	if id == "" || id == rootNamespaceID {
+		return rootNamespace
+	}
+	if s == nil {
+		return nil
+	}
+
+	s.l.RLock()
+	defer s.l.RUnlock()
+	return s.byID[id]
+}
+
+// ByPath returns the namespace at the given path, or nil if it does not
+// exist. The empty path is the root namespace.
+func (s *NamespaceStore) ByPath(path string) *NamespaceEntry {
+	path = canonicalizeNamespacePath(path)
+	if path == "" {
+		return rootNamespace
+	}
+	if s == nil {
+		return nil
+	}
+
+	s.l.RLock()
+	defer s.l.RUnlock()
+	raw, ok := s.byPath.Get(path)
+	if !ok {
+		return nil
+	}
+	return raw.(*NamespaceEntry)
+}
+
+// Resolve returns the namespace a request path belongs to, which is the
+// namespace with the longest path prefixing it
+func (s *NamespaceStore) Resolve(path string) *NamespaceEntry {
+	if s == nil {
+		return rootNamespace
+	}
+
+	s.l.RLock()
+	defer s.l.RUnlock()
+	_, raw, ok := s.byPath.LongestPrefix(path)
+	if !ok {
+		return rootNamespace
+	}
+	return raw.(*NamespaceEntry)
+}
+
+// Children returns the namespaces directly within the given namespace,
+// sorted by path
+func (s *NamespaceStore) Children(parent *NamespaceEntry) []*NamespaceEntry {
+	if s == nil {
+		return nil
+	}
+
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	var children []*NamespaceEntry
+	s.byPath.WalkPrefix(parent.Path, func(path string, raw interface{}) bool {
+		rel := strings.TrimPrefix(path, parent.Path)
+		if rel != "" && strings.Count(rel, "/") == 1 {
+			children = append(children, raw.(*NamespaceEntry))
+		}
+		return false
+	})
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Path < children[j].Path
+	})
+	return children
+}
+
+// canonicalizeNamespacePath trims the slashes around a namespace path and
+// adds a trailing one, returning the empty path for the root namespace
+func canonicalizeNamespacePath(path string) string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return ""
+	}
+	return path + "/"
+}
+
+// storesForNamespace returns the policy, external group and entity stores of
+// a namespace
+func (c *Core) storesForNamespace(ns *NamespaceEntry) *namespaceStores {
+	s := c.namespaceStore
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if stores, ok := s.stores[ns.ID]; ok {
+		return stores
+	}
+
+	prefix := namespaceBarrierPrefix + ns.ID + "/"
+	policies := NewPolicyStore(NewBarrierView(c.barrier, prefix+policySubPath), &dynamicSystemView{core: c})
+	policies.namespacePath = ns.Path
+	stores := &namespaceStores{
+		policies: policies,
+		groups: &ExternalGroupStore{
+			view: NewBarrierView(c.barrier, prefix+namespaceGroupsSubPath),
+		},
+		entities: &EntityStore{
+			view: NewBarrierView(c.barrier, prefix+namespaceEntitiesSubPath),
+		},
+	}
+	s.stores[ns.ID] = stores
+	return stores
+}
+
+// policyStoreForNamespace returns the policy store of a namespace
+func (c *Core) policyStoreForNamespace(ns *NamespaceEntry) *PolicyStore {
+	if ns == nil || ns.ID == rootNamespaceID {
+		return c.policyStore
+	}
+	return c.storesForNamespace(ns).policies
+}
+
+// externalGroupStoreForNamespace returns the external group store of a
+// namespace
+func (c *Core) externalGroupStoreForNamespace(ns *NamespaceEntry) *ExternalGroupStore {
+	if ns == nil || ns.ID == rootNamespaceID {
+		return c.externalGroupStore
+	}
+	return c.storesForNamespace(ns).groups
+}
+
+// entityStoreForNamespace returns the entity store of a namespace
+func (c *Core) entityStoreForNamespace(ns *NamespaceEntry) *EntityStore {
+	if ns == nil || ns.ID == rootNamespaceID {
+		return c.entityStore
+	}
+	return c.storesForNamespace(ns).entities
+}
+
+// createNamespace creates a namespace with the given name within the parent
+// namespace, along with its system backend, cubbyhole and token store
+func (c *Core) createNamespace(parent *NamespaceEntry, name string) (*NamespaceEntry, error) {
+	if !namespaceNameRegex.MatchString(name) {
+		return nil, fmt.Errorf("namespace names can only contain alphanumeric characters, dashes and underscores")
+	}
+	if strutil.StrListContains(reservedNamespaceNames, strings.ToLower(name)) {
+		return nil, fmt.Errorf("%q is a reserved namespace name", name)
+	}
+
+	s := c.namespaceStore
+	s.modifyLock.Lock()
+	defer s.modifyLock.Unlock()
+
+	path := parent.Path + name + "/"
+	if s.ByPath(path) != nil {
+		return nil, logical.CodedError(409, fmt.Sprintf("namespace %q already exists", path))
+	}
+	if match := c.router.MatchingMount(path); match != "" {
+		return nil, logical.CodedError(409, fmt.Sprintf("existing mount at %s", match))
+	}
+	if c.pathHasMounts(path) {
+		return nil, logical.CodedError(409, fmt.Sprintf("existing mounts under %s", path))
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	ns := &NamespaceEntry{
+		ID:   id,
+		Path: path,
+	}
+	buf, err := json.Marshal(ns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode namespace entry: %v", err)
+	}
+	if err := s.view.Put(&logical.StorageEntry{
+		Key:   ns.ID,
+		Value: buf,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to persist namespace entry: %v", err)
+	}
+	s.insert(ns)
+
+	if err := c.policyStoreForNamespace(ns).createDefaultPolicy(); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range namespaceMountTable(ns).Entries {
+		if err := c.mountInternal(entry); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range namespaceAuthTable(ns).Entries {
+		if err := c.enableCredentialInternal(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.logger.IsInfo() {
+		c.logger.Info("core: created namespace", "path", ns.Path)
+	}
+	return ns, nil
+}
+
+// deleteNamespace revokes the leases and tokens of a namespace and removes
+// its mounts and data. Namespaces with child namespaces cannot be deleted.
+func (c *Core) deleteNamespace(ns *NamespaceEntry) error {
+	s := c.namespaceStore
+	s.modifyLock.Lock()
+	defer s.modifyLock.Unlock()
+
+	if len(s.Children(ns)) > 0 {
+		return logical.CodedError(400, errNamespaceNotEmpty.Error())
+	}
+
+	// Revoke the leases of the namespace, including the tokens, so that the
+	// backends are able to clean up what they issued
+	if err := c.expiration.RevokePrefix(ns.Path); err != nil {
+		return err
+	}
+
+	// Remove the mounts and auth backends, leaving the system backend,
+	// cubbyhole and token store until the end
+	var entries, singletons []*MountEntry
+	c.mountsLock.RLock()
+	c.authLock.RLock()
+	for _, table := range []*MountTable{c.mounts, c.auth} {
+		for _, entry := range table.Entries {
+			switch {
+			case entry.Namespace().ID != ns.ID:
+			case strutil.StrListContains(singletonMounts, entry.Type):
+				singletons = append(singletons, entry)
+			default:
+				entries = append(entries, entry)
+			}
+		}
+	}
+	c.authLock.RUnlock()
+	c.mountsLock.RUnlock()
+
+	for _, entry := range append(entries, singletons...) {
+		var err error
+		if entry.Table == credentialTableType {
+			_, err = c.disableCredentialInternal(entry.APIPath())
+		} else {
+			_, err = c.unmountInternal(entry.APIPath())
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := logical.ClearView(NewBarrierView(c.barrier, namespaceBarrierPrefix+ns.ID+"/")); err != nil {
+		return err
+	}
+	if err := s.view.Delete(ns.ID); err != nil {
+		return fmt.Errorf("failed to delete namespace entry: %v", err)
+	}
+	s.remove(ns)
+
+	if c.logger.IsInfo() {
+		c.logger.Info("core: deleted namespace", "path", ns.Path)
+	}
+	return nil
+}
+
+// namespaceCubbyhole returns the cubbyhole of the namespace with the given
+// ID, or nil if it does not exist
+func (c *Core) namespaceCubbyhole(id string) *CubbyholeBackend {
+	ns := c.namespaceStore.ByID(id)
+	if ns == nil {
+		return nil
+	}
+	ch, _ := c.router.MatchingBackend(ns.Path + "cubbyhole/").(*CubbyholeBackend)
+	return ch
+}
+
+// pathHasMounts returns whether there are mounts or auth backends under the
+// given path
+func (c *Core) pathHasMounts(path string) bool {
+	c.mountsLock.RLock()
+	defer c.mountsLock.RUnlock()
+	c.authLock.RLock()
+	defer c.authLock.RUnlock()
+
+	for _, table := range []*MountTable{c.mounts, c.auth} {
+		for _, entry := range table.Entries {
+			if strings.HasPrefix(entry.APIPath(), path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setMountEntryNamespace sets the namespace of a new mount entry
+func setMountEntryNamespace(entry *MountEntry, ns *NamespaceEntry) {
+	if ns.ID == rootNamespaceID {
+		return
+	}
+	entry.NamespaceID = ns.ID
+	entry.namespace = ns
+}
+
+// namespaceMountTable returns the mounts created with a namespace
+func namespaceMountTable(ns *NamespaceEntry) *MountTable {
+	table := requiredMountTable()
+	for _, entry := range table.Entries {
+		setMountEntryNamespace(entry, ns)
+	}
+	return table
+}
+
+// namespaceAuthTable returns the auth backends created with a namespace
+func namespaceAuthTable(ns *NamespaceEntry) *MountTable {
+	table := defaultAuthTable()
+	for _, entry := range table.Entries {
+		setMountEntryNamespace(entry, ns)
+	}
+	return table
+}
+
+// namespaceBackend exposes some of the paths of a backend shared with the
+// root namespace, such as the system backend and the token store, within a
+// namespace. The backend is owned by the root namespace, so it is neither
+// initialized nor cleaned up with the namespace.
+type namespaceBackend struct {
+	logical.Backend
+
+	paths []string
+}
+
+func newNamespaceBackend(backend logical.Backend, paths []string) *namespaceBackend {
+	return &namespaceBackend{
+		Backend: backend,
+		paths:   paths,
+	}
+}
+
+func (b *namespaceBackend) allowed(path string) bool {
+	for _, p := range b.paths {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *namespaceBackend) HandleRequest(req *logical.Request) (*logical.Response, error) {
+	switch req.Operation {
+	case logical.RollbackOperation:
+		// The backend is rolled back through its mount in the root namespace
+		return nil, nil
+	case logical.RenewOperation, logical.RevokeOperation:
+		// Leases are renewed and revoked by the expiration manager rather
+		// than on behalf of clients
+		return b.Backend.HandleRequest(req)
+	}
+
+	if !b.allowed(req.Path) {
+		return logical.ErrorResponse(fmt.Sprintf("path %q is not available within namespaces", req.Path)), logical.ErrUnsupportedPath
+	}
+	return b.Backend.HandleRequest(req)
+}
+
+func (b *namespaceBackend) HandleExistenceCheck(req *logical.Request) (bool, bool, error) {
+	if !b.allowed(req.Path) {
+		return false, false, logical.ErrUnsupportedPath
+	}
+	return b.Backend.HandleExistenceCheck(req)
+}
+
+func (b *namespaceBackend) Cleanup() {}
+
+func (b *namespaceBackend) Initialize() error {
+	return nil
+}
@@ -0,0 +1,180 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/logical"
+)
+
+func testNamespaceRequest(t *testing.T, c *Core, token string, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	req := logical.TestRequest(t, op, path)
+	req.ClientToken = token
+	if data != nil {
+		req.Data = data
+	}
+	resp, err := c.HandleRequest(req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("%s %s: err: %v resp: %#v", op, path, err, resp)
+	}
+	return resp
+}
+
+func TestNamespaces(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	resp := testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/namespaces/ns1", nil)
+	if resp.Data["path"] != "ns1/" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The namespace has its own system backend, cubbyhole and token store
+	resp = testNamespaceRequest(t, c, root, logical.ReadOperation, "ns1/sys/mounts", nil)
+	for _, path := range []string{"sys/", "cubbyhole/"} {
+		if _, ok := resp.Data[path]; !ok {
+			t.Fatalf("missing mount %q: %#v", path, resp.Data)
+		}
+	}
+	if _, ok := resp.Data["secret/"]; ok {
+		t.Fatalf("root mount listed within the namespace: %#v", resp.Data)
+	}
+
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "ns1/sys/mounts/kv", map[string]interface{}{
+		"type": "generic",
+	})
+	if match := c.router.MatchingMount("ns1/kv/foo"); match != "ns1/kv/" {
+		t.Fatalf("bad: %q", match)
+	}
+
+	// Policies of the namespace apply to the paths of the namespace
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "ns1/sys/policy/writer", map[string]interface{}{
+		"rules": `path "kv/*" { capabilities = ["create", "update", "read"] }`,
+	})
+	resp = testNamespaceRequest(t, c, root, logical.ListOperation, "ns1/sys/policy", nil)
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"default", "writer"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = testNamespaceRequest(t, c, root, logical.ListOperation, "sys/policy", nil)
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"default", "root"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp = testNamespaceRequest(t, c, root, logical.UpdateOperation, "ns1/auth/token/create", map[string]interface{}{
+		"policies": "writer",
+	})
+	token := resp.Auth.ClientToken
+	te, err := c.tokenStore.Lookup(token)
+	if err != nil || te == nil {
+		t.Fatalf("err: %v entry: %#v", err, te)
+	}
+	if te.NamespaceID == "" || te.Path != "ns1/auth/token/create" {
+		t.Fatalf("bad: %#v", te)
+	}
+
+	testNamespaceRequest(t, c, token, logical.UpdateOperation, "ns1/kv/foo", map[string]interface{}{
+		"bar": "baz",
+	})
+	testNamespaceRequest(t, c, token, logical.ReadOperation, "ns1/kv/foo", nil)
+	testNamespaceRequest(t, c, token, logical.ReadOperation, "ns1/auth/token/lookup-self", nil)
+	for _, path := range []string{"secret/foo", "kv/foo", "ns1/sys/mounts"} {
+		req := logical.TestRequest(t, logical.ReadOperation, path)
+		req.ClientToken = token
+		if _, err := c.HandleRequest(req); err == nil || !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+			t.Fatalf("%s: expected permission denied, got: %v", path, err)
+		}
+	}
+
+	// The root policy cannot be assigned within namespaces
+	req := logical.TestRequest(t, logical.UpdateOperation, "ns1/auth/token/create")
+	req.ClientToken = root
+	req.Data["policies"] = "root"
+	if resp, err := c.HandleRequest(req); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("expected error creating a root token within the namespace")
+	}
+
+	// Only some system paths are available within namespaces
+	req = logical.TestRequest(t, logical.ReadOperation, "ns1/sys/audit")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatal("expected error reading the audit devices within the namespace")
+	}
+
+	// Namespaces can be nested
+	resp = testNamespaceRequest(t, c, root, logical.UpdateOperation, "ns1/sys/namespaces/ns2", nil)
+	if resp.Data["path"] != "ns1/ns2/" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = testNamespaceRequest(t, c, root, logical.ListOperation, "sys/namespaces", nil)
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"ns1/"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = testNamespaceRequest(t, c, root, logical.ListOperation, "ns1/sys/namespaces", nil)
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"ns2/"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Names conflicting with mounts or reserved paths are rejected
+	for _, path := range []string{"sys/namespaces/secret", "sys/namespaces/sys", "ns1/sys/namespaces/kv", "sys/namespaces/ns1"} {
+		req := logical.TestRequest(t, logical.UpdateOperation, path)
+		req.ClientToken = root
+		if resp, err := c.HandleRequest(req); err == nil && (resp == nil || !resp.IsError()) {
+			t.Fatalf("%s: expected error", path)
+		}
+	}
+
+	// Namespaces with child namespaces cannot be deleted
+	req = logical.TestRequest(t, logical.DeleteOperation, "sys/namespaces/ns1")
+	req.ClientToken = root
+	if resp, err := c.HandleRequest(req); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("expected error deleting a namespace with child namespaces")
+	}
+
+	testNamespaceRequest(t, c, root, logical.DeleteOperation, "ns1/sys/namespaces/ns2", nil)
+	testNamespaceRequest(t, c, root, logical.DeleteOperation, "sys/namespaces/ns1", nil)
+
+	// Deleting the namespace revokes its tokens and removes its mounts
+	if te, err := c.tokenStore.Lookup(token); err != nil || te != nil {
+		t.Fatalf("err: %v entry: %#v", err, te)
+	}
+	if match := c.router.MatchingMount("ns1/kv/foo"); match != "" {
+		t.Fatalf("bad: %q", match)
+	}
+	if c.namespaceStore.ByPath("ns1/") != nil {
+		t.Fatal("expected the namespace to be deleted")
+	}
+}
+
+func TestNamespaces_persist(t *testing.T) {
+	c, keys, root := TestCoreUnsealed(t)
+
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/namespaces/ns1", nil)
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "ns1/sys/mounts/kv", map[string]interface{}{
+		"type": "generic",
+	})
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "ns1/kv/foo", map[string]interface{}{
+		"bar": "baz",
+	})
+
+	if err := c.Seal(root); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for i, key := range keys {
+		unseal, err := TestCoreUnseal(c, key)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if i+1 == len(keys) && !unseal {
+			t.Fatal("should be unsealed")
+		}
+	}
+
+	resp := testNamespaceRequest(t, c, root, logical.ReadOperation, "ns1/kv/foo", nil)
+	if resp == nil || resp.Data["bar"] != "baz" {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = testNamespaceRequest(t, c, root, logical.ReadOperation, "sys/namespaces/ns1", nil)
+	if resp.Data["path"] != "ns1/" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
@@ -0,0 +1,99 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/passwordpolicy"
+	"github.com/hashicorp/vault/logical"
+)
+
+var passwordPoliciesPath = "core/password-policies/"
+
+// PasswordPolicyEntry is a stored password policy
+type PasswordPolicyEntry struct {
+	Name string `json:"name"`
+
+	// Policy is the HCL or JSON text of the policy
+	Policy string `json:"policy"`
+}
+
+// PasswordPolicyStore keeps the password policies backends generate
+// passwords from
+type PasswordPolicyStore struct {
+	view *BarrierView
+}
+
+func (c *Core) setupPasswordPolicyStore() error {
+	c.passwordPolicyStore = &PasswordPolicyStore{
+		view: NewBarrierView(c.barrier, passwordPoliciesPath),
+	}
+
+	return nil
+}
+
+// Get retrieves the named password policy, or nil if it does not exist
+func (s *PasswordPolicyStore) Get(name string) (*PasswordPolicyEntry, error) {
+	out, err := s.view.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve password policy %q: %v", name, err)
+	}
+	if out == nil {
+		return nil, nil
+	}
+
+	entry := new(PasswordPolicyEntry)
+	if err := jsonutil.DecodeJSON(out.Value, entry); err != nil {
+		return nil, fmt.Errorf("failed to decode password policy entry: %v", err)
+	}
+	return entry, nil
+}
+
+// Set stores a password policy, which must be valid
+func (s *PasswordPolicyStore) Set(entry *PasswordPolicyEntry) error {
+	if strings.Contains(entry.Name, "..") {
+		return fmt.Errorf("password policy names cannot contain \"..\"")
+	}
+	if _, err := passwordpolicy.Parse(entry.Policy); err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode password policy entry: %v", err)
+	}
+
+	if err := s.view.Put(&logical.StorageEntry{
+		Key:   entry.Name,
+		Value: buf,
+	}); err != nil {
+		return fmt.Errorf("failed to persist password policy entry: %v", err)
+	}
+	return nil
+}
+
+// Delete removes a password policy
+func (s *PasswordPolicyStore) Delete(name string) error {
+	return s.view.Delete(name)
+}
+
+// List returns the names of the password policies
+func (s *PasswordPolicyStore) List() ([]string, error) {
+	return logical.CollectKeys(s.view)
+}
+
+// Policy returns the named password policy. It returns
+// passwordpolicy.ErrNotFound if the policy does not exist.
+func (s *PasswordPolicyStore) Policy(name string) (*passwordpolicy.Policy, error) {
+	entry, err := s.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, passwordpolicy.ErrNotFound
+	}
+
+	return passwordpolicy.Parse(entry.Policy)
+}
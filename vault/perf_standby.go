@@ -0,0 +1,299 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
+)
+
+var (
+	// perfStandbyRefreshInterval is how often a performance standby checks
+	// whether the active node changed the mount tables
+	perfStandbyRefreshInterval = 5 * time.Second
+
+	// perfStandbyTablePaths are the storage paths of the tables which are
+	// loaded in memory by a performance standby. It reloads its state when
+	// one of them changes.
+	perfStandbyTablePaths = []string{
+		coreMountConfigPath,
+		coreLocalMountConfigPath,
+		coreAuthConfigPath,
+		coreLocalAuthConfigPath,
+		coreAuditConfigPath,
+		coreLocalAuditConfigPath,
+		systemBarrierPrefix + "config/cors",
+		systemBarrierPrefix + auditedHeadersSubPath + auditedHeadersEntry,
+	}
+)
+
+// PerfStandby returns whether this node is a performance standby serving the
+// read requests
+func (c *Core) PerfStandby() bool {
+	return atomic.LoadUint32(&c.perfStandby) == 1
+}
+
+// setupPerfStandby loads the mounts, policies, tokens and audit devices so
+// that the standby serves the read requests. The barrier is read-only while
+// the node is a performance standby, and the requests writing to the storage
+// are forwarded to the active node. The stateLock must be held.
+func (c *Core) setupPerfStandby() (retErr error) {
+	// The standbys of DR secondaries don't serve requests
+	conf, err := c.loadReplicationConfig(coreDRReplicationConfigPath)
+	if err != nil {
+		return err
+	}
+	if conf != nil && conf.Mode == replicationModeSecondary {
+		return nil
+	}
+
+	c.logger.Info("core: performance standby setup starting")
+
+	c.barrier.SetReadOnly(true)
+	if cache, ok := c.physical.(physical.ToggleableCache); ok {
+		cache.SetEnabled(false)
+	}
+	atomic.StoreUint32(&c.perfStandby, 1)
+	defer func() {
+		if retErr != nil {
+			c.teardownPerfStandby()
+		}
+	}()
+
+	tables, err := c.perfStandbyTablesDigest()
+	if err != nil {
+		return err
+	}
+	if err := c.setupReplicaState(); err != nil {
+		return err
+	}
+
+	c.perfStandbyTables = tables
+	c.logger.Info("core: performance standby setup complete")
+	return nil
+}
+
+// setupReplicaState loads the mounts, policies, tokens and audit devices
+// without starting the processes writing to the storage, such as the
+// revocation of the expired leases. Performance standbys and replication
+// secondaries use it to serve requests on data written by another node.
+func (c *Core) setupReplicaState() error {
+	if err := c.setupNamespaceStore(); err != nil {
+		return err
+	}
+	if err := c.loadMounts(); err != nil {
+		return err
+	}
+	if err := c.setupMounts(); err != nil {
+		return err
+	}
+	if err := c.setupPolicyStore(); err != nil {
+		return err
+	}
+	if err := c.loadCORSConfig(); err != nil {
+		return err
+	}
+	if err := c.loadESTConfig(); err != nil {
+		return err
+	}
+	if err := c.loadCredentials(); err != nil {
+		return err
+	}
+	if err := c.setupCredentials(); err != nil {
+		return err
+	}
+	c.setupPerfStandbyExpiration()
+	if err := c.loadAudits(); err != nil {
+		return err
+	}
+	if err := c.setupAudits(); err != nil {
+		return err
+	}
+	if err := c.setupAuditedHeadersConfig(); err != nil {
+		return err
+	}
+	if err := c.setupPluginCatalog(); err != nil {
+		return err
+	}
+	if err := c.setupManagedKeyRegistry(); err != nil {
+		return err
+	}
+	if err := c.setupPasswordPolicyStore(); err != nil {
+		return err
+	}
+	if err := c.setupExternalGroupStore(); err != nil {
+		return err
+	}
+	if err := c.setupEntityStore(); err != nil {
+		return err
+	}
+	if err := c.setupRulePolicyStores(); err != nil {
+		return err
+	}
+	if err := c.setupLoginMFAStore(); err != nil {
+		return err
+	}
+	if err := c.setupUserLockoutManager(); err != nil {
+		return err
+	}
+	if err := c.setupQuotaManager(); err != nil {
+		return err
+	}
+	if err := c.setupSecretsSync(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// setupPerfStandbyExpiration creates the expiration manager of a performance
+// standby or a replication secondary. The leases are not restored, since
+// they are revoked by the active node of the primary.
+func (c *Core) setupPerfStandbyExpiration() {
+	c.metricsMutex.Lock()
+	defer c.metricsMutex.Unlock()
+
+	view := c.systemBarrierView.SubView(expirationSubPath)
+	c.expiration = NewExpirationManager(c.router, view, c.tokenStore, c.logger)
+	c.tokenStore.SetExpirationManager(c.expiration)
+}
+
+// teardownPerfStandby is used to reverse setupPerfStandby, before the node
+// becomes active or is sealed. The stateLock must be held.
+func (c *Core) teardownPerfStandby() {
+	if !c.PerfStandby() {
+		return
+	}
+
+	if err := c.preSeal(); err != nil {
+		c.logger.Error("core: performance standby teardown failed", "error", err)
+	}
+	c.perfStandbyTables = nil
+
+	atomic.StoreUint32(&c.perfStandby, 0)
+	c.barrier.SetReadOnly(false)
+	if cache, ok := c.physical.(physical.ToggleableCache); ok {
+		cache.SetEnabled(true)
+	}
+}
+
+// perfStandbyTablesDigest returns a digest of the tables a performance
+// standby loads in memory, and of the namespaces
+func (c *Core) perfStandbyTablesDigest() ([]byte, error) {
+	hash := sha256.New()
+	for _, path := range perfStandbyTablePaths {
+		entry, err := c.barrier.Get(path)
+		if err != nil {
+			return nil, err
+		}
+		hash.Write([]byte(path))
+		if entry != nil {
+			hash.Write(entry.Value)
+		}
+	}
+
+	ids, err := c.barrier.List(coreNamespacesPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		hash.Write([]byte(coreNamespacesPath + id))
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// periodicPerfStandbyRefresh reloads the state of a performance standby when
+// the active node changes its mount tables
+func (c *Core) periodicPerfStandbyRefresh(doneCh, stopCh chan struct{}) {
+	defer close(doneCh)
+	for {
+		select {
+		case <-time.After(perfStandbyRefreshInterval):
+			c.refreshPerfStandby()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// refreshPerfStandby sets up the performance standby again if the tables it
+// loaded changed, or if its previous setup failed
+func (c *Core) refreshPerfStandby() {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	if c.sealed || !c.standby {
+		return
+	}
+
+	if c.PerfStandby() {
+		tables, err := c.perfStandbyTablesDigest()
+		if err != nil {
+			c.logger.Error("core: failed to check the tables of the performance standby", "error", err)
+			return
+		}
+		if bytes.Equal(tables, c.perfStandbyTables) {
+			return
+		}
+		c.logger.Info("core: tables changed on the active node, reloading performance standby")
+		c.teardownPerfStandby()
+	}
+
+	if err := c.setupPerfStandby(); err != nil {
+		c.logger.Error("core: performance standby setup failed", "error", err)
+	}
+}
+
+// checkPerfStandbyRequest returns consts.ErrPerfStandbyPleaseForward when a
+// performance standby cannot serve a request itself. Only reads are served
+// by the standbys, and neither logins nor wrapped responses, which create
+// tokens, nor reads under mounts whose backends may issue leases, which the
+// standby cannot register. The latter are forwarded before reaching the
+// backend, so that no secret is created for a request served elsewhere.
+func (c *Core) checkPerfStandbyRequest(req *logical.Request) error {
+	switch req.Operation {
+	case logical.ReadOperation, logical.ListOperation, logical.HelpOperation:
+	default:
+		return consts.ErrPerfStandbyPleaseForward
+	}
+
+	if c.router.LoginPath(req.Path) {
+		return consts.ErrPerfStandbyPleaseForward
+	}
+	if req.WrapInfo != nil && req.WrapInfo.TTL != 0 {
+		return consts.ErrPerfStandbyPleaseForward
+	}
+	if req.Operation != logical.HelpOperation {
+		leaser, ok := c.router.MatchingBackend(req.Path).(interface {
+			GeneratesLeases() bool
+		})
+		if !ok || leaser.GeneratesLeases() {
+			return consts.ErrPerfStandbyPleaseForward
+		}
+	}
+	return nil
+}
+
+// perfStandbyRevokeSecret revokes a leased secret created by a request
+// served by a performance standby, which cannot register its lease. Such
+// requests are normally forwarded before reaching the backend, this only
+// covers backends which return a lease without declaring it. The request is
+// then forwarded to the active node, so the secret would be left behind
+// otherwise.
+func (c *Core) perfStandbyRevokeSecret(req *logical.Request, resp *logical.Response) {
+	revokeReq := logical.RevokeRequest(req.Path, resp.Secret, resp.Data)
+	if _, err := c.router.Route(revokeReq); err != nil {
+		c.logger.Error("core: failed to revoke a secret created by the performance standby", "request_path", req.Path, "error", err)
+	}
+}
+
+// isPerfStandbyReadOnlyErr returns whether the error is a write to the
+// storage of a performance standby
+func isPerfStandbyReadOnlyErr(err error) bool {
+	return err != nil && errwrap.Contains(err, logical.ErrReadOnly.Error())
+}
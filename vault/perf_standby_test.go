@@ -0,0 +1,167 @@
+package vault
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
+	log "github.com/mgutz/logxi/v1"
+)
+
+func testWaitPerfStandby(t *testing.T, c *Core) {
+	start := time.Now()
+	for time.Now().Sub(start) < 10*time.Second {
+		if c.PerfStandby() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("should be a performance standby")
+}
+
+func TestCore_PerfStandby(t *testing.T) {
+	logger = logformat.NewVaultLogger(log.LevelTrace)
+	inmha := physical.NewInmemHA(logger)
+
+	noop := &NoopBackend{}
+	core, err := NewCore(&CoreConfig{
+		Physical:     inmha,
+		HAPhysical:   inmha,
+		RedirectAddr: "http://127.0.0.1:8200",
+		DisableMlock: true,
+		LogicalBackends: map[string]logical.Factory{
+			"noop": func(*logical.BackendConfig) (logical.Backend, error) {
+				return noop, nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	keys, root := TestCoreInit(t, core)
+	for _, key := range keys {
+		if _, err := TestCoreUnseal(core, TestKeyCopy(key)); err != nil {
+			t.Fatalf("unseal err: %s", err)
+		}
+	}
+	TestWaitActive(t, core)
+
+	testNamespaceRequest(t, core, root, logical.UpdateOperation, "secret/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+
+	noop2 := &NoopBackend{}
+	core2, err := NewCore(&CoreConfig{
+		Physical:           inmha,
+		HAPhysical:         inmha,
+		RedirectAddr:       "http://127.0.0.1:8500",
+		DisableMlock:       true,
+		PerformanceStandby: true,
+		LogicalBackends: map[string]logical.Factory{
+			"noop": func(*logical.BackendConfig) (logical.Backend, error) {
+				return noop2, nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for _, key := range keys {
+		if _, err := TestCoreUnseal(core2, TestKeyCopy(key)); err != nil {
+			t.Fatalf("unseal err: %s", err)
+		}
+	}
+	testWaitPerfStandby(t, core2)
+
+	// Reads are served by the standby
+	resp := testNamespaceRequest(t, core2, root, logical.ReadOperation, "secret/foo", nil)
+	if resp == nil || resp.Data["foo"] != "bar" {
+		t.Fatalf("bad: %#v", resp)
+	}
+	testNamespaceRequest(t, core2, root, logical.ReadOperation, "auth/token/lookup-self", nil)
+
+	// Writes and logins must be forwarded to the active node
+	req := logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.ClientToken = root
+	req.Data["foo"] = "baz"
+	if _, err := core2.HandleRequest(req); err != consts.ErrPerfStandbyPleaseForward {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+	req.ClientToken = root
+	req.WrapInfo = &logical.RequestWrapInfo{
+		TTL: time.Minute,
+	}
+	if _, err := core2.HandleRequest(req); err != consts.ErrPerfStandbyPleaseForward {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Limited-use tokens are forwarded, since using them writes to the storage
+	resp = testNamespaceRequest(t, core, root, logical.UpdateOperation, "auth/token/create", map[string]interface{}{
+		"num_uses": 2,
+	})
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+	req.ClientToken = resp.Auth.ClientToken
+	if _, err := core2.HandleRequest(req); err != consts.ErrPerfStandbyPleaseForward {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The writes of the active node are visible on the standby
+	testNamespaceRequest(t, core, root, logical.UpdateOperation, "secret/foo", map[string]interface{}{
+		"foo": "baz",
+	})
+	resp = testNamespaceRequest(t, core2, root, logical.ReadOperation, "secret/foo", nil)
+	if resp == nil || resp.Data["foo"] != "baz" {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// The standby picks up the mounts of the active node on refresh
+	testNamespaceRequest(t, core, root, logical.UpdateOperation, "sys/mounts/kv", map[string]interface{}{
+		"type": "generic",
+	})
+	testNamespaceRequest(t, core, root, logical.UpdateOperation, "kv/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+	core2.refreshPerfStandby()
+	if !core2.PerfStandby() {
+		t.Fatal("should be a performance standby")
+	}
+	resp = testNamespaceRequest(t, core2, root, logical.ReadOperation, "kv/foo", nil)
+	if resp == nil || resp.Data["foo"] != "bar" {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Reads under mounts whose backends may issue leases are forwarded
+	// before reaching the backend
+	testNamespaceRequest(t, core, root, logical.UpdateOperation, "sys/mounts/noop", map[string]interface{}{
+		"type": "noop",
+	})
+	core2.refreshPerfStandby()
+	req = logical.TestRequest(t, logical.ReadOperation, "noop/foo")
+	req.ClientToken = root
+	if _, err := core2.HandleRequest(req); err != consts.ErrPerfStandbyPleaseForward {
+		t.Fatalf("err: %v", err)
+	}
+	if len(noop2.Requests) != 0 {
+		t.Fatalf("bad: %#v", noop2.Requests)
+	}
+
+	// The standby becomes a regular active node when the active node seals
+	if err := core.Seal(root); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	TestWaitActive(t, core2)
+	if core2.PerfStandby() {
+		t.Fatal("should not be a performance standby")
+	}
+	testNamespaceRequest(t, core2, root, logical.UpdateOperation, "kv/foo", map[string]interface{}{
+		"foo": "baz",
+	})
+	resp = testNamespaceRequest(t, core2, root, logical.ReadOperation, "kv/foo", nil)
+	if resp == nil || resp.Data["foo"] != "baz" {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
@@ -61,6 +61,22 @@ type Policy struct {
 	Raw   string
 }
 
+// withPathPrefix returns a copy of the policy whose rules apply to the paths
+// under the given prefix, such as the path of a namespace
+func (p *Policy) withPathPrefix(prefix string) *Policy {
+	prefixed := &Policy{
+		Name:  p.Name,
+		Paths: make([]*PathCapabilities, len(p.Paths)),
+		Raw:   p.Raw,
+	}
+	for i, pc := range p.Paths {
+		clone := *pc
+		clone.Prefix = prefix + pc.Prefix
+		prefixed.Paths[i] = &clone
+	}
+	return prefixed
+}
+
 // PathCapabilities represents a policy for a path in the namespace.
 type PathCapabilities struct {
 	Prefix       string
@@ -75,6 +91,24 @@ type PathCapabilities struct {
 	MaxWrappingTTLHCL    interface{}              `hcl:"max_wrapping_ttl"`
 	AllowedParametersHCL map[string][]interface{} `hcl:"allowed_parameters"`
 	DeniedParametersHCL  map[string][]interface{} `hcl:"denied_parameters"`
+	ControlGroupHCL      *ControlGroupHCL         `hcl:"control_group"`
+}
+
+// ControlGroupHCL is the control group of a path in the policy syntax
+type ControlGroupHCL struct {
+	TTL     interface{}                       `hcl:"ttl"`
+	Factors map[string]*ControlGroupFactorHCL `hcl:"factor"`
+}
+
+// ControlGroupFactorHCL is a factor of a control group in the policy syntax
+type ControlGroupFactorHCL struct {
+	Identity *ControlGroupIdentityHCL `hcl:"identity"`
+}
+
+// ControlGroupIdentityHCL lists the groups whose members approve a factor
+type ControlGroupIdentityHCL struct {
+	GroupNames []string `hcl:"group_names"`
+	Approvals  int      `hcl:"approvals"`
 }
 
 type Permissions struct {
@@ -83,6 +117,7 @@ type Permissions struct {
 	MaxWrappingTTL     time.Duration
 	AllowedParameters  map[string][]interface{}
 	DeniedParameters   map[string][]interface{}
+	ControlGroup       *ControlGroup
 }
 
 func (p *Permissions) Clone() (*Permissions, error) {
@@ -90,6 +125,7 @@ func (p *Permissions) Clone() (*Permissions, error) {
 		CapabilitiesBitmap: p.CapabilitiesBitmap,
 		MinWrappingTTL:     p.MinWrappingTTL,
 		MaxWrappingTTL:     p.MaxWrappingTTL,
+		ControlGroup:       p.ControlGroup.clone(),
 	}
 
 	switch {
@@ -174,6 +210,7 @@ func parsePaths(result *Policy, list *ast.ObjectList) error {
 			"denied_parameters",
 			"min_wrapping_ttl",
 			"max_wrapping_ttl",
+			"control_group",
 		}
 		if err := checkHCLKeys(item.Val, valid); err != nil {
 			return multierror.Prefix(err, fmt.Sprintf("path %q:", key))
@@ -264,6 +301,13 @@ func parsePaths(result *Policy, list *ast.ObjectList) error {
 			pc.Permissions.MaxWrappingTTL < pc.Permissions.MinWrappingTTL {
 			return errors.New("max_wrapping_ttl cannot be less than min_wrapping_ttl")
 		}
+		if pc.ControlGroupHCL != nil {
+			controlGroup, err := parseControlGroup(pc.ControlGroupHCL)
+			if err != nil {
+				return multierror.Prefix(err, fmt.Sprintf("path %q: control_group:", key))
+			}
+			pc.Permissions.ControlGroup = controlGroup
+		}
 
 	PathFinished:
 		paths = append(paths, &pc)
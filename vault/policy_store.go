@@ -115,6 +115,11 @@ var (
 type PolicyStore struct {
 	view *BarrierView
 	lru  *lru.TwoQueueCache
+
+	// namespacePath is the path of the namespace of the policies, which
+	// prefixes the paths of their rules. It is empty for the root namespace,
+	// which is the only one with a root policy.
+	namespacePath string
 }
 
 // PolicyEntry is used to store a policy by name
@@ -147,7 +152,7 @@ func (c *Core) setupPolicyStore() error {
 	sysView := &dynamicSystemView{core: c}
 	c.policyStore = NewPolicyStore(view, sysView)
 
-	if sysView.ReplicationState() == consts.ReplicationSecondary {
+	if sysView.ReplicationState().HasState(consts.ReplicationSecondary) {
 		// Policies will sync from the primary
 		return nil
 	}
@@ -240,7 +245,7 @@ func (ps *PolicyStore) GetPolicy(name string) (*Policy, error) {
 	}
 
 	// Special case the root policy
-	if name == "root" {
+	if name == "root" && ps.namespacePath == "" {
 		p := &Policy{Name: "root"}
 		if ps.lru != nil {
 			ps.lru.Add(p.Name, p)
@@ -349,6 +354,9 @@ func (ps *PolicyStore) ACL(names ...string) (*ACL, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to get policy '%s': %v", name, err)
 		}
+		if p != nil && ps.namespacePath != "" {
+			p = p.withPathPrefix(ps.namespacePath)
+		}
 		policy = append(policy, p)
 	}
 
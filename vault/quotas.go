@@ -0,0 +1,462 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	quotasPath = "core/quotas/"
+
+	// quotaConfigKey is the storage key of the quota configuration
+	quotaConfigKey = "config"
+
+	quotaTypeRateLimit  = "rate-limit"
+	quotaTypeLeaseCount = "lease-count"
+
+	// rateLimitDefaultInterval is the interval rate limits are counted
+	// over, unless configured on the quota
+	rateLimitDefaultInterval = time.Second
+)
+
+var (
+	// ErrRateLimitQuotaExceeded is returned when a request is rejected by a
+	// rate limit quota
+	ErrRateLimitQuotaExceeded = errors.New("request rate limit quota exceeded")
+
+	// ErrLeaseCountQuotaExceeded is returned when a lease would exceed a
+	// lease count quota
+	ErrLeaseCountQuotaExceeded = logical.CodedError(http.StatusTooManyRequests, "lease count quota exceeded")
+
+	// defaultRateLimitExemptPaths are the paths not subject to rate limit
+	// quotas unless configured otherwise, so that the status of the nodes
+	// can always be checked
+	defaultRateLimitExemptPaths = []string{
+		"sys/health",
+		"sys/leader",
+		"sys/seal-status",
+	}
+)
+
+// QuotaConfig is the configuration common to the quotas
+type QuotaConfig struct {
+	// RateLimitExemptPaths are the request path prefixes not subject to
+	// rate limit quotas
+	RateLimitExemptPaths []string `json:"rate_limit_exempt_paths"`
+
+	// EnableRateLimitAuditLogging enables the audit logging of the requests
+	// rejected by rate limit quotas
+	EnableRateLimitAuditLogging bool `json:"enable_rate_limit_audit_logging"`
+}
+
+// RateLimitQuota limits each client to Rate requests per Interval on the
+// requests of its path. The empty path applies to all the requests, and
+// other paths are namespaces, mounts or request path prefixes. Requests are
+// only subject to the quota with the most specific path applying to them.
+type RateLimitQuota struct {
+	Name     string        `json:"name"`
+	Path     string        `json:"path"`
+	Rate     int           `json:"rate"`
+	Interval time.Duration `json:"interval"`
+}
+
+// LeaseCountQuota caps the number of leases of its path, which is empty for
+// all the leases, or a namespace, mount or request path prefix. Leases are
+// only subject to the quota with the most specific path applying to them.
+type LeaseCountQuota struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	MaxLeases int    `json:"max_leases"`
+}
+
+// rateLimiter keeps a token bucket per client for a rate limit quota
+type rateLimiter struct {
+	quota *RateLimitQuota
+
+	l         sync.Mutex
+	buckets   map[string]*rateLimitBucket
+	lastPurge time.Time
+}
+
+type rateLimitBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// QuotaManager keeps the quotas, which are persisted and loaded in memory
+// along with the state of their limits
+type QuotaManager struct {
+	view *BarrierView
+
+	l           sync.RWMutex
+	config      *QuotaConfig
+	rateLimits  map[string]*rateLimiter
+	leaseCounts map[string]*LeaseCountQuota
+}
+
+func (c *Core) setupQuotaManager() error {
+	m := &QuotaManager{
+		view: NewBarrierView(c.barrier, quotasPath),
+		config: &QuotaConfig{
+			RateLimitExemptPaths: defaultRateLimitExemptPaths,
+		},
+		rateLimits:  make(map[string]*rateLimiter),
+		leaseCounts: make(map[string]*LeaseCountQuota),
+	}
+
+	out, err := m.view.Get(quotaConfigKey)
+	if err != nil {
+		return fmt.Errorf("failed to read quota configuration: %v", err)
+	}
+	if out != nil {
+		if err := jsonutil.DecodeJSON(out.Value, m.config); err != nil {
+			return fmt.Errorf("failed to decode quota configuration: %v", err)
+		}
+	}
+
+	if err := m.load(quotaTypeRateLimit, func(name string, buf []byte) error {
+		quota := new(RateLimitQuota)
+		if err := jsonutil.DecodeJSON(buf, quota); err != nil {
+			return err
+		}
+		m.rateLimits[name] = newRateLimiter(quota)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := m.load(quotaTypeLeaseCount, func(name string, buf []byte) error {
+		quota := new(LeaseCountQuota)
+		if err := jsonutil.DecodeJSON(buf, quota); err != nil {
+			return err
+		}
+		m.leaseCounts[name] = quota
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	c.quotaManager = m
+	return nil
+}
+
+// load decodes the stored quotas of a type
+func (m *QuotaManager) load(kind string, decode func(name string, buf []byte) error) error {
+	names, err := m.view.List(kind + "/")
+	if err != nil {
+		return fmt.Errorf("failed to list %s quotas: %v", kind, err)
+	}
+	for _, name := range names {
+		out, err := m.view.Get(kind + "/" + name)
+		if err != nil {
+			return fmt.Errorf("failed to read %s quota %q: %v", kind, name, err)
+		}
+		if out == nil {
+			continue
+		}
+		if err := decode(name, out.Value); err != nil {
+			return fmt.Errorf("failed to decode %s quota %q: %v", kind, name, err)
+		}
+	}
+	return nil
+}
+
+// Config returns the quota configuration
+func (m *QuotaManager) Config() *QuotaConfig {
+	m.l.RLock()
+	defer m.l.RUnlock()
+	config := *m.config
+	return &config
+}
+
+// SetConfig stores the quota configuration
+func (m *QuotaManager) SetConfig(config *QuotaConfig) error {
+	m.l.Lock()
+	defer m.l.Unlock()
+	if err := m.put(quotaConfigKey, config); err != nil {
+		return err
+	}
+	m.config = config
+	return nil
+}
+
+// RateLimitQuota returns the named rate limit quota, or nil if it does not
+// exist
+func (m *QuotaManager) RateLimitQuota(name string) *RateLimitQuota {
+	m.l.RLock()
+	defer m.l.RUnlock()
+	limiter, ok := m.rateLimits[name]
+	if !ok {
+		return nil
+	}
+	quota := *limiter.quota
+	return &quota
+}
+
+// SetRateLimitQuota stores a rate limit quota. Updating a quota resets the
+// requests counted against it.
+func (m *QuotaManager) SetRateLimitQuota(quota *RateLimitQuota) error {
+	if strings.Contains(quota.Name, "..") {
+		return fmt.Errorf("quota names cannot contain \"..\"")
+	}
+	if quota.Rate <= 0 {
+		return fmt.Errorf("rate must be positive")
+	}
+	if quota.Interval < 0 {
+		return fmt.Errorf("interval cannot be negative")
+	}
+
+	m.l.Lock()
+	defer m.l.Unlock()
+	for name, limiter := range m.rateLimits {
+		if name != quota.Name && limiter.quota.Path == quota.Path {
+			return fmt.Errorf("rate limit quota %q already applies to path %q", name, quota.Path)
+		}
+	}
+	if err := m.put(quotaTypeRateLimit+"/"+quota.Name, quota); err != nil {
+		return err
+	}
+	m.rateLimits[quota.Name] = newRateLimiter(quota)
+	return nil
+}
+
+// DeleteRateLimitQuota removes a rate limit quota
+func (m *QuotaManager) DeleteRateLimitQuota(name string) error {
+	m.l.Lock()
+	defer m.l.Unlock()
+	if err := m.view.Delete(quotaTypeRateLimit + "/" + name); err != nil {
+		return fmt.Errorf("failed to delete rate limit quota: %v", err)
+	}
+	delete(m.rateLimits, name)
+	return nil
+}
+
+// RateLimitQuotas returns the sorted names of the rate limit quotas
+func (m *QuotaManager) RateLimitQuotas() []string {
+	m.l.RLock()
+	defer m.l.RUnlock()
+	names := make([]string, 0, len(m.rateLimits))
+	for name := range m.rateLimits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LeaseCountQuota returns the named lease count quota, or nil if it does not
+// exist
+func (m *QuotaManager) LeaseCountQuota(name string) *LeaseCountQuota {
+	m.l.RLock()
+	defer m.l.RUnlock()
+	quota, ok := m.leaseCounts[name]
+	if !ok {
+		return nil
+	}
+	copied := *quota
+	return &copied
+}
+
+// SetLeaseCountQuota stores a lease count quota. Existing leases are kept
+// when lowering a quota, but no lease can be created until they go below
+// it.
+func (m *QuotaManager) SetLeaseCountQuota(quota *LeaseCountQuota) error {
+	if strings.Contains(quota.Name, "..") {
+		return fmt.Errorf("quota names cannot contain \"..\"")
+	}
+	if quota.MaxLeases <= 0 {
+		return fmt.Errorf("max leases must be positive")
+	}
+
+	m.l.Lock()
+	defer m.l.Unlock()
+	for name, existing := range m.leaseCounts {
+		if name != quota.Name && existing.Path == quota.Path {
+			return fmt.Errorf("lease count quota %q already applies to path %q", name, quota.Path)
+		}
+	}
+	if err := m.put(quotaTypeLeaseCount+"/"+quota.Name, quota); err != nil {
+		return err
+	}
+	m.leaseCounts[quota.Name] = quota
+	return nil
+}
+
+// DeleteLeaseCountQuota removes a lease count quota
+func (m *QuotaManager) DeleteLeaseCountQuota(name string) error {
+	m.l.Lock()
+	defer m.l.Unlock()
+	if err := m.view.Delete(quotaTypeLeaseCount + "/" + name); err != nil {
+		return fmt.Errorf("failed to delete lease count quota: %v", err)
+	}
+	delete(m.leaseCounts, name)
+	return nil
+}
+
+// LeaseCountQuotas returns the sorted names of the lease count quotas
+func (m *QuotaManager) LeaseCountQuotas() []string {
+	m.l.RLock()
+	defer m.l.RUnlock()
+	names := make([]string, 0, len(m.leaseCounts))
+	for name := range m.leaseCounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// leaseCountQuota returns the lease count quota applying to the leases of a
+// path, or nil if there is none
+func (m *QuotaManager) leaseCountQuota(path string) *LeaseCountQuota {
+	m.l.RLock()
+	defer m.l.RUnlock()
+	var match *LeaseCountQuota
+	for _, quota := range m.leaseCounts {
+		if quotaPathMatches(quota.Path, path) && (match == nil || len(quota.Path) > len(match.Path)) {
+			match = quota
+		}
+	}
+	return match
+}
+
+// quotaPathMatches returns whether a request path or lease ID is under the
+// path of a quota. Paths ending with a slash, such as namespaces and mounts,
+// are prefixes, while other paths only match on a path segment boundary, so
+// that "secret/foo" applies to "secret/foo/bar" but not to "secret/foobar".
+func quotaPathMatches(quotaPath, path string) bool {
+	if quotaPath == "" || strings.HasSuffix(quotaPath, "/") {
+		return strings.HasPrefix(path, quotaPath)
+	}
+	return path == quotaPath || strings.HasPrefix(path, quotaPath+"/")
+}
+
+func (m *QuotaManager) put(key string, value interface{}) error {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode quota entry: %v", err)
+	}
+	if err := m.view.Put(&logical.StorageEntry{
+		Key:   key,
+		Value: buf,
+	}); err != nil {
+		return fmt.Errorf("failed to persist quota entry: %v", err)
+	}
+	return nil
+}
+
+// allow counts a request of a client against the rate limit quota applying
+// to its path, and returns whether the request is allowed
+func (m *QuotaManager) allow(path, client string) bool {
+	m.l.RLock()
+	for _, exempt := range m.config.RateLimitExemptPaths {
+		if quotaPathMatches(exempt, path) {
+			m.l.RUnlock()
+			return true
+		}
+	}
+	var match *rateLimiter
+	for _, limiter := range m.rateLimits {
+		if quotaPathMatches(limiter.quota.Path, path) &&
+			(match == nil || len(limiter.quota.Path) > len(match.quota.Path)) {
+			match = limiter
+		}
+	}
+	m.l.RUnlock()
+
+	if match == nil {
+		return true
+	}
+	return match.allow(client, time.Now())
+}
+
+func newRateLimiter(quota *RateLimitQuota) *rateLimiter {
+	return &rateLimiter{
+		quota:   quota,
+		buckets: make(map[string]*rateLimitBucket),
+	}
+}
+
+// allow takes a token from the bucket of a client. Buckets hold up to the
+// rate of the quota, and are refilled at the rate of the quota.
+func (l *rateLimiter) allow(client string, now time.Time) bool {
+	interval := l.quota.Interval
+	if interval == 0 {
+		interval = rateLimitDefaultInterval
+	}
+	capacity := float64(l.quota.Rate)
+
+	l.l.Lock()
+	defer l.l.Unlock()
+
+	// Forget the clients whose buckets have been refilled since their last
+	// request
+	if now.Sub(l.lastPurge) > interval {
+		for key, bucket := range l.buckets {
+			if now.Sub(bucket.last) > interval {
+				delete(l.buckets, key)
+			}
+		}
+		l.lastPurge = now
+	}
+
+	bucket, ok := l.buckets[client]
+	if !ok {
+		bucket = &rateLimitBucket{tokens: capacity}
+		l.buckets[client] = bucket
+	} else {
+		refill := now.Sub(bucket.last).Seconds() * capacity / interval.Seconds()
+		bucket.tokens = math.Min(capacity, bucket.tokens+refill)
+	}
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// ApplyRateLimitQuota counts a request against the rate limit quota applying
+// to it, and returns ErrRateLimitQuotaExceeded if the client of the request
+// exceeded it. Rejected requests are audit logged if configured.
+func (c *Core) ApplyRateLimitQuota(req *logical.Request) error {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+	if c.sealed || c.quotaManager == nil || (c.standby && !c.PerfStandby()) {
+		return nil
+	}
+
+	var client string
+	if req.Connection != nil {
+		client = req.Connection.RemoteAddr
+	}
+	if c.quotaManager.allow(req.Path, client) {
+		return nil
+	}
+
+	if c.logger.IsTrace() {
+		c.logger.Trace("core: request rejected by rate limit quota", "request_path", req.Path, "remote_addr", client)
+	}
+	if c.quotaManager.Config().EnableRateLimitAuditLogging {
+		if err := c.auditBroker.LogRequest(nil, req, c.auditedHeaders, ErrRateLimitQuotaExceeded); err != nil {
+			c.logger.Error("core: failed to audit request", "path", req.Path, "error", err)
+		}
+	}
+	return ErrRateLimitQuotaExceeded
+}
+
+// isLeaseCountQuotaErr returns whether the registration of a lease failed
+// because of a lease count quota, possibly along with the errors of its
+// rollback
+func isLeaseCountQuotaErr(err error) bool {
+	return err != nil && errwrap.Contains(err, ErrLeaseCountQuotaExceeded.Error())
+}
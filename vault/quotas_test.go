@@ -0,0 +1,241 @@
+package vault
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestRateLimitQuota_allow(t *testing.T) {
+	l := newRateLimiter(&RateLimitQuota{Rate: 2, Interval: time.Minute})
+	now := time.Now()
+
+	for i, expected := range []bool{true, true, false} {
+		if l.allow("10.0.0.1", now) != expected {
+			t.Fatalf("bad result for request %d", i)
+		}
+	}
+	if !l.allow("10.0.0.2", now) {
+		t.Fatal("expected the requests of another client to be allowed")
+	}
+
+	// Buckets are refilled at the rate of the quota
+	if !l.allow("10.0.0.1", now.Add(30*time.Second)) || l.allow("10.0.0.1", now.Add(30*time.Second)) {
+		t.Fatal("expected a single request to be allowed after half the interval")
+	}
+	for i := 0; i < 2; i++ {
+		if !l.allow("10.0.0.1", now.Add(time.Hour)) {
+			t.Fatalf("expected request %d to be allowed after the bucket was refilled", i)
+		}
+	}
+}
+
+func TestQuotaPathMatches(t *testing.T) {
+	for _, tc := range []struct {
+		quotaPath, path string
+		expected        bool
+	}{
+		{"", "secret/foo", true},
+		{"secret/", "secret/foo", true},
+		{"secret/", "secretive/foo", false},
+		{"secret/foo", "secret/foo", true},
+		{"secret/foo", "secret/foo/bar", true},
+		{"secret/foo", "secret/foobar", false},
+		{"sys/health", "sys/healthy", false},
+	} {
+		if quotaPathMatches(tc.quotaPath, tc.path) != tc.expected {
+			t.Fatalf("bad result for quota path %q and path %q", tc.quotaPath, tc.path)
+		}
+	}
+}
+
+func TestRateLimitQuota_apply(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	noop := &NoopAudit{}
+	c.auditBackends["noop"] = func(config *audit.BackendConfig) (audit.Backend, error) {
+		noop.Config = config
+		return noop, nil
+	}
+
+	for path, data := range map[string]map[string]interface{}{
+		"sys/audit/noop":               {"type": "noop"},
+		"sys/quotas/config":            {"enable_rate_limit_audit_logging": true},
+		"sys/quotas/rate-limit/global": {"rate": 1, "interval": 3600},
+		"sys/quotas/rate-limit/secret": {"path": "secret", "rate": 2, "interval": 3600},
+	} {
+		req := logical.TestRequest(t, logical.UpdateOperation, path)
+		req.Data = data
+		req.ClientToken = root
+		if resp, err := c.HandleRequest(req); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v resp: %#v", err, resp)
+		}
+	}
+
+	apply := func(path string) error {
+		return c.ApplyRateLimitQuota(&logical.Request{
+			Operation:  logical.ReadOperation,
+			Path:       path,
+			Connection: &logical.Connection{RemoteAddr: "10.0.0.1"},
+		})
+	}
+
+	// Requests are subject to the most specific quota applying to them
+	for i, expected := range []error{nil, nil, ErrRateLimitQuotaExceeded} {
+		if err := apply("secret/foo"); err != expected {
+			t.Fatalf("bad result for request %d: %v", i, err)
+		}
+	}
+	for i, expected := range []error{nil, ErrRateLimitQuotaExceeded} {
+		if err := apply("cubbyhole/foo"); err != expected {
+			t.Fatalf("bad result for request %d: %v", i, err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if err := apply("sys/health"); err != nil {
+			t.Fatalf("expected exempt path to be allowed, got: %v", err)
+		}
+	}
+
+	// Rejected requests are audit logged
+	var rejected int
+	for _, err := range noop.ReqErrs {
+		if err == ErrRateLimitQuotaExceeded {
+			rejected++
+		}
+	}
+	if rejected != 2 {
+		t.Fatalf("expected 2 rejected requests to be audit logged, got %d", rejected)
+	}
+
+	req := logical.TestRequest(t, logical.ReadOperation, "sys/quotas/rate-limit/secret")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["path"] != "secret/" || resp.Data["rate"] != 2 || resp.Data["interval"] != int64(3600) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Quotas must apply to existing namespaces or mounts, each path having a
+	// single quota
+	for name, data := range map[string]map[string]interface{}{
+		"missing":   {"path": "missing/foo", "rate": 1},
+		"duplicate": {"path": "secret/", "rate": 1},
+		"rate":      {"path": "secret/foo"},
+	} {
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/quotas/rate-limit/"+name)
+		req.Data = data
+		req.ClientToken = root
+		if _, err := c.HandleRequest(req); err == nil {
+			t.Fatalf("expected error writing quota %q", name)
+		}
+	}
+}
+
+func TestLeaseCountQuota(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	write := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.UpdateOperation, path)
+		req.Data = data
+		req.ClientToken = root
+		return c.HandleRequest(req)
+	}
+	read := func() (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+		req.ClientToken = root
+		return c.HandleRequest(req)
+	}
+
+	for path, data := range map[string]map[string]interface{}{
+		"secret/foo":                  {"value": "bar", "ttl": "1h"},
+		"sys/quotas/lease-count/kv":   {"path": "secret", "max_leases": 2},
+		"sys/quotas/lease-count/auth": {"path": "auth/token/create", "max_leases": 1},
+	} {
+		if resp, err := write(path, data); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v resp: %#v", err, resp)
+		}
+	}
+
+	// Secrets cannot be leased beyond the quota of their path
+	var leaseID string
+	for i := 0; i < 2; i++ {
+		resp, err := read()
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		leaseID = resp.Secret.LeaseID
+	}
+	if _, err := read(); err != ErrLeaseCountQuotaExceeded {
+		t.Fatalf("expected lease count quota exceeded, got: %v", err)
+	}
+	if _, err := write("sys/revoke/"+leaseID, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := read(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Token leases are subject to the quotas too
+	if _, err := write("auth/token/create", map[string]interface{}{"ttl": "1h"}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := write("auth/token/create", map[string]interface{}{"ttl": "1h"}); err != ErrLeaseCountQuotaExceeded {
+		t.Fatalf("expected lease count quota exceeded, got: %v", err)
+	}
+
+	req := logical.TestRequest(t, logical.ReadOperation, "sys/quotas/lease-count/kv")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["path"] != "secret/" || resp.Data["max_leases"] != 2 || resp.Data["counter"] != 2 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Leases are counted from the storage, whether they were restored or
+	// not
+	c.expiration.pendingLock.Lock()
+	for _, timer := range c.expiration.pending {
+		timer.Stop()
+	}
+	c.expiration.pending = make(map[string]*time.Timer)
+	c.expiration.pendingLock.Unlock()
+	c.expiration.resetQuotaCounts()
+	if _, err := read(); err != ErrLeaseCountQuotaExceeded {
+		t.Fatalf("expected lease count quota exceeded, got: %v", err)
+	}
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["counter"] != 2 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Quotas on paths which are not mounts only apply to whole path segments
+	for path, data := range map[string]map[string]interface{}{
+		"sys/quotas/lease-count/kv":     {"path": "secret", "max_leases": 10},
+		"sys/quotas/lease-count/foo":    {"path": "secret/foo", "max_leases": 2},
+		"secret/foobar":                 {"value": "bar", "ttl": "1h"},
+		"sys/quotas/lease-count/foobar": {"path": "secret/foob", "max_leases": 1},
+	} {
+		if resp, err := write(path, data); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v resp: %#v", err, resp)
+		}
+	}
+	if _, err := read(); err != ErrLeaseCountQuotaExceeded {
+		t.Fatalf("expected lease count quota exceeded, got: %v", err)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/foobar")
+	req.ClientToken = root
+	for i := 0; i < 2; i++ {
+		if _, err := c.HandleRequest(req); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+}
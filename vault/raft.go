@@ -0,0 +1,154 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
+)
+
+var (
+	// ErrRaftStorageNotInUse is returned by the raft operations when the
+	// physical backend is not the raft storage
+	ErrRaftStorageNotInUse = errors.New("raft storage is not in use")
+)
+
+// RaftStorage returns the raft storage of the core, or nil when the
+// physical backend is not the raft storage
+func (c *Core) RaftStorage() *physical.RaftBackend {
+	return c.raftStorage
+}
+
+// JoinRaftCluster adds the node to the raft cluster of the node with the
+// given raft address. Only nodes which are not initialized can join a
+// cluster; they are unsealed with the keys of the cluster once joined.
+func (c *Core) JoinRaftCluster(leaderAddress string, nonVoter bool) error {
+	if c.raftStorage == nil {
+		return ErrRaftStorageNotInUse
+	}
+	if leaderAddress == "" {
+		return fmt.Errorf("leader address must be provided")
+	}
+
+	// Avoid racing with the initialization of the node
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	init, err := c.Initialized()
+	if err != nil {
+		return err
+	}
+	if init || c.raftStorage.Initialized() {
+		return ErrAlreadyInit
+	}
+
+	if err := c.raftStorage.Join(leaderAddress, nonVoter); err != nil {
+		c.logger.Error("core: failed to join raft cluster", "leader_address", leaderAddress, "error", err)
+		return err
+	}
+	return nil
+}
+
+// restoreRaftSnapshot replaces the data of the raft cluster with the data of
+// a snapshot. Unless forced, the snapshot must be encrypted with the current
+// master key. The active node then steps down to reload the restored state;
+// a forced restore seals the node instead, as it must be unsealed with the
+// keys of the snapshot.
+func (c *Core) restoreRaftSnapshot(snapshot []byte, force bool) error {
+	if c.raftStorage == nil {
+		return ErrRaftStorageNotInUse
+	}
+
+	if !force {
+		data, err := physical.SnapshotData(snapshot)
+		if err != nil {
+			return err
+		}
+		keyring, ok := data[keyringPath]
+		if !ok {
+			return fmt.Errorf("snapshot does not hold a keyring")
+		}
+		barrier, ok := c.barrier.(*AESGCMBarrier)
+		if !ok {
+			return fmt.Errorf("unsupported barrier type")
+		}
+		if err := barrier.verifyKeyring(keyring); err != nil {
+			if err == ErrBarrierInvalidKey {
+				return fmt.Errorf("snapshot is not encrypted with the current master key; restore it forcibly and unseal with the keys of the snapshot")
+			}
+			return fmt.Errorf("failed to verify the keyring of the snapshot: %v", err)
+		}
+	}
+
+	if err := c.raftStorage.Restore(snapshot); err != nil {
+		c.logger.Error("core: failed to restore raft snapshot", "error", err)
+		return err
+	}
+	c.logger.Info("core: restored raft snapshot", "force", force)
+
+	// Drop the cached entries of the replaced data
+	if purgable, ok := c.physical.(physical.Purgable); ok {
+		purgable.Purge()
+	}
+
+	// The state lock is held by the request, so reload asynchronously
+	if force || c.ha == nil {
+		go c.Shutdown()
+		return nil
+	}
+	select {
+	case c.manualStepDownCh <- struct{}{}:
+	default:
+		c.logger.Warn("core: manual step-down operation already queued")
+	}
+	return nil
+}
+
+// raftAutopilotConfigPath is the path of the autopilot configuration in the
+// config view of the system barrier view
+const raftAutopilotConfigPath = "raft-autopilot"
+
+// loadRaftAutopilotConfig hands the saved autopilot configuration over to
+// the raft storage. This should only be called with the core state lock held
+// for writing.
+func (c *Core) loadRaftAutopilotConfig() error {
+	if c.raftStorage == nil {
+		return nil
+	}
+
+	view := c.systemBarrierView.SubView("config/")
+	out, err := view.Get(raftAutopilotConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to read raft autopilot config: %v", err)
+	}
+
+	config := physical.DefaultRaftAutopilotConfig()
+	if out != nil {
+		if err := out.DecodeJSON(config); err != nil {
+			return err
+		}
+	}
+	c.raftStorage.SetAutopilotConfig(config)
+	return nil
+}
+
+// saveRaftAutopilotConfig saves the autopilot configuration, and puts it in
+// effect
+func (c *Core) saveRaftAutopilotConfig(config *physical.RaftAutopilotConfig) error {
+	if c.raftStorage == nil {
+		return ErrRaftStorageNotInUse
+	}
+
+	view := c.systemBarrierView.SubView("config/")
+	entry, err := logical.StorageEntryJSON(raftAutopilotConfigPath, config)
+	if err != nil {
+		return fmt.Errorf("failed to create raft autopilot config entry: %v", err)
+	}
+	if err := view.Put(entry); err != nil {
+		return fmt.Errorf("failed to save raft autopilot config: %v", err)
+	}
+
+	c.raftStorage.SetAutopilotConfig(config)
+	return nil
+}
@@ -0,0 +1,343 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/snapshotstore"
+	"github.com/hashicorp/vault/logical"
+)
+
+var raftSnapshotAutoPath = "core/raft-snapshot-auto/"
+
+const (
+	// raftSnapshotAutoDefaultFilePrefix is the default prefix of the names
+	// of the automated snapshots
+	raftSnapshotAutoDefaultFilePrefix = "vault-snapshot"
+
+	// raftSnapshotAutoTimeFormat formats the time of the automated snapshots
+	// in their names, so that sorting the names sorts them by age
+	raftSnapshotAutoTimeFormat = "20060102T150405.000000000Z"
+)
+
+// RaftSnapshotAutoConfig configures the periodic snapshots of the raft
+// storage, and where they are uploaded to
+type RaftSnapshotAutoConfig struct {
+	Name     string        `json:"name"`
+	Interval time.Duration `json:"interval"`
+
+	// Retain is the number of snapshots kept in the storage; older ones are
+	// deleted after each upload
+	Retain int `json:"retain"`
+
+	// PathPrefix is the directory of the snapshots in the storage, and
+	// FilePrefix the beginning of their names
+	PathPrefix string `json:"path_prefix"`
+	FilePrefix string `json:"file_prefix"`
+
+	// StorageType is the snapshotstore provider type, such as "aws-s3"
+	StorageType string `json:"storage_type"`
+
+	// Parameters are passed to the provider to access the storage
+	Parameters map[string]string `json:"parameters"`
+}
+
+// RaftSnapshotAutoStatus is the outcome of the automated snapshots of a
+// configuration since the node became active
+type RaftSnapshotAutoStatus struct {
+	LastSnapshotStart time.Time
+	LastSnapshotEnd   time.Time
+	LastSnapshotName  string
+	LastSnapshotSize  int
+	LastError         string
+	ConsecutiveErrors int
+	NextSnapshotStart time.Time
+}
+
+// RaftSnapshotAutoManager takes the snapshots of the raft storage of the
+// active node periodically, and uploads them to the configured storage
+type RaftSnapshotAutoManager struct {
+	core *Core
+	view *BarrierView
+
+	// lock guards the configuration entries, the runners and the statuses
+	lock sync.Mutex
+
+	// runners holds the channels stopping the goroutine taking the
+	// snapshots of each configuration
+	runners  map[string]chan struct{}
+	statuses map[string]*RaftSnapshotAutoStatus
+
+	// wg tracks the runners, so that sealing waits for uploads in progress
+	wg sync.WaitGroup
+}
+
+// setupRaftSnapshotAuto starts taking the automated snapshots of the saved
+// configurations. Nothing is done when the raft storage is not in use.
+func (c *Core) setupRaftSnapshotAuto() error {
+	if c.raftStorage == nil {
+		return nil
+	}
+
+	m := &RaftSnapshotAutoManager{
+		core:     c,
+		view:     NewBarrierView(c.barrier, raftSnapshotAutoPath),
+		runners:  map[string]chan struct{}{},
+		statuses: map[string]*RaftSnapshotAutoStatus{},
+	}
+
+	names, err := m.view.List("")
+	if err != nil {
+		return fmt.Errorf("failed to list automated snapshot configurations: %v", err)
+	}
+	for _, name := range names {
+		config, err := m.get(name)
+		if err != nil {
+			return err
+		}
+		if config != nil {
+			m.start(config)
+		}
+	}
+
+	c.raftSnapshotAuto = m
+	return nil
+}
+
+// stopRaftSnapshotAuto stops taking the automated snapshots, waiting for the
+// uploads in progress
+func (c *Core) stopRaftSnapshotAuto() {
+	if c.raftSnapshotAuto == nil {
+		return
+	}
+
+	m := c.raftSnapshotAuto
+	m.lock.Lock()
+	for name, stopCh := range m.runners {
+		close(stopCh)
+		delete(m.runners, name)
+	}
+	m.lock.Unlock()
+
+	m.wg.Wait()
+	c.raftSnapshotAuto = nil
+}
+
+// Get returns the named configuration, or nil if it does not exist
+func (m *RaftSnapshotAutoManager) Get(name string) (*RaftSnapshotAutoConfig, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.get(name)
+}
+
+func (m *RaftSnapshotAutoManager) get(name string) (*RaftSnapshotAutoConfig, error) {
+	out, err := m.view.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve automated snapshot configuration %q: %v", name, err)
+	}
+	if out == nil {
+		return nil, nil
+	}
+
+	config := new(RaftSnapshotAutoConfig)
+	if err := jsonutil.DecodeJSON(out.Value, config); err != nil {
+		return nil, fmt.Errorf("failed to decode automated snapshot configuration: %v", err)
+	}
+	return config, nil
+}
+
+// Set saves a configuration, and restarts taking its snapshots
+func (m *RaftSnapshotAutoManager) Set(config *RaftSnapshotAutoConfig) error {
+	if config.Name == "" || strings.Contains(config.Name, "/") {
+		return fmt.Errorf("configuration names must be non-empty and cannot contain \"/\"")
+	}
+	if config.Interval < time.Second {
+		return fmt.Errorf("interval must be at least one second")
+	}
+	if config.Retain < 1 {
+		return fmt.Errorf("retain must be at least 1")
+	}
+	if config.FilePrefix == "" || strings.Contains(config.FilePrefix, "/") {
+		return fmt.Errorf("file_prefix must be non-empty and cannot contain \"/\"")
+	}
+	if err := snapshotstore.ValidateParameters(config.StorageType, config.Parameters); err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to encode automated snapshot configuration: %v", err)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if err := m.view.Put(&logical.StorageEntry{
+		Key:   config.Name,
+		Value: buf,
+	}); err != nil {
+		return fmt.Errorf("failed to persist automated snapshot configuration: %v", err)
+	}
+
+	m.stop(config.Name)
+	m.start(config)
+	return nil
+}
+
+// Delete removes a configuration, and stops taking its snapshots. The
+// snapshots already uploaded are kept.
+func (m *RaftSnapshotAutoManager) Delete(name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.stop(name)
+	delete(m.statuses, name)
+	return m.view.Delete(name)
+}
+
+// List returns the names of the configurations
+func (m *RaftSnapshotAutoManager) List() ([]string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.view.List("")
+}
+
+// Status returns the status of the named configuration, or nil if it does
+// not exist
+func (m *RaftSnapshotAutoManager) Status(name string) *RaftSnapshotAutoStatus {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	status, ok := m.statuses[name]
+	if !ok {
+		return nil
+	}
+	ret := *status
+	return &ret
+}
+
+// start runs the goroutine taking the snapshots of the configuration. This
+// must be called with the lock held.
+func (m *RaftSnapshotAutoManager) start(config *RaftSnapshotAutoConfig) {
+	if _, ok := m.statuses[config.Name]; !ok {
+		m.statuses[config.Name] = &RaftSnapshotAutoStatus{}
+	}
+
+	stopCh := make(chan struct{})
+	m.runners[config.Name] = stopCh
+	m.wg.Add(1)
+	go m.run(config, stopCh)
+}
+
+// stop stops the goroutine taking the snapshots of the named configuration.
+// This must be called with the lock held.
+func (m *RaftSnapshotAutoManager) stop(name string) {
+	if stopCh, ok := m.runners[name]; ok {
+		close(stopCh)
+		delete(m.runners, name)
+	}
+}
+
+func (m *RaftSnapshotAutoManager) run(config *RaftSnapshotAutoConfig, stopCh chan struct{}) {
+	defer m.wg.Done()
+
+	for {
+		m.updateStatus(config.Name, stopCh, func(status *RaftSnapshotAutoStatus) {
+			status.NextSnapshotStart = time.Now().Add(config.Interval)
+		})
+
+		timer := time.NewTimer(config.Interval)
+		select {
+		case <-stopCh:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		start := time.Now()
+		name, size, err := m.snapshot(config, start)
+		m.updateStatus(config.Name, stopCh, func(status *RaftSnapshotAutoStatus) {
+			status.LastSnapshotStart = start
+			status.LastSnapshotEnd = time.Now()
+			if err != nil {
+				status.LastError = err.Error()
+				status.ConsecutiveErrors++
+				return
+			}
+			status.LastSnapshotName = name
+			status.LastSnapshotSize = size
+			status.LastError = ""
+			status.ConsecutiveErrors = 0
+		})
+		if err != nil {
+			m.core.logger.Error("core: failed to take automated raft snapshot", "config", config.Name, "error", err)
+		} else if m.core.logger.IsDebug() {
+			m.core.logger.Debug("core: took automated raft snapshot", "config", config.Name, "snapshot", name)
+		}
+	}
+}
+
+// updateStatus applies the update to the status of the configuration, unless
+// the runner was stopped meanwhile
+func (m *RaftSnapshotAutoManager) updateStatus(name string, stopCh chan struct{}, update func(*RaftSnapshotAutoStatus)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.runners[name] != stopCh {
+		return
+	}
+	update(m.statuses[name])
+}
+
+// snapshot takes a snapshot and uploads it, then deletes the snapshots of
+// the configuration beyond the retained ones. It returns the name and size
+// of the uploaded snapshot.
+func (m *RaftSnapshotAutoManager) snapshot(config *RaftSnapshotAutoConfig, now time.Time) (string, int, error) {
+	store, err := snapshotstore.NewStore(config.StorageType, config.Parameters)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to access the snapshot storage: %v", err)
+	}
+
+	data, err := m.core.raftStorage.Snapshot()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to take snapshot: %v", err)
+	}
+
+	prefix := path.Join(config.PathPrefix, config.FilePrefix) + "-"
+	name := prefix + now.UTC().Format(raftSnapshotAutoTimeFormat) + ".snap"
+	if err := store.Put(name, data); err != nil {
+		return "", 0, fmt.Errorf("failed to upload snapshot %q: %v", name, err)
+	}
+
+	names, err := store.List(prefix)
+	if err != nil {
+		return name, len(data), fmt.Errorf("failed to list snapshots for retention: %v", err)
+	}
+
+	// Only the names with a timestamp belong to the configuration, as
+	// another one may use a longer file prefix starting with this one
+	var snapshots []string
+	for _, n := range names {
+		ts := strings.TrimSuffix(strings.TrimPrefix(n, prefix), ".snap")
+		if _, err := time.Parse(raftSnapshotAutoTimeFormat, ts); err == nil {
+			snapshots = append(snapshots, n)
+		}
+	}
+	sort.Strings(snapshots)
+
+	for len(snapshots) > config.Retain {
+		if err := store.Delete(snapshots[0]); err != nil {
+			return name, len(data), fmt.Errorf("failed to delete snapshot %q: %v", snapshots[0], err)
+		}
+		snapshots = snapshots[1:]
+	}
+	return name, len(data), nil
+}
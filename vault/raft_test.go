@@ -0,0 +1,313 @@
+package vault
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
+	log "github.com/mgutz/logxi/v1"
+)
+
+func testRaftStorage(t *testing.T) (*physical.RaftBackend, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	address := ln.Addr().String()
+	ln.Close()
+
+	path, err := ioutil.TempDir("", "vault-raft")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	b, err := physical.NewRaftBackend(map[string]string{
+		"path":        path,
+		"address":     address,
+		"tls_disable": "true",
+		"ha_enabled":  "false",
+	}, logger)
+	if err != nil {
+		os.RemoveAll(path)
+		t.Fatalf("err: %v", err)
+	}
+	return b, func() {
+		b.Close()
+		os.RemoveAll(path)
+	}
+}
+
+func TestCore_RaftStorage(t *testing.T) {
+	raftStorage, cleanup := testRaftStorage(t)
+	defer cleanup()
+
+	c, keys, root := TestCoreUnsealedBackend(t, raftStorage)
+	if c.RaftStorage() != raftStorage {
+		t.Fatalf("raft storage not detected")
+	}
+	if !raftStorage.Initialized() {
+		t.Fatalf("raft storage should be bootstrapped by the initialization")
+	}
+
+	// Initialized nodes can't join another cluster
+	if err := c.JoinRaftCluster("127.0.0.1:8202", false); err != ErrAlreadyInit {
+		t.Fatalf("err: %v", err)
+	}
+
+	req := logical.TestRequest(t, logical.ReadOperation, "sys/storage/raft/configuration")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := []*physical.RaftServer{
+		{
+			NodeID:  raftStorage.NodeID(),
+			Address: raftStorage.Configuration().Servers[0].Address,
+			Leader:  true,
+			Voter:   true,
+		},
+	}
+	if !reflect.DeepEqual(resp.Data["servers"], expected) {
+		t.Fatalf("bad: %#v", resp.Data["servers"])
+	}
+
+	write := func(value string) {
+		req := logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+		req.Data["value"] = value
+		req.ClientToken = root
+		if _, err := c.HandleRequest(req); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	write("before")
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/storage/raft/snapshot")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data[logical.HTTPContentType] != "application/octet-stream" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	snapshot := resp.Data[logical.HTTPRawBody].([]byte)
+
+	write("after")
+
+	// A snapshot of a vault with other keys can't be restored without force
+	otherStorage, otherCleanup := testRaftStorage(t)
+	defer otherCleanup()
+	TestCoreUnsealedBackend(t, otherStorage)
+	otherSnapshot, err := otherStorage.Snapshot()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/storage/raft/snapshot")
+	req.Data = map[string]interface{}{
+		logical.HTTPRawBody: otherSnapshot,
+	}
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err == nil || !strings.Contains(resp.Data["error"].(string), "master key") {
+		t.Fatalf("err: %v, resp: %#v", err, resp)
+	}
+
+	// Restoring the snapshot rolls the data back, and seals the non-HA node
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/storage/raft/snapshot")
+	req.Data = map[string]interface{}{
+		logical.HTTPRawBody: snapshot,
+	}
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for i := 0; ; i++ {
+		if sealed, _ := c.Sealed(); sealed {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("core should be sealed after the restore")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	for _, key := range keys {
+		if _, err := TestCoreUnseal(c, TestKeyCopy(key)); err != nil {
+			t.Fatalf("unseal err: %v", err)
+		}
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["value"] != "before" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestCore_RaftAutopilot(t *testing.T) {
+	raftStorage, cleanup := testRaftStorage(t)
+	defer cleanup()
+
+	c, _, root := TestCoreUnsealedBackend(t, raftStorage)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/storage/raft/autopilot/configuration")
+	req.Data["cleanup_dead_servers"] = true
+	req.Data["min_quorum"] = 1
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected an error with a minimum quorum below 3")
+	}
+
+	req.Data["min_quorum"] = 3
+	req.Data["dead_server_last_contact_threshold"] = "5m"
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/storage/raft/autopilot/configuration")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := map[string]interface{}{
+		"cleanup_dead_servers":               true,
+		"last_contact_threshold":             "10s",
+		"dead_server_last_contact_threshold": "5m0s",
+		"max_trailing_logs":                  uint64(1000),
+		"min_quorum":                         3,
+		"server_stabilization_time":          "10s",
+	}
+	if !reflect.DeepEqual(resp.Data, expected) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The configuration is restored on unseal
+	raftStorage.SetAutopilotConfig(physical.DefaultRaftAutopilotConfig())
+	c.stateLock.Lock()
+	err = c.loadRaftAutopilotConfig()
+	c.stateLock.Unlock()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if config := raftStorage.AutopilotConfig(); !config.CleanupDeadServers || config.DeadServerLastContactThreshold != 5*time.Minute {
+		t.Fatalf("bad: %#v", config)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/storage/raft/autopilot/state")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["healthy"] != true || resp.Data["leader"] != raftStorage.NodeID() ||
+		!reflect.DeepEqual(resp.Data["voters"], []string{raftStorage.NodeID()}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	server := resp.Data["servers"].(map[string]interface{})[raftStorage.NodeID()].(map[string]interface{})
+	if server["status"] != "leader" || server["healthy"] != true {
+		t.Fatalf("bad: %#v", server)
+	}
+}
+
+func TestCore_RaftSnapshotAuto(t *testing.T) {
+	raftStorage, cleanup := testRaftStorage(t)
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "vault-raft-snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, _, root := TestCoreUnsealedBackend(t, raftStorage)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/storage/raft/snapshot-auto/config/hourly")
+	req.Data["interval"] = "1s"
+	req.Data["retain"] = 2
+	req.Data["path_prefix"] = "backups"
+	req.Data["storage_type"] = "local"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected an error without the path parameter")
+	}
+
+	req.Data["parameters"] = map[string]interface{}{"path": dir}
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/storage/raft/snapshot-auto/config/hourly")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := map[string]interface{}{
+		"interval":     int64(1),
+		"retain":       2,
+		"path_prefix":  "backups",
+		"file_prefix":  "vault-snapshot",
+		"storage_type": "local",
+		"parameters":   map[string]string{"path": dir},
+	}
+	if !reflect.DeepEqual(resp.Data, expected) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Older snapshots are deleted beyond the retained ones
+	time.Sleep(3500 * time.Millisecond)
+	files, err := ioutil.ReadDir(dir + "/backups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 snapshots, got %d", len(files))
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/storage/raft/snapshot-auto/status/hourly")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["last_error"] != "" || resp.Data["consecutive_errors"] != 0 ||
+		resp.Data["last_snapshot_name"] != "backups/"+files[1].Name() {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	snapshot, err := ioutil.ReadFile(dir + "/backups/" + files[1].Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := physical.SnapshotData(snapshot); err != nil {
+		t.Fatalf("bad snapshot: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "sys/storage/raft/snapshot-auto/config/hourly")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.ListOperation, "sys/storage/raft/snapshot-auto/config")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if keys, ok := resp.Data["keys"]; ok && len(keys.([]string)) != 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
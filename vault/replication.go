@@ -0,0 +1,1413 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// coreReplicationPath holds the replication configuration of the cluster.
+	// Like the other paths of replicationLocalPaths, it is never replicated.
+	coreReplicationPath = "core/replication/"
+
+	// coreDRReplicationConfigPath is the configuration of the DR replication
+	coreDRReplicationConfigPath = coreReplicationPath + "dr/config"
+
+	// coreDRSecondariesPath holds the secondaries known by a DR primary
+	coreDRSecondariesPath = coreReplicationPath + "dr/secondaries/"
+
+	// corePerfReplicationConfigPath is the configuration of the performance
+	// replication
+	corePerfReplicationConfigPath = coreReplicationPath + "performance/config"
+
+	// corePerfSecondariesPath holds the secondaries known by a performance
+	// primary
+	corePerfSecondariesPath = coreReplicationPath + "performance/secondaries/"
+
+	replicationModePrimary   = "primary"
+	replicationModeSecondary = "secondary"
+
+	// The states of the secondaries. They stream the WALs of their primary
+	// while they are close enough to it, and reconcile their data with a
+	// merkle sync otherwise.
+	replicationStateIdle       = "idle"
+	replicationStateMerkleSync = "merkle-sync"
+	replicationStateStreamWALs = "stream-wals"
+
+	// replicationMerkleBuckets is the number of leaves of the merkle index
+	replicationMerkleBuckets = 256
+)
+
+var (
+	// replicationSyncInterval is how often the secondaries fetch the WALs of
+	// their primary
+	replicationSyncInterval = time.Second
+
+	// replicationWALSize is the number of WALs kept by a primary. The
+	// secondaries falling further behind reconcile with a merkle sync.
+	replicationWALSize = 16384
+
+	// replicationBatchSize is the maximum number of WALs or merkle buckets
+	// fetched by a secondary in a single request
+	replicationBatchSize = 256
+
+	// replicationLocalPaths are the storage paths which are never replicated.
+	// They hold the keys, the seal and the cluster state of each cluster.
+	replicationLocalPaths = []string{
+		keyringPath,
+		keyringUpgradePrefix,
+		masterKeyPath,
+		barrierSealConfigPath,
+		recoverySealConfigPath,
+		recoveryKeyPath,
+		storedBarrierKeysPath,
+		coreBarrierUnsealKeysBackupPath,
+		coreRecoveryUnsealKeysBackupPath,
+		coreKeyringCanaryPath,
+		coreLockPath,
+		poisonPillPath,
+		coreLeaderPrefix,
+		coreLocalClusterInfoPath,
+		raftSnapshotAutoPath,
+		coreReplicationPath,
+	}
+
+	// perfReplicationLocalPaths are the storage paths which are not
+	// replicated by the performance replication. The tokens, the leases and
+	// the local mounts belong to each cluster.
+	perfReplicationLocalPaths = []string{
+		systemBarrierPrefix + tokenSubPath,
+		systemBarrierPrefix + expirationSubPath,
+		coreLocalMountConfigPath,
+		coreLocalAuthConfigPath,
+		coreLocalAuditConfigPath,
+		coreWrappingJWTKeyPath,
+		lockedUsersPath,
+	}
+
+	// replicationLocalTables maps the mount tables to the storage prefix of
+	// their mounts, to track the mounts which are not replicated: the local
+	// mounts, and the ones of replicationLocalMountTypes
+	replicationLocalTables = map[string]string{
+		coreMountConfigPath:      backendBarrierPrefix,
+		coreLocalMountConfigPath: backendBarrierPrefix,
+		coreLocalAuthConfigPath:  credentialBarrierPrefix,
+		coreLocalAuditConfigPath: auditBarrierPrefix,
+	}
+
+	// replicationLocalMountTypes are the types of the mounts whose data
+	// belongs to each cluster, like the tokens owning the cubbyholes
+	replicationLocalMountTypes = []string{"cubbyhole"}
+)
+
+// replicationConfig is the stored configuration of the replication of the
+// cluster
+type replicationConfig struct {
+	Mode string `json:"mode"`
+
+	// PrimaryClusterID is the cluster ID of the primary of the replication
+	// set
+	PrimaryClusterID string `json:"primary_cluster_id"`
+
+	// The address of the primary and the credentials of a secondary. A
+	// demoted primary has no primary to connect to.
+	PrimaryAPIAddr string `json:"primary_api_addr,omitempty"`
+	SecondaryID    string `json:"secondary_id,omitempty"`
+	Secret         string `json:"secret,omitempty"`
+	CAFile         string `json:"ca_file,omitempty"`
+	CAPath         string `json:"ca_path,omitempty"`
+
+	// FilteredMounts are the UUIDs of the mounts a performance secondary
+	// doesn't receive, because of its paths filter on the primary
+	FilteredMounts []string `json:"filtered_mounts,omitempty"`
+}
+
+// replicationSecondaryEntry is a secondary known by a primary
+type replicationSecondaryEntry struct {
+	ID         string `json:"id"`
+	SecretHash string `json:"secret_hash"`
+
+	// The paths filter of a performance secondary, see
+	// replicationPathsFilter
+	FilterMode  string   `json:"filter_mode,omitempty"`
+	FilterPaths []string `json:"filter_paths,omitempty"`
+}
+
+// replicationActivationToken is given to a secondary to connect it to its
+// primary
+type replicationActivationToken struct {
+	ID               string `json:"id"`
+	Secret           string `json:"secret"`
+	PrimaryAPIAddr   string `json:"primary_api_addr"`
+	PrimaryClusterID string `json:"primary_cluster_id"`
+}
+
+// replicationWALEntry is a replicated write. The value is the current value
+// of the key, rather than the value of the write, which makes applying the
+// entries idempotent.
+type replicationWALEntry struct {
+	Key     string `json:"key"`
+	Value   []byte `json:"value,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// replicationTransport sends the requests of a secondary to its primary
+type replicationTransport interface {
+	Call(op string, data map[string]interface{}) (map[string]interface{}, error)
+}
+
+// replicationAPITransport sends the requests of a secondary to the API of its
+// primary
+type replicationAPITransport struct {
+	client *api.Client
+	prefix string
+}
+
+func newReplicationAPITransport(conf *replicationConfig, prefix string) (*replicationAPITransport, error) {
+	apiConf := api.DefaultConfig()
+	apiConf.Address = conf.PrimaryAPIAddr
+	if conf.CAFile != "" || conf.CAPath != "" {
+		if err := apiConf.ConfigureTLS(&api.TLSConfig{
+			CACert: conf.CAFile,
+			CAPath: conf.CAPath,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := api.NewClient(apiConf)
+	if err != nil {
+		return nil, err
+	}
+	client.ClearToken()
+	client.SetNamespace("")
+
+	return &replicationAPITransport{
+		client: client,
+		prefix: prefix,
+	}, nil
+}
+
+func (t *replicationAPITransport) Call(op string, data map[string]interface{}) (map[string]interface{}, error) {
+	secret, err := t.client.Logical().Write(t.prefix+op, data)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("empty response from the primary")
+	}
+	return secret.Data, nil
+}
+
+// replicationWAL is the log of the keys written on a primary. Only the keys
+// are logged, the secondaries get their current values.
+type replicationWAL struct {
+	// epoch identifies the log, which starts over when the replication is
+	// set up again
+	epoch string
+
+	// keys[i] was written by the WAL of index first+i
+	first uint64
+	keys  []string
+}
+
+func newReplicationWAL() (*replicationWAL, error) {
+	epoch, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	return &replicationWAL{
+		epoch: epoch,
+		first: 1,
+	}, nil
+}
+
+// last returns the index of the last WAL
+func (w *replicationWAL) last() uint64 {
+	return w.first + uint64(len(w.keys)) - 1
+}
+
+func (w *replicationWAL) append(key string) {
+	w.keys = append(w.keys, key)
+	if len(w.keys) > 2*replicationWALSize {
+		drop := len(w.keys) - replicationWALSize
+		w.keys = append([]string(nil), w.keys[drop:]...)
+		w.first += uint64(drop)
+	}
+}
+
+// since returns the keys written after the given WAL, and false if the WALs
+// following it are not kept anymore
+func (w *replicationWAL) since(from uint64, max int) ([]string, uint64, bool) {
+	if from > w.last() || from+1 < w.first {
+		return nil, 0, false
+	}
+
+	keys := w.keys[from+1-w.first:]
+	if len(keys) > max {
+		keys = keys[:max]
+	}
+	return keys, from + uint64(len(keys)), true
+}
+
+// merkleIndex is a two-level merkle tree of the replicated keys and the
+// hashes of their values. The secondaries compare it with the index of their
+// primary to find the keys which are out of sync.
+type merkleIndex struct {
+	l       sync.RWMutex
+	buckets [replicationMerkleBuckets]map[string][sha256.Size]byte
+
+	// touched records the keys written while the index is being built, which
+	// are already up to date
+	touched map[string]struct{}
+}
+
+func newMerkleIndex() *merkleIndex {
+	m := &merkleIndex{}
+	for i := range m.buckets {
+		m.buckets[i] = make(map[string][sha256.Size]byte)
+	}
+	return m
+}
+
+func merkleBucket(key string) int {
+	sum := sha256.Sum256([]byte(key))
+	return int(sum[0]) % replicationMerkleBuckets
+}
+
+func (m *merkleIndex) update(key string, entry *Entry) {
+	m.l.Lock()
+	defer m.l.Unlock()
+	m.updateLocked(key, entry)
+	if m.touched != nil {
+		m.touched[key] = struct{}{}
+	}
+}
+
+func (m *merkleIndex) updateLocked(key string, entry *Entry) {
+	bucket := m.buckets[merkleBucket(key)]
+	if entry == nil {
+		delete(bucket, key)
+		return
+	}
+	bucket[key] = sha256.Sum256(entry.Value)
+}
+
+// bucketHashes returns the hex-encoded hashes of the buckets, restricted to
+// the keys shipped by the filter if not nil
+func (m *merkleIndex) bucketHashes(shipped func(string) bool) []string {
+	m.l.RLock()
+	defer m.l.RUnlock()
+
+	hashes := make([]string, len(m.buckets))
+	for i, bucket := range m.buckets {
+		keys := make([]string, 0, len(bucket))
+		for key := range bucket {
+			if shipped == nil || shipped(key) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		hash := sha256.New()
+		for _, key := range keys {
+			value := bucket[key]
+			hash.Write([]byte(key))
+			hash.Write([]byte{0})
+			hash.Write(value[:])
+		}
+		hashes[i] = hex.EncodeToString(hash.Sum(nil))
+	}
+	return hashes
+}
+
+// merkleRoot returns the root hash of the index from its bucket hashes
+func merkleRoot(hashes []string) string {
+	hash := sha256.New()
+	for _, h := range hashes {
+		hash.Write([]byte(h))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// keys returns the keys of a bucket
+func (m *merkleIndex) keys(bucket int) []string {
+	m.l.RLock()
+	defer m.l.RUnlock()
+
+	keys := make([]string, 0, len(m.buckets[bucket]))
+	for key := range m.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// replicationSet is the in-memory state of a kind of replication of the
+// cluster
+type replicationSet struct {
+	// kind is the name of the replication in the API paths and the logs, and
+	// name the one in the messages
+	kind string
+	name string
+
+	configPath      string
+	secondariesPath string
+	primaryState    consts.ReplicationState
+	secondaryState  consts.ReplicationState
+
+	// localPaths are the storage paths not replicated by the set, besides
+	// replicationLocalPaths
+	localPaths []string
+
+	// localMounts holds the storage prefixes of the local mounts by local
+	// table, which are not replicated if trackLocalMounts is set
+	trackLocalMounts bool
+	localMountsLock  sync.RWMutex
+	localMounts      map[string]map[string]struct{}
+
+	l      sync.RWMutex
+	config *replicationConfig
+
+	// The index of the replicated keys, and the WALs of a primary
+	index *merkleIndex
+	wal   *replicationWAL
+
+	// The progress of a secondary. The remote epoch is empty until the
+	// secondary reconciled its data with a merkle sync.
+	transport     replicationTransport
+	state         string
+	remoteEpoch   string
+	lastRemoteWAL uint64
+	tablesDigest  []byte
+	lastError     string
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+func newDRReplicationSet() *replicationSet {
+	return &replicationSet{
+		kind:            "dr",
+		name:            "DR",
+		configPath:      coreDRReplicationConfigPath,
+		secondariesPath: coreDRSecondariesPath,
+		primaryState:    consts.ReplicationDRPrimary,
+		secondaryState:  consts.ReplicationDRSecondary,
+		state:           replicationStateIdle,
+	}
+}
+
+func newPerfReplicationSet() *replicationSet {
+	return &replicationSet{
+		kind:             "performance",
+		name:             "performance",
+		configPath:       corePerfReplicationConfigPath,
+		secondariesPath:  corePerfSecondariesPath,
+		primaryState:     consts.ReplicationPrimary,
+		secondaryState:   consts.ReplicationSecondary,
+		localPaths:       perfReplicationLocalPaths,
+		trackLocalMounts: true,
+		localMounts:      make(map[string]map[string]struct{}),
+		state:            replicationStateIdle,
+	}
+}
+
+// replicated returns whether a key is replicated by the set
+func (r *replicationSet) replicated(key string) bool {
+	for _, path := range replicationLocalPaths {
+		if strings.HasPrefix(key, path) {
+			return false
+		}
+	}
+	for _, path := range r.localPaths {
+		if strings.HasPrefix(key, path) {
+			return false
+		}
+	}
+
+	if r.trackLocalMounts {
+		prefix := mountStoragePrefix(key)
+		if prefix == "" {
+			return true
+		}
+		r.localMountsLock.RLock()
+		defer r.localMountsLock.RUnlock()
+		for _, prefixes := range r.localMounts {
+			if _, ok := prefixes[prefix]; ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// mountStoragePrefix returns the storage prefix of the mount owning a key,
+// or an empty string if the key doesn't belong to a mount
+func mountStoragePrefix(key string) string {
+	for _, prefix := range []string{backendBarrierPrefix, credentialBarrierPrefix, auditBarrierPrefix} {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		i := strings.Index(key[len(prefix):], "/")
+		if i < 0 {
+			return ""
+		}
+		return key[:len(prefix)+i+1]
+	}
+	return ""
+}
+
+// updateLocalMounts records the storage prefixes of the local mounts of a
+// mount table
+func (r *replicationSet) updateLocalMounts(table string, entry *Entry) {
+	prefixes := make(map[string]struct{})
+	if entry != nil {
+		var mountTable MountTable
+		if err := jsonutil.DecodeJSON(entry.Value, &mountTable); err != nil {
+			return
+		}
+		for _, me := range mountTable.Entries {
+			if !me.Local && !strutil.StrListContains(replicationLocalMountTypes, me.Type) {
+				continue
+			}
+			prefixes[replicationLocalTables[table]+me.UUID+"/"] = struct{}{}
+		}
+	}
+
+	r.localMountsLock.Lock()
+	r.localMounts[table] = prefixes
+	r.localMountsLock.Unlock()
+}
+
+// observe tracks a write through the barrier
+func (r *replicationSet) observe(key string, entry *Entry) {
+	if _, ok := replicationLocalTables[key]; ok && r.trackLocalMounts {
+		r.updateLocalMounts(key, entry)
+	}
+	if !r.replicated(key) {
+		return
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+	if r.index != nil {
+		r.index.update(key, entry)
+	}
+	if r.wal != nil {
+		r.wal.append(key)
+	}
+}
+
+// internalPrefix is the path of the endpoints the secondaries use to fetch
+// the data of their primary
+func (r *replicationSet) internalPrefix() string {
+	return "sys/replication/" + r.kind + "/internal/"
+}
+
+// replicationSets returns the replication sets of the cluster
+func (c *Core) replicationSets() []*replicationSet {
+	return []*replicationSet{c.perfReplication, c.drReplication}
+}
+
+// replicationObserve tracks the writes through the barrier for all the
+// replication sets
+func (c *Core) replicationObserve(key string, entry *Entry) {
+	for _, r := range c.replicationSets() {
+		r.observe(key, entry)
+	}
+}
+
+// loadReplicationConfig reads the configuration of a replication set
+func (c *Core) loadReplicationConfig(path string) (*replicationConfig, error) {
+	entry, err := c.barrier.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var conf replicationConfig
+	if err := jsonutil.DecodeJSON(entry.Value, &conf); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
+
+// persistReplicationConfig stores the configuration of a replication set,
+// deleting it if nil
+func (c *Core) persistReplicationConfig(r *replicationSet, conf *replicationConfig) error {
+	if conf == nil {
+		return c.barrier.Delete(r.configPath)
+	}
+
+	value, err := jsonutil.EncodeJSON(conf)
+	if err != nil {
+		return err
+	}
+	return c.barrier.Put(&Entry{
+		Key:   r.configPath,
+		Value: value,
+	})
+}
+
+// loadReplicationState loads the replication configurations and sets the
+// replication state of the cluster accordingly
+func (c *Core) loadReplicationState() error {
+	for _, r := range c.replicationSets() {
+		if err := c.loadReplicationSetState(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Core) loadReplicationSetState(r *replicationSet) error {
+	conf, err := c.loadReplicationConfig(r.configPath)
+	if err != nil {
+		return err
+	}
+
+	var transport replicationTransport
+	if conf != nil && conf.Mode == replicationModeSecondary && conf.PrimaryAPIAddr != "" {
+		if transport, err = c.newReplicationTransport(conf, r.internalPrefix()); err != nil {
+			return err
+		}
+	}
+
+	r.l.Lock()
+	if conf == nil || r.config == nil || conf.PrimaryAPIAddr != r.config.PrimaryAPIAddr || conf.SecondaryID != r.config.SecondaryID {
+		r.remoteEpoch = ""
+		r.lastRemoteWAL = 0
+	}
+	r.config = conf
+	r.transport = transport
+	r.l.Unlock()
+
+	c.clusterParamsLock.Lock()
+	c.replicationState.ClearState(r.primaryState | r.secondaryState)
+	if conf != nil {
+		switch conf.Mode {
+		case replicationModePrimary:
+			c.replicationState.AddState(r.primaryState)
+		case replicationModeSecondary:
+			c.replicationState.AddState(r.secondaryState)
+		}
+	}
+	c.clusterParamsLock.Unlock()
+
+	return nil
+}
+
+// newReplicationTransport returns the transport a secondary uses to reach
+// its primary. It's a field of the core so that tests can replace it.
+func (c *Core) newReplicationTransport(conf *replicationConfig, prefix string) (replicationTransport, error) {
+	if c.replicationTransportFactory != nil {
+		return c.replicationTransportFactory(conf, prefix)
+	}
+	return newReplicationAPITransport(conf, prefix)
+}
+
+// startReplicationImpl starts the replication of the primaries once the
+// cluster is set up
+func startReplicationImpl(c *Core) error {
+	for _, r := range c.replicationSets() {
+		if err := c.startReplicationSet(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startReplicationSet starts logging the writes of a primary
+func (c *Core) startReplicationSet(r *replicationSet) error {
+	if !c.ReplicationState().HasState(r.primaryState) {
+		return nil
+	}
+
+	wal, err := newReplicationWAL()
+	if err != nil {
+		return err
+	}
+	r.l.Lock()
+	r.wal = wal
+	r.l.Unlock()
+
+	if err := c.replicationReindex(r); err != nil {
+		return err
+	}
+	c.logger.Info("replication: started replication as a primary", "kind", r.kind)
+	return nil
+}
+
+// startReplicationSecondaries starts keeping the secondaries in sync with
+// their primary once the cluster is set up. The DR secondaries are set up by
+// postUnsealDRSecondary instead.
+func (c *Core) startReplicationSecondaries() error {
+	for _, r := range c.replicationSets() {
+		if !c.ReplicationState().HasState(r.secondaryState) {
+			continue
+		}
+		tables, err := c.perfStandbyTablesDigest()
+		if err != nil {
+			return err
+		}
+		if err := c.replicationReindex(r); err != nil {
+			return err
+		}
+		c.startReplicationSync(r, tables)
+		c.logger.Info("replication: started replication as a secondary", "kind", r.kind)
+	}
+	return nil
+}
+
+// startReplicationSync starts keeping a secondary in sync with its primary
+func (c *Core) startReplicationSync(r *replicationSet, tables []byte) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	r.tablesDigest = tables
+	r.stopCh = make(chan struct{})
+	r.doneCh = make(chan struct{})
+	go c.replicationSecondarySync(r, r.stopCh, r.doneCh)
+}
+
+// stopReplicationImpl stops the replication before the cluster is torn down
+func stopReplicationImpl(c *Core) error {
+	for _, r := range c.replicationSets() {
+		c.stopReplicationSet(r)
+	}
+	c.barrier.SetWriteObserver(nil)
+	return nil
+}
+
+func (c *Core) stopReplicationSet(r *replicationSet) {
+	r.l.Lock()
+	stopCh, doneCh := r.stopCh, r.doneCh
+	r.stopCh, r.doneCh = nil, nil
+	r.l.Unlock()
+	if stopCh != nil {
+		close(stopCh)
+		<-doneCh
+	}
+
+	r.l.Lock()
+	r.index = nil
+	r.wal = nil
+	r.state = replicationStateIdle
+	r.l.Unlock()
+
+	c.clusterParamsLock.Lock()
+	c.replicationState.ClearState(r.primaryState | r.secondaryState)
+	c.clusterParamsLock.Unlock()
+}
+
+// replicationReindex builds the merkle index of a replication set from the
+// storage. The writes made meanwhile update the new index, and are not
+// overwritten by the values read before them.
+func (c *Core) replicationReindex(r *replicationSet) error {
+	index := newMerkleIndex()
+	index.touched = make(map[string]struct{})
+
+	r.l.Lock()
+	r.index = index
+	r.l.Unlock()
+	c.barrier.SetWriteObserver(c.replicationObserve)
+
+	if r.trackLocalMounts {
+		for table := range replicationLocalTables {
+			entry, err := c.barrier.Get(table)
+			if err != nil {
+				return err
+			}
+			r.updateLocalMounts(table, entry)
+		}
+	}
+
+	keys, err := logical.CollectKeys(NewBarrierView(c.barrier, ""))
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if !r.replicated(key) {
+			continue
+		}
+		entry, err := c.barrier.Get(key)
+		if err != nil {
+			return err
+		}
+
+		index.l.Lock()
+		if _, ok := index.touched[key]; !ok {
+			index.updateLocked(key, entry)
+		}
+		index.l.Unlock()
+	}
+
+	index.l.Lock()
+	index.touched = nil
+	index.l.Unlock()
+
+	c.logger.Debug("replication: reindexed the storage", "kind", r.kind, "keys", len(keys))
+	return nil
+}
+
+// postUnsealDRSecondary sets up a DR secondary. It doesn't serve requests
+// besides the replication ones, and loads the state of the cluster only to
+// authenticate them.
+func (c *Core) postUnsealDRSecondary() error {
+	r := c.drReplication
+
+	if err := c.setupReplicaState(); err != nil {
+		return err
+	}
+	tables, err := c.perfStandbyTablesDigest()
+	if err != nil {
+		return err
+	}
+	if err := c.replicationReindex(r); err != nil {
+		return err
+	}
+	c.startReplicationSync(r, tables)
+
+	if c.ha != nil {
+		if err := c.startClusterListener(); err != nil {
+			return err
+		}
+	}
+	c.logger.Info("core: post-unseal setup complete, running as a replication secondary", "kind", r.kind)
+	return nil
+}
+
+// reloadReplication sets up the cluster again after its replication mode
+// changed. It runs after the request changing the mode, which holds the
+// state lock.
+func (c *Core) reloadReplication() {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	if c.sealed || c.standby {
+		return
+	}
+
+	c.logger.Info("replication: reloading the cluster after a replication change")
+	if err := c.preSeal(); err != nil {
+		c.logger.Error("replication: failed to tear down the cluster", "error", err)
+	}
+	if err := c.postUnseal(); err != nil {
+		c.logger.Error("replication: failed to set up the cluster", "error", err)
+	}
+}
+
+// refreshReplicaState reloads the state of a secondary when the replicated
+// tables changed. Like reloadReplication, it doesn't run on the goroutine
+// syncing the secondary, which is stopped by the reload.
+func (c *Core) refreshReplicaState(r *replicationSet) {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	if c.sealed || c.standby || !c.ReplicationState().HasState(r.secondaryState) {
+		return
+	}
+
+	c.logger.Info("replication: tables changed on the primary, reloading the secondary", "kind", r.kind)
+	if err := c.preSeal(); err != nil {
+		c.logger.Error("replication: failed to tear down the secondary", "error", err)
+	}
+	if err := c.postUnseal(); err != nil {
+		c.logger.Error("replication: failed to set up the secondary", "error", err)
+	}
+}
+
+// replicationSecondarySync keeps a secondary in sync with its primary
+func (c *Core) replicationSecondarySync(r *replicationSet, stopCh, doneCh chan struct{}) {
+	defer close(doneCh)
+	for {
+		select {
+		case <-time.After(replicationSyncInterval):
+		case <-stopCh:
+			return
+		}
+
+		reload, err := c.replicationSyncOnce(r)
+		if err != nil {
+			c.logger.Warn("replication: failed to sync with the primary", "kind", r.kind, "error", err)
+			r.l.Lock()
+			r.state = replicationStateIdle
+			r.lastError = err.Error()
+			r.l.Unlock()
+			continue
+		}
+		if reload {
+			go c.refreshReplicaState(r)
+			return
+		}
+	}
+}
+
+// replicationSyncOnce fetches the new WALs of the primary, after
+// reconciling with a merkle sync if needed. It returns whether the state of
+// the secondary must be reloaded.
+func (c *Core) replicationSyncOnce(r *replicationSet) (bool, error) {
+	r.l.RLock()
+	transport, conf := r.transport, r.config
+	epoch, last := r.remoteEpoch, r.lastRemoteWAL
+	r.l.RUnlock()
+	if transport == nil || conf == nil {
+		return false, nil
+	}
+	auth := map[string]interface{}{
+		"id":     conf.SecondaryID,
+		"secret": conf.Secret,
+	}
+
+	merkleSynced := false
+	if epoch == "" {
+		r.l.Lock()
+		r.state = replicationStateMerkleSync
+		r.l.Unlock()
+
+		var err error
+		if epoch, last, err = c.replicationMerkleSync(r, transport, auth); err != nil {
+			return false, err
+		}
+		merkleSynced = true
+	}
+
+	r.l.Lock()
+	r.state = replicationStateStreamWALs
+	r.remoteEpoch, r.lastRemoteWAL = epoch, last
+	r.lastError = ""
+	r.l.Unlock()
+
+	for {
+		data := map[string]interface{}{
+			"epoch": epoch,
+			"from":  last,
+		}
+		for k, v := range auth {
+			data[k] = v
+		}
+		raw, err := transport.Call("wal", data)
+		if err != nil {
+			return false, err
+		}
+
+		var resp struct {
+			Reset          bool                   `json:"reset"`
+			Last           uint64                 `json:"last"`
+			Entries        []*replicationWALEntry `json:"entries"`
+			FilteredMounts []string               `json:"filtered_mounts"`
+		}
+		if err := replicationDecode(raw, &resp); err != nil {
+			return false, err
+		}
+		if resp.Reset {
+			c.logger.Info("replication: WALs of the primary not available, reconciling with a merkle sync", "kind", r.kind)
+			r.l.Lock()
+			r.remoteEpoch, r.lastRemoteWAL = "", 0
+			r.l.Unlock()
+			return false, nil
+		}
+
+		// The data of the mounts added to or removed from the filter is
+		// reconciled with a merkle sync
+		changed, err := c.replicationUpdateFilteredMounts(r, resp.FilteredMounts)
+		if err != nil {
+			return false, err
+		}
+		if changed {
+			c.logger.Info("replication: paths filter changed on the primary, reconciling with a merkle sync", "kind", r.kind)
+			r.l.Lock()
+			r.remoteEpoch, r.lastRemoteWAL = "", 0
+			r.l.Unlock()
+			return false, nil
+		}
+
+		if err := c.replicationApply(r, resp.Entries); err != nil {
+			return false, err
+		}
+		last = resp.Last
+
+		r.l.Lock()
+		r.lastRemoteWAL = last
+		r.l.Unlock()
+
+		if len(resp.Entries) < replicationBatchSize {
+			break
+		}
+	}
+
+	tables, err := c.perfStandbyTablesDigest()
+	if err != nil {
+		return false, err
+	}
+	r.l.RLock()
+	changed := string(tables) != string(r.tablesDigest)
+	r.l.RUnlock()
+
+	return merkleSynced || changed, nil
+}
+
+// replicationMerkleSync reconciles the data of a secondary with its primary,
+// fetching the keys of the merkle buckets which differ. It returns the WAL
+// epoch and index of the primary to stream from next.
+func (c *Core) replicationMerkleSync(r *replicationSet, transport replicationTransport, auth map[string]interface{}) (string, uint64, error) {
+	raw, err := transport.Call("merkle", auth)
+	if err != nil {
+		return "", 0, err
+	}
+	var resp struct {
+		Epoch          string   `json:"epoch"`
+		Last           uint64   `json:"last"`
+		Buckets        []string `json:"buckets"`
+		FilteredMounts []string `json:"filtered_mounts"`
+	}
+	if err := replicationDecode(raw, &resp); err != nil {
+		return "", 0, err
+	}
+	if _, err := c.replicationUpdateFilteredMounts(r, resp.FilteredMounts); err != nil {
+		return "", 0, err
+	}
+
+	r.l.RLock()
+	index := r.index
+	r.l.RUnlock()
+	if index == nil {
+		return "", 0, fmt.Errorf("replication index not available")
+	}
+
+	local := index.bucketHashes(nil)
+	if len(resp.Buckets) != len(local) {
+		return "", 0, fmt.Errorf("unexpected number of merkle buckets from the primary: %d", len(resp.Buckets))
+	}
+	var diff []int
+	for i, hash := range resp.Buckets {
+		if hash != local[i] {
+			diff = append(diff, i)
+		}
+	}
+	c.logger.Info("replication: merkle sync with the primary", "kind", r.kind, "buckets_out_of_sync", len(diff))
+
+	for len(diff) > 0 {
+		buckets := diff
+		if len(buckets) > replicationBatchSize {
+			buckets = buckets[:replicationBatchSize]
+		}
+		diff = diff[len(buckets):]
+
+		indexes := make([]string, len(buckets))
+		for i, bucket := range buckets {
+			indexes[i] = strconv.Itoa(bucket)
+		}
+		data := map[string]interface{}{
+			"buckets": strings.Join(indexes, ","),
+		}
+		for k, v := range auth {
+			data[k] = v
+		}
+		raw, err := transport.Call("buckets", data)
+		if err != nil {
+			return "", 0, err
+		}
+		var bucketsResp struct {
+			Entries []*replicationWALEntry `json:"entries"`
+		}
+		if err := replicationDecode(raw, &bucketsResp); err != nil {
+			return "", 0, err
+		}
+
+		// Delete the keys which aren't on the primary anymore
+		remote := make(map[string]struct{}, len(bucketsResp.Entries))
+		for _, entry := range bucketsResp.Entries {
+			remote[entry.Key] = struct{}{}
+		}
+		entries := bucketsResp.Entries
+		for _, bucket := range buckets {
+			for _, key := range index.keys(bucket) {
+				if _, ok := remote[key]; !ok {
+					entries = append(entries, &replicationWALEntry{
+						Key:     key,
+						Deleted: true,
+					})
+				}
+			}
+		}
+
+		if err := c.replicationApply(r, entries); err != nil {
+			return "", 0, err
+		}
+	}
+
+	return resp.Epoch, resp.Last, nil
+}
+
+// replicationApply writes the replicated entries on a secondary
+func (c *Core) replicationApply(r *replicationSet, entries []*replicationWALEntry) error {
+	for _, entry := range entries {
+		if !r.replicated(entry.Key) {
+			continue
+		}
+		if entry.Deleted {
+			if err := c.barrier.Delete(entry.Key); err != nil {
+				return err
+			}
+		} else if err := c.barrier.Put(&Entry{
+			Key:   entry.Key,
+			Value: entry.Value,
+		}); err != nil {
+			return err
+		}
+		c.replicationInvalidate(entry.Key)
+	}
+	return nil
+}
+
+// replicationInvalidate clears the caches of a replicated key, such as the
+// ones of the policies and of the backend owning the key
+func (c *Core) replicationInvalidate(key string) {
+	switch {
+	case strings.HasPrefix(key, systemBarrierPrefix+policySubPath):
+		// The system backend invalidates the policies under the state lock,
+		// which is held while the sync of the secondary is stopped
+		c.policyStore.invalidate(strings.TrimPrefix(key, systemBarrierPrefix+policySubPath))
+
+	case strings.HasPrefix(key, namespaceBarrierPrefix):
+		parts := strings.SplitN(strings.TrimPrefix(key, namespaceBarrierPrefix), "/", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[1], policySubPath) {
+			return
+		}
+		s := c.namespaceStore
+		s.l.Lock()
+		stores := s.stores[parts[0]]
+		s.l.Unlock()
+		if stores != nil {
+			stores.policies.invalidate(strings.TrimPrefix(parts[1], policySubPath))
+		}
+
+	default:
+		backend, entry, prefix, ok := c.router.MatchingStorageBackend(key)
+		if ok && entry.Type != "system" {
+			backend.InvalidateKey(strings.TrimPrefix(key, prefix))
+		}
+	}
+}
+
+// replicationDecode decodes the response of a primary, which is the raw
+// response data with the in-memory transport or decoded JSON with the API
+func replicationDecode(data map[string]interface{}, out interface{}) error {
+	raw, err := jsonutil.EncodeJSON(data)
+	if err != nil {
+		return err
+	}
+	return jsonutil.DecodeJSON(raw, out)
+}
+
+// replicationEntries returns the current values of the given keys
+func (c *Core) replicationEntries(keys []string) ([]*replicationWALEntry, error) {
+	seen := make(map[string]struct{}, len(keys))
+	entries := make([]*replicationWALEntry, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		entry, err := c.barrier.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			entries = append(entries, &replicationWALEntry{
+				Key:     key,
+				Deleted: true,
+			})
+			continue
+		}
+		entries = append(entries, &replicationWALEntry{
+			Key:   key,
+			Value: entry.Value,
+		})
+	}
+	return entries, nil
+}
+
+// generateReplicationActivationToken registers a secondary on a primary and
+// returns the token activating it
+func (c *Core) generateReplicationActivationToken(r *replicationSet, id string) (string, error) {
+	r.l.RLock()
+	conf := r.config
+	r.l.RUnlock()
+	if conf == nil || conf.Mode != replicationModePrimary {
+		return "", fmt.Errorf("%s replication is not enabled as a primary", r.name)
+	}
+
+	secret, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+	// The paths filter of the secondary is kept when its token is generated
+	// again
+	secondary, err := c.replicationSecondary(r, id)
+	if err != nil {
+		return "", err
+	}
+	if secondary == nil {
+		secondary = &replicationSecondaryEntry{
+			ID: id,
+		}
+	}
+	secretHash := sha256.Sum256([]byte(secret))
+	secondary.SecretHash = hex.EncodeToString(secretHash[:])
+	if err := c.persistReplicationSecondary(r, secondary); err != nil {
+		return "", err
+	}
+
+	_, redirectAddr, err := c.Leader()
+	if err != nil && err != ErrHANotEnabled {
+		return "", err
+	}
+	if redirectAddr == "" {
+		redirectAddr = c.redirectAddr
+	}
+
+	token, err := jsonutil.EncodeJSON(&replicationActivationToken{
+		ID:               id,
+		Secret:           secret,
+		PrimaryAPIAddr:   redirectAddr,
+		PrimaryClusterID: conf.PrimaryClusterID,
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// parseReplicationActivationToken decodes the token activating a secondary
+func parseReplicationActivationToken(token string) (*replicationActivationToken, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(token))
+	if err != nil {
+		return nil, fmt.Errorf("invalid activation token")
+	}
+	var result replicationActivationToken
+	if err := jsonutil.DecodeJSON(raw, &result); err != nil {
+		return nil, fmt.Errorf("invalid activation token")
+	}
+	if result.ID == "" || result.Secret == "" {
+		return nil, fmt.Errorf("invalid activation token")
+	}
+	return &result, nil
+}
+
+// checkReplicationSecondary authenticates a secondary on a primary
+func (c *Core) checkReplicationSecondary(r *replicationSet, id, secret string) (*replicationSecondaryEntry, error) {
+	if !c.ReplicationState().HasState(r.primaryState) {
+		return nil, fmt.Errorf("%s replication is not enabled as a primary", r.name)
+	}
+	if id == "" || secret == "" {
+		return nil, logical.ErrPermissionDenied
+	}
+
+	secondary, err := c.replicationSecondary(r, id)
+	if err != nil {
+		return nil, err
+	}
+	if secondary == nil {
+		return nil, logical.ErrPermissionDenied
+	}
+
+	secretHash := sha256.Sum256([]byte(secret))
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(secretHash[:])), []byte(secondary.SecretHash)) != 1 {
+		return nil, logical.ErrPermissionDenied
+	}
+	return secondary, nil
+}
+
+// replicationSecondary returns a secondary known by a primary
+func (c *Core) replicationSecondary(r *replicationSet, id string) (*replicationSecondaryEntry, error) {
+	entry, err := c.barrier.Get(r.secondariesPath + id)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var secondary replicationSecondaryEntry
+	if err := jsonutil.DecodeJSON(entry.Value, &secondary); err != nil {
+		return nil, err
+	}
+	return &secondary, nil
+}
+
+// persistReplicationSecondary stores a secondary known by a primary
+func (c *Core) persistReplicationSecondary(r *replicationSet, secondary *replicationSecondaryEntry) error {
+	value, err := jsonutil.EncodeJSON(secondary)
+	if err != nil {
+		return err
+	}
+	return c.barrier.Put(&Entry{
+		Key:   r.secondariesPath + secondary.ID,
+		Value: value,
+	})
+}
+
+// replicationStatus returns the status of a replication set
+func (c *Core) replicationStatus(r *replicationSet) map[string]interface{} {
+	state := c.ReplicationState()
+	status := map[string]interface{}{
+		"mode": "disabled",
+	}
+
+	r.l.RLock()
+	defer r.l.RUnlock()
+	if r.config == nil {
+		return status
+	}
+	status["mode"] = r.config.Mode
+	status["cluster_id"] = r.config.PrimaryClusterID
+	if r.index != nil {
+		status["merkle_root"] = merkleRoot(r.index.bucketHashes(nil))
+	}
+
+	switch {
+	case state.HasState(r.primaryState):
+		var lastWAL uint64
+		if r.wal != nil {
+			lastWAL = r.wal.last()
+		}
+		status["last_wal"] = lastWAL
+
+		secondaries, err := c.barrier.List(r.secondariesPath)
+		if err != nil {
+			c.logger.Error("replication: failed to list the secondaries", "kind", r.kind, "error", err)
+		}
+		if secondaries == nil {
+			secondaries = []string{}
+		}
+		status["known_secondaries"] = secondaries
+
+	case state.HasState(r.secondaryState):
+		status["primary_api_addr"] = r.config.PrimaryAPIAddr
+		status["state"] = r.state
+		status["last_remote_wal"] = r.lastRemoteWAL
+		status["last_error"] = r.lastError
+	}
+	return status
+}
+
+// replicationWALsSince returns the entries written on a primary after the
+// given WAL which are shipped to the secondary, and false if the secondary
+// must reconcile with a merkle sync
+func (c *Core) replicationWALsSince(r *replicationSet, epoch string, from uint64, shipped func(string) bool) ([]*replicationWALEntry, uint64, bool, error) {
+	r.l.RLock()
+	wal := r.wal
+	if wal == nil {
+		r.l.RUnlock()
+		return nil, 0, false, fmt.Errorf("replication WALs not available")
+	}
+	if epoch != wal.epoch {
+		r.l.RUnlock()
+		return nil, 0, false, nil
+	}
+	walKeys, last, ok := wal.since(from, replicationBatchSize)
+	var keys []string
+	for _, key := range walKeys {
+		if shipped(key) {
+			keys = append(keys, key)
+		}
+	}
+	r.l.RUnlock()
+	if !ok {
+		return nil, 0, false, nil
+	}
+
+	entries, err := c.replicationEntries(keys)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	return entries, last, true, nil
+}
+
+// replicationMerkleState returns the WAL epoch and index of a primary, and
+// the hashes of its merkle buckets at that index restricted to the keys
+// shipped to the secondary
+func (c *Core) replicationMerkleState(r *replicationSet, shipped func(string) bool) (string, uint64, []string, error) {
+	r.l.RLock()
+	defer r.l.RUnlock()
+	if r.wal == nil || r.index == nil {
+		return "", 0, nil, fmt.Errorf("replication index not available")
+	}
+	return r.wal.epoch, r.wal.last(), r.index.bucketHashes(shipped), nil
+}
+
+// replicationBucketEntries returns the entries of the given merkle buckets of
+// a primary which are shipped to the secondary
+func (c *Core) replicationBucketEntries(r *replicationSet, buckets []int, shipped func(string) bool) ([]*replicationWALEntry, error) {
+	r.l.RLock()
+	index := r.index
+	r.l.RUnlock()
+	if index == nil {
+		return nil, fmt.Errorf("replication index not available")
+	}
+
+	var keys []string
+	for _, bucket := range buckets {
+		if bucket < 0 || bucket >= replicationMerkleBuckets {
+			return nil, fmt.Errorf("invalid merkle bucket %d", bucket)
+		}
+		for _, key := range index.keys(bucket) {
+			if shipped(key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	entries, err := c.replicationEntries(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys deleted since they were listed are deleted by the WALs
+	result := entries[:0]
+	for _, entry := range entries {
+		if !entry.Deleted {
+			result = append(result, entry)
+		}
+	}
+	return result, nil
+}
+
+// replicationCheckPrimary checks that a secondary can reach its primary with
+// the given configuration
+func (c *Core) replicationCheckPrimary(r *replicationSet, conf *replicationConfig) error {
+	transport, err := c.newReplicationTransport(conf, r.internalPrefix())
+	if err != nil {
+		return err
+	}
+	_, err = transport.Call("wal", map[string]interface{}{
+		"id":     conf.SecondaryID,
+		"secret": conf.Secret,
+		"epoch":  "",
+		"from":   0,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reach the primary: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,374 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// The modes of the paths filter of a performance secondary. An allow
+	// filter ships only the mounts under its paths, a deny filter all the
+	// mounts but them.
+	replicationFilterAllow = "allow"
+	replicationFilterDeny  = "deny"
+)
+
+var (
+	// replicationForwardedWriteTimeout is how long a performance secondary
+	// waits for a write it forwarded to be replicated back before responding
+	replicationForwardedWriteTimeout = 2 * time.Second
+
+	// replicationUnfilteredTypes are the types of the mounts which are always
+	// shipped to the performance secondaries
+	replicationUnfilteredTypes = []string{"system", "token", "cubbyhole", "identity"}
+
+	// perfSecondaryLocalSystemPaths are the paths of the system backend
+	// which a performance secondary serves itself. They manage its local
+	// mounts, tokens, leases and cluster, while the other writes are
+	// forwarded to the primary.
+	perfSecondaryLocalSystemPaths = []string{
+		"audit",
+		"auth",
+		"mounts",
+		"remount",
+		"rotate",
+		"leases/",
+		"renew",
+		"revoke",
+		"wrapping/",
+		"replication/",
+		"capabilities",
+		"seal",
+		"step-down",
+		"generate-root",
+		"rekey",
+		"unseal",
+		"init",
+		"storage/raft/",
+	}
+
+	// replicationForwardedErrors are the errors of the backends which are
+	// kept when forwarded back to a performance secondary
+	replicationForwardedErrors = []error{
+		logical.ErrPermissionDenied,
+		logical.ErrInvalidRequest,
+		logical.ErrUnsupportedPath,
+		logical.ErrUnsupportedOperation,
+		logical.ErrReadOnly,
+	}
+)
+
+// replicationForwardedRequest is a request forwarded by a performance
+// secondary to its primary. The secondary already authorized it, so the
+// primary routes it to the backend directly.
+type replicationForwardedRequest struct {
+	Operation   logical.Operation      `json:"operation"`
+	Path        string                 `json:"path"`
+	Data        map[string]interface{} `json:"data"`
+	DisplayName string                 `json:"display_name"`
+	RemoteAddr  string                 `json:"remote_addr"`
+}
+
+// replicationPathsFilter returns whether a key is shipped to a secondary
+// given its paths filter, and the UUIDs of the mounts it filters out. The
+// secondaries without a filter get all the replicated keys.
+func (c *Core) replicationPathsFilter(secondary *replicationSecondaryEntry) (func(string) bool, []string) {
+	if secondary == nil || secondary.FilterMode == "" {
+		return func(string) bool { return true }, nil
+	}
+
+	prefixes := make(map[string]struct{})
+	var filtered []string
+	check := func(table *MountTable, storagePrefix string) {
+		if table == nil {
+			return
+		}
+		for _, entry := range table.Entries {
+			if entry.Local || strutil.StrListContains(replicationUnfilteredTypes, entry.Type) {
+				continue
+			}
+			if replicationPathFiltered(secondary, entry.APIPath()) {
+				prefixes[storagePrefix+entry.UUID+"/"] = struct{}{}
+				filtered = append(filtered, entry.UUID)
+			}
+		}
+	}
+	c.mountsLock.RLock()
+	check(c.mounts, backendBarrierPrefix)
+	c.mountsLock.RUnlock()
+	c.authLock.RLock()
+	check(c.auth, credentialBarrierPrefix)
+	c.authLock.RUnlock()
+	sort.Strings(filtered)
+
+	return func(key string) bool {
+		_, ok := prefixes[mountStoragePrefix(key)]
+		return !ok
+	}, filtered
+}
+
+// replicationPathFiltered returns whether the mount at the given API path is
+// filtered out by the paths filter of a secondary
+func replicationPathFiltered(secondary *replicationSecondaryEntry, path string) bool {
+	matched := false
+	for _, filterPath := range secondary.FilterPaths {
+		if strings.HasPrefix(path, filterPath) {
+			matched = true
+			break
+		}
+	}
+
+	switch secondary.FilterMode {
+	case replicationFilterAllow:
+		return !matched
+	case replicationFilterDeny:
+		return matched
+	}
+	return false
+}
+
+// replicationUpdateFilteredMounts records the mounts filtered out by the
+// primary of a secondary, and returns whether they changed
+func (c *Core) replicationUpdateFilteredMounts(r *replicationSet, mounts []string) (bool, error) {
+	sort.Strings(mounts)
+
+	r.l.Lock()
+	defer r.l.Unlock()
+	if r.config == nil || strings.Join(r.config.FilteredMounts, ",") == strings.Join(mounts, ",") {
+		return false, nil
+	}
+
+	conf := *r.config
+	conf.FilteredMounts = mounts
+	if err := c.persistReplicationConfig(r, &conf); err != nil {
+		return false, err
+	}
+	r.config = &conf
+	return true, nil
+}
+
+// replicationFilteredMount returns whether a mount is filtered out by the
+// primary of a performance secondary, in which case it is not set up
+func (c *Core) replicationFilteredMount(entry *MountEntry) bool {
+	r := c.perfReplication
+	if !c.ReplicationState().HasState(r.secondaryState) {
+		return false
+	}
+
+	r.l.RLock()
+	defer r.l.RUnlock()
+	return r.config != nil && strutil.StrListContains(r.config.FilteredMounts, entry.UUID)
+}
+
+// perfSecondaryReadOnlyMount returns whether the storage of a mount is
+// read-only, since it is replicated from the primary of a performance
+// secondary
+func (c *Core) perfSecondaryReadOnlyMount(entry *MountEntry) bool {
+	if !c.ReplicationState().HasState(consts.ReplicationSecondary) {
+		return false
+	}
+	return !entry.Local && entry.Type != "system" && entry.Type != "token"
+}
+
+// routeRequest routes a request to its backend. A performance secondary
+// forwards the requests writing replicated data to its primary, as well as
+// the requests which turn out to write to a read-only mount, such as the
+// logins updating their backend.
+func (c *Core) routeRequest(req *logical.Request) (*logical.Response, error) {
+	if !c.ReplicationState().HasState(consts.ReplicationSecondary) {
+		return c.router.Route(req)
+	}
+
+	if c.perfSecondaryForwarded(req) {
+		return c.forwardToReplicationPrimary(req)
+	}
+	resp, err := c.router.Route(req)
+	if isPerfStandbyReadOnlyErr(err) {
+		return c.forwardToReplicationPrimary(req)
+	}
+	return resp, err
+}
+
+// perfSecondaryForwarded returns whether a performance secondary forwards a
+// request to its primary rather than serving it
+func (c *Core) perfSecondaryForwarded(req *logical.Request) bool {
+	switch req.Operation {
+	case logical.CreateOperation, logical.UpdateOperation, logical.DeleteOperation:
+	default:
+		return false
+	}
+	if c.router.LoginPath(req.Path) {
+		return false
+	}
+
+	entry := c.router.MatchingMountEntry(req.Path)
+	if entry == nil || entry.Local {
+		return false
+	}
+	switch entry.Type {
+	case "token", "cubbyhole":
+		return false
+	case "system":
+		path := strings.TrimPrefix(req.Path, c.router.MatchingMount(req.Path))
+		for _, prefix := range perfSecondaryLocalSystemPaths {
+			if strings.HasPrefix(path, prefix) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// forwardToReplicationPrimary forwards a request to the primary of a
+// performance secondary, and waits for its writes to be replicated back
+func (c *Core) forwardToReplicationPrimary(req *logical.Request) (*logical.Response, error) {
+	r := c.perfReplication
+	r.l.RLock()
+	transport, conf := r.transport, r.config
+	r.l.RUnlock()
+	if transport == nil || conf == nil {
+		return logical.ErrorResponse("cannot write to a performance secondary without a primary"), logical.ErrInvalidRequest
+	}
+
+	forwarded := &replicationForwardedRequest{
+		Operation:   req.Operation,
+		Path:        req.Path,
+		Data:        req.Data,
+		DisplayName: req.DisplayName,
+	}
+	if req.Connection != nil {
+		forwarded.RemoteAddr = req.Connection.RemoteAddr
+	}
+	raw, err := jsonutil.EncodeJSON(forwarded)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := transport.Call("forward", map[string]interface{}{
+		"id":      conf.SecondaryID,
+		"secret":  conf.Secret,
+		"request": string(raw),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to forward the request to the primary: %v", err)
+	}
+	var result struct {
+		Response string `json:"response"`
+		Error    string `json:"error"`
+		Epoch    string `json:"epoch"`
+		Last     uint64 `json:"last"`
+	}
+	if err := replicationDecode(data, &result); err != nil {
+		return nil, err
+	}
+
+	var resp *logical.Response
+	if result.Response != "" {
+		resp = &logical.Response{}
+		if err := jsonutil.DecodeJSON([]byte(result.Response), resp); err != nil {
+			return nil, err
+		}
+	}
+	if result.Error != "" {
+		return resp, replicationForwardedError(result.Error)
+	}
+
+	if !c.replicationWaitForWAL(r, result.Epoch, result.Last) {
+		if resp == nil {
+			resp = &logical.Response{}
+		}
+		resp.AddWarning("Timeout hit while waiting for the write to be replicated from the primary; reading the data right away may return a stale value.")
+	}
+	return resp, nil
+}
+
+// replicationForwardedError returns the error of a forwarded request,
+// keeping the well-known errors of the backends
+func replicationForwardedError(msg string) error {
+	for _, err := range replicationForwardedErrors {
+		if msg == err.Error() {
+			return err
+		}
+	}
+	return errors.New(msg)
+}
+
+// replicationWaitForWAL waits for a secondary to apply the WALs of its
+// primary up to the given one, and returns whether it did in time
+func (c *Core) replicationWaitForWAL(r *replicationSet, epoch string, last uint64) bool {
+	deadline := time.Now().Add(replicationForwardedWriteTimeout)
+	for {
+		r.l.RLock()
+		applied := r.remoteEpoch == epoch && r.lastRemoteWAL >= last
+		r.l.RUnlock()
+		if applied {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// replicationRouteForwarded routes a request forwarded by a performance
+// secondary on its primary. It returns the encoded response and error of the
+// backend, and the WAL the secondary waits for.
+func (c *Core) replicationRouteForwarded(r *replicationSet, raw string) (map[string]interface{}, error) {
+	var forwarded replicationForwardedRequest
+	if err := jsonutil.DecodeJSON([]byte(raw), &forwarded); err != nil {
+		return nil, fmt.Errorf("invalid forwarded request: %v", err)
+	}
+	if forwarded.Data == nil {
+		forwarded.Data = make(map[string]interface{})
+	}
+
+	req := &logical.Request{
+		Operation:   forwarded.Operation,
+		Path:        forwarded.Path,
+		Data:        forwarded.Data,
+		DisplayName: forwarded.DisplayName,
+		Connection: &logical.Connection{
+			RemoteAddr: forwarded.RemoteAddr,
+		},
+	}
+	resp, routeErr := c.router.Route(req)
+	if routeErr == nil {
+		c.secretsSync.notify(req)
+	}
+
+	result := make(map[string]interface{})
+	if resp != nil {
+		encoded, err := jsonutil.EncodeJSON(resp)
+		if err != nil {
+			return nil, err
+		}
+		result["response"] = string(encoded)
+	}
+	if routeErr != nil {
+		result["error"] = routeErr.Error()
+		for _, err := range replicationForwardedErrors {
+			if errwrap.Contains(routeErr, err.Error()) {
+				result["error"] = err.Error()
+				break
+			}
+		}
+	}
+
+	r.l.RLock()
+	if r.wal != nil {
+		result["epoch"] = r.wal.epoch
+		result["last"] = r.wal.last()
+	}
+	r.l.RUnlock()
+	return result, nil
+}
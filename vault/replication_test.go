@@ -0,0 +1,394 @@
+package vault
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/consts"
+	"github.com/hashicorp/vault/logical"
+)
+
+// testReplicationTransport sends the requests of a secondary to a primary in
+// the same process
+type testReplicationTransport struct {
+	core   *Core
+	prefix string
+}
+
+func (t *testReplicationTransport) Call(op string, data map[string]interface{}) (map[string]interface{}, error) {
+	resp, err := t.core.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      t.prefix + op,
+		Data:      data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		return nil, fmt.Errorf("empty response from the primary")
+	}
+	return resp.Data, nil
+}
+
+func testReplicationCores(t *testing.T) (*Core, string, *Core, string) {
+	primary, _, primaryRoot := TestCoreUnsealed(t)
+	secondary, _, secondaryRoot := TestCoreUnsealed(t)
+	secondary.replicationTransportFactory = func(conf *replicationConfig, prefix string) (replicationTransport, error) {
+		return &testReplicationTransport{
+			core:   primary,
+			prefix: prefix,
+		}, nil
+	}
+	return primary, primaryRoot, secondary, secondaryRoot
+}
+
+func testWaitReplicationState(t *testing.T, c *Core, state consts.ReplicationState) {
+	start := time.Now()
+	for time.Now().Sub(start) < 10*time.Second {
+		if c.ReplicationState().HasState(state) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("replication state not reached: %d", state)
+}
+
+// testWaitDRReplicated waits until the secondary streams the WALs of the
+// primary with the same data
+func testWaitDRReplicated(t *testing.T, primary, secondary *Core) {
+	start := time.Now()
+	var primaryStatus, secondaryStatus map[string]interface{}
+	for time.Now().Sub(start) < 10*time.Second {
+		primaryStatus = primary.replicationStatus(primary.drReplication)
+		secondaryStatus = secondary.replicationStatus(secondary.drReplication)
+		if secondaryStatus["state"] == replicationStateStreamWALs &&
+			secondaryStatus["last_remote_wal"] == primaryStatus["last_wal"] &&
+			secondaryStatus["merkle_root"] == primaryStatus["merkle_root"] {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("secondary not in sync:\nprimary: %#v\nsecondary: %#v", primaryStatus, secondaryStatus)
+}
+
+func TestReplication_DR(t *testing.T) {
+	oldInterval := replicationSyncInterval
+	replicationSyncInterval = 10 * time.Millisecond
+
+	primary, root, secondary, secondaryRoot := testReplicationCores(t)
+	defer func() {
+		// Stop the secondaries syncing before restoring the interval
+		for _, c := range []*Core{primary, secondary} {
+			c.stateLock.Lock()
+			if err := c.sealInternal(); err != nil {
+				t.Errorf("err: %v", err)
+			}
+			c.stateLock.Unlock()
+		}
+		replicationSyncInterval = oldInterval
+	}()
+
+	// Written before the replication is enabled, and reconciled with a merkle
+	// sync
+	testNamespaceRequest(t, primary, root, logical.UpdateOperation, "secret/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+	testNamespaceRequest(t, primary, root, logical.UpdateOperation, "sys/replication/dr/primary/enable", nil)
+	if !primary.ReplicationState().HasState(consts.ReplicationDRPrimary) {
+		t.Fatalf("bad: %d", primary.ReplicationState())
+	}
+
+	resp := testNamespaceRequest(t, primary, root, logical.UpdateOperation, "sys/replication/dr/primary/secondary-token", map[string]interface{}{
+		"id": "dr1",
+	})
+	token := resp.Data["token"].(string)
+
+	// The token must be valid
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/replication/dr/secondary/enable")
+	req.ClientToken = secondaryRoot
+	req.Data["token"] = "bad"
+	req.Data["primary_api_addr"] = "https://127.0.0.1:8200"
+	if _, err := secondary.HandleRequest(req); err == nil || !errwrap.Contains(err, logical.ErrInvalidRequest.Error()) {
+		t.Fatalf("err: %v", err)
+	}
+
+	testNamespaceRequest(t, secondary, secondaryRoot, logical.UpdateOperation, "sys/replication/dr/secondary/enable", map[string]interface{}{
+		"token":            token,
+		"primary_api_addr": "https://127.0.0.1:8200",
+	})
+	testWaitReplicationState(t, secondary, consts.ReplicationDRSecondary)
+	testWaitDRReplicated(t, primary, secondary)
+
+	// Written after the secondary caught up, and streamed in the WALs
+	testNamespaceRequest(t, primary, root, logical.UpdateOperation, "secret/bar", map[string]interface{}{
+		"bar": "baz",
+	})
+	testNamespaceRequest(t, primary, root, logical.DeleteOperation, "secret/foo", nil)
+	testWaitDRReplicated(t, primary, secondary)
+
+	// The secondary only serves the replication requests
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/bar")
+	req.ClientToken = root
+	if _, err := secondary.HandleRequest(req); err == nil || !errwrap.Contains(err, logical.ErrInvalidRequest.Error()) {
+		t.Fatalf("err: %v", err)
+	}
+	resp, err := secondary.HandleRequest(logical.TestRequest(t, logical.ReadOperation, "sys/replication/dr/status"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["mode"] != replicationModeSecondary || resp.Data["primary_api_addr"] != "https://127.0.0.1:8200" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = testNamespaceRequest(t, primary, root, logical.ReadOperation, "sys/replication/status", nil)
+	drStatus := resp.Data["dr"].(map[string]interface{})
+	if drStatus["mode"] != replicationModePrimary || len(drStatus["known_secondaries"].([]string)) != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The tokens are replicated, and the secondary is promoted with a token
+	// of the primary after demoting the primary
+	testNamespaceRequest(t, primary, root, logical.UpdateOperation, "sys/replication/dr/primary/demote", nil)
+	testWaitReplicationState(t, primary, consts.ReplicationDRSecondary)
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/bar")
+	req.ClientToken = root
+	if _, err := primary.HandleRequest(req); err == nil || !errwrap.Contains(err, logical.ErrInvalidRequest.Error()) {
+		t.Fatalf("err: %v", err)
+	}
+
+	testNamespaceRequest(t, secondary, root, logical.UpdateOperation, "sys/replication/dr/secondary/promote", nil)
+	testWaitReplicationState(t, secondary, consts.ReplicationDRPrimary)
+
+	resp = testNamespaceRequest(t, secondary, root, logical.ReadOperation, "secret/bar", nil)
+	if resp == nil || resp.Data["bar"] != "baz" {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = testNamespaceRequest(t, secondary, root, logical.ReadOperation, "secret/foo", nil)
+	if resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	testNamespaceRequest(t, secondary, root, logical.UpdateOperation, "secret/foo", map[string]interface{}{
+		"foo": "qux",
+	})
+}
+
+func TestReplication_DRInternalAuth(t *testing.T) {
+	primary, root, _, _ := testReplicationCores(t)
+	testNamespaceRequest(t, primary, root, logical.UpdateOperation, "sys/replication/dr/primary/enable", nil)
+	testNamespaceRequest(t, primary, root, logical.UpdateOperation, "sys/replication/dr/primary/secondary-token", map[string]interface{}{
+		"id": "dr1",
+	})
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/replication/dr/internal/merkle")
+	req.Data["id"] = "dr1"
+	req.Data["secret"] = "bad"
+	if _, err := primary.HandleRequest(req); err != logical.ErrPermissionDenied {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Revoked secondaries can't connect anymore
+	resp := testNamespaceRequest(t, primary, root, logical.UpdateOperation, "sys/replication/dr/primary/secondary-token", map[string]interface{}{
+		"id": "dr2",
+	})
+	token, err := parseReplicationActivationToken(resp.Data["token"].(string))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/replication/dr/internal/merkle")
+	req.Data["id"] = token.ID
+	req.Data["secret"] = token.Secret
+	resp, err = primary.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(resp.Data["buckets"].([]string)) != replicationMerkleBuckets {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	testNamespaceRequest(t, primary, root, logical.UpdateOperation, "sys/replication/dr/primary/revoke-secondary", map[string]interface{}{
+		"id": "dr2",
+	})
+	if _, err := primary.HandleRequest(req); err != logical.ErrPermissionDenied {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestReplicationWAL(t *testing.T) {
+	oldSize := replicationWALSize
+	replicationWALSize = 4
+	defer func() {
+		replicationWALSize = oldSize
+	}()
+
+	wal, err := newReplicationWAL()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, _, ok := wal.since(0, 10); !ok {
+		t.Fatal("expected the WALs")
+	}
+	if _, _, ok := wal.since(1, 10); ok {
+		t.Fatal("unexpected WALs in the future")
+	}
+
+	for i := 0; i < 9; i++ {
+		wal.append(fmt.Sprintf("key%d", i))
+	}
+	if wal.last() != 9 || wal.first != 6 {
+		t.Fatalf("bad: first %d last %d", wal.first, wal.last())
+	}
+
+	// The compacted WALs can't be streamed anymore
+	if _, _, ok := wal.since(4, 10); ok {
+		t.Fatal("expected a reset")
+	}
+	keys, last, ok := wal.since(5, 2)
+	if !ok || last != 7 || len(keys) != 2 || keys[0] != "key5" || keys[1] != "key6" {
+		t.Fatalf("bad: %v %d %v", keys, last, ok)
+	}
+	keys, last, ok = wal.since(9, 2)
+	if !ok || last != 9 || len(keys) != 0 {
+		t.Fatalf("bad: %v %d %v", keys, last, ok)
+	}
+}
+
+// testWaitRead waits until a read on a core returns the given value
+func testWaitRead(t *testing.T, c *Core, token, path, key string, value interface{}) {
+	start := time.Now()
+	var resp *logical.Response
+	var err error
+	for time.Now().Sub(start) < 10*time.Second {
+		req := logical.TestRequest(t, logical.ReadOperation, path)
+		req.ClientToken = token
+		resp, err = c.HandleRequest(req)
+		if err == nil && resp != nil && resp.Data[key] == value {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s not replicated: err: %v resp: %#v", path, err, resp)
+}
+
+func TestReplication_Performance(t *testing.T) {
+	oldInterval := replicationSyncInterval
+	replicationSyncInterval = 10 * time.Millisecond
+
+	primary, root, secondary, secondaryRoot := testReplicationCores(t)
+	defer func() {
+		for _, c := range []*Core{primary, secondary} {
+			c.stateLock.Lock()
+			if err := c.sealInternal(); err != nil {
+				t.Errorf("err: %v", err)
+			}
+			c.stateLock.Unlock()
+		}
+		replicationSyncInterval = oldInterval
+	}()
+
+	testNamespaceRequest(t, primary, root, logical.UpdateOperation, "secret/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+	testNamespaceRequest(t, primary, root, logical.UpdateOperation, "sys/mounts/kv", map[string]interface{}{
+		"type": "generic",
+	})
+	testNamespaceRequest(t, primary, root, logical.UpdateOperation, "kv/foo", map[string]interface{}{
+		"foo": "bar",
+	})
+
+	// The local mounts of the secondary are kept
+	testNamespaceRequest(t, secondary, secondaryRoot, logical.UpdateOperation, "sys/mounts/local", map[string]interface{}{
+		"type":  "generic",
+		"local": true,
+	})
+	testNamespaceRequest(t, secondary, secondaryRoot, logical.UpdateOperation, "local/foo", map[string]interface{}{
+		"foo": "local",
+	})
+
+	testNamespaceRequest(t, primary, root, logical.UpdateOperation, "sys/replication/performance/primary/enable", nil)
+	resp := testNamespaceRequest(t, primary, root, logical.UpdateOperation, "sys/replication/performance/primary/secondary-token", map[string]interface{}{
+		"id": "perf1",
+	})
+	token := resp.Data["token"].(string)
+	testNamespaceRequest(t, primary, root, logical.UpdateOperation, "sys/replication/performance/primary/paths-filter/perf1", map[string]interface{}{
+		"mode":  "deny",
+		"paths": "kv",
+	})
+	resp = testNamespaceRequest(t, primary, root, logical.ReadOperation, "sys/replication/performance/primary/paths-filter/perf1", nil)
+	if resp.Data["mode"] != "deny" || len(resp.Data["paths"].([]string)) != 1 || resp.Data["paths"].([]string)[0] != "kv/" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	testNamespaceRequest(t, secondary, secondaryRoot, logical.UpdateOperation, "sys/replication/performance/secondary/enable", map[string]interface{}{
+		"token":            token,
+		"primary_api_addr": "https://127.0.0.1:8200",
+	})
+	testWaitReplicationState(t, secondary, consts.ReplicationSecondary)
+	testWaitRead(t, secondary, secondaryRoot, "secret/foo", "foo", "bar")
+	testWaitRead(t, secondary, secondaryRoot, "local/foo", "foo", "local")
+
+	// The tokens are local to each cluster
+	req := logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+	req.ClientToken = root
+	if _, err := secondary.HandleRequest(req); err == nil || !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("err: %v", err)
+	}
+	resp = testNamespaceRequest(t, secondary, secondaryRoot, logical.UpdateOperation, "auth/token/create", map[string]interface{}{
+		"policies": "default",
+	})
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		t.Fatalf("bad: %#v", resp)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "auth/token/lookup-self")
+	req.ClientToken = resp.Auth.ClientToken
+	if _, err := secondary.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := primary.HandleRequest(req); err == nil || !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The filtered mounts are not available on the secondary
+	req = logical.TestRequest(t, logical.ReadOperation, "kv/foo")
+	req.ClientToken = secondaryRoot
+	if _, err := secondary.HandleRequest(req); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// The writes to the replicated mounts are forwarded to the primary, and
+	// read on the secondary once replicated back
+	resp = testNamespaceRequest(t, secondary, secondaryRoot, logical.UpdateOperation, "secret/bar", map[string]interface{}{
+		"bar": "baz",
+	})
+	if resp != nil && len(resp.Warnings) != 0 {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = testNamespaceRequest(t, primary, root, logical.ReadOperation, "secret/bar", nil)
+	if resp == nil || resp.Data["bar"] != "baz" {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = testNamespaceRequest(t, secondary, secondaryRoot, logical.ReadOperation, "secret/bar", nil)
+	if resp == nil || resp.Data["bar"] != "baz" {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// The writes to the local mounts are not
+	testNamespaceRequest(t, secondary, secondaryRoot, logical.UpdateOperation, "local/bar", map[string]interface{}{
+		"bar": "local",
+	})
+	req = logical.TestRequest(t, logical.ReadOperation, "local/bar")
+	req.ClientToken = root
+	if _, err := primary.HandleRequest(req); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	resp = testNamespaceRequest(t, secondary, secondaryRoot, logical.ReadOperation, "sys/replication/status", nil)
+	perfStatus := resp.Data["performance"].(map[string]interface{})
+	if resp.Data["mode"] != "secondary" || perfStatus["mode"] != replicationModeSecondary {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The mounts removed from the filter are shipped to the secondary
+	testNamespaceRequest(t, primary, root, logical.DeleteOperation, "sys/replication/performance/primary/paths-filter/perf1", nil)
+	testWaitRead(t, secondary, secondaryRoot, "kv/foo", "foo", "bar")
+}
@@ -15,6 +15,7 @@ import (
 	"golang.org/x/net/context"
 	"golang.org/x/net/http2"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/keepalive"
 )
 
@@ -23,6 +24,14 @@ const (
 	heartbeatInterval             = 30 * time.Second
 )
 
+var (
+	// requestForwardingPoolSize is the number of connections a standby opens
+	// to the active node. Forwarded requests are spread across them so that
+	// a slow request doesn't hold up the others, and retried on another
+	// connection when one is unavailable.
+	requestForwardingPoolSize = 4
+)
+
 // Starts the listeners and servers necessary to handle forwarded requests
 func (c *Core) startForwarding() error {
 	c.logger.Trace("core: cluster listener setup function")
@@ -225,26 +234,31 @@ func (c *Core) refreshRequestForwardingConnection(clusterAddr string) error {
 	// ALPN header right. It's just "insecure" because GRPC isn't managing
 	// the TLS state.
 	ctx, cancelFunc := context.WithCancel(context.Background())
-	c.rpcClientConn, err = grpc.DialContext(ctx, clusterURL.Host,
-		grpc.WithDialer(c.getGRPCDialer("req_fw_sb-act_v1", "", nil)),
-		grpc.WithInsecure(), // it's not, we handle it in the dialer
-		grpc.WithKeepaliveParams(keepalive.ClientParameters{
-			Time: 2 * heartbeatInterval,
-		}))
-	if err != nil {
-		cancelFunc()
-		c.logger.Error("core: err setting up forwarding rpc client", "error", err)
-		return err
-	}
 	c.rpcClientConnContext = ctx
 	c.rpcClientConnCancelFunc = cancelFunc
-	c.rpcForwardingClient = &forwardingClient{
-		RequestForwardingClient: NewRequestForwardingClient(c.rpcClientConn),
-		core:        c,
-		echoTicker:  time.NewTicker(heartbeatInterval),
-		echoContext: ctx,
+	for i := 0; i < requestForwardingPoolSize; i++ {
+		conn, err := grpc.DialContext(ctx, clusterURL.Host,
+			grpc.WithDialer(c.getGRPCDialer("req_fw_sb-act_v1", "", nil)),
+			grpc.WithInsecure(), // it's not, we handle it in the dialer
+			grpc.WithKeepaliveParams(keepalive.ClientParameters{
+				Time: 2 * heartbeatInterval,
+			}))
+		if err != nil {
+			c.clearForwardingClients()
+			c.logger.Error("core: err setting up forwarding rpc client", "error", err)
+			return err
+		}
+		client := &forwardingClient{
+			RequestForwardingClient: NewRequestForwardingClient(conn),
+			core:        c,
+			echoTicker:  time.NewTicker(heartbeatInterval),
+			echoContext: ctx,
+		}
+		client.startHeartbeat()
+
+		c.rpcClientConns = append(c.rpcClientConns, conn)
+		c.rpcForwardingClients = append(c.rpcForwardingClients, client)
 	}
-	c.rpcForwardingClient.startHeartbeat()
 
 	return nil
 }
@@ -257,22 +271,23 @@ func (c *Core) clearForwardingClients() {
 		c.rpcClientConnCancelFunc()
 		c.rpcClientConnCancelFunc = nil
 	}
-	if c.rpcClientConn != nil {
-		c.rpcClientConn.Close()
-		c.rpcClientConn = nil
+	for _, conn := range c.rpcClientConns {
+		conn.Close()
 	}
 
+	c.rpcClientConns = nil
 	c.rpcClientConnContext = nil
-	c.rpcForwardingClient = nil
+	c.rpcForwardingClients = nil
 }
 
 // ForwardRequest forwards a given request to the active node and returns the
-// response.
+// response. The pooled connections are used in turn, and the request is
+// retried on the next one if a connection is unavailable.
 func (c *Core) ForwardRequest(req *http.Request) (int, http.Header, []byte, error) {
 	c.requestForwardingConnectionLock.RLock()
 	defer c.requestForwardingConnectionLock.RUnlock()
 
-	if c.rpcForwardingClient == nil {
+	if len(c.rpcForwardingClients) == 0 {
 		return 0, nil, nil, ErrCannotForward
 	}
 
@@ -285,7 +300,17 @@ func (c *Core) ForwardRequest(req *http.Request) (int, http.Header, []byte, erro
 		c.logger.Error("core: got nil forwarding RPC request")
 		return 0, nil, nil, fmt.Errorf("got nil forwarding RPC request")
 	}
-	resp, err := c.rpcForwardingClient.ForwardRequest(c.rpcClientConnContext, freq)
+
+	var resp *forwarding.Response
+	for i := 0; i < len(c.rpcForwardingClients); i++ {
+		index := atomic.AddUint32(&c.rpcForwardingClientIndex, 1)
+		client := c.rpcForwardingClients[int(index)%len(c.rpcForwardingClients)]
+		resp, err = client.ForwardRequest(c.rpcClientConnContext, freq)
+		if grpc.Code(err) != codes.Unavailable {
+			break
+		}
+		c.logger.Debug("core: forwarding connection unavailable, retrying on the next one", "error", err)
+	}
 	if err != nil {
 		c.logger.Error("core: error during forwarded RPC request", "error", err)
 		return 0, nil, nil, fmt.Errorf("error during forwarding RPC request")
@@ -23,7 +23,18 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 		return nil, consts.ErrSealed
 	}
 	if c.standby {
-		return nil, consts.ErrStandby
+		if !c.PerfStandby() {
+			return nil, consts.ErrStandby
+		}
+		if err := c.checkPerfStandbyRequest(req); err != nil {
+			return nil, err
+		}
+	}
+
+	// DR secondaries only serve the replication requests, such as their
+	// promotion
+	if c.ReplicationState().HasState(consts.ReplicationDRSecondary) && !strings.HasPrefix(req.Path, "sys/replication/") {
+		return logical.ErrorResponse("path disabled in replication DR secondary mode"), logical.ErrInvalidRequest
 	}
 
 	// Allowing writing to a path ending in / makes it extremely difficult to
@@ -39,10 +50,16 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 	}
 
 	var auth *logical.Auth
+	var controlGroup *ControlGroup
 	if c.router.LoginPath(req.Path) {
 		resp, auth, err = c.handleLoginRequest(req)
 	} else {
-		resp, auth, err = c.handleRequest(req)
+		resp, auth, controlGroup, err = c.handleRequest(req)
+	}
+
+	// Performance standbys forward the requests which turn out to need writes
+	if c.PerfStandby() && (err == consts.ErrPerfStandbyPleaseForward || isPerfStandbyReadOnlyErr(err)) {
+		return nil, consts.ErrPerfStandbyPleaseForward
 	}
 
 	// Ensure we don't leak internal data
@@ -80,6 +97,17 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 				Warnings: resp.Warnings,
 			}
 			resp = wrappingResp
+
+			// Record the request under a control group along with its
+			// response, until its approvers authorize it
+			if controlGroup != nil {
+				if cgErr := c.createControlGroupRequest(req, auth, resp.WrapInfo.Token, controlGroup); cgErr != nil {
+					c.tokenStore.Revoke(resp.WrapInfo.Token)
+					c.logger.Error("core: failed to store control group request", "request_path", req.Path, "error", cgErr)
+					resp = nil
+					err = ErrInternalError
+				}
+			}
 		}
 	}
 
@@ -112,25 +140,43 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 	return
 }
 
-func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, retAuth *logical.Auth, retErr error) {
+// handleRequest handles a request which is not a login. It also returns the
+// control group which must authorize the request, if its response is wrapped
+// until then.
+func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, retAuth *logical.Auth, retControlGroup *ControlGroup, retErr error) {
 	defer metrics.MeasureSince([]string{"core", "handle_request"}, time.Now())
 
 	// Validate the token
-	auth, te, ctErr := c.checkToken(req)
+	auth, te, controlGroup, ctErr := c.checkToken(req)
+
+	// The responses under a control group cannot be released before the
+	// request is authorized. The wrapping token is not used, so it can still
+	// be unwrapped once the request is authorized.
+	if ctErr == nil {
+		if err := c.checkControlGroupUnwrap(req); err != nil {
+			ctErr, te = err, nil
+		}
+	}
+
 	// We run this logic first because we want to decrement the use count even in the case of an error
 	if te != nil {
+		// Performance standbys cannot decrement the use count of the tokens
+		if te.NumUses != 0 && c.PerfStandby() {
+			return nil, nil, nil, consts.ErrPerfStandbyPleaseForward
+		}
+
 		// Attempt to use the token (decrement NumUses)
 		var err error
 		te, err = c.tokenStore.UseToken(te)
 		if err != nil {
 			c.logger.Error("core: failed to use token", "error", err)
 			retErr = multierror.Append(retErr, ErrInternalError)
-			return nil, nil, retErr
+			return nil, nil, nil, retErr
 		}
 		if te == nil {
 			// Token has been revoked by this point
 			retErr = multierror.Append(retErr, logical.ErrPermissionDenied)
-			return nil, nil, retErr
+			return nil, nil, nil, retErr
 		}
 		if te.NumUses == -1 {
 			// We defer a revocation until after logic has run, since this is a
@@ -157,11 +203,16 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 		// If it is an internal error we return that, otherwise we
 		// return invalid request so that the status codes can be correct
 		var errType error
-		switch ctErr {
-		case ErrInternalError, logical.ErrPermissionDenied:
-			errType = ctErr
+		switch ctErr.(type) {
+		case *RulePolicyError:
+			errType = logical.ErrPermissionDenied
 		default:
-			errType = logical.ErrInvalidRequest
+			switch ctErr {
+			case ErrInternalError, logical.ErrPermissionDenied:
+				errType = ctErr
+			default:
+				errType = logical.ErrInvalidRequest
+			}
 		}
 
 		if err := c.auditBroker.LogRequest(auth, req, c.auditedHeaders, ctErr); err != nil {
@@ -171,21 +222,26 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 		if errType != nil {
 			retErr = multierror.Append(retErr, errType)
 		}
-		return logical.ErrorResponse(ctErr.Error()), auth, retErr
+		return logical.ErrorResponse(ctErr.Error()), auth, nil, retErr
 	}
 
-	// Attach the display name
+	// Attach the display name and the requesting entity
 	req.DisplayName = auth.DisplayName
+	req.Entity = tokenEntity(te)
 
 	// Create an audit trail of the request
 	if err := c.auditBroker.LogRequest(auth, req, c.auditedHeaders, nil); err != nil {
 		c.logger.Error("core: failed to audit request", "path", req.Path, "error", err)
 		retErr = multierror.Append(retErr, ErrInternalError)
-		return nil, auth, retErr
+		return nil, auth, nil, retErr
 	}
 
 	// Route the request
-	resp, routeErr := c.router.Route(req)
+	resp, routeErr := c.routeRequest(req)
+	if routeErr == nil {
+		// Push the secret to its sync destinations if it changed
+		c.secretsSync.notify(req)
+	}
 	if resp != nil {
 		// If wrapping is used, use the shortest between the request and response
 		var wrapTTL time.Duration
@@ -216,6 +272,20 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 			}
 		}
 
+		// Apply the wrapping TTL policy of the mount
+		wrapTTL = c.mountWrappingTTL(req.Path, resp, wrapTTL)
+
+		// Responses under a control group are always wrapped, so that they
+		// are only released once the request is authorized. The wrapping
+		// token must be looked up in the token store to check it.
+		if controlGroup != nil && routeErr == nil && !resp.IsError() {
+			if wrapTTL == 0 || controlGroup.TTL < wrapTTL {
+				wrapTTL = controlGroup.TTL
+			}
+			wrapFormat = ""
+			retControlGroup = controlGroup
+		}
+
 		if wrapTTL > 0 {
 			resp.WrapInfo = &wrapping.ResponseWrapInfo{
 				TTL:    wrapTTL,
@@ -233,7 +303,7 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 		if sysView == nil {
 			c.logger.Error("core: unable to retrieve system view from router")
 			retErr = multierror.Append(retErr, ErrInternalError)
-			return nil, auth, retErr
+			return nil, auth, nil, retErr
 		}
 
 		// Apply the default lease if none given
@@ -254,7 +324,7 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 		if matchingBackend == nil {
 			c.logger.Error("core: unable to retrieve generic backend from router")
 			retErr = multierror.Append(retErr, ErrInternalError)
-			return nil, auth, retErr
+			return nil, auth, nil, retErr
 		}
 		if ptbe, ok := matchingBackend.(*PassthroughBackend); ok {
 			if !ptbe.GeneratesLeases() {
@@ -263,25 +333,43 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 			}
 		}
 
+		if registerLease && c.PerfStandby() {
+			c.perfStandbyRevokeSecret(req, resp)
+			return nil, auth, nil, consts.ErrPerfStandbyPleaseForward
+		}
+
 		if registerLease {
+			// Secrets exceeding the lease count quota of their path are
+			// revoked by the registration
 			leaseID, err := c.expiration.Register(req, resp)
+			if isLeaseCountQuotaErr(err) {
+				return nil, auth, nil, ErrLeaseCountQuotaExceeded
+			}
 			if err != nil {
 				c.logger.Error("core: failed to register lease", "request_path", req.Path, "error", err)
 				retErr = multierror.Append(retErr, ErrInternalError)
-				return nil, auth, retErr
+				return nil, auth, nil, retErr
 			}
 			resp.Secret.LeaseID = leaseID
 		}
 	}
 
+	// Performance standbys cannot create the tokens of the auth responses
+	// and of the wrapped responses
+	if c.PerfStandby() && resp != nil && (resp.Auth != nil || resp.WrapInfo != nil) {
+		return nil, auth, nil, consts.ErrPerfStandbyPleaseForward
+	}
+
 	// Only the token store is allowed to return an auth block, for any
 	// other request this is an internal error. We exclude renewal of a token,
 	// since it does not need to be re-registered
-	if resp != nil && resp.Auth != nil && !strings.HasPrefix(req.Path, "auth/token/renew") {
-		if !strings.HasPrefix(req.Path, "auth/token/") {
+	tokenStorePath := c.router.IsTokenStorePath(req.Path)
+	tokenRenewal := tokenStorePath && strings.HasPrefix(strings.TrimPrefix(req.Path, c.router.MatchingMount(req.Path)), "renew")
+	if resp != nil && resp.Auth != nil && !tokenRenewal {
+		if !tokenStorePath {
 			c.logger.Error("core: unexpected Auth response for non-token backend", "request_path", req.Path)
 			retErr = multierror.Append(retErr, ErrInternalError)
-			return nil, auth, retErr
+			return nil, auth, nil, retErr
 		}
 
 		// Register with the expiration manager. We use the token's actual path
@@ -290,14 +378,20 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 		if err != nil {
 			c.logger.Error("core: failed to look up token", "error", err)
 			retErr = multierror.Append(retErr, ErrInternalError)
-			return nil, auth, retErr
+			return nil, auth, nil, retErr
 		}
 
-		if err := c.expiration.RegisterAuth(te.Path, resp.Auth); err != nil {
-			c.tokenStore.Revoke(te.ID)
-			c.logger.Error("core: failed to register token lease", "request_path", req.Path, "error", err)
-			retErr = multierror.Append(retErr, ErrInternalError)
-			return nil, auth, retErr
+		// Batch tokens are not tracked, they expire on their own
+		if te.Type != tokenTypeBatch {
+			if err := c.expiration.RegisterAuth(te.Path, resp.Auth); err != nil {
+				c.tokenStore.Revoke(te.ID)
+				if isLeaseCountQuotaErr(err) {
+					return nil, auth, nil, ErrLeaseCountQuotaExceeded
+				}
+				c.logger.Error("core: failed to register token lease", "request_path", req.Path, "error", err)
+				retErr = multierror.Append(retErr, ErrInternalError)
+				return nil, auth, nil, retErr
+			}
 		}
 	}
 
@@ -312,7 +406,20 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 	if routeErr != nil {
 		retErr = multierror.Append(retErr, routeErr)
 	}
-	return resp, auth, retErr
+	return resp, auth, retControlGroup, retErr
+}
+
+// tokenEntity returns the entity of the requests made with a token. Only
+// the entity the token was issued to is trusted: the metadata of the token
+// itself is set by its creator.
+func tokenEntity(te *TokenEntry) *logical.Entity {
+	if te == nil || te.EntityName == "" {
+		return nil
+	}
+	return &logical.Entity{
+		Name:     te.EntityName,
+		Metadata: te.EntityMeta,
+	}
 }
 
 // handleLoginRequest is used to handle a login request, which is an
@@ -328,13 +435,62 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 
 	// The token store uses authentication even when creating a new token,
 	// so it's handled in handleRequest. It should not be reached here.
-	if strings.HasPrefix(req.Path, "auth/token/") {
+	if c.router.IsTokenStorePath(req.Path) {
 		c.logger.Error("core: unexpected login request for token backend", "request_path", req.Path)
 		return nil, nil, ErrInternalError
 	}
 
-	// Route the request
-	resp, routeErr := c.router.Route(req)
+	// The EGPs of the login path apply before the credentials are checked
+	if err := c.checkRulePolicies(req, nil); err != nil {
+		if _, ok := err.(*RulePolicyError); !ok {
+			c.logger.Error("core: failed to evaluate rule policies", "request_path", req.Path, "error", err)
+			return nil, nil, ErrInternalError
+		}
+		return logical.ErrorResponse(err.Error()), nil, logical.ErrPermissionDenied
+	}
+
+	// Route the request. Requests completing an MFA requirement resume the
+	// login which returned it, using the response of the auth backend.
+	loginPath := req.Path
+	mfaValidated := false
+	var resp *logical.Response
+	var routeErr error
+	if req.Path == loginMFAValidatePath {
+		login, err := c.validateLoginMFA(req)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil, logical.ErrPermissionDenied
+		}
+		loginPath = login.path
+		mfaValidated = true
+		resp = login.response
+	} else {
+		// Users locked out of the mount are denied before their
+		// credentials are checked
+		lockoutMount, lockoutUser := c.loginUser(req)
+		if lockoutMount != nil {
+			locked, err := c.userLockoutManager.Locked(lockoutMount, lockoutUser)
+			if err != nil {
+				c.logger.Error("core: failed to look up locked user", "request_path", req.Path, "error", err)
+				return nil, nil, ErrInternalError
+			}
+			if locked {
+				return nil, nil, logical.ErrPermissionDenied
+			}
+		}
+
+		resp, routeErr = c.routeRequest(req)
+
+		if lockoutMount != nil {
+			switch {
+			case resp != nil && resp.Auth != nil:
+				c.userLockoutManager.Succeeded(lockoutMount, lockoutUser)
+			case routeErr != nil || resp.IsError():
+				if err := c.userLockoutManager.Failed(lockoutMount, lockoutUser); err != nil {
+					c.logger.Error("core: failed to lock out user", "request_path", req.Path, "error", err)
+				}
+			}
+		}
+	}
 	if resp != nil {
 		// If wrapping is used, use the shortest between the request and response
 		var wrapTTL time.Duration
@@ -363,6 +519,9 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 			}
 		}
 
+		// Apply the wrapping TTL policy of the mount
+		wrapTTL = c.mountWrappingTTL(loginPath, resp, wrapTTL)
+
 		if wrapTTL > 0 {
 			resp.WrapInfo = &wrapping.ResponseWrapInfo{
 				TTL:    wrapTTL,
@@ -373,7 +532,7 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 
 	// A login request should never return a secret!
 	if resp != nil && resp.Secret != nil {
-		c.logger.Error("core: unexpected Secret response for login path", "request_path", req.Path)
+		c.logger.Error("core: unexpected Secret response for login path", "request_path", loginPath)
 		return nil, nil, ErrInternalError
 	}
 
@@ -386,17 +545,27 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 			return logical.ErrorResponse("authentication backends cannot create root tokens"), nil, logical.ErrInvalidRequest
 		}
 
-		// Determine the source of the login
-		source := c.router.MatchingMount(req.Path)
-		source = strings.TrimPrefix(source, credentialRoutePrefix)
-		source = strings.Replace(source, "/", "-", -1)
+		// Keep the response of the backend, which completes the login if
+		// it is subject to MFA
+		backendAuth := *auth
+		backendResp := *resp
+		backendResp.Auth = &backendAuth
+
+		// Determine the source of the login, which is the auth backend
+		// within its namespace
+		loginMount := c.router.MatchingMountEntry(loginPath)
+		if loginMount == nil {
+			c.logger.Error("core: unable to look up mount entry for login path", "request_path", loginPath)
+			return nil, nil, ErrInternalError
+		}
+		source := strings.Replace(loginMount.Path, "/", "-", -1)
 
 		// Prepend the source to the display name
 		auth.DisplayName = strings.TrimSuffix(source+auth.DisplayName, "-")
 
-		sysView := c.router.MatchingSystemView(req.Path)
+		sysView := c.router.MatchingSystemView(loginPath)
 		if sysView == nil {
-			c.logger.Error("core: unable to look up sys view for login path", "request_path", req.Path)
+			c.logger.Error("core: unable to look up sys view for login path", "request_path", loginPath)
 			return nil, nil, ErrInternalError
 		}
 
@@ -410,15 +579,83 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 			auth.TTL = sysView.MaxLeaseTTL()
 		}
 
+		// Resolve the external groups of the user, within the namespace of
+		// the auth backend
+		groupStore := c.externalGroupStoreForNamespace(loginMount.Namespace())
+		groups, groupPolicies, err := groupStore.Resolve(loginMount.Path, auth.GroupAliases)
+		if err != nil {
+			c.logger.Error("core: failed to resolve external groups", "request_path", loginPath, "error", err)
+			return nil, nil, ErrInternalError
+		}
+		if len(auth.GroupAliases) > 0 && len(auth.Policies) == 0 && len(groupPolicies) == 0 {
+			return logical.ErrorResponse("user is not a member of any authorized group"), nil, logical.ErrInvalidRequest
+		}
+
+		// The entity of the user is described by the auth backend, along
+		// with the external groups of the user
+		entityMeta := auth.Metadata
+		if len(groups) > 0 {
+			entityMeta = make(map[string]string, len(auth.Metadata)+1)
+			for k, v := range auth.Metadata {
+				entityMeta[k] = v
+			}
+			entityMeta["external_groups"] = strings.Join(groups, ",")
+		}
+		entity := &logical.Entity{
+			Name:     auth.DisplayName,
+			Metadata: entityMeta,
+		}
+
+		// Users logging in with the alias of a stored entity are attributed
+		// the entity, along with its metadata. The alias is the display name
+		// returned by the backend.
+		entityAlias := EntityAlias{
+			MountPath: loginMount.Path,
+			Name:      backendAuth.DisplayName,
+		}
+		stored, storedAlias, err := c.entityStoreForNamespace(loginMount.Namespace()).ByAlias(entityAlias)
+		if err != nil {
+			c.logger.Error("core: failed to resolve entity", "request_path", loginPath, "error", err)
+			return nil, nil, ErrInternalError
+		}
+		if stored != nil {
+			entity = stored.Entity(storedAlias, entityMeta)
+		}
+
+		// Logins subject to MFA enforcements return the MFA requirement
+		// instead of a token until it is satisfied
+		if !mfaValidated {
+			requirement, err := c.loginMFARequirement(req, loginPath, &backendResp, entity, groups)
+			if err != nil {
+				c.logger.Error("core: failed to determine the login MFA requirement", "request_path", loginPath, "error", err)
+				return nil, nil, ErrInternalError
+			}
+			if requirement != nil {
+				return &logical.Response{
+					Auth: &logical.Auth{
+						MFARequirement: requirement,
+					},
+				}, nil, nil
+			}
+		}
+
 		// Generate a token
 		te := TokenEntry{
-			Path:         req.Path,
-			Policies:     auth.Policies,
-			Meta:         auth.Metadata,
+			Path:         loginPath,
+			Policies:     append(append([]string{}, auth.Policies...), groupPolicies...),
+			Meta:         entityMeta,
 			DisplayName:  auth.DisplayName,
 			CreationTime: time.Now().Unix(),
 			TTL:          auth.TTL,
 			NumUses:      auth.NumUses,
+			BoundCIDRs:   auth.BoundCIDRs,
+			NamespaceID:  loginMount.NamespaceID,
+			MFAValidated: mfaValidated,
+			EntityName:   entity.Name,
+			EntityMeta:   entity.Metadata,
+		}
+		if len(groups) > 0 {
+			te.ExternalGroups = groups
 		}
 
 		te.Policies = policyutil.SanitizePolicies(te.Policies, true)
@@ -430,21 +667,45 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 			}
 		}
 
-		if err := c.tokenStore.create(&te); err != nil {
+		// Batch tokens are issued if the mount is tuned to. They only
+		// expire, so they cannot be periodic or renewed.
+		if loginMount.Config.TokenType == tokenTypeBatch {
+			if auth.Period > 0 || auth.NumUses > 0 {
+				return logical.ErrorResponse("batch tokens cannot be periodic or have a limited number of uses"), nil, logical.ErrInvalidRequest
+			}
+			if strutil.StrListContains(te.Policies, "root") {
+				return logical.ErrorResponse("batch tokens cannot be root tokens"), nil, logical.ErrInvalidRequest
+			}
+			auth.Renewable = false
+
+			if err := c.tokenStore.createBatch(&te); err != nil {
+				c.logger.Error("core: failed to create batch token", "error", err)
+				return nil, auth, ErrInternalError
+			}
+		} else if err := c.tokenStore.create(&te); err != nil {
 			c.logger.Error("core: failed to create token", "error", err)
 			return nil, auth, ErrInternalError
 		}
 
-		// Populate the client token and accessor
+		// Populate the client token and accessor. The lease keeps the policies
+		// granted by the backend, which backends compare on renewal.
 		auth.ClientToken = te.ID
 		auth.Accessor = te.Accessor
+		registered := *auth
+		registered.Policies = policyutil.SanitizePolicies(auth.Policies, true)
 		auth.Policies = te.Policies
 
-		// Register with the expiration manager
-		if err := c.expiration.RegisterAuth(te.Path, auth); err != nil {
-			c.tokenStore.Revoke(te.ID)
-			c.logger.Error("core: failed to register token lease", "request_path", req.Path, "error", err)
-			return nil, auth, ErrInternalError
+		// Register with the expiration manager. Batch tokens are not
+		// tracked, they expire on their own.
+		if te.Type != tokenTypeBatch {
+			if err := c.expiration.RegisterAuth(te.Path, &registered); err != nil {
+				c.tokenStore.Revoke(te.ID)
+				if isLeaseCountQuotaErr(err) {
+					return nil, nil, ErrLeaseCountQuotaExceeded
+				}
+				c.logger.Error("core: failed to register token lease", "request_path", loginPath, "error", err)
+				return nil, auth, ErrInternalError
+			}
 		}
 
 		// Attach the display name, might be used by audit backends
@@ -453,3 +714,23 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 
 	return resp, auth, routeErr
 }
+
+// mountWrappingTTL applies the wrapping TTL policy of the mount of a path to
+// the wrapping TTL of a response. Responses with content that would not be
+// wrapped are wrapped with the default wrapping TTL of the mount, and wrapping
+// TTLs are capped to the max wrapping TTL of the mount.
+func (c *Core) mountWrappingTTL(path string, resp *logical.Response, wrapTTL time.Duration) time.Duration {
+	me := c.router.MatchingMountEntry(path)
+	if me == nil {
+		return wrapTTL
+	}
+
+	if wrapTTL == 0 && (len(resp.Data) != 0 || resp.Secret != nil || resp.Auth != nil) {
+		wrapTTL = me.Config.DefaultWrappingTTL
+	}
+	if me.Config.MaxWrappingTTL != 0 && wrapTTL > me.Config.MaxWrappingTTL {
+		wrapTTL = me.Config.MaxWrappingTTL
+	}
+
+	return wrapTTL
+}
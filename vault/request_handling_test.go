@@ -140,3 +140,210 @@ func TestRequestHandling_LoginWrapping(t *testing.T) {
 		t.Fatalf("bad: %#v", resp)
 	}
 }
+
+func TestRequestHandling_MountWrappingTTLs(t *testing.T) {
+	core, _, root := TestCoreUnsealed(t)
+
+	core.logicalBackends["generic"] = PassthroughBackendFactory
+
+	req := &logical.Request{
+		Path:        "sys/mounts/wraptest",
+		ClientToken: root,
+		Operation:   logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"type": "generic",
+			"config": map[string]interface{}{
+				"default_wrapping_ttl": "30s",
+				"max_wrapping_ttl":     "1m",
+			},
+		},
+	}
+	resp, err := core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	req = &logical.Request{
+		Path:        "wraptest/foo",
+		ClientToken: root,
+		Operation:   logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"zip": "zap",
+		},
+	}
+	resp, err = core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Responses are wrapped with the default wrapping TTL
+	req = &logical.Request{
+		Path:        "wraptest/foo",
+		ClientToken: root,
+		Operation:   logical.ReadOperation,
+	}
+	resp, err = core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.WrapInfo == nil || resp.WrapInfo.TTL != 30*time.Second {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Requested wrapping TTLs are capped
+	req.WrapInfo = &logical.RequestWrapInfo{
+		TTL: 5 * time.Minute,
+	}
+	resp, err = core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.WrapInfo == nil || resp.WrapInfo.TTL != time.Minute {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Disabling the default stops wrapping responses
+	req = &logical.Request{
+		Path:        "sys/mounts/wraptest/tune",
+		ClientToken: root,
+		Operation:   logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"default_wrapping_ttl": "0",
+		},
+	}
+	resp, err = core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	req = &logical.Request{
+		Path:        "wraptest/foo",
+		ClientToken: root,
+		Operation:   logical.ReadOperation,
+	}
+	resp, err = core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.WrapInfo != nil || resp.Data["zip"] != "zap" {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// The default wrapping TTL cannot be greater than the max
+	req = &logical.Request{
+		Path:        "sys/mounts/wraptest/tune",
+		ClientToken: root,
+		Operation:   logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"default_wrapping_ttl": "2m",
+		},
+	}
+	resp, err = core.HandleRequest(req)
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected an error, got %#v", resp)
+	}
+
+	req = &logical.Request{
+		Path:        "sys/mounts/wraptest/tune",
+		ClientToken: root,
+		Operation:   logical.ReadOperation,
+	}
+	resp, err = core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["default_wrapping_ttl"] != 0 || resp.Data["max_wrapping_ttl"] != 60 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestRequestHandling_LoginTokenType(t *testing.T) {
+	core, _, root := TestCoreUnsealed(t)
+	core.credentialBackends["userpass"] = credUserpass.Factory
+
+	request := func(path string, data map[string]interface{}) *logical.Response {
+		req := logical.TestRequest(t, logical.UpdateOperation, path)
+		req.Data = data
+		req.ClientToken = root
+		resp, err := core.HandleRequest(req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v resp: %#v", err, resp)
+		}
+		return resp
+	}
+	login := func() *logical.Response {
+		resp, err := core.HandleRequest(&logical.Request{
+			Path:      "auth/userpass/login/test",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"password": "foo",
+			},
+		})
+		if err != nil || resp == nil || resp.Auth == nil {
+			t.Fatalf("err: %v resp: %#v", err, resp)
+		}
+		return resp
+	}
+
+	request("sys/auth/userpass", map[string]interface{}{
+		"type": "userpass",
+	})
+	request("auth/userpass/users/test", map[string]interface{}{
+		"password": "foo",
+		"policies": "default",
+	})
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/userpass/tune")
+	req.ClientToken = root
+	req.Data = map[string]interface{}{
+		"token_type": "foo",
+	}
+	if resp, err := core.HandleRequest(req); err == nil && !resp.IsError() {
+		t.Fatal("expected an error with an invalid token type")
+	}
+
+	// Service tokens are issued by default
+	resp := login()
+	if isBatchToken(resp.Auth.ClientToken) || !resp.Auth.Renewable {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+
+	request("sys/auth/userpass/tune", map[string]interface{}{
+		"token_type": "batch",
+	})
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/auth/userpass/tune")
+	req.ClientToken = root
+	resp, err := core.HandleRequest(req)
+	if err != nil || resp.Data["token_type"] != "batch" {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+
+	resp = login()
+	if !isBatchToken(resp.Auth.ClientToken) || resp.Auth.Renewable {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+	te, err := core.tokenStore.Lookup(resp.Auth.ClientToken)
+	if err != nil || te == nil {
+		t.Fatalf("err: %v entry: %#v", err, te)
+	}
+	if te.Type != tokenTypeBatch || te.Path != "auth/userpass/login/test" {
+		t.Fatalf("bad: %#v", te)
+	}
+
+	request("sys/auth/userpass/tune", map[string]interface{}{
+		"token_type": "default",
+	})
+	resp = login()
+	if isBatchToken(resp.Auth.ClientToken) {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+}
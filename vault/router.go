@@ -235,6 +235,20 @@ func (r *Router) MatchingStoragePrefix(path string) (string, string, bool) {
 	return mountPath, prefix, true
 }
 
+// MatchingStorageBackend returns the backend and the mount entry owning a
+// storage key, and the storage prefix of the mount
+func (r *Router) MatchingStorageBackend(key string) (logical.Backend, *MountEntry, string, bool) {
+	r.l.RLock()
+	_, raw, ok := r.storagePrefix.LongestPrefix(key)
+	r.l.RUnlock()
+	if !ok {
+		return nil, nil, "", false
+	}
+
+	re := raw.(*routeEntry)
+	return re.backend, re.mountEntry, re.storageView.prefix, true
+}
+
 // Route is used to route a given request
 func (r *Router) Route(req *logical.Request) (*logical.Response, error) {
 	resp, _, _, err := r.routeCommon(req, false)
@@ -287,12 +301,13 @@ func (r *Router) routeCommon(req *logical.Request, existenceCheck bool) (*logica
 	// Attach the storage view for the request
 	req.Storage = re.storageView
 
-	// Hash the request token unless this is the token backend
+	// Hash the request token unless this is the token backend, of the root
+	// namespace or of any other
 	clientToken := req.ClientToken
 	switch {
-	case strings.HasPrefix(originalPath, "auth/token/"):
-	case strings.HasPrefix(originalPath, "sys/"):
-	case strings.HasPrefix(originalPath, "cubbyhole/"):
+	case strings.HasPrefix(originalPath, "auth/token/"), re.mountEntry.Type == "token":
+	case strings.HasPrefix(originalPath, "sys/"), re.mountEntry.Type == "system":
+	case strings.HasPrefix(originalPath, "cubbyhole/"), re.mountEntry.Type == "cubbyhole":
 		// In order for the token store to revoke later, we need to have the same
 		// salted ID, so we double-salt what's going to the cubbyhole backend
 		req.ClientToken = re.SaltID(r.tokenStoreSalt.SaltID(req.ClientToken))
@@ -350,6 +365,16 @@ func (r *Router) routeCommon(req *logical.Request, existenceCheck bool) (*logica
 	}
 }
 
+// IsTokenStorePath returns whether the given path is routed to the token
+// store, of the root namespace or of any other
+func (r *Router) IsTokenStorePath(path string) bool {
+	if strings.HasPrefix(path, "auth/token/") {
+		return true
+	}
+	me := r.MatchingMountEntry(path)
+	return me != nil && me.Type == "token"
+}
+
 // RootPath checks if the given path requires root privileges
 func (r *Router) RootPath(path string) bool {
 	r.l.RLock()
@@ -0,0 +1,322 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/golang-lru"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/rulepolicy"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// Role governing policies (RGPs) apply to the tokens having them among
+	// their policies, including through their external groups. Endpoint
+	// governing policies (EGPs) apply to the requests on their paths, whoever
+	// makes them.
+	rulePolicyTypeRGP = "rgp"
+	rulePolicyTypeEGP = "egp"
+
+	// The enforcement levels of the rule policies. Failing advisory policies
+	// are only logged, and failing soft-mandatory policies can be overridden
+	// by the requests setting the policy override flag.
+	enforcementLevelAdvisory      = "advisory"
+	enforcementLevelSoftMandatory = "soft-mandatory"
+	enforcementLevelHardMandatory = "hard-mandatory"
+
+	// rulePolicyCacheSize is the number of parsed rule policies kept in
+	// memory
+	rulePolicyCacheSize = 256
+)
+
+var (
+	rulePoliciesPath = "core/rule-policies/"
+
+	enforcementLevels = []string{
+		enforcementLevelAdvisory,
+		enforcementLevelSoftMandatory,
+		enforcementLevelHardMandatory,
+	}
+)
+
+// RulePolicyEntry is a stored rule policy
+type RulePolicyEntry struct {
+	Name string `json:"name"`
+
+	// Policy is the text of the rules of the policy
+	Policy string `json:"policy"`
+
+	EnforcementLevel string `json:"enforcement_level"`
+
+	// Paths are the request paths an EGP applies to. Paths ending with "*"
+	// are prefixes.
+	Paths []string `json:"paths,omitempty"`
+}
+
+// RulePolicyStore keeps the RGPs or the EGPs
+type RulePolicyStore struct {
+	view *BarrierView
+
+	// kind is the type of the policies of the store
+	kind string
+
+	// parsed caches the parsed policies by their text
+	parsed *lru.TwoQueueCache
+}
+
+// RulePolicyError is returned when a request is denied by rule policies
+type RulePolicyError struct {
+	Failures []string
+}
+
+func (e *RulePolicyError) Error() string {
+	return fmt.Sprintf("request denied by rule policies: %s", strings.Join(e.Failures, "; "))
+}
+
+func (c *Core) setupRulePolicyStores() error {
+	var err error
+	if c.rgpStore, err = newRulePolicyStore(c.barrier, rulePolicyTypeRGP); err != nil {
+		return err
+	}
+	c.egpStore, err = newRulePolicyStore(c.barrier, rulePolicyTypeEGP)
+	return err
+}
+
+func newRulePolicyStore(barrier SecurityBarrier, kind string) (*RulePolicyStore, error) {
+	parsed, err := lru.New2Q(rulePolicyCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	return &RulePolicyStore{
+		view:   NewBarrierView(barrier, rulePoliciesPath+kind+"/"),
+		kind:   kind,
+		parsed: parsed,
+	}, nil
+}
+
+// rulePolicyStore returns the store of the rule policies of the given type
+func (c *Core) rulePolicyStore(kind string) *RulePolicyStore {
+	if kind == rulePolicyTypeEGP {
+		return c.egpStore
+	}
+	return c.rgpStore
+}
+
+// Get retrieves the named rule policy, or nil if it does not exist
+func (s *RulePolicyStore) Get(name string) (*RulePolicyEntry, error) {
+	out, err := s.view.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve %s %q: %v", s.kind, name, err)
+	}
+	if out == nil {
+		return nil, nil
+	}
+
+	entry := new(RulePolicyEntry)
+	if err := jsonutil.DecodeJSON(out.Value, entry); err != nil {
+		return nil, fmt.Errorf("failed to decode %s entry: %v", s.kind, err)
+	}
+	return entry, nil
+}
+
+// Set stores a rule policy, which must be valid
+func (s *RulePolicyStore) Set(entry *RulePolicyEntry) error {
+	if strings.Contains(entry.Name, "..") {
+		return fmt.Errorf("%s names cannot contain \"..\"", s.kind)
+	}
+	if !strutil.StrListContains(enforcementLevels, entry.EnforcementLevel) {
+		return fmt.Errorf("enforcement level must be one of %s", strings.Join(enforcementLevels, ", "))
+	}
+	if s.kind == rulePolicyTypeEGP && len(entry.Paths) == 0 {
+		return fmt.Errorf("egp must apply to at least one path")
+	}
+	if _, err := s.parse(entry); err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s entry: %v", s.kind, err)
+	}
+
+	if err := s.view.Put(&logical.StorageEntry{
+		Key:   entry.Name,
+		Value: buf,
+	}); err != nil {
+		return fmt.Errorf("failed to persist %s entry: %v", s.kind, err)
+	}
+	return nil
+}
+
+// Delete removes a rule policy
+func (s *RulePolicyStore) Delete(name string) error {
+	return s.view.Delete(name)
+}
+
+// List returns the names of the rule policies
+func (s *RulePolicyStore) List() ([]string, error) {
+	return logical.CollectKeys(s.view)
+}
+
+// parse returns the parsed rules of a policy
+func (s *RulePolicyStore) parse(entry *RulePolicyEntry) (*rulepolicy.Policy, error) {
+	if raw, ok := s.parsed.Get(entry.Policy); ok {
+		return raw.(*rulepolicy.Policy), nil
+	}
+
+	policy, err := rulepolicy.Parse(entry.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %v", err)
+	}
+	s.parsed.Add(entry.Policy, policy)
+	return policy, nil
+}
+
+// appliesTo returns whether an EGP applies to the given request path
+func (e *RulePolicyEntry) appliesTo(path string) bool {
+	for _, p := range e.Paths {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(path, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		} else if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRulePolicies evaluates the EGPs of the path of a request, and the
+// RGPs of its token if any, and returns a RulePolicyError if one of them
+// denies it. Root tokens are not subject to rule policies.
+func (c *Core) checkRulePolicies(req *logical.Request, te *TokenEntry) error {
+	if te != nil && strutil.StrListContains(te.Policies, "root") {
+		return nil
+	}
+
+	type applicable struct {
+		store *RulePolicyStore
+		entry *RulePolicyEntry
+	}
+	var policies []applicable
+
+	names, err := c.egpStore.List()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		entry, err := c.egpStore.Get(name)
+		if err != nil {
+			return err
+		}
+		if entry != nil && entry.appliesTo(req.Path) {
+			policies = append(policies, applicable{c.egpStore, entry})
+		}
+	}
+	if te != nil {
+		for _, name := range te.Policies {
+			entry, err := c.rgpStore.Get(name)
+			if err != nil {
+				return err
+			}
+			if entry != nil {
+				policies = append(policies, applicable{c.rgpStore, entry})
+			}
+		}
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+
+	context := rulePolicyContext(req, te)
+	var failures []string
+	for _, p := range policies {
+		passed := false
+		policy, err := p.store.parse(p.entry)
+		if err == nil {
+			passed, err = policy.Eval(context)
+		}
+		if passed {
+			continue
+		}
+
+		failure := fmt.Sprintf("%s %q evaluated to false", p.store.kind, p.entry.Name)
+		if err != nil {
+			failure = fmt.Sprintf("%s %q failed to evaluate: %v", p.store.kind, p.entry.Name, err)
+		}
+		switch {
+		case p.entry.EnforcementLevel == enforcementLevelAdvisory:
+			c.logger.Warn("core: advisory rule policy failed", "request_path", req.Path, "failure", failure)
+		case p.entry.EnforcementLevel == enforcementLevelSoftMandatory && req.PolicyOverride:
+			c.logger.Warn("core: soft-mandatory rule policy overridden", "request_path", req.Path, "failure", failure)
+		default:
+			failures = append(failures, failure)
+		}
+	}
+
+	if len(failures) > 0 {
+		return &RulePolicyError{Failures: failures}
+	}
+	return nil
+}
+
+// rulePolicyContext returns the values rule policies are evaluated against
+func rulePolicyContext(req *logical.Request, te *TokenEntry) map[string]interface{} {
+	request := map[string]interface{}{
+		"path":            req.Path,
+		"operation":       string(req.Operation),
+		"data":            req.Data,
+		"policy_override": req.PolicyOverride,
+		"wrapping":        req.WrapInfo != nil && req.WrapInfo.TTL != 0,
+	}
+	if req.Connection != nil {
+		request["remote_addr"] = req.Connection.RemoteAddr
+	}
+
+	token := map[string]interface{}{}
+	identity := map[string]interface{}{}
+	mfa := map[string]interface{}{
+		"validated": false,
+	}
+	if te != nil {
+		token = map[string]interface{}{
+			"accessor":      te.Accessor,
+			"display_name":  te.DisplayName,
+			"policies":      te.Policies,
+			"meta":          te.Meta,
+			"path":          te.Path,
+			"type":          te.Type,
+			"namespace_id":  te.NamespaceID,
+			"creation_time": te.CreationTime,
+			"ttl":           int64(te.TTL.Seconds()),
+			"num_uses":      te.NumUses,
+		}
+		identity = map[string]interface{}{
+			"display_name": te.DisplayName,
+			"groups":       te.ExternalGroups,
+			"metadata":     te.Meta,
+		}
+		mfa["validated"] = te.MFAValidated
+	}
+
+	now := time.Now().UTC()
+	return map[string]interface{}{
+		"request":  request,
+		"token":    token,
+		"identity": identity,
+		"mfa":      mfa,
+		"time": map[string]interface{}{
+			"now":     now.Unix(),
+			"year":    now.Year(),
+			"month":   int(now.Month()),
+			"day":     now.Day(),
+			"hour":    now.Hour(),
+			"minute":  now.Minute(),
+			"weekday": strings.ToLower(now.Weekday().String()),
+		},
+	}
+}
@@ -0,0 +1,162 @@
+package vault
+
+import (
+	"testing"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestRulePolicies_enforcement(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	write := func(token, path string, data map[string]interface{}) (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.UpdateOperation, path)
+		req.Data = data
+		req.ClientToken = token
+		return c.HandleRequest(req)
+	}
+	mustWrite := func(path string, data map[string]interface{}) {
+		if resp, err := write(root, path, data); err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v resp: %#v", err, resp)
+		}
+	}
+
+	mustWrite("sys/policy/writer", map[string]interface{}{
+		"rules": `path "secret/*" { capabilities = ["create", "read", "update"] }`,
+	})
+	mustWrite("sys/policies/rgp/read-only", map[string]interface{}{
+		"policy": `main = rule { request.operation == "read" }`,
+	})
+
+	resp, err := write(root, "auth/token/create", map[string]interface{}{
+		"policies": []string{"writer", "read-only"},
+		"meta":     map[string]string{"team": "dev"},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	token := resp.Auth.ClientToken
+
+	// Hard-mandatory RGPs cannot be overridden
+	if _, err := write(token, "secret/foo", map[string]interface{}{"value": "bar"}); !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied, got: %v", err)
+	}
+	req := logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.Data["value"] = "bar"
+	req.ClientToken = token
+	req.PolicyOverride = true
+	if _, err := c.HandleRequest(req); !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied, got: %v", err)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+	req.ClientToken = token
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Soft-mandatory RGPs can be overridden, and advisory ones only warn
+	mustWrite("sys/policies/rgp/read-only", map[string]interface{}{
+		"policy":            `main = rule { request.operation == "read" }`,
+		"enforcement_level": "soft-mandatory",
+	})
+	if _, err := write(token, "secret/foo", map[string]interface{}{"value": "bar"}); !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied, got: %v", err)
+	}
+	req = logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.Data["value"] = "bar"
+	req.ClientToken = token
+	req.PolicyOverride = true
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	mustWrite("sys/policies/rgp/read-only", map[string]interface{}{
+		"policy":            `main = rule { request.operation == "read" }`,
+		"enforcement_level": "advisory",
+	})
+	if _, err := write(token, "secret/foo", map[string]interface{}{"value": "bar"}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// EGPs apply to the requests on their paths, except for root tokens
+	mustWrite("sys/policies/egp/ops-only", map[string]interface{}{
+		"policy": `main = rule { token.meta.team == "ops" }`,
+		"paths":  "secret/restricted/*",
+	})
+	if _, err := write(token, "secret/restricted/foo", map[string]interface{}{"value": "bar"}); !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied, got: %v", err)
+	}
+	if _, err := write(token, "secret/other", map[string]interface{}{"value": "bar"}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	mustWrite("secret/restricted/foo", map[string]interface{}{"value": "bar"})
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/policies/egp/ops-only")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["enforcement_level"] != "hard-mandatory" || len(resp.Data["paths"].([]string)) != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Invalid policies are rejected
+	for path, data := range map[string]map[string]interface{}{
+		"sys/policies/rgp/bad":   {"policy": `main = rule { true`},
+		"sys/policies/rgp/level": {"policy": `main = rule { true }`, "enforcement_level": "strict"},
+		"sys/policies/egp/paths": {"policy": `main = rule { true }`},
+	} {
+		if _, err := write(root, path, data); err == nil {
+			t.Fatalf("expected error writing %q", path)
+		}
+	}
+}
+
+func TestRulePolicies_login(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	noop := &NoopBackend{
+		Login: []string{"login"},
+		Response: &logical.Response{
+			Auth: &logical.Auth{
+				Policies:    []string{"default"},
+				DisplayName: "armon",
+			},
+		},
+	}
+	c.credentialBackends["noop"] = func(conf *logical.BackendConfig) (logical.Backend, error) {
+		return noop, nil
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := c.HandleRequest(&logical.Request{Path: "auth/foo/login"}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/policies/egp/internal-logins")
+	req.Data["policy"] = `main = rule { request.remote_addr matches "^10\\." }`
+	req.Data["paths"] = "auth/foo/*"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	_, err := c.HandleRequest(&logical.Request{
+		Path:       "auth/foo/login",
+		Connection: &logical.Connection{RemoteAddr: "192.168.0.1"},
+	})
+	if !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied, got: %v", err)
+	}
+	if _, err := c.HandleRequest(&logical.Request{
+		Path:       "auth/foo/login",
+		Connection: &logical.Connection{RemoteAddr: "10.0.0.1"},
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
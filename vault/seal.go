@@ -21,10 +21,11 @@ const (
 	barrierSealConfigPath = "core/seal-config"
 
 	// recoverySealConfigPath is the path to the recovery key seal
-	// configuration. It is inside the barrier.
+	// configuration. Like the barrier configuration, it is stored in
+	// plaintext so that it can be read with the Vault sealed.
 	recoverySealConfigPath = "core/recovery-seal-config"
 
-	// recoveryKeyPath is the path to the recovery key
+	// recoveryKeyPath is the path to the recovery key, encrypted by the seal
 	recoveryKeyPath = "core/recovery-key"
 )
 
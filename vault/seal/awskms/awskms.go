@@ -0,0 +1,232 @@
+// Package awskms implements a seal wrapping the master key with an AWS KMS
+// key.
+package awskms
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/helper/awsutil"
+	"github.com/hashicorp/vault/vault/seal"
+	log "github.com/mgutz/logxi/v1"
+)
+
+const (
+	// EnvAWSKMSSealKeyID is the environment variable of the KMS key
+	EnvAWSKMSSealKeyID = "VAULT_AWSKMS_SEAL_KEY_ID"
+
+	// EnvAWSKMSEndpoint is the environment variable overriding the KMS
+	// endpoint, such as a VPC endpoint
+	EnvAWSKMSEndpoint = "AWS_KMS_ENDPOINT"
+)
+
+// AWSKMSSeal is a seal wrapping the data keys of the values it encrypts with
+// an AWS KMS key
+type AWSKMSSeal struct {
+	client *awsutil.KMSClient
+	logger log.Logger
+
+	// keyID is the ARN of the key currently used, as resolved by KMS
+	keyID atomic.Value
+
+	// configuredKeyID is the key ID, ARN or alias given in the configuration
+	configuredKeyID string
+}
+
+var _ seal.Access = (*AWSKMSSeal)(nil)
+
+// NewSeal creates a new AWS KMS seal, which must be configured with
+// SetConfig
+func NewSeal(logger log.Logger) *AWSKMSSeal {
+	k := &AWSKMSSeal{
+		logger: logger,
+	}
+	k.keyID.Store("")
+	return k
+}
+
+type kmsEncryptInput struct {
+	KeyId     *string
+	Plaintext []byte
+}
+
+type kmsEncryptOutput struct {
+	CiphertextBlob []byte
+	KeyId          *string
+}
+
+type kmsDecryptInput struct {
+	CiphertextBlob []byte
+}
+
+type kmsDecryptOutput struct {
+	Plaintext []byte
+	KeyId     *string
+}
+
+type kmsDescribeKeyInput struct {
+	KeyId *string
+}
+
+type kmsDescribeKeyOutput struct {
+	KeyMetadata struct {
+		Arn      *string
+		KeyState *string
+		KeyUsage *string
+	}
+}
+
+// SetConfig configures the seal from the "kms_key_id" parameter, using the
+// optional "region", "access_key", "secret_key", "session_token" and
+// "endpoint" parameters to reach KMS. The environment variables of the AWS
+// SDK are used for the parameters which are not set. It returns the
+// information to display about the seal.
+func (k *AWSKMSSeal) SetConfig(config map[string]string) (map[string]string, error) {
+	if config == nil {
+		config = map[string]string{}
+	}
+
+	k.configuredKeyID = config["kms_key_id"]
+	if k.configuredKeyID == "" {
+		k.configuredKeyID = os.Getenv(EnvAWSKMSSealKeyID)
+	}
+	if k.configuredKeyID == "" {
+		return nil, fmt.Errorf("'kms_key_id' not found for AWS KMS seal configuration")
+	}
+
+	region := config["region"]
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	credsConfig := &awsutil.CredentialsConfig{
+		AccessKey:    config["access_key"],
+		SecretKey:    config["secret_key"],
+		SessionToken: config["session_token"],
+		Region:       region,
+		HTTPClient:   cleanhttp.DefaultClient(),
+	}
+	creds, err := credsConfig.GenerateCredentialChain()
+	if err != nil {
+		return nil, err
+	}
+
+	awsConfig := &aws.Config{
+		Credentials: creds,
+		Region:      aws.String(region),
+		HTTPClient:  cleanhttp.DefaultClient(),
+	}
+	endpoint := config["endpoint"]
+	if endpoint == "" {
+		endpoint = os.Getenv(EnvAWSKMSEndpoint)
+	}
+	if endpoint != "" {
+		awsConfig.Endpoint = aws.String(endpoint)
+	}
+	k.client = awsutil.NewKMSClient(awsConfig)
+
+	info := map[string]string{
+		"Region":     region,
+		"KMS Key ID": k.configuredKeyID,
+	}
+	if endpoint != "" {
+		info["Endpoint"] = endpoint
+	}
+	return info, nil
+}
+
+// Init checks that the key can be used to encrypt, and resolves its ARN
+func (k *AWSKMSSeal) Init() error {
+	output := &kmsDescribeKeyOutput{}
+	if err := k.client.Send("DescribeKey", &kmsDescribeKeyInput{
+		KeyId: aws.String(k.configuredKeyID),
+	}, output); err != nil {
+		return fmt.Errorf("error fetching AWS KMS key %s: %v", k.configuredKeyID, err)
+	}
+	if state := aws.StringValue(output.KeyMetadata.KeyState); state != "Enabled" {
+		return fmt.Errorf("AWS KMS key %s is not enabled: %s", k.configuredKeyID, state)
+	}
+	if usage := aws.StringValue(output.KeyMetadata.KeyUsage); usage != "" && usage != "ENCRYPT_DECRYPT" {
+		return fmt.Errorf("AWS KMS key %s can't be used to encrypt: %s", k.configuredKeyID, usage)
+	}
+	k.keyID.Store(aws.StringValue(output.KeyMetadata.Arn))
+	return nil
+}
+
+func (k *AWSKMSSeal) Finalize() error {
+	return nil
+}
+
+func (k *AWSKMSSeal) SealType() string {
+	return seal.AWSKMS
+}
+
+func (k *AWSKMSSeal) KeyID() string {
+	return k.keyID.Load().(string)
+}
+
+// Encrypt encrypts the plaintext with a data key wrapped by KMS
+func (k *AWSKMSSeal) Encrypt(plaintext []byte) (*seal.EncryptedBlobInfo, error) {
+	if plaintext == nil {
+		return nil, fmt.Errorf("given plaintext for encryption is nil")
+	}
+
+	env, err := seal.EnvelopeEncrypt(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &kmsEncryptOutput{}
+	if err := k.client.Send("Encrypt", &kmsEncryptInput{
+		KeyId:     aws.String(k.configuredKeyID),
+		Plaintext: env.Key,
+	}, output); err != nil {
+		return nil, fmt.Errorf("error encrypting data key: %v", err)
+	}
+
+	// Track the key used, in case the alias now points to another one
+	keyID := aws.StringValue(output.KeyId)
+	k.keyID.Store(keyID)
+
+	return &seal.EncryptedBlobInfo{
+		Ciphertext: env.Ciphertext,
+		IV:         env.IV,
+		KeyInfo: &seal.KeyInfo{
+			KeyID:      keyID,
+			WrappedKey: output.CiphertextBlob,
+		},
+	}, nil
+}
+
+// Decrypt decrypts a value encrypted by Encrypt. The wrapped data key
+// identifies the KMS key which encrypted it.
+func (k *AWSKMSSeal) Decrypt(in *seal.EncryptedBlobInfo) ([]byte, error) {
+	if in == nil {
+		return nil, fmt.Errorf("given input for decryption is nil")
+	}
+	if in.KeyInfo == nil {
+		return nil, fmt.Errorf("key info is nil")
+	}
+
+	output := &kmsDecryptOutput{}
+	if err := k.client.Send("Decrypt", &kmsDecryptInput{
+		CiphertextBlob: in.KeyInfo.WrappedKey,
+	}, output); err != nil {
+		return nil, fmt.Errorf("error decrypting data key: %v", err)
+	}
+
+	return seal.EnvelopeDecrypt(&seal.EnvelopeInfo{
+		Key:        output.Plaintext,
+		IV:         in.IV,
+		Ciphertext: in.Ciphertext,
+	})
+}
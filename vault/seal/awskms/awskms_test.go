@@ -0,0 +1,132 @@
+package awskms
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	log "github.com/mgutz/logxi/v1"
+)
+
+const testKeyARN = "arn:aws:kms:us-east-1:123456789012:key/1234abcd"
+
+// fakeKMS serves the KMS operations used by the seal, "wrapping" the data keys
+// by prefixing them
+func fakeKMS(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input struct {
+			KeyId          string
+			Plaintext      []byte
+			CiphertextBlob []byte
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Fatal(err)
+		}
+
+		var output interface{}
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.DescribeKey":
+			if input.KeyId != "alias/vault" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"NotFoundException","message":"key not found"}`))
+				return
+			}
+			output = map[string]interface{}{
+				"KeyMetadata": map[string]interface{}{
+					"Arn":      testKeyARN,
+					"KeyState": "Enabled",
+					"KeyUsage": "ENCRYPT_DECRYPT",
+				},
+			}
+		case "TrentService.Encrypt":
+			output = map[string]interface{}{
+				"KeyId":          testKeyARN,
+				"CiphertextBlob": append([]byte("wrapped:"), input.Plaintext...),
+			}
+		case "TrentService.Decrypt":
+			if !bytes.HasPrefix(input.CiphertextBlob, []byte("wrapped:")) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"__type":"InvalidCiphertextException","message":"invalid ciphertext"}`))
+				return
+			}
+			output = map[string]interface{}{
+				"KeyId":     testKeyARN,
+				"Plaintext": bytes.TrimPrefix(input.CiphertextBlob, []byte("wrapped:")),
+			}
+		default:
+			t.Fatalf("unexpected operation %q", r.Header.Get("X-Amz-Target"))
+		}
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		json.NewEncoder(w).Encode(output)
+	}))
+}
+
+func testSeal(t *testing.T, keyID, endpoint string) *AWSKMSSeal {
+	s := NewSeal(logformat.NewVaultLogger(log.LevelTrace))
+	_, err := s.SetConfig(map[string]string{
+		"kms_key_id": keyID,
+		"region":     "us-east-1",
+		"access_key": "AKIAEXAMPLE",
+		"secret_key": "secret",
+		"endpoint":   endpoint,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestAWSKMSSeal(t *testing.T) {
+	server := fakeKMS(t)
+	defer server.Close()
+
+	s := testSeal(t, "alias/vault", server.URL)
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if s.KeyID() != testKeyARN {
+		t.Fatalf("bad: %q", s.KeyID())
+	}
+
+	blob, err := s.Encrypt([]byte("master key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(blob.Ciphertext, []byte("master key")) {
+		t.Fatal("plaintext not encrypted")
+	}
+	if blob.KeyInfo.KeyID != testKeyARN {
+		t.Fatalf("bad: %#v", blob.KeyInfo)
+	}
+	plaintext, err := s.Decrypt(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "master key" {
+		t.Fatalf("bad: %q", plaintext)
+	}
+
+	// Tampering with the ciphertext is detected
+	blob.Ciphertext[0] ^= 1
+	if _, err := s.Decrypt(blob); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestAWSKMSSeal_InvalidKey(t *testing.T) {
+	server := fakeKMS(t)
+	defer server.Close()
+
+	s := testSeal(t, "alias/unknown", server.URL)
+	if err := s.Init(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if _, err := NewSeal(logformat.NewVaultLogger(log.LevelTrace)).SetConfig(nil); err == nil {
+		t.Fatal("expected error without a key")
+	}
+}
@@ -0,0 +1,279 @@
+// Package azurekeyvault implements a seal wrapping the master key with an
+// Azure Key Vault key.
+package azurekeyvault
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/vault/seal"
+	log "github.com/mgutz/logxi/v1"
+)
+
+const (
+	// The environment variables of the configuration
+	EnvAzureKeyVaultSealVaultName = "VAULT_AZUREKEYVAULT_VAULT_NAME"
+	EnvAzureKeyVaultSealKeyName   = "VAULT_AZUREKEYVAULT_KEY_NAME"
+
+	keyVaultAPIVersion = "7.4"
+
+	// wrapAlgorithm is the algorithm wrapping the data keys with the RSA key
+	wrapAlgorithm = "RSA-OAEP-256"
+)
+
+// AzureKeyVaultSeal is a seal wrapping the data keys of the values it
+// encrypts with an RSA key of a key vault
+type AzureKeyVaultSeal struct {
+	httpClient *http.Client
+	logger     log.Logger
+
+	// keyURL is the URL of the key, without version, such as
+	// "https://example.vault.azure.net/keys/vault"
+	keyURL string
+
+	// token returns an access token to the key vault
+	tokenLock sync.Mutex
+	token     func() (string, error)
+
+	// keyID is the URL of the current version of the key
+	keyID atomic.Value
+}
+
+var _ seal.Access = (*AzureKeyVaultSeal)(nil)
+
+// NewSeal creates a new Azure Key Vault seal, which must be configured with
+// SetConfig
+func NewSeal(logger log.Logger) *AzureKeyVaultSeal {
+	s := &AzureKeyVaultSeal{
+		logger: logger,
+	}
+	s.keyID.Store("")
+	return s
+}
+
+// SetConfig configures the seal from the "vault_name" and "key_name"
+// parameters. It authenticates as the service principal of the "tenant_id",
+// "client_id" and "client_secret" parameters, or with the managed identity of
+// the VM when no client secret is given. The optional "environment" parameter
+// selects the Azure cloud, and "endpoint" overrides the URL of the key vault.
+// It returns the information to display about the seal.
+func (s *AzureKeyVaultSeal) SetConfig(config map[string]string) (map[string]string, error) {
+	if config == nil {
+		config = map[string]string{}
+	}
+
+	param := func(name, env string) string {
+		if value := config[name]; value != "" {
+			return value
+		}
+		return os.Getenv(env)
+	}
+	tenantID := param("tenant_id", "AZURE_TENANT_ID")
+	clientID := param("client_id", "AZURE_CLIENT_ID")
+	clientSecret := param("client_secret", "AZURE_CLIENT_SECRET")
+	vaultName := param("vault_name", EnvAzureKeyVaultSealVaultName)
+	keyName := param("key_name", EnvAzureKeyVaultSealKeyName)
+	if tenantID == "" {
+		return nil, fmt.Errorf("'tenant_id' not found for Azure Key Vault seal configuration")
+	}
+	if vaultName == "" && config["endpoint"] == "" {
+		return nil, fmt.Errorf("'vault_name' not found for Azure Key Vault seal configuration")
+	}
+	if keyName == "" {
+		return nil, fmt.Errorf("'key_name' not found for Azure Key Vault seal configuration")
+	}
+
+	environment := azure.PublicCloud
+	if envName := param("environment", "AZURE_ENVIRONMENT"); envName != "" {
+		var err error
+		environment, err = azure.EnvironmentFromName(envName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	vaultURL := config["endpoint"]
+	if vaultURL == "" {
+		vaultURL = fmt.Sprintf("https://%s.%s", vaultName, environment.KeyVaultDNSSuffix)
+	}
+	s.keyURL = strings.TrimSuffix(vaultURL, "/") + "/keys/" + url.PathEscape(keyName)
+
+	oauthConfig, err := adal.NewOAuthConfig(environment.ActiveDirectoryEndpoint, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	resource := strings.TrimSuffix(environment.KeyVaultEndpoint, "/")
+	var spt *adal.ServicePrincipalToken
+	if clientSecret != "" {
+		spt, err = adal.NewServicePrincipalToken(*oauthConfig, clientID, clientSecret, resource)
+	} else {
+		spt, err = adal.NewServicePrincipalTokenFromMSI(*oauthConfig, resource)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating the Azure credentials: %v", err)
+	}
+
+	s.httpClient = cleanhttp.DefaultClient()
+	s.httpClient.Timeout = 30 * time.Second
+	spt.SetSender(s.httpClient)
+	s.token = func() (string, error) {
+		if err := spt.EnsureFresh(); err != nil {
+			return "", err
+		}
+		return spt.OAuthToken(), nil
+	}
+
+	return map[string]string{
+		"Environment": environment.Name,
+		"Vault URL":   vaultURL,
+		"Key Name":    keyName,
+	}, nil
+}
+
+func (s *AzureKeyVaultSeal) do(method, path string, in, out interface{}) error {
+	s.tokenLock.Lock()
+	token, err := s.token()
+	s.tokenLock.Unlock()
+	if err != nil {
+		return fmt.Errorf("error getting an access token: %v", err)
+	}
+
+	return seal.DoJSON(s.httpClient, method, fmt.Sprintf("%s%s?api-version=%s", s.keyURL, path, keyVaultAPIVersion), token, in, out)
+}
+
+// Init checks that the key can wrap keys and finds its current version
+func (s *AzureKeyVaultSeal) Init() error {
+	var resp struct {
+		Key struct {
+			KID    string   `json:"kid"`
+			KeyOps []string `json:"key_ops"`
+		} `json:"key"`
+		Attributes struct {
+			Enabled bool `json:"enabled"`
+		} `json:"attributes"`
+	}
+	if err := s.do("GET", "", nil, &resp); err != nil {
+		if seal.IsStatus(err, http.StatusNotFound) {
+			return seal.ErrKeyNotFound
+		}
+		return fmt.Errorf("error fetching Azure Key Vault key %s: %v", s.keyURL, err)
+	}
+	if !resp.Attributes.Enabled {
+		return fmt.Errorf("Azure Key Vault key %s is not enabled", s.keyURL)
+	}
+	var wrap, unwrap bool
+	for _, op := range resp.Key.KeyOps {
+		wrap = wrap || op == "wrapKey"
+		unwrap = unwrap || op == "unwrapKey"
+	}
+	if !wrap || !unwrap {
+		return fmt.Errorf("Azure Key Vault key %s doesn't allow the wrapKey and unwrapKey operations", s.keyURL)
+	}
+	s.keyID.Store(resp.Key.KID)
+	return nil
+}
+
+func (s *AzureKeyVaultSeal) Finalize() error {
+	return nil
+}
+
+func (s *AzureKeyVaultSeal) SealType() string {
+	return seal.AzureKeyVault
+}
+
+func (s *AzureKeyVaultSeal) KeyID() string {
+	return s.keyID.Load().(string)
+}
+
+type keyOperation struct {
+	Algorithm string `json:"alg,omitempty"`
+	Value     string `json:"value"`
+}
+
+type keyOperationResult struct {
+	KID   string `json:"kid"`
+	Value string `json:"value"`
+}
+
+// Encrypt encrypts the plaintext with a data key wrapped by the current
+// version of the key
+func (s *AzureKeyVaultSeal) Encrypt(plaintext []byte) (*seal.EncryptedBlobInfo, error) {
+	if plaintext == nil {
+		return nil, fmt.Errorf("given plaintext for encryption is nil")
+	}
+
+	env, err := seal.EnvelopeEncrypt(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp keyOperationResult
+	if err := s.do("POST", "/wrapkey", &keyOperation{
+		Algorithm: wrapAlgorithm,
+		Value:     base64.RawURLEncoding.EncodeToString(env.Key),
+	}, &resp); err != nil {
+		return nil, fmt.Errorf("error wrapping data key: %v", err)
+	}
+	wrapped, err := base64.RawURLEncoding.DecodeString(resp.Value)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding wrapped data key: %v", err)
+	}
+	if resp.KID != "" {
+		s.keyID.Store(resp.KID)
+	}
+
+	return &seal.EncryptedBlobInfo{
+		Ciphertext: env.Ciphertext,
+		IV:         env.IV,
+		KeyInfo: &seal.KeyInfo{
+			KeyID:      resp.KID,
+			WrappedKey: wrapped,
+		},
+	}, nil
+}
+
+// Decrypt decrypts a value encrypted by Encrypt, unwrapping its data key with
+// the version of the key which wrapped it
+func (s *AzureKeyVaultSeal) Decrypt(in *seal.EncryptedBlobInfo) ([]byte, error) {
+	if in == nil {
+		return nil, fmt.Errorf("given input for decryption is nil")
+	}
+	if in.KeyInfo == nil {
+		return nil, fmt.Errorf("key info is nil")
+	}
+
+	// The key ID is the URL of the key version, whose last element is the
+	// version
+	path := ""
+	if i := strings.LastIndex(in.KeyInfo.KeyID, "/"); i != -1 && strings.HasPrefix(in.KeyInfo.KeyID, s.keyURL+"/") {
+		path = "/" + in.KeyInfo.KeyID[i+1:]
+	}
+
+	var resp keyOperationResult
+	if err := s.do("POST", path+"/unwrapkey", &keyOperation{
+		Algorithm: wrapAlgorithm,
+		Value:     base64.RawURLEncoding.EncodeToString(in.KeyInfo.WrappedKey),
+	}, &resp); err != nil {
+		return nil, fmt.Errorf("error unwrapping data key: %v", err)
+	}
+	key, err := base64.RawURLEncoding.DecodeString(resp.Value)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding data key: %v", err)
+	}
+
+	return seal.EnvelopeDecrypt(&seal.EnvelopeInfo{
+		Key:        key,
+		IV:         in.IV,
+		Ciphertext: in.Ciphertext,
+	})
+}
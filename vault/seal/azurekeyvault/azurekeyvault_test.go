@@ -0,0 +1,130 @@
+package azurekeyvault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	log "github.com/mgutz/logxi/v1"
+)
+
+// fakeKeyVault serves the Key Vault operations used by the seal, "wrapping"
+// the data keys by reversing them. The current version of the key is "v2".
+func fakeKeyVault(t *testing.T) *httptest.Server {
+	var server *httptest.Server
+	reverse := func(b []byte) []byte {
+		out := make([]byte, len(b))
+		for i := range b {
+			out[len(b)-1-i] = b[i]
+		}
+		return out
+	}
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var input keyOperation
+		if r.Method == "POST" {
+			if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+				t.Fatal(err)
+			}
+			if input.Algorithm != wrapAlgorithm {
+				t.Fatalf("bad: %#v", input)
+			}
+		}
+		value, _ := base64.RawURLEncoding.DecodeString(input.Value)
+
+		var output interface{}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/keys/vault":
+			output = map[string]interface{}{
+				"key": map[string]interface{}{
+					"kid":     server.URL + "/keys/vault/v1",
+					"key_ops": []string{"encrypt", "decrypt", "wrapKey", "unwrapKey"},
+				},
+				"attributes": map[string]interface{}{"enabled": true},
+			}
+		case r.Method == "POST" && r.URL.Path == "/keys/vault/wrapkey":
+			output = &keyOperationResult{
+				KID:   server.URL + "/keys/vault/v2",
+				Value: base64.RawURLEncoding.EncodeToString(reverse(value)),
+			}
+		case r.Method == "POST" && r.URL.Path == "/keys/vault/v2/unwrapkey":
+			output = &keyOperationResult{
+				KID:   server.URL + "/keys/vault/v2",
+				Value: base64.RawURLEncoding.EncodeToString(reverse(value)),
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"code":"KeyNotFound"}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(output)
+	}))
+	return server
+}
+
+func TestAzureKeyVaultSeal(t *testing.T) {
+	server := fakeKeyVault(t)
+	defer server.Close()
+
+	s := NewSeal(logformat.NewVaultLogger(log.LevelTrace))
+	if _, err := s.SetConfig(map[string]string{
+		"tenant_id":     "tenant",
+		"client_id":     "client",
+		"client_secret": "secret",
+		"key_name":      "vault",
+		"endpoint":      server.URL,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	s.token = func() (string, error) {
+		return "test-token", nil
+	}
+
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if s.KeyID() != server.URL+"/keys/vault/v1" {
+		t.Fatalf("bad: %q", s.KeyID())
+	}
+
+	blob, err := s.Encrypt([]byte("master key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob.KeyInfo.KeyID != server.URL+"/keys/vault/v2" || s.KeyID() != blob.KeyInfo.KeyID {
+		t.Fatalf("bad: %#v", blob.KeyInfo)
+	}
+	plaintext, err := s.Decrypt(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "master key" {
+		t.Fatalf("bad: %q", plaintext)
+	}
+
+	// Unknown key
+	s.keyURL = server.URL + "/keys/unknown"
+	if err := s.Init(); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestAzureKeyVaultSeal_MissingConfig(t *testing.T) {
+	s := NewSeal(logformat.NewVaultLogger(log.LevelTrace))
+	if _, err := s.SetConfig(map[string]string{
+		"tenant_id":     "tenant",
+		"client_id":     "client",
+		"client_secret": "secret",
+		"endpoint":      "http://127.0.0.1:1",
+	}); err == nil || !strings.Contains(err.Error(), "key_name") {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package seal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+)
+
+// EnvelopeInfo holds the result of an envelope encryption
+type EnvelopeInfo struct {
+	Key        []byte
+	IV         []byte
+	Ciphertext []byte
+}
+
+// EnvelopeEncrypt encrypts the plaintext with a new AES-256-GCM data key. The
+// caller wraps the key with its key service and discards it.
+func EnvelopeEncrypt(plaintext []byte) (*EnvelopeInfo, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("error generating data key: %v", err)
+	}
+	gcm, err := newEnvelopeGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %v", err)
+	}
+
+	return &EnvelopeInfo{
+		Key:        key,
+		IV:         iv,
+		Ciphertext: gcm.Seal(nil, iv, plaintext, nil),
+	}, nil
+}
+
+// EnvelopeDecrypt decrypts the ciphertext of an envelope with its unwrapped
+// data key
+func EnvelopeDecrypt(data *EnvelopeInfo) ([]byte, error) {
+	gcm, err := newEnvelopeGCM(data.Key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data.IV) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce length %d", len(data.IV))
+	}
+	plaintext, err := gcm.Open(nil, data.IV, data.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting envelope: %v", err)
+	}
+	return plaintext, nil
+}
+
+func newEnvelopeGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
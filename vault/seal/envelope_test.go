@@ -0,0 +1,55 @@
+package seal
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	env, err := EnvelopeEncrypt([]byte("master key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(env.Key) != 32 || bytes.Contains(env.Ciphertext, []byte("master key")) {
+		t.Fatalf("bad: %#v", env)
+	}
+
+	plaintext, err := EnvelopeDecrypt(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "master key" {
+		t.Fatalf("bad: %q", plaintext)
+	}
+
+	// The ciphertext is authenticated
+	env.Ciphertext[0] ^= 1
+	if _, err := EnvelopeDecrypt(env); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestTestSeal_RotateKey(t *testing.T) {
+	s := NewTestSeal()
+	blob, err := s.Encrypt([]byte("master key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.RotateKey()
+	if s.KeyID() == blob.KeyInfo.KeyID {
+		t.Fatalf("bad: %q", s.KeyID())
+	}
+	plaintext, err := s.Decrypt(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "master key" {
+		t.Fatalf("bad: %q", plaintext)
+	}
+
+	// Another seal doesn't have the key
+	if _, err := NewTestSeal().Decrypt(blob); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,251 @@
+// Package gcpckms implements a seal wrapping the master key with a Google
+// Cloud KMS crypto key.
+package gcpckms
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/vault/seal"
+	log "github.com/mgutz/logxi/v1"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+const (
+	// The environment variables of the configuration
+	EnvGCPCKMSSealKeyRing   = "VAULT_GCPCKMS_SEAL_KEY_RING"
+	EnvGCPCKMSSealCryptoKey = "VAULT_GCPCKMS_SEAL_CRYPTO_KEY"
+
+	// DefaultEndpoint is the base URL of the Cloud KMS API
+	DefaultEndpoint = "https://cloudkms.googleapis.com/"
+
+	cloudKMSScope = "https://www.googleapis.com/auth/cloudkms"
+)
+
+// GCPCKMSSeal is a seal wrapping the data keys of the values it encrypts with
+// a Cloud KMS symmetric crypto key
+type GCPCKMSSeal struct {
+	httpClient *http.Client
+	logger     log.Logger
+
+	// endpoint is the base URL of the API, ending with a slash
+	endpoint string
+
+	// cryptoKey is the resource name of the crypto key
+	cryptoKey string
+
+	// keyID is the resource name of the primary version of the crypto key
+	keyID atomic.Value
+}
+
+var _ seal.Access = (*GCPCKMSSeal)(nil)
+
+// NewSeal creates a new Cloud KMS seal, which must be configured with
+// SetConfig
+func NewSeal(logger log.Logger) *GCPCKMSSeal {
+	s := &GCPCKMSSeal{
+		logger: logger,
+	}
+	s.keyID.Store("")
+	return s
+}
+
+// SetConfig configures the seal from the "project", "region", "key_ring" and
+// "crypto_key" parameters. It authenticates with the service account file of
+// the optional "credentials" parameter, or the application default
+// credentials. It returns the information to display about the seal.
+func (s *GCPCKMSSeal) SetConfig(config map[string]string) (map[string]string, error) {
+	if config == nil {
+		config = map[string]string{}
+	}
+
+	param := func(name string, envs ...string) string {
+		if value := config[name]; value != "" {
+			return value
+		}
+		for _, env := range envs {
+			if value := os.Getenv(env); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+	project := param("project", "GOOGLE_PROJECT")
+	region := param("region", "GOOGLE_REGION")
+	if region == "" {
+		region = "global"
+	}
+	keyRing := param("key_ring", EnvGCPCKMSSealKeyRing)
+	cryptoKey := param("crypto_key", EnvGCPCKMSSealCryptoKey)
+	for name, value := range map[string]string{"project": project, "key_ring": keyRing, "crypto_key": cryptoKey} {
+		if value == "" {
+			return nil, fmt.Errorf("'%s' not found for GCP Cloud KMS seal configuration", name)
+		}
+	}
+	s.cryptoKey = fmt.Sprintf("projects/%s/locations/%s/keyRings/%s/cryptoKeys/%s",
+		url.PathEscape(project), url.PathEscape(region), url.PathEscape(keyRing), url.PathEscape(cryptoKey))
+
+	s.endpoint = config["endpoint"]
+	if s.endpoint == "" {
+		s.endpoint = DefaultEndpoint
+	}
+	if !strings.HasSuffix(s.endpoint, "/") {
+		s.endpoint += "/"
+	}
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, cleanhttp.DefaultClient())
+	var tokenSource oauth2.TokenSource
+	if credentialsFile := param("credentials", "GOOGLE_APPLICATION_CREDENTIALS"); credentialsFile != "" {
+		credentials, err := ioutil.ReadFile(credentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading credentials file: %v", err)
+		}
+		jwtConfig, err := google.JWTConfigFromJSON(credentials, cloudKMSScope)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing credentials: %v", err)
+		}
+		tokenSource = jwtConfig.TokenSource(ctx)
+	} else if config["endpoint"] == "" {
+		var err error
+		tokenSource, err = google.DefaultTokenSource(ctx, cloudKMSScope)
+		if err != nil {
+			return nil, fmt.Errorf("error finding the application default credentials: %v", err)
+		}
+	}
+
+	// A custom endpoint without credentials is an emulator, which doesn't
+	// authenticate the requests
+	if tokenSource != nil {
+		s.httpClient = oauth2.NewClient(ctx, tokenSource)
+	} else {
+		s.httpClient = cleanhttp.DefaultClient()
+	}
+	s.httpClient.Timeout = 30 * time.Second
+
+	return map[string]string{
+		"Project":    project,
+		"Region":     region,
+		"Key Ring":   keyRing,
+		"Crypto Key": cryptoKey,
+	}, nil
+}
+
+type cryptoKeyResource struct {
+	Name    string `json:"name"`
+	Purpose string `json:"purpose"`
+	Primary struct {
+		Name  string `json:"name"`
+		State string `json:"state"`
+	} `json:"primary"`
+}
+
+// Init checks that the crypto key can be used to encrypt
+func (s *GCPCKMSSeal) Init() error {
+	var key cryptoKeyResource
+	if err := seal.DoJSON(s.httpClient, "GET", s.endpoint+"v1/"+s.cryptoKey, "", nil, &key); err != nil {
+		if seal.IsStatus(err, http.StatusNotFound) {
+			return seal.ErrKeyNotFound
+		}
+		return fmt.Errorf("error fetching GCP Cloud KMS crypto key %s: %v", s.cryptoKey, err)
+	}
+	if key.Purpose != "ENCRYPT_DECRYPT" {
+		return fmt.Errorf("GCP Cloud KMS crypto key %s can't be used to encrypt: %s", s.cryptoKey, key.Purpose)
+	}
+	if key.Primary.State != "ENABLED" {
+		return fmt.Errorf("primary version of GCP Cloud KMS crypto key %s is not enabled: %s", s.cryptoKey, key.Primary.State)
+	}
+	s.keyID.Store(key.Primary.Name)
+	return nil
+}
+
+func (s *GCPCKMSSeal) Finalize() error {
+	return nil
+}
+
+func (s *GCPCKMSSeal) SealType() string {
+	return seal.GCPCKMS
+}
+
+func (s *GCPCKMSSeal) KeyID() string {
+	return s.keyID.Load().(string)
+}
+
+// Encrypt encrypts the plaintext with a data key wrapped by the crypto key
+func (s *GCPCKMSSeal) Encrypt(plaintext []byte) (*seal.EncryptedBlobInfo, error) {
+	if plaintext == nil {
+		return nil, fmt.Errorf("given plaintext for encryption is nil")
+	}
+
+	env, err := seal.EnvelopeEncrypt(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Name       string `json:"name"`
+		Ciphertext string `json:"ciphertext"`
+	}
+	if err := seal.DoJSON(s.httpClient, "POST", s.endpoint+"v1/"+s.cryptoKey+":encrypt", "", map[string]string{
+		"plaintext": base64.StdEncoding.EncodeToString(env.Key),
+	}, &resp); err != nil {
+		return nil, fmt.Errorf("error encrypting data key: %v", err)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(resp.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding wrapped data key: %v", err)
+	}
+
+	// The name is the version of the crypto key which encrypted
+	if resp.Name != "" {
+		s.keyID.Store(resp.Name)
+	}
+
+	return &seal.EncryptedBlobInfo{
+		Ciphertext: env.Ciphertext,
+		IV:         env.IV,
+		KeyInfo: &seal.KeyInfo{
+			KeyID:      resp.Name,
+			WrappedKey: wrapped,
+		},
+	}, nil
+}
+
+// Decrypt decrypts a value encrypted by Encrypt. Cloud KMS finds the version
+// of the crypto key which wrapped the data key.
+func (s *GCPCKMSSeal) Decrypt(in *seal.EncryptedBlobInfo) ([]byte, error) {
+	if in == nil {
+		return nil, fmt.Errorf("given input for decryption is nil")
+	}
+	if in.KeyInfo == nil {
+		return nil, fmt.Errorf("key info is nil")
+	}
+
+	var resp struct {
+		Plaintext string `json:"plaintext"`
+	}
+	if err := seal.DoJSON(s.httpClient, "POST", s.endpoint+"v1/"+s.cryptoKey+":decrypt", "", map[string]string{
+		"ciphertext": base64.StdEncoding.EncodeToString(in.KeyInfo.WrappedKey),
+	}, &resp); err != nil {
+		return nil, fmt.Errorf("error decrypting data key: %v", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(resp.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding data key: %v", err)
+	}
+
+	return seal.EnvelopeDecrypt(&seal.EnvelopeInfo{
+		Key:        key,
+		IV:         in.IV,
+		Ciphertext: in.Ciphertext,
+	})
+}
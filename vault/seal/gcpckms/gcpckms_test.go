@@ -0,0 +1,124 @@
+package gcpckms
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	log "github.com/mgutz/logxi/v1"
+)
+
+const testCryptoKey = "/v1/projects/vault/locations/global/keyRings/ring/cryptoKeys/key"
+
+// fakeCloudKMS serves the Cloud KMS operations used by the seal, "wrapping"
+// the data keys by reversing them
+func fakeCloudKMS(t *testing.T) *httptest.Server {
+	reverse := func(b []byte) []byte {
+		out := make([]byte, len(b))
+		for i := range b {
+			out[len(b)-1-i] = b[i]
+		}
+		return out
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input map[string]string
+		if r.Method == "POST" {
+			if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var output interface{}
+		switch {
+		case r.Method == "GET" && r.URL.Path == testCryptoKey:
+			output = map[string]interface{}{
+				"name":    strings.TrimPrefix(testCryptoKey, "/v1/"),
+				"purpose": "ENCRYPT_DECRYPT",
+				"primary": map[string]string{
+					"name":  strings.TrimPrefix(testCryptoKey, "/v1/") + "/cryptoKeyVersions/1",
+					"state": "ENABLED",
+				},
+			}
+		case r.Method == "POST" && r.URL.Path == testCryptoKey+":encrypt":
+			plaintext, _ := base64.StdEncoding.DecodeString(input["plaintext"])
+			output = map[string]string{
+				"name":       strings.TrimPrefix(testCryptoKey, "/v1/") + "/cryptoKeyVersions/2",
+				"ciphertext": base64.StdEncoding.EncodeToString(reverse(plaintext)),
+			}
+		case r.Method == "POST" && r.URL.Path == testCryptoKey+":decrypt":
+			ciphertext, _ := base64.StdEncoding.DecodeString(input["ciphertext"])
+			output = map[string]string{
+				"plaintext": base64.StdEncoding.EncodeToString(reverse(ciphertext)),
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"message":"not found"}}`))
+			return
+		}
+		json.NewEncoder(w).Encode(output)
+	}))
+}
+
+func TestGCPCKMSSeal(t *testing.T) {
+	server := fakeCloudKMS(t)
+	defer server.Close()
+
+	s := NewSeal(logformat.NewVaultLogger(log.LevelTrace))
+	if _, err := s.SetConfig(map[string]string{
+		"project":    "vault",
+		"key_ring":   "ring",
+		"crypto_key": "key",
+		"endpoint":   server.URL,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(s.KeyID(), "/cryptoKeyVersions/1") {
+		t.Fatalf("bad: %q", s.KeyID())
+	}
+
+	blob, err := s.Encrypt([]byte("master key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(blob.KeyInfo.KeyID, "/cryptoKeyVersions/2") || s.KeyID() != blob.KeyInfo.KeyID {
+		t.Fatalf("bad: %#v", blob.KeyInfo)
+	}
+	plaintext, err := s.Decrypt(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "master key" {
+		t.Fatalf("bad: %q", plaintext)
+	}
+
+	// Unknown crypto key
+	if _, err := s.SetConfig(map[string]string{
+		"project":    "vault",
+		"key_ring":   "ring",
+		"crypto_key": "unknown",
+		"endpoint":   server.URL,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Init(); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestGCPCKMSSeal_MissingConfig(t *testing.T) {
+	s := NewSeal(logformat.NewVaultLogger(log.LevelTrace))
+	if _, err := s.SetConfig(map[string]string{
+		"project":  "vault",
+		"key_ring": "ring",
+		"endpoint": "http://127.0.0.1:1",
+	}); err == nil || !strings.Contains(err.Error(), "crypto_key") {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package pkcs11
+
+// keyHandle is the handle of a key object of the token
+type keyHandle uint
+
+// module is a logged in session on a PKCS#11 token. It is implemented with
+// the PKCS#11 library of the HSM in the builds with the pkcs11 tag.
+type module interface {
+	// Login opens a session on the token of the slot, or of the token with
+	// the label if set, and logs in as user with the pin
+	Login(slot uint, tokenLabel, pin string) error
+
+	// FindKey returns the handle of the secret key with the label
+	FindKey(label string) (keyHandle, bool, error)
+
+	// GenerateKey generates a persistent, non-extractable AES-256 key with
+	// the label
+	GenerateKey(label string) (keyHandle, error)
+
+	Encrypt(key keyHandle, mechanism uint, iv, plaintext []byte) ([]byte, error)
+	Decrypt(key keyHandle, mechanism uint, iv, ciphertext []byte) ([]byte, error)
+
+	// GenerateRandom returns random bytes from the generator of the token
+	GenerateRandom(n int) ([]byte, error)
+
+	// Close logs out, closes the session and unloads the library
+	Close() error
+}
@@ -0,0 +1,164 @@
+// +build pkcs11
+
+package pkcs11
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+)
+
+// ctxModule is a module using the PKCS#11 library through cgo. PKCS#11
+// sessions can't be used concurrently, so the operations are serialized.
+type ctxModule struct {
+	l        sync.Mutex
+	ctx      *pkcs11.Ctx
+	session  pkcs11.SessionHandle
+	loggedIn bool
+}
+
+func openModule(lib string) (module, error) {
+	ctx := pkcs11.New(lib)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load PKCS#11 library %s", lib)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("failed to initialize PKCS#11 library %s: %v", lib, err)
+	}
+	return &ctxModule{ctx: ctx}, nil
+}
+
+func (m *ctxModule) Login(slot uint, tokenLabel, pin string) error {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	if tokenLabel != "" {
+		slots, err := m.ctx.GetSlotList(true)
+		if err != nil {
+			return fmt.Errorf("failed to list slots: %v", err)
+		}
+		found := false
+		for _, s := range slots {
+			info, err := m.ctx.GetTokenInfo(s)
+			if err != nil {
+				return fmt.Errorf("failed to get token info of slot %d: %v", s, err)
+			}
+			if info.Label == tokenLabel {
+				slot, found = s, true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("no token found with label %q", tokenLabel)
+		}
+	}
+
+	session, err := m.ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		return fmt.Errorf("failed to open session on slot %d: %v", slot, err)
+	}
+	if err := m.ctx.Login(session, pkcs11.CKU_USER, pin); err != nil {
+		m.ctx.CloseSession(session)
+		return fmt.Errorf("failed to log in on slot %d: %v", slot, err)
+	}
+	m.session = session
+	m.loggedIn = true
+	return nil
+}
+
+func (m *ctxModule) FindKey(label string) (keyHandle, bool, error) {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_SECRET_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	if err := m.ctx.FindObjectsInit(m.session, template); err != nil {
+		return 0, false, err
+	}
+	objects, _, err := m.ctx.FindObjects(m.session, 1)
+	if finalErr := m.ctx.FindObjectsFinal(m.session); err == nil {
+		err = finalErr
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if len(objects) == 0 {
+		return 0, false, nil
+	}
+	return keyHandle(objects[0]), true, nil
+}
+
+func (m *ctxModule) GenerateKey(label string) (keyHandle, error) {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_SECRET_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_AES),
+		pkcs11.NewAttribute(pkcs11.CKA_VALUE_LEN, 32),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_ENCRYPT, true),
+		pkcs11.NewAttribute(pkcs11.CKA_DECRYPT, true),
+	}
+	handle, err := m.ctx.GenerateKey(m.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_KEY_GEN, nil)}, template)
+	if err != nil {
+		return 0, err
+	}
+	return keyHandle(handle), nil
+}
+
+func mechanismParams(mechanism uint, iv []byte) *pkcs11.Mechanism {
+	if mechanism == pkcs11.CKM_AES_GCM {
+		return pkcs11.NewMechanism(mechanism, pkcs11.NewGCMParams(iv, nil, 128))
+	}
+	return pkcs11.NewMechanism(mechanism, iv)
+}
+
+func (m *ctxModule) Encrypt(key keyHandle, mechanism uint, iv, plaintext []byte) ([]byte, error) {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	if err := m.ctx.EncryptInit(m.session, []*pkcs11.Mechanism{mechanismParams(mechanism, iv)}, pkcs11.ObjectHandle(key)); err != nil {
+		return nil, err
+	}
+	return m.ctx.Encrypt(m.session, plaintext)
+}
+
+func (m *ctxModule) Decrypt(key keyHandle, mechanism uint, iv, ciphertext []byte) ([]byte, error) {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	if err := m.ctx.DecryptInit(m.session, []*pkcs11.Mechanism{mechanismParams(mechanism, iv)}, pkcs11.ObjectHandle(key)); err != nil {
+		return nil, err
+	}
+	return m.ctx.Decrypt(m.session, ciphertext)
+}
+
+func (m *ctxModule) GenerateRandom(n int) ([]byte, error) {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	return m.ctx.GenerateRandom(m.session, n)
+}
+
+func (m *ctxModule) Close() error {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	if m.loggedIn {
+		m.ctx.Logout(m.session)
+		m.ctx.CloseSession(m.session)
+		m.loggedIn = false
+	}
+	err := m.ctx.Finalize()
+	m.ctx.Destroy()
+	return err
+}
@@ -0,0 +1,12 @@
+// +build !pkcs11
+
+package pkcs11
+
+import "fmt"
+
+// openModule fails in the builds without PKCS#11 support, which requires cgo
+// and the PKCS#11 library of the HSM; build Vault with the pkcs11 tag to use
+// the seal.
+func openModule(lib string) (module, error) {
+	return nil, fmt.Errorf("PKCS#11 seal not available in this build; build Vault with the 'pkcs11' tag")
+}
@@ -0,0 +1,373 @@
+// Package pkcs11 implements a seal wrapping the master key with an AES key
+// stored in an HSM, accessed through its PKCS#11 library.
+package pkcs11
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/hashicorp/vault/helper/parseutil"
+	"github.com/hashicorp/vault/vault/seal"
+	log "github.com/mgutz/logxi/v1"
+)
+
+const (
+	// EnvHSMLib is the environment variable of the PKCS#11 library path
+	EnvHSMLib = "VAULT_HSM_LIB"
+
+	// EnvHSMSlot is the environment variable of the slot of the token
+	EnvHSMSlot = "VAULT_HSM_SLOT"
+
+	// EnvHSMTokenLabel is the environment variable of the label of the token
+	EnvHSMTokenLabel = "VAULT_HSM_TOKEN_LABEL"
+
+	// EnvHSMPin is the environment variable of the user pin
+	EnvHSMPin = "VAULT_HSM_PIN"
+
+	// EnvHSMKeyLabel is the environment variable of the label of the key
+	EnvHSMKeyLabel = "VAULT_HSM_KEY_LABEL"
+
+	// EnvHSMMechanism is the environment variable of the encryption
+	// mechanism
+	EnvHSMMechanism = "VAULT_HSM_MECHANISM"
+
+	// EnvHSMGenerateKey is the environment variable enabling the generation
+	// of the key when it doesn't exist
+	EnvHSMGenerateKey = "VAULT_HSM_GENERATE_KEY"
+)
+
+const (
+	// CKMAESCBCPad and CKMAESGCM are the values of the supported PKCS#11
+	// mechanisms
+	CKMAESCBCPad uint = 0x1085
+	CKMAESGCM    uint = 0x1087
+)
+
+var mechanisms = map[string]uint{
+	"CKM_AES_CBC_PAD": CKMAESCBCPad,
+	"CKM_AES_GCM":     CKMAESGCM,
+}
+
+// ivSizes are the sizes of the IVs generated for the mechanisms
+var ivSizes = map[uint]int{
+	CKMAESCBCPad: 16,
+	CKMAESGCM:    12,
+}
+
+// PKCS11Seal is a seal wrapping the data keys of the values it encrypts with
+// an AES key of an HSM
+type PKCS11Seal struct {
+	logger log.Logger
+
+	// openModule loads the PKCS#11 library, and is replaced by the tests
+	openModule func(lib string) (module, error)
+
+	lib         string
+	slot        uint
+	tokenLabel  string
+	pin         string
+	keyLabel    string
+	mechanism   uint
+	generateKey bool
+
+	l      sync.Mutex
+	module module
+
+	// keys are the handles of the keys found, by label; the keys used
+	// before a change of the key label stay usable to decrypt
+	keys map[string]keyHandle
+}
+
+var _ seal.Access = (*PKCS11Seal)(nil)
+var _ seal.EntropySource = (*PKCS11Seal)(nil)
+
+// NewSeal creates a new PKCS#11 seal, which must be configured with
+// SetConfig
+func NewSeal(logger log.Logger) *PKCS11Seal {
+	return &PKCS11Seal{
+		logger:     logger,
+		openModule: openModule,
+		keys:       make(map[string]keyHandle),
+	}
+}
+
+func configValue(config map[string]string, key, env string) string {
+	if v := config[key]; v != "" {
+		return v
+	}
+	return os.Getenv(env)
+}
+
+// SetConfig configures the seal from the "lib", "pin" and "key_label"
+// parameters, and the "slot" or "token_label" of the token. The optional
+// "mechanism" is CKM_AES_GCM by default, and "generate_key" generates the key
+// if it doesn't exist. Each parameter can be set with its VAULT_HSM_
+// environment variable instead. It returns the information to display about
+// the seal.
+func (s *PKCS11Seal) SetConfig(config map[string]string) (map[string]string, error) {
+	if config == nil {
+		config = map[string]string{}
+	}
+
+	s.lib = configValue(config, "lib", EnvHSMLib)
+	if s.lib == "" {
+		return nil, fmt.Errorf("'lib' not found for PKCS#11 seal configuration")
+	}
+
+	s.tokenLabel = configValue(config, "token_label", EnvHSMTokenLabel)
+	slot := configValue(config, "slot", EnvHSMSlot)
+	switch {
+	case slot != "" && s.tokenLabel != "":
+		return nil, fmt.Errorf("only one of 'slot' and 'token_label' can be set for PKCS#11 seal configuration")
+	case slot != "":
+		v, err := strconv.ParseUint(slot, 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'slot' for PKCS#11 seal configuration: %v", err)
+		}
+		s.slot = uint(v)
+	case s.tokenLabel == "":
+		return nil, fmt.Errorf("'slot' or 'token_label' not found for PKCS#11 seal configuration")
+	}
+
+	s.pin = configValue(config, "pin", EnvHSMPin)
+	if s.pin == "" {
+		return nil, fmt.Errorf("'pin' not found for PKCS#11 seal configuration")
+	}
+
+	s.keyLabel = configValue(config, "key_label", EnvHSMKeyLabel)
+	if s.keyLabel == "" {
+		return nil, fmt.Errorf("'key_label' not found for PKCS#11 seal configuration")
+	}
+
+	s.mechanism = CKMAESGCM
+	if mechanism := configValue(config, "mechanism", EnvHSMMechanism); mechanism != "" {
+		var err error
+		if s.mechanism, err = parseMechanism(mechanism); err != nil {
+			return nil, err
+		}
+	}
+
+	if generateKey := configValue(config, "generate_key", EnvHSMGenerateKey); generateKey != "" {
+		var err error
+		if s.generateKey, err = parseutil.ParseBool(generateKey); err != nil {
+			return nil, fmt.Errorf("invalid 'generate_key' for PKCS#11 seal configuration: %v", err)
+		}
+	}
+	if regenerateKey := config["regenerate_key"]; regenerateKey != "" {
+		if v, err := parseutil.ParseBool(regenerateKey); err != nil || v {
+			return nil, fmt.Errorf("'regenerate_key' is not supported by the PKCS#11 seal; set a new 'key_label' with 'generate_key' to rotate the key")
+		}
+	}
+
+	info := map[string]string{
+		"Library":   s.lib,
+		"Key Label": s.keyLabel,
+		"Mechanism": fmt.Sprintf("0x%x", s.mechanism),
+	}
+	if s.tokenLabel != "" {
+		info["Token Label"] = s.tokenLabel
+	} else {
+		info["Slot"] = strconv.FormatUint(uint64(s.slot), 10)
+	}
+	return info, nil
+}
+
+func parseMechanism(v string) (uint, error) {
+	mechanism, ok := mechanisms[v]
+	if !ok {
+		parsed, err := strconv.ParseUint(v, 0, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid 'mechanism' for PKCS#11 seal configuration: %q", v)
+		}
+		mechanism = uint(parsed)
+	}
+	if _, ok := ivSizes[mechanism]; !ok {
+		return 0, fmt.Errorf("unsupported 'mechanism' for PKCS#11 seal configuration: %q", v)
+	}
+	return mechanism, nil
+}
+
+// Init logs in on the token and finds the key, generating it if it doesn't
+// exist and generate_key is set
+func (s *PKCS11Seal) Init() error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.module == nil {
+		m, err := s.openModule(s.lib)
+		if err != nil {
+			return err
+		}
+		if err := m.Login(s.slot, s.tokenLabel, s.pin); err != nil {
+			m.Close()
+			return err
+		}
+		s.module = m
+	}
+
+	if _, err := s.findKey(s.keyLabel); err != seal.ErrKeyNotFound {
+		return err
+	}
+	if !s.generateKey {
+		return fmt.Errorf("PKCS#11 key %q not found; set 'generate_key' to generate it", s.keyLabel)
+	}
+	handle, err := s.module.GenerateKey(s.keyLabel)
+	if err != nil {
+		return fmt.Errorf("error generating PKCS#11 key %q: %v", s.keyLabel, err)
+	}
+	if s.logger.IsInfo() {
+		s.logger.Info("pkcs11: generated key", "key_label", s.keyLabel)
+	}
+	s.keys[s.keyLabel] = handle
+	return nil
+}
+
+// findKey returns the handle of the key with the label. s.l must be held.
+func (s *PKCS11Seal) findKey(label string) (keyHandle, error) {
+	if handle, ok := s.keys[label]; ok {
+		return handle, nil
+	}
+	handle, ok, err := s.module.FindKey(label)
+	if err != nil {
+		return 0, fmt.Errorf("error finding PKCS#11 key %q: %v", label, err)
+	}
+	if !ok {
+		return 0, seal.ErrKeyNotFound
+	}
+	s.keys[label] = handle
+	return handle, nil
+}
+
+// Finalize logs out and unloads the PKCS#11 library
+func (s *PKCS11Seal) Finalize() error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.module == nil {
+		return nil
+	}
+	err := s.module.Close()
+	s.module = nil
+	s.keys = make(map[string]keyHandle)
+	return err
+}
+
+func (s *PKCS11Seal) SealType() string {
+	return seal.PKCS11
+}
+
+func (s *PKCS11Seal) KeyID() string {
+	return s.keyLabel
+}
+
+// Encrypt encrypts the plaintext with a data key wrapped by the HSM key
+func (s *PKCS11Seal) Encrypt(plaintext []byte) (*seal.EncryptedBlobInfo, error) {
+	if plaintext == nil {
+		return nil, fmt.Errorf("given plaintext for encryption is nil")
+	}
+
+	env, err := seal.EnvelopeEncrypt(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	iv := make([]byte, ivSizes[s.mechanism])
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.module == nil {
+		return nil, fmt.Errorf("PKCS#11 seal is not initialized")
+	}
+	handle, err := s.findKey(s.keyLabel)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := s.module.Encrypt(handle, s.mechanism, iv, env.Key)
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting data key: %v", err)
+	}
+
+	return &seal.EncryptedBlobInfo{
+		Ciphertext: env.Ciphertext,
+		IV:         env.IV,
+		KeyInfo: &seal.KeyInfo{
+			KeyID:      s.keyLabel,
+			WrappedKey: append(iv, wrapped...),
+			Mechanism:  uint64(s.mechanism),
+		},
+	}, nil
+}
+
+// Decrypt decrypts a value encrypted by Encrypt, with the key and the
+// mechanism recorded in its key info
+func (s *PKCS11Seal) Decrypt(in *seal.EncryptedBlobInfo) ([]byte, error) {
+	if in == nil {
+		return nil, fmt.Errorf("given input for decryption is nil")
+	}
+	if in.KeyInfo == nil {
+		return nil, fmt.Errorf("key info is nil")
+	}
+
+	label := in.KeyInfo.KeyID
+	if label == "" {
+		label = s.keyLabel
+	}
+	mechanism := uint(in.KeyInfo.Mechanism)
+	if mechanism == 0 {
+		mechanism = s.mechanism
+	}
+	ivSize, ok := ivSizes[mechanism]
+	if !ok {
+		return nil, fmt.Errorf("unsupported mechanism 0x%x", mechanism)
+	}
+	if len(in.KeyInfo.WrappedKey) < ivSize {
+		return nil, fmt.Errorf("wrapped key is too short")
+	}
+	iv, wrapped := in.KeyInfo.WrappedKey[:ivSize], in.KeyInfo.WrappedKey[ivSize:]
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.module == nil {
+		return nil, fmt.Errorf("PKCS#11 seal is not initialized")
+	}
+	handle, err := s.findKey(label)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.module.Decrypt(handle, mechanism, iv, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting data key: %v", err)
+	}
+
+	return seal.EnvelopeDecrypt(&seal.EnvelopeInfo{
+		Key:        key,
+		IV:         in.IV,
+		Ciphertext: in.Ciphertext,
+	})
+}
+
+// GenerateRandom returns random bytes generated by the HSM
+func (s *PKCS11Seal) GenerateRandom(n int) ([]byte, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.module == nil {
+		return nil, fmt.Errorf("PKCS#11 seal is not initialized")
+	}
+	b, err := s.module.GenerateRandom(n)
+	if err != nil {
+		return nil, fmt.Errorf("error generating random bytes: %v", err)
+	}
+	if len(b) != n {
+		return nil, fmt.Errorf("HSM returned %d random bytes, expected %d", len(b), n)
+	}
+	return b, nil
+}
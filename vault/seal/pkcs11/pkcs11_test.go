@@ -0,0 +1,191 @@
+package pkcs11
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	log "github.com/mgutz/logxi/v1"
+)
+
+// fakeModule is a token "wrapping" the data keys by prefixing them with the
+// label of the key, the mechanism and the IV
+type fakeModule struct {
+	loggedIn bool
+	closed   bool
+	labels   []string
+}
+
+func (m *fakeModule) Login(slot uint, tokenLabel, pin string) error {
+	if pin != "1234" {
+		return fmt.Errorf("CKR_PIN_INCORRECT")
+	}
+	m.loggedIn = true
+	return nil
+}
+
+func (m *fakeModule) FindKey(label string) (keyHandle, bool, error) {
+	for i, l := range m.labels {
+		if l == label {
+			return keyHandle(i + 1), true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+func (m *fakeModule) GenerateKey(label string) (keyHandle, error) {
+	m.labels = append(m.labels, label)
+	return keyHandle(len(m.labels)), nil
+}
+
+func (m *fakeModule) prefix(key keyHandle, mechanism uint, iv []byte) []byte {
+	return append([]byte(fmt.Sprintf("%s:%x:", m.labels[key-1], mechanism)), iv...)
+}
+
+func (m *fakeModule) Encrypt(key keyHandle, mechanism uint, iv, plaintext []byte) ([]byte, error) {
+	return append(m.prefix(key, mechanism, iv), plaintext...), nil
+}
+
+func (m *fakeModule) Decrypt(key keyHandle, mechanism uint, iv, ciphertext []byte) ([]byte, error) {
+	prefix := m.prefix(key, mechanism, iv)
+	if !bytes.HasPrefix(ciphertext, prefix) {
+		return nil, fmt.Errorf("CKR_ENCRYPTED_DATA_INVALID")
+	}
+	return ciphertext[len(prefix):], nil
+}
+
+func (m *fakeModule) GenerateRandom(n int) ([]byte, error) {
+	return bytes.Repeat([]byte{0xa5}, n), nil
+}
+
+func (m *fakeModule) Close() error {
+	m.closed = true
+	return nil
+}
+
+func testSeal(t *testing.T, m *fakeModule, config map[string]string) *PKCS11Seal {
+	s := NewSeal(logformat.NewVaultLogger(log.LevelTrace))
+	s.openModule = func(lib string) (module, error) {
+		return m, nil
+	}
+	if _, err := s.SetConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestPKCS11Seal(t *testing.T) {
+	m := &fakeModule{}
+	config := map[string]string{
+		"lib":          "/usr/lib/libhsm.so",
+		"slot":         "0",
+		"pin":          "1234",
+		"key_label":    "vault",
+		"generate_key": "true",
+	}
+	s := testSeal(t, m, config)
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if !m.loggedIn || len(m.labels) != 1 {
+		t.Fatalf("bad: %#v", m)
+	}
+	if s.KeyID() != "vault" {
+		t.Fatalf("bad: %q", s.KeyID())
+	}
+
+	blob, err := s.Encrypt([]byte("master key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(blob.Ciphertext, []byte("master key")) {
+		t.Fatal("plaintext not encrypted")
+	}
+	if blob.KeyInfo.KeyID != "vault" || blob.KeyInfo.Mechanism != uint64(CKMAESGCM) {
+		t.Fatalf("bad: %#v", blob.KeyInfo)
+	}
+	plaintext, err := s.Decrypt(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "master key" {
+		t.Fatalf("bad: %q", plaintext)
+	}
+
+	// Tampering with the ciphertext is detected
+	blob.Ciphertext[0] ^= 1
+	if _, err := s.Decrypt(blob); err == nil {
+		t.Fatal("expected error")
+	}
+	blob.Ciphertext[0] ^= 1
+
+	// After a change of the key label and the mechanism, the values
+	// encrypted with the previous key stay readable
+	if err := s.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+	if !m.closed {
+		t.Fatal("expected the module to be closed")
+	}
+	config["key_label"] = "vault-2"
+	config["mechanism"] = "CKM_AES_CBC_PAD"
+	s = testSeal(t, m, config)
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.labels) != 2 {
+		t.Fatalf("bad: %#v", m.labels)
+	}
+	plaintext, err = s.Decrypt(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "master key" {
+		t.Fatalf("bad: %q", plaintext)
+	}
+	blob, err = s.Encrypt([]byte("master key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob.KeyInfo.KeyID != "vault-2" || blob.KeyInfo.Mechanism != uint64(CKMAESCBCPad) {
+		t.Fatalf("bad: %#v", blob.KeyInfo)
+	}
+
+	random, err := s.GenerateRandom(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(random) != 32 {
+		t.Fatalf("bad: %d", len(random))
+	}
+}
+
+func TestPKCS11Seal_Config(t *testing.T) {
+	m := &fakeModule{}
+
+	// The key must exist without generate_key
+	s := testSeal(t, m, map[string]string{
+		"lib":         "/usr/lib/libhsm.so",
+		"token_label": "vault-token",
+		"pin":         "1234",
+		"key_label":   "vault",
+	})
+	if err := s.Init(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	for _, config := range []map[string]string{
+		{"slot": "0", "pin": "1234", "key_label": "vault"},
+		{"lib": "/usr/lib/libhsm.so", "pin": "1234", "key_label": "vault"},
+		{"lib": "/usr/lib/libhsm.so", "slot": "0", "token_label": "vault-token", "pin": "1234", "key_label": "vault"},
+		{"lib": "/usr/lib/libhsm.so", "slot": "0", "key_label": "vault"},
+		{"lib": "/usr/lib/libhsm.so", "slot": "0", "pin": "1234"},
+		{"lib": "/usr/lib/libhsm.so", "slot": "0", "pin": "1234", "key_label": "vault", "mechanism": "CKM_RSA_PKCS"},
+		{"lib": "/usr/lib/libhsm.so", "slot": "0", "pin": "1234", "key_label": "vault", "regenerate_key": "true"},
+	} {
+		if _, err := NewSeal(logformat.NewVaultLogger(log.LevelTrace)).SetConfig(config); err == nil {
+			t.Fatalf("expected error with %#v", config)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Package seal defines the access to the external key services wrapping the
+// master key of Vault, which lets Vault unseal without unseal keys.
+package seal
+
+import "errors"
+
+const (
+	Shamir        = "shamir"
+	AWSKMS        = "awskms"
+	GCPCKMS       = "gcpckms"
+	AzureKeyVault = "azurekeyvault"
+	Transit       = "transit"
+	PKCS11        = "pkcs11"
+	Test          = "test-auto"
+)
+
+// ErrKeyNotFound is returned when the key of a seal doesn't exist or can't be
+// used by Vault
+var ErrKeyNotFound = errors.New("seal key not found")
+
+// Access is the access to the key service of a seal. The key service only
+// wraps the data keys of the values it encrypts, which are encrypted locally.
+type Access interface {
+	// SealType returns the type of the seal, such as "awskms"
+	SealType() string
+
+	// KeyID returns the identifier of the key currently used to encrypt
+	KeyID() string
+
+	// Init checks the access to the key service. It is called before the
+	// seal is used.
+	Init() error
+
+	// Finalize releases the resources of the seal
+	Finalize() error
+
+	Encrypt(plaintext []byte) (*EncryptedBlobInfo, error)
+	Decrypt(in *EncryptedBlobInfo) ([]byte, error)
+}
+
+// EntropySource is implemented by the seals whose key service generates
+// random bytes, which Vault mixes into the randomness of its critical keys
+// when entropy augmentation is enabled
+type EntropySource interface {
+	GenerateRandom(n int) ([]byte, error)
+}
+
+// EncryptedBlobInfo is a value encrypted by a seal
+type EncryptedBlobInfo struct {
+	Ciphertext []byte   `json:"ciphertext"`
+	IV         []byte   `json:"iv"`
+	KeyInfo    *KeyInfo `json:"key_info"`
+}
+
+// KeyInfo identifies the key wrapping the data key of an encrypted value
+type KeyInfo struct {
+	// KeyID is the identifier of the key in the key service, which is needed
+	// to decrypt when the seal key is rotated
+	KeyID string `json:"key_id"`
+
+	// WrappedKey is the data key, encrypted by the key service
+	WrappedKey []byte `json:"wrapped_key"`
+
+	// Mechanism is the mechanism which wrapped the data key, for the key
+	// services supporting several
+	Mechanism uint64 `json:"mechanism,omitempty"`
+}
@@ -0,0 +1,125 @@
+package seal
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+)
+
+// TestSeal is a seal whose key service is an in-memory key, for tests
+type TestSeal struct {
+	l     sync.Mutex
+	keys  map[string][]byte
+	keyID string
+}
+
+// NewTestSeal returns a test seal with a new key
+func NewTestSeal() *TestSeal {
+	s := &TestSeal{
+		keys: make(map[string][]byte),
+	}
+	s.RotateKey()
+	return s
+}
+
+// RotateKey makes the seal encrypt with a new key, keeping the previous ones
+// to decrypt
+func (s *TestSeal) RotateKey() {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	s.keyID = fmt.Sprintf("test-key-%d", len(s.keys)+1)
+	s.keys[s.keyID] = key
+}
+
+func (s *TestSeal) SealType() string {
+	return Test
+}
+
+func (s *TestSeal) KeyID() string {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	return s.keyID
+}
+
+func (s *TestSeal) Init() error {
+	return nil
+}
+
+func (s *TestSeal) Finalize() error {
+	return nil
+}
+
+func (s *TestSeal) Encrypt(plaintext []byte) (*EncryptedBlobInfo, error) {
+	env, err := EnvelopeEncrypt(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	s.l.Lock()
+	keyID, key := s.keyID, s.keys[s.keyID]
+	s.l.Unlock()
+
+	wrapped, err := wrapTestKey(key, env.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedBlobInfo{
+		Ciphertext: env.Ciphertext,
+		IV:         env.IV,
+		KeyInfo: &KeyInfo{
+			KeyID:      keyID,
+			WrappedKey: wrapped,
+		},
+	}, nil
+}
+
+func (s *TestSeal) Decrypt(in *EncryptedBlobInfo) ([]byte, error) {
+	if in.KeyInfo == nil {
+		return nil, fmt.Errorf("missing key info")
+	}
+
+	s.l.Lock()
+	key, ok := s.keys[in.KeyInfo.KeyID]
+	s.l.Unlock()
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	dataKey, err := unwrapTestKey(key, in.KeyInfo.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	return EnvelopeDecrypt(&EnvelopeInfo{
+		Key:        dataKey,
+		IV:         in.IV,
+		Ciphertext: in.Ciphertext,
+	})
+}
+
+// wrapTestKey encrypts a data key with AES-GCM, prefixing the nonce
+func wrapTestKey(key, dataKey []byte) ([]byte, error) {
+	gcm, err := newEnvelopeGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, dataKey, nil), nil
+}
+
+func unwrapTestKey(key, wrapped []byte) ([]byte, error) {
+	gcm, err := newEnvelopeGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid wrapped key")
+	}
+	return gcm.Open(nil, wrapped[:gcm.NonceSize()], wrapped[gcm.NonceSize():], nil)
+}
@@ -0,0 +1,201 @@
+// Package transit implements a seal encrypting the master key with the
+// transit secret backend of another Vault cluster.
+package transit
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/vault/seal"
+	log "github.com/mgutz/logxi/v1"
+)
+
+const (
+	// The environment variables of the configuration
+	EnvTransitSealKeyName   = "VAULT_TRANSIT_SEAL_KEY_NAME"
+	EnvTransitSealMountPath = "VAULT_TRANSIT_SEAL_MOUNT_PATH"
+)
+
+// TransitSeal is a seal encrypting the values with a key of the transit
+// secret backend of another Vault cluster
+type TransitSeal struct {
+	client *api.Client
+	logger log.Logger
+
+	mountPath string
+	keyName   string
+
+	// keyID is the name and latest version of the key
+	keyID atomic.Value
+}
+
+var _ seal.Access = (*TransitSeal)(nil)
+
+// NewSeal creates a new transit seal, which must be configured with SetConfig
+func NewSeal(logger log.Logger) *TransitSeal {
+	s := &TransitSeal{
+		logger: logger,
+	}
+	s.keyID.Store("")
+	return s
+}
+
+// SetConfig configures the seal from the "address", "token", "key_name" and
+// "mount_path" parameters, and the "tls_*" parameters of the connection to
+// the Vault cluster. The parameters default to the VAULT_* environment
+// variables of the API client. It returns the information to display about
+// the seal.
+func (s *TransitSeal) SetConfig(config map[string]string) (map[string]string, error) {
+	if config == nil {
+		config = map[string]string{}
+	}
+
+	s.keyName = config["key_name"]
+	if s.keyName == "" {
+		s.keyName = os.Getenv(EnvTransitSealKeyName)
+	}
+	if s.keyName == "" {
+		return nil, fmt.Errorf("'key_name' not found for transit seal configuration")
+	}
+	s.mountPath = config["mount_path"]
+	if s.mountPath == "" {
+		s.mountPath = os.Getenv(EnvTransitSealMountPath)
+	}
+	if s.mountPath == "" {
+		s.mountPath = "transit"
+	}
+	s.mountPath = strings.Trim(s.mountPath, "/")
+
+	apiConfig := api.DefaultConfig()
+	if err := apiConfig.ReadEnvironment(); err != nil {
+		return nil, fmt.Errorf("error reading environment: %v", err)
+	}
+	if config["address"] != "" {
+		apiConfig.Address = config["address"]
+	}
+	tlsConfig := &api.TLSConfig{
+		CACert:        config["tls_ca_cert"],
+		ClientCert:    config["tls_client_cert"],
+		ClientKey:     config["tls_client_key"],
+		TLSServerName: config["tls_server_name"],
+	}
+	if config["tls_skip_verify"] != "" {
+		var err error
+		tlsConfig.Insecure, err = strconv.ParseBool(config["tls_skip_verify"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'tls_skip_verify' value: %v", err)
+		}
+	}
+	if tlsConfig.CACert != "" || tlsConfig.ClientCert != "" || tlsConfig.TLSServerName != "" || tlsConfig.Insecure {
+		if err := apiConfig.ConfigureTLS(tlsConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := api.NewClient(apiConfig)
+	if err != nil {
+		return nil, err
+	}
+	if config["token"] != "" {
+		client.SetToken(config["token"])
+	}
+	if client.Token() == "" {
+		return nil, fmt.Errorf("'token' not found for transit seal configuration")
+	}
+	s.client = client
+
+	return map[string]string{
+		"Address":    client.Address(),
+		"Mount Path": s.mountPath,
+		"Key Name":   s.keyName,
+	}, nil
+}
+
+// Init checks that the key exists and supports encryption
+func (s *TransitSeal) Init() error {
+	secret, err := s.client.Logical().Read(s.mountPath + "/keys/" + s.keyName)
+	if err != nil {
+		return fmt.Errorf("error reading transit key %q: %v", s.keyName, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return seal.ErrKeyNotFound
+	}
+	if supported, _ := secret.Data["supports_encryption"].(bool); !supported {
+		return fmt.Errorf("transit key %q doesn't support encryption", s.keyName)
+	}
+	s.keyID.Store(fmt.Sprintf("%s:%v", s.keyName, secret.Data["latest_version"]))
+	return nil
+}
+
+func (s *TransitSeal) Finalize() error {
+	return nil
+}
+
+func (s *TransitSeal) SealType() string {
+	return seal.Transit
+}
+
+func (s *TransitSeal) KeyID() string {
+	return s.keyID.Load().(string)
+}
+
+// Encrypt encrypts the plaintext with the latest version of the key. The
+// ciphertext is the one returned by the transit backend, which carries the
+// version of the key, so no data key is needed.
+func (s *TransitSeal) Encrypt(plaintext []byte) (*seal.EncryptedBlobInfo, error) {
+	if plaintext == nil {
+		return nil, fmt.Errorf("given plaintext for encryption is nil")
+	}
+
+	secret, err := s.client.Logical().Write(s.mountPath+"/encrypt/"+s.keyName, map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString(plaintext),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting with transit key %q: %v", s.keyName, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("empty response encrypting with transit key %q", s.keyName)
+	}
+	ciphertext, ok := secret.Data["ciphertext"].(string)
+	if !ok || ciphertext == "" {
+		return nil, fmt.Errorf("no ciphertext encrypting with transit key %q", s.keyName)
+	}
+
+	// The ciphertext has the form "vault:v<version>:<ciphertext>"
+	keyID := s.keyName
+	if parts := strings.SplitN(ciphertext, ":", 3); len(parts) == 3 {
+		keyID = fmt.Sprintf("%s:%s", s.keyName, strings.TrimPrefix(parts[1], "v"))
+		s.keyID.Store(keyID)
+	}
+
+	return &seal.EncryptedBlobInfo{
+		Ciphertext: []byte(ciphertext),
+		KeyInfo: &seal.KeyInfo{
+			KeyID: keyID,
+		},
+	}, nil
+}
+
+// Decrypt decrypts a value encrypted by Encrypt
+func (s *TransitSeal) Decrypt(in *seal.EncryptedBlobInfo) ([]byte, error) {
+	if in == nil {
+		return nil, fmt.Errorf("given input for decryption is nil")
+	}
+
+	secret, err := s.client.Logical().Write(s.mountPath+"/decrypt/"+s.keyName, map[string]interface{}{
+		"ciphertext": string(in.Ciphertext),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting with transit key %q: %v", s.keyName, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("empty response decrypting with transit key %q", s.keyName)
+	}
+	plaintext, _ := secret.Data["plaintext"].(string)
+	return base64.StdEncoding.DecodeString(plaintext)
+}
@@ -0,0 +1,95 @@
+package transit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	log "github.com/mgutz/logxi/v1"
+)
+
+// fakeTransit serves the transit operations used by the seal, "encrypting"
+// by prefixing the base64 plaintext with the key version
+func fakeTransit(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+
+		var input map[string]string
+		if r.Method == "PUT" {
+			if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var data map[string]interface{}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/v1/seal/keys/unseal":
+			data = map[string]interface{}{
+				"supports_encryption": true,
+				"latest_version":      1,
+			}
+		case r.Method == "PUT" && r.URL.Path == "/v1/seal/encrypt/unseal":
+			data = map[string]interface{}{
+				"ciphertext": "vault:v2:" + input["plaintext"],
+			}
+		case r.Method == "PUT" && r.URL.Path == "/v1/seal/decrypt/unseal":
+			data = map[string]interface{}{
+				"plaintext": strings.TrimPrefix(input["ciphertext"], "vault:v2:"),
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+}
+
+func TestTransitSeal(t *testing.T) {
+	server := fakeTransit(t)
+	defer server.Close()
+
+	s := NewSeal(logformat.NewVaultLogger(log.LevelTrace))
+	if _, err := s.SetConfig(map[string]string{
+		"address":    server.URL,
+		"token":      "root",
+		"mount_path": "/seal/",
+		"key_name":   "unseal",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if s.KeyID() != "unseal:1" {
+		t.Fatalf("bad: %q", s.KeyID())
+	}
+
+	blob, err := s.Encrypt([]byte("master key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob.KeyInfo.KeyID != "unseal:2" || s.KeyID() != "unseal:2" {
+		t.Fatalf("bad: %#v", blob.KeyInfo)
+	}
+	plaintext, err := s.Decrypt(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "master key" {
+		t.Fatalf("bad: %q", plaintext)
+	}
+
+	// Unknown key
+	s.keyName = "unknown"
+	if err := s.Init(); err == nil {
+		t.Fatal("expected error")
+	}
+}
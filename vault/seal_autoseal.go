@@ -0,0 +1,334 @@
+package vault
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/physical"
+	"github.com/hashicorp/vault/vault/seal"
+)
+
+const (
+	// storedBarrierKeysPath is the path used to store the unseal keys of the
+	// barrier, encrypted by an auto seal. It is outside of the barrier, so
+	// that Vault can unseal itself on start.
+	storedBarrierKeysPath = "core/stored-barrier-keys"
+)
+
+// autoSeal is a seal which stores the unseal keys of the barrier encrypted by
+// an external key service, so that Vault unseals itself on start. Operations
+// needing unseal keys, such as generating a root token, use recovery keys
+// instead.
+type autoSeal struct {
+	seal.Access
+
+	core *Core
+
+	configLock     sync.Mutex
+	config         *SealConfig
+	recoveryConfig *SealConfig
+}
+
+var _ Seal = (*autoSeal)(nil)
+
+// NewAutoSeal returns a seal storing the unseal keys with the key service of
+// the given access
+func NewAutoSeal(access seal.Access) Seal {
+	return &autoSeal{
+		Access: access,
+	}
+}
+
+func (d *autoSeal) checkCore() error {
+	if d.core == nil {
+		return fmt.Errorf("seal does not have a core set")
+	}
+	return nil
+}
+
+func (d *autoSeal) SetCore(core *Core) {
+	d.core = core
+}
+
+func (d *autoSeal) Init() error {
+	return d.Access.Init()
+}
+
+func (d *autoSeal) Finalize() error {
+	return d.Access.Finalize()
+}
+
+func (d *autoSeal) BarrierType() string {
+	return d.SealType()
+}
+
+func (d *autoSeal) StoredKeysSupported() bool {
+	return true
+}
+
+func (d *autoSeal) RecoveryKeySupported() bool {
+	return true
+}
+
+// putEncrypted stores the value encrypted by the seal at the given path of
+// the physical backend
+func (d *autoSeal) putEncrypted(path string, value []byte) error {
+	blob, err := d.Encrypt(value)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt with the seal: %v", err)
+	}
+	buf, err := json.Marshal(blob)
+	if err != nil {
+		return fmt.Errorf("failed to encode encrypted value: %v", err)
+	}
+	return d.core.physical.Put(&physical.Entry{
+		Key:   path,
+		Value: buf,
+	})
+}
+
+// getEncrypted returns the value stored by putEncrypted at the given path of
+// the physical backend, or nil if there is none
+func (d *autoSeal) getEncrypted(path string) ([]byte, error) {
+	pe, err := d.core.physical.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	if pe == nil {
+		return nil, nil
+	}
+
+	var blob seal.EncryptedBlobInfo
+	if err := jsonutil.DecodeJSON(pe.Value, &blob); err != nil {
+		return nil, fmt.Errorf("failed to decode encrypted value: %v", err)
+	}
+	value, err := d.Decrypt(&blob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt with the seal: %v", err)
+	}
+	return value, nil
+}
+
+func (d *autoSeal) SetStoredKeys(keys [][]byte) error {
+	if err := d.checkCore(); err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("failed to encode stored keys: %v", err)
+	}
+	if err := d.putEncrypted(storedBarrierKeysPath, buf); err != nil {
+		d.core.logger.Error("core: failed to write stored keys", "error", err)
+		return fmt.Errorf("failed to write stored keys: %v", err)
+	}
+	return nil
+}
+
+func (d *autoSeal) GetStoredKeys() ([][]byte, error) {
+	if err := d.checkCore(); err != nil {
+		return nil, err
+	}
+
+	buf, err := d.getEncrypted(storedBarrierKeysPath)
+	if err != nil {
+		d.core.logger.Error("core: failed to read stored keys", "error", err)
+		return nil, fmt.Errorf("failed to read stored keys: %v", err)
+	}
+	if buf == nil {
+		return nil, nil
+	}
+
+	var keys [][]byte
+	if err := jsonutil.DecodeJSON(buf, &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode stored keys: %v", err)
+	}
+	return keys, nil
+}
+
+// readConfig reads the seal configuration of the given type at the given path
+// of the physical backend
+func (d *autoSeal) readConfig(path, sealType string) (*SealConfig, error) {
+	pe, err := d.core.physical.Get(path)
+	if err != nil {
+		d.core.logger.Error("core: failed to read seal configuration", "path", path, "error", err)
+		return nil, fmt.Errorf("failed to check seal configuration: %v", err)
+	}
+	if pe == nil {
+		return nil, nil
+	}
+
+	var conf SealConfig
+	if err := jsonutil.DecodeJSON(pe.Value, &conf); err != nil {
+		d.core.logger.Error("core: failed to decode seal configuration", "path", path, "error", err)
+		return nil, fmt.Errorf("failed to decode seal configuration: %v", err)
+	}
+
+	if conf.Type != sealType {
+		d.core.logger.Error("core: seal type does not match loaded type", "path", path, "seal_type", conf.Type, "loaded_seal_type", sealType)
+		return nil, fmt.Errorf("seal type of %s does not match loaded type of %s", conf.Type, sealType)
+	}
+
+	if err := conf.Validate(); err != nil {
+		d.core.logger.Error("core: invalid seal configuration", "path", path, "error", err)
+		return nil, fmt.Errorf("seal validation failed: %v", err)
+	}
+	return &conf, nil
+}
+
+// writeConfig stores the seal configuration at the given path of the physical
+// backend
+func (d *autoSeal) writeConfig(path string, config *SealConfig) error {
+	buf, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to encode seal configuration: %v", err)
+	}
+	if err := d.core.physical.Put(&physical.Entry{
+		Key:   path,
+		Value: buf,
+	}); err != nil {
+		d.core.logger.Error("core: failed to write seal configuration", "path", path, "error", err)
+		return fmt.Errorf("failed to write seal configuration: %v", err)
+	}
+	return nil
+}
+
+func (d *autoSeal) BarrierConfig() (*SealConfig, error) {
+	d.configLock.Lock()
+	defer d.configLock.Unlock()
+
+	if d.config != nil {
+		return d.config.Clone(), nil
+	}
+
+	if err := d.checkCore(); err != nil {
+		return nil, err
+	}
+
+	conf, err := d.readConfig(barrierSealConfigPath, d.BarrierType())
+	if err != nil {
+		return nil, err
+	}
+
+	// If the seal configuration is missing, we are not initialized
+	if conf == nil {
+		d.core.logger.Info("core: seal configuration missing, not initialized")
+		return nil, nil
+	}
+
+	d.config = conf
+	return d.config.Clone(), nil
+}
+
+func (d *autoSeal) SetBarrierConfig(config *SealConfig) error {
+	d.configLock.Lock()
+	defer d.configLock.Unlock()
+
+	if err := d.checkCore(); err != nil {
+		return err
+	}
+
+	// Provide a way to wipe out the cached value (also prevents actually
+	// saving a nil config)
+	if config == nil {
+		d.config = nil
+		return nil
+	}
+
+	config.Type = d.BarrierType()
+	if err := d.writeConfig(barrierSealConfigPath, config); err != nil {
+		return err
+	}
+
+	d.config = config.Clone()
+	return nil
+}
+
+func (d *autoSeal) RecoveryType() string {
+	return seal.Shamir
+}
+
+func (d *autoSeal) RecoveryConfig() (*SealConfig, error) {
+	d.configLock.Lock()
+	defer d.configLock.Unlock()
+
+	if d.recoveryConfig != nil {
+		return d.recoveryConfig.Clone(), nil
+	}
+
+	if err := d.checkCore(); err != nil {
+		return nil, err
+	}
+
+	conf, err := d.readConfig(recoverySealConfigPath, d.RecoveryType())
+	if err != nil || conf == nil {
+		return nil, err
+	}
+
+	d.recoveryConfig = conf
+	return d.recoveryConfig.Clone(), nil
+}
+
+func (d *autoSeal) SetRecoveryConfig(config *SealConfig) error {
+	d.configLock.Lock()
+	defer d.configLock.Unlock()
+
+	if err := d.checkCore(); err != nil {
+		return err
+	}
+
+	// Provide a way to wipe out the cached value (also prevents actually
+	// saving a nil config)
+	if config == nil {
+		d.recoveryConfig = nil
+		return nil
+	}
+
+	config.Type = d.RecoveryType()
+	if err := d.writeConfig(recoverySealConfigPath, config); err != nil {
+		return err
+	}
+
+	d.recoveryConfig = config.Clone()
+	return nil
+}
+
+func (d *autoSeal) SetRecoveryKey(key []byte) error {
+	if err := d.checkCore(); err != nil {
+		return err
+	}
+
+	if len(key) == 0 {
+		return fmt.Errorf("recovery key to store is empty")
+	}
+	if err := d.putEncrypted(recoveryKeyPath, key); err != nil {
+		d.core.logger.Error("core: failed to write recovery key", "error", err)
+		return fmt.Errorf("failed to write recovery key: %v", err)
+	}
+	return nil
+}
+
+func (d *autoSeal) VerifyRecoveryKey(key []byte) error {
+	if err := d.checkCore(); err != nil {
+		return err
+	}
+
+	if len(key) == 0 {
+		return fmt.Errorf("recovery key to verify is empty")
+	}
+	stored, err := d.getEncrypted(recoveryKeyPath)
+	if err != nil {
+		d.core.logger.Error("core: failed to read recovery key", "error", err)
+		return fmt.Errorf("failed to read recovery key: %v", err)
+	}
+	if stored == nil {
+		return fmt.Errorf("no recovery key found")
+	}
+	if subtle.ConstantTimeCompare(key, stored) != 1 {
+		return fmt.Errorf("recovery key verification failed")
+	}
+	return nil
+}
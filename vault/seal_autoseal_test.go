@@ -0,0 +1,105 @@
+package vault
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/physical"
+	"github.com/hashicorp/vault/shamir"
+	"github.com/hashicorp/vault/vault/seal"
+	log "github.com/mgutz/logxi/v1"
+)
+
+func TestAutoSeal(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	inm := physical.NewInmem(logger)
+	access := seal.NewTestSeal()
+
+	conf := testCoreConfig(t, inm, logger)
+	conf.Seal = NewAutoSeal(access)
+	core, err := NewCore(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := core.Initialize(&InitParams{
+		BarrierConfig: &SealConfig{
+			SecretShares:    1,
+			SecretThreshold: 1,
+			StoredShares:    1,
+		},
+		RecoveryConfig: &SealConfig{
+			SecretShares:    3,
+			SecretThreshold: 2,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.SecretShares) != 0 || len(result.RecoveryShares) != 3 {
+		t.Fatalf("bad: %#v", result)
+	}
+	if err := core.UnsealWithStoredKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if sealed, _ := core.Sealed(); sealed {
+		t.Fatal("should not be sealed")
+	}
+
+	// The configurations are readable while sealed
+	core.seal.SetBarrierConfig(nil)
+	core.seal.SetRecoveryConfig(nil)
+	barrierConfig, err := core.SealAccess().BarrierConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if barrierConfig.Type != seal.Test || barrierConfig.StoredShares != 1 {
+		t.Fatalf("bad: %#v", barrierConfig)
+	}
+	recoveryConfig, err := core.SealAccess().RecoveryConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recoveryConfig.Type != seal.Shamir || recoveryConfig.SecretThreshold != 2 {
+		t.Fatalf("bad: %#v", recoveryConfig)
+	}
+
+	// The recovery key is stored encrypted
+	recoveryKey, err := shamir.Combine(result.RecoveryShares[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe, err := inm.Get(recoveryKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pe == nil || bytes.Contains(pe.Value, recoveryKey) {
+		t.Fatalf("bad: %#v", pe)
+	}
+	if err := core.seal.VerifyRecoveryKey(recoveryKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := core.seal.VerifyRecoveryKey(result.RecoveryShares[0]); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// A new core unseals itself, even after the seal key is rotated
+	access.RotateKey()
+	conf = testCoreConfig(t, inm, logger)
+	conf.Seal = NewAutoSeal(access)
+	core, err = NewCore(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed, _ := core.Sealed(); sealed {
+		t.Fatal("should not be sealed")
+	}
+
+	// Without the seal key, the core stays sealed
+	conf = testCoreConfig(t, inm, logger)
+	conf.Seal = NewAutoSeal(seal.NewTestSeal())
+	if _, err := NewCore(conf); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,254 @@
+package vault
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/shamir"
+	"github.com/hashicorp/vault/vault/seal"
+)
+
+// storedSealType returns the type of the seal of the stored data, or an
+// empty string if Vault is not initialized
+func (c *Core) storedSealType() (string, error) {
+	pe, err := c.physical.Get(barrierSealConfigPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read seal configuration: %v", err)
+	}
+	if pe == nil {
+		return "", nil
+	}
+
+	var conf SealConfig
+	if err := jsonutil.DecodeJSON(pe.Value, &conf); err != nil {
+		return "", fmt.Errorf("failed to decode seal configuration: %v", err)
+	}
+	if conf.Type == "" {
+		return seal.Shamir, nil
+	}
+	return conf.Type, nil
+}
+
+// setupSealMigration checks whether the configured seal is the seal of the
+// stored data. When it isn't, the stored data must be sealed by the given
+// migration seal, or by Shamir when migrating to an auto seal, and the core
+// uses that seal until unsealing with the migrate option migrates the data.
+func (c *Core) setupSealMigration(migrationSeal Seal) error {
+	// Without a disabled seal, only migrating to an auto seal is possible
+	if migrationSeal == nil && c.seal.BarrierType() == seal.Shamir {
+		return nil
+	}
+
+	storedType, err := c.storedSealType()
+	if err != nil {
+		c.logger.Error("core: failed to check for seal migration", "error", err)
+		return &NonFatalError{Err: fmt.Errorf("failed to check for seal migration: %v", err)}
+	}
+	if storedType == "" || storedType == c.seal.BarrierType() {
+		if migrationSeal != nil && storedType != "" {
+			c.logger.Warn("core: seal migration is complete, the disabled seal can be removed from the configuration", "seal_type", c.seal.BarrierType())
+		}
+		return nil
+	}
+
+	if migrationSeal == nil && storedType == seal.Shamir {
+		migrationSeal = &DefaultSeal{}
+	}
+	if migrationSeal == nil || migrationSeal.BarrierType() != storedType {
+		return fmt.Errorf("seal type of %s does not match configured seal type of %s", storedType, c.seal.BarrierType())
+	}
+
+	migrationSeal.SetCore(c)
+	c.migrationTargetSeal = c.seal
+	c.seal = migrationSeal
+	if c.logger.IsInfo() {
+		c.logger.Info("core: seal migration pending, unseal with the migrate option", "from", storedType, "to", c.migrationTargetSeal.BarrierType())
+	}
+	return nil
+}
+
+// SealMigrationPending returns whether the stored data must be migrated to
+// the configured seal by unsealing with the migrate option
+func (c *Core) SealMigrationPending() bool {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+	return c.migrationTargetSeal != nil
+}
+
+// UnsealWithMigration is used to provide one of the key parts to unseal the
+// Vault while migrating its seal. The parts are the unseal keys when
+// migrating from Shamir, and the recovery keys when migrating from an auto
+// seal. Once enough parts are provided, the stored data is migrated to the
+// configured seal and the Vault is unsealed.
+//
+// They key given as a parameter will automatically be zerod after
+// this method is done with it. If you want to keep the key around, a copy
+// should be made.
+func (c *Core) UnsealWithMigration(key []byte) (bool, error) {
+	defer metrics.MeasureSince([]string{"core", "unseal-with-migration"}, time.Now())
+
+	if err := c.checkKeyLength(key); err != nil {
+		return false, err
+	}
+
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	// Check if already unsealed
+	if !c.sealed {
+		return true, nil
+	}
+
+	if c.migrationTargetSeal == nil {
+		return false, ErrNoSealMigration
+	}
+
+	// Migrating from an auto seal needs the recovery keys
+	var config *SealConfig
+	var err error
+	if c.seal.RecoveryKeySupported() {
+		config, err = c.seal.RecoveryConfig()
+	} else {
+		config, err = c.seal.BarrierConfig()
+	}
+	if err != nil {
+		return false, err
+	}
+	if config == nil {
+		return false, ErrNotInit
+	}
+
+	combinedKey, err := c.unsealPart(config, key)
+	if err != nil || combinedKey == nil {
+		return false, err
+	}
+
+	masterKey, err := c.migrateSeal(combinedKey)
+	if err != nil {
+		return false, err
+	}
+	return c.unsealInternal(masterKey)
+}
+
+// migrateSeal migrates the stored data to the target seal given the combined
+// unseal or recovery key, and returns the master key of the barrier. It must
+// be called with the state write lock held.
+func (c *Core) migrateSeal(combinedKey []byte) ([]byte, error) {
+	defer memzero(combinedKey)
+
+	from, to := c.seal, c.migrationTargetSeal
+
+	// Another node may have migrated the stored data in the meantime
+	storedType, err := c.storedSealType()
+	if err != nil {
+		return nil, err
+	}
+	if storedType != from.BarrierType() {
+		return nil, fmt.Errorf("stored data is sealed by %s instead of %s, the seal migration may have been completed by another node", storedType, from.BarrierType())
+	}
+
+	// Recover the master key, and the configuration of the keys the operators
+	// hold, which become the recovery keys or the unseal keys of the new seal
+	var masterKey []byte
+	var keysConfig *SealConfig
+	if from.RecoveryKeySupported() {
+		if err := from.VerifyRecoveryKey(combinedKey); err != nil {
+			return nil, fmt.Errorf("recovery key verification failed: %v", err)
+		}
+		keysConfig, err = from.RecoveryConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		storedKeys, err := from.GetStoredKeys()
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch stored keys: %v", err)
+		}
+		switch len(storedKeys) {
+		case 0:
+			return nil, fmt.Errorf("no stored keys found")
+		case 1:
+			masterKey = storedKeys[0]
+		default:
+			masterKey, err = shamir.Combine(storedKeys)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compute master key: %v", err)
+			}
+		}
+	} else {
+		keysConfig, err = from.BarrierConfig()
+		if err != nil {
+			return nil, err
+		}
+		masterKey = make([]byte, len(combinedKey))
+		copy(masterKey, combinedKey)
+	}
+	keysConfig = &SealConfig{
+		SecretShares:    keysConfig.SecretShares,
+		SecretThreshold: keysConfig.SecretThreshold,
+	}
+
+	if err := c.barrier.Unseal(masterKey); err != nil {
+		memzero(masterKey)
+		return nil, err
+	}
+	defer func() {
+		if err := c.barrier.Seal(); err != nil {
+			c.logger.Error("core: failed to seal barrier after seal migration", "error", err)
+		}
+	}()
+
+	// The barrier configuration is written last, since its type tells which
+	// seal the stored data is sealed by
+	if to.StoredKeysSupported() {
+		if err := to.SetStoredKeys([][]byte{masterKey}); err != nil {
+			memzero(masterKey)
+			return nil, fmt.Errorf("failed to store keys: %v", err)
+		}
+		if err := to.SetRecoveryKey(combinedKey); err != nil {
+			memzero(masterKey)
+			return nil, fmt.Errorf("failed to store recovery key: %v", err)
+		}
+		if err := to.SetRecoveryConfig(keysConfig); err != nil {
+			memzero(masterKey)
+			return nil, fmt.Errorf("failed to save recovery configuration: %v", err)
+		}
+		if err := to.SetBarrierConfig(&SealConfig{
+			SecretShares:    1,
+			SecretThreshold: 1,
+			StoredShares:    1,
+		}); err != nil {
+			memzero(masterKey)
+			return nil, fmt.Errorf("failed to save barrier configuration: %v", err)
+		}
+	} else {
+		// The recovery keys become the unseal keys, so the recovery key
+		// becomes the master key
+		if err := c.barrier.Rekey(combinedKey); err != nil {
+			memzero(masterKey)
+			return nil, fmt.Errorf("failed to rekey barrier: %v", err)
+		}
+		memzero(masterKey)
+		masterKey = make([]byte, len(combinedKey))
+		copy(masterKey, combinedKey)
+
+		if err := to.SetBarrierConfig(keysConfig); err != nil {
+			memzero(masterKey)
+			return nil, fmt.Errorf("failed to save barrier configuration: %v", err)
+		}
+		for _, path := range []string{storedBarrierKeysPath, recoveryKeyPath, recoverySealConfigPath} {
+			if err := c.physical.Delete(path); err != nil {
+				c.logger.Warn("core: failed to delete entry of previous seal", "path", path, "error", err)
+			}
+		}
+	}
+
+	c.seal = to
+	c.migrationTargetSeal = nil
+	if c.logger.IsInfo() {
+		c.logger.Info("core: seal migration complete", "from", from.BarrierType(), "to", to.BarrierType())
+	}
+	return masterKey, nil
+}
@@ -0,0 +1,188 @@
+package vault
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/helper/logformat"
+	"github.com/hashicorp/vault/physical"
+	"github.com/hashicorp/vault/vault/seal"
+	log "github.com/mgutz/logxi/v1"
+)
+
+// otherTestSeal is a test seal of another type, to migrate between auto seals
+type otherTestSeal struct {
+	*seal.TestSeal
+}
+
+func (s *otherTestSeal) SealType() string {
+	return "other-test-auto"
+}
+
+func TestSealMigration(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	inm := physical.NewInmem(logger)
+
+	newCore := func(s, migrationSeal Seal) *Core {
+		conf := testCoreConfig(t, inm, logger)
+		conf.Seal = s
+		conf.MigrationSeal = migrationSeal
+		core, err := NewCore(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return core
+	}
+	unsealWithMigration := func(core *Core, keys ...[]byte) {
+		if !core.SealMigrationPending() {
+			t.Fatal("expected pending seal migration")
+		}
+		for i, key := range keys {
+			unsealed, err := core.UnsealWithMigration(TestKeyCopy(key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if unsealed != (i == len(keys)-1) {
+				t.Fatalf("bad: %d %v", i, unsealed)
+			}
+		}
+		if core.SealMigrationPending() {
+			t.Fatal("expected complete seal migration")
+		}
+	}
+	checkType := func(core *Core, sealType string) {
+		config, err := core.SealAccess().BarrierConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Type != sealType {
+			t.Fatalf("bad: %#v", config)
+		}
+	}
+
+	core := newCore(nil, nil)
+	result, err := core.Initialize(&InitParams{
+		BarrierConfig: &SealConfig{
+			SecretShares:    3,
+			SecretThreshold: 2,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := result.SecretShares
+
+	// Shamir to auto seal, the unseal keys becoming the recovery keys
+	access := seal.NewTestSeal()
+	core = newCore(NewAutoSeal(access), nil)
+	if _, err := core.Unseal(TestKeyCopy(keys[0])); err != ErrSealMigrationPending {
+		t.Fatalf("bad: %v", err)
+	}
+	unsealWithMigration(core, keys[0], keys[1])
+	checkType(core, seal.Test)
+	recoveryConfig, err := core.SealAccess().RecoveryConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recoveryConfig.SecretShares != 3 || recoveryConfig.SecretThreshold != 2 {
+		t.Fatalf("bad: %#v", recoveryConfig)
+	}
+
+	// The new seal unseals on start
+	core = newCore(NewAutoSeal(access), nil)
+	if sealed, _ := core.Sealed(); sealed {
+		t.Fatal("should not be sealed")
+	}
+	if _, err := core.UnsealWithMigration(TestKeyCopy(keys[0])); err != nil {
+		t.Fatal(err)
+	}
+
+	// Auto seal to another auto seal, with the recovery keys
+	otherAccess := &otherTestSeal{seal.NewTestSeal()}
+	core = newCore(NewAutoSeal(otherAccess), NewAutoSeal(access))
+	if sealed, _ := core.Sealed(); !sealed {
+		t.Fatal("should be sealed")
+	}
+	unsealWithMigration(core, keys[0], keys[2])
+	checkType(core, "other-test-auto")
+	core = newCore(NewAutoSeal(otherAccess), nil)
+	if sealed, _ := core.Sealed(); sealed {
+		t.Fatal("should not be sealed")
+	}
+
+	// The previous seal can't be used anymore
+	conf := testCoreConfig(t, inm, logger)
+	conf.Seal = NewAutoSeal(access)
+	if _, err := NewCore(conf); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// Auto seal to Shamir, the recovery keys becoming the unseal keys
+	core = newCore(nil, NewAutoSeal(otherAccess))
+	if _, err := core.UnsealWithMigration(TestKeyCopy(keys[1])); err != nil {
+		t.Fatal(err)
+	}
+	core.ResetUnsealProcess()
+	unsealWithMigration(core, keys[1], keys[2])
+	checkType(core, seal.Shamir)
+	for _, path := range []string{storedBarrierKeysPath, recoveryKeyPath, recoverySealConfigPath} {
+		if pe, err := inm.Get(path); err != nil || pe != nil {
+			t.Fatalf("bad: %s %#v %v", path, pe, err)
+		}
+	}
+
+	core = newCore(nil, nil)
+	if core.SealMigrationPending() {
+		t.Fatal("expected no seal migration")
+	}
+	for _, key := range keys[:2] {
+		if _, err := core.Unseal(TestKeyCopy(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sealed, _ := core.Sealed(); sealed {
+		t.Fatal("should not be sealed")
+	}
+}
+
+func TestSealMigration_WrongKeys(t *testing.T) {
+	logger := logformat.NewVaultLogger(log.LevelTrace)
+	inm := physical.NewInmem(logger)
+
+	conf := testCoreConfig(t, inm, logger)
+	core, err := NewCore(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := core.Initialize(&InitParams{
+		BarrierConfig: &SealConfig{
+			SecretShares:    1,
+			SecretThreshold: 1,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	conf = testCoreConfig(t, inm, logger)
+	conf.Seal = NewAutoSeal(seal.NewTestSeal())
+	core, err = NewCore(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := core.barrier.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := core.UnsealWithMigration(key); err == nil {
+		t.Fatal("expected error")
+	}
+	if !core.SealMigrationPending() {
+		t.Fatal("expected pending seal migration")
+	}
+	config, err := core.SealAccess().BarrierConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Type != seal.Shamir {
+		t.Fatalf("bad: %#v", config)
+	}
+}
@@ -0,0 +1,477 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/secretsync"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+var secretsSyncPath = "core/secrets-sync/"
+
+const (
+	syncStatusSynced   = "SYNCED"
+	syncStatusDeleted  = "DELETED"
+	syncStatusFailed   = "FAILED"
+	syncDriftInSync    = "IN_SYNC"
+	syncDriftDrifted   = "DRIFTED"
+	syncDriftMissing   = "MISSING"
+	syncDriftUnchecked = "UNCHECKED"
+)
+
+// SyncDestinationEntry is the configuration of an external secret store that
+// KV secrets are pushed to
+type SyncDestinationEntry struct {
+	// Type is the secretsync provider type, such as "aws-sm"
+	Type string `json:"type"`
+	Name string `json:"name"`
+
+	// Parameters are passed to the provider to access the store
+	Parameters map[string]string `json:"parameters"`
+
+	// Fields lists the fields of secrets pushed to the destination, or all
+	// fields if it is empty
+	Fields []string `json:"fields"`
+
+	// Associations are the secrets pushed to the destination, keyed by
+	// their mount and path
+	Associations map[string]*SyncAssociation `json:"associations"`
+}
+
+// SyncAssociation is a KV secret pushed to a destination, and the result of
+// the last push
+type SyncAssociation struct {
+	Mount string `json:"mount"`
+	Path  string `json:"path"`
+
+	// SecretName is the name of the secret in the destination
+	SecretName string `json:"secret_name"`
+
+	SyncStatus string    `json:"sync_status"`
+	LastError  string    `json:"last_error"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// SecretsSyncManager pushes KV secrets to external secret stores when they
+// are associated with a destination, and again every time they change
+type SecretsSyncManager struct {
+	core *Core
+	view *BarrierView
+
+	// lock guards the destination entries and serializes the pushes
+	lock sync.Mutex
+
+	// destinations holds the destinations created from the configured
+	// entries, so that providers are not set up again for each push
+	destinations map[string]secretsync.Destination
+
+	// index maps the mount and path of associated secrets to the keys of
+	// their destinations, so that writes to other secrets are not delayed
+	indexLock sync.RWMutex
+	index     map[string][]string
+
+	// pending tracks the pushes triggered by writes
+	pending sync.WaitGroup
+}
+
+func (c *Core) setupSecretsSync() error {
+	c.secretsSync = &SecretsSyncManager{
+		core:         c,
+		view:         NewBarrierView(c.barrier, secretsSyncPath),
+		destinations: map[string]secretsync.Destination{},
+	}
+
+	return c.secretsSync.rebuildIndex()
+}
+
+func syncDestinationKey(destType, name string) string {
+	return destType + "/" + name
+}
+
+// Get retrieves the configuration of the named destination, or nil if it does
+// not exist
+func (m *SecretsSyncManager) Get(destType, name string) (*SyncDestinationEntry, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.get(syncDestinationKey(destType, name))
+}
+
+func (m *SecretsSyncManager) get(key string) (*SyncDestinationEntry, error) {
+	out, err := m.view.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve sync destination %q: %v", key, err)
+	}
+	if out == nil {
+		return nil, nil
+	}
+
+	entry := new(SyncDestinationEntry)
+	if err := jsonutil.DecodeJSON(out.Value, entry); err != nil {
+		return nil, fmt.Errorf("failed to decode sync destination entry: %v", err)
+	}
+	if entry.Associations == nil {
+		entry.Associations = map[string]*SyncAssociation{}
+	}
+	return entry, nil
+}
+
+func (m *SecretsSyncManager) put(entry *SyncDestinationEntry) error {
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode sync destination entry: %v", err)
+	}
+
+	if err := m.view.Put(&logical.StorageEntry{
+		Key:   syncDestinationKey(entry.Type, entry.Name),
+		Value: buf,
+	}); err != nil {
+		return fmt.Errorf("failed to persist sync destination entry: %v", err)
+	}
+	return nil
+}
+
+// Set creates a destination, or updates the configuration of an existing
+// one. The secrets associated with an existing destination are pushed again.
+func (m *SecretsSyncManager) Set(destType, name string, params map[string]string, fields []string) error {
+	if strings.Contains(name, "..") || strings.Contains(name, "/") {
+		return fmt.Errorf("sync destination names cannot contain \"..\" or \"/\"")
+	}
+	if err := secretsync.ValidateParameters(destType, params); err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key := syncDestinationKey(destType, name)
+	entry, err := m.get(key)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		entry = &SyncDestinationEntry{
+			Type:         destType,
+			Name:         name,
+			Associations: map[string]*SyncAssociation{},
+		}
+	}
+	entry.Parameters = params
+	entry.Fields = fields
+
+	delete(m.destinations, key)
+	for _, assoc := range entry.Associations {
+		if assoc.SyncStatus != syncStatusDeleted {
+			m.push(entry, assoc)
+		}
+	}
+
+	return m.put(entry)
+}
+
+// Delete removes a destination, which must not have associated secrets
+func (m *SecretsSyncManager) Delete(destType, name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key := syncDestinationKey(destType, name)
+	entry, err := m.get(key)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+	if len(entry.Associations) != 0 {
+		return fmt.Errorf("sync destination %q still has associated secrets", key)
+	}
+
+	delete(m.destinations, key)
+	return m.view.Delete(key)
+}
+
+// List returns the keys of the destinations, in the "<type>/<name>" format
+func (m *SecretsSyncManager) List() ([]string, error) {
+	return logical.CollectKeys(m.view)
+}
+
+// Associate pushes the KV secret at the given mount and path to the
+// destination, and again every time it changes. The secret is named after its
+// mount and path in the destination, unless secretName is set.
+func (m *SecretsSyncManager) Associate(destType, name, mount, path, secretName string) (*SyncAssociation, error) {
+	mount = strings.Trim(mount, "/") + "/"
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil, fmt.Errorf("missing secret path")
+	}
+	mountEntry := m.core.router.MatchingMountEntry(mount)
+	if mountEntry == nil || mountEntry.Path != mount || mountEntry.Type != "generic" {
+		return nil, fmt.Errorf("%q is not the path of a KV mount", mount)
+	}
+	if secretName == "" {
+		secretName = secretsync.SecretName(destType, mount, path)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	entry, err := m.get(syncDestinationKey(destType, name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("sync destination %q not found", syncDestinationKey(destType, name))
+	}
+
+	assoc := &SyncAssociation{
+		Mount:      mount,
+		Path:       path,
+		SecretName: secretName,
+	}
+	entry.Associations[mount+path] = assoc
+	m.push(entry, assoc)
+	if err := m.put(entry); err != nil {
+		return nil, err
+	}
+
+	return assoc, m.rebuildIndex()
+}
+
+// Unassociate stops pushing the KV secret at the given mount and path to the
+// destination, and deletes it from the destination
+func (m *SecretsSyncManager) Unassociate(destType, name, mount, path string) error {
+	mount = strings.Trim(mount, "/") + "/"
+	path = strings.Trim(path, "/")
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	entry, err := m.get(syncDestinationKey(destType, name))
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return fmt.Errorf("sync destination %q not found", syncDestinationKey(destType, name))
+	}
+	assoc, ok := entry.Associations[mount+path]
+	if !ok {
+		return nil
+	}
+
+	dest, err := m.destination(entry)
+	if err != nil {
+		return err
+	}
+	if err := dest.Delete(assoc.SecretName); err != nil {
+		return fmt.Errorf("failed to delete secret %q from the destination: %v", assoc.SecretName, err)
+	}
+
+	delete(entry.Associations, mount+path)
+	if err := m.put(entry); err != nil {
+		return err
+	}
+
+	return m.rebuildIndex()
+}
+
+// Drift compares the secrets in the destination with the secrets associated
+// with it, returning the drift status of each association keyed by the mount
+// and path of its secret
+func (m *SecretsSyncManager) Drift(destType, name string) (map[string]string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	entry, err := m.get(syncDestinationKey(destType, name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("sync destination %q not found", syncDestinationKey(destType, name))
+	}
+	dest, err := m.destination(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	drift := make(map[string]string, len(entry.Associations))
+	for key, assoc := range entry.Associations {
+		expected, exists, err := m.secretValue(entry, assoc)
+		if err != nil {
+			drift[key] = syncDriftUnchecked
+			continue
+		}
+
+		actual, err := dest.Get(assoc.SecretName)
+		switch {
+		case err == secretsync.ErrNotFound && !exists:
+			drift[key] = syncDriftInSync
+		case err == secretsync.ErrNotFound:
+			drift[key] = syncDriftMissing
+		case err != nil:
+			drift[key] = syncDriftUnchecked
+		case !exists || actual != expected:
+			drift[key] = syncDriftDrifted
+		default:
+			drift[key] = syncDriftInSync
+		}
+	}
+	return drift, nil
+}
+
+// notify pushes the secret written by a request to its destinations, in the
+// background so that writes are not delayed by the destinations
+func (m *SecretsSyncManager) notify(req *logical.Request) {
+	if req.MountType != "generic" {
+		return
+	}
+	switch req.Operation {
+	case logical.CreateOperation, logical.UpdateOperation, logical.DeleteOperation:
+	default:
+		return
+	}
+
+	key := req.MountPoint + strings.Trim(strings.TrimPrefix(req.Path, req.MountPoint), "/")
+	m.indexLock.RLock()
+	destKeys := m.index[key]
+	m.indexLock.RUnlock()
+	if len(destKeys) == 0 {
+		return
+	}
+
+	m.pending.Add(1)
+	go func() {
+		defer m.pending.Done()
+
+		m.lock.Lock()
+		defer m.lock.Unlock()
+
+		for _, destKey := range destKeys {
+			entry, err := m.get(destKey)
+			if err != nil {
+				m.core.logger.Error("core: failed to sync secret", "path", key, "destination", destKey, "error", err)
+				continue
+			}
+			if entry == nil || entry.Associations[key] == nil {
+				continue
+			}
+			m.push(entry, entry.Associations[key])
+			if err := m.put(entry); err != nil {
+				m.core.logger.Error("core: failed to persist sync status", "path", key, "destination", destKey, "error", err)
+			}
+		}
+	}()
+}
+
+// push pushes the current value of the secret of the association to the
+// destination, deleting it from the destination if the secret was deleted,
+// and records the result in the association
+func (m *SecretsSyncManager) push(entry *SyncDestinationEntry, assoc *SyncAssociation) {
+	err := func() error {
+		dest, err := m.destination(entry)
+		if err != nil {
+			return err
+		}
+		value, exists, err := m.secretValue(entry, assoc)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			assoc.SyncStatus = syncStatusDeleted
+			return dest.Delete(assoc.SecretName)
+		}
+		assoc.SyncStatus = syncStatusSynced
+		return dest.Put(assoc.SecretName, value)
+	}()
+
+	assoc.UpdatedAt = time.Now().UTC()
+	assoc.LastError = ""
+	if err != nil {
+		assoc.SyncStatus = syncStatusFailed
+		assoc.LastError = err.Error()
+		m.core.logger.Error("core: failed to sync secret", "path", assoc.Mount+assoc.Path,
+			"destination", syncDestinationKey(entry.Type, entry.Name), "error", err)
+	}
+}
+
+// secretValue reads the secret of the association, returning the JSON object
+// of the fields pushed to the destination
+func (m *SecretsSyncManager) secretValue(entry *SyncDestinationEntry, assoc *SyncAssociation) (string, bool, error) {
+	resp, err := m.core.router.Route(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      assoc.Mount + assoc.Path,
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read secret: %v", err)
+	}
+	if resp == nil || resp.Data == nil {
+		return "", false, nil
+	}
+
+	data := make(map[string]interface{}, len(resp.Data))
+	for k, v := range resp.Data {
+		if len(entry.Fields) == 0 || strutil.StrListContains(entry.Fields, k) {
+			data[k] = v
+		}
+	}
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return "", false, err
+	}
+	return string(buf), true, nil
+}
+
+func (m *SecretsSyncManager) destination(entry *SyncDestinationEntry) (secretsync.Destination, error) {
+	key := syncDestinationKey(entry.Type, entry.Name)
+	if dest, ok := m.destinations[key]; ok {
+		return dest, nil
+	}
+
+	dest, err := secretsync.NewDestination(entry.Type, entry.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	m.destinations[key] = dest
+	return dest, nil
+}
+
+// rebuildIndex loads the associations of all the destinations into the index
+func (m *SecretsSyncManager) rebuildIndex() error {
+	keys, err := m.List()
+	if err != nil {
+		return err
+	}
+
+	index := map[string][]string{}
+	for _, key := range keys {
+		entry, err := m.get(key)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			continue
+		}
+		for assocKey := range entry.Associations {
+			index[assocKey] = append(index[assocKey], key)
+		}
+	}
+	for _, destKeys := range index {
+		sort.Strings(destKeys)
+	}
+
+	m.indexLock.Lock()
+	m.index = index
+	m.indexLock.Unlock()
+	return nil
+}
+
+// wait waits for the pushes triggered by writes to complete
+func (m *SecretsSyncManager) wait() {
+	m.pending.Wait()
+}
@@ -0,0 +1,165 @@
+package vault
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/secretsync"
+	"github.com/hashicorp/vault/logical"
+)
+
+type testSyncDestination struct {
+	sync.Mutex
+	secrets map[string]string
+}
+
+func (d *testSyncDestination) Put(name, value string) error {
+	d.Lock()
+	defer d.Unlock()
+	d.secrets[name] = value
+	return nil
+}
+
+func (d *testSyncDestination) Get(name string) (string, error) {
+	d.Lock()
+	defer d.Unlock()
+	value, ok := d.secrets[name]
+	if !ok {
+		return "", secretsync.ErrNotFound
+	}
+	return value, nil
+}
+
+func (d *testSyncDestination) Delete(name string) error {
+	d.Lock()
+	defer d.Unlock()
+	delete(d.secrets, name)
+	return nil
+}
+
+func (d *testSyncDestination) secret(name string) (string, bool) {
+	d.Lock()
+	defer d.Unlock()
+	value, ok := d.secrets[name]
+	return value, ok
+}
+
+func TestSecretsSync(t *testing.T) {
+	dest := &testSyncDestination{secrets: map[string]string{}}
+	secretsync.Register("test-mem", &secretsync.Provider{
+		RequiredParameters:  []string{"bucket"},
+		SensitiveParameters: []string{"password"},
+		Factory: func(params map[string]string) (secretsync.Destination, error) {
+			return dest, nil
+		},
+	})
+
+	c, _, root := TestCoreUnsealed(t)
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		req := logical.TestRequest(t, op, path)
+		req.Data = data
+		req.ClientToken = root
+		resp, err := c.HandleRequest(req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s: err: %v resp: %#v", path, err, resp)
+		}
+		return resp
+	}
+
+	request(logical.UpdateOperation, "secret/app", map[string]interface{}{
+		"username": "admin",
+		"password": "hunter2",
+	})
+
+	// Missing required parameters are rejected
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/sync/destinations/test-mem/dest")
+	req.ClientToken = root
+	if resp, err := c.HandleRequest(req); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("expected error without required parameters")
+	}
+
+	request(logical.UpdateOperation, "sys/sync/destinations/test-mem/dest", map[string]interface{}{
+		"parameters": map[string]interface{}{
+			"bucket":   "b",
+			"password": "secret",
+		},
+		"fields": "password",
+	})
+	resp := request(logical.ReadOperation, "sys/sync/destinations/test-mem/dest", nil)
+	if params := resp.Data["parameters"].(map[string]string); params["bucket"] != "b" || params["password"] != "" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Associating the secret pushes its fields
+	resp = request(logical.UpdateOperation, "sys/sync/destinations/test-mem/dest/associations/set", map[string]interface{}{
+		"mount":       "secret",
+		"secret_path": "app",
+	})
+	if resp.Data["sync_status"] != syncStatusSynced || resp.Data["secret_name"] != "vault/secret/app" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if value, _ := dest.secret("vault/secret/app"); value != `{"password":"hunter2"}` {
+		t.Fatalf("bad: %q", value)
+	}
+
+	// Writes are pushed
+	request(logical.UpdateOperation, "secret/app", map[string]interface{}{
+		"username": "admin",
+		"password": "correct horse",
+	})
+	c.secretsSync.wait()
+	if value, _ := dest.secret("vault/secret/app"); value != `{"password":"correct horse"}` {
+		t.Fatalf("bad: %q", value)
+	}
+
+	// Changes made in the destination are reported as drift
+	resp = request(logical.ReadOperation, "sys/sync/destinations/test-mem/dest/drift", nil)
+	if status := resp.Data["associations"].(map[string]interface{})["secret/app"]; status != syncDriftInSync {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	dest.Put("vault/secret/app", `{"password":"changed"}`)
+	resp = request(logical.ReadOperation, "sys/sync/destinations/test-mem/dest/drift", nil)
+	if status := resp.Data["associations"].(map[string]interface{})["secret/app"]; status != syncDriftDrifted {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Deletes are pushed
+	request(logical.DeleteOperation, "secret/app", nil)
+	c.secretsSync.wait()
+	if _, ok := dest.secret("vault/secret/app"); ok {
+		t.Fatal("expected secret to be deleted from the destination")
+	}
+	resp = request(logical.ReadOperation, "sys/sync/destinations/test-mem/dest/associations", nil)
+	assoc := resp.Data["associations"].(map[string]interface{})["secret/app"].(map[string]interface{})
+	if assoc["sync_status"] != syncStatusDeleted {
+		t.Fatalf("bad: %#v", assoc)
+	}
+
+	// Destinations with associations cannot be deleted
+	req = logical.TestRequest(t, logical.DeleteOperation, "sys/sync/destinations/test-mem/dest")
+	req.ClientToken = root
+	if resp, err := c.HandleRequest(req); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("expected error deleting a destination with associations")
+	}
+
+	request(logical.UpdateOperation, "sys/sync/destinations/test-mem/dest/associations/remove", map[string]interface{}{
+		"mount":       "secret/",
+		"secret_path": "app",
+	})
+	request(logical.DeleteOperation, "sys/sync/destinations/test-mem/dest", nil)
+	resp = request(logical.ListOperation, "sys/sync/destinations", nil)
+	if keys, _ := resp.Data["keys"].([]string); len(keys) != 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Only KV mounts can be associated
+	request(logical.UpdateOperation, "sys/sync/destinations/test-mem/dest", map[string]interface{}{
+		"parameters": map[string]interface{}{"bucket": "b"},
+	})
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/sync/destinations/test-mem/dest/associations/set")
+	req.Data = map[string]interface{}{"mount": "cubbyhole", "secret_path": "app"}
+	req.ClientToken = root
+	if resp, err := c.HandleRequest(req); err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("expected error associating a secret outside of a KV mount")
+	}
+}
@@ -139,12 +139,19 @@ func testCoreConfig(t testing.TB, physicalBackend physical.Backend, logger log.L
 	for backendName, backendFactory := range testLogicalBackends {
 		logicalBackends[backendName] = backendFactory
 	}
+	credentialBackends := make(map[string]logical.Factory)
+	for backendName, backendFactory := range noopBackends {
+		credentialBackends[backendName] = backendFactory
+	}
+	for backendName, backendFactory := range testCredentialBackends {
+		credentialBackends[backendName] = backendFactory
+	}
 
 	conf := &CoreConfig{
 		Physical:           physicalBackend,
 		AuditBackends:      noopAudits,
 		LogicalBackends:    logicalBackends,
-		CredentialBackends: noopBackends,
+		CredentialBackends: credentialBackends,
 		DisableMlock:       true,
 		Logger:             logger,
 	}
@@ -262,6 +269,9 @@ func testTokenStore(t testing.TB, c *Core) *TokenStore {
 
 	exp := NewExpirationManager(router, subview, ts, logger)
 	ts.SetExpirationManager(exp)
+	if err := exp.Restore(); err != nil {
+		panic(err)
+	}
 
 	return ts
 }
@@ -334,6 +344,8 @@ func TestAddTestPlugin(t testing.TB, c *Core, name, testFunc string) {
 
 var testLogicalBackends = map[string]logical.Factory{}
 
+var testCredentialBackends = map[string]logical.Factory{}
+
 // Starts the test server which responds to SSH authentication.
 // Used to test the SSH secret backend.
 func StartSSHHostTestServer() (string, error) {
@@ -438,6 +450,19 @@ func AddTestLogicalBackend(name string, factory logical.Factory) error {
 	return nil
 }
 
+// This adds a credential backend for the test core. This needs to be
+// invoked before the test core is created.
+func AddTestCredentialBackend(name string, factory logical.Factory) error {
+	if name == "" {
+		return fmt.Errorf("Missing backend name")
+	}
+	if factory == nil {
+		return fmt.Errorf("Missing backend factory function")
+	}
+	testCredentialBackends[name] = factory
+	return nil
+}
+
 type noopAudit struct {
 	Config    *audit.BackendConfig
 	salt      *salt.Salt
@@ -794,6 +819,8 @@ func TestCluster(t testing.TB, handlers []http.Handler, base *CoreConfig, unseal
 		if base.Logger != nil {
 			coreConfig.Logger = base.Logger
 		}
+
+		coreConfig.PerformanceStandby = base.PerformanceStandby
 	}
 
 	if coreConfig.Physical == nil {
@@ -3,6 +3,7 @@ package vault
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"sync/atomic"
 
 	"regexp"
@@ -14,6 +15,7 @@ import (
 	"github.com/armon/go-metrics"
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/cidrutil"
 	"github.com/hashicorp/vault/helper/consts"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/helper/locksutil"
@@ -86,18 +88,36 @@ type TokenStore struct {
 	view *BarrierView
 	salt *salt.Salt
 
+	// barrier encrypts the entries of batch tokens
+	barrier BarrierEncryptor
+
 	expiration *ExpirationManager
 
 	cubbyholeBackend *CubbyholeBackend
 
+	// namespaceCubbyhole returns the cubbyhole of the namespace with the
+	// given ID, which the tokens of the namespace also have a cubbyhole in
+	namespaceCubbyhole func(string) *CubbyholeBackend
+
+	// namespaces resolves the namespace of the tokens created through the
+	// token stores of namespaces
+	namespaces *NamespaceStore
+
 	policyLookupFunc func(string) (*Policy, error)
 
+	// entityLookupFunc returns the entity having an alias within a
+	// namespace, if any
+	entityLookupFunc func(*NamespaceEntry, EntityAlias) (*EntityEntry, *EntityAlias, error)
+
 	tokenLocks []*locksutil.LockEntry
 
 	cubbyholeDestroyer func(*TokenStore, string) error
 
 	logger log.Logger
 
+	// randReader is the source of randomness of the root tokens
+	randReader io.Reader
+
 	tidyLock int64
 }
 
@@ -110,14 +130,20 @@ func NewTokenStore(c *Core, config *logical.BackendConfig) (*TokenStore, error)
 	// Initialize the store
 	t := &TokenStore{
 		view:               view,
+		barrier:            c.barrier,
 		cubbyholeDestroyer: destroyCubbyhole,
 		logger:             c.logger,
 		tokenLocks:         locksutil.CreateLocks(),
+		randReader:         c.secureRandomReader,
+		namespaces:         c.namespaceStore,
 	}
 
 	if c.policyStore != nil {
 		t.policyLookupFunc = c.policyStore.GetPolicy
 	}
+	t.entityLookupFunc = func(ns *NamespaceEntry, alias EntityAlias) (*EntityEntry, *EntityAlias, error) {
+		return c.entityStoreForNamespace(ns).ByAlias(alias)
+	}
 
 	// Setup the framework endpoints
 	t.Backend = &framework.Backend{
@@ -189,6 +215,12 @@ func NewTokenStore(c *Core, config *logical.BackendConfig) (*TokenStore, error)
 					},
 
 					"period": &framework.FieldSchema{
+						Type:        framework.TypeDurationSecond,
+						Default:     0,
+						Description: `Deprecated: use "token_period" instead.`,
+					},
+
+					"token_period": &framework.FieldSchema{
 						Type:        framework.TypeDurationSecond,
 						Default:     0,
 						Description: tokenPeriodHelp,
@@ -201,16 +233,38 @@ func NewTokenStore(c *Core, config *logical.BackendConfig) (*TokenStore, error)
 					},
 
 					"explicit_max_ttl": &framework.FieldSchema{
+						Type:        framework.TypeDurationSecond,
+						Default:     0,
+						Description: `Deprecated: use "token_explicit_max_ttl" instead.`,
+					},
+
+					"token_explicit_max_ttl": &framework.FieldSchema{
 						Type:        framework.TypeDurationSecond,
 						Default:     0,
 						Description: tokenExplicitMaxTTLHelp,
 					},
 
+					"token_bound_cidrs": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: tokenBoundCIDRsHelp,
+					},
+
+					"allowed_entity_aliases": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: tokenAllowedEntityAliasesHelp,
+					},
+
 					"renewable": &framework.FieldSchema{
 						Type:        framework.TypeBool,
 						Default:     true,
 						Description: tokenRenewableHelp,
 					},
+
+					"token_type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Default:     tokenTypeService,
+						Description: tokenTypeHelp,
+					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -540,6 +594,33 @@ type TokenEntry struct {
 	// backends are subject to those renewal rules.
 	Period time.Duration `json:"period" mapstructure:"period" structs:"period"`
 
+	// If set, the CIDR blocks of the addresses the token can be used from
+	BoundCIDRs []string `json:"bound_cidrs" mapstructure:"bound_cidrs" structs:"bound_cidrs"`
+
+	// The type of the token, "service" or "batch". Tokens created before
+	// batch tokens existed have no type and are service tokens.
+	Type string `json:"type" mapstructure:"type" structs:"type"`
+
+	// The ID of the namespace of the token, whose policies are granted to
+	// it. Tokens of the root namespace have no namespace ID.
+	NamespaceID string `json:"namespace_id,omitempty" mapstructure:"namespace_id" structs:"namespace_id"`
+
+	// The names of the external groups of the user the token was issued to
+	// on login, whose members may authorize requests under control groups
+	ExternalGroups []string `json:"external_groups,omitempty" mapstructure:"external_groups" structs:"external_groups"`
+
+	// Whether the user the token was issued to on login completed an MFA
+	// requirement
+	MFAValidated bool `json:"mfa_validated,omitempty" mapstructure:"mfa_validated" structs:"mfa_validated"`
+
+	// The name and metadata of the entity the token was issued to, which
+	// backends template values from. They are set on login by the auth
+	// backend, or by the entity alias of a token role, and child tokens
+	// inherit them unchanged. Unlike Meta, the creator of a token cannot set
+	// them.
+	EntityName string            `json:"entity_name,omitempty" mapstructure:"entity_name" structs:"entity_name"`
+	EntityMeta map[string]string `json:"entity_meta,omitempty" mapstructure:"entity_meta" structs:"entity_meta"`
+
 	// These are the deprecated fields
 	DisplayNameDeprecated    string        `json:"DisplayName" mapstructure:"DisplayName" structs:"DisplayName"`
 	NumUsesDeprecated        int           `json:"NumUses" mapstructure:"NumUses" structs:"NumUses"`
@@ -576,6 +657,17 @@ type tsRoleEntry struct {
 	// If set, the token entry will have an explicit maximum TTL set, rather
 	// than deferring to role/mount values
 	ExplicitMaxTTL time.Duration `json:"explicit_max_ttl" mapstructure:"explicit_max_ttl" structs:"explicit_max_ttl"`
+
+	// If set, the type of the tokens created using this role
+	TokenType string `json:"token_type" mapstructure:"token_type" structs:"token_type"`
+
+	// If set, the CIDR blocks of the addresses the tokens created using this
+	// role can be used from
+	BoundCIDRs []string `json:"bound_cidrs" mapstructure:"bound_cidrs" structs:"bound_cidrs"`
+
+	// The entity aliases, which may contain globs, tokens created using this
+	// role can be tied to
+	AllowedEntityAliases []string `json:"allowed_entity_aliases" mapstructure:"allowed_entity_aliases" structs:"allowed_entity_aliases"`
 }
 
 type accessorEntry struct {
@@ -597,7 +689,19 @@ func (ts *TokenStore) SaltID(id string) string {
 
 // RootToken is used to generate a new token with root privileges and no parent
 func (ts *TokenStore) rootToken() (*TokenEntry, error) {
+	// Root tokens are generated from the secure source of randomness,
+	// which may be augmented by the seal
+	id := make([]byte, 16)
+	if _, err := io.ReadFull(ts.randReader, id); err != nil {
+		return nil, fmt.Errorf("failed to generate root token: %v", err)
+	}
+	idUUID, err := uuid.FormatUUID(id)
+	if err != nil {
+		return nil, err
+	}
+
 	te := &TokenEntry{
+		ID:           idUUID,
 		Policies:     []string{"root"},
 		Path:         "auth/token/root",
 		DisplayName:  "root",
@@ -814,6 +918,10 @@ func (ts *TokenStore) Lookup(id string) (*TokenEntry, error) {
 		return nil, fmt.Errorf("cannot lookup blank token")
 	}
 
+	if isBatchToken(id) {
+		return ts.lookupBatch(id)
+	}
+
 	lock := locksutil.LockForKey(ts.tokenLocks, id)
 	lock.RLock()
 	defer lock.RUnlock()
@@ -900,6 +1008,9 @@ func (ts *TokenStore) Revoke(id string) error {
 	if id == "" {
 		return fmt.Errorf("cannot revoke blank token")
 	}
+	if isBatchToken(id) {
+		return errBatchTokenRevocation
+	}
 
 	return ts.revokeSalted(ts.SaltID(id))
 }
@@ -982,6 +1093,13 @@ func (ts *TokenStore) revokeSalted(saltedId string) (ret error) {
 	if err != nil {
 		return err
 	}
+	if entry.NamespaceID != "" && ts.namespaceCubbyhole != nil {
+		if ch := ts.namespaceCubbyhole(entry.NamespaceID); ch != nil {
+			if err := ch.revoke(salt.SaltID(ch.saltUUID, saltedId, salt.SHA1Hash)); err != nil {
+				return err
+			}
+		}
+	}
 
 	// Revoke all secrets under this token. This should go first as it's a
 	// security-sensitive item.
@@ -1022,6 +1140,9 @@ func (ts *TokenStore) RevokeTree(id string) error {
 	if id == "" {
 		return fmt.Errorf("cannot tree-revoke blank token")
 	}
+	if isBatchToken(id) {
+		return errBatchTokenRevocation
+	}
 
 	// Get the salted ID
 	saltedId := ts.SaltID(id)
@@ -1377,6 +1498,13 @@ func (ts *TokenStore) handleCreateCommon(
 			logical.ErrInvalidRequest
 	}
 
+	// A batch token cannot create a new token, since it does not track its
+	// children and so could not revoke them
+	if parent.Type == tokenTypeBatch {
+		return logical.ErrorResponse("batch tokens cannot generate child tokens"),
+			logical.ErrInvalidRequest
+	}
+
 	// Check if the client token has sudo/root privileges for the requested path
 	isSudo := ts.System().SudoPrivilege(req.MountPoint+req.Path, req.ClientToken)
 
@@ -1394,6 +1522,8 @@ func (ts *TokenStore) handleCreateCommon(
 		DisplayName     string `mapstructure:"display_name"`
 		NumUses         int    `mapstructure:"num_uses"`
 		Period          string
+		Type            string
+		EntityAlias     string `mapstructure:"entity_alias"`
 	}
 	if err := mapstructure.WeakDecode(req.Data, &data); err != nil {
 		return logical.ErrorResponse(fmt.Sprintf(
@@ -1406,19 +1536,59 @@ func (ts *TokenStore) handleCreateCommon(
 			logical.ErrInvalidRequest
 	}
 
+	// The type of the role, if any, is enforced
+	if role != nil && role.TokenType != "" {
+		if data.Type != "" && data.Type != role.TokenType {
+			return logical.ErrorResponse(fmt.Sprintf("the role only allows %s tokens", role.TokenType)),
+				logical.ErrInvalidRequest
+		}
+		data.Type = role.TokenType
+	}
+	switch data.Type {
+	case "":
+		data.Type = tokenTypeService
+	case tokenTypeService:
+	case tokenTypeBatch:
+		// Batch tokens are not persisted, so nothing can be tracked about them
+		if data.NumUses != 0 {
+			return logical.ErrorResponse("batch tokens cannot have a limited number of uses"),
+				logical.ErrInvalidRequest
+		}
+		if data.ID != "" {
+			return logical.ErrorResponse("batch tokens cannot have a specified ID"),
+				logical.ErrInvalidRequest
+		}
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("invalid token type %q", data.Type)),
+			logical.ErrInvalidRequest
+	}
+
+	// Tokens created through the token store of a namespace belong to it.
+	// They can be created by tokens of the namespace or of the namespaces
+	// containing it.
+	ns := ts.namespaces.Resolve(req.MountPoint)
+	parentNS := ts.namespaces.ByID(parent.NamespaceID)
+	if parentNS == nil || !strings.HasPrefix(ns.Path, parentNS.Path) {
+		return logical.ErrorResponse("tokens cannot be created in a namespace outside of the namespace of the parent token"), logical.ErrInvalidRequest
+	}
+
 	// Setup the token entry
 	te := TokenEntry{
 		Parent: req.ClientToken,
 
-		// The mount point is always the same since we have only one token
-		// store; using req.MountPoint causes trouble in tests since they don't
-		// have an official mount
-		Path: fmt.Sprintf("auth/token/%s", req.Path),
+		// The mount point is always the same within a namespace since it has
+		// only one token store; using req.MountPoint causes trouble in tests
+		// since they don't have an official mount
+		Path: fmt.Sprintf("%sauth/token/%s", ns.Path, req.Path),
 
 		Meta:         data.Metadata,
 		DisplayName:  "token",
 		NumUses:      data.NumUses,
 		CreationTime: time.Now().Unix(),
+
+		// The token belongs to the entity of its parent
+		EntityName: parent.EntityName,
+		EntityMeta: parent.EntityMeta,
 	}
 
 	renewable := true
@@ -1443,6 +1613,10 @@ func (ts *TokenStore) handleCreateCommon(
 		if role.PathSuffix != "" {
 			te.Path = fmt.Sprintf("%s/%s", te.Path, role.PathSuffix)
 		}
+
+		if len(role.BoundCIDRs) != 0 {
+			te.BoundCIDRs = role.BoundCIDRs
+		}
 	}
 
 	// Attach the given display name if any
@@ -1453,6 +1627,45 @@ func (ts *TokenStore) handleCreateCommon(
 		te.DisplayName = full
 	}
 
+	// Requests made with the token are attributed to the entity its display
+	// name names, so the entity alias replaces the display name
+	if data.EntityAlias != "" {
+		if role == nil {
+			return logical.ErrorResponse("entity_alias can only be set when creating a token against a role"),
+				logical.ErrInvalidRequest
+		}
+		allowed := false
+		for _, alias := range role.AllowedEntityAliases {
+			if strutil.GlobbedStringsMatch(alias, data.EntityAlias) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return logical.ErrorResponse(fmt.Sprintf("entity alias %q is not allowed by the role", data.EntityAlias)),
+				logical.ErrInvalidRequest
+		}
+		te.DisplayName = data.EntityAlias
+		te.EntityName = data.EntityAlias
+		te.EntityMeta = nil
+
+		// The entity alias is the name of a stored entity in the token store
+		if ts.entityLookupFunc != nil {
+			stored, storedAlias, err := ts.entityLookupFunc(ns, EntityAlias{
+				MountPath: "token/",
+				Name:      data.EntityAlias,
+			})
+			if err != nil {
+				return nil, err
+			}
+			if stored != nil {
+				entity := stored.Entity(storedAlias, nil)
+				te.EntityName = entity.Name
+				te.EntityMeta = entity.Metadata
+			}
+		}
+	}
+
 	// Allow specifying the ID of the token if the client has root or sudo privileges
 	if data.ID != "" {
 		if !isSudo {
@@ -1577,6 +1790,14 @@ func (ts *TokenStore) handleCreateCommon(
 		}
 	}
 
+	// Namespaces have no root policy
+	if ns.ID != rootNamespaceID {
+		te.NamespaceID = ns.ID
+		if strutil.StrListContains(te.Policies, "root") {
+			return logical.ErrorResponse("root tokens cannot be created within namespaces"), logical.ErrInvalidRequest
+		}
+	}
+
 	// Prevent attempts to create a root token without an actual root token as parent.
 	// This is to thwart privilege escalation by tokens having 'sudo' privileges.
 	if strutil.StrListContains(data.Policies, "root") && !strutil.StrListContains(parent.Policies, "root") {
@@ -1736,7 +1957,24 @@ func (ts *TokenStore) handleCreateCommon(
 	}
 
 	// Create the token
-	if err := ts.create(&te); err != nil {
+	if data.Type == tokenTypeBatch {
+		// Batch tokens cannot be revoked, so they must not grant root
+		if strutil.StrListContains(te.Policies, "root") {
+			return logical.ErrorResponse("batch tokens cannot be root tokens"), logical.ErrInvalidRequest
+		}
+		// Batch tokens only expire, so they must have a fixed TTL
+		if te.TTL == 0 {
+			return logical.ErrorResponse("batch tokens must have a TTL"), logical.ErrInvalidRequest
+		}
+		if te.Period != 0 || periodToUse != 0 {
+			return logical.ErrorResponse("batch tokens cannot be periodic"), logical.ErrInvalidRequest
+		}
+		renewable = false
+
+		if err := ts.createBatch(&te); err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+	} else if err := ts.create(&te); err != nil {
 		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
 	}
 
@@ -1881,13 +2119,18 @@ func (ts *TokenStore) handleLookup(
 		return logical.ErrorResponse("missing token ID"), logical.ErrInvalidRequest
 	}
 
-	lock := locksutil.LockForKey(ts.tokenLocks, id)
-	lock.RLock()
-	defer lock.RUnlock()
-
 	// Lookup the token
-	saltedId := ts.SaltID(id)
-	out, err := ts.lookupSalted(saltedId, true)
+	var out *TokenEntry
+	var err error
+	if isBatchToken(id) {
+		out, err = ts.lookupBatch(id)
+	} else {
+		lock := locksutil.LockForKey(ts.tokenLocks, id)
+		lock.RLock()
+		defer lock.RUnlock()
+
+		out, err = ts.lookupSalted(ts.SaltID(id), true)
+	}
 
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
@@ -1914,6 +2157,7 @@ func (ts *TokenStore) handleLookup(
 			"expire_time":      nil,
 			"ttl":              int64(0),
 			"explicit_max_ttl": int64(out.ExplicitMaxTTL.Seconds()),
+			"type":             tokenTypeService,
 		},
 	}
 
@@ -1921,12 +2165,36 @@ func (ts *TokenStore) handleLookup(
 		resp.Data["orphan"] = true
 	}
 
+	if out.NamespaceID != "" {
+		if ns := ts.namespaces.ByID(out.NamespaceID); ns != nil {
+			resp.Data["namespace_path"] = ns.Path
+		}
+	}
+
 	if out.Role != "" {
 		resp.Data["role"] = out.Role
 	}
 	if out.Period != 0 {
 		resp.Data["period"] = int64(out.Period.Seconds())
 	}
+	if len(out.BoundCIDRs) != 0 {
+		resp.Data["bound_cidrs"] = out.BoundCIDRs
+	}
+
+	// Batch tokens have no lease; they expire at the end of their TTL
+	if out.Type == tokenTypeBatch {
+		expireTime := time.Unix(out.CreationTime, 0).Add(out.TTL)
+		resp.Data["type"] = tokenTypeBatch
+		resp.Data["expire_time"] = expireTime
+		resp.Data["ttl"] = int64(expireTime.Sub(time.Now()).Seconds())
+		resp.Data["renewable"] = false
+		resp.Data["issue_time"] = time.Unix(out.CreationTime, 0)
+
+		if urltoken {
+			resp.AddWarning(`Using a token in the path is unsafe as the token can be logged in many places. Please use POST or PUT with the token passed in via the "token" parameter.`)
+		}
+		return resp, nil
+	}
 
 	// Fetch the last renewal time
 	leaseTimes, err := ts.expiration.FetchLeaseTimesByToken(out.Path, out.ID)
@@ -1988,6 +2256,9 @@ func (ts *TokenStore) handleRenew(
 	if te == nil {
 		return logical.ErrorResponse("token not found"), logical.ErrInvalidRequest
 	}
+	if te.Type == tokenTypeBatch {
+		return logical.ErrorResponse("batch tokens cannot be renewed"), logical.ErrInvalidRequest
+	}
 
 	// Renew the token and its children
 	resp, err := ts.expiration.RenewToken(req, te.Path, te.ID, increment)
@@ -2139,14 +2410,19 @@ func (ts *TokenStore) tokenStoreRoleRead(
 
 	resp := &logical.Response{
 		Data: map[string]interface{}{
-			"period":              int64(role.Period.Seconds()),
-			"explicit_max_ttl":    int64(role.ExplicitMaxTTL.Seconds()),
-			"disallowed_policies": role.DisallowedPolicies,
-			"allowed_policies":    role.AllowedPolicies,
-			"name":                role.Name,
-			"orphan":              role.Orphan,
-			"path_suffix":         role.PathSuffix,
-			"renewable":           role.Renewable,
+			"period":                 int64(role.Period.Seconds()),
+			"token_period":           int64(role.Period.Seconds()),
+			"explicit_max_ttl":       int64(role.ExplicitMaxTTL.Seconds()),
+			"token_explicit_max_ttl": int64(role.ExplicitMaxTTL.Seconds()),
+			"token_bound_cidrs":      role.BoundCIDRs,
+			"allowed_entity_aliases": role.AllowedEntityAliases,
+			"disallowed_policies":    role.DisallowedPolicies,
+			"allowed_policies":       role.AllowedPolicies,
+			"name":                   role.Name,
+			"orphan":                 role.Orphan,
+			"path_suffix":            role.PathSuffix,
+			"renewable":              role.Renewable,
+			"token_type":             role.TokenType,
 		},
 	}
 
@@ -2196,7 +2472,10 @@ func (ts *TokenStore) tokenStoreRoleCreateUpdate(
 		entry.Orphan = data.Get("orphan").(bool)
 	}
 
-	periodInt, ok := data.GetOk("period")
+	periodInt, ok := data.GetOk("token_period")
+	if !ok {
+		periodInt, ok = data.GetOk("period")
+	}
 	if ok {
 		entry.Period = time.Second * time.Duration(periodInt.(int))
 	} else if req.Operation == logical.CreateOperation {
@@ -2210,9 +2489,27 @@ func (ts *TokenStore) tokenStoreRoleCreateUpdate(
 		entry.Renewable = data.Get("renewable").(bool)
 	}
 
+	tokenTypeInt, ok := data.GetOk("token_type")
+	if ok {
+		entry.TokenType = tokenTypeInt.(string)
+	} else if req.Operation == logical.CreateOperation {
+		entry.TokenType = data.Get("token_type").(string)
+	}
+	switch entry.TokenType {
+	case "", tokenTypeService, tokenTypeBatch:
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("invalid token_type %q", entry.TokenType)), nil
+	}
+	if entry.TokenType == tokenTypeBatch && entry.Period != 0 {
+		return logical.ErrorResponse("roles creating batch tokens cannot be periodic"), nil
+	}
+
 	var resp *logical.Response
 
-	explicitMaxTTLInt, ok := data.GetOk("explicit_max_ttl")
+	explicitMaxTTLInt, ok := data.GetOk("token_explicit_max_ttl")
+	if !ok {
+		explicitMaxTTLInt, ok = data.GetOk("explicit_max_ttl")
+	}
 	if ok {
 		entry.ExplicitMaxTTL = time.Second * time.Duration(explicitMaxTTLInt.(int))
 	} else if req.Operation == logical.CreateOperation {
@@ -2258,6 +2555,29 @@ func (ts *TokenStore) tokenStoreRoleCreateUpdate(
 		entry.AllowedPolicies = policyutil.SanitizePolicies(strings.Split(data.Get("allowed_policies").(string), ","), policyutil.DoNotAddDefaultPolicy)
 	}
 
+	boundCIDRsRaw, ok := data.GetOk("token_bound_cidrs")
+	if ok {
+		entry.BoundCIDRs = boundCIDRsRaw.([]string)
+	} else if req.Operation == logical.CreateOperation {
+		entry.BoundCIDRs = data.Get("token_bound_cidrs").([]string)
+	}
+	if len(entry.BoundCIDRs) != 0 {
+		valid, err := cidrutil.ValidateCIDRListSlice(entry.BoundCIDRs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to validate CIDR blocks: %v", err)
+		}
+		if !valid {
+			return logical.ErrorResponse("invalid CIDR blocks"), nil
+		}
+	}
+
+	allowedEntityAliasesRaw, ok := data.GetOk("allowed_entity_aliases")
+	if ok {
+		entry.AllowedEntityAliases = allowedEntityAliasesRaw.([]string)
+	} else if req.Operation == logical.CreateOperation {
+		entry.AllowedEntityAliases = data.Get("allowed_entity_aliases").([]string)
+	}
+
 	disallowedPoliciesStr, ok := data.GetOk("disallowed_policies")
 	if ok {
 		entry.DisallowedPolicies = strutil.ParseDedupLowercaseAndSortStrings(disallowedPoliciesStr.(string), ",")
@@ -2324,6 +2644,13 @@ their path. This can be used to assist use
 of the 'revoke-prefix' endpoint later on.
 The given suffix must match the regular
 expression.`
+	tokenBoundCIDRsHelp = `Comma separated list of CIDR blocks. If set,
+the tokens created via this role can only be
+used from addresses within these blocks.`
+	tokenAllowedEntityAliasesHelp = `Comma separated list of the entity aliases,
+which may contain globs, that tokens created
+via this role can be tied to with the
+"entity_alias" parameter.`
 	tokenExplicitMaxTTLHelp = `If set, tokens created via this role
 carry an explicit maximum TTL. During renewal,
 the current maximum TTL values of the role
@@ -2333,6 +2660,11 @@ no effect on the token being renewed.`
 	tokenRenewableHelp = `Tokens created via this role will be
 renewable or not according to this value.
 Defaults to "true".`
+	tokenTypeHelp = `The type of the tokens created via this
+role, "service" or "batch". Batch tokens are
+not persisted and cannot be renewed or revoked,
+so roles creating them cannot be periodic.
+Defaults to "service".`
 	tokenListAccessorsHelp = `List token accessors, which can then be
 be used to iterate and discover their properities
 or revoke them. Because this can be used to
@@ -0,0 +1,154 @@
+package vault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/policyutil"
+)
+
+const (
+	// tokenTypeService is the type of the tokens persisted in the token
+	// store, which are tracked by the expiration manager
+	tokenTypeService = "service"
+
+	// tokenTypeBatch is the type of the tokens which are not persisted: the
+	// token ID is the token entry itself, encrypted with the barrier key
+	tokenTypeBatch = "batch"
+
+	// batchTokenPrefix is the prefix of the IDs of batch tokens, which
+	// distinguishes them from the UUIDs of service tokens
+	batchTokenPrefix = "b."
+
+	// batchTokenKey is the key authenticated along with the encrypted
+	// batch token entries
+	batchTokenKey = "token/batch"
+)
+
+// errBatchTokenRevocation is returned when revoking a batch token
+var errBatchTokenRevocation = fmt.Errorf("batch tokens cannot be revoked; they expire at the end of their TTL")
+
+// batchTokenEntry is the encoding of the token entry of a batch token. Short
+// field names keep the token IDs small.
+type batchTokenEntry struct {
+	Parent       string            `json:"pa,omitempty"`
+	Policies     []string          `json:"po,omitempty"`
+	Path         string            `json:"p,omitempty"`
+	Meta         map[string]string `json:"m,omitempty"`
+	DisplayName  string            `json:"d,omitempty"`
+	CreationTime int64             `json:"c"`
+	TTL          int64             `json:"t"`
+	Role         string            `json:"r,omitempty"`
+	BoundCIDRs   []string          `json:"b,omitempty"`
+	NamespaceID  string            `json:"n,omitempty"`
+	EntityName   string            `json:"en,omitempty"`
+	EntityMeta   map[string]string `json:"em,omitempty"`
+}
+
+// isBatchToken returns whether a token ID is the ID of a batch token
+func isBatchToken(id string) bool {
+	return strings.HasPrefix(id, batchTokenPrefix)
+}
+
+// createBatch sets the ID of a batch token entry. Nothing is persisted; the
+// ID is the entry encrypted with the barrier key.
+func (ts *TokenStore) createBatch(entry *TokenEntry) error {
+	defer metrics.MeasureSince([]string{"token", "create_batch"}, time.Now())
+	if ts.barrier == nil {
+		return fmt.Errorf("batch tokens are not supported without a barrier")
+	}
+
+	entry.Type = tokenTypeBatch
+	entry.Policies = policyutil.SanitizePolicies(entry.Policies, policyutil.DoNotAddDefaultPolicy)
+
+	plaintext, err := json.Marshal(&batchTokenEntry{
+		Parent:       entry.Parent,
+		Policies:     entry.Policies,
+		Path:         entry.Path,
+		Meta:         entry.Meta,
+		DisplayName:  entry.DisplayName,
+		CreationTime: entry.CreationTime,
+		TTL:          int64(entry.TTL.Seconds()),
+		Role:         entry.Role,
+		BoundCIDRs:   entry.BoundCIDRs,
+		NamespaceID:  entry.NamespaceID,
+		EntityName:   entry.EntityName,
+		EntityMeta:   entry.EntityMeta,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode entry: %v", err)
+	}
+
+	ciphertext, err := ts.barrier.Encrypt(batchTokenKey, plaintext)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt entry: %v", err)
+	}
+
+	entry.ID = batchTokenPrefix + base64.RawURLEncoding.EncodeToString(ciphertext)
+	return nil
+}
+
+// lookupBatch returns the entry of a batch token. As batch tokens cannot be
+// revoked, tokens which have expired or whose parent was revoked are
+// returned as not found.
+func (ts *TokenStore) lookupBatch(id string) (*TokenEntry, error) {
+	if ts.barrier == nil {
+		return nil, nil
+	}
+
+	ciphertext, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(id, batchTokenPrefix))
+	if err != nil {
+		return nil, nil
+	}
+
+	// Tokens which fail to decrypt were not issued by this Vault, or were
+	// tampered with
+	plaintext, err := ts.barrier.Decrypt(batchTokenKey, ciphertext)
+	if err != nil {
+		return nil, nil
+	}
+
+	var batch batchTokenEntry
+	if err := jsonutil.DecodeJSON(plaintext, &batch); err != nil {
+		return nil, fmt.Errorf("failed to decode entry: %v", err)
+	}
+
+	ttl := time.Duration(batch.TTL) * time.Second
+	if time.Now().After(time.Unix(batch.CreationTime, 0).Add(ttl)) {
+		return nil, nil
+	}
+
+	// Batch tokens are not in the revocation tree of their parent, so they
+	// are checked against it instead
+	if batch.Parent != "" {
+		parent, err := ts.Lookup(batch.Parent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup parent: %v", err)
+		}
+		if parent == nil {
+			return nil, nil
+		}
+	}
+
+	return &TokenEntry{
+		ID:           id,
+		Type:         tokenTypeBatch,
+		Parent:       batch.Parent,
+		Policies:     batch.Policies,
+		Path:         batch.Path,
+		Meta:         batch.Meta,
+		DisplayName:  batch.DisplayName,
+		CreationTime: batch.CreationTime,
+		TTL:          ttl,
+		Role:         batch.Role,
+		BoundCIDRs:   batch.BoundCIDRs,
+		NamespaceID:  batch.NamespaceID,
+		EntityName:   batch.EntityName,
+		EntityMeta:   batch.EntityMeta,
+	}, nil
+}
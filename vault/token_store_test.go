@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/logical"
 )
@@ -1359,6 +1360,7 @@ func TestTokenStore_HandleRequest_Lookup(t *testing.T) {
 		"ttl":              int64(0),
 		"explicit_max_ttl": int64(0),
 		"expire_time":      nil,
+		"type":             "service",
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -1398,6 +1400,7 @@ func TestTokenStore_HandleRequest_Lookup(t *testing.T) {
 		"ttl":              int64(3600),
 		"explicit_max_ttl": int64(0),
 		"renewable":        true,
+		"type":             "service",
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -1448,6 +1451,7 @@ func TestTokenStore_HandleRequest_Lookup(t *testing.T) {
 		"ttl":              int64(3600),
 		"explicit_max_ttl": int64(0),
 		"renewable":        true,
+		"type":             "service",
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -1529,6 +1533,7 @@ func TestTokenStore_HandleRequest_LookupSelf(t *testing.T) {
 		"creation_ttl":     int64(3600),
 		"ttl":              int64(3600),
 		"explicit_max_ttl": int64(0),
+		"type":             "service",
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -1691,14 +1696,19 @@ func TestTokenStore_RoleCRUD(t *testing.T) {
 	}
 
 	expected := map[string]interface{}{
-		"name":                "test",
-		"orphan":              true,
-		"period":              int64(259200),
-		"allowed_policies":    []string{"test1", "test2"},
-		"disallowed_policies": []string{},
-		"path_suffix":         "happenin",
-		"explicit_max_ttl":    int64(0),
-		"renewable":           true,
+		"name":                   "test",
+		"orphan":                 true,
+		"period":                 int64(259200),
+		"allowed_policies":       []string{"test1", "test2"},
+		"disallowed_policies":    []string{},
+		"path_suffix":            "happenin",
+		"explicit_max_ttl":       int64(0),
+		"renewable":              true,
+		"token_type":             "service",
+		"token_period":           int64(259200),
+		"token_explicit_max_ttl": int64(0),
+		"token_bound_cidrs":      []string{},
+		"allowed_entity_aliases": []string{},
 	}
 
 	if !reflect.DeepEqual(expected, resp.Data) {
@@ -1713,6 +1723,7 @@ func TestTokenStore_RoleCRUD(t *testing.T) {
 		"allowed_policies": "test3",
 		"path_suffix":      "happenin",
 		"renewable":        false,
+		"token_type":       "service",
 	}
 
 	resp, err = core.HandleRequest(req)
@@ -1735,14 +1746,19 @@ func TestTokenStore_RoleCRUD(t *testing.T) {
 	}
 
 	expected = map[string]interface{}{
-		"name":                "test",
-		"orphan":              true,
-		"period":              int64(284400),
-		"allowed_policies":    []string{"test3"},
-		"disallowed_policies": []string{},
-		"path_suffix":         "happenin",
-		"explicit_max_ttl":    int64(0),
-		"renewable":           false,
+		"name":                   "test",
+		"orphan":                 true,
+		"period":                 int64(284400),
+		"allowed_policies":       []string{"test3"},
+		"disallowed_policies":    []string{},
+		"path_suffix":            "happenin",
+		"explicit_max_ttl":       int64(0),
+		"renewable":              false,
+		"token_type":             "service",
+		"token_period":           int64(284400),
+		"token_explicit_max_ttl": int64(0),
+		"token_bound_cidrs":      []string{},
+		"allowed_entity_aliases": []string{},
 	}
 
 	if !reflect.DeepEqual(expected, resp.Data) {
@@ -1772,14 +1788,19 @@ func TestTokenStore_RoleCRUD(t *testing.T) {
 	}
 
 	expected = map[string]interface{}{
-		"name":                "test",
-		"orphan":              true,
-		"explicit_max_ttl":    int64(5),
-		"allowed_policies":    []string{"test3"},
-		"disallowed_policies": []string{},
-		"path_suffix":         "happenin",
-		"period":              int64(0),
-		"renewable":           false,
+		"name":                   "test",
+		"orphan":                 true,
+		"explicit_max_ttl":       int64(5),
+		"allowed_policies":       []string{"test3"},
+		"disallowed_policies":    []string{},
+		"path_suffix":            "happenin",
+		"period":                 int64(0),
+		"renewable":              false,
+		"token_type":             "service",
+		"token_period":           int64(0),
+		"token_explicit_max_ttl": int64(5),
+		"token_bound_cidrs":      []string{},
+		"allowed_entity_aliases": []string{},
 	}
 
 	if !reflect.DeepEqual(expected, resp.Data) {
@@ -3473,3 +3494,243 @@ func TestTokenStore_TidyLeaseRevocation(t *testing.T) {
 		t.Fatal("found leases")
 	}
 }
+
+func TestTokenStore_BatchTokens(t *testing.T) {
+	core, _, _, root := TestCoreWithTokenStore(t)
+	ts := core.tokenStore
+
+	request := func(token string, op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		req := logical.TestRequest(t, op, path)
+		req.ClientToken = token
+		req.Data = data
+		return core.HandleRequest(req)
+	}
+	persisted := func() int {
+		keys, err := ts.view.List(lookupPrefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(keys)
+	}
+
+	resp, err := request(root, logical.UpdateOperation, "sys/policy/foo", map[string]interface{}{
+		"rules": `path "auth/token/*" { capabilities = ["update"] }
+path "cubbyhole/*" { capabilities = ["update"] }`,
+	})
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	// Batch tokens must expire
+	resp, err = request(root, logical.UpdateOperation, "auth/token/create", map[string]interface{}{
+		"type": "batch",
+	})
+	if err == nil {
+		t.Fatalf("expected an error, got %#v", resp)
+	}
+
+	// Batch tokens cannot be revoked, so they cannot be root tokens
+	resp, err = request(root, logical.UpdateOperation, "auth/token/create", map[string]interface{}{
+		"type": "batch",
+		"ttl":  "1h",
+	})
+	if err == nil || resp == nil || resp.Data["error"] != "batch tokens cannot be root tokens" {
+		t.Fatalf("expected root error, got %v %#v", err, resp)
+	}
+
+	resp, err = request(root, logical.UpdateOperation, "auth/token/create", map[string]interface{}{
+		"policies": "foo",
+		"ttl":      "1h",
+	})
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	parent := resp.Auth.ClientToken
+
+	for _, data := range []map[string]interface{}{
+		{"type": "batch", "num_uses": 1},
+		{"type": "batch", "id": "foo"},
+		{"type": "other"},
+	} {
+		if resp, err := request(root, logical.UpdateOperation, "auth/token/create", data); err == nil {
+			t.Fatalf("expected an error for %#v, got %#v", data, resp)
+		}
+	}
+
+	// Nothing is persisted when creating a batch token
+	before := persisted()
+	resp, err = request(parent, logical.UpdateOperation, "auth/token/create", map[string]interface{}{
+		"type": "batch",
+		"ttl":  "10m",
+	})
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	batch := resp.Auth.ClientToken
+	if !strings.HasPrefix(batch, "b.") || resp.Auth.Accessor != "" || resp.Auth.Renewable {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+	if persisted() != before {
+		t.Fatal("the batch token was persisted")
+	}
+
+	resp, err = request(batch, logical.ReadOperation, "auth/token/lookup-self", nil)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	if resp.Data["type"] != "batch" || resp.Data["renewable"] != false ||
+		!reflect.DeepEqual(resp.Data["policies"], []string{"default", "foo"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if ttl := resp.Data["ttl"].(int64); ttl <= 0 || ttl > 600 {
+		t.Fatalf("bad: %d", ttl)
+	}
+
+	// Batch tokens cannot create tokens, be renewed or revoked, or use the
+	// cubbyhole
+	for _, path := range []string{"auth/token/create", "auth/token/renew-self", "auth/token/revoke-self", "cubbyhole/foo"} {
+		if resp, err := request(batch, logical.UpdateOperation, path, map[string]interface{}{"foo": "bar"}); err == nil {
+			t.Fatalf("expected an error for %s, got %#v", path, resp)
+		}
+	}
+
+	// Tampered tokens are rejected
+	tampered := []byte(batch)
+	tampered[len(tampered)/2] ^= 1
+	if te, err := ts.Lookup(string(tampered)); err != nil || te != nil {
+		t.Fatalf("bad: %v %#v", err, te)
+	}
+
+	// Expired tokens are rejected
+	expired := &TokenEntry{
+		Policies:     []string{"foo"},
+		CreationTime: time.Now().Add(-time.Hour).Unix(),
+		TTL:          time.Minute,
+	}
+	if err := ts.createBatch(expired); err != nil {
+		t.Fatal(err)
+	}
+	if te, err := ts.Lookup(expired.ID); err != nil || te != nil {
+		t.Fatalf("bad: %v %#v", err, te)
+	}
+
+	// Revoking the parent invalidates the batch token
+	if te, err := ts.Lookup(batch); err != nil || te == nil {
+		t.Fatalf("bad: %v %#v", err, te)
+	}
+	if resp, err := request(root, logical.UpdateOperation, "auth/token/revoke", map[string]interface{}{"token": parent}); err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	if te, err := ts.Lookup(batch); err != nil || te != nil {
+		t.Fatalf("bad: %v %#v", err, te)
+	}
+
+	// Roles enforce their token type
+	if resp, err := request(root, logical.UpdateOperation, "auth/token/roles/batch", map[string]interface{}{
+		"token_type": "batch",
+		"orphan":     true,
+	}); err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	resp, err = request(root, logical.UpdateOperation, "auth/token/create/batch", map[string]interface{}{
+		"policies": "foo",
+		"ttl":      "10m",
+	})
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	te, err := ts.Lookup(resp.Auth.ClientToken)
+	if err != nil || te == nil || te.Type != "batch" || te.Parent != "" || te.Role != "batch" {
+		t.Fatalf("bad: %v %#v", err, te)
+	}
+	if resp, err := request(root, logical.UpdateOperation, "auth/token/create/batch", map[string]interface{}{
+		"type": "service",
+	}); err == nil {
+		t.Fatalf("expected an error, got %#v", resp)
+	}
+}
+
+func TestTokenStore_RoleTokenParams(t *testing.T) {
+	core, _, _, root := TestCoreWithTokenStore(t)
+
+	request := func(token string, path string, data map[string]interface{}) (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.UpdateOperation, path)
+		req.ClientToken = token
+		req.Data = data
+		req.Connection = &logical.Connection{RemoteAddr: "127.0.0.1"}
+		return core.HandleRequest(req)
+	}
+
+	if resp, err := request(root, "auth/token/roles/test", map[string]interface{}{
+		"token_bound_cidrs": "not a cidr",
+	}); err == nil && !resp.IsError() {
+		t.Fatalf("expected an error, got %#v", resp)
+	}
+
+	resp, err := request(root, "auth/token/roles/test", map[string]interface{}{
+		"token_period":           "1h",
+		"token_explicit_max_ttl": "2h",
+		"token_bound_cidrs":      "127.0.0.1/32",
+		"allowed_entity_aliases": "userpass-*,admin",
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	req := logical.TestRequest(t, logical.ReadOperation, "auth/token/roles/test")
+	req.ClientToken = root
+	resp, err = core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	if resp.Data["token_period"] != int64(3600) || resp.Data["period"] != int64(3600) ||
+		resp.Data["token_explicit_max_ttl"] != int64(7200) ||
+		!reflect.DeepEqual(resp.Data["token_bound_cidrs"], []string{"127.0.0.1/32"}) ||
+		!reflect.DeepEqual(resp.Data["allowed_entity_aliases"], []string{"userpass-*", "admin"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The entity alias must be allowed by a role
+	if resp, err := request(root, "auth/token/create/test", map[string]interface{}{
+		"entity_alias": "github-alice",
+	}); err == nil {
+		t.Fatalf("expected an error, got %#v", resp)
+	}
+	if resp, err := request(root, "auth/token/create", map[string]interface{}{
+		"entity_alias": "admin",
+	}); err == nil {
+		t.Fatalf("expected an error, got %#v", resp)
+	}
+
+	resp, err = request(root, "auth/token/create/test", map[string]interface{}{
+		"entity_alias": "userpass-alice",
+	})
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	token := resp.Auth.ClientToken
+
+	te, err := core.tokenStore.Lookup(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if te.DisplayName != "userpass-alice" || te.ExplicitMaxTTL != 2*time.Hour ||
+		!reflect.DeepEqual(te.BoundCIDRs, []string{"127.0.0.1/32"}) {
+		t.Fatalf("bad: %#v", te)
+	}
+	if resp.Auth.TTL != time.Hour {
+		t.Fatalf("bad: %s", resp.Auth.TTL)
+	}
+
+	// The token can only be used from the bound addresses
+	req = logical.TestRequest(t, logical.ReadOperation, "auth/token/lookup-self")
+	req.ClientToken = token
+	req.Connection = &logical.Connection{RemoteAddr: "127.0.0.1"}
+	if resp, err := core.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	req.Connection = &logical.Connection{RemoteAddr: "10.0.0.1"}
+	if _, err := core.HandleRequest(req); err == nil || !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+}
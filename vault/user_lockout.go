@@ -0,0 +1,266 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	lockedUsersPath = "core/locked-users/"
+
+	// userLockoutDefaultDuration is how long users stay locked out, unless
+	// configured on the mount
+	userLockoutDefaultDuration = 15 * time.Minute
+
+	// userLockoutDefaultCounterResetDuration is how long after their last
+	// failed login the failed logins of users are forgotten, unless
+	// configured on the mount
+	userLockoutDefaultCounterResetDuration = 15 * time.Minute
+
+	// userLockoutPruneInterval is how often the failed logins of users
+	// which have not failed again within their counter reset duration
+	// are forgotten
+	userLockoutPruneInterval = time.Minute
+)
+
+// userLockoutMountTypes are the types of the auth backends logging in users
+// with a password, which users can be locked out of
+var userLockoutMountTypes = []string{
+	"ldap",
+	"okta",
+	"radius",
+	"userpass",
+}
+
+// UserLockoutConfig is the user lockout configuration of an auth mount. Users
+// failing to log in LockoutThreshold times, each within
+// LockoutCounterResetDuration of the previous failure, are locked out of the
+// mount for LockoutDuration. A zero threshold disables the lockout.
+type UserLockoutConfig struct {
+	LockoutThreshold            int           `json:"lockout_threshold,omitempty" structs:"lockout_threshold" mapstructure:"lockout_threshold"`
+	LockoutDuration             time.Duration `json:"lockout_duration,omitempty" structs:"lockout_duration" mapstructure:"lockout_duration"`
+	LockoutCounterResetDuration time.Duration `json:"lockout_counter_reset_duration,omitempty" structs:"lockout_counter_reset_duration" mapstructure:"lockout_counter_reset_duration"`
+}
+
+// duration returns how long users stay locked out
+func (c *UserLockoutConfig) duration() time.Duration {
+	if c.LockoutDuration == 0 {
+		return userLockoutDefaultDuration
+	}
+	return c.LockoutDuration
+}
+
+// counterResetDuration returns how long failed logins are remembered
+func (c *UserLockoutConfig) counterResetDuration() time.Duration {
+	if c.LockoutCounterResetDuration == 0 {
+		return userLockoutDefaultCounterResetDuration
+	}
+	return c.LockoutCounterResetDuration
+}
+
+// LockedUserEntry is a user locked out of an auth mount
+type LockedUserEntry struct {
+	LockoutTime         time.Time `json:"lockout_time"`
+	FailedLoginAttempts int       `json:"failed_login_attempts"`
+}
+
+// failedLogins are the failed logins of a user which is not locked out yet.
+// They are forgotten once they expire.
+type failedLogins struct {
+	count   int
+	expires time.Time
+}
+
+// UserLockoutManager counts the failed logins of users, and keeps the users
+// locked out of auth mounts. Failed logins are only counted in memory, while
+// locked users are persisted under the UUID of their mount.
+type UserLockoutManager struct {
+	view *BarrierView
+
+	l          sync.Mutex
+	failed     map[string]*failedLogins
+	lastPruned time.Time
+}
+
+func (c *Core) setupUserLockoutManager() error {
+	c.userLockoutManager = &UserLockoutManager{
+		view:   NewBarrierView(c.barrier, lockedUsersPath),
+		failed: make(map[string]*failedLogins),
+	}
+
+	return nil
+}
+
+// Locked returns whether a user is locked out of a mount. Users whose
+// lockout has expired are unlocked.
+func (m *UserLockoutManager) Locked(me *MountEntry, user string) (bool, error) {
+	entry, err := m.lockedUser(me.UUID, user)
+	if err != nil || entry == nil {
+		return false, err
+	}
+
+	if time.Now().Before(entry.LockoutTime.Add(me.Config.UserLockoutConfig.duration())) {
+		return true, nil
+	}
+	return false, m.Unlock(me.UUID, user)
+}
+
+// Failed records a failed login of a user, and locks the user out of the
+// mount once the lockout threshold of the mount is reached
+func (m *UserLockoutManager) Failed(me *MountEntry, user string) error {
+	config := &me.Config.UserLockoutConfig
+	key := me.UUID + "/" + user
+	now := time.Now()
+
+	m.l.Lock()
+	m.pruneFailed(now)
+	failed, ok := m.failed[key]
+	if !ok || now.After(failed.expires) {
+		failed = &failedLogins{}
+		m.failed[key] = failed
+	}
+	failed.count++
+	failed.expires = now.Add(config.counterResetDuration())
+	count := failed.count
+	if count >= config.LockoutThreshold {
+		delete(m.failed, key)
+	}
+	m.l.Unlock()
+
+	if count < config.LockoutThreshold {
+		return nil
+	}
+
+	buf, err := json.Marshal(&LockedUserEntry{
+		LockoutTime:         now,
+		FailedLoginAttempts: count,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode locked user entry: %v", err)
+	}
+	if err := m.view.Put(&logical.StorageEntry{
+		Key:   key,
+		Value: buf,
+	}); err != nil {
+		return fmt.Errorf("failed to persist locked user entry: %v", err)
+	}
+	return nil
+}
+
+// pruneFailed forgets the expired failed logins, at most once per prune
+// interval, so that users who never log in again are not kept forever. The
+// lock must be held.
+func (m *UserLockoutManager) pruneFailed(now time.Time) {
+	if now.Sub(m.lastPruned) < userLockoutPruneInterval {
+		return
+	}
+	m.lastPruned = now
+
+	for key, failed := range m.failed {
+		if now.After(failed.expires) {
+			delete(m.failed, key)
+		}
+	}
+}
+
+// Succeeded forgets the failed logins of a user after a successful login
+func (m *UserLockoutManager) Succeeded(me *MountEntry, user string) {
+	m.l.Lock()
+	delete(m.failed, me.UUID+"/"+user)
+	m.l.Unlock()
+}
+
+// Unlock unlocks a user locked out of the mount with the given UUID
+func (m *UserLockoutManager) Unlock(mountUUID, user string) error {
+	m.l.Lock()
+	delete(m.failed, mountUUID+"/"+user)
+	m.l.Unlock()
+
+	if err := m.view.Delete(mountUUID + "/" + user); err != nil {
+		return fmt.Errorf("failed to delete locked user entry: %v", err)
+	}
+	return nil
+}
+
+// LockedUsers returns the users locked out of the mount with the given UUID,
+// including users whose lockout has expired but who have not logged in since
+func (m *UserLockoutManager) LockedUsers(mountUUID string) (map[string]*LockedUserEntry, error) {
+	users, err := m.view.List(mountUUID + "/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list locked users: %v", err)
+	}
+
+	entries := make(map[string]*LockedUserEntry, len(users))
+	for _, user := range users {
+		entry, err := m.lockedUser(mountUUID, user)
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			entries[user] = entry
+		}
+	}
+	return entries, nil
+}
+
+// clearMount removes the locked users of a mount which was disabled
+func (m *UserLockoutManager) clearMount(mountUUID string) error {
+	m.l.Lock()
+	for key := range m.failed {
+		if strings.HasPrefix(key, mountUUID+"/") {
+			delete(m.failed, key)
+		}
+	}
+	m.l.Unlock()
+
+	return logical.ClearView(m.view.SubView(mountUUID + "/"))
+}
+
+func (m *UserLockoutManager) lockedUser(mountUUID, user string) (*LockedUserEntry, error) {
+	out, err := m.view.Get(mountUUID + "/" + user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve locked user entry: %v", err)
+	}
+	if out == nil {
+		return nil, nil
+	}
+
+	entry := new(LockedUserEntry)
+	if err := jsonutil.DecodeJSON(out.Value, entry); err != nil {
+		return nil, fmt.Errorf("failed to decode locked user entry: %v", err)
+	}
+	return entry, nil
+}
+
+// loginUser returns the mount and the user of a login request, if users can
+// be locked out of the mount. The user is the last segment of login paths
+// such as "auth/userpass/login/<user>", or else the username of the request.
+func (c *Core) loginUser(req *logical.Request) (*MountEntry, string) {
+	me := c.router.MatchingMountEntry(req.Path)
+	if me == nil || me.Config.UserLockoutConfig.LockoutThreshold <= 0 ||
+		!strutil.StrListContains(userLockoutMountTypes, me.Type) {
+		return nil, ""
+	}
+
+	path := strings.TrimPrefix(req.Path, c.router.MatchingMount(req.Path))
+	user := ""
+	switch {
+	case strings.HasPrefix(path, "login/"):
+		user = strings.TrimPrefix(path, "login/")
+	case path == "login" && req.Data != nil:
+		user, _ = req.Data["username"].(string)
+	}
+	if user == "" || strings.Contains(user, "/") {
+		return nil, ""
+	}
+
+	// The backends log in users case-insensitively
+	return me, strings.ToLower(user)
+}
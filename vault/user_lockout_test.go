@@ -0,0 +1,175 @@
+package vault
+
+import (
+	"testing"
+	"time"
+
+	credUserpass "github.com/hashicorp/vault/builtin/credential/userpass"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestUserLockout(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	c.credentialBackends["userpass"] = credUserpass.Factory
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		req := logical.TestRequest(t, op, path)
+		req.Data = data
+		req.ClientToken = root
+		resp, err := c.HandleRequest(req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v resp: %#v", err, resp)
+		}
+		return resp
+	}
+	login := func(password string) (*logical.Response, error) {
+		return c.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "auth/userpass/login/armon",
+			Data: map[string]interface{}{
+				"password": password,
+			},
+		})
+	}
+
+	request(logical.UpdateOperation, "sys/auth/userpass", map[string]interface{}{
+		"type": "userpass",
+	})
+	request(logical.UpdateOperation, "auth/userpass/users/armon", map[string]interface{}{
+		"password": "foo",
+		"policies": "default",
+	})
+
+	// The lockout is disabled by default
+	for i := 0; i < 5; i++ {
+		if resp, err := login("bar"); err == nil && !resp.IsError() {
+			t.Fatalf("expected an error, got %#v", resp)
+		}
+	}
+	if resp, err := login("foo"); err != nil || resp.Auth == nil {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+
+	// Only auth backends logging in users with a password are supported
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/token/tune")
+	req.ClientToken = root
+	req.Data = map[string]interface{}{
+		"user_lockout_config": map[string]interface{}{
+			"lockout_threshold": 3,
+		},
+	}
+	if resp, err := c.HandleRequest(req); err == nil && !resp.IsError() {
+		t.Fatal("expected an error tuning the user lockout of the token backend")
+	}
+
+	request(logical.UpdateOperation, "sys/auth/userpass/tune", map[string]interface{}{
+		"user_lockout_config": map[string]interface{}{
+			"lockout_threshold": "3",
+			"lockout_duration":  "1h",
+		},
+	})
+	resp := request(logical.ReadOperation, "sys/auth/userpass/tune", nil)
+	expected := map[string]interface{}{
+		"lockout_threshold":              3,
+		"lockout_duration":               3600,
+		"lockout_counter_reset_duration": 900,
+	}
+	lockout := resp.Data["user_lockout_config"].(map[string]interface{})
+	for k, v := range expected {
+		if lockout[k] != v {
+			t.Fatalf("bad: %s: expected %v, got %v", k, v, lockout[k])
+		}
+	}
+
+	// Successful logins reset the failed logins
+	for i := 0; i < 2; i++ {
+		login("bar")
+	}
+	if resp, err := login("foo"); err != nil || resp.Auth == nil {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+	for i := 0; i < 3; i++ {
+		login("bar")
+	}
+
+	// Locked users are denied, even with their password
+	if _, err := login("foo"); err != logical.ErrPermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+
+	resp = request(logical.ReadOperation, "sys/locked-users", nil)
+	lockedUsers := resp.Data["locked_users"].(map[string]interface{})
+	users, ok := lockedUsers["userpass/"].(map[string]interface{})
+	if !ok || users["armon"] == nil {
+		t.Fatalf("bad: %#v", lockedUsers)
+	}
+	if users["armon"].(map[string]interface{})["failed_login_attempts"] != 3 {
+		t.Fatalf("bad: %#v", users["armon"])
+	}
+
+	resp = request(logical.ReadOperation, "sys/locked-users", map[string]interface{}{
+		"mount": "auth/token",
+	})
+	if len(resp.Data["locked_users"].(map[string]interface{})) != 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	request(logical.UpdateOperation, "sys/locked-users/userpass/unlock/armon", nil)
+	if resp, err := login("foo"); err != nil || resp.Auth == nil {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+
+	// Users whose lockout has expired can log in again
+	for i := 0; i < 3; i++ {
+		login("bar")
+	}
+	if _, err := login("foo"); err != logical.ErrPermissionDenied {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+	request(logical.UpdateOperation, "sys/auth/userpass/tune", map[string]interface{}{
+		"user_lockout_config": map[string]interface{}{
+			"lockout_duration": "1ns",
+		},
+	})
+	if resp, err := login("foo"); err != nil || resp.Auth == nil {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+	resp = request(logical.ReadOperation, "sys/locked-users", nil)
+	if len(resp.Data["locked_users"].(map[string]interface{})) != 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestUserLockoutManager_prune(t *testing.T) {
+	m := &UserLockoutManager{
+		failed: make(map[string]*failedLogins),
+	}
+	me := &MountEntry{
+		UUID: "mount",
+		Config: MountConfig{
+			UserLockoutConfig: UserLockoutConfig{
+				LockoutThreshold:            10,
+				LockoutCounterResetDuration: time.Millisecond,
+			},
+		},
+	}
+
+	for _, user := range []string{"armon", "jeff", "mitchell"} {
+		if err := m.Failed(me, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(m.failed) != 3 {
+		t.Fatalf("bad: %#v", m.failed)
+	}
+
+	// Failed logins of other users are forgotten once they expire
+	time.Sleep(10 * time.Millisecond)
+	m.lastPruned = time.Time{}
+	if err := m.Failed(me, "armon"); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.failed) != 1 || m.failed["mount/armon"].count != 1 {
+		t.Fatalf("bad: %#v", m.failed)
+	}
+}